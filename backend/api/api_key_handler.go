@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"moongazing/models"
+	"moongazing/scanner/subdomain/thirdparty"
+	"moongazing/service"
+	"moongazing/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyHandler 工作空间第三方数据源密钥处理器
+type APIKeyHandler struct {
+	resultService *service.ResultService
+	apiKeys       *service.APIKeyService
+}
+
+// NewAPIKeyHandler 创建数据源密钥处理器
+func NewAPIKeyHandler() *APIKeyHandler {
+	return &APIKeyHandler{
+		resultService: service.NewResultService(),
+		apiKeys:       service.NewAPIKeyService(service.NewMongoAPIKeyStore(service.APIKeyEncryptionKey()), nil),
+	}
+}
+
+// keyWorkspace 解析并校验密钥所属的工作空间，未指定时为默认空间；write 为 true 时需要修改权限，修改默认空间的密钥需要管理员
+func (h *APIKeyHandler) keyWorkspace(c *gin.Context, write bool) (string, bool) {
+	var oid primitive.ObjectID
+	if workspaceID := c.Query("workspace_id"); workspaceID != "" {
+		var err error
+		if oid, err = primitive.ObjectIDFromHex(workspaceID); err != nil {
+			c.JSON(http.StatusBadRequest, utils.Response{
+				Code:    -1,
+				Message: "Invalid workspace_id",
+			})
+			return "", false
+		}
+	}
+	userID, role := currentUser(c)
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(oid, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return "", false
+	}
+	if write && oid.IsZero() && role != "admin" {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Code:    -1,
+			Message: "Only admin can change the default workspace settings",
+		})
+		return "", false
+	}
+	return oid.Hex(), true
+}
+
+// keyError 按错误类型返回响应
+func keyError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, utils.Response{
+		Code:    -1,
+		Message: err.Error(),
+	})
+}
+
+// ListAPIKeys 获取工作空间保存的数据源密钥（脱敏）
+// @Summary 获取第三方数据源密钥
+// @Tags ThirdParty
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间"
+// @Success 200 {object} Response
+// @Router /api/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	workspaceID, ok := h.keyWorkspace(c, false)
+	if !ok {
+		return
+	}
+	items, err := h.apiKeys.List(workspaceID)
+	if err != nil {
+		keyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"keys":      items,
+			"providers": thirdparty.KeyProviders,
+		},
+	})
+}
+
+// SaveAPIKey 保存工作空间的数据源密钥，key 为空或仍是脱敏值时保留原密钥
+// @Summary 保存第三方数据源密钥
+// @Tags ThirdParty
+// @Security ApiKeyAuth
+// @Param provider path string true "数据源：fofa, hunter, quake, securitytrails"
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间（仅管理员）"
+// @Param key body models.APIKey true "密钥、Fofa 邮箱、是否启用"
+// @Success 200 {object} Response
+// @Router /api/api-keys/{provider} [put]
+func (h *APIKeyHandler) SaveAPIKey(c *gin.Context) {
+	workspaceID, ok := h.keyWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	var item models.APIKey
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	item.WorkspaceID = workspaceID
+	item.Provider = c.Param("provider")
+	saved, err := h.apiKeys.Save(&item)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save api key: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "API key saved",
+		Data:    saved,
+	})
+}
+
+// DeleteAPIKey 删除工作空间的数据源密钥
+// @Summary 删除第三方数据源密钥
+// @Tags ThirdParty
+// @Security ApiKeyAuth
+// @Param provider path string true "数据源"
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间（仅管理员）"
+// @Success 200 {object} Response
+// @Router /api/api-keys/{provider} [delete]
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	workspaceID, ok := h.keyWorkspace(c, true)
+	if !ok {
+		return
+	}
+	if err := h.apiKeys.Delete(workspaceID, c.Param("provider")); err != nil {
+		keyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "API key deleted",
+	})
+}
+
+// ValidateAPIKey 用保存的密钥向数据源发送一次认证请求，返回密钥是否可用和剩余配额
+// @Summary 校验第三方数据源密钥
+// @Tags ThirdParty
+// @Security ApiKeyAuth
+// @Param provider path string true "数据源"
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间"
+// @Success 200 {object} Response
+// @Router /api/api-keys/{provider}/validate [post]
+func (h *APIKeyHandler) ValidateAPIKey(c *gin.Context) {
+	workspaceID, ok := h.keyWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	result, err := h.apiKeys.Validate(ctx, workspaceID, c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			keyError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadGateway, utils.Response{
+			Code:    -1,
+			Message: "Failed to validate api key: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    result,
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"strconv"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AssetHandler 工作空间资产处理器
+type AssetHandler struct {
+	assetService  *service.AssetService
+	resultService *service.ResultService
+	taskService   *service.TaskService
+}
+
+// NewAssetHandler 创建工作空间资产处理器
+func NewAssetHandler() *AssetHandler {
+	return &AssetHandler{
+		assetService:  service.NewAssetService(),
+		resultService: service.NewResultService(),
+		taskService:   service.NewTaskService(),
+	}
+}
+
+// assetQuery 资产查询的公共参数：分页、资产类型
+func assetQuery(c *gin.Context) (page, pageSize int, kinds []models.AssetKind, ok bool) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ = strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	kinds, err := service.ParseAssetKinds(splitQueryList(c.Query("kind")))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return 0, 0, nil, false
+	}
+	return page, pageSize, kinds, true
+}
+
+// authorizedWorkspace 解析 workspace_id 并校验访问权限，未指定时为默认空间
+func (h *AssetHandler) authorizedWorkspace(c *gin.Context) (primitive.ObjectID, bool) {
+	var workspaceID primitive.ObjectID
+	if wsID := c.Query("workspace_id"); wsID != "" {
+		oid, err := primitive.ObjectIDFromHex(wsID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return workspaceID, false
+		}
+		workspaceID = oid
+	}
+
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeWorkspace(workspaceID, userID, role); err != nil {
+		respondSearchError(c, err)
+		return workspaceID, false
+	}
+	return workspaceID, true
+}
+
+// ListAssets 列出工作空间资产
+// GET /api/assets?workspace_id=&kind=subdomain,port,web&live=true&page=&size=
+// live=true 时只返回有 HTTP 响应的 Web 资产
+func (h *AssetHandler) ListAssets(c *gin.Context) {
+	workspaceID, ok := h.authorizedWorkspace(c)
+	if !ok {
+		return
+	}
+	page, pageSize, kinds, ok := assetQuery(c)
+	if !ok {
+		return
+	}
+
+	var assets []*models.Asset
+	var total int64
+	var err error
+	if c.Query("live") == "true" {
+		assets, total, err = h.assetService.ListLiveWebAssets(workspaceID, page, pageSize)
+	} else {
+		assets, total, err = h.assetService.ListAssets(service.AssetFilter{WorkspaceID: workspaceID, Kinds: kinds}, page, pageSize)
+	}
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.SuccessWithPagination(c, assets, total, page, pageSize)
+}
+
+// ListStaleAssets 列出最近 N 天没有再被发现的资产
+// GET /api/assets/stale?workspace_id=&days=30&kind=&page=&size=
+func (h *AssetHandler) ListStaleAssets(c *gin.Context) {
+	workspaceID, ok := h.authorizedWorkspace(c)
+	if !ok {
+		return
+	}
+	page, pageSize, kinds, ok := assetQuery(c)
+	if !ok {
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil {
+		utils.BadRequest(c, "无效的天数")
+		return
+	}
+
+	assets, total, err := h.assetService.ListStaleAssets(workspaceID, days, kinds, page, pageSize)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.SuccessWithPagination(c, assets, total, page, pageSize)
+}
+
+// ListNewTaskAssets 列出任务相对工作空间已有资产新发现的资产
+// GET /api/tasks/:id/assets/new?kind=&page=&size=
+// 默认只返回子域名和端口；工作空间中已由其他任务发现过的资产不计入
+func (h *AssetHandler) ListNewTaskAssets(c *gin.Context) {
+	task, err := h.taskService.GetTaskByID(c.Param("id"))
+	if err != nil {
+		utils.NotFound(c, "任务不存在")
+		return
+	}
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeWorkspace(task.WorkspaceID, userID, role); err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	page, pageSize, kinds, ok := assetQuery(c)
+	if !ok {
+		return
+	}
+
+	assets, total, err := h.assetService.ListNewAssets(task, kinds, page, pageSize)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.SuccessWithPagination(c, assets, total, page, pageSize)
+}
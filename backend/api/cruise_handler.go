@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -66,22 +67,22 @@ func (h *CruiseHandler) CreateCruise(c *gin.Context) {
 	}
 
 	// 获取用户ID
-	userID, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		log.Printf("[CruiseHandler] User not authenticated")
 		utils.Error(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
-	userObjID, _ := primitive.ObjectIDFromHex(userID.(string))
+	userObjID, role := currentUser(c)
 	log.Printf("[CruiseHandler] UserID: %s", userObjID.Hex())
 
-	// 获取工作区ID（可选）
-	var workspaceID primitive.ObjectID
-	if wsID := c.GetHeader("X-Workspace-ID"); wsID != "" {
-		workspaceID, _ = primitive.ObjectIDFromHex(wsID)
-		log.Printf("[CruiseHandler] WorkspaceID: %s", workspaceID.Hex())
-	} else {
-		log.Printf("[CruiseHandler] No WorkspaceID provided")
+	// 获取工作区ID（可选），需要编辑权限
+	workspaceID, ok := workspaceHeader(c)
+	if !ok {
+		return
+	}
+	if err := h.cruiseService.AuthorizeWorkspace(workspaceID, userObjID, role, models.WorkspaceRoleEditor); err != nil {
+		respondWorkspaceError(c, err)
+		return
 	}
 
 	cruise, err := h.cruiseService.CreateCruise(&req, userObjID, workspaceID)
@@ -106,8 +107,7 @@ func (h *CruiseHandler) CreateCruise(c *gin.Context) {
 // @Router /api/v1/cruises/{id} [put]
 func (h *CruiseHandler) UpdateCruise(c *gin.Context) {
 	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
+	if _, ok := h.cruiseForUser(c, models.WorkspaceRoleEditor); !ok {
 		return
 	}
 
@@ -133,8 +133,7 @@ func (h *CruiseHandler) UpdateCruise(c *gin.Context) {
 // @Router /api/v1/cruises/{id} [delete]
 func (h *CruiseHandler) DeleteCruise(c *gin.Context) {
 	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
+	if _, ok := h.cruiseForUser(c, models.WorkspaceRoleEditor); !ok {
 		return
 	}
 
@@ -153,15 +152,8 @@ func (h *CruiseHandler) DeleteCruise(c *gin.Context) {
 // @Success 200 {object} utils.Response
 // @Router /api/v1/cruises/{id} [get]
 func (h *CruiseHandler) GetCruise(c *gin.Context) {
-	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
-		return
-	}
-
-	cruise, err := h.cruiseService.GetCruise(cruiseID)
-	if err != nil {
-		utils.Error(c, http.StatusNotFound, "Cruise not found")
+	cruise, ok := h.cruiseForUser(c, models.WorkspaceRoleViewer)
+	if !ok {
 		return
 	}
 
@@ -188,13 +180,13 @@ func (h *CruiseHandler) ListCruises(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// 获取工作区ID（可选）
-	var workspaceID primitive.ObjectID
-	if wsID := c.GetHeader("X-Workspace-ID"); wsID != "" {
-		workspaceID, _ = primitive.ObjectIDFromHex(wsID)
+	filter, ok := h.cruiseScope(c)
+	if !ok {
+		return
 	}
+	filter.Search = search
 
-	cruises, total, err := h.cruiseService.ListCruises(workspaceID, page, pageSize, search)
+	cruises, total, err := h.cruiseService.ListCruises(filter, page, pageSize)
 	if err != nil {
 		utils.Error(c, http.StatusInternalServerError, "Failed to list cruises: "+err.Error())
 		return
@@ -216,8 +208,7 @@ func (h *CruiseHandler) ListCruises(c *gin.Context) {
 // @Router /api/v1/cruises/{id}/enable [post]
 func (h *CruiseHandler) EnableCruise(c *gin.Context) {
 	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
+	if _, ok := h.cruiseForUser(c, models.WorkspaceRoleEditor); !ok {
 		return
 	}
 
@@ -237,8 +228,7 @@ func (h *CruiseHandler) EnableCruise(c *gin.Context) {
 // @Router /api/v1/cruises/{id}/disable [post]
 func (h *CruiseHandler) DisableCruise(c *gin.Context) {
 	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
+	if _, ok := h.cruiseForUser(c, models.WorkspaceRoleEditor); !ok {
 		return
 	}
 
@@ -258,12 +248,15 @@ func (h *CruiseHandler) DisableCruise(c *gin.Context) {
 // @Router /api/v1/cruises/{id}/run [post]
 func (h *CruiseHandler) RunNow(c *gin.Context) {
 	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
+	if _, ok := h.cruiseForUser(c, models.WorkspaceRoleEditor); !ok {
 		return
 	}
 
 	if err := h.cruiseService.RunNow(cruiseID); err != nil {
+		if errors.Is(err, service.ErrCruiseOverlap) {
+			utils.Error(c, http.StatusConflict, "Previous cruise run is still in progress")
+			return
+		}
 		utils.Error(c, http.StatusInternalServerError, "Failed to run cruise: "+err.Error())
 		return
 	}
@@ -281,8 +274,7 @@ func (h *CruiseHandler) RunNow(c *gin.Context) {
 // @Router /api/v1/cruises/{id}/logs [get]
 func (h *CruiseHandler) GetCruiseLogs(c *gin.Context) {
 	cruiseID := c.Param("id")
-	if cruiseID == "" {
-		utils.Error(c, http.StatusBadRequest, "Cruise ID is required")
+	if _, ok := h.cruiseForUser(c, models.WorkspaceRoleViewer); !ok {
 		return
 	}
 
@@ -316,12 +308,76 @@ func (h *CruiseHandler) GetCruiseLogs(c *gin.Context) {
 // @Success 200 {object} utils.Response
 // @Router /api/v1/cruises/stats [get]
 func (h *CruiseHandler) GetCruiseStats(c *gin.Context) {
-	// 获取工作区ID（可选）
-	var workspaceID primitive.ObjectID
-	if wsID := c.GetHeader("X-Workspace-ID"); wsID != "" {
-		workspaceID, _ = primitive.ObjectIDFromHex(wsID)
+	filter, ok := h.cruiseScope(c)
+	if !ok {
+		return
 	}
 
-	stats := h.cruiseService.GetStats(workspaceID)
+	stats := h.cruiseService.GetStats(filter)
 	utils.Success(c, stats)
 }
+
+// workspaceHeader 解析 X-Workspace-ID 请求头，未设置时为默认空间
+func workspaceHeader(c *gin.Context) (primitive.ObjectID, bool) {
+	wsID := c.GetHeader("X-Workspace-ID")
+	if wsID == "" {
+		return primitive.NilObjectID, true
+	}
+	workspaceID, err := primitive.ObjectIDFromHex(wsID)
+	if err != nil {
+		utils.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+		return primitive.NilObjectID, false
+	}
+	return workspaceID, true
+}
+
+// cruiseScope 列表和统计的工作空间范围：指定工作空间时校验查看权限，未指定时只包含用户可以查看的工作空间
+func (h *CruiseHandler) cruiseScope(c *gin.Context) (service.CruiseListFilter, bool) {
+	var filter service.CruiseListFilter
+	userID, role := currentUser(c)
+	if c.GetHeader("X-Workspace-ID") != "" {
+		workspaceID, ok := workspaceHeader(c)
+		if !ok {
+			return filter, false
+		}
+		if err := h.cruiseService.AuthorizeWorkspace(workspaceID, userID, role, models.WorkspaceRoleViewer); err != nil {
+			respondWorkspaceError(c, err)
+			return filter, false
+		}
+		filter.WorkspaceID = workspaceID
+		return filter, true
+	}
+
+	ids, all, err := h.cruiseService.VisibleWorkspaceIDs(userID, role)
+	if err != nil {
+		utils.Error(c, http.StatusInternalServerError, err.Error())
+		return filter, false
+	}
+	if !all {
+		filter.WorkspaceIDs = ids
+	}
+	return filter, true
+}
+
+// cruiseForUser 获取路径中的巡航任务并校验用户的权限，失败时已写入响应
+func (h *CruiseHandler) cruiseForUser(c *gin.Context, need models.WorkspaceRole) (*models.CruiseTask, bool) {
+	userID, role := currentUser(c)
+	cruise, err := h.cruiseService.GetCruiseForUser(c.Param("id"), userID, role, need)
+	if err != nil {
+		respondCruiseError(c, err)
+		return nil, false
+	}
+	return cruise, true
+}
+
+// respondCruiseError 看不到的巡航任务按不存在返回，与任务一致；只读成员修改时返回 403
+func respondCruiseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCruiseNotFound), errors.Is(err, service.ErrWorkspaceNotFound):
+		utils.Error(c, http.StatusNotFound, "Cruise not found")
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		utils.Error(c, http.StatusForbidden, err.Error())
+	default:
+		utils.Error(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -7,32 +7,40 @@ import (
 	"moongazing/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type DashboardHandler struct {
-	taskService *service.TaskService
-	vulnService *service.VulnService
-	nodeService *service.NodeService
+	taskService   *service.TaskService
+	vulnService   *service.VulnService
+	nodeService   *service.NodeService
+	statsService  *service.StatsService
+	resultService *service.ResultService
 }
 
 func NewDashboardHandler() *DashboardHandler {
 	return &DashboardHandler{
-		taskService:  service.NewTaskService(),
-		vulnService:  service.NewVulnService(),
-		nodeService:  service.NewNodeService(),
+		taskService:   service.NewTaskService(),
+		vulnService:   service.NewVulnService(),
+		nodeService:   service.NewNodeService(),
+		statsService:  service.NewStatsService(),
+		resultService: service.NewResultService(),
 	}
 }
 
 // GetDashboardStats returns dashboard statistics
 // GET /api/dashboard/stats
 func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
-	workspaceID := c.Query("workspace_id")
+	workspaceID, ids, ok := workspaceQueryScope(c, h.taskService)
+	if !ok {
+		return
+	}
 	
 	// Get task stats
-	taskStats, _ := h.taskService.GetTaskStats(workspaceID)
+	taskStats, _ := h.taskService.GetTaskStatsByFilter(service.TaskListFilter{WorkspaceID: workspaceID, WorkspaceIDs: ids})
 	
 	// Get vulnerability stats
-	vulnStats, _ := h.vulnService.GetVulnStats(workspaceID)
+	vulnStats, _ := h.vulnService.GetVulnStatsByFilter(service.VulnListFilter{WorkspaceID: workspaceID, WorkspaceIDs: ids})
 	
 	// Get node stats
 	nodeStats, _ := h.nodeService.GetNodeStats()
@@ -48,10 +56,13 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 // GetRecentTasks returns recent tasks
 // GET /api/dashboard/recent-tasks
 func (h *DashboardHandler) GetRecentTasks(c *gin.Context) {
-	workspaceID := c.Query("workspace_id")
+	workspaceID, ids, ok := workspaceQueryScope(c, h.taskService)
+	if !ok {
+		return
+	}
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	
-	tasks, _, err := h.taskService.ListTasks(workspaceID, "", "", 1, limit)
+	tasks, _, err := h.taskService.ListTasksByFilter(service.TaskListFilter{WorkspaceID: workspaceID, WorkspaceIDs: ids}, 1, limit)
 	if err != nil {
 		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
 		return
@@ -63,10 +74,13 @@ func (h *DashboardHandler) GetRecentTasks(c *gin.Context) {
 // GetRecentVulnerabilities returns recent vulnerabilities
 // GET /api/dashboard/recent-vulns
 func (h *DashboardHandler) GetRecentVulnerabilities(c *gin.Context) {
-	workspaceID := c.Query("workspace_id")
+	workspaceID, ids, ok := workspaceQueryScope(c, h.taskService)
+	if !ok {
+		return
+	}
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	
-	vulns, _, err := h.vulnService.ListVulnerabilities(workspaceID, "", "", "", 1, limit)
+	vulns, _, err := h.vulnService.ListVulnerabilitiesByFilter(service.VulnListFilter{WorkspaceID: workspaceID, WorkspaceIDs: ids}, 1, limit)
 	if err != nil {
 		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
 		return
@@ -123,3 +137,88 @@ func (h *DashboardHandler) GetRecentActivities(c *gin.Context) {
 
 	utils.Success(c, activities)
 }
+
+// statsQuery 解析统计的工作空间和时间范围（start、end）并校验访问权限，未指定工作空间时为默认空间
+func (h *DashboardHandler) statsQuery(c *gin.Context) (primitive.ObjectID, service.StatsRange, bool) {
+	var workspaceID primitive.ObjectID
+	if wsID := c.Query("workspace_id"); wsID != "" {
+		oid, err := primitive.ObjectIDFromHex(wsID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return workspaceID, service.StatsRange{}, false
+		}
+		workspaceID = oid
+	}
+	r, err := service.ParseStatsRange(c.Query("start"), c.Query("end"))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return workspaceID, r, false
+	}
+
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeWorkspace(workspaceID, userID, role); err != nil {
+		respondSearchError(c, err)
+		return workspaceID, r, false
+	}
+	return workspaceID, r, true
+}
+
+// GetWorkspaceOverview returns asset and vulnerability totals plus new assets of the last 7 days
+// GET /api/dashboard/overview?workspace_id=&start=&end=
+func (h *DashboardHandler) GetWorkspaceOverview(c *gin.Context) {
+	workspaceID, r, ok := h.statsQuery(c)
+	if !ok {
+		return
+	}
+	overview, err := h.statsService.GetWorkspaceOverview(workspaceID, r)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.Success(c, overview)
+}
+
+// GetSeverityBreakdown returns vulnerability counts ordered critical > high > medium > low > info
+// GET /api/dashboard/severity?workspace_id=&start=&end=
+func (h *DashboardHandler) GetSeverityBreakdown(c *gin.Context) {
+	workspaceID, r, ok := h.statsQuery(c)
+	if !ok {
+		return
+	}
+	breakdown, err := h.statsService.GetSeverityBreakdown(workspaceID, r)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.Success(c, breakdown)
+}
+
+// GetTopTechnologies returns the 10 most common technologies across workspace assets
+// GET /api/dashboard/technologies?workspace_id=&start=&end=
+func (h *DashboardHandler) GetTopTechnologies(c *gin.Context) {
+	workspaceID, r, ok := h.statsQuery(c)
+	if !ok {
+		return
+	}
+	techs, err := h.statsService.GetTopTechnologies(workspaceID, r)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.Success(c, techs)
+}
+
+// GetDailyTaskCounts returns tasks completed per day for the trend chart
+// GET /api/dashboard/task-trend?workspace_id=&start=&end=
+func (h *DashboardHandler) GetDailyTaskCounts(c *gin.Context) {
+	workspaceID, r, ok := h.statsQuery(c)
+	if !ok {
+		return
+	}
+	daily, err := h.statsService.GetDailyTaskCounts(workspaceID, r)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.Success(c, daily)
+}
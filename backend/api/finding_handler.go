@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindingHandler 工作空间漏洞处理器
+type FindingHandler struct {
+	findingService *service.FindingService
+	resultService  *service.ResultService
+}
+
+// NewFindingHandler 创建工作空间漏洞处理器
+func NewFindingHandler() *FindingHandler {
+	return &FindingHandler{
+		findingService: service.NewFindingService(),
+		resultService:  service.NewResultService(),
+	}
+}
+
+// authorize 校验当前用户对漏洞所在工作空间的权限，write 为 true 时需要修改权限
+func (h *FindingHandler) authorize(c *gin.Context, workspaceID primitive.ObjectID, write bool) bool {
+	userID, role := currentUser(c)
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(workspaceID, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return false
+	}
+	return true
+}
+
+// ListFindings 列出工作空间漏洞
+// GET /api/findings?workspace_id=&status=open,fixed&severity=&target=&possibly_fixed=true&page=&size=
+func (h *FindingHandler) ListFindings(c *gin.Context) {
+	var workspaceID primitive.ObjectID
+	if wsID := c.Query("workspace_id"); wsID != "" {
+		oid, err := primitive.ObjectIDFromHex(wsID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return
+		}
+		workspaceID = oid
+	}
+	if !h.authorize(c, workspaceID, false) {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	statuses, err := service.ParseFindingStatuses(splitQueryList(c.Query("status")))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	findings, total, err := h.findingService.ListFindings(service.FindingFilter{
+		WorkspaceID:   workspaceID,
+		Statuses:      statuses,
+		Severity:      c.Query("severity"),
+		Target:        c.Query("target"),
+		PossiblyFixed: c.Query("possibly_fixed") == "true",
+	}, page, pageSize)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	utils.SuccessWithPagination(c, findings, total, page, pageSize)
+}
+
+// GetFinding 获取漏洞详情，包括状态变更记录
+// GET /api/findings/:id
+func (h *FindingHandler) GetFinding(c *gin.Context) {
+	finding, err := h.findingService.GetFinding(c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	if !h.authorize(c, finding.WorkspaceID, false) {
+		return
+	}
+	utils.Success(c, finding)
+}
+
+// UpdateFindingStatus 变更漏洞状态
+// PUT /api/findings/:id/status  {"status": "accepted", "note": "内网测试环境"}
+func (h *FindingHandler) UpdateFindingStatus(c *gin.Context) {
+	var req struct {
+		Status models.FindingStatus `json:"status" binding:"required"`
+		Note   string               `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	finding, err := h.findingService.GetFinding(c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	if !h.authorize(c, finding.WorkspaceID, true) {
+		return
+	}
+
+	username, _ := c.Get("username")
+	by, _ := username.(string)
+	updated, err := h.findingService.ChangeStatus(c.Param("id"), req.Status, req.Note, by)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "状态已更新", updated)
+}
+
+// respondError 按错误类型返回响应
+func (h *FindingHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrFindingNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrFindingStatusConflict):
+		utils.Error(c, utils.ErrCodeDuplicate, err.Error())
+	default:
+		utils.BadRequest(c, err.Error())
+	}
+}
@@ -1,17 +1,23 @@
 package api
 
 import (
+	"errors"
+	"moongazing/service"
 	"moongazing/service/notify"
 	"moongazing/utils"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // NotifyHandler 通知处理器
 type NotifyHandler struct {
-	manager *notify.NotifyManager
+	manager       *notify.NotifyManager
+	resultService *service.ResultService
+	findingRules  service.FindingRuleStore
+	channels      *service.NotifyChannelService
 }
 
 // NewNotifyHandler 创建通知处理器
@@ -19,7 +25,10 @@ func NewNotifyHandler() *NotifyHandler {
 	// 使用全局通知管理器
 	manager := notify.GetGlobalManager()
 	return &NotifyHandler{
-		manager: manager,
+		manager:       manager,
+		resultService: service.NewResultService(),
+		findingRules:  service.NewMongoFindingRuleStore(),
+		channels:      service.NewNotifyChannelService(service.NewMongoNotifyChannelStore(service.NotifyChannelKey()), manager),
 	}
 }
 
@@ -39,9 +48,7 @@ func (h *NotifyHandler) GetConfigs(c *gin.Context) {
 	
 	// 隐藏敏感信息
 	for i := range configs {
-		configs[i].DingTalkSecret = maskSecret(configs[i].DingTalkSecret)
-		configs[i].FeishuSecret = maskSecret(configs[i].FeishuSecret)
-		configs[i].SMTPPassword = maskSecret(configs[i].SMTPPassword)
+		configs[i] = configs[i].Masked()
 	}
 	
 	c.JSON(http.StatusOK, utils.Response{
@@ -267,6 +274,379 @@ func (h *NotifyHandler) GetHistory(c *gin.Context) {
 	})
 }
 
+// GetDeliveries 获取通知投递状态
+// @Summary 获取通知投递状态
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时仅管理员可查询全部"
+// @Param status query string false "投递状态 pending/delivered/failed"
+// @Param limit query int false "返回数量限制"
+// @Success 200 {object} Response
+// @Router /api/notify/deliveries [get]
+func (h *NotifyHandler) GetDeliveries(c *gin.Context) {
+	userID, role := currentUser(c)
+	workspaceID := c.Query("workspace_id")
+	if workspaceID == "" {
+		if role != "admin" {
+			c.JSON(http.StatusForbidden, utils.Response{
+				Code:    -1,
+				Message: "workspace_id is required",
+			})
+			return
+		}
+	} else {
+		oid, err := primitive.ObjectIDFromHex(workspaceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.Response{
+				Code:    -1,
+				Message: "Invalid workspace_id",
+			})
+			return
+		}
+		if err := h.resultService.AuthorizeWorkspace(oid, userID, role); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+	}
+	
+	status := notify.DeliveryStatus(c.Query("status"))
+	switch status {
+	case "", notify.DeliveryPending, notify.DeliveryDelivered, notify.DeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid status",
+		})
+		return
+	}
+	
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	
+	deliveries, err := h.manager.Deliveries(c.Request.Context(), notify.DeliveryFilter{
+		WorkspaceID: workspaceID,
+		Status:      status,
+		Limit:       limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, utils.Response{
+			Code:    -1,
+			Message: "Failed to query deliveries: " + err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    deliveries,
+	})
+}
+
+// findingRuleWorkspace 解析并校验规则所属的工作空间，未指定时为默认空间；write 为 true 时需要修改权限
+func (h *NotifyHandler) findingRuleWorkspace(c *gin.Context, write bool) (string, bool) {
+	var oid primitive.ObjectID
+	if workspaceID := c.Query("workspace_id"); workspaceID != "" {
+		var err error
+		if oid, err = primitive.ObjectIDFromHex(workspaceID); err != nil {
+			c.JSON(http.StatusBadRequest, utils.Response{
+				Code:    -1,
+				Message: "Invalid workspace_id",
+			})
+			return "", false
+		}
+	}
+	userID, role := currentUser(c)
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(oid, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return "", false
+	}
+	return oid.Hex(), true
+}
+
+// GetFindingRule 获取工作空间的漏洞即时通知规则
+// @Summary 获取漏洞即时通知规则
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间"
+// @Success 200 {object} Response
+// @Router /api/notify/finding-rule [get]
+func (h *NotifyHandler) GetFindingRule(c *gin.Context) {
+	workspaceID, ok := h.findingRuleWorkspace(c, false)
+	if !ok {
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    service.LoadFindingRule(h.findingRules, workspaceID),
+	})
+}
+
+// UpdateFindingRule 更新工作空间的漏洞即时通知规则
+// @Summary 更新漏洞即时通知规则
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间（仅管理员）"
+// @Param rule body notify.FindingRule true "最低严重程度、时间窗口内的通知上限、是否去重"
+// @Success 200 {object} Response
+// @Router /api/notify/finding-rule [put]
+func (h *NotifyHandler) UpdateFindingRule(c *gin.Context) {
+	workspaceID, ok := h.findingRuleWorkspace(c, true)
+	if !ok {
+		return
+	}
+	if _, role := currentUser(c); c.Query("workspace_id") == "" && role != "admin" {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Code:    -1,
+			Message: "Only admin can change the default workspace rule",
+		})
+		return
+	}
+	
+	var rule notify.FindingRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	rule.WorkspaceID = workspaceID
+	if err := service.SaveFindingRule(h.findingRules, &rule); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save finding rule: " + err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Finding rule updated",
+		Data:    &rule,
+	})
+}
+
+// channelWorkspace 校验当前用户能否查看（write 为 false）或管理工作空间的渠道，workspaceID 为空（全局渠道）时仅管理员
+func (h *NotifyHandler) channelWorkspace(c *gin.Context, workspaceID string, write bool) bool {
+	userID, role := currentUser(c)
+	if workspaceID == "" {
+		if role != "admin" {
+			c.JSON(http.StatusForbidden, utils.Response{
+				Code:    -1,
+				Message: "Only admin can manage global channels",
+			})
+			return false
+		}
+		return true
+	}
+	oid, err := primitive.ObjectIDFromHex(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid workspace_id",
+		})
+		return false
+	}
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(oid, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return false
+	}
+	return true
+}
+
+// storedChannel 读取路径中的渠道并校验工作空间的修改权限
+func (h *NotifyHandler) storedChannel(c *gin.Context) (*notify.NotifyConfig, bool) {
+	channel, err := h.channels.Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrNotifyChannelNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, utils.Response{
+			Code:    -1,
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+	if !h.channelWorkspace(c, channel.WorkspaceID, true) {
+		return nil, false
+	}
+	return channel, true
+}
+
+// ListChannels 获取工作空间的通知渠道
+// @Summary 获取通知渠道列表
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为全局渠道（仅管理员）"
+// @Success 200 {object} Response
+// @Router /api/notify/channels [get]
+func (h *NotifyHandler) ListChannels(c *gin.Context) {
+	workspaceID := c.Query("workspace_id")
+	if !h.channelWorkspace(c, workspaceID, false) {
+		return
+	}
+	
+	channels, err := h.channels.List(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Response{
+			Code:    -1,
+			Message: "Failed to list channels: " + err.Error(),
+		})
+		return
+	}
+	masked := make([]notify.NotifyConfig, 0, len(channels))
+	for _, channel := range channels {
+		masked = append(masked, channel.Masked())
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    masked,
+	})
+}
+
+// CreateChannel 创建通知渠道，配置加密保存
+// @Summary 创建通知渠道
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param config body notify.NotifyConfig true "渠道配置，workspace_id 为空时为全局渠道（仅管理员）"
+// @Success 200 {object} Response
+// @Router /api/notify/channels [post]
+func (h *NotifyHandler) CreateChannel(c *gin.Context) {
+	var config notify.NotifyConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if !h.channelWorkspace(c, config.WorkspaceID, true) {
+		return
+	}
+	
+	if err := h.channels.Create(&config); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save channel: " + err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Channel created",
+		Data:    config.Masked(),
+	})
+}
+
+// UpdateChannel 更新通知渠道，敏感字段提交脱敏值时保留原值
+// @Summary 更新通知渠道
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param id path string true "渠道ID"
+// @Param config body notify.NotifyConfig true "渠道配置"
+// @Success 200 {object} Response
+// @Router /api/notify/channels/{id} [put]
+func (h *NotifyHandler) UpdateChannel(c *gin.Context) {
+	channel, ok := h.storedChannel(c)
+	if !ok {
+		return
+	}
+	
+	var config notify.NotifyConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	
+	if err := h.channels.Update(channel.ID, &config); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save channel: " + err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Channel updated",
+		Data:    config.Masked(),
+	})
+}
+
+// DeleteChannel 删除通知渠道
+// @Summary 删除通知渠道
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param id path string true "渠道ID"
+// @Success 200 {object} Response
+// @Router /api/notify/channels/{id} [delete]
+func (h *NotifyHandler) DeleteChannel(c *gin.Context) {
+	channel, ok := h.storedChannel(c)
+	if !ok {
+		return
+	}
+	
+	if err := h.channels.Delete(channel.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Response{
+			Code:    -1,
+			Message: "Failed to delete channel: " + err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Channel deleted",
+	})
+}
+
+// TestChannel 通过已保存的渠道发送测试消息
+// @Summary 测试通知渠道
+// @Tags Notify
+// @Security ApiKeyAuth
+// @Param id path string true "渠道ID"
+// @Success 200 {object} Response
+// @Router /api/notify/channels/{id}/test [post]
+func (h *NotifyHandler) TestChannel(c *gin.Context) {
+	channel, ok := h.storedChannel(c)
+	if !ok {
+		return
+	}
+	
+	if err := h.channels.Test(channel.ID); err != nil {
+		c.JSON(http.StatusOK, utils.Response{
+			Code:    -1,
+			Message: "Test failed: " + err.Error(),
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Test notification sent successfully",
+	})
+}
+
 // GetSupportedTypes 获取支持的通知类型
 // @Summary 获取支持的通知类型
 // @Tags Notify
@@ -314,6 +694,16 @@ func (h *NotifyHandler) GetSupportedTypes(c *gin.Context) {
 				{"key": "email_to", "label": "收件人地址(多个用逗号分隔)", "type": "text", "required": "true"},
 			},
 		},
+		{
+			"type":        "telegram",
+			"name":        "Telegram 机器人",
+			"description": "通过 Telegram Bot API 发送通知",
+			"fields": []map[string]string{
+				{"key": "telegram_bot_token", "label": "Bot Token", "type": "password", "required": "true"},
+				{"key": "telegram_chat_id", "label": "Chat ID", "type": "text", "required": "true"},
+				{"key": "telegram_api_url", "label": "Bot API 地址", "type": "text", "required": "false"},
+			},
+		},
 		{
 			"type":        "webhook",
 			"name":        "自定义 Webhook",
@@ -333,13 +723,3 @@ func (h *NotifyHandler) GetSupportedTypes(c *gin.Context) {
 	})
 }
 
-// maskSecret 隐藏敏感信息
-func maskSecret(s string) string {
-	if s == "" {
-		return ""
-	}
-	if len(s) <= 8 {
-		return "****"
-	}
-	return s[:4] + "****" + s[len(s)-4:]
-}
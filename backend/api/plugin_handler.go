@@ -1,9 +1,17 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"moongazing/models"
+	"moongazing/scanner/fingerprint"
 	"moongazing/service"
 	"moongazing/utils"
 
@@ -12,7 +20,9 @@ import (
 )
 
 type PluginHandler struct {
-	pluginService *service.PluginService
+	pluginService  *service.PluginService
+	ruleTester     *fingerprint.FingerprintScanner // 规则试运行使用的扫描器，首次使用时创建
+	ruleTesterOnce sync.Once
 }
 
 func NewPluginHandler() *PluginHandler {
@@ -265,6 +275,165 @@ func (h *PluginHandler) DeleteFingerprintRule(c *gin.Context) {
 	utils.SuccessWithMessage(c, "删除成功", nil)
 }
 
+// GetFingerprintRulesStatus returns loaded DSL rules count and the last validation report
+// GET /api/fingerprints/rules/status
+func (h *PluginHandler) GetFingerprintRulesStatus(c *gin.Context) {
+	utils.Success(c, fingerprint.DefaultRulesStatus())
+}
+
+// ReloadFingerprintRules reloads DSL rule files and returns the validation report
+// POST /api/fingerprints/rules/reload
+func (h *PluginHandler) ReloadFingerprintRules(c *gin.Context) {
+	report, err := fingerprint.ReloadDefaultRules()
+	if err != nil {
+		// 严格模式下保留原有规则，返回报告便于规则作者定位问题
+		c.JSON(http.StatusUnprocessableEntity, utils.Response{
+			Code:    utils.ErrCodeConfigError,
+			Message: "指纹规则校验失败，已保留原有规则: " + err.Error(),
+			Data:    report,
+		})
+		return
+	}
+
+	message := "重新加载成功"
+	if report.HasErrors() {
+		message = fmt.Sprintf("重新加载成功，跳过 %d 条错误规则", report.Skipped)
+	}
+	utils.SuccessWithMessage(c, message, report)
+}
+
+// ListDSLRules lists loaded DSL rules, filtered by keyword, category and custom
+// GET /api/fingerprints/rules
+func (h *PluginHandler) ListDSLRules(c *gin.Context) {
+	keyword := strings.ToLower(c.Query("keyword"))
+	category := c.Query("category")
+	customOnly := c.Query("custom") == "true"
+
+	rules := []fingerprint.RuleDefinition{}
+	for _, rule := range fingerprint.DefaultDSLEngine().RuleDefinitions() {
+		if keyword != "" && !strings.Contains(strings.ToLower(rule.Name), keyword) {
+			continue
+		}
+		if category != "" && rule.Category != category {
+			continue
+		}
+		if customOnly && !rule.Custom {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	utils.Success(c, gin.H{"list": rules, "total": len(rules)})
+}
+
+// GetDSLRule returns a loaded DSL rule by name
+// GET /api/fingerprints/rules/:name
+func (h *PluginHandler) GetDSLRule(c *gin.Context) {
+	rule, ok := fingerprint.DefaultDSLEngine().RuleDefinition(c.Param("name"))
+	if !ok {
+		utils.NotFound(c, "规则不存在")
+		return
+	}
+	utils.Success(c, rule)
+}
+
+// ValidateDSLRule checks a submitted rule without loading it
+// POST /api/fingerprints/rules/validate
+func (h *PluginHandler) ValidateDSLRule(c *gin.Context) {
+	var rule fingerprint.RuleDefinition
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+	problems := fingerprint.CheckRule(&rule)
+	if problems == nil {
+		problems = []string{}
+	}
+	utils.Success(c, gin.H{"valid": len(problems) == 0, "problems": problems})
+}
+
+// TestDSLRule runs a submitted rule against a URL
+// POST /api/fingerprints/rules/test
+func (h *PluginHandler) TestDSLRule(c *gin.Context) {
+	var req struct {
+		URL  string                     `json:"url" binding:"required"`
+		Rule fingerprint.RuleDefinition `json:"rule"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+	if req.Rule.Name == "" {
+		req.Rule.Name = "test"
+	}
+	if problems := fingerprint.CheckRule(&req.Rule); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    utils.ErrCodeInvalidParams,
+			Message: "规则校验失败",
+			Data:    gin.H{"problems": problems},
+		})
+		return
+	}
+
+	h.ruleTesterOnce.Do(func() {
+		h.ruleTester = fingerprint.NewFingerprintScanner(1)
+	})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	utils.Success(c, h.ruleTester.TestRuleOnURL(ctx, req.Rule.Rule(), req.URL))
+}
+
+// SaveCustomDSLRule validates a rule, saves it to the custom rules file and reloads the rules
+// POST /api/fingerprints/rules/custom
+func (h *PluginHandler) SaveCustomDSLRule(c *gin.Context) {
+	var rule fingerprint.RuleDefinition
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	report, err := fingerprint.SaveCustomRule(&rule)
+	var invalid *fingerprint.InvalidRuleError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    utils.ErrCodeInvalidParams,
+			Message: "规则校验失败",
+			Data:    gin.H{"problems": invalid.Problems},
+		})
+	case report != nil && err != nil:
+		// 规则已保存，但严格模式下其他规则文件有错误，保留原有规则
+		c.JSON(http.StatusUnprocessableEntity, utils.Response{
+			Code:    utils.ErrCodeConfigError,
+			Message: "规则已保存，但指纹规则校验失败，已保留原有规则: " + err.Error(),
+			Data:    report,
+		})
+	case err != nil:
+		utils.Error(c, utils.ErrCodeInternalError, "保存规则失败: "+err.Error())
+	default:
+		utils.SuccessWithMessage(c, "保存成功", report)
+	}
+}
+
+// DeleteCustomDSLRule removes a rule from the custom rules file and reloads the rules
+// DELETE /api/fingerprints/rules/custom/:name
+func (h *PluginHandler) DeleteCustomDSLRule(c *gin.Context) {
+	report, err := fingerprint.DeleteCustomRule(c.Param("name"))
+	switch {
+	case errors.Is(err, fingerprint.ErrRuleNotFound):
+		utils.NotFound(c, "自定义规则不存在")
+	case report != nil && err != nil:
+		c.JSON(http.StatusUnprocessableEntity, utils.Response{
+			Code:    utils.ErrCodeConfigError,
+			Message: "规则已删除，但指纹规则校验失败，已保留原有规则: " + err.Error(),
+			Data:    report,
+		})
+	case err != nil:
+		utils.Error(c, utils.ErrCodeInternalError, "删除规则失败: "+err.Error())
+	default:
+		utils.SuccessWithMessage(c, "删除成功", report)
+	}
+}
+
 // ListDictionaries lists dictionaries
 // GET /api/dictionaries
 func (h *PluginHandler) ListDictionaries(c *gin.Context) {
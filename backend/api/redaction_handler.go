@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RedactionHandler 脱敏策略处理器
+type RedactionHandler struct {
+	redactionService *service.RedactionService
+}
+
+// NewRedactionHandler 创建脱敏策略处理器
+func NewRedactionHandler() *RedactionHandler {
+	return &RedactionHandler{
+		redactionService: service.NewRedactionService(),
+	}
+}
+
+// redactionPolicyRequest 创建、更新策略的请求
+type redactionPolicyRequest struct {
+	Name         string                 `json:"name" binding:"required"`
+	Description  string                 `json:"description"`
+	WorkspaceID  string                 `json:"workspace_id"`
+	DropFields   []string               `json:"drop_fields"`
+	MaskFields   []models.RedactionMask `json:"mask_fields"`
+	ExcludeTypes []models.ResultType    `json:"exclude_types"`
+	MaskSecrets  bool                   `json:"mask_secrets"`
+}
+
+func (r *redactionPolicyRequest) policy() *models.RedactionPolicy {
+	return &models.RedactionPolicy{
+		Name:         r.Name,
+		Description:  r.Description,
+		DropFields:   r.DropFields,
+		MaskFields:   r.MaskFields,
+		ExcludeTypes: r.ExcludeTypes,
+		MaskSecrets:  r.MaskSecrets,
+	}
+}
+
+// respondRedactionError 按错误类型返回响应
+func respondRedactionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWorkspaceNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		utils.Forbidden(c, err.Error())
+	case errors.Is(err, service.ErrRedactionPolicyNotFound):
+		utils.NotFound(c, err.Error())
+	default:
+		utils.BadRequest(c, err.Error())
+	}
+}
+
+// ListRedactionPolicies 列出内置策略和工作空间的策略
+// GET /api/redaction-policies?workspace_id=
+func (h *RedactionHandler) ListRedactionPolicies(c *gin.Context) {
+	var workspaceID primitive.ObjectID
+	if wsID := c.Query("workspace_id"); wsID != "" {
+		oid, err := primitive.ObjectIDFromHex(wsID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return
+		}
+		workspaceID = oid
+	}
+
+	userID, role := currentUser(c)
+	policies, err := h.redactionService.ListRedactionPolicies(workspaceID, userID, role)
+	if err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+	utils.Success(c, policies)
+}
+
+// CreateRedactionPolicy 创建策略
+// POST /api/redaction-policies
+func (h *RedactionHandler) CreateRedactionPolicy(c *gin.Context) {
+	var req redactionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	policy := req.policy()
+	if req.WorkspaceID != "" {
+		oid, err := primitive.ObjectIDFromHex(req.WorkspaceID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return
+		}
+		policy.WorkspaceID = oid
+	}
+
+	userID, role := currentUser(c)
+	if err := h.redactionService.CreateRedactionPolicy(policy, userID, role); err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "保存成功", policy)
+}
+
+// GetRedactionPolicy 获取策略详情，内置策略使用名称
+// GET /api/redaction-policies/:id
+func (h *RedactionHandler) GetRedactionPolicy(c *gin.Context) {
+	userID, role := currentUser(c)
+	policy, err := h.redactionService.GetRedactionPolicy(c.Param("id"), userID, role)
+	if err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+	utils.Success(c, policy)
+}
+
+// UpdateRedactionPolicy 更新策略
+// PUT /api/redaction-policies/:id
+func (h *RedactionHandler) UpdateRedactionPolicy(c *gin.Context) {
+	var req redactionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	userID, role := currentUser(c)
+	policy, err := h.redactionService.UpdateRedactionPolicy(c.Param("id"), req.policy(), userID, role)
+	if err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "更新成功", policy)
+}
+
+// DeleteRedactionPolicy 删除策略
+// DELETE /api/redaction-policies/:id
+func (h *RedactionHandler) DeleteRedactionPolicy(c *gin.Context) {
+	userID, role := currentUser(c)
+	if err := h.redactionService.DeleteRedactionPolicy(c.Param("id"), userID, role); err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "删除成功", nil)
+}
@@ -1,21 +1,31 @@
 package api
 
 import (
+"bufio"
+"encoding/json"
+"errors"
+"fmt"
+"log"
+"net/http"
 "moongazing/models"
 "moongazing/service"
 "moongazing/utils"
 "strconv"
+"strings"
 
 "github.com/gin-gonic/gin"
+"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ResultHandler struct {
-	resultService *service.ResultService
+	resultService    *service.ResultService
+	redactionService *service.RedactionService
 }
 
 func NewResultHandler() *ResultHandler {
 	return &ResultHandler{
-		resultService: service.NewResultService(),
+		resultService:    service.NewResultService(),
+		redactionService: service.NewRedactionService(),
 	}
 }
 
@@ -27,6 +37,11 @@ func (h *ResultHandler) GetTaskResults(c *gin.Context) {
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
 	search := c.Query("search")
 	statusCode, _ := strconv.Atoi(c.DefaultQuery("status_code", "0")) // 状态码筛选
+	// 标签筛选：tags 包含任意一个，exclude_tags 不包含任何一个（逗号分隔）
+	tags := service.ResultTagFilter{
+		Any:  service.ParseTagList(c.Query("tags")),
+		None: service.ParseTagList(c.Query("exclude_tags")),
+	}
 
 	if page < 1 {
 		page = 1
@@ -35,13 +50,28 @@ func (h *ResultHandler) GetTaskResults(c *gin.Context) {
 		pageSize = 20
 	}
 
-	results, total, err := h.resultService.GetResultsByTask(taskID, resultType, page, pageSize, search, statusCode)
+	results, total, err := h.resultService.GetResultsByTask(taskID, resultType, page, pageSize, search, statusCode, tags)
 	if err != nil {
-		utils.Error(c, 500, "获取结果失败: "+err.Error())
+		respondResultListError(c, err)
 		return
 	}
 
-	// 扁平化结果数据，将 Data 字段中的内容提升到顶层
+	flatResults := flattenResults(results)
+
+	utils.SuccessWithPagination(c, flatResults, total, page, pageSize)
+}
+
+// respondResultListError 搜索表达式错误返回 400，其他错误返回 500
+func respondResultListError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidSearch) {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Error(c, 500, "获取结果失败: "+err.Error())
+}
+
+// flattenResults 扁平化结果数据，将 Data 字段中的内容提升到顶层
+func flattenResults(results []models.ScanResult) []map[string]interface{} {
 	flatResults := make([]map[string]interface{}, len(results))
 	for i, r := range results {
 		flat := map[string]interface{}{
@@ -60,8 +90,54 @@ func (h *ResultHandler) GetTaskResults(c *gin.Context) {
 		}
 		flatResults[i] = flat
 	}
+	return flatResults
+}
 
-	utils.SuccessWithPagination(c, flatResults, total, page, pageSize)
+// QueryResults 按结构化条件查询工作空间内的结果
+// POST /api/results/query
+func (h *ResultHandler) QueryResults(c *gin.Context) {
+	var req struct {
+		WorkspaceID string              `json:"workspace_id"`
+		Filter      models.ResultFilter `json:"filter" binding:"required"`
+		Sort        models.ResultSort   `json:"sort"`
+		Page        int                 `json:"page"`
+		Size        int                 `json:"size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	var workspaceID primitive.ObjectID
+	if req.WorkspaceID != "" {
+		oid, err := primitive.ObjectIDFromHex(req.WorkspaceID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return
+		}
+		workspaceID = oid
+	}
+
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeWorkspace(workspaceID, userID, role); err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	page, size := req.Page, req.Size
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	results, total, err := h.resultService.SearchResults(workspaceID, req.Filter, req.Sort, page, size)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithPagination(c, flattenResults(results), total, page, size)
 }
 
 // GetTaskResultStats 获取任务结果统计
@@ -77,6 +153,52 @@ func (h *ResultHandler) GetTaskResultStats(c *gin.Context) {
 	utils.Success(c, stats)
 }
 
+// DiffTaskResults 比较两个任务的结果：新增、消失和变化的子域名、端口、Web 服务、URL、漏洞
+// GET /api/tasks/:id/diff?base=<之前的任务ID>&types=subdomain,port
+// 未指定 base 时与同一巡航上次完成的任务比较
+func (h *ResultHandler) DiffTaskResults(c *gin.Context) {
+	taskID := c.Param("id")
+	base := c.Query("base")
+	if base == "" {
+		task, err := service.NewTaskService().GetTaskByID(taskID)
+		if err != nil {
+			utils.NotFound(c, err.Error())
+			return
+		}
+		previous := service.NewTaskService().PreviousCruiseTask(task)
+		if previous == nil {
+			utils.BadRequest(c, "请指定比较的任务（base）")
+			return
+		}
+		base = previous.ID.Hex()
+	} else {
+		// 比较的任务同样需要查看权限
+		userID, role := currentUser(c)
+		if _, err := service.NewTaskService().GetTaskForUser(base, userID, role, models.WorkspaceRoleViewer); err != nil {
+			respondResultAccessError(c, err)
+			return
+		}
+	}
+
+	diff, err := h.resultService.DiffTasks(base, taskID, resultTypesQuery(c.Query("types")))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, diff)
+}
+
+// resultTypesQuery 解析以逗号分隔的结果类型参数
+func resultTypesQuery(value string) []models.ResultType {
+	var types []models.ResultType
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, models.ResultType(t))
+		}
+	}
+	return types
+}
+
 // GetSubdomainResults 获取子域名结果
 func (h *ResultHandler) GetSubdomainResults(c *gin.Context) {
 	taskID := c.Param("id")
@@ -93,7 +215,7 @@ func (h *ResultHandler) GetSubdomainResults(c *gin.Context) {
 
 	results, total, err := h.resultService.GetSubdomainResults(taskID, page, pageSize, search)
 	if err != nil {
-		utils.Error(c, 500, "获取结果失败: "+err.Error())
+		respondResultListError(c, err)
 		return
 	}
 
@@ -116,7 +238,7 @@ func (h *ResultHandler) GetPortResults(c *gin.Context) {
 
 	results, total, err := h.resultService.GetPortResultsAggregated(taskID, page, pageSize, search)
 	if err != nil {
-		utils.Error(c, 500, "获取结果失败: "+err.Error())
+		respondResultListError(c, err)
 		return
 	}
 
@@ -124,17 +246,227 @@ func (h *ResultHandler) GetPortResults(c *gin.Context) {
 }
 
 // ExportResults 导出结果
+// GET /api/tasks/:id/results/export?type=&policy=&format=json|http-raw|csv|xlsx|jsonl|ndjson
+// policy 为脱敏策略（内置名称、策略ID或名称），结果逐条脱敏后直接写入响应
 func (h *ResultHandler) ExportResults(c *gin.Context) {
 	taskID := c.Param("id")
 	resultType := models.ResultType(c.Query("type"))
 
-	results, err := h.resultService.ExportResults(taskID, resultType)
+	userID, role := currentUser(c)
+	redactor, err := h.redactionService.TaskRedactor(taskID, c.Query("policy"), userID, role)
+	if err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+
+	switch format := c.DefaultQuery("format", service.ExportFormatJSON); format {
+	case service.ExportFormatHTTPRaw:
+		h.exportRawRequests(c, taskID, resultType, redactor)
+		return
+	case service.ExportFormatCSV, service.ExportFormatXLSX:
+		h.exportTable(c, taskID, resultType, format, redactor)
+		return
+	case service.ExportFormatJSONL, service.ExportFormatNDJSON:
+		objID, err := primitive.ObjectIDFromHex(taskID)
+		if err != nil {
+			utils.BadRequest(c, "无效的任务ID")
+			return
+		}
+		h.exportJSONL(c, service.JSONLExportQuery{TaskID: objID}, "task-"+taskID, redactor)
+		return
+	}
+
+	// 与 SuccessWithPagination 相同的响应结构，写出第一条结果时才开始响应，total 在结果写完后输出
+	var w *bufio.Writer
+	var enc *json.Encoder
+	begin := func() {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		w = bufio.NewWriter(c.Writer)
+		enc = json.NewEncoder(w)
+		w.WriteString(`{"code":0,"message":"success","data":[`)
+	}
+	count, err := h.resultService.StreamExportResults(c.Request.Context(), taskID, resultType, redactor, func(result *models.ScanResult) error {
+		if w == nil {
+			begin()
+		} else {
+			w.WriteString(",")
+		}
+		return enc.Encode(result)
+	})
 	if err != nil {
+		if w == nil {
+			utils.Error(c, 500, "导出失败: "+err.Error())
+			return
+		}
+		// 响应已经开始，只能中断输出
+		log.Printf("[ResultHandler] Export of task %s aborted after %d results: %v", taskID, count, err)
+		w.Flush()
+		return
+	}
+	if w == nil {
+		begin()
+	}
+	fmt.Fprintf(w, `],"total":%d,"page":1,"size":%d}`, count, count)
+	w.Flush()
+}
+
+// exportRawRequests 以原始 HTTP 请求导出爬虫、目录扫描、URL 结果
+// layout=zip（默认）每个请求一个文件，layout=concat 输出单个文本；可能改变服务端状态的请求在文件名或分隔行中标记
+func (h *ResultHandler) exportRawRequests(c *gin.Context, taskID string, resultType models.ResultType, redactor *service.Redactor) {
+	var exporter *service.RawHTTPExporter
+	begin := func() {
+		exporter = service.NewRawHTTPExporter(c.Writer, c.DefaultQuery("layout", service.RawLayoutZip))
+		if exporter.Layout() == service.RawLayoutZip {
+			c.Header("Content-Type", "application/zip")
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task-%s-requests.zip"`, taskID))
+		} else {
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task-%s-requests.http"`, taskID))
+		}
+		c.Status(http.StatusOK)
+	}
+
+	count, err := h.resultService.StreamExportResults(c.Request.Context(), taskID, resultType, redactor, func(result *models.ScanResult) error {
+		if _, ok := service.RenderRawHTTPRequest(result); !ok {
+			return nil
+		}
+		if exporter == nil {
+			begin()
+		}
+		_, err := exporter.Write(result)
+		return err
+	})
+	if err != nil && exporter == nil {
 		utils.Error(c, 500, "导出失败: "+err.Error())
 		return
 	}
+	if err != nil {
+		log.Printf("[ResultHandler] Raw export of task %s aborted after %d results: %v", taskID, count, err)
+	}
+	if exporter == nil {
+		begin()
+	}
+	exporter.Close()
+}
+
+// exportTable 以 CSV 或 XLSX 导出结果，每种结果类型展开为固定的列
+// CSV 需要指定 type；XLSX 未指定 type 时每种结果类型一个工作表
+func (h *ResultHandler) exportTable(c *gin.Context, taskID string, resultType models.ResultType, format string, redactor *service.Redactor) {
+	types, err := service.TableExportTypes(resultType, format)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
 
-	utils.SuccessWithPagination(c, results, int64(len(results)), 1, len(results))
+	name := string(resultType)
+	if name == "" {
+		name = "results"
+	}
+	// 导出器第一次写出内容时才开始响应，查询失败时仍可返回错误
+	w := &lazyResponseWriter{c: c}
+	exporter, _ := service.NewTableExporter(w, format)
+	w.begin = func() {
+		c.Header("Content-Type", exporter.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="task-%s-%s.%s"`, taskID, name, format))
+		c.Status(http.StatusOK)
+	}
+
+	count, err := h.resultService.ExportTable(c.Request.Context(), exporter, taskID, types, redactor)
+	if err != nil && !w.started {
+		utils.Error(c, 500, "导出失败: "+err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[ResultHandler] Table export of task %s aborted after %d results: %v", taskID, count, err)
+	}
+	if err := exporter.Close(); err != nil {
+		log.Printf("[ResultHandler] Table export of task %s failed to close: %v", taskID, err)
+	}
+}
+
+// ExportWorkspaceResults 以 JSONL 流式导出工作空间的结果
+// GET /api/results/export?workspace_id=&type=a,b&created_after=&last_id=&policy=
+// 按 (created_at, id) 升序输出，中断后以最后一行的 created_at、id 作为 created_after、last_id 继续；
+// 请求头 Accept-Encoding 包含 gzip 时压缩输出
+func (h *ResultHandler) ExportWorkspaceResults(c *gin.Context) {
+	workspaceID, err := primitive.ObjectIDFromHex(c.Query("workspace_id"))
+	if err != nil {
+		utils.BadRequest(c, "请指定有效的工作空间ID")
+		return
+	}
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeWorkspace(workspaceID, userID, role); err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	redactor, err := h.redactionService.WorkspaceRedactor(workspaceID, c.Query("policy"))
+	if err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+	h.exportJSONL(c, service.JSONLExportQuery{WorkspaceID: workspaceID}, "workspace-"+workspaceID.Hex(), redactor)
+}
+
+// exportJSONL 以 JSONL 流式导出，type 可以是逗号分隔的多个类型，created_after、last_id 为续传位置
+// 写出第一行时才开始响应，查询失败时仍可返回错误
+func (h *ResultHandler) exportJSONL(c *gin.Context, query service.JSONLExportQuery, name string, redactor *service.Redactor) {
+	cursor, err := service.ParseJSONLCursor(c.Query("created_after"), c.Query("last_id"))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	query.Cursor = cursor
+	query.Types = resultTypesQuery(c.Query("type"))
+
+	var exporter *service.JSONLExporter
+	begin := func() {
+		compress := service.AcceptsGzip(c.GetHeader("Accept-Encoding"))
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-results.jsonl"`, name))
+		if compress {
+			c.Header("Content-Encoding", "gzip")
+			c.Header("Vary", "Accept-Encoding")
+		}
+		c.Status(http.StatusOK)
+		exporter = service.NewJSONLExporter(c.Writer, compress)
+	}
+
+	count, err := h.resultService.StreamJSONL(c.Request.Context(), query, redactor, func(result *models.ScanResult) error {
+		if exporter == nil {
+			begin()
+		}
+		return exporter.Write(result)
+	})
+	if err != nil && exporter == nil {
+		utils.Error(c, 500, "导出失败: "+err.Error())
+		return
+	}
+	if err != nil {
+		// 响应已经开始，只能中断输出，客户端从最后一行继续
+		log.Printf("[ResultHandler] JSONL export %s aborted after %d results: %v", name, count, err)
+	}
+	if exporter == nil {
+		begin()
+	}
+	if err := exporter.Close(); err != nil {
+		log.Printf("[ResultHandler] JSONL export %s failed to close: %v", name, err)
+	}
+}
+
+// lazyResponseWriter 第一次写入时才设置响应头
+type lazyResponseWriter struct {
+	c       *gin.Context
+	begin   func()
+	started bool
+}
+
+func (w *lazyResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.begin()
+	}
+	return w.c.Writer.Write(p)
 }
 
 // UpdateResultTags 更新结果标签
@@ -149,8 +481,14 @@ func (h *ResultHandler) UpdateResultTags(c *gin.Context) {
 		return
 	}
 
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeResults([]string{id}, userID, role, models.WorkspaceRoleEditor); err != nil {
+		respondResultAccessError(c, err)
+		return
+	}
+
 	if err := h.resultService.UpdateResultTags(id, req.Tags); err != nil {
-		utils.Error(c, 500, "更新失败: "+err.Error())
+		respondTagError(c, "更新失败: ", err)
 		return
 	}
 
@@ -169,8 +507,14 @@ func (h *ResultHandler) AddResultTag(c *gin.Context) {
 		return
 	}
 
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeResults([]string{id}, userID, role, models.WorkspaceRoleEditor); err != nil {
+		respondResultAccessError(c, err)
+		return
+	}
+
 	if err := h.resultService.AddResultTag(id, req.Tag); err != nil {
-		utils.Error(c, 500, "添加失败: "+err.Error())
+		respondTagError(c, "添加失败: ", err)
 		return
 	}
 
@@ -187,14 +531,115 @@ func (h *ResultHandler) RemoveResultTag(c *gin.Context) {
 		return
 	}
 
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeResults([]string{id}, userID, role, models.WorkspaceRoleEditor); err != nil {
+		respondResultAccessError(c, err)
+		return
+	}
+
 	if err := h.resultService.RemoveResultTag(id, tag); err != nil {
-		utils.Error(c, 500, "移除失败: "+err.Error())
+		respondTagError(c, "移除失败: ", err)
 		return
 	}
 
 	utils.SuccessWithMessage(c, "移除成功", nil)
 }
 
+// GetResultScreenshot 获取 Web 服务结果的页面截图
+// GET /api/tasks/:id/results/:result_id/screenshot，只返回属于该任务截图目录中的文件
+func (h *ResultHandler) GetResultScreenshot(c *gin.Context) {
+	path, err := h.resultService.GetTaskScreenshot(c.Param("id"), c.Param("result_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrScreenshotNotFound):
+			utils.NotFound(c, err.Error())
+		case errors.Is(err, service.ErrInvalidScreenshotPath):
+			utils.Forbidden(c, err.Error())
+		default:
+			utils.Error(c, 500, "获取截图失败: "+err.Error())
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.File(path)
+}
+
+// bulkTagRequest 批量打标签请求：ids 或 task_id + type + search + tags 筛选
+type bulkTagRequest struct {
+	service.BulkTagSelection
+	Tag string `json:"tag"`
+}
+
+// BulkAddTag 批量添加标签
+func (h *ResultHandler) BulkAddTag(c *gin.Context) {
+	var req bulkTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeTagSelection(req.BulkTagSelection, userID, role); err != nil {
+		respondResultAccessError(c, err)
+		return
+	}
+
+	modified, err := h.resultService.BulkAddTag(req.BulkTagSelection, req.Tag)
+	if err != nil {
+		respondTagError(c, "添加失败: ", err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "添加成功", gin.H{"modified": modified})
+}
+
+// BulkRemoveTag 批量移除标签
+func (h *ResultHandler) BulkRemoveTag(c *gin.Context) {
+	var req bulkTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeTagSelection(req.BulkTagSelection, userID, role); err != nil {
+		respondResultAccessError(c, err)
+		return
+	}
+
+	modified, err := h.resultService.BulkRemoveTag(req.BulkTagSelection, req.Tag)
+	if err != nil {
+		respondTagError(c, "移除失败: ", err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "移除成功", gin.H{"modified": modified})
+}
+
+// respondResultAccessError 其他工作空间的结果和任务返回 404，权限不足返回 403
+func respondResultAccessError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrResultNotFound), errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrWorkspaceNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		utils.Forbidden(c, err.Error())
+	case errors.Is(err, service.ErrInvalidTagSelection):
+		utils.BadRequest(c, err.Error())
+	default:
+		utils.Error(c, 500, err.Error())
+	}
+}
+
+// respondTagError 标签、批量范围或搜索条件错误返回 400，其他错误返回 500
+func respondTagError(c *gin.Context, prefix string, err error) {
+	if errors.Is(err, service.ErrInvalidTag) || errors.Is(err, service.ErrInvalidSearch) || errors.Is(err, service.ErrInvalidTagSelection) {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.Error(c, 500, prefix+err.Error())
+}
+
 // BatchDeleteResults 批量删除结果
 func (h *ResultHandler) BatchDeleteResults(c *gin.Context) {
 	var req struct {
@@ -205,6 +650,12 @@ func (h *ResultHandler) BatchDeleteResults(c *gin.Context) {
 		return
 	}
 
+	userID, role := currentUser(c)
+	if err := h.resultService.AuthorizeResults(req.IDs, userID, role, models.WorkspaceRoleEditor); err != nil {
+		respondResultAccessError(c, err)
+		return
+	}
+
 	if err := h.resultService.BatchDeleteResults(req.IDs); err != nil {
 		utils.Error(c, 500, "删除失败: "+err.Error())
 		return
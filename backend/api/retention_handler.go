@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// retentionRunTimeout 手动清理的最长执行时间
+const retentionRunTimeout = 10 * time.Minute
+
+// RetentionHandler 扫描结果保留策略处理器
+type RetentionHandler struct {
+	resultService *service.ResultService
+	store         service.RetentionStore
+}
+
+// NewRetentionHandler 创建保留策略处理器
+func NewRetentionHandler() *RetentionHandler {
+	return &RetentionHandler{
+		resultService: service.NewResultService(),
+		store:         service.NewMongoRetentionStore(),
+	}
+}
+
+// retentionWorkspace 解析并校验保留策略所属的工作空间，未指定时为默认空间；write 为 true 时需要修改权限
+func (h *RetentionHandler) retentionWorkspace(c *gin.Context, write bool) (string, bool) {
+	var oid primitive.ObjectID
+	if workspaceID := c.Query("workspace_id"); workspaceID != "" {
+		var err error
+		if oid, err = primitive.ObjectIDFromHex(workspaceID); err != nil {
+			c.JSON(http.StatusBadRequest, utils.Response{
+				Code:    -1,
+				Message: "Invalid workspace_id",
+			})
+			return "", false
+		}
+	}
+	userID, role := currentUser(c)
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(oid, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return "", false
+	}
+	return oid.Hex(), true
+}
+
+// GetRetention 获取工作空间的结果保留策略
+// @Summary 获取结果保留策略
+// @Tags Result
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间"
+// @Success 200 {object} Response
+// @Router /api/retention [get]
+func (h *RetentionHandler) GetRetention(c *gin.Context) {
+	workspaceID, ok := h.retentionWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    service.LoadRetention(h.store, workspaceID),
+	})
+}
+
+// UpdateRetention 更新工作空间的结果保留策略，每天的后台清理按该策略删除过期结果
+// @Summary 更新结果保留策略
+// @Tags Result
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间（仅管理员）"
+// @Param policy body models.WorkspaceRetention true "保留天数、每个巡航保留的执行次数"
+// @Success 200 {object} Response
+// @Router /api/retention [put]
+func (h *RetentionHandler) UpdateRetention(c *gin.Context) {
+	workspaceID, ok := h.retentionWorkspace(c, true)
+	if !ok {
+		return
+	}
+	if _, role := currentUser(c); c.Query("workspace_id") == "" && role != "admin" {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Code:    -1,
+			Message: "Only admin can change the default workspace settings",
+		})
+		return
+	}
+
+	var policy models.WorkspaceRetention
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	policy.WorkspaceID = workspaceID
+	if err := service.SaveRetention(h.store, &policy); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save retention policy: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Retention policy updated",
+		Data:    &policy,
+	})
+}
+
+// RunRetention 立即按全部工作空间的策略清理结果（仅管理员），dry_run=true 时只返回将要删除的数量
+// @Summary 手动执行结果清理
+// @Tags Result
+// @Security ApiKeyAuth
+// @Param dry_run query bool false "只统计不删除"
+// @Success 200 {object} Response
+// @Router /api/retention/run [post]
+func (h *RetentionHandler) RunRetention(c *gin.Context) {
+	userID, _ := currentUser(c)
+	username, _ := c.Get("username")
+	usernameStr, _ := username.(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), retentionRunTimeout)
+	defer cancel()
+	report, err := service.RunRetention(ctx, h.store, service.RetentionOptions{
+		DryRun:   c.Query("dry_run") == "true",
+		UserID:   userID,
+		Username: usernameStr,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utils.Response{
+			Code:    -1,
+			Message: "Failed to run retention cleanup: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    report,
+	})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScanNetworkHandler 工作空间扫描出站网络设置处理器
+type ScanNetworkHandler struct {
+	resultService *service.ResultService
+	networks      service.ScanNetworkStore
+}
+
+// NewScanNetworkHandler 创建扫描网络设置处理器
+func NewScanNetworkHandler() *ScanNetworkHandler {
+	return &ScanNetworkHandler{
+		resultService: service.NewResultService(),
+		networks:      service.NewMongoScanNetworkStore(),
+	}
+}
+
+// networkWorkspace 解析并校验设置所属的工作空间，未指定时为默认空间；write 为 true 时需要修改权限
+func (h *ScanNetworkHandler) networkWorkspace(c *gin.Context, write bool) (string, bool) {
+	var oid primitive.ObjectID
+	if workspaceID := c.Query("workspace_id"); workspaceID != "" {
+		var err error
+		if oid, err = primitive.ObjectIDFromHex(workspaceID); err != nil {
+			c.JSON(http.StatusBadRequest, utils.Response{
+				Code:    -1,
+				Message: "Invalid workspace_id",
+			})
+			return "", false
+		}
+	}
+	userID, role := currentUser(c)
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(oid, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return "", false
+	}
+	return oid.Hex(), true
+}
+
+// GetScanNetwork 获取工作空间的扫描出站网络设置
+// @Summary 获取扫描代理和 DNS 设置
+// @Tags Task
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间"
+// @Success 200 {object} Response
+// @Router /api/scan-network [get]
+func (h *ScanNetworkHandler) GetScanNetwork(c *gin.Context) {
+	workspaceID, ok := h.networkWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    service.LoadScanNetwork(h.networks, workspaceID),
+	})
+}
+
+// UpdateScanNetwork 更新工作空间的扫描出站网络设置，任务未设置代理或 DNS 时使用
+// @Summary 更新扫描代理和 DNS 设置
+// @Tags Task
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间（仅管理员）"
+// @Param network body models.WorkspaceNetwork true "代理地址、DNS 服务器、是否使用 DoH"
+// @Success 200 {object} Response
+// @Router /api/scan-network [put]
+func (h *ScanNetworkHandler) UpdateScanNetwork(c *gin.Context) {
+	workspaceID, ok := h.networkWorkspace(c, true)
+	if !ok {
+		return
+	}
+	if _, role := currentUser(c); c.Query("workspace_id") == "" && role != "admin" {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Code:    -1,
+			Message: "Only admin can change the default workspace settings",
+		})
+		return
+	}
+
+	var network models.WorkspaceNetwork
+	if err := c.ShouldBindJSON(&network); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	network.WorkspaceID = workspaceID
+	if err := service.SaveScanNetwork(h.networks, &network); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save scan network: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Scan network updated",
+		Data:    &network,
+	})
+}
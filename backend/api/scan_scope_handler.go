@@ -0,0 +1,115 @@
+package api
+
+import (
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScanScopeHandler 工作空间扫描范围处理器
+type ScanScopeHandler struct {
+	resultService *service.ResultService
+	scopes        service.ScanScopeStore
+}
+
+// NewScanScopeHandler 创建扫描范围处理器
+func NewScanScopeHandler() *ScanScopeHandler {
+	return &ScanScopeHandler{
+		resultService: service.NewResultService(),
+		scopes:        service.NewMongoScanScopeStore(),
+	}
+}
+
+// scopeWorkspace 解析并校验扫描范围所属的工作空间，未指定时为默认空间；write 为 true 时需要修改权限
+func (h *ScanScopeHandler) scopeWorkspace(c *gin.Context, write bool) (string, bool) {
+	var oid primitive.ObjectID
+	if workspaceID := c.Query("workspace_id"); workspaceID != "" {
+		var err error
+		if oid, err = primitive.ObjectIDFromHex(workspaceID); err != nil {
+			c.JSON(http.StatusBadRequest, utils.Response{
+				Code:    -1,
+				Message: "Invalid workspace_id",
+			})
+			return "", false
+		}
+	}
+	userID, role := currentUser(c)
+	authorize := h.resultService.AuthorizeWorkspace
+	if write {
+		authorize = h.resultService.AuthorizeWorkspaceEdit
+	}
+	if err := authorize(oid, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return "", false
+	}
+	return oid.Hex(), true
+}
+
+// GetScanScope 获取工作空间的扫描范围
+// @Summary 获取扫描范围
+// @Tags Task
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间"
+// @Success 200 {object} Response
+// @Router /api/scan-scope [get]
+func (h *ScanScopeHandler) GetScanScope(c *gin.Context) {
+	workspaceID, ok := h.scopeWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "success",
+		Data:    service.LoadScanScope(h.scopes, workspaceID),
+	})
+}
+
+// UpdateScanScope 更新工作空间的扫描范围：任务未设置包含规则时使用这里的包含规则，排除规则对所有任务生效
+// @Summary 更新扫描范围
+// @Tags Task
+// @Security ApiKeyAuth
+// @Param workspace_id query string false "工作空间ID，不传时为默认空间（仅管理员）"
+// @Param scope body models.WorkspaceScope true "包含规则和排除规则"
+// @Success 200 {object} Response
+// @Router /api/scan-scope [put]
+func (h *ScanScopeHandler) UpdateScanScope(c *gin.Context) {
+	workspaceID, ok := h.scopeWorkspace(c, true)
+	if !ok {
+		return
+	}
+	if _, role := currentUser(c); c.Query("workspace_id") == "" && role != "admin" {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Code:    -1,
+			Message: "Only admin can change the default workspace settings",
+		})
+		return
+	}
+
+	var scope models.WorkspaceScope
+	if err := c.ShouldBindJSON(&scope); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	scope.WorkspaceID = workspaceID
+	if err := service.SaveScanScope(h.scopes, &scope); err != nil {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Code:    -1,
+			Message: "Failed to save scan scope: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.Response{
+		Code:    0,
+		Message: "Scan scope updated",
+		Data:    &scope,
+	})
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SearchHandler 保存的搜索处理器
+type SearchHandler struct {
+	searchService *service.SearchService
+}
+
+// NewSearchHandler 创建保存的搜索处理器
+func NewSearchHandler() *SearchHandler {
+	return &SearchHandler{
+		searchService: service.NewSearchService(),
+	}
+}
+
+// savedSearchRequest 创建、更新搜索的请求
+type savedSearchRequest struct {
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	WorkspaceID string              `json:"workspace_id"`
+	ResultType  models.ResultType   `json:"result_type" binding:"required"`
+	Filter      models.ResultFilter `json:"filter"`
+	Sort        models.ResultSort   `json:"sort"`
+	Shared      bool                `json:"shared"`
+}
+
+// currentUser 获取当前登录用户ID和角色
+func currentUser(c *gin.Context) (primitive.ObjectID, string) {
+	var userID primitive.ObjectID
+	if v, ok := c.Get("user_id"); ok {
+		if s, ok := v.(string); ok {
+			userID, _ = primitive.ObjectIDFromHex(s)
+		}
+	}
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	return userID, roleStr
+}
+
+// respondSearchError 按错误类型返回响应
+func respondSearchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWorkspaceNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		utils.Forbidden(c, err.Error())
+	case errors.Is(err, service.ErrSavedSearchNotFound):
+		utils.NotFound(c, err.Error())
+	default:
+		utils.BadRequest(c, err.Error())
+	}
+}
+
+// ListSavedSearches 列出可见的搜索
+// GET /api/searches?workspace_id=
+func (h *SearchHandler) ListSavedSearches(c *gin.Context) {
+	var workspaceID primitive.ObjectID
+	if wsID := c.Query("workspace_id"); wsID != "" {
+		oid, err := primitive.ObjectIDFromHex(wsID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return
+		}
+		workspaceID = oid
+	}
+
+	userID, role := currentUser(c)
+	searches, err := h.searchService.ListSavedSearches(workspaceID, userID, role)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	utils.Success(c, searches)
+}
+
+// GetSearchFields 获取结果类型允许搜索的字段
+// GET /api/searches/fields?type=
+func (h *SearchHandler) GetSearchFields(c *gin.Context) {
+	resultType := models.ResultType(c.Query("type"))
+	fields := service.ResultFilterFields(resultType)
+	if fields == nil {
+		utils.BadRequest(c, "不支持搜索的结果类型")
+		return
+	}
+	utils.Success(c, fields)
+}
+
+// CreateSavedSearch 保存搜索
+// POST /api/searches
+func (h *SearchHandler) CreateSavedSearch(c *gin.Context) {
+	var req savedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	search := &models.SavedSearch{
+		Name:        req.Name,
+		Description: req.Description,
+		ResultType:  req.ResultType,
+		Filter:      req.Filter,
+		Sort:        req.Sort,
+		Shared:      req.Shared,
+	}
+	if req.WorkspaceID != "" {
+		oid, err := primitive.ObjectIDFromHex(req.WorkspaceID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return
+		}
+		search.WorkspaceID = oid
+	}
+
+	userID, role := currentUser(c)
+	if err := h.searchService.CreateSavedSearch(search, userID, role); err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "保存成功", search)
+}
+
+// GetSavedSearch 获取搜索详情
+// GET /api/searches/:id
+func (h *SearchHandler) GetSavedSearch(c *gin.Context) {
+	userID, role := currentUser(c)
+	search, err := h.searchService.GetSavedSearch(c.Param("id"), userID, role)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	utils.Success(c, search)
+}
+
+// UpdateSavedSearch 更新搜索
+// PUT /api/searches/:id
+func (h *SearchHandler) UpdateSavedSearch(c *gin.Context) {
+	var req savedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	userID, role := currentUser(c)
+	search, err := h.searchService.UpdateSavedSearch(c.Param("id"), &models.SavedSearch{
+		Name:        req.Name,
+		Description: req.Description,
+		ResultType:  req.ResultType,
+		Filter:      req.Filter,
+		Sort:        req.Sort,
+		Shared:      req.Shared,
+	}, userID, role)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "更新成功", search)
+}
+
+// DeleteSavedSearch 删除搜索
+// DELETE /api/searches/:id
+func (h *SearchHandler) DeleteSavedSearch(c *gin.Context) {
+	userID, role := currentUser(c)
+	if err := h.searchService.DeleteSavedSearch(c.Param("id"), userID, role); err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "删除成功", nil)
+}
+
+// ExecuteSavedSearch 执行搜索
+// GET /api/searches/:id/results?page=&size=
+func (h *SearchHandler) ExecuteSavedSearch(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	userID, role := currentUser(c)
+	results, total, err := h.searchService.Execute(c.Param("id"), page, pageSize, userID, role)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	utils.SuccessWithPagination(c, flattenResults(results), total, page, pageSize)
+}
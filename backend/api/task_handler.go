@@ -1,10 +1,17 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"strconv"
+	"strings"
+	"time"
 
 	"moongazing/models"
+	"moongazing/scanner/core"
 	"moongazing/service"
+	"moongazing/service/pipeline"
 	"moongazing/utils"
 
 	"github.com/gin-gonic/gin"
@@ -12,12 +19,18 @@ import (
 )
 
 type TaskHandler struct {
-	taskService *service.TaskService
+	taskService      *service.TaskService
+	redactionService *service.RedactionService
+	eventService     *service.TaskEventService
+	controlService   *service.TaskControlService
 }
 
 func NewTaskHandler() *TaskHandler {
 	return &TaskHandler{
-		taskService: service.NewTaskService(),
+		taskService:      service.NewTaskService(),
+		redactionService: service.NewRedactionService(),
+		eventService:     service.NewTaskEventService(),
+		controlService:   service.NewTaskControlService(),
 	}
 }
 
@@ -29,6 +42,7 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 	workspaceID := c.Query("workspace_id")
 	taskType := c.Query("type")
 	status := c.Query("status")
+	terminationReason := c.Query("termination_reason")
 	
 	if page < 1 {
 		page = 1
@@ -37,7 +51,21 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 		pageSize = 10
 	}
 	
-	tasks, total, err := h.taskService.ListTasks(workspaceID, taskType, status, page, pageSize)
+	filter := service.TaskListFilter{
+		WorkspaceID:       workspaceID,
+		Type:              taskType,
+		Status:            status,
+		TerminationReason: terminationReason,
+	}
+	
+	// 未指定工作空间时只列出用户可以查看的工作空间中的任务
+	_, ids, ok := workspaceQueryScope(c, h.taskService)
+	if !ok {
+		return
+	}
+	filter.WorkspaceIDs = ids
+	
+	tasks, total, err := h.taskService.ListTasksByFilter(filter, page, pageSize)
 	if err != nil {
 		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
 		return
@@ -66,16 +94,20 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	
 	var req struct {
-		WorkspaceID string            `json:"workspace_id"`
-		Name        string            `json:"name" binding:"required"`
-		Description string            `json:"description"`
-		Type        models.TaskType   `json:"type" binding:"required"`
-		Targets     []string          `json:"targets" binding:"required"`
-		TargetType  string            `json:"target_type" binding:"required"`
-		Config      models.TaskConfig `json:"config"`
-		IsScheduled bool              `json:"is_scheduled"`
-		CronExpr    string            `json:"cron_expr"`
-		Tags        []string          `json:"tags"`
+		WorkspaceID string               `json:"workspace_id"`
+		Name        string               `json:"name" binding:"required"`
+		Description string               `json:"description"`
+		Type        models.TaskType      `json:"type" binding:"required"`
+		Priority    models.TaskPriority  `json:"priority"`
+		Targets     []string             `json:"targets" binding:"required"`
+		TargetType  string               `json:"target_type" binding:"required"`
+		Config      models.TaskConfig    `json:"config"`
+		IsScheduled bool                 `json:"is_scheduled"`
+		CronExpr    string               `json:"cron_expr"`
+		Tags        []string             `json:"tags"`
+		FollowUp    *models.FollowUpSpec `json:"follow_up"`
+		// 所选模块依赖的工具全部不可用时拒绝创建
+		RequireTools bool `json:"require_tools"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -83,16 +115,38 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 	
+	if err := service.ValidateTaskConfig(&req.Config); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	if err := service.ValidateTaskTargets(req.Targets, req.Config.MaxTargets); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	if err := service.ValidateFollowUp(req.FollowUp); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	if err := service.ValidTaskPriority(req.Priority); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
 	task := &models.Task{
 		Name:        req.Name,
 		Description: req.Description,
 		Type:        req.Type,
+		Priority:    service.NormalizeTaskPriority(req.Priority),
 		Targets:     req.Targets,
 		TargetType:  req.TargetType,
 		Config:      req.Config,
 		IsScheduled: req.IsScheduled,
 		CronExpr:    req.CronExpr,
 		Tags:        req.Tags,
+		FollowUp:    req.FollowUp,
 	}
 	
 	if req.WorkspaceID != "" {
@@ -109,12 +163,87 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		TotalTargets: len(req.Targets),
 	}
 	
+	// 只读成员不能在工作空间中创建任务
+	operatorID, operatorRole := currentUser(c)
+	if err := h.taskService.AuthorizeWorkspace(task.WorkspaceID, operatorID, operatorRole, models.WorkspaceRoleEditor); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	
+	// 后续任务的每一级都需要对应工作空间的编辑权限，使用的模板需要可见
+	if err := h.taskService.AuthorizeFollowUp(task.WorkspaceID, task.FollowUp, operatorID, operatorRole); err != nil {
+		respondTemplateAccessError(c, err)
+		return
+	}
+	
+	// 工具缺失的模块在执行时会跳过，创建时提示
+	capabilities := service.CheckTaskCapabilities(core.NewToolsManager(), task)
+	if req.RequireTools && capabilities.NoneAvailable() {
+		utils.BadRequest(c, service.ErrNoAvailableModule.Error()+": "+strings.Join(capabilities.Warnings, "; "))
+		return
+	}
+	
 	if err := h.taskService.CreateTask(task); err != nil {
 		utils.Error(c, utils.ErrCodeInternalError, err.Error())
 		return
 	}
 	
-	utils.SuccessWithMessage(c, "创建成功", gin.H{"id": task.ID.Hex()})
+	utils.SuccessWithMessage(c, "创建成功", gin.H{
+		"id":           task.ID.Hex(),
+		"warnings":     capabilities.Warnings,
+		"capabilities": capabilities.Modules,
+	})
+}
+
+// ValidateTask checks which modules of a task would run without creating it
+// POST /api/tasks/validate
+func (h *TaskHandler) ValidateTask(c *gin.Context) {
+	var req struct {
+		Type   models.TaskType   `json:"type" binding:"required"`
+		Config models.TaskConfig `json:"config"`
+	}
+	
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	
+	capabilities := service.CheckTaskCapabilities(core.NewToolsManager(), &models.Task{Type: req.Type, Config: req.Config})
+	utils.Success(c, gin.H{
+		"runnable":     !capabilities.NoneAvailable(),
+		"warnings":     capabilities.Warnings,
+		"capabilities": capabilities.Modules,
+	})
+}
+
+// PreviewExclusions previews which known hosts would be excluded
+// POST /api/tasks/exclusion-preview
+func (h *TaskHandler) PreviewExclusions(c *gin.Context) {
+	var req struct {
+		WorkspaceID string   `json:"workspace_id"`
+		ExcludeList []string `json:"exclude_list" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	
+	if err := core.ValidateExcludePatterns(req.ExcludeList); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	hosts, err := h.taskService.PreviewExclusions(req.WorkspaceID, req.ExcludeList)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	
+	utils.Success(c, gin.H{
+		"excluded": hosts,
+		"total":    len(hosts),
+	})
 }
 
 // UpdateTask updates a task
@@ -134,6 +263,32 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	delete(req, "created_at")
 	delete(req, "status")
 	
+	// 修改后续任务时与创建时一样校验每一级的权限
+	if raw, ok := req["follow_up"]; ok {
+		var spec *models.FollowUpSpec
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &spec); err != nil {
+			utils.BadRequest(c, "参数错误: "+err.Error())
+			return
+		}
+		if err := service.ValidateFollowUp(spec); err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		value, _ := c.Get("task")
+		task, ok := value.(*models.Task)
+		if !ok {
+			utils.NotFound(c, service.ErrTaskNotFound.Error())
+			return
+		}
+		userID, role := currentUser(c)
+		if err := h.taskService.AuthorizeFollowUp(task.WorkspaceID, spec, userID, role); err != nil {
+			respondTemplateAccessError(c, err)
+			return
+		}
+		req["follow_up"] = spec
+	}
+	
 	if err := h.taskService.UpdateTask(taskID, req); err != nil {
 		utils.Error(c, utils.ErrCodeInternalError, err.Error())
 		return
@@ -142,17 +297,35 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	utils.SuccessWithMessage(c, "更新成功", nil)
 }
 
+// respondTemplateAccessError 模板不可见时按模板不存在返回，其余按工作空间权限错误返回
+func respondTemplateAccessError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrTaskTemplateNotFound) {
+		utils.NotFound(c, err.Error())
+		return
+	}
+	respondWorkspaceError(c, err)
+}
+
 // DeleteTask deletes a task
 // DELETE /api/tasks/:id
+// 同时清理任务的结果、日志、工具调用记录和磁盘文件，并解除其他文档对任务的引用
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	taskID := c.Param("id")
+	userID, _ := currentUser(c)
+	username, _ := c.Get("username")
+	usernameStr, _ := username.(string)
 	
-	if err := h.taskService.DeleteTask(taskID); err != nil {
+	report, err := h.taskService.PurgeTask(taskID, userID, usernameStr)
+	if errors.Is(err, service.ErrTaskStillRunning) {
+		utils.Error(c, utils.ErrCodeTaskRunning, err.Error())
+		return
+	}
+	if err != nil {
 		utils.Error(c, utils.ErrCodeInternalError, err.Error())
 		return
 	}
 	
-	utils.SuccessWithMessage(c, "删除成功", nil)
+	utils.SuccessWithMessage(c, "删除成功", report)
 }
 
 // StartTask starts a task
@@ -186,12 +359,22 @@ func (h *TaskHandler) PauseTask(c *gin.Context) {
 func (h *TaskHandler) ResumeTask(c *gin.Context) {
 	taskID := c.Param("id")
 	
-	if err := h.taskService.ResumeTask(taskID); err != nil {
+	// from_checkpoint: 暂停或失败的任务从断点继续，跳过已完成的子域名枚举和端口扫描
+	var req struct {
+		FromCheckpoint bool `json:"from_checkpoint"`
+	}
+	c.ShouldBindJSON(&req)
+	
+	if err := h.taskService.ResumeTask(taskID, req.FromCheckpoint); err != nil {
 		utils.Error(c, utils.ErrCodeInternalError, err.Error())
 		return
 	}
 	
-	utils.SuccessWithMessage(c, "任务已恢复", nil)
+	if req.FromCheckpoint {
+		utils.SuccessWithMessage(c, "任务已从断点恢复", nil)
+	} else {
+		utils.SuccessWithMessage(c, "任务已恢复", nil)
+	}
 }
 
 // CancelTask cancels a task
@@ -207,6 +390,72 @@ func (h *TaskHandler) CancelTask(c *gin.Context) {
 	utils.SuccessWithMessage(c, "任务已取消", nil)
 }
 
+// SetTaskPriority changes the priority of a queued task
+// PUT /api/tasks/:id/priority
+func (h *TaskHandler) SetTaskPriority(c *gin.Context) {
+	taskID := c.Param("id")
+	
+	var req struct {
+		Priority models.TaskPriority `json:"priority" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	if err := service.ValidTaskPriority(req.Priority); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	moved, err := h.taskService.SetTaskPriority(taskID, req.Priority)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeInternalError, err.Error())
+		return
+	}
+	
+	utils.SuccessWithMessage(c, "优先级已更新", gin.H{
+		"priority": service.NormalizeTaskPriority(req.Priority),
+		"moved":    moved,
+	})
+}
+
+// ControlTaskModule sends a runtime control to a module of a running task
+// (skip remaining input, stop the module, change its concurrency); the executor running the task applies it within a few seconds
+// POST /api/tasks/:id/controls {"module": "Crawler", "action": "stop"}
+func (h *TaskHandler) ControlTaskModule(c *gin.Context) {
+	var req pipeline.ControlMessage
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	username, _ := c.Get("username")
+	usernameStr, _ := username.(string)
+	
+	control, err := h.controlService.CreateControl(c.Param("id"), req, usernameStr)
+	if errors.Is(err, service.ErrTaskNotRunning) {
+		utils.Error(c, utils.ErrCodeInvalidParams, err.Error())
+		return
+	}
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	utils.SuccessWithMessage(c, "控制指令已发送", control)
+}
+
+// ListTaskControls lists runtime module controls of a task and their results
+// GET /api/tasks/:id/controls
+func (h *TaskHandler) ListTaskControls(c *gin.Context) {
+	controls, err := h.controlService.ListControls(c.Param("id"))
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	
+	utils.Success(c, controls)
+}
+
 // RetryTask retries a failed task
 // POST /api/tasks/:id/retry
 func (h *TaskHandler) RetryTask(c *gin.Context) {
@@ -246,9 +495,12 @@ func (h *TaskHandler) RescanTask(c *gin.Context) {
 // GetTaskStats returns task statistics
 // GET /api/tasks/stats
 func (h *TaskHandler) GetTaskStats(c *gin.Context) {
-	workspaceID := c.Query("workspace_id")
+	workspaceID, ids, ok := workspaceQueryScope(c, h.taskService)
+	if !ok {
+		return
+	}
 	
-	stats, err := h.taskService.GetTaskStats(workspaceID)
+	stats, err := h.taskService.GetTaskStatsByFilter(service.TaskListFilter{WorkspaceID: workspaceID, WorkspaceIDs: ids})
 	if err != nil {
 		utils.Error(c, utils.ErrCodeInternalError, err.Error())
 		return
@@ -273,6 +525,126 @@ func (h *TaskHandler) GetTaskLogs(c *gin.Context) {
 	utils.SuccessWithPagination(c, logs, total, page, pageSize)
 }
 
+// GetTaskEvents gets structured execution events of a task (module start/complete, skipped tools, target errors)
+// GET /api/tasks/:id/events?level=warn,error&module=DirScan&page=1&page_size=50
+func (h *TaskHandler) GetTaskEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	events, total, err := h.eventService.ListEvents(c.Param("id"),
+		splitQueryList(c.Query("level")), splitQueryList(c.Query("module")), page, pageSize)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidEventLevel) {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+
+	utils.SuccessWithPagination(c, events, total, page, pageSize)
+}
+
+// splitQueryList splits a comma separated query value, dropping empty items
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GetToolRuns gets external tool invocations of a task
+// GET /api/tasks/:id/tool-runs
+func (h *TaskHandler) GetToolRuns(c *gin.Context) {
+	runs, err := h.taskService.GetToolRuns(c.Param("id"))
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+
+	utils.Success(c, runs)
+}
+
+// GetTaskTimeline gets per-minute/hour discovery counts and the latest events
+// GET /api/tasks/:id/timeline?resolution=minute|hour&tail=50
+func (h *TaskHandler) GetTaskTimeline(c *gin.Context) {
+	tail, _ := strconv.Atoi(c.DefaultQuery("tail", strconv.Itoa(service.TimelineTailSize)))
+	timeline, err := h.taskService.GetTaskTimeline(c.Param("id"), c.Query("resolution"), tail)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidResolution) {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+
+	utils.Success(c, timeline)
+}
+
+// GetTaskSuppressionStats gets how many items each module dropped and why
+// GET /api/tasks/:id/suppression
+func (h *TaskHandler) GetTaskSuppressionStats(c *gin.Context) {
+	stats, err := h.taskService.GetTaskSuppressionStats(c.Param("id"))
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+
+	utils.Success(c, stats)
+}
+
+// StreamTaskTimeline streams newly written timeline events over SSE
+// GET /api/tasks/:id/timeline/stream
+func (h *TaskHandler) StreamTaskTimeline(c *gin.Context) {
+	if _, err := primitive.ObjectIDFromHex(c.Param("id")); err != nil {
+		utils.BadRequest(c, "无效的任务ID")
+		return
+	}
+
+	events, cancel := service.SubscribeTaskTimeline(c.Param("id"))
+	defer cancel()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			c.SSEvent("event", event)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// GetTaskReport gets task report with tool invocation appendix
+// GET /api/tasks/:id/report?policy=
+func (h *TaskHandler) GetTaskReport(c *gin.Context) {
+	userID, role := currentUser(c)
+	redactor, err := h.redactionService.TaskRedactor(c.Param("id"), c.Query("policy"), userID, role)
+	if err != nil {
+		respondRedactionError(c, err)
+		return
+	}
+
+	report, err := h.taskService.GetTaskReport(c.Param("id"))
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return
+	}
+	service.RedactTaskReport(report, redactor)
+
+	utils.Success(c, report)
+}
+
 // ListTaskTemplates lists task templates
 // GET /api/tasks/templates
 func (h *TaskHandler) ListTaskTemplates(c *gin.Context) {
@@ -301,29 +673,43 @@ func (h *TaskHandler) GetTaskTemplate(c *gin.Context) {
 	utils.Success(c, template)
 }
 
-// CreateTaskTemplate creates a task template
-// POST /api/tasks/templates
-func (h *TaskHandler) CreateTaskTemplate(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+// taskTemplateRequest is the body of template create and update requests
+type taskTemplateRequest struct {
+	WorkspaceID string              `json:"workspace_id"`
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Type        models.TaskType     `json:"type" binding:"required"`
+	Priority    models.TaskPriority `json:"priority"`
+	Tags        []string            `json:"tags"`
+	Config      models.TaskConfig   `json:"config"`
+	IsPublic    bool                `json:"is_public"`
+}
+
+// bindTaskTemplate binds and validates a template request with the checks of task creation,
+// targets are given per task and not checked here
+func bindTaskTemplate(c *gin.Context) (*models.TaskTemplate, *service.CapabilityReport, bool) {
+	var req taskTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return nil, nil, false
+	}
 	
-	var req struct {
-		WorkspaceID string            `json:"workspace_id"`
-		Name        string            `json:"name" binding:"required"`
-		Description string            `json:"description"`
-		Type        models.TaskType   `json:"type" binding:"required"`
-		Config      models.TaskConfig `json:"config"`
-		IsPublic    bool              `json:"is_public"`
+	if err := service.ValidateTaskConfig(&req.Config); err != nil {
+		utils.BadRequest(c, err.Error())
+		return nil, nil, false
 	}
 	
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, "参数错误")
-		return
+	if err := service.ValidTaskPriority(req.Priority); err != nil {
+		utils.BadRequest(c, err.Error())
+		return nil, nil, false
 	}
 	
 	template := &models.TaskTemplate{
 		Name:        req.Name,
 		Description: req.Description,
 		Type:        req.Type,
+		Priority:    req.Priority,
+		Tags:        req.Tags,
 		Config:      req.Config,
 		IsPublic:    req.IsPublic,
 	}
@@ -333,6 +719,20 @@ func (h *TaskHandler) CreateTaskTemplate(c *gin.Context) {
 		template.WorkspaceID = wsID
 	}
 	
+	capabilities := service.CheckTaskCapabilities(core.NewToolsManager(), &models.Task{Type: template.Type, Config: template.Config})
+	return template, capabilities, true
+}
+
+// CreateTaskTemplate creates a task template
+// POST /api/tasks/templates
+func (h *TaskHandler) CreateTaskTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	
+	template, capabilities, ok := bindTaskTemplate(c)
+	if !ok {
+		return
+	}
+	
 	if userID != nil {
 		uid, _ := primitive.ObjectIDFromHex(userID.(string))
 		template.CreatedBy = uid
@@ -343,7 +743,26 @@ func (h *TaskHandler) CreateTaskTemplate(c *gin.Context) {
 		return
 	}
 	
-	utils.SuccessWithMessage(c, "创建成功", gin.H{"id": template.ID.Hex()})
+	utils.SuccessWithMessage(c, "创建成功", gin.H{
+		"id":       template.ID.Hex(),
+		"warnings": capabilities.Warnings,
+	})
+}
+
+// UpdateTaskTemplate updates a task template
+// PUT /api/tasks/templates/:id
+func (h *TaskHandler) UpdateTaskTemplate(c *gin.Context) {
+	template, capabilities, ok := bindTaskTemplate(c)
+	if !ok {
+		return
+	}
+	
+	if err := h.taskService.UpdateTaskTemplate(c.Param("id"), template); err != nil {
+		h.respondTemplateError(c, err)
+		return
+	}
+	
+	utils.SuccessWithMessage(c, "更新成功", gin.H{"warnings": capabilities.Warnings})
 }
 
 // DeleteTaskTemplate deletes a task template
@@ -352,24 +771,41 @@ func (h *TaskHandler) DeleteTaskTemplate(c *gin.Context) {
 	templateID := c.Param("id")
 	
 	if err := h.taskService.DeleteTaskTemplate(templateID); err != nil {
-		utils.Error(c, utils.ErrCodeInternalError, err.Error())
+		h.respondTemplateError(c, err)
 		return
 	}
 	
 	utils.SuccessWithMessage(c, "删除成功", nil)
 }
 
-// CreateTaskFromTemplate creates a task from template
+// respondTemplateError 按错误类型返回响应
+func (h *TaskHandler) respondTemplateError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrBuiltInTemplate) {
+		utils.Forbidden(c, err.Error())
+		return
+	}
+	utils.Error(c, utils.ErrCodeInternalError, err.Error())
+}
+
+// CreateTaskFromTemplate creates a task from template. Fields given in the request override
+// the template and config is merged field by field; the task keeps its own copy of the config
 // POST /api/tasks/from-template
 func (h *TaskHandler) CreateTaskFromTemplate(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	
 	var req struct {
-		TemplateID  string   `json:"template_id" binding:"required"`
-		WorkspaceID string   `json:"workspace_id"`
-		Name        string   `json:"name" binding:"required"`
-		Targets     []string `json:"targets" binding:"required"`
-		TargetType  string   `json:"target_type" binding:"required"`
+		TemplateID  string              `json:"template_id" binding:"required"`
+		WorkspaceID string              `json:"workspace_id"`
+		Name        string              `json:"name" binding:"required"`
+		Description string              `json:"description"`
+		Type        models.TaskType     `json:"type"`
+		Priority    models.TaskPriority `json:"priority"`
+		Targets     []string            `json:"targets" binding:"required"`
+		TargetType  string              `json:"target_type" binding:"required"`
+		Tags        []string            `json:"tags"`
+		Config      json.RawMessage     `json:"config"` // 覆盖模板配置的字段
+		// 所选模块依赖的工具全部不可用时拒绝创建
+		RequireTools bool `json:"require_tools"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -377,31 +813,71 @@ func (h *TaskHandler) CreateTaskFromTemplate(c *gin.Context) {
 		return
 	}
 	
+	if err := service.ValidTaskPriority(req.Priority); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
 	template, err := h.taskService.GetTaskTemplate(req.TemplateID)
 	if err != nil {
 		utils.NotFound(c, "模板不存在")
 		return
 	}
 	
-	task := &models.Task{
-		Name:       req.Name,
-		Type:       template.Type,
-		Targets:    req.Targets,
-		TargetType: req.TargetType,
-		Config:     template.Config,
-		ResultStats: models.TaskResultStats{
-			TotalTargets: len(req.Targets),
-		},
+	// 其他工作空间的非公开模板按不存在处理
+	operatorID, operatorRole := currentUser(c)
+	if err := h.taskService.AuthorizeTemplate(template, operatorID, operatorRole); err != nil {
+		respondTemplateAccessError(c, err)
+		return
+	}
+	
+	taskReq := service.TemplateTaskRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Type:        req.Type,
+		Priority:    req.Priority,
+		Targets:     req.Targets,
+		TargetType:  req.TargetType,
+		Tags:        req.Tags,
+		Config:      req.Config,
 	}
 	
 	if req.WorkspaceID != "" {
 		wsID, _ := primitive.ObjectIDFromHex(req.WorkspaceID)
-		task.WorkspaceID = wsID
+		taskReq.WorkspaceID = wsID
 	}
 	
 	if userID != nil {
 		uid, _ := primitive.ObjectIDFromHex(userID.(string))
-		task.CreatedBy = uid
+		taskReq.CreatedBy = uid
+	}
+	
+	task, err := service.NewTaskFromTemplate(template, taskReq)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	// 任务的工作空间可能来自模板，合并后再校验
+	if err := h.taskService.AuthorizeWorkspace(task.WorkspaceID, operatorID, operatorRole, models.WorkspaceRoleEditor); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	
+	if err := service.ValidateTaskConfig(&task.Config); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	if err := service.ValidateTaskTargets(task.Targets, task.Config.MaxTargets); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	
+	capabilities := service.CheckTaskCapabilities(core.NewToolsManager(), task)
+	if req.RequireTools && capabilities.NoneAvailable() {
+		utils.BadRequest(c, service.ErrNoAvailableModule.Error()+": "+strings.Join(capabilities.Warnings, "; "))
+		return
 	}
 	
 	if err := h.taskService.CreateTask(task); err != nil {
@@ -409,5 +885,9 @@ func (h *TaskHandler) CreateTaskFromTemplate(c *gin.Context) {
 		return
 	}
 	
-	utils.SuccessWithMessage(c, "创建成功", gin.H{"id": task.ID.Hex()})
+	utils.SuccessWithMessage(c, "创建成功", gin.H{
+		"id":           task.ID.Hex(),
+		"warnings":     capabilities.Warnings,
+		"capabilities": capabilities.Modules,
+	})
 }
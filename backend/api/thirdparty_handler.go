@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"moongazing/scanner/core"
 	"moongazing/scanner/enscan"
 	"moongazing/scanner/subdomain/thirdparty"
 	"moongazing/utils"
@@ -61,6 +62,17 @@ func (h *ThirdPartyHandler) GetConfiguredSources(c *gin.Context) {
 	})
 }
 
+// GetQuotaStatus 获取各数据源的配额消耗
+// GET /api/thirdparty/quota
+func (h *ThirdPartyHandler) GetQuotaStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	utils.Success(c, gin.H{
+		"quota": h.manager.GetQuotaStatus(ctx),
+	})
+}
+
 // CollectSubdomains 收集子域名
 // POST /api/thirdparty/subdomains
 func (h *ThirdPartyHandler) CollectSubdomains(c *gin.Context) {
@@ -86,7 +98,7 @@ func (h *ThirdPartyHandler) CollectSubdomains(c *gin.Context) {
 
 	start := time.Now()
 	result := h.manager.CollectSubdomains(ctx, req.Domain, req.Sources, req.MaxResults)
-	result.Duration = time.Since(start).String()
+	result.DurationMs = core.MillisSince(start)
 
 	utils.Success(c, result)
 }
@@ -405,7 +417,7 @@ func (h *ThirdPartyHandler) GetCertSubdomains(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	subdomains, err := h.manager.CrtSh.SearchSubdomains(ctx, domain)
+	subdomains, err := h.manager.CrtSh.SearchSubdomains(ctx, domain, 0)
 	if err != nil {
 		utils.Error(c, utils.ErrCodeThirdPartyError, err.Error())
 		return
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WorkspaceHandler 工作空间成员处理器
+type WorkspaceHandler struct {
+	access      *service.WorkspaceAccess
+	userService *service.UserService
+}
+
+// NewWorkspaceHandler 创建工作空间成员处理器
+func NewWorkspaceHandler() *WorkspaceHandler {
+	return &WorkspaceHandler{
+		access:      service.NewWorkspaceAccess(),
+		userService: service.NewUserService(),
+	}
+}
+
+// workspaceMemberRequest 邀请成员或修改角色的请求
+type workspaceMemberRequest struct {
+	UserID string               `json:"user_id"`
+	Role   models.WorkspaceRole `json:"role" binding:"required"`
+}
+
+// respondWorkspaceError 不是成员时按工作空间不存在返回 404，避免泄露其他工作空间的信息
+func respondWorkspaceError(c *gin.Context, err error) {
+	switch {
+	case err == service.ErrWorkspaceForbidden, errors.Is(err, service.ErrWorkspaceNotFound):
+		utils.NotFound(c, service.ErrWorkspaceNotFound.Error())
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		utils.Forbidden(c, err.Error())
+	case errors.Is(err, service.ErrWorkspaceMemberNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrLastWorkspaceOwner), errors.Is(err, service.ErrInvalidWorkspaceRole),
+		errors.Is(err, service.ErrWorkspaceCreatorRemove), errors.Is(err, service.ErrDefaultWorkspaceMembers):
+		utils.BadRequest(c, err.Error())
+	default:
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+	}
+}
+
+// workspaceQueryScope 解析 workspace_id 查询参数：指定时校验查看权限，未指定时返回用户可见的工作空间（管理员返回 nil 表示不限）
+func workspaceQueryScope(c *gin.Context, taskService *service.TaskService) (string, []primitive.ObjectID, bool) {
+	workspaceID := c.Query("workspace_id")
+	userID, role := currentUser(c)
+	if workspaceID != "" {
+		wsID, err := primitive.ObjectIDFromHex(workspaceID)
+		if err != nil {
+			utils.BadRequest(c, "无效的工作空间ID")
+			return "", nil, false
+		}
+		if err := taskService.AuthorizeWorkspace(wsID, userID, role, models.WorkspaceRoleViewer); err != nil {
+			respondWorkspaceError(c, err)
+			return "", nil, false
+		}
+		return workspaceID, nil, true
+	}
+	ids, all, err := taskService.VisibleWorkspaceIDs(userID, role)
+	if err != nil {
+		utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+		return "", nil, false
+	}
+	if all {
+		return "", nil, true
+	}
+	return "", ids, true
+}
+
+// workspaceParam 解析路径中的工作空间ID
+func workspaceParam(c *gin.Context) (primitive.ObjectID, bool) {
+	workspaceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.NotFound(c, service.ErrWorkspaceNotFound.Error())
+		return primitive.NilObjectID, false
+	}
+	return workspaceID, true
+}
+
+// ListMembers 列出工作空间成员
+// GET /api/workspaces/:id/members
+func (h *WorkspaceHandler) ListMembers(c *gin.Context) {
+	workspaceID, ok := workspaceParam(c)
+	if !ok {
+		return
+	}
+
+	userID, role := currentUser(c)
+	members, err := h.access.ListMembers(workspaceID, userID, role)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	utils.Success(c, members)
+}
+
+// AddMember 邀请成员，用户已是成员时修改其角色
+// POST /api/workspaces/:id/members
+func (h *WorkspaceHandler) AddMember(c *gin.Context) {
+	workspaceID, ok := workspaceParam(c)
+	if !ok {
+		return
+	}
+	var req workspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+	member, err := h.userService.GetUserByID(req.UserID)
+	if err != nil {
+		utils.NotFound(c, "用户不存在")
+		return
+	}
+
+	h.setMember(c, workspaceID, member.ID, req.Role)
+}
+
+// UpdateMemberRole 修改成员角色
+// PUT /api/workspaces/:id/members/:user_id
+func (h *WorkspaceHandler) UpdateMemberRole(c *gin.Context) {
+	workspaceID, ok := workspaceParam(c)
+	if !ok {
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		utils.NotFound(c, service.ErrWorkspaceMemberNotFound.Error())
+		return
+	}
+	var req workspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	h.setMember(c, workspaceID, memberID, req.Role)
+}
+
+// setMember 保存成员角色
+func (h *WorkspaceHandler) setMember(c *gin.Context, workspaceID, memberID primitive.ObjectID, memberRole models.WorkspaceRole) {
+	userID, role := currentUser(c)
+	member, err := h.access.SetMember(workspaceID, memberID, memberRole, userID, role)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "保存成功", member)
+}
+
+// RemoveMember 移除成员
+// DELETE /api/workspaces/:id/members/:user_id
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	workspaceID, ok := workspaceParam(c)
+	if !ok {
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		utils.NotFound(c, service.ErrWorkspaceMemberNotFound.Error())
+		return
+	}
+
+	userID, role := currentUser(c)
+	if err := h.access.RemoveMember(workspaceID, memberID, userID, role); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	utils.SuccessWithMessage(c, "移除成功", nil)
+}
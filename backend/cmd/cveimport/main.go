@@ -0,0 +1,57 @@
+// cveimport 将 CVE 元数据导入本地数据库，供漏洞合并时补充 CVSS 评分和描述
+//
+//	go run ./cmd/cveimport -config config/config.yaml -feed nvdcve-2.0-2024.json
+//
+// 数据源格式见 service.ParseCVEFeed
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"moongazing/config"
+	"moongazing/database"
+	"moongazing/service"
+)
+
+func main() {
+	configPath := flag.String("config", "config/config.yaml", "config file path")
+	feedPath := flag.String("feed", "", "CVE feed file (JSON array or NVD CVE API 2.0)")
+	flag.Parse()
+
+	if *feedPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if envPath := os.Getenv("CONFIG_PATH"); envPath != "" && !isFlagSet("config") {
+		*configPath = envPath
+	}
+
+	cfg := config.LoadConfig(*configPath)
+	database.InitMongoDB(&cfg.MongoDB)
+	defer database.CloseMongoDB()
+
+	file, err := os.Open(*feedPath)
+	if err != nil {
+		log.Fatalf("Failed to open CVE feed: %v", err)
+	}
+	defer file.Close()
+
+	count, err := service.ImportCVEFeed(service.NewMongoCVEStore(), file)
+	if err != nil {
+		log.Fatalf("Failed to import CVE feed after %d entries: %v", count, err)
+	}
+	log.Printf("Imported %d CVE entries from %s", count, *feedPath)
+}
+
+// isFlagSet 命令行是否显式指定了参数
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
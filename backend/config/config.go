@@ -48,6 +48,34 @@ type ScannerConfig struct {
 	Timeout     int `mapstructure:"timeout"`
 	RetryCount  int `mapstructure:"retry_count"`
 	RetryDelay  int `mapstructure:"retry_delay"`
+
+	DictPath         string                 `mapstructure:"dict_path"` // 字典和规则目录（含 txt、yaml 子目录），为空时使用环境变量 MOONGAZING_DICT_PATH 或按工作目录查找
+	TaskTimeLimits   TaskTimeLimitConfig    `mapstructure:"task_time_limits"`
+	FingerprintRules FingerprintRulesConfig `mapstructure:"fingerprint_rules"`
+	GeoIP            GeoIPConfig            `mapstructure:"geoip"`
+}
+
+// GeoIPConfig IP 归属数据库配置
+type GeoIPConfig struct {
+	ASNDatabase   string `mapstructure:"asn_database"`   // GeoLite2-ASN.mmdb 路径，文件不存在时不查询 ASN 和组织
+	CityDatabase  string `mapstructure:"city_database"`  // GeoLite2-City.mmdb（或 Country）路径，文件不存在时不查询国家和城市
+	WatchInterval int    `mapstructure:"watch_interval"` // 检查数据库文件变化并自动重新加载的间隔(秒)，0 不检查
+}
+
+// FingerprintRulesConfig 指纹规则加载配置
+type FingerprintRulesConfig struct {
+	Strict          bool   `mapstructure:"strict"`            // 严格模式：规则文件有任何错误时拒绝启动/重新加载，否则跳过错误规则
+	CustomRulesFile string `mapstructure:"custom_rules_file"` // 通过 API 提交的规则保存位置，为空时 data/custom-rules.yaml
+	WatchInterval   int    `mapstructure:"watch_interval"`    // 检查规则文件变化并自动重新加载的间隔(秒)，0 不检查
+}
+
+// TaskTimeLimitConfig 任务执行时间上限配置（单位均为分钟）
+type TaskTimeLimitConfig struct {
+	Default     int            `mapstructure:"default"`      // 未单独配置的任务类型使用的上限，0 使用 24 小时
+	Types       map[string]int `mapstructure:"types"`        // 按任务类型配置的上限，例如 fingerprint: 120
+	MinOverride int            `mapstructure:"min_override"` // 任务级覆盖允许的最小值
+	MaxOverride int            `mapstructure:"max_override"` // 任务级覆盖允许的最大值
+	WarnPercent int            `mapstructure:"warn_percent"` // 超时预警阈值百分比，0 使用 80
 }
 
 type LogConfig struct {
@@ -59,14 +87,26 @@ type LogConfig struct {
 }
 
 type AlertConfig struct {
-	Enabled bool     `mapstructure:"enabled"`
-	Types   []string `mapstructure:"types"`
+	Enabled   bool     `mapstructure:"enabled"`
+	Types     []string `mapstructure:"types"`
+	SecretKey string   `mapstructure:"secret_key"` // 通知渠道配置在数据库中的加密密钥，为空时使用 jwt.secret
 }
 
 type ThirdPartyConfig struct {
 	Fofa   FofaConfig   `mapstructure:"fofa"`
 	Hunter HunterConfig `mapstructure:"hunter"`
 	Quake  QuakeConfig  `mapstructure:"quake"`
+	OTX    OTXConfig    `mapstructure:"otx"`
+	Chaos  ChaosConfig  `mapstructure:"chaos"`
+
+	CacheTTL           int `mapstructure:"cache_ttl"`            // 查询结果缓存时间(小时)，0 使用默认 24 小时，负数禁用
+	QuotaWarnThreshold int `mapstructure:"quota_warn_threshold"` // 剩余配额低于该值时告警，0 不告警
+	PageDelay          int `mapstructure:"page_delay"`           // 分页请求间隔(毫秒)，0 使用默认 1000
+
+	SourceTimeouts   map[string]int `mapstructure:"source_timeouts"`    // 被动数据源查询超时(秒)，如 crtsh: 60
+	CrtShSkipExpired bool           `mapstructure:"crtsh_skip_expired"` // crt.sh 忽略已过期的证书
+
+	SecretKey string `mapstructure:"secret_key"` // 工作空间 API 密钥在数据库中的加密密钥，为空时与通知渠道使用相同的密钥
 }
 
 type FofaConfig struct {
@@ -82,6 +122,16 @@ type QuakeConfig struct {
 	Key string `mapstructure:"key"`
 }
 
+// OTXConfig AlienVault OTX 配置，密钥可选
+type OTXConfig struct {
+	Key string `mapstructure:"key"`
+}
+
+// ChaosConfig ProjectDiscovery Chaos 配置，密钥可选
+type ChaosConfig struct {
+	Key string `mapstructure:"key"`
+}
+
 var (
 	cfg  *Config
 	once sync.Once
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Baseline copies of the rule files detection depends on, so a bare binary (installed as a
+// service, or run from another working directory) still has a usable rule set
+//
+//go:embed dicts/yaml/finger.yaml dicts/yaml/jslib.yaml dicts/yaml/ports.yaml dicts/yaml/favicon.yaml dicts/yaml/service_finger.yaml dicts/yaml/waf.yaml
+var embeddedDicts embed.FS
+
+const embeddedDictDir = "dicts/yaml"
+
+// EmbeddedDictPrefix marks a dictionary path served from the copy built into the binary, e.g. embedded:finger.yaml
+const EmbeddedDictPrefix = "embedded:"
+
+// DictPathEnv sets the dictionary directory when scanner.dict_path is not configured
+const DictPathEnv = "MOONGAZING_DICT_PATH"
+
+// DictYAMLDir returns the directory of the YAML rule files
+func DictYAMLDir() string {
+	return filepath.Join(GetDictBasePath(), "yaml")
+}
+
+// ResolveDictFile returns the path of the YAML file name in dir. When the file does not exist
+// and an embedded copy is available, the embedded path is returned instead
+func ResolveDictFile(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil && HasEmbeddedDict(name) {
+		return EmbeddedDictPrefix + name
+	}
+	return path
+}
+
+// HasEmbeddedDict reports whether the binary carries a copy of the YAML file name
+func HasEmbeddedDict(name string) bool {
+	_, err := fs.Stat(embeddedDicts, embeddedDictDir+"/"+name)
+	return err == nil
+}
+
+// IsEmbeddedDict reports whether path refers to an embedded copy
+func IsEmbeddedDict(path string) bool {
+	return strings.HasPrefix(path, EmbeddedDictPrefix)
+}
+
+// ReadDictFile reads a dictionary file, including the embedded paths returned by ResolveDictFile
+func ReadDictFile(path string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(path, EmbeddedDictPrefix); ok {
+		return embeddedDicts.ReadFile(embeddedDictDir + "/" + name)
+	}
+	return os.ReadFile(path)
+}
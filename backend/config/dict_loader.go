@@ -2,8 +2,11 @@ package config
 
 import (
 	"bufio"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -19,6 +22,8 @@ type DictConfig struct {
 	Vuln           *VulnConfig
 	Ports          *PortsConfig
 	FaviconHashes  *FaviconHashConfig
+	SaaS           *SaaSConfig
+	TechAliases    *TechAliasConfig
 }
 
 // FingerprintConfig holds fingerprint rules
@@ -85,9 +90,38 @@ type SensitivePatternConfig struct {
 type PortsConfig struct {
 	CommonPorts    []int            `yaml:"common_ports"`
 	TopPorts       []int            `yaml:"top_ports"`
-	PortServiceMap map[int]string   `yaml:"port_service_map"`
+	PortServiceMap map[int]string   `yaml:"port_service_map"` // Unified port to service mapping, see loadPortsConfig
 	HTTPPorts      []int            `yaml:"http_ports"`
 	NonHTTPPorts   []int            `yaml:"non_http_ports"`
+
+	Conflicts []PortServiceConflict `yaml:"-"` // Ports defined differently in the two YAML shapes
+}
+
+// PortServiceConflict a port defined differently by the per-port entry and port_service_map
+type PortServiceConflict struct {
+	Port          int    `json:"port"`
+	Service       string `json:"service"`        // "<port>: {service: ...}" entry, takes effect
+	LegacyService string `json:"legacy_service"` // port_service_map entry, ignored
+}
+
+// SaaSConfig holds CNAME-based SaaS provider classification rules
+type SaaSConfig struct {
+	Providers []SaaSProviderConfig `yaml:"providers"`
+}
+
+// SaaSProviderConfig represents a SaaS provider identified by CNAME suffixes
+type SaaSProviderConfig struct {
+	Name                 string   `yaml:"name"`
+	Category             string   `yaml:"category"`
+	Handling             string   `yaml:"handling"` // skip-portscan, takeover-relevant, scan-normally
+	CNAMESuffixes        []string `yaml:"cname_suffixes"`
+	TakeoverFingerprints []string `yaml:"takeover_fingerprints,omitempty"`
+	NXDomain             bool     `yaml:"nxdomain,omitempty"` // dangling CNAME target indicates takeover
+}
+
+// TechAliasConfig maps canonical technology names to their variant spellings
+type TechAliasConfig struct {
+	Aliases map[string][]string `yaml:"aliases"` // canonical name -> aliases (case-insensitive)
 }
 
 // FaviconHashConfig holds favicon hash to product mapping
@@ -108,8 +142,14 @@ func SetDictBasePath(path string) {
 }
 
 // GetDictBasePath returns the base path for dictionary files
+// Precedence: SetDictBasePath (scanner.dict_path) > DictPathEnv > directories relative to the working directory
 func GetDictBasePath() string {
 	if dictBasePath == "" {
+		if envPath := os.Getenv(DictPathEnv); envPath != "" {
+			dictBasePath = envPath
+			return dictBasePath
+		}
+
 		// 尝试多个可能的路径
 		possiblePaths := []string{
 			"config/dicts",         // 当前目录
@@ -154,10 +194,16 @@ func LoadDictConfig() *DictConfig {
 		dictConfig.Vuln = loadVulnConfig(filepath.Join(yamlPath, "vuln.yaml"))
 
 		// Load ports config
-		dictConfig.Ports = loadPortsConfig(filepath.Join(yamlPath, "ports.yaml"))
+		dictConfig.Ports = loadPortsConfig(ResolveDictFile(yamlPath, "ports.yaml"))
 
 		// Load favicon hashes
 		dictConfig.FaviconHashes = loadFaviconHashConfig(filepath.Join(yamlPath, "favicon_hashes.yaml"))
+
+		// Load SaaS provider classification
+		dictConfig.SaaS = loadSaaSConfig(filepath.Join(yamlPath, "saas.yaml"))
+
+		// Load technology name aliases
+		dictConfig.TechAliases = LoadTechAliasConfigFile(filepath.Join(yamlPath, "aliases.yaml"))
 	})
 
 	return dictConfig
@@ -233,18 +279,63 @@ func loadVulnConfig(filePath string) *VulnConfig {
 	return config
 }
 
+// LoadPortsConfigFile loads and merges a ports.yaml file outside the dictionary cache,
+// e.g. to check conflicts before replacing the dictionary
+func LoadPortsConfigFile(filePath string) *PortsConfig {
+	return loadPortsConfig(filePath)
+}
+
 // loadPortsConfig loads port configuration from YAML
+// ports.yaml describes services in two shapes, merged into a single PortServiceMap:
+//
+//	443:                      # per-port entry, authoritative
+//	  service: https
+//	port_service_map:         # legacy flat map, used for ports without a per-port entry
+//	  443: https
+//
+// Ports defined differently in both shapes are recorded in Conflicts and logged during the transition period
 func loadPortsConfig(filePath string) *PortsConfig {
 	config := &PortsConfig{
 		PortServiceMap: make(map[int]string),
 	}
 
-	data, err := os.ReadFile(filePath)
+	data, err := ReadDictFile(filePath)
 	if err != nil {
 		return config
 	}
 
 	yaml.Unmarshal(data, config)
+	if config.PortServiceMap == nil {
+		config.PortServiceMap = make(map[int]string)
+	}
+
+	var entries map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return config
+	}
+	for key, node := range entries {
+		port, err := strconv.Atoi(key)
+		if err != nil || port <= 0 || port > 65535 {
+			continue
+		}
+		var entry struct {
+			Service string `yaml:"service"`
+		}
+		if err := node.Decode(&entry); err != nil || entry.Service == "" {
+			continue
+		}
+		service := strings.ToLower(strings.TrimSpace(entry.Service))
+		if legacy, ok := config.PortServiceMap[port]; ok && !strings.EqualFold(legacy, service) {
+			config.Conflicts = append(config.Conflicts, PortServiceConflict{Port: port, Service: service, LegacyService: legacy})
+		}
+		config.PortServiceMap[port] = service
+	}
+
+	sort.Slice(config.Conflicts, func(i, j int) bool { return config.Conflicts[i].Port < config.Conflicts[j].Port })
+	for _, c := range config.Conflicts {
+		log.Printf("[Dict] Port %d defined differently in %s: service=%s, port_service_map=%s (using %s)",
+			c.Port, filePath, c.Service, c.LegacyService, c.Service)
+	}
 	return config
 }
 
@@ -264,6 +355,37 @@ func loadFaviconHashConfig(filePath string) *FaviconHashConfig {
 	return config
 }
 
+// loadSaaSConfig loads SaaS classification configuration from YAML
+func loadSaaSConfig(filePath string) *SaaSConfig {
+	config := &SaaSConfig{}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return config
+	}
+
+	yaml.Unmarshal(data, config)
+	return config
+}
+
+// LoadTechAliasConfigFile loads technology name aliases from YAML
+func LoadTechAliasConfigFile(filePath string) *TechAliasConfig {
+	config := &TechAliasConfig{Aliases: make(map[string][]string)}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return config
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		log.Printf("[Dict] Failed to parse tech aliases %s: %v", filePath, err)
+	}
+	if config.Aliases == nil {
+		config.Aliases = make(map[string][]string)
+	}
+	return config
+}
+
 // ReloadDictConfig forces reload of dictionary configurations
 func ReloadDictConfig() *DictConfig {
 	dictConfigOnce = sync.Once{}
@@ -271,6 +393,14 @@ func ReloadDictConfig() *DictConfig {
 	return LoadDictConfig()
 }
 
+// GetTechAliases returns canonical technology name -> aliases
+func GetTechAliases() map[string][]string {
+	if aliases := GetDictConfig().TechAliases; aliases != nil {
+		return aliases.Aliases
+	}
+	return nil
+}
+
 // GetSubdomains returns the subdomain wordlist
 func GetSubdomains() []string {
 	return GetDictConfig().Subdomains
@@ -291,6 +421,11 @@ func GetCDNConfig() *CDNConfig {
 	return GetDictConfig().CDN
 }
 
+// GetSaaSConfig returns SaaS classification config
+func GetSaaSConfig() *SaaSConfig {
+	return GetDictConfig().SaaS
+}
+
 // GetVulnConfig returns vulnerability config
 func GetVulnConfig() *VulnConfig {
 	return GetDictConfig().Vuln
@@ -375,6 +510,36 @@ func GetPortServiceMap() map[int]string {
 	return nil
 }
 
+// LookupPortService returns the service name for a port from the unified mapping
+func LookupPortService(port int) (string, bool) {
+	service, ok := GetPortServiceMap()[port]
+	return service, ok && service != ""
+}
+
+// ResolvePortService picks the service label for an open port, in order of precedence:
+// service identified from the banner > protocol reported by the scanner (e.g. gogo) >
+// unified port mapping > "unknown". Generic values such as "tcp" and "unknown" carry no information
+func ResolvePortService(port int, bannerService, protocol string) string {
+	if service := normalizeServiceName(bannerService); service != "" {
+		return service
+	}
+	if service := normalizeServiceName(protocol); service != "" && service != "tcp" && service != "udp" {
+		return service
+	}
+	if service, ok := LookupPortService(port); ok {
+		return service
+	}
+	return "unknown"
+}
+
+func normalizeServiceName(service string) string {
+	service = strings.ToLower(strings.TrimSpace(service))
+	if service == "unknown" {
+		return ""
+	}
+	return service
+}
+
 // GetHTTPPorts returns ports that typically run HTTP services
 func GetHTTPPorts() []int {
 	portsConfig := GetPortsConfig()
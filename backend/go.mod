@@ -10,6 +10,8 @@ github.com/go-redis/redis/v8 v8.11.5
 github.com/golang-jwt/jwt/v5 v5.2.0
 github.com/google/uuid v1.5.0
 github.com/gorilla/websocket v1.5.3
+github.com/miekg/dns v1.1.65
+github.com/oschwald/maxminddb-golang v1.13.1
 github.com/robfig/cron/v3 v3.0.1
 github.com/shirou/gopsutil/v3 v3.23.7
 github.com/spaolacci/murmur3 v1.1.0
@@ -17,6 +19,8 @@ github.com/spf13/viper v1.18.2
 github.com/twmb/murmur3 v1.1.8
 go.mongodb.org/mongo-driver v1.13.1
 golang.org/x/crypto v0.44.0
+golang.org/x/net v0.47.0
+golang.org/x/text v0.31.0
 gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -27,6 +31,7 @@ github.com/andybalholm/cascadia v1.3.3 // indirect
 github.com/bytedance/sonic v1.9.1 // indirect
 github.com/cespare/xxhash/v2 v2.1.2 // indirect
 github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
+github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 github.com/fsnotify/fsnotify v1.7.0 // indirect
 github.com/gabriel-vasile/mimetype v1.4.2 // indirect
@@ -48,7 +53,6 @@ github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
 github.com/magiconair/properties v1.8.7 // indirect
 github.com/mattn/go-colorable v0.1.13 // indirect
 github.com/mattn/go-isatty v0.0.20 // indirect
-github.com/miekg/dns v1.1.65 // indirect
 github.com/mitchellh/mapstructure v1.5.0 // indirect
 github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 github.com/modern-go/reflect2 v1.0.2 // indirect
@@ -81,11 +85,9 @@ go.uber.org/ratelimit v0.2.0 // indirect
 golang.org/x/arch v0.3.0 // indirect
 golang.org/x/exp v0.0.0-20240222234643-814bf88cf225 // indirect
 golang.org/x/mod v0.29.0 // indirect
-golang.org/x/net v0.47.0 // indirect
 golang.org/x/sync v0.18.0 // indirect
 golang.org/x/sys v0.38.0 // indirect
 golang.org/x/term v0.37.0 // indirect
-golang.org/x/text v0.31.0 // indirect
 golang.org/x/tools v0.38.0 // indirect
 google.golang.org/protobuf v1.33.0 // indirect
 gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
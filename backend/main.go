@@ -5,17 +5,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"moongazing/api"
 	"moongazing/config"
 	"moongazing/database"
+	"moongazing/models"
 	"moongazing/router"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/geoip"
+	"moongazing/scanner/subdomain/thirdparty"
 	"moongazing/service"
 
 	"github.com/gin-gonic/gin"
@@ -51,12 +57,72 @@ func main() {
 	database.InitRedis(&cfg.Redis)
 	defer database.CloseRedis()
 	
+	// 第三方 API 查询缓存与配额统计使用 Redis 存储
+	thirdparty.SetDefaultOptions(thirdpartyOptions(cfg))
+	
+	// 按任务类型设置执行时间上限
+	service.SetTaskTimeLimits(taskTimeLimits(cfg))
+	
+	// 字典和规则目录：配置优先，其次环境变量 MOONGAZING_DICT_PATH，都未设置时按工作目录查找
+	if cfg.Scanner.DictPath != "" {
+		config.SetDictBasePath(cfg.Scanner.DictPath)
+	}
+	
+	// 加载指纹规则，严格模式下规则文件有错误时拒绝启动
+	fingerprint.SetCustomRulesFile(cfg.Scanner.FingerprintRules.CustomRulesFile)
+	rulesReport, err := fingerprint.InitDefaultRules(cfg.Scanner.FingerprintRules.Strict)
+	if err != nil {
+		log.Fatalf("Invalid fingerprint rules: %v", err)
+	}
+	if rulesReport.HasErrors() {
+		log.Printf("Warning: skipped %d invalid fingerprint rules, see /api/fingerprints/rules/status", rulesReport.Skipped)
+	}
+	rulesSummary := fingerprint.DefaultRulesSummary()
+	for _, file := range rulesSummary.Files {
+		switch {
+		case file.Error != "":
+			log.Printf("Warning: failed to load fingerprint rule file %s: %s", file.Name, file.Error)
+		case file.Embedded:
+			log.Printf("Fingerprint rule file %s not found in %s, using the embedded copy (%d entries)", file.Name, rulesSummary.Dir, file.Loaded)
+		}
+	}
+	if interval := cfg.Scanner.FingerprintRules.WatchInterval; interval > 0 {
+		go fingerprint.WatchDefaultRules(context.Background(), time.Duration(interval)*time.Second)
+	}
+	
+	// IP 归属数据库，文件不存在时端口结果不带归属信息
+	if err := geoip.Configure(cfg.Scanner.GeoIP.ASNDatabase, cfg.Scanner.GeoIP.CityDatabase); err != nil {
+		log.Printf("Warning: Failed to load GeoIP databases: %v", err)
+	} else if !geoip.Default().Available() {
+		log.Printf("GeoIP databases not found, port results will not include ASN and location")
+	}
+	if interval := cfg.Scanner.GeoIP.WatchInterval; interval > 0 {
+		go geoip.Watch(context.Background(), time.Duration(interval)*time.Second)
+	}
+	
+	// 扫描结果集合的查询索引
+	if err := service.NewResultService().EnsureIndexes(); err != nil {
+		log.Printf("Warning: Failed to create result indexes: %v", err)
+	}
+	if err := service.EnsureStatsIndexes(); err != nil {
+		log.Printf("Warning: Failed to create stats indexes: %v", err)
+	}
+	if err := service.EnsureFindingIndexes(); err != nil {
+		log.Printf("Warning: Failed to create finding indexes: %v", err)
+	}
+	if err := service.EnsureAssetIndexes(); err != nil {
+		log.Printf("Warning: Failed to create asset indexes: %v", err)
+	}
+	
 	// Initialize default admin user
 	userService := service.NewUserService()
 	if err := userService.InitAdmin(); err != nil {
 		log.Printf("Warning: Failed to initialize admin user: %v", err)
 	}
 	
+	// Grant admins owner on existing workspaces so single-user deployments keep working
+	service.InitWorkspaceOwners()
+	
 	// Scan POC directory for auto-import
 	log.Println("Scanning POC directory...")
 	pocService := service.NewPOCService()
@@ -76,6 +142,13 @@ func main() {
 	}
 	pocService.ScanPOCDirectory(pocDir)
 	
+	// 通知投递记录写入数据库，重新发送上次退出时未完成的投递
+	service.InitNotifyDelivery()
+	// 加载工作空间的通知渠道
+	service.InitNotifyChannels()
+	// 补齐内置任务模板
+	service.InitBuiltInTemplates()
+
 	// Start task executor
 	log.Println("Starting task executor...")
 	taskExecutor := service.NewTaskExecutor(5) // 5 workers
@@ -92,6 +165,11 @@ func main() {
 	log.Println("Cruise scheduler started")
 	defer cruiseService.Stop()
 
+	// 每天按工作空间的保留策略清理过期结果和孤立结果
+	retentionJob := service.NewRetentionJob(service.NewMongoRetentionStore())
+	retentionJob.Start()
+	defer retentionJob.Stop()
+
 	// Initialize WebSocket hub for real-time data
 	log.Println("Initializing WebSocket hub...")
 	wsHub := api.NewHub()
@@ -119,3 +197,55 @@ func main() {
 	
 	log.Println("Shutting down server...")
 }
+
+// taskTimeLimits 根据配置构建任务时间上限，未配置的项使用默认值
+func taskTimeLimits(cfg *config.Config) service.TaskTimeLimits {
+	limits := service.DefaultTaskTimeLimits()
+	tc := cfg.Scanner.TaskTimeLimits
+	if tc.Default > 0 {
+		limits.Default = time.Duration(tc.Default) * time.Minute
+	}
+	for taskType, minutes := range tc.Types {
+		if minutes > 0 {
+			limits.Types[models.TaskType(taskType)] = time.Duration(minutes) * time.Minute
+		}
+	}
+	if tc.MinOverride > 0 {
+		limits.MinOverride = time.Duration(tc.MinOverride) * time.Minute
+	}
+	if tc.MaxOverride > 0 {
+		limits.MaxOverride = time.Duration(tc.MaxOverride) * time.Minute
+	}
+	if tc.WarnPercent > 0 && tc.WarnPercent < 100 {
+		limits.WarnRatio = float64(tc.WarnPercent) / 100
+	}
+	return limits
+}
+
+// thirdpartyOptions 根据配置构建第三方 API 管理器选项
+func thirdpartyOptions(cfg *config.Config) thirdparty.ManagerOptions {
+	opts := thirdparty.ManagerOptions{
+		CacheTTL:           thirdparty.DefaultCacheTTL,
+		QuotaWarnThreshold: cfg.ThirdParty.QuotaWarnThreshold,
+		PageDelay:          thirdparty.DefaultPageDelay,
+		Store:              thirdparty.NewRedisStore(database.GetRedis()),
+	}
+	if cfg.ThirdParty.CacheTTL < 0 {
+		opts.CacheTTL = 0
+	} else if cfg.ThirdParty.CacheTTL > 0 {
+		opts.CacheTTL = time.Duration(cfg.ThirdParty.CacheTTL) * time.Hour
+	}
+	if cfg.ThirdParty.PageDelay > 0 {
+		opts.PageDelay = time.Duration(cfg.ThirdParty.PageDelay) * time.Millisecond
+	}
+	if len(cfg.ThirdParty.SourceTimeouts) > 0 {
+		opts.SourceTimeouts = make(map[string]time.Duration)
+		for source, seconds := range cfg.ThirdParty.SourceTimeouts {
+			if seconds > 0 {
+				opts.SourceTimeouts[source] = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	opts.CrtShSkipExpired = cfg.ThirdParty.CrtShSkipExpired
+	return opts
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var taskService = service.NewTaskService()
+
+// TaskAccessMiddleware checks the current user's role in the workspace of the task in the :id path parameter.
+// Tasks outside the user's workspaces are reported as not found; read-only members get 403 on changes.
+// The authorized task is stored in the context under "task".
+func TaskAccessMiddleware(need models.WorkspaceRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID primitive.ObjectID
+		if v, ok := c.Get("user_id"); ok {
+			if s, ok := v.(string); ok {
+				userID, _ = primitive.ObjectIDFromHex(s)
+			}
+		}
+		role, _ := c.Get("role")
+		roleStr, _ := role.(string)
+
+		task, err := taskService.GetTaskForUser(c.Param("id"), userID, roleStr, need)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound):
+				utils.NotFound(c, err.Error())
+			case errors.Is(err, service.ErrWorkspaceForbidden):
+				utils.Forbidden(c, err.Error())
+			default:
+				utils.Error(c, utils.ErrCodeDatabaseError, err.Error())
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("task", task)
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// APIKey 工作空间保存的第三方数据源密钥，每个工作空间每个数据源一条
+// 密钥加密后保存在 Secret 字段，Key 只在提交和执行任务时使用，接口返回脱敏值
+type APIKey struct {
+	ID          string            `json:"-" bson:"_id"` // 工作空间ID:数据源
+	WorkspaceID string            `json:"workspace_id" bson:"workspace_id"`
+	Provider    string            `json:"provider" bson:"provider"`       // fofa, hunter, quake, securitytrails
+	Email       string            `json:"email,omitempty" bson:"email"`   // Fofa 账号邮箱
+	Key         string            `json:"key,omitempty" bson:"-"`         // 明文密钥
+	Secret      string            `json:"-" bson:"secret"`                // 加密的密钥
+	Enabled     bool              `json:"enabled" bson:"enabled"`         // 关闭后任务不再自动使用
+	UsageCount  int64             `json:"usage_count" bson:"usage_count"` // 任务中调用查询接口的次数
+	LastUsedAt  *time.Time        `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	Validation  *APIKeyValidation `json:"validation,omitempty" bson:"validation,omitempty"` // 最近一次校验结果
+	CreatedAt   time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at" bson:"updated_at"`
+}
+
+// APIKeyValidation 密钥校验结果
+type APIKeyValidation struct {
+	Valid     bool      `json:"valid" bson:"valid"`
+	Remaining int       `json:"remaining" bson:"remaining"` // 剩余配额或积分，-1 表示数据源未提供
+	Message   string    `json:"message,omitempty" bson:"message,omitempty"`
+	CheckedAt time.Time `json:"checked_at" bson:"checked_at"`
+}
+
+// APIKeyID 工作空间数据源密钥的记录ID
+func APIKeyID(workspaceID, provider string) string {
+	return workspaceID + ":" + provider
+}
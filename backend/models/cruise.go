@@ -15,6 +15,20 @@ const (
 	CruiseStatusRunning  CruiseStatus = "running"  // 执行中
 )
 
+// CruiseOverlapPolicy 上一次触发的任务仍未结束时的处理策略
+type CruiseOverlapPolicy string
+
+const (
+	CruiseOverlapSkip  CruiseOverlapPolicy = "skip"  // 跳过本次触发（默认）
+	CruiseOverlapAllow CruiseOverlapPolicy = "allow" // 照常触发，允许多次执行并行
+)
+
+// Collection names for cruise
+const (
+	CollectionCruiseTasks = "cruise_tasks"
+	CollectionCruiseLogs  = "cruise_logs"
+)
+
 // CruiseTask 巡航任务（定时自动扫描）
 type CruiseTask struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
@@ -26,6 +40,7 @@ type CruiseTask struct {
 	// 定时配置
 	CronExpr    string `json:"cron_expr" bson:"cron_expr"`       // Cron 表达式，如 "0 2 * * *" 每天凌晨2点
 	Timezone    string `json:"timezone" bson:"timezone"`         // 时区，如 "Asia/Shanghai"
+	OverlapPolicy CruiseOverlapPolicy `json:"overlap_policy,omitempty" bson:"overlap_policy,omitempty"` // 重叠策略，默认 skip
 	
 	// 扫描目标
 	Targets     []string `json:"targets" bson:"targets"`         // 目标列表
@@ -62,6 +77,7 @@ type CruiseTaskCreateRequest struct {
 	Description      string     `json:"description"`
 	CronExpr         string     `json:"cron_expr" binding:"required"` // Cron 表达式
 	Timezone         string     `json:"timezone"`                     // 默认 Asia/Shanghai
+	OverlapPolicy    CruiseOverlapPolicy `json:"overlap_policy"`      // 默认 skip
 	Targets          []string   `json:"targets" binding:"required"`
 	TargetType       string     `json:"target_type"`
 	TaskType         TaskType   `json:"task_type" binding:"required"`
@@ -78,6 +94,7 @@ type CruiseTaskUpdateRequest struct {
 	Description      *string     `json:"description"`
 	CronExpr         *string     `json:"cron_expr"`
 	Timezone         *string     `json:"timezone"`
+	OverlapPolicy    *CruiseOverlapPolicy `json:"overlap_policy"`
 	Targets          []string    `json:"targets"`
 	TargetType       *string     `json:"target_type"`
 	TaskType         *TaskType   `json:"task_type"`
@@ -96,11 +113,21 @@ type CruiseLog struct {
 	Status      string             `json:"status" bson:"status"` // success, failed, running
 	StartTime   time.Time          `json:"start_time" bson:"start_time"`
 	EndTime     time.Time          `json:"end_time,omitempty" bson:"end_time,omitempty"`
-	Duration    int64              `json:"duration" bson:"duration"` // 秒
+	DurationMs  int64              `json:"duration_ms" bson:"duration_ms"`
 	ResultCount int                `json:"result_count" bson:"result_count"`
 	VulnCount   int                `json:"vuln_count" bson:"vuln_count"`
 	Error       string             `json:"error,omitempty" bson:"error,omitempty"`
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+
+	LegacyDurationSec int64 `json:"-" bson:"duration,omitempty"` // 旧版本以秒保存的耗时，只读
+}
+
+// ElapsedMs 执行耗时（毫秒），旧日志只有以秒保存的 duration 时换算
+func (l *CruiseLog) ElapsedMs() int64 {
+	if l.DurationMs == 0 && l.LegacyDurationSec > 0 {
+		return l.LegacyDurationSec * 1000
+	}
+	return l.DurationMs
 }
 
 // GetCronDescription 获取 Cron 表达式的中文描述
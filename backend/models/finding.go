@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindingStatus 漏洞生命周期状态
+type FindingStatus string
+
+const (
+	FindingStatusOpen          FindingStatus = "open"           // 待处理
+	FindingStatusFixed         FindingStatus = "fixed"          // 已修复，再次扫描到时重新打开
+	FindingStatusAccepted      FindingStatus = "accepted"       // 接受风险
+	FindingStatusFalsePositive FindingStatus = "false_positive" // 误报
+)
+
+// Finding 工作空间漏洞：同一工作空间中 目标 + 漏洞ID 相同的扫描结果合并为一条，
+// 记录首次/最近发现时间、发现次数和处理状态
+type Finding struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	Target      string             `json:"target" bson:"target"`
+	VulnID      string             `json:"vuln_id" bson:"vuln_id"`
+	Name        string             `json:"name" bson:"name"`
+	Severity    string             `json:"severity" bson:"severity"`
+	Source      string             `json:"source,omitempty" bson:"source,omitempty"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	References  []string           `json:"references,omitempty" bson:"references,omitempty"`
+	CVEIDs      []string           `json:"cve_ids,omitempty" bson:"cve_ids,omitempty"`
+
+	// CVE 元数据，多个 CVE 时取评分最高的一个
+	CVSSScore  float64 `json:"cvss_score,omitempty" bson:"cvss_score,omitempty"`
+	CVSSVector string  `json:"cvss_vector,omitempty" bson:"cvss_vector,omitempty"`
+	CVESummary string  `json:"cve_summary,omitempty" bson:"cve_summary,omitempty"`
+
+	Status        FindingStatus         `json:"status" bson:"status"`
+	PossiblyFixed bool                  `json:"possibly_fixed" bson:"possibly_fixed"` // 超过 N 天未在新扫描中出现
+	History       []FindingStatusChange `json:"history,omitempty" bson:"history,omitempty"`
+
+	Occurrences int                `json:"occurrences" bson:"occurrences"` // 被发现的次数（扫描结果数）
+	FirstTaskID primitive.ObjectID `json:"first_task_id" bson:"first_task_id"`
+	LastTaskID  primitive.ObjectID `json:"last_task_id" bson:"last_task_id"`
+	FirstSeen   time.Time          `json:"first_seen" bson:"first_seen"`
+	LastSeen    time.Time          `json:"last_seen" bson:"last_seen"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// FindingStatusChange 状态变更记录
+type FindingStatusChange struct {
+	From FindingStatus `json:"from" bson:"from"`
+	To   FindingStatus `json:"to" bson:"to"`
+	Note string        `json:"note,omitempty" bson:"note,omitempty"`
+	By   string        `json:"by" bson:"by"` // 操作人，扫描重新发现时为 system
+	At   time.Time     `json:"at" bson:"at"`
+}
+
+// CVEMetadata 本地 CVE 元数据，由 cveimport 命令从 JSON 数据源导入
+type CVEMetadata struct {
+	ID         string    `json:"id" bson:"_id"` // CVE-2021-44228
+	CVSSScore  float64   `json:"cvss_score" bson:"cvss_score"`
+	CVSSVector string    `json:"cvss_vector,omitempty" bson:"cvss_vector,omitempty"`
+	Severity   string    `json:"severity,omitempty" bson:"severity,omitempty"`
+	Summary    string    `json:"summary,omitempty" bson:"summary,omitempty"`
+	References []string  `json:"references,omitempty" bson:"references,omitempty"`
+	Published  time.Time `json:"published,omitempty" bson:"published,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Collection names for findings
+const (
+	CollectionFindings    = "findings"
+	CollectionCVEMetadata = "cve_metadata"
+)
@@ -23,22 +23,87 @@ const (
 	ResultTypeMonitor    ResultType = "monitor"     // 页面监控
 	ResultTypePort       ResultType = "port"        // 端口
 	ResultTypeService    ResultType = "service"     // 服务
+	ResultTypeLiveness   ResultType = "liveness"    // 主机存活探测（未存活主机）
 )
 
 // ScanResult 扫描结果基础结构
 type ScanResult struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaskID          primitive.ObjectID `json:"task_id" bson:"task_id"`
+	WorkspaceID     primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	Type            ResultType         `json:"type" bson:"type"`
+	Data            bson.M             `json:"data" bson:"data"`
+	Tags            []string           `json:"tags" bson:"tags"`
+	Project         string             `json:"project" bson:"project"`
+	Source          string             `json:"source" bson:"source"`                                           // 来源：主动扫描/被动发现
+	Sources         []string           `json:"sources,omitempty" bson:"sources,omitempty"`                     // 写入过该结果的全部来源（去重合并时累积）
+	FirstSeenSource string             `json:"first_seen_source,omitempty" bson:"first_seen_source,omitempty"` // 首次发现该结果的来源
+	FirstSeenAt     *time.Time         `json:"first_seen_at,omitempty" bson:"first_seen_at,omitempty"`         // 首次发现时间
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ResultFilter 结构化结果查询条件
+type ResultFilter struct {
+	Type        ResultType        `json:"type" bson:"type"`                                     // 结果类型
+	Tags        []string          `json:"tags,omitempty" bson:"tags,omitempty"`                 // 包含任一标签
+	Conditions  []ResultCondition `json:"conditions,omitempty" bson:"conditions,omitempty"`     // 数据字段条件（全部满足）
+	TargetField string            `json:"target_field,omitempty" bson:"target_field,omitempty"` // 作为目标的数据字段，为空时按结果类型选择
+	Limit       int               `json:"limit,omitempty" bson:"limit,omitempty"`               // 最大结果数
+}
+
+// ResultCondition 结果数据字段条件
+type ResultCondition struct {
+	Field string      `json:"field" bson:"field"` // data 下的字段名，如 status_code、priority
+	Op    string      `json:"op" bson:"op"`       // eq, ne, gt, gte, lt, lte, in, nin, exists, contains, not_contains, ends_with, not_ends_with
+	Value interface{} `json:"value" bson:"value"`
+}
+
+// ResultSort 结果排序
+type ResultSort struct {
+	Field string `json:"field" bson:"field"` // created_at、updated_at 或 data 下的字段名
+	Order string `json:"order" bson:"order"` // asc, desc
+}
+
+// SavedSearch 保存的结果搜索
+type SavedSearch struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description" bson:"description"`
 	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
-	Type        ResultType         `json:"type" bson:"type"`
-	Data        bson.M             `json:"data" bson:"data"`
-	Tags        []string           `json:"tags" bson:"tags"`
-	Project     string             `json:"project" bson:"project"`
-	Source      string             `json:"source" bson:"source"` // 来源：主动扫描/被动发现
+	ResultType  ResultType         `json:"result_type" bson:"result_type"`
+	Filter      ResultFilter       `json:"filter" bson:"filter"` // Type 与 ResultType 一致
+	Sort        ResultSort         `json:"sort" bson:"sort"`
+	OwnerID     primitive.ObjectID `json:"owner_id" bson:"owner_id"`
+	Shared      bool               `json:"shared" bson:"shared"` // 共享后工作空间内可见，否则仅创建者可见
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// RedactionPolicy 导出结果、生成报告时使用的脱敏策略，按工作空间保存
+// 字段均指 data 下的字段，支持 "headers.Authorization" 形式的嵌套路径
+type RedactionPolicy struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name         string             `json:"name" bson:"name"`
+	Description  string             `json:"description" bson:"description"`
+	WorkspaceID  primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	DropFields   []string           `json:"drop_fields" bson:"drop_fields"`     // 删除的字段
+	MaskFields   []RedactionMask    `json:"mask_fields" bson:"mask_fields"`     // 掩码的字段
+	ExcludeTypes []ResultType       `json:"exclude_types" bson:"exclude_types"` // 不导出的结果类型
+	MaskSecrets  bool               `json:"mask_secrets" bson:"mask_secrets"`   // 敏感信息的匹配值在所有字段中掩码
+	BuiltIn      bool               `json:"built_in" bson:"-"`
+	CreatedBy    primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// RedactionMask 字段掩码规则
+type RedactionMask struct {
+	Field       string `json:"field" bson:"field"`                                 // "*" 表示所有字符串字段
+	Pattern     string `json:"pattern,omitempty" bson:"pattern,omitempty"`         // 正则，为空时替换整个值
+	Replacement string `json:"replacement,omitempty" bson:"replacement,omitempty"` // 替换内容，支持 ${1} 引用分组，默认 ***
+}
+
 // SubdomainResult 子域名结果
 type SubdomainResult struct {
 	Subdomain   string   `json:"subdomain" bson:"subdomain"`
@@ -165,7 +230,46 @@ type PortResult struct {
 	Fingerprint []string `json:"fingerprint" bson:"fingerprint"`
 }
 
+// AssetKind 工作空间资产类型
+type AssetKind string
+
+const (
+	AssetKindSubdomain AssetKind = "subdomain" // 子域名
+	AssetKindPort      AssetKind = "port"      // ip:port
+	AssetKindWeb       AssetKind = "web"       // Web 服务，按 URL host 去重
+)
+
+// Asset 工作空间资产：跨任务去重的子域名、端口、Web 服务，保存最近一次发现的信息
+type Asset struct {
+	ID           primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	WorkspaceID  primitive.ObjectID   `json:"workspace_id" bson:"workspace_id"`
+	Kind         AssetKind            `json:"kind" bson:"kind"`
+	Key          string               `json:"key" bson:"key"` // 资产标识：子域名、ip:port、host[:port]
+	Host         string               `json:"host,omitempty" bson:"host,omitempty"`
+	IP           string               `json:"ip,omitempty" bson:"ip,omitempty"`
+	Port         int                  `json:"port,omitempty" bson:"port,omitempty"`
+	URL          string               `json:"url,omitempty" bson:"url,omitempty"`
+	IPs          []string             `json:"ips,omitempty" bson:"ips,omitempty"`
+	Title        string               `json:"title,omitempty" bson:"title,omitempty"`
+	StatusCode   int                  `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Technologies []string             `json:"technologies,omitempty" bson:"technologies,omitempty"`
+	Service      string               `json:"service,omitempty" bson:"service,omitempty"`
+	ASN          int                  `json:"asn,omitempty" bson:"asn,omitempty"` // IP 归属，来自 GeoIP 数据库
+	Org          string               `json:"org,omitempty" bson:"org,omitempty"`
+	Country      string               `json:"country,omitempty" bson:"country,omitempty"`
+	CountryCode  string               `json:"country_code,omitempty" bson:"country_code,omitempty"`
+	City         string               `json:"city,omitempty" bson:"city,omitempty"`
+	TaskIDs      []primitive.ObjectID `json:"task_ids" bson:"task_ids"`           // 最近发现过该资产的任务，数量有上限
+	FirstTaskID  primitive.ObjectID   `json:"first_task_id" bson:"first_task_id"` // 首次发现的任务
+	LastTaskID   primitive.ObjectID   `json:"last_task_id" bson:"last_task_id"`
+	FirstSeen    time.Time            `json:"first_seen" bson:"first_seen"`
+	LastSeen     time.Time            `json:"last_seen" bson:"last_seen"`
+}
+
 // Collection names for results
 const (
-	CollectionScanResults = "scan_results"
+	CollectionScanResults       = "scan_results"
+	CollectionSavedSearches     = "saved_searches"
+	CollectionRedactionPolicies = "redaction_policies"
+	CollectionAssets            = "assets"
 )
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -36,6 +37,64 @@ const (
 	TaskStatusCancelled TaskStatus = "cancelled"
 )
 
+// TaskPriority 任务排队优先级，为空时按 normal 处理
+type TaskPriority string
+
+const (
+	TaskPriorityHigh   TaskPriority = "high"
+	TaskPriorityNormal TaskPriority = "normal"
+	TaskPriorityLow    TaskPriority = "low"
+)
+
+// TerminationReason 任务结束原因
+type TerminationReason string
+
+const (
+	TerminationUserCancel       TerminationReason = "user_cancel"       // 用户取消
+	TerminationDeadlineExceeded TerminationReason = "deadline_exceeded" // 超过时间上限
+	TerminationDeleted          TerminationReason = "deleted"           // 运行中任务被删除
+	TerminationWorkerShutdown   TerminationReason = "worker_shutdown"   // 执行器停止或重启
+	TerminationModuleFailure    TerminationReason = "module_failure"    // 模块异常或执行出错
+	TerminationCompleted        TerminationReason = "completed"         // 正常完成
+	TerminationMaxRetries       TerminationReason = "max_retries"       // 执行节点多次失联，移入死信队列
+)
+
+// TaskTermination 任务结束详情，失败和超时时记录当时的模块和进度快照
+type TaskTermination struct {
+	Reason          TerminationReason      `json:"reason" bson:"reason"`
+	Message         string                 `json:"message,omitempty" bson:"message,omitempty"`
+	Module          string                 `json:"module,omitempty" bson:"module,omitempty"`
+	Progress        int                    `json:"progress" bson:"progress"`
+	ProgressDetails map[string]interface{} `json:"progress_details,omitempty" bson:"progress_details,omitempty"`
+	NodeID          string                 `json:"node_id,omitempty" bson:"node_id,omitempty"`
+	At              time.Time              `json:"at" bson:"at"`
+}
+
+// UnmappedTechnology 任务中出现的、技术别名文件（aliases.yaml）未收录的名称
+type UnmappedTechnology struct {
+	Name  string `json:"name" bson:"name"`   // 小写后的名称
+	Raw   string `json:"raw" bson:"raw"`     // 原始名称
+	Count int    `json:"count" bson:"count"` // 出现次数
+}
+
+// SuppressionCount 任务中某个模块因某种原因丢弃或合并的结果数
+type SuppressionCount struct {
+	Module string `json:"module" bson:"module"`
+	Reason string `json:"reason" bson:"reason"` // duplicate, out_of_scope, stored_duplicate
+	Count  int64  `json:"count" bson:"count"`
+}
+
+// SuppressionSample 调试模式下采样保存的被丢弃条目
+type SuppressionSample struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id,omitempty" bson:"workspace_id,omitempty"`
+	Module      string             `json:"module" bson:"module"`
+	Reason      string             `json:"reason" bson:"reason"`
+	Item        string             `json:"item" bson:"item"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
 // Task represents a scan task
 type Task struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
@@ -44,6 +103,7 @@ type Task struct {
 	Description string             `json:"description" bson:"description"`
 	Type        TaskType           `json:"type" bson:"type"`
 	Status      TaskStatus         `json:"status" bson:"status"`
+	Priority    TaskPriority       `json:"priority,omitempty" bson:"priority,omitempty"` // 排队优先级
 	
 	// Target Configuration
 	Targets     []string `json:"targets" bson:"targets"` // IPs, domains, URLs
@@ -55,6 +115,8 @@ type Task struct {
 	// Schedule Configuration
 	IsScheduled bool   `json:"is_scheduled" bson:"is_scheduled"`
 	CronExpr    string `json:"cron_expr,omitempty" bson:"cron_expr,omitempty"`
+	CruiseID    primitive.ObjectID `json:"cruise_id,omitempty" bson:"cruise_id,omitempty"` // 触发该任务的巡航
+	TemplateID  primitive.ObjectID `json:"template_id,omitempty" bson:"template_id,omitempty"` // 创建任务使用的模板，配置创建时已复制
 	
 	// Execution Info
 	Progress        int                    `json:"progress" bson:"progress"` // 0-100
@@ -62,6 +124,16 @@ type Task struct {
 	NodeID          string                 `json:"node_id" bson:"node_id"` // assigned scanner node
 	StartedAt       time.Time              `json:"started_at,omitempty" bson:"started_at,omitempty"`
 	CompletedAt     time.Time              `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+
+	// Termination Info
+	TerminationReason TerminationReason `json:"termination_reason,omitempty" bson:"termination_reason,omitempty"`
+	Termination       *TaskTermination  `json:"termination,omitempty" bson:"termination,omitempty"`
+
+	// 别名文件未收录的技术名称，用于补充 aliases.yaml
+	UnmappedTechnologies []UnmappedTechnology `json:"unmapped_technologies,omitempty" bson:"unmapped_technologies,omitempty"`
+
+	// 各模块去重、排除等丢弃的结果数，任务结束时写入
+	SuppressionStats []SuppressionCount `json:"suppression_stats,omitempty" bson:"suppression_stats,omitempty"`
 	
 	// Results Summary
 	ResultStats TaskResultStats `json:"result_stats" bson:"result_stats"`
@@ -69,6 +141,13 @@ type Task struct {
 	// Retry Info
 	RetryCount  int    `json:"retry_count" bson:"retry_count"`
 	LastError   string `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Resume      bool   `json:"resume,omitempty" bson:"resume,omitempty"` // 下次执行从模块断点继续，执行开始时清除
+	
+	// Task Chaining
+	FollowUp     *FollowUpSpec        `json:"follow_up,omitempty" bson:"follow_up,omitempty"`           // 任务完成后自动创建的后续任务
+	ParentTaskID primitive.ObjectID   `json:"parent_task_id,omitempty" bson:"parent_task_id,omitempty"` // 父任务
+	ChildTaskIDs []primitive.ObjectID `json:"child_task_ids,omitempty" bson:"child_task_ids,omitempty"` // 由本任务结果创建的子任务
+	ChainDepth   int                  `json:"chain_depth,omitempty" bson:"chain_depth,omitempty"`       // 在任务链中的深度，根任务为 0
 	
 	// Metadata
 	CreatedBy   primitive.ObjectID `json:"created_by" bson:"created_by"`
@@ -85,14 +164,25 @@ type TaskConfig struct {
 	// Port Scan Config
 	PortScanMode  string `json:"port_scan_mode,omitempty" bson:"port_scan_mode,omitempty"` // quick, full, top1000, custom
 	PortRange     string `json:"port_range,omitempty" bson:"port_range,omitempty"` // e.g., "1-1000", "top100"
+	LivenessCheck bool   `json:"liveness_check,omitempty" bson:"liveness_check,omitempty"` // 端口扫描前对 IP/网段目标进行存活预检测
+	LivenessPorts       []int `json:"liveness_ports,omitempty" bson:"liveness_ports,omitempty"`             // 存活检测的 TCP 探测端口，默认 80,443,22
+	LivenessTimeout     int   `json:"liveness_timeout,omitempty" bson:"liveness_timeout,omitempty"`         // 单次探测超时(毫秒)
+	LivenessConcurrency int   `json:"liveness_concurrency,omitempty" bson:"liveness_concurrency,omitempty"` // 同时检测的主机数
+	LivenessICMP        bool  `json:"liveness_icmp,omitempty" bson:"liveness_icmp,omitempty"`               // 同时尝试 ICMP Echo（无权限时自动跳过）
+	IPv6Mode      string `json:"ipv6_mode,omitempty" bson:"ipv6_mode,omitempty"`           // IPv6 目标：为空时双栈主机使用 IPv4，prefer 优先 IPv6，skip 不扫描 IPv6 地址
+	HTTPProbe     *bool  `json:"http_probe,omitempty" bson:"http_probe,omitempty"`         // 对未识别服务的开放端口做 HTTP 探测，默认开启
+	HTTPProbeMinPort    int `json:"http_probe_min_port,omitempty" bson:"http_probe_min_port,omitempty"`         // 探测的最小端口，默认 1025
+	HTTPProbeMaxPerHost int `json:"http_probe_max_per_host,omitempty" bson:"http_probe_max_per_host,omitempty"` // 每个主机最多探测的端口数，默认 20
 	
 	// Subdomain Config
 	SubdomainDict string `json:"subdomain_dict,omitempty" bson:"subdomain_dict,omitempty"`
 	UsePassive    bool   `json:"use_passive,omitempty" bson:"use_passive,omitempty"`
+	KeepUnresolved bool  `json:"keep_unresolved,omitempty" bson:"keep_unresolved,omitempty"` // 记录被动来源中当前无法解析的子域名（不参与后续扫描）
+	WildcardHTTPConfirm bool `json:"wildcard_http_confirm,omitempty" bson:"wildcard_http_confirm,omitempty"` // 泛解析过滤时比较 HTTP 响应体，内容不同的子域名保留
 	
 	// Third-party API Config (for subdomain enumeration)
 	UseThirdParty bool     `json:"use_thirdparty,omitempty" bson:"use_thirdparty,omitempty"` // 是否使用第三方 API
-	ThirdPartySources []string `json:"thirdparty_sources,omitempty" bson:"thirdparty_sources,omitempty"` // fofa, hunter, quake, crtsh, securitytrails
+	ThirdPartySources []string `json:"thirdparty_sources,omitempty" bson:"thirdparty_sources,omitempty"` // fofa, hunter, quake, crtsh, otx, chaos, securitytrails
 	FofaEmail     string   `json:"fofa_email,omitempty" bson:"fofa_email,omitempty"`
 	FofaKey       string   `json:"fofa_key,omitempty" bson:"fofa_key,omitempty"`
 	HunterKey     string   `json:"hunter_key,omitempty" bson:"hunter_key,omitempty"`
@@ -101,14 +191,33 @@ type TaskConfig struct {
 	// Fingerprint Config
 	EnableFingerprint bool `json:"enable_fingerprint,omitempty" bson:"enable_fingerprint,omitempty"`
 	
+	// Screenshot Config（对指纹识别发现的 Web 服务截图，需要 chrome）
+	Screenshot            bool `json:"screenshot,omitempty" bson:"screenshot,omitempty"`
+	ScreenshotConcurrency int  `json:"screenshot_concurrency,omitempty" bson:"screenshot_concurrency,omitempty"` // 同时截图的页面数，默认 3
+	ScreenshotTimeout     int  `json:"screenshot_timeout,omitempty" bson:"screenshot_timeout,omitempty"`         // 单个页面超时(秒)，默认 30
+	
 	// Vuln Scan Config
 	POCIDs        []string `json:"poc_ids,omitempty" bson:"poc_ids,omitempty"`
 	POCTags       []string `json:"poc_tags,omitempty" bson:"poc_tags,omitempty"`
 	SeverityFilter []string `json:"severity_filter,omitempty" bson:"severity_filter,omitempty"`
+	// 漏洞扫描模板选择：只运行指定严重级别（critical、high 等）的模板；模板路径或目录（cves/、default-logins/）或标签
+	VulnSeverities  []string `json:"vuln_severities,omitempty" bson:"vuln_severities,omitempty"`
+	VulnTemplates   []string `json:"vuln_templates,omitempty" bson:"vuln_templates,omitempty"`
+	VulnRateLimit   int      `json:"vuln_rate_limit,omitempty" bson:"vuln_rate_limit,omitempty"`     // nuclei 每秒请求数，默认 150
+	VulnConcurrency int      `json:"vuln_concurrency,omitempty" bson:"vuln_concurrency,omitempty"`   // nuclei 并发模板数、内置引擎并发数
 	
 	// Dir Scan Config
 	DirDict       string `json:"dir_dict,omitempty" bson:"dir_dict,omitempty"`
 	Extensions    string `json:"extensions,omitempty" bson:"extensions,omitempty"`
+	Soft404Limit  int    `json:"soft404_limit,omitempty" bson:"soft404_limit,omitempty"` // 同一主机相同响应的路径数超过该值判定为软 404，0 默认 20，负数关闭
+	Soft404Tag    bool   `json:"soft404_tag,omitempty" bson:"soft404_tag,omitempty"`     // 疑似软 404 标记为 suspected_soft404 后保留，而不是丢弃
+	DirStatusInclude []int `json:"dir_status_include,omitempty" bson:"dir_status_include,omitempty"` // 目录扫描保留的状态码，为空时默认 2xx、3xx、401、403、405、500
+	DirStatusExclude []int `json:"dir_status_exclude,omitempty" bson:"dir_status_exclude,omitempty"` // 目录扫描排除的状态码
+	URLDedupSignature bool `json:"url_dedup_signature,omitempty" bson:"url_dedup_signature,omitempty"` // 爬虫和目录扫描的 URL 忽略参数值去重（?id=1 和 ?id=2 只保留一条）
+	URLDedupParameters bool `json:"url_dedup_parameters,omitempty" bson:"url_dedup_parameters,omitempty"` // 按请求方法 + 接口 + 参数名集合去重，表单提交的不同取值只保留一条
+	// 模块内去重的存储：memory、redis、bloom（URL 使用布隆过滤器，允许少量误判）；为空时按条目数自动切换
+	DedupBackend     string  `json:"dedup_backend,omitempty" bson:"dedup_backend,omitempty"`
+	DedupBloomFPRate float64 `json:"dedup_bloom_fp_rate,omitempty" bson:"dedup_bloom_fp_rate,omitempty"` // 布隆过滤器误判率，默认 0.001
 	
 	// Bruteforce Config
 	ServiceType   string `json:"service_type,omitempty" bson:"service_type,omitempty"`
@@ -119,13 +228,58 @@ type TaskConfig struct {
 	MaxDepth      int  `json:"max_depth,omitempty" bson:"max_depth,omitempty"`
 	MaxPages      int  `json:"max_pages,omitempty" bson:"max_pages,omitempty"`
 	FollowRedirect bool `json:"follow_redirect,omitempty" bson:"follow_redirect,omitempty"`
+	EndpointExtraction bool `json:"endpoint_extraction,omitempty" bson:"endpoint_extraction,omitempty"` // 从爬虫和目录扫描发现的 OpenAPI 文档、JS 文件中提取接口
+	SensitiveMaskEmails bool `json:"sensitive_mask_emails,omitempty" bson:"sensitive_mask_emails,omitempty"` // 敏感信息匹配上下文中同时掩码邮箱
 	
 	// General Config
 	Threads       int  `json:"threads,omitempty" bson:"threads,omitempty"`
 	Timeout       int  `json:"timeout,omitempty" bson:"timeout,omitempty"`
-	Proxy         string `json:"proxy,omitempty" bson:"proxy,omitempty"`
+	TimeLimit     int  `json:"time_limit,omitempty" bson:"time_limit,omitempty"` // 任务执行时间上限(分钟)，0 使用任务类型的默认值
+	ModuleTimeouts map[string]int `json:"module_timeouts,omitempty" bson:"module_timeouts,omitempty"` // 按模块名称设置运行时长上限(分钟)，超时的模块停止，其余模块继续
+	WatchdogTimeout int `json:"watchdog_timeout,omitempty" bson:"watchdog_timeout,omitempty"` // 看门狗超时(分钟)，模块输入关闭后超过该时间没有输出进展时任务失败；0 使用默认值，必须长于最长的模块超时
+	MaxPerIP      int  `json:"max_per_ip,omitempty" bson:"max_per_ip,omitempty"`             // 同一 IP 的最大并发请求数（指纹、爬虫、目录扫描合计），默认 10
+	IPQueueWarning int `json:"ip_queue_warning,omitempty" bson:"ip_queue_warning,omitempty"` // 单个 IP 排队数超过该值时在进度中提示，默认 50
+	MaxTargets    int  `json:"max_targets,omitempty" bson:"max_targets,omitempty"`           // 网段、IP 范围展开后的目标数上限，默认 4096
+	// 并发和速率设置，0 使用扫描器默认值，超出范围时限制到边界
+	RateLimit              int `json:"rate_limit,omitempty" bson:"rate_limit,omitempty"`                             // spray、katana 每秒请求数
+	PortScanThreads        int `json:"port_scan_threads,omitempty" bson:"port_scan_threads,omitempty"`               // gogo 线程数，默认 1000
+	HTTPConcurrency        int `json:"http_concurrency,omitempty" bson:"http_concurrency,omitempty"`                 // 指纹识别、HTTP 探测、spray 并发数
+	CrawlerConcurrency     int `json:"crawler_concurrency,omitempty" bson:"crawler_concurrency,omitempty"`           // katana、rad 并发数，默认 10
+	CrawlerBatchSize       int `json:"crawler_batch_size,omitempty" bson:"crawler_batch_size,omitempty"`             // katana 每批 URL 数，默认 100
+	CrawlerParallelBatches int `json:"crawler_parallel_batches,omitempty" bson:"crawler_parallel_batches,omitempty"` // katana 同时运行的批次数，默认 1
+	// 扫描出站网络设置，为空时使用工作空间的设置
+	Proxy         string   `json:"proxy,omitempty" bson:"proxy,omitempty"`         // 代理地址（http、https、socks5）
+	Resolvers     []string `json:"resolvers,omitempty" bson:"resolvers,omitempty"` // DNS 服务器 IP[:端口]，DoH 时为 https 地址
+	DoH           bool     `json:"doh,omitempty" bson:"doh,omitempty"`             // 使用 DNS over HTTPS 解析
+	// 认证扫描：指纹识别、HTTP 探测、katana、spray 的请求带上自定义请求头和 Cookie
+	CustomHeaders map[string]string `json:"custom_headers,omitempty" bson:"custom_headers,omitempty"` // 如 Authorization: Bearer xxx
+	CookieJar     string            `json:"cookie_jar,omitempty" bson:"cookie_jar,omitempty"`         // Cookie 请求头的值，如 session=abc; csrf=123
+	// User-Agent 策略：fixed 固定使用列表中的第一个，rotate 按顺序轮换，random 每个请求随机选择；为空时使用默认 User-Agent
+	UserAgentStrategy string   `json:"user_agent_strategy,omitempty" bson:"user_agent_strategy,omitempty"`
+	UserAgents        []string `json:"user_agents,omitempty" bson:"user_agents,omitempty"` // 候选列表，rotate、random 为空时使用内置的常见浏览器列表
 	VerifySSL     bool `json:"verify_ssl,omitempty" bson:"verify_ssl,omitempty"`
+	// 排除规则（不区分大小写）：通配符 *.example.com、正则 regex:^db\d+\.、IP 或网段 10.0.0.0/24
 	ExcludeList   []string `json:"exclude_list,omitempty" bson:"exclude_list,omitempty"`
+	// 扫描范围的包含规则：根域名 example.com（含子域名）、IP 或网段，为空时使用工作空间的设置
+	ScopeInclude  []string `json:"scope_include,omitempty" bson:"scope_include,omitempty"`
+	// 调试：按模块和原因采样保存被丢弃的条目，每种最多 SuppressionSamples 条（默认 20，上限 100）
+	DebugSuppression   bool `json:"debug_suppression,omitempty" bson:"debug_suppression,omitempty"`
+	SuppressionSamples int  `json:"suppression_samples,omitempty" bson:"suppression_samples,omitempty"`
+	// 巡航创建的任务完成时，通知中附带与同一巡航上次完成的任务的结果比较摘要
+	NotifyDiff bool `json:"notify_diff,omitempty" bson:"notify_diff,omitempty"`
+	// 任务完成和失败时是否发送通知，nil 时发送
+	NotifyOnComplete *bool `json:"notify_on_complete,omitempty" bson:"notify_on_complete,omitempty"`
+}
+
+// FollowUpSpec 后续任务配置
+// 任务成功完成后，按 Filter 筛选本任务的结果作为目标，使用模板创建子任务
+type FollowUpSpec struct {
+	Filter      ResultFilter  `json:"filter" bson:"filter"`
+	TemplateID  string        `json:"template_id,omitempty" bson:"template_id,omitempty"`   // 子任务模板，为空时沿用父任务的类型和配置
+	Name        string        `json:"name,omitempty" bson:"name,omitempty"`                 // 子任务名称，为空时自动生成
+	WorkspaceID string        `json:"workspace_id,omitempty" bson:"workspace_id,omitempty"` // 覆盖子任务的工作空间
+	MaxDepth    int           `json:"max_depth,omitempty" bson:"max_depth,omitempty"`       // 任务链最大深度，0 使用默认值
+	Next        *FollowUpSpec `json:"next,omitempty" bson:"next,omitempty"`                 // 子任务完成后的后续任务
 }
 
 // TaskResultStats represents task result statistics
@@ -142,14 +296,19 @@ type TaskResultStats struct {
 }
 
 // TaskTemplate represents reusable task templates
+// 从模板创建任务时复制模板的配置，之后修改模板不影响已创建的任务
 type TaskTemplate struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
 	Name        string             `json:"name" bson:"name"`
 	Description string             `json:"description" bson:"description"`
 	Type        TaskType           `json:"type" bson:"type"`
+	Priority    TaskPriority       `json:"priority,omitempty" bson:"priority,omitempty"`
+	Tags        []string           `json:"tags,omitempty" bson:"tags,omitempty"`
 	Config      TaskConfig         `json:"config" bson:"config"`
 	IsPublic    bool               `json:"is_public" bson:"is_public"`
+	BuiltIn     bool               `json:"built_in" bson:"built_in"`           // 内置模板，只读
+	Key         string             `json:"key,omitempty" bson:"key,omitempty"` // 内置模板标识，启动时按标识补齐缺失的内置模板
 	CreatedBy   primitive.ObjectID `json:"created_by" bson:"created_by"`
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
@@ -165,9 +324,109 @@ type TaskLog struct {
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 }
 
+// ToolRun records a single external tool invocation of a task
+type ToolRun struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	Tool        string             `json:"tool" bson:"tool"`
+	BinaryPath  string             `json:"binary_path" bson:"binary_path"`
+	BinaryHash  string             `json:"binary_hash" bson:"binary_hash"` // sha256
+	Version     string             `json:"version" bson:"version"`
+	Args        []string           `json:"args" bson:"args"` // secrets redacted
+	Inputs      []ToolRunInput     `json:"inputs,omitempty" bson:"inputs,omitempty"`
+	ExitCode    int                `json:"exit_code" bson:"exit_code"`
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"`
+	StartedAt   time.Time          `json:"started_at" bson:"started_at"`
+	FinishedAt  time.Time          `json:"finished_at" bson:"finished_at"`
+	DurationMs  int64              `json:"duration_ms" bson:"duration_ms"`
+
+	Stderr          string `json:"stderr,omitempty" bson:"stderr,omitempty"` // last 4KB, secrets redacted
+	StderrTruncated bool   `json:"stderr_truncated,omitempty" bson:"stderr_truncated,omitempty"`
+	OutputFile      string `json:"output_file,omitempty" bson:"output_file,omitempty"`
+	OutputSize      int64  `json:"output_size" bson:"output_size"` // size of the output file when the tool exited
+}
+
+// ToolRunInput represents an input file passed to a tool
+type ToolRunInput struct {
+	Path   string `json:"path" bson:"path"`
+	SHA256 string `json:"sha256" bson:"sha256"`
+	Size   int64  `json:"size" bson:"size"`
+}
+
+// TaskEvent represents a discovery event on a task timeline
+// High-volume result types are sampled: one event stands for Count results
+type TaskEvent struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id,omitempty" bson:"workspace_id,omitempty"`
+	Timestamp   time.Time          `json:"timestamp" bson:"timestamp"`
+	ResultType  ResultType         `json:"result_type" bson:"result_type"`
+	Key         string             `json:"key" bson:"key"` // subdomain, host:port, url or vuln name of the (last) result
+	Source      string             `json:"source,omitempty" bson:"source,omitempty"`
+	Count       int                `json:"count" bson:"count"`
+}
+
+// TaskExecutionEvent represents a structured event emitted while a task runs:
+// module start/complete, skipped modules, per-target errors and cancellation
+type TaskExecutionEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaskID    primitive.ObjectID `json:"task_id" bson:"task_id"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+	Module    string             `json:"module" bson:"module"`
+	Level     string             `json:"level" bson:"level"` // info, warn, error
+	Type      string             `json:"type" bson:"type"`   // module_start, module_complete, tool_unavailable, target_error, cancelled ...
+	Message   string             `json:"message" bson:"message"`
+	Data      bson.M             `json:"data,omitempty" bson:"data,omitempty"`
+}
+
+// TaskCheckpoint 任务的模块级断点，记录各模块已完成的目标
+type TaskCheckpoint struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TaskID    primitive.ObjectID  `json:"task_id" bson:"task_id"`
+	Completed map[string][]string `json:"completed" bson:"completed"` // 模块 -> 已完成的根域名或主机
+	Progress  int                 `json:"progress" bson:"progress"`   // 最近一次记录时的总体进度
+	UpdatedAt time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// TaskControl 任务运行中对单个模块的控制指令（跳过剩余输入、停止、调整并发），由运行该任务的执行器轮询执行
+type TaskControl struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	Module      string             `json:"module" bson:"module"`                               // 模块名称，如 Crawler
+	Action      string             `json:"action" bson:"action"`                               // skip, stop, concurrency
+	Concurrency int                `json:"concurrency,omitempty" bson:"concurrency,omitempty"` // action 为 concurrency 时的并发数
+	Status      string             `json:"status" bson:"status"`                               // pending, applied, failed
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"`             // 执行失败的原因
+	NodeID      string             `json:"node_id,omitempty" bson:"node_id,omitempty"`         // 执行指令的执行器
+	CreatedBy   string             `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	AppliedAt   time.Time          `json:"applied_at,omitempty" bson:"applied_at,omitempty"`
+}
+
+// Task control statuses
+const (
+	TaskControlPending = "pending"
+	TaskControlApplied = "applied"
+	TaskControlFailed  = "failed"
+)
+
 // Collection names for tasks
 const (
-	CollectionTasks         = "tasks"
-	CollectionTaskTemplates = "task_templates"
-	CollectionTaskLogs      = "task_logs"
+	CollectionTasks              = "tasks"
+	CollectionTaskTemplates      = "task_templates"
+	CollectionTaskLogs           = "task_logs"
+	CollectionToolRuns           = "tool_runs"
+	CollectionNotifyDeliveries   = "notify_deliveries"
+	CollectionNotifyChannels     = "notify_channels"
+	CollectionTaskEvents         = "task_events"
+	CollectionSuppressionSamples = "suppression_samples"
+	CollectionTaskCheckpoints    = "task_checkpoints"
+	CollectionTaskControls       = "task_controls"
+	CollectionTaskExecEvents     = "task_execution_events"
+	CollectionFindingRules       = "finding_notify_rules"
+	CollectionScanNetworks       = "workspace_scan_networks"
+	CollectionScanScopes         = "workspace_scan_scopes"
+	CollectionAPIKeys            = "workspace_api_keys"
+	CollectionRetentionPolicies  = "workspace_retention_policies"
 )
@@ -68,11 +68,59 @@ type Workspace struct {
 	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
 }
 
+// WorkspaceNetwork 工作空间的扫描出站网络设置，任务未设置代理或 DNS 时使用
+type WorkspaceNetwork struct {
+	WorkspaceID string    `json:"workspace_id" bson:"_id"`
+	Proxy       string    `json:"proxy" bson:"proxy"`         // 代理地址（http、https、socks5）
+	Resolvers   []string  `json:"resolvers" bson:"resolvers"` // DNS 服务器 IP[:端口]，DoH 时为 https 地址
+	DoH         bool      `json:"doh" bson:"doh"`             // 使用 DNS over HTTPS 解析
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkspaceScope 工作空间的扫描范围：包含规则在任务未设置时使用，排除规则与任务的排除规则合并
+type WorkspaceScope struct {
+	WorkspaceID string    `json:"workspace_id" bson:"_id"`
+	Include     []string  `json:"include" bson:"include"` // 根域名 example.com（含子域名）、IP 或网段
+	Exclude     []string  `json:"exclude" bson:"exclude"` // 通配符、regex: 前缀正则、IP 或网段
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkspaceRetention 工作空间扫描结果的保留策略，0 表示不按该条件清理
+// 只清理 scan_results 中的任务结果，漏洞（findings、vulnerabilities）和工作空间资产不受影响
+type WorkspaceRetention struct {
+	WorkspaceID        string    `json:"workspace_id" bson:"_id"`
+	KeepDays           int       `json:"keep_days" bson:"keep_days"`                       // 保留今天及之前 N 个自然日的结果
+	KeepRuns           int       `json:"keep_runs" bson:"keep_runs"`                       // 每个巡航只保留最近 K 次执行的结果
+	IncludeVulnResults bool      `json:"include_vuln_results" bson:"include_vuln_results"` // 漏洞类型的扫描结果也按策略清理，默认保留
+	UpdatedAt          time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkspaceRole 工作空间成员角色，与用户的全局角色（admin、user）无关
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleOwner  WorkspaceRole = "owner"  // 管理成员，读写任务和结果
+	WorkspaceRoleEditor WorkspaceRole = "editor" // 创建、修改、删除任务和结果
+	WorkspaceRoleViewer WorkspaceRole = "viewer" // 只读
+)
+
+// WorkspaceMember 工作空间成员，同一工作空间内每个用户一条
+type WorkspaceMember struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role        WorkspaceRole      `json:"role" bson:"role"`
+	InvitedBy   primitive.ObjectID `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
 // Collection names
 const (
-	CollectionUsers        = "users"
-	CollectionRoles        = "roles"
-	CollectionPermissions  = "permissions"
-	CollectionOperationLog = "operation_logs"
-	CollectionWorkspaces   = "workspaces"
+	CollectionUsers            = "users"
+	CollectionRoles            = "roles"
+	CollectionPermissions      = "permissions"
+	CollectionOperationLog     = "operation_logs"
+	CollectionWorkspaces       = "workspaces"
+	CollectionWorkspaceMembers = "workspace_members"
 )
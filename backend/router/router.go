@@ -8,6 +8,7 @@ import (
 	"moongazing/api"
 	"moongazing/config"
 	"moongazing/middleware"
+	"moongazing/models"
 	"moongazing/service/queue"
 
 	"github.com/gin-gonic/gin"
@@ -62,6 +63,10 @@ func SetupRouter() *gin.Engine {
 			// Task routes
 			taskHandler := api.NewTaskHandler()
 			resultHandler := api.NewResultHandler()
+			assetHandler := api.NewAssetHandler()
+			// 任务所在工作空间的成员权限：查看需要 viewer，修改需要 editor
+			viewTask := middleware.TaskAccessMiddleware(models.WorkspaceRoleViewer)
+			editTask := middleware.TaskAccessMiddleware(models.WorkspaceRoleEditor)
 			taskGroup := protected.Group("/tasks")
 			{
 				taskGroup.GET("", taskHandler.ListTasks)
@@ -69,25 +74,91 @@ func SetupRouter() *gin.Engine {
 				taskGroup.GET("/templates", taskHandler.ListTaskTemplates)
 				taskGroup.GET("/templates/:id", taskHandler.GetTaskTemplate)
 				taskGroup.POST("/templates", taskHandler.CreateTaskTemplate)
+				taskGroup.PUT("/templates/:id", taskHandler.UpdateTaskTemplate)
 				taskGroup.DELETE("/templates/:id", taskHandler.DeleteTaskTemplate)
 				taskGroup.POST("/from-template", taskHandler.CreateTaskFromTemplate)
-				taskGroup.GET("/:id", taskHandler.GetTask)
+				taskGroup.POST("/exclusion-preview", taskHandler.PreviewExclusions)
+				taskGroup.POST("/validate", taskHandler.ValidateTask)
+				taskGroup.GET("/:id", viewTask, taskHandler.GetTask)
 				taskGroup.POST("", taskHandler.CreateTask)
-				taskGroup.PUT("/:id", taskHandler.UpdateTask)
-				taskGroup.DELETE("/:id", taskHandler.DeleteTask)
-				taskGroup.POST("/:id/start", taskHandler.StartTask)
-				taskGroup.POST("/:id/pause", taskHandler.PauseTask)
-				taskGroup.POST("/:id/resume", taskHandler.ResumeTask)
-				taskGroup.POST("/:id/cancel", taskHandler.CancelTask)
-				taskGroup.POST("/:id/retry", taskHandler.RetryTask)
-				taskGroup.POST("/:id/rescan", taskHandler.RescanTask)
-				taskGroup.GET("/:id/logs", taskHandler.GetTaskLogs)
+				taskGroup.PUT("/:id", editTask, taskHandler.UpdateTask)
+				taskGroup.DELETE("/:id", editTask, taskHandler.DeleteTask)
+				taskGroup.POST("/:id/start", editTask, taskHandler.StartTask)
+				taskGroup.POST("/:id/pause", editTask, taskHandler.PauseTask)
+				taskGroup.POST("/:id/resume", editTask, taskHandler.ResumeTask)
+				taskGroup.POST("/:id/cancel", editTask, taskHandler.CancelTask)
+				taskGroup.PUT("/:id/priority", editTask, taskHandler.SetTaskPriority)
+				taskGroup.POST("/:id/controls", editTask, taskHandler.ControlTaskModule)
+				taskGroup.GET("/:id/controls", viewTask, taskHandler.ListTaskControls)
+				taskGroup.POST("/:id/retry", editTask, taskHandler.RetryTask)
+				taskGroup.POST("/:id/rescan", editTask, taskHandler.RescanTask)
+				taskGroup.GET("/:id/logs", viewTask, taskHandler.GetTaskLogs)
+				taskGroup.GET("/:id/events", viewTask, taskHandler.GetTaskEvents)
+				taskGroup.GET("/:id/tool-runs", viewTask, taskHandler.GetToolRuns)
+				taskGroup.GET("/:id/timeline", viewTask, taskHandler.GetTaskTimeline)
+				taskGroup.GET("/:id/timeline/stream", viewTask, taskHandler.StreamTaskTimeline)
+				taskGroup.GET("/:id/suppression", viewTask, taskHandler.GetTaskSuppressionStats)
+				taskGroup.GET("/:id/report", viewTask, taskHandler.GetTaskReport)
 				// Task Results routes
-				taskGroup.GET("/:id/results", resultHandler.GetTaskResults)
-				taskGroup.GET("/:id/results/stats", resultHandler.GetTaskResultStats)
-				taskGroup.GET("/:id/results/subdomains", resultHandler.GetSubdomainResults)
-				taskGroup.GET("/:id/results/ports", resultHandler.GetPortResults)
-				taskGroup.GET("/:id/results/export", resultHandler.ExportResults)
+				taskGroup.GET("/:id/results", viewTask, resultHandler.GetTaskResults)
+				taskGroup.GET("/:id/results/stats", viewTask, resultHandler.GetTaskResultStats)
+				taskGroup.GET("/:id/diff", viewTask, resultHandler.DiffTaskResults)
+				taskGroup.GET("/:id/results/subdomains", viewTask, resultHandler.GetSubdomainResults)
+				taskGroup.GET("/:id/results/ports", viewTask, resultHandler.GetPortResults)
+				taskGroup.GET("/:id/results/export", viewTask, resultHandler.ExportResults)
+				taskGroup.GET("/:id/results/:result_id/screenshot", viewTask, resultHandler.GetResultScreenshot)
+				taskGroup.GET("/:id/assets/new", viewTask, assetHandler.ListNewTaskAssets)
+			}
+			
+			// 工作空间的扫描代理和 DNS 设置
+			scanNetworkHandler := api.NewScanNetworkHandler()
+			scanNetworkGroup := protected.Group("/scan-network")
+			{
+				scanNetworkGroup.GET("", scanNetworkHandler.GetScanNetwork)
+				scanNetworkGroup.PUT("", scanNetworkHandler.UpdateScanNetwork)
+			}
+			
+			// 工作空间的第三方数据源密钥
+			apiKeyHandler := api.NewAPIKeyHandler()
+			apiKeyGroup := protected.Group("/api-keys")
+			{
+				apiKeyGroup.GET("", apiKeyHandler.ListAPIKeys)
+				apiKeyGroup.PUT("/:provider", apiKeyHandler.SaveAPIKey)
+				apiKeyGroup.DELETE("/:provider", apiKeyHandler.DeleteAPIKey)
+				apiKeyGroup.POST("/:provider/validate", apiKeyHandler.ValidateAPIKey)
+			}
+			
+			// 工作空间的扫描范围（包含和排除规则）
+			scanScopeHandler := api.NewScanScopeHandler()
+			scanScopeGroup := protected.Group("/scan-scope")
+			{
+				scanScopeGroup.GET("", scanScopeHandler.GetScanScope)
+				scanScopeGroup.PUT("", scanScopeHandler.UpdateScanScope)
+			}
+			
+			// 工作空间的结果保留策略和手动清理
+			retentionHandler := api.NewRetentionHandler()
+			retentionGroup := protected.Group("/retention")
+			{
+				retentionGroup.GET("", retentionHandler.GetRetention)
+				retentionGroup.PUT("", retentionHandler.UpdateRetention)
+				retentionGroup.POST("/run", middleware.AdminMiddleware(), retentionHandler.RunRetention)
+			}
+			
+			// Workspace asset routes
+			assetGroup := protected.Group("/assets")
+			{
+				assetGroup.GET("", assetHandler.ListAssets)
+				assetGroup.GET("/stale", assetHandler.ListStaleAssets)
+			}
+			
+			// Workspace vulnerability finding routes
+			findingHandler := api.NewFindingHandler()
+			findingGroup := protected.Group("/findings")
+			{
+				findingGroup.GET("", findingHandler.ListFindings)
+				findingGroup.GET("/:id", findingHandler.GetFinding)
+				findingGroup.PUT("/:id/status", findingHandler.UpdateFindingStatus)
 			}
 			
 			// Results routes (for tag management and batch operations)
@@ -97,6 +168,44 @@ func SetupRouter() *gin.Engine {
 				resultGroup.POST("/:id/tags", resultHandler.AddResultTag)
 				resultGroup.DELETE("/:id/tags", resultHandler.RemoveResultTag)
 				resultGroup.POST("/batch-delete", resultHandler.BatchDeleteResults)
+				resultGroup.POST("/batch-tag", resultHandler.BulkAddTag)
+				resultGroup.POST("/batch-untag", resultHandler.BulkRemoveTag)
+				resultGroup.POST("/query", resultHandler.QueryResults)
+				resultGroup.GET("/export", resultHandler.ExportWorkspaceResults)
+			}
+			
+			// Workspace member routes
+			workspaceHandler := api.NewWorkspaceHandler()
+			workspaceGroup := protected.Group("/workspaces")
+			{
+				workspaceGroup.GET("/:id/members", workspaceHandler.ListMembers)
+				workspaceGroup.POST("/:id/members", workspaceHandler.AddMember)
+				workspaceGroup.PUT("/:id/members/:user_id", workspaceHandler.UpdateMemberRole)
+				workspaceGroup.DELETE("/:id/members/:user_id", workspaceHandler.RemoveMember)
+			}
+			
+			// Saved search routes
+			searchHandler := api.NewSearchHandler()
+			searchGroup := protected.Group("/searches")
+			{
+				searchGroup.GET("", searchHandler.ListSavedSearches)
+				searchGroup.GET("/fields", searchHandler.GetSearchFields)
+				searchGroup.POST("", searchHandler.CreateSavedSearch)
+				searchGroup.GET("/:id", searchHandler.GetSavedSearch)
+				searchGroup.PUT("/:id", searchHandler.UpdateSavedSearch)
+				searchGroup.DELETE("/:id", searchHandler.DeleteSavedSearch)
+				searchGroup.GET("/:id/results", searchHandler.ExecuteSavedSearch)
+			}
+			
+			// Redaction policy routes
+			redactionHandler := api.NewRedactionHandler()
+			redactionGroup := protected.Group("/redaction-policies")
+			{
+				redactionGroup.GET("", redactionHandler.ListRedactionPolicies)
+				redactionGroup.POST("", redactionHandler.CreateRedactionPolicy)
+				redactionGroup.GET("/:id", redactionHandler.GetRedactionPolicy)
+				redactionGroup.PUT("/:id", redactionHandler.UpdateRedactionPolicy)
+				redactionGroup.DELETE("/:id", redactionHandler.DeleteRedactionPolicy)
 			}
 			
 			// Vulnerability routes
@@ -176,6 +285,14 @@ func SetupRouter() *gin.Engine {
 				fingerprintGroup.GET("", pluginHandler.ListFingerprintRules)
 				fingerprintGroup.POST("", pluginHandler.CreateFingerprintRule)
 				fingerprintGroup.DELETE("/:id", pluginHandler.DeleteFingerprintRule)
+				fingerprintGroup.GET("/rules/status", pluginHandler.GetFingerprintRulesStatus)
+				fingerprintGroup.POST("/rules/reload", middleware.AdminMiddleware(), pluginHandler.ReloadFingerprintRules)
+				fingerprintGroup.GET("/rules", pluginHandler.ListDSLRules)
+				fingerprintGroup.GET("/rules/:name", pluginHandler.GetDSLRule)
+				fingerprintGroup.POST("/rules/validate", pluginHandler.ValidateDSLRule)
+				fingerprintGroup.POST("/rules/test", pluginHandler.TestDSLRule)
+				fingerprintGroup.POST("/rules/custom", middleware.AdminMiddleware(), pluginHandler.SaveCustomDSLRule)
+				fingerprintGroup.DELETE("/rules/custom/:name", middleware.AdminMiddleware(), pluginHandler.DeleteCustomDSLRule)
 			}
 			
 			// Dictionary routes
@@ -192,6 +309,10 @@ func SetupRouter() *gin.Engine {
 			{
 				dashboardGroup.GET("/stats", dashboardHandler.GetDashboardStats)
 				dashboardGroup.GET("/trends", dashboardHandler.GetTrends)
+				dashboardGroup.GET("/overview", dashboardHandler.GetWorkspaceOverview)
+				dashboardGroup.GET("/severity", dashboardHandler.GetSeverityBreakdown)
+				dashboardGroup.GET("/technologies", dashboardHandler.GetTopTechnologies)
+				dashboardGroup.GET("/task-trend", dashboardHandler.GetDailyTaskCounts)
 				dashboardGroup.GET("/activities", dashboardHandler.GetRecentActivities)
 				dashboardGroup.GET("/recent-tasks", dashboardHandler.GetRecentTasks)
 				dashboardGroup.GET("/recent-vulns", dashboardHandler.GetRecentVulnerabilities)
@@ -259,6 +380,7 @@ func SetupRouter() *gin.Engine {
 				thirdPartyGroup.GET("/config", thirdPartyHandler.GetConfig)
 				thirdPartyGroup.PUT("/config", thirdPartyHandler.UpdateConfig)
 				thirdPartyGroup.GET("/sources", thirdPartyHandler.GetConfiguredSources)
+				thirdPartyGroup.GET("/quota", thirdPartyHandler.GetQuotaStatus)
 
 				// 统一查询接口
 				thirdPartyGroup.POST("/subdomains", thirdPartyHandler.CollectSubdomains)
@@ -302,12 +424,24 @@ func SetupRouter() *gin.Engine {
 				notifyGroup.DELETE("/configs", notifyHandler.DeleteConfig)
 				notifyGroup.POST("/configs/enable", notifyHandler.EnableConfig)
 
+				// 工作空间渠道（加密保存在数据库中）
+				notifyGroup.GET("/channels", notifyHandler.ListChannels)
+				notifyGroup.POST("/channels", notifyHandler.CreateChannel)
+				notifyGroup.PUT("/channels/:id", notifyHandler.UpdateChannel)
+				notifyGroup.DELETE("/channels/:id", notifyHandler.DeleteChannel)
+				notifyGroup.POST("/channels/:id/test", notifyHandler.TestChannel)
+
 				// 测试和发送
 				notifyGroup.POST("/test", notifyHandler.TestConfig)
 				notifyGroup.POST("/send", notifyHandler.SendNotification)
 
 				// 历史记录
 				notifyGroup.GET("/history", notifyHandler.GetHistory)
+				notifyGroup.GET("/deliveries", notifyHandler.GetDeliveries)
+
+				// 漏洞即时通知规则
+				notifyGroup.GET("/finding-rule", notifyHandler.GetFindingRule)
+				notifyGroup.PUT("/finding-rule", notifyHandler.UpdateFindingRule)
 			}
 
 			// Nuclei POC 扫描
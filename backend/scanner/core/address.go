@@ -0,0 +1,94 @@
+package core
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IPv6 地址处理
+// 拼接地址时 IPv6 需要加方括号（[2001:db8::1]:8080），URL 中同理；
+// 双栈主机按任务设置优先或跳过 IPv6 地址，只有 AAAA 记录的主机直接扫描 IPv6 地址
+
+// 地址族
+const (
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// IPv6 目标的处理方式
+const (
+	IPv6ModeDefault = ""       // 双栈主机使用 IPv4，只有 IPv6 地址的目标照常扫描
+	IPv6ModePrefer  = "prefer" // 双栈主机优先使用 IPv6
+	IPv6ModeSkip    = "skip"   // 不扫描 IPv6 地址，只有 IPv6 地址的目标跳过
+)
+
+// ValidIPv6Mode 是否为支持的 IPv6 处理方式
+func ValidIPv6Mode(mode string) bool {
+	switch mode {
+	case IPv6ModeDefault, IPv6ModePrefer, IPv6ModeSkip:
+		return true
+	}
+	return false
+}
+
+// AddressFamily IP 的地址族，不是 IP 时返回空字符串
+func AddressFamily(ip string) string {
+	addr := net.ParseIP(strings.Trim(ip, "[]"))
+	switch {
+	case addr == nil:
+		return ""
+	case addr.To4() != nil:
+		return AddressFamilyIPv4
+	default:
+		return AddressFamilyIPv6
+	}
+}
+
+// IsIPv6 是否为 IPv6 地址（可带方括号），IPv4 映射地址视为 IPv4
+func IsIPv6(host string) bool {
+	return AddressFamily(host) == AddressFamilyIPv6
+}
+
+// HostPort 拼接主机和端口，IPv6 地址加方括号
+func HostPort(host string, port int) string {
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+}
+
+// URLHost URL 中的主机部分，IPv6 地址加方括号
+func URLHost(host string) string {
+	if IsIPv6(host) {
+		return "[" + strings.Trim(host, "[]") + "]"
+	}
+	return host
+}
+
+// BuildURL 构建 scheme://host:port 形式的 URL，port <= 0 时不带端口
+func BuildURL(scheme, host string, port int) string {
+	if port <= 0 {
+		return scheme + "://" + URLHost(host)
+	}
+	return scheme + "://" + HostPort(host, port)
+}
+
+// SelectIPs 按 IPv6 处理方式整理主机的 IP：默认 IPv4 在前，prefer 时 IPv6 在前，skip 时去掉 IPv6
+// 同一地址族内保持原顺序
+func SelectIPs(ips []string, mode string) []string {
+	var v4, v6 []string
+	for _, ip := range ips {
+		switch AddressFamily(ip) {
+		case AddressFamilyIPv4:
+			v4 = append(v4, ip)
+		case AddressFamilyIPv6:
+			v6 = append(v6, ip)
+		}
+	}
+	switch mode {
+	case IPv6ModeSkip:
+		return v4
+	case IPv6ModePrefer:
+		return append(v6, v4...)
+	default:
+		return append(v4, v6...)
+	}
+}
@@ -20,6 +20,23 @@ const (
 	VulnScanHTTPTimeout     = 30 * time.Second  // 漏洞扫描 HTTP 超时
 	ContentScanHTTPTimeout  = 20 * time.Second  // 内容扫描 HTTP 超时
 
+	// 指纹识别分阶段读取超时，防止目标逐字节返回长时间占用工作协程
+	FingerprintFirstByteTimeout = 8 * time.Second  // 指纹识别等待响应头的最长时间
+	FingerprintBodyReadTimeout  = 5 * time.Second  // 指纹识别读取响应体的最长时间
+	FingerprintSlowHostTTL      = 30 * time.Minute // 响应过慢的主机被排除探测的时长
+	FingerprintPerTargetTimeout = 30 * time.Second // 批量指纹识别中单个目标的最长时间
+
+	// 指纹识别遇到超时、连接被拒绝或重置等临时网络错误时的重试
+	FingerprintRetryAttempts   = 3                      // 每个 URL 的最多请求次数（含第一次）
+	FingerprintRetryBackoff    = 200 * time.Millisecond // 第一次重试前的等待时间，之后每次翻倍
+	FingerprintRetryMaxBackoff = 2 * time.Second        // 重试等待时间上限
+	FingerprintMaxRedirects    = 3                      // 指纹识别每次请求最多跟随的跳转次数
+	FingerprintMaxFaviconSize  = 512 * 1024             // 图标响应超过该大小（字节）时不计算哈希
+
+	// 同一源站（解析到的 IP，未解析时为主机名）的并发限制和自适应退避
+	DefaultOriginConcurrency      = 5 // 每个源站同时进行的请求数
+	DefaultOriginBackoffThreshold = 5 // 源站返回 429 或重置连接的次数达到该值时并发减半
+
 	// 扫描任务超时配置
 	QuickScanTimeout     = 60 * time.Second   // 快速扫描超时
 	DefaultScanTimeout   = 5 * time.Minute    // 默认扫描超时
@@ -49,3 +66,8 @@ const (
 	MaxIdleConnsPerHost = 10               // 每个主机最大空闲连接数
 	IdleConnTimeout     = 90 * time.Second // 空闲连接超时
 )
+
+// DefaultTLSPorts 端口指纹识别时直接尝试 TLS 握手的端口
+var DefaultTLSPorts = []int{
+	443, 465, 636, 853, 990, 992, 993, 994, 995, 2376, 2484, 3269, 5061, 5986, 6443, 6697, 8443, 8883, 9443,
+}
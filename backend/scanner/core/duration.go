@@ -0,0 +1,28 @@
+package core
+
+import "time"
+
+// 耗时字段统一以毫秒整数保存：字段名以 Ms 结尾，JSON/BSON 键以 _ms 结尾。
+// 可序列化的结果结构中不直接使用 time.Duration（读取方按纳秒还是毫秒解释取决于调用方）
+// 或 Duration.String()（无法排序和汇总），统一通过以下函数换算。
+// 旧数据中的耗时字段由模型上的只读字段兼容（如 models.CruiseLog.ElapsedMs）
+
+// Millis 耗时转换为毫秒
+func Millis(d time.Duration) int64 {
+	return d.Milliseconds()
+}
+
+// MillisSince 从 start 到现在的毫秒数
+func MillisSince(start time.Time) int64 {
+	return time.Since(start).Milliseconds()
+}
+
+// MillisBetween 两个时间之间的毫秒数
+func MillisBetween(start, end time.Time) int64 {
+	return end.Sub(start).Milliseconds()
+}
+
+// MillisDuration 毫秒转换为 time.Duration
+func MillisDuration(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// 国际化域名（IDN）
+// 目标中的 münchen.example、中文域名等在进入流水线时转换为 punycode（xn--mnchen-3ya.example），
+// 解析、爆破和去重都使用 ASCII 形式，展示时再转换回 Unicode
+
+// idnDots 全角句号等 IDNA 视为标签分隔符的字符
+var idnDots = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCIIDomain 将域名转换为小写 punycode 形式
+// 只转换含非 ASCII 字符的标签，通配符等无法转换的标签保持原样
+func ToASCIIDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if isASCII(domain) {
+		return domain
+	}
+
+	labels := strings.Split(idnDots.Replace(domain), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		if ascii, err := idna.Lookup.ToASCII(label); err == nil {
+			labels[i] = ascii
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// ToUnicodeDomain 将 punycode 域名转换为 Unicode 形式，用于展示；无法转换时返回小写原值
+func ToUnicodeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if !strings.Contains(domain, "xn--") {
+		return domain
+	}
+	unicode, err := idna.ToUnicode(domain)
+	if err != nil {
+		return domain
+	}
+	return unicode
+}
+
+// NormalizeTargetIDN 将目标（域名、host:port 或 URL）中的国际化域名转换为 punycode
+// 不含 IDN 的目标原样返回，URL 的路径和参数不做改动
+func NormalizeTargetIDN(target string) string {
+	if !isIDNHost(target) {
+		return target
+	}
+
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			return target
+		}
+		host := ToASCIIDomain(u.Hostname())
+		if port := u.Port(); port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		u.Host = host
+		return u.String()
+	}
+
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		return net.JoinHostPort(ToASCIIDomain(host), port)
+	}
+	return ToASCIIDomain(target)
+}
+
+// isIDNHost 目标是否包含非 ASCII 字符或 punycode 标签
+func isIDNHost(target string) bool {
+	return !isASCII(target) || strings.Contains(strings.ToLower(target), "xn--")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
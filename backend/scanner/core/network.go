@@ -0,0 +1,273 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 扫描出站网络设置
+// 工作空间设置默认值，任务可覆盖：HTTP 请求经代理发出，域名解析使用指定的 DNS 服务器（可选 DoH）。
+// 进程内的扫描器（指纹识别、HTTP 探测、子域名解析）直接使用；外部工具通过 -proxy、-resolvers 等参数传入，
+// 工具不支持的参数不传，由流水线记录警告事件
+
+// DefaultDoHServers DoH 开启但未指定服务器时使用
+var DefaultDoHServers = []string{
+	"https://1.1.1.1/dns-query",
+	"https://8.8.8.8/dns-query",
+}
+
+// 代理支持的协议
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+const (
+	defaultDNSPort    = "53"
+	dohContentType    = "application/dns-message"
+	dohMaxMessageSize = 65535
+)
+
+// ScanNetworkConfig 扫描出站网络设置，nil 或空值使用系统网络和 DNS
+type ScanNetworkConfig struct {
+	Proxy     string   `json:"proxy,omitempty" bson:"proxy,omitempty"`         // 代理地址，支持 http、https、socks5，可带用户名密码
+	Resolvers []string `json:"resolvers,omitempty" bson:"resolvers,omitempty"` // DNS 服务器（IP[:端口]），DoH 时为 https 地址或 IP
+	DoH       bool     `json:"doh,omitempty" bson:"doh,omitempty"`             // 使用 DNS over HTTPS 解析
+}
+
+// Validate 校验代理地址和 DNS 服务器
+func (c *ScanNetworkConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("代理地址无效: %s", c.Proxy)
+		}
+		if !proxySchemes[strings.ToLower(u.Scheme)] {
+			return fmt.Errorf("不支持的代理协议: %s（支持 http、https、socks5）", u.Scheme)
+		}
+	}
+	for _, server := range c.Resolvers {
+		if _, err := normalizeResolver(server, c.DoH); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasProxy 是否配置了代理
+func (c *ScanNetworkConfig) HasProxy() bool {
+	return c.ProxyURL() != nil
+}
+
+// HasResolvers 是否使用自定义 DNS（指定了服务器或开启 DoH）
+func (c *ScanNetworkConfig) HasResolvers() bool {
+	return c != nil && (len(c.Resolvers) > 0 || c.DoH)
+}
+
+// ProxyURL 代理地址，未配置或无效时返回 nil
+func (c *ScanNetworkConfig) ProxyURL() *url.URL {
+	if c == nil || c.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Proxy)
+	if err != nil || u.Host == "" || !proxySchemes[strings.ToLower(u.Scheme)] {
+		return nil
+	}
+	return u
+}
+
+// IsSOCKSProxy 代理是否为 socks5 协议（部分工具只支持 HTTP 代理）
+func (c *ScanNetworkConfig) IsSOCKSProxy() bool {
+	u := c.ProxyURL()
+	return u != nil && strings.HasPrefix(strings.ToLower(u.Scheme), "socks5")
+}
+
+// ResolverServers 规范化后的 DNS 服务器：host:port，DoH 时为 https 地址；DoH 未指定服务器时使用默认服务器
+func (c *ScanNetworkConfig) ResolverServers() []string {
+	if c == nil {
+		return nil
+	}
+	var servers []string
+	for _, server := range c.Resolvers {
+		if s, err := normalizeResolver(server, c.DoH); err == nil {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) == 0 && c.DoH {
+		servers = append(servers, DefaultDoHServers...)
+	}
+	return servers
+}
+
+// normalizeResolver 规范化单个 DNS 服务器：补全默认端口；DoH 时 IP 或域名补全为 https://host/dns-query
+func normalizeResolver(server string, doh bool) (string, error) {
+	server = strings.TrimSpace(server)
+	if doh {
+		if !strings.Contains(server, "://") {
+			server = "https://" + server + "/dns-query"
+		}
+		u, err := url.Parse(server)
+		if err != nil || u.Host == "" || u.Scheme != "https" {
+			return "", fmt.Errorf("DoH 服务器地址无效: %s（需要 https 地址）", server)
+		}
+		return server, nil
+	}
+
+	host, port := server, defaultDNSPort
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+	host = strings.Trim(host, "[]")
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return "", fmt.Errorf("DNS 服务器地址无效: %s", server)
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("DNS 服务器地址无效: %s（需要 IP 地址）", server)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Resolver 使用自定义 DNS 服务器的解析器，未配置时返回 nil（使用系统解析）
+// 多个服务器轮流使用；DoH 时把 Go 解析器发出的 DNS 报文转成 HTTPS 请求
+func (c *ScanNetworkConfig) Resolver(timeout time.Duration) *net.Resolver {
+	servers := c.ResolverServers()
+	if len(servers) == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+
+	var next uint32
+	doh := c.DoH
+	var client *http.Client
+	if doh {
+		client = c.DoHClient(timeout)
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			server := servers[int(atomic.AddUint32(&next, 1)-1)%len(servers)]
+			if doh {
+				return &dohConn{ctx: ctx, client: client, endpoint: server}, nil
+			}
+			d := net.Dialer{Timeout: timeout}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// DoHClient DoH 查询使用的 HTTP 客户端，配置了代理时同样经代理发出
+func (c *ScanNetworkConfig) DoHClient(timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: timeout}).DialContext,
+		MaxIdleConnsPerHost: MaxIdleConnsPerHost,
+		IdleConnTimeout:     IdleConnTimeout,
+		ForceAttemptHTTP2:   true,
+	}
+	if u := c.ProxyURL(); u != nil {
+		transport.Proxy = http.ProxyURL(u)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// ApplyTransport 把代理和自定义 DNS 应用到 HTTP 传输层，dialer 为扫描器原有的拨号设置
+func (c *ScanNetworkConfig) ApplyTransport(transport *http.Transport, dialer net.Dialer) {
+	transport.Proxy = nil
+	if u := c.ProxyURL(); u != nil {
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if r := c.Resolver(dialer.Timeout); r != nil {
+		dialer.Resolver = r
+	}
+	transport.DialContext = dialer.DialContext
+}
+
+// WriteResolversFile 把 DNS 服务器写入临时文件（每行一个），供外部工具的 -resolvers 参数使用
+func (c *ScanNetworkConfig) WriteResolversFile(dir string) (*InputFile, error) {
+	file, err := CreateInputFile(dir, "resolvers_*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range c.ResolverServers() {
+		file.WriteString(server + "\n")
+	}
+	return file, file.Close()
+}
+
+// DoHExchange 发送一条 DNS over HTTPS 查询（RFC 8484，POST application/dns-message），返回应答报文
+func DoHExchange(ctx context.Context, client *http.Client, endpoint string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh server %s returned status %d", endpoint, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, dohMaxMessageSize))
+}
+
+// dohConn Go 解析器的 DNS 连接：按 TCP 格式（2 字节长度前缀）写入的查询转成 DoH 请求，应答同样加长度前缀读出
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	request  bytes.Buffer
+	response bytes.Reader
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.request.Write(b)
+	for c.request.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.request.Bytes()[:2]))
+		if c.request.Len() < 2+size {
+			break
+		}
+		query := make([]byte, size)
+		c.request.Next(2)
+		c.request.Read(query)
+
+		answer, err := DoHExchange(c.ctx, c.client, c.endpoint, query)
+		if err != nil {
+			return 0, err
+		}
+		framed := make([]byte, 2+len(answer))
+		binary.BigEndian.PutUint16(framed, uint16(len(answer)))
+		copy(framed[2:], answer)
+		c.response.Reset(framed)
+	}
+	return len(b), nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	return c.response.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.endpoint) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.endpoint) }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "doh" }
+func (a dohAddr) String() string  { return string(a) }
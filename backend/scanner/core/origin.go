@@ -0,0 +1,315 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 源站并发限制
+// 子域名扫描得到的大量主机往往解析到同一台源站，按目标并发时同一源站会同时收到成百上千个请求。
+// 按源站（解析到的 IP，未能解析时为主机名）限制同时进行的请求数；
+// 源站开始返回 429 或重置连接，且次数达到阈值时，该源站的并发减半，在本次任务剩余时间内保持
+
+// originResolveTimeout 解析目标源站 IP 的超时时间
+const originResolveTimeout = 3 * time.Second
+
+// OriginLimiter 源站并发限制器
+type OriginLimiter struct {
+	limit     int
+	threshold int
+	onBackoff func(origin string, from, to int) // 并发减半时回调
+
+	// Resolve 解析主机的 IP，为 nil 时使用系统解析
+	Resolve func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	origins map[string]*originSlot
+	hosts   map[string]string // 主机 -> 源站
+}
+
+// originSlot 单个源站的并发状态
+type originSlot struct {
+	limit     int
+	inFlight  int
+	peak      int
+	throttled int           // 上次减半后累计的限速次数
+	wake      chan struct{} // 名额释放或上限变化时关闭，唤醒等待者
+}
+
+// OriginStats 源站并发统计
+type OriginStats struct {
+	Origin    string `json:"origin"`
+	Limit     int    `json:"limit"`
+	InFlight  int    `json:"in_flight"`
+	Peak      int    `json:"peak"`
+	Throttled int    `json:"throttled"`
+}
+
+// NewOriginLimiter 创建源站并发限制器，limit <= 0 时使用 DefaultOriginConcurrency
+func NewOriginLimiter(limit int) *OriginLimiter {
+	if limit <= 0 {
+		limit = DefaultOriginConcurrency
+	}
+	return &OriginLimiter{
+		limit:     limit,
+		threshold: DefaultOriginBackoffThreshold,
+		origins:   make(map[string]*originSlot),
+		hosts:     make(map[string]string),
+	}
+}
+
+// SetBackoff 设置触发并发减半的限速次数（<= 0 保持默认值）和减半时的回调
+func (l *OriginLimiter) SetBackoff(threshold int, fn func(origin string, from, to int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if threshold > 0 {
+		l.threshold = threshold
+	}
+	l.onBackoff = fn
+}
+
+// MaxInFlight 每个源站的初始并发上限
+func (l *OriginLimiter) MaxInFlight() int {
+	return l.limit
+}
+
+// Origin 目标所在的源站：主机解析到的第一个 IP，目标本身是 IP 或解析失败时为主机名
+// 同一主机只解析一次
+func (l *OriginLimiter) Origin(ctx context.Context, target string) string {
+	host := targetHost(target)
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+
+	l.mu.Lock()
+	origin, ok := l.hosts[host]
+	l.mu.Unlock()
+	if ok {
+		return origin
+	}
+
+	resolve := l.Resolve
+	if resolve == nil {
+		resolve = net.DefaultResolver.LookupHost
+	}
+	resolveCtx, cancel := context.WithTimeout(ctx, originResolveTimeout)
+	defer cancel()
+	origin = host
+	if ips, err := resolve(resolveCtx, host); err == nil && len(ips) > 0 {
+		origin = ips[0]
+	} else if ctx.Err() != nil {
+		// 任务取消导致的解析失败不缓存
+		return host
+	}
+
+	l.mu.Lock()
+	l.hosts[host] = origin
+	l.mu.Unlock()
+	return origin
+}
+
+// targetHost 目标的主机名，目标可以是 URL、host:port 或主机名
+func targetHost(target string) string {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil {
+			return strings.ToLower(u.Hostname())
+		}
+	}
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return strings.ToLower(host)
+	}
+	if i := strings.IndexAny(target, "/?#"); i >= 0 {
+		target = target[:i]
+	}
+	return strings.ToLower(strings.Trim(target, "[]"))
+}
+
+// Acquire 占用源站的一个并发名额，名额用完时等待；限制器为 nil 时不做限制，上下文取消时返回 false
+func (l *OriginLimiter) Acquire(ctx context.Context, origin string) (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return func() {}, false
+		}
+		l.mu.Lock()
+		slot := l.slotLocked(origin)
+		if slot.inFlight < slot.limit {
+			slot.inFlight++
+			if slot.inFlight > slot.peak {
+				slot.peak = slot.inFlight
+			}
+			l.mu.Unlock()
+			break
+		}
+		wake := slot.wake
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return func() {}, false
+		case <-wake:
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			slot := l.origins[origin]
+			slot.inFlight--
+			slot.wakeLocked()
+			l.mu.Unlock()
+		})
+	}, true
+}
+
+// AcquireMany 一次占用多个源站的名额，counts 为各源站需要的名额数，超过源站当前上限时按上限占用
+// 全部源站都有足够名额时才同时占用，等待期间不持有任何名额，避免多个批量调用各占一部分后互相等待
+func (l *OriginLimiter) AcquireMany(ctx context.Context, counts map[string]int) (func(), bool) {
+	if l == nil || len(counts) == 0 {
+		return func() {}, true
+	}
+
+	taken := make(map[string]int, len(counts))
+	for {
+		if ctx.Err() != nil {
+			return func() {}, false
+		}
+		l.mu.Lock()
+		var wake chan struct{}
+		for origin, n := range counts {
+			slot := l.slotLocked(origin)
+			if n > slot.limit {
+				n = slot.limit
+			}
+			if slot.inFlight+n > slot.limit {
+				wake = slot.wake
+				break
+			}
+			taken[origin] = n
+		}
+		if wake == nil {
+			for origin, n := range taken {
+				slot := l.origins[origin]
+				slot.inFlight += n
+				if slot.inFlight > slot.peak {
+					slot.peak = slot.inFlight
+				}
+			}
+			l.mu.Unlock()
+			break
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return func() {}, false
+		case <-wake:
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			for origin, n := range taken {
+				slot := l.origins[origin]
+				slot.inFlight -= n
+				slot.wakeLocked()
+			}
+			l.mu.Unlock()
+		})
+	}, true
+}
+
+// Observe 记录源站的一次响应，返回是否因此将并发减半
+// 限速次数达到阈值时并发减半（最低为 1）并重新计数
+func (l *OriginLimiter) Observe(origin string, statusCode int, errText string) bool {
+	if l == nil || !IsThrottled(statusCode, errText) {
+		return false
+	}
+
+	l.mu.Lock()
+	slot := l.slotLocked(origin)
+	slot.throttled++
+	if slot.throttled < l.threshold || slot.limit <= 1 {
+		l.mu.Unlock()
+		return false
+	}
+	from := slot.limit
+	slot.limit /= 2
+	slot.throttled = 0
+	to := slot.limit
+	onBackoff := l.onBackoff
+	l.mu.Unlock()
+
+	if onBackoff != nil {
+		onBackoff(origin, from, to)
+	}
+	return true
+}
+
+// Limit 源站当前的并发上限
+func (l *OriginLimiter) Limit(origin string) int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if slot, ok := l.origins[origin]; ok {
+		return slot.limit
+	}
+	return l.limit
+}
+
+// Stats 各源站的并发统计
+func (l *OriginLimiter) Stats() []OriginStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make([]OriginStats, 0, len(l.origins))
+	for origin, slot := range l.origins {
+		stats = append(stats, OriginStats{
+			Origin:    origin,
+			Limit:     slot.limit,
+			InFlight:  slot.inFlight,
+			Peak:      slot.peak,
+			Throttled: slot.throttled,
+		})
+	}
+	return stats
+}
+
+// slotLocked 获取或创建源站状态（需要持有锁）
+func (l *OriginLimiter) slotLocked(origin string) *originSlot {
+	slot, ok := l.origins[origin]
+	if !ok {
+		slot = &originSlot{limit: l.limit, wake: make(chan struct{})}
+		l.origins[origin] = slot
+	}
+	return slot
+}
+
+// wakeLocked 唤醒等待名额的请求（需要持有锁）
+func (s *originSlot) wakeLocked() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// IsThrottled 响应是否表示源站在限速：429，或连接被重置
+func IsThrottled(statusCode int, errText string) bool {
+	if statusCode == 429 {
+		return true
+	}
+	errText = strings.ToLower(errText)
+	return strings.Contains(errText, "connection reset") ||
+		strings.Contains(errText, "forcibly closed") ||
+		strings.Contains(errText, "econnreset")
+}
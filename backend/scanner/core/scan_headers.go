@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 认证扫描的自定义请求头
+// 任务可设置请求头（如 Authorization）和 Cookie，用于扫描需要登录的应用：
+// 进程内的扫描器（指纹识别、HTTP 探测）直接设置到请求上，katana、spray 通过 -H 参数传入，
+// 工具（或当前版本）不支持的不传参数，由流水线记录警告事件
+
+// ScanHeaders 任务自定义请求头，nil 表示不设置
+type ScanHeaders struct {
+	Headers map[string]string
+	Cookie  string // 原样作为 Cookie 请求头发送，如 "session=abc; csrf=123"
+}
+
+// NewScanHeaders 创建自定义请求头，都为空时返回 nil
+func NewScanHeaders(headers map[string]string, cookie string) *ScanHeaders {
+	cookie = strings.TrimSpace(cookie)
+	if len(headers) == 0 && cookie == "" {
+		return nil
+	}
+	return &ScanHeaders{Headers: headers, Cookie: cookie}
+}
+
+// ValidateScanHeaders 校验请求头名称和值，值中不能包含换行
+func ValidateScanHeaders(headers map[string]string, cookie string) error {
+	for name, value := range headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("请求头名称无效: %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("请求头 %s 的值不能包含换行", name)
+		}
+	}
+	if strings.ContainsAny(cookie, "\r\n") {
+		return fmt.Errorf("Cookie 不能包含换行")
+	}
+	return nil
+}
+
+// validHeaderName 请求头名称只能由 RFC 7230 的 token 字符组成
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty 是否没有设置请求头
+func (h *ScanHeaders) IsEmpty() bool {
+	return h == nil || (len(h.Headers) == 0 && h.Cookie == "")
+}
+
+// Apply 设置到请求上，覆盖扫描器的默认请求头
+func (h *ScanHeaders) Apply(req *http.Request) {
+	if h.IsEmpty() {
+		return
+	}
+	for name, value := range h.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if h.Cookie != "" {
+		req.Header.Set("Cookie", h.Cookie)
+	}
+}
+
+// Lines 按名称排序的 "Name: value" 列表，用于外部工具的 -H 参数
+func (h *ScanHeaders) Lines() []string {
+	if h.IsEmpty() {
+		return nil
+	}
+	names := make([]string, 0, len(h.Headers))
+	for name := range h.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		lines = append(lines, textproto.CanonicalMIMEHeaderKey(name)+": "+h.Headers[name])
+	}
+	if h.Cookie != "" {
+		lines = append(lines, "Cookie: "+h.Cookie)
+	}
+	return lines
+}
+
+// Args 外部工具的请求头参数，每个请求头一个 flag
+func (h *ScanHeaders) Args(flag string) []string {
+	var args []string
+	for _, line := range h.Lines() {
+		args = append(args, flag, line)
+	}
+	return args
+}
+
+// Redacted 脱敏后的请求头列表，用于日志
+func (h *ScanHeaders) Redacted() []string {
+	lines := h.Lines()
+	for i, line := range lines {
+		lines[i] = redactHeader(line)
+	}
+	return lines
+}
+
+// AuthPreflight 认证预检结果
+type AuthPreflight struct {
+	URL           string `json:"url"`
+	AuthStatus    int    `json:"auth_status"`
+	AuthLength    int    `json:"auth_length"`
+	AnonStatus    int    `json:"anon_status"`
+	AnonLength    int    `json:"anon_length"`
+	Differs       bool   `json:"differs"`        // 带请求头和不带请求头的响应状态码或长度不同
+	SessionFailed bool   `json:"session_failed"` // 会话可能已失效：响应没有差别或带请求头仍返回 401/403
+}
+
+// preflightBodyLimit 预检读取的响应体上限
+const preflightBodyLimit = 2 << 20
+
+// RunAuthPreflight 分别带和不带自定义请求头请求目标，比较响应状态码和长度
+func RunAuthPreflight(ctx context.Context, client *http.Client, target string, headers *ScanHeaders) (*AuthPreflight, error) {
+	preflight := &AuthPreflight{URL: target}
+	var err error
+	if preflight.AuthStatus, preflight.AuthLength, err = preflightFetch(ctx, client, target, headers); err != nil {
+		return nil, err
+	}
+	if preflight.AnonStatus, preflight.AnonLength, err = preflightFetch(ctx, client, target, nil); err != nil {
+		return nil, err
+	}
+	preflight.Differs = preflight.AuthStatus != preflight.AnonStatus || preflight.AuthLength != preflight.AnonLength
+	preflight.SessionFailed = !preflight.Differs ||
+		preflight.AuthStatus == http.StatusUnauthorized || preflight.AuthStatus == http.StatusForbidden
+	return preflight, nil
+}
+
+// preflightFetch 请求一次目标，不跟随跳转（登录失效时通常跳转到登录页）
+func preflightFetch(ctx context.Context, client *http.Client, target string, headers *ScanHeaders) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultHTTPTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	headers.Apply(req)
+
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	if noRedirect.Timeout == 0 {
+		noRedirect.Timeout = DefaultHTTPTimeout + time.Second
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, preflightBodyLimit))
+	return resp.StatusCode, int(n), nil
+}
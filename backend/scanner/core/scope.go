@@ -0,0 +1,371 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// 目标排除规则
+// 支持三种写法（均不区分大小写）：
+//   - 通配符: *.example.com、*-dr.example.com、prod-payments.example.com
+//   - 正则:   regex:^db[0-9]+\.example\.com$
+//   - IP/网段: 10.0.0.5、10.0.0.0/24（仅匹配 IP 形式的目标）
+//
+// 扫描范围（ScopeFilter）在排除规则之外增加包含规则：根域名（example.com，包含其所有子域名）、IP 或网段。
+// 配置了包含规则时，不在任何包含规则内的主机超出范围；同时命中包含和排除规则时排除优先
+
+// RegexPatternPrefix 正则排除规则前缀
+const RegexPatternPrefix = "regex:"
+
+// exclusionRule 单条排除规则
+type exclusionRule struct {
+	raw      string
+	re       *regexp.Regexp
+	ipNet    *net.IPNet
+	hostExpr string // 匹配完整主机名的正则片段（不含锚点），用于生成 URL 排除正则
+}
+
+// ExclusionMatcher 目标排除匹配器
+// nil 匹配器不排除任何目标
+type ExclusionMatcher struct {
+	rules []exclusionRule
+}
+
+// NewExclusionMatcher 创建排除匹配器，规则非法时返回错误
+func NewExclusionMatcher(patterns []string) (*ExclusionMatcher, error) {
+	m := &ExclusionMatcher{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		rule, err := compileExclusionRule(p)
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+// ValidateExcludePatterns 校验排除规则
+func ValidateExcludePatterns(patterns []string) error {
+	_, err := NewExclusionMatcher(patterns)
+	return err
+}
+
+// compileExclusionRule 编译单条规则
+func compileExclusionRule(p string) (exclusionRule, error) {
+	rule := exclusionRule{raw: p}
+
+	if strings.HasPrefix(strings.ToLower(p), RegexPatternPrefix) {
+		expr := strings.TrimSpace(p[len(RegexPatternPrefix):])
+		if expr == "" {
+			return rule, fmt.Errorf("排除规则 %q 的正则表达式为空", p)
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return rule, fmt.Errorf("排除规则 %q 不是合法的正则表达式: %v", p, err)
+		}
+		rule.re = re
+		// 未锚定的正则按"包含"语义匹配主机名
+		hostExpr := expr
+		if strings.HasPrefix(hostExpr, "^") {
+			hostExpr = hostExpr[1:]
+		} else {
+			hostExpr = "[^/?#]*" + hostExpr
+		}
+		if strings.HasSuffix(hostExpr, "$") {
+			hostExpr = hostExpr[:len(hostExpr)-1]
+		} else {
+			hostExpr += "[^/?#:]*"
+		}
+		rule.hostExpr = hostExpr
+		return rule, nil
+	}
+
+	if strings.Contains(p, "/") {
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return rule, fmt.Errorf("排除规则 %q 不是合法的网段: %v", p, err)
+		}
+		rule.ipNet = ipNet
+		return rule, nil
+	}
+
+	if ip := net.ParseIP(p); ip != nil {
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		rule.ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		if bits == 32 {
+			rule.hostExpr = regexp.QuoteMeta(ip.String())
+		}
+		return rule, nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(p), ".")
+	if strings.ContainsAny(host, " :") {
+		return rule, fmt.Errorf("排除规则 %q 不是合法的域名通配符", p)
+	}
+
+	// 通配符转换为正则：* 匹配任意字符（含多级子域名），? 匹配单个字符
+	var sb strings.Builder
+	for _, c := range host {
+		switch c {
+		case '*':
+			sb.WriteString("[^/?#:]*")
+		case '?':
+			sb.WriteString("[^/?#:]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re, err := regexp.Compile("^" + sb.String() + "$")
+	if err != nil {
+		return rule, fmt.Errorf("排除规则 %q 无法解析: %v", p, err)
+	}
+	rule.re = re
+	rule.hostExpr = sb.String()
+	return rule, nil
+}
+
+// NormalizeHost 从 URL、host:port 等形式中提取小写主机名
+func NormalizeHost(target string) string {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return ""
+	}
+
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil && u.Host != "" {
+			target = u.Host
+		}
+	} else if idx := strings.IndexAny(target, "/?#"); idx >= 0 {
+		target = target[:idx]
+	}
+
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		target = host
+	}
+	target = strings.TrimPrefix(target, "[")
+	target = strings.TrimSuffix(target, "]")
+
+	return strings.TrimSuffix(strings.ToLower(target), ".")
+}
+
+// Match 检查目标是否被排除，返回命中的规则
+func (m *ExclusionMatcher) Match(target string) (string, bool) {
+	if m == nil || len(m.rules) == 0 {
+		return "", false
+	}
+
+	host := NormalizeHost(target)
+	if host == "" {
+		return "", false
+	}
+	ip := net.ParseIP(host)
+
+	for _, rule := range m.rules {
+		if rule.ipNet != nil {
+			if ip != nil && rule.ipNet.Contains(ip) {
+				return rule.raw, true
+			}
+			continue
+		}
+		if rule.re != nil && rule.re.MatchString(host) {
+			return rule.raw, true
+		}
+	}
+	return "", false
+}
+
+// IsExcluded 检查目标是否被排除
+func (m *ExclusionMatcher) IsExcluded(target string) bool {
+	_, excluded := m.Match(target)
+	return excluded
+}
+
+// URLRegexps 生成匹配被排除主机 URL 的正则（供爬虫的排除范围参数使用）
+// IPv6 和网段规则无法用正则表达，由调用方对结果再次过滤
+func (m *ExclusionMatcher) URLRegexps() []string {
+	if m == nil {
+		return nil
+	}
+	var exprs []string
+	for _, rule := range m.rules {
+		if rule.hostExpr == "" {
+			continue
+		}
+		exprs = append(exprs, "(?i)^[a-z][a-z0-9+.-]*://(?:"+rule.hostExpr+")(?::[0-9]+)?(?:[/?#]|$)")
+	}
+	return exprs
+}
+
+// Empty 是否没有任何排除规则
+func (m *ExclusionMatcher) Empty() bool {
+	return m == nil || len(m.rules) == 0
+}
+
+// ScopeNotIncluded 配置了包含规则但目标不在其中时 ScopeFilter.Check 返回的原因
+const ScopeNotIncluded = "not_included"
+
+// scopeInclude 单条包含规则
+type scopeInclude struct {
+	raw    string
+	domain string // 根域名，匹配自身和所有子域名
+	ipNet  *net.IPNet
+}
+
+// ScopeFilter 扫描范围过滤器：包含规则 + 排除规则
+// nil 过滤器不限制任何目标
+type ScopeFilter struct {
+	includes  []scopeInclude
+	exclusion *ExclusionMatcher
+}
+
+// NewScopeFilter 创建扫描范围过滤器，规则非法时返回错误
+func NewScopeFilter(includes, excludes []string) (*ScopeFilter, error) {
+	exclusion, err := NewExclusionMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+	f := &ScopeFilter{exclusion: exclusion}
+	for _, p := range includes {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		rule, err := compileScopeInclude(p)
+		if err != nil {
+			return nil, err
+		}
+		f.includes = append(f.includes, rule)
+	}
+	return f, nil
+}
+
+// ValidateScopeIncludes 校验包含规则
+func ValidateScopeIncludes(patterns []string) error {
+	_, err := NewScopeFilter(patterns, nil)
+	return err
+}
+
+// compileScopeInclude 编译单条包含规则：网段、IP 或根域名（可写作 *.example.com）
+func compileScopeInclude(p string) (scopeInclude, error) {
+	rule := scopeInclude{raw: p}
+	if strings.Contains(p, "/") {
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return rule, fmt.Errorf("包含规则 %q 不是合法的网段: %v", p, err)
+		}
+		rule.ipNet = ipNet
+		return rule, nil
+	}
+	if ip := net.ParseIP(p); ip != nil {
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		rule.ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return rule, nil
+	}
+
+	domain := strings.TrimSuffix(strings.ToLower(p), ".")
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+	if domain == "" || strings.ContainsAny(domain, " :*?") || !strings.Contains(domain, ".") {
+		return rule, fmt.Errorf("包含规则 %q 不是合法的根域名、IP 或网段", p)
+	}
+	rule.domain = domain
+	return rule, nil
+}
+
+// match 检查规范化后的主机是否在包含规则内
+func (r scopeInclude) match(host string, ip net.IP) bool {
+	if r.ipNet != nil {
+		return ip != nil && r.ipNet.Contains(ip)
+	}
+	return ip == nil && (host == r.domain || strings.HasSuffix(host, "."+r.domain))
+}
+
+// Check 检查目标是否在扫描范围内，超出范围时返回命中的排除规则或 ScopeNotIncluded
+func (f *ScopeFilter) Check(target string) (string, bool) {
+	if f == nil {
+		return "", true
+	}
+	if rule, excluded := f.exclusion.Match(target); excluded {
+		return rule, false
+	}
+	if !f.Included(target) {
+		return ScopeNotIncluded, false
+	}
+	return "", true
+}
+
+// InScope 目标是否在扫描范围内
+func (f *ScopeFilter) InScope(target string) bool {
+	_, ok := f.Check(target)
+	return ok
+}
+
+// Included 目标是否在包含规则内（不检查排除规则），没有包含规则时总是返回 true
+func (f *ScopeFilter) Included(target string) bool {
+	if !f.HasIncludes() {
+		return true
+	}
+	host := NormalizeHost(target)
+	if host == "" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, rule := range f.includes {
+		if rule.match(host, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIncludes 是否配置了包含规则
+func (f *ScopeFilter) HasIncludes() bool {
+	return f != nil && len(f.includes) > 0
+}
+
+// Exclusion 排除规则匹配器
+func (f *ScopeFilter) Exclusion() *ExclusionMatcher {
+	if f == nil {
+		return nil
+	}
+	return f.exclusion
+}
+
+// Empty 是否没有任何包含和排除规则
+func (f *ScopeFilter) Empty() bool {
+	return !f.HasIncludes() && f.Exclusion().Empty()
+}
+
+// DefaultToTargets 没有包含规则时以任务目标作为包含规则（域名目标包含其子域名），排除规则不变
+// 用于判断爬虫发现的跨站 URL：未显式配置范围时只跟随任务目标下的主机
+func (f *ScopeFilter) DefaultToTargets(targets []string) *ScopeFilter {
+	if f.HasIncludes() {
+		return f
+	}
+	scoped := &ScopeFilter{exclusion: f.Exclusion()}
+	for _, target := range targets {
+		for _, t := range strings.Split(target, ",") {
+			t = strings.TrimSpace(t)
+			host := NormalizeHost(t)
+			if _, _, err := net.ParseCIDR(t); err == nil {
+				host = t // 网段目标
+			}
+			if rule, err := compileScopeInclude(host); err == nil {
+				scoped.includes = append(scoped.includes, rule)
+			}
+		}
+	}
+	return scoped
+}
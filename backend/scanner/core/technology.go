@@ -0,0 +1,243 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"moongazing/config"
+)
+
+// 技术名称规范化
+// 同一技术在不同来源中的名称不同（gogo "nginx"、DSL 规则 "Nginx"、httpx "Nginx:1.18"、jslib "jquery"），
+// 合并到结果前按 aliases.yaml 映射为规范名称并拆分版本号，未收录的名称统一转为小写，
+// 并记录下来用于补充别名文件
+
+// Technology 规范化后的技术
+type Technology struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// UnmappedTechnology 别名文件中未收录的技术名称
+type UnmappedTechnology struct {
+	Name  string `json:"name" bson:"name"`   // 小写后的名称
+	Raw   string `json:"raw" bson:"raw"`     // 第一次出现时的原始名称
+	Count int    `json:"count" bson:"count"` // 出现次数
+}
+
+// MaxUnmappedTechnologies 每个规范化器最多记录的未收录名称数，达到上限后只累计已记录名称的次数，
+// 避免长期运行的全局规范化器随扫描到的名称无限增长
+const MaxUnmappedTechnologies = 1000
+
+// versionSuffixPattern 名称末尾的版本号: "Nginx:1.18" "nginx/1.18.0" "PHP 7.4.3" "jQuery v3.5.1"
+var versionSuffixPattern = regexp.MustCompile(`^(.+?)\s*[:/ ]\s*[vV]?(\d+(?:\.[0-9A-Za-z-]+)*)$`)
+
+// TechNormalizer 技术名称规范化器，同时统计未收录的名称
+type TechNormalizer struct {
+	canonical map[string]string // 小写别名 -> 规范名称
+
+	mu       sync.Mutex
+	unmapped map[string]*UnmappedTechnology
+}
+
+// NewTechNormalizer 根据别名表创建规范化器（规范名称 -> 别名列表）
+func NewTechNormalizer(aliases map[string][]string) *TechNormalizer {
+	canonical := make(map[string]string)
+	for name, variants := range aliases {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		canonical[strings.ToLower(name)] = name
+		for _, v := range variants {
+			if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+				canonical[v] = name
+			}
+		}
+	}
+	return &TechNormalizer{canonical: canonical, unmapped: make(map[string]*UnmappedTechnology)}
+}
+
+var (
+	defaultTechNormalizer     *TechNormalizer
+	defaultTechNormalizerOnce sync.Once
+)
+
+// DefaultTechNormalizer 使用 aliases.yaml 的全局规范化器
+func DefaultTechNormalizer() *TechNormalizer {
+	defaultTechNormalizerOnce.Do(func() {
+		defaultTechNormalizer = NewTechNormalizer(config.GetTechAliases())
+	})
+	return defaultTechNormalizer
+}
+
+// NewTaskTechNormalizer 创建任务级规范化器：共享全局别名表，单独统计任务中出现的未收录名称
+func NewTaskTechNormalizer() *TechNormalizer {
+	return DefaultTechNormalizer().Fork()
+}
+
+// Fork 复制别名表，未收录名称的统计从零开始
+func (n *TechNormalizer) Fork() *TechNormalizer {
+	return &TechNormalizer{canonical: n.canonical, unmapped: make(map[string]*UnmappedTechnology)}
+}
+
+// NormalizeTechnology 使用全局规范化器规范化技术名称
+func NormalizeTechnology(raw string) Technology {
+	return DefaultTechNormalizer().Normalize(raw)
+}
+
+// NormalizeTechnologies 使用全局规范化器规范化并去重，返回规范名称列表
+func NormalizeTechnologies(raws []string) []string {
+	return DefaultTechNormalizer().NewSet(raws...).Names()
+}
+
+// Normalize 规范化技术名称：先整体匹配别名，再拆分末尾的版本号匹配
+func (n *TechNormalizer) Normalize(raw string) Technology {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Technology{}
+	}
+	if name, ok := n.canonical[strings.ToLower(raw)]; ok {
+		return Technology{Name: name}
+	}
+
+	name, version := raw, ""
+	if m := versionSuffixPattern.FindStringSubmatch(raw); m != nil {
+		name, version = strings.TrimSpace(m[1]), m[2]
+		if canonical, ok := n.canonical[strings.ToLower(name)]; ok {
+			return Technology{Name: canonical, Version: version}
+		}
+	}
+
+	n.recordUnmapped(name)
+	return Technology{Name: strings.ToLower(name), Version: version}
+}
+
+// recordUnmapped 记录未收录的名称，已记录 MaxUnmappedTechnologies 个名称后不再记录新名称
+func (n *TechNormalizer) recordUnmapped(raw string) {
+	key := strings.ToLower(raw)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if u, ok := n.unmapped[key]; ok {
+		u.Count++
+		return
+	}
+	if len(n.unmapped) >= MaxUnmappedTechnologies {
+		return
+	}
+	n.unmapped[key] = &UnmappedTechnology{Name: key, Raw: raw, Count: 1}
+}
+
+// Unmapped 未收录名称报告，按出现次数降序
+func (n *TechNormalizer) Unmapped() []UnmappedTechnology {
+	n.mu.Lock()
+	report := make([]UnmappedTechnology, 0, len(n.unmapped))
+	for _, u := range n.unmapped {
+		report = append(report, *u)
+	}
+	n.mu.Unlock()
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Count != report[j].Count {
+			return report[i].Count > report[j].Count
+		}
+		return report[i].Name < report[j].Name
+	})
+	return report
+}
+
+// ServerProduct 取 Server 头中的第一个产品，"Apache/2.4.41 (Ubuntu) OpenSSL/1.1.1" -> "Apache/2.4.41"
+func ServerProduct(server string) string {
+	fields := strings.Fields(server)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// TechSet 合并多个来源的技术，按规范名称去重并保留版本号
+type TechSet struct {
+	normalizer *TechNormalizer
+	order      []string
+	versions   map[string]string
+}
+
+// NewSet 创建技术集合，raws 为已有的技术名称
+func (n *TechNormalizer) NewSet(raws ...string) *TechSet {
+	s := &TechSet{normalizer: n, versions: make(map[string]string)}
+	s.Add(raws...)
+	return s
+}
+
+// Add 添加技术名称
+func (s *TechSet) Add(raws ...string) {
+	for _, raw := range raws {
+		s.AddVersion(raw, "")
+	}
+}
+
+// AddVersion 添加技术名称和单独提供的版本号（名称中带版本时以名称中的为准）
+func (s *TechSet) AddVersion(raw, version string) {
+	tech := s.normalizer.Normalize(raw)
+	if tech.Name == "" {
+		return
+	}
+	if tech.Version == "" {
+		tech.Version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	}
+	if _, ok := s.versions[tech.Name]; !ok {
+		s.order = append(s.order, tech.Name)
+		s.versions[tech.Name] = ""
+	}
+	if tech.Version != "" && s.versions[tech.Name] == "" {
+		s.versions[tech.Name] = tech.Version
+	}
+}
+
+// Names 规范名称列表（按首次出现的顺序）
+func (s *TechSet) Names() []string {
+	return append([]string{}, s.order...)
+}
+
+// Versions 规范名称 -> 版本号，只包含已知版本的技术
+func (s *TechSet) Versions() map[string]string {
+	versions := make(map[string]string)
+	for name, version := range s.versions {
+		if version != "" {
+			versions[name] = version
+		}
+	}
+	return versions
+}
+
+// Technologies 技术列表（含版本号）
+func (s *TechSet) Technologies() []Technology {
+	techs := make([]Technology, 0, len(s.order))
+	for _, name := range s.order {
+		techs = append(techs, Technology{Name: name, Version: s.versions[name]})
+	}
+	return techs
+}
+
+// FrameworkTechnologies 将 gogo / spray 输出的 frameworks 映射规范化为技术集合
+// 值为对象时读取其中的 version 字段
+func FrameworkTechnologies(normalizer *TechNormalizer, frameworks map[string]interface{}) *TechSet {
+	names := make([]string, 0, len(frameworks))
+	for name := range frameworks {
+		names = append(names, name)
+	}
+	// map 遍历顺序不固定，排序保证输出稳定
+	sort.Strings(names)
+
+	set := normalizer.NewSet()
+	for _, name := range names {
+		var version string
+		if attrs, ok := frameworks[name].(map[string]interface{}); ok {
+			version, _ = attrs["version"].(string)
+		}
+		set.AddVersion(name, version)
+	}
+	return set
+}
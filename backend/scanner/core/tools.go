@@ -54,6 +54,15 @@ func NewToolsManager() *ToolsManager {
 
 // GetToolPath 获取工具路径
 func (t *ToolsManager) GetToolPath(toolName string) string {
+	toolPath := t.ExpectedToolPath(toolName)
+	if toolPath != "" && FileExists(toolPath) {
+		return toolPath
+	}
+	return ""
+}
+
+// ExpectedToolPath 工具应在的路径（不检查是否存在），不支持的系统返回空字符串
+func (t *ToolsManager) ExpectedToolPath(toolName string) string {
 	var osDir string
 	switch runtime.GOOS {
 	case "darwin":
@@ -69,11 +78,7 @@ func (t *ToolsManager) GetToolPath(toolName string) string {
 		return ""
 	}
 
-	toolPath := filepath.Join(t.ToolsDir, osDir, toolName)
-	if FileExists(toolPath) {
-		return toolPath
-	}
-	return ""
+	return filepath.Join(t.ToolsDir, osDir, toolName)
 }
 
 // IsToolAvailable 检查工具是否可用
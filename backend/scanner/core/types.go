@@ -13,6 +13,8 @@ type PortResult struct {
 	Version     string   `json:"version,omitempty"`
 	Banner      string   `json:"banner,omitempty"`
 	Fingerprint []string `json:"fingerprint,omitempty"`
+	Protocol    string   `json:"protocol,omitempty"` // transport: tcp, udp
+	TLS         bool     `json:"tls,omitempty"`      // service is wrapped in TLS (https, imaps, ...)
 }
 
 // ScanResult represents the complete scan result for a target
@@ -42,11 +44,13 @@ func GetPortServiceMap() map[int]string {
 
 // GetServiceName returns the service name for a port
 func GetServiceName(port int) string {
-	serviceMap := GetPortServiceMap()
-	if name, ok := serviceMap[port]; ok {
-		return name
-	}
-	return "unknown"
+	return config.ResolvePortService(port, "", "")
+}
+
+// ResolveServiceName returns the service label for an open port
+// Precedence: banner-derived service > scanner-reported protocol > unified port map > "unknown"
+func ResolveServiceName(port int, bannerService, protocol string) string {
+	return config.ResolvePortService(port, bannerService, protocol)
 }
 
 // IsHTTPPort checks if a port is likely to run HTTP service
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 扫描请求的 User-Agent 策略
+// 指纹识别（页面、https 重试和 favicon 请求）、HTTP 探测按策略为每个请求选择 User-Agent，
+// katana、spray 每次运行选择一个，通过 -H/--header 传入。任务的自定义请求头中设置了 User-Agent 时以自定义请求头为准
+
+// User-Agent 策略
+const (
+	UAStrategyFixed  = "fixed"  // 固定使用列表中的第一个
+	UAStrategyRotate = "rotate" // 按列表顺序轮换
+	UAStrategyRandom = "random" // 每个请求随机选择
+)
+
+// DefaultUserAgent 未设置策略时使用的 User-Agent
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// DefaultUserAgents 轮换和随机策略未设置列表时使用的常见浏览器 User-Agent
+var DefaultUserAgents = []string{
+	DefaultUserAgent,
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+}
+
+// UserAgentPicker 按策略选择 User-Agent，可并发使用；nil 始终返回 DefaultUserAgent
+type UserAgentPicker struct {
+	strategy string
+	agents   []string
+	next     uint64 // 轮换策略的下一个位置
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// ValidateUserAgents 校验 User-Agent 策略和列表，列表中不能有空值和换行
+func ValidateUserAgents(strategy string, agents []string) error {
+	switch strategy {
+	case "", UAStrategyFixed, UAStrategyRotate, UAStrategyRandom:
+	default:
+		return fmt.Errorf("User-Agent 策略无效: %q，可选 fixed、rotate、random", strategy)
+	}
+	for _, agent := range agents {
+		if strings.TrimSpace(agent) == "" {
+			return fmt.Errorf("User-Agent 不能为空")
+		}
+		if strings.ContainsAny(agent, "\r\n") {
+			return fmt.Errorf("User-Agent 不能包含换行")
+		}
+	}
+	if strategy == "" && len(agents) > 0 {
+		return fmt.Errorf("设置 User-Agent 列表时需要指定策略")
+	}
+	return nil
+}
+
+// NewUserAgentPicker 创建 User-Agent 选择器，策略为空时返回 nil（使用 DefaultUserAgent）。
+// 固定策略未设置列表时使用 DefaultUserAgent，轮换和随机策略未设置列表时使用 DefaultUserAgents
+func NewUserAgentPicker(strategy string, agents []string) (*UserAgentPicker, error) {
+	if err := ValidateUserAgents(strategy, agents); err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		return nil, nil
+	}
+
+	list := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		list = append(list, strings.TrimSpace(agent))
+	}
+	if len(list) == 0 {
+		if strategy == UAStrategyFixed {
+			list = []string{DefaultUserAgent}
+		} else {
+			list = append(list, DefaultUserAgents...)
+		}
+	}
+	return &UserAgentPicker{
+		strategy: strategy,
+		agents:   list,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Strategy 选择策略
+func (p *UserAgentPicker) Strategy() string {
+	if p == nil {
+		return ""
+	}
+	return p.strategy
+}
+
+// Agents 候选的 User-Agent 列表
+func (p *UserAgentPicker) Agents() []string {
+	if p == nil {
+		return []string{DefaultUserAgent}
+	}
+	return append([]string(nil), p.agents...)
+}
+
+// Next 选择下一个请求使用的 User-Agent
+func (p *UserAgentPicker) Next() string {
+	if p == nil {
+		return DefaultUserAgent
+	}
+	switch p.strategy {
+	case UAStrategyRotate:
+		n := atomic.AddUint64(&p.next, 1) - 1
+		return p.agents[n%uint64(len(p.agents))]
+	case UAStrategyRandom:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.agents[p.rng.Intn(len(p.agents))]
+	default:
+		return p.agents[0]
+	}
+}
+
+// UserAgentLine 外部工具请求头参数中的 User-Agent，自定义请求头已设置 User-Agent 时返回空
+func (p *UserAgentPicker) UserAgentLine(headers []string) string {
+	if p == nil {
+		return ""
+	}
+	for _, header := range headers {
+		if name, _, ok := strings.Cut(header, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "User-Agent") {
+			return ""
+		}
+	}
+	return "User-Agent: " + p.Next()
+}
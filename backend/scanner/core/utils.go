@@ -43,8 +43,10 @@ var secondLevelTLDs = map[string]bool{
 // 例如: www.example.com.cn -> example.com.cn
 //
 //	api.test.example.com -> example.com
+//
+// 国际化域名按 punycode 形式处理: www.münchen.de -> xn--mnchen-3ya.de
 func ExtractRootDomain(domain string) string {
-	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = ToASCIIDomain(domain)
 	domain = strings.TrimSuffix(domain, ".")
 
 	parts := strings.Split(domain, ".")
@@ -412,7 +412,9 @@ func (s *ENScanScanner) queryViaCLI(ctx context.Context, companyName string, opt
 	cmd := exec.CommandContext(ctx, s.execPath, args...)
 	cmd.Dir = filepath.Dir(s.execPath)
 
+	run := core.StartToolCommand(ctx, "enscan", cmd)
 	output, err := cmd.Output()
+	run.Finish(err)
 	if err != nil {
 		return nil, fmt.Errorf("enscan command failed: %w", err)
 	}
@@ -0,0 +1,68 @@
+package fingerprint
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// BodyPreviewLength is the number of visible-text characters kept in BodyPreview
+const BodyPreviewLength = 500
+
+var (
+	// Script, style and comment contents change with builds and carry inline nonces
+	scriptStylePattern = regexp.MustCompile(`(?is)<(script|style|noscript)\b[^>]*>.*?</(script|style|noscript)\s*>`)
+	commentPattern     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// Inputs and metas carrying per-request tokens (CSRF fields, csrf-token metas)
+	tokenTagPattern = regexp.MustCompile(`(?i)<(input|meta)\b[^>]*(csrf|xsrf|token|nonce|authenticity|__requestverification|__viewstate|__eventvalidation)[^>]*>`)
+	// Per-request attributes
+	nonceAttrPattern = regexp.MustCompile(`(?i)\s(nonce|integrity|data-csrf|data-token)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+	// Query strings of embedded URLs are often cache busters (?v=1712345678, ?_=…)
+	cacheBusterPattern = regexp.MustCompile(`(?i)(\s(?:src|href|action|data-src)\s*=\s*["']?[^"'\s>?#]*)\?[^"'\s>#]*`)
+	// Long opaque strings: session-bound tokens, hashes, base64 blobs
+	opaqueTokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_\-]{32,}={0,2}`)
+	// ISO timestamps and unix times in seconds or milliseconds
+	timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?|\b1\d{9}(?:\d{3})?\b`)
+	tagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacePattern     = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeBody strips the parts of a page that change between otherwise identical renders:
+// script/style contents, comments, CSRF inputs and metas, nonce attributes, cache-buster
+// query strings, long opaque tokens, timestamps and whitespace
+func NormalizeBody(body string) string {
+	body = scriptStylePattern.ReplaceAllString(body, "")
+	body = commentPattern.ReplaceAllString(body, "")
+	body = tokenTagPattern.ReplaceAllString(body, "<$1>")
+	body = nonceAttrPattern.ReplaceAllString(body, "")
+	body = cacheBusterPattern.ReplaceAllString(body, "$1")
+	body = opaqueTokenPattern.ReplaceAllString(body, "")
+	body = timestampPattern.ReplaceAllString(body, "")
+	body = spacePattern.ReplaceAllString(body, "")
+	return body
+}
+
+// NormalizedBodyHash returns the SHA1 of the normalized body, stable across renders of the same page
+func NormalizedBodyHash(body string) string {
+	sum := sha1.Sum([]byte(NormalizeBody(body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// VisibleTextPreview returns the first maxLen characters of the page's visible text
+func VisibleTextPreview(body string, maxLen int) string {
+	text := scriptStylePattern.ReplaceAllString(body, " ")
+	text = commentPattern.ReplaceAllString(text, " ")
+	text = tagPattern.ReplaceAllString(text, " ")
+	text = html.UnescapeString(text)
+	text = strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "")
+	}
+	if utf8.RuneCountInString(text) <= maxLen {
+		return text
+	}
+	return string([]rune(text)[:maxLen])
+}
@@ -0,0 +1,107 @@
+package fingerprint
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLength is how much of a body is read before deciding whether to read the rest of it
+const sniffLength = 512
+
+// bodyCheck decides from the response headers and the first sniffLength bytes of the body
+// whether the rest of the body is read; nil reads the whole body up to the limit
+type bodyCheck func(resp *http.Response, head []byte) bool
+
+// textMediaTypes are application/* types whose bodies are text
+var textMediaTypes = map[string]bool{
+	"application/json":         true,
+	"application/javascript":   true,
+	"application/ecmascript":   true,
+	"application/xml":          true,
+	"application/x-javascript": true,
+}
+
+// iconMediaTypes are non-image/* types servers use for .ico files
+var iconMediaTypes = map[string]bool{
+	"application/ico":   true,
+	"application/x-ico": true,
+}
+
+// mediaType returns the lower-case media type of a Content-Type value without parameters
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	if media, _, err := mime.ParseMediaType(contentType); err == nil {
+		return media
+	}
+	media, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(media))
+}
+
+// isTextMediaType reports whether a media type carries text (text/*, JSON, JavaScript, XML and their +json/+xml variants)
+func isTextMediaType(media string) bool {
+	return strings.HasPrefix(media, "text/") || textMediaTypes[media] ||
+		strings.HasSuffix(media, "+xml") || strings.HasSuffix(media, "+json")
+}
+
+// sniffMediaType returns the media type http.DetectContentType finds in the first sniffLength bytes
+func sniffMediaType(head []byte) string {
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	return mediaType(http.DetectContentType(head))
+}
+
+// isTextBody reports whether a response body is worth running body rules on.
+// A declared text type is trusted unless the first bytes carry a binary signature (PNG, ZIP, PDF, ...);
+// any other declared type, including application/octet-stream and a missing header, is text only when
+// the first bytes sniff as text. Only the first sniffLength bytes are looked at, so the
+// answer is the same for the sniffed prefix and the full body.
+func isTextBody(contentType string, head []byte) bool {
+	if len(head) == 0 {
+		return true
+	}
+	sniffed := sniffMediaType(head)
+	if isTextMediaType(mediaType(contentType)) {
+		return isTextMediaType(sniffed) || sniffed == "application/octet-stream"
+	}
+	return isTextMediaType(sniffed)
+}
+
+// IsTextBody reports whether a body is text, for other scanners that fetch bodies themselves; see isTextBody
+func IsTextBody(contentType string, head []byte) bool {
+	return isTextBody(contentType, head)
+}
+
+// isImageBody reports whether a favicon response carries an image: declared image/* or icon
+// types that do not sniff as an HTML page, or an undeclared/generic type that sniffs as an image
+func isImageBody(contentType string, head []byte) bool {
+	sniffed := sniffMediaType(head)
+	media := mediaType(contentType)
+	if strings.HasPrefix(media, "image/") || iconMediaTypes[media] {
+		return sniffed != "text/html"
+	}
+	switch media {
+	case "", "application/octet-stream", "binary/octet-stream":
+		return strings.HasPrefix(sniffed, "image/")
+	}
+	return false
+}
+
+// pageBodyCheck stops reading page bodies that are not text
+func pageBodyCheck(resp *http.Response, head []byte) bool {
+	return isTextBody(resp.Header.Get("Content-Type"), head)
+}
+
+// faviconBodyCheck returns a check that stops reading favicon responses that are not images
+// or whose Content-Length exceeds maxSize
+func faviconBodyCheck(maxSize int64) bodyCheck {
+	return func(resp *http.Response, head []byte) bool {
+		if maxSize > 0 && resp.ContentLength > maxSize {
+			return false
+		}
+		return isImageBody(resp.Header.Get("Content-Type"), head)
+	}
+}
@@ -0,0 +1,93 @@
+package fingerprint
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// charsetPrescanSize is how much of the body is searched for a <meta> charset declaration
+const charsetPrescanSize = 4096
+
+// metaCharsetRegex matches <meta charset="gbk"> and <meta http-equiv="Content-Type" content="text/html; charset=gbk">
+var metaCharsetRegex = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)`)
+
+// DecodeBody transcodes an HTTP response body to UTF-8.
+// The charset comes from the BOM, the Content-Type header, then the page's <meta> tags;
+// a header claiming UTF-8 is ignored when the body is not valid UTF-8 and a meta tag says otherwise.
+// Bodies without a usable charset are returned unchanged.
+func DecodeBody(body []byte, contentType string) string {
+	enc := detectEncoding(body, contentType)
+	if enc == nil || enc == unicode.UTF8 || enc == encoding.Nop {
+		return string(body)
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(body)
+	}
+	return string(decoded)
+}
+
+// detectEncoding returns the body's declared encoding, nil when none is recognised
+func detectEncoding(body []byte, contentType string) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		return unicode.UTF8
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	}
+
+	header := lookupEncoding(headerCharset(contentType))
+	if header != nil && (header != unicode.UTF8 || utf8.Valid(body)) {
+		return header
+	}
+	if meta := lookupEncoding(metaCharset(body)); meta != nil {
+		return meta
+	}
+	return header
+}
+
+// headerCharset returns the charset parameter of a Content-Type header
+func headerCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// metaCharset returns the charset declared by the first <meta> tag near the start of the page
+func metaCharset(body []byte) string {
+	if len(body) > charsetPrescanSize {
+		body = body[:charsetPrescanSize]
+	}
+	matches := metaCharsetRegex.FindSubmatch(body)
+	if len(matches) < 2 {
+		return ""
+	}
+	return string(matches[1])
+}
+
+// lookupEncoding resolves a charset label (gb2312, gbk, big5, shift_jis ...) using the WHATWG names
+func lookupEncoding(label string) encoding.Encoding {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return nil
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil
+	}
+	return enc
+}
@@ -5,11 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
-
-	"gopkg.in/yaml.v3"
 )
 
 // DSLEngine 指纹识别 DSL 引擎
@@ -17,6 +16,9 @@ type DSLEngine struct {
 	Rules    map[string]*FingerprintRule
 	mu       sync.RWMutex
 	compiled map[string]*regexp.Regexp
+	sources  map[string]string     // 规则名 -> 所在文件
+	strict   bool                  // 严格模式：规则文件有任何错误时拒绝加载
+	report   *RuleValidationReport // 最近一次加载的校验报告
 }
 
 // NewDSLEngine 创建新的 DSL 引擎
@@ -24,37 +26,131 @@ func NewDSLEngine() *DSLEngine {
 	return &DSLEngine{
 		Rules:    make(map[string]*FingerprintRule),
 		compiled: make(map[string]*regexp.Regexp),
+		sources:  make(map[string]string),
 	}
 }
 
-// LoadRulesFromFile 从单个文件加载规则
-func (e *DSLEngine) LoadRulesFromFile(filePath string) error {
+// SetStrict 设置严格模式
+// 严格模式下文件中任一规则校验失败则整个文件不加载并返回 *RuleValidationError，
+// 宽松模式下跳过有问题的规则，错误记录在校验报告中
+func (e *DSLEngine) SetStrict(strict bool) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.strict = strict
+}
 
-	data, err := os.ReadFile(filePath)
+// LoadRulesFromFile 从单个文件加载规则，追加到已加载的规则中
+func (e *DSLEngine) LoadRulesFromFile(filePath string) error {
+	rules, report, err := parseRulesFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return err
 	}
 
-	var rules map[string]*FingerprintRule
-	if err := yaml.Unmarshal(data, &rules); err != nil {
-		return fmt.Errorf("failed to parse YAML %s: %w", filePath, err)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	report.Strict = e.strict
+	rejected := e.strict && report.HasErrors()
+	if rejected {
+		report.Skipped += report.Loaded
+		report.Loaded = 0
+	}
+	if e.report == nil {
+		e.report = newRuleValidationReport(e.strict)
+	}
+	e.report.merge(report)
+	if rejected {
+		return &RuleValidationError{Report: report}
 	}
 
 	for name, rule := range rules {
-		if rule == nil {
+		e.Rules[name] = rule
+		e.sources[name] = filePath
+	}
+	for pattern, re := range compileRules(rules) {
+		e.compiled[pattern] = re
+	}
+	return nil
+}
+
+// ReloadRules 从规则文件重新加载全部规则并替换当前规则
+// 严格模式下有任何错误时保留原有规则；宽松模式下只加载通过校验的规则。
+// 同名规则以后面的文件为准。新规则集在锁外解析和编译，最后在写锁内整体替换，
+// 重新加载期间 AnalyzeResponse 使用的始终是完整的旧规则集或新规则集
+func (e *DSLEngine) ReloadRules(files ...string) (*RuleValidationReport, error) {
+	e.mu.RLock()
+	strict := e.strict
+	e.mu.RUnlock()
+
+	report := newRuleValidationReport(strict)
+	loaded := make(map[string]*FingerprintRule)
+	sources := make(map[string]string)
+	for _, file := range files {
+		rules, fileReport, err := parseRulesFile(file)
+		if err != nil {
+			report.Files = append(report.Files, file)
+			report.Errors = append(report.Errors, RuleError{File: file, Error: err.Error()})
 			continue
 		}
-		rule.ID = name
-		rule.Name = name
-		if rule.Condition == "" {
-			rule.Condition = "or"
+		report.merge(fileReport)
+		for name, rule := range rules {
+			loaded[name] = rule
+			sources[name] = file
 		}
-		e.Rules[name] = rule
 	}
 
-	return nil
+	if strict && report.HasErrors() {
+		report.Skipped += report.Loaded
+		report.Loaded = 0
+		return report, &RuleValidationError{Report: report}
+	}
+
+	compiled := compileRules(loaded)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Rules = loaded
+	e.compiled = compiled
+	e.sources = sources
+	e.report = report
+	return report, nil
+}
+
+// ValidationReport 最近一次加载的校验报告
+func (e *DSLEngine) ValidationReport() *RuleValidationReport {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.report == nil {
+		return newRuleValidationReport(e.strict)
+	}
+	return e.report.clone()
+}
+
+// compileRules 预编译规则中的正则，匹配时只读缓存
+func compileRules(rules map[string]*FingerprintRule) map[string]*regexp.Regexp {
+	compiled := make(map[string]*regexp.Regexp)
+	for _, rule := range rules {
+		if rule.VersionRegex != "" {
+			if re, err := regexp.Compile("(?i)" + rule.VersionRegex); err == nil {
+				compiled[rule.VersionRegex] = re
+			}
+		}
+		for _, dsl := range rule.DSL {
+			dsl = strings.TrimSpace(dsl)
+			if !strings.HasPrefix(dsl, "regex(") {
+				continue
+			}
+			args := parseDSLArgs(dsl, "regex")
+			if len(args) < 2 {
+				continue
+			}
+			pattern := strings.Trim(args[1], "'\"")
+			if re, err := regexp.Compile("(?i)" + pattern); err == nil {
+				compiled[pattern] = re
+			}
+		}
+	}
+	return compiled
 }
 
 // LoadRulesFromDir 从目录加载所有规则文件
@@ -76,6 +172,17 @@ func (e *DSLEngine) LoadRulesFromDir(dirPath string) error {
 	})
 }
 
+// SourceCounts 每个规则文件加载的规则数量
+func (e *DSLEngine) SourceCounts() map[string]int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, file := range e.sources {
+		counts[file]++
+	}
+	return counts
+}
+
 // RulesCount 返回已加载的规则数量
 func (e *DSLEngine) RulesCount() int {
 	e.mu.RLock()
@@ -109,15 +216,37 @@ func (e *DSLEngine) AnalyzeResponse(resp *HTTPResponse) []*FingerprintMatch {
 
 // matchRule 检查响应是否匹配规则
 func (e *DSLEngine) matchRule(resp *HTTPResponse, rule *FingerprintRule) *FingerprintMatch {
-	if len(rule.DSL) == 0 {
+	matchedDSLs, confidence := matchRuleDSL(rule, func(dsl string) bool {
+		return e.evaluateDSL(dsl, resp)
+	})
+	if len(matchedDSLs) == 0 {
 		return nil
 	}
 
+	return &FingerprintMatch{
+		URL:        resp.URL,
+		RuleName:   rule.Name,
+		Technology: rule.Name,
+		Version:    e.extractVersion(rule, resp),
+		DSLMatched: matchedDSLs,
+		Category:   rule.Category,
+		Tags:       ruleTags(rule),
+		Confidence: confidence,
+		Method:     "dsl",
+	}
+}
+
+// matchRuleDSL 按规则的 and/or 条件逐个评估 DSL，返回命中的表达式和置信度，未命中时返回 nil
+func matchRuleDSL(rule *FingerprintRule, evaluate func(dsl string) bool) ([]string, int) {
+	if len(rule.DSL) == 0 {
+		return nil, 0
+	}
+
 	matchedDSLs := make([]string, 0)
 	isAnd := strings.ToLower(rule.Condition) == "and"
 
 	for _, dsl := range rule.DSL {
-		matched := e.evaluateDSL(dsl, resp)
+		matched := evaluate(dsl)
 		if matched {
 			matchedDSLs = append(matchedDSLs, dsl)
 			if !isAnd {
@@ -126,12 +255,12 @@ func (e *DSLEngine) matchRule(resp *HTTPResponse, rule *FingerprintRule) *Finger
 			}
 		} else if isAnd {
 			// AND 条件：必须全部匹配
-			return nil
+			return nil, 0
 		}
 	}
 
 	if len(matchedDSLs) == 0 {
-		return nil
+		return nil, 0
 	}
 
 	// 根据匹配的 DSL 数量计算置信度
@@ -142,26 +271,51 @@ func (e *DSLEngine) matchRule(resp *HTTPResponse, rule *FingerprintRule) *Finger
 	if isAnd && len(matchedDSLs) == len(rule.DSL) {
 		confidence = 95
 	}
+	return matchedDSLs, confidence
+}
 
-	// 解析标签
-	var tags []string
-	if rule.Tags != "" {
-		tags = strings.Split(rule.Tags, ",")
-		for i := range tags {
-			tags[i] = strings.TrimSpace(tags[i])
-		}
+// ruleTags 解析规则的逗号分隔标签
+func ruleTags(rule *FingerprintRule) []string {
+	if rule.Tags == "" {
+		return nil
 	}
+	tags := strings.Split(rule.Tags, ",")
+	for i := range tags {
+		tags[i] = strings.TrimSpace(tags[i])
+	}
+	return tags
+}
 
-	return &FingerprintMatch{
-		URL:        resp.URL,
-		RuleName:   rule.Name,
-		Technology: rule.Name,
-		DSLMatched: matchedDSLs,
-		Category:   rule.Category,
-		Tags:       tags,
-		Confidence: confidence,
-		Method:     "dsl",
+// extractVersion 用规则的 version_regex 依次在 body、header、title 中提取版本号，取第一个捕获组
+func (e *DSLEngine) extractVersion(rule *FingerprintRule, resp *HTTPResponse) string {
+	if rule.VersionRegex == "" {
+		return ""
+	}
+	// 未通过加载校验的正则不会出现在缓存中，匹配时不再编译
+	re, ok := e.compiled[rule.VersionRegex]
+	if !ok || re.NumSubexp() == 0 {
+		return ""
 	}
+
+	// header 按名称排序，多个 header 都能匹配时结果稳定
+	names := make([]string, 0, len(resp.Headers))
+	for name := range resp.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ": " + resp.Headers[name] + "\n")
+	}
+
+	for _, content := range []string{resp.Body, headers.String(), resp.Title} {
+		if m := re.FindStringSubmatch(content); m != nil {
+			if version := strings.TrimSpace(m[1]); version != "" {
+				return version
+			}
+		}
+	}
+	return ""
 }
 
 // evaluateDSL 评估单个 DSL 表达式
@@ -193,6 +347,12 @@ func (e *DSLEngine) evaluateDSL(dsl string, resp *HTTPResponse) bool {
 	if strings.HasPrefix(dsl, "header(") {
 		return e.evalHeader(dsl, resp)
 	}
+	if strings.HasPrefix(dsl, "cookie(") {
+		return e.evalCookie(dsl, resp)
+	}
+	if strings.HasPrefix(dsl, "meta(") {
+		return e.evalMeta(dsl, resp)
+	}
 
 	return false
 }
@@ -200,7 +360,7 @@ func (e *DSLEngine) evaluateDSL(dsl string, resp *HTTPResponse) bool {
 // evalContains 评估 contains(target, value1, value2, ...)
 // 如果 target 包含任意一个 value 则返回 true
 func (e *DSLEngine) evalContains(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "contains")
+	args := parseDSLArgs(dsl, "contains")
 	if len(args) < 2 {
 		return false
 	}
@@ -237,7 +397,7 @@ func (e *DSLEngine) evalContains(dsl string, resp *HTTPResponse) bool {
 // evalContainsAll 评估 contains_all(target, value1, value2, ...)
 // 如果 target 包含所有 value 则返回 true
 func (e *DSLEngine) evalContainsAll(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "contains_all")
+	args := parseDSLArgs(dsl, "contains_all")
 	if len(args) < 2 {
 		return false
 	}
@@ -279,7 +439,7 @@ func (e *DSLEngine) evalContainsAny(dsl string, resp *HTTPResponse) bool {
 
 // evalTitle 评估 title('value')
 func (e *DSLEngine) evalTitle(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "title")
+	args := parseDSLArgs(dsl, "title")
 	if len(args) < 1 {
 		return false
 	}
@@ -292,7 +452,7 @@ func (e *DSLEngine) evalTitle(dsl string, resp *HTTPResponse) bool {
 
 // evalIcon 评估 icon('/path', 'hash') 或 icon('/path', 'hash1', 'hash2', ...)
 func (e *DSLEngine) evalIcon(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "icon")
+	args := parseDSLArgs(dsl, "icon")
 	if len(args) < 2 {
 		return false
 	}
@@ -310,7 +470,7 @@ func (e *DSLEngine) evalIcon(dsl string, resp *HTTPResponse) bool {
 
 // evalStatus 评估 status(code)
 func (e *DSLEngine) evalStatus(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "status")
+	args := parseDSLArgs(dsl, "status")
 	if len(args) < 1 {
 		return false
 	}
@@ -325,7 +485,7 @@ func (e *DSLEngine) evalStatus(dsl string, resp *HTTPResponse) bool {
 
 // evalRegex 评估 regex(target, pattern)
 func (e *DSLEngine) evalRegex(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "regex")
+	args := parseDSLArgs(dsl, "regex")
 	if len(args) < 2 {
 		return false
 	}
@@ -345,7 +505,7 @@ func (e *DSLEngine) evalRegex(dsl string, resp *HTTPResponse) bool {
 		content = resp.Body
 	}
 
-	// 使用缓存的正则表达式或编译新的
+	// 正则在加载时预编译，匹配时持有读锁不能写缓存
 	re, ok := e.compiled[pattern]
 	if !ok {
 		var err error
@@ -353,7 +513,6 @@ func (e *DSLEngine) evalRegex(dsl string, resp *HTTPResponse) bool {
 		if err != nil {
 			return false
 		}
-		e.compiled[pattern] = re
 	}
 
 	return re.MatchString(content)
@@ -361,7 +520,7 @@ func (e *DSLEngine) evalRegex(dsl string, resp *HTTPResponse) bool {
 
 // evalHeader 评估 header(name, value) 或 header('value')
 func (e *DSLEngine) evalHeader(dsl string, resp *HTTPResponse) bool {
-	args := e.parseDSLArgs(dsl, "header")
+	args := parseDSLArgs(dsl, "header")
 	if len(args) < 1 {
 		return false
 	}
@@ -382,7 +541,7 @@ func (e *DSLEngine) evalHeader(dsl string, resp *HTTPResponse) bool {
 }
 
 // parseDSLArgs 解析 DSL 函数的参数
-func (e *DSLEngine) parseDSLArgs(dsl, funcName string) []string {
+func parseDSLArgs(dsl, funcName string) []string {
 	prefix := funcName + "("
 	if !strings.HasPrefix(dsl, prefix) {
 		return nil
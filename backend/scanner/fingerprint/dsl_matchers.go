@@ -0,0 +1,108 @@
+package fingerprint
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Cookie 与 meta 标签匹配
+// cookie('name') / cookie('name', 'value')：按响应中 Set-Cookie 解析出的 Cookie 名称匹配，
+// 名称以 * 结尾时按前缀匹配（如 wordpress_logged_in_*），值为子串匹配。
+// meta('name', 'content')：按 meta 标签的 name / property / http-equiv 匹配，content 为子串匹配。
+// 名称和值都不区分大小写
+
+// ParseSetCookies 解析 Set-Cookie 响应头为 Cookie 名称 -> 值，忽略 Path、HttpOnly 等属性
+func ParseSetCookies(values []string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	resp := &http.Response{Header: http.Header{"Set-Cookie": values}}
+	cookies := make(map[string]string)
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	return cookies
+}
+
+// MetaTags 页面中的 meta 标签，名称（小写）-> content，同名标签保留全部
+// 首次调用时解析 body 并缓存，同一响应不要在多个协程中并发分析
+func (r *HTTPResponse) MetaTags() map[string][]string {
+	if r.metaParsed {
+		return r.meta
+	}
+	r.metaParsed = true
+	r.meta = parseMetaTags(r.Body)
+	return r.meta
+}
+
+// parseMetaTags 提取 meta 标签，属性值的单双引号由 HTML 解析器处理
+func parseMetaTags(body string) map[string][]string {
+	if !strings.Contains(strings.ToLower(body), "<meta") {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	tags := make(map[string][]string)
+	doc.Find("meta").Each(func(_ int, sel *goquery.Selection) {
+		content, _ := sel.Attr("content")
+		for _, attr := range []string{"name", "property", "http-equiv"} {
+			if name, ok := sel.Attr(attr); ok && strings.TrimSpace(name) != "" {
+				name = strings.ToLower(strings.TrimSpace(name))
+				tags[name] = append(tags[name], content)
+				return
+			}
+		}
+	})
+	return tags
+}
+
+// evalCookie 评估 cookie('name') 或 cookie('name', 'value')
+func (e *DSLEngine) evalCookie(dsl string, resp *HTTPResponse) bool {
+	args := parseDSLArgs(dsl, "cookie")
+	if len(args) < 1 {
+		return false
+	}
+
+	name := strings.ToLower(strings.Trim(args[0], "'\""))
+	prefix := strings.HasSuffix(name, "*")
+	name = strings.TrimSuffix(name, "*")
+	if name == "" {
+		return false
+	}
+	var pattern string
+	if len(args) > 1 {
+		pattern = strings.ToLower(strings.Trim(args[1], "'\""))
+	}
+
+	for cookieName, value := range resp.Cookies {
+		cookieName = strings.ToLower(cookieName)
+		if cookieName != name && !(prefix && strings.HasPrefix(cookieName, name)) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(value), pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalMeta 评估 meta('name', 'content')
+func (e *DSLEngine) evalMeta(dsl string, resp *HTTPResponse) bool {
+	args := parseDSLArgs(dsl, "meta")
+	if len(args) < 2 {
+		return false
+	}
+
+	name := strings.ToLower(strings.Trim(args[0], "'\""))
+	pattern := strings.ToLower(strings.Trim(args[1], "'\""))
+	for _, content := range resp.MetaTags()[name] {
+		if strings.Contains(strings.ToLower(content), pattern) {
+			return true
+		}
+	}
+	return false
+}
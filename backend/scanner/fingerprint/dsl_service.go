@@ -0,0 +1,187 @@
+package fingerprint
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"moongazing/scanner/core"
+)
+
+// 非 Web 服务指纹
+// 端口指纹读取到的 banner 和 TLS 证书交给 service_finger.yaml 中的 DSL 规则识别，
+// 例如按 MySQL 握手包中的认证插件识别数据库，按设备出厂证书的签发者识别防火墙、VPN 网关等设备。
+// 支持的函数：banner('...')、cert_subject('...')、cert_issuer('...')、cert_san('...') 包含任一值，
+// port(3306, 33060) 为任一端口，protocol('mysql') 为识别出的服务名；
+// contains / contains_all / contains_any / regex 的匹配对象为 banner、cert_subject、cert_issuer、cert_san、protocol
+
+// ServiceResponse 端口指纹的识别输入
+type ServiceResponse struct {
+	Host        string
+	Port        int
+	Banner      string
+	Protocol    string   // 识别出的服务名，如 mysql、ssh
+	CertSubject string   // TLS 证书主题
+	CertIssuer  string   // TLS 证书签发者
+	CertSANs    []string // TLS 证书的备用名称
+}
+
+// NewServiceResponse 由端口指纹结果构建识别输入
+func NewServiceResponse(host string, fp *PortFingerprint) *ServiceResponse {
+	resp := &ServiceResponse{
+		Host:     host,
+		Port:     fp.Port,
+		Banner:   fp.Banner,
+		Protocol: fp.Service,
+	}
+	if cert := fp.Certificate; cert != nil {
+		resp.CertSubject = cert.Subject
+		resp.CertIssuer = cert.Issuer
+		resp.CertSANs = cert.SANs
+	}
+	return resp
+}
+
+// AnalyzeService 分析端口 banner 和证书并返回匹配的指纹
+func (e *DSLEngine) AnalyzeService(resp *ServiceResponse) []*FingerprintMatch {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if resp == nil {
+		return nil
+	}
+
+	matches := make([]*FingerprintMatch, 0)
+	for _, rule := range e.Rules {
+		matchedDSLs, confidence := matchRuleDSL(rule, func(dsl string) bool {
+			return e.evaluateServiceDSL(dsl, resp)
+		})
+		if len(matchedDSLs) == 0 {
+			continue
+		}
+		matches = append(matches, &FingerprintMatch{
+			URL:        core.HostPort(resp.Host, resp.Port),
+			RuleName:   rule.Name,
+			Technology: rule.Name,
+			Version:    e.extractServiceVersion(rule, resp),
+			DSLMatched: matchedDSLs,
+			Category:   rule.Category,
+			Tags:       ruleTags(rule),
+			Confidence: confidence,
+			Method:     "dsl",
+		})
+	}
+	return matches
+}
+
+// extractServiceVersion 用规则的 version_regex 依次在 banner、证书主题中提取版本号
+func (e *DSLEngine) extractServiceVersion(rule *FingerprintRule, resp *ServiceResponse) string {
+	if rule.VersionRegex == "" {
+		return ""
+	}
+	re, ok := e.compiled[rule.VersionRegex]
+	if !ok || re.NumSubexp() == 0 {
+		return ""
+	}
+	for _, content := range []string{resp.Banner, resp.CertSubject} {
+		if m := re.FindStringSubmatch(content); m != nil {
+			if version := strings.TrimSpace(m[1]); version != "" {
+				return version
+			}
+		}
+	}
+	return ""
+}
+
+// evaluateServiceDSL 评估单个服务 DSL 表达式，HTTP 专用的函数不匹配
+func (e *DSLEngine) evaluateServiceDSL(dsl string, resp *ServiceResponse) bool {
+	dsl = strings.TrimSpace(dsl)
+	idx := strings.Index(dsl, "(")
+	if idx <= 0 {
+		return false
+	}
+	name := dsl[:idx]
+	args := parseDSLArgs(dsl, name)
+	if len(args) == 0 {
+		return false
+	}
+
+	switch name {
+	case "banner", "cert_subject", "cert_issuer", "cert_san":
+		return containsAnyValue(serviceContent(name, resp), args)
+	case "protocol":
+		for _, arg := range args {
+			if strings.EqualFold(strings.Trim(arg, "'\""), resp.Protocol) {
+				return true
+			}
+		}
+	case "port":
+		for _, arg := range args {
+			if port, err := strconv.Atoi(strings.TrimSpace(arg)); err == nil && port == resp.Port {
+				return true
+			}
+		}
+	case "contains", "contains_any":
+		if len(args) < 2 {
+			return false
+		}
+		return containsAnyValue(serviceContent(strings.Trim(args[0], "'\""), resp), args[1:])
+	case "contains_all":
+		if len(args) < 2 {
+			return false
+		}
+		content := strings.ToLower(serviceContent(strings.Trim(args[0], "'\""), resp))
+		for _, arg := range args[1:] {
+			if !strings.Contains(content, strings.ToLower(strings.Trim(arg, "'\""))) {
+				return false
+			}
+		}
+		return content != ""
+	case "regex":
+		if len(args) < 2 {
+			return false
+		}
+		pattern := strings.Trim(args[1], "'\"")
+		re, ok := e.compiled[pattern]
+		if !ok {
+			var err error
+			re, err = regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return false
+			}
+		}
+		return re.MatchString(serviceContent(strings.Trim(args[0], "'\""), resp))
+	}
+	return false
+}
+
+// serviceContent 服务 DSL 的匹配对象，未知对象返回空字符串
+func serviceContent(source string, resp *ServiceResponse) string {
+	switch strings.ToLower(source) {
+	case "banner":
+		return resp.Banner
+	case "cert_subject":
+		return resp.CertSubject
+	case "cert_issuer":
+		return resp.CertIssuer
+	case "cert_san":
+		return strings.Join(resp.CertSANs, "\n")
+	case "protocol":
+		return resp.Protocol
+	}
+	return ""
+}
+
+// containsAnyValue content 是否包含任一值（不区分大小写），content 为空时不匹配
+func containsAnyValue(content string, values []string) bool {
+	if content == "" {
+		return false
+	}
+	content = strings.ToLower(content)
+	for _, value := range values {
+		if pattern := strings.ToLower(strings.Trim(value, "'\"")); pattern != "" && strings.Contains(content, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package fingerprint
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// faviconRels link rel tokens that declare a page icon
+var faviconRels = map[string]bool{
+	"icon":                         true,
+	"apple-touch-icon":             true,
+	"apple-touch-icon-precomposed": true,
+}
+
+// defaultFaviconPaths are tried after the icons declared by the page
+var defaultFaviconPaths = []string{"/favicon.ico", "/favicon.png"}
+
+// getFaviconHash gets the favicon hash of a page. Icons declared with <link rel="icon">,
+// "shortcut icon" and "apple-touch-icon" in body are tried first, resolved against the final
+// page URL (after redirects) and <base href>; data: URIs are decoded in place. The
+// conventional /favicon.ico and /favicon.png are tried last. Responses that are not images
+// (an HTML 404 page served with status 200) or larger than s.MaxFaviconSize are skipped.
+// Icons are requested with the page's userAgent.
+func (s *FingerprintScanner) getFaviconHash(ctx context.Context, pageURL *url.URL, body []byte, userAgent string) (string, string, error) {
+	if pageURL == nil {
+		return "", "", nil
+	}
+
+	for _, candidate := range faviconCandidates(pageURL, body) {
+		if strings.HasPrefix(candidate, "data:") {
+			if favicon, ok := decodeDataURI(candidate); ok && len(favicon) > 0 && !s.faviconTooLarge(len(favicon)) {
+				iconHash, iconMD5 := faviconHashes(favicon)
+				return iconHash, iconMD5, nil
+			}
+			continue
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", candidate, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("User-Agent", userAgent)
+		s.RequestHeaders.Apply(req)
+
+		// One byte past the cap tells an oversized icon without Content-Length from one of exactly the cap
+		limit := int64(maxBodySize)
+		if s.MaxFaviconSize > 0 {
+			limit = s.MaxFaviconSize + 1
+		}
+		resp, favicon, _, err := s.fetchWithRetry(req, limit, faviconBodyCheck(s.MaxFaviconSize))
+		if errors.Is(err, ErrSlowResponse) {
+			return "", "", err
+		}
+		if err != nil || resp.StatusCode != 200 || len(favicon) == 0 {
+			continue
+		}
+		if s.faviconTooLarge(len(favicon)) || (resp.ContentLength > 0 && s.faviconTooLarge(int(resp.ContentLength))) ||
+			!isImageBody(resp.Header.Get("Content-Type"), favicon) {
+			continue
+		}
+
+		iconHash, iconMD5 := faviconHashes(favicon)
+		return iconHash, iconMD5, nil
+	}
+
+	return "", "", nil
+}
+
+// faviconTooLarge reports whether a favicon of size bytes exceeds s.MaxFaviconSize
+func (s *FingerprintScanner) faviconTooLarge(size int) bool {
+	return s.MaxFaviconSize > 0 && int64(size) > s.MaxFaviconSize
+}
+
+// faviconCandidates lists favicon URLs in the order they should be tried, without duplicates
+func faviconCandidates(pageURL *url.URL, body []byte) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(u string) {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			candidates = append(candidates, u)
+		}
+	}
+
+	base := pageURL
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+			if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+				base = pageURL.ResolveReference(ref)
+			}
+		}
+		doc.Find("link[rel][href]").Each(func(_ int, link *goquery.Selection) {
+			if !isFaviconLink(link.AttrOr("rel", "")) {
+				return
+			}
+			href := strings.TrimSpace(link.AttrOr("href", ""))
+			if strings.HasPrefix(strings.ToLower(href), "data:") {
+				add(href)
+				return
+			}
+			if ref, err := url.Parse(href); err == nil && href != "" {
+				if resolved := base.ResolveReference(ref); resolved.Scheme == "http" || resolved.Scheme == "https" {
+					add(resolved.String())
+				}
+			}
+		})
+	}
+
+	// Conventional locations live at the site root of the final URL, not under <base href>
+	for _, path := range defaultFaviconPaths {
+		add(pageURL.ResolveReference(&url.URL{Path: path}).String())
+	}
+	return candidates
+}
+
+// isFaviconLink reports whether a link rel attribute declares an icon ("icon", "shortcut icon", ...)
+func isFaviconLink(rel string) bool {
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		if faviconRels[token] {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeDataURI decodes a data: URI payload (base64 or percent-encoded)
+func decodeDataURI(uri string) ([]byte, bool) {
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return nil, false
+	}
+	meta, payload := strings.ToLower(uri[len("data:"):comma]), uri[comma+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		payload = strings.Join(strings.Fields(payload), "")
+		if data, err := base64.StdEncoding.DecodeString(payload); err == nil {
+			return data, true
+		}
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		return data, err == nil
+	}
+	data, err := url.PathUnescape(payload)
+	return []byte(data), err == nil
+}
+
+// faviconHashes returns the MMH3 hash (Shodan style, over the base64 encoding) and MD5 of a favicon
+func faviconHashes(favicon []byte) (string, string) {
+	md5Hash := md5.Sum(favicon)
+	b64 := base64.StdEncoding.EncodeToString(favicon)
+	return fmt.Sprintf("%d", mmh3Hash32([]byte(b64))), hex.EncodeToString(md5Hash[:])
+}
@@ -1,19 +1,21 @@
 package fingerprint
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/tls"
-	"encoding/base64"
+	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"hash"
-	"io"
+	"html"
+	"moongazing/config"
 	"moongazing/scanner/core"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
@@ -36,7 +38,10 @@ type FingerprintResult struct {
 	IconHash    string            `json:"icon_hash,omitempty"`
 	IconMD5     string            `json:"icon_md5,omitempty"`
 	BodyHash    string            `json:"body_hash,omitempty"`
+	NormalizedBodyHash string     `json:"normalized_body_hash,omitempty"` // SHA1 of the body without tokens, nonces and timestamps, see NormalizeBody
+	BodyPreview string            `json:"body_preview,omitempty"`         // First BodyPreviewLength characters of visible text
 	BodyLength  int               `json:"body_length,omitempty"`
+	ContentType string            `json:"content_type,omitempty"` // Content-Type header; bodies that are not text are only sniffed, not read
 	Fingerprints []Fingerprint    `json:"fingerprints"`
 	Technologies []string         `json:"technologies,omitempty"`
 	CMS         string            `json:"cms,omitempty"`
@@ -45,7 +50,17 @@ type FingerprintResult struct {
 	OS          string            `json:"os,omitempty"`
 	Language    string            `json:"language,omitempty"`
 	JSLibraries []string          `json:"js_libraries,omitempty"`
-	ScanTime    time.Duration     `json:"scan_time_ms"`
+	ScanTimeMs  int64             `json:"scan_time_ms"`
+	Attempts    int               `json:"attempts,omitempty"` // Page requests sent, including retries and the https fallback
+	UserAgent   string            `json:"user_agent,omitempty"` // User-Agent sent with the page and favicon requests, for reproducing the scan
+	Error       string            `json:"error,omitempty"`    // Why the page could not be fetched; wraps ErrRetriesExhausted after transient errors
+	Skipped     bool              `json:"skipped,omitempty"` // Not scanned because the batch was cancelled
+
+	FinalURL            string        `json:"final_url,omitempty"`             // URL of the fingerprinted page after redirects
+	RedirectChain       []RedirectHop `json:"redirect_chain,omitempty"`        // Redirects from URL to FinalURL, plus the one that was not followed
+	CrossOriginRedirect bool          `json:"cross_origin_redirect,omitempty"` // A redirect pointed to a host other than the target's
+
+	WAF *WAFInfo `json:"waf,omitempty"` // WAF in front of the page, from the waf.yaml rules or the active probe
 }
 
 // Fingerprint represents a single fingerprint match
@@ -59,24 +74,32 @@ type Fingerprint struct {
 
 // PortFingerprint represents service fingerprint on a port
 type PortFingerprint struct {
-	Port        int      `json:"port"`
-	Service     string   `json:"service"`
-	Version     string   `json:"version,omitempty"`
-	Product     string   `json:"product,omitempty"`
-	Info        string   `json:"info,omitempty"`
-	Banner      string   `json:"banner,omitempty"`
-	SSL         bool     `json:"ssl"`
-	Certificate *CertInfo `json:"certificate,omitempty"`
+	Port         int       `json:"port"`
+	Service      string    `json:"service"`
+	Version      string    `json:"version,omitempty"`
+	Product      string    `json:"product,omitempty"`
+	Info         string    `json:"info,omitempty"`
+	Banner       string    `json:"banner,omitempty"`
+	SSL          bool      `json:"ssl"`
+	StartTLS     bool      `json:"starttls"` // certificate obtained after a STARTTLS upgrade
+	Certificate  *CertInfo `json:"certificate,omitempty"`
+	Fingerprints []string  `json:"fingerprints,omitempty"` // service_finger.yaml rules matched by the banner and certificate
 }
 
 // CertInfo represents SSL certificate information
 type CertInfo struct {
-	Subject     string    `json:"subject"`
-	Issuer      string    `json:"issuer"`
-	NotBefore   time.Time `json:"not_before"`
-	NotAfter    time.Time `json:"not_after"`
-	SANs        []string  `json:"sans,omitempty"`
-	Fingerprint string    `json:"fingerprint"`
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	SANs               []string  `json:"sans,omitempty"`
+	Fingerprint        string    `json:"fingerprint"` // SHA256 of the DER certificate, same as FingerprintSHA256
+	FingerprintSHA1    string    `json:"fingerprint_sha1"`
+	FingerprintSHA256  string    `json:"fingerprint_sha256"`
+	SerialNumber       string    `json:"serial_number"` // hex, as printed by openssl x509 -serial
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	SelfSigned         bool      `json:"self_signed"`
+	Expired            bool      `json:"expired"`
 }
 
 // FingerprintScanner handles fingerprint detection
@@ -86,8 +109,34 @@ type FingerprintScanner struct {
 	Concurrency    int
 	DSLEngine      *DSLEngine                // DSL fingerprint engine
 	JSLibPatterns  map[string]*regexp.Regexp // JS library detection patterns
-	PortServices   map[int]string            // Port to service mapping
+	PortServices   map[int]string            // Port to service mapping, a copy of the unified mapping in config
+	PortDialer     func(ctx context.Context, network, address string) (net.Conn, error) // Dialer for port fingerprinting
 	FaviconHashes  map[string]FaviconInfo    // Favicon hash to technology mapping
+	TLSPorts       map[int]bool              // Ports that get a TLS handshake even when a banner was read
+	BannerRules    *ServiceBannerRules       // Non-HTTP banner rules and probes, checked before the built-in banner parsing
+	ServiceEngine  *DSLEngine                // DSL rules for non-HTTP services (service_finger.yaml), matched on banners and certificates
+	WAFRules       *WAFRules                 // WAF signatures (waf.yaml) matched on the page response
+
+	FirstByteTimeout time.Duration // Max wait for response headers, separate from the dial timeout
+	BodyReadTimeout  time.Duration // Max duration of a body read (page or favicon)
+	MaxFaviconSize   int64         // Favicon responses larger than this many bytes are not hashed, <= 0 disables the cap
+	SlowHostTTL      time.Duration // How long hosts that tripped a read deadline stay excluded
+	PerTargetTimeout time.Duration // Max duration of one target in BatchScanFingerprint, 0 disables
+	Retry            RetryPolicy   // Retries of transient network errors for page and favicon fetches
+	MaxPerOrigin     int           // Max targets of one origin scanned at the same time in BatchScanFingerprint, <= 0 disables
+	OriginBackoff    func(origin string, from, to int) // Called when BatchScanFingerprint halves the share of a throttling origin
+
+	MaxRedirects           int  // Redirects followed per page fetch, 0 disables following
+	FollowForeignRedirects bool // Fingerprint the page a redirect to another host leads to instead of the redirect itself
+
+	RequestHeaders *core.ScanHeaders // Task headers (session cookie, Authorization) sent with page and favicon requests
+	UserAgents     *core.UserAgentPicker // Picks the User-Agent of each target, nil sends core.DefaultUserAgent
+
+	WAFProbe bool // When no WAF rule matched, request the page once more with a suspicious query string and compare
+
+	RulesSummary *RulesLoadSummary // Rule files loaded by the constructor, per file counts and errors
+	rulesDir     string            // Directory given to NewFingerprintScannerWithRules, empty uses config.DictYAMLDir
+	slow             slowHosts
 }
 
 // FaviconInfo represents favicon hash mapping info
@@ -98,7 +147,18 @@ type FaviconInfo struct {
 
 
 // NewFingerprintScanner creates a new fingerprint scanner
+// Rules are read from the dictionary directory (config.SetDictBasePath) and DSL rules are shared across scanners
 func NewFingerprintScanner(concurrency int) *FingerprintScanner {
+	return newFingerprintScanner(concurrency, "")
+}
+
+// NewFingerprintScannerWithRules creates a fingerprint scanner that loads every rule file from dir
+// DSL rules go to a private engine instead of the shared one; files missing from dir fall back to the embedded copies
+func NewFingerprintScannerWithRules(dir string) *FingerprintScanner {
+	return newFingerprintScanner(0, dir)
+}
+
+func newFingerprintScanner(concurrency int, rulesDir string) *FingerprintScanner {
 	if concurrency <= 0 {
 		concurrency = core.DefaultFingerprintConcurrency
 	}
@@ -117,26 +177,86 @@ func NewFingerprintScanner(concurrency int) *FingerprintScanner {
 				MaxIdleConnsPerHost: core.MaxIdleConnsPerHost,
 				IdleConnTimeout:     core.IdleConnTimeout,
 			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) >= 3 {
-					return http.ErrUseLastResponse
-				}
-				return nil
-			},
 		},
-		Concurrency: concurrency,
+		Concurrency:      concurrency,
+		FirstByteTimeout: core.FingerprintFirstByteTimeout,
+		BodyReadTimeout:  core.FingerprintBodyReadTimeout,
+		MaxFaviconSize:   core.FingerprintMaxFaviconSize,
+		SlowHostTTL:      core.FingerprintSlowHostTTL,
+		PerTargetTimeout: core.FingerprintPerTargetTimeout,
+		Retry:            DefaultRetryPolicy(),
+		MaxRedirects:     core.FingerprintMaxRedirects,
+		MaxPerOrigin:     core.DefaultOriginConcurrency,
+		rulesDir:         rulesDir,
 	}
+	scanner.HTTPClient.CheckRedirect = scanner.checkRedirect
 
-	// Initialize DSL engine and load fingerprint rules
-	scanner.DSLEngine = NewDSLEngine()
+	// Use the shared DSL engine unless an explicit rules directory was given, then load fingerprint rules
+	if rulesDir == "" {
+		scanner.DSLEngine = DefaultDSLEngine()
+	} else {
+		scanner.DSLEngine = NewDSLEngine()
+	}
 	scanner.JSLibPatterns = make(map[string]*regexp.Regexp)
 	scanner.PortServices = make(map[int]string)
+	for port, service := range core.GetPortServiceMap() {
+		scanner.PortServices[port] = service
+	}
+	scanner.TLSPorts = make(map[int]bool)
+	for _, port := range core.DefaultTLSPorts {
+		scanner.TLSPorts[port] = true
+	}
+	scanner.PortDialer = (&net.Dialer{Timeout: scanner.Timeout}).DialContext
 	scanner.FaviconHashes = make(map[string]FaviconInfo)
-	scanner.loadFingerprintRules()
+	scanner.RulesSummary = scanner.loadFingerprintRules()
 
 	return scanner
 }
 
+// SetNetwork routes page and favicon requests through the configured proxy and resolves
+// hosts with the configured DNS servers. Port fingerprinting dials targets directly and
+// only picks up the resolver. A nil config restores the system network.
+func (s *FingerprintScanner) SetNetwork(cfg *core.ScanNetworkConfig) {
+	if transport, ok := s.HTTPClient.Transport.(*http.Transport); ok {
+		cfg.ApplyTransport(transport, net.Dialer{
+			Timeout:   core.DefaultHTTPTimeout,
+			KeepAlive: core.DefaultHTTPTimeout,
+		})
+	}
+	s.PortDialer = (&net.Dialer{Timeout: s.Timeout, Resolver: cfg.Resolver(s.Timeout)}).DialContext
+}
+
+// SetHeaders sets the custom headers sent with page and favicon requests, nil removes them.
+// They override the scanner's default User-Agent and Accept headers.
+func (s *FingerprintScanner) SetHeaders(headers *core.ScanHeaders) {
+	s.RequestHeaders = headers
+}
+
+// SetUserAgents sets the User-Agent strategy, nil restores core.DefaultUserAgent.
+// One User-Agent is picked per target and reused for its https retry and favicon requests.
+func (s *FingerprintScanner) SetUserAgents(agents *core.UserAgentPicker) {
+	s.UserAgents = agents
+}
+
+// Browser headers sent with page requests
+const (
+	pageAccept         = "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"
+	pageAcceptLanguage = "zh-CN,zh;q=0.9,en;q=0.8"
+)
+
+// newPageRequest builds a page request with the browser headers and userAgent, then the task headers
+func (s *FingerprintScanner) newPageRequest(ctx context.Context, url, userAgent string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", pageAccept)
+	req.Header.Set("Accept-Language", pageAcceptLanguage)
+	s.RequestHeaders.Apply(req)
+	return req, nil
+}
+
 // ScanFingerprint performs fingerprint detection on a URL
 func (s *FingerprintScanner) ScanFingerprint(ctx context.Context, target string) *FingerprintResult {
 	start := time.Now()
@@ -156,49 +276,63 @@ func (s *FingerprintScanner) ScanFingerprint(ctx context.Context, target string)
 	result.URL = url
 
 	// Fetch page
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := s.newPageRequest(ctx, url, s.UserAgents.Next())
 	if err != nil {
-		result.ScanTime = time.Since(start) / time.Millisecond
+		result.ScanTimeMs = core.MillisSince(start)
 		return result
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	// Hosts that already tripped a read deadline are not probed again
+	if s.IsSlowHost(req.URL.Host) {
+		result.Error = ErrSlowResponse.Error()
+		result.ScanTimeMs = core.MillisSince(start)
+		return result
+	}
+	// Task headers may override the picked User-Agent, record the one actually sent
+	result.UserAgent = req.Header.Get("User-Agent")
 
-	resp, err := s.HTTPClient.Do(req)
-	if err != nil {
-		// Try HTTPS
+	resp, body, attempts, err := s.fetchWithRetry(req, maxBodySize, pageBodyCheck)
+	result.Attempts = attempts
+	if err != nil && resp == nil && !errors.Is(err, ErrSlowResponse) && ctx.Err() == nil {
+		// Try HTTPS once the http retries are exhausted
 		if strings.HasPrefix(url, "http://") {
 			url = strings.Replace(url, "http://", "https://", 1)
 			result.URL = url
-			req, _ = http.NewRequestWithContext(ctx, "GET", url, nil)
-			req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-			resp, err = s.HTTPClient.Do(req)
-			if err != nil {
-				result.ScanTime = time.Since(start) / time.Millisecond
-				return result
-			}
-		} else {
-			result.ScanTime = time.Since(start) / time.Millisecond
-			return result
+			// Same headers as the http request, so both attempts look like one browser
+			req, _ = s.newPageRequest(ctx, url, result.UserAgent)
+			resp, body, attempts, err = s.fetchWithRetry(req, maxBodySize, pageBodyCheck)
+			result.Attempts += attempts
 		}
 	}
-	defer resp.Body.Close()
-
-	result.StatusCode = resp.StatusCode
-
-	// Read body (limit to 1MB)
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+		applyRedirects(result, resp)
+	}
 	if err != nil {
-		result.ScanTime = time.Since(start) / time.Millisecond
+		result.Error = err.Error()
+		result.ScanTimeMs = core.MillisSince(start)
 		return result
 	}
-	bodyStr := string(body)
-	result.BodyLength = len(body)
 
-	// Calculate body hash
-	bodyMD5 := md5.Sum(body)
-	result.BodyHash = hex.EncodeToString(bodyMD5[:])
+	// Body is limited to maxBodySize; the decoded copy is used for the title, preview and DSL rules.
+	// Bodies that are not text (installers, archives, images) stop after the sniffed bytes and skip
+	// body-based detection, their length comes from Content-Length
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.BodyLength = len(body)
+	bodyStr := ""
+	if isTextBody(result.ContentType, body) {
+		bodyStr = DecodeBody(body, result.ContentType)
+
+		// Calculate body hash on the raw bytes
+		bodyMD5 := md5.Sum(body)
+		result.BodyHash = hex.EncodeToString(bodyMD5[:])
+		result.NormalizedBodyHash = NormalizedBodyHash(string(body))
+		result.BodyPreview = VisibleTextPreview(bodyStr, BodyPreviewLength)
+	} else {
+		if resp.ContentLength > 0 {
+			result.BodyLength = int(resp.ContentLength)
+		}
+		body = nil
+	}
 
 	// Extract headers
 	for key, values := range resp.Header {
@@ -210,87 +344,175 @@ func (s *FingerprintScanner) ScanFingerprint(ctx context.Context, target string)
 	result.PoweredBy = resp.Header.Get("X-Powered-By")
 
 	// Extract title
-	result.Title = extractPageTitle(bodyStr)
+	result.Title = ExtractPageTitle(bodyStr)
 
 	// Extract JS libraries
 	result.JSLibraries = s.extractJSLibraries(bodyStr)
 
-	// Try to get favicon hash
-	iconHash, iconMD5 := s.getFaviconHash(ctx, url)
+	// Try to get favicon hash: icons declared by the page first, then /favicon.ico
+	iconHash, iconMD5, err := s.getFaviconHash(ctx, resp.Request.URL, body, result.UserAgent)
+	if err != nil {
+		result.Error = err.Error()
+	}
 	result.IconHash = iconHash
 	result.IconMD5 = iconMD5
 
 	// Use DSL engine for fingerprint detection
-	s.detectFingerprintsWithDSL(result, bodyStr, iconHash, iconMD5)
+	cookies := ParseSetCookies(resp.Header.Values("Set-Cookie"))
+	s.detectFingerprintsWithDSL(result, bodyStr, iconHash, iconMD5, cookies)
+
+	// Detect a WAF in front of the page
+	result.WAF = s.detectWAF(ctx, resp, bodyStr, cookies)
 
 	// Sort fingerprints by confidence
 	sort.Slice(result.Fingerprints, func(i, j int) bool {
 		return result.Fingerprints[i].Confidence > result.Fingerprints[j].Confidence
 	})
 
-	result.ScanTime = time.Since(start) / time.Millisecond
+	result.ScanTimeMs = core.MillisSince(start)
 	return result
 }
 
-// loadFingerprintRules loads fingerprint rules from YAML files
-func (s *FingerprintScanner) loadFingerprintRules() {
-	// Try to find the config/dicts/yaml directory
-	paths := []string{
-		"config/dicts/yaml",
-		"./config/dicts/yaml",
-		"../config/dicts/yaml",
-		"backend/config/dicts/yaml",
+// defaultRuleFiles returns the DSL rule files shared by all scanners
+func defaultRuleFiles() []string {
+	return dslRuleFiles(config.DictYAMLDir())
+}
+
+var (
+	defaultEngine     = NewDSLEngine()
+	defaultEngineOnce sync.Once
+)
+
+// InitDefaultRules loads the shared DSL rules, called once at startup
+// In strict mode any invalid rule aborts loading and the report is returned with the error
+func InitDefaultRules(strict bool) (*RuleValidationReport, error) {
+	defaultEngine.SetStrict(strict)
+	return ReloadDefaultRules()
+}
+
+// DefaultDSLEngine returns the shared DSL engine, loading rules in lenient mode on first use
+func DefaultDSLEngine() *DSLEngine {
+	loadDefaultRulesOnce()
+	return defaultEngine
+}
+
+// ReloadDefaultRules reloads the shared DSL rules from disk, custom rules take precedence over built-in rules
+// In strict mode the previous rules are kept when the new files contain errors
+func ReloadDefaultRules() (*RuleValidationReport, error) {
+	if report, loaded, err := loadDefaultRulesOnce(); loaded {
+		return report, err
 	}
+	return reloadDefaultEngine()
+}
 
-	var rulesDir string
-	for _, p := range paths {
-		if _, err := os.Stat(p); err == nil {
-			rulesDir = p
-			break
-		}
+// loadDefaultRulesOnce loads the shared rules on first use, loaded reports whether this call did the loading
+func loadDefaultRulesOnce() (report *RuleValidationReport, loaded bool, err error) {
+	defaultEngineOnce.Do(func() {
+		report, err = reloadDefaultEngine()
+		loaded = true
+	})
+	return report, loaded, err
+}
+
+// reloadDefaultEngine reloads the shared engine, problems are returned in the report instead of printed
+func reloadDefaultEngine() (*RuleValidationReport, error) {
+	return defaultEngine.ReloadRules(ruleFiles()...)
+}
+
+// Reload reloads the scanner's DSL rules from the rule files, including the custom rules file
+// The rule set is swapped atomically, scans running during the reload keep matching against a complete rule set
+func (s *FingerprintScanner) Reload() (*RuleValidationReport, error) {
+	if s.DSLEngine == nil || s.DSLEngine == defaultEngine {
+		return ReloadDefaultRules()
 	}
+	if s.rulesDir != "" {
+		return s.DSLEngine.ReloadRules(dslRuleFiles(s.rulesDir)...)
+	}
+	return s.DSLEngine.ReloadRules(ruleFiles()...)
+}
 
-	if rulesDir == "" {
-		fmt.Println("Warning: fingerprint rules directory not found")
-		return
+// RulesStatus shared DSL rules status
+type RulesStatus struct {
+	RulesCount      int                   `json:"rules_count"`
+	Strict          bool                  `json:"strict"`
+	CustomRulesFile string                `json:"custom_rules_file"`
+	Report          *RuleValidationReport `json:"report"`
+	Files           *RulesLoadSummary     `json:"files"`
+}
+
+// DefaultRulesStatus returns the shared DSL rules status and the last validation report
+func DefaultRulesStatus() RulesStatus {
+	engine := DefaultDSLEngine()
+	report := engine.ValidationReport()
+	return RulesStatus{
+		RulesCount:      engine.RulesCount(),
+		Strict:          report.Strict,
+		CustomRulesFile: CustomRulesFile(),
+		Report:          report,
+		Files:           DefaultRulesSummary(),
 	}
+}
 
-	// Load finger.yaml
-	fingerPath := filepath.Join(rulesDir, "finger.yaml")
-	if err := s.DSLEngine.LoadRulesFromFile(fingerPath); err != nil {
-		fmt.Printf("Warning: failed to load finger.yaml: %v\n", err)
+// loadFingerprintRules loads the scanner's rule files and returns what was loaded from each of them
+// DSL rules are shared across scanners (see DefaultDSLEngine) unless the scanner has its own rules directory
+func (s *FingerprintScanner) loadFingerprintRules() *RulesLoadSummary {
+	rulesDir := s.rulesDir
+	if rulesDir == "" {
+		rulesDir = config.DictYAMLDir()
 	}
+	summary := &RulesLoadSummary{Dir: rulesDir}
 
-	// Load sensitive.yaml
-	sensitivePath := filepath.Join(rulesDir, "sensitive.yaml")
-	if err := s.DSLEngine.LoadRulesFromFile(sensitivePath); err != nil {
-		fmt.Printf("Warning: failed to load sensitive.yaml: %v\n", err)
+	// DSL rules: finger.yaml, sensitive.yaml and, for the shared engine, the custom rules file
+	if s.rulesDir != "" {
+		s.DSLEngine.ReloadRules(dslRuleFiles(rulesDir)...)
 	}
+	summary.addDSL(s.DSLEngine, rulesDir)
 
 	// Load jslib.yaml for JavaScript library detection
-	jslibPath := filepath.Join(rulesDir, "jslib.yaml")
-	if err := s.loadJSLibPatterns(jslibPath); err != nil {
-		fmt.Printf("Warning: failed to load jslib.yaml: %v\n", err)
-	}
+	jslibPath := config.ResolveDictFile(rulesDir, "jslib.yaml")
+	skipped, err := s.loadJSLibPatterns(jslibPath)
+	summary.add("jslib.yaml", jslibPath, len(s.JSLibPatterns), skipped, err)
 
-	// Load ports.yaml for port service mapping
-	portsPath := filepath.Join(rulesDir, "ports.yaml")
-	if err := s.loadPortServices(portsPath); err != nil {
-		fmt.Printf("Warning: failed to load ports.yaml: %v\n", err)
+	// Load favicon.yaml for favicon hash mapping
+	faviconPath := config.ResolveDictFile(rulesDir, "favicon.yaml")
+	err = s.loadFaviconHashes(faviconPath)
+	summary.add("favicon.yaml", faviconPath, len(s.FaviconHashes), 0, err)
+
+	// ports.yaml: the shared dictionary already holds the configured directory's mapping
+	portsPath := config.ResolveDictFile(rulesDir, "ports.yaml")
+	err = nil
+	if s.rulesDir != "" {
+		err = s.loadPortServices(portsPath)
 	}
+	summary.add("ports.yaml", portsPath, len(s.PortServices), 0, err)
 
-	// Load favicon.yaml for favicon hash mapping
-	faviconPath := filepath.Join(rulesDir, "favicon.yaml")
-	if err := s.loadFaviconHashes(faviconPath); err != nil {
-		fmt.Printf("Warning: failed to load favicon.yaml: %v\n", err)
+	// Load service_banners.yaml for non-HTTP service detection
+	bannerPath := config.ResolveDictFile(rulesDir, "service_banners.yaml")
+	bannerRules, err := LoadServiceBannerRules(bannerPath)
+	if err == nil {
+		s.BannerRules = bannerRules
+	}
+	summary.add("service_banners.yaml", bannerPath, s.BannerRules.RulesCount(), 0, err)
+
+	// Load service_finger.yaml for non-HTTP fingerprints
+	servicePath := config.ResolveDictFile(rulesDir, "service_finger.yaml")
+	s.ServiceEngine = NewDSLEngine()
+	err = s.ServiceEngine.LoadRulesFromFile(servicePath)
+	summary.add("service_finger.yaml", servicePath, s.ServiceEngine.RulesCount(), s.ServiceEngine.ValidationReport().Skipped, err)
+
+	// Load waf.yaml for WAF detection
+	wafPath := config.ResolveDictFile(rulesDir, "waf.yaml")
+	wafRules, skipped, err := LoadWAFRules(wafPath)
+	if err == nil {
+		s.WAFRules = wafRules
 	}
+	summary.add("waf.yaml", wafPath, s.WAFRules.RulesCount(), skipped, err)
 
-	fmt.Printf("Loaded %d fingerprint rules, %d JS libs, %d port services, %d favicon hashes\n", 
-		s.DSLEngine.RulesCount(), len(s.JSLibPatterns), len(s.PortServices), len(s.FaviconHashes))
+	return summary
 }
 
 // detectFingerprintsWithDSL performs fingerprint detection using DSL engine
-func (s *FingerprintScanner) detectFingerprintsWithDSL(result *FingerprintResult, body, iconHash, iconMD5 string) {
+func (s *FingerprintScanner) detectFingerprintsWithDSL(result *FingerprintResult, body, iconHash, iconMD5 string, cookies map[string]string) {
 	matched := make(map[string]bool)
 
 	// Use DSL engine if available
@@ -303,47 +525,70 @@ func (s *FingerprintScanner) detectFingerprintsWithDSL(result *FingerprintResult
 			URL:        result.URL,
 			IconHash:   iconHash,
 			IconMD5:    iconMD5,
+			Cookies:    cookies,
 		}
 
 		dslMatches := s.DSLEngine.AnalyzeResponse(dslResp)
 		for _, match := range dslMatches {
-			if !matched[match.Technology] {
-				matched[match.Technology] = true
-				result.Fingerprints = append(result.Fingerprints, Fingerprint{
-					Name:       match.Technology,
-					Category:   match.Category,
-					Confidence: match.Confidence,
-					Method:     "dsl",
-				})
-				result.Technologies = append(result.Technologies, match.Technology)
-				setCategoryField(result, match.Technology, match.Category)
-			}
+			s.addFingerprintVersion(result, matched, match.Technology, match.Version, match.Category, match.Confidence, "dsl")
 		}
 	}
 
 	// Also detect from headers (basic detection as fallback)
 	s.detectFromHeaders(result, matched)
+
+	// JavaScript libraries referenced by the page
+	s.detectJSLibraries(result, body, matched)
+}
+
+// detectJSLibraries merges JavaScript libraries into technologies, with the version captured by the jslib pattern
+func (s *FingerprintScanner) detectJSLibraries(result *FingerprintResult, body string, matched map[string]bool) {
+	names := make([]string, 0, len(s.JSLibPatterns))
+	for name := range s.JSLibPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := s.JSLibPatterns[name].FindStringSubmatch(body)
+		if m == nil {
+			continue
+		}
+		var version string
+		if len(m) > 1 {
+			version = strings.Trim(m[1], ".-")
+		}
+		s.addFingerprintVersion(result, matched, name, version, "JavaScript", 80, "jslib")
+	}
 }
 
 // detectFromHeaders performs basic fingerprint detection from HTTP headers
 func (s *FingerprintScanner) detectFromHeaders(result *FingerprintResult, matched map[string]bool) {
-	// Detect from Server header
+	// Detect from Server header, e.g. "nginx/1.18.0" also yields the version
 	if result.Server != "" {
+		server := core.NormalizeTechnology(core.ServerProduct(result.Server))
+		serverVersion := func(name string) string {
+			if server.Name == name {
+				return server.Version
+			}
+			// The product may not be the first one, e.g. "Apache/2.4.41 (Ubuntu) Tomcat/9.0.1"
+			return headerProductVersion(result.Server, name)
+		}
 		serverLower := strings.ToLower(result.Server)
 		if strings.Contains(serverLower, "nginx") {
-			s.addFingerprint(result, matched, "Nginx", "WebServer", 90, "header")
+			s.addFingerprintVersion(result, matched, "Nginx", serverVersion("Nginx"), "WebServer", 90, "header")
 		}
 		if strings.Contains(serverLower, "apache") {
-			s.addFingerprint(result, matched, "Apache", "WebServer", 90, "header")
+			s.addFingerprintVersion(result, matched, "Apache", serverVersion("Apache"), "WebServer", 90, "header")
 		}
 		if strings.Contains(serverLower, "iis") {
-			s.addFingerprint(result, matched, "IIS", "WebServer", 90, "header")
+			s.addFingerprintVersion(result, matched, "IIS", serverVersion("IIS"), "WebServer", 90, "header")
 		}
 		if strings.Contains(serverLower, "tomcat") {
-			s.addFingerprint(result, matched, "Tomcat", "WebServer", 90, "header")
+			s.addFingerprintVersion(result, matched, "Tomcat", serverVersion("Tomcat"), "WebServer", 90, "header")
 		}
 		if strings.Contains(serverLower, "openresty") {
-			s.addFingerprint(result, matched, "OpenResty", "WebServer", 90, "header")
+			s.addFingerprintVersion(result, matched, "OpenResty", serverVersion("OpenResty"), "WebServer", 90, "header")
 		}
 	}
 
@@ -351,34 +596,81 @@ func (s *FingerprintScanner) detectFromHeaders(result *FingerprintResult, matche
 	if result.PoweredBy != "" {
 		poweredByLower := strings.ToLower(result.PoweredBy)
 		if strings.Contains(poweredByLower, "php") {
-			s.addFingerprint(result, matched, "PHP", "Language", 90, "header")
+			s.addFingerprintVersion(result, matched, "PHP", headerProductVersion(result.PoweredBy, "PHP"), "Language", 90, "header")
 		}
 		if strings.Contains(poweredByLower, "asp.net") {
-			s.addFingerprint(result, matched, "ASP.NET", "Framework", 90, "header")
+			s.addFingerprintVersion(result, matched, "ASP.NET", headerProductVersion(result.PoweredBy, "ASP.NET"), "Framework", 90, "header")
 		}
 		if strings.Contains(poweredByLower, "express") {
 			s.addFingerprint(result, matched, "Express", "Framework", 90, "header")
 		}
 		if strings.Contains(poweredByLower, "servlet") {
-			s.addFingerprint(result, matched, "Java Servlet", "Framework", 90, "header")
+			s.addFingerprintVersion(result, matched, "Java Servlet", headerProductVersion(result.PoweredBy, "Servlet"), "Framework", 90, "header")
 		}
 	}
 }
 
+// headerProductVersion returns the version of product in a Server / X-Powered-By style header,
+// e.g. "PHP/8.1.0" -> "8.1.0", "Apache/2.4.41 (Ubuntu) PHP/7.4.3" with PHP -> "7.4.3"
+func headerProductVersion(header, product string) string {
+	for _, field := range strings.FieldsFunc(header, func(r rune) bool { return r == ' ' || r == ',' || r == ';' }) {
+		name, version, ok := strings.Cut(field, "/")
+		if !ok || !strings.EqualFold(name, product) {
+			continue
+		}
+		version = strings.Trim(version, "()")
+		if version != "" && version[0] >= '0' && version[0] <= '9' {
+			return version
+		}
+	}
+	return ""
+}
+
 // addFingerprint adds a fingerprint to result if not already matched
 func (s *FingerprintScanner) addFingerprint(result *FingerprintResult, matched map[string]bool, name, category string, confidence int, method string) {
-	if matched[name] {
+	s.addFingerprintVersion(result, matched, name, "", category, confidence, method)
+}
+
+// addFingerprintVersion adds a fingerprint under its canonical name (see core.NormalizeTechnology)
+// A version embedded in the name ("Nginx:1.18") takes precedence over the version argument
+func (s *FingerprintScanner) addFingerprintVersion(result *FingerprintResult, matched map[string]bool, name, version, category string, confidence int, method string) {
+	tech := core.NormalizeTechnology(name)
+	if tech.Name == "" {
 		return
 	}
-	matched[name] = true
+	if tech.Version == "" {
+		tech.Version = version
+	}
+	if matched[tech.Name] {
+		// Same technology from another source, keep the first known version
+		for i := range result.Fingerprints {
+			if result.Fingerprints[i].Name == tech.Name && result.Fingerprints[i].Version == "" {
+				result.Fingerprints[i].Version = tech.Version
+			}
+		}
+		return
+	}
+	matched[tech.Name] = true
 	result.Fingerprints = append(result.Fingerprints, Fingerprint{
-		Name:       name,
+		Name:       tech.Name,
 		Category:   category,
+		Version:    tech.Version,
 		Confidence: confidence,
 		Method:     method,
 	})
-	result.Technologies = append(result.Technologies, name)
-	setCategoryField(result, name, category)
+	result.Technologies = append(result.Technologies, tech.Name)
+	setCategoryField(result, tech.Name, category)
+}
+
+// TechVersions returns canonical technology name -> version for fingerprints with a known version
+func (r *FingerprintResult) TechVersions() map[string]string {
+	versions := make(map[string]string)
+	for _, fp := range r.Fingerprints {
+		if fp.Version != "" {
+			versions[fp.Name] = fp.Version
+		}
+	}
+	return versions
 }
 
 // setCategoryField sets the appropriate category field in result
@@ -403,30 +695,35 @@ func setCategoryField(result *FingerprintResult, name, category string) {
 	}
 }
 
-// extractPageTitle extracts page title from HTML
-func extractPageTitle(html string) string {
+// maxTitleLength is the longest title kept, in runes
+const maxTitleLength = 200
+
+// ExtractPageTitle extracts page title from HTML that has already been decoded to UTF-8 (see DecodeBody)
+func ExtractPageTitle(body string) string {
 	titleRegex := regexp.MustCompile(`(?i)<title[^>]*>([^<]+)</title>`)
-	matches := titleRegex.FindStringSubmatch(html)
+	matches := titleRegex.FindStringSubmatch(body)
 	if len(matches) > 1 {
-		title := strings.TrimSpace(matches[1])
+		// Entities (&amp;, &#x4e2d;) are unescaped, invalid bytes replaced so the title is valid UTF-8
+		title := strings.ToValidUTF8(html.UnescapeString(matches[1]), "\uFFFD")
 		// Clean up title
 		title = strings.ReplaceAll(title, "\n", " ")
 		title = strings.ReplaceAll(title, "\r", " ")
 		title = strings.ReplaceAll(title, "\t", " ")
-		// Limit length
-		if len(title) > 200 {
-			title = title[:200] + "..."
+		title = strings.TrimSpace(title)
+		// Limit length by runes so multi-byte characters are never split
+		if runes := []rune(title); len(runes) > maxTitleLength {
+			title = string(runes[:maxTitleLength]) + "..."
 		}
 		return title
 	}
 	return ""
 }
 
-// loadJSLibPatterns loads JavaScript library patterns from YAML file
-func (s *FingerprintScanner) loadJSLibPatterns(path string) error {
-	data, err := os.ReadFile(path)
+// loadJSLibPatterns loads JavaScript library patterns from YAML file, returns the number of invalid patterns skipped
+func (s *FingerprintScanner) loadJSLibPatterns(path string) (int, error) {
+	data, err := config.ReadDictFile(path)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Parse YAML structure: LibName: {pattern: "regex"}
@@ -434,52 +731,45 @@ func (s *FingerprintScanner) loadJSLibPatterns(path string) error {
 		Pattern string `yaml:"pattern"`
 	}
 	if err := yaml.Unmarshal(data, &rawPatterns); err != nil {
-		return err
+		return 0, err
 	}
 
 	// Compile regex patterns
+	skipped := 0
 	for name, item := range rawPatterns {
 		if item.Pattern == "" {
 			continue
 		}
 		re, err := regexp.Compile(item.Pattern)
 		if err != nil {
-			fmt.Printf("Warning: invalid regex for %s: %v\n", name, err)
+			skipped++
 			continue
 		}
 		s.JSLibPatterns[name] = re
 	}
 
-	return nil
+	return skipped, nil
 }
 
-// loadPortServices loads port to service mapping from YAML file
+// loadPortServices replaces the port to service mapping with the one in a ports.yaml file
 func (s *FingerprintScanner) loadPortServices(path string) error {
-	data, err := os.ReadFile(path)
-	if err != nil {
+	if _, err := config.ReadDictFile(path); err != nil {
 		return err
 	}
-
-	// Parse YAML structure: port: {service: "name"}
-	var rawPorts map[int]struct {
-		Service string `yaml:"service"`
+	ports := config.LoadPortsConfigFile(path)
+	if len(ports.PortServiceMap) == 0 {
+		return fmt.Errorf("no port services in %s", path)
 	}
-	if err := yaml.Unmarshal(data, &rawPorts); err != nil {
-		return err
+	s.PortServices = make(map[int]string, len(ports.PortServiceMap))
+	for port, service := range ports.PortServiceMap {
+		s.PortServices[port] = service
 	}
-
-	for port, item := range rawPorts {
-		if item.Service != "" {
-			s.PortServices[port] = item.Service
-		}
-	}
-
 	return nil
 }
 
 // loadFaviconHashes loads favicon hash to technology mapping from YAML file
 func (s *FingerprintScanner) loadFaviconHashes(path string) error {
-	data, err := os.ReadFile(path)
+	data, err := config.ReadDictFile(path)
 	if err != nil {
 		return err
 	}
@@ -499,6 +789,7 @@ func (s *FingerprintScanner) extractJSLibraries(html string) []string {
 
 	// Use patterns from configuration
 	for name, pattern := range s.JSLibPatterns {
+		name = core.NormalizeTechnology(name).Name
 		if pattern.MatchString(html) && !seen[name] {
 			seen[name] = true
 			libraries = append(libraries, name)
@@ -509,53 +800,6 @@ func (s *FingerprintScanner) extractJSLibraries(html string) []string {
 	return libraries
 }
 
-// getFaviconHash gets favicon hash (Shodan compatible mmh3)
-func (s *FingerprintScanner) getFaviconHash(ctx context.Context, baseURL string) (string, string) {
-	// Parse base URL
-	faviconURLs := []string{
-		baseURL + "/favicon.ico",
-		baseURL + "/favicon.png",
-	}
-
-	// Also try to find from HTML
-	// (simplified - would need to parse HTML link tags)
-
-	for _, faviconURL := range faviconURLs {
-		req, err := http.NewRequestWithContext(ctx, "GET", faviconURL, nil)
-		if err != nil {
-			continue
-		}
-		req.Header.Set("User-Agent", "Mozilla/5.0")
-
-		resp, err := s.HTTPClient.Do(req)
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			continue
-		}
-
-		favicon, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
-		if err != nil || len(favicon) == 0 {
-			continue
-		}
-
-		// Calculate MD5
-		md5Hash := md5.Sum(favicon)
-		md5Str := hex.EncodeToString(md5Hash[:])
-
-		// Calculate MMH3 hash (Shodan style)
-		b64 := base64.StdEncoding.EncodeToString(favicon)
-		mmh3Hash := mmh3Hash32([]byte(b64))
-
-		return fmt.Sprintf("%d", mmh3Hash), md5Str
-	}
-
-	return "", ""
-}
-
 // mmh3Hash32 calculates MurmurHash3 32-bit hash
 func mmh3Hash32(data []byte) int32 {
 	h := murmur3.New32()
@@ -570,10 +814,12 @@ func (s *FingerprintScanner) ScanPortFingerprint(ctx context.Context, host strin
 		Service: "unknown",
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := core.HostPort(host, port)
 
 	// Try TCP connection
-	conn, err := net.DialTimeout("tcp", address, s.Timeout)
+	dialCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	conn, err := s.PortDialer(dialCtx, "tcp", address)
 	if err != nil {
 		return result
 	}
@@ -583,32 +829,68 @@ func (s *FingerprintScanner) ScanPortFingerprint(ctx context.Context, host strin
 	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
 
 	// Try to grab banner
+	bannerService := ""
 	buffer := make([]byte, 4096)
 	n, _ := conn.Read(buffer)
+	if n == 0 {
+		// Silent port: services like Redis and RDP only answer a request
+		if probe := s.BannerRules.Probe(port); probe != nil {
+			conn.SetDeadline(time.Now().Add(3 * time.Second))
+			if _, err := conn.Write(probe); err == nil {
+				n, _ = conn.Read(buffer)
+			}
+		}
+	}
 	if n > 0 {
 		result.Banner = string(buffer[:n])
-		result.Service, result.Product, result.Version = parseServiceBanner(result.Banner, port)
+		bannerService, result.Product, result.Version = s.parseServiceBanner(result.Banner, port)
 	}
 
-	// Try SSL/TLS connection for common HTTPS ports
-	if port == 443 || port == 8443 || port == 9443 {
-		result.SSL = true
-		result.Certificate = s.getCertInfo(ctx, host, port)
-		if result.Service == "unknown" {
-			result.Service = "https"
+	if SupportsStartTLS(bannerService) {
+		// Mail/FTP services upgrade in-band; reuse the connection the banner came from
+		if cert := s.getStartTLSCertInfo(ctx, conn, bannerService, host); cert != nil {
+			result.StartTLS = true
+			result.Certificate = cert
+		}
+	} else if s.TLSPorts[port] || n == 0 {
+		// Listed TLS ports, and silent ports (a TLS server waits for the ClientHello), get a handshake
+		if cert := s.getCertInfo(ctx, host, port); cert != nil {
+			result.SSL = true
+			result.Certificate = cert
 		}
 	}
 
-	// If no banner, determine service by port
-	if result.Service == "unknown" {
-		result.Service = s.getServiceByPort(port)
-	}
+	// Banner-derived service first, then the unified port mapping (same precedence as the gogo path)
+	result.Service = core.ResolveServiceName(port, bannerService, "")
+	result.Fingerprints = s.matchServiceFingerprints(host, result)
 
 	return result
 }
 
+// matchServiceFingerprints runs the service DSL rules on the banner and certificate, returns the sorted rule names
+func (s *FingerprintScanner) matchServiceFingerprints(host string, fp *PortFingerprint) []string {
+	if s.ServiceEngine == nil || (fp.Banner == "" && fp.Certificate == nil) {
+		return nil
+	}
+	var names []string
+	for _, match := range s.ServiceEngine.AnalyzeService(NewServiceResponse(host, fp)) {
+		names = append(names, match.RuleName)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // parseServiceBanner parses service banner to identify service
-func parseServiceBanner(banner string, port int) (service, product, version string) {
+// Rules from service_banners.yaml come first, the built-in checks are the fallback
+func (s *FingerprintScanner) parseServiceBanner(banner string, port int) (service, product, version string) {
+	if service, product, version, ok := s.BannerRules.Match(banner); ok {
+		return service, product, version
+	}
+	return parseBuiltinBanner(banner, port)
+}
+
+// parseBuiltinBanner identifies common services with built-in banner checks
+func parseBuiltinBanner(banner string, port int) (service, product, version string) {
 	bannerLower := strings.ToLower(banner)
 
 	// SSH
@@ -616,7 +898,7 @@ func parseServiceBanner(banner string, port int) (service, product, version stri
 		service = "ssh"
 		parts := strings.Split(banner, "-")
 		if len(parts) >= 3 {
-			product = parts[2]
+			product = strings.TrimSpace(parts[2])
 			if idx := strings.Index(product, " "); idx > 0 {
 				version = strings.TrimSpace(product[idx:])
 				product = product[:idx]
@@ -679,7 +961,7 @@ func parseServiceBanner(banner string, port int) (service, product, version stri
 	}
 
 	// POP3
-	if strings.HasPrefix(banner, "+OK") && port == 110 {
+	if strings.HasPrefix(banner, "+OK") && (port == 110 || strings.Contains(bannerLower, "pop3")) {
 		service = "pop3"
 		return
 	}
@@ -694,75 +976,176 @@ func parseServiceBanner(banner string, port int) (service, product, version stri
 	return
 }
 
-// getCertInfo gets SSL certificate information
+// getCertInfo performs a TLS handshake on a fresh connection and returns the server certificate,
+// or nil when the port does not speak TLS
 func (s *FingerprintScanner) getCertInfo(ctx context.Context, host string, port int) *CertInfo {
-	conf := &tls.Config{
-		InsecureSkipVerify: true,
-	}
+	return fetchCertInfo(ctx, s.PortDialer, host, port, s.Timeout)
+}
+
+// GetCertInfo performs a TLS handshake with the default dialer, for callers without a scanner
+func GetCertInfo(ctx context.Context, host string, port int, timeout time.Duration) *CertInfo {
+	return fetchCertInfo(ctx, (&net.Dialer{Timeout: timeout}).DialContext, host, port, timeout)
+}
+
+// GetCertInfoWithDialer performs a TLS handshake over connections from dial, so callers can
+// apply their own resolver or proxy
+func GetCertInfoWithDialer(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), host string, port int, timeout time.Duration) *CertInfo {
+	return fetchCertInfo(ctx, dial, host, port, timeout)
+}
 
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: s.Timeout}, "tcp", fmt.Sprintf("%s:%d", host, port), conf)
+// fetchCertInfo dials host:port with dial and returns the leaf certificate after a TLS handshake
+func fetchCertInfo(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), host string, port int, timeout time.Duration) *CertInfo {
+	handshakeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rawConn, err := dial(handshakeCtx, "tcp", net.JoinHostPort(host, fmt.Sprintf("%d", port)))
 	if err != nil {
 		return nil
 	}
-	defer conn.Close()
+	defer rawConn.Close()
+
+	conf := &tls.Config{InsecureSkipVerify: true}
+	if net.ParseIP(host) == nil {
+		conf.ServerName = host
+	}
+	conn := tls.Client(rawConn, conf)
+	if err := conn.HandshakeContext(handshakeCtx); err != nil {
+		return nil
+	}
 
-	certs := conn.ConnectionState().PeerCertificates
+	return certInfoFromState(conn.ConnectionState())
+}
+
+// certInfoFromState extracts the leaf certificate of a TLS session
+func certInfoFromState(state tls.ConnectionState) *CertInfo {
+	certs := state.PeerCertificates
 	if len(certs) == 0 {
 		return nil
 	}
 
-	cert := certs[0]
+	return CertInfoFromCertificate(certs[0], time.Now())
+}
+
+// CertInfoFromCertificate describes a parsed certificate; now decides the Expired flag
+func CertInfoFromCertificate(cert *x509.Certificate, now time.Time) *CertInfo {
 	fingerprint := sha256Fingerprint(cert.Raw)
 
 	return &CertInfo{
-		Subject:     cert.Subject.String(),
-		Issuer:      cert.Issuer.String(),
-		NotBefore:   cert.NotBefore,
-		NotAfter:    cert.NotAfter,
-		SANs:        cert.DNSNames,
-		Fingerprint: fingerprint,
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SANs:               cert.DNSNames,
+		Fingerprint:        fingerprint,
+		FingerprintSHA1:    sha1Fingerprint(cert.Raw),
+		FingerprintSHA256:  fingerprint,
+		SerialNumber:       serialHex(cert),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SelfSigned:         isSelfSigned(cert),
+		Expired:            now.After(cert.NotAfter),
 	}
 }
 
-// sha256Fingerprint calculates SHA256 fingerprint
-func sha256Fingerprint(data []byte) string {
-	var h hash.Hash = md5.New() // Using MD5 for simplicity, should use SHA256 in production
-	h.Write(data)
-	return hex.EncodeToString(h.Sum(nil))
+// serialHex formats the serial number like openssl: uppercase hex padded to whole bytes
+func serialHex(cert *x509.Certificate) string {
+	if cert.SerialNumber == nil {
+		return ""
+	}
+	serial := fmt.Sprintf("%X", cert.SerialNumber)
+	if len(serial)%2 == 1 {
+		serial = "0" + serial
+	}
+	return serial
 }
 
-// getServiceByPort returns service name for a port from configuration
-func (s *FingerprintScanner) getServiceByPort(port int) string {
-	// First try from loaded configuration
-	if service, ok := s.PortServices[port]; ok {
-		return service
+// isSelfSigned reports whether the certificate is issued by its own key. The signature is checked
+// directly: CheckSignatureFrom rejects the common self-signed leaf that is not a CA
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
 	}
-	return "unknown"
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// sha256Fingerprint calculates the SHA256 fingerprint of the DER certificate (lowercase hex, no separators)
+func sha256Fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sha1Fingerprint calculates the SHA1 fingerprint of the DER certificate (lowercase hex, no separators)
+func sha1Fingerprint(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
 }
 
 // BatchScanFingerprint scans fingerprints for multiple targets
+// Each target runs with its own PerTargetTimeout. Targets are grouped by origin (resolved IP, or host
+// when unresolved) and at most MaxPerOrigin of them run against one origin at a time; an origin
+// that keeps answering 429 or resetting connections gets its share halved for the rest of the batch.
+// Once ctx is done no more targets are started, the remaining entries are returned with Skipped set
+// so results still line up with targets
 func (s *FingerprintScanner) BatchScanFingerprint(ctx context.Context, targets []string) []*FingerprintResult {
 	results := make([]*FingerprintResult, len(targets))
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, s.Concurrency)
-	var mu sync.Mutex
+	var origins *core.OriginLimiter
+	if s.MaxPerOrigin > 0 {
+		origins = core.NewOriginLimiter(s.MaxPerOrigin)
+		origins.SetBackoff(0, s.OriginBackoff)
+	}
 
 	for i, target := range targets {
 		wg.Add(1)
-		semaphore <- struct{}{}
-
+		// Each goroutine writes only its own index
 		go func(idx int, t string) {
 			defer wg.Done()
-			defer func() { <-semaphore }()
 
-			result := s.ScanFingerprint(ctx, t)
+			// Wait for the origin first so targets of a busy origin don't hold global slots
+			origin := ""
+			if origins != nil {
+				origin = origins.Origin(ctx, t)
+			}
+			release, ok := origins.Acquire(ctx, origin)
+			if !ok {
+				results[idx] = skippedResult(t, ctx.Err())
+				return
+			}
+			defer release()
+
+			select {
+			case <-ctx.Done():
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			}
+			if ctx.Err() != nil {
+				results[idx] = skippedResult(t, ctx.Err())
+				return
+			}
 
-			mu.Lock()
+			targetCtx := ctx
+			if s.PerTargetTimeout > 0 {
+				var cancel context.CancelFunc
+				targetCtx, cancel = context.WithTimeout(ctx, s.PerTargetTimeout)
+				defer cancel()
+			}
+			result := s.ScanFingerprint(targetCtx, t)
+			origins.Observe(origin, result.StatusCode, result.Error)
 			results[idx] = result
-			mu.Unlock()
 		}(i, target)
 	}
 
 	wg.Wait()
 	return results
 }
+
+// skippedResult is the placeholder for a target that was never scanned
+func skippedResult(target string, err error) *FingerprintResult {
+	return &FingerprintResult{
+		Target:       target,
+		Fingerprints: make([]Fingerprint, 0),
+		Technologies: make([]string, 0),
+		Error:        err.Error(),
+		Skipped:      true,
+	}
+}
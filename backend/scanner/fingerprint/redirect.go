@@ -0,0 +1,86 @@
+package fingerprint
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedirectHop is one redirect response on the way to the fingerprinted page
+type RedirectHop struct {
+	URL        string `json:"url"`                // Requested URL
+	StatusCode int    `json:"status_code"`        // Redirect status returned for URL
+	Location   string `json:"location,omitempty"` // Absolute target of the redirect
+}
+
+// checkRedirect stops following after MaxRedirects hops and, unless FollowForeignRedirects
+// is set, at the first hop that leaves the original host. The redirect response itself is
+// then fingerprinted, so a login portal on a CDN does not show up in the asset's technologies.
+func (s *FingerprintScanner) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > s.MaxRedirects {
+		return http.ErrUseLastResponse
+	}
+	if !s.FollowForeignRedirects && !sameHost(via[0].URL.Hostname(), req.URL.Hostname()) {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// applyRedirects records the redirect chain that led to resp, the URL of the page that was
+// fingerprinted and whether any hop, followed or not, pointed to another host
+func applyRedirects(result *FingerprintResult, resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	var chain []RedirectHop
+	// A redirect that was not followed is the last hop of the chain
+	if location, err := resp.Location(); err == nil && isRedirect(resp.StatusCode) {
+		chain = append(chain, RedirectHop{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Location: location.String()})
+	}
+	// Each followed redirect is kept on the request it triggered
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		prev := req.Response
+		chain = append(chain, RedirectHop{URL: prev.Request.URL.String(), StatusCode: prev.StatusCode, Location: req.URL.String()})
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	result.FinalURL = resp.Request.URL.String()
+	result.RedirectChain = chain
+	if len(chain) == 0 {
+		return
+	}
+	origin := hostOf(chain[0].URL)
+	for _, hop := range chain {
+		if !sameHost(origin, hostOf(hop.Location)) {
+			result.CrossOriginRedirect = true
+			break
+		}
+	}
+}
+
+// isRedirect reports whether code is a redirect status that carries a Location
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// hostOf returns the host name of an absolute URL without the port
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// sameHost compares host names case-insensitively; ports and schemes are ignored so that
+// http -> https upgrades on the same host are not reported as cross-origin
+func sameHost(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
@@ -0,0 +1,107 @@
+package fingerprint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"moongazing/scanner/core"
+)
+
+// ErrRetriesExhausted wraps the last transient error once every attempt of a fetch failed,
+// so callers can tell "gave up after transient errors" from a definitive failure
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryPolicy controls retries of page and favicon fetches. Only transient network errors
+// (timeouts, connection refused or reset, temporary DNS failures) are retried; any HTTP
+// response, including 4xx and 5xx, is returned as is.
+type RetryPolicy struct {
+	Attempts   int           // Max requests per URL including the first, <= 1 disables retries
+	Backoff    time.Duration // Delay before the first retry, doubled for each following one
+	MaxBackoff time.Duration // Upper bound of the delay, 0 means no bound
+}
+
+// DefaultRetryPolicy returns the retry policy used by NewFingerprintScanner
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:   core.FingerprintRetryAttempts,
+		Backoff:    core.FingerprintRetryBackoff,
+		MaxBackoff: core.FingerprintRetryMaxBackoff,
+	}
+}
+
+// delay returns the wait before attempt n (n >= 2)
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.Backoff
+	for i := 2; i < n; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// errServerClosedIdle message of the unexported net/http error for a connection closed by the server before the response
+const errServerClosedIdle = "http: server closed idle connection"
+
+// IsTransientError reports whether err is a network error worth retrying. Slow responses
+// are not retried: the host is already excluded for the rest of the task.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, ErrSlowResponse) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// Connection closed by the server before or while sending the response. A connection the
+	// server closes right after accepting it is reported by net/http as an idle connection
+	// closed by the server; the error is not exported, so it is matched by its message
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), errServerClosedIdle) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// fetchWithRetry calls fetch until it succeeds, fails with a non-transient error, the
+// context is done or s.Retry.Attempts is reached. It returns the number of requests sent;
+// when every attempt failed with a transient error the error wraps ErrRetriesExhausted.
+func (s *FingerprintScanner) fetchWithRetry(req *http.Request, limit int64, check bodyCheck) (*http.Response, []byte, int, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, body, err := s.fetch(req.Clone(ctx), limit, check)
+		if err == nil || !IsTransientError(err) || ctx.Err() != nil {
+			return resp, body, attempt, err
+		}
+		if attempt >= s.Retry.Attempts {
+			if attempt > 1 {
+				err = fmt.Errorf("%w after %d attempts: %w", ErrRetriesExhausted, attempt, err)
+			}
+			return resp, body, attempt, err
+		}
+
+		timer := time.NewTimer(s.Retry.delay(attempt + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, body, attempt, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package fingerprint
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"moongazing/config"
+	"moongazing/scanner/core"
+)
+
+// Rule files are looked up in the dictionary directory set with config.SetDictBasePath (scanner.dict_path,
+// MOONGAZING_DICT_PATH), or in the directory given to NewFingerprintScannerWithRules.
+// finger.yaml, jslib.yaml, ports.yaml, favicon.yaml, service_finger.yaml and waf.yaml fall back to the copies embedded in the binary.
+
+// dslRuleFileNames DSL rule files in a rules directory, later files take precedence
+var dslRuleFileNames = []string{"finger.yaml", "sensitive.yaml"}
+
+// dslRuleFiles returns the DSL rule files found in dir, embedded copies included
+func dslRuleFiles(dir string) []string {
+	var files []string
+	for _, name := range dslRuleFileNames {
+		path := config.ResolveDictFile(dir, name)
+		if config.IsEmbeddedDict(path) || core.FileExists(path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// RulesLoadSummary lists the rule files a scanner loaded and how many entries each contributed
+type RulesLoadSummary struct {
+	Dir   string            `json:"dir"`
+	Files []RuleFileSummary `json:"files"`
+}
+
+// RuleFileSummary load result of one rule file
+type RuleFileSummary struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`               // File path, or embedded:<name> for the copy built into the binary
+	Embedded bool   `json:"embedded,omitempty"` // The file was missing from the directory and the embedded copy was used
+	Loaded   int    `json:"loaded"`             // Rules, patterns or mappings loaded from the file
+	Skipped  int    `json:"skipped,omitempty"`  // Invalid entries skipped
+	Error    string `json:"error,omitempty"`    // Why the file could not be loaded
+}
+
+// File returns the summary of the named file, nil when it was not part of the load
+func (s *RulesLoadSummary) File(name string) *RuleFileSummary {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Files {
+		if s.Files[i].Name == name {
+			return &s.Files[i]
+		}
+	}
+	return nil
+}
+
+// Errors returns the files that could not be loaded as "name: error"
+func (s *RulesLoadSummary) Errors() []string {
+	if s == nil {
+		return nil
+	}
+	var errs []string
+	for _, f := range s.Files {
+		if f.Error != "" {
+			errs = append(errs, f.Name+": "+f.Error)
+		}
+	}
+	return errs
+}
+
+// HasErrors reports whether any rule file could not be loaded
+func (s *RulesLoadSummary) HasErrors() bool {
+	return len(s.Errors()) > 0
+}
+
+func (s *RulesLoadSummary) add(name, path string, loaded, skipped int, err error) {
+	file := RuleFileSummary{
+		Name:     name,
+		Path:     path,
+		Embedded: config.IsEmbeddedDict(path),
+		Loaded:   loaded,
+		Skipped:  skipped,
+	}
+	if err != nil {
+		file.Error = err.Error()
+	}
+	s.Files = append(s.Files, file)
+}
+
+// addDSL records the DSL rule files of dir using the engine's rule sources and last validation report
+func (s *RulesLoadSummary) addDSL(engine *DSLEngine, dir string) {
+	type dslFile struct{ name, path string }
+	var files []dslFile
+	for _, name := range dslRuleFileNames {
+		files = append(files, dslFile{name, config.ResolveDictFile(dir, name)})
+	}
+	if custom := CustomRulesFile(); engine == defaultEngine && core.FileExists(custom) {
+		files = append(files, dslFile{filepath.Base(custom), custom})
+	}
+
+	counts := engine.SourceCounts()
+	report := engine.ValidationReport()
+	for _, f := range files {
+		var err error
+		skipped := 0
+		if !config.IsEmbeddedDict(f.path) && !core.FileExists(f.path) {
+			err = fmt.Errorf("%s not found in %s", f.name, dir)
+		}
+		for _, e := range report.Errors {
+			if e.File != f.path {
+				continue
+			}
+			if e.Rule != "" {
+				skipped++
+			} else if err == nil {
+				err = fmt.Errorf("%s", e.Error)
+			}
+		}
+		s.add(f.name, f.path, counts[f.path], skipped, err)
+	}
+}
+
+// DefaultRulesSummary load summary of the rule files in the configured dictionary directory
+func DefaultRulesSummary() *RulesLoadSummary {
+	return NewFingerprintScanner(1).RulesSummary
+}
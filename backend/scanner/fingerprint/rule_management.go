@@ -0,0 +1,424 @@
+package fingerprint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/core"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 指纹规则管理
+// 用户提交的规则保存在单独的 custom-rules.yaml 中，升级替换内置规则文件时不会丢失；加载时排在内置规则之后，
+// 同名规则以自定义规则为准。提交前可以校验规则（静态检查 + 用合成响应试运行 DSL），也可以对任意 URL 试运行。
+// 规则文件修改后由管理员触发重新加载，或由 WatchDefaultRules 检查到文件变化后自动重新加载
+
+// DefaultCustomRulesFile 自定义规则文件的默认位置
+const DefaultCustomRulesFile = "data/custom-rules.yaml"
+
+// ErrRuleNotFound 规则不存在
+var ErrRuleNotFound = errors.New("fingerprint rule not found")
+
+var (
+	customRulesMu   sync.Mutex // 串行化自定义规则文件的读写
+	customRulesPath = DefaultCustomRulesFile
+)
+
+// SetCustomRulesFile 设置自定义规则文件，为空时使用 DefaultCustomRulesFile，需在加载规则之前调用
+func SetCustomRulesFile(path string) {
+	customRulesMu.Lock()
+	defer customRulesMu.Unlock()
+	if path == "" {
+		path = DefaultCustomRulesFile
+	}
+	customRulesPath = path
+}
+
+// CustomRulesFile 自定义规则文件路径
+func CustomRulesFile() string {
+	customRulesMu.Lock()
+	defer customRulesMu.Unlock()
+	return customRulesPath
+}
+
+// RuleDefinition 规则的 API 表示，用于列出、校验、试运行和提交规则
+type RuleDefinition struct {
+	Name         string   `json:"name"`
+	DSL          []string `json:"dsl"`
+	Condition    string   `json:"condition,omitempty"`
+	Category     string   `json:"category,omitempty"`
+	Tags         string   `json:"tags,omitempty"`
+	Path         []string `json:"path,omitempty"`
+	Header       string   `json:"header,omitempty"`
+	VersionRegex string   `json:"version_regex,omitempty"`
+	Source       string   `json:"source,omitempty"` // 规则所在文件
+	Custom       bool     `json:"custom"`           // 是否为用户提交的规则
+}
+
+// NewRuleDefinition 由已加载的规则构建 API 表示
+func NewRuleDefinition(rule *FingerprintRule) RuleDefinition {
+	return RuleDefinition{
+		Name:         rule.Name,
+		DSL:          append([]string{}, rule.DSL...),
+		Condition:    rule.Condition,
+		Category:     rule.Category,
+		Tags:         rule.Tags,
+		Path:         append([]string(nil), rule.Path...),
+		Header:       rule.Header,
+		VersionRegex: rule.VersionRegex,
+	}
+}
+
+// Rule 转换为引擎使用的规则，condition 为空时为 or
+func (d *RuleDefinition) Rule() *FingerprintRule {
+	condition := d.Condition
+	if condition == "" {
+		condition = "or"
+	}
+	return &FingerprintRule{
+		ID:           d.Name,
+		Name:         d.Name,
+		DSL:          append(StringList{}, d.DSL...),
+		Condition:    condition,
+		Category:     d.Category,
+		Tags:         d.Tags,
+		Path:         append(StringList(nil), d.Path...),
+		Header:       d.Header,
+		VersionRegex: d.VersionRegex,
+	}
+}
+
+// RuleDefinitions 列出已加载的规则，按名称排序
+func (e *DSLEngine) RuleDefinitions() []RuleDefinition {
+	custom := filepath.Clean(CustomRulesFile())
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	defs := make([]RuleDefinition, 0, len(e.Rules))
+	for name, rule := range e.Rules {
+		def := NewRuleDefinition(rule)
+		def.Source = e.sources[name]
+		def.Custom = def.Source != "" && filepath.Clean(def.Source) == custom
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// RuleDefinition 按名称获取已加载的规则
+func (e *DSLEngine) RuleDefinition(name string) (RuleDefinition, bool) {
+	custom := filepath.Clean(CustomRulesFile())
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rule, ok := e.Rules[name]
+	if !ok {
+		return RuleDefinition{}, false
+	}
+	def := NewRuleDefinition(rule)
+	def.Source = e.sources[name]
+	def.Custom = def.Source != "" && filepath.Clean(def.Source) == custom
+	return def, true
+}
+
+// newSingleRuleEngine 只包含一条规则的引擎，用于校验和试运行，不影响共享规则
+func newSingleRuleEngine(rule *FingerprintRule) *DSLEngine {
+	engine := NewDSLEngine()
+	engine.Rules[rule.Name] = rule
+	engine.compiled = compileRules(engine.Rules)
+	return engine
+}
+
+// syntheticResponse 试运行 DSL 使用的合成响应，包含各 DSL 函数会读取的字段
+func syntheticResponse() *HTTPResponse {
+	return &HTTPResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Server":       "nginx",
+			"Content-Type": "text/html; charset=utf-8",
+			"Set-Cookie":   "session=test; Path=/",
+		},
+		Body:     `<html><head><title>Test Page</title><meta name="generator" content="test"></head><body>test</body></html>`,
+		Title:    "Test Page",
+		URL:      "http://example.com/",
+		IconHash: "0",
+		IconMD5:  "d41d8cd98f00b204e9800998ecf8427e",
+		Cookies:  map[string]string{"session": "test"},
+	}
+}
+
+// CheckRule 校验规则：名称不能为空，ValidateRule 的静态检查（DSL 语法、正则可编译等），
+// 再用合成响应试运行每个 DSL 表达式，返回发现的全部问题
+func CheckRule(def *RuleDefinition) []string {
+	var problems []string
+	if strings.TrimSpace(def.Name) == "" {
+		problems = append(problems, "name is empty")
+	}
+	rule := def.Rule()
+	problems = append(problems, ValidateRule(rule)...)
+	if len(problems) > 0 {
+		return problems
+	}
+
+	engine := newSingleRuleEngine(rule)
+	resp := syntheticResponse()
+	for i, dsl := range rule.DSL {
+		if err := dryRun(func() { engine.evaluateDSL(dsl, resp) }); err != nil {
+			problems = append(problems, fmt.Sprintf("dsl[%d] %q: %v", i, dsl, err))
+		}
+	}
+	if err := dryRun(func() { engine.matchRule(resp, rule) }); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// dryRun 执行试运行，把 panic 转换为错误
+func dryRun(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("evaluation failed: %v", r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// InvalidRuleError 提交的规则未通过校验
+type InvalidRuleError struct {
+	Problems []string
+}
+
+func (e *InvalidRuleError) Error() string {
+	return "invalid fingerprint rule: " + strings.Join(e.Problems, "; ")
+}
+
+// DSLResult 单个 DSL 表达式的试运行结果
+type DSLResult struct {
+	DSL     string `json:"dsl"`
+	Matched bool   `json:"matched"`
+}
+
+// RuleTestResult 规则试运行结果
+type RuleTestResult struct {
+	URL         string            `json:"url"`
+	StatusCode  int               `json:"status_code"`
+	Title       string            `json:"title"`
+	Matched     bool              `json:"matched"`
+	Match       *FingerprintMatch `json:"match,omitempty"`
+	Expressions []DSLResult       `json:"expressions"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// TestRule 对响应试运行单条规则，返回规则是否匹配及每个 DSL 表达式的结果
+func TestRule(rule *FingerprintRule, resp *HTTPResponse) *RuleTestResult {
+	engine := newSingleRuleEngine(rule)
+	result := &RuleTestResult{URL: resp.URL, StatusCode: resp.StatusCode, Title: resp.Title, Expressions: []DSLResult{}}
+	for _, dsl := range rule.DSL {
+		result.Expressions = append(result.Expressions, DSLResult{DSL: dsl, Matched: engine.evaluateDSL(dsl, resp)})
+	}
+	result.Match = engine.matchRule(resp, rule)
+	result.Matched = result.Match != nil
+	return result
+}
+
+// TestRuleOnURL 获取目标页面（含 favicon 和 Cookie）后试运行规则，获取失败时结果中带错误信息
+func (s *FingerprintScanner) TestRuleOnURL(ctx context.Context, rule *FingerprintRule, target string) *RuleTestResult {
+	url := target
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + target
+	}
+	failed := func(err error) *RuleTestResult {
+		return &RuleTestResult{URL: url, Expressions: []DSLResult{}, Error: err.Error()}
+	}
+
+	userAgent := s.UserAgents.Next()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return failed(err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", pageAccept)
+	resp, body, _, err := s.fetchWithRetry(req, maxBodySize, nil)
+	if err != nil {
+		return failed(err)
+	}
+
+	headers := make(map[string]string)
+	for key, values := range resp.Header {
+		headers[key] = strings.Join(values, ", ")
+	}
+	bodyStr := DecodeBody(body, resp.Header.Get("Content-Type"))
+	dslResp := &HTTPResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    headers,
+		Body:       bodyStr,
+		Title:      ExtractPageTitle(bodyStr),
+		URL:        resp.Request.URL.String(),
+		Cookies:    ParseSetCookies(resp.Header.Values("Set-Cookie")),
+	}
+	dslResp.IconHash, dslResp.IconMD5, _ = s.getFaviconHash(ctx, resp.Request.URL, body, userAgent)
+	return TestRule(rule, dslResp)
+}
+
+// customRule 自定义规则文件中的规则，字段与 finger.yaml 相同
+type customRule struct {
+	DSL          StringList `yaml:"dsl"`
+	Condition    string     `yaml:"condition,omitempty"`
+	Category     string     `yaml:"category,omitempty"`
+	Tags         string     `yaml:"tags,omitempty"`
+	Path         StringList `yaml:"path,omitempty"`
+	Header       string     `yaml:"header,omitempty"`
+	VersionRegex string     `yaml:"version_regex,omitempty"`
+}
+
+// readCustomRules 读取自定义规则文件，文件不存在时返回空集合（调用方持有 customRulesMu）
+func readCustomRules(path string) (map[string]customRule, error) {
+	rules := make(map[string]customRule)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML %s: %w", path, err)
+	}
+	if rules == nil {
+		rules = make(map[string]customRule)
+	}
+	return rules, nil
+}
+
+// writeCustomRules 写入自定义规则文件，先写临时文件再替换，写入中途失败不会损坏原文件（调用方持有 customRulesMu）
+func writeCustomRules(path string, rules map[string]customRule) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	data = append([]byte("# Custom fingerprint rules submitted through the API, loaded after the built-in rules\n"), data...)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".custom-rules-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SaveCustomRule 校验规则后写入自定义规则文件（同名时覆盖），然后重新加载共享规则
+// 校验失败时返回 *InvalidRuleError，文件不变
+func SaveCustomRule(def *RuleDefinition) (*RuleValidationReport, error) {
+	if problems := CheckRule(def); len(problems) > 0 {
+		return nil, &InvalidRuleError{Problems: problems}
+	}
+
+	customRulesMu.Lock()
+	path := customRulesPath
+	rules, err := readCustomRules(path)
+	if err == nil {
+		rules[def.Name] = customRule{
+			DSL:          append(StringList{}, def.DSL...),
+			Condition:    def.Condition,
+			Category:     def.Category,
+			Tags:         def.Tags,
+			Path:         append(StringList(nil), def.Path...),
+			Header:       def.Header,
+			VersionRegex: def.VersionRegex,
+		}
+		err = writeCustomRules(path, rules)
+	}
+	customRulesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return ReloadDefaultRules()
+}
+
+// DeleteCustomRule 从自定义规则文件中删除规则并重新加载共享规则，规则不在该文件中时返回 ErrRuleNotFound
+func DeleteCustomRule(name string) (*RuleValidationReport, error) {
+	customRulesMu.Lock()
+	path := customRulesPath
+	rules, err := readCustomRules(path)
+	if err == nil {
+		if _, ok := rules[name]; !ok {
+			err = ErrRuleNotFound
+		} else {
+			delete(rules, name)
+			err = writeCustomRules(path, rules)
+		}
+	}
+	customRulesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return ReloadDefaultRules()
+}
+
+// ruleFiles 共享规则的全部文件：内置规则文件，存在时再加上自定义规则文件（排在最后，同名规则以它为准）
+func ruleFiles() []string {
+	files := defaultRuleFiles()
+	if custom := CustomRulesFile(); core.FileExists(custom) {
+		files = append(files, custom)
+	}
+	return files
+}
+
+// ruleFilesState 规则文件的大小和修改时间，用于检查文件变化
+func ruleFilesState() string {
+	var sb strings.Builder
+	for _, file := range append(defaultRuleFiles(), CustomRulesFile()) {
+		sb.WriteString(file)
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&sb, "|%d|%d", info.Size(), info.ModTime().UnixNano())
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// WatchDefaultRules 按 interval 检查规则文件（含自定义规则文件）是否变化，变化时重新加载共享规则，ctx 取消时返回
+func WatchDefaultRules(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ruleFilesState()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			state := ruleFilesState()
+			if state == last {
+				continue
+			}
+			last = state
+			log.Printf("[Fingerprint] Rule files changed, reloading")
+			ReloadDefaultRules()
+		}
+	}
+}
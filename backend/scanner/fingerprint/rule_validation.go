@@ -0,0 +1,285 @@
+package fingerprint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"moongazing/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 指纹规则校验
+// 加载规则文件时逐条校验：DSL 不能为空、函数名可识别且参数可解析、condition 合法、
+// category 属于已知分类、正则可编译、version_regex 带捕获组。校验结果汇总为报告，规则作者修改 finger.yaml 后可以立即看到问题，
+// 而不是几周后才发现识别率下降
+
+// KnownCategories 已知的指纹分类
+var KnownCategories = map[string]bool{
+	"API": true, "CDN": true, "CI/CD": true, "CMS": true, "Camera": true, "Config": true,
+	"Container": true, "Database": true, "DevOps": true, "ERP": true, "Firewall": true,
+	"Framework": true, "JavaScript": true, "Language": true, "LoadBalancer": true, "Mail": true,
+	"MessageQueue": true, "Middleware": true, "Monitoring": true, "Network": true, "OA": true,
+	"OS": true, "Panel": true, "ProjectManagement": true, "Registry": true, "Security": true,
+	"Sensitive": true, "Storage": true, "Virtualization": true, "WAF": true, "WebServer": true,
+	"Wiki": true,
+}
+
+// dslMinArgs 支持的 DSL 函数及最少参数个数
+var dslMinArgs = map[string]int{
+	"contains":     2,
+	"contains_all": 2,
+	"contains_any": 2,
+	"title":        1,
+	"icon":         2,
+	"status":       1,
+	"regex":        2,
+	"header":       1,
+	"cookie":       1,
+	"meta":         2,
+	// 非 Web 服务指纹（service_finger.yaml）
+	"banner":       1,
+	"cert_subject": 1,
+	"cert_issuer":  1,
+	"cert_san":     1,
+	"port":         1,
+	"protocol":     1,
+}
+
+// dslContentSources contains 系列函数支持的匹配对象
+var dslContentSources = map[string]bool{
+	"body": true, "header": true, "headers": true, "title": true, "server": true, "url": true,
+	"banner": true, "cert_subject": true, "cert_issuer": true, "cert_san": true, "protocol": true,
+}
+
+// RuleError 单条规则的校验错误
+type RuleError struct {
+	File  string `json:"file"`
+	Rule  string `json:"rule,omitempty"` // 为空表示文件级错误
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error"`
+}
+
+// RuleValidationReport 规则加载校验报告
+type RuleValidationReport struct {
+	Strict   bool        `json:"strict"`
+	Files    []string    `json:"files"`
+	Loaded   int         `json:"loaded"`  // 通过校验并加载的规则数
+	Skipped  int         `json:"skipped"` // 校验失败未加载的规则数
+	Errors   []RuleError `json:"errors"`
+	LoadedAt time.Time   `json:"loaded_at"`
+}
+
+func newRuleValidationReport(strict bool) *RuleValidationReport {
+	return &RuleValidationReport{Strict: strict, Files: []string{}, Errors: []RuleError{}, LoadedAt: time.Now()}
+}
+
+// HasErrors 是否存在校验错误
+func (r *RuleValidationReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// merge 合并另一个文件的报告
+func (r *RuleValidationReport) merge(other *RuleValidationReport) {
+	r.Files = append(r.Files, other.Files...)
+	r.Loaded += other.Loaded
+	r.Skipped += other.Skipped
+	r.Errors = append(r.Errors, other.Errors...)
+	r.LoadedAt = other.LoadedAt
+}
+
+func (r *RuleValidationReport) clone() *RuleValidationReport {
+	c := *r
+	c.Files = append([]string{}, r.Files...)
+	c.Errors = append([]RuleError{}, r.Errors...)
+	return &c
+}
+
+// RuleValidationError 严格模式下规则文件存在校验错误
+type RuleValidationError struct {
+	Report *RuleValidationReport
+}
+
+func (e *RuleValidationError) Error() string {
+	if len(e.Report.Errors) == 0 {
+		return "invalid fingerprint rules"
+	}
+	first := e.Report.Errors[0]
+	return fmt.Sprintf("%d invalid fingerprint rules, first: %s %s: %s", len(e.Report.Errors), first.File, first.Rule, first.Error)
+}
+
+// parseRulesFile 解析并校验规则文件，返回通过校验的规则和校验报告
+// 读取或 YAML 语法错误返回 error；单条规则的问题记录在报告中
+func parseRulesFile(filePath string) (map[string]*FingerprintRule, *RuleValidationReport, error) {
+	data, err := config.ReadDictFile(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	// 先解析为节点，单条规则结构错误不影响其他规则，并能报告行号
+	var nodes map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse YAML %s: %w", filePath, err)
+	}
+
+	report := newRuleValidationReport(false)
+	report.Files = append(report.Files, filePath)
+	rules := make(map[string]*FingerprintRule)
+	if len(nodes) == 0 {
+		report.Errors = append(report.Errors, RuleError{File: filePath, Error: "no rules found in file"})
+		return rules, report, nil
+	}
+
+	for name, node := range nodes {
+		fail := func(format string, args ...interface{}) {
+			report.Skipped++
+			report.Errors = append(report.Errors, RuleError{File: filePath, Rule: name, Line: node.Line, Error: fmt.Sprintf(format, args...)})
+		}
+
+		if node.Tag == "!!null" {
+			fail("rule is empty")
+			continue
+		}
+		var rule FingerprintRule
+		if err := node.Decode(&rule); err != nil {
+			fail("invalid rule structure: %v", err)
+			continue
+		}
+		if problems := ValidateRule(&rule); len(problems) > 0 {
+			fail("%s", strings.Join(problems, "; "))
+			continue
+		}
+
+		rule.ID = name
+		rule.Name = name
+		if rule.Condition == "" {
+			rule.Condition = "or"
+		}
+		rules[name] = &rule
+		report.Loaded++
+	}
+
+	sort.Slice(report.Errors, func(i, j int) bool {
+		if report.Errors[i].Line != report.Errors[j].Line {
+			return report.Errors[i].Line < report.Errors[j].Line
+		}
+		return report.Errors[i].Rule < report.Errors[j].Rule
+	})
+	return rules, report, nil
+}
+
+// ValidateRule 校验单条规则，返回发现的全部问题
+func ValidateRule(rule *FingerprintRule) []string {
+	if rule == nil {
+		return []string{"rule is empty"}
+	}
+
+	var problems []string
+	if len(rule.DSL) == 0 {
+		problems = append(problems, "dsl is empty")
+	}
+	switch strings.ToLower(rule.Condition) {
+	case "", "and", "or":
+	default:
+		problems = append(problems, fmt.Sprintf("invalid condition %q, expected and/or", rule.Condition))
+	}
+	if rule.Category != "" && !KnownCategories[rule.Category] {
+		problems = append(problems, fmt.Sprintf("unknown category %q", rule.Category))
+	}
+	for i, dsl := range rule.DSL {
+		if err := validateDSL(dsl); err != nil {
+			problems = append(problems, fmt.Sprintf("dsl[%d] %q: %v", i, dsl, err))
+		}
+	}
+	if rule.VersionRegex != "" {
+		if err := validateVersionRegex(rule.VersionRegex); err != nil {
+			problems = append(problems, fmt.Sprintf("version_regex %q: %v", rule.VersionRegex, err))
+		}
+	}
+	return problems
+}
+
+// validateVersionRegex 版本正则必须可编译，并且至少有一个捕获组
+func validateVersionRegex(pattern string) error {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regex: %v", err)
+	}
+	if re.NumSubexp() == 0 {
+		return fmt.Errorf("regex has no capture group for the version")
+	}
+	return nil
+}
+
+// validateDSL 试解析单个 DSL 表达式
+func validateDSL(dsl string) error {
+	dsl = strings.TrimSpace(dsl)
+	if dsl == "" {
+		return fmt.Errorf("empty expression")
+	}
+	idx := strings.Index(dsl, "(")
+	if idx <= 0 || !strings.HasSuffix(dsl, ")") {
+		return fmt.Errorf("malformed expression, expected func(args)")
+	}
+	name := dsl[:idx]
+	minArgs, ok := dslMinArgs[name]
+	if !ok {
+		return fmt.Errorf("unknown function %s", name)
+	}
+	if err := checkQuotes(dsl[idx+1 : len(dsl)-1]); err != nil {
+		return err
+	}
+
+	args := parseDSLArgs(dsl, name)
+	if len(args) < minArgs {
+		return fmt.Errorf("%s requires at least %d arguments, got %d", name, minArgs, len(args))
+	}
+
+	switch name {
+	case "contains", "contains_all", "contains_any":
+		source := strings.ToLower(strings.Trim(args[0], "'\""))
+		if !dslContentSources[source] {
+			return fmt.Errorf("unknown match target %q", source)
+		}
+	case "status":
+		for _, arg := range args {
+			if _, err := strconv.Atoi(strings.TrimSpace(arg)); err != nil {
+				return fmt.Errorf("invalid status code %q", arg)
+			}
+		}
+	case "port":
+		for _, arg := range args {
+			if port, err := strconv.Atoi(strings.TrimSpace(arg)); err != nil || port <= 0 || port > 65535 {
+				return fmt.Errorf("invalid port %q", arg)
+			}
+		}
+	case "regex":
+		pattern := strings.Trim(args[1], "'\"")
+		if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+			return fmt.Errorf("invalid regex: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkQuotes 检查参数中的引号是否闭合
+func checkQuotes(content string) error {
+	quote := byte(0)
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote != 0 && c == quote:
+			quote = 0
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("unterminated quote")
+	}
+	return nil
+}
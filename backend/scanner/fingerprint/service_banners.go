@@ -0,0 +1,183 @@
+package fingerprint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"moongazing/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Banner match types
+const (
+	BannerMatchPrefix    = "prefix"
+	BannerMatchContains  = "contains"
+	BannerMatchRegex     = "regex"
+	BannerMatchHexPrefix = "hex-prefix"
+)
+
+// ServiceBannerRule identifies a non-HTTP service from the first bytes it sends,
+// either unprompted or in reply to a probe
+type ServiceBannerRule struct {
+	Name    string `yaml:"name"`
+	Service string `yaml:"service"`
+	Product string `yaml:"product"`
+	Match   string `yaml:"match"`   // prefix, contains, regex or hex-prefix
+	Pattern string `yaml:"pattern"` // hex-prefix patterns may contain spaces
+	Version string `yaml:"version"` // Regex whose first group is the version; regex rules fall back to their own first group
+
+	pattern *regexp.Regexp
+	version *regexp.Regexp
+	prefix  string // decoded hex-prefix pattern
+}
+
+// ServiceProbe is a payload sent to ports that stay silent after connecting
+type ServiceProbe struct {
+	Name    string `yaml:"name"`
+	Ports   []int  `yaml:"ports"`
+	Send    string `yaml:"send"`
+	SendHex string `yaml:"send_hex"` // Binary payloads, takes precedence over Send
+}
+
+// ServiceBannerRules holds the banner rules and probes loaded from service_banners.yaml
+type ServiceBannerRules struct {
+	Rules  []*ServiceBannerRule
+	probes map[int][]byte
+}
+
+// LoadServiceBannerRules loads banner rules from a YAML file
+// Invalid rules and probes are skipped with a warning, like jslib.yaml patterns
+func LoadServiceBannerRules(path string) (*ServiceBannerRules, error) {
+	data, err := config.ReadDictFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		Rules  []*ServiceBannerRule `yaml:"rules"`
+		Probes []ServiceProbe       `yaml:"probes"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	rules := &ServiceBannerRules{probes: make(map[int][]byte)}
+	for _, rule := range raw.Rules {
+		if err := rule.compile(); err != nil {
+			fmt.Printf("Warning: invalid service banner rule %s: %v\n", rule.Name, err)
+			continue
+		}
+		rules.Rules = append(rules.Rules, rule)
+	}
+	for _, probe := range raw.Probes {
+		payload := []byte(probe.Send)
+		if probe.SendHex != "" {
+			payload, err = decodeHexPattern(probe.SendHex)
+			if err != nil {
+				fmt.Printf("Warning: invalid service probe %s: %v\n", probe.Name, err)
+				continue
+			}
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		for _, port := range probe.Ports {
+			rules.probes[port] = payload
+		}
+	}
+	return rules, nil
+}
+
+// compile validates the rule and prepares its matchers
+func (r *ServiceBannerRule) compile() error {
+	if r.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+
+	var err error
+	switch r.Match {
+	case BannerMatchPrefix, BannerMatchContains:
+	case BannerMatchRegex:
+		if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return err
+		}
+	case BannerMatchHexPrefix:
+		decoded, err := decodeHexPattern(r.Pattern)
+		if err != nil {
+			return err
+		}
+		r.prefix = string(decoded)
+	default:
+		return fmt.Errorf("unknown match type %q", r.Match)
+	}
+
+	if r.Version != "" {
+		if r.version, err = regexp.Compile(r.Version); err != nil {
+			return fmt.Errorf("version: %w", err)
+		}
+	} else if r.pattern != nil && r.pattern.NumSubexp() > 0 {
+		r.version = r.pattern
+	}
+	return nil
+}
+
+// matches reports whether the banner satisfies the rule pattern
+func (r *ServiceBannerRule) matches(banner string) bool {
+	switch r.Match {
+	case BannerMatchPrefix:
+		return strings.HasPrefix(banner, r.Pattern)
+	case BannerMatchContains:
+		return strings.Contains(banner, r.Pattern)
+	case BannerMatchRegex:
+		return r.pattern.MatchString(banner)
+	case BannerMatchHexPrefix:
+		return strings.HasPrefix(banner, r.prefix)
+	}
+	return false
+}
+
+// Match returns the service, product and version of the first matching rule
+func (rs *ServiceBannerRules) Match(banner string) (service, product, version string, ok bool) {
+	if rs == nil || banner == "" {
+		return "", "", "", false
+	}
+	for _, rule := range rs.Rules {
+		if !rule.matches(banner) {
+			continue
+		}
+		if rule.version != nil {
+			if m := rule.version.FindStringSubmatch(banner); len(m) > 1 {
+				version = m[1]
+			}
+		}
+		return rule.Service, rule.Product, version, true
+	}
+	return "", "", "", false
+}
+
+// Probe returns the payload to send to a silent port, nil when the port has none
+func (rs *ServiceBannerRules) Probe(port int) []byte {
+	if rs == nil {
+		return nil
+	}
+	return rs.probes[port]
+}
+
+// RulesCount returns the number of loaded banner rules
+func (rs *ServiceBannerRules) RulesCount() int {
+	if rs == nil {
+		return 0
+	}
+	return len(rs.Rules)
+}
+
+// decodeHexPattern decodes a hex string, ignoring spaces between bytes
+func decodeHexPattern(s string) ([]byte, error) {
+	return hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+}
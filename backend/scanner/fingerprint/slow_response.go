@@ -0,0 +1,114 @@
+package fingerprint
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrSlowResponse is returned when a target exceeds the first-byte or body-read deadline
+var ErrSlowResponse = errors.New("slow response")
+
+// maxBodySize caps the bytes read from a page or favicon body
+const maxBodySize = 1024 * 1024
+
+// fetch sends req and reads up to limit bytes of the body in two bounded phases:
+// waiting for the response headers (s.FirstByteTimeout) and reading the body
+// (s.BodyReadTimeout). Both are separate from the dial timeout and the overall
+// client timeout, so a target dribbling bytes cannot hold a worker for long.
+// When either deadline trips the host is marked slow and ErrSlowResponse is returned,
+// together with the response (headers only) if it was already received.
+// When check rejects the headers and the first sniffLength bytes, only those bytes are returned.
+func (s *FingerprintScanner) fetch(req *http.Request, limit int64, check bodyCheck) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	defer cancel(nil)
+
+	resp, err := s.doPhase(ctx, cancel, s.FirstByteTimeout, func() (*http.Response, error) {
+		return s.HTTPClient.Do(req.WithContext(ctx))
+	})
+	if err != nil {
+		if errors.Is(err, ErrSlowResponse) {
+			s.markSlow(req.URL.Host)
+		}
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	_, err = s.doPhase(ctx, cancel, s.BodyReadTimeout, func() (*http.Response, error) {
+		reader := io.LimitReader(resp.Body, limit)
+		if check != nil {
+			// A body shorter than the sniffed prefix is already complete
+			head := make([]byte, min(limit, sniffLength))
+			n, readErr := io.ReadFull(reader, head)
+			if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				return nil, readErr
+			}
+			if body = head[:n]; n < len(head) || !check(resp, body) {
+				return nil, nil
+			}
+		}
+		rest, readErr := io.ReadAll(reader)
+		body = append(body, rest...)
+		return nil, readErr
+	})
+	if err != nil {
+		if errors.Is(err, ErrSlowResponse) {
+			s.markSlow(req.URL.Host)
+		}
+		return resp, nil, err
+	}
+	return resp, body, nil
+}
+
+// doPhase runs fn and cancels ctx with ErrSlowResponse if it takes longer than limit
+func (s *FingerprintScanner) doPhase(ctx context.Context, cancel context.CancelCauseFunc, limit time.Duration, fn func() (*http.Response, error)) (*http.Response, error) {
+	if limit > 0 {
+		timer := time.AfterFunc(limit, func() { cancel(ErrSlowResponse) })
+		defer timer.Stop()
+	}
+	resp, err := fn()
+	if err != nil && errors.Is(context.Cause(ctx), ErrSlowResponse) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, ErrSlowResponse
+	}
+	return resp, err
+}
+
+// slowHosts hosts that tripped a read deadline, kept for SlowHostTTL
+type slowHosts struct {
+	mu    sync.Mutex
+	hosts map[string]time.Time
+}
+
+// markSlow excludes host (host:port) from further probing by this scanner
+func (s *FingerprintScanner) markSlow(host string) {
+	s.slow.mu.Lock()
+	defer s.slow.mu.Unlock()
+	if s.slow.hosts == nil {
+		s.slow.hosts = make(map[string]time.Time)
+	}
+	s.slow.hosts[host] = time.Now()
+}
+
+// IsSlowHost reports whether host (host:port) tripped a read deadline on this scanner.
+// Scanners are created per task, so the exclusion lasts for the rest of the task;
+// long-lived scanners forget hosts after SlowHostTTL.
+func (s *FingerprintScanner) IsSlowHost(host string) bool {
+	s.slow.mu.Lock()
+	defer s.slow.mu.Unlock()
+	marked, ok := s.slow.hosts[host]
+	if !ok {
+		return false
+	}
+	if s.SlowHostTTL > 0 && time.Since(marked) > s.SlowHostTTL {
+		delete(s.slow.hosts, host)
+		return false
+	}
+	return true
+}
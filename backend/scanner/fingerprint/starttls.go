@@ -0,0 +1,168 @@
+package fingerprint
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// startTLSServices services that advertise TLS through an in-band upgrade command
+var startTLSServices = map[string]bool{
+	"smtp": true,
+	"imap": true,
+	"pop3": true,
+	"ftp":  true,
+}
+
+// SupportsStartTLS reports whether the banner-derived service can be upgraded with STARTTLS
+func SupportsStartTLS(service string) bool {
+	return startTLSServices[service]
+}
+
+// getStartTLSCertInfo upgrades an already connected plaintext session (banner consumed) to TLS
+// and returns the server certificate. The exchange is bounded by s.Timeout and ctx; any failure
+// returns nil so the caller keeps the banner result as is.
+func (s *FingerprintScanner) getStartTLSCertInfo(ctx context.Context, conn net.Conn, service, host string) *CertInfo {
+	if !SupportsStartTLS(service) {
+		return nil
+	}
+
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	// Unblock pending reads/writes when ctx is cancelled mid-exchange
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	if err := startTLSExchange(conn, reader, service); err != nil {
+		return nil
+	}
+	// The server must not send anything between the upgrade reply and the handshake;
+	// buffered bytes here mean we would lose part of the TLS stream
+	if reader.Buffered() > 0 {
+		return nil
+	}
+
+	conf := &tls.Config{InsecureSkipVerify: true}
+	if net.ParseIP(host) == nil {
+		conf.ServerName = host
+	}
+	tlsConn := tls.Client(conn, conf)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil
+	}
+	return certInfoFromState(tlsConn.ConnectionState())
+}
+
+// startTLSExchange speaks the minimal protocol exchange that asks the server to start TLS
+func startTLSExchange(conn net.Conn, reader *bufio.Reader, service string) error {
+	switch service {
+	case "smtp":
+		// EHLO + STARTTLS (RFC 3207)
+		if err := sendLine(conn, "EHLO moongazing.local"); err != nil {
+			return err
+		}
+		if _, err := readSMTPReply(reader, "250"); err != nil {
+			return err
+		}
+		if err := sendLine(conn, "STARTTLS"); err != nil {
+			return err
+		}
+		_, err := readSMTPReply(reader, "220")
+		return err
+
+	case "imap":
+		// . CAPABILITY + STARTTLS (RFC 3501)
+		if err := sendLine(conn, ". CAPABILITY"); err != nil {
+			return err
+		}
+		if err := readIMAPTagged(reader, "."); err != nil {
+			return err
+		}
+		if err := sendLine(conn, ". STARTTLS"); err != nil {
+			return err
+		}
+		return readIMAPTagged(reader, ".")
+
+	case "pop3":
+		// STLS (RFC 2595)
+		if err := sendLine(conn, "STLS"); err != nil {
+			return err
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "+OK") {
+			return fmt.Errorf("pop3 STLS rejected: %s", strings.TrimSpace(line))
+		}
+		return nil
+
+	case "ftp":
+		// AUTH TLS (RFC 4217)
+		if err := sendLine(conn, "AUTH TLS"); err != nil {
+			return err
+		}
+		_, err := readSMTPReply(reader, "234")
+		return err
+	}
+	return fmt.Errorf("starttls not supported for %s", service)
+}
+
+// sendLine writes a CRLF terminated command
+func sendLine(conn net.Conn, line string) error {
+	_, err := conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// readSMTPReply reads a (possibly multi-line) SMTP/FTP reply and checks its code
+func readSMTPReply(reader *bufio.Reader, code string) (string, error) {
+	var reply strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return reply.String(), err
+		}
+		reply.WriteString(line)
+		if len(line) < 4 {
+			return reply.String(), fmt.Errorf("malformed reply: %q", line)
+		}
+		// "250-..." continues, "250 ..." is the last line
+		if line[3] == '-' {
+			continue
+		}
+		if !strings.HasPrefix(line, code) {
+			return reply.String(), fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+		}
+		return reply.String(), nil
+	}
+}
+
+// readIMAPTagged reads untagged responses until the tagged completion and checks it is OK
+func readIMAPTagged(reader *bufio.Reader, tag string) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			continue
+		}
+		status := strings.Fields(strings.TrimPrefix(line, tag+" "))
+		if len(status) == 0 || !strings.EqualFold(status[0], "OK") {
+			return fmt.Errorf("imap command rejected: %s", strings.TrimSpace(line))
+		}
+		return nil
+	}
+}
@@ -39,6 +39,8 @@ type FingerprintRule struct {
 	Tags      string     `yaml:"tags"`      // Comma-separated tags
 	Path      StringList `yaml:"path"`      // Paths for active probing
 	Header    string     `yaml:"header"`    // Custom headers for requests
+	// Regex matched against body, headers and title when the rule matches, first capture group is the version
+	VersionRegex string `yaml:"version_regex"`
 }
 
 // FingerprintMatch represents a successful fingerprint match
@@ -46,6 +48,7 @@ type FingerprintMatch struct {
 	URL        string    `json:"url"`
 	RuleName   string    `json:"rule_name"`
 	Technology string    `json:"technology"`
+	Version    string    `json:"version,omitempty"`
 	DSLMatched []string  `json:"dsl_matched,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 	Snippet    string    `json:"snippet,omitempty"`
@@ -64,6 +67,10 @@ type HTTPResponse struct {
 	URL        string
 	IconHash   string // mmh3 hash of favicon
 	IconMD5    string // MD5 of favicon
+	Cookies    map[string]string // Cookie name -> value parsed from Set-Cookie, see ParseSetCookies
+
+	meta       map[string][]string // Meta tags parsed from Body on first use, see MetaTags
+	metaParsed bool
 }
 
 // GetHeader returns a header value (case-insensitive)
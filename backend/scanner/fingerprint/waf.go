@@ -0,0 +1,202 @@
+package fingerprint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+
+	"moongazing/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WAF detection methods
+const (
+	WAFMethodHeader = "header"
+	WAFMethodCookie = "cookie"
+	WAFMethodBody   = "body"
+	WAFMethodProbe  = "probe"
+)
+
+// WAFGeneric names a WAF that only showed itself by blocking the probe, without a matching rule
+const WAFGeneric = "generic"
+
+// wafProbeQuery is added to the page URL by the active probe: harmless to the target,
+// but refused by any WAF that inspects query strings
+const wafProbeQuery = "q=%3Cscript%3Ealert(1)%3C%2Fscript%3E&id=1%27%20OR%20%271%27%3D%271"
+
+// wafBlockStatus are the statuses WAFs answer refused requests with
+var wafBlockStatus = map[int]bool{
+	http.StatusForbidden:          true,
+	http.StatusNotAcceptable:      true,
+	419:                           true,
+	http.StatusNotImplemented:     true,
+	http.StatusServiceUnavailable: true,
+}
+
+// WAFInfo a WAF in front of a web asset
+type WAFInfo struct {
+	Name     string `json:"name"`
+	Method   string `json:"method"`             // header, cookie, body or probe
+	Evidence string `json:"evidence,omitempty"` // Header, cookie or body string that matched, or the status the probe got
+}
+
+// WAFRule identifies a WAF from the headers, cookies and block page of a response
+type WAFRule struct {
+	Name    string            `yaml:"-"`
+	Headers map[string]string `yaml:"headers"` // Header name -> case-insensitive substring of its value, empty only requires the header
+	Cookies []string          `yaml:"cookies"` // Cookie name prefixes, case-insensitive
+	Body    []string          `yaml:"body"`    // Strings of the block page
+
+	headerNames []string // sorted Headers keys
+}
+
+// WAFRules holds the rules loaded from waf.yaml, sorted by name
+type WAFRules struct {
+	Rules []*WAFRule
+}
+
+// LoadWAFRules loads WAF rules from a YAML file, rules without any signature are skipped
+func LoadWAFRules(path string) (*WAFRules, int, error) {
+	data, err := config.ReadDictFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var raw map[string]*WAFRule
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, 0, err
+	}
+
+	rules := &WAFRules{}
+	skipped := 0
+	for name, rule := range raw {
+		if rule == nil || len(rule.Headers)+len(rule.Cookies)+len(rule.Body) == 0 {
+			fmt.Printf("Warning: WAF rule %s has no signatures\n", name)
+			skipped++
+			continue
+		}
+		rule.Name = name
+		for header := range rule.Headers {
+			rule.headerNames = append(rule.headerNames, header)
+		}
+		sort.Strings(rule.headerNames)
+		rules.Rules = append(rules.Rules, rule)
+	}
+	sort.Slice(rules.Rules, func(i, j int) bool { return rules.Rules[i].Name < rules.Rules[j].Name })
+	return rules, skipped, nil
+}
+
+// RulesCount returns the number of loaded rules
+func (r *WAFRules) RulesCount() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.Rules)
+}
+
+// Detect matches the rules against a response. Headers of every rule are checked first,
+// then cookies, then the body, so the strongest signature names the WAF
+func (r *WAFRules) Detect(header http.Header, cookies map[string]string, body string) *WAFInfo {
+	if r == nil {
+		return nil
+	}
+	for _, rule := range r.Rules {
+		for _, name := range rule.headerNames {
+			value := header.Get(name)
+			if value == "" {
+				continue
+			}
+			if want := rule.Headers[name]; want == "" || strings.Contains(strings.ToLower(value), strings.ToLower(want)) {
+				return &WAFInfo{Name: rule.Name, Method: WAFMethodHeader, Evidence: name + ": " + value}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(cookies))
+	for name := range cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, rule := range r.Rules {
+		for _, prefix := range rule.Cookies {
+			for _, name := range names {
+				if strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+					return &WAFInfo{Name: rule.Name, Method: WAFMethodCookie, Evidence: name}
+				}
+			}
+		}
+	}
+
+	if body == "" {
+		return nil
+	}
+	for _, rule := range r.Rules {
+		for _, s := range rule.Body {
+			if strings.Contains(body, s) {
+				return &WAFInfo{Name: rule.Name, Method: WAFMethodBody, Evidence: s}
+			}
+		}
+	}
+	return nil
+}
+
+// detectWAF matches the waf.yaml rules against the page response. When no rule matched and
+// s.WAFProbe is set, the page is requested once more with a suspicious query string
+func (s *FingerprintScanner) detectWAF(ctx context.Context, resp *http.Response, body string, cookies map[string]string) *WAFInfo {
+	if waf := s.WAFRules.Detect(resp.Header, cookies, body); waf != nil {
+		return waf
+	}
+	if !s.WAFProbe || resp.Request == nil || resp.StatusCode >= 400 {
+		return nil
+	}
+	return s.probeWAF(ctx, resp.Request, resp.StatusCode)
+}
+
+// probeWAF repeats the baseline request with wafProbeQuery added. The block page of the probe
+// is matched against the rules to name the WAF; a probe that is refused (wafBlockStatus) or
+// reset while the baseline was answered is reported as WAFGeneric
+func (s *FingerprintScanner) probeWAF(ctx context.Context, baseline *http.Request, baselineStatus int) *WAFInfo {
+	probeURL := *baseline.URL
+	if probeURL.RawQuery == "" {
+		probeURL.RawQuery = wafProbeQuery
+	} else {
+		probeURL.RawQuery += "&" + wafProbeQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", probeURL.String(), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header = baseline.Header.Clone()
+
+	resp, body, err := s.fetch(req, maxBodySize, pageBodyCheck)
+	if err != nil {
+		if ctx.Err() == nil && isConnectionReset(err) {
+			return &WAFInfo{Name: WAFGeneric, Method: WAFMethodProbe, Evidence: "connection reset"}
+		}
+		return nil
+	}
+
+	bodyStr := ""
+	contentType := resp.Header.Get("Content-Type")
+	if isTextBody(contentType, body) {
+		bodyStr = DecodeBody(body, contentType)
+	}
+	if waf := s.WAFRules.Detect(resp.Header, ParseSetCookies(resp.Header.Values("Set-Cookie")), bodyStr); waf != nil {
+		waf.Method = WAFMethodProbe
+		return waf
+	}
+	if resp.StatusCode != baselineStatus && wafBlockStatus[resp.StatusCode] {
+		return &WAFInfo{Name: WAFGeneric, Method: WAFMethodProbe, Evidence: fmt.Sprintf("status %d -> %d", baselineStatus, resp.StatusCode)}
+	}
+	return nil
+}
+
+// isConnectionReset reports whether the peer dropped the connection instead of answering
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,264 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// IP 归属信息
+// 从本地的 GeoLite2 ASN 和 City（或 Country）数据库查询 IP 所属的 ASN、组织、国家和城市。
+// 数据库路径可配置，文件不存在时对应字段留空，两个数据库都不可用时查询直接返回 nil。
+// 替换 mmdb 文件后调用 Reload 或由 Watch 检测到变化后重新加载，不需要重启。
+// mmdb 文件由 maxminddb-golang 解析，整个文件读入内存，重新加载后旧的数据库由 GC 回收，不需要关闭。
+
+// Info IP 归属信息
+type Info struct {
+	ASN         uint   `json:"asn,omitempty"`
+	Org         string `json:"org,omitempty"`
+	Country     string `json:"country,omitempty"`      // 国家英文名称
+	CountryCode string `json:"country_code,omitempty"` // ISO 3166-1 两位代码
+	City        string `json:"city,omitempty"`
+}
+
+// Empty 没有任何归属信息
+func (i *Info) Empty() bool {
+	return i == nil || (i.ASN == 0 && i.Org == "" && i.Country == "" && i.CountryCode == "" && i.City == "")
+}
+
+// asnRecord GeoLite2 ASN 的记录
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// placeRecord GeoLite2 City/Country 中的国家或城市
+type placeRecord struct {
+	ISOCode string            `maxminddb:"iso_code"`
+	Names   map[string]string `maxminddb:"names"`
+}
+
+// cityRecord GeoLite2 City/Country 的记录
+type cityRecord struct {
+	City              placeRecord `maxminddb:"city"`
+	Country           placeRecord `maxminddb:"country"`
+	RegisteredCountry placeRecord `maxminddb:"registered_country"`
+}
+
+// DB ASN 和 City 数据库，任一为 nil 时不查询对应字段
+type DB struct {
+	asn  *maxminddb.Reader
+	city *maxminddb.Reader
+}
+
+// NewDB 使用已打开的数据库创建查询
+func NewDB(asn, city *maxminddb.Reader) *DB {
+	return &DB{asn: asn, city: city}
+}
+
+// Open 打开 ASN 和 City 数据库，路径为空或文件不存在时跳过该数据库
+func Open(asnPath, cityPath string) (*DB, error) {
+	asn, err := openOptional(asnPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载 ASN 数据库失败: %w", err)
+	}
+	city, err := openOptional(cityPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载 City 数据库失败: %w", err)
+	}
+	return NewDB(asn, city), nil
+}
+
+// openOptional 文件不存在时返回 nil
+func openOptional(path string) (*maxminddb.Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return maxminddb.FromBytes(buf)
+}
+
+// Available 至少有一个数据库可用
+func (d *DB) Available() bool {
+	return d != nil && (d.asn != nil || d.city != nil)
+}
+
+// Lookup 查询 IP 的归属信息，无效 IP、私有地址或数据库中没有记录时返回 nil
+func (d *DB) Lookup(ip string) *Info {
+	if !d.Available() {
+		return nil
+	}
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsUnspecified() {
+		return nil
+	}
+
+	info := &Info{}
+	var asn asnRecord
+	if lookup(d.asn, parsed, &asn) {
+		info.ASN = asn.Number
+		info.Org = asn.Org
+	}
+	var city cityRecord
+	if lookup(d.city, parsed, &city) {
+		country := city.Country
+		if country.ISOCode == "" && len(country.Names) == 0 {
+			country = city.RegisteredCountry
+		}
+		info.CountryCode = country.ISOCode
+		info.Country = country.Names["en"]
+		info.City = city.City.Names["en"]
+	}
+	if info.Empty() {
+		return nil
+	}
+	return info
+}
+
+// lookup 查询一个数据库并解码到 record，出错时记录日志并当作没有记录
+func lookup(r *maxminddb.Reader, ip net.IP, record interface{}) bool {
+	if r == nil {
+		return false
+	}
+	_, ok, err := r.LookupNetwork(ip, record)
+	if err != nil {
+		log.Printf("[GeoIP] Lookup %s in %s failed: %v", ip, r.Metadata.DatabaseType, err)
+		return false
+	}
+	return ok
+}
+
+// Cache 单个任务内的查询缓存，同一 IP 只查询一次数据库（包括没有记录的 IP）
+type Cache struct {
+	db      *DB
+	mu      sync.Mutex
+	entries map[string]*Info
+	lookups int
+}
+
+// NewCache 创建查询缓存，db 为 nil 时所有查询返回 nil
+func NewCache(db *DB) *Cache {
+	return &Cache{db: db, entries: make(map[string]*Info)}
+}
+
+// Lookup 查询 IP，结果缓存到任务结束
+func (c *Cache) Lookup(ip string) *Info {
+	if c == nil || !c.db.Available() || ip == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if info, ok := c.entries[ip]; ok {
+		return info
+	}
+	info := c.db.Lookup(ip)
+	c.entries[ip] = info
+	c.lookups++
+	return info
+}
+
+// Lookups 实际查询数据库的次数
+func (c *Cache) Lookups() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookups
+}
+
+// 全局数据库
+var (
+	defaultMu       sync.RWMutex
+	defaultDB       *DB
+	defaultASNPath  string
+	defaultCityPath string
+)
+
+// Configure 设置数据库路径并加载，文件不存在时跳过
+func Configure(asnPath, cityPath string) error {
+	defaultMu.Lock()
+	defaultASNPath, defaultCityPath = asnPath, cityPath
+	defaultMu.Unlock()
+	return Reload()
+}
+
+// Reload 重新加载数据库文件，加载失败时保留之前的数据库
+func Reload() error {
+	defaultMu.RLock()
+	asnPath, cityPath := defaultASNPath, defaultCityPath
+	defaultMu.RUnlock()
+
+	db, err := Open(asnPath, cityPath)
+	if err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	defaultDB = db
+	defaultMu.Unlock()
+	return nil
+}
+
+// Default 当前加载的数据库，未配置时返回 nil
+func Default() *DB {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultDB
+}
+
+// Watch 定期检查数据库文件的修改时间和大小，变化后重新加载
+func Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := filesState()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			state := filesState()
+			if state == last {
+				continue
+			}
+			last = state
+			log.Printf("[GeoIP] Database files changed, reloading")
+			if err := Reload(); err != nil {
+				log.Printf("[GeoIP] Reload failed, keeping the previous database: %v", err)
+			}
+		}
+	}
+}
+
+// filesState 数据库文件的修改时间和大小
+func filesState() string {
+	defaultMu.RLock()
+	paths := []string{defaultASNPath, defaultCityPath}
+	defaultMu.RUnlock()
+
+	var b strings.Builder
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		} else {
+			fmt.Fprintf(&b, "%s:missing;", path)
+		}
+	}
+	return b.String()
+}
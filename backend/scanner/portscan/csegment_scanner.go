@@ -17,7 +17,7 @@ type HostResult struct {
 	Alive     bool         `json:"alive"`
 	Hostname  string       `json:"hostname,omitempty"`
 	OpenPorts []core.PortResult `json:"open_ports,omitempty"`
-	ScanTime  time.Duration `json:"scan_time_ms"`
+	ScanTimeMs int64       `json:"scan_time_ms"`
 }
 
 // CSegmentResult represents the result of a C segment scan
@@ -29,7 +29,7 @@ type CSegmentResult struct {
 	AliveHosts  int          `json:"alive_hosts"`
 	StartTime   time.Time    `json:"start_time"`
 	EndTime     time.Time    `json:"end_time"`
-	Duration    string       `json:"duration"`
+	DurationMs  int64       `json:"duration_ms"`
 	Hosts       []HostResult `json:"hosts"`
 }
 
@@ -148,7 +148,7 @@ func (s *CSegmentScanner) IsHostAlive(ctx context.Context, ip string) bool {
 		default:
 		}
 
-		address := fmt.Sprintf("%s:%d", ip, port)
+		address := core.HostPort(ip, port)
 		conn, err := net.DialTimeout("tcp", address, s.PingTimeout)
 		if err == nil {
 			conn.Close()
@@ -168,7 +168,7 @@ func (s *CSegmentScanner) ScanHost(ctx context.Context, ip string, ports []int)
 
 	// Check if host is alive first
 	if !s.IsHostAlive(ctx, ip) {
-		result.ScanTime = time.Since(start) / time.Millisecond
+		result.ScanTimeMs = core.MillisSince(start)
 		return result
 	}
 
@@ -192,7 +192,7 @@ func (s *CSegmentScanner) ScanHost(ctx context.Context, ip string, ports []int)
 		}
 	}
 
-	result.ScanTime = time.Since(start) / time.Millisecond
+	result.ScanTimeMs = core.MillisSince(start)
 	return result
 }
 
@@ -223,7 +223,7 @@ func (s *CSegmentScanner) ScanCSegment(ctx context.Context, target string, ports
 		select {
 		case <-ctx.Done():
 			result.EndTime = time.Now()
-			result.Duration = result.EndTime.Sub(result.StartTime).String()
+			result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 			return result
 		default:
 		}
@@ -261,7 +261,7 @@ func (s *CSegmentScanner) ScanCSegment(ctx context.Context, target string, ports
 	})
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	return result
 }
 
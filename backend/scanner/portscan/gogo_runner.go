@@ -21,8 +21,9 @@ import (
 type GoGoScanner struct {
 	toolPath string
 	mu       sync.Mutex
-	Threads  int // 并发数
-	Timeout  int // 超时时间(秒)
+	Threads  int  // 并发数
+	Timeout  int  // 超时时间(秒)
+	IPv6     bool // gogo 是否支持 IPv6 目标，不支持时 IPv6 地址使用内置 TCP 连接扫描
 }
 
 // GoGoConfig GoGo 扫描配置
@@ -81,6 +82,31 @@ func NewGoGoScannerWithConfig(config *GoGoConfig) *GoGoScanner {
 	return scanner
 }
 
+// NewGoGoScannerWithPath 使用指定路径的 gogo 创建独立的扫描器（不使用全局实例）
+func NewGoGoScannerWithPath(path string) *GoGoScanner {
+	return &GoGoScanner{
+		toolPath: path,
+		Threads:  1000,
+		Timeout:  10,
+	}
+}
+
+// WithThreads 返回使用指定线程数的扫描器副本，全局实例被多个任务共用，不能直接修改
+func (g *GoGoScanner) WithThreads(threads int) *GoGoScanner {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	scanner := &GoGoScanner{
+		toolPath: g.toolPath,
+		Threads:  g.Threads,
+		Timeout:  g.Timeout,
+		IPv6:     g.IPv6,
+	}
+	if threads > 0 {
+		scanner.Threads = threads
+	}
+	return scanner
+}
+
 // SetConfig 更新扫描器配置
 func (g *GoGoScanner) SetConfig(config *GoGoConfig) {
 	if config == nil {
@@ -155,12 +181,16 @@ func (g *GoGoScanner) findToolPath() {
 	log.Printf("[GoGoScanner] gogo not found in any expected location")
 }
 
-// IsAvailable 检查是否可用
+// IsAvailable 检查是否可用，指定的路径不存在或不可执行时不可用
 func (g *GoGoScanner) IsAvailable() bool {
 	if g.toolPath == "" {
 		g.findToolPath()
 	}
-	return g.toolPath != ""
+	if g.toolPath == "" {
+		return false
+	}
+	_, err := exec.LookPath(g.toolPath)
+	return err == nil
 }
 
 // ScanPorts 扫描端口
@@ -170,6 +200,10 @@ func (g *GoGoScanner) ScanPorts(ctx context.Context, target string, ports string
 	if !g.IsAvailable() {
 		return nil, fmt.Errorf("gogo tool not found")
 	}
+	if core.IsIPv6(target) && !g.IPv6 {
+		log.Printf("[GoGoScanner] gogo does not support IPv6 target %s, using TCP connect scan", target)
+		return g.TCPFallback().ScanPorts(ctx, target, ports)
+	}
 
 	result := &core.ScanResult{
 		Target:    target,
@@ -190,6 +224,7 @@ func (g *GoGoScanner) ScanPorts(ctx context.Context, target string, ports string
 
 	// 创建命令
 	cmd := exec.CommandContext(ctx, g.toolPath, args...)
+	run := core.StartToolCommand(ctx, "gogo", cmd)
 
 	// 获取输出管道
 	stdout, err := cmd.StdoutPipe()
@@ -199,6 +234,7 @@ func (g *GoGoScanner) ScanPorts(ctx context.Context, target string, ports string
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
+		run.Finish(err)
 		return nil, fmt.Errorf("failed to start gogo: %v", err)
 	}
 
@@ -221,9 +257,9 @@ func (g *GoGoScanner) ScanPorts(ctx context.Context, target string, ports string
 			continue
 		}
 
-		portResult := g.convertResult(&gogoResult)
+		portResult := ConvertGoGoResult(&gogoResult)
 		if portResult != nil {
-			key := fmt.Sprintf("%s:%d", gogoResult.IP, portResult.Port)
+			key := core.HostPort(gogoResult.IP, portResult.Port)
 			if !portMap[key] {
 				portMap[key] = true
 				result.Ports = append(result.Ports, *portResult)
@@ -232,7 +268,9 @@ func (g *GoGoScanner) ScanPorts(ctx context.Context, target string, ports string
 	}
 
 	// 等待命令完成
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	run.Finish(err)
+	if err != nil {
 		// 如果是上下文取消，不视为错误
 		if ctx.Err() != nil {
 			log.Printf("[GoGoScanner] Scan cancelled")
@@ -249,8 +287,19 @@ func (g *GoGoScanner) ScanPorts(ctx context.Context, target string, ports string
 	return result, nil
 }
 
-// convertResult 将 GoGo 结果转换为通用格式
-func (g *GoGoScanner) convertResult(gogoResult *GoGoResult) *core.PortResult {
+// TCPFallback gogo 无法扫描的目标（IPv6 地址、gogo 未安装）使用的 TCP 连接扫描器，并发不超过 gogo 线程数
+func (g *GoGoScanner) TCPFallback() *TCPConnectScanner {
+	g.mu.Lock()
+	threads := g.Threads
+	g.mu.Unlock()
+	if threads > defaultTCPConnectConcurrency {
+		threads = defaultTCPConnectConcurrency
+	}
+	return NewTCPConnectScanner(threads, 0)
+}
+
+// ConvertGoGoResult 将 GoGo 结果转换为通用格式
+func ConvertGoGoResult(gogoResult *GoGoResult) *core.PortResult {
 	if gogoResult == nil {
 		return nil
 	}
@@ -265,19 +314,16 @@ func (g *GoGoScanner) convertResult(gogoResult *GoGoResult) *core.PortResult {
 		return nil
 	}
 
-	// 提取服务信息
-	service := gogoResult.Protocol
-	if service == "" || service == "tcp" {
-		service = guessService(port)
-	}
+	// 提取服务信息：GoGo 识别的协议优先，未识别（tcp）时使用统一端口服务映射
+	service := core.ResolveServiceName(port, "", gogoResult.Protocol)
 
 	// 提取版本信息
 	version := gogoResult.Midware
 
-	// 提取指纹信息
+	// 提取指纹信息（规范化为统一的技术名称）
 	var fingerprints []string
-	for name := range gogoResult.Frameworks {
-		fingerprints = append(fingerprints, name)
+	if len(gogoResult.Frameworks) > 0 {
+		fingerprints = core.FrameworkTechnologies(core.DefaultTechNormalizer(), gogoResult.Frameworks).Names()
 	}
 
 	// 提取 Banner（使用 Title）
@@ -290,9 +336,38 @@ func (g *GoGoScanner) convertResult(gogoResult *GoGoResult) *core.PortResult {
 		Version:     version,
 		Banner:      banner,
 		Fingerprint: fingerprints,
+		Protocol:    gogoTransport(gogoResult.Protocol),
+		TLS:         gogoTLS(gogoResult),
 	}
 }
 
+// gogoTLSProtocols GoGo 识别为 TLS 封装的协议
+var gogoTLSProtocols = map[string]bool{
+	"https": true, "tls": true, "ssl": true,
+	"imaps": true, "pop3s": true, "smtps": true, "ldaps": true, "ftps": true,
+}
+
+// gogoTransport GoGo 的 protocol 为 udp 开头时是 UDP 端口，其余为 TCP
+func gogoTransport(protocol string) string {
+	if strings.HasPrefix(strings.ToLower(protocol), "udp") {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// gogoTLS 根据 GoGo 识别的协议和 frameworks 判断端口是否为 TLS 服务
+func gogoTLS(gogoResult *GoGoResult) bool {
+	if gogoTLSProtocols[strings.ToLower(gogoResult.Protocol)] {
+		return true
+	}
+	for name := range gogoResult.Frameworks {
+		if gogoTLSProtocols[strings.ToLower(name)] {
+			return true
+		}
+	}
+	return false
+}
+
 // ScanRange 扫描端口范围
 func (g *GoGoScanner) ScanRange(ctx context.Context, target string, portRange string) (*core.ScanResult, error) {
 	return g.ScanPorts(ctx, target, portRange)
@@ -327,14 +402,3 @@ func (g *GoGoScanner) ScanOne(target string, port string) *core.PortResult {
 
 	return &result.Ports[0]
 }
-
-// guessService 根据端口猜测服务
-func guessService(port int) string {
-	// 从配置加载端口服务映射
-	services := core.GetPortServiceMap()
-
-	if service, ok := services[port]; ok {
-		return service
-	}
-	return "unknown"
-}
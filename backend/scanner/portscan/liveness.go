@@ -0,0 +1,228 @@
+package portscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// 主机存活预检测
+// 端口扫描前用少量 TCP 端口连接（不依赖 SYN 权限）和可选的 ICMP Echo 判断主机是否存活，
+// 避免对大网段中大量不存在的地址逐个启动 GoGo
+
+// DefaultLivenessPorts 默认探测端口
+var DefaultLivenessPorts = []int{80, 443, 22}
+
+// LivenessConfig 存活探测配置
+type LivenessConfig struct {
+	Ports       []int         // TCP 探测端口
+	Timeout     time.Duration // 单次探测超时
+	Concurrency int           // 并发主机数
+	ICMP        bool          // 是否尝试 ICMP Echo（需要原始套接字权限，不可用时自动跳过）
+	Dial        DialFunc      // 自定义拨号函数（如指定出口地址），nil 使用默认拨号
+}
+
+// DialFunc TCP 拨号函数
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DefaultLivenessConfig 默认存活探测配置
+func DefaultLivenessConfig() LivenessConfig {
+	return LivenessConfig{
+		Ports:       DefaultLivenessPorts,
+		Timeout:     time.Second,
+		Concurrency: 100,
+		ICMP:        true,
+	}
+}
+
+// LivenessResult 存活探测结果
+type LivenessResult struct {
+	IP       string   `json:"ip"`
+	Alive    bool     `json:"alive"`
+	Method   string   `json:"method,omitempty"` // 判定存活的方式: tcp, icmp
+	Evidence []string `json:"evidence"`         // 各项探测结果
+}
+
+// LivenessProber 主机存活探测器
+type LivenessProber struct {
+	config LivenessConfig
+	icmp   bool
+	dial   DialFunc
+}
+
+var (
+	icmpOnce      sync.Once
+	icmpAvailable bool
+)
+
+// ICMPAvailable 检测当前进程是否有权限发送 ICMP Echo（仅检测一次）
+func ICMPAvailable() bool {
+	icmpOnce.Do(func() {
+		conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		if err != nil {
+			log.Printf("[Liveness] ICMP not available, using TCP probes only: %v", err)
+			return
+		}
+		conn.Close()
+		icmpAvailable = true
+	})
+	return icmpAvailable
+}
+
+// NewLivenessProber 创建存活探测器
+func NewLivenessProber(cfg LivenessConfig) *LivenessProber {
+	defaults := DefaultLivenessConfig()
+	if len(cfg.Ports) == 0 {
+		cfg.Ports = defaults.Ports
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaults.Concurrency
+	}
+
+	dial := cfg.Dial
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: cfg.Timeout}
+		dial = dialer.DialContext
+	}
+	return &LivenessProber{
+		config: cfg,
+		icmp:   cfg.ICMP && ICMPAvailable(),
+		dial:   dial,
+	}
+}
+
+// Concurrency 并发主机数
+func (p *LivenessProber) Concurrency() int {
+	return p.config.Concurrency
+}
+
+// Probe 探测单个主机
+// 任一端口建立连接或被拒绝（收到 RST）都说明主机存活；TCP 全部超时时再尝试 ICMP
+func (p *LivenessProber) Probe(ctx context.Context, ip string) LivenessResult {
+	result := LivenessResult{IP: ip}
+
+	type portResult struct {
+		port     int
+		alive    bool
+		evidence string
+	}
+	results := make(chan portResult, len(p.config.Ports))
+	probeCtx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	for _, port := range p.config.Ports {
+		go func(port int) {
+			alive, evidence := p.probeTCP(probeCtx, ip, port)
+			results <- portResult{port: port, alive: alive, evidence: evidence}
+		}(port)
+	}
+
+	evidence := make(map[int]string, len(p.config.Ports))
+	for range p.config.Ports {
+		r := <-results
+		evidence[r.port] = r.evidence
+		if r.alive {
+			result.Alive = true
+			result.Method = "tcp"
+		}
+	}
+	for _, port := range p.config.Ports {
+		result.Evidence = append(result.Evidence, evidence[port])
+	}
+	if result.Alive {
+		return result
+	}
+
+	if p.icmp {
+		alive, ev := p.probeICMP(ctx, ip)
+		result.Evidence = append(result.Evidence, ev)
+		if alive {
+			result.Alive = true
+			result.Method = "icmp"
+		}
+	}
+	return result
+}
+
+// probeTCP TCP 连接探测
+func (p *LivenessProber) probeTCP(ctx context.Context, ip string, port int) (bool, string) {
+	conn, err := p.dial(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err == nil {
+		conn.Close()
+		return true, fmt.Sprintf("tcp/%d open", port)
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true, fmt.Sprintf("tcp/%d refused", port)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded) {
+		return false, fmt.Sprintf("tcp/%d timeout", port)
+	}
+	return false, fmt.Sprintf("tcp/%d error: %v", port, err)
+}
+
+// probeICMP ICMP Echo 探测
+func (p *LivenessProber) probeICMP(ctx context.Context, ip string) (bool, string) {
+	dst := net.ParseIP(ip)
+	if dst == nil || dst.To4() == nil {
+		return false, "icmp skipped: not ipv4"
+	}
+
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false, fmt.Sprintf("icmp error: %v", err)
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{ID: id, Seq: 1, Data: []byte("moongazing")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false, fmt.Sprintf("icmp error: %v", err)
+	}
+	if _, err := conn.WriteTo(data, &net.IPAddr{IP: dst}); err != nil {
+		return false, fmt.Sprintf("icmp error: %v", err)
+	}
+
+	deadline := time.Now().Add(p.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return false, "icmp timeout"
+		}
+		// 原始套接字会收到所有 ICMP 报文，只接受来自目标的 Echo Reply
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(dst) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id {
+			return true, "icmp echo reply"
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/core"
+)
+
+// 内置 TCP 连接扫描
+// gogo 不接受 IPv6 目标，IPv6 地址改用 TCP 全连接扫描；没有安装 gogo 时流水线整体改用该扫描器。
+// 端口参数与 gogo 相同（top1、top2、范围、列表）。开放端口读取少量 banner 推断服务，
+// 协议细节和指纹由后续的端口指纹识别补充
+
+const (
+	defaultTCPConnectConcurrency = 200
+	defaultTCPConnectTimeout     = 2 * time.Second
+	defaultBannerTimeout         = 500 * time.Millisecond
+	maxTCPConnectPorts           = 65535
+	maxBannerSize                = 512
+
+	// MaxTCPConnectConcurrency 内置扫描的并发上限，gogo 的线程数通常远高于系统能同时建立的连接数
+	MaxTCPConnectConcurrency = 1000
+)
+
+// PortScanner 端口扫描器：GoGoScanner 和内置的 TCPConnectScanner
+type PortScanner interface {
+	IsAvailable() bool
+	ScanPorts(ctx context.Context, target string, ports string) (*core.ScanResult, error)
+	QuickScan(ctx context.Context, target string) (*core.ScanResult, error)
+	Top1000Scan(ctx context.Context, target string) (*core.ScanResult, error)
+	FullScan(ctx context.Context, target string) (*core.ScanResult, error)
+}
+
+// fallbackTopPorts 配置中没有 top_ports 时 top1 使用的端口
+var fallbackTopPorts = []int{
+	21, 22, 23, 25, 53, 80, 81, 88, 110, 111, 135, 139, 143, 161, 389, 443, 445, 465, 587, 636,
+	873, 993, 995, 1080, 1433, 1521, 2049, 2181, 2375, 2376, 2379, 3000, 3306, 3389, 3690, 4443,
+	5000, 5001, 5432, 5601, 5672, 5900, 5984, 6379, 6443, 7001, 7002, 8000, 8001, 8008, 8009,
+	8080, 8081, 8086, 8088, 8443, 8500, 8888, 9000, 9001, 9042, 9090, 9092, 9200, 9300, 9418,
+	9443, 10250, 11211, 15672, 27017,
+}
+
+// TCPConnectScanner TCP 全连接端口扫描器
+type TCPConnectScanner struct {
+	Concurrency   int           // 同时进行的连接数
+	Timeout       time.Duration // 单个端口的连接超时
+	BannerTimeout time.Duration // 连接后等待服务主动发送 banner 的时间，0 不读取
+	Dialer        func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewTCPConnectScanner 创建 TCP 连接扫描器，参数 <= 0 时使用默认值，并发不超过 MaxTCPConnectConcurrency
+func NewTCPConnectScanner(concurrency int, timeout time.Duration) *TCPConnectScanner {
+	if concurrency <= 0 {
+		concurrency = defaultTCPConnectConcurrency
+	}
+	if concurrency > MaxTCPConnectConcurrency {
+		concurrency = MaxTCPConnectConcurrency
+	}
+	if timeout <= 0 {
+		timeout = defaultTCPConnectTimeout
+	}
+	return &TCPConnectScanner{
+		Concurrency:   concurrency,
+		Timeout:       timeout,
+		BannerTimeout: defaultBannerTimeout,
+		Dialer:        (&net.Dialer{}).DialContext,
+	}
+}
+
+// IsAvailable 内置扫描器总是可用
+func (s *TCPConnectScanner) IsAvailable() bool {
+	return true
+}
+
+// QuickScan 扫描常用端口（对应 gogo 的 top1）
+func (s *TCPConnectScanner) QuickScan(ctx context.Context, target string) (*core.ScanResult, error) {
+	return s.ScanPorts(ctx, target, "top1")
+}
+
+// Top1000Scan 扫描 1-1000 及常用端口（对应 gogo 的 top2）
+func (s *TCPConnectScanner) Top1000Scan(ctx context.Context, target string) (*core.ScanResult, error) {
+	return s.ScanPorts(ctx, target, "top2")
+}
+
+// FullScan 全端口扫描
+func (s *TCPConnectScanner) FullScan(ctx context.Context, target string) (*core.ScanResult, error) {
+	return s.ScanPorts(ctx, target, "1-65535")
+}
+
+// ScanPorts 扫描目标的端口，ports 格式与 gogo 的 -p 参数相同
+func (s *TCPConnectScanner) ScanPorts(ctx context.Context, target string, ports string) (*core.ScanResult, error) {
+	portList, err := ParsePortSpec(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &core.ScanResult{
+		Target:    target,
+		StartTime: time.Now(),
+		Ports:     make([]core.PortResult, 0),
+	}
+	log.Printf("[TCPConnect] Scanning %s with %d ports (concurrency %d)", target, len(portList), s.Concurrency)
+
+	host := strings.Trim(target, "[]")
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.Concurrency)
+	for _, port := range portList {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			open, banner := s.probe(ctx, host, port)
+			if !open {
+				return
+			}
+			mu.Lock()
+			result.Ports = append(result.Ports, core.PortResult{
+				Port:     port,
+				State:    "open",
+				Service:  core.ResolveServiceName(port, guessService(banner), ""),
+				Banner:   banner,
+				Protocol: "tcp",
+			})
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		log.Printf("[TCPConnect] Scan of %s cancelled", target)
+	}
+
+	sort.Slice(result.Ports, func(i, j int) bool { return result.Ports[i].Port < result.Ports[j].Port })
+	result.EndTime = time.Now()
+	log.Printf("[TCPConnect] Found %d open ports on %s", len(result.Ports), target)
+	return result, nil
+}
+
+// probe 端口能否建立 TCP 连接，能连接时读取服务主动发送的 banner（第一行）
+func (s *TCPConnectScanner) probe(ctx context.Context, host string, port int) (bool, string) {
+	dialCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	conn, err := s.Dialer(dialCtx, "tcp", core.HostPort(host, port))
+	if err != nil {
+		return false, ""
+	}
+	defer conn.Close()
+	if s.BannerTimeout <= 0 || ctx.Err() != nil {
+		return true, ""
+	}
+
+	conn.SetReadDeadline(time.Now().Add(s.BannerTimeout))
+	buf := make([]byte, maxBannerSize)
+	n, _ := conn.Read(buf)
+	banner := string(buf[:n])
+	if i := strings.IndexAny(banner, "\r\n"); i >= 0 {
+		banner = banner[:i]
+	}
+	return true, strings.TrimSpace(banner)
+}
+
+// guessService 根据 banner 推断服务，无法判断时返回空字符串，由端口映射决定
+func guessService(banner string) string {
+	upper := strings.ToUpper(banner)
+	switch {
+	case banner == "":
+		return ""
+	case strings.HasPrefix(banner, "SSH-"):
+		return "ssh"
+	case strings.HasPrefix(upper, "HTTP/"):
+		return "http"
+	case strings.HasPrefix(banner, "+OK"):
+		return "pop3"
+	case strings.HasPrefix(upper, "* OK"):
+		return "imap"
+	case strings.HasPrefix(banner, "220"):
+		if strings.Contains(upper, "FTP") {
+			return "ftp"
+		}
+		if strings.Contains(upper, "SMTP") || strings.Contains(upper, "MAIL") {
+			return "smtp"
+		}
+	case strings.Contains(upper, "MYSQL") || strings.Contains(upper, "MARIADB"):
+		return "mysql"
+	case strings.HasPrefix(banner, "RFB "):
+		return "vnc"
+	case strings.HasPrefix(banner, "-ERR") || strings.HasPrefix(banner, "-NOAUTH"):
+		return "redis"
+	}
+	return ""
+}
+
+// ParsePortSpec 解析 gogo 格式的端口参数：top1（配置的 top_ports）、top2（1-1000 及配置的 top_ports、common_ports）、
+// 范围 1-65535、逗号分隔的列表，可以混合使用
+func ParsePortSpec(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	add := func(port int) {
+		if port > 0 && port <= maxTCPConnectPorts && !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(strings.ToLower(part))
+		switch {
+		case part == "":
+			continue
+		case part == "top1" || part == "top2":
+			top := core.GetTopPorts()
+			if len(top) == 0 {
+				top = fallbackTopPorts
+			}
+			for _, port := range top {
+				add(port)
+			}
+			if part == "top2" {
+				for _, port := range core.GetCommonPorts() {
+					add(port)
+				}
+				for port := 1; port <= 1000; port++ {
+					add(port)
+				}
+			}
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			start, err1 := strconv.Atoi(strings.TrimSpace(bounds[0]))
+			end, err2 := strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err1 != nil || err2 != nil || start <= 0 || end < start || end > maxTCPConnectPorts {
+				return nil, fmt.Errorf("invalid port range: %s", part)
+			}
+			for port := start; port <= end; port++ {
+				add(port)
+			}
+		default:
+			port, err := strconv.Atoi(part)
+			if err != nil || port <= 0 || port > maxTCPConnectPorts {
+				return nil, fmt.Errorf("invalid port: %s", part)
+			}
+			add(port)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", spec)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
@@ -2,14 +2,17 @@ package subdomain
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"moongazing/config"
+	"moongazing/scanner/core"
 	"moongazing/scanner/subdomain/thirdparty"
 )
 
@@ -30,11 +33,13 @@ type ActiveScannerConfig struct {
 	EnableRecursive   bool     // 是否启用递归
 	RecursiveDepth    int      // 递归深度
 	WildcardDetection bool     // 泛解析检测
+	WildcardHTTPConfirm bool   // 对判定为泛解析的结果比较 HTTP 响应体再次确认
 	ResolveTimeout    int      // 解析超时(秒)
 	EnableAPI         bool     // 是否启用API
 	APISources        []string // API源列表
 	APIMaxResults     int      // API最大结果数
-	VerifySubdomains  bool     // 是否验证存活
+	VerifySubdomains  bool     // 是否验证存活（对被动来源的子域名重新解析）
+	ResolveConcurrency int     // 被动来源解析并发数
 	EnableHTTPProbe   bool     // 是否进行HTTP探测
 }
 
@@ -44,6 +49,12 @@ type ActiveScanner struct {
 	apiManager *thirdparty.APIManager
 	results    sync.Map // 存储去重后的结果 map[string]*SubdomainResult
 	callback   func(SubdomainResult) // 结果回调函数
+	resolver   ResolveFunc           // 自定义解析函数，nil 使用内置 DNS 服务器池
+	cname      CNAMEFunc             // 自定义 CNAME 查询函数，nil 使用内置 DNS 服务器池
+	bodyHash   BodyHashFunc          // 泛解析 HTTP 确认使用的响应体 hash 函数，nil 使用 HTTPBodyHash
+	wildcards  sync.Map              // 根域名 -> *WildcardPool，最近一次字典爆破的泛解析检测结果
+	network    *core.ScanNetworkConfig // 自定义 DNS 服务器，nil 使用内置 DNS 服务器池
+	dns        *net.Resolver           // 按 network 创建的解析器
 }
 
 // NewActiveScanner 创建新的扫描器
@@ -54,8 +65,15 @@ func NewActiveScanner(cfg *ActiveScannerConfig, apiCfg *thirdparty.APIConfig) *A
 	}
 }
 
+// SetAPIManager 替换第三方数据源管理器（任务使用工作空间保存的密钥时）
+func (s *ActiveScanner) SetAPIManager(manager *thirdparty.APIManager) {
+	s.apiManager = manager
+}
+
 // Run 执行扫描
 func (s *ActiveScanner) Run(ctx context.Context, domain string) ([]SubdomainResult, error) {
+	// 国际化域名转换为 punycode，subfinder、API 和字典爆破都使用 ASCII 形式
+	domain = core.ToASCIIDomain(domain)
 	log.Printf("[ActiveScanner] Starting scan for domain: %s", domain)
 
 	// 重置结果存储，确保每次扫描都是干净的
@@ -91,13 +109,7 @@ func (s *ActiveScanner) Run(ctx context.Context, domain string) ([]SubdomainResu
 	wg.Wait()
 
 	// 收集结果
-	var results []SubdomainResult
-	s.results.Range(func(key, value interface{}) bool {
-		if result, ok := value.(*SubdomainResult); ok {
-			results = append(results, *result)
-		}
-		return true
-	})
+	results := s.Results()
 
 	log.Printf("[ActiveScanner] Scan completed for %s, found %d subdomains", domain, len(results))
 	return results, nil
@@ -117,100 +129,61 @@ func (s *ActiveScanner) runSubfinder(ctx context.Context, domain string) {
 		return
 	}
 
-	// 添加结果（暂时不解析IP，后续统一验证）
-	for _, sub := range subdomains {
-		s.addResult(sub, nil, "subfinder")
-	}
+	// 被动来源需要解析确认
+	s.AddPassiveResults(ctx, subdomains, "subfinder")
 
 	log.Printf("[ActiveScanner] Subfinder found %d subdomains", len(subdomains))
 }
 
-// runAPIEnum 执行API枚举（仅支持付费API: fofa, hunter, quake, securitytrails）
-// 注意：crtsh 已移除，因为数据不准确
+// runAPIEnum 执行API枚举（付费API: fofa, hunter, quake, securitytrails；免费被动源: crtsh, otx, chaos）
+// 被动源的历史数据可能已失效，与其他来源一样经 AddPassiveResults 重新解析确认
 func (s *ActiveScanner) runAPIEnum(ctx context.Context, domain string) {
 	log.Printf("[ActiveScanner] Starting API enumeration for %s", domain)
 
 	var wg sync.WaitGroup
 
-	// 调用各个 API（已移除 crtsh）
+	// 调用各个 API
 	for _, source := range s.config.APISources {
 		wg.Add(1)
 		go func(src string) {
 			defer wg.Done()
 			switch src {
-			case "fofa":
-				if s.apiManager.Fofa != nil {
-					assets, err := s.apiManager.Fofa.SearchSubdomains(ctx, domain, s.config.APIMaxResults)
-					if err == nil {
-						for _, asset := range assets {
-							var ips []string
-							if asset.IP != "" {
-								ips = []string{asset.IP}
-							}
-							s.addResult(asset.Host, ips, "fofa")
-						}
-						log.Printf("[ActiveScanner] Fofa found %d assets", len(assets))
-					} else {
-						log.Printf("[ActiveScanner] Fofa error: %v", err)
-					}
+			case "fofa", "hunter", "quake":
+				// 管理器负责分页、配额统计和结果缓存
+				assets, err := s.apiManager.FetchSubdomainAssets(ctx, src, domain, s.config.APIMaxResults)
+				if err != nil {
+					log.Printf("[ActiveScanner] %s error: %v", src, err)
 				}
-			case "hunter":
-				if s.apiManager.Hunter != nil {
-					assets, err := s.apiManager.Hunter.SearchSubdomains(ctx, domain, s.config.APIMaxResults)
-					if err == nil {
-						for _, asset := range assets {
-							var ips []string
-							if asset.IP != "" {
-								ips = []string{asset.IP}
-							}
-							// Hunter 使用 Domain 或 URL 字段
-							host := asset.Domain
-							if host == "" {
-								host = asset.URL
-							}
-							if host != "" {
-								s.addResult(host, ips, "hunter")
-							}
-						}
-						log.Printf("[ActiveScanner] Hunter found %d assets", len(assets))
-					} else {
-						log.Printf("[ActiveScanner] Hunter error: %v", err)
+				// API 返回的 IP 可能是历史数据，按来源分组后统一重新解析
+				bySource := make(map[string][]string)
+				for _, asset := range assets {
+					// Fofa 使用 Host 字段，Hunter/Quake 优先使用 Domain 字段
+					host := asset.Host
+					if src != "fofa" && asset.Domain != "" {
+						host = asset.Domain
 					}
-				}
-			case "quake":
-				if s.apiManager.Quake != nil {
-					assets, err := s.apiManager.Quake.SearchSubdomains(ctx, domain, s.config.APIMaxResults)
-					if err == nil {
-						for _, asset := range assets {
-							var ips []string
-							if asset.IP != "" {
-								ips = []string{asset.IP}
-							}
-							// Quake 使用 Domain 或 Hostname 字段
-							host := asset.Domain
-							if host == "" {
-								host = asset.Hostname
-							}
-							if host != "" {
-								s.addResult(host, ips, "quake")
-							}
-						}
-						log.Printf("[ActiveScanner] Quake found %d assets", len(assets))
-					} else {
-						log.Printf("[ActiveScanner] Quake error: %v", err)
+					if host != "" {
+						bySource[asset.Source] = append(bySource[asset.Source], host)
 					}
 				}
-			case "securitytrails":
-				if s.apiManager.SecurityTrails != nil {
-					subdomains, err := s.apiManager.SecurityTrails.SearchSubdomains(ctx, domain)
-					if err == nil {
-						for _, sub := range subdomains {
-							s.addResult(sub, nil, "securitytrails")
-						}
-						log.Printf("[ActiveScanner] SecurityTrails found %d subdomains", len(subdomains))
-					} else {
-						log.Printf("[ActiveScanner] SecurityTrails error: %v", err)
-					}
+				for source, hosts := range bySource {
+					s.AddPassiveResults(ctx, hosts, source)
+				}
+				log.Printf("[ActiveScanner] %s found %d assets", src, len(assets))
+			case thirdparty.SourceCrtSh, thirdparty.SourceOTX, thirdparty.SourceChaos:
+				subdomains, err := s.apiManager.FetchPassiveSubdomains(ctx, src, domain, s.config.APIMaxResults)
+				if err != nil {
+					log.Printf("[ActiveScanner] %s error: %v", src, err)
+				}
+				s.AddPassiveResults(ctx, subdomains, src)
+				log.Printf("[ActiveScanner] %s found %d subdomains", src, len(subdomains))
+			case thirdparty.SourceSecurityTrails:
+				subdomains, err := s.apiManager.FetchSecurityTrailsSubdomains(ctx, domain)
+				if err == nil {
+					s.AddPassiveResults(ctx, subdomains, "securitytrails")
+					log.Printf("[ActiveScanner] SecurityTrails found %d subdomains", len(subdomains))
+				} else {
+					log.Printf("[ActiveScanner] SecurityTrails error: %v", err)
 				}
 			}
 		}(source)
@@ -233,22 +206,16 @@ func (s *ActiveScanner) runBruteForce(ctx context.Context, domain string) {
 	log.Printf("[ActiveScanner] Loaded %d subdomains from dictionary for %s", len(subdomains), domain)
 
 	// 泛解析检测
-	wildcardIPs := make(map[string]bool)
-	var wildcardEnabled bool
+	var pool *WildcardPool
 	if s.config.WildcardDetection {
-		if ips := s.detectWildcard(domain); len(ips) > 0 {
-			log.Printf("[ActiveScanner] Wildcard detected for %s, IPs: %v (will filter these)", domain, ips)
-			for _, ip := range ips {
-				wildcardIPs[ip] = true
-			}
-			wildcardEnabled = true
-		} else {
-			log.Printf("[ActiveScanner] No wildcard detected for %s", domain)
-		}
+		pool = s.DetectWildcard(ctx, domain)
 	}
 
 	// 使用 ksubdomain 进行枚举
 	runner := NewKSubdomainRunner()
+	if s.network.HasResolvers() && !s.network.DoH {
+		runner.SetResolvers(s.network.ResolverServers())
+	}
 	results, err := runner.RunEnumeration(ctx, domain, subdomains)
 	if err != nil {
 		log.Printf("[ActiveScanner] ksubdomain error: %v", err)
@@ -257,40 +224,55 @@ func (s *ActiveScanner) runBruteForce(ctx context.Context, domain string) {
 
 	log.Printf("[ActiveScanner] ksubdomain found %d potential subdomains", len(results))
 
+	// 过滤泛解析
+	results = s.FilterWildcard(ctx, pool, results)
+
 	var added int64
 	for sub, ips := range results {
-		// 过滤泛解析
-		if wildcardEnabled && len(wildcardIPs) > 0 {
-			allWildcard := true
-			for _, ip := range ips {
-				if !wildcardIPs[ip] {
-					allWildcard = false
-					break
-				}
-			}
-			if allWildcard {
-				continue // 跳过泛解析结果
-			}
-		}
-
-		s.addResult(sub, ips, "ksubdomain")
+		// 字典爆破结果已经过解析
+		s.addResult(sub, ips, "ksubdomain", ResolutionResolved)
 		added++
 	}
 
-	log.Printf("[ActiveScanner] Brute force completed, added %d new subdomains", added)
+	log.Printf("[ActiveScanner] Brute force completed, added %d new subdomains, %d filtered as wildcard", added, pool.Filtered())
+}
+
+// SetNetwork 设置自定义 DNS 服务器，用于解析验证、CNAME 查询和 ksubdomain 字典爆破
+// 返回不支持的设置：ksubdomain 直接发送 DNS 报文，开启 DoH 时字典爆破仍使用其默认 DNS 服务器
+func (s *ActiveScanner) SetNetwork(cfg *core.ScanNetworkConfig) []string {
+	s.network, s.dns = cfg, nil
+	if !cfg.HasResolvers() {
+		return nil
+	}
+	s.dns = cfg.Resolver(time.Duration(s.resolveTimeout()) * time.Second)
+	if cfg.DoH && s.config.EnableBrute {
+		return []string{"doh"}
+	}
+	return nil
+}
+
+// resolveTimeout 单次解析超时（秒）
+func (s *ActiveScanner) resolveTimeout() int {
+	if s.config.ResolveTimeout <= 0 {
+		return 5
+	}
+	return s.config.ResolveTimeout
 }
 
 // resolveDomain 解析域名（使用多个DNS服务器并带重试机制）
 func (s *ActiveScanner) resolveDomain(domain string) ([]string, error) {
-	timeout := s.config.ResolveTimeout
-	if timeout <= 0 {
-		timeout = 5
+	timeout := s.resolveTimeout()
+	if s.dns != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+		defer cancel()
+		return s.dns.LookupHost(ctx, domain)
 	}
 
 	// 随机选择一个DNS服务器开始
 	startIdx := rand.Intn(len(dnsServers))
 	
 	// 尝试所有DNS服务器
+	var lastErr error
 	for i := 0; i < len(dnsServers); i++ {
 		serverIdx := (startIdx + i) % len(dnsServers)
 		dnsServer := dnsServers[serverIdx]
@@ -313,63 +295,186 @@ func (s *ActiveScanner) resolveDomain(domain string) ([]string, error) {
 		if err == nil && len(ips) > 0 {
 			return ips, nil
 		}
+		// NXDOMAIN 是确定的结果，无需再尝试其他服务器
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, err
+		}
+		lastErr = err
 	}
 	
-	// 所有DNS服务器都失败了，返回NXDOMAIN
+	// 所有DNS服务器都失败了
+	if lastErr != nil {
+		return nil, fmt.Errorf("no DNS record found: %w", lastErr)
+	}
 	return nil, fmt.Errorf("no DNS record found")
 }
 
-// detectWildcard 检测泛解析，返回泛解析的IP
-func (s *ActiveScanner) detectWildcard(domain string) []string {
-	// 生成多个随机子域名进行测试
-	testDomains := []string{
-		fmt.Sprintf("wildcard-test-%d.%s", time.Now().UnixNano(), domain),
-		fmt.Sprintf("random-check-%d.%s", time.Now().UnixNano()+1, domain),
-		fmt.Sprintf("notexist-%d.%s", time.Now().UnixNano()+2, domain),
+// DetectWildcard 检测域名的泛解析，结果可通过 Wildcard 查询
+func (s *ActiveScanner) DetectWildcard(ctx context.Context, domain string) *WildcardPool {
+	cname := s.cname
+	if cname == nil {
+		cname = s.lookupCNAME
+	}
+	pool := DetectWildcard(ctx, domain, WildcardProbeCount, s.resolve, cname)
+	s.wildcards.Store(domain, pool)
+
+	if !pool.Detected() {
+		log.Printf("[ActiveScanner] No wildcard detected for %s (%d/%d random labels resolved)", domain, pool.Hits, pool.Probes)
+		return pool
+	}
+	if s.config.WildcardHTTPConfirm {
+		pool.PrepareHTTPConfirm(ctx, s.hashBody())
 	}
+	log.Printf("[ActiveScanner] Wildcard detected for %s: %d/%d random labels resolved, IP pool: %v, CNAME: %q, HTTP confirm: %v",
+		domain, pool.Hits, pool.Probes, pool.IPs(), pool.CNAME, pool.BodyHash != "")
+	return pool
+}
 
-	ipCounts := make(map[string]int)
+// FilterWildcard 过滤字典爆破结果中的泛解析子域名（子域名 -> IP），返回保留的结果
+// 开启 HTTP 确认时，DNS 判定为泛解析但响应体与随机子域名不同的结果仍然保留
+func (s *ActiveScanner) FilterWildcard(ctx context.Context, pool *WildcardPool, results map[string][]string) map[string][]string {
+	if !pool.Detected() {
+		return results
+	}
 
-	for _, testDomain := range testDomains {
-		if ips, err := s.resolveDomain(testDomain); err == nil {
-			for _, ip := range ips {
-				ipCounts[ip]++
+	cname := s.cname
+	if cname == nil {
+		cname = s.lookupCNAME
+	}
+	hash := s.hashBody()
+	kept := make(map[string][]string, len(results))
+	minConfidence := 1.0
+	for sub, ips := range results {
+		wildcard, confidence := pool.Classify(ips, "")
+		if !wildcard && pool.CNAME != "" {
+			// IP 不在池中时再比较 CNAME（轮换 IP 池之外的泛解析）
+			if target, err := cname(ctx, sub); err == nil {
+				wildcard, confidence = pool.Classify(ips, target)
 			}
 		}
+		if wildcard && pool.BodyHash != "" && !pool.ConfirmWildcard(ctx, sub, hash) {
+			pool.RecordConfirmed()
+			log.Printf("[ActiveScanner] %s matches wildcard DNS (confidence %.2f) but serves different content, kept", sub, confidence)
+			wildcard = false
+		}
+		if wildcard {
+			pool.RecordFiltered(confidence)
+			if confidence < minConfidence {
+				minConfidence = confidence
+			}
+			continue
+		}
+		kept[sub] = ips
 	}
 
-	// 如果多个随机域名解析到相同IP，则认为是泛解析
-	var wildcardIPs []string
-	for ip, count := range ipCounts {
-		if count >= 2 {
-			wildcardIPs = append(wildcardIPs, ip)
-		}
+	if filtered := pool.Filtered(); filtered > 0 {
+		log.Printf("[ActiveScanner] Wildcard filter for %s: filtered %d of %d candidates (avg confidence %.2f, min %.2f), %d kept after HTTP confirm",
+			pool.Domain, filtered, len(results), pool.AverageConfidence(), minConfidence, pool.Confirmed())
+	}
+	return kept
+}
+
+// Wildcard 域名最近一次字典爆破的泛解析检测结果，未检测时返回 nil
+func (s *ActiveScanner) Wildcard(domain string) *WildcardPool {
+	if pool, ok := s.wildcards.Load(domain); ok {
+		return pool.(*WildcardPool)
+	}
+	return nil
+}
+
+// SetCNAMEResolver 设置 CNAME 查询函数（默认使用内置 DNS 服务器池）
+func (s *ActiveScanner) SetCNAMEResolver(fn CNAMEFunc) {
+	s.cname = fn
+}
+
+// SetBodyHasher 设置泛解析 HTTP 确认的响应体 hash 函数（默认 HTTPBodyHash）
+func (s *ActiveScanner) SetBodyHasher(fn BodyHashFunc) {
+	s.bodyHash = fn
+}
+
+func (s *ActiveScanner) hashBody() BodyHashFunc {
+	if s.bodyHash != nil {
+		return s.bodyHash
 	}
+	return HTTPBodyHash
+}
 
-	return wildcardIPs
+// lookupCNAME 使用内置 DNS 服务器池（或自定义 DNS 服务器）查询 CNAME
+func (s *ActiveScanner) lookupCNAME(ctx context.Context, host string) (string, error) {
+	timeout := s.resolveTimeout()
+	resolver := s.dns
+	if resolver == nil {
+		dnsServer := dnsServers[rand.Intn(len(dnsServers))]
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: time.Duration(timeout) * time.Second}
+				return d.DialContext(ctx, "udp", dnsServer)
+			},
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	target, err := resolver.LookupCNAME(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if target = normalizeCNAME(target); target == strings.ToLower(host) {
+		return "", nil
+	}
+	return target, nil
 }
 
 // addResult 添加结果
-func (s *ActiveScanner) addResult(subdomain string, ips []string, source string) {
+func (s *ActiveScanner) addResult(subdomain string, ips []string, source string, resolution string) {
+	// 数据源可能返回 Unicode 或大小写混合的 punycode，按 punycode 去重
+	subdomain = core.ToASCIIDomain(subdomain)
+
 	// 提取域名部分
 	result := &SubdomainResult{
 		Subdomain:  subdomain,
 		FullDomain: subdomain,
 		IPs:        ips,
-		Alive:      true,
+		Alive:      resolution == ResolutionResolved,
+		Resolution: resolution,
 	}
 
-	// 去重存储
-	if _, loaded := s.results.LoadOrStore(subdomain, result); !loaded {
-		log.Printf("[ActiveScanner] Found: %s -> %v (%s)", subdomain, ips, source)
-		
-		// 调用回调函数（如果设置了）
-		if s.callback != nil {
-			s.callback(*result)
+	// 去重存储；先到的被动来源记录无法解析、之后被其他来源（如 ksubdomain）解析成功时，
+	// 用可解析的记录替换并再次回调，避免丢弃存活的子域名
+	for {
+		stored, loaded := s.results.LoadOrStore(subdomain, result)
+		if !loaded {
+			log.Printf("[ActiveScanner] Found: %s -> %v (%s)", subdomain, ips, source)
+			break
+		}
+		if existing, ok := stored.(*SubdomainResult); !ok || IsResolved(existing.Resolution) || resolution != ResolutionResolved {
+			return
 		}
+		if s.results.CompareAndSwap(subdomain, stored, result) {
+			log.Printf("[ActiveScanner] Resolved: %s -> %v (%s)", subdomain, ips, source)
+			break
+		}
+	}
+
+	// 调用回调函数（如果设置了）
+	if s.callback != nil {
+		s.callback(*result)
 	}
 }
 
+// Results 获取去重后的扫描结果
+func (s *ActiveScanner) Results() []SubdomainResult {
+	var results []SubdomainResult
+	s.results.Range(func(key, value interface{}) bool {
+		if result, ok := value.(*SubdomainResult); ok {
+			results = append(results, *result)
+		}
+		return true
+	})
+	return results
+}
+
 // ScanWithCallback 使用回调函数进行扫描
 func (s *ActiveScanner) ScanWithCallback(ctx context.Context, domain string, callback func(SubdomainResult)) error {
 	s.callback = callback
@@ -2,9 +2,11 @@ package subdomain
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,16 +16,18 @@ import (
 
 // CDNResult represents CDN detection result
 type CDNResult struct {
-	Domain      string   `json:"domain"`
-	IsCDN       bool     `json:"is_cdn"`
-	CDNProvider string   `json:"cdn_provider,omitempty"`
-	CDNType     string   `json:"cdn_type,omitempty"` // commercial, cloud, unknown
-	IPs         []string `json:"ips"`
-	CNAMEs      []string `json:"cnames,omitempty"`
-	Headers     []string `json:"cdn_headers,omitempty"`
-	RealIPs     []string `json:"real_ips,omitempty"`
-	Confidence  int      `json:"confidence"` // 0-100
-	Method      string   `json:"method,omitempty"`
+	Domain         string   `json:"domain"`
+	IsCDN          bool     `json:"is_cdn"`
+	CDNProvider    string   `json:"cdn_provider,omitempty"`
+	CDNType        string   `json:"cdn_type,omitempty"` // commercial, cloud, unknown
+	IPs            []string `json:"ips"`
+	CNAMEs         []string `json:"cnames,omitempty"`
+	Headers        []string `json:"cdn_headers,omitempty"`
+	HeaderProvider string   `json:"header_provider,omitempty"` // provider suggested by headers, not decisive on its own
+	RealIPs        []string `json:"real_ips,omitempty"`
+	Confidence     int      `json:"confidence"` // 0-100
+	Method         string   `json:"method,omitempty"`
+	Evidence       string   `json:"evidence,omitempty"` // matched CNAME, IP range and corroborating headers
 }
 
 // CDNDetector handles CDN detection
@@ -33,6 +37,9 @@ type CDNDetector struct {
 	CNAMEMap    map[string]string // CNAME pattern -> CDN name
 	HeaderMap   map[string]string // Header name -> CDN name
 	IPRanges    map[string][]*net.IPNet
+
+	lookupIP    ResolveFunc     // 为空时使用系统解析
+	lookupCNAME CNAMELookupFunc // 跟踪 CNAME 链的单跳查询
 }
 
 // NewCDNDetector creates a new CDN detector
@@ -48,7 +55,39 @@ func NewCDNDetector() *CDNDetector {
 		CNAMEMap:  loadCNAMEMapFromConfig(),
 		HeaderMap: loadHeaderMapFromConfig(),
 		IPRanges:  loadIPRangesFromConfig(),
+
+		lookupCNAME: defaultCNAMELookup,
+	}
+}
+
+// SetIPLookup sets the function used to resolve domain IPs (e.g. a shared ResolverPool)
+func (d *CDNDetector) SetIPLookup(fn ResolveFunc) {
+	d.lookupIP = fn
+}
+
+// SetCNAMELookup sets the single-hop CNAME lookup used to follow CNAME chains
+func (d *CDNDetector) SetCNAMELookup(fn CNAMELookupFunc) {
+	if fn != nil {
+		d.lookupCNAME = fn
+	}
+}
+
+// resolveIPs resolves domain IPs via the configured lookup or the system resolver
+func (d *CDNDetector) resolveIPs(ctx context.Context, domain string) ([]net.IP, error) {
+	if d.lookupIP == nil {
+		return net.DefaultResolver.LookupIP(ctx, "ip", domain)
+	}
+	ips, err := d.lookupIP(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if addr := net.ParseIP(ip); addr != nil {
+			addrs = append(addrs, addr)
+		}
 	}
+	return addrs, nil
 }
 
 // loadCNAMEMapFromConfig loads CNAME patterns from configuration
@@ -89,7 +128,9 @@ func loadIPRangesFromConfig() map[string][]*net.IPNet {
 			for _, cidr := range cidrs {
 				_, ipnet, err := net.ParseCIDR(cidr)
 				if err == nil && ipnet != nil {
-					ranges[provider] = append(ranges[provider], ipnet)
+					// ip_ranges keys use underscores (AWS_CloudFront), CNAME patterns use display names
+					name := strings.ReplaceAll(provider, "_", " ")
+					ranges[name] = append(ranges[name], ipnet)
 				}
 			}
 		}
@@ -99,7 +140,7 @@ func loadIPRangesFromConfig() map[string][]*net.IPNet {
 	}
 	
 	// Fallback to minimal Cloudflare ranges
-	defaultRanges := []string{"104.16.0.0/13", "104.24.0.0/14"}
+	defaultRanges := []string{"104.16.0.0/13", "104.24.0.0/14", "2606:4700::/32", "2400:cb00::/32"}
 	for _, cidr := range defaultRanges {
 		_, ipnet, _ := net.ParseCIDR(cidr)
 		if ipnet != nil {
@@ -111,246 +152,238 @@ func loadIPRangesFromConfig() map[string][]*net.IPNet {
 
 // DetectCDN performs CDN detection for a domain
 func (d *CDNDetector) DetectCDN(ctx context.Context, domain string) *CDNResult {
-	result := &CDNResult{
-		Domain:     domain,
-		IsCDN:      false,
-		Confidence: 0,
-	}
+	return d.Detect(ctx, domain, nil, nil)
+}
 
+// Detect performs CDN detection for a domain whose CNAME chain and IPs may already be known
+// (e.g. from subdomain verification). The chain is resolved only when unknown; IPs are always
+// resolved (a shared ResolverPool answers from cache) and merged with the known ones, since
+// passive sources often report IPv4 addresses only
+func (d *CDNDetector) Detect(ctx context.Context, domain string, cnames, ips []string) *CDNResult {
 	var wg sync.WaitGroup
-	var mu sync.Mutex
+	var headers http.Header
+	var resolved []string
 
-	// 1. Check CNAME
+	if len(cnames) == 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cnames = resolveCNAMEChain(ctx, d.lookupCNAME, domain)
+		}()
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		cnames, cdnName := d.checkCNAME(domain)
-		mu.Lock()
-		result.CNAMEs = cnames
-		if cdnName != "" {
-			result.IsCDN = true
-			result.CDNProvider = cdnName
-			result.Confidence += 50
-			result.Method = "CNAME"
-		}
-		mu.Unlock()
+		resolved = d.lookupIPs(ctx, domain)
 	}()
-
-	// 2. Check HTTP headers
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		headers, cdnName := d.checkHeaders(ctx, domain)
-		mu.Lock()
-		result.Headers = headers
-		if cdnName != "" {
-			result.IsCDN = true
-			if result.CDNProvider == "" {
-				result.CDNProvider = cdnName
-			}
-			result.Confidence += 30
-			if result.Method == "" {
-				result.Method = "HTTP Header"
-			} else {
-				result.Method += ",HTTP Header"
-			}
-		}
-		mu.Unlock()
+		headers = d.fetchHeaders(ctx, domain)
 	}()
+	wg.Wait()
 
-	// 3. Check IP ranges
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		ips, cdnName := d.checkIPRange(domain)
-		mu.Lock()
-		result.IPs = ips
-		if cdnName != "" {
-			result.IsCDN = true
-			if result.CDNProvider == "" {
-				result.CDNProvider = cdnName
-			}
-			result.Confidence += 20
-			if result.Method == "" {
-				result.Method = "IP Range"
-			} else {
-				result.Method += ",IP Range"
-			}
-		}
-		mu.Unlock()
-	}()
+	result := d.evaluate(cnames, uniqueStrings(append(append([]string{}, ips...), resolved...)), headers)
+	result.Domain = domain
+	return result
+}
 
-	// 4. Check multiple IPs (multi-region CDN characteristic)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		hasMultiIP := d.checkMultipleIPs(domain)
-		mu.Lock()
-		if hasMultiIP && result.IsCDN {
-			result.Confidence += 10
+// Evaluate decides whether a host is behind a CDN from its CNAME chain, resolved IPs and response headers.
+// A CNAME pattern or IP range match is required: header patterns only corroborate, since WAFs and
+// reverse proxies send many of the same headers. Returns whether it is a CDN, the provider and the evidence
+func (d *CDNDetector) Evaluate(cnames, ips []string, headers http.Header) (bool, string, string) {
+	result := d.evaluate(cnames, ips, headers)
+	return result.IsCDN, result.CDNProvider, result.Evidence
+}
+
+// evaluate builds the detection result for Detect and Evaluate
+func (d *CDNDetector) evaluate(cnames, ips []string, headers http.Header) *CDNResult {
+	result := &CDNResult{CNAMEs: cnames, IPs: ips}
+	var methods, evidence []string
+
+	if cname, pattern, provider := d.matchCNAME(cnames); provider != "" {
+		result.CDNProvider = provider
+		result.Confidence += 50
+		methods = append(methods, "CNAME")
+		evidence = append(evidence, fmt.Sprintf("cname %s matches %s (%s)", cname, pattern, provider))
+	}
+	if ip, ipnet, provider := d.matchIPRange(ips); provider != "" {
+		if result.CDNProvider == "" {
+			result.CDNProvider = provider
 		}
-		mu.Unlock()
-	}()
+		result.Confidence += 20
+		methods = append(methods, "IP Range")
+		evidence = append(evidence, fmt.Sprintf("ip %s in %s (%s)", ip, ipnet, provider))
+	}
 
-	wg.Wait()
+	result.Headers, result.HeaderProvider = d.matchHeaders(headers)
+	if len(methods) == 0 {
+		return result
+	}
 
-	// Cap confidence at 100
+	result.IsCDN = true
+	if len(result.Headers) > 0 {
+		result.Confidence += 30
+		methods = append(methods, "HTTP Header")
+		evidence = append(evidence, fmt.Sprintf("header %s (%s)", strings.Join(result.Headers, ", "), result.HeaderProvider))
+	}
+	// Multiple IPs are a multi-region CDN characteristic
+	if len(uniqueStrings(ips)) >= 2 {
+		result.Confidence += 10
+	}
 	if result.Confidence > 100 {
 		result.Confidence = 100
 	}
+	result.Method = strings.Join(methods, ",")
+	result.Evidence = strings.Join(evidence, "; ")
+	result.CDNType = classifyCDNType(result.CDNProvider)
+	return result
+}
 
-	// Classify CDN type
-	if result.CDNProvider != "" {
-		result.CDNType = classifyCDNType(result.CDNProvider)
+// matchCNAME returns the first CNAME in the chain matching a CDN pattern, preferring the longest pattern
+func (d *CDNDetector) matchCNAME(cnames []string) (string, string, string) {
+	for _, cname := range cnames {
+		lowerCname := strings.ToLower(strings.TrimSuffix(cname, "."))
+		var best string
+		for pattern := range d.CNAMEMap {
+			if strings.Contains(lowerCname, pattern) && (len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best)) {
+				best = pattern
+			}
+		}
+		if best != "" {
+			return lowerCname, best, d.CNAMEMap[best]
+		}
 	}
-
-	return result
+	return "", "", ""
 }
 
-// checkCNAME checks CNAME records for CDN patterns
-func (d *CDNDetector) checkCNAME(domain string) ([]string, string) {
-	var cnames []string
-	var cdnName string
+// matchIPRange returns the first IP inside a known CDN range, preferring the most specific range.
+// IPv4-mapped IPv6 addresses are checked as IPv4; IPv6 addresses only match IPv6 ranges
+func (d *CDNDetector) matchIPRange(ips []string) (string, string, string) {
+	providers := make([]string, 0, len(d.IPRanges))
+	for provider := range d.IPRanges {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
 
-	cname, err := net.LookupCNAME(domain)
-	if err == nil && cname != "" {
-		cname = strings.TrimSuffix(cname, ".")
-		cnames = append(cnames, cname)
+	for _, ip := range ips {
+		addr := net.ParseIP(strings.TrimSpace(ip))
+		if addr == nil {
+			continue
+		}
+		if ipv4 := addr.To4(); ipv4 != nil {
+			addr = ipv4
+		}
 
-		// Check against known CDN patterns
-		lowerCname := strings.ToLower(cname)
-		for pattern, name := range d.CNAMEMap {
-			if strings.Contains(lowerCname, pattern) {
-				cdnName = name
-				break
+		var best *net.IPNet
+		var bestProvider string
+		bestOnes := -1
+		for _, provider := range providers {
+			for _, ipnet := range d.IPRanges[provider] {
+				if ones, _ := ipnet.Mask.Size(); ipnet.Contains(addr) && ones > bestOnes {
+					best, bestProvider, bestOnes = ipnet, provider, ones
+				}
 			}
 		}
+		if best != nil {
+			return addr.String(), best.String(), bestProvider
+		}
 	}
+	return "", "", ""
+}
 
-	return cnames, cdnName
+// cdnServerKeywords maps Server header keywords to CDN providers
+var cdnServerKeywords = map[string]string{
+	"cloudflare":  "Cloudflare",
+	"akamaighost": "Akamai",
+	"yunjiasu":    "百度云加速",
+	"upyun":       "又拍云CDN",
+	"tengine":     "阿里云CDN",
 }
 
-// checkHeaders checks HTTP response headers for CDN signatures
-func (d *CDNDetector) checkHeaders(ctx context.Context, domain string) ([]string, string) {
-	var cdnHeaders []string
-	var cdnName string
+// matchHeaders returns the response headers matching CDN header patterns and the first matched provider
+func (d *CDNDetector) matchHeaders(headers http.Header) ([]string, string) {
+	if len(headers) == 0 {
+		return nil, ""
+	}
 
-	urls := []string{
-		"https://" + domain,
-		"http://" + domain,
+	patterns := make([]string, 0, len(d.HeaderMap))
+	for pattern := range d.HeaderMap {
+		patterns = append(patterns, pattern)
 	}
+	sort.Strings(patterns)
 
-	for _, url := range urls {
-		req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
-		if err != nil {
+	var cdnHeaders []string
+	var cdnName string
+	for _, pattern := range patterns {
+		parts := strings.SplitN(pattern, ":", 2)
+		headerName := http.CanonicalHeaderKey(strings.TrimSpace(parts[0]))
+		value := headers.Get(headerName)
+		if value == "" {
 			continue
 		}
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
-		resp, err := d.HTTPClient.Do(req)
-		if err != nil {
+		// "name:value" patterns also require the header value to match
+		if len(parts) == 2 && !strings.Contains(strings.ToLower(value), strings.ToLower(strings.TrimSpace(parts[1]))) {
 			continue
 		}
-		defer resp.Body.Close()
-
-		// Check headers
-		for header, cdn := range d.HeaderMap {
-			parts := strings.SplitN(header, ":", 2)
-			headerName := parts[0]
-			
-			value := resp.Header.Get(headerName)
-			if value != "" {
-				if len(parts) == 2 {
-					// Check header value
-					if strings.Contains(strings.ToLower(value), strings.ToLower(strings.TrimSpace(parts[1]))) {
-						cdnHeaders = append(cdnHeaders, headerName+": "+value)
-						if cdnName == "" {
-							cdnName = cdn
-						}
-					}
-				} else {
-					cdnHeaders = append(cdnHeaders, headerName+": "+value)
-					if cdnName == "" {
-						cdnName = cdn
-					}
-				}
-			}
+		cdnHeaders = append(cdnHeaders, headerName+": "+value)
+		if cdnName == "" {
+			cdnName = d.HeaderMap[pattern]
 		}
+	}
 
-		// Check Server header
-		server := resp.Header.Get("Server")
-		if server != "" {
-			lowerServer := strings.ToLower(server)
-			for keyword, cdn := range map[string]string{
-				"cloudflare": "Cloudflare",
-				"akamaighost": "Akamai",
-				"yunjiasu": "百度云加速",
-				"upyun": "又拍云CDN",
-				"tengine": "阿里云CDN",
-			} {
-				if strings.Contains(lowerServer, keyword) {
-					cdnName = cdn
-					break
-				}
-			}
+	if server := headers.Get("Server"); server != "" {
+		lowerServer := strings.ToLower(server)
+		keywords := make([]string, 0, len(cdnServerKeywords))
+		for keyword := range cdnServerKeywords {
+			keywords = append(keywords, keyword)
 		}
-
-		if cdnName != "" {
-			break
+		sort.Strings(keywords)
+		for _, keyword := range keywords {
+			if strings.Contains(lowerServer, keyword) {
+				cdnHeaders = append(cdnHeaders, "Server: "+server)
+				cdnName = cdnServerKeywords[keyword]
+				break
+			}
 		}
 	}
 
 	return cdnHeaders, cdnName
 }
 
-// checkIPRange checks if resolved IPs belong to known CDN ranges
-func (d *CDNDetector) checkIPRange(domain string) ([]string, string) {
-	var ips []string
-	var cdnName string
-
-	addrs, err := net.LookupIP(domain)
-	if err != nil {
-		return ips, cdnName
-	}
+// fetchHeaders fetches the response headers of the domain over HTTPS, falling back to HTTP
+func (d *CDNDetector) fetchHeaders(ctx context.Context, domain string) http.Header {
+	for _, url := range []string{"https://" + domain, "http://" + domain} {
+		req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
 
-	for _, addr := range addrs {
-		if ipv4 := addr.To4(); ipv4 != nil {
-			ips = append(ips, ipv4.String())
-
-			// Check against known CDN IP ranges
-			for cdn, ranges := range d.IPRanges {
-				for _, ipnet := range ranges {
-					if ipnet.Contains(ipv4) {
-						cdnName = cdn
-						break
-					}
-				}
-				if cdnName != "" {
-					break
-				}
-			}
+		resp, err := d.HTTPClient.Do(req)
+		if err != nil {
+			continue
 		}
+		resp.Body.Close()
+		return resp.Header
 	}
-
-	return ips, cdnName
+	return nil
 }
 
-// checkMultipleIPs checks if domain resolves to multiple IPs (CDN characteristic)
-func (d *CDNDetector) checkMultipleIPs(domain string) bool {
-	addrs, err := net.LookupIP(domain)
+// lookupIPs resolves domain IPs (IPv4 and IPv6) as strings
+func (d *CDNDetector) lookupIPs(ctx context.Context, domain string) []string {
+	addrs, err := d.resolveIPs(ctx, domain)
 	if err != nil {
-		return false
+		return nil
 	}
-
-	// Count unique IPv4 addresses
-	uniqueIPs := make(map[string]bool)
+	ips := make([]string, 0, len(addrs))
 	for _, addr := range addrs {
 		if ipv4 := addr.To4(); ipv4 != nil {
-			uniqueIPs[ipv4.String()] = true
+			addr = ipv4
 		}
+		ips = append(ips, addr.String())
 	}
-
-	return len(uniqueIPs) >= 2
+	return ips
 }
 
 // classifyCDNType classifies CDN provider type
@@ -25,6 +25,7 @@ type SubdomainResult struct {
 	IPs         []string `json:"ips,omitempty"`
 	CNAMEs      []string `json:"cnames,omitempty"`
 	Alive       bool     `json:"alive"`
+	Resolution  string   `json:"resolution,omitempty"` // 解析状态: resolved, unresolved, nxdomain, unverified
 	HTTPStatus  int      `json:"http_status,omitempty"`
 	HTTPSStatus int      `json:"https_status,omitempty"`
 	Title       string   `json:"title,omitempty"`
@@ -42,11 +43,14 @@ type DomainScanResult struct {
 	Found        int               `json:"found"`
 	StartTime    time.Time         `json:"start_time"`
 	EndTime      time.Time         `json:"end_time"`
-	Duration     string            `json:"duration"`
+	DurationMs   int64            `json:"duration_ms"`
 	Subdomains   []SubdomainResult `json:"subdomains"`
 	NSRecords    []string          `json:"ns_records,omitempty"`
 	MXRecords    []string          `json:"mx_records,omitempty"`
 	TXTRecords   []string          `json:"txt_records,omitempty"`
+	WildcardIPs      []string `json:"wildcard_ips,omitempty"`      // 泛解析 IP 池
+	WildcardCNAME    string   `json:"wildcard_cname,omitempty"`    // 泛解析 CNAME 目标
+	WildcardFiltered int      `json:"wildcard_filtered,omitempty"` // 被泛解析过滤的子域名数
 }
 
 // DomainInfo represents basic domain information
@@ -66,7 +70,8 @@ type DomainScanner struct {
 	Concurrency  int
 	Resolvers    []string
 	EnableHTTP   bool // 是否启用HTTP探测（会变慢但获取更多信息）
-	WildcardIPs  map[string]bool // 泛解析IP记录
+	WildcardHTTPConfirm bool // 对判定为泛解析的结果比较 HTTP 响应体再次确认
+	wildcards    sync.Map // 根域名 -> *WildcardPool
 }
 
 // NewDomainScanner creates a new domain scanner
@@ -87,7 +92,6 @@ func NewDomainScanner(concurrency int) *DomainScanner {
 			"119.29.29.29:53",  // DNSPod
 			"180.76.76.76:53", // 百度DNS
 		},
-		WildcardIPs: make(map[string]bool),
 	}
 }
 
@@ -199,18 +203,18 @@ func (s *DomainScanner) CheckSubdomain(ctx context.Context, subdomain, domain st
 		result.IPs = append(result.IPs, ipStr)
 	}
 
-	// 检查是否命中泛解析IP
-	if s.isWildcardIP(result.IPs) {
-		result.Alive = false
-		return result
-	}
-
 	// Try to get CNAME (使用新的resolver)
 	cname, err := resolver.LookupCNAME(queryCtx, fullDomain)
 	if err == nil && cname != "" && cname != fullDomain+"." {
 		result.CNAMEs = append(result.CNAMEs, strings.TrimSuffix(cname, "."))
 	}
 
+	// 检查是否为泛解析结果
+	if s.isWildcard(ctx, domain, result) {
+		result.Alive = false
+		return result
+	}
+
 	// Check for CDN based on CNAME and IP
 	result.CDN, result.CDNProvider = s.detectCDN(result.CNAMEs, result.IPs)
 
@@ -222,30 +226,31 @@ func (s *DomainScanner) CheckSubdomain(ctx context.Context, subdomain, domain st
 	return result
 }
 
-// isWildcardIP checks if IPs match wildcard DNS records
-func (s *DomainScanner) isWildcardIP(ips []string) bool {
-	if len(s.WildcardIPs) == 0 {
+// isWildcard checks whether a resolved subdomain is a wildcard DNS answer of its root domain
+func (s *DomainScanner) isWildcard(ctx context.Context, domain string, result *SubdomainResult) bool {
+	value, ok := s.wildcards.Load(domain)
+	if !ok {
 		return false
 	}
-	for _, ip := range ips {
-		if s.WildcardIPs[ip] {
-			return true
-		}
+	pool := value.(*WildcardPool)
+	cname := ""
+	if len(result.CNAMEs) > 0 {
+		cname = result.CNAMEs[0]
+	}
+	wildcard, confidence := pool.Classify(result.IPs, cname)
+	if !wildcard {
+		return false
+	}
+	if pool.BodyHash != "" && !pool.ConfirmWildcard(ctx, result.FullDomain, HTTPBodyHash) {
+		pool.RecordConfirmed()
+		return false
 	}
-	return false
+	pool.RecordFiltered(confidence)
+	return true
 }
 
 // detectWildcardDNS detects wildcard DNS for a domain
-func (s *DomainScanner) detectWildcardDNS(ctx context.Context, domain string) {
-	s.WildcardIPs = make(map[string]bool)
-	
-	// 生成随机子域名测试泛解析
-	testSubdomains := []string{
-		generateRandomString(8),
-		generateRandomString(10),
-		generateRandomString(12),
-	}
-	
+func (s *DomainScanner) detectWildcardDNS(ctx context.Context, domain string) *WildcardPool {
 	resolver := &net.Resolver{
 		PreferGo: true,
 		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
@@ -254,37 +259,31 @@ func (s *DomainScanner) detectWildcardDNS(ctx context.Context, domain string) {
 			return d.DialContext(ctx, "udp", resolverAddr)
 		},
 	}
-	
-	wildcardCount := 0
-	for _, sub := range testSubdomains {
-		testDomain := sub + "." + domain
+	resolve := func(ctx context.Context, host string) ([]string, error) {
 		queryCtx, cancel := context.WithTimeout(ctx, s.Timeout)
-		ips, err := resolver.LookupIP(queryCtx, "ip4", testDomain)
-		cancel()
-		
-		if err == nil && len(ips) > 0 {
-			wildcardCount++
-			for _, ip := range ips {
-				s.WildcardIPs[ip.String()] = true
-			}
+		defer cancel()
+		ips, err := resolver.LookupIP(queryCtx, "ip4", host)
+		if err != nil {
+			return nil, err
 		}
+		result := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			result = append(result, ip.String())
+		}
+		return result, nil
 	}
-	
-	// 如果3个随机子域名都有解析，认为存在泛解析
-	if wildcardCount < 2 {
-		s.WildcardIPs = make(map[string]bool) // 清空，不是泛解析
+	cname := func(ctx context.Context, host string) (string, error) {
+		queryCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+		return resolver.LookupCNAME(queryCtx, host)
 	}
-}
 
-// generateRandomString generates a random string for wildcard detection
-func generateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
-		time.Sleep(time.Nanosecond) // 确保随机性
+	pool := DetectWildcard(ctx, domain, WildcardProbeCount, resolve, cname)
+	if s.WildcardHTTPConfirm {
+		pool.PrepareHTTPConfirm(ctx, HTTPBodyHash)
 	}
-	return string(b)
+	s.wildcards.Store(domain, pool)
+	return pool
 }
 
 // httpProbe performs HTTP/HTTPS probing to get title, status code, etc.
@@ -516,15 +515,14 @@ func (s *DomainScanner) BruteSubdomains(ctx context.Context, domain string, word
 	}
 
 	// 先检测泛解析
-	s.detectWildcardDNS(ctx, domain)
-	if len(s.WildcardIPs) > 0 {
+	pool := s.detectWildcardDNS(ctx, domain)
+	if pool.Detected() {
 		// 记录泛解析信息
-		var wildcardIPList []string
-		for ip := range s.WildcardIPs {
-			wildcardIPList = append(wildcardIPList, ip)
-		}
-		fmt.Printf("[*] 检测到泛解析域名 %s, 泛解析IP: %v\n", domain, wildcardIPList)
+		result.WildcardIPs = pool.IPs()
+		result.WildcardCNAME = pool.CNAME
+		fmt.Printf("[*] 检测到泛解析域名 %s, 泛解析IP: %v, CNAME: %s\n", domain, result.WildcardIPs, pool.CNAME)
 	}
+	defer s.wildcards.Delete(domain)
 
 	// Get domain info first
 	domainInfo := s.GetDomainInfo(ctx, domain)
@@ -541,8 +539,9 @@ func (s *DomainScanner) BruteSubdomains(ctx context.Context, domain string, word
 	for i := 0; i < len(wordlist); i += batchSize {
 		select {
 		case <-ctx.Done():
+			result.WildcardFiltered = pool.Filtered()
 			result.EndTime = time.Now()
-			result.Duration = result.EndTime.Sub(result.StartTime).String()
+			result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 			return result
 		default:
 		}
@@ -573,6 +572,10 @@ func (s *DomainScanner) BruteSubdomains(ctx context.Context, domain string, word
 	}
 
 	wg.Wait()
+	result.WildcardFiltered = pool.Filtered()
+	if result.WildcardFiltered > 0 {
+		fmt.Printf("[*] %s 泛解析过滤 %d 个子域名, 平均置信度 %.2f\n", domain, result.WildcardFiltered, pool.AverageConfidence())
+	}
 
 	// Sort by subdomain name
 	sort.Slice(result.Subdomains, func(i, j int) bool {
@@ -580,7 +583,7 @@ func (s *DomainScanner) BruteSubdomains(ctx context.Context, domain string, word
 	})
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	return result
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 
 	"github.com/boy-hack/ksubdomain/v2/pkg/core/options"
 	"github.com/boy-hack/ksubdomain/v2/pkg/device"
@@ -14,7 +15,8 @@ import (
 
 // KSubdomainRunner wraps ksubdomain logic
 type KSubdomainRunner struct {
-	options *options.Options
+	options   *options.Options
+	resolvers []string // DNS server IPs, nil uses the ksubdomain defaults
 }
 
 // NewKSubdomainRunner creates a new runner
@@ -22,6 +24,18 @@ func NewKSubdomainRunner() *KSubdomainRunner {
 	return &KSubdomainRunner{}
 }
 
+// SetResolvers sets the DNS servers (host:port, queried on port 53)
+func (k *KSubdomainRunner) SetResolvers(servers []string) {
+	k.resolvers = nil
+	for _, server := range servers {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			host = server
+		}
+		k.resolvers = append(k.resolvers, host)
+	}
+}
+
 // resultCollector implements outputter.Output to capture results
 type resultCollector struct {
 	results map[string][]string
@@ -59,7 +73,7 @@ func (k *KSubdomainRunner) RunEnumeration(ctx context.Context, domain string, di
 	opt := &options.Options{
 		Rate:      options.Band2Rate("5m"), // 5M bandwidth
 		Domain:    domainChan,
-		Resolvers: options.GetResolvers(nil),
+		Resolvers: options.GetResolvers(k.resolvers),
 		Silent:    true, // Silence stdout
 		TimeOut:   6,
 		Retry:     3,
@@ -111,7 +125,7 @@ func (k *KSubdomainRunner) Verify(ctx context.Context, domains []string) (map[st
 	opt := &options.Options{
 		Rate:      options.Band2Rate("5m"),
 		Domain:    domainChan,
-		Resolvers: options.GetResolvers(nil),
+		Resolvers: options.GetResolvers(k.resolvers),
 		Silent:    true,
 		TimeOut:   6,
 		Retry:     3,
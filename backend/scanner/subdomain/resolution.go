@@ -0,0 +1,102 @@
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+)
+
+// 子域名解析状态
+const (
+	ResolutionResolved   = "resolved"   // 当前可解析
+	ResolutionUnresolved = "unresolved" // 解析失败（超时、SERVFAIL 等），可能是历史记录
+	ResolutionNXDomain   = "nxdomain"   // 域名不存在
+	ResolutionUnverified = "unverified" // 未进行解析验证
+)
+
+// defaultResolveConcurrency 被动来源解析的默认并发数
+const defaultResolveConcurrency = 50
+
+// ResolveFunc 域名解析函数
+type ResolveFunc func(ctx context.Context, domain string) ([]string, error)
+
+// SetResolver 设置解析函数（默认使用内置 DNS 服务器池）
+func (s *ActiveScanner) SetResolver(fn ResolveFunc) {
+	s.resolver = fn
+}
+
+// IsResolved 解析状态是否表示当前可解析（未验证的视为可扫描）
+func IsResolved(resolution string) bool {
+	return resolution == ResolutionResolved || resolution == ResolutionUnverified || resolution == ""
+}
+
+// classifyResolution 根据解析结果判断解析状态
+func classifyResolution(ips []string, err error) string {
+	if err == nil && len(ips) > 0 {
+		return ResolutionResolved
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ResolutionNXDomain
+	}
+	return ResolutionUnresolved
+}
+
+// AddPassiveResults 添加被动来源（subfinder、第三方 API）发现的子域名
+// 被动来源的记录可能是历史数据，API 返回的 IP 也不代表当前解析，
+// 因此统一通过解析器池重新解析后再确定解析状态；VerifySubdomains=false 时不解析，标记为未验证
+func (s *ActiveScanner) AddPassiveResults(ctx context.Context, subdomains []string, source string) {
+	if !s.config.VerifySubdomains {
+		for _, sub := range subdomains {
+			s.addResult(sub, nil, source, ResolutionUnverified)
+		}
+		return
+	}
+
+	concurrency := s.config.ResolveConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultResolveConcurrency
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, sub := range subdomains {
+		// 已由其他来源确认可解析的子域名不再重复解析
+		if stored, exists := s.results.Load(sub); exists {
+			if existing, ok := stored.(*SubdomainResult); !ok || IsResolved(existing.Resolution) {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ips, err := s.resolve(ctx, name)
+			resolution := classifyResolution(ips, err)
+			if resolution != ResolutionResolved {
+				log.Printf("[ActiveScanner] %s from %s is %s", name, source, resolution)
+			}
+			s.addResult(name, ips, source, resolution)
+		}(sub)
+	}
+	wg.Wait()
+}
+
+// resolve 使用设置的解析函数或内置 DNS 服务器池解析域名
+func (s *ActiveScanner) resolve(ctx context.Context, domain string) ([]string, error) {
+	if s.resolver != nil {
+		return s.resolver(ctx, domain)
+	}
+	return s.resolveDomain(domain)
+}
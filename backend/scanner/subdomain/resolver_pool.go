@@ -0,0 +1,403 @@
+package subdomain
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"moongazing/scanner/core"
+
+	"github.com/miekg/dns"
+)
+
+// 共享解析器池
+// 一条流水线只创建一个实例：复用同一个 DNS 客户端轮询多个服务器，并按 TTL 缓存 host -> IPs，
+// 子域名扫描阶段解析过的主机在域名验证、端口扫描预处理阶段直接命中缓存，不再重复解析。
+// 未配置 DNS 服务器时使用系统解析器，扫描流量不会默认发往公共 DNS
+
+const (
+	defaultResolverCacheSize = 50000
+	defaultResolverTimeout   = 5 * time.Second
+	defaultResolverMinTTL    = 30 * time.Second // DNS 返回的 TTL 过短时使用
+	defaultResolverMaxTTL    = 30 * time.Minute
+	defaultSeedTTL           = 10 * time.Minute // 由扫描结果直接写入的记录
+	defaultNegativeTTL       = time.Minute      // NXDOMAIN
+	defaultSystemTTL         = 5 * time.Minute  // 系统解析器不返回 TTL，成功的解析按该时间缓存
+)
+
+// TTLResolveFunc 带 TTL 的解析函数，返回的 TTL 决定缓存时间
+type TTLResolveFunc func(ctx context.Context, host string) ([]string, time.Duration, error)
+
+// ResolverStats 解析器池统计
+type ResolverStats struct {
+	Requests int64   `json:"requests"` // 解析请求数
+	Hits     int64   `json:"hits"`     // 命中缓存（含等待同一主机进行中的查询）
+	Lookups  int64   `json:"lookups"`  // 实际 DNS 查询数
+	Entries  int     `json:"entries"`  // 当前缓存条目数
+	HitRate  float64 `json:"hit_rate"` // 命中率 0-1
+}
+
+// resolverEntry 缓存条目
+type resolverEntry struct {
+	host    string
+	ips     []string
+	err     error
+	expires time.Time
+}
+
+// resolverCall 进行中的查询，同一主机的并发请求等待同一次查询
+type resolverCall struct {
+	done chan struct{}
+	ips  []string
+	err  error
+}
+
+// ResolverPool 带 LRU 缓存的共享解析器
+type ResolverPool struct {
+	servers  []string
+	timeout  time.Duration
+	capacity int
+	lookup   TTLResolveFunc
+	client   *dns.Client
+	doh      *http.Client // 非 nil 时 servers 为 DoH 地址
+	next     uint32
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // 最近使用的在前
+	inflight map[string]*resolverCall
+
+	requests int64
+	hits     int64
+	lookups  int64
+}
+
+// NewResolverPool 创建解析器池，servers 为空使用系统解析器，capacity <= 0 使用默认缓存大小
+func NewResolverPool(servers []string, capacity int) *ResolverPool {
+	if capacity <= 0 {
+		capacity = defaultResolverCacheSize
+	}
+	p := &ResolverPool{
+		servers:  servers,
+		timeout:  defaultResolverTimeout,
+		capacity: capacity,
+		client:   &dns.Client{Timeout: defaultResolverTimeout},
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inflight: make(map[string]*resolverCall),
+	}
+	p.lookup = p.exchange
+	return p
+}
+
+// SetNetwork 使用任务配置的 DNS 服务器（或 DoH），未配置时保持原有服务器；需在开始解析前调用
+func (p *ResolverPool) SetNetwork(cfg *core.ScanNetworkConfig) {
+	if !cfg.HasResolvers() {
+		return
+	}
+	p.servers = cfg.ResolverServers()
+	p.doh = nil
+	if cfg.DoH {
+		p.doh = cfg.DoHClient(p.timeout)
+	}
+}
+
+// SetLookup 设置底层解析函数（默认直接查询 DNS 服务器池）
+func (p *ResolverPool) SetLookup(fn TTLResolveFunc) {
+	p.lookup = fn
+}
+
+// Resolve 解析主机，优先使用缓存；签名与 ResolveFunc 一致，可直接交给扫描器使用
+func (p *ResolverPool) Resolve(ctx context.Context, host string) ([]string, error) {
+	host = normalizeHost(host)
+	atomic.AddInt64(&p.requests, 1)
+
+	p.mu.Lock()
+	if entry, ok := p.getLocked(host); ok {
+		p.mu.Unlock()
+		atomic.AddInt64(&p.hits, 1)
+		return entry.ips, entry.err
+	}
+	if call, ok := p.inflight[host]; ok {
+		p.mu.Unlock()
+		atomic.AddInt64(&p.hits, 1)
+		select {
+		case <-call.done:
+			return call.ips, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &resolverCall{done: make(chan struct{})}
+	p.inflight[host] = call
+	p.mu.Unlock()
+
+	atomic.AddInt64(&p.lookups, 1)
+	ips, ttl, err := p.lookup(ctx, host)
+	call.ips, call.err = ips, err
+
+	p.mu.Lock()
+	delete(p.inflight, host)
+	if ttl > 0 && cacheable(ips, err) {
+		p.putLocked(host, ips, err, ttl)
+	}
+	p.mu.Unlock()
+	close(call.done)
+
+	return ips, err
+}
+
+// ResolveBatch 并发解析一组主机（自动去重），返回 host -> IPs，无法解析的主机不在结果中
+func (p *ResolverPool) ResolveBatch(ctx context.Context, hosts []string, concurrency int) map[string][]string {
+	if concurrency <= 0 {
+		concurrency = defaultResolveConcurrency
+	}
+
+	results := make(map[string][]string, len(hosts))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	seen := make(map[string]bool, len(hosts))
+
+	for _, host := range hosts {
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return results
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(h string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ips, err := p.Resolve(ctx, h)
+			if err == nil && len(ips) > 0 {
+				mu.Lock()
+				results[h] = ips
+				mu.Unlock()
+			}
+		}(host)
+	}
+	wg.Wait()
+	return results
+}
+
+// Add 写入已知的解析结果（如字典爆破得到的 IP），后续解析直接命中缓存
+func (p *ResolverPool) Add(host string, ips []string) {
+	if len(ips) == 0 {
+		return
+	}
+	host = normalizeHost(host)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.getLocked(host); ok && entry.err == nil {
+		return
+	}
+	p.putLocked(host, ips, nil, defaultSeedTTL)
+}
+
+// Cached 只查询缓存，不发起解析
+func (p *ResolverPool) Cached(host string) ([]string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.getLocked(normalizeHost(host))
+	if !ok || entry.err != nil {
+		return nil, false
+	}
+	return entry.ips, true
+}
+
+// Stats 获取统计信息
+func (p *ResolverPool) Stats() ResolverStats {
+	p.mu.Lock()
+	entries := p.order.Len()
+	p.mu.Unlock()
+
+	stats := ResolverStats{
+		Requests: atomic.LoadInt64(&p.requests),
+		Hits:     atomic.LoadInt64(&p.hits),
+		Lookups:  atomic.LoadInt64(&p.lookups),
+		Entries:  entries,
+	}
+	if stats.Requests > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Requests)
+	}
+	return stats
+}
+
+// getLocked 获取未过期的缓存条目（需要持有锁）
+func (p *ResolverPool) getLocked(host string) (*resolverEntry, bool) {
+	elem, ok := p.entries[host]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*resolverEntry)
+	if time.Now().After(entry.expires) {
+		p.order.Remove(elem)
+		delete(p.entries, host)
+		return nil, false
+	}
+	p.order.MoveToFront(elem)
+	return entry, true
+}
+
+// putLocked 写入缓存条目，超过容量时淘汰最久未使用的条目（需要持有锁）
+func (p *ResolverPool) putLocked(host string, ips []string, err error, ttl time.Duration) {
+	if ttl > defaultResolverMaxTTL {
+		ttl = defaultResolverMaxTTL
+	}
+	entry := &resolverEntry{host: host, ips: ips, err: err, expires: time.Now().Add(ttl)}
+	if elem, ok := p.entries[host]; ok {
+		elem.Value = entry
+		p.order.MoveToFront(elem)
+		return
+	}
+	p.entries[host] = p.order.PushFront(entry)
+	for p.order.Len() > p.capacity {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(*resolverEntry).host)
+	}
+}
+
+// cacheable 成功的解析和 NXDOMAIN 可以缓存，超时等临时错误不缓存
+func cacheable(ips []string, err error) bool {
+	if err == nil {
+		return len(ips) > 0
+	}
+	return classifyResolution(nil, err) == ResolutionNXDomain
+}
+
+// exchange 默认解析函数：轮询 DNS 服务器查询 A/AAAA 记录，返回最小 TTL；未配置服务器时使用系统解析器
+func (p *ResolverPool) exchange(ctx context.Context, host string) ([]string, time.Duration, error) {
+	if len(p.servers) == 0 {
+		return p.systemLookup(ctx, host)
+	}
+	start := int(atomic.AddUint32(&p.next, 1))
+	var lastErr error
+	for i := 0; i < len(p.servers); i++ {
+		server := p.servers[(start+i)%len(p.servers)]
+		ips, ttl, err := p.exchangeServer(ctx, server, host)
+		if err == nil {
+			return ips, ttl, nil
+		}
+		// NXDOMAIN 是确定的结果，无需再尝试其他服务器
+		if classifyResolution(nil, err) == ResolutionNXDomain {
+			return nil, defaultNegativeTTL, err
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// systemLookup 使用系统解析器查询，NXDOMAIN 按 defaultNegativeTTL 缓存
+func (p *ResolverPool) systemLookup(ctx context.Context, host string) ([]string, time.Duration, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(queryCtx, host)
+	if err != nil {
+		if classifyResolution(nil, err) == ResolutionNXDomain {
+			return nil, defaultNegativeTTL, err
+		}
+		return nil, 0, err
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	if len(ips) == 0 {
+		return nil, defaultNegativeTTL, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, defaultSystemTTL, nil
+}
+
+// query 发送一条查询，DoH 时经 HTTPS 发送
+func (p *ResolverPool) query(ctx context.Context, msg *dns.Msg, server string) (*dns.Msg, error) {
+	if p.doh == nil {
+		resp, _, err := p.client.ExchangeContext(ctx, msg, server)
+		return resp, err
+	}
+	// RFC 8484 建议 DoH 查询的 ID 为 0，便于 HTTP 缓存
+	msg.Id = 0
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	answer, err := core.DoHExchange(ctx, p.doh, server, packed)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(dns.Msg)
+	if err := resp.Unpack(answer); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// exchangeServer 向单个 DNS 服务器查询 A 和 AAAA 记录
+func (p *ResolverPool) exchangeServer(ctx context.Context, server, host string) ([]string, time.Duration, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var ips []string
+	var minTTL uint32
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(host), qtype)
+		resp, err := p.query(queryCtx, msg, server)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.Rcode == dns.RcodeNameError {
+			return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: server, IsNotFound: true}
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			return nil, 0, &net.DNSError{Err: dns.RcodeToString[resp.Rcode], Name: host, Server: server}
+		}
+		for _, rr := range resp.Answer {
+			var ip net.IP
+			switch record := rr.(type) {
+			case *dns.A:
+				ip = record.A
+			case *dns.AAAA:
+				ip = record.AAAA
+			default:
+				continue
+			}
+			ips = append(ips, ip.String())
+			if minTTL == 0 || rr.Header().Ttl < minTTL {
+				minTTL = rr.Header().Ttl
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: server, IsNotFound: true}
+	}
+	ttl := time.Duration(minTTL) * time.Second
+	if ttl < defaultResolverMinTTL {
+		ttl = defaultResolverMinTTL
+	}
+	return ips, ttl, nil
+}
+
+// normalizeHost 统一主机名格式
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
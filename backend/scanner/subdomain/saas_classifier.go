@@ -0,0 +1,285 @@
+package subdomain
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/config"
+
+	"github.com/miekg/dns"
+)
+
+// SaaS 资产分类
+// 根据子域名的 CNAME 链后缀识别托管在第三方 SaaS 平台上的资产，
+// 按平台的处理建议决定跳过端口扫描、重点做接管检测还是按普通资产扫描
+
+// SaaS 处理建议
+const (
+	SaaSHandlingSkipPortScan = "skip-portscan"     // 平台自身端口不属于目标资产
+	SaaSHandlingTakeover     = "takeover-relevant" // 重点做子域名接管检测
+	SaaSHandlingScan         = "scan-normally"     // 按普通资产扫描
+)
+
+// maxCNAMEChain CNAME 链最大跟踪深度
+const maxCNAMEChain = 8
+
+// SaaSProvider SaaS 平台
+type SaaSProvider struct {
+	Name                 string   `json:"name"`
+	Category             string   `json:"category"`
+	Handling             string   `json:"handling"`
+	CNAMESuffixes        []string `json:"cname_suffixes"`
+	TakeoverFingerprints []string `json:"takeover_fingerprints,omitempty"`
+	NXDomain             bool     `json:"nxdomain,omitempty"`
+}
+
+// SaaSMatch 分类命中结果
+type SaaSMatch struct {
+	Provider SaaSProvider `json:"provider"`
+	CNAME    string       `json:"cname"` // 命中的 CNAME
+}
+
+// CNAMELookupFunc 单跳 CNAME 查询函数，返回 host 的直接 CNAME 目标，没有 CNAME 时返回空串
+type CNAMELookupFunc func(ctx context.Context, host string) (string, error)
+
+// SaaSClassifier SaaS 资产分类器
+type SaaSClassifier struct {
+	providers   []SaaSProvider
+	lookupCNAME CNAMELookupFunc
+	lookupHost  ResolveFunc
+}
+
+// NewSaaSClassifier 创建 SaaS 资产分类器，规则从 saas.yaml 加载
+func NewSaaSClassifier() *SaaSClassifier {
+	return NewSaaSClassifierWithProviders(loadSaaSProviders())
+}
+
+// NewSaaSClassifierWithProviders 使用指定规则创建分类器，规则为空时使用内置默认规则
+func NewSaaSClassifierWithProviders(providers []SaaSProvider) *SaaSClassifier {
+	if len(providers) == 0 {
+		providers = defaultSaaSProviders()
+	}
+	return &SaaSClassifier{
+		providers:   providers,
+		lookupCNAME: defaultCNAMELookup,
+		lookupHost:  net.DefaultResolver.LookupHost,
+	}
+}
+
+// SetResolver 设置 CNAME 查询和主机解析函数（nil 保持默认）
+func (c *SaaSClassifier) SetResolver(lookupCNAME CNAMELookupFunc, lookupHost ResolveFunc) {
+	if lookupCNAME != nil {
+		c.lookupCNAME = lookupCNAME
+	}
+	if lookupHost != nil {
+		c.lookupHost = lookupHost
+	}
+}
+
+// LookupHost 主机解析，接管检测判断 CNAME 目标是否悬挂时使用
+func (c *SaaSClassifier) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return c.lookupHost(ctx, host)
+}
+
+// LookupCNAME 单跳 CNAME 查询，接管检测在没有已知 CNAME 链时使用
+func (c *SaaSClassifier) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return c.lookupCNAME(ctx, host)
+}
+
+// Providers 获取分类规则
+func (c *SaaSClassifier) Providers() []SaaSProvider {
+	return c.providers
+}
+
+// ResolveChain 跟踪 host 的完整 CNAME 链（不含 host 本身）
+func (c *SaaSClassifier) ResolveChain(ctx context.Context, host string) []string {
+	return resolveCNAMEChain(ctx, c.lookupCNAME, host)
+}
+
+// resolveCNAMEChain 用单跳查询函数逐跳跟踪 CNAME 链，遇到环或达到最大深度时停止
+func resolveCNAMEChain(ctx context.Context, lookupCNAME CNAMELookupFunc, host string) []string {
+	var chain []string
+	seen := map[string]bool{strings.ToLower(host): true}
+	current := host
+	for i := 0; i < maxCNAMEChain; i++ {
+		target, err := lookupCNAME(ctx, current)
+		if err != nil || target == "" {
+			break
+		}
+		target = strings.ToLower(strings.TrimSuffix(target, "."))
+		if seen[target] {
+			break
+		}
+		seen[target] = true
+		chain = append(chain, target)
+		current = target
+	}
+	return chain
+}
+
+// Classify 解析 host 的 CNAME 链并分类，known 为已知的 CNAME 记录（如子域名扫描结果中的）
+// 未命中任何平台时返回 nil
+func (c *SaaSClassifier) Classify(ctx context.Context, host string, known []string) (*SaaSMatch, []string) {
+	chain := c.ResolveChain(ctx, host)
+	for _, cname := range known {
+		cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+		if cname != "" && !containsString(chain, cname) {
+			chain = append(chain, cname)
+		}
+	}
+	return c.Match(chain), chain
+}
+
+// Match 按 CNAME 链匹配平台
+// 链上越靠前的记录越能代表资产归属，同一记录命中多条规则时取最长后缀
+func (c *SaaSClassifier) Match(chain []string) *SaaSMatch {
+	for _, cname := range chain {
+		cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+		var best *SaaSProvider
+		bestLen := 0
+		for i := range c.providers {
+			for _, suffix := range c.providers[i].CNAMESuffixes {
+				suffix = strings.ToLower(strings.Trim(suffix, "."))
+				if suffix == "" || len(suffix) <= bestLen {
+					continue
+				}
+				if cname == suffix || strings.HasSuffix(cname, "."+suffix) {
+					best = &c.providers[i]
+					bestLen = len(suffix)
+				}
+			}
+		}
+		if best != nil {
+			return &SaaSMatch{Provider: *best, CNAME: cname}
+		}
+	}
+	return nil
+}
+
+// SkipPortScan 是否跳过端口扫描
+func (m *SaaSMatch) SkipPortScan() bool {
+	return m.Provider.Handling == SaaSHandlingSkipPortScan
+}
+
+// TakeoverRelevant 是否需要按平台指纹做接管检测
+func (m *SaaSMatch) TakeoverRelevant() bool {
+	return m.Provider.Handling == SaaSHandlingTakeover
+}
+
+// TakeoverFingerprint 将平台规则转换为接管检测指纹
+func (p SaaSProvider) TakeoverFingerprint() TakeoverFingerprint {
+	return TakeoverFingerprint{
+		Service:     p.Name,
+		CNames:      p.CNAMESuffixes,
+		Fingerprint: p.TakeoverFingerprints,
+		NXDomain:    p.NXDomain,
+		HTTPCheck:   len(p.TakeoverFingerprints) > 0,
+		Vulnerable:  true,
+	}
+}
+
+// loadSaaSProviders 从字典配置加载分类规则
+func loadSaaSProviders() []SaaSProvider {
+	saasConfig := config.GetSaaSConfig()
+	if saasConfig == nil {
+		return nil
+	}
+
+	providers := make([]SaaSProvider, 0, len(saasConfig.Providers))
+	for _, p := range saasConfig.Providers {
+		switch p.Handling {
+		case SaaSHandlingSkipPortScan, SaaSHandlingTakeover, SaaSHandlingScan:
+		default:
+			log.Printf("[SaaS] Provider %s has unknown handling %q, treated as %s", p.Name, p.Handling, SaaSHandlingScan)
+			p.Handling = SaaSHandlingScan
+		}
+		providers = append(providers, SaaSProvider{
+			Name:                 p.Name,
+			Category:             p.Category,
+			Handling:             p.Handling,
+			CNAMESuffixes:        p.CNAMESuffixes,
+			TakeoverFingerprints: p.TakeoverFingerprints,
+			NXDomain:             p.NXDomain,
+		})
+	}
+	return providers
+}
+
+// defaultSaaSProviders 字典文件缺失时使用的最小内置规则
+func defaultSaaSProviders() []SaaSProvider {
+	return []SaaSProvider{
+		{Name: "GitHub Pages", Category: "static-hosting", Handling: SaaSHandlingTakeover,
+			CNAMESuffixes: []string{"github.io"}, TakeoverFingerprints: []string{"There isn't a GitHub Pages site here", "Site not found &middot; GitHub Pages"}},
+		{Name: "Heroku", Category: "paas", Handling: SaaSHandlingTakeover,
+			CNAMESuffixes: []string{"herokuapp.com", "herokudns.com"}, TakeoverFingerprints: []string{"No such app"}},
+		{Name: "Zendesk", Category: "helpdesk", Handling: SaaSHandlingTakeover,
+			CNAMESuffixes: []string{"zendesk.com"}, TakeoverFingerprints: []string{"Help Center Closed"}},
+		{Name: "Salesforce", Category: "crm", Handling: SaaSHandlingSkipPortScan,
+			CNAMESuffixes: []string{"force.com", "salesforce.com"}},
+		{Name: "Atlassian", Category: "collaboration", Handling: SaaSHandlingSkipPortScan,
+			CNAMESuffixes: []string{"atlassian.net"}},
+	}
+}
+
+var (
+	resolvConfOnce sync.Once
+	resolvConf     *dns.ClientConfig
+)
+
+// defaultCNAMELookup 查询单跳 CNAME 记录
+// 标准库 LookupCNAME 只返回链的最终名称，这里直接向系统 DNS 查询 CNAME 类型记录以获取中间节点
+func defaultCNAMELookup(ctx context.Context, host string) (string, error) {
+	resolvConfOnce.Do(func() {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err == nil && len(conf.Servers) > 0 {
+			resolvConf = conf
+		}
+	})
+
+	if resolvConf == nil {
+		// 无法读取系统 DNS 配置时退化为只获取最终名称
+		cname, err := net.DefaultResolver.LookupCNAME(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		cname = strings.TrimSuffix(cname, ".")
+		if strings.EqualFold(cname, host) {
+			return "", nil
+		}
+		return cname, nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(host), dns.TypeCNAME)
+	client := &dns.Client{Timeout: 5 * time.Second}
+
+	var lastErr error
+	for _, server := range resolvConf.Servers {
+		resp, _, err := client.ExchangeContext(ctx, msg, net.JoinHostPort(server, resolvConf.Port))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if record, ok := rr.(*dns.CNAME); ok && strings.EqualFold(record.Hdr.Name, dns.Fqdn(host)) {
+				return strings.TrimSuffix(record.Target, "."), nil
+			}
+		}
+		return "", nil
+	}
+	return "", lastErr
+}
+
+// containsString 检查字符串切片是否包含指定值
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -46,6 +46,7 @@ func (s *SubfinderScanner) Scan(ctx context.Context, domain string) ([]string, e
 
 	// 构建命令: subfinder -d domain -silent
 	cmd := exec.CommandContext(scanCtx, s.toolPath, "-d", domain, "-silent")
+	run := core.StartToolCommand(scanCtx, "subfinder", cmd)
 
 	// 获取输出管道
 	stdout, err := cmd.StdoutPipe()
@@ -55,6 +56,7 @@ func (s *SubfinderScanner) Scan(ctx context.Context, domain string) ([]string, e
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
+		run.Finish(err)
 		log.Printf("[Subfinder] Failed to start: %v", err)
 		return nil, err
 	}
@@ -70,7 +72,9 @@ func (s *SubfinderScanner) Scan(ctx context.Context, domain string) ([]string, e
 	}
 
 	// 等待命令完成
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	run.Finish(err)
+	if err != nil {
 		// 检查是否是超时
 		if scanCtx.Err() == context.DeadlineExceeded {
 			log.Printf("[Subfinder] Timed out after %v, got %d subdomains", s.timeout, len(subdomains))
@@ -3,6 +3,7 @@ package subdomain
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -15,6 +16,8 @@ type TakeoverScanner struct {
 	client      *http.Client
 	concurrency int
 	fingerprints []TakeoverFingerprint
+	lookupHost   ResolveFunc
+	lookupCNAME  CNAMELookupFunc
 }
 
 // TakeoverFingerprint 接管指纹
@@ -50,9 +53,14 @@ func NewTakeoverScanner(concurrency int) *TakeoverScanner {
 		},
 		concurrency:  concurrency,
 		fingerprints: getDefaultFingerprints(),
+		lookupHost:   net.DefaultResolver.LookupHost,
+		lookupCNAME:  defaultCNAMELookup,
 	}
 }
 
+// takeoverBodyLimit HTTP 指纹检测读取的响应体上限
+const takeoverBodyLimit = 100 * 1024
+
 // getDefaultFingerprints 获取默认指纹库
 func getDefaultFingerprints() []TakeoverFingerprint {
 	return []TakeoverFingerprint{
@@ -78,7 +86,7 @@ func getDefaultFingerprints() []TakeoverFingerprint {
 		{
 			Service:     "GitHub Pages",
 			CNames:      []string{".github.io", ".github.com"},
-			Fingerprint: []string{"There isn't a GitHub Pages site here", "For root URLs (like http://example.com/) you must provide an index.html file"},
+			Fingerprint: []string{"There isn't a GitHub Pages site here", "For root URLs (like http://example.com/) you must provide an index.html file", "Site not found &middot; GitHub Pages"},
 			NXDomain:    false,
 			HTTPCheck:   true,
 			Vulnerable:  true,
@@ -240,7 +248,7 @@ func getDefaultFingerprints() []TakeoverFingerprint {
 		{
 			Service:     "Azure",
 			CNames:      []string{".azurewebsites.net", ".cloudapp.net", ".cloudapp.azure.com", ".trafficmanager.net", ".blob.core.windows.net", ".azure-api.net"},
-			Fingerprint: []string{"404 Web Site not found", "The resource you are looking for has been removed"},
+			Fingerprint: []string{"404 Web Site not found", "Error 404 - Web app not found", "The resource you are looking for has been removed"},
 			NXDomain:    true,
 			HTTPCheck:   true,
 			Vulnerable:  true,
@@ -572,76 +580,100 @@ func getDefaultFingerprints() []TakeoverFingerprint {
 	}
 }
 
-// Scan 扫描单个域名
+// Scan 扫描单个域名，解析其 CNAME 链后检测
 func (s *TakeoverScanner) Scan(ctx context.Context, domain string) (*TakeoverResult, error) {
+	return s.ScanWithCNAMEs(ctx, domain, nil)
+}
+
+// ScanWithCNAMEs 使用已知的 CNAME 链检测域名（如子域名扫描结果中的），cnames 为空时才解析
+// 链上任一节点命中可接管服务时，访问该域名并匹配服务的未认领页面特征确认，仅 CNAME 命中不判定为可接管
+func (s *TakeoverScanner) ScanWithCNAMEs(ctx context.Context, domain string, cnames []string) (*TakeoverResult, error) {
 	result := &TakeoverResult{
 		Domain:     domain,
 		Vulnerable: false,
 	}
 
-	// 获取 CNAME 记录
-	cname, err := s.getCNAME(domain)
-	if err != nil {
-		// 检查是否 NXDOMAIN
-		if strings.Contains(err.Error(), "no such host") {
-			result.CNAME = "NXDOMAIN"
-			result.Reason = "Domain does not exist (NXDOMAIN)"
+	if len(cnames) == 0 {
+		// 获取 CNAME 记录
+		cname, err := s.lookupCNAME(ctx, domain)
+		if err != nil {
+			// 检查是否 NXDOMAIN
+			if strings.Contains(err.Error(), "no such host") {
+				result.CNAME = "NXDOMAIN"
+				result.Reason = "Domain does not exist (NXDOMAIN)"
+			}
 			return result, nil
 		}
-		return result, nil
+		if cname == "" {
+			result.Reason = "No CNAME record found"
+			return result, nil
+		}
+		cnames = append([]string{cname}, resolveCNAMEChain(ctx, s.lookupCNAME, cname)...)
 	}
 
-	if cname == "" {
-		result.Reason = "No CNAME record found"
-		return result, nil
+	// 检查 CNAME 链是否匹配已知的可接管服务
+	for _, cname := range cnames {
+		cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+		for _, fp := range s.fingerprints {
+			if fp.Vulnerable && s.matchCNAME(cname, fp.CNames) {
+				result.CNAME = cname
+				s.checkFingerprint(ctx, result, fp)
+				return result, nil
+			}
+		}
 	}
 
-	result.CNAME = cname
+	// 即使没有匹配已知服务，也检查链末端的 CNAME 是否悬挂
+	result.CNAME = strings.ToLower(strings.TrimSuffix(cnames[len(cnames)-1], "."))
+	_, err := s.lookupHost(ctx, result.CNAME)
+	if err != nil && strings.Contains(err.Error(), "no such host") {
+		result.Vulnerable = true
+		result.Service = "Unknown"
+		result.Reason = fmt.Sprintf("Dangling CNAME detected: %s does not resolve", result.CNAME)
+	}
 
-	// 检查 CNAME 是否匹配已知的可接管服务
-	for _, fp := range s.fingerprints {
-		if s.matchCNAME(cname, fp.CNames) {
-			result.Service = fp.Service
+	return result, nil
+}
 
-			// 首先检查 CNAME 目标是否可以解析
-			if fp.NXDomain {
-				_, err := net.LookupHost(cname)
-				if err != nil {
-					// CNAME 目标无法解析，可能存在接管风险
-					result.Vulnerable = true
-					result.Reason = fmt.Sprintf("Dangling CNAME: %s does not resolve (potential %s takeover)", cname, fp.Service)
-					result.Discussion = fp.Discussion
-					return result, nil
-				}
-			}
+// ScanWithFingerprint 使用指定指纹检测域名（CNAME 已由调用方解析）
+// 用于 SaaS 分类命中可接管平台后，按平台专属指纹检测
+func (s *TakeoverScanner) ScanWithFingerprint(ctx context.Context, domain, cname string, fp TakeoverFingerprint) *TakeoverResult {
+	result := &TakeoverResult{
+		Domain: domain,
+		CNAME:  cname,
+	}
+	s.checkFingerprint(ctx, result, fp)
+	return result
+}
 
-			// 如果需要 HTTP 检查
-			if fp.HTTPCheck {
-				vulnerable, fingerprints := s.checkHTTP(ctx, domain, fp.Fingerprint)
-				if vulnerable {
-					result.Vulnerable = true
-					result.Fingerprints = fingerprints
-					result.Reason = fmt.Sprintf("Potential %s takeover detected", fp.Service)
-					result.Discussion = fp.Discussion
-				}
-			}
+// checkFingerprint 按指纹检测 CNAME 悬挂和 HTTP 响应特征
+func (s *TakeoverScanner) checkFingerprint(ctx context.Context, result *TakeoverResult, fp TakeoverFingerprint) {
+	result.Service = fp.Service
 
-			break
+	// 首先检查 CNAME 目标是否可以解析
+	if fp.NXDomain {
+		_, err := s.lookupHost(ctx, result.CNAME)
+		if err != nil {
+			// CNAME 目标无法解析，可能存在接管风险
+			result.Vulnerable = true
+			result.Reason = fmt.Sprintf("Dangling CNAME: %s does not resolve (potential %s takeover)", result.CNAME, fp.Service)
+			result.Discussion = fp.Discussion
+			return
 		}
 	}
 
-	// 即使没有匹配已知服务，也检查悬挂 CNAME
-	if result.Service == "" && result.CNAME != "" {
-		// 尝试解析 CNAME 目标
-		_, err := net.LookupHost(cname)
-		if err != nil && strings.Contains(err.Error(), "no such host") {
+	// 如果需要 HTTP 检查
+	if fp.HTTPCheck {
+		vulnerable, fingerprints := s.checkHTTP(ctx, result.Domain, fp.Fingerprint)
+		if vulnerable {
 			result.Vulnerable = true
-			result.Service = "Unknown"
-			result.Reason = fmt.Sprintf("Dangling CNAME detected: %s does not resolve", cname)
+			result.Fingerprints = fingerprints
+			result.Reason = fmt.Sprintf("Potential %s takeover detected", fp.Service)
+			result.Discussion = fp.Discussion
+			return
 		}
+		result.Reason = fmt.Sprintf("CNAME points to %s but the unclaimed page signature was not found", fp.Service)
 	}
-
-	return result, nil
 }
 
 // ScanBatch 批量扫描
@@ -679,24 +711,6 @@ func (s *TakeoverScanner) ScanBatch(ctx context.Context, domains []string) ([]*T
 	return results, nil
 }
 
-// getCNAME 获取域名的 CNAME 记录
-func (s *TakeoverScanner) getCNAME(domain string) (string, error) {
-	cname, err := net.LookupCNAME(domain)
-	if err != nil {
-		return "", err
-	}
-	
-	// 移除末尾的点
-	cname = strings.TrimSuffix(cname, ".")
-	
-	// 如果 CNAME 与原域名相同，说明没有 CNAME
-	if strings.EqualFold(cname, domain) {
-		return "", nil
-	}
-	
-	return cname, nil
-}
-
 // matchCNAME 检查 CNAME 是否匹配模式
 func (s *TakeoverScanner) matchCNAME(cname string, patterns []string) bool {
 	cname = strings.ToLower(cname)
@@ -728,11 +742,11 @@ func (s *TakeoverScanner) checkHTTP(ctx context.Context, domain string, fingerpr
 			continue
 		}
 		
-		body := make([]byte, 1024*100) // 读取前 100KB
-		n, _ := resp.Body.Read(body)
+		// 读取前 100KB，单次 Read 可能只返回部分内容
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, takeoverBodyLimit))
 		resp.Body.Close()
 		
-		bodyStr := string(body[:n])
+		bodyStr := string(body)
 		
 		for _, fp := range fingerprints {
 			if strings.Contains(bodyStr, fp) {
@@ -753,6 +767,27 @@ func (s *TakeoverScanner) GetFingerprints() []TakeoverFingerprint {
 	return s.fingerprints
 }
 
+// SetHostLookup 设置判断 CNAME 目标是否悬挂时使用的解析函数
+func (s *TakeoverScanner) SetHostLookup(fn ResolveFunc) {
+	if fn != nil {
+		s.lookupHost = fn
+	}
+}
+
+// SetCNAMELookup 设置未提供 CNAME 链时使用的单跳 CNAME 查询函数
+func (s *TakeoverScanner) SetCNAMELookup(fn CNAMELookupFunc) {
+	if fn != nil {
+		s.lookupCNAME = fn
+	}
+}
+
+// SetHTTPClient 设置 HTTP 指纹检测使用的客户端
+func (s *TakeoverScanner) SetHTTPClient(client *http.Client) {
+	if client != nil {
+		s.client = client
+	}
+}
+
 // AddFingerprint 添加自定义指纹
 func (s *TakeoverScanner) AddFingerprint(fp TakeoverFingerprint) {
 	s.fingerprints = append(s.fingerprints, fp)
@@ -0,0 +1,132 @@
+package thirdparty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// CachedSourceSuffix 缓存结果的来源标注，例如 "fofa(cached)"
+const CachedSourceSuffix = "(cached)"
+
+// cacheKey 查询结果缓存的 Redis key
+func cacheKey(provider, domain string) string {
+	return fmt.Sprintf("thirdparty:cache:%s:%s", provider, strings.ToLower(domain))
+}
+
+// getCachedAssets 读取缓存的查询结果
+func (m *APIManager) getCachedAssets(ctx context.Context, provider, domain string) ([]UnifiedAsset, bool) {
+	if m.options.CacheTTL <= 0 {
+		return nil, false
+	}
+
+	val, ok, err := m.store.Get(ctx, cacheKey(provider, domain))
+	if err != nil || !ok {
+		return nil, false
+	}
+
+	var assets []UnifiedAsset
+	if err := json.Unmarshal([]byte(val), &assets); err != nil {
+		return nil, false
+	}
+
+	for i := range assets {
+		assets[i].Source = provider + CachedSourceSuffix
+	}
+	return assets, true
+}
+
+// setCachedAssets 缓存查询结果
+func (m *APIManager) setCachedAssets(ctx context.Context, provider, domain string, assets []UnifiedAsset) {
+	if m.options.CacheTTL <= 0 {
+		return
+	}
+
+	data, err := json.Marshal(assets)
+	if err != nil {
+		return
+	}
+	if err := m.store.Set(ctx, cacheKey(provider, domain), string(data), m.options.CacheTTL); err != nil {
+		log.Printf("[APIManager] Failed to cache %s results for %s: %v", provider, domain, err)
+	}
+}
+
+// FetchSubdomainAssets 从指定付费数据源分页查询子域名资产
+// 优先使用缓存；配额耗尽时停用该数据源并返回已获取的部分结果，不返回错误
+func (m *APIManager) FetchSubdomainAssets(ctx context.Context, provider, domain string, maxResults int) ([]UnifiedAsset, error) {
+	if assets, ok := m.getCachedAssets(ctx, provider, domain); ok {
+		log.Printf("[APIManager] Using cached %s results for %s (%d assets)", provider, domain, len(assets))
+		return assets, nil
+	}
+
+	if m.isDisabled(provider) {
+		return nil, nil
+	}
+
+	var assets []UnifiedAsset
+	var err error
+
+	switch provider {
+	case "fofa":
+		if m.Fofa == nil || !m.Fofa.IsConfigured() {
+			return nil, nil
+		}
+		m.recordUsage(provider)
+		fofaAssets, e := m.Fofa.SearchSubdomains(ctx, domain, maxResults)
+		for _, a := range fofaAssets {
+			assets = append(assets, m.convertFofaAsset(a))
+		}
+		err = e
+	case "hunter":
+		if m.Hunter == nil || !m.Hunter.IsConfigured() {
+			return nil, nil
+		}
+		m.recordUsage(provider)
+		hunterAssets, e := m.Hunter.SearchSubdomains(ctx, domain, maxResults)
+		for _, a := range hunterAssets {
+			assets = append(assets, m.convertHunterAsset(a))
+		}
+		err = e
+	case "quake":
+		if m.Quake == nil || !m.Quake.IsConfigured() {
+			return nil, nil
+		}
+		m.recordUsage(provider)
+		quakeAssets, e := m.Quake.SearchSubdomains(ctx, domain, maxResults)
+		for _, a := range quakeAssets {
+			assets = append(assets, m.convertQuakeAsset(a))
+		}
+		err = e
+	default:
+		return nil, fmt.Errorf("不支持的数据源: %s", provider)
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrQuotaExhausted) {
+			m.disableProvider(provider, err)
+			return assets, nil
+		}
+		return assets, err
+	}
+
+	m.setCachedAssets(ctx, provider, domain, assets)
+	return assets, nil
+}
+
+// FetchSecurityTrailsSubdomains 从 SecurityTrails 查询子域名，未配置或已停用时返回空结果；
+// 配额耗尽时停用该数据源且不返回错误
+func (m *APIManager) FetchSecurityTrailsSubdomains(ctx context.Context, domain string) ([]string, error) {
+	if m.SecurityTrails == nil || !m.SecurityTrails.IsConfigured() || m.isDisabled(SourceSecurityTrails) {
+		return nil, nil
+	}
+	m.recordUsage(SourceSecurityTrails)
+	names, err := m.SecurityTrails.SearchSubdomains(ctx, domain)
+	if errors.Is(err, ErrQuotaExhausted) {
+		m.disableProvider(SourceSecurityTrails, err)
+		return nil, nil
+	}
+	return names, err
+}
@@ -0,0 +1,98 @@
+package thirdparty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ChaosClient ProjectDiscovery Chaos 子域名数据集客户端
+// 密钥可选：未配置时仍可在 APISources 中显式选择，接口拒绝时返回错误
+type ChaosClient struct {
+	APIKey  string
+	BaseURL string
+	client  *http.Client
+}
+
+// ChaosSubdomainsResponse 子域名响应，subdomains 为不含主域名的前缀
+type ChaosSubdomainsResponse struct {
+	Domain     string   `json:"domain"`
+	Subdomains []string `json:"subdomains"`
+	Count      int      `json:"count"`
+}
+
+// NewChaosClient 创建 Chaos 客户端
+func NewChaosClient(apiKey string) *ChaosClient {
+	return &ChaosClient{
+		APIKey:  apiKey,
+		BaseURL: "https://dns.projectdiscovery.io",
+		client: &http.Client{
+			Timeout: DefaultPassiveTimeout,
+		},
+	}
+}
+
+// Name 数据源名称
+func (c *ChaosClient) Name() string {
+	return SourceChaos
+}
+
+// IsConfigured 检查是否已配置密钥
+func (c *ChaosClient) IsConfigured() bool {
+	return c.APIKey != ""
+}
+
+// SearchSubdomains 查询子域名
+func (c *ChaosClient) SearchSubdomains(ctx context.Context, domain string, maxResults int) ([]string, error) {
+	reqURL := fmt.Sprintf("%s/dns/%s/subdomains", c.BaseURL, url.PathEscape(domain))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", c.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if isQuotaExhaustedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: Chaos HTTP %d", ErrQuotaExhausted, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("Chaos API 密钥无效或未配置 (HTTP %d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Chaos 返回 HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ChaosSubdomainsResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	names := newNameCollector(domain, maxResults)
+	for _, sub := range result.Subdomains {
+		name := domain
+		if sub != "" {
+			name = sub + "." + domain
+		}
+		if names.add(name) {
+			break
+		}
+	}
+	return names.names, nil
+}
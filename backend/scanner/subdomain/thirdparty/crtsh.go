@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
 // CrtShClient 证书透明度查询客户端 (crt.sh)
 type CrtShClient struct {
-	BaseURL string
-	client  *http.Client
+	BaseURL     string
+	SkipExpired bool // 忽略已过期的证书，过期证书上的名称多已下线
+	client      *http.Client
 }
 
 // CrtShResult crt.sh 查询结果
@@ -28,6 +30,9 @@ type CrtShResult struct {
 	SerialNumber      string `json:"serial_number"`
 }
 
+// crtShTimeLayout crt.sh 返回的证书时间格式（UTC）
+const crtShTimeLayout = "2006-01-02T15:04:05"
+
 // NewCrtShClient 创建 crt.sh 客户端
 func NewCrtShClient() *CrtShClient {
 	return &CrtShClient{
@@ -38,61 +43,51 @@ func NewCrtShClient() *CrtShClient {
 	}
 }
 
-// SearchSubdomains 通过证书透明度查询子域名
-func (c *CrtShClient) SearchSubdomains(ctx context.Context, domain string) ([]string, error) {
-	url := fmt.Sprintf("%s/?q=%%.%s&output=json", c.BaseURL, domain)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// Name 数据源名称
+func (c *CrtShClient) Name() string {
+	return SourceCrtSh
+}
 
-	body, err := io.ReadAll(resp.Body)
+// SearchSubdomains 通过证书透明度查询子域名，maxResults <= 0 表示不限制
+// 通配符条目 *.a.example.com 记为 a.example.com，与同名条目去重
+func (c *CrtShClient) SearchSubdomains(ctx context.Context, domain string, maxResults int) ([]string, error) {
+	results, err := c.GetCertificates(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []CrtShResult
-	if err := json.Unmarshal(body, &results); err != nil {
-		return nil, fmt.Errorf("解析响应失败: %v", err)
-	}
-
-	// 去重
-	subdomainMap := make(map[string]bool)
+	now := time.Now().UTC()
+	names := newNameCollector(domain, maxResults)
 	for _, r := range results {
+		if c.SkipExpired && certExpired(r.NotAfter, now) {
+			continue
+		}
 		// name_value 可能包含多个域名，用换行分隔
-		domains := splitDomains(r.NameValue)
-		for _, d := range domains {
-			if d != "" && !subdomainMap[d] {
-				subdomainMap[d] = true
+		for _, d := range splitDomains(r.NameValue) {
+			if names.add(d) {
+				return names.names, nil
 			}
 		}
-		if r.CommonName != "" && !subdomainMap[r.CommonName] {
-			subdomainMap[r.CommonName] = true
+		if names.add(r.CommonName) {
+			break
 		}
 	}
 
-	subdomains := make([]string, 0, len(subdomainMap))
-	for subdomain := range subdomainMap {
-		subdomains = append(subdomains, subdomain)
-	}
-
-	return subdomains, nil
+	return names.names, nil
 }
 
 // GetCertificates 获取完整证书信息
 func (c *CrtShClient) GetCertificates(ctx context.Context, domain string) ([]CrtShResult, error) {
-	url := fmt.Sprintf("%s/?q=%%.%s&output=json", c.BaseURL, domain)
+	// q=%.example.com 匹配所有子域名，% 需要编码为 %25
+	query := url.Values{}
+	query.Set("q", "%."+normalizeName(domain))
+	query.Set("output", "json")
+	if c.SkipExpired {
+		query.Set("exclude", "expired")
+	}
+	reqURL := fmt.Sprintf("%s/?%s", c.BaseURL, query.Encode())
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -105,6 +100,11 @@ func (c *CrtShClient) GetCertificates(ctx context.Context, domain string) ([]Crt
 	}
 	defer resp.Body.Close()
 
+	// crt.sh 过载时返回 HTML 错误页
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crt.sh 返回 HTTP %d", resp.StatusCode)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -118,6 +118,12 @@ func (c *CrtShClient) GetCertificates(ctx context.Context, domain string) ([]Crt
 	return results, nil
 }
 
+// certExpired 证书是否已过期，时间无法解析时视为未过期
+func certExpired(notAfter string, now time.Time) bool {
+	t, err := time.Parse(crtShTimeLayout, notAfter)
+	return err == nil && t.Before(now)
+}
+
 // splitDomains 分割域名（处理换行符）
 func splitDomains(nameValue string) []string {
 	var domains []string
@@ -13,10 +13,12 @@ import (
 
 // FofaClient Fofa API 客户端
 type FofaClient struct {
-	Email   string
-	APIKey  string
-	BaseURL string
-	client  *http.Client
+	Email     string
+	APIKey    string
+	BaseURL   string
+	PageDelay time.Duration // 分页请求间隔
+	client    *http.Client
+	quotaHook func(QuotaUsage)
 }
 
 // FofaResult Fofa 查询结果
@@ -51,9 +53,10 @@ type FofaAsset struct {
 // NewFofaClient 创建 Fofa 客户端
 func NewFofaClient(email, apiKey string) *FofaClient {
 	return &FofaClient{
-		Email:   email,
-		APIKey:  apiKey,
-		BaseURL: "https://fofa.info/api/v1",
+		Email:     email,
+		APIKey:    apiKey,
+		BaseURL:   "https://fofa.info/api/v1",
+		PageDelay: DefaultPageDelay,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -106,15 +109,27 @@ func (c *FofaClient) Search(ctx context.Context, query string, page, size int, f
 		return nil, err
 	}
 
+	if isQuotaExhaustedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: Fofa HTTP %d", ErrQuotaExhausted, resp.StatusCode)
+	}
+
 	var result FofaResult
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("解析响应失败: %v, body: %s", err, string(body))
 	}
 
 	if result.Error {
+		if isQuotaExhaustedMessage(result.ErrMsg) {
+			return nil, fmt.Errorf("%w: Fofa %s", ErrQuotaExhausted, result.ErrMsg)
+		}
 		return nil, fmt.Errorf("Fofa API 错误: %s", result.ErrMsg)
 	}
 
+	// Fofa 按返回条数消耗 F 点
+	if c.quotaHook != nil {
+		c.quotaHook(QuotaUsage{Provider: "fofa", Consumed: len(result.Results), Remaining: remainingFromHeader(resp)})
+	}
+
 	return &result, nil
 }
 
@@ -127,12 +142,21 @@ func (c *FofaClient) SearchSubdomains(ctx context.Context, domain string, maxRes
 		maxResults = 100
 	}
 
-	result, err := c.Search(ctx, query, 1, maxResults, fields)
-	if err != nil {
-		return nil, err
+	// 分页拉取，出错时返回已获取的部分结果
+	var assets []FofaAsset
+	err := fetchPages(ctx, maxResults, defaultPageSize, c.PageDelay, func(page, offset, size int) (int, int, error) {
+		result, err := c.Search(ctx, query, page, size, fields)
+		if err != nil {
+			return 0, 0, err
+		}
+		assets = append(assets, c.parseResults(result, fields)...)
+		return len(result.Results), result.Size, nil
+	})
+	if len(assets) > maxResults {
+		assets = assets[:maxResults]
 	}
 
-	return c.parseResults(result, fields), nil
+	return assets, err
 }
 
 // SearchByIP 根据 IP 查询资产
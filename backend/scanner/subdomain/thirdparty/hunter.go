@@ -12,9 +12,11 @@ import (
 
 // HunterClient Hunter API 客户端 (奇安信)
 type HunterClient struct {
-	APIKey  string
-	BaseURL string
-	client  *http.Client
+	APIKey    string
+	BaseURL   string
+	PageDelay time.Duration // 分页请求间隔
+	client    *http.Client
+	quotaHook func(QuotaUsage)
 }
 
 // HunterResponse Hunter API 响应
@@ -63,8 +65,9 @@ type HunterAsset struct {
 // NewHunterClient 创建 Hunter 客户端
 func NewHunterClient(apiKey string) *HunterClient {
 	return &HunterClient{
-		APIKey:  apiKey,
-		BaseURL: "https://hunter.qianxin.com/openApi",
+		APIKey:    apiKey,
+		BaseURL:   "https://hunter.qianxin.com/openApi",
+		PageDelay: DefaultPageDelay,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -115,15 +118,35 @@ func (c *HunterClient) Search(ctx context.Context, query string, page, pageSize
 		return nil, err
 	}
 
+	if isQuotaExhaustedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: Hunter HTTP %d", ErrQuotaExhausted, resp.StatusCode)
+	}
+
 	var result HunterResponse
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("解析响应失败: %v", err)
 	}
 
 	if result.Code != 200 {
+		if isQuotaExhaustedStatus(result.Code) || isQuotaExhaustedMessage(result.Message) {
+			return nil, fmt.Errorf("%w: Hunter %s", ErrQuotaExhausted, result.Message)
+		}
 		return nil, fmt.Errorf("Hunter API 错误: %s", result.Message)
 	}
 
+	// 响应中带有本次消耗和剩余积分
+	if c.quotaHook != nil && result.Data != nil {
+		usage := QuotaUsage{
+			Provider:  "hunter",
+			Consumed:  parseQuotaNumber(result.Data.ConsumeQuota),
+			Remaining: parseQuotaNumber(result.Data.RestQuota),
+		}
+		if usage.Remaining < 0 {
+			usage.Remaining = remainingFromHeader(resp)
+		}
+		c.quotaHook(usage)
+	}
+
 	return result.Data, nil
 }
 
@@ -135,16 +158,24 @@ func (c *HunterClient) SearchSubdomains(ctx context.Context, domain string, maxR
 		maxResults = 100
 	}
 
-	data, err := c.Search(ctx, query, 1, maxResults, "", "")
-	if err != nil {
-		return nil, err
-	}
-
-	if data == nil {
-		return []HunterAsset{}, nil
+	// 分页拉取，出错时返回已获取的部分结果
+	assets := []HunterAsset{}
+	err := fetchPages(ctx, maxResults, defaultPageSize, c.PageDelay, func(page, offset, size int) (int, int, error) {
+		data, err := c.Search(ctx, query, page, size, "", "")
+		if err != nil {
+			return 0, 0, err
+		}
+		if data == nil {
+			return 0, 0, nil
+		}
+		assets = append(assets, data.Arr...)
+		return len(data.Arr), data.Total, nil
+	})
+	if len(assets) > maxResults {
+		assets = assets[:maxResults]
 	}
 
-	return data.Arr, nil
+	return assets, err
 }
 
 // SearchByIP 根据 IP 查询资产
@@ -0,0 +1,269 @@
+package thirdparty
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 付费数据源密钥校验
+// 每个数据源发送一次最小的认证请求（用户信息或 ping 接口，Hunter 没有用户信息接口时查询 1 条数据），
+// 返回密钥是否可用以及接口提供的剩余配额
+
+// 需要密钥的付费数据源
+const (
+	SourceFofa           = "fofa"
+	SourceHunter         = "hunter"
+	SourceQuake          = "quake"
+	SourceSecurityTrails = "securitytrails"
+)
+
+// KeyProviders 支持保存和校验密钥的数据源
+var KeyProviders = []string{SourceFofa, SourceHunter, SourceQuake, SourceSecurityTrails}
+
+// IsKeyProvider 是否为支持保存密钥的数据源
+func IsKeyProvider(provider string) bool {
+	for _, p := range KeyProviders {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyValidation 密钥校验结果
+type KeyValidation struct {
+	Provider  string    `json:"provider"`
+	Valid     bool      `json:"valid"`             // 认证是否通过，配额耗尽但认证通过时为 true
+	Remaining int       `json:"remaining"`         // 剩余配额或积分，-1 表示接口未提供
+	Message   string    `json:"message,omitempty"` // 认证失败或配额耗尽的说明
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// KeyValidator 密钥校验器
+type KeyValidator struct {
+	BaseURLs map[string]string // 按数据源覆盖接口地址，未设置时使用默认地址
+	client   *http.Client
+}
+
+// NewKeyValidator 创建密钥校验器
+func NewKeyValidator() *KeyValidator {
+	return &KeyValidator{
+		BaseURLs: make(map[string]string),
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Validate 校验数据源的密钥，email 仅 Fofa 使用；请求失败（网络错误、响应无法解析）时返回错误
+func (v *KeyValidator) Validate(ctx context.Context, provider, email, key string) (*KeyValidation, error) {
+	if !IsKeyProvider(provider) {
+		return nil, fmt.Errorf("不支持的数据源: %s", provider)
+	}
+	if key == "" || (provider == SourceFofa && email == "") {
+		return nil, fmt.Errorf("%s 密钥未配置", provider)
+	}
+
+	result := &KeyValidation{Provider: provider, Remaining: -1}
+	var err error
+	switch provider {
+	case SourceFofa:
+		err = v.validateFofa(ctx, email, key, result)
+	case SourceHunter:
+		err = v.validateHunter(ctx, key, result)
+	case SourceQuake:
+		err = v.validateQuake(ctx, key, result)
+	case SourceSecurityTrails:
+		err = v.validateSecurityTrails(ctx, key, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.CheckedAt = time.Now()
+	return result, nil
+}
+
+// baseURL 数据源的接口地址
+func (v *KeyValidator) baseURL(provider string) string {
+	if u := v.BaseURLs[provider]; u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	// 与各客户端的默认地址相同
+	switch provider {
+	case SourceFofa:
+		return NewFofaClient("", "").BaseURL
+	case SourceHunter:
+		return NewHunterClient("").BaseURL
+	case SourceQuake:
+		return NewQuakeClient("").BaseURL
+	default:
+		return NewSecurityTrailsClient("").BaseURL
+	}
+}
+
+// getJSON 发送 GET 请求并解析 JSON 响应，返回状态码；认证失败、配额耗尽的状态码不解析响应体
+func (v *KeyValidator) getJSON(ctx context.Context, reqURL string, headers map[string]string, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	for k, val := range headers {
+		req.Header.Set(k, val)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if isAuthFailedStatus(resp.StatusCode) || isQuotaExhaustedStatus(resp.StatusCode) {
+		return resp.StatusCode, nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("解析响应失败: %v", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// isAuthFailedStatus 认证失败的状态码
+func isAuthFailedStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// applyStatus 按状态码设置认证失败、配额耗尽，返回是否已确定结果
+func applyStatus(result *KeyValidation, code int) bool {
+	switch {
+	case isAuthFailedStatus(code):
+		result.Valid = false
+		result.Message = fmt.Sprintf("认证失败: HTTP %d", code)
+		return true
+	case isQuotaExhaustedStatus(code):
+		result.Valid = true
+		result.Remaining = 0
+		result.Message = ErrQuotaExhausted.Error()
+		return true
+	}
+	return false
+}
+
+// validateFofa 查询 /info/my，剩余次数取 remain_api_query
+func (v *KeyValidator) validateFofa(ctx context.Context, email, key string, result *KeyValidation) error {
+	params := url.Values{}
+	params.Set("email", email)
+	params.Set("key", key)
+	var info struct {
+		Error          bool     `json:"error"`
+		ErrMsg         string   `json:"errmsg"`
+		RemainAPIQuery *int     `json:"remain_api_query"`
+		FCoin          *float64 `json:"fcoin"`
+	}
+	code, err := v.getJSON(ctx, v.baseURL(SourceFofa)+"/info/my?"+params.Encode(), nil, &info)
+	if err != nil || applyStatus(result, code) {
+		return err
+	}
+	if info.Error {
+		result.Message = info.ErrMsg
+		return nil
+	}
+	result.Valid = true
+	switch {
+	case info.RemainAPIQuery != nil:
+		result.Remaining = *info.RemainAPIQuery
+	case info.FCoin != nil:
+		result.Remaining = int(*info.FCoin)
+	}
+	return nil
+}
+
+// validateHunter 查询 1 条数据，剩余积分取响应中的 rest_quota
+func (v *KeyValidator) validateHunter(ctx context.Context, key string, result *KeyValidation) error {
+	params := url.Values{}
+	params.Set("api-key", key)
+	params.Set("search", base64.URLEncoding.EncodeToString([]byte(`ip="127.0.0.1"`)))
+	params.Set("page", "1")
+	params.Set("page_size", "1")
+	var resp HunterResponse
+	code, err := v.getJSON(ctx, v.baseURL(SourceHunter)+"/search?"+params.Encode(), nil, &resp)
+	if err != nil || applyStatus(result, code) {
+		return err
+	}
+	switch {
+	case resp.Code == http.StatusOK:
+		result.Valid = true
+		if resp.Data != nil {
+			result.Remaining = parseQuotaNumber(resp.Data.RestQuota)
+		}
+	case isQuotaExhaustedStatus(resp.Code) || isQuotaExhaustedMessage(resp.Message):
+		result.Valid = true
+		result.Remaining = 0
+		result.Message = resp.Message
+	default:
+		result.Message = resp.Message
+	}
+	return nil
+}
+
+// validateQuake 查询 /user/info，剩余积分为永久积分与月度积分之和
+func (v *KeyValidator) validateQuake(ctx context.Context, key string, result *KeyValidation) error {
+	var info struct {
+		Code    interface{} `json:"code"` // 成功时为 0，失败时可能是字符串错误码
+		Message string      `json:"message"`
+		Data    struct {
+			Credit      int `json:"credit"`
+			MonthCredit int `json:"month_remaining_credit"`
+		} `json:"data"`
+	}
+	code, err := v.getJSON(ctx, v.baseURL(SourceQuake)+"/user/info", map[string]string{"X-QuakeToken": key}, &info)
+	if err != nil || applyStatus(result, code) {
+		return err
+	}
+	if n, ok := info.Code.(float64); !ok || n != 0 {
+		result.Message = info.Message
+		return nil
+	}
+	result.Valid = true
+	result.Remaining = info.Data.Credit + info.Data.MonthCredit
+	return nil
+}
+
+// validateSecurityTrails 请求 /ping 认证，剩余次数由 /account/usage 的本月额度计算
+func (v *KeyValidator) validateSecurityTrails(ctx context.Context, key string, result *KeyValidation) error {
+	headers := map[string]string{"APIKEY": key, "Accept": "application/json"}
+	var ping struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	code, err := v.getJSON(ctx, v.baseURL(SourceSecurityTrails)+"/ping", headers, &ping)
+	if err != nil || applyStatus(result, code) {
+		return err
+	}
+	if !ping.Success {
+		result.Message = ping.Message
+		return nil
+	}
+	result.Valid = true
+
+	var usage struct {
+		Current int `json:"current_monthly_usage"`
+		Allowed int `json:"allowed_monthly_usage"`
+	}
+	code, err = v.getJSON(ctx, v.baseURL(SourceSecurityTrails)+"/account/usage", headers, &usage)
+	if err != nil || code != http.StatusOK || usage.Allowed <= 0 {
+		// 用量接口不可用时只报告认证结果
+		return nil
+	}
+	result.Remaining = usage.Allowed - usage.Current
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return nil
+}
@@ -6,16 +6,57 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// DefaultCacheTTL 默认查询结果缓存时间
+const DefaultCacheTTL = 24 * time.Hour
+
 // APIManager 第三方 API 统一管理器
 type APIManager struct {
 	Fofa           *FofaClient
 	Hunter         *HunterClient
 	Quake          *QuakeClient
 	CrtSh          *CrtShClient
+	OTX            *OTXClient
+	Chaos          *ChaosClient
 	SecurityTrails *SecurityTrailsClient
 	config         *APIConfig // 保存配置信息
+
+	options     ManagerOptions
+	store       Store
+	mu          sync.Mutex
+	disabled    map[string]bool // 配额耗尽后在本管理器生命周期内停用的数据源
+	quotaWarned map[string]bool
+
+	usageHook    func(provider string)               // 每次调用付费数据源的查询接口
+	disabledHook func(provider string, reason error) // 数据源因配额耗尽停用
+}
+
+// ManagerOptions 管理器选项
+type ManagerOptions struct {
+	CacheTTL           time.Duration            // 查询结果缓存时间，0 表示不缓存
+	QuotaWarnThreshold int                      // 剩余配额低于该值时告警，0 表示不告警
+	PageDelay          time.Duration            // 分页请求间隔
+	Store              Store                    // 缓存和配额存储，nil 时使用进程内存
+	SourceTimeouts     map[string]time.Duration // 被动数据源的查询超时，未设置时使用客户端的默认超时
+	CrtShSkipExpired   bool                     // crt.sh 忽略已过期的证书
+}
+
+var (
+	defaultOptions = ManagerOptions{
+		CacheTTL:  DefaultCacheTTL,
+		PageDelay: DefaultPageDelay,
+	}
+	defaultStore  Store = NewMemoryStore()
+	defaultOptsMu sync.RWMutex
+)
+
+// SetDefaultOptions 设置新建管理器使用的默认选项（启动时调用）
+func SetDefaultOptions(opts ManagerOptions) {
+	defaultOptsMu.Lock()
+	defer defaultOptsMu.Unlock()
+	defaultOptions = opts
 }
 
 // APIConfig 第三方 API 配置
@@ -25,6 +66,8 @@ type APIConfig struct {
 	HunterKey          string `json:"hunter_key" yaml:"hunter_key"`
 	QuakeKey           string `json:"quake_key" yaml:"quake_key"`
 	SecurityTrailsKey  string `json:"securitytrails_key" yaml:"securitytrails_key"`
+	OTXKey             string `json:"otx_key" yaml:"otx_key"`     // 可选
+	ChaosKey           string `json:"chaos_key" yaml:"chaos_key"` // 可选
 }
 
 // UnifiedAsset 统一资产格式
@@ -42,7 +85,7 @@ type UnifiedAsset struct {
 	Banner     string   `json:"banner"`
 	Cert       string   `json:"cert"`
 	Components []string `json:"components,omitempty"`
-	Source     string   `json:"source"` // fofa, hunter, quake, crtsh, securitytrails
+	Source     string   `json:"source"` // fofa, hunter, quake, crtsh, otx, chaos, securitytrails
 	UpdateTime string   `json:"update_time,omitempty"`
 }
 
@@ -53,16 +96,26 @@ type SubdomainResult struct {
 	Subdomains   []string       `json:"subdomains"`
 	Sources      map[string]int `json:"sources"` // 每个来源发现的数量
 	Assets       []UnifiedAsset `json:"assets,omitempty"`
-	Duration     string         `json:"duration"`
+	DurationMs   int64         `json:"duration_ms"`
 }
 
 // NewAPIManager 创建 API 管理器
 func NewAPIManager(config *APIConfig) *APIManager {
 	manager := &APIManager{
-		CrtSh: NewCrtShClient(), // crt.sh 免费，不需要配置
+		CrtSh:       NewCrtShClient(), // crt.sh 免费，不需要配置
+		OTX:         NewOTXClient(""),
+		Chaos:       NewChaosClient(""),
+		disabled:    make(map[string]bool),
+		quotaWarned: make(map[string]bool),
 	}
 
 	if config != nil {
+		if config.OTXKey != "" {
+			manager.OTX = NewOTXClient(config.OTXKey)
+		}
+		if config.ChaosKey != "" {
+			manager.Chaos = NewChaosClient(config.ChaosKey)
+		}
 		if config.FofaEmail != "" && config.FofaKey != "" {
 			manager.Fofa = NewFofaClient(config.FofaEmail, config.FofaKey)
 		}
@@ -77,9 +130,43 @@ func NewAPIManager(config *APIConfig) *APIManager {
 		}
 	}
 
+	defaultOptsMu.RLock()
+	opts := defaultOptions
+	defaultOptsMu.RUnlock()
+	manager.SetOptions(opts)
+
 	return manager
 }
 
+// SetOptions 设置管理器选项
+func (m *APIManager) SetOptions(opts ManagerOptions) {
+	m.options = opts
+	m.store = opts.Store
+	if m.store == nil {
+		m.store = defaultStore
+	}
+	m.applyClientOptions()
+}
+
+// applyClientOptions 将分页间隔和配额回调应用到各客户端
+func (m *APIManager) applyClientOptions() {
+	if m.Fofa != nil {
+		m.Fofa.PageDelay = m.options.PageDelay
+		m.Fofa.quotaHook = m.recordQuota
+	}
+	if m.Hunter != nil {
+		m.Hunter.PageDelay = m.options.PageDelay
+		m.Hunter.quotaHook = m.recordQuota
+	}
+	if m.Quake != nil {
+		m.Quake.PageDelay = m.options.PageDelay
+		m.Quake.quotaHook = m.recordQuota
+	}
+	if m.CrtSh != nil {
+		m.CrtSh.SkipExpired = m.options.CrtShSkipExpired
+	}
+}
+
 // UpdateConfig 更新配置
 func (m *APIManager) UpdateConfig(config *APIConfig) {
 	// 保存配置
@@ -103,6 +190,12 @@ func (m *APIManager) UpdateConfig(config *APIConfig) {
 	if config.SecurityTrailsKey != "" {
 		m.config.SecurityTrailsKey = config.SecurityTrailsKey
 	}
+	if config.OTXKey != "" {
+		m.config.OTXKey = config.OTXKey
+	}
+	if config.ChaosKey != "" {
+		m.config.ChaosKey = config.ChaosKey
+	}
 	
 	// 重建客户端
 	if m.config.FofaEmail != "" && m.config.FofaKey != "" {
@@ -117,6 +210,19 @@ func (m *APIManager) UpdateConfig(config *APIConfig) {
 	if m.config.SecurityTrailsKey != "" {
 		m.SecurityTrails = NewSecurityTrailsClient(m.config.SecurityTrailsKey)
 	}
+	if m.config.OTXKey != "" {
+		m.OTX = NewOTXClient(m.config.OTXKey)
+	}
+	if m.config.ChaosKey != "" {
+		m.Chaos = NewChaosClient(m.config.ChaosKey)
+	}
+	m.applyClientOptions()
+
+	// 更换密钥后重新启用所有数据源
+	m.mu.Lock()
+	m.disabled = make(map[string]bool)
+	m.quotaWarned = make(map[string]bool)
+	m.mu.Unlock()
 }
 
 // GetConfig 获取当前配置（脱敏）
@@ -127,10 +233,12 @@ func (m *APIManager) GetConfig() *APIConfig {
 	// 返回脱敏后的配置
 	return &APIConfig{
 		FofaEmail:         m.config.FofaEmail,
-		FofaKey:           maskKey(m.config.FofaKey),
-		HunterKey:         maskKey(m.config.HunterKey),
-		QuakeKey:          maskKey(m.config.QuakeKey),
-		SecurityTrailsKey: maskKey(m.config.SecurityTrailsKey),
+		FofaKey:           MaskKey(m.config.FofaKey),
+		HunterKey:         MaskKey(m.config.HunterKey),
+		QuakeKey:          MaskKey(m.config.QuakeKey),
+		SecurityTrailsKey: MaskKey(m.config.SecurityTrailsKey),
+		OTXKey:            MaskKey(m.config.OTXKey),
+		ChaosKey:          MaskKey(m.config.ChaosKey),
 	}
 }
 
@@ -142,8 +250,8 @@ func (m *APIManager) GetRawConfig() *APIConfig {
 	return m.config
 }
 
-// maskKey 对密钥进行脱敏处理
-func maskKey(key string) string {
+// MaskKey 对密钥进行脱敏处理
+func MaskKey(key string) string {
 	if key == "" {
 		return ""
 	}
@@ -155,7 +263,7 @@ func maskKey(key string) string {
 
 // GetConfiguredSources 获取已配置的数据源
 func (m *APIManager) GetConfiguredSources() []string {
-	sources := []string{"crtsh"} // crt.sh 始终可用
+	sources := []string{SourceCrtSh, SourceOTX} // 免费数据源始终可用
 
 	if m.Fofa != nil && m.Fofa.IsConfigured() {
 		sources = append(sources, "fofa")
@@ -169,6 +277,9 @@ func (m *APIManager) GetConfiguredSources() []string {
 	if m.SecurityTrails != nil && m.SecurityTrails.IsConfigured() {
 		sources = append(sources, "securitytrails")
 	}
+	if m.Chaos != nil && m.Chaos.IsConfigured() {
+		sources = append(sources, SourceChaos)
+	}
 
 	return sources
 }
@@ -204,61 +315,33 @@ func (m *APIManager) CollectSubdomains(ctx context.Context, domain string, sourc
 			var err error
 
 			switch src {
-			case "fofa":
-				if m.Fofa != nil && m.Fofa.IsConfigured() {
-					fofaAssets, e := m.Fofa.SearchSubdomains(ctx, domain, maxResults)
-					if e == nil {
-						for _, a := range fofaAssets {
-							assets = append(assets, m.convertFofaAsset(a))
-							if a.Domain != "" {
-								subdomains = append(subdomains, a.Domain)
-							}
-							if a.Host != "" && strings.Contains(a.Host, domain) {
-								subdomains = append(subdomains, extractDomainFromHost(a.Host))
-							}
-						}
+			case "fofa", "hunter", "quake":
+				assets, err = m.FetchSubdomainAssets(ctx, src, domain, maxResults)
+				for _, a := range assets {
+					if a.Domain != "" {
+						subdomains = append(subdomains, a.Domain)
 					}
-					err = e
-				}
-
-			case "hunter":
-				if m.Hunter != nil && m.Hunter.IsConfigured() {
-					hunterAssets, e := m.Hunter.SearchSubdomains(ctx, domain, maxResults)
-					if e == nil {
-						for _, a := range hunterAssets {
-							assets = append(assets, m.convertHunterAsset(a))
-							if a.Domain != "" {
-								subdomains = append(subdomains, a.Domain)
-							}
+					switch src {
+					case "fofa":
+						if a.Host != "" && strings.Contains(a.Host, domain) {
+							subdomains = append(subdomains, extractDomainFromHost(a.Host))
 						}
-					}
-					err = e
-				}
-
-			case "quake":
-				if m.Quake != nil && m.Quake.IsConfigured() {
-					quakeAssets, e := m.Quake.SearchSubdomains(ctx, domain, maxResults)
-					if e == nil {
-						for _, a := range quakeAssets {
-							assets = append(assets, m.convertQuakeAsset(a))
-							if a.Domain != "" {
-								subdomains = append(subdomains, a.Domain)
-							}
-							if a.Hostname != "" {
-								subdomains = append(subdomains, a.Hostname)
-							}
+					case "quake":
+						if a.Host != "" {
+							subdomains = append(subdomains, a.Host)
 						}
 					}
-					err = e
+				}
+				// 缓存命中时标注来源
+				if len(assets) > 0 && strings.HasSuffix(assets[0].Source, CachedSourceSuffix) {
+					src = assets[0].Source
 				}
 
-			case "crtsh":
-				subdomains, err = m.CrtSh.SearchSubdomains(ctx, domain)
+			case SourceCrtSh, SourceOTX, SourceChaos:
+				subdomains, err = m.FetchPassiveSubdomains(ctx, src, domain, maxResults)
 
-			case "securitytrails":
-				if m.SecurityTrails != nil && m.SecurityTrails.IsConfigured() {
-					subdomains, err = m.SecurityTrails.SearchSubdomains(ctx, domain)
-				}
+			case SourceSecurityTrails:
+				subdomains, err = m.FetchSecurityTrailsSubdomains(ctx, domain)
 			}
 
 			if err != nil {
@@ -0,0 +1,90 @@
+package thirdparty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// OTXClient AlienVault OTX 被动 DNS 查询客户端，密钥可选（提供后限速更宽松）
+type OTXClient struct {
+	APIKey  string
+	BaseURL string
+	client  *http.Client
+}
+
+// OTXPassiveDNSResponse 被动 DNS 响应
+type OTXPassiveDNSResponse struct {
+	PassiveDNS []struct {
+		Hostname   string `json:"hostname"`
+		Address    string `json:"address"`
+		RecordType string `json:"record_type"`
+		First      string `json:"first"`
+		Last       string `json:"last"`
+	} `json:"passive_dns"`
+	Count int `json:"count"`
+}
+
+// NewOTXClient 创建 OTX 客户端
+func NewOTXClient(apiKey string) *OTXClient {
+	return &OTXClient{
+		APIKey:  apiKey,
+		BaseURL: "https://otx.alienvault.com/api/v1",
+		client: &http.Client{
+			Timeout: DefaultPassiveTimeout,
+		},
+	}
+}
+
+// Name 数据源名称
+func (c *OTXClient) Name() string {
+	return SourceOTX
+}
+
+// SearchSubdomains 通过被动 DNS 记录查询子域名
+func (c *OTXClient) SearchSubdomains(ctx context.Context, domain string, maxResults int) ([]string, error) {
+	reqURL := fmt.Sprintf("%s/indicators/domain/%s/passive_dns", c.BaseURL, url.PathEscape(domain))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("X-OTX-API-KEY", c.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if isQuotaExhaustedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: OTX HTTP %d", ErrQuotaExhausted, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OTX 返回 HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result OTXPassiveDNSResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	names := newNameCollector(domain, maxResults)
+	for _, record := range result.PassiveDNS {
+		if names.add(record.Hostname) {
+			break
+		}
+	}
+	return names.names, nil
+}
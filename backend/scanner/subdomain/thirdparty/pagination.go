@@ -0,0 +1,48 @@
+package thirdparty
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// defaultPageSize 单页请求数量
+	defaultPageSize = 100
+	// DefaultPageDelay 默认分页请求间隔，避免触发频率限制
+	DefaultPageDelay = 1 * time.Second
+)
+
+// pageFetcher 拉取单页数据，返回本页条数和总数（总数未知时返回 0）
+type pageFetcher func(page, offset, size int) (count int, total int, err error)
+
+// fetchPages 分页拉取数据直到达到 maxResults、数据取完或出错
+// 每页大小固定（按页码分页的接口要求页大小一致），调用方负责截断多余结果
+func fetchPages(ctx context.Context, maxResults, pageSize int, delay time.Duration, fetch pageFetcher) error {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if maxResults > 0 && maxResults < pageSize {
+		pageSize = maxResults
+	}
+
+	collected := 0
+	for page := 1; ; page++ {
+		count, total, err := fetch(page, collected, pageSize)
+		if err != nil {
+			return err
+		}
+		collected += count
+
+		if count < pageSize || collected >= maxResults || (total > 0 && collected >= total) {
+			return nil
+		}
+
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+	}
+}
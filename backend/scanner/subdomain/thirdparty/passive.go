@@ -0,0 +1,180 @@
+package thirdparty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 免费被动数据源
+// crt.sh、AlienVault OTX 不需要密钥，Chaos 的密钥可选；只返回子域名，由调用方重新解析确认
+
+const (
+	SourceCrtSh = "crtsh"
+	SourceOTX   = "otx"
+	SourceChaos = "chaos"
+
+	// DefaultPassiveTimeout OTX、Chaos 客户端的请求超时
+	DefaultPassiveTimeout = 30 * time.Second
+)
+
+// PassiveSource 被动子域名数据源
+type PassiveSource interface {
+	// Name 数据源名称，与 APISources 中的取值相同
+	Name() string
+	// SearchSubdomains 查询子域名，maxResults <= 0 表示不限制
+	SearchSubdomains(ctx context.Context, domain string, maxResults int) ([]string, error)
+}
+
+// IsPassiveSource 是否为免费被动数据源
+func IsPassiveSource(source string) bool {
+	switch source {
+	case SourceCrtSh, SourceOTX, SourceChaos:
+		return true
+	}
+	return false
+}
+
+// passiveSource 按名称获取被动数据源
+func (m *APIManager) passiveSource(source string) PassiveSource {
+	switch source {
+	case SourceCrtSh:
+		if m.CrtSh != nil {
+			return m.CrtSh
+		}
+	case SourceOTX:
+		if m.OTX != nil {
+			return m.OTX
+		}
+	case SourceChaos:
+		if m.Chaos != nil {
+			return m.Chaos
+		}
+	}
+	return nil
+}
+
+// FetchPassiveSubdomains 从免费被动数据源查询子域名
+// 优先使用缓存；按数据源设置的超时查询，结果超过 maxResults 时截断；配额耗尽时停用该数据源且不返回错误
+func (m *APIManager) FetchPassiveSubdomains(ctx context.Context, source, domain string, maxResults int) ([]string, error) {
+	src := m.passiveSource(source)
+	if src == nil {
+		return nil, fmt.Errorf("不支持的数据源: %s", source)
+	}
+	if names, ok := m.getCachedSubdomains(ctx, source, domain); ok {
+		log.Printf("[APIManager] Using cached %s results for %s (%d subdomains)", source, domain, len(names))
+		return limitNames(names, maxResults), nil
+	}
+	if m.isDisabled(source) {
+		return nil, nil
+	}
+
+	if timeout := m.options.SourceTimeouts[source]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	names, err := src.SearchSubdomains(ctx, domain, maxResults)
+	if err != nil {
+		if errors.Is(err, ErrQuotaExhausted) {
+			m.disableProvider(source, err)
+			return names, nil
+		}
+		return names, err
+	}
+	m.setCachedSubdomains(ctx, source, domain, names)
+	return names, nil
+}
+
+// getCachedSubdomains 读取缓存的被动数据源结果
+func (m *APIManager) getCachedSubdomains(ctx context.Context, source, domain string) ([]string, bool) {
+	if m.options.CacheTTL <= 0 {
+		return nil, false
+	}
+	val, ok, err := m.store.Get(ctx, cacheKey(source, domain))
+	if err != nil || !ok {
+		return nil, false
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(val), &names); err != nil {
+		return nil, false
+	}
+	return names, true
+}
+
+// setCachedSubdomains 缓存被动数据源结果
+func (m *APIManager) setCachedSubdomains(ctx context.Context, source, domain string, names []string) {
+	if m.options.CacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(names)
+	if err != nil {
+		return
+	}
+	if err := m.store.Set(ctx, cacheKey(source, domain), string(data), m.options.CacheTTL); err != nil {
+		log.Printf("[APIManager] Failed to cache %s results for %s: %v", source, domain, err)
+	}
+}
+
+// nameCollector 规范化并去重数据源返回的子域名，达到上限后不再收集
+type nameCollector struct {
+	domain string
+	max    int
+	seen   map[string]bool
+	names  []string
+}
+
+func newNameCollector(domain string, maxResults int) *nameCollector {
+	return &nameCollector{domain: normalizeName(domain), max: maxResults, seen: make(map[string]bool)}
+}
+
+// add 添加一个名称，返回是否已达到上限
+func (c *nameCollector) add(name string) bool {
+	if c.full() {
+		return true
+	}
+	name = normalizeName(name)
+	if name == "" || c.seen[name] || (name != c.domain && !strings.HasSuffix(name, "."+c.domain)) {
+		return false
+	}
+	c.seen[name] = true
+	c.names = append(c.names, name)
+	return c.full()
+}
+
+func (c *nameCollector) full() bool {
+	return c.max > 0 && len(c.names) >= c.max
+}
+
+// normalizeName 小写、去掉空白和末尾的点，去掉通配符前缀 *. 和 crt.sh 查询中 URL 编码的 %25.
+func normalizeName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	for {
+		switch {
+		case strings.HasPrefix(name, "*."):
+			name = name[2:]
+		case strings.HasPrefix(name, "%25."):
+			name = name[4:]
+		case strings.HasPrefix(name, "%."):
+			name = name[2:]
+		default:
+			if strings.ContainsAny(name, "*% @/") {
+				return ""
+			}
+			return name
+		}
+	}
+}
+
+// limitNames 截断到 maxResults 个
+func limitNames(names []string, maxResults int) []string {
+	if maxResults > 0 && len(names) > maxResults {
+		return names[:maxResults]
+	}
+	return names
+}
@@ -12,9 +12,11 @@ import (
 
 // QuakeClient Quake API 客户端 (360)
 type QuakeClient struct {
-	APIKey  string
-	BaseURL string
-	client  *http.Client
+	APIKey    string
+	BaseURL   string
+	PageDelay time.Duration // 分页请求间隔
+	client    *http.Client
+	quotaHook func(QuotaUsage)
 }
 
 // QuakeResponse Quake API 响应
@@ -102,8 +104,9 @@ type QuakeUserInfo struct {
 // NewQuakeClient 创建 Quake 客户端
 func NewQuakeClient(apiKey string) *QuakeClient {
 	return &QuakeClient{
-		APIKey:  apiKey,
-		BaseURL: "https://quake.360.net/api/v3",
+		APIKey:    apiKey,
+		BaseURL:   "https://quake.360.net/api/v3",
+		PageDelay: DefaultPageDelay,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -117,6 +120,11 @@ func (c *QuakeClient) IsConfigured() bool {
 
 // Search 执行 Quake 搜索
 func (c *QuakeClient) Search(ctx context.Context, query string, start, size int) (*QuakeResponse, error) {
+	return c.searchPage(ctx, query, start, size, "")
+}
+
+// searchPage 执行 Quake 分页搜索，paginationID 为上一页返回的翻页标识
+func (c *QuakeClient) searchPage(ctx context.Context, query string, start, size int, paginationID string) (*QuakeResponse, error) {
 	if !c.IsConfigured() {
 		return nil, fmt.Errorf("Quake API 未配置")
 	}
@@ -129,6 +137,9 @@ func (c *QuakeClient) Search(ctx context.Context, query string, start, size int)
 		"latest":     true,
 		"shortcuts":  []string{"610ce2adb1a2e3e1632e67b1"},
 	}
+	if paginationID != "" {
+		reqBody["pagination_id"] = paginationID
+	}
 
 	jsonBody, _ := json.Marshal(reqBody)
 
@@ -151,15 +162,27 @@ func (c *QuakeClient) Search(ctx context.Context, query string, start, size int)
 		return nil, err
 	}
 
+	if isQuotaExhaustedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: Quake HTTP %d", ErrQuotaExhausted, resp.StatusCode)
+	}
+
 	var result QuakeResponse
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("解析响应失败: %v", err)
 	}
 
 	if result.Code != 0 {
+		if isQuotaExhaustedMessage(result.Message) {
+			return nil, fmt.Errorf("%w: Quake %s", ErrQuotaExhausted, result.Message)
+		}
 		return nil, fmt.Errorf("Quake API 错误: %s", result.Message)
 	}
 
+	// Quake 按返回条数消耗积分
+	if c.quotaHook != nil {
+		c.quotaHook(QuotaUsage{Provider: "quake", Consumed: len(result.Data), Remaining: remainingFromHeader(resp)})
+	}
+
 	return &result, nil
 }
 
@@ -171,12 +194,27 @@ func (c *QuakeClient) SearchSubdomains(ctx context.Context, domain string, maxRe
 		maxResults = 100
 	}
 
-	result, err := c.Search(ctx, query, 0, maxResults)
-	if err != nil {
-		return nil, err
+	// 分页拉取，出错时返回已获取的部分结果
+	var assets []QuakeAsset
+	var paginationID string
+	err := fetchPages(ctx, maxResults, defaultPageSize, c.PageDelay, func(page, offset, size int) (int, int, error) {
+		result, err := c.searchPage(ctx, query, offset, size, paginationID)
+		if err != nil {
+			return 0, 0, err
+		}
+		assets = append(assets, result.Data...)
+		total := 0
+		if result.Meta != nil {
+			total = result.Meta.Total
+			paginationID = result.Meta.PaginationID
+		}
+		return len(result.Data), total, nil
+	})
+	if len(assets) > maxResults {
+		assets = assets[:maxResults]
 	}
 
-	return result.Data, nil
+	return assets, err
 }
 
 // SearchByIP 根据 IP 查询资产
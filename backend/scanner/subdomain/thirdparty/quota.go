@@ -0,0 +1,186 @@
+package thirdparty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQuotaExhausted API 配额已耗尽
+var ErrQuotaExhausted = errors.New("API 配额已耗尽")
+
+// QuotaUsage 单次请求的配额消耗
+type QuotaUsage struct {
+	Provider  string `json:"provider"`
+	Consumed  int    `json:"consumed"`
+	Remaining int    `json:"remaining"` // -1 表示未知
+}
+
+// QuotaStatus 配额统计
+type QuotaStatus struct {
+	Provider      string `json:"provider"`
+	ConsumedToday int64  `json:"consumed_today"`
+	Remaining     int    `json:"remaining"` // -1 表示未知
+	Disabled      bool   `json:"disabled"`  // 当前管理器中是否因配额耗尽而停用
+}
+
+// quotaStatTTL 每日配额统计的保留时间
+const quotaStatTTL = 7 * 24 * time.Hour
+
+// 配额耗尽相关的错误信息关键字
+var quotaExhaustedKeywords = []string{
+	"积分不足", "积分已用完", "余额不足", "配额", "额度不足", "次数已用完",
+	"quota", "credit", "insufficient", "limit exceeded",
+}
+
+var digitsPattern = regexp.MustCompile(`-?\d+`)
+
+// isQuotaExhaustedMessage 判断错误信息是否表示配额耗尽
+func isQuotaExhaustedMessage(msg string) bool {
+	lower := strings.ToLower(msg)
+	for _, kw := range quotaExhaustedKeywords {
+		if strings.Contains(lower, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// isQuotaExhaustedStatus 判断 HTTP 状态码是否表示配额耗尽
+func isQuotaExhaustedStatus(code int) bool {
+	return code == http.StatusPaymentRequired || code == http.StatusTooManyRequests
+}
+
+// parseQuotaNumber 从 "剩余积分：123" 之类的字符串中提取数字，失败返回 -1
+func parseQuotaNumber(s string) int {
+	match := digitsPattern.FindString(s)
+	if match == "" {
+		return -1
+	}
+	n, err := strconv.Atoi(match)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// remainingFromHeader 从响应头读取剩余配额，未提供时返回 -1
+func remainingFromHeader(resp *http.Response) int {
+	for _, h := range []string{"X-RateLimit-Remaining", "X-Quota-Remaining"} {
+		if v := resp.Header.Get(h); v != "" {
+			return parseQuotaNumber(v)
+		}
+	}
+	return -1
+}
+
+// quotaKey 配额统计的 Redis key
+func quotaKey(provider, kind string) string {
+	if kind == "consumed" {
+		return fmt.Sprintf("thirdparty:quota:%s:consumed:%s", provider, time.Now().Format("20060102"))
+	}
+	return fmt.Sprintf("thirdparty:quota:%s:%s", provider, kind)
+}
+
+// recordQuota 记录配额消耗，剩余配额低于阈值时输出告警
+func (m *APIManager) recordQuota(usage QuotaUsage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if usage.Consumed > 0 {
+		if _, err := m.store.IncrBy(ctx, quotaKey(usage.Provider, "consumed"), int64(usage.Consumed), quotaStatTTL); err != nil {
+			log.Printf("[APIManager] Failed to record %s quota: %v", usage.Provider, err)
+		}
+	}
+
+	if usage.Remaining < 0 {
+		return
+	}
+	if err := m.store.Set(ctx, quotaKey(usage.Provider, "remaining"), strconv.Itoa(usage.Remaining), 0); err != nil {
+		log.Printf("[APIManager] Failed to record %s remaining quota: %v", usage.Provider, err)
+	}
+
+	if m.options.QuotaWarnThreshold > 0 && usage.Remaining <= m.options.QuotaWarnThreshold {
+		m.mu.Lock()
+		warned := m.quotaWarned[usage.Provider]
+		m.quotaWarned[usage.Provider] = true
+		m.mu.Unlock()
+		if !warned {
+			log.Printf("[APIManager] Warning: %s remaining quota %d is below threshold %d",
+				usage.Provider, usage.Remaining, m.options.QuotaWarnThreshold)
+		}
+	}
+}
+
+// GetQuotaStatus 获取各数据源的配额统计
+func (m *APIManager) GetQuotaStatus(ctx context.Context) []QuotaStatus {
+	var statuses []QuotaStatus
+	for _, provider := range []string{"fofa", "hunter", "quake"} {
+		status := QuotaStatus{
+			Provider:  provider,
+			Remaining: -1,
+			Disabled:  m.isDisabled(provider),
+		}
+		if v, ok, err := m.store.Get(ctx, quotaKey(provider, "consumed")); err == nil && ok {
+			status.ConsumedToday, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v, ok, err := m.store.Get(ctx, quotaKey(provider, "remaining")); err == nil && ok {
+			status.Remaining = parseQuotaNumber(v)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// SetUsageHook 设置调用付费数据源查询接口时的回调，用于统计密钥的使用次数
+func (m *APIManager) SetUsageHook(hook func(provider string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usageHook = hook
+}
+
+// SetDisabledHook 设置数据源因配额耗尽停用时的回调，每个数据源只回调一次
+func (m *APIManager) SetDisabledHook(hook func(provider string, reason error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disabledHook = hook
+}
+
+// recordUsage 记录一次付费数据源查询
+func (m *APIManager) recordUsage(provider string) {
+	m.mu.Lock()
+	hook := m.usageHook
+	m.mu.Unlock()
+	if hook != nil {
+		hook(provider)
+	}
+}
+
+// disableProvider 停用数据源（仅对当前管理器生效）
+func (m *APIManager) disableProvider(provider string, reason error) {
+	m.mu.Lock()
+	first := !m.disabled[provider]
+	m.disabled[provider] = true
+	hook := m.disabledHook
+	m.mu.Unlock()
+	if !first {
+		return
+	}
+	log.Printf("[APIManager] %s disabled for the rest of the task: %v", provider, reason)
+	if hook != nil {
+		hook(provider, reason)
+	}
+}
+
+// isDisabled 数据源是否已停用
+func (m *APIManager) isDisabled(provider string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.disabled[provider]
+}
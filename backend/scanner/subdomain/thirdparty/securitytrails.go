@@ -86,6 +86,13 @@ func (c *SecurityTrailsClient) SearchSubdomains(ctx context.Context, domain stri
 		return nil, err
 	}
 
+	if isQuotaExhaustedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: SecurityTrails HTTP %d", ErrQuotaExhausted, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SecurityTrails API 错误: HTTP %d", resp.StatusCode)
+	}
+
 	var result SecurityTrailsSubdomainsResponse
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("解析响应失败: %v", err)
@@ -0,0 +1,124 @@
+package thirdparty
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store 缓存与配额数据的持久化存储
+type Store interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// RedisStore 基于 Redis 的存储
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 创建 Redis 存储
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Get 获取值
+func (s *RedisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	val, err := s.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return val, true, nil
+}
+
+// Set 设置值，ttl 为 0 表示不过期
+func (s *RedisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// IncrBy 累加计数
+func (s *RedisStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	val, err := s.client.IncrBy(ctx, key, n).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl > 0 {
+		s.client.Expire(ctx, key, ttl)
+	}
+	return val, nil
+}
+
+// MemoryStore 内存存储（未配置 Redis 时使用）
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]memoryItem)}
+}
+
+// Get 获取值
+func (s *MemoryStore) Get(ctx context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return "", false, nil
+	}
+	if !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+		delete(s.items, key)
+		return "", false, nil
+	}
+	return item.value, true, nil
+}
+
+// Set 设置值，ttl 为 0 表示不过期
+func (s *MemoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+	s.items[key] = item
+	return nil
+}
+
+// IncrBy 累加计数
+func (s *MemoryStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if ok && !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+		ok = false
+	}
+
+	var current int64
+	if ok {
+		current, _ = strconv.ParseInt(item.value, 10, 64)
+	} else if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+
+	current += n
+	item.value = strconv.FormatInt(current, 10)
+	s.items[key] = item
+	return current, nil
+}
@@ -0,0 +1,271 @@
+package subdomain
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 泛解析过滤
+// 许多 CDN 的泛解析会在一组 IP 之间轮换，少量随机子域名只能看到其中一部分 IP。
+// 检测时解析多个随机子域名，记录出现过的所有 IP（及次数）和共同的 CNAME 目标；
+// 候选子域名的 IP 全部落在泛解析 IP 池中，或 CNAME 与泛解析 CNAME 相同时判定为泛解析。
+// 可选的 HTTP 确认会比较候选子域名与随机子域名的响应体 hash，不同则保留。
+
+const (
+	// WildcardProbeCount 泛解析检测解析的随机子域名数
+	WildcardProbeCount = 12
+	// wildcardMinHits 至少有这么多随机子域名能解析才视为泛解析
+	wildcardMinHits = 2
+	// wildcardBodyLimit HTTP 确认时读取的响应体大小上限
+	wildcardBodyLimit = 256 * 1024
+	// wildcardHTTPTimeout HTTP 确认的请求超时
+	wildcardHTTPTimeout = 5 * time.Second
+)
+
+// CNAMEFunc CNAME 查询函数，返回去掉末尾点的目标，没有 CNAME 时返回空字符串
+type CNAMEFunc func(ctx context.Context, host string) (string, error)
+
+// BodyHashFunc 获取主机 HTTP 响应体 hash 的函数
+type BodyHashFunc func(ctx context.Context, host string) (string, error)
+
+// WildcardPool 域名的泛解析检测结果
+type WildcardPool struct {
+	Domain   string         `json:"domain"`
+	Probes   int            `json:"probes"`              // 解析的随机子域名数
+	Hits     int            `json:"hits"`                // 能解析的随机子域名数
+	IPCounts map[string]int `json:"ip_counts,omitempty"` // 泛解析 IP -> 出现次数
+	CNAME    string         `json:"cname,omitempty"`     // 随机子域名共同的 CNAME 目标
+	BodyHash string         `json:"body_hash,omitempty"` // 随机子域名的响应体 hash（开启 HTTP 确认时）
+
+	mu        sync.Mutex
+	filtered  int
+	confirmed int     // HTTP 确认后保留的数量
+	scoreSum  float64 // 被过滤结果的置信度之和
+}
+
+// DetectWildcard 解析 probes 个随机子域名检测泛解析，cname 为 nil 时不记录 CNAME
+func DetectWildcard(ctx context.Context, domain string, probes int, resolve ResolveFunc, cname CNAMEFunc) *WildcardPool {
+	if probes <= 0 {
+		probes = WildcardProbeCount
+	}
+	pool := &WildcardPool{Domain: domain, Probes: probes, IPCounts: make(map[string]int)}
+	cnameCounts := make(map[string]int)
+
+	for i := 0; i < probes; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		host := randomLabel(12) + "." + domain
+		ips, err := resolve(ctx, host)
+		if err != nil || len(ips) == 0 {
+			continue
+		}
+		pool.Hits++
+		for _, ip := range uniqueStrings(ips) {
+			pool.IPCounts[ip]++
+		}
+		if cname != nil {
+			if target, err := cname(ctx, host); err == nil {
+				if target = normalizeCNAME(target); target != "" && target != host {
+					cnameCounts[target]++
+				}
+			}
+		}
+	}
+
+	if pool.Hits < wildcardMinHits {
+		pool.IPCounts = make(map[string]int)
+		return pool
+	}
+	// 多数随机子域名指向同一个 CNAME 时记录泛解析 CNAME
+	for target, count := range cnameCounts {
+		if count >= wildcardMinHits && count*2 >= pool.Hits && count > cnameCounts[pool.CNAME] {
+			pool.CNAME = target
+		}
+	}
+	return pool
+}
+
+// Detected 是否存在泛解析
+func (p *WildcardPool) Detected() bool {
+	return p != nil && p.Hits >= wildcardMinHits
+}
+
+// IPs 泛解析 IP 池，按出现次数从多到少排序
+func (p *WildcardPool) IPs() []string {
+	if p == nil {
+		return nil
+	}
+	ips := make([]string, 0, len(p.IPCounts))
+	for ip := range p.IPCounts {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if p.IPCounts[ips[i]] != p.IPCounts[ips[j]] {
+			return p.IPCounts[ips[i]] > p.IPCounts[ips[j]]
+		}
+		return ips[i] < ips[j]
+	})
+	return ips
+}
+
+// Classify 判断候选子域名是否为泛解析结果，返回判定结果和置信度（0-1）
+// CNAME 与泛解析 CNAME 相同时置信度为 1；IP 全部落在池中时为这些 IP 在随机子域名中的平均出现率
+func (p *WildcardPool) Classify(ips []string, cname string) (bool, float64) {
+	if !p.Detected() {
+		return false, 0
+	}
+	if p.CNAME != "" && normalizeCNAME(cname) == p.CNAME {
+		return true, 1
+	}
+	ips = uniqueStrings(ips)
+	if len(ips) == 0 {
+		return false, 0
+	}
+	var score float64
+	for _, ip := range ips {
+		count, ok := p.IPCounts[ip]
+		if !ok {
+			return false, 0
+		}
+		score += float64(count) / float64(p.Hits)
+	}
+	return true, score / float64(len(ips))
+}
+
+// RecordFiltered 记录一个被过滤的候选子域名
+func (p *WildcardPool) RecordFiltered(confidence float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filtered++
+	p.scoreSum += confidence
+}
+
+// RecordConfirmed 记录一个 DNS 判定为泛解析、HTTP 确认后保留的候选子域名
+func (p *WildcardPool) RecordConfirmed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.confirmed++
+}
+
+// Filtered 被过滤的候选子域名数
+func (p *WildcardPool) Filtered() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.filtered
+}
+
+// Confirmed HTTP 确认后保留的候选子域名数
+func (p *WildcardPool) Confirmed() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.confirmed
+}
+
+// AverageConfidence 被过滤结果的平均置信度
+func (p *WildcardPool) AverageConfidence() float64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.filtered == 0 {
+		return 0
+	}
+	return p.scoreSum / float64(p.filtered)
+}
+
+// PrepareHTTPConfirm 获取一个随机子域名的响应体 hash 作为 HTTP 确认的基准，失败时不做 HTTP 确认
+func (p *WildcardPool) PrepareHTTPConfirm(ctx context.Context, hash BodyHashFunc) {
+	if !p.Detected() || hash == nil {
+		return
+	}
+	if h, err := hash(ctx, randomLabel(12)+"."+p.Domain); err == nil {
+		p.BodyHash = h
+	}
+}
+
+// ConfirmWildcard HTTP 确认候选子域名是否为泛解析：响应体 hash 与随机子域名相同时返回 true
+// 没有基准 hash 或候选子域名请求失败时按 DNS 判定结果处理
+func (p *WildcardPool) ConfirmWildcard(ctx context.Context, host string, hash BodyHashFunc) bool {
+	if p.BodyHash == "" || hash == nil {
+		return true
+	}
+	h, err := hash(ctx, host)
+	if err != nil {
+		return true
+	}
+	return h == p.BodyHash
+}
+
+// HTTPBodyHash 默认的响应体 hash：请求 http://host/，去掉响应体中的主机名后计算 sha256
+// 泛解析页面常在内容中回显请求的主机名，去掉后不同随机子域名的页面 hash 相同
+func HTTPBodyHash(ctx context.Context, host string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, wildcardHTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := wildcardHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, wildcardBodyLimit))
+	if err != nil {
+		return "", err
+	}
+	return BodyHash(body, host), nil
+}
+
+// BodyHash 去掉响应体中的主机名后计算 sha256
+func BodyHash(body []byte, host string) string {
+	normalized := strings.ReplaceAll(strings.ToLower(string(body)), strings.ToLower(host), "")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// wildcardHTTPClient HTTP 确认使用的客户端，不跟随跳转（跳转页面本身即可区分）
+var wildcardHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		DialContext:     (&net.Dialer{Timeout: 3 * time.Second}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// normalizeCNAME 统一 CNAME 的大小写和末尾的点
+func normalizeCNAME(cname string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(cname)), ".")
+}
+
+// randomLabel 生成随机子域名标签，以固定前缀开头避免与字典中的词冲突
+func randomLabel(length int) string {
+	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[rand.Intn(len(charset))]
+	}
+	return fmt.Sprintf("wc-%s", b)
+}
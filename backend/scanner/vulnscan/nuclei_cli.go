@@ -9,7 +9,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -21,7 +20,6 @@ type NucleiCLIScanner struct {
 	rateLimit       int
 	timeout         time.Duration
 	resultCallback  func(*NucleiResult)
-	mu              sync.Mutex
 }
 
 // NucleiResult Nuclei 扫描结果
@@ -135,8 +133,8 @@ func (s *NucleiCLIScanner) SetNucleiBinary(path string) {
 	s.nucleiBinary = path
 }
 
-// buildArgs 构建命令行参数
-func (s *NucleiCLIScanner) buildArgs(targets []string, config *NucleiScanConfig) []string {
+// BuildArgs 构建命令行参数
+func (s *NucleiCLIScanner) BuildArgs(targets []string, config *NucleiScanConfig) []string {
 	args := []string{
 		"-json",
 		"-silent",
@@ -190,16 +188,13 @@ func (s *NucleiCLIScanner) buildArgs(targets []string, config *NucleiScanConfig)
 	return args
 }
 
-// Scan 执行漏洞扫描
+// Scan 执行漏洞扫描，一次调用扫描全部目标，可同时多次调用
 func (s *NucleiCLIScanner) Scan(ctx context.Context, targets []string, config *NucleiScanConfig) ([]*NucleiResult, error) {
 	if len(targets) == 0 {
 		return nil, fmt.Errorf("目标列表为空")
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	args := s.buildArgs(targets, config)
+	args := s.BuildArgs(targets, config)
 
 	// 设置超时
 	timeout := s.timeout
@@ -210,6 +205,7 @@ func (s *NucleiCLIScanner) Scan(ctx context.Context, targets []string, config *N
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, s.nucleiBinary, args...)
+	run := core.StartToolCommand(ctx, "nuclei", cmd)
 
 	// 获取输出管道
 	stdout, err := cmd.StdoutPipe()
@@ -218,6 +214,7 @@ func (s *NucleiCLIScanner) Scan(ctx context.Context, targets []string, config *N
 	}
 
 	if err := cmd.Start(); err != nil {
+		run.Finish(err)
 		return nil, fmt.Errorf("启动 nuclei 失败: %w", err)
 	}
 
@@ -244,7 +241,9 @@ func (s *NucleiCLIScanner) Scan(ctx context.Context, targets []string, config *N
 	}
 
 	// 等待命令完成
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	run.Finish(err)
+	if err != nil {
 		// 如果有结果，忽略退出错误（nuclei 可能返回非零状态码）
 		if len(results) == 0 && ctx.Err() == nil {
 			return nil, fmt.Errorf("nuclei 执行失败: %w", err)
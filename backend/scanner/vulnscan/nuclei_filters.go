@@ -0,0 +1,64 @@
+package vulnscan
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// VulnSeverities nuclei 支持的严重级别
+var VulnSeverities = []string{"critical", "high", "medium", "low", "info", "unknown"}
+
+// ValidateSeverities 检查严重级别，不区分大小写
+func ValidateSeverities(severities []string) error {
+	for _, sev := range severities {
+		if !isVulnSeverity(sev) {
+			return fmt.Errorf("未知的漏洞严重级别: %s，可选 %s", sev, strings.Join(VulnSeverities, "、"))
+		}
+	}
+	return nil
+}
+
+func isVulnSeverity(severity string) bool {
+	for _, s := range VulnSeverities {
+		if strings.EqualFold(s, strings.TrimSpace(severity)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitTemplateSelectors 区分模板路径和标签
+// 包含路径分隔符或以 .yaml/.yml 结尾的是模板文件或目录（如 cves/、default-logins/），其余按标签处理
+func SplitTemplateSelectors(selectors []string) (templates, tags []string) {
+	for _, s := range selectors {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(s))
+		if strings.ContainsAny(s, `/\`) || ext == ".yaml" || ext == ".yml" {
+			templates = append(templates, s)
+		} else {
+			tags = append(tags, s)
+		}
+	}
+	return templates, tags
+}
+
+// NewNucleiScanConfig 按任务的严重级别、模板选择和速率设置构建扫描配置，0 使用扫描器默认值
+func NewNucleiScanConfig(severities, selectors []string, concurrency, rateLimit int) *NucleiScanConfig {
+	config := &NucleiScanConfig{
+		Concurrency: concurrency,
+		RateLimit:   rateLimit,
+	}
+	config.Templates, config.Tags = SplitTemplateSelectors(selectors)
+	var sevs []string
+	for _, sev := range severities {
+		if sev = strings.ToLower(strings.TrimSpace(sev)); sev != "" {
+			sevs = append(sevs, sev)
+		}
+	}
+	config.Severity = strings.Join(sevs, ",")
+	return config
+}
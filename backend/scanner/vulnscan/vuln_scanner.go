@@ -225,7 +225,7 @@ func (s *VulnScanner) ScanVuln(ctx context.Context, target string, templates []*
 	wg.Wait()
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	return result
 }
 
@@ -27,7 +27,7 @@ type VulnScanResult struct {
 	TotalFound   int          `json:"total_found"`
 	StartTime    time.Time    `json:"start_time"`
 	EndTime      time.Time    `json:"end_time"`
-	Duration     string       `json:"duration"`
+	DurationMs   int64        `json:"duration_ms"`
 	Vulns        []VulnResult `json:"vulns"`
 	Summary      VulnSummary  `json:"summary"`
 }
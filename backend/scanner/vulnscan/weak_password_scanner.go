@@ -21,7 +21,7 @@ type BruteForceResult struct {
 	Username    string       `json:"username,omitempty"`
 	Password    string       `json:"password,omitempty"`
 	Attempts    int          `json:"attempts"`
-	Duration    string       `json:"duration"`
+	DurationMs  int64        `json:"duration_ms"`
 	Credentials []Credential `json:"credentials,omitempty"`
 }
 
@@ -101,7 +101,7 @@ func (s *WeakPasswordScanner) BruteForceSSH(ctx context.Context, host string, po
 			select {
 			case <-ctx.Done():
 				result.Attempts = attempts
-				result.Duration = time.Since(start).String()
+				result.DurationMs = core.MillisSince(start)
 				return result
 			default:
 			}
@@ -121,13 +121,13 @@ func (s *WeakPasswordScanner) BruteForceSSH(ctx context.Context, host string, po
 	}
 
 	result.Attempts = attempts
-	result.Duration = time.Since(start).String()
+	result.DurationMs = core.MillisSince(start)
 	return result
 }
 
 // trySSH attempts SSH authentication (simplified - would need golang.org/x/crypto/ssh)
 func (s *WeakPasswordScanner) trySSH(host string, port int, username, password string) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := core.HostPort(host, port)
 	conn, err := net.DialTimeout("tcp", address, s.Timeout)
 	if err != nil {
 		return false
@@ -187,7 +187,7 @@ func (s *WeakPasswordScanner) BruteForceMySQL(ctx context.Context, host string,
 			select {
 			case <-ctx.Done():
 				result.Attempts = attempts
-				result.Duration = time.Since(start).String()
+				result.DurationMs = core.MillisSince(start)
 				return result
 			default:
 			}
@@ -201,7 +201,7 @@ func (s *WeakPasswordScanner) BruteForceMySQL(ctx context.Context, host string,
 	}
 
 	result.Attempts = attempts
-	result.Duration = time.Since(start).String()
+	result.DurationMs = core.MillisSince(start)
 	return result
 }
 
@@ -222,7 +222,7 @@ func (s *WeakPasswordScanner) BruteForceFTP(ctx context.Context, host string, po
 			select {
 			case <-ctx.Done():
 				result.Attempts = attempts
-				result.Duration = time.Since(start).String()
+				result.DurationMs = core.MillisSince(start)
 				return result
 			default:
 			}
@@ -241,13 +241,13 @@ func (s *WeakPasswordScanner) BruteForceFTP(ctx context.Context, host string, po
 	}
 
 	result.Attempts = attempts
-	result.Duration = time.Since(start).String()
+	result.DurationMs = core.MillisSince(start)
 	return result
 }
 
 // tryFTP attempts FTP authentication
 func (s *WeakPasswordScanner) tryFTP(host string, port int, username, password string) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := core.HostPort(host, port)
 	conn, err := net.DialTimeout("tcp", address, s.Timeout)
 	if err != nil {
 		return false
@@ -319,7 +319,7 @@ func (s *WeakPasswordScanner) BruteForceRedis(ctx context.Context, host string,
 		select {
 		case <-ctx.Done():
 			result.Attempts = attempts
-			result.Duration = time.Since(start).String()
+			result.DurationMs = core.MillisSince(start)
 			return result
 		default:
 		}
@@ -336,13 +336,13 @@ func (s *WeakPasswordScanner) BruteForceRedis(ctx context.Context, host string,
 	}
 
 	result.Attempts = attempts
-	result.Duration = time.Since(start).String()
+	result.DurationMs = core.MillisSince(start)
 	return result
 }
 
 // tryRedis attempts Redis authentication
 func (s *WeakPasswordScanner) tryRedis(host string, port int, password string) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := core.HostPort(host, port)
 	conn, err := net.DialTimeout("tcp", address, s.Timeout)
 	if err != nil {
 		return false
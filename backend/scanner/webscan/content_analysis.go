@@ -0,0 +1,239 @@
+package webscan
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"moongazing/config"
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+)
+
+// 内容敏感信息检测
+// 爬虫和目录扫描发现的 JS、JSON、文本、配置、SQL 和备份文件按扩展名或内容类型筛选后获取响应体，
+// 用敏感信息正则（vuln.yaml 的 sensitive_patterns，未配置时使用内置规则）和 sensitive.yaml 的 DSL 规则检测。
+// 超过大小上限、嗅探为二进制或压缩文件的内容跳过
+
+// DefaultContentAnalysisMaxBodySize 获取内容的默认大小上限
+const DefaultContentAnalysisMaxBodySize = 2 * 1024 * 1024
+
+var (
+	// ErrContentTooLarge 内容超过大小上限
+	ErrContentTooLarge = errors.New("content exceeds size limit")
+	// ErrContentNotText 内容为二进制或压缩文件
+	ErrContentNotText = errors.New("content is not text")
+)
+
+// inspectableExtensions 按扩展名检测的文件
+var inspectableExtensions = map[string]bool{
+	".js":     true,
+	".mjs":    true,
+	".json":   true,
+	".txt":    true,
+	".env":    true,
+	".config": true,
+	".conf":   true,
+	".sql":    true,
+	".bak":    true,
+}
+
+// inspectableMediaTypes 按内容类型检测的响应（不含 HTML 页面，页面由敏感信息模块直接检测）
+var inspectableMediaTypes = map[string]bool{
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"text/javascript":          true,
+	"application/json":         true,
+	"text/plain":               true,
+	"application/sql":          true,
+	"application/x-sql":        true,
+}
+
+// IsInspectableURL URL 的扩展名或内容类型是否需要检测内容，.env.production 等 .env 开头的文件名同样检测
+func IsInspectableURL(rawURL, contentType string) bool {
+	if media, _, err := mime.ParseMediaType(contentType); err == nil {
+		if inspectableMediaTypes[media] || strings.HasSuffix(media, "+json") {
+			return true
+		}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	name := strings.ToLower(path.Base(u.Path))
+	return inspectableExtensions[path.Ext(name)] || strings.HasPrefix(name, ".env")
+}
+
+// ContentAnalyzer 获取内容并检测敏感信息
+type ContentAnalyzer struct {
+	HTTPClient  *http.Client
+	MaxBodySize int64 // 内容大小上限(字节)，超过时跳过
+	UserAgent   string
+	UserAgents  *core.UserAgentPicker        // 设置后按策略选择 User-Agent，代替 UserAgent
+	MaskEmails  bool                         // 匹配上下文中同时掩码邮箱
+	Patterns    map[string]*SensitivePattern // 敏感信息正则，默认与敏感信息扫描相同
+	Rules       *fingerprint.DSLEngine       // sensitive.yaml 的 DSL 规则，为 nil 时只使用正则
+	headers     *core.ScanHeaders
+}
+
+// NewContentAnalyzer 创建内容检测器
+func NewContentAnalyzer() *ContentAnalyzer {
+	return &ContentAnalyzer{
+		HTTPClient: &http.Client{
+			Timeout: core.DefaultHTTPTimeout * 3,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				DialContext: (&net.Dialer{
+					Timeout:   core.ShortHTTPTimeout,
+					KeepAlive: core.ShortHTTPTimeout,
+				}).DialContext,
+				MaxIdleConns:        core.MaxIdleConns,
+				MaxIdleConnsPerHost: core.MaxIdleConnsPerHost,
+				IdleConnTimeout:     core.IdleConnTimeout,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse // 重定向到登录页等内容不检测
+			},
+		},
+		MaxBodySize: DefaultContentAnalysisMaxBodySize,
+		UserAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+		Patterns:    getSensitivePatterns(),
+		Rules:       sensitiveRuleEngine(),
+	}
+}
+
+// SetHeaders 设置获取内容时的自定义请求头
+func (a *ContentAnalyzer) SetHeaders(headers *core.ScanHeaders) {
+	a.headers = headers
+}
+
+// Fetch 获取内容，状态码不是 2xx、超过大小上限或内容不是文本时返回错误
+func (a *ContentAnalyzer) Fetch(ctx context.Context, target string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	userAgent := a.UserAgent
+	if a.UserAgents != nil {
+		userAgent = a.UserAgents.Next()
+	}
+	req.Header.Set("User-Agent", userAgent)
+	a.headers.Apply(req)
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	limit := a.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultContentAnalysisMaxBodySize
+	}
+	if resp.ContentLength > limit {
+		return nil, "", ErrContentTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(body)) > limit {
+		return nil, "", ErrContentTooLarge
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isTextContent(contentType, body) {
+		return nil, "", ErrContentNotText
+	}
+	return body, contentType, nil
+}
+
+// isTextContent 按声明的类型和前 512 字节判断内容是否为文本；
+// 声明为文本但含有 NUL 字节的内容（被改名的压缩包、数据库文件）同样跳过
+func isTextContent(contentType string, body []byte) bool {
+	head := body
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return fingerprint.IsTextBody(contentType, head) && bytes.IndexByte(head, 0) < 0
+}
+
+// Analyze 检测内容中的敏感信息，JS 文件的位置记为 js，其余为 body
+func (a *ContentAnalyzer) Analyze(target, contentType string, body []byte) []SensitiveFinding {
+	location := "body"
+	if IsJavaScriptURL(target, contentType) {
+		location = "js"
+	}
+	text := string(body)
+
+	var findings []SensitiveFinding
+	for name, pattern := range a.Patterns {
+		if finding := MatchSensitiveBody(text, name, pattern, a.MaskEmails); finding != nil {
+			finding.Location = location
+			findings = append(findings, *finding)
+		}
+	}
+	if a.Rules != nil && a.Rules.RulesCount() > 0 {
+		matches := a.Rules.AnalyzeResponse(&fingerprint.HTTPResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": contentType},
+			Body:       text,
+			URL:        target,
+		})
+		for _, match := range matches {
+			findings = append(findings, SensitiveFinding{
+				Type:         "sensitive",
+				Pattern:      match.RuleName,
+				Matches:      match.DSLMatched,
+				Location:     location,
+				Severity:     "medium",
+				Confidence:   match.Confidence,
+				TotalMatches: len(match.DSLMatched),
+			})
+		}
+	}
+
+	severityOrder := map[string]int{"critical": 0, "high": 1, "medium": 2, "low": 3, "info": 4}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return severityOrder[findings[i].Severity] < severityOrder[findings[j].Severity]
+		}
+		return findings[i].Pattern < findings[j].Pattern
+	})
+	return findings
+}
+
+// sensitive.yaml 的 DSL 规则（只加载一次）
+var (
+	sensitiveRules     *fingerprint.DSLEngine
+	sensitiveRulesOnce sync.Once
+)
+
+// sensitiveRuleEngine 加载字典目录中的 sensitive.yaml，文件不存在时返回 nil
+func sensitiveRuleEngine() *fingerprint.DSLEngine {
+	sensitiveRulesOnce.Do(func() {
+		path := config.ResolveDictFile(config.DictYAMLDir(), "sensitive.yaml")
+		if !config.IsEmbeddedDict(path) && !core.FileExists(path) {
+			return
+		}
+		engine := fingerprint.NewDSLEngine()
+		if err := engine.LoadRulesFromFile(path); err == nil {
+			sensitiveRules = engine
+		}
+	})
+	return sensitiveRules
+}
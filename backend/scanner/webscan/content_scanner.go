@@ -23,6 +23,7 @@ type ContentScanner struct {
 	FollowRedirect bool            // 是否跟随重定向
 	MaxRedirects   int             // 最大重定向次数
 	Filter         *core.ResponseFilter // 响应去重过滤器
+	MaskEmails     bool            // 敏感信息上下文中是否同时掩码邮箱（默认只掩码密钥类）
 }
 
 // NewContentScanner creates a new content scanner
@@ -0,0 +1,242 @@
+package webscan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// stateChangingWord 操作类请求的路径片段、参数名或参数值
+var stateChangingWord = regexp.MustCompile(`(?i)^(delete|del|remove|destroy|logout|signout|update|save|submit|create|reset|transfer|pay|confirm|approve|unsubscribe)$`)
+
+// operationParams 携带操作名的参数，如 ?action=delete
+var operationParams = map[string]bool{"action": true, "act": true, "op": true, "do": true, "cmd": true, "method": true}
+
+// IsStateChanging 根据请求方法和参数判断请求是否可能改变服务端状态
+// POST/PUT/PATCH/DELETE 和带请求体的请求一律视为改变状态；GET 请求的路径或参数中出现 delete、logout 等操作词时同样视为改变状态。
+// 这类请求只记录，不在流水线中自动重放
+func IsStateChanging(method, rawURL, body string) bool {
+	switch strings.ToUpper(strings.TrimSpace(method)) {
+	case "", "GET", "HEAD", "OPTIONS":
+	default:
+		return true
+	}
+	if body != "" {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		// 去掉扩展名，如 /logout.php
+		if i := strings.LastIndex(segment, "."); i > 0 {
+			segment = segment[:i]
+		}
+		if stateChangingWord.MatchString(segment) {
+			return true
+		}
+	}
+	for key, values := range u.Query() {
+		if stateChangingWord.MatchString(key) {
+			return true
+		}
+		if !operationParams[strings.ToLower(key)] {
+			continue
+		}
+		for _, v := range values {
+			if stateChangingWord.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 表单字段类型
+const (
+	FieldTypeText    = "text"   // 表单文本字段
+	FieldTypeFile    = "file"   // multipart 文件字段
+	FieldTypeString  = "string" // JSON 请求体字段，按值的类型
+	FieldTypeNumber  = "number"
+	FieldTypeBoolean = "boolean"
+	FieldTypeObject  = "object"
+	FieldTypeArray   = "array"
+	FieldTypeNull    = "null"
+)
+
+// FormField 请求体中的字段
+type FormField struct {
+	Name string `json:"name" bson:"name"`
+	Type string `json:"type" bson:"type"`
+}
+
+// RequestParams 爬虫发现的请求的参数，供漏洞扫描模块构造测试请求
+type RequestParams struct {
+	ContentType string      // 请求的 Content-Type（不含 charset 等参数），未给出时按请求体推断
+	Parameters  []string    // 查询参数名和请求体参数名，去重后排序
+	FormFields  []FormField // 请求体字段，按出现顺序（JSON 按字段名排序）
+}
+
+// ParseRequestParams 解析请求的查询参数和请求体字段
+// 支持 application/x-www-form-urlencoded、multipart/form-data 和 JSON 对象请求体，其他类型只解析查询参数
+func ParseRequestParams(rawURL, contentType, body string) RequestParams {
+	var params RequestParams
+	seen := make(map[string]bool)
+	addParam := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			params.Parameters = append(params.Parameters, name)
+		}
+	}
+
+	if u, err := url.Parse(rawURL); err == nil {
+		for name := range u.Query() {
+			addParam(name)
+		}
+	}
+
+	mediaType, mediaParams, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" && strings.TrimSpace(body) != "" {
+		mediaType = "application/x-www-form-urlencoded"
+		if trimmed := strings.TrimSpace(body); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			mediaType = "application/json"
+		}
+	}
+	params.ContentType = mediaType
+
+	if body != "" {
+		switch {
+		case mediaType == "application/x-www-form-urlencoded":
+			params.FormFields = parseURLEncodedFields(body)
+		case mediaType == "multipart/form-data":
+			params.FormFields = parseMultipartFields(body, mediaParams["boundary"])
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			params.FormFields = parseJSONFields(body)
+		}
+	}
+	for _, field := range params.FormFields {
+		addParam(field.Name)
+	}
+	sort.Strings(params.Parameters)
+	return params
+}
+
+// parseURLEncodedFields 解析 a=1&b=2 形式的请求体，重复的字段只保留一个
+func parseURLEncodedFields(body string) []FormField {
+	var fields []FormField
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(strings.TrimSpace(body), "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		fields = append(fields, FormField{Name: name, Type: FieldTypeText})
+	}
+	return fields
+}
+
+// parseMultipartFields 解析 multipart/form-data 请求体，带文件名的部分为文件字段
+func parseMultipartFields(body, boundary string) []FormField {
+	if boundary == "" {
+		return nil
+	}
+	var fields []FormField
+	seen := make(map[string]bool)
+	reader := multipart.NewReader(strings.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		name := part.FormName()
+		if name != "" && !seen[name] {
+			seen[name] = true
+			fieldType := FieldTypeText
+			if part.FileName() != "" {
+				fieldType = FieldTypeFile
+			}
+			fields = append(fields, FormField{Name: name, Type: fieldType})
+		}
+		part.Close()
+	}
+	return fields
+}
+
+// parseJSONFields 解析 JSON 对象请求体的顶层字段
+func parseJSONFields(body string) []FormField {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &object); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]FormField, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, FormField{Name: name, Type: jsonValueType(object[name])})
+	}
+	return fields
+}
+
+// jsonValueType JSON 值的类型
+func jsonValueType(value json.RawMessage) string {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 {
+		return FieldTypeNull
+	}
+	switch trimmed[0] {
+	case '"':
+		return FieldTypeString
+	case '{':
+		return FieldTypeObject
+	case '[':
+		return FieldTypeArray
+	case 't', 'f':
+		return FieldTypeBoolean
+	case 'n':
+		return FieldTypeNull
+	default:
+		return FieldTypeNumber
+	}
+}
+
+// ParseRawRequest 解析原始 HTTP 请求文本（katana 的 request.raw），返回请求头和请求体
+// 请求行和请求头按行读取，空行之后为请求体
+func ParseRawRequest(raw string) (map[string]string, string) {
+	reader := bufio.NewReader(strings.NewReader(raw))
+	headers := make(map[string]string)
+	first := true
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if first {
+			// 请求行
+			first = false
+		} else if line == "" {
+			break
+		} else if name, value, ok := strings.Cut(line, ":"); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		if err != nil {
+			return headers, ""
+		}
+	}
+	body, _ := io.ReadAll(reader)
+	return headers, string(body)
+}
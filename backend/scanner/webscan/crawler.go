@@ -21,7 +21,7 @@ type CrawlerResult struct {
 	TotalForms int          `json:"total_forms"`
 	StartTime  time.Time    `json:"start_time"`
 	EndTime    time.Time    `json:"end_time"`
-	Duration   string       `json:"duration"`
+	DurationMs int64        `json:"duration_ms"`
 	URLs       []CrawledURL `json:"urls"`
 	Forms      []FormInfo   `json:"forms"`
 	Emails     []string     `json:"emails,omitempty"`
@@ -210,7 +210,7 @@ func (c *WebCrawler) Crawl(ctx context.Context, startURL string) *CrawlerResult
 	result.TotalURLs = len(result.URLs)
 	result.TotalForms = len(result.Forms)
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	return result
 }
 
@@ -0,0 +1,283 @@
+package webscan
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"moongazing/scanner/core"
+)
+
+// 接口提取
+// 从 OpenAPI/Swagger 文档中按路径和方法提取接口，从 JS 文件中用 LinkFinder 风格的正则提取相对路径
+
+// DefaultEndpointMaxBodySize 获取文档的默认大小上限
+const DefaultEndpointMaxBodySize = 5 * 1024 * 1024
+
+// ErrEndpointDocTooLarge 文档超过大小上限
+var ErrEndpointDocTooLarge = errors.New("document exceeds size limit")
+
+// ExtractedEndpoint 提取到的接口
+type ExtractedEndpoint struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+}
+
+// EndpointExtractor 获取并解析接口文档、JS 文件
+type EndpointExtractor struct {
+	HTTPClient  *http.Client
+	MaxBodySize int64 // 文档大小上限(字节)，超过时跳过
+	UserAgent   string
+}
+
+// NewEndpointExtractor 创建接口提取器
+func NewEndpointExtractor() *EndpointExtractor {
+	return &EndpointExtractor{
+		HTTPClient: &http.Client{
+			Timeout: core.DefaultHTTPTimeout * 3,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				DialContext: (&net.Dialer{
+					Timeout: core.ShortHTTPTimeout,
+				}).DialContext,
+				MaxIdleConnsPerHost: core.MaxIdleConnsPerHost,
+				IdleConnTimeout:     core.IdleConnTimeout,
+			},
+		},
+		MaxBodySize: DefaultEndpointMaxBodySize,
+		UserAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+	}
+}
+
+// Fetch 获取文档内容，状态码不是 2xx 或超过大小上限时返回错误
+func (e *EndpointExtractor) Fetch(ctx context.Context, target string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", e.UserAgent)
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	limit := e.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultEndpointMaxBodySize
+	}
+	if resp.ContentLength > limit {
+		return nil, "", ErrEndpointDocTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(body)) > limit {
+		return nil, "", ErrEndpointDocTooLarge
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+var apiSpecPathRegex = regexp.MustCompile(`(?i)(/api-docs|(swagger|openapi)[\w.-]*\.json)$`)
+
+// IsAPISpecURL URL 路径是否像 OpenAPI/Swagger 文档（/swagger.json、/openapi.json、/v2/api-docs 等）
+func IsAPISpecURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return apiSpecPathRegex.MatchString(strings.TrimRight(u.Path, "/"))
+}
+
+// IsJavaScriptURL URL 路径或内容类型是否为 JS 文件
+func IsJavaScriptURL(rawURL, contentType string) bool {
+	if strings.Contains(strings.ToLower(contentType), "javascript") {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	return ext == ".js" || ext == ".mjs"
+}
+
+// apiSpec Swagger 2.0 和 OpenAPI 3 文档中提取接口需要的字段
+type apiSpec struct {
+	Swagger  string   `json:"swagger"`
+	OpenAPI  string   `json:"openapi"`
+	Host     string   `json:"host"`
+	BasePath string   `json:"basePath"`
+	Schemes  []string `json:"schemes"`
+	Servers  []struct {
+		URL       string `json:"url"`
+		Variables map[string]struct {
+			Default string `json:"default"`
+		} `json:"variables"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// apiSpecMethods 路径项中表示操作的字段
+var apiSpecMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// ParseOpenAPI 解析 Swagger 2.0 或 OpenAPI 3 文档，每个路径和方法返回一个接口
+// 接口地址按文档中的 host/basePath（Swagger 2.0）或第一个 servers 地址（OpenAPI 3）拼接，
+// 未声明或为相对地址时相对文档地址解析；路径参数保留 {id} 形式
+func ParseOpenAPI(body []byte, docURL string) ([]ExtractedEndpoint, error) {
+	var spec apiSpec
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return nil, err
+	}
+	if spec.Swagger == "" && spec.OpenAPI == "" {
+		return nil, errors.New("not an openapi document")
+	}
+	doc, err := url.Parse(docURL)
+	if err != nil {
+		return nil, err
+	}
+
+	base := specBaseURL(&spec, doc)
+	var endpoints []ExtractedEndpoint
+	for p, item := range spec.Paths {
+		for method := range item {
+			method = strings.ToLower(method)
+			if !apiSpecMethods[method] {
+				continue
+			}
+			endpoints = append(endpoints, ExtractedEndpoint{
+				URL:    strings.TrimRight(base, "/") + "/" + strings.TrimLeft(p, "/"),
+				Method: strings.ToUpper(method),
+			})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].URL != endpoints[j].URL {
+			return endpoints[i].URL < endpoints[j].URL
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints, nil
+}
+
+// specBaseURL 接口的基础地址
+func specBaseURL(spec *apiSpec, doc *url.URL) string {
+	root := &url.URL{Scheme: doc.Scheme, Host: doc.Host}
+	if spec.Swagger != "" {
+		if spec.Host != "" {
+			root.Host = spec.Host
+		}
+		if len(spec.Schemes) > 0 && spec.Host != "" {
+			root.Scheme = strings.ToLower(spec.Schemes[0])
+		}
+		return root.String() + "/" + strings.Trim(spec.BasePath, "/")
+	}
+
+	if len(spec.Servers) == 0 || spec.Servers[0].URL == "" {
+		return root.String()
+	}
+	server := spec.Servers[0].URL
+	for name, v := range spec.Servers[0].Variables {
+		server = strings.ReplaceAll(server, "{"+name+"}", v.Default)
+	}
+	ref, err := url.Parse(server)
+	if err != nil {
+		return root.String()
+	}
+	return doc.ResolveReference(ref).String()
+}
+
+// jsEndpointRegex LinkFinder 风格的接口正则：引号中的完整 URL、/ ./ ../ 开头的路径、
+// 带扩展名或至少两级的相对路径
+var jsEndpointRegex = regexp.MustCompile(strings.ReplaceAll(
+	`[QUOTE]((?:[a-zA-Z]{1,10}://|//)[^QUOTE/\s]+\.[a-zA-Z]{2,}[^QUOTE\s]*`+
+		`|(?:/|\.\./|\./)[^QUOTE><,;|*()%$^\\\[\]\s][^QUOTE><,;|()\s]+`+
+		`|[a-zA-Z0-9_\-/]+/[a-zA-Z0-9_\-/.]+\.(?:[a-zA-Z]{1,4}|action)(?:[?#][^QUOTE\s]*)?`+
+		`|[a-zA-Z0-9_\-/]+/[a-zA-Z0-9_\-/]{3,}(?:[?#][^QUOTE\s]*)?`+
+		`|[a-zA-Z0-9_\-]+\.(?:php|asp|aspx|jsp|json|action|html|js|txt|xml)(?:[?#][^QUOTE\s]*)?)[QUOTE]`,
+	"QUOTE", "\"'`"))
+
+// jsStaticExtensions 静态资源，不作为接口输出
+var jsStaticExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true,
+	".css": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true, ".otf": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".map": true,
+}
+
+// jsNoisePrefixes 形如路径但不是接口的字符串（MIME 类型、日期格式等）
+var jsNoisePrefixes = []string{
+	"text/", "application/", "image/", "audio/", "video/", "font/", "multipart/",
+	"mm/", "dd/", "yyyy/", "m/d/",
+}
+
+// ExtractJSEndpoints 从 JS 内容中提取接口，相对路径按 baseURL 解析，只保留与 baseURL 同一主机的地址
+func ExtractJSEndpoints(body []byte, baseURL string) []ExtractedEndpoint {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var endpoints []ExtractedEndpoint
+	for _, match := range jsEndpointRegex.FindAllSubmatch(body, -1) {
+		raw := string(match[1])
+		if isJSNoise(raw) {
+			continue
+		}
+		ref, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		if ref.Host == "" && ref.Scheme == "" && !strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, ".") {
+			// 不以 / 开头的相对路径按站点根路径解析
+			ref.Path = "/" + ref.Path
+		}
+		u := base.ResolveReference(ref)
+		if !strings.EqualFold(u.Hostname(), base.Hostname()) || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		// 以 / 结尾的多为拼接用的前缀（webpack publicPath、接口根路径）
+		if strings.HasSuffix(u.Path, "/") || jsStaticExtensions[strings.ToLower(path.Ext(u.Path))] {
+			continue
+		}
+		u.Fragment = ""
+		if seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		endpoints = append(endpoints, ExtractedEndpoint{URL: u.String(), Method: http.MethodGet})
+	}
+	return endpoints
+}
+
+// isJSNoise 是否为不像接口的字符串
+func isJSNoise(raw string) bool {
+	lower := strings.ToLower(raw)
+	if strings.HasPrefix(lower, "//www.w3.org") {
+		return true
+	}
+	for _, prefix := range jsNoisePrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package webscan
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/core"
+)
+
+// HTTPProber 对端口扫描未标记为 HTTP 的开放端口做一次 HTTP 探测
+// gogo 对高位端口常常只输出 "tcp"，而 IsHTTPPort 只检查静态端口列表，18080、9999 上的管理后台因此被漏掉。
+// 每个端口先 HTTPS 后 HTTP 各请求一次，结果（包括探测失败）按 host:port 缓存，不会重复探测。
+// 流水线的指纹识别模块在 IP 调度槽位内调用，不是 HTTP 服务的端口直接做端口指纹识别
+type HTTPProber struct {
+	config     HTTPProbeConfig
+	client     *http.Client
+	userAgents *core.UserAgentPicker // nil 使用 core.DefaultUserAgent
+
+	limiter chan struct{} // 同时进行的探测数
+
+	mu      sync.Mutex
+	cache   map[string]*HTTPProbeResult // host:port -> 结果，nil 表示不是 HTTP
+	perHost map[string]int              // 每个主机已探测的端口数
+}
+
+// HTTPProbeConfig HTTP 探测配置
+type HTTPProbeConfig struct {
+	Enabled     bool
+	MinPort     int           // 只探测不小于该端口的端口
+	MaxPerHost  int           // 每个主机最多探测的端口数
+	Concurrency int           // 同时进行的探测数
+	Timeout     time.Duration // 单次请求超时
+}
+
+// HTTPProbeResult HTTP 探测结果
+type HTTPProbeResult struct {
+	Host       string
+	Port       int
+	Protocol   string // http, https
+	URL        string
+	Title      string
+	StatusCode int
+	Server     string
+}
+
+// DefaultHTTPProbeConfig 默认配置：探测 1024 以上的端口
+func DefaultHTTPProbeConfig() HTTPProbeConfig {
+	return HTTPProbeConfig{
+		Enabled:     true,
+		MinPort:     1025,
+		MaxPerHost:  20,
+		Concurrency: 10,
+		Timeout:     core.ShortHTTPTimeout,
+	}
+}
+
+// NewHTTPProber 创建 HTTP 探测器
+func NewHTTPProber(config HTTPProbeConfig) *HTTPProber {
+	defaults := DefaultHTTPProbeConfig()
+	if config.MaxPerHost <= 0 {
+		config.MaxPerHost = defaults.MaxPerHost
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+
+	return &HTTPProber{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				DialContext: (&net.Dialer{
+					Timeout: config.Timeout,
+				}).DialContext,
+				TLSHandshakeTimeout: config.Timeout,
+				DisableKeepAlives:   true,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse // 只需确认是否为 HTTP 服务
+			},
+		},
+		limiter: make(chan struct{}, config.Concurrency),
+		cache:   make(map[string]*HTTPProbeResult),
+		perHost: make(map[string]int),
+	}
+}
+
+// SetNetwork 设置代理和自定义 DNS，nil 使用系统网络
+func (p *HTTPProber) SetNetwork(cfg *core.ScanNetworkConfig) {
+	if transport, ok := p.client.Transport.(*http.Transport); ok {
+		cfg.ApplyTransport(transport, net.Dialer{Timeout: p.config.Timeout})
+	}
+}
+
+// SetUserAgents 设置 User-Agent 策略，nil 使用 core.DefaultUserAgent
+func (p *HTTPProber) SetUserAgents(agents *core.UserAgentPicker) {
+	p.userAgents = agents
+}
+
+// Enabled 是否开启探测
+func (p *HTTPProber) Enabled() bool {
+	return p != nil && p.config.Enabled
+}
+
+// ShouldProbe 端口是否需要探测：已识别为 HTTP、明确不是 HTTP、已识别出其他服务的端口不探测
+func (p *HTTPProber) ShouldProbe(port core.PortResult) bool {
+	if !p.Enabled() || port.State != "open" || port.Port < p.config.MinPort {
+		return false
+	}
+	if core.IsHTTPPort(port.Port) || core.IsNonHTTPPort(port.Port) {
+		return false
+	}
+	if len(port.Fingerprint) > 0 {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(port.Service)) {
+	case "", "tcp", "unknown":
+		return true
+	}
+	return false
+}
+
+// Probe 探测端口，不是 HTTP 服务或超过主机探测上限时返回 nil
+func (p *HTTPProber) Probe(ctx context.Context, host string, port int) *HTTPProbeResult {
+	key := net.JoinHostPort(host, strconv.Itoa(port))
+
+	p.mu.Lock()
+	if result, ok := p.cache[key]; ok {
+		p.mu.Unlock()
+		return result
+	}
+	if p.perHost[host] >= p.config.MaxPerHost {
+		p.mu.Unlock()
+		return nil
+	}
+	p.perHost[host]++
+	p.mu.Unlock()
+
+	select {
+	case p.limiter <- struct{}{}:
+	case <-ctx.Done():
+		return nil
+	}
+	result := p.probe(ctx, host, port, key)
+	<-p.limiter
+
+	// 上下文取消时结果不可信，不缓存
+	if ctx.Err() != nil {
+		return result
+	}
+	p.mu.Lock()
+	p.cache[key] = result
+	p.mu.Unlock()
+	return result
+}
+
+// probe 先 HTTPS 后 HTTP
+func (p *HTTPProber) probe(ctx context.Context, host string, port int, hostPort string) *HTTPProbeResult {
+	for _, protocol := range []string{"https", "http"} {
+		url := protocol + "://" + hostPort
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil
+		}
+		req.Header.Set("User-Agent", p.userAgents.Next())
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		return &HTTPProbeResult{
+			Host:       host,
+			Port:       port,
+			Protocol:   protocol,
+			URL:        url,
+			Title:      core.ExtractTitle(string(body)),
+			StatusCode: resp.StatusCode,
+			Server:     resp.Header.Get("Server"),
+		}
+	}
+	return nil
+}
+
+// Probed 已探测的端口数和识别为 HTTP 的端口数
+func (p *HTTPProber) Probed() (probed, found int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, result := range p.cache {
+		probed++
+		if result != nil {
+			found++
+		}
+	}
+	return probed, found
+}
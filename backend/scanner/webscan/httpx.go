@@ -9,10 +9,11 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"moongazing/scanner/core"
 	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/subdomain"
 	"net"
 	"net/http"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -23,10 +24,15 @@ import (
 // HttpxScanner HTTP 探测器
 type HttpxScanner struct {
 	client            *http.Client
+	resolver          *net.Resolver // 解析 IP 和 CNAME，默认使用系统 DNS
 	fingerprintScanner *fingerprint.FingerprintScanner
 	timeout           time.Duration
 	threads           int
 	followRedirect    bool
+	headers           *core.ScanHeaders // 自定义请求头（认证扫描），同时用于指纹识别
+	userAgents        *core.UserAgentPicker // User-Agent 策略，nil 使用 core.DefaultUserAgent
+	cdnDetector       *subdomain.CDNDetector
+	hostTimeout       time.Duration // 单个目标的探测总时间，0 使用 httpxHostTimeout
 }
 
 // HttpxResult HTTP 探测结果
@@ -42,6 +48,7 @@ type HttpxResult struct {
 	ContentType   string   `json:"content_type"`
 	WebServer     string   `json:"web_server"`
 	Technologies  []string `json:"technologies"`
+	TechVersions  map[string]string `json:"tech_versions,omitempty"` // 规范名称 -> 版本
 	CDN           bool     `json:"cdn"`
 	CDNName       string   `json:"cdn_name"`
 	Favicon       string   `json:"favicon"`       // favicon hash (mmh3)
@@ -50,7 +57,7 @@ type HttpxResult struct {
 	Body          string   `json:"body"`
 	Scheme        string   `json:"scheme"`
 	Error         string   `json:"error,omitempty"`
-	ResponseTime  time.Duration `json:"response_time"`
+	ResponseTimeMs int64        `json:"response_time_ms"`
 }
 
 // NewHttpxScanner 创建 HTTP 探测器
@@ -79,21 +86,90 @@ func NewHttpxScanner(threads int) *HttpxScanner {
 
 	return &HttpxScanner{
 		client:            client,
+		resolver:          net.DefaultResolver,
 		fingerprintScanner: fingerprint.NewFingerprintScanner(threads),
 		timeout:           15 * time.Second,
 		threads:           threads,
 		followRedirect:    true,
+		cdnDetector:       subdomain.NewCDNDetector(),
 	}
 }
 
-// Probe 探测单个目标
+// SetHostTimeout 设置单个目标的探测总时间
+func (h *HttpxScanner) SetHostTimeout(timeout time.Duration) {
+	h.hostTimeout = timeout
+}
+
+// SetThreads 设置并发数（同时用于批量探测和指纹识别）
+func (h *HttpxScanner) SetThreads(threads int) {
+	if threads <= 0 {
+		return
+	}
+	h.threads = threads
+	h.fingerprintScanner.Concurrency = threads
+}
+
+// SetNetwork 设置代理和自定义 DNS（同时用于指纹识别），nil 使用系统网络
+func (h *HttpxScanner) SetNetwork(cfg *core.ScanNetworkConfig) {
+	if transport, ok := h.client.Transport.(*http.Transport); ok {
+		cfg.ApplyTransport(transport, net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 10 * time.Second,
+		})
+	}
+	h.resolver = net.DefaultResolver
+	if r := cfg.Resolver(h.timeout); r != nil {
+		h.resolver = r
+	}
+	h.fingerprintScanner.SetNetwork(cfg)
+}
+
+// SetHeaders 设置自定义请求头（同时用于指纹识别），nil 不设置
+func (h *HttpxScanner) SetHeaders(headers *core.ScanHeaders) {
+	h.headers = headers
+	h.fingerprintScanner.SetHeaders(headers)
+}
+
+// SetUserAgents 设置 User-Agent 策略（同时用于指纹识别），nil 使用 core.DefaultUserAgent
+func (h *HttpxScanner) SetUserAgents(agents *core.UserAgentPicker) {
+	h.userAgents = agents
+	h.fingerprintScanner.SetUserAgents(agents)
+}
+
+// httpxHostTimeout 单个目标的探测总时间（DNS 解析、HTTP/HTTPS 请求、指纹识别和 favicon）
+const httpxHostTimeout = 45 * time.Second
+
+// httpxResponse 单个协议的响应
+type httpxResponse struct {
+	scheme    string
+	url       string
+	status    int
+	header    http.Header
+	body      []byte
+	elapsedMs int64
+	err       error
+}
+
+// Probe 探测单个目标，target 为域名或 host:port
 func (h *HttpxScanner) Probe(ctx context.Context, target string) *HttpxResult {
 	result := &HttpxResult{
 		Host: target,
 	}
+	
+	hostTimeout := h.hostTimeout
+	if hostTimeout <= 0 {
+		hostTimeout = httpxHostTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, hostTimeout)
+	defer cancel()
+	
+	host := target
+	if hostname, _, err := net.SplitHostPort(target); err == nil {
+		host = hostname
+	}
 
 	// 1. DNS 解析获取 IP
-	ips, err := net.LookupIP(target)
+	ips, err := h.resolver.LookupIP(ctx, "ip", host)
 	if err == nil {
 		for _, ip := range ips {
 			if ipv4 := ip.To4(); ipv4 != nil {
@@ -105,72 +181,98 @@ func (h *HttpxScanner) Probe(ctx context.Context, target string) *HttpxResult {
 		}
 	}
 
-	// 2. 检测 CDN
-	result.CDN, result.CDNName = h.detectCDN(target, result.IPs)
-
-	// 3. HTTP/HTTPS 探测
-	schemes := []string{"https", "http"}
-	for _, scheme := range schemes {
-		url := fmt.Sprintf("%s://%s", scheme, target)
-		
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			continue
-		}
-		
-		// 设置常用 headers
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-		req.Header.Set("Accept-Language", "en-US,en;q=0.5")
-		req.Header.Set("Connection", "close")
-		
-		startTime := time.Now()
-		resp, err := h.client.Do(req)
-		if err != nil {
-			continue
-		}
-		
-		result.ResponseTime = time.Since(startTime)
-		result.URL = url
-		result.Scheme = scheme
-		result.StatusCode = resp.StatusCode
-		result.ContentType = resp.Header.Get("Content-Type")
-		result.WebServer = resp.Header.Get("Server")
-		
-		// 读取响应头
-		var headerBuilder strings.Builder
-		for key, values := range resp.Header {
-			for _, value := range values {
-				headerBuilder.WriteString(fmt.Sprintf("%s: %s\n", key, value))
-			}
+	// 2. HTTP/HTTPS 同时探测，都有响应时使用 HTTPS（HTTPS 端口对明文请求也会返回 400）
+	responses := make([]*httpxResponse, 2)
+	var wg sync.WaitGroup
+	for i, scheme := range []string{"https", "http"} {
+		wg.Add(1)
+		go func(i int, scheme string) {
+			defer wg.Done()
+			responses[i] = h.fetch(ctx, scheme, fmt.Sprintf("%s://%s", scheme, target))
+		}(i, scheme)
+	}
+	wg.Wait()
+	
+	var resp *httpxResponse
+	for _, r := range responses {
+		if r.err == nil {
+			resp = r
+			break
 		}
-		result.RawHeaders = headerBuilder.String()
-		
-		// 读取响应体
-		bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // 限制 1MB
-		resp.Body.Close()
-		if err == nil {
-			result.Body = string(bodyBytes)
-			result.ContentLength = len(bodyBytes)
-			
-			// 提取 Title
-			result.Title = h.extractTitle(result.Body)
+	}
+	if resp == nil {
+		result.Error = responses[0].err.Error()
+		result.CDN, result.CDNName = h.detectCDN(ctx, host, result.IPs, nil)
+		return result
+	}
+	
+	result.ResponseTimeMs = resp.elapsedMs
+	result.URL = resp.url
+	result.Scheme = resp.scheme
+	result.StatusCode = resp.status
+	result.ContentType = resp.header.Get("Content-Type")
+	result.WebServer = resp.header.Get("Server")
+	
+	// 响应头
+	var headerBuilder strings.Builder
+	for key, values := range resp.header {
+		for _, value := range values {
+			headerBuilder.WriteString(fmt.Sprintf("%s: %s\n", key, value))
 		}
-		
-		// 4. 指纹识别
-		result.Technologies = h.detectFingerprint(ctx, url, result.Body, result.RawHeaders, result.Title, result.WebServer)
-		
-		// 5. 获取 favicon
-		faviconURL := fmt.Sprintf("%s://%s/favicon.ico", scheme, target)
-		result.Favicon, result.FaviconData = h.getFavicon(ctx, faviconURL)
-		
-		break // 成功则不再尝试另一个协议
 	}
+	result.RawHeaders = headerBuilder.String()
+	
+	// 响应体按页面编码转为 UTF-8 后提取 Title
+	result.Body = fingerprint.DecodeBody(resp.body, result.ContentType)
+	result.ContentLength = len(resp.body)
+	result.Title = fingerprint.ExtractPageTitle(result.Body)
+	
+	// 3. 检测 CDN
+	result.CDN, result.CDNName = h.detectCDN(ctx, host, result.IPs, resp.header)
+	
+	// 4. 指纹识别
+	result.Technologies, result.TechVersions = h.detectFingerprint(ctx, result.URL, result.Body, result.RawHeaders, result.Title, result.WebServer)
+	
+	// 5. 获取 favicon
+	faviconURL := fmt.Sprintf("%s://%s/favicon.ico", resp.scheme, target)
+	result.Favicon, result.FaviconData = h.getFavicon(ctx, faviconURL)
 	
 	return result
 }
 
-// ProbeMultiple 批量探测多个目标
+// fetch 请求首页并读取响应体
+func (h *HttpxScanner) fetch(ctx context.Context, scheme, url string) *httpxResponse {
+	r := &httpxResponse{scheme: scheme, url: url}
+	
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	
+	// 设置常用 headers
+	req.Header.Set("User-Agent", h.userAgents.Next())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	req.Header.Set("Connection", "close")
+	h.headers.Apply(req)
+	
+	startTime := time.Now()
+	resp, err := h.client.Do(req)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer resp.Body.Close()
+	
+	r.elapsedMs = core.MillisSince(startTime)
+	r.status = resp.StatusCode
+	r.header = resp.Header
+	r.body, _ = io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // 限制 1MB
+	return r
+}
+
+// ProbeMultiple 批量探测多个目标，ctx 结束后不再开始新的目标
 func (h *HttpxScanner) ProbeMultiple(ctx context.Context, targets []string) []*HttpxResult {
 	results := make([]*HttpxResult, 0, len(targets))
 	var mu sync.Mutex
@@ -182,13 +284,13 @@ func (h *HttpxScanner) ProbeMultiple(ctx context.Context, targets []string) []*H
 	for _, target := range targets {
 		select {
 		case <-ctx.Done():
+		case semaphore <- struct{}{}:
+		}
+		if ctx.Err() != nil {
 			break
-		default:
 		}
 		
 		wg.Add(1)
-		semaphore <- struct{}{}
-		
 		go func(t string) {
 			defer func() {
 				<-semaphore
@@ -207,99 +309,34 @@ func (h *HttpxScanner) ProbeMultiple(ctx context.Context, targets []string) []*H
 	return results
 }
 
-// extractTitle 提取网页标题
-func (h *HttpxScanner) extractTitle(body string) string {
-	// 使用正则表达式提取 title
-	re := regexp.MustCompile(`(?i)<title[^>]*>([^<]+)</title>`)
-	matches := re.FindStringSubmatch(body)
-	if len(matches) > 1 {
-		title := strings.TrimSpace(matches[1])
-		// 限制长度
-		if len(title) > 200 {
-			title = title[:200] + "..."
+// detectCDN 按 CDN 配置（cdn.yaml）的 CNAME、IP 段和响应头检测 CDN
+func (h *HttpxScanner) detectCDN(ctx context.Context, host string, ips []string, headers http.Header) (bool, string) {
+	var cnames []string
+	if net.ParseIP(host) == nil {
+		cname, err := h.resolver.LookupCNAME(ctx, host)
+		if err == nil && cname != "" && !strings.EqualFold(strings.TrimSuffix(cname, "."), host) {
+			cnames = append(cnames, cname)
 		}
-		return title
 	}
-	return ""
-}
-
-// detectCDN 检测 CDN
-func (h *HttpxScanner) detectCDN(host string, ips []string) (bool, string) {
-	// 1. 通过 CNAME 检测
-	cnames, err := net.LookupCNAME(host)
-	if err == nil && cnames != "" {
-		cdnCnames := map[string]string{
-			"cloudflare":     "Cloudflare",
-			"cloudfront":     "CloudFront",
-			"akamai":         "Akamai",
-			"fastly":         "Fastly",
-			"cdn.":           "CDN",
-			"cdnify":         "CDNify",
-			"edgecast":       "EdgeCast",
-			"azureedge":      "Azure CDN",
-			"googleusercontent": "Google Cloud CDN",
-			"kunlunaq":       "阿里云CDN",
-			"kunluncan":      "阿里云CDN",
-			"alikunlun":      "阿里云CDN",
-			"kunlunsl":       "阿里云CDN",
-			"cdngslb":        "阿里云CDN",
-			"tbcache":        "阿里云CDN",
-			"alicdn":         "阿里云CDN",
-			"aliyuncs":       "阿里云",
-			"qiniu":          "七牛云CDN",
-			"qiniudns":       "七牛云CDN",
-			"qbox":           "七牛云CDN",
-			"baidubce":       "百度云CDN",
-			"bcebos":         "百度云CDN",
-			"bdydns":         "百度云CDN",
-			"tcdn":           "腾讯云CDN",
-			"dnsv1":          "腾讯云CDN",
-			"tdnsv5":         "腾讯云CDN",
-			"cdn.myqcloud":   "腾讯云CDN",
-			"wangsucdn":      "网宿CDN",
-			"wsglb":          "网宿CDN",
-			"chinanetcenter": "网宿CDN",
-			"lxdns":          "蓝汛CDN",
-			"chinacache":     "蓝汛CDN",
-			"speedcdns":      "加速乐CDN",
-			"jiashule":       "加速乐CDN",
-			"yunjiasu":       "百度云加速",
-			"yundunddos":     "云盾CDN",
-			"vercel-dns":     "Vercel",
-			"incapdns":       "Imperva",
-			"edgesuite":      "Akamai",
-		}
-		
-		cnameLower := strings.ToLower(cnames)
-		for pattern, name := range cdnCnames {
-			if strings.Contains(cnameLower, pattern) {
-				return true, name
-			}
-		}
-	}
-	
-	// 2. 通过 IP 数量判断（多个 IP 可能是 CDN）
-	if len(ips) > 3 {
-		return true, "Unknown CDN"
-	}
-	
-	// 3. 通过 IP 范围检测（常见 CDN IP 段）
-	// TODO: 添加更多 CDN IP 范围检测
-	
-	return false, ""
+	isCDN, provider, _ := h.cdnDetector.Evaluate(cnames, ips, headers)
+	return isCDN, provider
 }
 
 // detectFingerprint 检测指纹
-func (h *HttpxScanner) detectFingerprint(ctx context.Context, url, body, headers, title, server string) []string {
+func (h *HttpxScanner) detectFingerprint(ctx context.Context, url, body, headers, title, server string) ([]string, map[string]string) {
 	// 使用指纹扫描器
 	fpResult := h.fingerprintScanner.ScanFingerprint(ctx, url)
 	
-	technologies := make([]string, 0)
+	// 指纹与 Server 头（如 "nginx/1.18.0"）按规范名称合并
+	techs := core.DefaultTechNormalizer().NewSet()
 	for _, fp := range fpResult.Fingerprints {
-		technologies = append(technologies, fp.Name)
+		techs.AddVersion(fp.Name, fp.Version)
+	}
+	if server != "" {
+		techs.Add(core.ServerProduct(server))
 	}
 	
-	return technologies
+	return techs.Names(), techs.Versions()
 }
 
 // getFavicon 获取 favicon 并计算 hash
@@ -309,7 +346,8 @@ func (h *HttpxScanner) getFavicon(ctx context.Context, faviconURL string) (strin
 		return "", nil
 	}
 	
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("User-Agent", h.userAgents.Next())
+	h.headers.Apply(req)
 	
 	resp, err := h.client.Do(req)
 	if err != nil {
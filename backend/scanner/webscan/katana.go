@@ -21,6 +21,11 @@ type KatanaScanner struct {
 	RateLimit        int    // 每秒请求数
 	TempDir          string
 	ExecutionTimeout int    // 执行超时时间（分钟）
+	OutOfScope       []string // 排除范围的 URL 正则（-cos），命中的 URL 不会被爬取
+	Proxy            string   // 代理地址（-proxy）
+	Resolvers        []string // 自定义 DNS 服务器（-resolvers），运行时写入临时文件
+	Headers          []string // 自定义请求头 "Name: value"（-H），用于认证扫描
+	UserAgents       *core.UserAgentPicker // User-Agent 策略，每次运行选择一个通过 -H 传入，nil 使用 katana 的默认值
 }
 
 // KatanaResult Katana 爬虫结果
@@ -29,31 +34,85 @@ type KatanaResult struct {
 	URLs      []KatanaCrawledURL  `json:"urls"`
 	StartTime time.Time           `json:"start_time"`
 	EndTime   time.Time           `json:"end_time"`
-	Duration  string              `json:"duration"`
+	DurationMs int64              `json:"duration_ms"`
 	Total     int                 `json:"total"`
 }
 
 // KatanaCrawledURL 爬取到的URL
 type KatanaCrawledURL struct {
-	URL        string `json:"url"`
-	Method     string `json:"method,omitempty"`
-	StatusCode int    `json:"status_code,omitempty"`
-	Source     string `json:"source,omitempty"` // 来源：form, script, link, etc.
+	URL        string            `json:"url"`
+	Method     string            `json:"method,omitempty"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Source     string            `json:"source,omitempty"`  // 来源：form, script, link, etc.
+	Body       string            `json:"body,omitempty"`    // 请求体（表单提交等）
+	Headers    map[string]string `json:"headers,omitempty"` // 请求头
+	// 请求参数，见 ParseRequestParams
+	ContentType string      `json:"content_type,omitempty"` // 请求的 Content-Type
+	Parameters  []string    `json:"parameters,omitempty"`   // 查询参数名和请求体参数名
+	FormFields  []FormField `json:"form_fields,omitempty"`  // 表单提交的字段名和类型
 }
 
 // KatanaJSONOutput Katana JSON 输出格式
 type KatanaJSONOutput struct {
 	Timestamp string `json:"timestamp"`
 	Request   struct {
-		Method   string `json:"method"`
-		Endpoint string `json:"endpoint"`
-		Raw      string `json:"raw"`
+		Method   string            `json:"method"`
+		Endpoint string            `json:"endpoint"`
+		Body     string            `json:"body"`
+		Headers  map[string]string `json:"headers"`
+		Source   string            `json:"source"`
+		Raw      string            `json:"raw"`
 	} `json:"request"`
 	Response struct {
 		StatusCode int `json:"status_code"`
 	} `json:"response"`
 }
 
+// crawledURL 转换为爬取结果，保留表单请求的方法、请求体和请求头，并解析请求参数
+// 请求体或请求头缺失时从原始请求（request.raw）中读取
+func (o *KatanaJSONOutput) crawledURL() KatanaCrawledURL {
+	crawled := KatanaCrawledURL{
+		URL:        o.Request.Endpoint,
+		Method:     o.Request.Method,
+		StatusCode: o.Response.StatusCode,
+		Source:     o.Request.Source,
+		Body:       o.Request.Body,
+		Headers:    o.Request.Headers,
+	}
+	if o.Request.Raw != "" && (crawled.Body == "" || len(crawled.Headers) == 0) {
+		headers, body := ParseRawRequest(o.Request.Raw)
+		if crawled.Body == "" {
+			crawled.Body = body
+		}
+		if len(crawled.Headers) == 0 && len(headers) > 0 {
+			crawled.Headers = headers
+		}
+	}
+	params := ParseRequestParams(crawled.URL, headerValue(crawled.Headers, "Content-Type"), crawled.Body)
+	crawled.ContentType = params.ContentType
+	crawled.Parameters = params.Parameters
+	crawled.FormFields = params.FormFields
+	return crawled
+}
+
+// headerValue 不区分大小写读取请求头
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// key 去重键：同一地址的 GET 和表单提交是不同的请求
+func (u KatanaCrawledURL) key() string {
+	if u.Method == "" || strings.EqualFold(u.Method, "GET") {
+		return u.URL
+	}
+	return strings.ToUpper(u.Method) + " " + u.URL + "\n" + u.Body
+}
+
 // NewKatanaScanner 创建 Katana 扫描器
 func NewKatanaScanner() *KatanaScanner {
 	tm := core.NewToolsManager()
@@ -70,6 +129,94 @@ func NewKatanaScanner() *KatanaScanner {
 	}
 }
 
+// outOfScopeArgs 构建排除范围参数
+func (k *KatanaScanner) outOfScopeArgs() []string {
+	var args []string
+	for _, expr := range k.OutOfScope {
+		args = append(args, "-cos", expr)
+	}
+	return args
+}
+
+// SetNetwork 设置代理和自定义 DNS，返回当前 katana 版本不支持的设置（对应参数不传）
+// katana 不支持 DoH，开启 DoH 时使用系统 DNS
+func (k *KatanaScanner) SetNetwork(cfg *core.ScanNetworkConfig) []string {
+	k.Proxy, k.Resolvers = "", nil
+	var unsupported []string
+	if cfg.HasProxy() {
+		if core.ToolSupportsFlag(k.BinPath, "-proxy") {
+			k.Proxy = cfg.Proxy
+		} else {
+			unsupported = append(unsupported, "proxy")
+		}
+	}
+	switch {
+	case cfg.DoH:
+		unsupported = append(unsupported, "doh")
+	case cfg.HasResolvers():
+		if core.ToolSupportsFlag(k.BinPath, "-resolvers") {
+			k.Resolvers = cfg.ResolverServers()
+		} else {
+			unsupported = append(unsupported, "resolvers")
+		}
+	}
+	return unsupported
+}
+
+// SetHeaders 设置自定义请求头，当前 katana 版本不支持 -H 时返回 true（不传参数）
+func (k *KatanaScanner) SetHeaders(headers *core.ScanHeaders) (unsupported bool) {
+	k.Headers = nil
+	if headers.IsEmpty() {
+		return false
+	}
+	if !core.ToolSupportsFlag(k.BinPath, "-H") {
+		return true
+	}
+	k.Headers = headers.Lines()
+	return false
+}
+
+// SetUserAgents 设置 User-Agent 策略，当前 katana 版本不支持 -H 时返回 true（不传参数）
+func (k *KatanaScanner) SetUserAgents(agents *core.UserAgentPicker) (unsupported bool) {
+	k.UserAgents = nil
+	if agents == nil {
+		return false
+	}
+	if !core.ToolSupportsFlag(k.BinPath, "-H") {
+		return true
+	}
+	k.UserAgents = agents
+	return false
+}
+
+// headerArgs 自定义请求头参数，自定义请求头未设置 User-Agent 时带上按策略选择的 User-Agent
+func (k *KatanaScanner) headerArgs() []string {
+	var args []string
+	for _, header := range k.Headers {
+		args = append(args, "-H", header)
+	}
+	if line := k.UserAgents.UserAgentLine(k.Headers); line != "" {
+		args = append(args, "-H", line)
+	}
+	return args
+}
+
+// networkArgs 构建代理和 DNS 参数，DNS 服务器写入临时文件，调用方负责删除
+func (k *KatanaScanner) networkArgs() ([]string, *core.InputFile, error) {
+	var args []string
+	if k.Proxy != "" {
+		args = append(args, "-proxy", k.Proxy)
+	}
+	if len(k.Resolvers) == 0 {
+		return args, nil, nil
+	}
+	file, err := (&core.ScanNetworkConfig{Resolvers: k.Resolvers}).WriteResolversFile(k.TempDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create resolvers file: %v", err)
+	}
+	return append(args, "-resolvers", file.Name()), file, nil
+}
+
 // IsAvailable 检查是否可用
 func (k *KatanaScanner) IsAvailable() bool {
 	return k.BinPath != "" && core.FileExists(k.BinPath)
@@ -113,12 +260,26 @@ func (k *KatanaScanner) Crawl(ctx context.Context, target string) (*KatanaResult
 		"-jsonl", // 使用 JSON Lines 格式输出，包含状态码等信息
 		"-o", outputPath,
 	}
+	args = append(args, k.outOfScopeArgs()...)
+	netArgs, resolvers, err := k.networkArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, netArgs...)
+	args = append(args, k.headerArgs()...)
 
 	cmd := exec.CommandContext(ctx, k.BinPath, args...)
+	run := core.StartToolCommand(ctx, "katana", cmd)
+	run.SetOutputFile(outputPath)
+	if resolvers != nil {
+		defer os.Remove(resolvers.Name())
+		run.AddInput(resolvers.Input())
+	}
 
-	fmt.Printf("[*] Running Katana: %s %s\n", k.BinPath, strings.Join(args, " "))
+	fmt.Printf("[*] Running Katana: %s %s\n", k.BinPath, strings.Join(core.RedactArgs(args), " "))
 
 	err = cmd.Run()
+	run.Finish(err)
 	if err != nil {
 		if ctx.Err() != nil {
 			return result, ctx.Err()
@@ -145,14 +306,9 @@ func (k *KatanaScanner) Crawl(ctx context.Context, target string) (*KatanaResult
 		// 尝试解析 JSON 格式
 		var jsonOutput KatanaJSONOutput
 		if err := json.Unmarshal([]byte(line), &jsonOutput); err == nil {
-			url := jsonOutput.Request.Endpoint
-			if url != "" && !seen[url] {
-				seen[url] = true
-				result.URLs = append(result.URLs, KatanaCrawledURL{
-					URL:        url,
-					Method:     jsonOutput.Request.Method,
-					StatusCode: jsonOutput.Response.StatusCode,
-				})
+			if crawled := jsonOutput.crawledURL(); crawled.URL != "" && !seen[crawled.key()] {
+				seen[crawled.key()] = true
+				result.URLs = append(result.URLs, crawled)
 			}
 		} else {
 			// 纯文本格式（每行一个URL）
@@ -166,7 +322,7 @@ func (k *KatanaScanner) Crawl(ctx context.Context, target string) (*KatanaResult
 	}
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	result.Total = len(result.URLs)
 
 	return result, nil
@@ -204,7 +360,7 @@ func (k *KatanaScanner) CrawlList(ctx context.Context, urls []string) (*KatanaRe
 	}
 
 	// 创建输入文件（URL列表）
-	inputFile, err := os.CreateTemp(k.TempDir, "katana_input_*.txt")
+	inputFile, err := core.CreateInputFile(k.TempDir, "katana_input_*.txt")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create input file: %v", err)
 	}
@@ -242,12 +398,27 @@ func (k *KatanaScanner) CrawlList(ctx context.Context, urls []string) (*KatanaRe
 		"-jsonl",
 		"-o", outputPath,
 	}
+	args = append(args, k.outOfScopeArgs()...)
+	netArgs, resolvers, err := k.networkArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, netArgs...)
+	args = append(args, k.headerArgs()...)
 
 	cmd := exec.CommandContext(ctx, k.BinPath, args...)
+	run := core.StartToolCommand(ctx, "katana", cmd)
+	run.SetOutputFile(outputPath)
+	run.AddInput(inputFile.Input())
+	if resolvers != nil {
+		defer os.Remove(resolvers.Name())
+		run.AddInput(resolvers.Input())
+	}
 
 	fmt.Printf("[*] Running Katana (list mode): %s -list [%d urls] ...\n", k.BinPath, len(urls))
 
 	err = cmd.Run()
+	run.Finish(err)
 	if err != nil {
 		if ctx.Err() != nil {
 			return result, ctx.Err()
@@ -273,14 +444,9 @@ func (k *KatanaScanner) CrawlList(ctx context.Context, urls []string) (*KatanaRe
 
 		var jsonOutput KatanaJSONOutput
 		if err := json.Unmarshal([]byte(line), &jsonOutput); err == nil {
-			url := jsonOutput.Request.Endpoint
-			if url != "" && !seen[url] {
-				seen[url] = true
-				result.URLs = append(result.URLs, KatanaCrawledURL{
-					URL:        url,
-					Method:     jsonOutput.Request.Method,
-					StatusCode: jsonOutput.Response.StatusCode,
-				})
+			if crawled := jsonOutput.crawledURL(); crawled.URL != "" && !seen[crawled.key()] {
+				seen[crawled.key()] = true
+				result.URLs = append(result.URLs, crawled)
 			}
 		} else {
 			if !seen[line] {
@@ -293,7 +459,7 @@ func (k *KatanaScanner) CrawlList(ctx context.Context, urls []string) (*KatanaRe
 	}
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	result.Total = len(result.URLs)
 
 	fmt.Printf("[*] Katana list crawl completed: %d URLs found from %d targets\n", result.Total, len(urls))
@@ -2,12 +2,15 @@ package webscan
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"moongazing/scanner/core"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -20,6 +23,7 @@ type RadScanner struct {
 	Concurrency      int    // 并发数
 	TempDir          string
 	ExecutionTimeout int    // 执行超时时间（分钟）
+	Proxy            string // HTTP 代理地址（--http-proxy）
 }
 
 // RadResult rad 爬虫结果
@@ -28,24 +32,90 @@ type RadResult struct {
 	URLs      []RadURL     `json:"urls"`
 	StartTime time.Time    `json:"start_time"`
 	EndTime   time.Time    `json:"end_time"`
-	Duration  string       `json:"duration"`
+	DurationMs int64       `json:"duration_ms"`
 	Total     int          `json:"total"`
 }
 
 // RadURL rad 发现的 URL
 type RadURL struct {
-	URL        string `json:"url"`
-	Method     string `json:"method,omitempty"`
-	Source     string `json:"source,omitempty"`
-	ParentURL  string `json:"parent_url,omitempty"`
+	URL        string            `json:"url"`
+	Method     string            `json:"method,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	ParentURL  string            `json:"parent_url,omitempty"`
+	Body       string            `json:"body,omitempty"`    // 请求体（表单提交等）
+	Headers    map[string]string `json:"headers,omitempty"` // 请求头
+	// 请求参数，见 ParseRequestParams
+	ContentType string      `json:"content_type,omitempty"` // 请求的 Content-Type
+	Parameters  []string    `json:"parameters,omitempty"`   // 查询参数名和请求体参数名
+	FormFields  []FormField `json:"form_fields,omitempty"`  // 表单提交的字段名和类型
 }
 
 // RadJSONOutput rad JSON 输出格式
 type RadJSONOutput struct {
-	URL       string `json:"url"`
-	Method    string `json:"method"`
-	Source    string `json:"source"`
-	ParentURL string `json:"parent_url"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Source    string            `json:"source"`
+	ParentURL string            `json:"parent_url"`
+	Header    map[string]string `json:"header"`
+	Body      string            `json:"body"`
+	B64Body   string            `json:"b64_body"` // rad 以 base64 输出请求体
+}
+
+// radURL 转换为爬取结果，解码请求体
+func (o *RadJSONOutput) radURL() RadURL {
+	body := o.Body
+	if body == "" && o.B64Body != "" {
+		if decoded, err := base64.StdEncoding.DecodeString(o.B64Body); err == nil {
+			body = string(decoded)
+		}
+	}
+	return RadURL{
+		URL:       o.URL,
+		Method:    o.Method,
+		Source:    o.Source,
+		ParentURL: o.ParentURL,
+		Body:      body,
+		Headers:   o.Header,
+	}.withParams()
+}
+
+// withParams 解析请求参数
+func (u RadURL) withParams() RadURL {
+	params := ParseRequestParams(u.URL, headerValue(u.Headers, "Content-Type"), u.Body)
+	u.ContentType = params.ContentType
+	u.Parameters = params.Parameters
+	u.FormFields = params.FormFields
+	return u
+}
+
+// parseRadLine 解析 rad 的一行输出：JSON（--json-output）、"POST http://..."（文本输出，带请求方法）或单独的 URL
+func parseRadLine(line string) (RadURL, bool) {
+	var jsonOutput RadJSONOutput
+	if err := json.Unmarshal([]byte(line), &jsonOutput); err == nil {
+		found := jsonOutput.radURL()
+		return found, found.URL != ""
+	}
+	if method, rawURL, ok := strings.Cut(line, " "); ok && radMethod.MatchString(method) {
+		rawURL = strings.TrimSpace(rawURL)
+		if strings.HasPrefix(rawURL, "http") {
+			return RadURL{URL: rawURL, Method: method}.withParams(), true
+		}
+	}
+	if strings.HasPrefix(line, "http") {
+		return RadURL{URL: line}.withParams(), true
+	}
+	return RadURL{}, false
+}
+
+// radMethod 文本输出行首的请求方法
+var radMethod = regexp.MustCompile(`^(GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS)$`)
+
+// key 去重键：同一地址的 GET 和表单提交是不同的请求
+func (u RadURL) key() string {
+	if u.Method == "" || strings.EqualFold(u.Method, "GET") {
+		return u.URL
+	}
+	return strings.ToUpper(u.Method) + " " + u.URL + "\n" + u.Body
 }
 
 // NewRadScanner 创建 rad 扫描器
@@ -68,6 +138,26 @@ func (r *RadScanner) IsAvailable() bool {
 	return r.BinPath != "" && core.FileExists(r.BinPath)
 }
 
+// SetNetwork 设置代理，返回不支持的设置（对应参数不传）
+// rad 只支持 HTTP 代理，也没有指定 DNS 服务器的参数
+func (r *RadScanner) SetNetwork(cfg *core.ScanNetworkConfig) []string {
+	r.Proxy = ""
+	var unsupported []string
+	if cfg.HasProxy() {
+		if !cfg.IsSOCKSProxy() && core.ToolSupportsFlag(r.BinPath, "--http-proxy") {
+			r.Proxy = cfg.Proxy
+		} else {
+			unsupported = append(unsupported, "proxy")
+		}
+	}
+	if cfg.DoH {
+		unsupported = append(unsupported, "doh")
+	} else if cfg.HasResolvers() {
+		unsupported = append(unsupported, "resolvers")
+	}
+	return unsupported
+}
+
 // Crawl 使用浏览器爬取目标
 func (r *RadScanner) Crawl(ctx context.Context, target string) (*RadResult, error) {
 	if !r.IsAvailable() {
@@ -100,28 +190,37 @@ func (r *RadScanner) Crawl(ctx context.Context, target string) (*RadResult, erro
 		"-t", target,
 		"-o", outputPath,
 	}
+	if r.Proxy != "" {
+		args = append(args, "--http-proxy", r.Proxy)
+	}
 
 	cmd := exec.CommandContext(ctx, r.BinPath, args...)
 
 	// 设置环境变量以无头模式运行
 	cmd.Env = append(os.Environ(), "DISPLAY=")
 
-	fmt.Printf("[*] Running rad: %s %s\n", r.BinPath, strings.Join(args, " "))
+	fmt.Printf("[*] Running rad: %s %s\n", r.BinPath, strings.Join(core.RedactArgs(args), " "))
 
-	// 使用 CombinedOutput 捕获所有输出
-	output, err := cmd.CombinedOutput()
+	// 捕获 stdout 和 stderr 的全部输出
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	run := core.StartToolCommand(ctx, "rad", cmd)
+	run.SetOutputFile(outputPath)
+	err = cmd.Run()
+	run.Finish(err)
 	if err != nil {
 		if ctx.Err() != nil {
 			return result, ctx.Err()
 		}
-		fmt.Printf("[!] rad error: %v, output: %s\n", err, string(output))
+		fmt.Printf("[!] rad error: %v, output: %s\n", err, output.String())
 	}
 
 	// 解析输出文件
 	file, err := os.Open(outputPath)
 	if err != nil {
 		// 如果没有输出文件，尝试从 stdout 解析
-		return r.parseOutput(string(output), result), nil
+		return r.parseOutput(output.String(), result), nil
 	}
 	defer file.Close()
 
@@ -133,32 +232,14 @@ func (r *RadScanner) Crawl(ctx context.Context, target string) (*RadResult, erro
 		if line == "" {
 			continue
 		}
-
-		// 尝试解析 JSON
-		var jsonOutput RadJSONOutput
-		if err := json.Unmarshal([]byte(line), &jsonOutput); err == nil {
-			if jsonOutput.URL != "" && !seen[jsonOutput.URL] {
-				seen[jsonOutput.URL] = true
-				result.URLs = append(result.URLs, RadURL{
-					URL:       jsonOutput.URL,
-					Method:    jsonOutput.Method,
-					Source:    jsonOutput.Source,
-					ParentURL: jsonOutput.ParentURL,
-				})
-			}
-		} else {
-			// 纯文本，每行一个 URL
-			if strings.HasPrefix(line, "http") && !seen[line] {
-				seen[line] = true
-				result.URLs = append(result.URLs, RadURL{
-					URL: line,
-				})
-			}
+		if found, ok := parseRadLine(line); ok && !seen[found.key()] {
+			seen[found.key()] = true
+			result.URLs = append(result.URLs, found)
 		}
 	}
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	result.Total = len(result.URLs)
 
 	return result, nil
@@ -174,29 +255,14 @@ func (r *RadScanner) parseOutput(output string, result *RadResult) *RadResult {
 		if line == "" {
 			continue
 		}
-
-		// 尝试解析 JSON
-		var jsonOutput RadJSONOutput
-		if err := json.Unmarshal([]byte(line), &jsonOutput); err == nil {
-			if jsonOutput.URL != "" && !seen[jsonOutput.URL] {
-				seen[jsonOutput.URL] = true
-				result.URLs = append(result.URLs, RadURL{
-					URL:       jsonOutput.URL,
-					Method:    jsonOutput.Method,
-					Source:    jsonOutput.Source,
-					ParentURL: jsonOutput.ParentURL,
-				})
-			}
-		} else if strings.HasPrefix(line, "http") && !seen[line] {
-			seen[line] = true
-			result.URLs = append(result.URLs, RadURL{
-				URL: line,
-			})
+		if found, ok := parseRadLine(line); ok && !seen[found.key()] {
+			seen[found.key()] = true
+			result.URLs = append(result.URLs, found)
 		}
 	}
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 	result.Total = len(result.URLs)
 
 	return result
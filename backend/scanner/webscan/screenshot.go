@@ -0,0 +1,121 @@
+package webscan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"moongazing/scanner/core"
+)
+
+// ScreenshotCapturer 使用无头 Chrome 截取页面截图
+// 调用 chrome --headless --screenshot=<文件>，优先使用 tools 目录中的 chrome，找不到时在 PATH 中查找
+type ScreenshotCapturer struct {
+	BinPath      string
+	Timeout      int // 单个页面超时(秒)
+	WindowWidth  int
+	WindowHeight int
+}
+
+// screenshotBrowsers tools 目录中没有 chrome 时在 PATH 中查找的浏览器
+var screenshotBrowsers = []string{"chrome", "chromium", "chromium-browser", "google-chrome"}
+
+// FindScreenshotBrowser 查找截图使用的浏览器，找不到时返回空字符串
+func FindScreenshotBrowser(tm *core.ToolsManager) string {
+	if path := tm.GetToolPath("chrome"); path != "" {
+		return path
+	}
+	for _, name := range screenshotBrowsers {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// NewScreenshotCapturer 创建截图器
+func NewScreenshotCapturer() *ScreenshotCapturer {
+	return &ScreenshotCapturer{
+		BinPath:      FindScreenshotBrowser(core.NewToolsManager()),
+		Timeout:      30,
+		WindowWidth:  1366,
+		WindowHeight: 768,
+	}
+}
+
+// IsAvailable 检查是否可用
+func (s *ScreenshotCapturer) IsAvailable() bool {
+	return s.BinPath != "" && core.FileExists(s.BinPath)
+}
+
+// buildArgs 构建命令参数
+func (s *ScreenshotCapturer) buildArgs(target, outputPath string) []string {
+	return []string{
+		"--headless",
+		"--disable-gpu",
+		"--no-sandbox",
+		"--hide-scrollbars",
+		"--ignore-certificate-errors",
+		fmt.Sprintf("--window-size=%d,%d", s.WindowWidth, s.WindowHeight),
+		"--screenshot=" + outputPath,
+		target,
+	}
+}
+
+// Capture 截取页面并保存为 PNG，超时、浏览器出错或没有生成文件时返回错误
+func (s *ScreenshotCapturer) Capture(ctx context.Context, target, outputPath string) error {
+	if !s.IsAvailable() {
+		return fmt.Errorf("chrome not available")
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create screenshot dir: %v", err)
+	}
+
+	timeout := time.Duration(s.Timeout) * time.Second
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := s.buildArgs(target, outputPath)
+	cmd := exec.CommandContext(execCtx, s.BinPath, args...)
+	// 浏览器的子进程可能继续持有输出管道，超时后不无限等待
+	cmd.WaitDelay = 2 * time.Second
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	run := core.StartToolCommand(execCtx, "chrome", cmd)
+	run.SetOutputFile(outputPath)
+
+	err := cmd.Run()
+	run.Finish(err)
+	if err != nil {
+		os.Remove(outputPath)
+		if execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return fmt.Errorf("screenshot timeout after %v", timeout)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("chrome error: %v: %s", err, lastOutputLine(output.Bytes()))
+	}
+
+	if info, err := os.Stat(outputPath); err != nil || info.Size() == 0 {
+		os.Remove(outputPath)
+		return fmt.Errorf("screenshot not created")
+	}
+	return nil
+}
+
+// lastOutputLine 工具输出的最后一行非空内容，最多 200 个字符
+func lastOutputLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+	if len(line) > 200 {
+		line = line[:200]
+	}
+	return line
+}
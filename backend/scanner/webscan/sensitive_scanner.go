@@ -9,29 +9,53 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"moongazing/config"
+	"moongazing/scanner/core"
 )
 
 // SensitiveResult represents sensitive information detection result
 type SensitiveResult struct {
-	Target   string             `json:"target"`
-	URL      string             `json:"url"`
-	Found    int                `json:"found"`
-	Findings []SensitiveFinding `json:"findings"`
-	ScanTime time.Duration      `json:"scan_time_ms"`
+	Target     string             `json:"target"`
+	URL        string             `json:"url"`
+	Found      int                `json:"found"`
+	Findings   []SensitiveFinding `json:"findings"`
+	ScanTimeMs int64              `json:"scan_time_ms"`
 }
 
 // SensitiveFinding represents a single sensitive information finding
 type SensitiveFinding struct {
-	Type       string   `json:"type"`
-	Pattern    string   `json:"pattern"`
-	Matches    []string `json:"matches"`
-	Location   string   `json:"location"` // url, body, header, js
-	Severity   string   `json:"severity"`
-	Confidence int      `json:"confidence"`
+	Type         string             `json:"type"`
+	Pattern      string             `json:"pattern"`
+	Matches      []string           `json:"matches"`
+	Location     string             `json:"location"` // url, body, header, js
+	Severity     string             `json:"severity"`
+	Confidence   int                `json:"confidence"`
+	Contexts     []SensitiveContext `json:"contexts,omitempty"` // first SensitiveMaxContexts body matches
+	TotalMatches int                `json:"total_matches"`      // all matches, including those without a context
 }
 
+// SensitiveContext is the body text around one match, with the secret masked
+type SensitiveContext struct {
+	Offset int    `json:"offset" bson:"offset"` // byte offset of the match in the body
+	Match  string `json:"match" bson:"match"`   // masked match
+	Before string `json:"before" bson:"before"`
+	After  string `json:"after" bson:"after"`
+}
+
+const (
+	// SensitiveContextWindow is the number of bytes kept before and after each match
+	SensitiveContextWindow = 200
+	// SensitiveMaxContexts caps the contexts stored per finding so minified bundles
+	// with thousands of hits stay small
+	SensitiveMaxContexts = 20
+	// sensitiveMaxMatches caps the distinct match values stored per finding
+	sensitiveMaxMatches = 10
+	// sensitiveMaxMatchLen skips very long matches
+	sensitiveMaxMatchLen = 200
+)
+
 // SensitivePattern represents a sensitive information pattern
 type SensitivePattern struct {
 	Name     string
@@ -89,6 +113,12 @@ func getDefaultSensitivePatterns() map[string]*SensitivePattern {
 			Type:     "credential",
 			Severity: "high",
 		},
+		"aws_access_key": {
+			Name:     "aws_access_key",
+			Pattern:  `\b(AKIA|ASIA)[0-9A-Z]{16}\b`,
+			Type:     "credential",
+			Severity: "critical",
+		},
 		"private_key": {
 			Name:     "private_key",
 			Pattern:  `-----BEGIN (RSA |DSA |EC |OPENSSH )?PRIVATE KEY-----`,
@@ -135,21 +165,21 @@ func (s *ContentScanner) ScanSensitiveInfo(ctx context.Context, target string) *
 
 	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
 	if err != nil {
-		result.ScanTime = time.Since(start) / time.Millisecond
+		result.ScanTimeMs = core.MillisSince(start)
 		return result
 	}
 	req.Header.Set("User-Agent", s.UserAgent)
 
 	resp, err := s.HTTPClient.Do(req)
 	if err != nil {
-		result.ScanTime = time.Since(start) / time.Millisecond
+		result.ScanTimeMs = core.MillisSince(start)
 		return result
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
 	if err != nil {
-		result.ScanTime = time.Since(start) / time.Millisecond
+		result.ScanTimeMs = core.MillisSince(start)
 		return result
 	}
 	bodyStr := string(body)
@@ -159,29 +189,9 @@ func (s *ContentScanner) ScanSensitiveInfo(ctx context.Context, target string) *
 
 	// Check body for sensitive patterns
 	for name, pattern := range patterns {
-		matches := pattern.Regex.FindAllString(bodyStr, 10) // Limit to 10 matches
-		if len(matches) > 0 {
-			// Deduplicate
-			seen := make(map[string]bool)
-			uniqueMatches := make([]string, 0)
-			for _, m := range matches {
-				if !seen[m] && len(m) < 200 { // Skip very long matches
-					seen[m] = true
-					uniqueMatches = append(uniqueMatches, m)
-				}
-			}
-
-			if len(uniqueMatches) > 0 {
-				result.Findings = append(result.Findings, SensitiveFinding{
-					Type:       pattern.Type,
-					Pattern:    name,
-					Matches:    uniqueMatches,
-					Location:   "body",
-					Severity:   pattern.Severity,
-					Confidence: 70,
-				})
-				result.Found += len(uniqueMatches)
-			}
+		if finding := MatchSensitiveBody(bodyStr, name, pattern, s.MaskEmails); finding != nil {
+			result.Findings = append(result.Findings, *finding)
+			result.Found += len(finding.Matches)
 		}
 	}
 
@@ -189,12 +199,13 @@ func (s *ContentScanner) ScanSensitiveInfo(ctx context.Context, target string) *
 	if serverHeader := resp.Header.Get("Server"); serverHeader != "" {
 		if strings.Contains(serverHeader, "/") {
 			result.Findings = append(result.Findings, SensitiveFinding{
-				Type:       "info",
-				Pattern:    "server_version",
-				Matches:    []string{serverHeader},
-				Location:   "header",
-				Severity:   "info",
-				Confidence: 90,
+				Type:         "info",
+				Pattern:      "server_version",
+				Matches:      []string{serverHeader},
+				Location:     "header",
+				Severity:     "info",
+				Confidence:   90,
+				TotalMatches: 1,
 			})
 			result.Found++
 		}
@@ -203,12 +214,13 @@ func (s *ContentScanner) ScanSensitiveInfo(ctx context.Context, target string) *
 	// Check X-Powered-By
 	if poweredBy := resp.Header.Get("X-Powered-By"); poweredBy != "" {
 		result.Findings = append(result.Findings, SensitiveFinding{
-			Type:       "info",
-			Pattern:    "powered_by",
-			Matches:    []string{poweredBy},
-			Location:   "header",
-			Severity:   "info",
-			Confidence: 90,
+			Type:         "info",
+			Pattern:      "powered_by",
+			Matches:      []string{poweredBy},
+			Location:     "header",
+			Severity:     "info",
+			Confidence:   90,
+			TotalMatches: 1,
 		})
 		result.Found++
 	}
@@ -219,10 +231,198 @@ func (s *ContentScanner) ScanSensitiveInfo(ctx context.Context, target string) *
 		return severityOrder[result.Findings[i].Severity] < severityOrder[result.Findings[j].Severity]
 	})
 
-	result.ScanTime = time.Since(start) / time.Millisecond
+	result.ScanTimeMs = core.MillisSince(start)
 	return result
 }
 
+// MatchSensitiveBody matches one pattern against a response body. Distinct match values are
+// kept as before; in addition every match is counted and the first SensitiveMaxContexts get
+// a context window with the secret masked; emails are only masked when maskEmails is set.
+// Returns nil when nothing matched.
+func MatchSensitiveBody(body, name string, pattern *SensitivePattern, maskEmails bool) *SensitiveFinding {
+	locs := pattern.Regex.FindAllStringSubmatchIndex(body, -1)
+	if len(locs) == 0 {
+		return nil
+	}
+
+	kind := maskKindFor(name, pattern.Type)
+	if kind == sensitiveMaskEmail && !maskEmails {
+		kind = sensitiveMaskNone
+	}
+	finding := &SensitiveFinding{
+		Type:       pattern.Type,
+		Pattern:    name,
+		Matches:    make([]string, 0),
+		Location:   "body",
+		Severity:   pattern.Severity,
+		Confidence: 70,
+	}
+
+	// Secret spans of all matches, so neighbouring secrets inside a window are masked too
+	spans := make([][2]int, 0, len(locs))
+	for _, loc := range locs {
+		if loc[1]-loc[0] >= sensitiveMaxMatchLen {
+			continue // Skip very long matches
+		}
+		start, end := secretSpan(loc)
+		spans = append(spans, [2]int{start, end})
+	}
+
+	seen := make(map[string]bool)
+	for _, loc := range locs {
+		if loc[1]-loc[0] >= sensitiveMaxMatchLen {
+			continue
+		}
+		finding.TotalMatches++
+		m := body[loc[0]:loc[1]]
+		if !seen[m] && len(finding.Matches) < sensitiveMaxMatches {
+			seen[m] = true
+			finding.Matches = append(finding.Matches, m)
+		}
+		if len(finding.Contexts) < SensitiveMaxContexts {
+			finding.Contexts = append(finding.Contexts, sensitiveContext(body, loc[0], loc[1], spans, kind))
+		}
+	}
+	if finding.TotalMatches == 0 {
+		return nil
+	}
+	return finding
+}
+
+// secretSpan is the part of a match to mask: the last non-empty capture group
+// (the value in patterns like password = "..."), or the whole match
+func secretSpan(loc []int) (int, int) {
+	for i := len(loc)/2 - 1; i > 0; i-- {
+		if loc[2*i] >= 0 && loc[2*i+1] > loc[2*i] {
+			return loc[2*i], loc[2*i+1]
+		}
+	}
+	return loc[0], loc[1]
+}
+
+// sensitiveContext builds the window around body[start:end], aligned to UTF-8 boundaries
+func sensitiveContext(body string, start, end int, spans [][2]int, kind string) SensitiveContext {
+	from := start - SensitiveContextWindow
+	if from < 0 {
+		from = 0
+	}
+	for from > 0 && !utf8.RuneStart(body[from]) {
+		from++
+	}
+	to := end + SensitiveContextWindow
+	if to > len(body) {
+		to = len(body)
+	}
+	for to < len(body) && !utf8.RuneStart(body[to]) {
+		to--
+	}
+
+	return SensitiveContext{
+		Offset: start,
+		Match:  maskRange(body, start, end, spans, kind),
+		Before: maskRange(body, from, start, spans, kind),
+		After:  maskRange(body, end, to, spans, kind),
+	}
+}
+
+// maskRange returns body[from:to] with every secret span inside it masked
+func maskRange(body string, from, to int, spans [][2]int, kind string) string {
+	var b strings.Builder
+	pos := from
+	for _, span := range spans {
+		start, end := span[0], span[1]
+		if end <= from || start >= to {
+			continue
+		}
+		if start < pos {
+			start = pos
+		}
+		if end > to {
+			end = to
+		}
+		b.WriteString(body[pos:start])
+		b.WriteString(MaskSensitiveValue(kind, body[start:end]))
+		pos = end
+	}
+	b.WriteString(body[pos:to])
+	text := b.String()
+	if kind == sensitiveMaskKey {
+		// Key material following a match (e.g. a private key body after its BEGIN line)
+		text = longTokenRegex.ReplaceAllStringFunc(text, func(s string) string {
+			return MaskSensitiveValue(kind, s)
+		})
+	}
+	return text
+}
+
+// Masking rules
+const (
+	sensitiveMaskKey   = "key"   // keep a known prefix and the last 4 characters
+	sensitiveMaskEmail = "email" // mask the middle of the local part
+	sensitiveMaskNone  = "none"  // informational findings
+)
+
+// keyPrefixes are non-secret prefixes that identify the key type
+var keyPrefixes = []string{"AKIA", "ASIA", "AGPA", "AIDA", "AROA", "AIza", "ghp_", "gho_", "ghu_", "ghs_", "github_pat_",
+	"glpat-", "sk_live_", "sk_test_", "pk_live_", "pk_test_", "xoxb-", "xoxp-", "xoxa-", "SG."}
+
+// longTokenRegex matches long base64-like runs in context windows
+var longTokenRegex = regexp.MustCompile(`[A-Za-z0-9+/=_-]{32,}`)
+
+// maskKindFor picks the masking rule for a pattern
+func maskKindFor(name, patternType string) string {
+	switch {
+	case patternType == "info":
+		return sensitiveMaskNone
+	case patternType == "pii" || strings.Contains(strings.ToLower(name), "email"):
+		return sensitiveMaskEmail
+	default:
+		return sensitiveMaskKey
+	}
+}
+
+// MaskSensitiveValue masks a matched secret according to its kind: keys keep a known type
+// prefix and the last 4 characters (short values are fully masked), emails keep the first
+// and last character of the local part and the domain
+func MaskSensitiveValue(kind, value string) string {
+	switch kind {
+	case sensitiveMaskNone:
+		return value
+	case sensitiveMaskEmail:
+		at := strings.LastIndex(value, "@")
+		if at <= 0 {
+			return maskMiddle(value, 0, 0)
+		}
+		local := []rune(value[:at])
+		if len(local) <= 2 {
+			return strings.Repeat("*", len(local)) + value[at:]
+		}
+		return string(local[0]) + strings.Repeat("*", len(local)-2) + string(local[len(local)-1]) + value[at:]
+	default:
+		prefix := 0
+		for _, p := range keyPrefixes {
+			if strings.HasPrefix(value, p) {
+				prefix = len(p)
+				break
+			}
+		}
+		suffix := 4
+		if utf8.RuneCountInString(value)-prefix < 12 {
+			suffix = 0
+		}
+		return maskMiddle(value, prefix, suffix)
+	}
+}
+
+// maskMiddle replaces all but the first keep and last suffix runes with '*'
+func maskMiddle(value string, keep, suffix int) string {
+	runes := []rune(value)
+	if keep+suffix >= len(runes) {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:keep]) + strings.Repeat("*", len(runes)-keep-suffix) + string(runes[len(runes)-suffix:])
+}
+
 // BatchScanSensitive scans multiple URLs for sensitive information
 func (s *ContentScanner) BatchScanSensitive(ctx context.Context, targets []string) []*SensitiveResult {
 	results := make([]*SensitiveResult, len(targets))
@@ -2,6 +2,7 @@ package webscan
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -27,6 +28,9 @@ type SprayScanner struct {
 	EnableCrawl      bool   // 是否启用爬虫
 	EnableBackup     bool   // 是否扫描备份文件
 	EnableCommon     bool   // 是否扫描通用文件
+	Proxy            string // 代理地址（--proxy）
+	Headers          []string // 自定义请求头 "Name: value"（--header），用于认证扫描
+	UserAgents       *core.UserAgentPicker // User-Agent 策略，每次运行选择一个通过 --header 传入，nil 使用 spray 的默认值
 }
 
 // SprayResult Spray 扫描结果
@@ -35,7 +39,7 @@ type SprayResult struct {
 	Results   []SprayEntry     `json:"results"`
 	StartTime time.Time        `json:"start_time"`
 	EndTime   time.Time        `json:"end_time"`
-	Duration  string           `json:"duration"`
+	DurationMs int64           `json:"duration_ms"`
 	Total     int              `json:"total"`
 }
 
@@ -50,6 +54,7 @@ type SprayEntry struct {
 	Title        string            `json:"title"`
 	Host         string            `json:"host"`
 	Frameworks   map[string]interface{} `json:"frameworks"`
+	Technologies []string          `json:"technologies,omitempty"` // Frameworks 规范化后的技术名称
 	Extracts     []string          `json:"extracts"`
 	Hashes       map[string]string `json:"hashes"`
 }
@@ -106,6 +111,15 @@ func (s *SprayScanner) IsAvailable() bool {
 	return s.BinPath != "" && core.FileExists(s.BinPath)
 }
 
+// WithConcurrency 返回线程数（-t）为 n 的副本，n <= 0 时使用原线程数
+func (s *SprayScanner) WithConcurrency(n int) *SprayScanner {
+	c := *s
+	if n > 0 {
+		c.Concurrency = n
+	}
+	return &c
+}
+
 // Scan 对单个目标进行目录扫描
 func (s *SprayScanner) Scan(ctx context.Context, target string) (*SprayResult, error) {
 	return s.ScanWithWordlist(ctx, target, nil)
@@ -145,11 +159,18 @@ func (s *SprayScanner) ScanWithWordlist(ctx context.Context, target string, word
 	defer cancel()
 
 	cmd := exec.CommandContext(execCtx, s.BinPath, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	run := core.StartToolCommand(execCtx, "spray", cmd)
+	run.AddInput(wordlistInputs(wordlists)...)
+	run.SetOutputFile(outputPath)
 
-	fmt.Printf("[*] Running Spray: %s %s\n", s.BinPath, strings.Join(args, " "))
+	fmt.Printf("[*] Running Spray: %s %s\n", s.BinPath, strings.Join(core.RedactArgs(args), " "))
 
 	// 执行命令
-	output, err := cmd.CombinedOutput()
+	err = cmd.Run()
+	run.Finish(err)
 	if err != nil {
 		if execCtx.Err() == context.DeadlineExceeded {
 			return result, fmt.Errorf("spray execution timeout after %d minutes", s.ExecutionTimeout)
@@ -157,7 +178,7 @@ func (s *SprayScanner) ScanWithWordlist(ctx context.Context, target string, word
 		if ctx.Err() != nil {
 			return result, ctx.Err()
 		}
-		fmt.Printf("[!] Spray error: %v, output: %s\n", err, string(output))
+		fmt.Printf("[!] Spray error: %v, output: %s\n", err, output.String())
 	}
 
 	// 解析输出文件
@@ -169,7 +190,7 @@ func (s *SprayScanner) ScanWithWordlist(ctx context.Context, target string, word
 	result.Total = len(entries)
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 
 	fmt.Printf("[*] Spray completed for %s: found %d entries\n", target, result.Total)
 
@@ -181,85 +202,9 @@ func (s *SprayScanner) ScanBatch(ctx context.Context, targets []string) (*SprayR
 	return s.ScanBatchWithWordlist(ctx, targets, nil)
 }
 
-// ScanBatchWithWordlist 使用指定字典批量扫描多个目标
+// ScanBatchWithWordlist 使用指定字典批量扫描多个目标，Spray 结束后返回全部结果
 func (s *SprayScanner) ScanBatchWithWordlist(ctx context.Context, targets []string, wordlists []string) (*SprayResult, error) {
-	if !s.IsAvailable() {
-		return nil, fmt.Errorf("spray not available")
-	}
-
-	if len(targets) == 0 {
-		return nil, fmt.Errorf("no targets provided")
-	}
-
-	result := &SprayResult{
-		Target:    fmt.Sprintf("batch_%d_targets", len(targets)),
-		StartTime: time.Now(),
-		Results:   make([]SprayEntry, 0),
-	}
-
-	// 创建目标列表文件
-	targetFile, err := os.CreateTemp(s.TempDir, "spray_targets_*.txt")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create target file: %v", err)
-	}
-	targetPath := targetFile.Name()
-	defer os.Remove(targetPath)
-
-	// 写入目标
-	for _, t := range targets {
-		// 确保目标有协议
-		if !strings.HasPrefix(t, "http://") && !strings.HasPrefix(t, "https://") {
-			t = "https://" + t
-		}
-		targetFile.WriteString(t + "\n")
-	}
-	targetFile.Close()
-
-	// 创建输出文件
-	outputFile, err := os.CreateTemp(s.TempDir, "spray_output_*.json")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %v", err)
-	}
-	outputPath := outputFile.Name()
-	outputFile.Close()
-	defer os.Remove(outputPath)
-
-	// 构建命令参数（批量模式使用 -l）
-	args := s.buildBatchArgs(targetPath, outputPath, wordlists)
-
-	// 创建带超时的上下文
-	execCtx, cancel := context.WithTimeout(ctx, time.Duration(s.ExecutionTimeout)*time.Minute)
-	defer cancel()
-
-	cmd := exec.CommandContext(execCtx, s.BinPath, args...)
-
-	fmt.Printf("[*] Running Spray batch: %s %s\n", s.BinPath, strings.Join(args, " "))
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		if execCtx.Err() == context.DeadlineExceeded {
-			fmt.Printf("[!] Spray batch execution timeout\n")
-		} else if ctx.Err() != nil {
-			return result, ctx.Err()
-		} else {
-			fmt.Printf("[!] Spray batch error: %v, output: %s\n", err, string(output))
-		}
-	}
-
-	// 解析输出
-	entries, err := s.parseOutput(outputPath)
-	if err != nil {
-		fmt.Printf("[!] Failed to parse spray batch output: %v\n", err)
-	}
-	result.Results = entries
-	result.Total = len(entries)
-
-	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
-
-	fmt.Printf("[*] Spray batch completed: found %d entries from %d targets\n", result.Total, len(targets))
-
-	return result, nil
+	return s.ScanBatchStream(ctx, targets, wordlists, nil)
 }
 
 // CheckOnly 仅进行指纹识别（类似 httpx）
@@ -275,7 +220,7 @@ func (s *SprayScanner) CheckOnly(ctx context.Context, targets []string) (*SprayR
 	}
 
 	// 创建目标列表文件
-	targetFile, err := os.CreateTemp(s.TempDir, "spray_check_*.txt")
+	targetFile, err := core.CreateInputFile(s.TempDir, "spray_check_*.txt")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create target file: %v", err)
 	}
@@ -314,16 +259,29 @@ func (s *SprayScanner) CheckOnly(ctx context.Context, targets []string) (*SprayR
 		args = append(args, "--finger")
 	}
 
+	// 速率限制
+	if s.RateLimit > 0 {
+		args = append(args, "--rate-limit", fmt.Sprintf("%d", s.RateLimit))
+	}
+	args = append(args, s.requestArgs()...)
+
 	execCtx, cancel := context.WithTimeout(ctx, time.Duration(s.ExecutionTimeout)*time.Minute)
 	defer cancel()
 
 	cmd := exec.CommandContext(execCtx, s.BinPath, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	run := core.StartToolCommand(execCtx, "spray", cmd)
+	run.AddInput(targetFile.Input())
+	run.SetOutputFile(outputPath)
 
-	fmt.Printf("[*] Running Spray check-only: %s %s\n", s.BinPath, strings.Join(args, " "))
+	fmt.Printf("[*] Running Spray check-only: %s %s\n", s.BinPath, strings.Join(core.RedactArgs(args), " "))
 
-	output, err := cmd.CombinedOutput()
+	err = cmd.Run()
+	run.Finish(err)
 	if err != nil {
-		fmt.Printf("[!] Spray check error: %v, output: %s\n", err, string(output))
+		fmt.Printf("[!] Spray check error: %v, output: %s\n", err, output.String())
 	}
 
 	entries, err := s.parseOutput(outputPath)
@@ -334,11 +292,83 @@ func (s *SprayScanner) CheckOnly(ctx context.Context, targets []string) (*SprayR
 	result.Total = len(entries)
 
 	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
 
 	return result, nil
 }
 
+// wordlistInputs 计算字典文件的校验和
+func wordlistInputs(wordlists []string) []core.ToolInput {
+	var inputs []core.ToolInput
+	for _, wl := range wordlists {
+		if core.FileExists(wl) {
+			inputs = append(inputs, core.FileInput(wl))
+		}
+	}
+	return inputs
+}
+
+// SetNetwork 设置代理，返回不支持的设置（对应参数不传）
+// spray 没有指定 DNS 服务器的参数，自定义 DNS 和 DoH 不生效
+func (s *SprayScanner) SetNetwork(cfg *core.ScanNetworkConfig) []string {
+	s.Proxy = ""
+	var unsupported []string
+	if cfg.HasProxy() {
+		if core.ToolSupportsFlag(s.BinPath, "--proxy") {
+			s.Proxy = cfg.Proxy
+		} else {
+			unsupported = append(unsupported, "proxy")
+		}
+	}
+	if cfg.DoH {
+		unsupported = append(unsupported, "doh")
+	} else if cfg.HasResolvers() {
+		unsupported = append(unsupported, "resolvers")
+	}
+	return unsupported
+}
+
+// SetHeaders 设置自定义请求头，当前 spray 版本不支持 --header 时返回 true（不传参数）
+func (s *SprayScanner) SetHeaders(headers *core.ScanHeaders) (unsupported bool) {
+	s.Headers = nil
+	if headers.IsEmpty() {
+		return false
+	}
+	if !core.ToolSupportsFlag(s.BinPath, "--header") {
+		return true
+	}
+	s.Headers = headers.Lines()
+	return false
+}
+
+// SetUserAgents 设置 User-Agent 策略，当前 spray 版本不支持 --header 时返回 true（不传参数）
+func (s *SprayScanner) SetUserAgents(agents *core.UserAgentPicker) (unsupported bool) {
+	s.UserAgents = nil
+	if agents == nil {
+		return false
+	}
+	if !core.ToolSupportsFlag(s.BinPath, "--header") {
+		return true
+	}
+	s.UserAgents = agents
+	return false
+}
+
+// requestArgs 代理和自定义请求头参数，自定义请求头未设置 User-Agent 时带上按策略选择的 User-Agent
+func (s *SprayScanner) requestArgs() []string {
+	var args []string
+	if s.Proxy != "" {
+		args = append(args, "--proxy", s.Proxy)
+	}
+	for _, header := range s.Headers {
+		args = append(args, "--header", header)
+	}
+	if line := s.UserAgents.UserAgentLine(s.Headers); line != "" {
+		args = append(args, "--header", line)
+	}
+	return args
+}
+
 // buildArgs 构建单目标扫描参数
 func (s *SprayScanner) buildArgs(target, outputPath string, wordlists []string) []string {
 	args := []string{
@@ -390,7 +420,7 @@ func (s *SprayScanner) buildArgs(target, outputPath string, wordlists []string)
 		args = append(args, "--common")
 	}
 
-	return args
+	return append(args, s.requestArgs()...)
 }
 
 // buildBatchArgs 构建批量扫描参数
@@ -439,7 +469,7 @@ func (s *SprayScanner) buildBatchArgs(targetPath, outputPath string, wordlists [
 		args = append(args, "--common")
 	}
 
-	return args
+	return append(args, s.requestArgs()...)
 }
 
 // parseOutput 解析 Spray 输出文件
@@ -457,44 +487,9 @@ func (s *SprayScanner) parseOutput(outputPath string) ([]SprayEntry, error) {
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
 
-	seen := make(map[string]bool)
-
+	parser := newSprayLineParser()
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		// 尝试解析 JSON
-		var jsonOutput SprayJSONOutput
-		if err := json.Unmarshal([]byte(line), &jsonOutput); err != nil {
-			// 可能是普通文本输出，跳过
-			continue
-		}
-
-		// 去重 - 使用 URL 或 URL+Path 作为唯一键
-		uniqueKey := jsonOutput.URL
-		if jsonOutput.Path != "" {
-			uniqueKey = jsonOutput.URL + jsonOutput.Path
-		}
-		
-		if uniqueKey != "" && !seen[uniqueKey] {
-			seen[uniqueKey] = true
-
-			entry := SprayEntry{
-				URL:          jsonOutput.URL,
-				Path:         jsonOutput.Path,
-				StatusCode:   jsonOutput.Status,
-				BodyLength:   jsonOutput.BodyLength,
-				HeaderLength: jsonOutput.HeaderLength,
-				ContentType:  jsonOutput.ContentType,
-				Title:        jsonOutput.Title,
-				Host:         jsonOutput.Host,
-				Frameworks:   jsonOutput.Frameworks,
-				Extracts:     jsonOutput.Extracts,
-				Hashes:       jsonOutput.Hashes,
-			}
-
+		if entry, ok := parser.parse(scanner.Text()); ok {
 			entries = append(entries, entry)
 		}
 	}
@@ -506,6 +501,55 @@ func (s *SprayScanner) parseOutput(outputPath string) ([]SprayEntry, error) {
 	return entries, nil
 }
 
+// sprayLineParser 逐行解析 Spray JSON 输出并按 URL+Path 去重
+type sprayLineParser struct {
+	seen map[string]bool
+}
+
+func newSprayLineParser() *sprayLineParser {
+	return &sprayLineParser{seen: make(map[string]bool)}
+}
+
+// parse 解析一行输出，非 JSON 行和重复结果返回 false
+func (p *sprayLineParser) parse(line string) (SprayEntry, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return SprayEntry{}, false
+	}
+
+	// 尝试解析 JSON
+	var jsonOutput SprayJSONOutput
+	if err := json.Unmarshal([]byte(line), &jsonOutput); err != nil {
+		// 可能是普通文本输出，跳过
+		return SprayEntry{}, false
+	}
+
+	// 去重 - 使用 URL 或 URL+Path 作为唯一键
+	uniqueKey := jsonOutput.URL
+	if jsonOutput.Path != "" {
+		uniqueKey = jsonOutput.URL + jsonOutput.Path
+	}
+	if uniqueKey == "" || p.seen[uniqueKey] {
+		return SprayEntry{}, false
+	}
+	p.seen[uniqueKey] = true
+
+	return SprayEntry{
+		URL:          jsonOutput.URL,
+		Path:         jsonOutput.Path,
+		StatusCode:   jsonOutput.Status,
+		BodyLength:   jsonOutput.BodyLength,
+		HeaderLength: jsonOutput.HeaderLength,
+		ContentType:  jsonOutput.ContentType,
+		Title:        jsonOutput.Title,
+		Host:         jsonOutput.Host,
+		Frameworks:   jsonOutput.Frameworks,
+		Technologies: core.FrameworkTechnologies(core.DefaultTechNormalizer(), jsonOutput.Frameworks).Names(),
+		Extracts:     jsonOutput.Extracts,
+		Hashes:       jsonOutput.Hashes,
+	}, true
+}
+
 // GetDefaultWordlistPath 获取默认字典路径
 func (s *SprayScanner) GetDefaultWordlistPath() string {
 	// spray 自带字典，通常不需要额外指定
@@ -0,0 +1,209 @@
+package webscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"moongazing/scanner/core"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SprayTailInterval Spray 运行期间检查输出文件新内容的间隔
+var SprayTailInterval = 500 * time.Millisecond
+
+// ScanBatchStream 批量扫描多个目标，Spray 运行期间持续读取 JSON 输出文件，
+// 每解析出一条结果就调用 onEntry（在调用方协程中执行，onEntry 可以为 nil）。
+// 进程被取消或超时时，已写入输出文件的结果仍会被解析并回调，返回的结果中包含全部已解析条目
+func (s *SprayScanner) ScanBatchStream(ctx context.Context, targets []string, wordlists []string, onEntry func(SprayEntry)) (*SprayResult, error) {
+	if !s.IsAvailable() {
+		return nil, fmt.Errorf("spray not available")
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets provided")
+	}
+
+	result := &SprayResult{
+		Target:    fmt.Sprintf("batch_%d_targets", len(targets)),
+		StartTime: time.Now(),
+		Results:   make([]SprayEntry, 0),
+	}
+
+	// 创建目标列表文件
+	targetFile, err := core.CreateInputFile(s.TempDir, "spray_targets_*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target file: %v", err)
+	}
+	targetPath := targetFile.Name()
+	defer os.Remove(targetPath)
+
+	// 写入目标
+	for _, t := range targets {
+		// 确保目标有协议
+		if !strings.HasPrefix(t, "http://") && !strings.HasPrefix(t, "https://") {
+			t = "https://" + t
+		}
+		targetFile.WriteString(t + "\n")
+	}
+	targetFile.Close()
+
+	// 创建输出文件
+	outputFile, err := os.CreateTemp(s.TempDir, "spray_output_*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %v", err)
+	}
+	outputPath := outputFile.Name()
+	outputFile.Close()
+	defer os.Remove(outputPath)
+
+	// 构建命令参数（批量模式使用 -l）
+	args := s.buildBatchArgs(targetPath, outputPath, wordlists)
+
+	// 创建带超时的上下文
+	execCtx, cancel := context.WithTimeout(ctx, time.Duration(s.ExecutionTimeout)*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(execCtx, s.BinPath, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// 取消后 spray 的子进程可能仍占用输出管道，限制等待时间
+	cmd.WaitDelay = 2 * time.Second
+	run := core.StartToolCommand(execCtx, "spray", cmd)
+	run.AddInput(targetFile.Input())
+	run.AddInput(wordlistInputs(wordlists)...)
+	run.SetOutputFile(outputPath)
+
+	fmt.Printf("[*] Running Spray batch: %s %s\n", s.BinPath, strings.Join(core.RedactArgs(args), " "))
+
+	if err := cmd.Start(); err != nil {
+		run.Finish(err)
+		return result, fmt.Errorf("failed to start spray: %v", err)
+	}
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	// 进程运行期间持续解析输出，进程退出后读完剩余内容
+	tailErr := tailSprayOutput(outputPath, exited, func(entry SprayEntry) {
+		result.Results = append(result.Results, entry)
+		if onEntry != nil {
+			onEntry(entry)
+		}
+	})
+	run.Finish(waitErr)
+	if tailErr != nil {
+		fmt.Printf("[!] Failed to parse spray batch output: %v\n", tailErr)
+	}
+
+	result.Total = len(result.Results)
+	result.EndTime = time.Now()
+	result.DurationMs = core.MillisBetween(result.StartTime, result.EndTime)
+
+	if waitErr != nil {
+		if execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			fmt.Printf("[!] Spray batch execution timeout\n")
+		} else if ctx.Err() != nil {
+			fmt.Printf("[!] Spray batch cancelled after %d entries\n", result.Total)
+			return result, ctx.Err()
+		} else {
+			fmt.Printf("[!] Spray batch error: %v, output: %s\n", waitErr, output.String())
+		}
+	}
+
+	fmt.Printf("[*] Spray batch completed: found %d entries from %d targets\n", result.Total, len(targets))
+
+	return result, nil
+}
+
+// tailSprayOutput 跟踪读取 Spray 输出文件，直到 done 关闭后把剩余内容读完
+// 只解析以换行结尾的完整行，进程退出后最后一行没有换行时也会解析
+func tailSprayOutput(path string, done <-chan struct{}, onEntry func(SprayEntry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %v", err)
+	}
+	defer func() { file.Close() }()
+
+	parser := newSprayLineParser()
+	var pending []byte
+	var offset int64
+	chunk := make([]byte, 64*1024)
+
+	// reopen 输出文件被重建或截断时从头读取，已回调的结果由 parser 去重
+	reopen := func() error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		current, err := file.Stat()
+		if err == nil && os.SameFile(info, current) && info.Size() >= offset {
+			return nil
+		}
+		reopened, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to reopen output file: %v", err)
+		}
+		file.Close()
+		file = reopened
+		pending, offset = nil, 0
+		return nil
+	}
+
+	// drain 读取当前已写入的全部内容，回调其中的完整行
+	drain := func() error {
+		if err := reopen(); err != nil {
+			return err
+		}
+		for {
+			n, err := file.Read(chunk)
+			if n > 0 {
+				offset += int64(n)
+				pending = append(pending, chunk[:n]...)
+				for {
+					i := bytes.IndexByte(pending, '\n')
+					if i < 0 {
+						break
+					}
+					if entry, ok := parser.parse(string(pending[:i])); ok {
+						onEntry(entry)
+					}
+					pending = pending[i+1:]
+				}
+			}
+			if errors.Is(err, io.EOF) || (err == nil && n == 0) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error reading output: %v", err)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(SprayTailInterval)
+	defer ticker.Stop()
+	for {
+		if err := drain(); err != nil {
+			return err
+		}
+		select {
+		case <-done:
+			if err := drain(); err != nil {
+				return err
+			}
+			if entry, ok := parser.parse(string(pending)); ok {
+				onEntry(entry)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/config"
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/scanner/subdomain/thirdparty"
+	"moongazing/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 工作空间第三方数据源密钥
+// Fofa、Hunter、Quake、SecurityTrails 的密钥按工作空间保存，密钥加密后写入 secret 字段。
+// 任务启用第三方数据源时合并到 thirdparty.APIConfig：任务中填写的密钥优先，其次是工作空间启用的密钥，
+// 最后是配置文件中的密钥；只有来自工作空间的密钥统计调用次数
+
+// ErrAPIKeyNotFound 密钥不存在
+var ErrAPIKeyNotFound = errors.New("数据源密钥不存在")
+
+// APIKeyEncryptionKey 工作空间密钥的加密密钥，取 thirdparty.secret_key，未配置时与通知渠道相同
+func APIKeyEncryptionKey() []byte {
+	if secret := config.GetConfig().ThirdParty.SecretKey; secret != "" {
+		return utils.DeriveKey(secret)
+	}
+	return NotifyChannelKey()
+}
+
+// SealAPIKey 加密明文密钥写入 Secret
+func SealAPIKey(item *models.APIKey, key []byte) error {
+	sealed, err := utils.EncryptAESGCM(key, []byte(item.Key))
+	if err != nil {
+		return err
+	}
+	item.Secret = sealed
+	return nil
+}
+
+// OpenAPIKey 解密 Secret 到 Key
+func OpenAPIKey(item *models.APIKey, key []byte) error {
+	plain, err := utils.DecryptAESGCM(key, item.Secret)
+	if err != nil {
+		return fmt.Errorf("decrypt api key %s: %v", item.ID, err)
+	}
+	item.Key = string(plain)
+	return nil
+}
+
+// MaskAPIKey 返回密钥脱敏后的副本，用于接口返回
+func MaskAPIKey(item *models.APIKey) *models.APIKey {
+	masked := *item
+	masked.Key = thirdparty.MaskKey(item.Key)
+	masked.Secret = ""
+	return &masked
+}
+
+// APIKeyStore 工作空间数据源密钥存储，读取的密钥已解密
+type APIKeyStore interface {
+	ListAPIKeys(ctx context.Context, workspaceID string) ([]*models.APIKey, error)
+	// GetAPIKey 不存在时返回 ErrAPIKeyNotFound
+	GetAPIKey(ctx context.Context, workspaceID, provider string) (*models.APIKey, error)
+	SaveAPIKey(ctx context.Context, item *models.APIKey) error
+	DeleteAPIKey(ctx context.Context, workspaceID, provider string) error
+	// AddAPIKeyUsage 增加调用次数并记录最近使用时间，密钥不存在时忽略
+	AddAPIKeyUsage(ctx context.Context, workspaceID, provider string, n int64, at time.Time) error
+	SetAPIKeyValidation(ctx context.Context, workspaceID, provider string, validation *models.APIKeyValidation) error
+}
+
+// APIKeyService 工作空间数据源密钥的保存、校验和任务注入
+type APIKeyService struct {
+	store     APIKeyStore
+	validator *thirdparty.KeyValidator
+}
+
+// NewAPIKeyService 创建数据源密钥服务，validator 为 nil 时使用默认的校验器
+func NewAPIKeyService(store APIKeyStore, validator *thirdparty.KeyValidator) *APIKeyService {
+	if validator == nil {
+		validator = thirdparty.NewKeyValidator()
+	}
+	return &APIKeyService{store: store, validator: validator}
+}
+
+// List 工作空间的密钥（脱敏）
+func (s *APIKeyService) List(workspaceID string) ([]*models.APIKey, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	items, err := s.store.ListAPIKeys(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	masked := make([]*models.APIKey, 0, len(items))
+	for _, item := range items {
+		masked = append(masked, MaskAPIKey(item))
+	}
+	return masked, nil
+}
+
+// Save 保存工作空间的密钥，提交的密钥为空或仍是脱敏值时保留原密钥；
+// 调用次数保留，密钥变化时清除上次的校验结果
+func (s *APIKeyService) Save(item *models.APIKey) (*models.APIKey, error) {
+	if !thirdparty.IsKeyProvider(item.Provider) {
+		return nil, fmt.Errorf("不支持的数据源: %s", item.Provider)
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	old, err := s.store.GetAPIKey(ctx, item.WorkspaceID, item.Provider)
+	if err != nil && !errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, err
+	}
+	now := time.Now()
+	item.ID = models.APIKeyID(item.WorkspaceID, item.Provider)
+	item.CreatedAt = now
+	if old != nil {
+		if item.Key == "" || item.Key == thirdparty.MaskKey(old.Key) {
+			item.Key = old.Key
+		}
+		if item.Key == old.Key && item.Email == old.Email {
+			item.Validation = old.Validation
+		}
+		item.UsageCount = old.UsageCount
+		item.LastUsedAt = old.LastUsedAt
+		item.CreatedAt = old.CreatedAt
+	}
+	if item.Key == "" {
+		return nil, errors.New("密钥不能为空")
+	}
+	if item.Provider == thirdparty.SourceFofa && item.Email == "" {
+		return nil, errors.New("Fofa 需要填写账号邮箱")
+	}
+	item.UpdatedAt = now
+	if err := s.store.SaveAPIKey(ctx, item); err != nil {
+		return nil, err
+	}
+	return MaskAPIKey(item), nil
+}
+
+// Delete 删除工作空间的密钥
+func (s *APIKeyService) Delete(workspaceID, provider string) error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.DeleteAPIKey(ctx, workspaceID, provider)
+}
+
+// Validate 用保存的密钥向数据源发送一次认证请求，保存并返回校验结果
+func (s *APIKeyService) Validate(ctx context.Context, workspaceID, provider string) (*thirdparty.KeyValidation, error) {
+	item, err := s.store.GetAPIKey(ctx, workspaceID, provider)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.validator.Validate(ctx, provider, item.Email, item.Key)
+	if err != nil {
+		return nil, err
+	}
+	validation := &models.APIKeyValidation{
+		Valid:     result.Valid,
+		Remaining: result.Remaining,
+		Message:   result.Message,
+		CheckedAt: result.CheckedAt,
+	}
+	if err := s.store.SetAPIKeyValidation(ctx, workspaceID, provider, validation); err != nil {
+		log.Printf("[APIKey] Failed to save validation of %s in workspace %s: %v", provider, workspaceID, err)
+	}
+	return result, nil
+}
+
+// RecordUsage 记录一次工作空间密钥的调用
+func (s *APIKeyService) RecordUsage(workspaceID, provider string) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := s.store.AddAPIKeyUsage(ctx, workspaceID, provider, 1, time.Now()); err != nil {
+		log.Printf("[APIKey] Failed to record usage of %s in workspace %s: %v", provider, workspaceID, err)
+	}
+}
+
+// Resolve 合并任务、工作空间和配置文件的密钥，返回任务使用的配置和调用次数记录函数
+// 记录函数只统计来自工作空间的密钥；读取工作空间密钥失败时只使用任务和配置文件的密钥
+func (s *APIKeyService) Resolve(workspaceID string, task *models.TaskConfig) (*thirdparty.APIConfig, func(provider string)) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	stored, err := s.store.ListAPIKeys(ctx, workspaceID)
+	if err != nil {
+		log.Printf("[TaskExecutor] Failed to load api keys of workspace %s: %v", workspaceID, err)
+	}
+	apiCfg, fromWorkspace := MergeAPIConfig(ConfigAPIKeys(), stored, task)
+	return apiCfg, func(provider string) {
+		if fromWorkspace[provider] {
+			s.RecordUsage(workspaceID, provider)
+		}
+	}
+}
+
+// ConfigAPIKeys 配置文件中的第三方数据源密钥
+func ConfigAPIKeys() *thirdparty.APIConfig {
+	cfg := config.GetConfig()
+	return &thirdparty.APIConfig{
+		FofaEmail: cfg.ThirdParty.Fofa.Email,
+		FofaKey:   cfg.ThirdParty.Fofa.Key,
+		HunterKey: cfg.ThirdParty.Hunter.Key,
+		QuakeKey:  cfg.ThirdParty.Quake.Key,
+		OTXKey:    cfg.ThirdParty.OTX.Key,
+		ChaosKey:  cfg.ThirdParty.Chaos.Key,
+	}
+}
+
+// MergeAPIConfig 依次用工作空间启用的密钥、任务填写的密钥覆盖 base，返回合并结果和使用工作空间密钥的数据源
+func MergeAPIConfig(base *thirdparty.APIConfig, stored []*models.APIKey, task *models.TaskConfig) (*thirdparty.APIConfig, map[string]bool) {
+	merged := &thirdparty.APIConfig{}
+	if base != nil {
+		*merged = *base
+	}
+	fromWorkspace := make(map[string]bool)
+	for _, item := range stored {
+		if !item.Enabled || item.Key == "" {
+			continue
+		}
+		switch item.Provider {
+		case thirdparty.SourceFofa:
+			merged.FofaEmail, merged.FofaKey = item.Email, item.Key
+		case thirdparty.SourceHunter:
+			merged.HunterKey = item.Key
+		case thirdparty.SourceQuake:
+			merged.QuakeKey = item.Key
+		case thirdparty.SourceSecurityTrails:
+			merged.SecurityTrailsKey = item.Key
+		default:
+			continue
+		}
+		fromWorkspace[item.Provider] = true
+	}
+	if task != nil {
+		if task.FofaKey != "" {
+			merged.FofaKey = task.FofaKey
+			if task.FofaEmail != "" {
+				merged.FofaEmail = task.FofaEmail
+			}
+			delete(fromWorkspace, thirdparty.SourceFofa)
+		}
+		if task.HunterKey != "" {
+			merged.HunterKey = task.HunterKey
+			delete(fromWorkspace, thirdparty.SourceHunter)
+		}
+		if task.QuakeKey != "" {
+			merged.QuakeKey = task.QuakeKey
+			delete(fromWorkspace, thirdparty.SourceQuake)
+		}
+	}
+	return merged, fromWorkspace
+}
+
+// mongoAPIKeyStore 密钥的数据库存储，写入前加密，读取时解密
+type mongoAPIKeyStore struct {
+	key []byte
+}
+
+// NewMongoAPIKeyStore 创建数据库密钥存储
+func NewMongoAPIKeyStore(key []byte) APIKeyStore {
+	return &mongoAPIKeyStore{key: key}
+}
+
+func (s *mongoAPIKeyStore) collection() *mongo.Collection {
+	return database.GetCollection(models.CollectionAPIKeys)
+}
+
+func (s *mongoAPIKeyStore) ListAPIKeys(ctx context.Context, workspaceID string) ([]*models.APIKey, error) {
+	cursor, err := s.collection().Find(ctx, bson.M{"workspace_id": workspaceID},
+		options.Find().SetSort(bson.D{{Key: "provider", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []*models.APIKey
+	for cursor.Next(ctx) {
+		var item models.APIKey
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		if err := OpenAPIKey(&item, s.key); err != nil {
+			// 加密密钥更换后旧记录无法解密，跳过而不影响其他数据源
+			log.Printf("[APIKey] %v", err)
+			continue
+		}
+		items = append(items, &item)
+	}
+	return items, cursor.Err()
+}
+
+func (s *mongoAPIKeyStore) GetAPIKey(ctx context.Context, workspaceID, provider string) (*models.APIKey, error) {
+	var item models.APIKey
+	err := s.collection().FindOne(ctx, bson.M{"_id": models.APIKeyID(workspaceID, provider)}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := OpenAPIKey(&item, s.key); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *mongoAPIKeyStore) SaveAPIKey(ctx context.Context, item *models.APIKey) error {
+	sealed := *item
+	if err := SealAPIKey(&sealed, s.key); err != nil {
+		return err
+	}
+	_, err := s.collection().ReplaceOne(ctx, bson.M{"_id": sealed.ID}, &sealed, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoAPIKeyStore) DeleteAPIKey(ctx context.Context, workspaceID, provider string) error {
+	res, err := s.collection().DeleteOne(ctx, bson.M{"_id": models.APIKeyID(workspaceID, provider)})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *mongoAPIKeyStore) AddAPIKeyUsage(ctx context.Context, workspaceID, provider string, n int64, at time.Time) error {
+	_, err := s.collection().UpdateOne(ctx, bson.M{"_id": models.APIKeyID(workspaceID, provider)}, bson.M{
+		"$inc": bson.M{"usage_count": n},
+		"$set": bson.M{"last_used_at": at},
+	})
+	return err
+}
+
+func (s *mongoAPIKeyStore) SetAPIKeyValidation(ctx context.Context, workspaceID, provider string, validation *models.APIKeyValidation) error {
+	_, err := s.collection().UpdateOne(ctx, bson.M{"_id": models.APIKeyID(workspaceID, provider)},
+		bson.M{"$set": bson.M{"validation": validation}})
+	return err
+}
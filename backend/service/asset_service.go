@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 工作空间资产
+// 扫描结果按任务保存，同一域名在新任务中重新扫描得到的是一份独立的副本。
+// 执行器保存子域名、端口、Web 服务结果时按 工作空间 + 资产标识 合并到资产集合，
+// 记录首次/最近发现时间、最近发现过的任务（最多 MaxAssetTaskIDs 个）和最近一次的标题、状态码、技术栈
+
+// MaxAssetTaskIDs 资产记录的任务ID数上限，超过时只保留最近的任务，周期任务反复扫描同一资产时文档不会无限增长
+const MaxAssetTaskIDs = 50
+
+// ErrInvalidAssetKind 资产类型不合法
+var ErrInvalidAssetKind = errors.New("无效的资产类型，可选 subdomain、port、web")
+
+// validAssetKinds 可查询的资产类型
+var validAssetKinds = map[models.AssetKind]bool{
+	models.AssetKindSubdomain: true,
+	models.AssetKindPort:      true,
+	models.AssetKindWeb:       true,
+}
+
+// AssetFilter 资产查询条件，零值表示不限
+type AssetFilter struct {
+	WorkspaceID primitive.ObjectID
+	Kinds       []models.AssetKind
+	LiveOnly    bool               // 只返回有 HTTP 响应的资产
+	SeenBefore  time.Time          // 最近发现时间早于该时间
+	FirstTaskID primitive.ObjectID // 由该任务首次发现
+}
+
+// AssetStore 资产存储
+type AssetStore interface {
+	// UpsertAsset 按 工作空间 + 类型 + 标识 合并资产：首次写入时记录 FirstSeen、FirstTaskID，
+	// 之后只推进 LastSeen、追加任务ID（最多保留 MaxAssetTaskIDs 个），并用非空的字段覆盖已有信息
+	UpsertAsset(ctx context.Context, asset *models.Asset) error
+	// FindAssets 按最近发现时间倒序分页查询，返回当页资产和总数
+	FindAssets(ctx context.Context, filter AssetFilter, page, pageSize int) ([]*models.Asset, int64, error)
+}
+
+// AssetService 工作空间资产服务
+type AssetService struct {
+	store AssetStore
+}
+
+// NewAssetService 创建资产服务
+func NewAssetService() *AssetService {
+	return NewAssetServiceWithStore(NewMongoAssetStore())
+}
+
+// NewAssetServiceWithStore 使用指定存储创建资产服务
+func NewAssetServiceWithStore(store AssetStore) *AssetService {
+	return &AssetService{store: store}
+}
+
+// Record 把已保存的结果合并到工作空间资产，不对应资产的结果类型忽略
+func (s *AssetService) Record(result *models.ScanResult) error {
+	if s == nil {
+		return nil
+	}
+	asset := AssetFromResult(result)
+	if asset == nil {
+		return nil
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := s.store.UpsertAsset(ctx, asset); err != nil {
+		return fmt.Errorf("更新资产 %s 失败: %w", asset.Key, err)
+	}
+	return nil
+}
+
+// ListAssets 按条件分页查询资产
+func (s *AssetService) ListAssets(filter AssetFilter, page, pageSize int) ([]*models.Asset, int64, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.FindAssets(ctx, filter, page, pageSize)
+}
+
+// ListLiveWebAssets 工作空间内所有有响应的 Web 资产
+func (s *AssetService) ListLiveWebAssets(workspaceID primitive.ObjectID, page, pageSize int) ([]*models.Asset, int64, error) {
+	return s.ListAssets(AssetFilter{
+		WorkspaceID: workspaceID,
+		Kinds:       []models.AssetKind{models.AssetKindWeb},
+		LiveOnly:    true,
+	}, page, pageSize)
+}
+
+// ListStaleAssets 最近 days 天内没有再被发现的资产
+func (s *AssetService) ListStaleAssets(workspaceID primitive.ObjectID, days int, kinds []models.AssetKind, page, pageSize int) ([]*models.Asset, int64, error) {
+	if days < 1 {
+		return nil, 0, errors.New("天数必须大于 0")
+	}
+	return s.ListAssets(AssetFilter{
+		WorkspaceID: workspaceID,
+		Kinds:       kinds,
+		SeenBefore:  time.Now().AddDate(0, 0, -days),
+	}, page, pageSize)
+}
+
+// ListNewAssets 任务相对工作空间已有资产新发现的资产，kinds 为空时返回子域名和端口
+func (s *AssetService) ListNewAssets(task *models.Task, kinds []models.AssetKind, page, pageSize int) ([]*models.Asset, int64, error) {
+	if len(kinds) == 0 {
+		kinds = []models.AssetKind{models.AssetKindSubdomain, models.AssetKindPort}
+	}
+	return s.ListAssets(AssetFilter{
+		WorkspaceID: task.WorkspaceID,
+		Kinds:       kinds,
+		FirstTaskID: task.ID,
+	}, page, pageSize)
+}
+
+// ParseAssetKinds 解析查询参数中的资产类型
+func ParseAssetKinds(values []string) ([]models.AssetKind, error) {
+	kinds := make([]models.AssetKind, 0, len(values))
+	for _, v := range values {
+		kind := models.AssetKind(v)
+		if !validAssetKinds[kind] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAssetKind, v)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// AssetFromResult 从扫描结果中提取资产标识和信息，不对应资产的结果返回 nil
+func AssetFromResult(result *models.ScanResult) *models.Asset {
+	if result == nil || result.Data == nil {
+		return nil
+	}
+	asset := &models.Asset{
+		WorkspaceID: result.WorkspaceID,
+		FirstTaskID: result.TaskID,
+		LastTaskID:  result.TaskID,
+		TaskIDs:     []primitive.ObjectID{result.TaskID},
+		FirstSeen:   result.CreatedAt,
+		LastSeen:    result.CreatedAt,
+	}
+	if asset.LastSeen.IsZero() {
+		asset.FirstSeen = time.Now()
+		asset.LastSeen = asset.FirstSeen
+	}
+	data := result.Data
+
+	switch result.Type {
+	case models.ResultTypeSubdomain:
+		// 命中排除规则、不存在的子域名不作为资产
+		if excluded, _ := data["excluded"].(bool); excluded || cellValue(data["resolution"]) == "nxdomain" {
+			return nil
+		}
+		asset.Kind = models.AssetKindSubdomain
+		asset.Key = strings.ToLower(strings.TrimSuffix(cellValue(data["subdomain"]), "."))
+		asset.Host = asset.Key
+		asset.IPs = stringList(data["ips"])
+		asset.URL = cellValue(data["url"])
+
+	case models.ResultTypePort:
+		asset.Kind = models.AssetKindPort
+		asset.IP = cellValue(data["ip"])
+		if asset.IP == "" {
+			asset.IP = cellValue(data["host"])
+		}
+		asset.Host = cellValue(data["host"])
+		asset.Port, _ = strconv.Atoi(cellValue(data["port"]))
+		if asset.IP == "" || asset.Port == 0 {
+			return nil
+		}
+		asset.Key = net.JoinHostPort(strings.ToLower(asset.IP), strconv.Itoa(asset.Port))
+		asset.Service = cellValue(data["service"])
+		asset.ASN, _ = intValue(data["asn"])
+		asset.Org = cellValue(data["org"])
+		asset.Country = cellValue(data["country"])
+		asset.CountryCode = cellValue(data["country_code"])
+		asset.City = cellValue(data["city"])
+
+	case models.ResultTypeService:
+		asset.Kind = models.AssetKindWeb
+		asset.URL = cellValue(data["url"])
+		asset.Key = strings.ToLower(extractHostFromURL(asset.URL))
+		if asset.Key == "" {
+			asset.Key = strings.ToLower(cellValue(data["host"]))
+		}
+		asset.Host = cellValue(data["host"])
+		asset.IP = cellValue(data["ip"])
+		asset.Port, _ = strconv.Atoi(cellValue(data["port"]))
+
+	default:
+		return nil
+	}
+	if asset.Key == "" {
+		return nil
+	}
+
+	asset.Title = cellValue(data["title"])
+	asset.StatusCode, _ = strconv.Atoi(cellValue(data["status_code"]))
+	asset.Technologies = stringList(data["technologies"])
+	return asset
+}
+
+// stringList 取字符串列表字段，忽略空元素
+func stringList(v interface{}) []string {
+	var items []interface{}
+	switch val := v.(type) {
+	case []string:
+		for _, s := range val {
+			items = append(items, s)
+		}
+	case primitive.A:
+		items = val
+	case []interface{}:
+		items = val
+	case string:
+		items = []interface{}{val}
+	}
+	var list []string
+	for _, item := range items {
+		if s := cellValue(item); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// AssetIndexes 资产集合的索引：合并键唯一，避免并发写入同一资产时 upsert 产生重复记录
+func AssetIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "workspace_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "last_seen", Value: -1}}},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "first_task_id", Value: 1}}},
+	}
+}
+
+// EnsureAssetIndexes 创建资产集合的索引，已存在的索引不会重复创建
+func EnsureAssetIndexes() error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	_, err := database.GetCollection(models.CollectionAssets).Indexes().CreateMany(ctx, AssetIndexes(), options.CreateIndexes())
+	return err
+}
+
+// mongoAssetStore 资产的数据库存储
+type mongoAssetStore struct{}
+
+// NewMongoAssetStore 创建数据库资产存储
+func NewMongoAssetStore() AssetStore {
+	return &mongoAssetStore{}
+}
+
+func (s *mongoAssetStore) UpsertAsset(ctx context.Context, asset *models.Asset) error {
+	filter := bson.M{
+		"workspace_id": asset.WorkspaceID,
+		"kind":         asset.Kind,
+		"key":          asset.Key,
+	}
+
+	// 只覆盖本次结果中非空的信息，未探测到标题的扫描不清空已有的标题
+	set := bson.M{"last_task_id": asset.LastTaskID}
+	for field, value := range map[string]interface{}{
+		"host":         asset.Host,
+		"ip":           asset.IP,
+		"url":          asset.URL,
+		"title":        asset.Title,
+		"service":      asset.Service,
+		"org":          asset.Org,
+		"country":      asset.Country,
+		"country_code": asset.CountryCode,
+		"city":         asset.City,
+	} {
+		if value != "" {
+			set[field] = value
+		}
+	}
+	if asset.Port != 0 {
+		set["port"] = asset.Port
+	}
+	if asset.StatusCode != 0 {
+		set["status_code"] = asset.StatusCode
+	}
+	if asset.ASN != 0 {
+		set["asn"] = asset.ASN
+	}
+	if len(asset.IPs) > 0 {
+		set["ips"] = asset.IPs
+	}
+	if len(asset.Technologies) > 0 {
+		set["technologies"] = asset.Technologies
+	}
+
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"first_seen": asset.FirstSeen, "first_task_id": asset.FirstTaskID},
+		"$max":         bson.M{"last_seen": asset.LastSeen},
+		"$addToSet":    bson.M{"task_ids": asset.LastTaskID},
+	}
+	collection := database.GetCollection(models.CollectionAssets)
+	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+
+	// $addToSet 不支持 $slice，超过上限时再裁剪为最近的任务
+	filter[fmt.Sprintf("task_ids.%d", MaxAssetTaskIDs)] = bson.M{"$exists": true}
+	trim := bson.M{"$push": bson.M{"task_ids": bson.M{"$each": bson.A{}, "$slice": -MaxAssetTaskIDs}}}
+	_, err := collection.UpdateOne(ctx, filter, trim)
+	return err
+}
+
+func (s *mongoAssetStore) FindAssets(ctx context.Context, filter AssetFilter, page, pageSize int) ([]*models.Asset, int64, error) {
+	query := bson.M{"workspace_id": filter.WorkspaceID}
+	if len(filter.Kinds) > 0 {
+		query["kind"] = bson.M{"$in": filter.Kinds}
+	}
+	if filter.LiveOnly {
+		query["status_code"] = bson.M{"$gt": 0}
+	}
+	if !filter.SeenBefore.IsZero() {
+		query["last_seen"] = bson.M{"$lt": filter.SeenBefore}
+	}
+	if !filter.FirstTaskID.IsZero() {
+		query["first_task_id"] = filter.FirstTaskID
+	}
+
+	collection := database.GetCollection(models.CollectionAssets)
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "last_seen", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var assets []*models.Asset
+	if err := cursor.All(ctx, &assets); err != nil {
+		return nil, 0, err
+	}
+	return assets, total, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"github.com/robfig/cron/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 巡航任务的触发控制
+// 每个后端实例都运行调度器，同一巡航在同一分钟只允许一个实例触发（Redis SETNX 锁）；
+// 上一次触发的任务仍在排队或执行时，按巡航的重叠策略跳过本次触发或照常触发
+
+const (
+	cruiseFireLockPrefix = "cruise:fire:"
+	// cruiseFireLockTTL 触发锁过期时间，只需覆盖各实例调度器之间的时钟偏差
+	cruiseFireLockTTL = 10 * time.Minute
+	// cruiseSyncSpec 从数据库同步巡航调度的间隔，其他实例上的启用、暂停和修改在一分钟内生效
+	cruiseSyncSpec = "@every 1m"
+)
+
+// ErrCruiseOverlap 上一次触发的任务仍未结束
+var ErrCruiseOverlap = errors.New("上一次巡航任务仍在执行")
+
+// cronParser 巡航使用五段式 Cron 表达式：分 时 日 月 周
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// ParseCronExpr 解析巡航的 Cron 表达式
+func ParseCronExpr(expr string) (cron.Schedule, error) {
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %v", err)
+	}
+	return schedule, nil
+}
+
+// ValidateOverlapPolicy 校验重叠策略，空值表示默认的 skip
+func ValidateOverlapPolicy(policy models.CruiseOverlapPolicy) error {
+	switch policy {
+	case "", models.CruiseOverlapSkip, models.CruiseOverlapAllow:
+		return nil
+	}
+	return fmt.Errorf("无效的重叠策略: %s", policy)
+}
+
+// CruiseSkipReason 巡航本次不触发的原因，空值表示触发
+type CruiseSkipReason string
+
+const (
+	CruiseSkipNone    CruiseSkipReason = ""
+	CruiseSkipPaused  CruiseSkipReason = "paused"  // 巡航已暂停
+	CruiseSkipLocked  CruiseSkipReason = "locked"  // 其他实例已在这一分钟触发
+	CruiseSkipOverlap CruiseSkipReason = "overlap" // 上一次的任务仍未结束
+)
+
+// CruiseFireStore 巡航触发判断依赖的存储操作
+type CruiseFireStore interface {
+	// AcquireFireLock 获取巡航在某一分钟的触发锁，已被其他实例获取时返回 false
+	AcquireFireLock(ctx context.Context, cruiseID string, slot time.Time) (bool, error)
+	// GetTaskStatus 任务的状态，任务不存在时返回空值
+	GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error)
+}
+
+// CruiseGate 判断巡航是否触发
+type CruiseGate struct {
+	store CruiseFireStore
+}
+
+// NewCruiseGate 创建巡航触发判断
+func NewCruiseGate(store CruiseFireStore) *CruiseGate {
+	return &CruiseGate{store: store}
+}
+
+// Check 判断巡航在 slot 这一分钟是否触发
+// manual 为立即执行：不受暂停和触发锁限制，但仍遵守重叠策略
+func (g *CruiseGate) Check(ctx context.Context, cruise *models.CruiseTask, slot time.Time, manual bool) (CruiseSkipReason, error) {
+	if !manual {
+		if cruise.Status == models.CruiseStatusDisabled {
+			return CruiseSkipPaused, nil
+		}
+		acquired, err := g.store.AcquireFireLock(ctx, cruise.ID.Hex(), slot.Truncate(time.Minute))
+		if err != nil {
+			return CruiseSkipNone, err
+		}
+		if !acquired {
+			return CruiseSkipLocked, nil
+		}
+	}
+
+	if cruise.OverlapPolicy == models.CruiseOverlapAllow || cruise.LastTaskID == "" {
+		return CruiseSkipNone, nil
+	}
+	status, err := g.store.GetTaskStatus(ctx, cruise.LastTaskID)
+	if err != nil {
+		return CruiseSkipNone, err
+	}
+	if status == models.TaskStatusPending || status == models.TaskStatusRunning {
+		return CruiseSkipOverlap, nil
+	}
+	return CruiseSkipNone, nil
+}
+
+// cruiseFireLockKey 巡航触发锁的 Redis key，按 UTC 分钟区分
+func cruiseFireLockKey(cruiseID string, slot time.Time) string {
+	return cruiseFireLockPrefix + cruiseID + ":" + slot.UTC().Format("200601021504")
+}
+
+// mongoCruiseFireStore 基于 Redis / MongoDB 的触发存储
+type mongoCruiseFireStore struct{}
+
+// NewMongoCruiseFireStore 创建触发存储
+func NewMongoCruiseFireStore() CruiseFireStore {
+	return &mongoCruiseFireStore{}
+}
+
+func (s *mongoCruiseFireStore) AcquireFireLock(ctx context.Context, cruiseID string, slot time.Time) (bool, error) {
+	return database.GetRedis().SetNX(ctx, cruiseFireLockKey(cruiseID, slot), newExecutorID(), cruiseFireLockTTL).Result()
+}
+
+func (s *mongoCruiseFireStore) GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return "", nil
+	}
+	var task struct {
+		Status models.TaskStatus `bson:"status"`
+	}
+	err = database.GetCollection(models.CollectionTasks).FindOne(ctx, bson.M{"_id": objID},
+		options.FindOne().SetProjection(bson.M{"status": 1})).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	return task.Status, err
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -9,6 +10,7 @@ import (
 
 	"moongazing/database"
 	"moongazing/models"
+	"moongazing/scanner/core"
 
 	"github.com/robfig/cron/v3"
 	"go.mongodb.org/mongo-driver/bson"
@@ -23,7 +25,9 @@ type CruiseService struct {
 	logCollection *mongo.Collection
 	scheduler     *cron.Cron
 	taskService   *TaskService
+	gate          *CruiseGate
 	entryMap      map[string]cron.EntryID // cruiseID -> cronEntryID
+	entrySpecs    map[string]string       // cruiseID -> 调度时使用的 Cron 表达式
 	mu            sync.RWMutex
 	ctx           context.Context
 	cancel        context.CancelFunc
@@ -37,11 +41,13 @@ func NewCruiseService() *CruiseService {
 	scheduler := cron.New(cron.WithLocation(time.Local))
 	
 	service := &CruiseService{
-		collection:    database.GetCollection("cruise_tasks"),
-		logCollection: database.GetCollection("cruise_logs"),
+		collection:    database.GetCollection(models.CollectionCruiseTasks),
+		logCollection: database.GetCollection(models.CollectionCruiseLogs),
 		scheduler:     scheduler,
 		taskService:   NewTaskService(),
+		gate:          NewCruiseGate(NewMongoCruiseFireStore()),
 		entryMap:      make(map[string]cron.EntryID),
+		entrySpecs:    make(map[string]string),
 		ctx:           ctx,
 		cancel:        cancel,
 	}
@@ -59,6 +65,11 @@ func (s *CruiseService) Start() error {
 		return err
 	}
 	
+	// 定期与数据库同步，其他实例或 API 上的启用、暂停和修改无需重启即可生效
+	if _, err := s.scheduler.AddFunc(cruiseSyncSpec, s.syncCruises); err != nil {
+		return err
+	}
+	
 	// 启动调度器
 	s.scheduler.Start()
 	log.Println("[CruiseService] Cruise scheduler started")
@@ -77,30 +88,77 @@ func (s *CruiseService) Stop() {
 
 // loadEnabledCruises 加载所有启用的巡航任务
 func (s *CruiseService) loadEnabledCruises() error {
+	cruises, err := s.findActiveCruises()
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("[CruiseService] Loading %d enabled cruise tasks", len(cruises))
+	
+	for _, cruise := range cruises {
+		if err := s.scheduleCruise(&cruise); err != nil {
+			log.Printf("[CruiseService] Failed to schedule cruise %s: %v", cruise.ID.Hex(), err)
+		}
+	}
+	
+	return nil
+}
+
+// findActiveCruises 查询未暂停的巡航任务（执行中的巡航也需要继续调度）
+func (s *CruiseService) findActiveCruises() ([]models.CruiseTask, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
 	defer cancel()
 	
-	filter := bson.M{"status": models.CruiseStatusEnabled}
+	filter := bson.M{"status": bson.M{"$in": []models.CruiseStatus{models.CruiseStatusEnabled, models.CruiseStatusRunning}}}
 	cursor, err := s.collection.Find(ctx, filter)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 	
 	var cruises []models.CruiseTask
 	if err := cursor.All(ctx, &cruises); err != nil {
-		return err
+		return nil, err
+	}
+	return cruises, nil
+}
+
+// syncCruises 与数据库同步调度：调度新启用或修改了表达式的巡航，移除已暂停或删除的巡航
+func (s *CruiseService) syncCruises() {
+	cruises, err := s.findActiveCruises()
+	if err != nil {
+		log.Printf("[CruiseService] Failed to sync cruises: %v", err)
+		return
 	}
 	
-	log.Printf("[CruiseService] Loading %d enabled cruise tasks", len(cruises))
-	
-	for _, cruise := range cruises {
-		if err := s.scheduleCruise(&cruise); err != nil {
-			log.Printf("[CruiseService] Failed to schedule cruise %s: %v", cruise.ID.Hex(), err)
+	active := make(map[string]bool, len(cruises))
+	for i := range cruises {
+		cruise := &cruises[i]
+		cruiseID := cruise.ID.Hex()
+		active[cruiseID] = true
+		
+		s.mu.RLock()
+		spec, scheduled := s.entrySpecs[cruiseID]
+		s.mu.RUnlock()
+		if scheduled && spec == cruise.CronExpr {
+			continue
+		}
+		if err := s.scheduleCruise(cruise); err != nil {
+			log.Printf("[CruiseService] Failed to schedule cruise %s: %v", cruiseID, err)
 		}
 	}
 	
-	return nil
+	s.mu.RLock()
+	var stale []string
+	for cruiseID := range s.entryMap {
+		if !active[cruiseID] {
+			stale = append(stale, cruiseID)
+		}
+	}
+	s.mu.RUnlock()
+	for _, cruiseID := range stale {
+		s.unscheduleCruise(cruiseID)
+	}
 }
 
 // scheduleCruise 调度单个巡航任务
@@ -113,6 +171,7 @@ func (s *CruiseService) scheduleCruise(cruise *models.CruiseTask) error {
 	if entryID, exists := s.entryMap[cruiseID]; exists {
 		s.scheduler.Remove(entryID)
 		delete(s.entryMap, cruiseID)
+		delete(s.entrySpecs, cruiseID)
 	}
 	
 	// 添加新的调度
@@ -124,6 +183,7 @@ func (s *CruiseService) scheduleCruise(cruise *models.CruiseTask) error {
 	}
 	
 	s.entryMap[cruiseID] = entryID
+	s.entrySpecs[cruiseID] = cruise.CronExpr
 	
 	// 更新下次执行时间
 	entry := s.scheduler.Entry(entryID)
@@ -143,13 +203,14 @@ func (s *CruiseService) unscheduleCruise(cruiseID string) {
 	if entryID, exists := s.entryMap[cruiseID]; exists {
 		s.scheduler.Remove(entryID)
 		delete(s.entryMap, cruiseID)
+		delete(s.entrySpecs, cruiseID)
 		log.Printf("[CruiseService] Unscheduled cruise %s", cruiseID)
 	}
 }
 
-// executeCruise 执行巡航任务
+// executeCruise 定时触发巡航任务
 func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
-	log.Printf("[CruiseService] Executing cruise: %s", cruiseID.Hex())
+	slot := time.Now().Truncate(time.Minute)
 	
 	// 获取巡航任务
 	cruise, err := s.GetCruise(cruiseID.Hex())
@@ -158,11 +219,33 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 		return
 	}
 	
-	// 检查状态
-	if cruise.Status != models.CruiseStatusEnabled {
-		log.Printf("[CruiseService] Cruise %s is not enabled, skipping", cruise.Name)
+	// 检查暂停、触发锁和重叠策略
+	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	reason, err := s.gate.Check(ctx, cruise, slot, false)
+	cancel()
+	if err != nil {
+		log.Printf("[CruiseService] Failed to check cruise %s, skipping: %v", cruise.Name, err)
 		return
 	}
+	switch reason {
+	case CruiseSkipNone:
+	case CruiseSkipOverlap:
+		log.Printf("[CruiseService] Cruise %s skipped, previous task %s is still running", cruise.Name, cruise.LastTaskID)
+		s.recordCruiseLog(cruiseID, primitive.NilObjectID, "skipped", slot, slot, 0, 0,
+			fmt.Sprintf("%s: %s", ErrCruiseOverlap.Error(), cruise.LastTaskID))
+		return
+	default:
+		log.Printf("[CruiseService] Cruise %s skipped: %s", cruise.Name, reason)
+		return
+	}
+	
+	s.launchCruise(cruise)
+}
+
+// launchCruise 创建巡航的扫描任务并监控执行结果
+func (s *CruiseService) launchCruise(cruise *models.CruiseTask) {
+	cruiseID := cruise.ID
+	log.Printf("[CruiseService] Executing cruise: %s", cruiseID.Hex())
 	
 	// 更新状态为执行中
 	s.updateCruiseStatus(cruiseID, models.CruiseStatusRunning)
@@ -180,6 +263,8 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 		TargetType:  cruise.TargetType,
 		Config:      cruise.Config,
 		IsScheduled: true,
+		CronExpr:    cruise.CronExpr,
+		CruiseID:    cruiseID,
 		CreatedBy:   cruise.CreatedBy,
 		Tags:        append(cruise.Tags, "cruise", "auto"),
 		CreatedAt:   startTime,
@@ -187,11 +272,11 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 	}
 	
 	// 保存任务 (CreateTask 返回 error)
-	err = s.taskService.CreateTask(task)
+	err := s.taskService.CreateTask(task)
 	if err != nil {
 		log.Printf("[CruiseService] Failed to create task for cruise %s: %v", cruise.Name, err)
 		s.recordCruiseLog(cruiseID, primitive.NilObjectID, "failed", startTime, time.Now(), 0, 0, err.Error())
-		s.updateCruiseStatus(cruiseID, models.CruiseStatusEnabled)
+		s.finishCruiseRun(cruiseID)
 		s.incrementFailCount(cruiseID)
 		return
 	}
@@ -230,7 +315,7 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 				   updatedTask.Status == models.TaskStatusCancelled {
 					
 					endTime := time.Now()
-					duration := int64(endTime.Sub(startTime).Seconds())
+					durationMs := core.MillisBetween(startTime, endTime)
 					
 					resultCount := updatedTask.ResultStats.DiscoveredAssets
 					vulnCount := updatedTask.ResultStats.DiscoveredVulns
@@ -245,10 +330,10 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 					}
 					
 					// 更新日志
-					s.updateCruiseLog(cruiseID, taskObjID, status, endTime, duration, resultCount, vulnCount, errorMsg)
+					s.updateCruiseLog(cruiseID, taskObjID, status, endTime, durationMs, resultCount, vulnCount, errorMsg)
 					
 					// 更新巡航状态
-					s.updateCruiseStatus(cruiseID, models.CruiseStatusEnabled)
+					s.finishCruiseRun(cruiseID)
 					s.updateLastStatus(cruiseID, status)
 					
 					if status == "success" {
@@ -274,8 +359,8 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 				
 			case <-timeout:
 				log.Printf("[CruiseService] Cruise %s task timeout", cruise.Name)
-				s.updateCruiseLog(cruiseID, taskObjID, "timeout", time.Now(), int64(24*time.Hour.Seconds()), 0, 0, "任务执行超时")
-				s.updateCruiseStatus(cruiseID, models.CruiseStatusEnabled)
+				s.updateCruiseLog(cruiseID, taskObjID, "timeout", time.Now(), core.Millis(24*time.Hour), 0, 0, "任务执行超时")
+				s.finishCruiseRun(cruiseID)
 				s.incrementFailCount(cruiseID)
 				return
 			}
@@ -286,10 +371,12 @@ func (s *CruiseService) executeCruise(cruiseID primitive.ObjectID) {
 // CreateCruise 创建巡航任务
 func (s *CruiseService) CreateCruise(req *models.CruiseTaskCreateRequest, userID, workspaceID primitive.ObjectID) (*models.CruiseTask, error) {
 	// 验证 Cron 表达式
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	_, err := parser.Parse(req.CronExpr)
+	_, err := ParseCronExpr(req.CronExpr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid cron expression: %v", err)
+		return nil, err
+	}
+	if err := ValidateOverlapPolicy(req.OverlapPolicy); err != nil {
+		return nil, err
 	}
 	
 	now := time.Now()
@@ -306,6 +393,7 @@ func (s *CruiseService) CreateCruise(req *models.CruiseTaskCreateRequest, userID
 		Status:           models.CruiseStatusDisabled, // 默认禁用，需手动启用
 		CronExpr:         req.CronExpr,
 		Timezone:         timezone,
+		OverlapPolicy:    req.OverlapPolicy,
 		Targets:          req.Targets,
 		TargetType:       req.TargetType,
 		TaskType:         req.TaskType,
@@ -348,15 +436,20 @@ func (s *CruiseService) UpdateCruise(cruiseID string, req *models.CruiseTaskUpda
 	}
 	if req.CronExpr != nil {
 		// 验证 Cron 表达式
-		parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-		if _, err := parser.Parse(*req.CronExpr); err != nil {
-			return fmt.Errorf("invalid cron expression: %v", err)
+		if _, err := ParseCronExpr(*req.CronExpr); err != nil {
+			return err
 		}
 		update["cron_expr"] = *req.CronExpr
 	}
 	if req.Timezone != nil {
 		update["timezone"] = *req.Timezone
 	}
+	if req.OverlapPolicy != nil {
+		if err := ValidateOverlapPolicy(*req.OverlapPolicy); err != nil {
+			return err
+		}
+		update["overlap_policy"] = *req.OverlapPolicy
+	}
 	if req.Targets != nil {
 		update["targets"] = req.Targets
 	}
@@ -393,7 +486,7 @@ func (s *CruiseService) UpdateCruise(cruiseID string, req *models.CruiseTaskUpda
 	// 如果更新了 cron 表达式且任务已启用，重新调度
 	if req.CronExpr != nil {
 		cruise, _ := s.GetCruise(cruiseID)
-		if cruise != nil && cruise.Status == models.CruiseStatusEnabled {
+		if cruise != nil && cruise.Status != models.CruiseStatusDisabled {
 			s.scheduleCruise(cruise)
 		}
 	}
@@ -445,24 +538,75 @@ func (s *CruiseService) GetCruise(cruiseID string) (*models.CruiseTask, error) {
 	return &cruise, nil
 }
 
+// GetCruiseForUser 获取巡航任务并校验用户对其所在工作空间的权限，need 为需要的最低角色
+// 巡航任务不存在和用户看不到其所在的工作空间都返回 ErrCruiseNotFound
+func (s *CruiseService) GetCruiseForUser(cruiseID string, userID primitive.ObjectID, role string, need models.WorkspaceRole) (*models.CruiseTask, error) {
+	if _, err := primitive.ObjectIDFromHex(cruiseID); err != nil {
+		return nil, ErrCruiseNotFound
+	}
+	cruise, err := s.GetCruise(cruiseID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCruiseNotFound
+		}
+		return nil, err
+	}
+	if err := s.taskService.access.AuthorizeCruise(cruise, userID, role, need); err != nil {
+		return nil, err
+	}
+	return cruise, nil
+}
+
+// AuthorizeWorkspace 校验用户对工作空间的权限，创建巡航任务前调用；不是成员时返回 ErrWorkspaceNotFound
+func (s *CruiseService) AuthorizeWorkspace(workspaceID, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	return s.taskService.AuthorizeWorkspace(workspaceID, userID, role, need)
+}
+
+// VisibleWorkspaceIDs 用户可以查看的工作空间，all 为 true 时不限制
+func (s *CruiseService) VisibleWorkspaceIDs(userID primitive.ObjectID, role string) ([]primitive.ObjectID, bool, error) {
+	return s.taskService.VisibleWorkspaceIDs(userID, role)
+}
+
+// CruiseListFilter 巡航任务列表过滤条件
+type CruiseListFilter struct {
+	WorkspaceID  primitive.ObjectID
+	WorkspaceIDs []primitive.ObjectID // 未指定 WorkspaceID 时只列出这些工作空间的巡航任务，nil 不限制
+	Search       string
+}
+
+// BSON 构建查询条件
+func (f CruiseListFilter) BSON() bson.M {
+	var conditions []bson.M
+	if !f.WorkspaceID.IsZero() {
+		conditions = append(conditions, bson.M{"workspace_id": f.WorkspaceID})
+	} else if f.WorkspaceIDs != nil {
+		// 默认空间的巡航任务 workspace_id 为空 ID（包含在 WorkspaceIDs 中），更早的数据可能没有该字段
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"workspace_id": bson.M{"$in": f.WorkspaceIDs}},
+			{"workspace_id": bson.M{"$exists": false}},
+		}})
+	}
+	if f.Search != "" {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"name": bson.M{"$regex": f.Search, "$options": "i"}},
+			{"description": bson.M{"$regex": f.Search, "$options": "i"}},
+		}})
+	}
+	switch len(conditions) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return conditions[0]
+	}
+	return bson.M{"$and": conditions}
+}
+
 // ListCruises 列出巡航任务
-func (s *CruiseService) ListCruises(workspaceID primitive.ObjectID, page, pageSize int, search string) ([]models.CruiseTask, int64, error) {
+func (s *CruiseService) ListCruises(f CruiseListFilter, page, pageSize int) ([]models.CruiseTask, int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	filter := bson.M{}
-	if !workspaceID.IsZero() {
-		filter["workspace_id"] = workspaceID
-		log.Printf("[CruiseService] ListCruises with workspaceID: %s", workspaceID.Hex())
-	} else {
-		log.Printf("[CruiseService] ListCruises without workspaceID filter")
-	}
-	if search != "" {
-		filter["$or"] = []bson.M{
-			{"name": bson.M{"$regex": search, "$options": "i"}},
-			{"description": bson.M{"$regex": search, "$options": "i"}},
-		}
-	}
+	filter := f.BSON()
 	
 	// 统计总数
 	total, err := s.collection.CountDocuments(ctx, filter)
@@ -504,7 +648,7 @@ func (s *CruiseService) EnableCruise(cruiseID string) error {
 		return err
 	}
 	
-	if cruise.Status == models.CruiseStatusEnabled {
+	if cruise.Status != models.CruiseStatusDisabled {
 		return nil
 	}
 	
@@ -531,15 +675,25 @@ func (s *CruiseService) DisableCruise(cruiseID string) error {
 	return s.updateCruiseStatus(objID, models.CruiseStatusDisabled)
 }
 
-// RunNow 立即执行一次
+// RunNow 立即执行一次，暂停中的巡航也可执行；上一次任务未结束且策略为 skip 时返回 ErrCruiseOverlap
 func (s *CruiseService) RunNow(cruiseID string) error {
-	objID, err := primitive.ObjectIDFromHex(cruiseID)
+	cruise, err := s.GetCruise(cruiseID)
 	if err != nil {
 		return err
 	}
 	
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	reason, err := s.gate.Check(ctx, cruise, time.Now(), true)
+	if err != nil {
+		return err
+	}
+	if reason == CruiseSkipOverlap {
+		return ErrCruiseOverlap
+	}
+	
 	// 异步执行
-	go s.executeCruise(objID)
+	go s.launchCruise(cruise)
 	
 	return nil
 }
@@ -581,6 +735,9 @@ func (s *CruiseService) GetCruiseLogs(cruiseID string, page, pageSize int) ([]mo
 	if logs == nil {
 		logs = []models.CruiseLog{}
 	}
+	for i := range logs {
+		logs[i].DurationMs = logs[i].ElapsedMs()
+	}
 
 	return logs, total, nil
 }
@@ -597,6 +754,16 @@ func (s *CruiseService) updateCruiseStatus(cruiseID primitive.ObjectID, status m
 	return err
 }
 
+// finishCruiseRun 执行结束后恢复为启用状态，执行期间被暂停的巡航保持暂停
+func (s *CruiseService) finishCruiseRun(cruiseID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	
+	s.collection.UpdateOne(ctx,
+		bson.M{"_id": cruiseID, "status": models.CruiseStatusRunning},
+		bson.M{"$set": bson.M{"status": models.CruiseStatusEnabled, "updated_at": time.Now()}})
+}
+
 func (s *CruiseService) updateNextRunTime(cruiseID primitive.ObjectID, nextRun time.Time) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -649,9 +816,9 @@ func (s *CruiseService) recordCruiseLog(cruiseID, taskID primitive.ObjectID, sta
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	
-	duration := int64(0)
+	durationMs := int64(0)
 	if !endTime.IsZero() {
-		duration = int64(endTime.Sub(startTime).Seconds())
+		durationMs = core.MillisBetween(startTime, endTime)
 	}
 	
 	log := models.CruiseLog{
@@ -661,7 +828,7 @@ func (s *CruiseService) recordCruiseLog(cruiseID, taskID primitive.ObjectID, sta
 		Status:      status,
 		StartTime:   startTime,
 		EndTime:     endTime,
-		Duration:    duration,
+		DurationMs:  durationMs,
 		ResultCount: resultCount,
 		VulnCount:   vulnCount,
 		Error:       errMsg,
@@ -671,7 +838,7 @@ func (s *CruiseService) recordCruiseLog(cruiseID, taskID primitive.ObjectID, sta
 	s.logCollection.InsertOne(ctx, log)
 }
 
-func (s *CruiseService) updateCruiseLog(cruiseID, taskID primitive.ObjectID, status string, endTime time.Time, duration int64, resultCount, vulnCount int, errMsg string) {
+func (s *CruiseService) updateCruiseLog(cruiseID, taskID primitive.ObjectID, status string, endTime time.Time, durationMs int64, resultCount, vulnCount int, errMsg string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	
@@ -680,37 +847,27 @@ func (s *CruiseService) updateCruiseLog(cruiseID, taskID primitive.ObjectID, sta
 		bson.M{"$set": bson.M{
 			"status":       status,
 			"end_time":     endTime,
-			"duration":     duration,
+			"duration_ms":  durationMs,
 			"result_count": resultCount,
 			"vuln_count":   vulnCount,
 			"error":        errMsg,
 		}})
 }
 
-// GetStats 获取巡航统计
-func (s *CruiseService) GetStats(workspaceID primitive.ObjectID) map[string]interface{} {
+// GetStats 获取巡航统计，f 限定统计的工作空间
+func (s *CruiseService) GetStats(f CruiseListFilter) map[string]interface{} {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	
-	filter := bson.M{}
-	if !workspaceID.IsZero() {
-		filter["workspace_id"] = workspaceID
+
+	filter := f.BSON()
+	withStatus := func(status models.CruiseStatus) bson.M {
+		return bson.M{"$and": []bson.M{filter, {"status": status}}}
 	}
-	
+
 	total, _ := s.collection.CountDocuments(ctx, filter)
-	
-	enabledFilter := bson.M{"status": models.CruiseStatusEnabled}
-	if !workspaceID.IsZero() {
-		enabledFilter["workspace_id"] = workspaceID
-	}
-	enabled, _ := s.collection.CountDocuments(ctx, enabledFilter)
-	
-	runningFilter := bson.M{"status": models.CruiseStatusRunning}
-	if !workspaceID.IsZero() {
-		runningFilter["workspace_id"] = workspaceID
-	}
-	running, _ := s.collection.CountDocuments(ctx, runningFilter)
-	
+	enabled, _ := s.collection.CountDocuments(ctx, withStatus(models.CruiseStatusEnabled))
+	running, _ := s.collection.CountDocuments(ctx, withStatus(models.CruiseStatusRunning))
+
 	return map[string]interface{}{
 		"total":    total,
 		"enabled":  enabled,
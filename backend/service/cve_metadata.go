@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CVE 元数据
+// 漏洞结果中的 CVSS、描述只有模板本身提供的内容。本地保存一份 CVE 元数据（cveimport 命令导入），
+// 合并漏洞时按漏洞ID、名称中的 CVE 编号查询评分和向量。
+// 数据源支持两种 JSON 格式：简单数组 [{"id","cvss_score","cvss_vector","severity","summary","references","published"}]，
+// 以及 NVD CVE API 2.0 的 {"vulnerabilities":[{"cve":{...}}]}
+
+// cvePattern CVE 编号
+var cvePattern = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+
+// cveImportBatch 每批写入的条数
+const cveImportBatch = 1000
+
+// ErrEmptyCVEFeed 数据源中没有 CVE
+var ErrEmptyCVEFeed = errors.New("CVE 数据中没有可导入的条目")
+
+// CVEStore CVE 元数据存储
+type CVEStore interface {
+	// GetCVEs 按编号批量查询，不存在的编号不在结果中
+	GetCVEs(ctx context.Context, ids []string) (map[string]*models.CVEMetadata, error)
+	// SaveCVEs 按编号覆盖写入
+	SaveCVEs(ctx context.Context, items []*models.CVEMetadata) error
+}
+
+// ExtractCVEIDs 提取文本中的 CVE 编号（大写，去重，按出现顺序）
+func ExtractCVEIDs(values ...string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, id := range cvePattern.FindAllString(v, -1) {
+			id = strings.ToUpper(id)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// simpleCVEEntry 简单格式的一条 CVE
+type simpleCVEEntry struct {
+	ID         string   `json:"id"`
+	CVSSScore  float64  `json:"cvss_score"`
+	CVSSVector string   `json:"cvss_vector"`
+	Severity   string   `json:"severity"`
+	Summary    string   `json:"summary"`
+	References []string `json:"references"`
+	Published  string   `json:"published"`
+}
+
+// nvdCVSSMetric NVD 2.0 的 CVSS 评分
+type nvdCVSSMetric struct {
+	Type     string `json:"type"` // Primary, Secondary
+	CVSSData struct {
+		BaseScore    float64 `json:"baseScore"`
+		VectorString string  `json:"vectorString"`
+		BaseSeverity string  `json:"baseSeverity"`
+	} `json:"cvssData"`
+	BaseSeverity string `json:"baseSeverity"` // CVSS 2.0 的级别在外层
+}
+
+// nvdFeed NVD CVE API 2.0 格式
+type nvdFeed struct {
+	Vulnerabilities []struct {
+		CVE struct {
+			ID           string `json:"id"`
+			Published    string `json:"published"`
+			Descriptions []struct {
+				Lang  string `json:"lang"`
+				Value string `json:"value"`
+			} `json:"descriptions"`
+			Metrics    map[string][]nvdCVSSMetric `json:"metrics"`
+			References []struct {
+				URL string `json:"url"`
+			} `json:"references"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+// nvdMetricOrder 多个 CVSS 版本时优先使用的版本
+var nvdMetricOrder = []string{"cvssMetricV40", "cvssMetricV31", "cvssMetricV30", "cvssMetricV2"}
+
+// ParseCVEFeed 解析 CVE 数据源，编号不合法的条目跳过
+func ParseCVEFeed(r io.Reader) ([]*models.CVEMetadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(string(data))
+
+	var items []*models.CVEMetadata
+	if strings.HasPrefix(trimmed, "[") {
+		var entries []simpleCVEEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("解析 CVE 数据失败: %w", err)
+		}
+		for _, e := range entries {
+			items = append(items, &models.CVEMetadata{
+				ID:         e.ID,
+				CVSSScore:  e.CVSSScore,
+				CVSSVector: e.CVSSVector,
+				Severity:   strings.ToLower(e.Severity),
+				Summary:    e.Summary,
+				References: e.References,
+				Published:  parseFeedTime(e.Published),
+			})
+		}
+	} else {
+		var feed nvdFeed
+		if err := json.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("解析 CVE 数据失败: %w", err)
+		}
+		for _, v := range feed.Vulnerabilities {
+			item := &models.CVEMetadata{ID: v.CVE.ID, Published: parseFeedTime(v.CVE.Published)}
+			for _, d := range v.CVE.Descriptions {
+				if d.Lang == "en" || item.Summary == "" {
+					item.Summary = d.Value
+				}
+			}
+			for _, ref := range v.CVE.References {
+				item.References = append(item.References, ref.URL)
+			}
+			for _, version := range nvdMetricOrder {
+				metric, ok := primaryMetric(v.CVE.Metrics[version])
+				if !ok {
+					continue
+				}
+				item.CVSSScore = metric.CVSSData.BaseScore
+				item.CVSSVector = metric.CVSSData.VectorString
+				item.Severity = strings.ToLower(metric.CVSSData.BaseSeverity)
+				if item.Severity == "" {
+					item.Severity = strings.ToLower(metric.BaseSeverity)
+				}
+				break
+			}
+			items = append(items, item)
+		}
+	}
+
+	valid := items[:0]
+	now := time.Now()
+	for _, item := range items {
+		ids := ExtractCVEIDs(item.ID)
+		if len(ids) != 1 {
+			continue
+		}
+		item.ID = ids[0]
+		item.UpdatedAt = now
+		valid = append(valid, item)
+	}
+	if len(valid) == 0 {
+		return nil, ErrEmptyCVEFeed
+	}
+	return valid, nil
+}
+
+// primaryMetric NVD 的 Primary 评分，没有时取第一条
+func primaryMetric(metrics []nvdCVSSMetric) (nvdCVSSMetric, bool) {
+	if len(metrics) == 0 {
+		return nvdCVSSMetric{}, false
+	}
+	for _, m := range metrics {
+		if m.Type == "Primary" {
+			return m, true
+		}
+	}
+	return metrics[0], true
+}
+
+// parseFeedTime 解析数据源中的时间，支持 RFC3339 和 NVD 不带时区的格式
+func parseFeedTime(s string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05.000", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ImportCVEFeed 解析数据源并写入存储，返回导入的条数
+func ImportCVEFeed(store CVEStore, r io.Reader) (int, error) {
+	items, err := ParseCVEFeed(r)
+	if err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(items); start += cveImportBatch {
+		end := start + cveImportBatch
+		if end > len(items) {
+			end = len(items)
+		}
+		ctx, cancel := database.NewContext()
+		err := store.SaveCVEs(ctx, items[start:end])
+		cancel()
+		if err != nil {
+			return start, fmt.Errorf("写入 CVE 数据失败: %w", err)
+		}
+	}
+	return len(items), nil
+}
+
+// mongoCVEStore CVE 元数据的数据库存储
+type mongoCVEStore struct{}
+
+// NewMongoCVEStore 创建数据库 CVE 元数据存储
+func NewMongoCVEStore() CVEStore {
+	return &mongoCVEStore{}
+}
+
+func (s *mongoCVEStore) GetCVEs(ctx context.Context, ids []string) (map[string]*models.CVEMetadata, error) {
+	result := make(map[string]*models.CVEMetadata)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	cursor, err := database.GetCollection(models.CollectionCVEMetadata).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var item models.CVEMetadata
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		result[item.ID] = &item
+	}
+	return result, cursor.Err()
+}
+
+func (s *mongoCVEStore) SaveCVEs(ctx context.Context, items []*models.CVEMetadata) error {
+	writes := make([]mongo.WriteModel, 0, len(items))
+	for _, item := range items {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": item.ID}).
+			SetReplacement(item).
+			SetUpsert(true))
+	}
+	_, err := database.GetCollection(models.CollectionCVEMetadata).BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
@@ -127,7 +127,7 @@ func (e *TaskExecutor) executeContentScan(task *models.Task) {
 		progress := int((float64(i) / float64(len(targets))) * 100)
 		e.updateProgress(task, progress)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		ctx, cancel := context.WithTimeout(e.toolContext(task), 10*time.Minute)
 		sprayResult, err := sprayScanner.Scan(ctx, target)
 		cancel()
 
@@ -242,7 +242,7 @@ func (e *TaskExecutor) executeCrawlerScan(task *models.Task) {
 
 		// Katana 爬取
 		if useKatana {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(katanaScanner.ExecutionTimeout)*time.Minute)
+			ctx, cancel := context.WithTimeout(e.toolContext(task), time.Duration(katanaScanner.ExecutionTimeout)*time.Minute)
 			katanaResult, err := katanaScanner.Crawl(ctx, target)
 			cancel()
 
@@ -271,7 +271,7 @@ func (e *TaskExecutor) executeCrawlerScan(task *models.Task) {
 
 		// Rad 爬取
 		if useRad {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(radScanner.ExecutionTimeout)*time.Minute)
+			ctx, cancel := context.WithTimeout(e.toolContext(task), time.Duration(radScanner.ExecutionTimeout)*time.Minute)
 			radResult, err := radScanner.Crawl(ctx, target)
 			cancel()
 
@@ -39,21 +39,29 @@ func (e *TaskExecutor) executePortScan(task *models.Task) {
 	}
 	
 	gogoScanner := portscan.NewGoGoScannerWithConfig(gogoConfig)
-	if !gogoScanner.IsAvailable() {
-		e.failTask(task, "GoGo 端口扫描器初始化失败")
-		return
+	var scanner portscan.PortScanner = gogoScanner
+	if gogoScanner.IsAvailable() {
+		log.Printf("[TaskExecutor] Using GoGo for port scanning, config: timeout=%ds, threads=%d",
+			gogoConfig.Timeout, gogoConfig.Threads)
+	} else {
+		// GoGo 未安装时使用内置 TCP 连接扫描
+		log.Printf("[TaskExecutor] GoGo not available, falling back to built-in TCP connect scan")
+		scanner = gogoScanner.TCPFallback()
 	}
-	
-	log.Printf("[TaskExecutor] Using GoGo for port scanning, config: timeout=%ds, threads=%d",
-		gogoConfig.Timeout, gogoConfig.Threads)
 
 	for i, target := range targets {
 		progress := int((float64(i) / float64(len(targets))) * 100)
 		e.updateProgress(task, progress)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		// IPv6 地址由 GoGoScanner 改用 TCP 连接扫描，任务设置跳过时不扫描
+		if task.Config.IPv6Mode == core.IPv6ModeSkip && core.IsIPv6(target) {
+			log.Printf("[TaskExecutor] Skipping IPv6 target %s (ipv6_mode=skip)", target)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(e.toolContext(task), 10*time.Minute)
 		
-		scanResult, err := e.runPortScanMode(ctx, gogoScanner, target, task.Config.PortScanMode, task.Config.PortRange)
+		scanResult, err := e.runPortScanMode(ctx, scanner, target, task.Config.PortScanMode, task.Config.PortRange)
 		cancel()
 		
 		if err != nil {
@@ -80,9 +88,14 @@ func (e *TaskExecutor) executePortScan(task *models.Task) {
 						"version":     port.Version,
 						"banner":      port.Banner,
 						"fingerprint": port.Fingerprint,
+						"protocol":    port.Protocol,
+						"tls":         port.TLS,
 					},
 					CreatedAt: time.Now(),
 				}
+				if family := core.AddressFamily(target); family != "" {
+					result.Data["family"] = family
+				}
 				results = append(results, result)
 			}
 		}
@@ -93,7 +106,7 @@ func (e *TaskExecutor) executePortScan(task *models.Task) {
 }
 
 // runPortScanMode 根据模式运行端口扫描
-func (e *TaskExecutor) runPortScanMode(ctx context.Context, gogoScanner *portscan.GoGoScanner, target, mode, customPorts string) (*core.ScanResult, error) {
+func (e *TaskExecutor) runPortScanMode(ctx context.Context, scanner portscan.PortScanner, target, mode, customPorts string) (*core.ScanResult, error) {
 	if mode == "" {
 		mode = "quick"
 	}
@@ -101,18 +114,18 @@ func (e *TaskExecutor) runPortScanMode(ctx context.Context, gogoScanner *portsca
 	switch mode {
 	case "full":
 		log.Printf("[TaskExecutor] Running full port scan (1-65535) on %s", target)
-		return gogoScanner.FullScan(ctx, target)
+		return scanner.FullScan(ctx, target)
 	case "top1000":
 		log.Printf("[TaskExecutor] Running top 1000 port scan on %s", target)
-		return gogoScanner.Top1000Scan(ctx, target)
+		return scanner.Top1000Scan(ctx, target)
 	case "custom":
 		if customPorts == "" {
 			customPorts = "1-1000"
 		}
 		log.Printf("[TaskExecutor] Running custom port scan (%s) on %s", customPorts, target)
-		return gogoScanner.ScanPorts(ctx, target, customPorts)
+		return scanner.ScanPorts(ctx, target, customPorts)
 	default:
 		log.Printf("[TaskExecutor] Running quick port scan on %s", target)
-		return gogoScanner.QuickScan(ctx, target)
+		return scanner.QuickScan(ctx, target)
 	}
 }
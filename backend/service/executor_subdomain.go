@@ -7,6 +7,7 @@ import (
 
 	"moongazing/config"
 	"moongazing/models"
+	"moongazing/scanner/core"
 	"moongazing/scanner/subdomain"
 	"moongazing/scanner/webscan"
 	"moongazing/scanner/subdomain/thirdparty"
@@ -62,7 +63,8 @@ func (e *TaskExecutor) executeSubdomainScan(task *models.Task) {
 			continue
 		}
 
-		// 收集子域名
+		// 收集子域名，国际化域名使用 punycode 形式
+		target = core.ToASCIIDomain(target)
 		subdomainSet := e.collectSubdomains(target, domainScanner, thirdpartyManager)
 		
 		log.Printf("[TaskExecutor] Total unique subdomains collected: %d for %s", len(subdomainSet), target)
@@ -96,6 +98,7 @@ func (e *TaskExecutor) executeSubdomainScan(task *models.Task) {
 				Source:      "ksubdomain+httpx",
 				Data: bson.M{
 					"subdomain":    httpResult.Host,
+					"display_name": core.ToUnicodeDomain(httpResult.Host),
 					"domain":       target,
 					"full_domain":  httpResult.Host,
 					"url":          httpResult.URL,
@@ -105,6 +108,7 @@ func (e *TaskExecutor) executeSubdomainScan(task *models.Task) {
 					"status_code":  httpResult.StatusCode,
 					"web_server":   httpResult.WebServer,
 					"technologies": httpResult.Technologies,
+					"tech_versions": httpResult.TechVersions,
 					"cdn":          httpResult.CDN,
 					"cdn_name":     httpResult.CDNName,
 					"alive":        httpResult.StatusCode > 0,
@@ -166,6 +170,8 @@ func (e *TaskExecutor) createThirdpartyManager() *thirdparty.APIManager {
 		FofaKey:   cfg.ThirdParty.Fofa.Key,
 		HunterKey: cfg.ThirdParty.Hunter.Key,
 		QuakeKey:  cfg.ThirdParty.Quake.Key,
+		OTXKey:    cfg.ThirdParty.OTX.Key,
+		ChaosKey:  cfg.ThirdParty.Chaos.Key,
 	}
 	
 	if apiConfig.FofaKey != "" || apiConfig.HunterKey != "" || apiConfig.QuakeKey != "" {
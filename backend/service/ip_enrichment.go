@@ -0,0 +1,37 @@
+package service
+
+import (
+	"moongazing/scanner/geoip"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 端口结果的 IP 归属
+// 执行器保存端口结果前按 IP 查询本地 GeoLite2 数据库，把 asn、org、country、country_code、city 写入结果的 Data，
+// 合并到工作空间资产时一并保存。每个任务使用一个查询缓存，同一 IP 的多个端口只查询一次数据库。
+// 数据库不可用时不写入这些字段。
+
+// EnrichPortData 把 IP 归属信息写入端口结果的 Data，没有归属信息时不修改
+func EnrichPortData(data bson.M, cache *geoip.Cache) {
+	ip := cellValue(data["ip"])
+	if ip == "" {
+		ip = cellValue(data["host"])
+	}
+	info := cache.Lookup(ip)
+	if info.Empty() {
+		return
+	}
+	if info.ASN != 0 {
+		data["asn"] = int64(info.ASN)
+	}
+	for field, value := range map[string]string{
+		"org":          info.Org,
+		"country":      info.Country,
+		"country_code": info.CountryCode,
+		"city":         info.City,
+	} {
+		if value != "" {
+			data[field] = value
+		}
+	}
+}
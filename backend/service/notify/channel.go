@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// 渠道配置校验和脱敏
+// 通过接口返回的配置隐藏签名密钥、口令、bot token 和自定义请求头的值；
+// 更新时提交的仍是脱敏后的值则保留原值，前端不需要回传明文
+
+// MaskSecret 隐藏敏感信息，保留前后各 4 个字符
+func MaskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:4] + "****" + s[len(s)-4:]
+}
+
+// Validate 校验渠道配置：名称、类型对应的必填项、Webhook 地址和消息模板
+func (c NotifyConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+
+	var required [][2]string
+	var webhook string
+	switch c.Type {
+	case NotifyTypeDingTalk:
+		required = [][2]string{{"dingtalk_webhook", c.DingTalkWebhook}}
+		webhook = c.DingTalkWebhook
+	case NotifyTypeFeishu:
+		required = [][2]string{{"feishu_webhook", c.FeishuWebhook}}
+		webhook = c.FeishuWebhook
+	case NotifyTypeWechat:
+		required = [][2]string{{"wechat_webhook", c.WechatWebhook}}
+		webhook = c.WechatWebhook
+	case NotifyTypeEmail:
+		required = [][2]string{{"smtp_host", c.SMTPHost}, {"smtp_from", c.SMTPFrom}}
+		if len(c.EmailTo) == 0 {
+			return errors.New("email_to is required")
+		}
+	case NotifyTypeWebhook:
+		required = [][2]string{{"webhook_url", c.WebhookURL}}
+		webhook = c.WebhookURL
+	case NotifyTypeTelegram:
+		required = [][2]string{{"telegram_bot_token", c.TelegramBotToken}, {"telegram_chat_id", c.TelegramChatID}}
+		webhook = c.TelegramAPIURL
+	default:
+		return fmt.Errorf("unsupported notify type: %s", c.Type)
+	}
+	for _, field := range required {
+		if field[1] == "" {
+			return fmt.Errorf("%s is required", field[0])
+		}
+	}
+	if webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook url: %s", webhook)
+		}
+	}
+
+	_, err := NewMessageRenderer(c)
+	return err
+}
+
+// Masked 返回隐藏敏感信息后的配置
+func (c NotifyConfig) Masked() NotifyConfig {
+	c.DingTalkSecret = MaskSecret(c.DingTalkSecret)
+	c.FeishuSecret = MaskSecret(c.FeishuSecret)
+	c.SMTPPassword = MaskSecret(c.SMTPPassword)
+	c.TelegramBotToken = MaskSecret(c.TelegramBotToken)
+	if len(c.WebhookHeaders) > 0 {
+		headers := make(map[string]string, len(c.WebhookHeaders))
+		for k, v := range c.WebhookHeaders {
+			headers[k] = MaskSecret(v)
+		}
+		c.WebhookHeaders = headers
+	}
+	return c
+}
+
+// KeepSecrets 提交的敏感字段仍为原配置脱敏后的值时恢复为原值
+func (c *NotifyConfig) KeepSecrets(old NotifyConfig) {
+	keep := func(value *string, original string) {
+		if original != "" && *value == MaskSecret(original) {
+			*value = original
+		}
+	}
+	keep(&c.DingTalkSecret, old.DingTalkSecret)
+	keep(&c.FeishuSecret, old.FeishuSecret)
+	keep(&c.SMTPPassword, old.SMTPPassword)
+	keep(&c.TelegramBotToken, old.TelegramBotToken)
+	for k, v := range c.WebhookHeaders {
+		keep(&v, old.WebhookHeaders[k])
+		c.WebhookHeaders[k] = v
+	}
+}
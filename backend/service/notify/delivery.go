@@ -0,0 +1,225 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 通知投递
+// 每条通知按启用的渠道拆分为投递记录，先写入投递存储（状态 pending），再由后台投递协程发送。
+// 发送失败按指数退避重试，超过次数后标记为 failed 并保留最后一次错误；进程重启后未完成的投递会被重新发送
+
+// DeliveryStatus 投递状态
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Delivery 一条通知在一个渠道上的投递记录
+type Delivery struct {
+	ID            string         `json:"id" bson:"_id"`
+	WorkspaceID   string         `json:"workspace_id,omitempty" bson:"workspace_id,omitempty"`
+	TaskID        string         `json:"task_id,omitempty" bson:"task_id,omitempty"`
+	Channel       string         `json:"channel" bson:"channel"`                           // 通知配置名称
+	ChannelID     string         `json:"channel_id,omitempty" bson:"channel_id,omitempty"` // 数据库中保存的渠道ID
+	ChannelType   NotifyType     `json:"channel_type" bson:"channel_type"`
+	Message       *NotifyMessage `json:"message" bson:"message"`
+	Status        DeliveryStatus `json:"status" bson:"status"`
+	Attempts      int            `json:"attempts" bson:"attempts"`
+	LastError     string         `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time      `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     time.Time      `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" bson:"updated_at"`
+	DeliveredAt   *time.Time     `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// DeliveryFilter 投递记录查询条件
+type DeliveryFilter struct {
+	WorkspaceID string
+	Status      DeliveryStatus
+	Limit       int
+}
+
+// DeliveryStore 投递记录存储
+type DeliveryStore interface {
+	// InsertDeliveries 写入新的投递记录
+	InsertDeliveries(ctx context.Context, deliveries []*Delivery) error
+	// UpdateDelivery 更新投递状态、尝试次数和错误
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+	// PendingDeliveries 到达重试时间的待投递记录，按创建时间排序
+	PendingDeliveries(ctx context.Context, before time.Time, limit int) ([]*Delivery, error)
+	// RecentDeliveries 最近的投递记录，最新的在前
+	RecentDeliveries(ctx context.Context, filter DeliveryFilter) ([]*Delivery, error)
+}
+
+// RetryPolicy 投递重试策略
+type RetryPolicy struct {
+	MaxAttempts  int           // 最多尝试次数
+	BaseDelay    time.Duration // 第一次重试的等待时间，之后每次翻倍
+	MaxDelay     time.Duration // 重试等待时间上限
+	SendTimeout  time.Duration // 单次发送超时
+	PollInterval time.Duration // 扫描待投递记录的间隔
+	Workers      int           // 同时发送的投递数
+}
+
+// DefaultRetryPolicy 默认重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  6,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     30 * time.Minute,
+		SendTimeout:  30 * time.Second,
+		PollInterval: 10 * time.Second,
+		Workers:      10,
+	}
+}
+
+// backoff 第 attempts 次失败后的等待时间
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// SyncRetryPolicy 同步发送（手动发送、测试渠道）的重试策略：最多 3 次，间隔 1s、2s
+func SyncRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// RetryNotifier 发送失败时按退避策略重试的渠道，用于不经过投递队列的同步发送
+type RetryNotifier struct {
+	notifier Notifier
+	policy   RetryPolicy
+}
+
+// NewRetryNotifier 包装渠道，MaxAttempts 小于 1 时只发送一次
+func NewRetryNotifier(notifier Notifier, policy RetryPolicy) *RetryNotifier {
+	return &RetryNotifier{notifier: notifier, policy: policy}
+}
+
+func (n *RetryNotifier) Type() NotifyType {
+	return n.notifier.Type()
+}
+
+// Send 发送消息，失败后等待退避时间重试，ctx 结束时返回最后一次的错误
+func (n *RetryNotifier) Send(ctx context.Context, msg *NotifyMessage) error {
+	for attempt := 1; ; attempt++ {
+		err := n.notifier.Send(ctx, msg)
+		if err == nil || attempt >= n.policy.MaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(n.policy.backoff(attempt)):
+		}
+	}
+}
+
+// deliverySeq 投递记录ID序号
+var deliverySeq uint64
+
+// newDeliveryID 生成投递记录ID，同一时刻拆分出的多条记录也不会重复
+func newDeliveryID() string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&deliverySeq, 1))
+}
+
+// channelKey 渠道标识
+func channelKey(name string, t NotifyType) string {
+	return string(t) + ":" + name
+}
+
+// extraString 读取消息附加信息中的字符串
+func extraString(msg *NotifyMessage, key string) string {
+	if msg.Extra == nil {
+		return ""
+	}
+	s, _ := msg.Extra[key].(string)
+	return s
+}
+
+// memoryDeliveryStore 内存投递存储，未配置数据库时使用
+type memoryDeliveryStore struct {
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+}
+
+// NewMemoryDeliveryStore 创建内存投递存储
+func NewMemoryDeliveryStore() DeliveryStore {
+	return &memoryDeliveryStore{deliveries: make(map[string]*Delivery)}
+}
+
+func (s *memoryDeliveryStore) InsertDeliveries(ctx context.Context, deliveries []*Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range deliveries {
+		cp := *d
+		s.deliveries[d.ID] = &cp
+	}
+	return nil
+}
+
+func (s *memoryDeliveryStore) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[d.ID]; !ok {
+		return fmt.Errorf("delivery %s not found", d.ID)
+	}
+	cp := *d
+	s.deliveries[d.ID] = &cp
+	return nil
+}
+
+func (s *memoryDeliveryStore) PendingDeliveries(ctx context.Context, before time.Time, limit int) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*Delivery
+	for _, d := range s.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(before) {
+			cp := *d
+			due = append(due, &cp)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *memoryDeliveryStore) RecentDeliveries(ctx context.Context, filter DeliveryFilter) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*Delivery
+	for _, d := range s.deliveries {
+		if filter.WorkspaceID != "" && d.WorkspaceID != filter.WorkspaceID {
+			continue
+		}
+		if filter.Status != "" && d.Status != filter.Status {
+			continue
+		}
+		cp := *d
+		result = append(result, &cp)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 扫描中的漏洞即时通知
+// 任务运行期间保存的高危漏洞立即通知，不等任务结束；按工作空间的规则过滤严重程度、
+// 在每个任务内按 vuln_id+target 去重并限制时间窗口内的通知数，避免误报较多的模板刷屏
+
+// 默认规则
+const (
+	DefaultFindingMinSeverity   = "high"
+	DefaultFindingMaxAlerts     = 10
+	DefaultFindingWindowMinutes = 10
+	// findingEvidenceLimit 通知中证据摘要的最大长度
+	findingEvidenceLimit = 500
+)
+
+// severityRanks 严重程度排序，数值越大越严重
+var severityRanks = map[string]int{
+	"info":     1,
+	"low":      2,
+	"medium":   3,
+	"high":     4,
+	"critical": 5,
+}
+
+// Finding 任务运行中发现的漏洞
+type Finding struct {
+	WorkspaceID string
+	TaskID      string
+	TaskName    string
+	VulnID      string
+	Name        string
+	Severity    string
+	Target      string
+	Evidence    string
+}
+
+// FindingRule 工作空间的漏洞即时通知规则
+type FindingRule struct {
+	WorkspaceID   string    `json:"workspace_id" bson:"_id"`
+	Enabled       bool      `json:"enabled" bson:"enabled"`
+	MinSeverity   string    `json:"min_severity" bson:"min_severity"`     // 最低严重程度：critical、high、medium、low、info
+	MaxAlerts     int       `json:"max_alerts" bson:"max_alerts"`         // 每个任务在时间窗口内最多发送的通知数
+	WindowMinutes int       `json:"window_minutes" bson:"window_minutes"` // 限流时间窗口（分钟）
+	Dedupe        bool      `json:"dedupe" bson:"dedupe"`                 // 同一任务内相同 vuln_id+target 只通知一次
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// DefaultFindingRule 未配置规则的工作空间使用的默认规则：高危及以上，每 10 分钟最多 10 条，去重
+func DefaultFindingRule(workspaceID string) *FindingRule {
+	return &FindingRule{
+		WorkspaceID:   workspaceID,
+		Enabled:       true,
+		MinSeverity:   DefaultFindingMinSeverity,
+		MaxAlerts:     DefaultFindingMaxAlerts,
+		WindowMinutes: DefaultFindingWindowMinutes,
+		Dedupe:        true,
+	}
+}
+
+// Validate 校验规则
+func (r *FindingRule) Validate() error {
+	if _, ok := severityRanks[strings.ToLower(r.MinSeverity)]; !ok {
+		return errors.New("min_severity must be one of critical, high, medium, low, info")
+	}
+	if r.MaxAlerts < 1 {
+		return errors.New("max_alerts must be at least 1")
+	}
+	if r.WindowMinutes < 1 {
+		return errors.New("window_minutes must be at least 1")
+	}
+	return nil
+}
+
+// Matches 漏洞是否达到规则的最低严重程度
+func (r *FindingRule) Matches(severity string) bool {
+	rank, ok := severityRanks[strings.ToLower(severity)]
+	return r.Enabled && ok && rank >= severityRanks[strings.ToLower(r.MinSeverity)]
+}
+
+// FindingThrottle 单个任务的漏洞通知过滤、去重和限流
+type FindingThrottle struct {
+	rule *FindingRule
+	now  func() time.Time
+
+	mu         sync.Mutex
+	seen       map[string]bool
+	sent       []time.Time // 时间窗口内已发送通知的时间
+	suppressed int
+}
+
+// NewFindingThrottle 按规则创建任务的通知限流器
+func NewFindingThrottle(rule *FindingRule) *FindingThrottle {
+	return &FindingThrottle{
+		rule: rule,
+		now:  time.Now,
+		seen: make(map[string]bool),
+	}
+}
+
+// SetClock 替换时钟，用于测试时间窗口
+func (t *FindingThrottle) SetClock(now func() time.Time) {
+	t.now = now
+}
+
+// Allow 漏洞是否需要通知；未达到严重程度、重复或超过限流的返回 false
+func (t *FindingThrottle) Allow(f Finding) bool {
+	if !t.rule.Matches(f.Severity) {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := f.VulnID + "|" + f.Target
+	if t.rule.Dedupe && t.seen[key] {
+		t.suppressed++
+		return false
+	}
+
+	now := t.now()
+	window := time.Duration(t.rule.WindowMinutes) * time.Minute
+	kept := t.sent[:0]
+	for _, ts := range t.sent {
+		if now.Sub(ts) < window {
+			kept = append(kept, ts)
+		}
+	}
+	t.sent = kept
+	if len(t.sent) >= t.rule.MaxAlerts {
+		t.suppressed++
+		return false
+	}
+
+	t.seen[key] = true
+	t.sent = append(t.sent, now)
+	return true
+}
+
+// Suppressed 被去重或限流的通知数
+func (t *FindingThrottle) Suppressed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.suppressed
+}
+
+// NotifyFinding 发送任务运行中发现漏洞的通知，附带目标、漏洞名称、证据摘要和任务链接
+func (m *NotifyManager) NotifyFinding(f Finding) {
+	level := NotifyLevelWarning
+	if severityRanks[strings.ToLower(f.Severity)] >= severityRanks["high"] {
+		level = NotifyLevelCritical
+	}
+
+	evidence := f.Evidence
+	if runes := []rune(evidence); len(runes) > findingEvidenceLimit {
+		evidence = string(runes[:findingEvidenceLimit]) + "..."
+	}
+	link := "/tasks/" + f.TaskID
+
+	content := fmt.Sprintf("**任务**: %s\n**目标**: %s\n**严重程度**: %s", f.TaskName, f.Target, f.Severity)
+	if f.VulnID != "" {
+		content += fmt.Sprintf("\n**漏洞ID**: %s", f.VulnID)
+	}
+	if evidence != "" {
+		content += fmt.Sprintf("\n\n%s", evidence)
+	}
+	content += fmt.Sprintf("\n\n任务详情: %s", link)
+
+	msg := &NotifyMessage{
+		Event:     EventFinding,
+		Level:     level,
+		Title:     fmt.Sprintf("🚨 发现%s漏洞: %s", strings.ToUpper(f.Severity), f.Name),
+		Content:   content,
+		Source:    "vuln_scanner",
+		Timestamp: time.Now(),
+		Extra: map[string]interface{}{
+			"workspace_id": f.WorkspaceID,
+			"task_id":      f.TaskID,
+			"task_name":    f.TaskName,
+			"task_link":    link,
+			"vuln_id":      f.VulnID,
+			"vuln_name":    f.Name,
+			"target":       f.Target,
+			"severity":     f.Severity,
+			"evidence":     evidence,
+		},
+	}
+
+	m.SendAsync(msg)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,9 +32,19 @@ type NotifyManager struct {
 	configs   []NotifyConfig
 	mu        sync.RWMutex
 	
-	// 通知队列
-	queue      chan *NotifyMessage
-	stopCh     chan struct{}
+	// 投递渠道，按配置名称（数据库中保存的渠道为ID）和类型索引
+	channels map[string]Notifier
+	routes   map[string]channelRoute
+	custom   map[string]Notifier // 通过 AddNotifier 注册的渠道，重建时保留
+	
+	// 投递队列
+	store    DeliveryStore
+	policy   RetryPolicy
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	workers  chan struct{}
+	inflight map[string]bool
+	inflightMu sync.Mutex
 	
 	// 通知历史
 	history    []*NotifyHistory
@@ -40,6 +52,35 @@ type NotifyManager struct {
 	maxHistory int
 }
 
+// channelRoute 渠道的投递信息
+type channelRoute struct {
+	name        string
+	id          string
+	notifyType  NotifyType
+	workspaceID string // 为空时接收所有工作空间的通知
+}
+
+// accepts 渠道是否接收该工作空间的通知，不属于任何工作空间的消息只发往全局渠道
+func (r channelRoute) accepts(workspaceID string) bool {
+	return r.workspaceID == "" || r.workspaceID == workspaceID
+}
+
+// configKey 配置对应的渠道标识
+func configKey(config NotifyConfig) string {
+	if config.ID != "" {
+		return channelKey(config.ID, config.Type)
+	}
+	return channelKey(config.Name, config.Type)
+}
+
+// sameConfig 是否为同一个渠道配置：有ID时按ID，否则按名称和类型
+func sameConfig(a, b NotifyConfig) bool {
+	if a.ID != "" || b.ID != "" {
+		return a.ID == b.ID
+	}
+	return a.Name == b.Name && a.Type == b.Type
+}
+
 // NotifyHistory 通知历史记录
 type NotifyHistory struct {
 	ID        string      `json:"id"`
@@ -55,23 +96,69 @@ func NewNotifyManager() *NotifyManager {
 	return &NotifyManager{
 		notifiers:  make([]Notifier, 0),
 		configs:    make([]NotifyConfig, 0),
-		queue:      make(chan *NotifyMessage, 1000),
+		channels:   make(map[string]Notifier),
+		routes:     make(map[string]channelRoute),
+		custom:     make(map[string]Notifier),
+		store:      NewMemoryDeliveryStore(),
+		policy:     DefaultRetryPolicy(),
+		wakeCh:     make(chan struct{}, 1),
 		stopCh:     make(chan struct{}),
+		inflight:   make(map[string]bool),
 		history:    make([]*NotifyHistory, 0),
 		maxHistory: 1000,
 	}
 }
 
-// Start 启动通知管理器
+// Start 启动通知管理器，启动时未完成的投递会在第一次扫描时重新发送
 func (m *NotifyManager) Start() {
-	go m.processQueue()
+	m.mu.Lock()
+	m.workers = make(chan struct{}, m.policy.Workers)
+	m.mu.Unlock()
+	go m.dispatchLoop()
 }
 
-// Stop 停止通知管理器
+// Stop 停止通知管理器，未完成的投递保留在存储中，下次启动时继续
 func (m *NotifyManager) Stop() {
 	close(m.stopCh)
 }
 
+// SetDeliveryStore 设置投递存储（如数据库），并重新扫描其中未完成的投递
+func (m *NotifyManager) SetDeliveryStore(store DeliveryStore) {
+	m.mu.Lock()
+	m.store = store
+	m.mu.Unlock()
+	m.wake()
+}
+
+// SetRetryPolicy 设置投递重试策略，需在 Start 之前调用
+func (m *NotifyManager) SetRetryPolicy(policy RetryPolicy) {
+	defaults := DefaultRetryPolicy()
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaults.MaxAttempts
+	}
+	if policy.SendTimeout <= 0 {
+		policy.SendTimeout = defaults.SendTimeout
+	}
+	if policy.PollInterval <= 0 {
+		policy.PollInterval = defaults.PollInterval
+	}
+	if policy.Workers <= 0 {
+		policy.Workers = defaults.Workers
+	}
+	m.mu.Lock()
+	m.policy = policy
+	m.mu.Unlock()
+}
+
+// AddNotifier 注册自定义投递渠道
+func (m *NotifyManager) AddNotifier(name string, notifier Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	m.custom[channelKey(name, notifier.Type())] = notifier
+	m.rebuildNotifiers()
+}
+
 // AddConfig 添加通知配置
 func (m *NotifyManager) AddConfig(config NotifyConfig) {
 	m.mu.Lock()
@@ -79,7 +166,7 @@ func (m *NotifyManager) AddConfig(config NotifyConfig) {
 	
 	// 检查是否已存在
 	for i, c := range m.configs {
-		if c.Name == config.Name && c.Type == config.Type {
+		if sameConfig(c, config) {
 			m.configs[i] = config
 			m.rebuildNotifiers()
 			return
@@ -104,6 +191,20 @@ func (m *NotifyManager) RemoveConfig(name string, t NotifyType) {
 	}
 }
 
+// RemoveConfigByID 移除数据库中保存的渠道配置
+func (m *NotifyManager) RemoveConfigByID(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	for i, c := range m.configs {
+		if c.ID == id {
+			m.configs = append(m.configs[:i], m.configs[i+1:]...)
+			m.rebuildNotifiers()
+			return
+		}
+	}
+}
+
 // GetConfigs 获取所有配置
 func (m *NotifyManager) GetConfigs() []NotifyConfig {
 	m.mu.RLock()
@@ -131,21 +232,49 @@ func (m *NotifyManager) EnableConfig(name string, t NotifyType, enabled bool) {
 // rebuildNotifiers 重建通知器列表
 func (m *NotifyManager) rebuildNotifiers() {
 	m.notifiers = make([]Notifier, 0)
+	m.channels = make(map[string]Notifier)
+	m.routes = make(map[string]channelRoute)
 	
 	for _, config := range m.configs {
 		if !config.Enabled {
 			continue
 		}
 		
-		notifier := m.createNotifier(config)
+		notifier, err := NewChannelNotifier(config)
+		if err != nil {
+			log.Printf("[Notify] Skipping channel %s (%s): %v", config.Name, config.Type, err)
+			continue
+		}
 		if notifier != nil {
+			key := configKey(config)
 			m.notifiers = append(m.notifiers, notifier)
+			m.channels[key] = notifier
+			m.routes[key] = channelRoute{name: config.Name, id: config.ID, notifyType: config.Type, workspaceID: config.WorkspaceID}
 		}
 	}
+	for key, notifier := range m.custom {
+		_, name, _ := strings.Cut(key, ":")
+		m.notifiers = append(m.notifiers, notifier)
+		m.channels[key] = notifier
+		m.routes[key] = channelRoute{name: name, notifyType: notifier.Type()}
+	}
+}
+
+// NewChannelNotifier 根据配置创建渠道，按配置的语言和模板渲染消息；缺少必填项时返回 nil
+func NewChannelNotifier(config NotifyConfig) (Notifier, error) {
+	renderer, err := NewMessageRenderer(config)
+	if err != nil {
+		return nil, err
+	}
+	notifier := createNotifier(config)
+	if notifier == nil {
+		return nil, nil
+	}
+	return &templateNotifier{Notifier: notifier, renderer: renderer}, nil
 }
 
 // createNotifier 根据配置创建通知器
-func (m *NotifyManager) createNotifier(config NotifyConfig) Notifier {
+func createNotifier(config NotifyConfig) Notifier {
 	switch config.Type {
 	case NotifyTypeDingTalk:
 		if config.DingTalkWebhook != "" {
@@ -174,14 +303,24 @@ func (m *NotifyManager) createNotifier(config NotifyConfig) Notifier {
 		if config.WebhookURL != "" {
 			return NewWebhookNotifier(config.WebhookURL, config.WebhookMethod, config.WebhookHeaders)
 		}
+	case NotifyTypeTelegram:
+		if config.TelegramBotToken != "" && config.TelegramChatID != "" {
+			return NewTelegramNotifier(config.TelegramBotToken, config.TelegramChatID, config.TelegramAPIURL)
+		}
 	}
 	return nil
 }
 
-// Send 发送通知（同步）
+// Send 发送通知（同步），失败时按 SyncRetryPolicy 重试；只发往接收消息所属工作空间的渠道
 func (m *NotifyManager) Send(ctx context.Context, msg *NotifyMessage) error {
+	workspaceID := extraString(msg, "workspace_id")
 	m.mu.RLock()
-	notifiers := m.notifiers
+	var notifiers []Notifier
+	for key, notifier := range m.channels {
+		if m.routes[key].accepts(workspaceID) {
+			notifiers = append(notifiers, NewRetryNotifier(notifier, SyncRetryPolicy()))
+		}
+	}
 	m.mu.RUnlock()
 	
 	if msg.Timestamp.IsZero() {
@@ -204,28 +343,200 @@ func (m *NotifyManager) Send(ctx context.Context, msg *NotifyMessage) error {
 
 // SendAsync 发送通知（异步）
 func (m *NotifyManager) SendAsync(msg *NotifyMessage) {
+	if _, err := m.Enqueue(msg); err != nil {
+		log.Printf("[Notify] Failed to enqueue message %s: %v", msg.Title, err)
+	}
+}
+
+// Enqueue 为每个启用的渠道写入一条待投递记录并唤醒投递协程，不等待发送
+// 消息附加信息中的 workspace_id、task_id 写入投递记录，用于按工作空间查询投递状态；
+// 属于某个工作空间的渠道只接收该工作空间的消息
+func (m *NotifyManager) Enqueue(msg *NotifyMessage) ([]*Delivery, error) {
 	if msg.Timestamp.IsZero() {
 		msg.Timestamp = time.Now()
 	}
+	workspaceID := extraString(msg, "workspace_id")
+	
+	m.mu.RLock()
+	store := m.store
+	keys := make([]string, 0, len(m.channels))
+	routes := make(map[string]channelRoute, len(m.routes))
+	for key := range m.channels {
+		if route := m.routes[key]; route.accepts(workspaceID) {
+			keys = append(keys, key)
+			routes[key] = route
+		}
+	}
+	m.mu.RUnlock()
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Strings(keys)
+	
+	now := time.Now()
+	deliveries := make([]*Delivery, 0, len(keys))
+	for _, key := range keys {
+		route := routes[key]
+		deliveries = append(deliveries, &Delivery{
+			ID:            newDeliveryID(),
+			WorkspaceID:   workspaceID,
+			TaskID:        extraString(msg, "task_id"),
+			Channel:       route.name,
+			ChannelID:     route.id,
+			ChannelType:   route.notifyType,
+			Message:       msg,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
 	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.InsertDeliveries(ctx, deliveries); err != nil {
+		return nil, err
+	}
+	m.wake()
+	return deliveries, nil
+}
+
+// Deliveries 查询最近的投递记录
+func (m *NotifyManager) Deliveries(ctx context.Context, filter DeliveryFilter) ([]*Delivery, error) {
+	m.mu.RLock()
+	store := m.store
+	m.mu.RUnlock()
+	return store.RecentDeliveries(ctx, filter)
+}
+
+// wake 唤醒投递协程，已有未处理的唤醒时直接返回
+func (m *NotifyManager) wake() {
 	select {
-	case m.queue <- msg:
+	case m.wakeCh <- struct{}{}:
 	default:
-		log.Printf("[Notify] Queue full, dropping message: %s", msg.Title)
 	}
 }
 
-// processQueue 处理消息队列
-func (m *NotifyManager) processQueue() {
+// dispatchLoop 投递协程：被唤醒或定时扫描到期的待投递记录
+func (m *NotifyManager) dispatchLoop() {
+	m.mu.RLock()
+	interval := m.policy.PollInterval
+	m.mu.RUnlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	
+	m.dispatchDue()
 	for {
 		select {
 		case <-m.stopCh:
 			return
-		case msg := <-m.queue:
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			m.Send(ctx, msg)
-			cancel()
+		case <-m.wakeCh:
+			m.dispatchDue()
+		case <-ticker.C:
+			m.dispatchDue()
+		}
+	}
+}
+
+// dispatchDue 发送到期的待投递记录，每条记录同一时刻只有一个发送
+func (m *NotifyManager) dispatchDue() {
+	const batch = 100
+	
+	m.mu.RLock()
+	store := m.store
+	m.mu.RUnlock()
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	due, err := store.PendingDeliveries(ctx, time.Now(), batch)
+	cancel()
+	if err != nil {
+		log.Printf("[Notify] Failed to load pending deliveries: %v", err)
+		return
+	}
+	
+	for _, d := range due {
+		if !m.claim(d.ID) {
+			continue
+		}
+		select {
+		case m.workers <- struct{}{}:
+		case <-m.stopCh:
+			m.unclaim(d.ID)
+			return
+		}
+		go func(d *Delivery) {
+			defer func() {
+				<-m.workers
+				m.unclaim(d.ID)
+			}()
+			m.deliver(store, d)
+		}(d)
+	}
+	if len(due) == batch {
+		m.wake()
+	}
+}
+
+// claim 标记投递记录正在发送
+func (m *NotifyManager) claim(id string) bool {
+	m.inflightMu.Lock()
+	defer m.inflightMu.Unlock()
+	if m.inflight[id] {
+		return false
+	}
+	m.inflight[id] = true
+	return true
+}
+
+func (m *NotifyManager) unclaim(id string) {
+	m.inflightMu.Lock()
+	delete(m.inflight, id)
+	m.inflightMu.Unlock()
+}
+
+// deliver 发送一条投递记录并保存结果
+// 渠道不存在（被删除、禁用或重启后尚未加载）按发送失败处理，渠道恢复后重试仍可送达
+func (m *NotifyManager) deliver(store DeliveryStore, d *Delivery) {
+	key := channelKey(d.Channel, d.ChannelType)
+	if d.ChannelID != "" {
+		key = channelKey(d.ChannelID, d.ChannelType)
+	}
+	m.mu.RLock()
+	notifier := m.channels[key]
+	policy := m.policy
+	m.mu.RUnlock()
+	
+	var err error
+	if notifier == nil {
+		err = fmt.Errorf("channel %s (%s) not found or disabled", d.Channel, d.ChannelType)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), policy.SendTimeout)
+		err = notifier.Send(ctx, d.Message)
+		cancel()
+	}
+	
+	now := time.Now()
+	d.Attempts++
+	d.UpdatedAt = now
+	if err == nil {
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = &now
+		m.addHistory(d.Message, d.ChannelType, "success", "")
+	} else {
+		d.LastError = err.Error()
+		if d.Attempts >= policy.MaxAttempts {
+			d.Status = DeliveryFailed
+		} else {
+			d.NextAttemptAt = now.Add(policy.backoff(d.Attempts))
 		}
+		log.Printf("[Notify] Failed to send via %s (%s), attempt %d/%d: %v", d.Channel, d.ChannelType, d.Attempts, policy.MaxAttempts, err)
+		m.addHistory(d.Message, d.ChannelType, "failed", err.Error())
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.UpdateDelivery(ctx, d); err != nil {
+		log.Printf("[Notify] Failed to update delivery %s: %v", d.ID, err)
 	}
 }
 
@@ -277,14 +588,18 @@ func (m *NotifyManager) GetHistory(limit int) []*NotifyHistory {
 	return result
 }
 
-// TestNotifier 测试通知器
+// TestNotifier 测试通知器，消息按配置的语言和模板渲染，失败时按 SyncRetryPolicy 重试
 func (m *NotifyManager) TestNotifier(config NotifyConfig) error {
-	notifier := m.createNotifier(config)
+	notifier, err := NewChannelNotifier(config)
+	if err != nil {
+		return err
+	}
 	if notifier == nil {
-		return nil
+		return fmt.Errorf("channel %s (%s) is missing required fields", config.Name, config.Type)
 	}
 	
 	msg := &NotifyMessage{
+		Event:     EventTest,
 		Level:     NotifyLevelInfo,
 		Title:     "测试通知",
 		Content:   "这是一条来自 Moon Gazing Tower 的测试通知消息。\n\n如果您收到此消息，说明通知配置正确。",
@@ -295,7 +610,7 @@ func (m *NotifyManager) TestNotifier(config NotifyConfig) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
-	return notifier.Send(ctx, msg)
+	return NewRetryNotifier(notifier, SyncRetryPolicy()).Send(ctx, msg)
 }
 
 // NotifyVulnerability 发送漏洞通知
@@ -309,6 +624,7 @@ func (m *NotifyManager) NotifyVulnerability(vulnName, target, severity, details
 	}
 	
 	msg := &NotifyMessage{
+		Event:     EventVulnerability,
 		Level:     level,
 		Title:     "发现漏洞: " + vulnName,
 		Content:   fmt.Sprintf("**目标**: %s\n**严重程度**: %s\n\n%s", target, severity, details),
@@ -325,25 +641,56 @@ func (m *NotifyManager) NotifyVulnerability(vulnName, target, severity, details
 }
 
 // NotifyTaskComplete 发送任务完成通知
-func (m *NotifyManager) NotifyTaskComplete(taskName string, taskID string, success bool, summary string, stats map[string]interface{}) {
+func (m *NotifyManager) NotifyTaskComplete(workspaceID, taskName, taskID string, success bool, summary string, stats map[string]interface{}) {
 	level := NotifyLevelInfo
+	event := EventTaskCompleted
 	title := "✅ 扫描完成: " + taskName
 	if !success {
 		level = NotifyLevelWarning
+		event = EventTaskFailed
 		title = "❌ 扫描失败: " + taskName
 	}
 
 	msg := &NotifyMessage{
+		Event:     event,
 		Level:     level,
 		Title:     title,
 		Content:   summary,
 		Source:    "task_manager",
 		Timestamp: time.Now(),
 		Extra: map[string]interface{}{
-			"task_name": taskName,
-			"task_id":   taskID,
-			"success":   success,
-			"stats":     stats,
+			"workspace_id": workspaceID,
+			"task_name":    taskName,
+			"task_id":      taskID,
+			"success":      success,
+			"stats":        stats,
+		},
+	}
+
+	m.SendAsync(msg)
+}
+
+// NotifyTaskOverrun 发送任务即将超时通知
+func (m *NotifyManager) NotifyTaskOverrun(workspaceID, taskName, taskID string, elapsed, limit time.Duration, currentModule string) {
+	content := fmt.Sprintf("任务已运行 %s，时间上限 %s", elapsed.Round(time.Second), limit)
+	if currentModule != "" {
+		content += fmt.Sprintf("\n当前模块: %s", currentModule)
+	}
+
+	msg := &NotifyMessage{
+		Event:     EventTaskOverrun,
+		Level:     NotifyLevelWarning,
+		Title:     "⏰ 任务即将超时: " + taskName,
+		Content:   content,
+		Source:    "task_manager",
+		Timestamp: time.Now(),
+		Extra: map[string]interface{}{
+			"workspace_id":   workspaceID,
+			"task_name":      taskName,
+			"task_id":        taskID,
+			"elapsed":        elapsed.String(),
+			"time_limit":     limit.String(),
+			"current_module": currentModule,
 		},
 	}
 
@@ -353,6 +700,7 @@ func (m *NotifyManager) NotifyTaskComplete(taskName string, taskID string, succe
 // NotifyAssetChange 发送资产变更通知
 func (m *NotifyManager) NotifyAssetChange(changeType, assetInfo string) {
 	msg := &NotifyMessage{
+		Event:     EventAssetChange,
 		Level:     NotifyLevelInfo,
 		Title:     "资产变更: " + changeType,
 		Content:   assetInfo,
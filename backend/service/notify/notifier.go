@@ -23,6 +23,7 @@ const (
 	NotifyTypeWechat   NotifyType = "wechat"
 	NotifyTypeEmail    NotifyType = "email"
 	NotifyTypeWebhook  NotifyType = "webhook"
+	NotifyTypeTelegram NotifyType = "telegram"
 )
 
 // NotifyLevel 通知级别
@@ -34,8 +35,20 @@ const (
 	NotifyLevelCritical NotifyLevel = "critical"
 )
 
+// 通知事件，渲染消息模板时用于区分消息
+const (
+	EventTaskCompleted = "task_completed"
+	EventTaskFailed    = "task_failed"
+	EventTaskOverrun   = "task_overrun"
+	EventFinding       = "finding"
+	EventVulnerability = "vulnerability"
+	EventAssetChange   = "asset_change"
+	EventTest          = "test"
+)
+
 // NotifyMessage 通知消息
 type NotifyMessage struct {
+	Event     string                 `json:"event,omitempty"` // 通知事件，见 EventTaskCompleted 等
 	Level     NotifyLevel            `json:"level"`
 	Title     string                 `json:"title"`
 	Content   string                 `json:"content"`
@@ -46,9 +59,16 @@ type NotifyMessage struct {
 
 // NotifyConfig 通知配置
 type NotifyConfig struct {
-	Type      NotifyType `json:"type"`
-	Enabled   bool       `json:"enabled"`
-	Name      string     `json:"name"`
+	ID          string     `json:"id,omitempty"` // 数据库中保存的渠道ID，仅通过 /notify/channels 管理的渠道有
+	WorkspaceID string     `json:"workspace_id,omitempty"` // 所属工作空间，为空时接收所有工作空间的通知
+	Type        NotifyType `json:"type"`
+	Enabled     bool       `json:"enabled"`
+	Name        string     `json:"name"`
+	
+	// 消息模板（text/template，字段见 TemplateData），为空时使用 Language 对应的内置模板
+	Language        string `json:"language,omitempty"` // 消息语言：zh（默认）、en
+	TitleTemplate   string `json:"title_template,omitempty"`
+	ContentTemplate string `json:"content_template,omitempty"`
 	
 	// DingTalk
 	DingTalkWebhook string `json:"dingtalk_webhook,omitempty"`
@@ -73,6 +93,11 @@ type NotifyConfig struct {
 	WebhookURL     string            `json:"webhook_url,omitempty"`
 	WebhookMethod  string            `json:"webhook_method,omitempty"`
 	WebhookHeaders map[string]string `json:"webhook_headers,omitempty"`
+	
+	// Telegram
+	TelegramBotToken string `json:"telegram_bot_token,omitempty"`
+	TelegramChatID   string `json:"telegram_chat_id,omitempty"`
+	TelegramAPIURL   string `json:"telegram_api_url,omitempty"` // Bot API 地址，为空时使用 https://api.telegram.org
 }
 
 // Notifier 通知器接口
@@ -106,9 +131,11 @@ func (n *DingTalkNotifier) Send(ctx context.Context, msg *NotifyMessage) error {
 	
 	// 如果有签名密钥，添加签名
 	if n.secret != "" {
-		timestamp := time.Now().UnixMilli()
-		sign := n.sign(timestamp)
-		webhook = fmt.Sprintf("%s&timestamp=%d&sign=%s", webhook, timestamp, url.QueryEscape(sign))
+		signed, err := n.signedURL(time.Now().UnixMilli())
+		if err != nil {
+			return err
+		}
+		webhook = signed
 	}
 	
 	// 构建消息
@@ -126,6 +153,24 @@ func (n *DingTalkNotifier) Send(ctx context.Context, msg *NotifyMessage) error {
 	return n.post(ctx, webhook, payload)
 }
 
+// signedURL 在 Webhook 地址上附加签名参数（timestamp、sign）
+func (n *DingTalkNotifier) signedURL(timestamp int64) (string, error) {
+	u, err := url.Parse(n.webhook)
+	if err != nil {
+		return "", fmt.Errorf("invalid dingtalk webhook: %v", err)
+	}
+	query := u.Query()
+	query.Set("timestamp", fmt.Sprintf("%d", timestamp))
+	query.Set("sign", n.sign(timestamp))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// DingTalkSign 钉钉加签：以密钥对 "timestamp\nsecret" 做 HmacSHA256 后 Base64 编码
+func DingTalkSign(timestamp int64, secret string) string {
+	return NewDingTalkNotifier("", secret).sign(timestamp)
+}
+
 func (n *DingTalkNotifier) sign(timestamp int64) string {
 	stringToSign := fmt.Sprintf("%d\n%s", timestamp, n.secret)
 	h := hmac.New(sha256.New, []byte(n.secret))
@@ -152,6 +197,15 @@ func (n *DingTalkNotifier) post(ctx context.Context, url string, payload interfa
 		return fmt.Errorf("dingtalk error: %s", string(respBody))
 	}
 	
+	// 签名错误、关键词不匹配等情况同样返回 200，错误码在响应中
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk error: errcode=%d, errmsg=%s", result.ErrCode, result.ErrMsg)
+	}
+	
 	return nil
 }
 
@@ -276,6 +330,15 @@ func (n *FeishuNotifier) post(ctx context.Context, url string, payload interface
 		return fmt.Errorf("feishu error: %s", string(respBody))
 	}
 	
+	// 签名校验失败等情况同样返回 200，错误码在响应中
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.Code != 0 {
+		return fmt.Errorf("feishu error: code=%d, msg=%s", result.Code, result.Msg)
+	}
+	
 	return nil
 }
 
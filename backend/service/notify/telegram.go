@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultTelegramAPIURL Telegram Bot API 地址
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// telegramMessageLimit 单条消息的最大长度（字符）
+const telegramMessageLimit = 4096
+
+// TelegramNotifier Telegram 机器人通知
+type TelegramNotifier struct {
+	apiURL string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+// NewTelegramNotifier 创建 Telegram 通知器，apiURL 为空时使用官方 Bot API
+func NewTelegramNotifier(token, chatID, apiURL string) *TelegramNotifier {
+	if apiURL == "" {
+		apiURL = DefaultTelegramAPIURL
+	}
+	return &TelegramNotifier{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+		chatID: chatID,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *TelegramNotifier) Type() NotifyType {
+	return NotifyTypeTelegram
+}
+
+// Send 通过 sendMessage 发送纯文本消息，不使用 parse_mode，避免标题和正文中的 Markdown 字符导致发送失败
+func (n *TelegramNotifier) Send(ctx context.Context, msg *NotifyMessage) error {
+	text := fmt.Sprintf("%s\n\n%s", msg.Title, msg.Content)
+	if runes := []rune(text); len(runes) > telegramMessageLimit {
+		text = string(runes[:telegramMessageLimit-3]) + "..."
+	}
+	payload := map[string]interface{}{
+		"chat_id":                  n.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}
+
+	body, _ := json.Marshal(payload)
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", n.apiURL, n.token)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// 请求地址中包含 bot token，不在错误中输出
+		return fmt.Errorf("telegram request failed: %v", redactToken(err.Error(), n.token))
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil || resp.StatusCode != 200 || !result.OK {
+		if result.Description != "" {
+			return fmt.Errorf("telegram error: status=%d, %s", resp.StatusCode, result.Description)
+		}
+		return fmt.Errorf("telegram error: status=%d, body=%s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// redactToken 隐藏错误信息中的 bot token
+func redactToken(s, token string) string {
+	if token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, token, "****")
+}
@@ -0,0 +1,308 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 消息模板
+// 渠道可以选择消息语言（zh、en），也可以用 text/template 自定义标题和正文。
+// 中文内置模板即消息本身的标题和正文；英文内置模板按事件类型重新生成，未覆盖的事件保留原消息
+
+// 消息语言
+const (
+	LanguageZh = "zh"
+	LanguageEn = "en"
+)
+
+// TemplateData 消息模板可用的字段
+type TemplateData struct {
+	Event       string // 通知事件，见 EventTaskCompleted 等
+	Level       string // 通知级别：info、warning、error、critical
+	Title       string // 原消息标题
+	Content     string // 原消息正文
+	Source      string
+	Time        string // 发送时间，2006-01-02 15:04:05
+	WorkspaceID string
+	TaskID      string
+	TaskName    string
+	TaskLink    string
+	Targets     []string       // 任务目标，漏洞通知为漏洞目标
+	Counts      map[string]int // 结果数量等统计，如 .Counts.result_count
+	Severity    string
+	Target      string
+	VulnName    string
+	Error       string // 任务失败原因
+	Extra       map[string]interface{}
+}
+
+// Field 读取附加信息中的字段并转为字符串，不存在时为空，如 {{.Field "vuln_id"}}
+func (d TemplateData) Field(key string) string {
+	if v, ok := d.Extra[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// NewTemplateData 从通知消息中提取模板字段
+func NewTemplateData(msg *NotifyMessage) TemplateData {
+	data := TemplateData{
+		Event:       msg.Event,
+		Level:       string(msg.Level),
+		Title:       msg.Title,
+		Content:     msg.Content,
+		Source:      msg.Source,
+		Time:        msg.Timestamp.Format("2006-01-02 15:04:05"),
+		WorkspaceID: extraString(msg, "workspace_id"),
+		TaskID:      extraString(msg, "task_id"),
+		TaskName:    extraString(msg, "task_name"),
+		TaskLink:    extraString(msg, "task_link"),
+		Severity:    extraString(msg, "severity"),
+		Target:      extraString(msg, "target"),
+		VulnName:    extraString(msg, "vuln_name"),
+		Counts:      make(map[string]int),
+		Extra:       msg.Extra,
+	}
+	if data.Extra == nil {
+		data.Extra = map[string]interface{}{}
+	}
+	if data.TaskLink == "" && data.TaskID != "" {
+		data.TaskLink = "/tasks/" + data.TaskID
+	}
+
+	// 任务通知的统计在 stats 中，从数据库读出的投递记录为 bson 文档，按反射读取
+	stats := mapValue(msg.Extra["stats"])
+	for _, source := range []map[string]interface{}{stats, mapValue(msg.Extra["counts"])} {
+		for k, v := range source {
+			if n, ok := intValue(v); ok {
+				data.Counts[k] = n
+			}
+		}
+	}
+	data.Targets = stringValues(msg.Extra["targets"])
+	if len(data.Targets) == 0 {
+		data.Targets = stringValues(stats["targets"])
+	}
+	if len(data.Targets) == 0 && data.Target != "" {
+		data.Targets = []string{data.Target}
+	}
+	if s, ok := stats["error"].(string); ok {
+		data.Error = s
+	}
+	return data
+}
+
+// mapValue 读取文档类型的字段
+func mapValue(v interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	m := make(map[string]interface{}, rv.Len())
+	for _, key := range rv.MapKeys() {
+		m[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return m
+}
+
+// stringValues 读取字符串数组字段
+func stringValues(v interface{}) []string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	var values []string
+	for i := 0; i < rv.Len(); i++ {
+		if s, ok := rv.Index(i).Interface().(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// intValue 读取整数字段，从数据库读出的数字为 int32/int64
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// messageTemplate 标题和正文模板
+type messageTemplate struct {
+	title   string
+	content string
+}
+
+// englishTemplates 英文内置模板
+var englishTemplates = map[string]messageTemplate{
+	EventTaskCompleted: {
+		title:   "✅ Scan completed: {{.TaskName}}",
+		content: "Task {{.TaskName}} completed\nTargets: {{join .Targets \", \"}}\nResults: {{.Counts.result_count}}",
+	},
+	EventTaskFailed: {
+		title:   "❌ Scan failed: {{.TaskName}}",
+		content: "Task {{.TaskName}} failed\nTargets: {{join .Targets \", \"}}\nError: {{.Error}}",
+	},
+	EventTaskOverrun: {
+		title:   "⏰ Task about to time out: {{.TaskName}}",
+		content: "Running for {{.Field \"elapsed\"}}, time limit {{.Field \"time_limit\"}}{{with .Field \"current_module\"}}\nCurrent module: {{.}}{{end}}",
+	},
+	EventFinding: {
+		title:   "🚨 {{upper .Severity}} finding: {{.VulnName}}",
+		content: "**Task**: {{.TaskName}}\n**Target**: {{.Target}}\n**Severity**: {{.Severity}}{{with .Field \"vuln_id\"}}\n**Vuln ID**: {{.}}{{end}}{{with .Field \"evidence\"}}\n\n{{.}}{{end}}\n\nTask details: {{.TaskLink}}",
+	},
+	EventVulnerability: {
+		title:   "Vulnerability found: {{.VulnName}}",
+		content: "**Target**: {{.Target}}\n**Severity**: {{.Severity}}",
+	},
+	EventTest: {
+		title:   "Test notification",
+		content: "This is a test notification from Moon Gazing Tower.\n\nIf you received it, the channel is configured correctly.",
+	},
+}
+
+// templateFuncs 模板函数
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// MessageRenderer 按渠道的语言和自定义模板渲染消息
+type MessageRenderer struct {
+	language string
+	title    *template.Template
+	content  *template.Template
+	builtin  map[string][2]*template.Template
+}
+
+// NewMessageRenderer 解析渠道的消息模板
+func NewMessageRenderer(config NotifyConfig) (*MessageRenderer, error) {
+	r := &MessageRenderer{language: config.Language}
+	switch r.language {
+	case "":
+		r.language = LanguageZh
+	case LanguageZh, LanguageEn:
+	default:
+		return nil, fmt.Errorf("language must be %s or %s", LanguageZh, LanguageEn)
+	}
+
+	var err error
+	if r.title, err = parseTemplate("title", config.TitleTemplate); err != nil {
+		return nil, err
+	}
+	if r.content, err = parseTemplate("content", config.ContentTemplate); err != nil {
+		return nil, err
+	}
+	if r.language == LanguageEn {
+		r.builtin = make(map[string][2]*template.Template, len(englishTemplates))
+		for event, t := range englishTemplates {
+			title, _ := parseTemplate(event+".title", t.title)
+			content, _ := parseTemplate(event+".content", t.content)
+			r.builtin[event] = [2]*template.Template{title, content}
+		}
+	}
+
+	// 用示例数据执行一次，字段名或函数写错时在保存配置时报告
+	if _, err := r.Render(sampleMessage()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseTemplate 解析模板，text 为空时返回 nil
+func parseTemplate(name, text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	return t, nil
+}
+
+// Render 渲染消息的标题和正文，返回新的消息，不修改原消息
+func (r *MessageRenderer) Render(msg *NotifyMessage) (*NotifyMessage, error) {
+	title, content := r.title, r.content
+	if builtin, ok := r.builtin[msg.Event]; ok {
+		if title == nil {
+			title = builtin[0]
+		}
+		if content == nil {
+			content = builtin[1]
+		}
+	}
+	if title == nil && content == nil {
+		return msg, nil
+	}
+
+	data := NewTemplateData(msg)
+	rendered := *msg
+	if title != nil {
+		s, err := executeTemplate(title, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered.Title = s
+	}
+	if content != nil {
+		s, err := executeTemplate(content, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered.Content = s
+	}
+	return &rendered, nil
+}
+
+func executeTemplate(t *template.Template, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render %s template: %v", t.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// sampleMessage 校验模板使用的示例消息
+func sampleMessage() *NotifyMessage {
+	return &NotifyMessage{
+		Event:     EventTaskCompleted,
+		Level:     NotifyLevelInfo,
+		Title:     "✅ 扫描完成: example",
+		Content:   "扫描任务已完成",
+		Source:    "task_manager",
+		Timestamp: time.Now(),
+		Extra: map[string]interface{}{
+			"task_name": "example",
+			"task_id":   "000000000000000000000000",
+			"stats":     map[string]interface{}{"result_count": 1, "targets": []string{"example.com"}},
+		},
+	}
+}
+
+// templateNotifier 发送前按模板渲染消息的渠道
+type templateNotifier struct {
+	Notifier
+	renderer *MessageRenderer
+}
+
+func (n *templateNotifier) Send(ctx context.Context, msg *NotifyMessage) error {
+	rendered, err := n.renderer.Render(msg)
+	if err != nil {
+		return err
+	}
+	return n.Notifier.Send(ctx, rendered)
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/config"
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/notify"
+	"moongazing/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 通知渠道配置
+// 渠道按工作空间保存在数据库中，Webhook 地址、签名密钥、bot token 等整份配置加密后写入 config 字段，
+// 只有名称、类型、工作空间和启用状态以明文保存用于查询。启动时全部加载到全局通知管理器
+
+// ErrNotifyChannelNotFound 渠道不存在
+var ErrNotifyChannelNotFound = errors.New("通知渠道不存在")
+
+// NotifyChannelRecord 数据库中的渠道配置
+type NotifyChannelRecord struct {
+	ID          string            `bson:"_id"`
+	WorkspaceID string            `bson:"workspace_id"`
+	Name        string            `bson:"name"`
+	Type        notify.NotifyType `bson:"type"`
+	Enabled     bool              `bson:"enabled"`
+	Config      string            `bson:"config"` // 加密的 NotifyConfig JSON
+	UpdatedAt   time.Time         `bson:"updated_at"`
+}
+
+// SealNotifyChannel 加密渠道配置
+func SealNotifyChannel(cfg *notify.NotifyConfig, key []byte) (*NotifyChannelRecord, error) {
+	plain, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := utils.EncryptAESGCM(key, plain)
+	if err != nil {
+		return nil, err
+	}
+	return &NotifyChannelRecord{
+		ID:          cfg.ID,
+		WorkspaceID: cfg.WorkspaceID,
+		Name:        cfg.Name,
+		Type:        cfg.Type,
+		Enabled:     cfg.Enabled,
+		Config:      sealed,
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
+// Open 解密渠道配置，ID、工作空间、名称和启用状态以记录为准
+func (r *NotifyChannelRecord) Open(key []byte) (*notify.NotifyConfig, error) {
+	plain, err := utils.DecryptAESGCM(key, r.Config)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt notify channel %s: %v", r.ID, err)
+	}
+	var cfg notify.NotifyConfig
+	if err := json.Unmarshal(plain, &cfg); err != nil {
+		return nil, err
+	}
+	cfg.ID = r.ID
+	cfg.WorkspaceID = r.WorkspaceID
+	cfg.Name = r.Name
+	cfg.Type = r.Type
+	cfg.Enabled = r.Enabled
+	return &cfg, nil
+}
+
+// NotifyChannelKey 渠道配置的加密密钥，取 alert.secret_key，未配置时使用 jwt.secret
+func NotifyChannelKey() []byte {
+	cfg := config.GetConfig()
+	secret := cfg.Alert.SecretKey
+	if secret == "" {
+		secret = cfg.JWT.Secret
+	}
+	return utils.DeriveKey(secret)
+}
+
+// NotifyChannelStore 通知渠道配置存储
+type NotifyChannelStore interface {
+	// ListChannels 全部渠道，workspaceID 非空时只返回该工作空间的渠道
+	ListChannels(ctx context.Context, workspaceID *string) ([]*notify.NotifyConfig, error)
+	// GetChannel 按ID读取渠道，不存在时返回 ErrNotifyChannelNotFound
+	GetChannel(ctx context.Context, id string) (*notify.NotifyConfig, error)
+	SaveChannel(ctx context.Context, cfg *notify.NotifyConfig) error
+	DeleteChannel(ctx context.Context, id string) error
+}
+
+// NotifyChannelService 渠道配置的增删改查，保存后同步到通知管理器
+type NotifyChannelService struct {
+	store   NotifyChannelStore
+	manager *notify.NotifyManager
+}
+
+// NewNotifyChannelService 创建渠道配置服务
+func NewNotifyChannelService(store NotifyChannelStore, manager *notify.NotifyManager) *NotifyChannelService {
+	return &NotifyChannelService{store: store, manager: manager}
+}
+
+// InitNotifyChannels 将数据库中的渠道加载到全局通知管理器
+func InitNotifyChannels() {
+	svc := NewNotifyChannelService(NewMongoNotifyChannelStore(NotifyChannelKey()), notify.GetGlobalManager())
+	n, err := svc.Load()
+	if err != nil {
+		log.Printf("[Notify] Failed to load notify channels: %v", err)
+		return
+	}
+	log.Printf("[Notify] Loaded %d notify channels", n)
+}
+
+// Load 加载全部渠道到通知管理器，返回加载的渠道数
+func (s *NotifyChannelService) Load() (int, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	channels, err := s.store.ListChannels(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, cfg := range channels {
+		s.manager.AddConfig(*cfg)
+	}
+	return len(channels), nil
+}
+
+// List 工作空间的渠道，workspaceID 为空时为全局渠道
+func (s *NotifyChannelService) List(workspaceID string) ([]*notify.NotifyConfig, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.ListChannels(ctx, &workspaceID)
+}
+
+// Get 按ID读取渠道
+func (s *NotifyChannelService) Get(id string) (*notify.NotifyConfig, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.GetChannel(ctx, id)
+}
+
+// Create 校验并保存新渠道
+func (s *NotifyChannelService) Create(cfg *notify.NotifyConfig) error {
+	cfg.ID = primitive.NewObjectID().Hex()
+	return s.save(cfg)
+}
+
+// Update 更新渠道，未修改的敏感字段（提交的仍是脱敏值）保留原值；渠道所属工作空间不变
+func (s *NotifyChannelService) Update(id string, cfg *notify.NotifyConfig) error {
+	old, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	cfg.ID = old.ID
+	cfg.WorkspaceID = old.WorkspaceID
+	cfg.KeepSecrets(*old)
+	return s.save(cfg)
+}
+
+func (s *NotifyChannelService) save(cfg *notify.NotifyConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := s.store.SaveChannel(ctx, cfg); err != nil {
+		return err
+	}
+	s.manager.AddConfig(*cfg)
+	return nil
+}
+
+// Delete 删除渠道
+func (s *NotifyChannelService) Delete(id string) error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := s.store.DeleteChannel(ctx, id); err != nil {
+		return err
+	}
+	s.manager.RemoveConfigByID(id)
+	return nil
+}
+
+// Test 通过已保存的渠道发送测试消息，禁用的渠道同样发送
+func (s *NotifyChannelService) Test(id string) error {
+	cfg, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	cfg.Enabled = true
+	return s.manager.TestNotifier(*cfg)
+}
+
+// mongoNotifyChannelStore 渠道配置的数据库存储
+type mongoNotifyChannelStore struct {
+	key []byte
+}
+
+// NewMongoNotifyChannelStore 创建数据库渠道存储，key 为配置的加密密钥
+func NewMongoNotifyChannelStore(key []byte) NotifyChannelStore {
+	return &mongoNotifyChannelStore{key: key}
+}
+
+func (s *mongoNotifyChannelStore) ListChannels(ctx context.Context, workspaceID *string) ([]*notify.NotifyConfig, error) {
+	filter := bson.M{}
+	if workspaceID != nil {
+		filter["workspace_id"] = *workspaceID
+	}
+	cursor, err := database.GetCollection(models.CollectionNotifyChannels).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var channels []*notify.NotifyConfig
+	for cursor.Next(ctx) {
+		var record NotifyChannelRecord
+		if err := cursor.Decode(&record); err != nil {
+			return nil, err
+		}
+		cfg, err := record.Open(s.key)
+		if err != nil {
+			// 密钥变更后旧配置无法解密，跳过并提示重新配置
+			log.Printf("[Notify] Skipping notify channel %s (%s): %v", record.Name, record.Type, err)
+			continue
+		}
+		channels = append(channels, cfg)
+	}
+	return channels, cursor.Err()
+}
+
+func (s *mongoNotifyChannelStore) GetChannel(ctx context.Context, id string) (*notify.NotifyConfig, error) {
+	var record NotifyChannelRecord
+	err := database.GetCollection(models.CollectionNotifyChannels).FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotifyChannelNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.Open(s.key)
+}
+
+func (s *mongoNotifyChannelStore) SaveChannel(ctx context.Context, cfg *notify.NotifyConfig) error {
+	record, err := SealNotifyChannel(cfg, s.key)
+	if err != nil {
+		return err
+	}
+	_, err = database.GetCollection(models.CollectionNotifyChannels).ReplaceOne(ctx,
+		bson.M{"_id": record.ID}, record, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoNotifyChannelStore) DeleteChannel(ctx context.Context, id string) error {
+	res, err := database.GetCollection(models.CollectionNotifyChannels).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotifyChannelNotFound
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/notify"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDeliveryStore 通知投递记录的数据库存储，重启后未完成的投递可继续发送
+type mongoDeliveryStore struct{}
+
+// NewMongoDeliveryStore 创建数据库投递存储
+func NewMongoDeliveryStore() notify.DeliveryStore {
+	return &mongoDeliveryStore{}
+}
+
+// InitNotifyDelivery 全局通知管理器改用数据库投递存储，并重新发送上次退出时未完成的投递
+func InitNotifyDelivery() {
+	notify.GetGlobalManager().SetDeliveryStore(NewMongoDeliveryStore())
+}
+
+func (s *mongoDeliveryStore) InsertDeliveries(ctx context.Context, deliveries []*notify.Delivery) error {
+	docs := make([]interface{}, 0, len(deliveries))
+	for _, d := range deliveries {
+		docs = append(docs, d)
+	}
+	_, err := database.GetCollection(models.CollectionNotifyDeliveries).InsertMany(ctx, docs)
+	return err
+}
+
+func (s *mongoDeliveryStore) UpdateDelivery(ctx context.Context, d *notify.Delivery) error {
+	_, err := database.GetCollection(models.CollectionNotifyDeliveries).UpdateOne(ctx,
+		bson.M{"_id": d.ID},
+		bson.M{"$set": bson.M{
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"last_error":      d.LastError,
+			"next_attempt_at": d.NextAttemptAt,
+			"updated_at":      d.UpdatedAt,
+			"delivered_at":    d.DeliveredAt,
+		}},
+	)
+	return err
+}
+
+func (s *mongoDeliveryStore) PendingDeliveries(ctx context.Context, before time.Time, limit int) ([]*notify.Delivery, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit))
+	return s.find(ctx, bson.M{
+		"status":          notify.DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": before},
+	}, opts)
+}
+
+func (s *mongoDeliveryStore) RecentDeliveries(ctx context.Context, filter notify.DeliveryFilter) ([]*notify.Delivery, error) {
+	query := bson.M{}
+	if filter.WorkspaceID != "" {
+		query["workspace_id"] = filter.WorkspaceID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	return s.find(ctx, query, opts)
+}
+
+func (s *mongoDeliveryStore) find(ctx context.Context, query bson.M, opts *options.FindOptions) ([]*notify.Delivery, error) {
+	cursor, err := database.GetCollection(models.CollectionNotifyDeliveries).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := make([]*notify.Delivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/notify"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindingRuleStore 漏洞即时通知规则存储，每个工作空间一条
+type FindingRuleStore interface {
+	// GetFindingRule 工作空间的规则，未配置时返回 nil
+	GetFindingRule(ctx context.Context, workspaceID string) (*notify.FindingRule, error)
+	SaveFindingRule(ctx context.Context, rule *notify.FindingRule) error
+}
+
+// LoadFindingRule 读取工作空间的规则，未配置或读取失败时使用默认规则
+func LoadFindingRule(store FindingRuleStore, workspaceID string) *notify.FindingRule {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	rule, err := store.GetFindingRule(ctx, workspaceID)
+	if err != nil {
+		log.Printf("[Notify] Failed to load finding rule of workspace %s, using default: %v", workspaceID, err)
+	}
+	if rule == nil {
+		return notify.DefaultFindingRule(workspaceID)
+	}
+	return rule
+}
+
+// SaveFindingRule 校验并保存工作空间的规则
+func SaveFindingRule(store FindingRuleStore, rule *notify.FindingRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	rule.UpdatedAt = time.Now()
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return store.SaveFindingRule(ctx, rule)
+}
+
+// FindingAlerter 任务运行中保存的漏洞按规则立即通知
+type FindingAlerter struct {
+	task     *models.Task
+	manager  *notify.NotifyManager
+	throttle *notify.FindingThrottle
+}
+
+// NewFindingAlerter 创建任务的漏洞通知器
+func NewFindingAlerter(task *models.Task, rule *notify.FindingRule, manager *notify.NotifyManager) *FindingAlerter {
+	return &FindingAlerter{
+		task:     task,
+		manager:  manager,
+		throttle: notify.NewFindingThrottle(rule),
+	}
+}
+
+// Throttle 任务的通知限流器
+func (a *FindingAlerter) Throttle() *notify.FindingThrottle {
+	return a.throttle
+}
+
+// Record 已保存的漏洞结果达到规则时发送通知，其他结果类型忽略
+func (a *FindingAlerter) Record(result *models.ScanResult) {
+	if a == nil || result.Type != models.ResultTypeVuln {
+		return
+	}
+	finding := notify.Finding{
+		WorkspaceID: a.task.WorkspaceID.Hex(),
+		TaskID:      a.task.ID.Hex(),
+		TaskName:    a.task.Name,
+		VulnID:      cellValue(result.Data["vuln_id"]),
+		Name:        cellValue(result.Data["name"]),
+		Severity:    cellValue(result.Data["severity"]),
+		Target:      cellValue(result.Data["target"]),
+		Evidence:    cellValue(result.Data["evidence"]),
+	}
+	if finding.Target == "" {
+		finding.Target = cellValue(result.Data["matched_at"])
+	}
+	if a.throttle.Allow(finding) {
+		a.manager.NotifyFinding(finding)
+	}
+}
+
+// mongoFindingRuleStore 规则的数据库存储
+type mongoFindingRuleStore struct{}
+
+// NewMongoFindingRuleStore 创建数据库规则存储
+func NewMongoFindingRuleStore() FindingRuleStore {
+	return &mongoFindingRuleStore{}
+}
+
+func (s *mongoFindingRuleStore) GetFindingRule(ctx context.Context, workspaceID string) (*notify.FindingRule, error) {
+	var rule notify.FindingRule
+	err := database.GetCollection(models.CollectionFindingRules).FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&rule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *mongoFindingRuleStore) SaveFindingRule(ctx context.Context, rule *notify.FindingRule) error {
+	_, err := database.GetCollection(models.CollectionFindingRules).ReplaceOne(ctx,
+		bson.M{"_id": rule.WorkspaceID}, rule, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// 通道背压监控
+// 下游模块或结果入库处理慢时，模块之间的通道会被填满，上游模块随之阻塞并可能触发各自的超时，
+// 看起来像扫描器故障。定期采样各模块输入通道和结果通道的占用写入进度报告，持续接近满时记录预警事件
+
+const (
+	// ChannelFullRatio 通道占用超过该比例视为接近满
+	ChannelFullRatio = 0.9
+	// DefaultChannelWarnAfter 通道持续接近满多久后记录预警
+	DefaultChannelWarnAfter = time.Minute
+	// ResultsChannel 流水线结果通道在统计中的名称（由执行器读取并入库）
+	ResultsChannel = "Results"
+)
+
+// ChannelStats 通道占用情况
+type ChannelStats struct {
+	Len         int     `json:"len"`
+	Cap         int     `json:"cap"`
+	Utilization float64 `json:"utilization"` // Len / Cap，0-1
+}
+
+// newChannelStats 计算通道占用
+func newChannelStats(length, capacity int) ChannelStats {
+	s := ChannelStats{Len: length, Cap: capacity}
+	if capacity > 0 {
+		s.Utilization = float64(length) / float64(capacity)
+	}
+	return s
+}
+
+// channelStats 各模块输入通道的占用：包装器的转发通道和模块自身的输入通道合计
+func (pm *pipelineMonitor) channelStats() map[string]ChannelStats {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	stats := make(map[string]ChannelStats, len(pm.modules)+1)
+	for _, m := range pm.modules {
+		length, capacity := len(m.input), cap(m.input)
+		if in := m.inner.GetInput(); in != nil {
+			length += len(in)
+			capacity += cap(in)
+		}
+		stats[m.state.name] = newChannelStats(length, capacity)
+	}
+	return stats
+}
+
+// ChannelStats 采样各模块输入通道和结果通道的占用，键为模块名称，结果通道为 ResultsChannel
+func (p *StreamingPipeline) ChannelStats() map[string]ChannelStats {
+	stats := p.monitor.channelStats()
+	stats[ResultsChannel] = newChannelStats(len(p.collected)+len(p.resultChan), cap(p.collected)+cap(p.resultChan))
+	return stats
+}
+
+// channelWarnAfter 获取通道预警时长，返回 0 表示禁用
+func (p *StreamingPipeline) channelWarnAfter() time.Duration {
+	if p.config.ChannelWarnAfter < 0 {
+		return 0
+	}
+	if p.config.ChannelWarnAfter == 0 {
+		return DefaultChannelWarnAfter
+	}
+	return p.config.ChannelWarnAfter
+}
+
+// runBackpressureMonitor 周期性采样通道占用，持续接近满的通道记录预警
+func (p *StreamingPipeline) runBackpressureMonitor(done <-chan struct{}) {
+	warnAfter := p.channelWarnAfter()
+	if warnAfter == 0 {
+		return
+	}
+
+	interval := warnAfter / 6
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	if interval > 10*time.Second {
+		interval = 10 * time.Second
+	}
+
+	watch := NewBackpressureWatch(warnAfter)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			stats := p.ChannelStats()
+			for _, name := range watch.Check(stats, now) {
+				p.emitBackpressure(name, stats[name], warnAfter)
+			}
+		}
+	}
+}
+
+// emitBackpressure 记录通道持续接近满的预警事件和进度提示
+func (p *StreamingPipeline) emitBackpressure(name string, stats ChannelStats, after time.Duration) {
+	log.Printf("[Pipeline] Channel of %s stayed above %.0f%% full for %v (%d/%d)", name, ChannelFullRatio*100, after, stats.Len, stats.Cap)
+
+	cause := "该模块处理较慢，上游模块被阻塞"
+	if name == ResultsChannel {
+		cause = "结果入库较慢，所有模块被阻塞"
+	}
+	message := fmt.Sprintf("%s 的输入通道持续 %s 超过 %.0f%%（%d/%d），%s", name, formatDuration(after), ChannelFullRatio*100, stats.Len, stats.Cap, cause)
+	p.events.Emit(name, EventLevelWarn, EventBackpressure, message, map[string]interface{}{
+		"len":         stats.Len,
+		"cap":         stats.Cap,
+		"utilization": stats.Utilization,
+		"seconds":     after.Seconds(),
+	})
+	if p.progressTracker != nil {
+		p.progressTracker.SetWarning("channel:"+name, message)
+	}
+}
+
+// BackpressureWatch 记录各通道开始接近满的时间
+type BackpressureWatch struct {
+	warnAfter time.Duration
+	fullSince map[string]time.Time
+	warned    map[string]bool
+}
+
+// NewBackpressureWatch 创建通道预警判定，通道持续 warnAfter 接近满时预警
+func NewBackpressureWatch(warnAfter time.Duration) *BackpressureWatch {
+	return &BackpressureWatch{
+		warnAfter: warnAfter,
+		fullSince: make(map[string]time.Time),
+		warned:    make(map[string]bool),
+	}
+}
+
+// Check 按一次采样更新状态，返回需要预警的通道（按名称排序）；
+// 同一通道在回落到阈值以下之前只预警一次
+func (w *BackpressureWatch) Check(stats map[string]ChannelStats, now time.Time) []string {
+	var names []string
+	for name, s := range stats {
+		if s.Cap == 0 || s.Utilization < ChannelFullRatio {
+			delete(w.fullSince, name)
+			delete(w.warned, name)
+			continue
+		}
+		since, ok := w.fullSince[name]
+		if !ok {
+			w.fullSince[name] = now
+			continue
+		}
+		if !w.warned[name] && now.Sub(since) >= w.warnAfter {
+			w.warned[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
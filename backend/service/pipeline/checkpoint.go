@@ -0,0 +1,249 @@
+package pipeline
+
+import (
+	"sync"
+
+	"moongazing/scanner/subdomain"
+)
+
+// 模块级断点
+// 子域名扫描按根域名、端口扫描按主机记录完成情况。模块处理完一个目标时登记它输出的结果，
+// 这些结果全部入库后该目标才算完成，避免任务停止时仍在后续模块中的结果随断点一起丢失。
+// 恢复执行时已完成的目标不再扫描，改为输出之前保存的结果，后续模块照常处理
+
+// 记录断点的模块
+const (
+	CheckpointSubdomainScan = "SubdomainScan" // 键为根域名
+	CheckpointPortScan      = "PortScan"      // 键为扫描的主机（域名或 IP）
+)
+
+// CheckpointEntry 模块已完成的一个目标
+type CheckpointEntry struct {
+	Module string `json:"module"`
+	Key    string `json:"key"`
+}
+
+// ResumeState 恢复执行时的断点数据
+type ResumeState struct {
+	Completed  []CheckpointEntry // 已完成的模块目标
+	Subdomains []SubdomainResult // 之前保存的子域名结果
+	Ports      []PortAlive       // 之前保存的端口结果
+	Progress   int               // 中断时的总体进度
+}
+
+// checkpointMark 模块处理完一个目标，跟在该目标的结果之后进入模块的结果通道
+type checkpointMark struct {
+	module string
+	key    string
+}
+
+// Checkpoint 任务断点，nil 时不记录
+type Checkpoint struct {
+	mu        sync.Mutex
+	done      map[CheckpointEntry]bool
+	stored    map[CheckpointEntry]map[string]bool // 未完成目标已入库的结果
+	waiting   map[CheckpointEntry]map[string]bool // 模块已处理完、等待入库的结果
+	confirmed []CheckpointEntry                   // 新完成、尚未持久化的目标
+
+	resumed    bool
+	progress   int
+	subdomains map[string][]SubdomainResult // 根域名 -> 之前保存的子域名
+	ports      map[string][]PortAlive       // 主机 -> 之前保存的端口
+}
+
+// NewCheckpoint 创建任务断点，state 为 nil 表示全新执行
+func NewCheckpoint(state *ResumeState) *Checkpoint {
+	c := &Checkpoint{
+		done:       make(map[CheckpointEntry]bool),
+		stored:     make(map[CheckpointEntry]map[string]bool),
+		waiting:    make(map[CheckpointEntry]map[string]bool),
+		subdomains: make(map[string][]SubdomainResult),
+		ports:      make(map[string][]PortAlive),
+	}
+	if state == nil {
+		return c
+	}
+
+	c.resumed = true
+	c.progress = state.Progress
+	for _, entry := range state.Completed {
+		c.done[entry] = true
+	}
+	for _, sr := range state.Subdomains {
+		// 被排除、无法解析的子域名当时只记录不扫描，恢复时同样不再进入后续模块
+		if sr.Excluded || !subdomain.IsResolved(sr.Resolution) {
+			continue
+		}
+		c.subdomains[sr.Domain] = append(c.subdomains[sr.Domain], sr)
+	}
+	for _, pa := range state.Ports {
+		c.ports[pa.Host] = append(c.ports[pa.Host], pa)
+	}
+	return c
+}
+
+// Resumed 是否从断点恢复执行
+func (c *Checkpoint) Resumed() bool {
+	return c != nil && c.resumed
+}
+
+// Progress 中断时的总体进度
+func (c *Checkpoint) Progress() int {
+	if c == nil {
+		return 0
+	}
+	return c.progress
+}
+
+// Done 模块是否已完成该目标
+func (c *Checkpoint) Done(module, key string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[CheckpointEntry{Module: module, Key: key}]
+}
+
+// Complete 模块处理完一个目标，items 为它输出的结果，全部入库后目标才算完成
+func (c *Checkpoint) Complete(module, key string, items []string) {
+	if c == nil {
+		return
+	}
+	entry := CheckpointEntry{Module: module, Key: key}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done[entry] {
+		return
+	}
+
+	pending := c.waiting[entry]
+	if pending == nil {
+		pending = make(map[string]bool)
+	}
+	stored := c.stored[entry]
+	for _, item := range items {
+		if !stored[item] {
+			pending[item] = true
+		}
+	}
+	c.waiting[entry] = pending
+	c.confirmLocked(entry)
+}
+
+// Stored 结果已入库，按结果类型归属到对应的模块目标
+func (c *Checkpoint) Stored(data interface{}) {
+	if c == nil {
+		return
+	}
+	entry, item, ok := checkpointItem(data)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done[entry] {
+		return
+	}
+
+	if pending, waiting := c.waiting[entry]; waiting {
+		delete(pending, item)
+		c.confirmLocked(entry)
+		return
+	}
+	// 模块尚未处理完该目标，先记下已入库的结果
+	if c.stored[entry] == nil {
+		c.stored[entry] = make(map[string]bool)
+	}
+	c.stored[entry][item] = true
+}
+
+// confirmLocked 等待入库的结果都已入库时完成目标（需要持有锁）
+func (c *Checkpoint) confirmLocked(entry CheckpointEntry) {
+	if len(c.waiting[entry]) > 0 {
+		return
+	}
+	delete(c.waiting, entry)
+	delete(c.stored, entry)
+	c.done[entry] = true
+	c.confirmed = append(c.confirmed, entry)
+}
+
+// TakeConfirmed 取出新完成的目标，用于持久化
+func (c *Checkpoint) TakeConfirmed() []CheckpointEntry {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	confirmed := c.confirmed
+	c.confirmed = nil
+	return confirmed
+}
+
+// restoredSubdomains 之前保存的、属于该根域名的子域名
+func (c *Checkpoint) restoredSubdomains(domain string) []SubdomainResult {
+	if c == nil {
+		return nil
+	}
+	return c.subdomains[domain]
+}
+
+// restoredPorts 之前保存的、属于该主机的端口
+func (c *Checkpoint) restoredPorts(host string) []PortAlive {
+	if c == nil {
+		return nil
+	}
+	return c.ports[host]
+}
+
+// checkpointItem 结果所属的模块目标及其标识
+func checkpointItem(data interface{}) (CheckpointEntry, string, bool) {
+	switch r := data.(type) {
+	case SubdomainResult:
+		return CheckpointEntry{Module: CheckpointSubdomainScan, Key: r.Domain}, r.Host, true
+	case PortAlive:
+		if r.Port == "" {
+			return CheckpointEntry{}, "", false
+		}
+		return CheckpointEntry{Module: CheckpointPortScan, Key: r.Host}, r.Host + ":" + r.Port, true
+	}
+	return CheckpointEntry{}, "", false
+}
+
+// checkpointTracker 模块结果转发协程中记录每个目标已输出的结果，收到 checkpointMark 时登记到断点
+type checkpointTracker struct {
+	checkpoint *Checkpoint
+	module     string
+	items      map[string][]string
+}
+
+func newCheckpointTracker(checkpoint *Checkpoint, module string) *checkpointTracker {
+	return &checkpointTracker{checkpoint: checkpoint, module: module, items: make(map[string][]string)}
+}
+
+// sent 结果已发送到下一个模块
+func (t *checkpointTracker) sent(data interface{}) {
+	if t.checkpoint == nil {
+		return
+	}
+	if entry, item, ok := checkpointItem(data); ok && entry.Module == t.module {
+		t.items[entry.Key] = append(t.items[entry.Key], item)
+	}
+}
+
+// mark 目标处理完成
+func (t *checkpointTracker) mark(m checkpointMark) {
+	t.checkpoint.Complete(m.module, m.key, t.items[m.key])
+	delete(t.items, m.key)
+}
+
+// SetCheckpoint 设置任务断点（流水线共用）
+func (m *SubdomainScanModule) SetCheckpoint(checkpoint *Checkpoint) {
+	m.checkpoint = checkpoint
+}
+
+// SetCheckpoint 设置任务断点（流水线共用）
+func (m *PortScanModule) SetCheckpoint(checkpoint *Checkpoint) {
+	m.checkpoint = checkpoint
+}
@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/webscan"
+)
+
+// DefaultContentAnalysisConcurrency 同时获取的内容数
+const DefaultContentAnalysisConcurrency = 5
+
+// ContentAnalysisModule 内容敏感信息检测模块
+// 接收爬虫和目录扫描发现的 URL，原样传递给下一个模块；JS、JSON、配置、SQL、备份等文件（见 webscan.IsInspectableURL）
+// 获取响应体后检测敏感信息，输出的 SensitiveInfoResult 记录文件地址和链接到它的页面（Parent）。
+// 请求带任务的自定义请求头，同一主机的并发受 IP 调度器限制；同一主机多个文件中相同的密钥只输出一次
+type ContentAnalysisModule struct {
+	BaseModule
+	analyzer    *webscan.ContentAnalyzer
+	concurrency int
+	resultChan  chan interface{}
+
+	mu       sync.Mutex
+	reported map[string]bool // 主机 + 规则 + 匹配值
+}
+
+// NewContentAnalysisModule 创建内容敏感信息检测模块
+func NewContentAnalysisModule(ctx context.Context, nextModule ModuleRunner, concurrency int) *ContentAnalysisModule {
+	if concurrency <= 0 {
+		concurrency = DefaultContentAnalysisConcurrency
+	}
+
+	return &ContentAnalysisModule{
+		BaseModule: BaseModule{
+			name:       "ContentAnalysis",
+			ctx:        ctx,
+			nextModule: nextModule,
+			dupChecker: NewDuplicateChecker(),
+		},
+		analyzer:    webscan.NewContentAnalyzer(),
+		concurrency: concurrency,
+		resultChan:  make(chan interface{}, 500),
+		reported:    make(map[string]bool),
+	}
+}
+
+// SetAnalyzer 设置内容检测器
+func (m *ContentAnalysisModule) SetAnalyzer(analyzer *webscan.ContentAnalyzer) {
+	m.analyzer = analyzer
+}
+
+// SetMaxBodySize 设置获取内容的大小上限(字节)，0 保持默认值
+func (m *ContentAnalysisModule) SetMaxBodySize(size int64) {
+	if size > 0 {
+		m.analyzer.MaxBodySize = size
+	}
+}
+
+// SetMaskEmails 设置匹配上下文中是否同时掩码邮箱
+func (m *ContentAnalysisModule) SetMaskEmails(mask bool) {
+	m.analyzer.MaskEmails = mask
+}
+
+// SetHeaders 设置获取内容时的自定义请求头
+func (m *ContentAnalysisModule) SetHeaders(headers *core.ScanHeaders) {
+	m.analyzer.SetHeaders(headers)
+}
+
+// ContentAnalysisDoc URL 结果是否需要获取内容检测：GET 请求、可检测的文件类型，
+// 目录扫描记录了状态码时只检测 2xx
+func ContentAnalysisDoc(r UrlResult) bool {
+	if r.Output == "" || r.StateChanging || (r.Method != "" && !strings.EqualFold(r.Method, "GET")) {
+		return false
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 200 || r.StatusCode >= 300) {
+		return false
+	}
+	return webscan.IsInspectableURL(r.Output, r.ContentType)
+}
+
+// ModuleRun 运行模块
+func (m *ContentAnalysisModule) ModuleRun() error {
+	m.ReportModuleStart(0)
+	defer m.ReportModuleComplete()
+
+	var allWg sync.WaitGroup
+	var resultWg sync.WaitGroup
+	var nextModuleRun sync.WaitGroup
+
+	sem := make(chan struct{}, m.concurrency)
+
+	// 启动下一个模块
+	if m.nextModule != nil {
+		nextModuleRun.Add(1)
+		go func() {
+			defer nextModuleRun.Done()
+			if err := m.nextModule.ModuleRun(); err != nil {
+				log.Printf("[%s] Next module error: %v", m.name, err)
+			}
+		}()
+	}
+
+	// 结果处理协程
+	resultWg.Add(1)
+	go func() {
+		defer resultWg.Done()
+		for result := range m.resultChan {
+			if m.nextModule != nil {
+				select {
+				case <-m.ctx.Done():
+					return
+				case m.nextModule.GetInput() <- result:
+				}
+			}
+		}
+		if m.nextModule != nil {
+			m.nextModule.CloseInput()
+		}
+	}()
+
+	finish := func() error {
+		allWg.Wait()
+		close(m.resultChan)
+		resultWg.Wait()
+		nextModuleRun.Wait()
+		return nil
+	}
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return finish()
+
+		case data, ok := <-m.input:
+			if !ok {
+				log.Printf("[%s] Input closed, waiting for analysis", m.name)
+				return finish()
+			}
+
+			// 先传递原始数据到下一个模块
+			select {
+			case <-m.ctx.Done():
+				return finish()
+			case m.resultChan <- data:
+			}
+
+			doc, ok := data.(UrlResult)
+			if !ok || !ContentAnalysisDoc(doc) {
+				continue
+			}
+			// 同一文件只获取一次
+			if m.dupChecker.IsURLDuplicate("content " + NormalizeURL(doc.Output)) {
+				continue
+			}
+
+			allWg.Add(1)
+			go func(doc UrlResult) {
+				defer allWg.Done()
+				select {
+				case <-m.ctx.Done():
+					return
+				case sem <- struct{}{}:
+				}
+				defer func() { <-sem }()
+				m.analyze(doc)
+			}(doc)
+		}
+	}
+}
+
+// analyze 获取内容并输出检测到的敏感信息
+func (m *ContentAnalysisModule) analyze(doc UrlResult) {
+	host := ""
+	if u, err := url.Parse(doc.Output); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	release, ok := m.ipScheduler.Acquire(m.ctx, host, "")
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(m.ctx, 60*time.Second)
+	defer cancel()
+
+	body, contentType, err := m.analyzer.Fetch(ctx, doc.Output)
+	if err != nil {
+		if m.ctx.Err() == nil && !errors.Is(err, webscan.ErrContentNotText) {
+			log.Printf("[%s] Failed to fetch %s: %v", m.name, doc.Output, err)
+		}
+		return
+	}
+
+	parent := doc.Parent
+	if parent == "" {
+		parent = doc.Input
+	}
+	emitted := 0
+	for _, finding := range m.analyzer.Analyze(doc.Output, contentType, body) {
+		if !m.keepNew(host, &finding) {
+			continue
+		}
+		result := SensitiveInfoResult{
+			Target:       doc.Input,
+			URL:          doc.Output,
+			Parent:       parent,
+			Type:         finding.Type,
+			Pattern:      finding.Pattern,
+			Matches:      finding.Matches,
+			Contexts:     finding.Contexts,
+			TotalMatches: finding.TotalMatches,
+			Location:     finding.Location,
+			Severity:     finding.Severity,
+			Confidence:   finding.Confidence,
+			Source:       "content_analysis",
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- result:
+			emitted++
+		}
+	}
+	if emitted > 0 {
+		m.ReportOutput(emitted)
+		log.Printf("[%s] Found %d sensitive findings in %s", m.name, emitted, doc.Output)
+	}
+}
+
+// keepNew 去掉同一主机已输出过的匹配值，全部输出过时返回 false
+func (m *ContentAnalysisModule) keepNew(host string, finding *webscan.SensitiveFinding) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matches []string
+	for _, match := range finding.Matches {
+		key := host + "\x00" + finding.Pattern + "\x00" + match
+		if m.reported[key] {
+			continue
+		}
+		m.reported[key] = true
+		matches = append(matches, match)
+	}
+	if len(matches) == 0 {
+		return false
+	}
+	finding.Matches = matches
+	return true
+}
@@ -4,15 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
+	"moongazing/scanner/core"
 	"moongazing/scanner/webscan"
 )
 
 // CrawlerModule URL爬虫模块
 // 接收HTTP资产，执行URL爬虫，输出发现的URL
-// 支持批量模式：收集所有URL后批量调用Katana
+// 支持批量模式：收集所有URL后按 batchSize 分批调用Katana
 type CrawlerModule struct {
 	BaseModule
 	katanaScanner *webscan.KatanaScanner
@@ -24,7 +27,9 @@ type CrawlerModule struct {
 	crawlDepth    int
 	batchMode     bool    // 是否使用批量模式
 	batchSize     int     // 批量大小
+	batchParallel int     // 同时运行的批次数
 	batchTimeout  time.Duration // 批量收集超时
+	crossOrigin   *core.ScopeFilter // 跨站 URL 的范围，nil 时不限制
 }
 
 // NewCrawlerModule 创建爬虫模块
@@ -49,6 +54,7 @@ func NewCrawlerModule(ctx context.Context, nextModule ModuleRunner, concurrency
 		crawlDepth:    3,
 		batchMode:     true,  // 默认启用批量模式
 		batchSize:     100,   // 默认每批100个URL
+		batchParallel: 1,     // 默认逐批运行
 		batchTimeout:  30 * time.Second, // 批量收集等待30秒
 	}
 	return m
@@ -72,6 +78,22 @@ func (m *CrawlerModule) SetCrawlDepth(depth int) {
 	}
 }
 
+// SetRateLimit 设置 katana/rad 并发数和 katana 每秒请求数，0 保持默认值
+func (m *CrawlerModule) SetRateLimit(concurrency, rateLimit int) {
+	if concurrency > 0 {
+		m.katanaScanner.Concurrency = concurrency
+		m.radScanner.Concurrency = concurrency
+	}
+	if rateLimit > 0 {
+		m.katanaScanner.RateLimit = rateLimit
+	}
+}
+
+// SetKatanaScanner 设置 Katana 爬虫
+func (m *CrawlerModule) SetKatanaScanner(scanner *webscan.KatanaScanner) {
+	m.katanaScanner = scanner
+}
+
 // SetBatchMode 设置批量模式
 func (m *CrawlerModule) SetBatchMode(enabled bool, batchSize int) {
 	m.batchMode = enabled
@@ -80,14 +102,33 @@ func (m *CrawlerModule) SetBatchMode(enabled bool, batchSize int) {
 	}
 }
 
+// SetBatchLimits 设置每批 URL 数和同时运行的批次数，0 保持默认值
+func (m *CrawlerModule) SetBatchLimits(batchSize, parallel int) {
+	if batchSize > 0 {
+		m.batchSize = batchSize
+	}
+	if parallel > 0 {
+		m.batchParallel = parallel
+	}
+}
+
+// radEnabled rad 是否参与爬取：选择了 rad，或 katana 不可用时作为备用爬虫
+func (m *CrawlerModule) radEnabled() bool {
+	if !m.radScanner.IsAvailable() {
+		return false
+	}
+	return m.useRad || !(m.useKatana && m.katanaScanner.IsAvailable())
+}
+
 // ModuleRun 运行模块
 func (m *CrawlerModule) ModuleRun() error {
 	// 检查爬虫工具是否可用
 	katanaAvailable := m.useKatana && m.katanaScanner.IsAvailable()
-	radAvailable := m.useRad && m.radScanner.IsAvailable()
+	radAvailable := m.radEnabled()
 
 	if !katanaAvailable && !radAvailable {
 		log.Printf("[%s] No crawler available, skipping", m.name)
+		m.emitToolUnavailable("katana/rad")
 		if m.nextModule != nil {
 			m.nextModule.CloseInput()
 		}
@@ -105,7 +146,7 @@ func (m *CrawlerModule) ModuleRun() error {
 	return m.runStreamMode(katanaAvailable, radAvailable)
 }
 
-// runBatchMode 批量模式：收集所有URL后批量调用Katana -list
+// runBatchMode 批量模式：收集所有URL后分批调用Katana -list
 func (m *CrawlerModule) runBatchMode(useKatana, useRad bool) error {
 	var nextModuleRun sync.WaitGroup
 
@@ -188,15 +229,23 @@ processBatch:
 	// 批量爬取
 	log.Printf("[%s] Starting batch crawl for %d URLs", m.name, len(urlsToScan))
 
-	// 使用 Katana 批量爬取
+	// 使用 Katana 批量爬取，同一 IP 的 URL 超过并发上限时分多轮调用，每轮再按 batchSize 分批
 	if useKatana {
-		m.batchCrawlWithKatana(urlsToScan)
+		m.ipScheduler.EachRound(m.ctx, assetWorks(pendingAssets), func(round []IPWork) bool {
+			m.crawlKatanaBatches(workURLs(round))
+			return true
+		})
 	}
 
 	// 使用 Rad 补充爬取（逐个处理，因为Rad不支持批量）
 	if useRad {
 		for _, asset := range pendingAssets {
+			release, ok := m.ipScheduler.Acquire(m.ctx, asset.Host, asset.IP)
+			if !ok {
+				break
+			}
 			m.crawlWithRad(asset.URL, asset)
+			release()
 		}
 	}
 
@@ -210,9 +259,55 @@ processBatch:
 	return nil
 }
 
-// batchCrawlWithKatana 使用Katana批量爬取
-func (m *CrawlerModule) batchCrawlWithKatana(urls []string) {
-	// 根据URL数量动态设置超时（每个URL最多3分钟）
+// crawlKatanaBatches 按 batchSize 分批调用 Katana，最多 batchParallel 批同时运行
+// 每批完成后立即转发结果，某一批失败或超时只记录事件，继续下一批
+func (m *CrawlerModule) crawlKatanaBatches(urls []string) {
+	batches := splitURLBatches(urls, m.batchSize)
+	parallel := m.batchParallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for i, batch := range batches {
+		select {
+		case <-m.ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if m.ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(index int, batch []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			log.Printf("[%s] Katana batch %d/%d: %d URLs", m.name, index, len(batches), len(batch))
+			m.batchCrawlWithKatana(batch, fmt.Sprintf("第 %d/%d 批 %d 个 URL", index, len(batches), len(batch)))
+		}(i+1, batch)
+	}
+	wg.Wait()
+}
+
+// splitURLBatches 把 URL 按 size 分批，size <= 0 时不分批
+func splitURLBatches(urls []string, size int) [][]string {
+	if size <= 0 || len(urls) <= size {
+		return [][]string{urls}
+	}
+	batches := make([][]string, 0, (len(urls)+size-1)/size)
+	for start := 0; start < len(urls); start += size {
+		end := start + size
+		if end > len(urls) {
+			end = len(urls)
+		}
+		batches = append(batches, urls[start:end])
+	}
+	return batches
+}
+
+// batchCrawlWithKatana 使用Katana爬取一批URL，label 用于错误事件
+func (m *CrawlerModule) batchCrawlWithKatana(urls []string, label string) {
+	// 根据本批URL数量动态设置超时（每个URL最多3分钟）
 	timeout := time.Duration(len(urls)*3) * time.Minute
 	if timeout < 5*time.Minute {
 		timeout = 5 * time.Minute
@@ -229,6 +324,7 @@ func (m *CrawlerModule) batchCrawlWithKatana(urls []string) {
 	result, err := m.katanaScanner.CrawlList(ctx, urls)
 	if err != nil {
 		log.Printf("[%s] Katana batch crawl error: %v", m.name, err)
+		m.emitTargetError("katana", label, err)
 		return
 	}
 
@@ -241,16 +337,20 @@ func (m *CrawlerModule) batchCrawlWithKatana(urls []string) {
 
 	// 发送爬取结果
 	for _, url := range result.URLs {
-		urlResult := UrlResult{
+		urlResult := crawledRequest(UrlResult{
 			Input:      url.Source,
 			Output:     url.URL,
 			Source:     "katana",
 			Method:     url.Method,
 			StatusCode: url.StatusCode,
-		}
+		}, url.Body, url.Headers)
 
+		if m.dropCrossOrigin(urlResult) {
+			continue
+		}
 		// URL去重
-		if m.dupChecker.IsURLDuplicate(urlResult.Output) {
+		urlResult, dup := m.checkURL(urlResult)
+		if dup {
 			continue
 		}
 
@@ -290,10 +390,15 @@ func (m *CrawlerModule) runStreamMode(useKatana, useRad bool) error {
 		defer resultWg.Done()
 		for result := range m.resultChan {
 			if urlResult, ok := result.(UrlResult); ok {
+				if m.dropCrossOrigin(urlResult) {
+					continue
+				}
 				// URL去重
-				if m.dupChecker.IsURLDuplicate(urlResult.Output) {
+				urlResult, dup := m.checkURL(urlResult)
+				if dup {
 					continue
 				}
+				result = urlResult
 			}
 
 			// 发送到下一个模块
@@ -349,6 +454,11 @@ func (m *CrawlerModule) runStreamMode(useKatana, useRad bool) error {
 			allWg.Add(1)
 			go func(a AssetHttp) {
 				defer allWg.Done()
+				release, ok := m.ipScheduler.Acquire(m.ctx, a.Host, a.IP)
+				if !ok {
+					return
+				}
+				defer release()
 				sem <- struct{}{}
 				defer func() { <-sem }()
 				m.crawlTarget(a, useKatana, useRad)
@@ -382,6 +492,7 @@ func (m *CrawlerModule) crawlWithKatana(target string, asset AssetHttp) {
 	result, err := m.katanaScanner.Crawl(ctx, target)
 	if err != nil {
 		log.Printf("[%s] Katana error for %s: %v", m.name, target, err)
+		m.emitTargetError("katana", target, err)
 		return
 	}
 
@@ -392,13 +503,13 @@ func (m *CrawlerModule) crawlWithKatana(target string, asset AssetHttp) {
 	log.Printf("[%s] Katana found %d URLs for %s", m.name, len(result.URLs), target)
 
 	for _, url := range result.URLs {
-		urlResult := UrlResult{
+		urlResult := crawledRequest(UrlResult{
 			Input:      target,
 			Output:     url.URL,
 			Source:     "katana",
 			Method:     url.Method,
 			StatusCode: url.StatusCode,
-		}
+		}, url.Body, url.Headers)
 
 		select {
 		case <-m.ctx.Done():
@@ -416,6 +527,7 @@ func (m *CrawlerModule) crawlWithRad(target string, asset AssetHttp) {
 	result, err := m.radScanner.Crawl(ctx, target)
 	if err != nil {
 		log.Printf("[%s] Rad error for %s: %v", m.name, target, err)
+		m.emitTargetError("rad", target, err)
 		return
 	}
 
@@ -426,12 +538,12 @@ func (m *CrawlerModule) crawlWithRad(target string, asset AssetHttp) {
 	log.Printf("[%s] Rad found %d URLs for %s", m.name, len(result.URLs), target)
 
 	for _, url := range result.URLs {
-		urlResult := UrlResult{
+		urlResult := crawledRequest(UrlResult{
 			Input:  target,
 			Output: url.URL,
 			Source: "rad",
 			Method: url.Method,
-		}
+		}, url.Body, url.Headers)
 
 		select {
 		case <-m.ctx.Done():
@@ -441,6 +553,53 @@ func (m *CrawlerModule) crawlWithRad(target string, asset AssetHttp) {
 	}
 }
 
+// crawledRequest 补充爬虫发现的请求内容并标记可能改变服务端状态的请求
+func crawledRequest(r UrlResult, body string, headers map[string]string) UrlResult {
+	if r.Method == "" {
+		r.Method = "GET"
+	}
+	r.RequestBody = body
+	if len(headers) > 0 {
+		r.RequestHeaders = make(map[string]string, len(headers))
+		for k, v := range headers {
+			r.RequestHeaders[k] = v
+		}
+	}
+	if body != "" && requestHeader(r.RequestHeaders, "Content-Type") == "" {
+		if r.RequestHeaders == nil {
+			r.RequestHeaders = make(map[string]string)
+		}
+		r.RequestHeaders["Content-Type"] = guessContentType(body)
+	}
+	r.StateChanging = webscan.IsStateChanging(r.Method, r.Output, body)
+	params := webscan.ParseRequestParams(r.Output, requestHeader(r.RequestHeaders, "Content-Type"), body)
+	if body != "" {
+		r.RequestContentType = params.ContentType
+	}
+	r.Parameters = params.Parameters
+	r.FormFields = params.FormFields
+	return r
+}
+
+// requestHeader 不区分大小写读取请求头
+func requestHeader(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// guessContentType 爬虫未给出 Content-Type 时按请求体推断
+func guessContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return "application/json"
+	}
+	return "application/x-www-form-urlencoded"
+}
+
 // DirScanModule 目录扫描模块
 // 接收HTTP资产，使用 Spray 执行目录爆破，输出发现的URL
 type DirScanModule struct {
@@ -454,6 +613,13 @@ type DirScanModule struct {
 	batchTimeout   time.Duration // 批量收集超时
 	enableBackup   bool          // 扫描备份文件
 	enableCommon   bool          // 扫描通用文件
+
+	softNotFoundThreshold int  // 软 404 判定阈值，0 使用默认值，负数关闭
+	softNotFoundTag       bool // 疑似软 404 标记后保留，而不是丢弃
+
+	statusFilter *DirScanStatusFilter // 保留的状态码，nil 使用默认值
+
+	wafThreads int // 受 WAF 保护的目标的 spray 线程数上限，0 不调整
 }
 
 // NewDirScanModule 创建目录扫描模块
@@ -490,6 +656,24 @@ func NewDirScanModule(ctx context.Context, nextModule ModuleRunner, concurrency
 	return m
 }
 
+// SetSprayScanner 设置 Spray 扫描器
+func (m *DirScanModule) SetSprayScanner(scanner *webscan.SprayScanner) {
+	m.sprayScanner = scanner
+}
+
+// SetRateLimit 设置 spray 线程数和每秒请求数，0 保持默认值
+func (m *DirScanModule) SetRateLimit(concurrency, rateLimit int) {
+	if m.sprayScanner == nil {
+		return
+	}
+	if concurrency > 0 {
+		m.sprayScanner.Concurrency = concurrency
+	}
+	if rateLimit > 0 {
+		m.sprayScanner.RateLimit = rateLimit
+	}
+}
+
 // SetBatchMode 设置批量模式
 func (m *DirScanModule) SetBatchMode(enabled bool, batchSize int) {
 	m.batchMode = enabled
@@ -498,6 +682,85 @@ func (m *DirScanModule) SetBatchMode(enabled bool, batchSize int) {
 	}
 }
 
+// SetSoftNotFound 设置软 404 过滤：threshold 为同一主机上相同响应的路径数阈值（0 使用默认值，负数关闭），
+// tag 为 true 时疑似软 404 的结果标记 Suspicious 后保留
+func (m *DirScanModule) SetSoftNotFound(threshold int, tag bool) {
+	m.softNotFoundThreshold = threshold
+	m.softNotFoundTag = tag
+}
+
+// SetStatusFilter 设置保留的状态码：include 为空时使用默认值（2xx、3xx、401、403、405、500），exclude 从中排除
+func (m *DirScanModule) SetStatusFilter(include, exclude []int) {
+	if len(include) == 0 && len(exclude) == 0 {
+		m.statusFilter = nil
+		return
+	}
+	m.statusFilter = NewDirScanStatusFilter(include, exclude)
+}
+
+// SetWAFThreads 设置受 WAF 保护的目标（指纹识别检测到 WAF）的 spray 线程数上限，0 不调整
+func (m *DirScanModule) SetWAFThreads(threads int) {
+	m.wafThreads = threads
+}
+
+// sprayFor 返回扫描目标使用的 spray 扫描器，受 WAF 保护的目标线程数不超过 wafThreads
+func (m *DirScanModule) sprayFor(waf bool) *webscan.SprayScanner {
+	if !waf || m.wafThreads <= 0 || m.wafThreads >= m.sprayScanner.Concurrency {
+		return m.sprayScanner
+	}
+	return m.sprayScanner.WithConcurrency(m.wafThreads)
+}
+
+// dirScanGroup 批量模式中使用同一线程数扫描的一组资产
+type dirScanGroup struct {
+	assets []AssetHttp
+	waf    bool
+}
+
+// wafGroups 设置了 WAF 线程数时，受 WAF 保护的资产单独分为一组
+func (m *DirScanModule) wafGroups(assets []AssetHttp) []dirScanGroup {
+	if m.wafThreads <= 0 {
+		return []dirScanGroup{{assets: assets}}
+	}
+	var plain, protected []AssetHttp
+	for _, asset := range assets {
+		if asset.WAF != "" {
+			protected = append(protected, asset)
+		} else {
+			plain = append(plain, asset)
+		}
+	}
+	var groups []dirScanGroup
+	if len(plain) > 0 {
+		groups = append(groups, dirScanGroup{assets: plain})
+	}
+	if len(protected) > 0 {
+		groups = append(groups, dirScanGroup{assets: protected, waf: true})
+	}
+	return groups
+}
+
+// newSoftNotFoundFilter 每个目标或批次使用独立的过滤器，关闭时返回 nil
+func (m *DirScanModule) newSoftNotFoundFilter() *SoftNotFoundFilter {
+	if m.softNotFoundThreshold < 0 {
+		return nil
+	}
+	return NewSoftNotFoundFilter(m.softNotFoundThreshold, m.softNotFoundTag)
+}
+
+// filterSoftNotFound 经过软 404 过滤器，返回可以转发的结果；过滤器为 nil 时原样返回
+// 未超过阈值的结果缓存在过滤器中，由 Flush 或 FlushIdle 取出
+func (m *DirScanModule) filterSoftNotFound(filter *SoftNotFoundFilter, entry webscan.SprayEntry, result UrlResult) []UrlResult {
+	if filter == nil {
+		return []UrlResult{result}
+	}
+	ready, dropped := filter.Add(entry, result)
+	for _, d := range dropped {
+		m.suppression.Record(m.name, SuppressSoftNotFound, d)
+	}
+	return ready
+}
+
 // SetScanOptions 设置扫描选项
 func (m *DirScanModule) SetScanOptions(enableBackup, enableCommon bool) {
 	m.enableBackup = enableBackup
@@ -517,6 +780,7 @@ func (m *DirScanModule) ModuleRun() error {
 	// 检查 Spray 是否可用
 	if m.sprayScanner == nil || !m.sprayScanner.IsAvailable() {
 		log.Printf("[%s] Spray not available, skipping directory scan", m.name)
+		m.emitToolUnavailable("spray")
 		return fmt.Errorf("spray scanner not available")
 	}
 
@@ -549,6 +813,7 @@ func (m *DirScanModule) runBatchMode() error {
 	// 收集所有URL
 	var urlsToScan []string
 	urlSet := make(map[string]bool)
+	var pendingAssets []AssetHttp
 
 	log.Printf("[%s] Collecting URLs for batch directory scanning...", m.name)
 
@@ -597,6 +862,7 @@ func (m *DirScanModule) runBatchMode() error {
 			if asset.URL != "" && !urlSet[asset.URL] {
 				urlSet[asset.URL] = true
 				urlsToScan = append(urlsToScan, asset.URL)
+				pendingAssets = append(pendingAssets, asset)
 			}
 		}
 	}
@@ -611,60 +877,165 @@ processBatch:
 		return nil
 	}
 
-	// 批量扫描
+	// 批量扫描，同一 IP 的 URL 超过并发上限时分多轮调用；
+	// spray 的线程数按目标计，同一 IP 上的目标平分线程数，使每个 IP 的请求数不超过单个目标的线程数
 	log.Printf("[%s] Starting batch directory scan for %d URLs with Spray", m.name, len(urlsToScan))
 
-	ctx, cancel := context.WithTimeout(m.ctx, 60*time.Minute)
-	defer cancel()
+	// 受 WAF 保护的目标单独分批，使用较低的线程数
+	for _, group := range m.wafGroups(pendingAssets) {
+		waf := group.waf
+		ok := m.ipScheduler.EachRound(m.ctx, assetWorks(group.assets), func(round []IPWork) bool {
+			return m.scanBatchWithSpray(round, waf)
+		})
+		if !ok {
+			break
+		}
+	}
 
-	result, err := m.sprayScanner.ScanBatchWithWordlist(ctx, urlsToScan, m.wordlist)
-	if err != nil {
-		log.Printf("[%s] Spray batch scan error: %v", m.name, err)
+	if m.nextModule != nil {
+		m.nextModule.CloseInput()
 	}
+	nextModuleRun.Wait()
+	return nil
+}
 
-	if result != nil {
-		log.Printf("[%s] Spray found %d results", m.name, len(result.Results))
+// scanBatchWithSpray 批量调用 Spray 扫描一轮 URL，上下文取消时返回 false；waf 为 true 时这一轮的目标受 WAF 保护
+// Spray 运行期间结果经软 404 过滤后转发给下一个模块，不等待整批完成；返回 429 的结果计入所在 IP 的限速次数
+func (m *DirScanModule) scanBatchWithSpray(round []IPWork, waf bool) bool {
+	ctx, cancel := context.WithTimeout(m.ctx, 60*time.Minute)
+	defer cancel()
 
-		for _, entry := range result.Results {
-			// 输出有效的结果（排除根路径和无效状态码）
-			// 保留: 2xx(成功), 3xx(重定向), 401(未授权), 403(禁止)
-			validStatus := (entry.StatusCode >= 200 && entry.StatusCode < 400) ||
-				entry.StatusCode == 401 || entry.StatusCode == 403
-			
-			// 跳过根路径（只有域名没有具体路径）
-			isRootPath := entry.Path == "" || entry.Path == "/"
-			
-			if validStatus && !isRootPath {
-				urlResult := UrlResult{
-					Input:       entry.Host,
-					Output:      entry.URL,
-					Source:      "dirscan",
-					Method:      "GET",
-					StatusCode:  entry.StatusCode,
-					ContentType: entry.ContentType,
-					Length:      entry.BodyLength,
-				}
+	urlsToScan := workURLs(round)
+	works := make(map[string]IPWork, len(round))
+	for _, work := range round {
+		if u, err := url.Parse(work.URL); err == nil {
+			works[strings.ToLower(u.Hostname())] = work
+		}
+	}
+	scanner := m.sprayFor(waf)
+	if scanner != m.sprayScanner {
+		log.Printf("[%s] Spray threads lowered to %d for %d WAF-protected URLs", m.name, scanner.Concurrency, len(urlsToScan))
+	}
+	if threads := m.ipScheduler.SplitThreads(round, scanner.Concurrency); threads != scanner.Concurrency {
+		log.Printf("[%s] Spray threads lowered to %d for %d URLs sharing IPs", m.name, threads, len(urlsToScan))
+		scanner = scanner.WithConcurrency(threads)
+	}
 
-				// 报告输出
-				m.ReportOutput(1)
+	// 结果由 spray 的输出回调和软 404 的定时转发两处调用
+	var forwardMu sync.Mutex
+	forwarded := 0
+	forward := func(urlResult UrlResult) {
+		forwardMu.Lock()
+		defer forwardMu.Unlock()
+		// 重定向等得到的超出范围的 URL 不输出
+		if m.dropOutOfScope(urlResult) {
+			return
+		}
+		// 爬虫已经发现的 URL 不再输出
+		urlResult, dup := m.checkURL(urlResult)
+		if dup {
+			return
+		}
+		// 报告输出
+		m.ReportOutput(1)
+		forwarded++
 
-				if m.nextModule != nil {
-					select {
-					case <-m.ctx.Done():
-						goto cleanup
-					case m.nextModule.GetInput() <- urlResult:
+		if m.nextModule != nil {
+			select {
+			case <-m.ctx.Done():
+			case m.nextModule.GetInput() <- urlResult:
+			}
+		}
+	}
+	// 批量扫描耗时较长，结果不等待整批完成：每组的结果缓存到超过阈值（整组按软 404 处理），
+	// 或者一段时间内没有同组的新结果时转发
+	filter := m.newSoftNotFoundFilter()
+	stopFlush := make(chan struct{})
+	var flushWg sync.WaitGroup
+	if filter != nil {
+		flushWg.Add(1)
+		go func() {
+			defer flushWg.Done()
+			ticker := time.NewTicker(SoftNotFoundHold / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopFlush:
+					return
+				case <-ticker.C:
+					for _, r := range filter.FlushIdle(SoftNotFoundHold) {
+						forward(r)
 					}
 				}
 			}
+		}()
+	}
+	result, err := scanner.ScanBatchStream(ctx, urlsToScan, m.wordlist, func(entry webscan.SprayEntry) {
+		if entry.StatusCode == 429 {
+			if u, err := url.Parse(entry.URL); err == nil {
+				if work, ok := works[strings.ToLower(u.Hostname())]; ok {
+					m.ipScheduler.Observe(work.Host, work.IP, entry.StatusCode, "")
+				}
+			}
 		}
+		urlResult, ok := sprayURLResult(entry, entry.Host, m.statusFilter)
+		if !ok {
+			return
+		}
+		for _, r := range m.filterSoftNotFound(filter, entry, urlResult) {
+			forward(r)
+		}
+	})
+	close(stopFlush)
+	flushWg.Wait()
+	if filter != nil {
+		for _, r := range filter.Flush() {
+			forward(r)
+		}
+	}
+	if err != nil {
+		log.Printf("[%s] Spray batch scan error: %v", m.name, err)
+		m.emitTargetError("spray", fmt.Sprintf("%d 个 URL", len(urlsToScan)), err)
+	}
+	if result != nil {
+		log.Printf("[%s] Spray found %d results, forwarded %d", m.name, len(result.Results), forwarded)
 	}
+	return m.ctx.Err() == nil
+}
 
-cleanup:
-	if m.nextModule != nil {
-		m.nextModule.CloseInput()
+// sprayURLResult 将 Spray 结果转换为 UrlResult
+// 只保留 status 接受的状态码（nil 为默认: 2xx、3xx、401、403、405、500），401/403/405/500 标记 Interesting；
+// 根路径（只有域名没有具体路径）只在状态码需要关注时保留，例如整站 401
+func sprayURLResult(entry webscan.SprayEntry, input string, status *DirScanStatusFilter) (UrlResult, bool) {
+	interesting := IsInterestingStatus(entry.StatusCode)
+	isRootPath := entry.Path == "" || entry.Path == "/"
+	if !status.Accept(entry.StatusCode) || (isRootPath && !interesting) {
+		return UrlResult{}, false
 	}
-	nextModuleRun.Wait()
-	return nil
+
+	// spray 的 url 可能只有目标地址，标准化地址和签名按拼接路径后的完整 URL 计算
+	full := sprayEntryURL(entry)
+	return UrlResult{
+		Input:         input,
+		Output:        entry.URL,
+		Source:        "dirscan",
+		Method:        "GET",
+		StatusCode:    entry.StatusCode,
+		ContentType:   entry.ContentType,
+		Length:        entry.BodyLength,
+		NormalizedURL: NormalizeURL(full),
+		Signature:     URLSignature(full),
+		Interesting:   interesting,
+	}, true
+}
+
+// sprayEntryURL Spray 结果的完整 URL：url 字段没有路径时拼接 path
+func sprayEntryURL(entry webscan.SprayEntry) string {
+	u, err := url.Parse(entry.URL)
+	if err != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return entry.URL
+	}
+	return strings.TrimRight(entry.URL, "/") + "/" + strings.TrimLeft(entry.Path, "/")
 }
 
 // runStreamMode 流式模式：逐个URL扫描
@@ -748,6 +1119,11 @@ func (m *DirScanModule) runStreamMode() error {
 			allWg.Add(1)
 			go func(a AssetHttp) {
 				defer allWg.Done()
+				release, ok := m.ipScheduler.Acquire(m.ctx, a.Host, a.IP)
+				if !ok {
+					return
+				}
+				defer release()
 				sem <- struct{}{}
 				defer func() { <-sem }()
 				m.scanWithSpray(a)
@@ -765,9 +1141,14 @@ func (m *DirScanModule) scanWithSpray(asset AssetHttp) {
 	ctx, cancel := context.WithTimeout(m.ctx, 15*time.Minute)
 	defer cancel()
 
-	result, err := m.sprayScanner.ScanWithWordlist(ctx, target, m.wordlist)
+	scanner := m.sprayFor(asset.WAF != "")
+	if scanner != m.sprayScanner {
+		log.Printf("[%s] Spray threads lowered to %d for %s behind WAF %s", m.name, scanner.Concurrency, target, asset.WAF)
+	}
+	result, err := scanner.ScanWithWordlist(ctx, target, m.wordlist)
 	if err != nil {
 		log.Printf("[%s] Spray error for %s: %v", m.name, target, err)
+		m.emitTargetError("spray", target, err)
 		return
 	}
 
@@ -777,28 +1158,31 @@ func (m *DirScanModule) scanWithSpray(asset AssetHttp) {
 
 	log.Printf("[%s] Spray found %d paths for %s", m.name, len(result.Results), target)
 
+	var kept []UrlResult
+	filter := m.newSoftNotFoundFilter()
 	for _, entry := range result.Results {
-		// 输出有效的结果（排除根路径和无效状态码）
-		validStatus := (entry.StatusCode >= 200 && entry.StatusCode < 400) ||
-			entry.StatusCode == 401 || entry.StatusCode == 403
-		isRootPath := entry.Path == "" || entry.Path == "/"
-		
-		if validStatus && !isRootPath {
-			urlResult := UrlResult{
-				Input:       target,
-				Output:      entry.URL,
-				Source:      "dirscan",
-				Method:      "GET",
-				StatusCode:  entry.StatusCode,
-				ContentType: entry.ContentType,
-				Length:      entry.BodyLength,
-			}
+		urlResult, ok := sprayURLResult(entry, target, m.statusFilter)
+		if !ok {
+			continue
+		}
+		kept = append(kept, m.filterSoftNotFound(filter, entry, urlResult)...)
+	}
+	if filter != nil {
+		kept = append(kept, filter.Flush()...)
+	}
 
-			select {
-			case <-m.ctx.Done():
-				return
-			case m.resultChan <- urlResult:
-			}
+	for _, urlResult := range kept {
+		if m.dropOutOfScope(urlResult) {
+			continue
+		}
+		urlResult, dup := m.checkURL(urlResult)
+		if dup {
+			continue
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- urlResult:
 		}
 	}
 }
@@ -0,0 +1,490 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha1"
+	"hash/maphash"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 模块内去重存储
+// 小任务使用内存集合；大任务的集合可以放到 Redis（按任务和模块分键，任务结束时删除），
+// 或者 URL 改用布隆过滤器（允许少量误判为重复）。DuplicateChecker 的接口不变
+
+// 去重的条目类型
+const (
+	DedupKindSubdomain = "subdomain"
+	DedupKindPort      = "port"
+	DedupKindURL       = "url"
+)
+
+// 去重存储后端
+const (
+	DedupBackendMemory = "memory" // 进程内集合
+	DedupBackendRedis  = "redis"  // Redis 集合，未设置 Redis 时使用内存
+	DedupBackendBloom  = "bloom"  // URL 使用布隆过滤器，子域名和端口仍为内存集合
+)
+
+const (
+	// DefaultDedupMemoryLimit 未指定后端时，单个模块内存去重的条目数上限，超过后转为 Redis 或布隆过滤器
+	DefaultDedupMemoryLimit = 200000
+	// DefaultDedupBloomFPRate 布隆过滤器默认误判率
+	DefaultDedupBloomFPRate = 0.001
+	// DefaultDedupRedisTTL Redis 去重集合的过期时间，进程异常退出未能删除时由 Redis 清理
+	DefaultDedupRedisTTL = 24 * time.Hour
+
+	dedupBloomInitialCapacity = 100000
+	dedupRedisTimeout         = 3 * time.Second
+	dedupRedisBatchSize       = 1000
+	dedupRedisKeyPrefix       = "task:dedup:"
+)
+
+var dedupKinds = []string{DedupKindSubdomain, DedupKindPort, DedupKindURL}
+
+// DedupStore 去重存储
+type DedupStore interface {
+	// Add 记录 key，返回之前是否已存在
+	Add(kind, key string) bool
+	// Close 释放存储（删除 Redis 集合等）
+	Close() error
+}
+
+// dedupBulkLoader 可以批量导入条目的存储，内存存储超过上限迁移时使用
+type dedupBulkLoader interface {
+	load(kind string, keys []string)
+}
+
+// MemoryDedupStore 进程内集合
+type MemoryDedupStore struct {
+	sets  [3]sync.Map // 按 dedupKinds 顺序
+	count int64
+}
+
+// NewMemoryDedupStore 创建内存去重存储
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{}
+}
+
+func (s *MemoryDedupStore) set(kind string) *sync.Map {
+	switch kind {
+	case DedupKindSubdomain:
+		return &s.sets[0]
+	case DedupKindPort:
+		return &s.sets[1]
+	default:
+		return &s.sets[2]
+	}
+}
+
+// Add 记录 key，返回之前是否已存在
+func (s *MemoryDedupStore) Add(kind, key string) bool {
+	_, loaded := s.set(kind).LoadOrStore(key, true)
+	if !loaded {
+		atomic.AddInt64(&s.count, 1)
+	}
+	return loaded
+}
+
+// Len 已记录的条目数
+func (s *MemoryDedupStore) Len() int {
+	return int(atomic.LoadInt64(&s.count))
+}
+
+// Close 释放存储
+func (s *MemoryDedupStore) Close() error {
+	return nil
+}
+
+// keys 按类型列出已记录的条目
+func (s *MemoryDedupStore) keys(kind string) []string {
+	var keys []string
+	s.set(kind).Range(func(k, _ interface{}) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	return keys
+}
+
+// RedisDedupStore 按任务和模块分键的 Redis 集合，成员为条目的摘要
+// Redis 出错时改用内存集合，不影响扫描
+type RedisDedupStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+
+	expiring sync.Map // 已设置过期时间的集合
+	fallback *MemoryDedupStore
+	failed   int32
+}
+
+// NewRedisDedupStore 创建 Redis 去重存储，键为 task:dedup:<任务>:<模块>:<类型>
+// 创建时删除同名的旧集合（上次执行异常退出时遗留），ttl 为 0 时使用 DefaultDedupRedisTTL
+func NewRedisDedupStore(client *redis.Client, taskID, module string, ttl time.Duration) *RedisDedupStore {
+	if ttl <= 0 {
+		ttl = DefaultDedupRedisTTL
+	}
+	s := &RedisDedupStore{
+		client:   client,
+		prefix:   dedupRedisKeyPrefix + taskID + ":" + module + ":",
+		ttl:      ttl,
+		fallback: NewMemoryDedupStore(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dedupRedisTimeout)
+	defer cancel()
+	if err := client.Del(ctx, s.allKeys()...).Err(); err != nil {
+		s.fail(err)
+	}
+	return s
+}
+
+func (s *RedisDedupStore) allKeys() []string {
+	keys := make([]string, 0, len(dedupKinds))
+	for _, kind := range dedupKinds {
+		keys = append(keys, s.prefix+kind)
+	}
+	return keys
+}
+
+// fail Redis 出错后改用内存集合
+func (s *RedisDedupStore) fail(err error) {
+	if atomic.CompareAndSwapInt32(&s.failed, 0, 1) {
+		log.Printf("[Dedup] Redis dedup store %s unavailable, falling back to memory: %v", s.prefix, err)
+	}
+}
+
+// dedupDigest 条目摘要，长 URL 在 Redis 中也只占 16 字节
+func dedupDigest(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return string(sum[:16])
+}
+
+// Add 记录 key，返回之前是否已存在
+func (s *RedisDedupStore) Add(kind, key string) bool {
+	if atomic.LoadInt32(&s.failed) == 1 {
+		return s.fallback.Add(kind, key)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dedupRedisTimeout)
+	defer cancel()
+
+	setKey := s.prefix + kind
+	added, err := s.client.SAdd(ctx, setKey, dedupDigest(key)).Result()
+	if err != nil {
+		s.fail(err)
+		return s.fallback.Add(kind, key)
+	}
+	s.expire(ctx, setKey)
+	return added == 0
+}
+
+// expire 集合第一次写入时设置过期时间
+func (s *RedisDedupStore) expire(ctx context.Context, setKey string) {
+	if _, loaded := s.expiring.LoadOrStore(setKey, true); !loaded {
+		s.client.Expire(ctx, setKey, s.ttl)
+	}
+}
+
+// load 批量导入条目
+func (s *RedisDedupStore) load(kind string, keys []string) {
+	setKey := s.prefix + kind
+	for start := 0; start < len(keys); start += dedupRedisBatchSize {
+		end := start + dedupRedisBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		members := make([]interface{}, 0, end-start)
+		for _, key := range keys[start:end] {
+			members = append(members, dedupDigest(key))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dedupRedisTimeout)
+		err := s.client.SAdd(ctx, setKey, members...).Err()
+		if err == nil {
+			s.expire(ctx, setKey)
+		}
+		cancel()
+		if err != nil {
+			s.fail(err)
+			for _, key := range keys {
+				s.fallback.Add(kind, key)
+			}
+			return
+		}
+	}
+}
+
+// Close 删除任务的去重集合
+func (s *RedisDedupStore) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dedupRedisTimeout)
+	defer cancel()
+	return s.client.Del(ctx, s.allKeys()...).Err()
+}
+
+// BloomDedupStore URL 使用布隆过滤器，子域名和端口数量有限，仍为内存集合
+type BloomDedupStore struct {
+	exact *MemoryDedupStore
+	urls  *scalableBloom
+}
+
+// NewBloomDedupStore 创建布隆过滤器去重存储，fpRate 为 URL 的误判率（误判时按重复丢弃）
+func NewBloomDedupStore(fpRate float64) *BloomDedupStore {
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = DefaultDedupBloomFPRate
+	}
+	return &BloomDedupStore{
+		exact: NewMemoryDedupStore(),
+		urls:  newScalableBloom(dedupBloomInitialCapacity, fpRate),
+	}
+}
+
+// Add 记录 key，返回之前是否已存在
+func (s *BloomDedupStore) Add(kind, key string) bool {
+	if kind == DedupKindURL {
+		return s.urls.add(key)
+	}
+	return s.exact.Add(kind, key)
+}
+
+// load 批量导入条目
+func (s *BloomDedupStore) load(kind string, keys []string) {
+	for _, key := range keys {
+		s.Add(kind, key)
+	}
+}
+
+// Close 释放存储
+func (s *BloomDedupStore) Close() error {
+	return nil
+}
+
+// scalableBloom 可扩容的布隆过滤器，当前层写满后追加一层容量翻倍、误判率减半的过滤器，
+// 总误判率不超过初始误判率的两倍
+type scalableBloom struct {
+	mu     sync.Mutex
+	seeds  [2]maphash.Seed
+	layers []*bloomLayer
+	fpRate float64
+}
+
+// bloomLayer 单层布隆过滤器
+type bloomLayer struct {
+	bits     []uint64
+	m        uint64 // 位数
+	k        uint64 // 哈希函数个数
+	count    uint64
+	capacity uint64
+}
+
+func newScalableBloom(capacity uint64, fpRate float64) *scalableBloom {
+	b := &scalableBloom{
+		seeds:  [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()},
+		fpRate: fpRate,
+	}
+	b.layers = append(b.layers, newBloomLayer(capacity, fpRate))
+	return b
+}
+
+// newBloomLayer 按容量和误判率计算位数和哈希函数个数
+func newBloomLayer(capacity uint64, fpRate float64) *bloomLayer {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomLayer{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// add 记录 key，返回之前是否（可能）已存在
+func (b *scalableBloom) add(key string) bool {
+	h1 := maphash.String(b.seeds[0], key)
+	h2 := maphash.String(b.seeds[1], key) | 1
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, layer := range b.layers {
+		if layer.test(h1, h2) {
+			return true
+		}
+	}
+	last := b.layers[len(b.layers)-1]
+	if last.count >= last.capacity {
+		rate := b.fpRate / math.Pow(2, float64(len(b.layers)))
+		last = newBloomLayer(last.capacity*2, rate)
+		b.layers = append(b.layers, last)
+	}
+	last.set(h1, h2)
+	return false
+}
+
+func (l *bloomLayer) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < l.k; i++ {
+		pos := (h1 + i*h2) % l.m
+		if l.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) set(h1, h2 uint64) {
+	for i := uint64(0); i < l.k; i++ {
+		pos := (h1 + i*h2) % l.m
+		l.bits[pos/64] |= 1 << (pos % 64)
+	}
+	l.count++
+}
+
+// TieredDedupStore 先使用内存集合，条目数超过上限后迁移到 large 创建的存储
+type TieredDedupStore struct {
+	mu     sync.RWMutex
+	memory *MemoryDedupStore
+	large  DedupStore
+	limit  int
+	create func() DedupStore
+}
+
+// NewTieredDedupStore 创建分级去重存储，limit 为内存集合的条目数上限
+func NewTieredDedupStore(limit int, create func() DedupStore) *TieredDedupStore {
+	return &TieredDedupStore{
+		memory: NewMemoryDedupStore(),
+		limit:  limit,
+		create: create,
+	}
+}
+
+// Add 记录 key，返回之前是否已存在
+func (s *TieredDedupStore) Add(kind, key string) bool {
+	s.mu.RLock()
+	if s.large != nil {
+		defer s.mu.RUnlock()
+		return s.large.Add(kind, key)
+	}
+	loaded := s.memory.Add(kind, key)
+	over := !loaded && s.memory.Len() > s.limit
+	s.mu.RUnlock()
+
+	if over {
+		s.migrate()
+	}
+	return loaded
+}
+
+// migrate 将内存集合中的条目导入新存储，之后不再使用内存集合
+func (s *TieredDedupStore) migrate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.large != nil {
+		return
+	}
+
+	large := s.create()
+	for _, kind := range dedupKinds {
+		keys := s.memory.keys(kind)
+		if loader, ok := large.(dedupBulkLoader); ok {
+			loader.load(kind, keys)
+			continue
+		}
+		for _, key := range keys {
+			large.Add(kind, key)
+		}
+	}
+	log.Printf("[Dedup] Memory dedup set exceeded %d entries, switched to %T", s.limit, large)
+	s.large = large
+	s.memory = nil
+}
+
+// Close 释放存储
+func (s *TieredDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.large != nil {
+		return s.large.Close()
+	}
+	return nil
+}
+
+// dedupStoreSet 按流水线配置为各模块创建去重存储，流水线结束时统一释放
+type dedupStoreSet struct {
+	mu     sync.Mutex
+	stores []DedupStore
+
+	backend string
+	limit   int
+	fpRate  float64
+	redis   *redis.Client
+	taskID  string
+}
+
+// newDedupStoreSet 按配置创建，redis 为 nil 时 Redis 后端使用内存集合
+func newDedupStoreSet(config *PipelineConfig, taskID string, client *redis.Client) *dedupStoreSet {
+	limit := config.DedupMemoryLimit
+	if limit == 0 {
+		limit = DefaultDedupMemoryLimit
+	}
+	if config.DedupBackend == DedupBackendRedis && client == nil {
+		log.Printf("[Dedup] Redis dedup backend requested but no Redis client configured, using memory")
+	}
+	return &dedupStoreSet{
+		backend: config.DedupBackend,
+		limit:   limit,
+		fpRate:  config.DedupBloomFPRate,
+		redis:   client,
+		taskID:  taskID,
+	}
+}
+
+// create 为模块创建去重存储
+func (s *dedupStoreSet) create(module string) DedupStore {
+	var store DedupStore
+	switch s.backend {
+	case DedupBackendMemory:
+		store = NewMemoryDedupStore()
+	case DedupBackendRedis:
+		if s.redis == nil {
+			store = NewMemoryDedupStore()
+		} else {
+			store = NewRedisDedupStore(s.redis, s.taskID, module, 0)
+		}
+	case DedupBackendBloom:
+		store = NewBloomDedupStore(s.fpRate)
+	default:
+		// 未指定时先用内存，超过上限后转为 Redis（已设置）或布隆过滤器；上限为负数时不切换
+		if s.limit < 0 {
+			store = NewMemoryDedupStore()
+			break
+		}
+		store = NewTieredDedupStore(s.limit, func() DedupStore {
+			if s.redis != nil {
+				return NewRedisDedupStore(s.redis, s.taskID, module, 0)
+			}
+			return NewBloomDedupStore(s.fpRate)
+		})
+	}
+
+	s.mu.Lock()
+	s.stores = append(s.stores, store)
+	s.mu.Unlock()
+	return store
+}
+
+// close 释放所有模块的去重存储
+func (s *dedupStoreSet) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, store := range s.stores {
+		if err := store.Close(); err != nil {
+			log.Printf("[Dedup] Failed to release dedup store: %v", err)
+		}
+	}
+	s.stores = nil
+}
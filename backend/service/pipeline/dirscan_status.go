@@ -0,0 +1,50 @@
+package pipeline
+
+// interestingStatus 需要重点关注的状态码：未授权、禁止访问、方法不允许、服务器错误
+var interestingStatus = map[int]bool{401: true, 403: true, 405: true, 500: true}
+
+// DefaultDirScanStatus 目录扫描默认保留的状态码：2xx、3xx 以及 401、403、405、500
+func DefaultDirScanStatus() []int {
+	codes := make([]int, 0, 204)
+	for code := 200; code < 400; code++ {
+		codes = append(codes, code)
+	}
+	return append(codes, 401, 403, 405, 500)
+}
+
+// IsInterestingStatus 状态码是否需要在结果中标记 interesting
+func IsInterestingStatus(code int) bool {
+	return interestingStatus[code]
+}
+
+// DirScanStatusFilter 目录扫描的状态码过滤
+type DirScanStatusFilter struct {
+	include map[int]bool
+	exclude map[int]bool
+}
+
+// NewDirScanStatusFilter 创建状态码过滤：include 为空时使用默认状态码，exclude 从中排除
+func NewDirScanStatusFilter(include, exclude []int) *DirScanStatusFilter {
+	if len(include) == 0 {
+		include = DefaultDirScanStatus()
+	}
+	f := &DirScanStatusFilter{
+		include: make(map[int]bool, len(include)),
+		exclude: make(map[int]bool, len(exclude)),
+	}
+	for _, code := range include {
+		f.include[code] = true
+	}
+	for _, code := range exclude {
+		f.exclude[code] = true
+	}
+	return f
+}
+
+// Accept 状态码是否保留，nil 过滤器按默认状态码判断
+func (f *DirScanStatusFilter) Accept(code int) bool {
+	if f == nil {
+		return (code >= 200 && code < 400) || interestingStatus[code]
+	}
+	return f.include[code] && !f.exclude[code]
+}
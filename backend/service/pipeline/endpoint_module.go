@@ -0,0 +1,218 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/webscan"
+)
+
+// DefaultEndpointConcurrency 同时获取的文档数
+const DefaultEndpointConcurrency = 5
+
+// EndpointModule 接口提取模块
+// 接收爬虫和目录扫描发现的 URL，原样传递给下一个模块；OpenAPI/Swagger 文档按路径和方法输出接口（Source 为 openapi），
+// JS 文件按正则提取相对路径并相对资产地址解析（Source 为 jsfinder）。提取到的接口记录来源文档（Parent），
+// 与爬虫、目录扫描共用 URL 去重器，已发现的地址不重复输出
+type EndpointModule struct {
+	BaseModule
+	extractor   *webscan.EndpointExtractor
+	concurrency int
+	resultChan  chan interface{}
+}
+
+// NewEndpointModule 创建接口提取模块
+func NewEndpointModule(ctx context.Context, nextModule ModuleRunner, concurrency int) *EndpointModule {
+	if concurrency <= 0 {
+		concurrency = DefaultEndpointConcurrency
+	}
+
+	return &EndpointModule{
+		BaseModule: BaseModule{
+			name:       "EndpointExtraction",
+			ctx:        ctx,
+			nextModule: nextModule,
+			dupChecker: NewDuplicateChecker(),
+		},
+		extractor:   webscan.NewEndpointExtractor(),
+		concurrency: concurrency,
+		resultChan:  make(chan interface{}, 500),
+	}
+}
+
+// SetExtractor 设置接口提取器
+func (m *EndpointModule) SetExtractor(extractor *webscan.EndpointExtractor) {
+	m.extractor = extractor
+}
+
+// SetMaxBodySize 设置获取文档的大小上限(字节)，0 保持默认值
+func (m *EndpointModule) SetMaxBodySize(size int64) {
+	if size > 0 && m.extractor != nil {
+		m.extractor.MaxBodySize = size
+	}
+}
+
+// EndpointDocKind URL 结果是否为需要提取接口的文档，返回 openapi、jsfinder 或空字符串
+// OpenAPI 文档要求路径匹配且内容类型为 JSON（爬虫未记录内容类型时也尝试）
+func EndpointDocKind(r UrlResult) string {
+	if r.Output == "" || r.StateChanging || (r.Method != "" && !strings.EqualFold(r.Method, "GET")) {
+		return ""
+	}
+	contentType := strings.ToLower(r.ContentType)
+	if webscan.IsAPISpecURL(r.Output) && (contentType == "" || strings.Contains(contentType, "json")) {
+		return "openapi"
+	}
+	if webscan.IsJavaScriptURL(r.Output, r.ContentType) {
+		return "jsfinder"
+	}
+	return ""
+}
+
+// ModuleRun 运行模块
+func (m *EndpointModule) ModuleRun() error {
+	m.ReportModuleStart(0)
+	defer m.ReportModuleComplete()
+
+	var allWg sync.WaitGroup
+	var resultWg sync.WaitGroup
+	var nextModuleRun sync.WaitGroup
+
+	sem := make(chan struct{}, m.concurrency)
+
+	// 启动下一个模块
+	if m.nextModule != nil {
+		nextModuleRun.Add(1)
+		go func() {
+			defer nextModuleRun.Done()
+			if err := m.nextModule.ModuleRun(); err != nil {
+				log.Printf("[%s] Next module error: %v", m.name, err)
+			}
+		}()
+	}
+
+	// 结果处理协程
+	resultWg.Add(1)
+	go func() {
+		defer resultWg.Done()
+		for result := range m.resultChan {
+			if m.nextModule != nil {
+				select {
+				case <-m.ctx.Done():
+					return
+				case m.nextModule.GetInput() <- result:
+				}
+			}
+		}
+		if m.nextModule != nil {
+			m.nextModule.CloseInput()
+		}
+	}()
+
+	finish := func() error {
+		allWg.Wait()
+		close(m.resultChan)
+		resultWg.Wait()
+		nextModuleRun.Wait()
+		return nil
+	}
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return finish()
+
+		case data, ok := <-m.input:
+			if !ok {
+				log.Printf("[%s] Input closed, waiting for extractions", m.name)
+				return finish()
+			}
+
+			// 先传递原始数据到下一个模块
+			select {
+			case <-m.ctx.Done():
+				return finish()
+			case m.resultChan <- data:
+			}
+
+			doc, ok := data.(UrlResult)
+			if !ok {
+				continue
+			}
+			kind := EndpointDocKind(doc)
+			// 同一文档只获取一次（与接口去重分开记录，文档本身已由发现它的模块输出）
+			if kind == "" || m.dupChecker.IsURLDuplicate("doc "+NormalizeURL(doc.Output)) {
+				continue
+			}
+
+			allWg.Add(1)
+			go func(doc UrlResult, kind string) {
+				defer allWg.Done()
+				select {
+				case <-m.ctx.Done():
+					return
+				case sem <- struct{}{}:
+				}
+				defer func() { <-sem }()
+				m.extract(doc, kind)
+			}(doc, kind)
+		}
+	}
+}
+
+// extract 获取文档并输出提取到的接口
+func (m *EndpointModule) extract(doc UrlResult, kind string) {
+	ctx, cancel := context.WithTimeout(m.ctx, 60*time.Second)
+	defer cancel()
+
+	body, contentType, err := m.extractor.Fetch(ctx, doc.Output)
+	if err != nil {
+		if m.ctx.Err() == nil {
+			log.Printf("[%s] Failed to fetch %s: %v", m.name, doc.Output, err)
+		}
+		return
+	}
+
+	var endpoints []webscan.ExtractedEndpoint
+	switch kind {
+	case "openapi":
+		endpoints, err = webscan.ParseOpenAPI(body, doc.Output)
+		if err != nil {
+			log.Printf("[%s] Failed to parse %s (%s): %v", m.name, doc.Output, contentType, err)
+			return
+		}
+	case "jsfinder":
+		base := doc.Input
+		if base == "" {
+			base = doc.Output
+		}
+		endpoints = webscan.ExtractJSEndpoints(body, base)
+	}
+
+	emitted := 0
+	for _, endpoint := range endpoints {
+		result, dup := m.checkURL(UrlResult{
+			Input:         doc.Input,
+			Output:        endpoint.URL,
+			Source:        kind,
+			Method:        endpoint.Method,
+			Parent:        doc.Output,
+			StateChanging: webscan.IsStateChanging(endpoint.Method, endpoint.URL, ""),
+		})
+		if dup {
+			continue
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- result:
+			emitted++
+		}
+	}
+	if emitted > 0 {
+		m.ReportOutput(emitted)
+	}
+	log.Printf("[%s] Extracted %d endpoints from %s (%d new)", m.name, len(endpoints), doc.Output, emitted)
+}
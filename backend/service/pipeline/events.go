@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/subdomain"
+)
+
+// 任务事件
+// 模块开始/结束、工具不可用跳过、单个目标扫描出错等原本只写到服务端日志的信息，
+// 以结构化事件交给执行器保存，用户可以在界面上看到某个模块为什么没有结果
+
+// 事件级别
+const (
+	EventLevelInfo  = "info"
+	EventLevelWarn  = "warn"
+	EventLevelError = "error"
+)
+
+// 事件类型
+const (
+	EventModuleStart        = "module_start"
+	EventModuleComplete     = "module_complete"
+	EventModuleTimeout      = "module_timeout"      // 模块超过配置的运行时长，已停止
+	EventModuleControl      = "module_control"      // 任务运行中跳过、停止模块或调整模块并发
+	EventToolUnavailable    = "tool_unavailable"    // 外部工具不可用，模块跳过
+	EventDegraded           = "degraded_mode"       // 外部工具不可用，改用功能较少的内置实现继续扫描
+	EventNetworkUnsupported = "network_unsupported" // 外部工具不支持配置的代理或 DNS 设置，该设置对此工具不生效
+	EventQuotaExhausted     = "quota_exhausted"     // 第三方数据源配额耗尽，本任务不再调用该数据源
+	EventTargetError        = "target_error"        // 单个目标扫描出错
+	EventWildcard           = "wildcard"            // 检测到泛解析，记录过滤的子域名数
+	EventOutOfScope         = "out_of_scope"        // 模块丢弃的超出扫描范围的数据数量
+	EventToolCommand        = "tool_command"        // 外部工具的调用参数（已脱敏），用于确认任务的过滤条件已生效
+	EventOriginBackoff      = "origin_backoff"      // IP 频繁返回 429 或重置连接，并发上限已减半
+	EventBackpressure       = "backpressure"        // 模块输入通道持续接近满，下游处理或结果入库较慢
+	EventHeadersUnsupported = "headers_unsupported" // 外部工具不支持自定义请求头，其请求不带认证信息
+	EventAuthPreflight      = "auth_preflight"      // 认证预检：带和不带自定义请求头的响应比较，会话可能失效时为警告
+	EventCancelled          = "cancelled"
+)
+
+// Event 流水线事件
+type Event struct {
+	Time    time.Time              `json:"timestamp"`
+	Module  string                 `json:"module"`
+	Level   string                 `json:"level"`
+	Type    string                 `json:"type"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventRecorder 事件记录器（流水线共用），nil 或未设置处理函数时不记录
+type EventRecorder struct {
+	mu      sync.RWMutex
+	handler func(Event)
+}
+
+// NewEventRecorder 创建事件记录器
+func NewEventRecorder() *EventRecorder {
+	return &EventRecorder{}
+}
+
+// SetHandler 设置事件处理函数，处理函数需要尽快返回
+func (r *EventRecorder) SetHandler(handler func(Event)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handler = handler
+}
+
+// Emit 记录事件
+func (r *EventRecorder) Emit(module, level, eventType, message string, data map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	handler := r.handler
+	r.mu.RUnlock()
+	if handler == nil {
+		return
+	}
+	handler(Event{
+		Time:    time.Now(),
+		Module:  module,
+		Level:   level,
+		Type:    eventType,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// eventEmitter 可以记录事件的模块
+type eventEmitter interface {
+	SetEventRecorder(recorder *EventRecorder)
+}
+
+// SetEventRecorder 设置事件记录器（流水线共用）
+func (m *BaseModule) SetEventRecorder(recorder *EventRecorder) {
+	m.events = recorder
+}
+
+// emitToolUnavailable 外部工具不可用，模块跳过
+func (m *BaseModule) emitToolUnavailable(tool string) {
+	m.events.Emit(m.name, EventLevelWarn, EventToolUnavailable, tool+" 不可用，已跳过", map[string]interface{}{"tool": tool})
+}
+
+// emitDegraded 外部工具不可用，改用内置实现 fallback 继续，limits 说明降级后缺少的能力
+func (m *BaseModule) emitDegraded(tool, fallback, limits string) {
+	m.events.Emit(m.name, EventLevelWarn, EventDegraded,
+		fmt.Sprintf("%s 不可用，使用%s（%s）", tool, fallback, limits), map[string]interface{}{
+			"tool":     tool,
+			"fallback": fallback,
+		})
+}
+
+// emitQuotaExhausted 第三方数据源配额耗尽，本任务剩余的根域名不再查询该数据源
+func (m *BaseModule) emitQuotaExhausted(provider string, reason error) {
+	m.events.Emit(m.name, EventLevelWarn, EventQuotaExhausted,
+		fmt.Sprintf("%s 配额已耗尽，本任务不再调用该数据源（%v）", provider, reason), map[string]interface{}{
+			"provider": provider,
+		})
+}
+
+// emitNetworkUnsupported 外部工具不支持配置的代理或 DNS 设置，options 为空时不记录
+func (m *BaseModule) emitNetworkUnsupported(tool string, options []string) {
+	if len(options) == 0 {
+		return
+	}
+	log.Printf("[%s] %s does not support network options %v, using system network for them", m.name, tool, options)
+	m.events.Emit(m.name, EventLevelWarn, EventNetworkUnsupported,
+		fmt.Sprintf("%s 不支持 %s 设置，对应请求使用系统网络", tool, strings.Join(options, "、")), map[string]interface{}{
+			"tool":    tool,
+			"options": options,
+		})
+}
+
+// emitWildcard 检测到泛解析时记录泛解析 IP 池和过滤的子域名数
+func (m *BaseModule) emitWildcard(pool *subdomain.WildcardPool) {
+	if !pool.Detected() {
+		return
+	}
+	m.events.Emit(m.name, EventLevelInfo, EventWildcard,
+		fmt.Sprintf("%s 存在泛解析，过滤 %d 个子域名", pool.Domain, pool.Filtered()), map[string]interface{}{
+			"domain":         pool.Domain,
+			"wildcard_ips":   pool.IPs(),
+			"wildcard_cname": pool.CNAME,
+			"filtered":       pool.Filtered(),
+			"http_kept":      pool.Confirmed(),
+			"confidence":     pool.AverageConfidence(),
+		})
+}
+
+// emitTargetError 单个目标扫描出错，任务取消导致的错误不记录
+func (m *BaseModule) emitTargetError(tool, target string, err error) {
+	if m.ctx != nil && m.ctx.Err() != nil {
+		return
+	}
+	m.events.Emit(m.name, EventLevelError, EventTargetError, tool+" 扫描 "+target+" 出错", map[string]interface{}{
+		"tool":   tool,
+		"target": target,
+		"error":  err.Error(),
+	})
+}
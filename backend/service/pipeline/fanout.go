@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// 模块扇出
+// TeeModule 把上游数据复制给多个并行的分支模块（如爬虫和目录扫描），每个分支有独立的输入通道；
+// 分支的输出和上游数据经合并阶段汇总到同一个下游模块。
+//
+//	Fingerprint -> FanOut ─┬─> Crawler ─┬─> merge -> Sensitive -> ResultCollector
+//	                       ├─> DirScan ─┤
+//	                       └────────────┘ 上游数据直接旁路到合并阶段
+//
+// 分支只接收 Accept 选中的数据，上游数据已经旁路到下游，分支转发回来的同类数据在合并时丢弃，
+// 这样下游不会收到重复的资产。分支的输入是有界通道，发送时同时等待 ctx 和分支退出：
+// 某个分支慢时只在它的缓冲区满后阻塞，分支退出（如工具不可用）后不再给它发送数据。
+
+// TeeBranch 扇出分支
+type TeeBranch struct {
+	Module ModuleRunner                // 分支模块，nextModule 为 AddBranch 提供的合并输入
+	Accept func(data interface{}) bool // 分发给分支的数据，nil 表示全部
+	output *mergeInput
+}
+
+// TeeModule 扇出模块
+type TeeModule struct {
+	BaseModule
+	branches []*TeeBranch
+	merge    *mergeStage
+}
+
+// NewTeeModule 创建扇出模块，nextModule 接收合并后的输出
+func NewTeeModule(ctx context.Context, nextModule ModuleRunner) *TeeModule {
+	m := &TeeModule{
+		BaseModule: BaseModule{
+			name:       "FanOut",
+			ctx:        ctx,
+			nextModule: nextModule,
+		},
+		merge: &mergeStage{ctx: ctx, next: nextModule},
+	}
+	// 第一个合并输入用于旁路上游数据
+	m.merge.add("FanOut", nil)
+	return m
+}
+
+// AddBranch 添加分支，build 接收分支的下游（合并输入）并返回分支模块
+func (m *TeeModule) AddBranch(accept func(data interface{}) bool, build func(next ModuleRunner) ModuleRunner) ModuleRunner {
+	branch := &TeeBranch{Accept: accept}
+	branch.output = m.merge.add(fmt.Sprintf("FanOut[%d]", len(m.branches)+1), accept)
+	branch.Module = build(branch.output)
+	m.branches = append(m.branches, branch)
+	return branch.Module
+}
+
+// Branches 获取所有分支模块
+func (m *TeeModule) Branches() []ModuleRunner {
+	modules := make([]ModuleRunner, 0, len(m.branches))
+	for _, b := range m.branches {
+		modules = append(modules, b.Module)
+	}
+	return modules
+}
+
+// ModuleRun 运行模块
+func (m *TeeModule) ModuleRun() error {
+	var wg sync.WaitGroup
+
+	// 合并阶段负责启动和关闭下游模块
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.merge.run()
+	}()
+
+	// 启动所有分支，分支退出后关闭它的合并输入，防止分支异常退出时合并阶段一直等待；
+	// ctx 取消时合并阶段自行退出，不关闭输入，避免分支中仍在发送的协程向已关闭的通道写入
+	done := make([]chan struct{}, len(m.branches))
+	for i, b := range m.branches {
+		done[i] = make(chan struct{})
+		wg.Add(1)
+		go func(b *TeeBranch, done chan struct{}) {
+			defer wg.Done()
+			defer close(done)
+			defer func() {
+				if m.ctx.Err() == nil {
+					b.output.CloseInput()
+				}
+			}()
+			if err := b.Module.ModuleRun(); err != nil {
+				log.Printf("[%s] Branch %s error: %v", m.name, b.Module.GetName(), err)
+			}
+		}(b, done[i])
+	}
+
+	log.Printf("[%s] Started with %d branches", m.name, len(m.branches))
+
+	defer func() {
+		m.merge.inputs[0].CloseInput()
+		for _, b := range m.branches {
+			b.Module.CloseInput()
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case data, ok := <-m.input:
+			if !ok {
+				log.Printf("[%s] Input closed, closing branches", m.name)
+				return nil
+			}
+
+			select {
+			case <-m.ctx.Done():
+				return nil
+			case m.merge.inputs[0].ch <- data:
+			}
+
+			for i, b := range m.branches {
+				if b.Accept != nil && !b.Accept(data) {
+					continue
+				}
+				select {
+				case <-m.ctx.Done():
+					return nil
+				case <-done[i]:
+					// 分支已退出，不再发送
+				case b.Module.GetInput() <- data:
+				}
+			}
+		}
+	}
+}
+
+// mergeStage 合并阶段，把多个输入汇总到下游模块，所有输入关闭后关闭下游输入
+type mergeStage struct {
+	ctx    context.Context
+	next   ModuleRunner
+	inputs []*mergeInput
+}
+
+// add 添加合并输入，drop 选中的数据不转发
+func (s *mergeStage) add(name string, drop func(data interface{}) bool) *mergeInput {
+	in := &mergeInput{name: name, ch: make(chan interface{}, 500), drop: drop}
+	s.inputs = append(s.inputs, in)
+	return in
+}
+
+// run 启动下游模块并转发所有输入
+func (s *mergeStage) run() {
+	var nextModuleRun sync.WaitGroup
+	if s.next != nil {
+		nextModuleRun.Add(1)
+		go func() {
+			defer nextModuleRun.Done()
+			if err := s.next.ModuleRun(); err != nil {
+				log.Printf("[FanOut] Next module error: %v", err)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, in := range s.inputs {
+		wg.Add(1)
+		go func(in *mergeInput) {
+			defer wg.Done()
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case data, ok := <-in.ch:
+					if !ok {
+						return
+					}
+					if in.drop != nil && in.drop(data) {
+						continue
+					}
+					if s.next == nil {
+						continue
+					}
+					select {
+					case <-s.ctx.Done():
+						return
+					case s.next.GetInput() <- data:
+					}
+				}
+			}
+		}(in)
+	}
+	wg.Wait()
+
+	if s.next != nil {
+		s.next.CloseInput()
+	}
+	nextModuleRun.Wait()
+}
+
+// mergeInput 合并阶段的一个输入，作为分支模块的 nextModule
+// 合并阶段自己转发数据，分支调用的 ModuleRun 不做任何事
+type mergeInput struct {
+	name      string
+	ch        chan interface{}
+	drop      func(data interface{}) bool
+	closeOnce sync.Once
+}
+
+// ModuleRun 运行模块
+func (in *mergeInput) ModuleRun() error {
+	return nil
+}
+
+// SetInput 设置输入通道
+func (in *mergeInput) SetInput(ch chan interface{}) {
+	in.ch = ch
+}
+
+// GetInput 获取输入通道
+func (in *mergeInput) GetInput() chan interface{} {
+	return in.ch
+}
+
+// CloseInput 关闭输入通道，可重复调用
+func (in *mergeInput) CloseInput() {
+	in.closeOnce.Do(func() { close(in.ch) })
+}
+
+// GetName 获取模块名称
+func (in *mergeInput) GetName() string {
+	return in.name
+}
+
+// isAssetHttp 是否为 HTTP 资产
+func isAssetHttp(data interface{}) bool {
+	_, ok := data.(AssetHttp)
+	return ok
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import "time"
+
+// 故障注入（仅用于测试）
+// 通过 PipelineConfig.Faults 显式开启，默认为 nil，生产环境不会触发任何故障
+
+// ModuleFault 单个模块的故障配置
+type ModuleFault struct {
+	Module         string        // 模块名称，对应 GetName() 返回值
+	ErrorOnStart   bool          // 启动时直接返回错误，不运行模块
+	PanicAfter     int           // 转发 N 个数据后 panic（0 表示不启用）
+	Stall          time.Duration // 收到第一个数据后停顿的时长
+	Delay          time.Duration // 每个数据转发前停顿的时长（模拟处理慢的模块）
+	DropCloseInput bool          // 上游关闭输入时不再关闭模块的真实输入（模拟遗漏 CloseInput）
+}
+
+// FaultConfig 流水线故障注入配置
+type FaultConfig struct {
+	Faults []ModuleFault
+}
+
+// faultFor 查找指定模块的故障配置
+func (fc *FaultConfig) faultFor(name string) *ModuleFault {
+	if fc == nil {
+		return nil
+	}
+	for i := range fc.Faults {
+		if fc.Faults[i].Module == name {
+			return &fc.Faults[i]
+		}
+	}
+	return nil
+}
@@ -2,12 +2,13 @@ package pipeline
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"moongazing/scanner/core"
 	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/webscan"
 )
 
 // FingerprintModule 指纹识别模块
@@ -17,6 +18,9 @@ type FingerprintModule struct {
 	fingerprintScanner *fingerprint.FingerprintScanner
 	resultChan         chan interface{}
 	concurrency        int
+	limit              *concurrencyLimit    // 同时识别的目标数，运行中可调整
+	techs              *core.TechNormalizer // 任务级技术名称规范化器
+	httpProber         *webscan.HTTPProber  // 未识别服务端口的 HTTP 探测，nil 不探测
 }
 
 // NewFingerprintModule 创建指纹识别模块
@@ -35,10 +39,38 @@ func NewFingerprintModule(ctx context.Context, nextModule ModuleRunner, concurre
 		fingerprintScanner: fingerprint.NewFingerprintScanner(concurrency),
 		resultChan:         make(chan interface{}, 500),
 		concurrency:        concurrency,
+		limit:              newConcurrencyLimit(concurrency),
+		techs:              core.NewTaskTechNormalizer(),
 	}
 	return m
 }
 
+// SetTechNormalizer 设置技术名称规范化器（流水线共用，用于统计任务中未收录的名称）
+func (m *FingerprintModule) SetTechNormalizer(n *core.TechNormalizer) {
+	m.techs = n
+}
+
+// SetWAFProbe 设置是否主动探测 WAF：规则未识别出 WAF 时再发送一个带可疑参数的请求
+func (m *FingerprintModule) SetWAFProbe(enabled bool) {
+	m.fingerprintScanner.WAFProbe = enabled
+}
+
+// SetConcurrency 设置指纹识别并发数，0 保持默认值
+func (m *FingerprintModule) SetConcurrency(concurrency int) {
+	if concurrency > 0 {
+		m.concurrency = concurrency
+		m.fingerprintScanner.Concurrency = concurrency
+		m.limit.SetLimit(concurrency)
+	}
+}
+
+// AdjustConcurrency 运行中调整同时识别的目标数，正在识别的目标不受影响
+func (m *FingerprintModule) AdjustConcurrency(n int) int {
+	n = clampScanLimit("fingerprint concurrency", n, MaxHTTPConcurrency)
+	m.limit.SetLimit(n)
+	return m.limit.Limit()
+}
+
 // ModuleRun 运行模块
 func (m *FingerprintModule) ModuleRun() error {
 	var allWg sync.WaitGroup
@@ -49,9 +81,6 @@ func (m *FingerprintModule) ModuleRun() error {
 	m.ReportModuleStart(0)
 	defer m.ReportModuleComplete()
 
-	// 并发控制
-	sem := make(chan struct{}, m.concurrency)
-
 	// 启动下一个模块
 	if m.nextModule != nil {
 		nextModuleRun.Add(1)
@@ -126,8 +155,15 @@ func (m *FingerprintModule) ModuleRun() error {
 			allWg.Add(1)
 			go func(pa PortAlive) {
 				defer allWg.Done()
-				sem <- struct{}{}
-				defer func() { <-sem }()
+				release, ok := m.ipScheduler.Acquire(m.ctx, pa.Host, pa.IP)
+				if !ok {
+					return
+				}
+				defer release()
+				if !m.limit.Acquire(m.ctx) {
+					return
+				}
+				defer m.limit.Release()
 				m.scanFingerprint(pa)
 			}(portAlive)
 		}
@@ -139,13 +175,31 @@ func (m *FingerprintModule) scanFingerprint(pa PortAlive) {
 	// 构建目标URL
 	target := m.buildTarget(pa)
 
-	log.Printf("[%s] Scanning fingerprint for %s", m.name, target)
-
 	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
 	defer cancel()
 
+	// 未识别服务的端口先探测是否为 HTTP 服务，按探测到的协议识别指纹
+	if probed, ok := m.probeHTTP(ctx, pa); ok {
+		if probed == nil {
+			m.scanPortFingerprint(pa)
+			return
+		}
+		target = probed.URL
+	}
+
+	log.Printf("[%s] Scanning fingerprint for %s", m.name, target)
+
 	// 执行指纹扫描
 	result := m.fingerprintScanner.ScanFingerprint(ctx, target)
+	if result != nil {
+		m.ipScheduler.Observe(pa.Host, pa.IP, result.StatusCode, result.Error)
+	}
+
+	// 响应过慢的目标在本任务中不再继续探测
+	if result != nil && result.Error == fingerprint.ErrSlowResponse.Error() && result.StatusCode == 0 {
+		log.Printf("[%s] Skipping %s: %s", m.name, target, result.Error)
+		return
+	}
 
 	// 判断是否是有效的HTTP响应（StatusCode > 0 表示成功获取响应）
 	if result == nil || result.StatusCode == 0 {
@@ -159,15 +213,37 @@ func (m *FingerprintModule) scanFingerprint(pa PortAlive) {
 		Host:       pa.Host,
  		IP:         pa.IP,
 		Port:       pa.Port,
+		Family:     pa.Family,
 		URL:        result.URL,
 		Title:      result.Title,
 		StatusCode: result.StatusCode,
 		Server:     result.Server,
+
+		BodyHash:           result.BodyHash,
+		NormalizedBodyHash: result.NormalizedBodyHash,
+		BodyPreview:        result.BodyPreview,
+	}
+	if result.FinalURL != result.URL {
+		asset.FinalURL = result.FinalURL
+	}
+	if result.WAF != nil {
+		asset.WAF = result.WAF.Name
+		asset.WAFMethod = result.WAF.Method
+		log.Printf("[%s] %s is behind WAF %s (%s: %s)", m.name, target, result.WAF.Name, result.WAF.Method, result.WAF.Evidence)
+	}
+	if result.CrossOriginRedirect {
+		log.Printf("[%s] %s redirects to another host: %s", m.name, target, result.RedirectChain[len(result.RedirectChain)-1].Location)
 	}
 
-	// 提取技术栈
+	// 提取技术栈，按规范名称合并并保留版本号
 	if len(result.Technologies) > 0 {
-		asset.Technologies = result.Technologies
+		techs := m.techs.NewSet()
+		versions := result.TechVersions()
+		for _, name := range result.Technologies {
+			techs.AddVersion(name, versions[name])
+		}
+		asset.Technologies = techs.Names()
+		asset.TechVersions = techs.Versions()
 	}
 
 	// 提取指纹
@@ -209,10 +285,12 @@ func (m *FingerprintModule) scanPortFingerprint(pa PortAlive) {
 		Type:    "other",
 		Banner:  result.Banner,
 		Version: result.Version,
+
+		Fingerprints: result.Fingerprints,
 	}
 
-	log.Printf("[%s] Found non-HTTP asset: %s:%s (%s %s)",
-		m.name, pa.Host, pa.Port, result.Service, result.Version)
+	log.Printf("[%s] Found non-HTTP asset: %s:%s (%s %s, Fingerprints: %v)",
+		m.name, pa.Host, pa.Port, result.Service, result.Version, result.Fingerprints)
 
 	select {
 	case <-m.ctx.Done():
@@ -226,15 +304,15 @@ func (m *FingerprintModule) buildTarget(pa PortAlive) string {
 	port := pa.Port
 	host := pa.Host
 
-	// 根据端口判断协议
+	// 根据端口判断协议，IPv6 地址加方括号
 	switch port {
 	case "443", "8443", "9443":
-		return fmt.Sprintf("https://%s:%s", host, port)
+		return core.BuildURL("https", host, stringToInt(port))
 	case "80":
-		return fmt.Sprintf("http://%s", host)
+		return core.BuildURL("http", host, 0)
 	default:
 		// 默认尝试 HTTP
-		return fmt.Sprintf("http://%s:%s", host, port)
+		return core.BuildURL("http", host, stringToInt(port))
 	}
 }
 
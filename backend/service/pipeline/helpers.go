@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"strings"
 	"time"
 
 	"moongazing/models"
@@ -13,70 +12,14 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-// parseTargets 解析目标
-func (p *ScanPipeline) parseTargets() []string {
-	targets := p.task.Targets
-	result := make([]string, 0)
-
-	for _, target := range targets {
-		target = strings.TrimSpace(target)
-		if target == "" {
-			continue
-		}
-
-		// 处理 CIDR (如 192.168.1.0/24)
-		if strings.Contains(target, "/") {
-			expanded := expandCIDR(target)
-			result = append(result, expanded...)
-		} else {
-			result = append(result, target)
-		}
-	}
-
-	log.Printf("[Pipeline] Parsed %d targets", len(result))
-	return result
-}
-
-// expandCIDR 展开 CIDR 为单个 IP 地址列表
-func expandCIDR(cidr string) []string {
-	_, ipNet, err := net.ParseCIDR(cidr)
+// parseTargets 解析目标：网段、IP 范围和逗号列表按 ExpandTargets 展开，超过任务的目标数上限时返回错误
+func (p *ScanPipeline) parseTargets() ([]string, error) {
+	result, err := ExpandTargets(p.task.Targets, p.task.Config.MaxTargets)
 	if err != nil {
-		// 如果解析失败，返回原始字符串
-		log.Printf("[Pipeline] Failed to parse CIDR %s: %v", cidr, err)
-		return []string{cidr}
-	}
-
-	// 计算 CIDR 中的 IP 数量
-	ones, bits := ipNet.Mask.Size()
-	numIPs := 1 << (bits - ones)
-
-	// 限制扩展数量，防止 /8 这样的大网段耗尽内存
-	const maxCIDRExpand = 65536 // 最大扩展 /16 网段
-	if numIPs > maxCIDRExpand {
-		log.Printf("[Pipeline] CIDR %s too large (%d IPs), keeping as-is", cidr, numIPs)
-		return []string{cidr}
-	}
-
-	result := make([]string, 0, numIPs)
-	ip := ipNet.IP
-
-	for i := 0; i < numIPs; i++ {
-		result = append(result, ip.String())
-		incrementIP(ip)
-	}
-
-	log.Printf("[Pipeline] Expanded CIDR %s to %d IPs", cidr, len(result))
-	return result
-}
-
-// incrementIP 递增 IP 地址
-func incrementIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
-		}
+		return nil, err
 	}
+	log.Printf("[Pipeline] Parsed %d targets", len(result))
+	return result, nil
 }
 
 // calculateTotalSteps 计算总步骤数
@@ -134,10 +77,16 @@ func (p *ScanPipeline) completeTask() {
 	}
 
 	p.taskService.UpdateTask(p.task.ID.Hex(), map[string]interface{}{
-		"status":       models.TaskStatusCompleted,
-		"progress":     100,
-		"completed_at": time.Now(),
-		"result_stats": stats,
+		"status":             models.TaskStatusCompleted,
+		"progress":           100,
+		"completed_at":       time.Now(),
+		"result_stats":       stats,
+		"termination_reason": models.TerminationCompleted,
+		"termination": &models.TaskTermination{
+			Reason:   models.TerminationCompleted,
+			Progress: 100,
+			At:       time.Now(),
+		},
 	})
 
 	log.Printf("[Pipeline] Task %s completed with %d results", p.task.ID.Hex(), p.totalResults)
@@ -158,15 +107,21 @@ func (p *ScanPipeline) completeTask() {
 		"discovered_subdomains": len(p.discoveredSubdomains),
 		"targets":               p.task.Targets,
 	}
-	notify.GetGlobalManager().NotifyTaskComplete(p.task.Name, p.task.ID.Hex(), true, summary, notifyStats)
+	notify.GetGlobalManager().NotifyTaskComplete(p.task.WorkspaceID.Hex(), p.task.Name, p.task.ID.Hex(), true, summary, notifyStats)
 }
 
 // failTask 任务失败
 func (p *ScanPipeline) failTask(errMsg string) {
 	p.taskService.UpdateTask(p.task.ID.Hex(), map[string]interface{}{
-		"status":       models.TaskStatusFailed,
-		"completed_at": time.Now(),
-		"last_error":   errMsg,
+		"status":             models.TaskStatusFailed,
+		"completed_at":       time.Now(),
+		"last_error":         errMsg,
+		"termination_reason": models.TerminationModuleFailure,
+		"termination": &models.TaskTermination{
+			Reason:  models.TerminationModuleFailure,
+			Message: errMsg,
+			At:      time.Now(),
+		},
 	})
 
 	log.Printf("[Pipeline] Task %s failed: %s", p.task.ID.Hex(), errMsg)
@@ -177,7 +132,7 @@ func (p *ScanPipeline) failTask(errMsg string) {
 		"error":   errMsg,
 		"targets": p.task.Targets,
 	}
-	notify.GetGlobalManager().NotifyTaskComplete(p.task.Name, p.task.ID.Hex(), false, summary, stats)
+	notify.GetGlobalManager().NotifyTaskComplete(p.task.WorkspaceID.Hex(), p.task.Name, p.task.ID.Hex(), false, summary, stats)
 }
 
 // 辅助函数
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/webscan"
+)
+
+// 未识别服务端口的 HTTP 探测
+// gogo 对高位端口常常只输出 "tcp"，指纹识别按端口猜测协议，HTTPS 管理后台和非 HTTP 服务都要先走一遍完整的页面请求。
+// 指纹识别模块在 IP 调度槽位和并发限制内先探测一次（先 HTTPS 后 HTTP，结果在任务内按 host:port 缓存），
+// 是 HTTP 服务时按探测到的协议识别指纹，不是时直接做端口指纹识别
+
+// HTTPProbeConfig 端口 HTTP 探测配置，未设置的项使用 webscan.DefaultHTTPProbeConfig
+func (c *PipelineConfig) HTTPProbeConfig() webscan.HTTPProbeConfig {
+	probe := webscan.DefaultHTTPProbeConfig()
+	if c.PortHTTPProbe != nil {
+		probe.Enabled = *c.PortHTTPProbe
+	}
+	if c.PortHTTPProbeMinPort > 0 {
+		probe.MinPort = c.PortHTTPProbeMinPort
+	}
+	if c.PortHTTPProbeMaxPerHost > 0 {
+		probe.MaxPerHost = c.PortHTTPProbeMaxPerHost
+	}
+	// 并发由指纹识别模块的并发限制和 IP 调度控制
+	probe.Concurrency = MaxHTTPConcurrency
+	return probe
+}
+
+// SetHTTPProbe 设置未识别服务端口的 HTTP 探测，关闭时不探测
+func (m *FingerprintModule) SetHTTPProbe(config webscan.HTTPProbeConfig) {
+	if !config.Enabled {
+		m.httpProber = nil
+		return
+	}
+	m.httpProber = webscan.NewHTTPProber(config)
+}
+
+// probeHTTP 探测端口是否为 HTTP 服务，ok 为 false 表示端口不需要探测；
+// 超过主机探测上限的端口按非 HTTP 服务处理
+func (m *FingerprintModule) probeHTTP(ctx context.Context, pa PortAlive) (*webscan.HTTPProbeResult, bool) {
+	port := core.PortResult{Port: stringToInt(pa.Port), State: "open", Service: pa.Service}
+	if pa.Protocol == "udp" || !m.httpProber.ShouldProbe(port) {
+		return nil, false
+	}
+	result := m.httpProber.Probe(ctx, pa.Host, port.Port)
+	if result == nil {
+		log.Printf("[%s] %s:%s is not an HTTP service, using port fingerprint", m.name, pa.Host, pa.Port)
+	}
+	return result, true
+}
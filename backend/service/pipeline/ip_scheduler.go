@@ -0,0 +1,445 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+
+	"moongazing/scanner/core"
+)
+
+// 每个 IP 的默认并发上限和排队预警阈值
+const (
+	DefaultMaxInFlightPerIP     = 10
+	DefaultIPQueueWarnThreshold = 50
+)
+
+// IPScheduler 按解析 IP 限制指纹识别、爬虫、目录扫描的并发
+// 大型 SaaS 域名的数百个子域名往往只解析到少数几个 IP，各模块按子域名独立并发时，
+// 单个 IP 的实际并发是 模块并发数 × 子域名数，容易触发限速、得到无效结果。
+// 流水线共用一个调度器，同一 IP 上所有模块正在执行的请求合计不超过上限；
+// 解析到多个 IP 的主机计入负载最小的 IP。
+// IP 返回 429 或重置连接的次数达到阈值时，该 IP 的并发上限减半，直到任务结束
+type IPScheduler struct {
+	maxInFlight   int
+	warnThreshold int
+	warn          func(key, message string) // 排队预警回调
+	limiter       *core.OriginLimiter       // 各 IP 的并发名额
+
+	mu      sync.Mutex
+	slots   map[string]*ipSlot  // IP -> 负载
+	hostIPs map[string][]string // 主机 -> 解析的 IP
+}
+
+// ipSlot 单个 IP 的负载
+type ipSlot struct {
+	inFlight int
+	queued   int
+	peak     int                 // 最大同时执行数
+	hosts    map[string]struct{} // 共用该 IP 的主机
+	warned   int                 // 上次预警时的主机数
+}
+
+// IPLoad IP 负载统计
+type IPLoad struct {
+	IP       string `json:"ip"`
+	Hosts    int    `json:"hosts"`
+	InFlight int    `json:"in_flight"`
+	Queued   int    `json:"queued"`
+	Peak     int    `json:"peak"`
+	Limit    int    `json:"limit"` // 当前并发上限，限速退避后低于配置值
+}
+
+// IPWork 批量模式中按 IP 分组的工作项
+type IPWork struct {
+	Host string
+	IP   string
+	URL  string
+}
+
+// NewIPScheduler 创建 IP 调度器
+func NewIPScheduler(maxInFlight, warnThreshold int) *IPScheduler {
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlightPerIP
+	}
+	if warnThreshold <= 0 {
+		warnThreshold = DefaultIPQueueWarnThreshold
+	}
+	return &IPScheduler{
+		maxInFlight:   maxInFlight,
+		warnThreshold: warnThreshold,
+		limiter:       core.NewOriginLimiter(maxInFlight),
+		slots:         make(map[string]*ipSlot),
+		hostIPs:       make(map[string][]string),
+	}
+}
+
+// SetWarningHandler 设置排队预警回调（写入任务进度详情）
+func (s *IPScheduler) SetWarningHandler(fn func(key, message string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warn = fn
+}
+
+// SetBackoffHandler 设置 IP 并发减半时的回调（记录任务事件）
+func (s *IPScheduler) SetBackoffHandler(fn func(key string, from, to int)) {
+	s.limiter.SetBackoff(0, fn)
+}
+
+// MaxInFlight 每个 IP 的并发上限
+func (s *IPScheduler) MaxInFlight() int {
+	return s.maxInFlight
+}
+
+// Observe 记录一次请求的结果，429 和连接重置计入主机所在 IP 的限速次数
+// 主机计入数据携带的 IP，没有时为记录的第一个 IP
+func (s *IPScheduler) Observe(host, ip string, statusCode int, errText string) {
+	if s == nil || !core.IsThrottled(statusCode, errText) {
+		return
+	}
+	if ip == "" {
+		s.mu.Lock()
+		if ips := s.hostIPs[host]; len(ips) > 0 {
+			ip = ips[0]
+		} else {
+			ip = host
+		}
+		s.mu.Unlock()
+	}
+	s.limiter.Observe(ip, statusCode, errText)
+}
+
+// SplitThreads 一轮工作项中每个目标可用的线程数：同一 IP 上的目标平分 threads，
+// IP 的并发上限因限速减半后按比例减少，最少为 1
+func (s *IPScheduler) SplitThreads(round []IPWork, threads int) int {
+	if s == nil || threads <= 0 {
+		return threads
+	}
+	perIP := make(map[string]int)
+	for _, work := range round {
+		perIP[work.IP]++
+	}
+	share := threads
+	for ip, n := range perIP {
+		t := threads * s.limiter.Limit(ip) / s.maxInFlight / n
+		if t < share {
+			share = t
+		}
+	}
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
+
+// RecordHost 记录主机解析到的全部 IP（后续模块的数据只携带第一个 IP）
+func (s *IPScheduler) RecordHost(host string, ips []string) {
+	if s == nil || host == "" || len(ips) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hostIPs[host] = append([]string(nil), ips...)
+}
+
+// Acquire 占用主机所在 IP 的一个并发名额，名额用完时排队等待
+// 调度器为 nil 时不做限制；上下文取消时返回 false
+func (s *IPScheduler) Acquire(ctx context.Context, host, ip string) (func(), bool) {
+	if s == nil {
+		return func() {}, true
+	}
+
+	s.mu.Lock()
+	key := s.pickLocked(host, ip, nil)
+	s.mu.Unlock()
+	return s.acquire(ctx, host, key)
+}
+
+// acquire 占用指定 IP 的名额
+func (s *IPScheduler) acquire(ctx context.Context, host, key string) (func(), bool) {
+	s.mu.Lock()
+	slot := s.slotLocked(key)
+	slot.hosts[host] = struct{}{}
+	slot.queued++
+	s.checkQueueLocked(key, slot, slot.queued)
+	s.mu.Unlock()
+
+	lease, ok := s.limiter.Acquire(ctx, key)
+	if !ok {
+		s.mu.Lock()
+		slot.queued--
+		s.mu.Unlock()
+		return func() {}, false
+	}
+
+	s.mu.Lock()
+	slot.queued--
+	slot.inFlight++
+	if slot.inFlight > slot.peak {
+		slot.peak = slot.inFlight
+	}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			slot.inFlight--
+			s.mu.Unlock()
+			lease()
+		})
+	}, true
+}
+
+// Rounds 将批量工作项按 IP 分组，拆成若干轮，每轮中同一 IP 的工作项不超过该 IP 当前的并发上限
+// 没有 IP 超过上限时只有一轮，与原来的整批调用相同。轮次按调用时的上限拆分，
+// 执行期间上限可能因限速减半，批量执行使用 EachRound，每轮按当时的上限重新拆分
+func (s *IPScheduler) Rounds(items []IPWork) [][]IPWork {
+	if len(items) == 0 {
+		return nil
+	}
+	if s == nil {
+		return [][]IPWork{items}
+	}
+
+	plan := s.plan(items)
+	var rounds [][]IPWork
+	for round := plan.next(); len(round) > 0; round = plan.next() {
+		rounds = append(rounds, round)
+	}
+	return rounds
+}
+
+// EachRound 将批量工作项按 IP 分轮执行：每轮按各 IP 当前的并发上限取出工作项，占用名额后调用 fn，
+// fn 返回后释放名额再取下一轮，上一轮触发的并发减半在下一轮生效。
+// 上下文取消或 fn 返回 false 时停止并返回 false；调度器为 nil 时整批调用一次
+func (s *IPScheduler) EachRound(ctx context.Context, items []IPWork, fn func(round []IPWork) bool) bool {
+	if len(items) == 0 {
+		return true
+	}
+	if s == nil {
+		return fn(items)
+	}
+
+	plan := s.plan(items)
+	for round := plan.next(); len(round) > 0; round = plan.next() {
+		release, ok := s.AcquireRound(ctx, round)
+		if !ok {
+			return false
+		}
+		ok = fn(round)
+		release()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// roundPlan 按 IP 分组后尚未执行的工作项
+type roundPlan struct {
+	s      *IPScheduler
+	order  []string
+	groups map[string][]IPWork
+}
+
+// plan 将工作项按计入的 IP 分组
+func (s *IPScheduler) plan(items []IPWork) *roundPlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &roundPlan{s: s, groups: make(map[string][]IPWork)}
+	planned := make(map[string]int)
+	for _, item := range items {
+		key := s.pickLocked(item.Host, item.IP, planned)
+		planned[key]++
+		if _, ok := p.groups[key]; !ok {
+			p.order = append(p.order, key)
+		}
+		item.IP = key
+		p.groups[key] = append(p.groups[key], item)
+
+		slot := s.slotLocked(key)
+		slot.hosts[item.Host] = struct{}{}
+	}
+	for _, key := range p.order {
+		s.checkQueueLocked(key, s.slots[key], len(p.groups[key]))
+	}
+	return p
+}
+
+// next 取出下一轮工作项，每个 IP 最多取当前的并发上限个，没有剩余时返回空
+func (p *roundPlan) next() []IPWork {
+	var round []IPWork
+	for _, key := range p.order {
+		group := p.groups[key]
+		if len(group) == 0 {
+			continue
+		}
+		n := p.s.limiter.Limit(key)
+		if n > len(group) {
+			n = len(group)
+		}
+		round = append(round, group[:n]...)
+		p.groups[key] = group[n:]
+	}
+	return round
+}
+
+// AcquireRound 为一轮工作项占用名额：同时占用各 IP 的名额，不会占着一部分 IP 等待其他 IP，
+// 避免与同时执行的其他模块互相等待；某个 IP 的工作项超过其当前上限时按上限占用
+func (s *IPScheduler) AcquireRound(ctx context.Context, round []IPWork) (func(), bool) {
+	if s == nil || len(round) == 0 {
+		return func() {}, true
+	}
+
+	counts := make(map[string]int)
+	s.mu.Lock()
+	for _, item := range round {
+		counts[item.IP]++
+		slot := s.slotLocked(item.IP)
+		slot.hosts[item.Host] = struct{}{}
+		slot.queued++
+	}
+	s.mu.Unlock()
+
+	lease, ok := s.limiter.AcquireMany(ctx, counts)
+
+	s.mu.Lock()
+	for key, n := range counts {
+		slot := s.slots[key]
+		slot.queued -= n
+		if ok {
+			slot.inFlight += n
+			if slot.inFlight > slot.peak {
+				slot.peak = slot.inFlight
+			}
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		return func() {}, false
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			for key, n := range counts {
+				s.slots[key].inFlight -= n
+			}
+			s.mu.Unlock()
+			lease()
+		})
+	}, true
+}
+
+// Loads 各 IP 的负载统计，按主机数降序
+func (s *IPScheduler) Loads() []IPLoad {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loads := make([]IPLoad, 0, len(s.slots))
+	for ip, slot := range s.slots {
+		loads = append(loads, IPLoad{
+			IP:       ip,
+			Hosts:    len(slot.hosts),
+			InFlight: slot.inFlight,
+			Queued:   slot.queued,
+			Peak:     slot.peak,
+			Limit:    s.limiter.Limit(ip),
+		})
+	}
+	sort.Slice(loads, func(i, j int) bool {
+		if loads[i].Hosts != loads[j].Hosts {
+			return loads[i].Hosts > loads[j].Hosts
+		}
+		return loads[i].IP < loads[j].IP
+	})
+	return loads
+}
+
+// pickLocked 选择工作项计入的 IP：主机的全部 IP 中负载最小的一个，
+// 没有 IP 时按主机名计（需要持有锁）
+func (s *IPScheduler) pickLocked(host, ip string, planned map[string]int) string {
+	candidates := s.hostIPs[host]
+	if ip != "" && !containsIP(candidates, ip) {
+		candidates = append(append([]string(nil), candidates...), ip)
+	}
+	if len(candidates) == 0 {
+		return host
+	}
+
+	best, bestLoad := "", 0
+	for _, candidate := range candidates {
+		load := planned[candidate]
+		if slot, ok := s.slots[candidate]; ok {
+			load += slot.inFlight + slot.queued
+		}
+		if best == "" || load < bestLoad {
+			best, bestLoad = candidate, load
+		}
+	}
+	return best
+}
+
+// slotLocked 获取或创建 IP 负载（需要持有锁）
+func (s *IPScheduler) slotLocked(key string) *ipSlot {
+	slot, ok := s.slots[key]
+	if !ok {
+		slot = &ipSlot{
+			hosts: make(map[string]struct{}),
+		}
+		s.slots[key] = slot
+	}
+	return slot
+}
+
+// checkQueueLocked 排队数超过阈值时预警，共用主机数增加后更新预警内容（需要持有锁）
+func (s *IPScheduler) checkQueueLocked(key string, slot *ipSlot, queued int) {
+	if queued <= s.warnThreshold || net.ParseIP(key) == nil {
+		return
+	}
+	hosts := len(slot.hosts)
+	if hosts <= 1 || hosts <= slot.warned {
+		return
+	}
+	slot.warned = hosts
+
+	message := fmt.Sprintf("%d 个主机共用 IP %s，已限制并发（每个 IP 最多 %d 个请求）", hosts, key, s.maxInFlight)
+	log.Printf("[IPScheduler] %s", message)
+	if s.warn != nil {
+		s.warn("ip:"+key, message)
+	}
+}
+
+// containsIP 列表中是否包含 IP
+func containsIP(ips []string, ip string) bool {
+	for _, v := range ips {
+		if v == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// assetWorks HTTP 资产转换为调度工作项
+func assetWorks(assets []AssetHttp) []IPWork {
+	works := make([]IPWork, 0, len(assets))
+	for _, asset := range assets {
+		works = append(works, IPWork{Host: asset.Host, IP: asset.IP, URL: asset.URL})
+	}
+	return works
+}
+
+// workURLs 一轮工作项的 URL
+func workURLs(round []IPWork) []string {
+	urls := make([]string, 0, len(round))
+	for _, work := range round {
+		urls = append(urls, work.URL)
+	}
+	return urls
+}
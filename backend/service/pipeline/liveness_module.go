@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"moongazing/scanner/portscan"
+)
+
+// LivenessModule 主机存活预检测模块
+// 位于端口扫描之前，对 IP/网段目标进行快速存活探测，只把存活主机交给端口扫描；
+// 不存活的主机带探测证据记录为提示性结果。域名目标和其他数据直接传递
+type LivenessModule struct {
+	BaseModule
+	prober     *portscan.LivenessProber
+	record     func(interface{}) // 记录不存活的主机
+	resultChan chan interface{}
+	total      int
+	mu         sync.Mutex
+}
+
+// NewLivenessModule 创建主机存活预检测模块
+func NewLivenessModule(ctx context.Context, nextModule ModuleRunner, prober *portscan.LivenessProber, record func(interface{})) *LivenessModule {
+	return &LivenessModule{
+		BaseModule: BaseModule{
+			name:       "LivenessCheck",
+			ctx:        ctx,
+			nextModule: nextModule,
+		},
+		prober:     prober,
+		record:     record,
+		resultChan: make(chan interface{}, 1000),
+	}
+}
+
+// ModuleRun 运行模块
+func (m *LivenessModule) ModuleRun() error {
+	var allWg sync.WaitGroup
+	var resultWg sync.WaitGroup
+	var nextModuleRun sync.WaitGroup
+
+	m.ReportModuleStart(0)
+	defer m.ReportModuleComplete()
+
+	// 启动下一个模块
+	if m.nextModule != nil {
+		nextModuleRun.Add(1)
+		go func() {
+			defer nextModuleRun.Done()
+			if err := m.nextModule.ModuleRun(); err != nil {
+				log.Printf("[%s] Next module error: %v", m.name, err)
+			}
+		}()
+	}
+
+	// 结果处理协程
+	resultWg.Add(1)
+	go func() {
+		defer resultWg.Done()
+		for result := range m.resultChan {
+			if m.nextModule != nil {
+				select {
+				case <-m.ctx.Done():
+					return
+				case m.nextModule.GetInput() <- result:
+				}
+			}
+		}
+		// 关闭下一个模块的输入
+		if m.nextModule != nil {
+			m.nextModule.CloseInput()
+		}
+	}()
+
+	sem := make(chan struct{}, m.prober.Concurrency())
+	var alive, dead int
+
+	// 处理输入
+	for {
+		select {
+		case <-m.ctx.Done():
+			allWg.Wait()
+			close(m.resultChan)
+			resultWg.Wait()
+			nextModuleRun.Wait()
+			return nil
+
+		case data, ok := <-m.input:
+			if !ok {
+				// 输入通道关闭
+				allWg.Wait()
+				close(m.resultChan)
+				resultWg.Wait()
+				log.Printf("[%s] Input closed, alive %d, dead %d, waiting for next module", m.name, alive, dead)
+				nextModuleRun.Wait()
+				return nil
+			}
+
+			ips := livenessTargets(data)
+			if ips == nil {
+				// 域名目标和其他数据不做存活检测
+				m.resultChan <- data
+				continue
+			}
+
+			// 网段展开后目标数增加
+			m.addTotal(len(ips))
+			if len(ips) > 1 {
+				m.adjustTargets(len(ips) - 1)
+			}
+
+			for _, ip := range ips {
+				select {
+				case <-m.ctx.Done():
+					continue
+				case sem <- struct{}{}:
+				}
+
+				allWg.Add(1)
+				go func(ip string) {
+					defer allWg.Done()
+					defer func() { <-sem }()
+
+					result := m.prober.Probe(m.ctx, ip)
+					m.ReportProgress(1, 0)
+
+					m.mu.Lock()
+					if result.Alive {
+						alive++
+					} else {
+						dead++
+					}
+					m.mu.Unlock()
+
+					if !result.Alive {
+						log.Printf("[%s] Host %s not responding (%s), skipping port scan", m.name, ip, strings.Join(result.Evidence, ", "))
+						m.adjustTargets(-1)
+						if m.record != nil {
+							m.record(HostLiveness{IP: ip, Alive: false, Evidence: result.Evidence})
+						}
+						return
+					}
+
+					m.ReportOutput(1)
+					select {
+					case <-m.ctx.Done():
+					case m.resultChan <- ip:
+					}
+				}(ip)
+			}
+		}
+	}
+}
+
+// addTotal 增加模块的待探测数量
+func (m *LivenessModule) addTotal(n int) {
+	m.mu.Lock()
+	m.total += n
+	total := m.total
+	m.mu.Unlock()
+	if m.progressTracker != nil {
+		m.progressTracker.UpdateModuleTotal(m.name, total)
+	}
+}
+
+// adjustTargets 调整流水线总目标数
+func (m *LivenessModule) adjustTargets(delta int) {
+	if m.progressTracker != nil {
+		m.progressTracker.AdjustTotalTargets(delta)
+	}
+}
+
+// livenessTargets 提取需要存活检测的 IP，非 IP/网段目标返回 nil
+func livenessTargets(data interface{}) []string {
+	target, ok := data.(string)
+	if !ok {
+		return nil
+	}
+	target = strings.TrimSpace(target)
+	if net.ParseIP(target) != nil {
+		return []string{target}
+	}
+	if _, _, err := net.ParseCIDR(target); err == nil {
+		// 超过展开上限的网段保持原样，交给端口扫描处理
+		expanded, err := ExpandTargets([]string{target}, 0)
+		if err != nil {
+			return nil
+		}
+		return expanded
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"sync"
+
+	"moongazing/scanner/core"
 )
 
 // ModuleRunner 模块运行器接口
@@ -113,35 +115,57 @@ func (pm *PipelineManager) GetStats() PipelineStats {
 }
 
 // DuplicateChecker 去重检查器
-// 用于在任务内去重
+// 用于在任务内去重，默认使用内存集合，流水线可按配置替换为 Redis 或布隆过滤器
 type DuplicateChecker struct {
-	subdomains sync.Map // map[string]bool
-	ports      sync.Map // map[string]bool
-	urls       sync.Map // map[string]bool
+	store DedupStore
+
+	module string            // 所属模块，用于丢弃统计
+	stats  *SuppressionStats // 丢弃统计，nil 时不记录
 }
 
 // NewDuplicateChecker 创建去重检查器
 func NewDuplicateChecker() *DuplicateChecker {
-	return &DuplicateChecker{}
+	return &DuplicateChecker{store: NewMemoryDedupStore()}
+}
+
+// NewDuplicateCheckerWithStore 创建使用指定存储的去重检查器
+func NewDuplicateCheckerWithStore(store DedupStore) *DuplicateChecker {
+	return &DuplicateChecker{store: store}
+}
+
+// track 将重复项计入所属模块的丢弃统计
+func (dc *DuplicateChecker) track(module string, stats *SuppressionStats) {
+	dc.module = module
+	dc.stats = stats
+}
+
+// seen 记录 key，已存在时计为重复
+func (dc *DuplicateChecker) seen(kind, key string) bool {
+	return dc.seenIn(dc.store, kind, key)
+}
+
+// seenIn 在指定存储中记录 key（如模块间共用的 URL 去重器），重复时计入本模块的丢弃统计
+func (dc *DuplicateChecker) seenIn(store DedupStore, kind, key string) bool {
+	loaded := store.Add(kind, key)
+	if loaded {
+		dc.stats.Record(dc.module, SuppressDuplicate, key)
+	}
+	return loaded
 }
 
 // IsSubdomainDuplicate 检查子域名是否重复
 func (dc *DuplicateChecker) IsSubdomainDuplicate(host string) bool {
-	_, loaded := dc.subdomains.LoadOrStore(host, true)
-	return loaded
+	return dc.seen(DedupKindSubdomain, host)
 }
 
 // IsPortDuplicate 检查端口是否重复
 func (dc *DuplicateChecker) IsPortDuplicate(host, port string) bool {
-	key := host + ":" + port
-	_, loaded := dc.ports.LoadOrStore(key, true)
-	return loaded
+	return dc.seen(DedupKindPort, host+":"+port)
 }
 
 // IsURLDuplicate 检查URL是否重复
 func (dc *DuplicateChecker) IsURLDuplicate(url string) bool {
-	_, loaded := dc.urls.LoadOrStore(url, true)
-	return loaded
+	return dc.seen(DedupKindURL, url)
 }
 
 // BaseModule 基础模块
@@ -152,7 +176,12 @@ type BaseModule struct {
 	nextModule      ModuleRunner
 	ctx             context.Context
 	dupChecker      *DuplicateChecker
+	urlDedup        *URLDeduper // 爬虫和目录扫描共用的 URL 去重器，nil 时只在模块内去重
 	progressTracker *ProgressTracker
+	ipScheduler     *IPScheduler      // 按 IP 限制并发，nil 表示不限制
+	events          *EventRecorder    // 任务事件，nil 表示不记录
+	scope           *core.ScopeFilter // 扫描范围，nil 表示不限制
+	suppression     *SuppressionStats // 丢弃统计，nil 表示不记录
 }
 
 // SetInput 设置输入通道
@@ -187,6 +216,11 @@ func (m *BaseModule) SetProgressTracker(tracker *ProgressTracker) {
 	m.progressTracker = tracker
 }
 
+// SetIPScheduler 设置 IP 调度器（流水线共用）
+func (m *BaseModule) SetIPScheduler(scheduler *IPScheduler) {
+	m.ipScheduler = scheduler
+}
+
 // GetProgressTracker 获取进度追踪器
 func (m *BaseModule) GetProgressTracker() *ProgressTracker {
 	return m.progressTracker
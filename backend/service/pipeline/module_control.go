@@ -0,0 +1,250 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// 模块运行时控制
+// 任务运行中可以按模块名称（GetName() 返回值）发送控制指令，不中断整个任务：
+//   skip        跳过剩余输入：立即关闭模块的输入，模块处理完已经收到的数据后正常结束，之后上游发来的数据直接丢弃
+//   stop        停止模块：取消模块的上下文，与模块超时相同，后续模块处理完已经收到的数据后正常结束
+//   concurrency 调整并发数，只有实现了 concurrencyAdjuster 的模块支持（目前为 Fingerprint），正在处理的目标不受影响
+// 跳过和停止的模块进度分别标记为 skipped、stopped，进度保持在控制时的数值
+
+// 控制指令
+const (
+	ControlSkip        = "skip"
+	ControlStop        = "stop"
+	ControlConcurrency = "concurrency"
+)
+
+// ControlMessage 模块控制指令
+type ControlMessage struct {
+	Module      string `json:"module" bson:"module"`                               // 模块名称，如 Crawler、DirScan
+	Action      string `json:"action" bson:"action"`                               // skip, stop, concurrency
+	Concurrency int    `json:"concurrency,omitempty" bson:"concurrency,omitempty"` // action 为 concurrency 时的并发数
+}
+
+// ValidControlAction 控制指令是否有效
+func ValidControlAction(action string) bool {
+	switch action {
+	case ControlSkip, ControlStop, ControlConcurrency:
+		return true
+	}
+	return false
+}
+
+// concurrencyAdjuster 支持在运行时调整并发数的模块，返回实际生效的并发数
+type concurrencyAdjuster interface {
+	AdjustConcurrency(n int) int
+}
+
+// moduleControl 单个模块的运行时控制状态，由 moduleContext 创建
+type moduleControl struct {
+	ctx      context.Context    // 模块使用的上下文，停止或超时后结束
+	stop     context.CancelFunc // 取消模块的上下文
+	skip     chan struct{}      // 跳过剩余输入后关闭
+	skipOnce sync.Once
+}
+
+// ApplyControl 对运行中的模块执行控制指令
+func (p *StreamingPipeline) ApplyControl(msg ControlMessage) error {
+	if !ValidControlAction(msg.Action) {
+		return fmt.Errorf("不支持的控制指令: %s", msg.Action)
+	}
+	w := p.monitor.module(msg.Module)
+	if w == nil {
+		return fmt.Errorf("模块 %s 未启用", msg.Module)
+	}
+
+	var finished, skipped, stopped bool
+	w.update(func(s *moduleState) {
+		finished, skipped, stopped = s.finished, s.skipped, s.stopped
+	})
+	switch {
+	case finished:
+		return fmt.Errorf("模块 %s 已结束", msg.Module)
+	case stopped:
+		return fmt.Errorf("模块 %s 已停止", msg.Module)
+	}
+
+	switch msg.Action {
+	case ControlSkip:
+		if w.control == nil {
+			return fmt.Errorf("模块 %s 不支持跳过", msg.Module)
+		}
+		if skipped {
+			return fmt.Errorf("模块 %s 已跳过剩余输入", msg.Module)
+		}
+		w.requestSkip()
+	case ControlStop:
+		if w.control == nil {
+			return fmt.Errorf("模块 %s 不支持停止", msg.Module)
+		}
+		w.stopModule()
+	case ControlConcurrency:
+		adjuster, ok := w.inner.(concurrencyAdjuster)
+		if !ok {
+			return fmt.Errorf("模块 %s 不支持调整并发", msg.Module)
+		}
+		if msg.Concurrency <= 0 {
+			return fmt.Errorf("并发数必须大于 0")
+		}
+		applied := adjuster.AdjustConcurrency(msg.Concurrency)
+		log.Printf("[%s] Concurrency adjusted to %d", w.state.name, applied)
+		w.emit(EventLevelInfo, EventModuleControl, fmt.Sprintf("并发数已调整为 %d", applied), map[string]interface{}{
+			"action":      ControlConcurrency,
+			"concurrency": applied,
+		})
+	}
+	return nil
+}
+
+// module 按名称获取模块的包装器
+func (pm *pipelineMonitor) module(name string) *monitoredModule {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, m := range pm.modules {
+		if m.state.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// skipped 跳过剩余输入的通知通道，模块不支持控制时为 nil
+func (w *monitoredModule) skipped() <-chan struct{} {
+	if w.control == nil {
+		return nil
+	}
+	return w.control.skip
+}
+
+// requestSkip 标记模块跳过剩余输入，由转发协程关闭真实模块的输入
+func (w *monitoredModule) requestSkip() {
+	w.control.skipOnce.Do(func() {
+		var received int
+		w.update(func(s *moduleState) {
+			s.skipped = true
+			received = s.received
+		})
+		log.Printf("[%s] Skipping remaining input after %d items", w.state.name, received)
+		if w.monitor.progress != nil {
+			w.monitor.progress.SkipModule(w.state.name)
+		}
+		w.emit(EventLevelWarn, EventModuleControl, "已跳过剩余输入，模块处理完已收到的数据后结束", map[string]interface{}{
+			"action":   ControlSkip,
+			"received": received,
+		})
+		close(w.control.skip)
+	})
+}
+
+// stopModule 停止模块，下游处理完已经收到的数据后正常结束
+func (w *monitoredModule) stopModule() {
+	var received int
+	w.update(func(s *moduleState) {
+		s.stopped = true
+		received = s.received
+	})
+	log.Printf("[%s] Module stopped by control, downstream continues with forwarded results", w.state.name)
+	if w.monitor.progress != nil {
+		w.monitor.progress.StopModule(w.state.name)
+	}
+	w.emit(EventLevelWarn, EventModuleControl, "模块已停止，后续模块继续处理已输出的结果", map[string]interface{}{
+		"action":   ControlStop,
+		"received": received,
+	})
+	w.control.stop()
+
+	if next := w.monitor.nextOf(w); next != nil {
+		next.release()
+	}
+}
+
+// dropSkipped 跳过剩余输入后立即关闭真实模块的输入，继续读取上游的数据并丢弃，避免上游阻塞
+func (w *monitoredModule) dropSkipped() {
+	w.inner.CloseInput()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case data, ok := <-w.input:
+			if !ok {
+				return
+			}
+			w.monitor.suppression.Record(w.state.name, SuppressModuleSkipped, data)
+		}
+	}
+}
+
+// concurrencyLimit 可在运行时调整上限的并发限制
+type concurrencyLimit struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	wake     chan struct{} // 名额释放或上限变化时关闭，唤醒等待者
+}
+
+// newConcurrencyLimit 创建并发限制，limit <= 0 时为 1
+func newConcurrencyLimit(limit int) *concurrencyLimit {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &concurrencyLimit{limit: limit, wake: make(chan struct{})}
+}
+
+// Acquire 获取一个名额，ctx 结束时返回 false
+func (l *concurrencyLimit) Acquire(ctx context.Context) bool {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return true
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-wake:
+		}
+	}
+}
+
+// Release 释放名额
+func (l *concurrencyLimit) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// SetLimit 调整上限，调低时已在运行的任务不受影响，名额释放后按新上限分配
+func (l *concurrencyLimit) SetLimit(limit int) {
+	if limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.notify()
+}
+
+// Limit 当前上限
+func (l *concurrencyLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// notify 唤醒等待者（需要持有锁）
+func (l *concurrencyLimit) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
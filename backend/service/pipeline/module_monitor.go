@@ -0,0 +1,357 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"moongazing/scanner/core"
+)
+
+// 模块监控
+// 流水线的每个模块都经 pipelineMonitor.wrap 包装：在上游与真实模块之间插入转发通道，
+// 记录输入、关闭和运行状态供看门狗诊断，执行模块超时、扫描范围过滤和运行中控制；
+// PipelineConfig.Faults 设置时（仅测试）在转发时注入故障
+
+// moduleState 模块运行状态（供看门狗诊断使用）
+type moduleState struct {
+	name         string
+	started      bool
+	finished     bool
+	inputClosed  bool
+	closedAt     time.Time
+	received     int
+	lastReceived time.Time
+	err          error
+	panicValue   interface{}
+	timedOut     bool
+	skipped      bool // 运行中跳过了剩余输入
+	stopped      bool // 运行中被停止
+}
+
+// String 输出模块状态摘要
+func (s *moduleState) String() string {
+	desc := fmt.Sprintf("%s{started=%v finished=%v input_closed=%v received=%d",
+		s.name, s.started, s.finished, s.inputClosed, s.received)
+	if s.err != nil {
+		desc += fmt.Sprintf(" err=%q", s.err.Error())
+	}
+	if s.panicValue != nil {
+		desc += fmt.Sprintf(" panic=%q", fmt.Sprint(s.panicValue))
+	}
+	if s.timedOut {
+		desc += " timed_out=true"
+	}
+	if s.skipped {
+		desc += " skipped=true"
+	}
+	if s.stopped {
+		desc += " stopped=true"
+	}
+	return desc + "}"
+}
+
+// pipelineMonitor 记录链上所有模块的状态
+type pipelineMonitor struct {
+	mu      sync.Mutex
+	modules []*monitoredModule // 按链顺序排列：入口模块在前，结果收集模块在后
+
+	scope       *core.ScopeFilter // 扫描范围（包含和排除规则），在模块启动前设置
+	suppression *SuppressionStats // 丢弃统计，包装时设置到模块
+	events      *EventRecorder    // 任务事件，包装时设置到模块
+	dedup       *dedupStoreSet    // 模块内去重存储，nil 时使用模块默认的内存集合
+	progress    *ProgressTracker  // 模块超时时标记进度状态
+	timeouts    map[string]*moduleTimeout
+	controls    map[string]*moduleControl // 模块的运行时控制，按模块名称
+}
+
+// monitoredModule 模块包装器
+// 在上游与真实模块之间插入一个转发通道，用于记录输入/关闭情况并按需注入故障
+type monitoredModule struct {
+	inner     ModuleRunner
+	input     chan interface{}
+	ctx       context.Context
+	fault     *ModuleFault
+	monitor   *pipelineMonitor
+	state     *moduleState
+	closeOnce sync.Once
+
+	deadline    *moduleTimeout // 模块超时，nil 表示不限制
+	released    chan struct{}  // 上游模块超时后关闭
+	releaseOnce sync.Once
+
+	control *moduleControl // 运行时控制，nil 表示模块不支持跳过和停止
+
+	downstream []*monitoredModule // 输出去向，为空时为链上的下一个模块（扇出分支时显式指定）
+}
+
+// wrap 包装模块，返回的包装器需要作为上游模块的 nextModule
+func (pm *pipelineMonitor) wrap(ctx context.Context, inner ModuleRunner, faults *FaultConfig) *monitoredModule {
+	w := &monitoredModule{
+		inner:   inner,
+		input:   make(chan interface{}, cap(inner.GetInput())),
+		ctx:     ctx,
+		fault:   faults.faultFor(inner.GetName()),
+		monitor: pm,
+		state:   &moduleState{name: inner.GetName()},
+
+		released: make(chan struct{}),
+	}
+	if r, ok := inner.(suppressionRecorder); ok {
+		r.SetSuppressionStats(pm.suppression)
+	}
+	if e, ok := inner.(eventEmitter); ok {
+		e.SetEventRecorder(pm.events)
+	}
+	if s, ok := inner.(scopeUser); ok {
+		s.SetScope(pm.scope)
+	}
+	if d, ok := inner.(dedupStoreUser); ok && pm.dedup != nil {
+		d.SetDedupStore(pm.dedup.create(inner.GetName()))
+	}
+
+	pm.mu.Lock()
+	w.deadline = pm.timeouts[inner.GetName()]
+	w.control = pm.controls[inner.GetName()]
+	// 模块链从后向前构建，新模块插入到最前面
+	pm.modules = append([]*monitoredModule{w}, pm.modules...)
+	pm.mu.Unlock()
+
+	return w
+}
+
+// link 指定模块的输出去向，供看门狗判断扇出分支的输出进展
+func (pm *pipelineMonitor) link(upstream ModuleRunner, downstream ...ModuleRunner) {
+	up, ok := upstream.(*monitoredModule)
+	if !ok {
+		return
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, d := range downstream {
+		if w, ok := d.(*monitoredModule); ok {
+			up.downstream = append(up.downstream, w)
+		}
+	}
+}
+
+// find 获取指定模块对应的包装器
+func (pm *pipelineMonitor) find(inner ModuleRunner) ModuleRunner {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, m := range pm.modules {
+		if m.inner == inner {
+			return m
+		}
+	}
+	return inner
+}
+
+// update 在锁内修改模块状态
+func (w *monitoredModule) update(fn func(s *moduleState)) {
+	w.monitor.mu.Lock()
+	defer w.monitor.mu.Unlock()
+	fn(w.state)
+}
+
+// ModuleRun 运行模块
+func (w *monitoredModule) ModuleRun() (err error) {
+	w.update(func(s *moduleState) { s.started = true })
+	w.emit(EventLevelInfo, EventModuleStart, "模块开始运行", nil)
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[%s] Panic in module: %v", w.state.name, r)
+			w.update(func(s *moduleState) { s.panicValue = r })
+			err = fmt.Errorf("module %s panicked: %v", w.state.name, r)
+		}
+		var received int
+		var timedOut, skipped, stopped bool
+		w.update(func(s *moduleState) {
+			s.finished = true
+			s.err = err
+			received = s.received
+			timedOut = s.timedOut
+			skipped = s.skipped
+			stopped = s.stopped
+		})
+		data := map[string]interface{}{"received": received}
+		switch {
+		case err != nil:
+			data["error"] = err.Error()
+			w.emit(EventLevelError, EventModuleComplete, "模块异常结束", data)
+		case timedOut:
+			data["timeout"] = true
+			w.emit(EventLevelWarn, EventModuleComplete, "模块运行超时", data)
+		case stopped:
+			data["stopped"] = true
+			w.emit(EventLevelWarn, EventModuleComplete, "模块已停止", data)
+		case w.ctx.Err() != nil:
+			data["cancelled"] = true
+			w.emit(EventLevelWarn, EventModuleComplete, "模块被中断", data)
+		case skipped:
+			data["skipped"] = true
+			w.emit(EventLevelWarn, EventModuleComplete, "模块跳过剩余输入后结束", data)
+		default:
+			w.emit(EventLevelInfo, EventModuleComplete, "模块运行完成", data)
+		}
+		w.emitOutOfScope()
+	}()
+
+	if w.fault != nil && w.fault.ErrorOnStart {
+		log.Printf("[%s] Injected start error", w.state.name)
+		return fmt.Errorf("injected start error for module %s", w.state.name)
+	}
+
+	if w.deadline != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go w.watchTimeout(done)
+	}
+
+	go w.forward()
+	return w.inner.ModuleRun()
+}
+
+// emit 记录模块事件，结果收集模块不记录
+func (w *monitoredModule) emit(level, eventType, message string, data map[string]interface{}) {
+	if w.state.name == "ResultCollector" {
+		return
+	}
+	w.monitor.events.Emit(w.state.name, level, eventType, message, data)
+}
+
+// forward 将上游数据转发到真实模块的输入通道
+func (w *monitoredModule) forward() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[%s] Panic while processing input: %v", w.state.name, r)
+			w.update(func(s *moduleState) { s.panicValue = r })
+		}
+	}()
+
+	var forwarded int
+	draining := false
+	for {
+		var data interface{}
+		var ok bool
+		if draining {
+			// 上游模块超时：转发已经收到的数据后关闭真实模块的输入
+			select {
+			case data, ok = <-w.input:
+			default:
+				log.Printf("[%s] Upstream timed out, closing input", w.state.name)
+				w.inner.CloseInput()
+				return
+			}
+		} else {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-w.expired():
+				w.skipInput()
+				return
+			case <-w.skipped():
+				w.dropSkipped()
+				return
+			case <-w.released:
+				draining = true
+				continue
+			case data, ok = <-w.input:
+			}
+		}
+
+		if !ok {
+			if w.fault != nil && w.fault.DropCloseInput {
+				log.Printf("[%s] Injected fault: dropping CloseInput", w.state.name)
+				return
+			}
+			w.inner.CloseInput()
+			return
+		}
+
+		w.update(func(s *moduleState) {
+			s.received++
+			s.lastReceived = time.Now()
+		})
+
+		// 所有模块入口统一检查排除范围，防止被排除的主机经旁路发现重新进入流水线
+		if rule, excluded := outOfScopeBy(w.monitor.scope, data); excluded {
+			log.Printf("[%s] Dropped out-of-scope input %T (rule %q)", w.state.name, data, rule)
+			w.monitor.suppression.Record(w.state.name, SuppressOutOfScope, data)
+			continue
+		}
+
+		if w.fault != nil && w.fault.Stall > 0 && forwarded == 0 {
+			log.Printf("[%s] Injected fault: stalling for %v", w.state.name, w.fault.Stall)
+			if !w.pause(w.fault.Stall) {
+				return
+			}
+		}
+		if w.fault != nil && w.fault.Delay > 0 && !w.pause(w.fault.Delay) {
+			return
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-w.expired():
+			w.skipInput()
+			return
+		case <-w.skipped():
+			w.monitor.suppression.Record(w.state.name, SuppressModuleSkipped, data)
+			w.dropSkipped()
+			return
+		case w.inner.GetInput() <- data:
+		}
+		forwarded++
+
+		if w.fault != nil && w.fault.PanicAfter > 0 && forwarded >= w.fault.PanicAfter {
+			panic(fmt.Sprintf("injected panic after %d items", forwarded))
+		}
+	}
+}
+
+// pause 注入的停顿，流水线停止、模块超时或跳过剩余输入时返回 false
+func (w *monitoredModule) pause(d time.Duration) bool {
+	select {
+	case <-w.ctx.Done():
+		return false
+	case <-w.expired():
+		w.skipInput()
+		return false
+	case <-w.skipped():
+		w.dropSkipped()
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// SetInput 设置输入通道
+func (w *monitoredModule) SetInput(ch chan interface{}) {
+	w.input = ch
+}
+
+// GetInput 获取输入通道
+func (w *monitoredModule) GetInput() chan interface{} {
+	return w.input
+}
+
+// CloseInput 关闭输入通道
+func (w *monitoredModule) CloseInput() {
+	w.closeOnce.Do(func() {
+		w.update(func(s *moduleState) {
+			s.inputClosed = true
+			s.closedAt = time.Now()
+		})
+		close(w.input)
+	})
+}
+
+// GetName 获取模块名称
+func (w *monitoredModule) GetName() string {
+	return w.inner.GetName()
+}
@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 模块超时
+// PipelineConfig.ModuleTimeouts 按模块名称设置运行时长上限，从流水线启动开始计时。
+// 超时的模块停止运行，进度标记为 timeout；下游模块处理完已经收到的数据后正常结束，任务不中断。
+// 每个模块的上下文都可以单独取消，用于运行时停止模块（见 module_control.go）
+
+// moduleTimeout 单个模块的超时上下文
+type moduleTimeout struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	limit  time.Duration
+}
+
+// timeoutModules 可以设置超时的模块，与 moduleContext 使用的模块名称一致
+var timeoutModules = map[string]bool{
+	"SubdomainScan":       true,
+	"DomainVerify":        true,
+	"LivenessCheck":       true,
+	"PortScanPreparation": true,
+	"PortScan":            true,
+	"Fingerprint":         true,
+	"Screenshot":          true,
+	"VulnScan":            true,
+	"EndpointExtraction":  true,
+	"ContentAnalysis":     true,
+	"SensitiveInfo":       true,
+	"Crawler":             true,
+	"DirScan":             true,
+}
+
+// ValidTimeoutModule 模块名称是否可以设置超时
+func ValidTimeoutModule(name string) bool {
+	return timeoutModules[name]
+}
+
+// timeoutUnit 超时配置的时间单位
+func (c *PipelineConfig) timeoutUnit() time.Duration {
+	if c.TimeoutUnit > 0 {
+		return c.TimeoutUnit
+	}
+	return time.Minute
+}
+
+// moduleContext 获取模块使用的上下文：在流水线 ctx 上派生可单独取消的上下文，配置了超时的模块再加截止时间
+func (p *StreamingPipeline) moduleContext(name string) context.Context {
+	ctx, stop := context.WithCancel(p.ctx)
+	control := &moduleControl{ctx: ctx, stop: stop, skip: make(chan struct{})}
+
+	p.monitor.mu.Lock()
+	defer p.monitor.mu.Unlock()
+	if p.monitor.controls == nil {
+		p.monitor.controls = make(map[string]*moduleControl)
+	}
+	p.monitor.controls[name] = control
+
+	minutes := p.config.ModuleTimeouts[name]
+	if minutes <= 0 {
+		return ctx
+	}
+	limit := time.Duration(minutes) * p.config.timeoutUnit()
+	ctx, cancel := context.WithTimeout(ctx, limit)
+	control.ctx = ctx
+
+	if p.monitor.timeouts == nil {
+		p.monitor.timeouts = make(map[string]*moduleTimeout)
+	}
+	p.monitor.timeouts[name] = &moduleTimeout{ctx: ctx, cancel: cancel, limit: limit}
+	log.Printf("[Pipeline] Module %s timeout: %v", name, limit)
+	return ctx
+}
+
+// stopTimeouts 流水线结束后释放模块超时的计时器和模块的上下文
+func (pm *pipelineMonitor) stopTimeouts() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, t := range pm.timeouts {
+		t.cancel()
+	}
+	for _, c := range pm.controls {
+		c.stop()
+	}
+}
+
+// nextOf 链上的下一个模块；显式指定了输出去向的模块（扇出及其分支）返回 nil，
+// 分支退出后由 FanOut 关闭合并输入，FanOut 退出时关闭各分支的输入
+func (pm *pipelineMonitor) nextOf(w *monitoredModule) *monitoredModule {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if len(w.downstream) > 0 {
+		return nil
+	}
+	for i, m := range pm.modules {
+		if m == w && i+1 < len(pm.modules) {
+			return pm.modules[i+1]
+		}
+	}
+	return nil
+}
+
+// watchTimeout 等待模块结束或到达截止时间
+func (w *monitoredModule) watchTimeout(done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-w.ctx.Done():
+		return
+	case <-w.deadline.ctx.Done():
+	}
+	// 流水线停止、结束或模块被停止时释放计时器，不是超时
+	if w.ctx.Err() != nil || !errors.Is(w.deadline.ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+
+	var received int
+	w.update(func(s *moduleState) {
+		s.timedOut = true
+		received = s.received
+	})
+	log.Printf("[%s] Module timed out after %v, downstream continues with forwarded results", w.state.name, w.deadline.limit)
+
+	if w.monitor.progress != nil {
+		w.monitor.progress.TimeoutModule(w.state.name)
+	}
+	limit := w.deadline.limit.String()
+	if w.deadline.limit >= time.Second {
+		limit = formatDuration(w.deadline.limit)
+	}
+	w.emit(EventLevelWarn, EventModuleTimeout, fmt.Sprintf("模块运行超过 %s，已停止，后续模块继续处理已输出的结果", limit), map[string]interface{}{
+		"timeout_seconds": w.deadline.limit.Seconds(),
+		"received":        received,
+	})
+
+	if next := w.monitor.nextOf(w); next != nil {
+		next.release()
+	}
+}
+
+// release 上游模块超时，不再等待上游关闭输入
+func (w *monitoredModule) release() {
+	w.releaseOnce.Do(func() {
+		w.update(func(s *moduleState) {
+			if !s.inputClosed {
+				s.inputClosed = true
+				s.closedAt = time.Now()
+			}
+		})
+		close(w.released)
+	})
+}
+
+// expired 模块超时或被停止的通知通道，模块不支持控制时为 nil
+func (w *monitoredModule) expired() <-chan struct{} {
+	if w.control != nil {
+		return w.control.ctx.Done()
+	}
+	if w.deadline == nil {
+		return nil
+	}
+	return w.deadline.ctx.Done()
+}
+
+// skipInput 模块超时或被停止后继续读取上游的数据并丢弃，避免上游阻塞，上游关闭输入后关闭真实模块的输入
+func (w *monitoredModule) skipInput() {
+	reason := SuppressModuleTimeout
+	w.update(func(s *moduleState) {
+		if s.stopped {
+			reason = SuppressModuleStopped
+		}
+	})
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case data, ok := <-w.input:
+			if !ok {
+				w.inner.CloseInput()
+				return
+			}
+			w.monitor.suppression.Record(w.state.name, reason, data)
+		}
+	}
+}
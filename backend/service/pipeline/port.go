@@ -2,12 +2,12 @@ package pipeline
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"time"
 
 	"moongazing/models"
 	"moongazing/scanner/core"
+	"moongazing/scanner/portscan"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -64,10 +64,11 @@ func (p *ScanPipeline) runPortScan() {
 
 	log.Printf("[Pipeline] Running port scan for %d targets: %v", len(targets), targets)
 
-	// 检查 GoGo 是否可用
+	// GoGo 不可用时使用内置 TCP 连接扫描
+	var scanner portscan.PortScanner = p.gogoScanner
 	if !p.gogoScanner.IsAvailable() {
-		log.Printf("[Pipeline] GoGo not available, skipping port scan")
-		return
+		log.Printf("[Pipeline] GoGo not available, falling back to built-in TCP connect scan")
+		scanner = p.gogoScanner.TCPFallback()
 	}
 
 	for _, target := range targets {
@@ -91,20 +92,20 @@ func (p *ScanPipeline) runPortScan() {
 		switch portScanMode {
 		case "full":
 			log.Printf("[Pipeline] Full port scan on %s", target)
-			scanResult, err = p.gogoScanner.FullScan(ctx, target)
+			scanResult, err = scanner.FullScan(ctx, target)
 		case "top1000":
 			log.Printf("[Pipeline] Top1000 port scan on %s", target)
-			scanResult, err = p.gogoScanner.Top1000Scan(ctx, target)
+			scanResult, err = scanner.Top1000Scan(ctx, target)
 		case "custom":
 			customPorts := p.task.Config.PortRange
 			if customPorts == "" {
 				customPorts = "1-1000"
 			}
 			log.Printf("[Pipeline] Custom port scan (%s) on %s", customPorts, target)
-			scanResult, err = p.gogoScanner.ScanPorts(ctx, target, customPorts)
+			scanResult, err = scanner.ScanPorts(ctx, target, customPorts)
 		default:
 			log.Printf("[Pipeline] Quick port scan on %s", target)
-			scanResult, err = p.gogoScanner.QuickScan(ctx, target)
+			scanResult, err = scanner.QuickScan(ctx, target)
 		}
 		cancel()
 
@@ -139,13 +140,12 @@ func (p *ScanPipeline) runPortScan() {
 					if port.Port == 443 || port.Port == 8443 {
 						protocol = "https"
 					}
-					url := fmt.Sprintf("%s://%s:%d", protocol, target, port.Port)
 
 					asset := AssetInfo{
 						Host:        target,
 						Port:        port.Port,
 						Protocol:    protocol,
-						URL:         url,
+						URL:         core.BuildURL(protocol, target, port.Port),
 						Title:       port.Banner, // GoGo 返回的 Title
 						Fingerprint: port.Fingerprint,
 						Server:      port.Version, // GoGo 返回的 Midware
@@ -242,6 +242,8 @@ func (p *ScanPipeline) savePortResult(port core.PortResult, host string) {
 			"version":     port.Version,
 			"banner":      port.Banner,
 			"fingerprint": port.Fingerprint,
+			"protocol":    port.Protocol,
+			"tls":         port.TLS,
 		},
 		CreatedAt: time.Now(),
 	}
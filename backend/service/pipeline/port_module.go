@@ -4,21 +4,36 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
 	"moongazing/scanner/portscan"
 )
 
+// portProbeTimeout 开放端口补充探测（连接耗时、TLS 证书）的超时
+const portProbeTimeout = 3 * time.Second
+
+// portProbeConcurrency 开放端口补充探测的并发数（模块内所有主机共用）
+const portProbeConcurrency = 50
+
 // PortScanModule 端口扫描模块
 // 接收预处理后的域名，执行端口扫描，输出存活端口
 type PortScanModule struct {
 	BaseModule
 	gogoScanner *portscan.GoGoScanner
+	scanner     portscan.PortScanner // 本次运行使用的扫描器，gogo 不可用时为内置 TCP 连接扫描
+	scannerName string
 	resultChan  chan interface{}
 	portRange   string
 	scanMode    string
+	ipv6Mode    string        // IPv6 目标的处理方式，见 core.IPv6Mode*
+	checkpoint  *Checkpoint   // 任务断点，已扫描完成的主机不再扫描
+	probeDialer net.Dialer    // 补充探测的拨号设置，SetNetwork 设置自定义 DNS
+	probeLimit  chan struct{} // 补充探测的并发名额
 }
 
 // NewPortScanModule 创建端口扫描模块
@@ -41,10 +56,33 @@ func NewPortScanModule(ctx context.Context, nextModule ModuleRunner, portRange,
 		resultChan:  make(chan interface{}, 1000),
 		portRange:   portRange,
 		scanMode:    scanMode,
+		probeDialer: net.Dialer{Timeout: portProbeTimeout},
+		probeLimit:  make(chan struct{}, portProbeConcurrency),
 	}
 	return m
 }
 
+// SetThreads 设置 gogo 线程数，0 保持默认值
+func (m *PortScanModule) SetThreads(threads int) {
+	if threads > 0 {
+		m.gogoScanner = m.gogoScanner.WithThreads(threads)
+	}
+}
+
+// SetIPv6Mode 设置 IPv6 目标的处理方式：默认双栈主机使用 IPv4，prefer 优先 IPv6，skip 不扫描 IPv6 地址
+func (m *PortScanModule) SetIPv6Mode(mode string) {
+	if !core.ValidIPv6Mode(mode) {
+		log.Printf("[%s] Warning: unknown ipv6_mode %q, using default", m.name, mode)
+		mode = core.IPv6ModeDefault
+	}
+	m.ipv6Mode = mode
+}
+
+// SetGoGoScanner 设置 GoGo 扫描器
+func (m *PortScanModule) SetGoGoScanner(scanner *portscan.GoGoScanner) {
+	m.gogoScanner = scanner
+}
+
 // ModuleRun 运行模块
 func (m *PortScanModule) ModuleRun() error {
 	var allWg sync.WaitGroup
@@ -55,14 +93,12 @@ func (m *PortScanModule) ModuleRun() error {
 	m.ReportModuleStart(0)
 	defer m.ReportModuleComplete()
 
-	// 检查 GoGo 是否可用
+	// GoGo 不可用时改用内置 TCP 连接扫描，速度较慢且不识别协议
+	m.scanner, m.scannerName = m.gogoScanner, "gogo"
 	if !m.gogoScanner.IsAvailable() {
-		log.Printf("[%s] GoGo not available, skipping port scan", m.name)
-		// 直接关闭下一个模块
-		if m.nextModule != nil {
-			m.nextModule.CloseInput()
-		}
-		return nil
+		log.Printf("[%s] GoGo not available, falling back to built-in TCP connect scan", m.name)
+		m.scanner, m.scannerName = m.gogoScanner.TCPFallback(), "tcp-connect"
+		m.emitDegraded("gogo", "内置 TCP 连接扫描", "速度较慢，仅根据 banner 和端口推断服务")
 	}
 
 	// 启动下一个模块
@@ -80,7 +116,13 @@ func (m *PortScanModule) ModuleRun() error {
 	resultWg.Add(1)
 	go func() {
 		defer resultWg.Done()
+		tracker := newCheckpointTracker(m.checkpoint, CheckpointPortScan)
 		for result := range m.resultChan {
+			// 主机扫描完成，登记已发送的端口
+			if mark, ok := result.(checkpointMark); ok {
+				tracker.mark(mark)
+				continue
+			}
 			if portAlive, ok := result.(PortAlive); ok {
 				// 去重检查
 				if portAlive.Port != "" && m.dupChecker.IsPortDuplicate(portAlive.Host, portAlive.Port) {
@@ -98,6 +140,7 @@ func (m *PortScanModule) ModuleRun() error {
 				case m.nextModule.GetInput() <- result:
 				}
 			}
+			tracker.sent(result)
 		}
 		// 关闭下一个模块的输入
 		if m.nextModule != nil {
@@ -137,17 +180,21 @@ func (m *PortScanModule) ModuleRun() error {
 			case DomainSkip:
 				domainSkip = v
 			case string:
-				// 支持直接传入域名字符串
+				// 支持直接传入域名字符串，IP 目标（含展开的网段）结果带上具体 IP
 				domainSkip = DomainSkip{
 					Domain: v,
 					Skip:   false,
 				}
+				if isIPAddress(v) {
+					domainSkip.IP = []string{v}
+				}
 			case DomainResolve:
 				// 支持 DomainResolve 类型
 				domainSkip = DomainSkip{
 					Domain: v.Domain,
 					IP:     v.IP,
-					Skip:   false,
+					Skip:   v.SkipReason != "",
+					Reason: v.SkipReason,
 				}
 			default:
 				// 非预期类型，直接传递
@@ -160,13 +207,20 @@ func (m *PortScanModule) ModuleRun() error {
 
 			// 如果需要跳过（如CDN），不进行端口扫描
 			if domainSkip.Skip {
-				log.Printf("[%s] Skipping %s (CDN: %s)", m.name, domainSkip.Domain, domainSkip.CDN)
+				log.Printf("[%s] Skipping %s (CDN: %s, reason: %s)", m.name, domainSkip.Domain, domainSkip.CDN, domainSkip.Reason)
 				continue
 			}
 
+			// 记录域名的全部 IP，后续模块按负载最小的 IP 调度
+			m.ipScheduler.RecordHost(domainSkip.Domain, domainSkip.IP)
+
 			allWg.Add(1)
 			go func(ds DomainSkip) {
 				defer allWg.Done()
+				if m.checkpoint.Done(CheckpointPortScan, ds.Domain) {
+					m.replayPorts(ds.Domain)
+					return
+				}
 				m.scanPorts(ds)
 			}(domainSkip)
 		}
@@ -175,7 +229,25 @@ func (m *PortScanModule) ModuleRun() error {
 
 // scanPorts 执行端口扫描
 func (m *PortScanModule) scanPorts(ds DomainSkip) {
-	log.Printf("[%s] Starting port scan for %s (mode: %s)", m.name, ds.Domain, m.scanMode)
+	// 按 IPv6 设置选择主机的 IP，全部是 IPv6 且设置为跳过时不扫描
+	ips := core.SelectIPs(ds.IP, m.ipv6Mode)
+	if len(ds.IP) > 0 && len(ips) == 0 {
+		log.Printf("[%s] Skipping %s: only IPv6 addresses %v and ipv6_mode is skip", m.name, ds.Domain, ds.IP)
+		m.suppression.Record(m.name, SuppressIPv6Skipped, ds.Domain)
+		m.markScanned(ds.Domain)
+		return
+	}
+	ip := ""
+	if len(ips) > 0 {
+		ip = ips[0]
+	}
+	// gogo 按主机名扫描时只使用 IPv4：只有 AAAA 记录或优先 IPv6 的主机直接扫描 IPv6 地址（不支持时改用 TCP 连接扫描）
+	target := ds.Domain
+	if core.IsIPv6(ip) && !isIPAddress(ds.Domain) {
+		target = ip
+	}
+
+	log.Printf("[%s] Starting port scan for %s (mode: %s, target: %s)", m.name, ds.Domain, m.scanMode, target)
 
 	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Minute)
 	defer cancel()
@@ -186,52 +258,136 @@ func (m *PortScanModule) scanPorts(ds DomainSkip) {
 	// 根据扫描模式选择扫描方式
 	switch m.scanMode {
 	case "full":
-		scanResult, err = m.gogoScanner.FullScan(ctx, ds.Domain)
+		scanResult, err = m.scanner.FullScan(ctx, target)
 	case "top1000":
-		scanResult, err = m.gogoScanner.Top1000Scan(ctx, ds.Domain)
+		scanResult, err = m.scanner.Top1000Scan(ctx, target)
 	case "custom":
-		scanResult, err = m.gogoScanner.ScanPorts(ctx, ds.Domain, m.portRange)
+		scanResult, err = m.scanner.ScanPorts(ctx, target, m.portRange)
 	default: // quick
-		scanResult, err = m.gogoScanner.QuickScan(ctx, ds.Domain)
+		scanResult, err = m.scanner.QuickScan(ctx, target)
 	}
 
 	if err != nil {
-		log.Printf("[%s] GoGo error for %s: %v", m.name, ds.Domain, err)
+		log.Printf("[%s] %s error for %s: %v", m.name, m.scannerName, ds.Domain, err)
+		m.emitTargetError(m.scannerName, ds.Domain, err)
 		return
 	}
 
 	if scanResult == nil {
+		m.markScanned(ds.Domain)
 		return
 	}
 
-	// 发送扫描结果
+	// 开放端口并发补充探测，全部完成后按扫描顺序发送
+	var results []PortAlive
 	for _, port := range scanResult.Ports {
 		if port.State != "open" {
 			continue
 		}
+		results = append(results, PortAlive{
+			Host:     ds.Domain,
+			IP:       ip,
+			Family:   core.AddressFamily(ip),
+			Port:     intToString(port.Port),
+			Service:  port.Service,
+			Protocol: port.Protocol,
+			TLS:      port.TLS,
+		})
+	}
+	m.probePorts(ctx, results)
 
-		ip := ""
-		if len(ds.IP) > 0 {
-			ip = ds.IP[0]
+	for _, result := range results {
+		log.Printf("[%s] Found open port: %s:%s (%s)", m.name, ds.Domain, result.Port, result.Service)
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- result:
 		}
+	}
+
+	log.Printf("[%s] Port scan completed for %s, found %d ports", m.name, ds.Domain, len(scanResult.Ports))
+	m.markScanned(ds.Domain)
+}
 
-		result := PortAlive{
-			Host:    ds.Domain,
-			IP:      ip,
-			Port:    intToString(port.Port),
-			Service: port.Service,
+// probePorts 并发探测开放端口，并发数受 portProbeConcurrency 限制，
+// 每个探测占用 IP 调度器的名额，避免对同一 IP 的连接超过单 IP 并发上限
+func (m *PortScanModule) probePorts(ctx context.Context, results []PortAlive) {
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Protocol == "udp" {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case m.probeLimit <- struct{}{}:
 		}
+		wg.Add(1)
+		go func(result *PortAlive) {
+			defer wg.Done()
+			defer func() { <-m.probeLimit }()
+			release, ok := m.ipScheduler.Acquire(ctx, result.Host, result.IP)
+			if !ok {
+				return
+			}
+			defer release()
+			m.probePort(ctx, result)
+		}(&results[i])
+	}
+	wg.Wait()
+}
+
+// probePort 测量开放端口的 TCP 连接耗时，GoGo 识别为 TLS 的端口获取证书
+func (m *PortScanModule) probePort(ctx context.Context, result *PortAlive) {
+	port, err := strconv.Atoi(result.Port)
+	if err != nil {
+		return
+	}
+	host := result.IP
+	if host == "" {
+		host = result.Host
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, portProbeTimeout)
+	start := time.Now()
+	conn, err := m.probeDialer.DialContext(dialCtx, "tcp", core.HostPort(host, port))
+	cancel()
+	if err != nil {
+		return
+	}
+	// 向上取整到毫秒，本地网络的连接耗时不足 1ms 时也能与未探测区分
+	result.ResponseTimeMs = (time.Since(start) + time.Millisecond - 1).Milliseconds()
+	conn.Close()
 
-		log.Printf("[%s] Found open port: %s:%d (%s)", m.name, ds.Domain, port.Port, port.Service)
+	if result.TLS {
+		result.Certificate = fingerprint.GetCertInfoWithDialer(ctx, m.probeDialer.DialContext, host, port, portProbeTimeout)
+	}
+}
 
+// markScanned 主机扫描完成，跟在该主机的端口之后登记断点（扫描被取消时不记录）
+func (m *PortScanModule) markScanned(host string) {
+	if m.checkpoint == nil || m.ctx.Err() != nil {
+		return
+	}
+	select {
+	case <-m.ctx.Done():
+	case m.resultChan <- checkpointMark{module: CheckpointPortScan, key: host}:
+	}
+}
+
+// replayPorts 主机在断点中已扫描完成，输出之前保存的端口代替重新扫描
+func (m *PortScanModule) replayPorts(host string) {
+	restored := m.checkpoint.restoredPorts(host)
+	log.Printf("[%s] %s already scanned before resume, replaying %d ports", m.name, host, len(restored))
+	for _, result := range restored {
 		select {
 		case <-m.ctx.Done():
 			return
 		case m.resultChan <- result:
 		}
 	}
-
-	log.Printf("[%s] Port scan completed for %s, found %d ports", m.name, ds.Domain, len(scanResult.Ports))
 }
 
 // intToString 整数转字符串
@@ -10,6 +10,7 @@ import (
 
 // PortScanPreparationModule 端口扫描预处理模块
 // 负责在端口扫描前进行CDN检测，决定是否跳过某些目标
+// CDN 判定需要 CNAME 链或 IP 段命中，不依赖 httpx 探测结果，响应头只作为佐证
 type PortScanPreparationModule struct {
 	BaseModule
 	cdnDetector *subdomain.CDNDetector
@@ -30,6 +31,16 @@ func NewPortScanPreparationModule(ctx context.Context, nextModule ModuleRunner)
 	return m
 }
 
+// SetResolverPool 设置解析器池，CDN 检测的 IP 解析命中流水线缓存
+func (m *PortScanPreparationModule) SetResolverPool(pool *subdomain.ResolverPool) {
+	m.cdnDetector.SetIPLookup(pool.Resolve)
+}
+
+// SetCDNDetector 设置 CDN 检测器
+func (m *PortScanPreparationModule) SetCDNDetector(detector *subdomain.CDNDetector) {
+	m.cdnDetector = detector
+}
+
 // ModuleRun 运行模块
 func (m *PortScanPreparationModule) ModuleRun() error {
 	var allWg sync.WaitGroup
@@ -109,13 +120,39 @@ func (m *PortScanPreparationModule) ModuleRun() error {
 					IsCDN:  false,
 				}
 
-				// 执行CDN检测 - 使用域名检测
-				cdnResult := m.cdnDetector.DetectCDN(m.ctx, dr.Domain)
+				// 上游已判定无需端口扫描（如 SaaS 平台），不再做CDN检测
+				if dr.SkipReason != "" {
+					domainSkip.Skip = true
+					domainSkip.Reason = dr.SkipReason
+					select {
+					case <-m.ctx.Done():
+					case m.resultChan <- domainSkip:
+					}
+					return
+				}
+
+				// 解析到被排除的 IP 时不扫描端口
+				if _, excluded := m.dropOutOfScopeIPs(dr); excluded {
+					domainSkip.Skip = true
+					domainSkip.Reason = SuppressOutOfScope
+					select {
+					case <-m.ctx.Done():
+					case m.resultChan <- domainSkip:
+					}
+					return
+				}
+
+				// 执行CDN检测 - 复用域名验证得到的 CNAME 链，IP 与解析器池中的结果合并
+				cdnResult := m.cdnDetector.Detect(m.ctx, dr.Domain, dr.CNAMEs, dr.IP)
 				if cdnResult != nil && cdnResult.IsCDN {
 					domainSkip.IsCDN = true
 					domainSkip.CDN = cdnResult.CDNProvider
 					domainSkip.Skip = true // CDN目标跳过端口扫描
-					log.Printf("[%s] Detected CDN for %s: %s", m.name, dr.Domain, cdnResult.CDNProvider)
+					domainSkip.Reason = "cdn"
+					domainSkip.Evidence = cdnResult.Evidence
+					log.Printf("[%s] Detected CDN for %s: %s (%s)", m.name, dr.Domain, cdnResult.CDNProvider, cdnResult.Evidence)
+				} else if cdnResult != nil && len(cdnResult.Headers) > 0 {
+					log.Printf("[%s] Ignoring CDN headers for %s without CNAME/IP match: %v", m.name, dr.Domain, cdnResult.Headers)
 				}
 
 				// 发送结果
@@ -2,8 +2,11 @@ package pipeline
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	"moongazing/scanner/subdomain"
 )
 
 // ProgressTracker 进度追踪器
@@ -23,12 +26,28 @@ type ProgressTracker struct {
 	
 	// 进度回调
 	callback ProgressCallback
+
+	// 时间上限
+	timeLimit      time.Duration // 任务时间上限，0 表示不限制
+	overrunWarning bool          // 是否已超过时间上限的预警比例
+
+	// DNS 缓存统计
+	dnsStats func() subdomain.ResolverStats
+
+	// 各模块输入通道的占用统计
+	channels func() map[string]ChannelStats
+
+	// 运行中的提示（如多个主机共用一个 IP 被限制并发），按来源去重
+	warnings map[string]string
+
+	// 从断点恢复时的起始进度，总体进度不低于该值
+	baseline int
 }
 
 // ModuleProgress 模块进度
 type ModuleProgress struct {
 	Name           string    `json:"name"`            // 模块名称
-	Status         string    `json:"status"`          // pending, running, completed
+	Status         string    `json:"status"`          // pending, running, completed, timeout, skipped, stopped
 	TotalItems     int       `json:"total_items"`     // 总项目数
 	ProcessedItems int       `json:"processed_items"` // 已处理项目数
 	OutputItems    int       `json:"output_items"`    // 输出项目数
@@ -49,20 +68,29 @@ type ProgressReport struct {
 	TotalResults      int                        `json:"total_results"`      // 总结果数
 	ElapsedTime       string                     `json:"elapsed_time"`       // 已用时间
 	EstimatedTimeLeft string                     `json:"estimated_time_left"`// 预计剩余时间
+	TimeLimit         string                     `json:"time_limit,omitempty"`      // 任务时间上限
+	OverrunWarning    bool                       `json:"overrun_warning,omitempty"` // 即将超过时间上限
+	DNSCache          *subdomain.ResolverStats   `json:"dns_cache,omitempty"`       // DNS 缓存命中率等统计
+	Channels          map[string]ChannelStats    `json:"channels,omitempty"`        // 各模块输入通道和结果通道的占用
+	Warnings          []string                   `json:"warnings,omitempty"`        // 运行中的提示
 }
 
 // DefaultModuleWeights 默认模块权重
 // 权重决定每个模块在总体进度中所占的比例
 var DefaultModuleWeights = map[string]float64{
-	"SubdomainScan":     20, // 子域名扫描 20%
-	"DomainVerify":      5,  // 域名验证 5%
-	"PortPreparation":   5,  // 端口预处理 5%
-	"PortScan":          25, // 端口扫描 25%
-	"Fingerprint":       15, // 指纹识别 15%
-	"VulnScan":          15, // 漏洞扫描 15%
-	"Crawler":           5,  // 爬虫 5%
-	"DirScan":           5,  // 目录扫描 5%
-	"Sensitive":         5,  // 敏感信息 5%
+	"SubdomainScan":      20, // 子域名扫描 20%
+	"DomainVerify":       5,  // 域名验证 5%
+	"PortPreparation":    5,  // 端口预处理 5%
+	"LivenessCheck":      5,  // 主机存活预检测 5%
+	"PortScan":           25, // 端口扫描 25%
+	"Fingerprint":        15, // 指纹识别 15%
+	"Screenshot":         5,  // 页面截图 5%
+	"VulnScan":           15, // 漏洞扫描 15%
+	"Crawler":            5,  // 爬虫 5%
+	"DirScan":            5,  // 目录扫描 5%
+	"EndpointExtraction": 5,  // 接口提取 5%
+	"ContentAnalysis":    5,  // 内容敏感信息 5%
+	"Sensitive":          5,  // 敏感信息 5%
 }
 
 // NewProgressTracker 创建进度追踪器
@@ -103,6 +131,10 @@ func (pt *ProgressTracker) StartModule(moduleName string, totalItems int) {
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
 	
+	// 启动前已被跳过或停止的模块保留状态
+	if mp, ok := pt.moduleProgress[moduleName]; ok && mp.frozen() {
+		return
+	}
 	pt.moduleProgress[moduleName] = &ModuleProgress{
 		Name:       moduleName,
 		Status:     "running",
@@ -118,7 +150,7 @@ func (pt *ProgressTracker) UpdateModuleTotal(moduleName string, totalItems int)
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
 	
-	if mp, ok := pt.moduleProgress[moduleName]; ok {
+	if mp, ok := pt.moduleProgress[moduleName]; ok && !mp.frozen() {
 		mp.TotalItems = totalItems
 	}
 	
@@ -130,7 +162,7 @@ func (pt *ProgressTracker) IncrementModuleProcessed(moduleName string, count int
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
 	
-	if mp, ok := pt.moduleProgress[moduleName]; ok {
+	if mp, ok := pt.moduleProgress[moduleName]; ok && !mp.frozen() {
 		mp.ProcessedItems += count
 		if mp.TotalItems > 0 {
 			mp.Progress = float64(mp.ProcessedItems) / float64(mp.TotalItems) * 100
@@ -159,7 +191,15 @@ func (pt *ProgressTracker) CompleteModule(moduleName string) {
 	defer pt.mu.Unlock()
 	
 	if mp, ok := pt.moduleProgress[moduleName]; ok {
-		mp.Status = "completed"
+		// 跳过或停止的模块保留状态和控制时的进度
+		if mp.frozen() {
+			pt.notifyProgress()
+			return
+		}
+		// 超时的模块退出时保留 timeout 状态
+		if mp.Status != "timeout" {
+			mp.Status = "completed"
+		}
 		mp.EndTime = time.Now()
 		mp.Progress = 100
 	}
@@ -167,6 +207,156 @@ func (pt *ProgressTracker) CompleteModule(moduleName string) {
 	pt.notifyProgress()
 }
 
+// TimeoutModule 模块超时，已停止运行，不再计入剩余进度
+func (pt *ProgressTracker) TimeoutModule(moduleName string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if mp, ok := pt.moduleProgress[moduleName]; ok {
+		mp.Status = "timeout"
+		mp.EndTime = time.Now()
+		mp.Progress = 100
+	}
+
+	pt.notifyProgress()
+}
+
+// SkipModule 模块跳过剩余输入，进度保持在当前数值
+func (pt *ProgressTracker) SkipModule(moduleName string) {
+	pt.freezeModule(moduleName, "skipped")
+}
+
+// StopModule 模块在运行中被停止，进度保持在当前数值
+func (pt *ProgressTracker) StopModule(moduleName string) {
+	pt.freezeModule(moduleName, "stopped")
+}
+
+// freezeModule 标记模块状态并停止更新进度，总体进度按已完成计算
+func (pt *ProgressTracker) freezeModule(moduleName, status string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	mp, ok := pt.moduleProgress[moduleName]
+	if !ok {
+		mp = &ModuleProgress{Name: moduleName, StartTime: time.Now()}
+		pt.moduleProgress[moduleName] = mp
+	}
+	mp.Status = status
+	mp.EndTime = time.Now()
+
+	pt.notifyProgress()
+}
+
+// frozen 模块是否已跳过或停止，不再更新进度
+func (mp *ModuleProgress) frozen() bool {
+	return mp.Status == "skipped" || mp.Status == "stopped"
+}
+
+// AdjustTotalTargets 调整总目标数（网段展开、存活预检测过滤后目标数会变化）
+func (pt *ProgressTracker) AdjustTotalTargets(delta int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.totalTargets += delta
+	if pt.totalTargets < 0 {
+		pt.totalTargets = 0
+	}
+
+	pt.notifyProgress()
+}
+
+// SetTimeLimit 设置任务时间上限（仅用于进度报告展示）
+func (pt *ProgressTracker) SetTimeLimit(limit time.Duration) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.timeLimit = limit
+}
+
+// SetBaseline 设置起始进度（从断点恢复的任务从中断时的进度开始）
+func (pt *ProgressTracker) SetBaseline(progress int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.baseline = progress
+}
+
+// SetDNSStats 设置 DNS 缓存统计来源
+func (pt *ProgressTracker) SetDNSStats(fn func() subdomain.ResolverStats) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.dnsStats = fn
+}
+
+// dnsCacheStats 获取 DNS 缓存统计（需要持有锁）
+func (pt *ProgressTracker) dnsCacheStats() *subdomain.ResolverStats {
+	if pt.dnsStats == nil {
+		return nil
+	}
+	stats := pt.dnsStats()
+	return &stats
+}
+
+// SetChannelStats 设置通道占用统计来源
+func (pt *ProgressTracker) SetChannelStats(fn func() map[string]ChannelStats) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.channels = fn
+}
+
+// channelStats 采样通道占用（需要持有锁）
+func (pt *ProgressTracker) channelStats() map[string]ChannelStats {
+	if pt.channels == nil {
+		return nil
+	}
+	return pt.channels()
+}
+
+// SetWarning 设置提示，同一来源的提示会被覆盖
+func (pt *ProgressTracker) SetWarning(key, message string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.warnings == nil {
+		pt.warnings = make(map[string]string)
+	}
+	if pt.warnings[key] == message {
+		return
+	}
+	pt.warnings[key] = message
+	pt.notifyProgress()
+}
+
+// warningList 按来源排序的提示（需要持有锁）
+func (pt *ProgressTracker) warningList() []string {
+	if len(pt.warnings) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(pt.warnings))
+	for key := range pt.warnings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]string, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, pt.warnings[key])
+	}
+	return list
+}
+
+// MarkOverrun 标记任务即将超过时间上限
+func (pt *ProgressTracker) MarkOverrun() {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.overrunWarning = true
+	pt.notifyProgress()
+}
+
+// timeLimitString 格式化时间上限（需要持有锁）
+func (pt *ProgressTracker) timeLimitString() string {
+	if pt.timeLimit <= 0 {
+		return ""
+	}
+	return formatDuration(pt.timeLimit)
+}
+
 // GetOverallProgress 获取总体进度
 func (pt *ProgressTracker) GetOverallProgress() int {
 	pt.mu.RLock()
@@ -186,11 +376,16 @@ func (pt *ProgressTracker) calculateOverallProgress() int {
 			weight = 10 // 默认权重
 		}
 		activeWeight += weight
+		// 跳过或停止的模块不再计入剩余进度
+		if mp.frozen() {
+			totalProgress += weight
+			continue
+		}
 		totalProgress += (mp.Progress / 100) * weight
 	}
 	
 	if activeWeight == 0 {
-		return 0
+		return pt.baseline
 	}
 	
 	// 归一化到已激活模块的权重比例
@@ -198,6 +393,9 @@ func (pt *ProgressTracker) calculateOverallProgress() int {
 	if progress > 100 {
 		progress = 100
 	}
+	if progress < pt.baseline {
+		progress = pt.baseline
+	}
 	
 	return progress
 }
@@ -252,6 +450,11 @@ func (pt *ProgressTracker) GetReport() *ProgressReport {
 		TotalResults:      totalResults,
 		ElapsedTime:       formatDuration(elapsed),
 		EstimatedTimeLeft: estimatedLeft,
+		TimeLimit:         pt.timeLimitString(),
+		OverrunWarning:    pt.overrunWarning,
+		DNSCache:          pt.dnsCacheStats(),
+		Channels:          pt.channelStats(),
+		Warnings:          pt.warningList(),
 	}
 }
 
@@ -311,6 +514,11 @@ func (pt *ProgressTracker) getReportUnsafe() *ProgressReport {
 		TotalResults:      totalResults,
 		ElapsedTime:       formatDuration(elapsed),
 		EstimatedTimeLeft: estimatedLeft,
+		TimeLimit:         pt.timeLimitString(),
+		OverrunWarning:    pt.overrunWarning,
+		DNSCache:          pt.dnsCacheStats(),
+		Channels:          pt.channelStats(),
+		Warnings:          pt.warningList(),
 	}
 }
 
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"moongazing/scanner/core"
+)
+
+// 认证扫描的自定义请求头
+// PipelineConfig.CustomHeaders、CookieJar 设置后，指纹识别和 HTTP 探测直接带上请求头，katana、spray 通过 -H/--header 传入，
+// rad 和不支持该参数的工具版本不传，记录 headers_unsupported 警告事件。
+// 启动时对第一个目标做一次预检：分别带和不带请求头请求，响应没有差别时记录会话可能失效的警告
+
+// scanHeaders 任务的自定义请求头，未设置时返回 nil
+func (c *PipelineConfig) scanHeaders() *core.ScanHeaders {
+	return core.NewScanHeaders(c.CustomHeaders, c.CookieJar)
+}
+
+// logString 用于日志的配置，自定义请求头的值已脱敏
+func (c *PipelineConfig) logString() string {
+	redacted := *c
+	if headers := c.scanHeaders(); headers != nil {
+		redacted.CustomHeaders = map[string]string{"redacted": strings.Join(headers.Redacted(), "; ")}
+		redacted.CookieJar = ""
+	}
+	return fmt.Sprintf("%+v", redacted)
+}
+
+// applyScanHeaders 把自定义请求头应用到各模块的扫描器，并在后台做认证预检
+func (p *StreamingPipeline) applyScanHeaders(targets []string) {
+	headers := p.config.scanHeaders()
+	if headers.IsEmpty() {
+		return
+	}
+	log.Printf("[Pipeline] Custom headers: %v", headers.Redacted())
+
+	if p.subdomainModule != nil {
+		p.subdomainModule.SetHeaders(headers)
+	}
+	if p.fingerprintModule != nil {
+		p.fingerprintModule.SetHeaders(headers)
+	}
+	if p.crawlerModule != nil {
+		p.crawlerModule.SetHeaders(headers)
+	}
+	if p.dirScanModule != nil {
+		p.dirScanModule.SetHeaders(headers)
+	}
+	if p.contentModule != nil {
+		p.contentModule.SetHeaders(headers)
+	}
+
+	if target := preflightTarget(targets); target != "" {
+		go p.runAuthPreflight(target, headers)
+	}
+}
+
+// SetHeaders 设置 HTTP 探测的自定义请求头
+func (m *SubdomainScanModule) SetHeaders(headers *core.ScanHeaders) {
+	if m.httpxScanner != nil {
+		m.httpxScanner.SetHeaders(headers)
+	}
+}
+
+// SetHeaders 设置指纹识别的自定义请求头（页面和 favicon 请求）
+func (m *FingerprintModule) SetHeaders(headers *core.ScanHeaders) {
+	m.fingerprintScanner.SetHeaders(headers)
+}
+
+// SetHeaders 设置 katana 的 -H 参数，rad 不支持命令行请求头，只对启用的爬虫记录不支持
+func (m *CrawlerModule) SetHeaders(headers *core.ScanHeaders) {
+	if m.katanaScanner.SetHeaders(headers) && m.useKatana {
+		m.emitHeadersUnsupported("katana")
+	}
+	if m.radEnabled() {
+		m.emitHeadersUnsupported("rad")
+	}
+}
+
+// SetHeaders 设置 spray 的 --header 参数
+func (m *DirScanModule) SetHeaders(headers *core.ScanHeaders) {
+	if m.sprayScanner == nil {
+		return
+	}
+	if m.sprayScanner.SetHeaders(headers) && m.sprayScanner.IsAvailable() {
+		m.emitHeadersUnsupported("spray")
+	}
+}
+
+// emitHeadersUnsupported 记录工具不支持自定义请求头，该工具的请求不带认证信息
+func (m *BaseModule) emitHeadersUnsupported(tool string) {
+	log.Printf("[%s] %s does not support custom headers, its requests are sent without them", m.name, tool)
+	m.events.Emit(m.name, EventLevelWarn, EventHeadersUnsupported,
+		fmt.Sprintf("%s 不支持自定义请求头，其请求不带认证信息", tool), map[string]interface{}{
+			"tool": tool,
+		})
+}
+
+// preflightTarget 第一个目标的地址（目标已展开为主机），未带协议时使用 http
+func preflightTarget(targets []string) string {
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+			return target
+		}
+		return "http://" + target
+	}
+	return ""
+}
+
+// runAuthPreflight 比较带和不带自定义请求头的响应，会话可能失效时记录警告
+func (p *StreamingPipeline) runAuthPreflight(target string, headers *core.ScanHeaders) {
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	p.config.Network.ApplyTransport(transport, net.Dialer{Timeout: core.DefaultHTTPTimeout})
+	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	result, err := core.RunAuthPreflight(p.ctx, client, target, headers)
+	if err != nil {
+		if p.ctx.Err() == nil {
+			log.Printf("[Pipeline] Auth preflight of %s failed: %v", target, err)
+		}
+		return
+	}
+	data := map[string]interface{}{
+		"url":            result.URL,
+		"auth_status":    result.AuthStatus,
+		"auth_length":    result.AuthLength,
+		"anon_status":    result.AnonStatus,
+		"anon_length":    result.AnonLength,
+		"differs":        result.Differs,
+		"session_failed": result.SessionFailed,
+	}
+	if !result.SessionFailed {
+		p.events.Emit("AuthPreflight", EventLevelInfo, EventAuthPreflight,
+			fmt.Sprintf("%s 带认证请求头的响应（%d，%d 字节）与匿名响应（%d，%d 字节）不同，会话有效",
+				target, result.AuthStatus, result.AuthLength, result.AnonStatus, result.AnonLength), data)
+		return
+	}
+
+	log.Printf("[Pipeline] Auth preflight of %s: session appears invalid (status %d/%d, length %d/%d)",
+		target, result.AuthStatus, result.AnonStatus, result.AuthLength, result.AnonLength)
+	message := fmt.Sprintf("%s 带认证请求头的响应与匿名响应相同（%d，%d 字节），会话可能已失效", target, result.AuthStatus, result.AuthLength)
+	if result.Differs {
+		message = fmt.Sprintf("%s 带认证请求头仍返回 %d，会话可能已失效", target, result.AuthStatus)
+	}
+	p.events.Emit("AuthPreflight", EventLevelWarn, EventAuthPreflight, message, data)
+	if p.progressTracker != nil {
+		p.progressTracker.SetWarning("auth_preflight", message)
+	}
+}
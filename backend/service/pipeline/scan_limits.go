@@ -0,0 +1,70 @@
+package pipeline
+
+import "log"
+
+// 任务级并发和速率设置
+// 各扫描器默认值：gogo 1000 线程、指纹识别 20 并发、HTTP 探测 30 并发、spray 20 线程不限速、katana 10 并发 150 请求/秒。
+// 任务可以调低（脆弱的生产目标）或调高（内网大网段），0 保持默认值，超出范围的值限制到边界
+
+// 并发和速率设置的允许范围
+const (
+	MaxScanRateLimit      = 5000  // 每秒请求数（spray、katana）
+	MaxPortScanThreads    = 10000 // gogo 线程数
+	MaxHTTPConcurrency    = 500   // 指纹识别、HTTP 探测、spray 并发数
+	MaxCrawlerConcurrency = 100   // katana、rad 并发数
+	MaxVulnConcurrency    = 200   // nuclei 并发模板数
+	MaxCrawlerBatchSize   = 1000  // katana 每批 URL 数
+	MaxCrawlerBatches     = 10    // katana 同时运行的批次数
+	minScanLimit          = 1
+)
+
+// clampScanLimits 限制并发和速率设置的范围，超出范围时记录警告
+func (c *PipelineConfig) clampScanLimits() {
+	c.RateLimit = clampScanLimit("rate_limit", c.RateLimit, MaxScanRateLimit)
+	c.PortScanThreads = clampScanLimit("port_scan_threads", c.PortScanThreads, MaxPortScanThreads)
+	c.HTTPConcurrency = clampScanLimit("http_concurrency", c.HTTPConcurrency, MaxHTTPConcurrency)
+	c.CrawlerConcurrency = clampScanLimit("crawler_concurrency", c.CrawlerConcurrency, MaxCrawlerConcurrency)
+	c.CrawlerBatchSize = clampScanLimit("crawler_batch_size", c.CrawlerBatchSize, MaxCrawlerBatchSize)
+	c.CrawlerParallelBatches = clampScanLimit("crawler_parallel_batches", c.CrawlerParallelBatches, MaxCrawlerBatches)
+	c.VulnRateLimit = clampScanLimit("vuln_rate_limit", c.VulnRateLimit, MaxScanRateLimit)
+	c.VulnConcurrency = clampScanLimit("vuln_concurrency", c.VulnConcurrency, MaxVulnConcurrency)
+}
+
+// clampScanLimit 0 表示使用默认值，其余值限制在 [1, max]
+func clampScanLimit(name string, value, max int) int {
+	switch {
+	case value == 0:
+		return 0
+	case value < minScanLimit:
+		log.Printf("[Pipeline] Warning: %s %d out of range, using %d", name, value, minScanLimit)
+		return minScanLimit
+	case value > max:
+		log.Printf("[Pipeline] Warning: %s %d out of range, using %d", name, value, max)
+		return max
+	}
+	return value
+}
+
+// applyScanLimits 把任务级并发和速率设置应用到各模块的扫描器
+func (p *StreamingPipeline) applyScanLimits() {
+	c := p.config
+	if p.subdomainModule != nil {
+		p.subdomainModule.SetHTTPConcurrency(c.HTTPConcurrency)
+	}
+	if p.portScanModule != nil {
+		p.portScanModule.SetThreads(c.PortScanThreads)
+	}
+	if p.fingerprintModule != nil {
+		p.fingerprintModule.SetConcurrency(c.HTTPConcurrency)
+	}
+	if p.crawlerModule != nil {
+		p.crawlerModule.SetRateLimit(c.CrawlerConcurrency, c.RateLimit)
+		p.crawlerModule.SetBatchLimits(c.CrawlerBatchSize, c.CrawlerParallelBatches)
+	}
+	if p.dirScanModule != nil {
+		p.dirScanModule.SetRateLimit(c.HTTPConcurrency, c.RateLimit)
+	}
+	if p.vulnScanModule != nil {
+		p.vulnScanModule.SetRateLimit(c.VulnConcurrency, c.VulnRateLimit)
+	}
+}
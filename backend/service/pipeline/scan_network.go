@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"log"
+
+	"moongazing/scanner/core"
+)
+
+// 出站网络设置
+// PipelineConfig.Network 设置代理和自定义 DNS：指纹识别、HTTP 探测和子域名解析在进程内直接使用，
+// katana、spray、rad 通过参数传入。工具（或当前版本）不支持的设置不传参数，记录 network_unsupported 警告事件，扫描照常进行
+
+// applyScanNetwork 把出站网络设置应用到流水线的解析器池和各模块的扫描器
+func (p *StreamingPipeline) applyScanNetwork() {
+	cfg := p.config.Network
+	if !cfg.HasProxy() && !cfg.HasResolvers() {
+		return
+	}
+	log.Printf("[Pipeline] Scan network: proxy=%v resolvers=%v doh=%v", cfg.HasProxy(), cfg.ResolverServers(), cfg.DoH)
+
+	p.resolver.SetNetwork(cfg)
+	if p.subdomainModule != nil {
+		p.subdomainModule.SetNetwork(cfg)
+	}
+	if p.portScanModule != nil {
+		p.portScanModule.SetNetwork(cfg)
+	}
+	if p.fingerprintModule != nil {
+		p.fingerprintModule.SetNetwork(cfg)
+	}
+	if p.crawlerModule != nil {
+		p.crawlerModule.SetNetwork(cfg)
+	}
+	if p.dirScanModule != nil {
+		p.dirScanModule.SetNetwork(cfg)
+	}
+}
+
+// SetNetwork 设置子域名解析和 HTTP 探测的网络，字典爆破不支持 DoH 时记录警告
+func (m *SubdomainScanModule) SetNetwork(cfg *core.ScanNetworkConfig) {
+	m.emitNetworkUnsupported("ksubdomain", m.activeScanner.SetNetwork(cfg))
+	if m.httpxScanner != nil {
+		m.httpxScanner.SetNetwork(cfg)
+	}
+}
+
+// SetNetwork 设置端口补充探测的 DNS，目标没有解析出 IP 时按自定义 DNS 解析主机名
+func (m *PortScanModule) SetNetwork(cfg *core.ScanNetworkConfig) {
+	if resolver := cfg.Resolver(portProbeTimeout); resolver != nil {
+		m.probeDialer.Resolver = resolver
+	}
+}
+
+// SetNetwork 设置指纹识别和端口 HTTP 探测的代理和 DNS
+func (m *FingerprintModule) SetNetwork(cfg *core.ScanNetworkConfig) {
+	m.fingerprintScanner.SetNetwork(cfg)
+	if m.httpProber != nil {
+		m.httpProber.SetNetwork(cfg)
+	}
+}
+
+// SetNetwork 设置 katana、rad 的代理和 DNS 参数，只对启用的爬虫记录不支持的设置
+func (m *CrawlerModule) SetNetwork(cfg *core.ScanNetworkConfig) {
+	unsupported := m.katanaScanner.SetNetwork(cfg)
+	if m.useKatana && m.katanaScanner.IsAvailable() {
+		m.emitNetworkUnsupported("katana", unsupported)
+	}
+	unsupported = m.radScanner.SetNetwork(cfg)
+	if m.radEnabled() {
+		m.emitNetworkUnsupported("rad", unsupported)
+	}
+}
+
+// SetNetwork 设置 spray 的代理参数
+func (m *DirScanModule) SetNetwork(cfg *core.ScanNetworkConfig) {
+	if m.sprayScanner == nil {
+		return
+	}
+	unsupported := m.sprayScanner.SetNetwork(cfg)
+	if m.sprayScanner.IsAvailable() {
+		m.emitNetworkUnsupported("spray", unsupported)
+	}
+}
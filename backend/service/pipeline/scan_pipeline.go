@@ -105,6 +105,8 @@ func NewScanPipeline(task *models.Task, taskService TaskService, resultService R
 		FofaKey:   cfg.ThirdParty.Fofa.Key,
 		HunterKey: cfg.ThirdParty.Hunter.Key,
 		QuakeKey:  cfg.ThirdParty.Quake.Key,
+		OTXKey:    cfg.ThirdParty.OTX.Key,
+		ChaosKey:  cfg.ThirdParty.Chaos.Key,
 	}
 	thirdpartyManager := thirdparty.NewAPIManager(apiConfig)
 
@@ -155,7 +157,11 @@ func (p *ScanPipeline) Run() error {
 
 	// 1. 目标解析
 	p.updateProgress(currentStep, totalSteps, "解析目标...")
-	targets := p.parseTargets()
+	targets, err := p.parseTargets()
+	if err != nil {
+		p.failTask(err.Error())
+		return err
+	}
 	currentStep++
 
 	// 2. 子域名扫描
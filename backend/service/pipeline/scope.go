@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+
+	"moongazing/scanner/core"
+)
+
+// 目标排除范围
+// 每个模块的输入都会经过扫描范围检查（排除规则和包含规则），使爬虫、证书、虚拟主机等旁路发现的主机也无法重新进入扫描。
+// 子域名枚举、端口扫描预处理、爬虫和目录扫描在模块内再检查自己发现的主机，丢弃的数量按模块计入丢弃统计，
+// 模块结束时记录一条超出范围的事件
+
+// scopeHosts 提取流水线数据中需要进行排除检查的主机
+func scopeHosts(data interface{}) []string {
+	switch v := data.(type) {
+	case string:
+		return []string{v}
+	case SubdomainResult:
+		return []string{v.Host}
+	case DomainResolve:
+		return []string{v.Domain}
+	case DomainSkip:
+		return []string{v.Domain}
+	case PortAlive:
+		return []string{v.Host, v.IP}
+	case AssetOther:
+		return []string{v.Host, v.IP}
+	case AssetHttp:
+		return []string{v.URL, v.Host, v.IP}
+	case UrlResult:
+		return []string{v.Output}
+	case SensitiveInfoResult:
+		return []string{v.URL, v.Target}
+	case TakeoverResult:
+		return []string{v.Domain}
+	case VulnResult:
+		return []string{v.Target}
+	}
+	return nil
+}
+
+// outOfScopeBy 检查数据是否超出扫描范围：任一主机命中排除规则，或配置了包含规则而没有主机在包含规则内，
+// 返回命中的排除规则或 core.ScopeNotIncluded
+func outOfScopeBy(scope *core.ScopeFilter, data interface{}) (string, bool) {
+	if scope.Empty() {
+		return "", false
+	}
+	checked := false
+	included := !scope.HasIncludes()
+	for _, host := range scopeHosts(data) {
+		if host == "" {
+			continue
+		}
+		checked = true
+		if rule, ok := scope.Exclusion().Match(host); ok {
+			return rule, true
+		}
+		included = included || scope.Included(host)
+	}
+	if checked && !included {
+		return core.ScopeNotIncluded, true
+	}
+	return "", false
+}
+
+// scopeUser 需要检查扫描范围的模块
+type scopeUser interface {
+	SetScope(scope *core.ScopeFilter)
+}
+
+// SetScope 设置扫描范围（流水线共用）
+func (m *BaseModule) SetScope(scope *core.ScopeFilter) {
+	m.scope = scope
+}
+
+// dropOutOfScope 模块发现的数据超出扫描范围时计入丢弃统计并返回 true
+func (m *BaseModule) dropOutOfScope(data interface{}) bool {
+	rule, out := outOfScopeBy(m.scope, data)
+	if !out {
+		return false
+	}
+	log.Printf("[%s] Dropped out-of-scope discovery %s (rule %q)", m.name, describeSuppressed(data), rule)
+	m.suppression.Record(m.name, SuppressOutOfScope, data)
+	return true
+}
+
+// scopeItemNames 超出范围事件中各模块丢弃条目的名称
+var scopeItemNames = map[string]string{
+	"SubdomainScan":       "子域名",
+	"PortScanPreparation": "端口扫描目标",
+	"Crawler":             "URL",
+	"DirScan":             "URL",
+	"SensitiveInfo":       "URL",
+	"EndpointExtraction":  "URL",
+	"ContentAnalysis":     "URL",
+}
+
+// emitOutOfScope 模块结束时记录超出扫描范围被丢弃的数量，没有丢弃时不记录
+func (w *monitoredModule) emitOutOfScope() {
+	dropped := w.monitor.suppression.Count(w.state.name, SuppressOutOfScope)
+	if dropped == 0 {
+		return
+	}
+	item, ok := scopeItemNames[w.state.name]
+	if !ok {
+		item = "目标"
+	}
+	w.emit(EventLevelInfo, EventOutOfScope, fmt.Sprintf("丢弃 %d 个超出扫描范围的%s", dropped, item), map[string]interface{}{
+		"dropped": dropped,
+	})
+}
+
+// SetExclusion 设置排除规则
+// 命中规则的子域名只通过 record 记录（Excluded=true），不会进入验证、HTTP 探测和端口扫描
+func (m *SubdomainScanModule) SetExclusion(matcher *core.ExclusionMatcher, record func(SubdomainResult)) {
+	m.exclusion = matcher
+	m.recordOnly = record
+}
+
+// FilterExcluded 检查子域名是否被排除，被排除时记录结果并返回 true
+func (m *SubdomainScanModule) FilterExcluded(result SubdomainResult) bool {
+	rule, excluded := m.exclusion.Match(result.Host)
+	if !excluded {
+		return false
+	}
+
+	log.Printf("[%s] Subdomain %s excluded by rule %q, recorded without scanning", m.name, result.Host, rule)
+	result.Excluded = true
+	if m.recordOnly != nil {
+		m.recordOnly(result)
+	}
+	return true
+}
+
+// SetExclusion 设置排除规则，被排除主机的 URL 不会被爬取
+func (m *CrawlerModule) SetExclusion(matcher *core.ExclusionMatcher) {
+	if m.katanaScanner != nil {
+		m.katanaScanner.OutOfScope = matcher.URLRegexps()
+	}
+}
+
+// SetCrossOriginScope 设置跨站 URL 的范围：与爬取页面主机不同的 URL 只有在范围内才转发，nil 时不限制
+func (m *CrawlerModule) SetCrossOriginScope(scope *core.ScopeFilter) {
+	m.crossOrigin = scope
+}
+
+// dropCrossOrigin 爬虫发现的跨站 URL 不在范围内时计入丢弃统计并返回 true
+func (m *CrawlerModule) dropCrossOrigin(r UrlResult) bool {
+	host := core.NormalizeHost(r.Output)
+	if m.crossOrigin == nil || host == "" || host == core.NormalizeHost(r.Input) {
+		return false
+	}
+	if m.crossOrigin.InScope(host) {
+		return false
+	}
+	log.Printf("[%s] Dropped cross-origin URL %s found on %s", m.name, r.Output, r.Input)
+	m.suppression.Record(m.name, SuppressOutOfScope, r)
+	return true
+}
+
+// dropOutOfScopeIPs 解析到的 IP 命中排除规则时跳过端口扫描（端口扫描按域名进行，会扫描到被排除的 IP），返回命中的规则
+func (m *PortScanPreparationModule) dropOutOfScopeIPs(dr DomainResolve) (string, bool) {
+	for _, ip := range dr.IP {
+		if rule, excluded := m.scope.Exclusion().Match(ip); excluded {
+			log.Printf("[%s] Skipping port scan for %s: resolved IP %s excluded by rule %q", m.name, dr.Domain, ip, rule)
+			m.suppression.Record(m.name, SuppressOutOfScope, dr)
+			return rule, true
+		}
+	}
+	return "", false
+}
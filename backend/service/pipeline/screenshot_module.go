@@ -0,0 +1,229 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/webscan"
+)
+
+// DefaultScreenshotDir 未指定截图目录时的保存位置
+const DefaultScreenshotDir = "data/screenshots"
+
+// 截图默认值
+const (
+	DefaultScreenshotConcurrency = 3
+	DefaultScreenshotTimeout     = 30 // 秒
+)
+
+// nonHTMLContentTypes 明确不是页面的内容类型，不截图
+var nonHTMLContentTypes = []string{
+	"image/", "audio/", "video/", "font/",
+	"application/json", "application/javascript", "application/octet-stream", "application/pdf",
+	"application/zip", "application/x-", "text/css", "text/javascript", "text/csv",
+}
+
+// ShouldScreenshot 资产是否需要截图：状态码为 0（未获得响应）或内容类型明确不是页面时跳过
+func ShouldScreenshot(asset AssetHttp) bool {
+	if asset.URL == "" || asset.StatusCode == 0 {
+		return false
+	}
+	contentType := strings.ToLower(strings.TrimSpace(asset.ContentType))
+	if contentType == "" || strings.Contains(contentType, "html") {
+		return true
+	}
+	for _, prefix := range nonHTMLContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+var screenshotNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// ScreenshotFileName 按 URL 生成截图文件名：主机和端口便于辨认，URL 哈希保证唯一
+func ScreenshotFileName(url string) string {
+	name := url
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	if i := strings.IndexAny(name, "/?#"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Trim(screenshotNameUnsafe.ReplaceAllString(name, "_"), "_.")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	sum := sha1.Sum([]byte(url))
+	return name + "_" + hex.EncodeToString(sum[:])[:12] + ".png"
+}
+
+// ScreenshotModule 页面截图模块
+// 接收HTTP资产，原样传递给下一个模块，同时按并发上限对页面截图，输出 ScreenshotResult
+type ScreenshotModule struct {
+	BaseModule
+	capturer    *webscan.ScreenshotCapturer
+	outputDir   string
+	concurrency int
+	resultChan  chan interface{}
+}
+
+// NewScreenshotModule 创建截图模块，截图保存到 outputDir
+func NewScreenshotModule(ctx context.Context, nextModule ModuleRunner, outputDir string, concurrency int) *ScreenshotModule {
+	if concurrency <= 0 {
+		concurrency = DefaultScreenshotConcurrency
+	}
+	if outputDir == "" {
+		outputDir = DefaultScreenshotDir
+	}
+
+	return &ScreenshotModule{
+		BaseModule: BaseModule{
+			name:       "Screenshot",
+			ctx:        ctx,
+			nextModule: nextModule,
+			dupChecker: NewDuplicateChecker(),
+		},
+		capturer:    webscan.NewScreenshotCapturer(),
+		outputDir:   outputDir,
+		concurrency: concurrency,
+		resultChan:  make(chan interface{}, 500),
+	}
+}
+
+// SetCapturer 设置截图器
+func (m *ScreenshotModule) SetCapturer(capturer *webscan.ScreenshotCapturer) {
+	m.capturer = capturer
+}
+
+// SetTimeout 设置单个页面的截图超时(秒)，0 保持默认值
+func (m *ScreenshotModule) SetTimeout(seconds int) {
+	if seconds > 0 && m.capturer != nil {
+		m.capturer.Timeout = seconds
+	}
+}
+
+// ModuleRun 运行模块
+func (m *ScreenshotModule) ModuleRun() error {
+	m.ReportModuleStart(0)
+	defer m.ReportModuleComplete()
+
+	// 浏览器不可用时只传递数据
+	available := m.capturer != nil && m.capturer.IsAvailable()
+	if !available {
+		log.Printf("[%s] Chrome not available, skipping screenshots", m.name)
+		m.emitToolUnavailable("chrome")
+	}
+
+	var allWg sync.WaitGroup
+	var resultWg sync.WaitGroup
+	var nextModuleRun sync.WaitGroup
+
+	sem := make(chan struct{}, m.concurrency)
+
+	// 启动下一个模块
+	if m.nextModule != nil {
+		nextModuleRun.Add(1)
+		go func() {
+			defer nextModuleRun.Done()
+			if err := m.nextModule.ModuleRun(); err != nil {
+				log.Printf("[%s] Next module error: %v", m.name, err)
+			}
+		}()
+	}
+
+	// 结果处理协程
+	resultWg.Add(1)
+	go func() {
+		defer resultWg.Done()
+		for result := range m.resultChan {
+			if m.nextModule != nil {
+				select {
+				case <-m.ctx.Done():
+					return
+				case m.nextModule.GetInput() <- result:
+				}
+			}
+		}
+		if m.nextModule != nil {
+			m.nextModule.CloseInput()
+		}
+	}()
+
+	finish := func() error {
+		allWg.Wait()
+		close(m.resultChan)
+		resultWg.Wait()
+		nextModuleRun.Wait()
+		return nil
+	}
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return finish()
+
+		case data, ok := <-m.input:
+			if !ok {
+				log.Printf("[%s] Input closed, waiting for captures", m.name)
+				return finish()
+			}
+
+			// 先传递原始数据到下一个模块
+			select {
+			case <-m.ctx.Done():
+				return finish()
+			case m.resultChan <- data:
+			}
+
+			asset, ok := data.(AssetHttp)
+			if !ok || !available || !ShouldScreenshot(asset) || m.dupChecker.IsURLDuplicate(asset.URL) {
+				continue
+			}
+
+			allWg.Add(1)
+			go func(asset AssetHttp) {
+				defer allWg.Done()
+				select {
+				case <-m.ctx.Done():
+					return
+				case sem <- struct{}{}:
+				}
+				defer func() { <-sem }()
+				m.capture(asset)
+			}(asset)
+		}
+	}
+}
+
+// capture 对单个页面截图并输出结果
+func (m *ScreenshotModule) capture(asset AssetHttp) {
+	start := time.Now()
+	path := filepath.Join(m.outputDir, ScreenshotFileName(asset.URL))
+	result := ScreenshotResult{URL: asset.URL, Host: asset.Host, IP: asset.IP, Port: asset.Port}
+
+	if err := m.capturer.Capture(m.ctx, asset.URL, path); err != nil {
+		if m.ctx.Err() != nil {
+			return
+		}
+		log.Printf("[%s] Failed to capture %s: %v", m.name, asset.URL, err)
+		result.Error = err.Error()
+	} else {
+		log.Printf("[%s] Captured %s in %v", m.name, asset.URL, time.Since(start).Round(time.Millisecond))
+		result.Path = path
+	}
+	m.ReportOutput(1)
+
+	select {
+	case <-m.ctx.Done():
+	case m.resultChan <- result:
+	}
+}
@@ -16,6 +16,7 @@ type SensitiveModule struct {
 	contentScanner *webscan.ContentScanner
 	resultChan     chan interface{}
 	concurrency    int
+	skipContent    bool // 可检测内容的文件由内容检测模块处理
 }
 
 // NewSensitiveModule 创建敏感信息检测模块
@@ -106,6 +107,13 @@ func (m *SensitiveModule) ModuleRun() error {
 			case AssetHttp:
 				targetURL = v.URL
 			case UrlResult:
+				// 可能改变服务端状态的请求不自动重新请求
+				if v.StateChanging {
+					continue
+				}
+				if m.skipContent && webscan.IsInspectableURL(v.Output, v.ContentType) {
+					continue
+				}
 				targetURL = v.Output
 			default:
 				continue
@@ -131,6 +139,16 @@ func (m *SensitiveModule) ModuleRun() error {
 	}
 }
 
+// SetSkipContentFiles 设置是否跳过 JS、配置等文件（内容检测模块启用时由其获取和检测）
+func (m *SensitiveModule) SetSkipContentFiles(skip bool) {
+	m.skipContent = skip
+}
+
+// SetMaskEmails 设置匹配上下文中是否同时掩码邮箱
+func (m *SensitiveModule) SetMaskEmails(mask bool) {
+	m.contentScanner.MaskEmails = mask
+}
+
 // scanSensitive 执行敏感信息扫描
 func (m *SensitiveModule) scanSensitive(target string) {
 	log.Printf("[%s] Scanning sensitive info for %s", m.name, target)
@@ -148,15 +166,17 @@ func (m *SensitiveModule) scanSensitive(target string) {
 	// 转换为流水线结果格式
 	for _, finding := range result.Findings {
 		sensitiveResult := SensitiveInfoResult{
-			Target:     result.Target,
-			URL:        result.URL,
-			Type:       finding.Type,
-			Pattern:    finding.Pattern,
-			Matches:    finding.Matches,
-			Location:   finding.Location,
-			Severity:   finding.Severity,
-			Confidence: finding.Confidence,
-			Source:     "sensitive_scan",
+			Target:       result.Target,
+			URL:          result.URL,
+			Type:         finding.Type,
+			Pattern:      finding.Pattern,
+			Matches:      finding.Matches,
+			Contexts:     finding.Contexts,
+			TotalMatches: finding.TotalMatches,
+			Location:     finding.Location,
+			Severity:     finding.Severity,
+			Confidence:   finding.Confidence,
+			Source:       "sensitive_scan",
 		}
 
 		select {
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"moongazing/scanner/webscan"
+)
+
+// 目录扫描软 404 过滤
+// 对任意路径都返回 200 的主机会让 Spray 输出成百上千条相同的结果。按主机分组，
+// 状态码和响应体长度（Spray 提供响应体 hash 时使用 hash）相同的路径超过阈值时判定为疑似软 404：
+// 默认丢弃，开启标记模式时保留并设置 UrlResult.Suspicious。
+// Add 在超过阈值前先缓存每组的结果，Flush 时才转发未超过阈值的结果；
+// 边扫描边转发时定期调用 FlushIdle，只转发一段时间内没有新结果的分组，软 404 的分组持续收到结果，超过阈值时整组一起处理。
+
+const (
+	// DefaultSoftNotFoundThreshold 同一主机上相同响应的路径数超过该值时判定为软 404
+	DefaultSoftNotFoundThreshold = 20
+	// SuppressSoftNotFound 疑似软 404 被丢弃
+	SuppressSoftNotFound = "soft_404"
+	// SoftNotFoundHold 边扫描边转发时，分组超过该时间没有新结果就转发其缓存的结果
+	SoftNotFoundHold = 500 * time.Millisecond
+)
+
+// softNotFoundAllowlist 始终保留的敏感路径（后缀匹配，不区分大小写）
+var softNotFoundAllowlist = []string{
+	".git/config",
+	".git/head",
+	".svn/entries",
+	".env",
+	".ds_store",
+	".htpasswd",
+	"web-inf/web.xml",
+	"phpinfo.php",
+	"server-status",
+	"actuator/env",
+	"actuator/heapdump",
+}
+
+// softNotFoundKey 响应分组：同一主机、状态码和响应体特征
+type softNotFoundKey struct {
+	host   string
+	status int
+	length int64
+	hash   string
+}
+
+type softNotFoundGroup struct {
+	count     int // 分组的结果数，包括已由 FlushIdle 转发的结果
+	pending   []UrlResult
+	suspected bool
+	lastAdded time.Time
+}
+
+// SoftNotFoundFilter 按主机识别软 404，可并发调用
+type SoftNotFoundFilter struct {
+	threshold int
+	tag       bool
+
+	mu     sync.Mutex
+	groups map[softNotFoundKey]*softNotFoundGroup
+}
+
+// NewSoftNotFoundFilter 创建软 404 过滤器，threshold <= 0 使用默认值；tag 为 true 时标记而不丢弃
+func NewSoftNotFoundFilter(threshold int, tag bool) *SoftNotFoundFilter {
+	if threshold <= 0 {
+		threshold = DefaultSoftNotFoundThreshold
+	}
+	return &SoftNotFoundFilter{threshold: threshold, tag: tag, groups: make(map[softNotFoundKey]*softNotFoundGroup)}
+}
+
+// Add 加入一条结果，返回现在可以转发的结果和被丢弃的结果
+func (f *SoftNotFoundFilter) Add(entry webscan.SprayEntry, result UrlResult) (ready, dropped []UrlResult) {
+	if isAllowlistedPath(entry.Path) {
+		return []UrlResult{result}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	group := f.group(entry)
+	group.count++
+	group.lastAdded = time.Now()
+
+	if !group.suspected {
+		group.pending = append(group.pending, result)
+		if group.count <= f.threshold {
+			return nil, nil
+		}
+		// 超过阈值：已缓存的结果一并处理
+		group.suspected = true
+		pending := group.pending
+		group.pending = nil
+		return f.suspect(pending)
+	}
+	return f.suspect([]UrlResult{result})
+}
+
+// FlushIdle 返回超过 idle 没有新结果的分组中缓存的结果，分组保留：已转发的结果仍计入分组的结果数
+func (f *SoftNotFoundFilter) FlushIdle(idle time.Duration) []UrlResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ready []UrlResult
+	now := time.Now()
+	for _, group := range f.groups {
+		if len(group.pending) > 0 && now.Sub(group.lastAdded) >= idle {
+			ready = append(ready, group.pending...)
+			group.pending = nil
+		}
+	}
+	return ready
+}
+
+// group 结果所属的分组，调用方持有锁
+func (f *SoftNotFoundFilter) group(entry webscan.SprayEntry) *softNotFoundGroup {
+	key := softNotFoundKey{host: entryHost(entry), status: entry.StatusCode}
+	if hash := entryBodyHash(entry); hash != "" {
+		key.hash = hash
+	} else {
+		key.length = entry.BodyLength
+	}
+	group := f.groups[key]
+	if group == nil {
+		group = &softNotFoundGroup{}
+		f.groups[key] = group
+	}
+	return group
+}
+
+// suspect 处理疑似软 404 的结果
+func (f *SoftNotFoundFilter) suspect(results []UrlResult) (ready, dropped []UrlResult) {
+	if !f.tag {
+		return nil, results
+	}
+	for i := range results {
+		results[i].Suspicious = true
+	}
+	return results, nil
+}
+
+// Flush 返回所有未超过阈值的缓存结果并清空分组
+func (f *SoftNotFoundFilter) Flush() []UrlResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ready []UrlResult
+	for _, group := range f.groups {
+		ready = append(ready, group.pending...)
+	}
+	f.groups = make(map[softNotFoundKey]*softNotFoundGroup)
+	return ready
+}
+
+// FilterSprayResult 转换并过滤一次 Spray 扫描的全部结果，返回保留的结果和被丢弃的数量
+func (f *SoftNotFoundFilter) FilterSprayResult(result *webscan.SprayResult, input string) ([]UrlResult, int) {
+	if result == nil {
+		return nil, 0
+	}
+	var kept []UrlResult
+	droppedCount := 0
+	for _, entry := range result.Results {
+		urlResult, ok := sprayURLResult(entry, input, nil)
+		if !ok {
+			continue
+		}
+		ready, dropped := f.Add(entry, urlResult)
+		kept = append(kept, ready...)
+		droppedCount += len(dropped)
+	}
+	return append(kept, f.Flush()...), droppedCount
+}
+
+// isAllowlistedPath 是否为始终保留的敏感路径
+func isAllowlistedPath(path string) bool {
+	path = strings.ToLower(strings.TrimRight(path, "/"))
+	for _, suffix := range softNotFoundAllowlist {
+		if path == suffix || strings.HasSuffix(path, "/"+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryHost Spray 结果所属的主机（含端口）
+func entryHost(entry webscan.SprayEntry) string {
+	if u, err := url.Parse(entry.URL); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return strings.ToLower(entry.Host)
+}
+
+// entryBodyHash Spray 提供的响应体 hash
+func entryBodyHash(entry webscan.SprayEntry) string {
+	for _, key := range []string{"body-md5", "md5"} {
+		if hash := entry.Hashes[key]; hash != "" {
+			return hash
+		}
+	}
+	return ""
+}
@@ -8,6 +8,12 @@ import (
 	"time"
 
 	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/portscan"
+	"moongazing/scanner/subdomain"
+	"moongazing/scanner/subdomain/thirdparty"
+
+	"github.com/go-redis/redis/v8"
 )
 
 // PipelineConfig 流水线配置
@@ -18,27 +24,139 @@ type PipelineConfig struct {
 	SubdomainResolveIP    bool   `json:"subdomain_resolve_ip"`
 	SubdomainCheckTakeover bool  `json:"subdomain_check_takeover"`
 	SubdomainHTTPProbe    bool   `json:"subdomain_http_probe"`    // 是否对子域名进行 HTTP 探测获取标题、状态码等
+	SubdomainKeepUnresolved bool `json:"subdomain_keep_unresolved"` // 是否记录当前无法解析的子域名（不参与后续扫描）
+	SubdomainWildcardHTTPConfirm bool `json:"subdomain_wildcard_http_confirm"` // 泛解析过滤是否用 HTTP 响应体再次确认
 
 	// 端口扫描
 	PortScan     bool   `json:"port_scan"`
 	PortScanMode string `json:"port_scan_mode"` // quick, full, top1000, custom
 	PortRange    string `json:"port_range"`     // 自定义端口范围
 	SkipCDN      bool   `json:"skip_cdn"`       // 是否跳过 CDN
+	IPv6Mode     string `json:"ipv6_mode,omitempty"` // IPv6 目标：为空时双栈主机使用 IPv4，prefer 优先 IPv6，skip 不扫描 IPv6
+
+	// 主机存活预检测（仅对 IP/网段目标，端口扫描前过滤不存活的主机）
+	LivenessCheck       bool  `json:"liveness_check"`
+	LivenessPorts       []int `json:"liveness_ports,omitempty"`       // TCP 探测端口，默认 80,443,22
+	LivenessTimeout     int   `json:"liveness_timeout,omitempty"`     // 单次探测超时(毫秒)
+	LivenessConcurrency int   `json:"liveness_concurrency,omitempty"` // 并发主机数
+	LivenessICMP        bool  `json:"liveness_icmp,omitempty"`        // 尝试 ICMP Echo（无权限时自动跳过）
 
 	// 指纹识别
-	Fingerprint bool `json:"fingerprint"`
+	Fingerprint    bool `json:"fingerprint"`
+	WAFActiveProbe bool `json:"waf_active_probe,omitempty"` // 规则未识别出 WAF 时再发送一个带可疑参数的请求，与正常响应比较
+	// 未识别服务的高位端口先做一次 HTTP 探测，不是 HTTP 服务时直接做端口指纹识别
+	PortHTTPProbe           *bool `json:"port_http_probe,omitempty"`              // nil 默认开启
+	PortHTTPProbeMinPort    int   `json:"port_http_probe_min_port,omitempty"`     // 探测的最小端口，默认 1025
+	PortHTTPProbeMaxPerHost int   `json:"port_http_probe_max_per_host,omitempty"` // 每个主机最多探测的端口数，默认 20
+
+	// 页面截图（指纹识别发现的 Web 服务）
+	Screenshot            bool   `json:"screenshot"`
+	ScreenshotDir         string `json:"screenshot_dir,omitempty"`         // 截图保存目录，执行器按任务设置，为空时使用 DefaultScreenshotDir
+	ScreenshotConcurrency int    `json:"screenshot_concurrency,omitempty"` // 同时截图的页面数，默认 3
+	ScreenshotTimeout     int    `json:"screenshot_timeout,omitempty"`     // 单个页面超时(秒)，默认 30
 
 	// 漏洞扫描
-	VulnScan bool `json:"vuln_scan"`
+	VulnScan        bool     `json:"vuln_scan"`
+	VulnSeverities  []string `json:"vuln_severities,omitempty"`  // 只运行这些严重级别的模板，为空时 critical、high、medium
+	VulnTemplates   []string `json:"vuln_templates,omitempty"`   // 模板路径或目录（含 / 或 .yaml），其余按标签处理
+	VulnRateLimit   int      `json:"vuln_rate_limit,omitempty"`  // nuclei 每秒请求数
+	VulnConcurrency int      `json:"vuln_concurrency,omitempty"` // nuclei 并发模板数、内置引擎并发数
 
 	// 爬虫
 	WebCrawler bool `json:"web_crawler"`
 
 	// 目录扫描
-	DirScan bool `json:"dir_scan"`
+	DirScan              bool `json:"dir_scan"`
+	DirScanSoft404Limit  int  `json:"dir_scan_soft404_limit,omitempty"` // 同一主机相同响应的路径数超过该值判定为软 404，0 默认 20，负数关闭
+	DirScanSoft404Tag    bool `json:"dir_scan_soft404_tag,omitempty"`   // 疑似软 404 标记后保留，而不是丢弃
+	DirScanStatusInclude []int `json:"dir_scan_status_include,omitempty"` // 保留的状态码，为空时默认 2xx、3xx、401、403、405、500
+	DirScanStatusExclude []int `json:"dir_scan_status_exclude,omitempty"` // 从保留的状态码中排除
+	DirScanWAFThreads    int   `json:"dir_scan_waf_threads,omitempty"`    // 受 WAF 保护的目标使用的 spray 线程数上限，0 不调整
+
+	// 从爬虫和目录扫描发现的 OpenAPI 文档、JS 文件中提取接口
+	EndpointExtraction  bool  `json:"endpoint_extraction"`
+	EndpointConcurrency int   `json:"endpoint_concurrency,omitempty"`   // 同时获取的文档数，默认 5
+	EndpointMaxBodySize int64 `json:"endpoint_max_body_size,omitempty"` // 文档大小上限(字节)，超过时跳过，默认 5MB
 
 	// 敏感信息检测
-	SensitiveScan bool `json:"sensitive_scan"`
+	SensitiveScan       bool `json:"sensitive_scan"`
+	SensitiveMaskEmails bool `json:"sensitive_mask_emails,omitempty"` // 匹配上下文中同时掩码邮箱，默认只掩码密钥类
+	// 爬虫和目录扫描发现的 JS、JSON、配置、SQL、备份文件获取内容后检测，启用敏感信息检测和爬虫或目录扫描时运行
+	ContentAnalysisMaxBodySize int64 `json:"content_analysis_max_body_size,omitempty"` // 内容大小上限(字节)，超过时跳过，默认 2MB
+
+	// 爬虫和目录扫描发现的 URL 按参数签名去重（忽略参数值），默认按标准化后的完整 URL 去重
+	URLDedupSignature bool `json:"url_dedup_signature,omitempty"`
+	// 按请求方法、接口和参数名集合去重（忽略参数值和顺序，表单字段同样处理），优先于 URLDedupSignature
+	URLDedupParameters bool `json:"url_dedup_parameters,omitempty"`
+
+	// 模块内去重的存储：memory、redis（按任务的 Redis 集合）、bloom（URL 使用布隆过滤器）；
+	// 为空时先用内存，单个模块的条目数超过 DedupMemoryLimit 后转为 Redis（已设置客户端时）或布隆过滤器
+	DedupBackend     string  `json:"dedup_backend,omitempty"`
+	DedupMemoryLimit int     `json:"dedup_memory_limit,omitempty"`  // 0 使用 DefaultDedupMemoryLimit，负数不切换
+	DedupBloomFPRate float64 `json:"dedup_bloom_fp_rate,omitempty"` // 布隆过滤器误判率，0 使用 DefaultDedupBloomFPRate
+
+	// 目标排除规则（通配符、regex: 前缀正则、IP 或网段）
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	// 扫描范围的包含规则（根域名、IP 或网段），为空时不限制；排除规则优先
+	ScopeIncludes []string `json:"scope_includes,omitempty"`
+
+	// 网段、IP 范围展开后的目标数上限，0 使用 DefaultMaxExpandedTargets
+	MaxExpandedTargets int `json:"max_expanded_targets,omitempty"`
+
+	// 任务级并发和速率设置，0 使用扫描器默认值，超出范围时限制到边界
+	RateLimit              int `json:"rate_limit,omitempty"`               // spray、katana 每秒请求数
+	PortScanThreads        int `json:"port_scan_threads,omitempty"`        // gogo 线程数
+	HTTPConcurrency        int `json:"http_concurrency,omitempty"`         // 指纹识别、HTTP 探测、spray 并发数
+	CrawlerConcurrency     int `json:"crawler_concurrency,omitempty"`      // katana、rad 并发数
+	CrawlerBatchSize       int `json:"crawler_batch_size,omitempty"`       // katana 批量模式每批 URL 数
+	CrawlerParallelBatches int `json:"crawler_parallel_batches,omitempty"` // katana 同时运行的批次数
+
+	// 出站网络设置（代理、DNS 服务器、DoH），nil 使用系统网络
+	Network *core.ScanNetworkConfig `json:"network,omitempty"`
+
+	// 认证扫描的自定义请求头和 Cookie（如 "session=abc; csrf=123"），日志中脱敏
+	CustomHeaders map[string]string `json:"-"`
+	CookieJar     string            `json:"-"`
+
+	// User-Agent 策略（fixed、rotate、random）和候选列表，策略为空时使用默认 User-Agent；
+	// fixed 使用列表中的第一个，rotate、random 未设置列表时使用 core.DefaultUserAgents
+	UserAgentStrategy string   `json:"user_agent_strategy,omitempty"`
+	UserAgents        []string `json:"user_agents,omitempty"`
+
+	// 子域名扫描使用的第三方数据源密钥和数据源列表，nil 不查询第三方数据源；列表为空时使用已配置密钥的全部数据源
+	ThirdPartyAPI     *thirdparty.APIConfig `json:"-"`
+	ThirdPartySources []string              `json:"thirdparty_sources,omitempty"`
+
+	// 调试：每种模块/丢弃原因采样的条目数，0 只计数不采样
+	SuppressionSamples int `json:"suppression_samples,omitempty"`
+
+	// 同一 IP 上指纹识别、爬虫、目录扫描的并发上限，排队数超过预警阈值时写入进度提示；0 使用默认值
+	MaxInFlightPerIP     int `json:"max_in_flight_per_ip,omitempty"`
+	IPQueueWarnThreshold int `json:"ip_queue_warn_threshold,omitempty"`
+
+	// 时间上限（流水线的全局超时），0 表示不限制；已用时间超过 TimeLimitWarnRatio（默认 0.8）时触发超时预警。
+	// 执行器按任务类型的上限或任务的 time_limit 设置，任务覆盖值限制在管理员设置的范围内（service.TaskTimeLimits.LimitFor）
+	TimeLimit          time.Duration `json:"-"`
+	TimeLimitWarnRatio float64       `json:"-"`
+
+	// 模块超时(分钟)，键为模块名称（SubdomainScan、PortScan、Fingerprint、Crawler、DirScan 等），从流水线启动开始计时；
+	// 超时的模块停止运行，下游模块继续处理已经收到的结果，任务不中断。未设置的模块不限制，只使用模块内部的单目标超时
+	ModuleTimeouts map[string]int `json:"module_timeouts,omitempty"`
+
+	// 超时配置的时间单位，0 表示分钟（仅测试缩短使用）
+	TimeoutUnit time.Duration `json:"-"`
+
+	// 看门狗超时时间，0 或负数禁用；执行器按任务配置设置，未设置时为 DefaultWatchdogTimeoutMinutes
+	WatchdogTimeout time.Duration `json:"-"`
+
+	// 通道持续超过 90% 多久后记录预警，0 使用 DefaultChannelWarnAfter，负数禁用
+	ChannelWarnAfter time.Duration `json:"-"`
+
+	// 从断点恢复执行时的断点数据，nil 表示全新执行
+	Resume *ResumeState `json:"-"`
+
+	// 故障注入配置（仅测试使用，默认 nil）
+	Faults *FaultConfig `json:"-"`
 }
 
 // DefaultPipelineConfig 默认流水线配置
@@ -72,18 +190,63 @@ type StreamingPipeline struct {
 	subdomainModule   *SubdomainScanModule
 	securityModule    *DomainVerifyModule
 	portPrepModule    *PortScanPreparationModule
+	livenessModule    *LivenessModule
 	portScanModule    *PortScanModule
 	fingerprintModule *FingerprintModule
+	screenshotModule  *ScreenshotModule
+	endpointModule    *EndpointModule
+	contentModule     *ContentAnalysisModule
 	vulnScanModule    *VulnScanModule
 	crawlerModule     *CrawlerModule
 	dirScanModule     *DirScanModule
+	fanOutModule      *TeeModule // 爬虫和目录扫描同时启用时的扇出模块
+	urlDedup          *URLDeduper // 爬虫和目录扫描共用的 URL 去重器
 	sensitiveModule   *SensitiveModule
 	
 	// 进度追踪
 	progressTracker *ProgressTracker
+
+	// 扫描范围（包含和排除规则）
+	scope *core.ScopeFilter
+	// 爬虫跨站 URL 的范围，未配置包含规则时为任务目标
+	crossOriginScope *core.ScopeFilter
+
+	// 共享解析器池，各模块共用 DNS 缓存
+	resolver *subdomain.ResolverPool
+
+	// 技术名称规范化器，统计任务中别名文件未收录的名称
+	techs *core.TechNormalizer
+
+	// IP 调度器，各模块共用每个 IP 的并发名额
+	ipScheduler *IPScheduler
+
+	// 去重、排除等环节的丢弃统计
+	suppression *SuppressionStats
+
+	// 模块内去重使用的 Redis，nil 时只使用内存集合或布隆过滤器
+	dedupRedis *redis.Client
+
+	// 第三方数据源调用次数的记录函数，nil 不记录
+	apiUsage func(provider string)
+
+	// 模块级断点，已完成的子域名枚举、端口扫描在恢复时跳过
+	checkpoint *Checkpoint
+
+	// 任务事件（模块开始/结束、工具不可用、目标出错）
+	events *EventRecorder
+
+	// 超时预警回调
+	overrunHandler OverrunHandler
+
+	// 模块状态监控（看门狗）
+	monitor   *pipelineMonitor
+	collected chan interface{} // 结果收集模块的输出，由转发协程写入 resultChan
+	abort     chan struct{}
+	abortOnce sync.Once
 	
 	// 状态
 	running bool
+	err     error
 	mu      sync.Mutex
 }
 
@@ -94,21 +257,50 @@ func NewStreamingPipeline(ctx context.Context, task *models.Task, config *Pipeli
 	}
 
 	pipeCtx, cancel := context.WithCancel(ctx)
+	suppression := NewSuppressionStats(config.SuppressionSamples)
+	events := NewEventRecorder()
 
-	return &StreamingPipeline{
+	p := &StreamingPipeline{
 		ctx:             pipeCtx,
 		cancel:          cancel,
 		config:          config,
 		task:            task,
 		resultChan:      make(chan interface{}, 1000),
 		progressTracker: nil, // 默认无进度追踪，需要通过 SetProgressCallback 设置
-	}
+		monitor:         &pipelineMonitor{suppression: suppression, events: events},
+		collected:       make(chan interface{}, 1000),
+		abort:           make(chan struct{}),
+		resolver:        subdomain.NewResolverPool(nil, 0),
+		techs:           core.NewTaskTechNormalizer(),
+		ipScheduler:     NewIPScheduler(config.MaxInFlightPerIP, config.IPQueueWarnThreshold),
+		suppression:     suppression,
+		checkpoint:      NewCheckpoint(config.Resume),
+		events:          events,
+	}
+	p.ipScheduler.SetBackoffHandler(p.emitOriginBackoff)
+	return p
+}
+
+// emitOriginBackoff IP 因限速并发减半时记录任务事件
+func (p *StreamingPipeline) emitOriginBackoff(ip string, from, to int) {
+	log.Printf("[IPScheduler] %s is throttling requests, concurrency reduced %d -> %d", ip, from, to)
+	p.events.Emit("IPScheduler", EventLevelWarn, EventOriginBackoff,
+		fmt.Sprintf("%s 频繁返回 429 或重置连接，并发上限从 %d 降为 %d", ip, from, to), map[string]interface{}{
+			"ip":   ip,
+			"from": from,
+			"to":   to,
+		})
 }
 
 // NewStreamingPipelineWithProgress 创建带进度追踪的扫描流水线
 func NewStreamingPipelineWithProgress(ctx context.Context, task *models.Task, config *PipelineConfig, totalTargets int, callback ProgressCallback) *StreamingPipeline {
 	p := NewStreamingPipeline(ctx, task, config)
 	p.progressTracker = NewProgressTracker(totalTargets, callback)
+	p.progressTracker.SetTimeLimit(p.config.TimeLimit)
+	p.progressTracker.SetDNSStats(p.resolver.Stats)
+	p.progressTracker.SetChannelStats(p.ChannelStats)
+	p.progressTracker.SetBaseline(p.checkpoint.Progress())
+	p.ipScheduler.SetWarningHandler(p.progressTracker.SetWarning)
 	
 	// 根据配置设置启用的模块权重
 	enabledModules := p.getEnabledModules()
@@ -117,9 +309,24 @@ func NewStreamingPipelineWithProgress(ctx context.Context, task *models.Task, co
 	return p
 }
 
+// SetDedupRedis 设置模块内去重使用的 Redis，需在 Start 之前调用
+func (p *StreamingPipeline) SetDedupRedis(client *redis.Client) {
+	p.dedupRedis = client
+}
+
+// SetAPIUsageRecorder 设置第三方数据源调用次数的记录函数，需在 Start 之前调用
+func (p *StreamingPipeline) SetAPIUsageRecorder(record func(provider string)) {
+	p.apiUsage = record
+}
+
 // SetProgressCallback 设置进度回调
 func (p *StreamingPipeline) SetProgressCallback(totalTargets int, callback ProgressCallback) {
 	p.progressTracker = NewProgressTracker(totalTargets, callback)
+	p.progressTracker.SetTimeLimit(p.config.TimeLimit)
+	p.progressTracker.SetDNSStats(p.resolver.Stats)
+	p.progressTracker.SetChannelStats(p.ChannelStats)
+	p.progressTracker.SetBaseline(p.checkpoint.Progress())
+	p.ipScheduler.SetWarningHandler(p.progressTracker.SetWarning)
 	enabledModules := p.getEnabledModules()
 	p.progressTracker.SetModuleWeights(enabledModules)
 }
@@ -131,6 +338,9 @@ func (p *StreamingPipeline) getEnabledModules() []string {
 		modules = append(modules, "SubdomainScan", "DomainVerify")
 	}
 	if p.config.PortScan {
+		if p.config.LivenessCheck {
+			modules = append(modules, "LivenessCheck")
+		}
 		if p.config.SkipCDN {
 			modules = append(modules, "PortPreparation")
 		}
@@ -139,6 +349,9 @@ func (p *StreamingPipeline) getEnabledModules() []string {
 	if p.config.Fingerprint {
 		modules = append(modules, "Fingerprint")
 	}
+	if p.config.Screenshot && p.config.Fingerprint {
+		modules = append(modules, "Screenshot")
+	}
 	if p.config.VulnScan {
 		modules = append(modules, "VulnScan")
 	}
@@ -148,12 +361,58 @@ func (p *StreamingPipeline) getEnabledModules() []string {
 	if p.config.DirScan {
 		modules = append(modules, "DirScan")
 	}
+	if p.endpointExtractionEnabled() {
+		modules = append(modules, "EndpointExtraction")
+	}
+	if p.contentAnalysisEnabled() {
+		modules = append(modules, "ContentAnalysis")
+	}
 	if p.config.SensitiveScan {
 		modules = append(modules, "Sensitive")
 	}
 	return modules
 }
 
+// contentAnalysisEnabled 内容检测的输入来自爬虫和目录扫描，随敏感信息检测启用
+func (p *StreamingPipeline) contentAnalysisEnabled() bool {
+	return p.config.SensitiveScan && (p.config.WebCrawler || p.config.DirScan)
+}
+
+// endpointExtractionEnabled 接口提取的输入来自爬虫和目录扫描，两者都未启用时不创建
+func (p *StreamingPipeline) endpointExtractionEnabled() bool {
+	return p.config.EndpointExtraction && (p.config.WebCrawler || p.config.DirScan)
+}
+
+// DNSStats 获取共享解析器池的缓存统计
+func (p *StreamingPipeline) DNSStats() subdomain.ResolverStats {
+	return p.resolver.Stats()
+}
+
+// IPLoads 获取各 IP 的并发负载
+func (p *StreamingPipeline) IPLoads() []IPLoad {
+	return p.ipScheduler.Loads()
+}
+
+// UnmappedTechnologies 获取任务中出现的、别名文件未收录的技术名称
+func (p *StreamingPipeline) UnmappedTechnologies() []core.UnmappedTechnology {
+	return p.techs.Unmapped()
+}
+
+// Suppression 获取丢弃统计，入库合并等流水线之外的丢弃也计入其中
+func (p *StreamingPipeline) Suppression() *SuppressionStats {
+	return p.suppression
+}
+
+// SetEventHandler 设置任务事件处理函数，在 Start 之前设置才能收到全部模块的开始事件
+func (p *StreamingPipeline) SetEventHandler(handler func(Event)) {
+	p.events.SetHandler(handler)
+}
+
+// Checkpoint 获取模块级断点，结果入库后由调用方通过 Stored 确认
+func (p *StreamingPipeline) Checkpoint() *Checkpoint {
+	return p.checkpoint
+}
+
 // GetProgressTracker 获取进度追踪器
 func (p *StreamingPipeline) GetProgressTracker() *ProgressTracker {
 	return p.progressTracker
@@ -185,22 +444,70 @@ func (p *StreamingPipeline) Start(targets []string) error {
 	p.running = true
 	p.mu.Unlock()
 
-	log.Printf("[Pipeline] Starting with %d targets, config: %+v", len(targets), p.config)
+	log.Printf("[Pipeline] Starting with %d targets, config: %s", len(targets), p.config.logString())
+
+	// 展开网段、IP 范围和逗号列表，按主机注入；国际化域名统一为 punycode
+	expanded, err := ExpandTargets(targets, p.config.MaxExpandedTargets)
+	if err != nil {
+		return err
+	}
+	if len(expanded) != len(targets) {
+		log.Printf("[Pipeline] Expanded %d targets to %d hosts", len(targets), len(expanded))
+		if p.progressTracker != nil {
+			p.progressTracker.AdjustTotalTargets(len(expanded) - len(targets))
+		}
+	}
+	rawTargets := targets
+	targets = expanded
+
+	// 编译扫描范围，在模块启动前设置到监控器
+	scope, err := core.NewScopeFilter(p.config.ScopeIncludes, p.config.ExcludePatterns)
+	if err != nil {
+		return fmt.Errorf("invalid scope patterns: %v", err)
+	}
+	p.scope = scope
+	p.crossOriginScope = scope.DefaultToTargets(rawTargets)
+	p.monitor.scope = scope
+
+	if err := p.config.Network.Validate(); err != nil {
+		return fmt.Errorf("invalid network config: %v", err)
+	}
 
-	// 构建模块链
+	// 构建模块链，并应用任务级并发和速率设置
+	p.config.clampScanLimits()
 	if err := p.buildModuleChain(); err != nil {
 		return fmt.Errorf("failed to build module chain: %v", err)
 	}
+	p.applyScanLimits()
+	p.applyScanNetwork()
+	p.applyScanHeaders(targets)
+	if err := p.applyUserAgents(); err != nil {
+		return fmt.Errorf("invalid user agent config: %v", err)
+	}
 
 	// 获取入口模块
 	entryModule := p.getEntryModule()
 	if entryModule == nil {
 		return fmt.Errorf("no entry module available")
 	}
+	// IP 目标不做子域名扫描，直接进入子域名模块之后的模块
+	ipEntryModule := p.getIPEntryModule()
+	if ipEntryModule == nil {
+		ipEntryModule = entryModule
+	}
+
+	// 转发最终结果，看门狗终止流水线时直接关闭结果通道，避免调用方阻塞
+	done := make(chan struct{})
+	go p.forwardResults(done)
+	go p.runWatchdog(done)
+	go p.runBackpressureMonitor(done)
+	go p.runTimeLimit(done)
 
 	// 启动流水线处理
 	go func() {
-		defer close(p.resultChan)
+		defer close(p.collected)
+		defer p.monitor.dedup.close()
+		defer p.monitor.stopTimeouts()
 		defer func() {
 			p.mu.Lock()
 			p.running = false
@@ -217,15 +524,20 @@ func (p *StreamingPipeline) Start(targets []string) error {
 			}
 		}()
 
-		// 注入目标到入口模块
+		// 注入目标到入口模块，IP 目标必须在入口模块关闭输入之前注入，
+		// 入口模块结束后会关闭后续模块的输入
 		for _, target := range targets {
+			module := entryModule
+			if isIPTarget(target) {
+				module = ipEntryModule
+			}
 			select {
 			case <-p.ctx.Done():
 				log.Printf("[Pipeline] Context cancelled, stopping target injection")
 				entryModule.CloseInput()
 				wg.Wait()
 				return
-			case entryModule.GetInput() <- target:
+			case module.GetInput() <- target:
 				log.Printf("[Pipeline] Injected target: %s", target)
 			}
 		}
@@ -236,119 +548,283 @@ func (p *StreamingPipeline) Start(targets []string) error {
 
 		// 等待所有模块完成
 		wg.Wait()
-		log.Printf("[Pipeline] All modules completed")
+		stats := p.resolver.Stats()
+		log.Printf("[Pipeline] All modules completed, DNS cache: %d requests, %d lookups, hit rate %.1f%%",
+			stats.Requests, stats.Lookups, stats.HitRate*100)
+
+		// 模块异常退出时流水线虽然结束，但结果不完整
+		if reason, failed := p.monitor.failure(); failed {
+			p.setErr(fmt.Errorf("pipeline failed: %s; modules: %s", reason, p.monitor.describe()))
+		}
 	}()
 
 	return nil
 }
 
 // buildModuleChain 构建模块链
-// 链式结构: SubdomainScan -> SubdomainSecurity -> PortScanPreparation -> PortScan -> Fingerprint -> VulnScan -> Crawler -> DirScan -> Sensitive -> ResultCollector
+// 链式结构: SubdomainScan -> SubdomainSecurity -> LivenessCheck -> PortScanPreparation -> PortScan -> Fingerprint -> VulnScan -> Crawler -> DirScan -> ContentAnalysis -> Sensitive -> ResultCollector
+// 爬虫和目录扫描同时启用时经 FanOut 并行运行: ... -> VulnScan -> FanOut -> {Crawler, DirScan} -> ContentAnalysis -> Sensitive -> ResultCollector
 func (p *StreamingPipeline) buildModuleChain() error {
 	var lastModule ModuleRunner
 
 	// 从后向前构建模块链
 
 	// 结果收集模块（最后一个模块）
-	resultCollector := NewResultCollectorModule(p.ctx, p.resultChan)
+	taskID := ""
+	if p.task != nil {
+		taskID = p.task.ID.Hex()
+	}
+	p.monitor.dedup = newDedupStoreSet(p.config, taskID, p.dedupRedis)
+	p.monitor.progress = p.progressTracker
+	if p.config.URLDedupParameters {
+		p.urlDedup = NewParameterURLDeduper()
+	} else {
+		p.urlDedup = NewURLDeduper(p.config.URLDedupSignature)
+	}
+	p.urlDedup.store = p.monitor.dedup.create("URLDedup")
+
+	resultCollector := NewResultCollectorModule(p.ctx, p.collected)
 	resultCollector.SetInput(make(chan interface{}, 500))
-	lastModule = resultCollector
+	lastModule = p.monitor.wrap(p.ctx, resultCollector, p.config.Faults)
 
 	// 敏感信息检测模块
 	if p.config.SensitiveScan {
-		p.sensitiveModule = NewSensitiveModule(p.ctx, lastModule, 10)
+		p.sensitiveModule = NewSensitiveModule(p.moduleContext("SensitiveInfo"), lastModule, 10)
+		p.sensitiveModule.SetMaskEmails(p.config.SensitiveMaskEmails)
+		p.sensitiveModule.SetSkipContentFiles(p.contentAnalysisEnabled())
 		p.sensitiveModule.SetInput(make(chan interface{}, 500))
 		p.sensitiveModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.sensitiveModule
-	}
-
-	// 目录扫描模块
-	if p.config.DirScan {
-		p.dirScanModule = NewDirScanModule(p.ctx, lastModule, 20, nil)
-		p.dirScanModule.SetInput(make(chan interface{}, 500))
-		p.dirScanModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.dirScanModule
-	}
+		lastModule = p.monitor.wrap(p.ctx, p.sensitiveModule, p.config.Faults)
+	}
+
+	// 内容敏感信息检测模块，输入来自爬虫、目录扫描和接口提取
+	if p.contentAnalysisEnabled() {
+		p.contentModule = NewContentAnalysisModule(p.moduleContext("ContentAnalysis"), lastModule, DefaultContentAnalysisConcurrency)
+		p.contentModule.SetMaxBodySize(p.config.ContentAnalysisMaxBodySize)
+		p.contentModule.SetMaskEmails(p.config.SensitiveMaskEmails)
+		p.contentModule.SetInput(make(chan interface{}, 500))
+		p.contentModule.SetIPScheduler(p.ipScheduler)
+		p.contentModule.SetProgressTracker(p.progressTracker)
+		lastModule = p.monitor.wrap(p.ctx, p.contentModule, p.config.Faults)
+	}
+
+	// 接口提取模块，输入来自爬虫和目录扫描
+	if p.endpointExtractionEnabled() {
+		p.endpointModule = NewEndpointModule(p.moduleContext("EndpointExtraction"), lastModule, p.config.EndpointConcurrency)
+		p.endpointModule.SetInput(make(chan interface{}, 500))
+		p.endpointModule.SetMaxBodySize(p.config.EndpointMaxBodySize)
+		p.endpointModule.SetURLDeduper(p.urlDedup)
+		p.endpointModule.SetProgressTracker(p.progressTracker)
+		lastModule = p.monitor.wrap(p.ctx, p.endpointModule, p.config.Faults)
+	}
+
+	// 爬虫和目录扫描同时启用时作为并行分支，否则按链式连接
+	if p.config.WebCrawler && p.config.DirScan {
+		p.fanOutModule = NewTeeModule(p.ctx, lastModule)
+		p.fanOutModule.SetInput(make(chan interface{}, 500))
+		crawler := p.fanOutModule.AddBranch(isAssetHttp, p.buildCrawlerModule)
+		dirScan := p.fanOutModule.AddBranch(isAssetHttp, p.buildDirScanModule)
+		p.monitor.link(crawler, lastModule)
+		p.monitor.link(dirScan, lastModule)
+		lastModule = p.monitor.wrap(p.ctx, p.fanOutModule, p.config.Faults)
+		p.monitor.link(lastModule, crawler, dirScan)
+	} else {
+		// 目录扫描模块
+		if p.config.DirScan {
+			lastModule = p.buildDirScanModule(lastModule)
+		}
 
-	// 爬虫模块
-	if p.config.WebCrawler {
-		p.crawlerModule = NewCrawlerModule(p.ctx, lastModule, 5, true, false) // 默认使用Katana
-		p.crawlerModule.SetInput(make(chan interface{}, 500))
-		p.crawlerModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.crawlerModule
+		// 爬虫模块
+		if p.config.WebCrawler {
+			lastModule = p.buildCrawlerModule(lastModule)
+		}
 	}
 
 	// 漏洞扫描模块
 	if p.config.VulnScan {
-		p.vulnScanModule = NewVulnScanModule(p.ctx, lastModule, 10)
+		p.vulnScanModule = NewVulnScanModule(p.moduleContext("VulnScan"), lastModule, 10)
 		p.vulnScanModule.SetInput(make(chan interface{}, 500))
+		p.vulnScanModule.SetFilters(p.config.VulnSeverities, p.config.VulnTemplates)
 		p.vulnScanModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.vulnScanModule
+		lastModule = p.monitor.wrap(p.ctx, p.vulnScanModule, p.config.Faults)
+	}
+
+	// 截图模块，输入来自指纹识别
+	if p.config.Screenshot && p.config.Fingerprint {
+		p.screenshotModule = NewScreenshotModule(p.moduleContext("Screenshot"), lastModule, p.config.ScreenshotDir, p.config.ScreenshotConcurrency)
+		p.screenshotModule.SetInput(make(chan interface{}, 500))
+		p.screenshotModule.SetTimeout(p.config.ScreenshotTimeout)
+		p.screenshotModule.SetProgressTracker(p.progressTracker)
+		lastModule = p.monitor.wrap(p.ctx, p.screenshotModule, p.config.Faults)
 	}
 
 	// 指纹识别模块
 	if p.config.Fingerprint {
-		p.fingerprintModule = NewFingerprintModule(p.ctx, lastModule, 20)
+		p.fingerprintModule = NewFingerprintModule(p.moduleContext("Fingerprint"), lastModule, 20)
 		p.fingerprintModule.SetInput(make(chan interface{}, 500))
 		p.fingerprintModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.fingerprintModule
+		p.fingerprintModule.SetIPScheduler(p.ipScheduler)
+		p.fingerprintModule.SetTechNormalizer(p.techs)
+		p.fingerprintModule.SetWAFProbe(p.config.WAFActiveProbe)
+		p.fingerprintModule.SetHTTPProbe(p.config.HTTPProbeConfig())
+		lastModule = p.monitor.wrap(p.ctx, p.fingerprintModule, p.config.Faults)
 	}
 
 	// 端口扫描模块
 	if p.config.PortScan {
-		p.portScanModule = NewPortScanModule(p.ctx, lastModule, p.config.PortRange, p.config.PortScanMode)
+		p.portScanModule = NewPortScanModule(p.moduleContext("PortScan"), lastModule, p.config.PortRange, p.config.PortScanMode)
 		p.portScanModule.SetInput(make(chan interface{}, 500))
 		p.portScanModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.portScanModule
+		p.portScanModule.SetIPScheduler(p.ipScheduler)
+		p.portScanModule.SetCheckpoint(p.checkpoint)
+		p.portScanModule.SetIPv6Mode(p.config.IPv6Mode)
+		lastModule = p.monitor.wrap(p.ctx, p.portScanModule, p.config.Faults)
 	}
 
 	// CDN检测/端口扫描预处理模块
 	if p.config.PortScan && p.config.SkipCDN {
-		p.portPrepModule = NewPortScanPreparationModule(p.ctx, lastModule)
+		p.portPrepModule = NewPortScanPreparationModule(p.moduleContext("PortScanPreparation"), lastModule)
 		p.portPrepModule.SetInput(make(chan interface{}, 500))
 		p.portPrepModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.portPrepModule
+		p.portPrepModule.SetResolverPool(p.resolver)
+		lastModule = p.monitor.wrap(p.ctx, p.portPrepModule, p.config.Faults)
+	}
+
+	// 主机存活预检测模块
+	if p.config.PortScan && p.config.LivenessCheck {
+		p.livenessModule = NewLivenessModule(p.moduleContext("LivenessCheck"), lastModule, portscan.NewLivenessProber(portscan.LivenessConfig{
+			Ports:       p.config.LivenessPorts,
+			Timeout:     time.Duration(p.config.LivenessTimeout) * time.Millisecond,
+			Concurrency: p.config.LivenessConcurrency,
+			ICMP:        p.config.LivenessICMP,
+		}), p.recordResult)
+		p.livenessModule.SetInput(make(chan interface{}, 500))
+		p.livenessModule.SetProgressTracker(p.progressTracker)
+		lastModule = p.monitor.wrap(p.ctx, p.livenessModule, p.config.Faults)
 	}
 
 	// 子域名安全检测模块
 	if p.config.SubdomainScan {
-		p.securityModule = NewDomainVerifyModule(p.ctx, lastModule, 50)
+		p.securityModule = NewDomainVerifyModule(p.moduleContext("DomainVerify"), lastModule, 50)
 		p.securityModule.SetInput(make(chan interface{}, 500))
 		p.securityModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.securityModule
+		p.securityModule.SetResolverPool(p.resolver)
+		lastModule = p.monitor.wrap(p.ctx, p.securityModule, p.config.Faults)
 	}
 
 	// 子域名扫描模块（入口模块）
 	if p.config.SubdomainScan {
-		p.subdomainModule = NewSubdomainScanModuleWithHTTPProbe(p.ctx, lastModule, p.config.SubdomainMaxEnumTime, p.config.SubdomainResolveIP, p.config.SubdomainHTTPProbe)
+		p.subdomainModule = NewSubdomainScanModuleWithHTTPProbe(p.moduleContext("SubdomainScan"), lastModule, p.config.SubdomainMaxEnumTime, p.config.SubdomainResolveIP, p.config.SubdomainHTTPProbe)
 		p.subdomainModule.SetInput(make(chan interface{}, 500))
 		p.subdomainModule.SetProgressTracker(p.progressTracker)
-		lastModule = p.subdomainModule
+		p.subdomainModule.SetResolverPool(p.resolver)
+		p.subdomainModule.SetTechNormalizer(p.techs)
+		p.subdomainModule.SetExclusion(p.scope.Exclusion(), p.recordOnly)
+		p.subdomainModule.SetServiceRecorder(p.recordResult)
+		p.subdomainModule.SetKeepUnresolved(p.config.SubdomainKeepUnresolved)
+		p.subdomainModule.SetWildcardHTTPConfirm(p.config.SubdomainWildcardHTTPConfirm)
+		p.subdomainModule.SetCheckpoint(p.checkpoint)
+		if p.config.ThirdPartyAPI != nil {
+			p.subdomainModule.SetThirdPartyAPI(p.config.ThirdPartyAPI, p.config.ThirdPartySources, p.apiUsage)
+		}
+		lastModule = p.monitor.wrap(p.ctx, p.subdomainModule, p.config.Faults)
 	}
 
 	return nil
 }
 
+// buildDirScanModule 构建目录扫描模块，返回监控包装器
+func (p *StreamingPipeline) buildDirScanModule(next ModuleRunner) ModuleRunner {
+	p.dirScanModule = NewDirScanModule(p.moduleContext("DirScan"), next, 20, nil)
+	p.dirScanModule.SetInput(make(chan interface{}, 500))
+	p.dirScanModule.SetProgressTracker(p.progressTracker)
+	p.dirScanModule.SetIPScheduler(p.ipScheduler)
+	p.dirScanModule.SetSoftNotFound(p.config.DirScanSoft404Limit, p.config.DirScanSoft404Tag)
+	p.dirScanModule.SetStatusFilter(p.config.DirScanStatusInclude, p.config.DirScanStatusExclude)
+	p.dirScanModule.SetWAFThreads(p.config.DirScanWAFThreads)
+	p.dirScanModule.SetURLDeduper(p.urlDedup)
+	return p.monitor.wrap(p.ctx, p.dirScanModule, p.config.Faults)
+}
+
+// buildCrawlerModule 构建爬虫模块，返回监控包装器
+func (p *StreamingPipeline) buildCrawlerModule(next ModuleRunner) ModuleRunner {
+	p.crawlerModule = NewCrawlerModule(p.moduleContext("Crawler"), next, 5, true, false) // 默认使用Katana
+	p.crawlerModule.SetInput(make(chan interface{}, 500))
+	p.crawlerModule.SetProgressTracker(p.progressTracker)
+	p.crawlerModule.SetIPScheduler(p.ipScheduler)
+	p.crawlerModule.SetExclusion(p.scope.Exclusion())
+	p.crawlerModule.SetCrossOriginScope(p.crossOriginScope)
+	p.crawlerModule.SetURLDeduper(p.urlDedup)
+	return p.monitor.wrap(p.ctx, p.crawlerModule, p.config.Faults)
+}
+
 // getEntryModule 获取入口模块
 func (p *StreamingPipeline) getEntryModule() ModuleRunner {
 	if p.config.SubdomainScan && p.subdomainModule != nil {
-		return p.subdomainModule
+		return p.monitor.find(p.subdomainModule)
+	}
+	return p.getIPEntryModule()
+}
+
+// getIPEntryModule 获取 IP 目标的入口模块（跳过子域名扫描和子域名安全检测）
+func (p *StreamingPipeline) getIPEntryModule() ModuleRunner {
+	if p.config.PortScan && p.livenessModule != nil {
+		return p.monitor.find(p.livenessModule)
 	}
 	if p.config.PortScan && p.portPrepModule != nil {
-		return p.portPrepModule
+		return p.monitor.find(p.portPrepModule)
 	}
 	if p.config.PortScan && p.portScanModule != nil {
-		return p.portScanModule
+		return p.monitor.find(p.portScanModule)
 	}
 	if p.config.Fingerprint && p.fingerprintModule != nil {
-		return p.fingerprintModule
+		return p.monitor.find(p.fingerprintModule)
+	}
+	if p.fanOutModule != nil {
+		return p.monitor.find(p.fanOutModule)
 	}
 	if p.config.WebCrawler && p.crawlerModule != nil {
-		return p.crawlerModule
+		return p.monitor.find(p.crawlerModule)
 	}
 	return nil
 }
 
+// recordOnly 记录不进入后续扫描的子域名（被排除、无法解析）
+func (p *StreamingPipeline) recordOnly(result SubdomainResult) {
+	p.recordResult(result)
+}
+
+// recordResult 记录仅用于展示的结果
+// 直接写入结果收集通道，不经过后续模块
+func (p *StreamingPipeline) recordResult(result interface{}) {
+	select {
+	case <-p.ctx.Done():
+	case p.collected <- result:
+	}
+}
+
+// forwardResults 将收集到的结果转发到最终结果通道
+func (p *StreamingPipeline) forwardResults(done chan struct{}) {
+	defer close(p.resultChan)
+	defer close(done)
+
+	for {
+		select {
+		case <-p.abort:
+			return
+		case data, ok := <-p.collected:
+			if !ok {
+				return
+			}
+			select {
+			case <-p.abort:
+				return
+			case p.resultChan <- data:
+			}
+		}
+	}
+}
+
 // Results 获取结果通道
 func (p *StreamingPipeline) Results() <-chan interface{} {
 	return p.resultChan
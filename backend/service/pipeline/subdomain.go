@@ -29,7 +29,7 @@ func (p *ScanPipeline) runSubdomainScan(targets []string) {
 		// 使用 map 去重
 		subdomainSet := make(map[string]bool)
 
-		// 步骤1.5: 使用第三方 API 收集子域名 (FOFA, Hunter, Quake, CrtSh)
+		// 步骤1.5: 使用第三方 API 收集子域名 (FOFA, Hunter, Quake, CrtSh, OTX, Chaos)
 		if p.thirdpartyManager != nil {
 			log.Printf("[Pipeline] Step 1.5: Third-party API collection for %s", target)
 
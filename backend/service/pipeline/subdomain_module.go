@@ -2,8 +2,11 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,7 +27,13 @@ type SubdomainScanModule struct {
 	apiConfig       *thirdparty.APIConfig
 	resolveIP       bool
 	enableHTTPProbe bool  // 是否进行 HTTP 探测
-	dnsResolvers    []string
+	resolver        *subdomain.ResolverPool // 共享解析器池
+	techs           *core.TechNormalizer    // 任务级技术名称规范化器
+	exclusion       *core.ExclusionMatcher // 目标排除规则
+	keepUnresolved  bool                   // 是否记录无法解析的子域名
+	recordOnly      func(SubdomainResult)  // 记录不进入后续扫描的子域名（被排除、无法解析）
+	recordService   func(interface{})      // 记录 HTTP 探测得到的 Web 服务
+	checkpoint      *Checkpoint            // 任务断点，已完成的根域名不再枚举
 }
 
 // SubdomainScanConfig 子域名扫描配置
@@ -46,6 +55,8 @@ type SubdomainScanConfig struct {
 	HunterKey         string
 	QuakeKey          string
 	SecurityTrailsKey string
+	OTXKey            string // 可选
+	ChaosKey          string // 可选
 
 	// 其他
 	ResolveIP        bool // 是否解析IP (默认 true)
@@ -112,6 +123,8 @@ func NewSubdomainScanModuleWithConfig(ctx context.Context, nextModule ModuleRunn
 		HunterKey:         scanConfig.HunterKey,
 		QuakeKey:          scanConfig.QuakeKey,
 		SecurityTrailsKey: scanConfig.SecurityTrailsKey,
+		OTXKey:            scanConfig.OTXKey,
+		ChaosKey:          scanConfig.ChaosKey,
 	}
 
 	// 创建 httpx 扫描器（如果启用 HTTP 探测）
@@ -134,17 +147,102 @@ func NewSubdomainScanModuleWithConfig(ctx context.Context, nextModule ModuleRunn
 		apiConfig:       apiCfg,
 		resolveIP:       scanConfig.ResolveIP,
 		enableHTTPProbe: scanConfig.EnableHTTPProbe,
-		dnsResolvers: []string{
-			"8.8.8.8:53",
-			"1.1.1.1:53",
-			"114.114.114.114:53",
-			"223.5.5.5:53",
-		},
 	}
+	m.SetResolverPool(subdomain.NewResolverPool(nil, 0))
+	m.techs = core.NewTaskTechNormalizer()
 
 	return m
 }
 
+// SetHTTPConcurrency 设置子域名 HTTP 探测并发数，0 保持默认值
+func (m *SubdomainScanModule) SetHTTPConcurrency(concurrency int) {
+	if m.httpxScanner != nil {
+		m.httpxScanner.SetThreads(concurrency)
+	}
+}
+
+// SetResolverPool 设置解析器池，被动来源子域名的解析验证和 IP 解析共用流水线的缓存
+func (m *SubdomainScanModule) SetResolverPool(pool *subdomain.ResolverPool) {
+	m.resolver = pool
+	m.activeScanner.SetResolver(pool.Resolve)
+}
+
+// SetTechNormalizer 设置技术名称规范化器（流水线共用，用于统计任务中未收录的名称）
+func (m *SubdomainScanModule) SetTechNormalizer(n *core.TechNormalizer) {
+	m.techs = n
+}
+
+// SetServiceRecorder 设置 Web 服务记录函数
+// HTTP 探测有响应的子域名同时作为 AssetHttp 记录，不经过后续模块，没有指纹识别时 Web 服务也有数据
+func (m *SubdomainScanModule) SetServiceRecorder(record func(interface{})) {
+	m.recordService = record
+}
+
+// SetThirdPartyAPI 启用第三方数据源查询，sources 为空时使用已配置密钥的全部数据源
+// onUsage 在每次调用付费数据源的查询接口时回调；数据源配额耗尽后本任务不再调用，并记录事件
+func (m *SubdomainScanModule) SetThirdPartyAPI(apiCfg *thirdparty.APIConfig, sources []string, onUsage func(provider string)) {
+	manager := thirdparty.NewAPIManager(apiCfg)
+	manager.SetUsageHook(onUsage)
+	manager.SetDisabledHook(m.emitQuotaExhausted)
+	if len(sources) == 0 {
+		sources = manager.GetConfiguredSources()
+	}
+	m.apiConfig = apiCfg
+	m.config.EnableAPI = true
+	m.config.APISources = sources
+	m.activeScanner.SetAPIManager(manager)
+	log.Printf("[%s] Third-party API enabled with sources: %v", m.name, sources)
+}
+
+// ApplyHTTPProbe 用 HTTP 探测结果丰富子域名结果，有响应时记录对应的 Web 服务
+func (m *SubdomainScanModule) ApplyHTTPProbe(result SubdomainResult, hr *webscan.HttpxResult) SubdomainResult {
+	result.IPs = hr.IPs
+	result.Title = hr.Title
+	result.StatusCode = hr.StatusCode
+	result.WebServer = hr.WebServer
+	techs := m.techs.NewSet()
+	for _, name := range hr.Technologies {
+		techs.AddVersion(name, hr.TechVersions[name])
+	}
+	result.Technologies = techs.Names()
+	result.TechVersions = techs.Versions()
+	result.CDN = hr.CDN
+	result.CDNName = hr.CDNName
+	result.URL = hr.URL
+	result.Source = "httpx"
+
+	if hr.StatusCode > 0 && m.recordService != nil {
+		m.recordService(AssetHttp{
+			Host:         result.Host,
+			IP:           hr.IP,
+			Port:         probePort(hr),
+			URL:          hr.URL,
+			Title:        hr.Title,
+			StatusCode:   hr.StatusCode,
+			Server:       hr.WebServer,
+			ContentType:  hr.ContentType,
+			Technologies: result.Technologies,
+			TechVersions: result.TechVersions,
+			Source:       "httpx",
+		})
+	}
+	return result
+}
+
+// probePort HTTP 探测结果的端口，未记录时按协议取默认端口
+func probePort(hr *webscan.HttpxResult) string {
+	if hr.Port != "" {
+		return hr.Port
+	}
+	if u, err := url.Parse(hr.URL); err == nil && u.Port() != "" {
+		return u.Port()
+	}
+	if hr.Scheme == "https" || strings.HasPrefix(hr.URL, "https://") {
+		return "443"
+	}
+	return "80"
+}
+
 // ModuleRun 运行模块
 func (m *SubdomainScanModule) ModuleRun() error {
 	var allWg sync.WaitGroup
@@ -170,7 +268,13 @@ func (m *SubdomainScanModule) ModuleRun() error {
 	resultWg.Add(1)
 	go func() {
 		defer resultWg.Done()
+		tracker := newCheckpointTracker(m.checkpoint, CheckpointSubdomainScan)
 		for result := range m.resultChan {
+			// 根域名枚举完成，登记已发送的子域名
+			if mark, ok := result.(checkpointMark); ok {
+				tracker.mark(mark)
+				continue
+			}
 			// 报告输出
 			m.ReportOutput(1)
 			// 发送到下一个模块
@@ -182,6 +286,7 @@ func (m *SubdomainScanModule) ModuleRun() error {
 					log.Printf("[%s] Sent result to next module: %+v", m.name, result)
 				}
 			}
+			tracker.sent(result)
 		}
 		// 关闭下一个模块的输入
 		if m.nextModule != nil {
@@ -230,6 +335,10 @@ func (m *SubdomainScanModule) ModuleRun() error {
 			allWg.Add(1)
 			go func(d string) {
 				defer allWg.Done()
+				if m.checkpoint.Done(CheckpointSubdomainScan, d) {
+					m.replaySubdomains(d)
+					return
+				}
 				m.scanSubdomains(d)
 			}(domain)
 		}
@@ -243,13 +352,38 @@ func (m *SubdomainScanModule) scanSubdomains(domain string) {
 		m.name, m.config.EnableBrute, m.config.EnableAPI, m.config.APISources, m.enableHTTPProbe)
 
 	// 收集所有子域名，如果启用了 HTTP 探测，需要批量处理
+	// 回调可能并发调用（被动来源并发解析），共享状态需要加锁
+	var mu sync.Mutex
 	var collectedSubdomains []string
 	var collectedResults []SubdomainResult
+	var pending []SubdomainResult // 等待批量解析 IP 的子域名
+
+	emit := func(result SubdomainResult) {
+		log.Printf("[%s] Found subdomain: %s (IPs: %v)", m.name, result.Host, result.IPs)
+
+		if m.enableHTTPProbe && m.httpxScanner != nil {
+			// 如果启用了 HTTP 探测，先收集起来
+			mu.Lock()
+			collectedSubdomains = append(collectedSubdomains, result.Host)
+			collectedResults = append(collectedResults, result)
+			mu.Unlock()
+			return
+		}
+		// 否则直接发送结果
+		select {
+		case <-m.ctx.Done():
+		case m.resultChan <- result:
+		}
+	}
 
 	// 使用回调函数实时处理结果
 	err := m.activeScanner.ScanWithCallback(m.ctx, domain, func(subResult subdomain.SubdomainResult) {
-		// 去重检查
-		if m.dupChecker.IsSubdomainDuplicate(subResult.FullDomain) {
+		// 去重检查；无法解析的记录单独去重，之后解析成功的同一子域名仍会处理
+		dedupKey := subResult.FullDomain
+		if !subdomain.IsResolved(subResult.Resolution) {
+			dedupKey = "unresolved " + dedupKey
+		}
+		if m.dupChecker.IsSubdomainDuplicate(dedupKey) {
 			return
 		}
 
@@ -259,32 +393,54 @@ func (m *SubdomainScanModule) scanSubdomains(domain string) {
 			RootDomain: domain,               // 根域名
 			Source:     "active",             // 综合扫描
 			IPs:        subResult.IPs,
+			Resolution: subResult.Resolution,
 		}
 
-		// 如果没有 IP 且需要解析
-		if m.resolveIP && len(result.IPs) == 0 {
-			result.IPs = m.resolveIPs(subResult.FullDomain)
+		// 命中排除规则的子域名只记录，不解析、不探测、不发送到下一个模块
+		if m.FilterExcluded(result) {
+			return
+		}
+		// 不在包含规则内的子域名（如第三方接口返回的其他域名）丢弃
+		if m.dropOutOfScope(result) {
+			return
+		}
+		// 当前无法解析的子域名（历史记录、NXDOMAIN）不进入 HTTP 探测和端口扫描
+		if m.FilterUnresolved(result) {
+			return
 		}
 
-		log.Printf("[%s] Found subdomain: %s (IPs: %v)", m.name, subResult.FullDomain, result.IPs)
-
-		if m.enableHTTPProbe && m.httpxScanner != nil {
-			// 如果启用了 HTTP 探测，先收集起来
-			collectedSubdomains = append(collectedSubdomains, subResult.FullDomain)
-			collectedResults = append(collectedResults, result)
-		} else {
-			// 否则直接发送结果
-			select {
-			case <-m.ctx.Done():
-				return
-			case m.resultChan <- result:
+		if len(result.IPs) > 0 {
+			// 已知的解析结果写入缓存，后续模块不再重复解析
+			m.resolver.Add(result.Host, result.IPs)
+		} else if m.resolveIP {
+			// 没有 IP 的子域名攒批解析
+			mu.Lock()
+			pending = append(pending, result)
+			var batch []SubdomainResult
+			if len(pending) >= subdomainResolveBatchSize {
+				batch, pending = pending, nil
+			}
+			mu.Unlock()
+			if batch != nil {
+				m.resolveBatch(batch, emit)
 			}
+			return
 		}
+
+		emit(result)
 	})
 
+	mu.Lock()
+	batch := pending
+	pending = nil
+	mu.Unlock()
+	m.resolveBatch(batch, emit)
+
 	if err != nil {
 		log.Printf("[%s] Scan error for %s: %v", m.name, domain, err)
+		m.emitTargetError("subdomain", domain, err)
 	}
+	m.emitWildcard(m.activeScanner.Wildcard(domain))
 
 	// 如果启用了 HTTP 探测，批量进行探测
 	if m.enableHTTPProbe && m.httpxScanner != nil && len(collectedSubdomains) > 0 {
@@ -305,16 +461,7 @@ func (m *SubdomainScanModule) scanSubdomains(domain string) {
 		// 丰富子域名结果并发送
 		for _, result := range collectedResults {
 			if hr, ok := httpxMap[result.Host]; ok {
-				// 丰富结果数据
-				result.IPs = hr.IPs
-				result.Title = hr.Title
-				result.StatusCode = hr.StatusCode
-				result.WebServer = hr.WebServer
-				result.Technologies = hr.Technologies
-				result.CDN = hr.CDN
-				result.CDNName = hr.CDNName
-				result.URL = hr.URL
-				result.Source = "httpx"
+				result = m.ApplyHTTPProbe(result, hr)
 			}
 			
 			select {
@@ -326,46 +473,65 @@ func (m *SubdomainScanModule) scanSubdomains(domain string) {
 	}
 
 	log.Printf("[%s] Subdomain scan completed for %s", m.name, domain)
-}
 
-// resolveIPs 解析域名的 IP 地址
-func (m *SubdomainScanModule) resolveIPs(domain string) []string {
-	var ips []string
+	// 枚举被取消时结果不完整，不记录断点
+	if m.checkpoint != nil && m.ctx.Err() == nil {
+		select {
+		case <-m.ctx.Done():
+		case m.resultChan <- checkpointMark{module: CheckpointSubdomainScan, key: domain}:
+		}
+	}
+}
 
-	// 使用自定义 resolver
-	resolver := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{
-				Timeout: 5 * time.Second,
-			}
-			// 随机选择一个 DNS 服务器
-			dnsServer := m.dnsResolvers[0]
-			return d.DialContext(ctx, "udp", dnsServer)
-		},
+// replaySubdomains 根域名在断点中已完成，输出之前保存的子域名代替重新枚举
+func (m *SubdomainScanModule) replaySubdomains(domain string) {
+	restored := m.checkpoint.restoredSubdomains(domain)
+	log.Printf("[%s] %s already enumerated before resume, replaying %d subdomains", m.name, domain, len(restored))
+	for _, result := range restored {
+		if m.dupChecker.IsSubdomainDuplicate(result.Host) {
+			continue
+		}
+		if len(result.IPs) > 0 {
+			m.resolver.Add(result.Host, result.IPs)
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- result:
+		}
 	}
+}
 
-	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
-	defer cancel()
+// subdomainResolveBatchSize 子域名批量解析 IP 的批大小
+const subdomainResolveBatchSize = 200
 
-	addrs, err := resolver.LookupIPAddr(ctx, domain)
-	if err != nil {
-		return ips
+// resolveBatch 批量解析子域名 IP 后逐个输出
+func (m *SubdomainScanModule) resolveBatch(batch []SubdomainResult, emit func(SubdomainResult)) {
+	if len(batch) == 0 {
+		return
 	}
 
-	for _, addr := range addrs {
-		ips = append(ips, addr.IP.String())
+	hosts := make([]string, len(batch))
+	for i, result := range batch {
+		hosts[i] = result.Host
 	}
+	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Minute)
+	resolved := m.resolver.ResolveBatch(ctx, hosts, m.config.BruteConcurrency/10)
+	cancel()
 
-	return ips
+	for _, result := range batch {
+		result.IPs = resolved[result.Host]
+		emit(result)
+	}
 }
 
 // DomainVerifyModule 子域名安全检测模块
 // 执行子域名接管检测、DNS解析等
 type DomainVerifyModule struct {
 	BaseModule
-	domainScanner   *subdomain.DomainScanner
+	resolver        *subdomain.ResolverPool
 	takeoverScanner *subdomain.TakeoverScanner
+	saasClassifier  *subdomain.SaaSClassifier
 	resultChan      chan interface{}
 	concurrency     int
 }
@@ -383,14 +549,37 @@ func NewDomainVerifyModule(ctx context.Context, nextModule ModuleRunner, concurr
 			nextModule: nextModule,
 			dupChecker: NewDuplicateChecker(),
 		},
-		domainScanner:   subdomain.NewDomainScanner(10),
+		resolver:        subdomain.NewResolverPool(nil, 0),
 		takeoverScanner: subdomain.NewTakeoverScanner(20),
+		saasClassifier:  subdomain.NewSaaSClassifier(),
 		resultChan:      make(chan interface{}, 500),
 		concurrency:     concurrency,
 	}
 	return m
 }
 
+// SetSaaSClassifier 设置 SaaS 分类器，接管检测使用分类器的解析函数判断 CNAME 是否悬挂
+func (m *DomainVerifyModule) SetSaaSClassifier(classifier *subdomain.SaaSClassifier) {
+	m.saasClassifier = classifier
+	if classifier != nil {
+		m.takeoverScanner.SetHostLookup(classifier.LookupHost)
+		m.takeoverScanner.SetCNAMELookup(classifier.LookupCNAME)
+	}
+}
+
+// SetTakeoverHTTPClient 设置接管检测访问子域名时使用的 HTTP 客户端
+func (m *DomainVerifyModule) SetTakeoverHTTPClient(client *http.Client) {
+	m.takeoverScanner.SetHTTPClient(client)
+}
+
+// SetResolverPool 设置解析器池，与子域名扫描模块共用缓存
+func (m *DomainVerifyModule) SetResolverPool(pool *subdomain.ResolverPool) {
+	m.resolver = pool
+}
+
+// verifyResolveBatchSize 域名验证每批解析的最大子域名数
+const verifyResolveBatchSize = 200
+
 // ModuleRun 运行模块
 func (m *DomainVerifyModule) ModuleRun() error {
 	var allWg sync.WaitGroup
@@ -454,64 +643,117 @@ func (m *DomainVerifyModule) ModuleRun() error {
 				continue
 			}
 
-			allWg.Add(1)
-			go func(sr SubdomainResult) {
-				defer allWg.Done()
-				m.checkSubdomain(sr)
-			}(subResult)
+			// 取出已到达的子域名一起批量解析
+			batch, closed := m.drainBatch(subResult)
+			m.resolveBatch(batch)
+			for _, sr := range batch {
+				allWg.Add(1)
+				go func(sr SubdomainResult) {
+					defer allWg.Done()
+					m.checkSubdomain(sr)
+				}(sr)
+			}
+
+			if closed {
+				allWg.Wait()
+				close(m.resultChan)
+				resultWg.Wait()
+				log.Printf("[%s] Input closed, waiting for next module", m.name)
+				nextModuleRun.Wait()
+				return nil
+			}
 		}
 	}
 }
 
-// checkSubdomain 检查子域名安全
-func (m *DomainVerifyModule) checkSubdomain(sr SubdomainResult) {
-	// 【重要】先传递原始的 SubdomainResult，确保它被收集到
-	select {
-	case <-m.ctx.Done():
+// drainBatch 不阻塞地取出输入通道中已有的子域名，返回批次以及输入是否已关闭
+func (m *DomainVerifyModule) drainBatch(first SubdomainResult) ([]SubdomainResult, bool) {
+	batch := []SubdomainResult{first}
+	for len(batch) < verifyResolveBatchSize {
+		select {
+		case data, ok := <-m.input:
+			if !ok {
+				return batch, true
+			}
+			sr, ok := data.(SubdomainResult)
+			if !ok {
+				log.Printf("[%s] Unexpected data type: %T, value: %+v", m.name, data, data)
+				continue
+			}
+			batch = append(batch, sr)
+		default:
+			return batch, false
+		}
+	}
+	return batch, false
+}
+
+// resolveBatch 批量解析没有 IP 的子域名，已有 IP 的写入缓存
+func (m *DomainVerifyModule) resolveBatch(batch []SubdomainResult) {
+	var hosts []string
+	for _, sr := range batch {
+		if len(sr.IPs) > 0 {
+			m.resolver.Add(verifyHost(sr), sr.IPs)
+		} else {
+			hosts = append(hosts, verifyHost(sr))
+		}
+	}
+	if len(hosts) == 0 {
 		return
-	case m.resultChan <- sr:
 	}
 
-	// 获取子域名（使用 Host 字段）
-	subdomain := sr.Host
-	if subdomain == "" {
-		subdomain = sr.Domain // 兼容旧数据
+	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Minute)
+	resolved := m.resolver.ResolveBatch(ctx, hosts, m.concurrency)
+	cancel()
+	for i := range batch {
+		if len(batch[i].IPs) == 0 {
+			batch[i].IPs = resolved[verifyHost(batch[i])]
+		}
+	}
+}
+
+// verifyHost 子域名结果对应的主机（兼容旧数据只有 Domain 字段）
+func verifyHost(sr SubdomainResult) string {
+	if sr.Host != "" {
+		return sr.Host
 	}
+	return sr.Domain
+}
+
+// checkSubdomain 检查子域名安全
+func (m *DomainVerifyModule) checkSubdomain(sr SubdomainResult) {
+	// 获取子域名（使用 Host 字段）
+	subdomain := verifyHost(sr)
 
 	// 解析 DNS 获取更多信息
 	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
 	defer cancel()
 
-	// 使用 DomainScanner 检查子域名
-	rootDomain := core.ExtractRootDomain(subdomain)
-	checkResult := m.domainScanner.CheckSubdomain(ctx, subdomain, rootDomain)
+	// SaaS 分类：按 CNAME 链识别第三方平台，结果写入 SubdomainResult
+	saasMatch := m.classifySaaS(ctx, &sr, subdomain)
 
-	// 构建 DomainResolve 结果
-	result := DomainResolve{
-		Domain: subdomain,
-		IP:     sr.IPs,
+	// 【重要】先传递 SubdomainResult，确保它被收集到
+	select {
+	case <-m.ctx.Done():
+		return
+	case m.resultChan <- sr:
 	}
 
-	// 如果有更多的 IP 信息，使用检查结果
-	if checkResult != nil {
-		if len(checkResult.IPs) > 0 {
-			result.IP = checkResult.IPs
-		}
-
-		// 记录存活状态和 HTTP 信息
-		if checkResult.Alive {
-			log.Printf("[%s] %s is alive (HTTP: %d, HTTPS: %d)",
-				m.name, subdomain, checkResult.HTTPStatus, checkResult.HTTPSStatus)
-		}
+	// 构建 DomainResolve 结果，IP 已在批量解析中通过解析器池获取
+	result := DomainResolve{
+		Domain:     subdomain,
+		IP:         sr.IPs,
+		CNAMEs:     sr.CNAMEs,
+		SkipReason: sr.SkipReason,
 	}
 
 	// 子域名接管检测
-	takeoverResult, err := m.takeoverScanner.Scan(ctx, sr.Domain)
+	takeoverResult, err := m.scanTakeover(ctx, sr, subdomain, saasMatch)
 	if err != nil {
-		log.Printf("[%s] Takeover scan error for %s: %v", m.name, sr.Domain, err)
+		log.Printf("[%s] Takeover scan error for %s: %v", m.name, subdomain, err)
 	} else if takeoverResult != nil && takeoverResult.Vulnerable {
 		log.Printf("[%s] Potential subdomain takeover detected: %s (Service: %s, CNAME: %s)",
-			m.name, sr.Domain, takeoverResult.Service, takeoverResult.CNAME)
+			m.name, subdomain, takeoverResult.Service, takeoverResult.CNAME)
 		// 发送接管检测结果
 		takeoverRes := TakeoverResult{
 			Domain:       takeoverResult.Domain,
@@ -526,6 +768,12 @@ func (m *DomainVerifyModule) checkSubdomain(sr SubdomainResult) {
 			return
 		case m.resultChan <- takeoverRes:
 		}
+		// 同时作为高危漏洞输出，与其他漏洞一起展示和统计
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- takeoverVuln(takeoverRes):
+		}
 	}
 
 	select {
@@ -534,3 +782,58 @@ func (m *DomainVerifyModule) checkSubdomain(sr SubdomainResult) {
 	case m.resultChan <- result:
 	}
 }
+
+// scanTakeover 子域名接管检测
+// 命中可接管的 SaaS 平台时使用平台专属指纹检测该子域名，否则按通用指纹库检测
+func (m *DomainVerifyModule) scanTakeover(ctx context.Context, sr SubdomainResult, host string, match *subdomain.SaaSMatch) (*subdomain.TakeoverResult, error) {
+	if match != nil && match.TakeoverRelevant() {
+		return m.takeoverScanner.ScanWithFingerprint(ctx, host, match.CNAME, match.Provider.TakeoverFingerprint()), nil
+	}
+	return m.takeoverScanner.ScanWithCNAMEs(ctx, host, sr.CNAMEs)
+}
+
+// takeoverVuln 将确认的子域名接管转换为漏洞结果
+func takeoverVuln(r TakeoverResult) VulnResult {
+	evidence := "CNAME: " + r.CNAME
+	if len(r.Fingerprints) > 0 {
+		evidence += "\nFingerprints: " + strings.Join(r.Fingerprints, ", ")
+	}
+	return VulnResult{
+		Target:      r.Domain,
+		VulnID:      "subdomain-takeover",
+		Name:        fmt.Sprintf("Subdomain Takeover (%s)", r.Service),
+		Severity:    "high",
+		Type:        "takeover",
+		Description: r.Reason,
+		Evidence:    evidence,
+		Remediation: "删除指向未认领服务的 DNS 记录，或在对应服务上重新认领该域名",
+		MatchedAt:   "http://" + r.Domain,
+		Source:      "takeover",
+		Timestamp:   time.Now(),
+	}
+}
+
+// classifySaaS 对子域名做 SaaS 分类并写入分类结果，未命中时返回 nil
+func (m *DomainVerifyModule) classifySaaS(ctx context.Context, sr *SubdomainResult, host string) *subdomain.SaaSMatch {
+	if m.saasClassifier == nil {
+		return nil
+	}
+
+	match, chain := m.saasClassifier.Classify(ctx, host, sr.CNAMEs)
+	if len(sr.CNAMEs) == 0 {
+		sr.CNAMEs = chain
+	}
+	if match == nil {
+		return nil
+	}
+
+	sr.SaaSProvider = match.Provider.Name
+	sr.SaaSCategory = match.Provider.Category
+	sr.SaaSHandling = match.Provider.Handling
+	if match.SkipPortScan() {
+		sr.SkipReason = fmt.Sprintf("SaaS平台 %s (CNAME: %s)", match.Provider.Name, match.CNAME)
+	}
+	log.Printf("[%s] %s classified as SaaS %s (%s, %s) via CNAME %s",
+		m.name, host, match.Provider.Name, match.Provider.Category, match.Provider.Handling, match.CNAME)
+	return match
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"log"
+
+	"moongazing/scanner/subdomain"
+)
+
+// SetKeepUnresolved 设置是否记录当前无法解析的子域名
+// 开启后无法解析的子域名带解析状态写入结果，但不进入 HTTP 探测和端口扫描
+func (m *SubdomainScanModule) SetKeepUnresolved(keep bool) {
+	m.keepUnresolved = keep
+}
+
+// SetWildcardHTTPConfirm 设置是否对判定为泛解析的爆破结果比较 HTTP 响应体再次确认
+func (m *SubdomainScanModule) SetWildcardHTTPConfirm(confirm bool) {
+	m.config.WildcardHTTPConfirm = confirm
+}
+
+// FilterUnresolved 检查子域名是否当前可解析，无法解析时按配置记录结果并返回 true
+func (m *SubdomainScanModule) FilterUnresolved(result SubdomainResult) bool {
+	if subdomain.IsResolved(result.Resolution) {
+		return false
+	}
+
+	if !m.keepUnresolved {
+		log.Printf("[%s] Subdomain %s is %s, dropped", m.name, result.Host, result.Resolution)
+		return true
+	}
+
+	log.Printf("[%s] Subdomain %s is %s, recorded without scanning", m.name, result.Host, result.Resolution)
+	if m.recordOnly != nil {
+		m.recordOnly(result)
+	}
+	return true
+}
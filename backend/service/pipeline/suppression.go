@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 结果丢弃统计
+// 去重、排除范围、入库合并等环节都会丢弃或合并数据，这里按模块和原因计数，
+// 用于回答“工具发现了 12000 个 URL 为什么只看到 900 个”。计数使用原子操作；
+// 调试模式下每种模块/原因最多采样 sampleLimit 条被丢弃的条目
+
+// 丢弃原因
+const (
+	SuppressDuplicate       = "duplicate"        // 模块内去重（DuplicateChecker）
+	SuppressOutOfScope      = "out_of_scope"     // 命中排除规则，在模块入口被拦截
+	SuppressStoredDuplicate = "stored_duplicate" // 入库时与已有结果合并（CreateResultWithDedup）
+	SuppressModuleTimeout   = "module_timeout"   // 模块超时后上游继续发送的数据
+	SuppressModuleSkipped   = "module_skipped"   // 模块跳过剩余输入后上游继续发送的数据
+	SuppressModuleStopped   = "module_stopped"   // 模块被停止后上游继续发送的数据
+	SuppressIPv6Skipped     = "ipv6_skipped"     // 任务设置跳过 IPv6，只有 IPv6 地址的目标不扫描端口
+)
+
+const (
+	// DefaultSuppressionSamples 调试模式下每种模块/原因默认采样条数
+	DefaultSuppressionSamples = 20
+	// MaxSuppressionSamples 每种模块/原因最多采样条数
+	MaxSuppressionSamples = 100
+	// maxSampleItemLen 采样条目的最大长度
+	maxSampleItemLen = 512
+)
+
+// SuppressionCount 某个模块因某种原因丢弃的数量
+type SuppressionCount struct {
+	Module string `json:"module"`
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// SuppressionSample 采样的被丢弃条目
+type SuppressionSample struct {
+	Module string `json:"module"`
+	Reason string `json:"reason"`
+	Item   string `json:"item"`
+}
+
+type suppressionKey struct {
+	module string
+	reason string
+}
+
+// SuppressionStats 任务级丢弃统计，nil 时不记录
+type SuppressionStats struct {
+	mu       sync.RWMutex
+	counters map[suppressionKey]*atomic.Int64
+
+	sampleLimit int
+	sampleMu    sync.Mutex
+	samples     map[suppressionKey][]string
+}
+
+// NewSuppressionStats 创建丢弃统计，sampleLimit 为每种模块/原因的采样条数，0 表示不采样
+func NewSuppressionStats(sampleLimit int) *SuppressionStats {
+	if sampleLimit < 0 {
+		sampleLimit = 0
+	}
+	if sampleLimit > MaxSuppressionSamples {
+		sampleLimit = MaxSuppressionSamples
+	}
+	return &SuppressionStats{
+		counters:    make(map[suppressionKey]*atomic.Int64),
+		sampleLimit: sampleLimit,
+		samples:     make(map[suppressionKey][]string),
+	}
+}
+
+// Record 记录一个被丢弃的条目
+func (s *SuppressionStats) Record(module, reason string, item interface{}) {
+	if s == nil {
+		return
+	}
+	key := suppressionKey{module: module, reason: reason}
+	n := s.counter(key).Add(1)
+	// 只有前 sampleLimit 次计数会采样，采样总量严格受限
+	if n <= int64(s.sampleLimit) {
+		s.sampleMu.Lock()
+		s.samples[key] = append(s.samples[key], describeSuppressed(item))
+		s.sampleMu.Unlock()
+	}
+}
+
+func (s *SuppressionStats) counter(key suppressionKey) *atomic.Int64 {
+	s.mu.RLock()
+	c := s.counters[key]
+	s.mu.RUnlock()
+	if c != nil {
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c = s.counters[key]; c == nil {
+		c = &atomic.Int64{}
+		s.counters[key] = c
+	}
+	return c
+}
+
+// Counts 按模块、原因排序的计数
+func (s *SuppressionStats) Counts() []SuppressionCount {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	counts := make([]SuppressionCount, 0, len(s.counters))
+	for key, c := range s.counters {
+		counts = append(counts, SuppressionCount{Module: key.module, Reason: key.reason, Count: c.Load()})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Module != counts[j].Module {
+			return counts[i].Module < counts[j].Module
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return counts
+}
+
+// Count 某个模块因某种原因丢弃的数量
+func (s *SuppressionStats) Count(module, reason string) int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if c := s.counters[suppressionKey{module: module, reason: reason}]; c != nil {
+		return c.Load()
+	}
+	return 0
+}
+
+// Samples 调试模式下采样的条目，按模块、原因排序
+func (s *SuppressionStats) Samples() []SuppressionSample {
+	if s == nil {
+		return nil
+	}
+	s.sampleMu.Lock()
+	defer s.sampleMu.Unlock()
+
+	keys := make([]suppressionKey, 0, len(s.samples))
+	for key := range s.samples {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].module != keys[j].module {
+			return keys[i].module < keys[j].module
+		}
+		return keys[i].reason < keys[j].reason
+	})
+
+	var samples []SuppressionSample
+	for _, key := range keys {
+		for _, item := range s.samples[key] {
+			samples = append(samples, SuppressionSample{Module: key.module, Reason: key.reason, Item: item})
+		}
+	}
+	return samples
+}
+
+// describeSuppressed 被丢弃条目的可读描述
+func describeSuppressed(item interface{}) string {
+	var desc string
+	switch v := item.(type) {
+	case string:
+		desc = v
+	case UrlResult:
+		desc = v.Method + " " + v.Output
+		if v.Method == "" {
+			desc = v.Output
+		}
+	default:
+		for _, host := range scopeHosts(item) {
+			if host != "" {
+				desc = fmt.Sprintf("%T %s", item, host)
+				break
+			}
+		}
+		if desc == "" {
+			desc = fmt.Sprintf("%T %v", item, item)
+		}
+	}
+	if len(desc) > maxSampleItemLen {
+		desc = desc[:maxSampleItemLen]
+	}
+	return desc
+}
+
+// suppressionRecorder 可以记录丢弃统计的模块
+type suppressionRecorder interface {
+	SetSuppressionStats(stats *SuppressionStats)
+}
+
+// SetSuppressionStats 设置丢弃统计（流水线共用），模块内去重、超出范围等丢弃会按模块名记录
+func (m *BaseModule) SetSuppressionStats(stats *SuppressionStats) {
+	m.suppression = stats
+	if m.dupChecker != nil {
+		m.dupChecker.track(m.name, stats)
+	}
+}
+
+// dedupStoreUser 可以替换模块内去重存储的模块
+type dedupStoreUser interface {
+	SetDedupStore(store DedupStore)
+}
+
+// SetDedupStore 替换模块内去重使用的存储，需在模块运行前设置
+func (m *BaseModule) SetDedupStore(store DedupStore) {
+	if m.dupChecker != nil {
+		m.dupChecker.store = store
+	}
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"moongazing/scanner/core"
+)
+
+// 目标展开
+// 任务目标中的网段（10.0.0.0/24）、IP 范围（192.168.1.1-192.168.1.50 或 192.168.1.1-50）
+// 和逗号分隔的列表在进入流水线前展开为单个主机，端口扫描按主机调用 GoGo，结果带上具体 IP
+
+// DefaultMaxExpandedTargets 展开后的默认目标数上限
+const DefaultMaxExpandedTargets = 4096
+
+// cidrLike 形如网段的目标，解析失败时报错而不是当作域名
+var cidrLike = regexp.MustCompile(`^[0-9a-fA-F:.]+/\d+$`)
+
+// ExpandTargets 展开网段、IP 范围和逗号列表，去重并保持顺序
+// 域名、URL 中的国际化域名转换为 punycode，其余原样保留
+// 展开后超过 limit（<=0 使用 DefaultMaxExpandedTargets）时返回错误
+func ExpandTargets(targets []string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = DefaultMaxExpandedTargets
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(targets))
+	add := func(target string) error {
+		if seen[target] {
+			return nil
+		}
+		if len(result) >= limit {
+			return fmt.Errorf("too many targets after expansion: more than %d hosts", limit)
+		}
+		seen[target] = true
+		result = append(result, target)
+		return nil
+	}
+
+	for _, raw := range targets {
+		for _, target := range strings.Split(raw, ",") {
+			target = strings.TrimSpace(target)
+			if target == "" {
+				continue
+			}
+
+			start, end, err := parseIPTarget(target)
+			if err != nil {
+				return nil, err
+			}
+			if start == nil {
+				if err := add(core.NormalizeTargetIDN(target)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// 逐个展开前先检查数量，避免 /8 这样的网段占用大量内存
+			if count := ipRangeSize(start, end); count > int64(limit-len(result)) {
+				return nil, fmt.Errorf("too many targets after expansion: %s contains %d hosts, limit is %d", target, count, limit)
+			}
+			for ip := start; ; ip = nextIP(ip) {
+				if err := add(ip.String()); err != nil {
+					return nil, err
+				}
+				if ip.Equal(end) {
+					break
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseIPTarget 解析网段或 IP 范围，返回首尾地址；不是网段/范围的目标返回 nil
+func parseIPTarget(target string) (net.IP, net.IP, error) {
+	if cidrLike.MatchString(target) {
+		_, ipNet, err := net.ParseCIDR(target)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR target %q: %v", target, err)
+		}
+		start := normalizeIP(ipNet.IP)
+		end := make(net.IP, len(start))
+		for i := range start {
+			end[i] = start[i] | ^ipNet.Mask[i]
+		}
+		return start, end, nil
+	}
+
+	if strings.Contains(target, "://") {
+		return nil, nil, nil
+	}
+	left, right, found := strings.Cut(target, "-")
+	if !found {
+		return nil, nil, nil
+	}
+	start := net.ParseIP(strings.TrimSpace(left))
+	if start == nil {
+		// 带连字符的域名
+		return nil, nil, nil
+	}
+	start = normalizeIP(start)
+	right = strings.TrimSpace(right)
+
+	end := net.ParseIP(right)
+	if end == nil && len(start) == net.IPv4len {
+		// 简写形式：192.168.1.1-50 只给出最后一段
+		if n, err := strconv.Atoi(right); err == nil && n >= 0 && n <= 255 {
+			end = append(net.IP{}, start...)
+			end[3] = byte(n)
+		}
+	}
+	if end == nil {
+		return nil, nil, fmt.Errorf("invalid IP range %q", target)
+	}
+	end = normalizeIP(end)
+	if len(start) != len(end) {
+		return nil, nil, fmt.Errorf("invalid IP range %q: mixed IPv4 and IPv6", target)
+	}
+	if bytes.Compare(start, end) > 0 {
+		return nil, nil, fmt.Errorf("invalid IP range %q: start is after end", target)
+	}
+	return start, end, nil
+}
+
+// normalizeIP IPv4 使用 4 字节表示，便于比较和计算范围
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// ipRangeSize 范围内的地址数，超过 int64 时返回最大值
+func ipRangeSize(start, end net.IP) int64 {
+	size := new(big.Int).Sub(new(big.Int).SetBytes(end), new(big.Int).SetBytes(start))
+	size.Add(size, big.NewInt(1))
+	if !size.IsInt64() {
+		return 1<<63 - 1
+	}
+	return size.Int64()
+}
+
+// nextIP 返回下一个地址（不修改参数）
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP{}, ip...)
+	incrementIP(next)
+	return next
+}
+
+// incrementIP 递增 IP 地址
+func incrementIP(ip net.IP) {
+	for j := len(ip) - 1; j >= 0; j-- {
+		ip[j]++
+		if ip[j] > 0 {
+			break
+		}
+	}
+}
+
+// isIPTarget 目标是否为单个 IP（展开后的网段、范围）
+func isIPTarget(target interface{}) bool {
+	s, ok := target.(string)
+	return ok && isIPAddress(s)
+}
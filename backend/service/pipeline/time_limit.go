@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultTimeLimitWarnRatio 已用时间达到时间上限的该比例时触发超时预警
+const DefaultTimeLimitWarnRatio = 0.8
+
+// OverrunHandler 超时预警回调
+type OverrunHandler func(elapsed, limit time.Duration, report *ProgressReport)
+
+// TimeLimitError 流水线超过时间上限被终止
+type TimeLimitError struct {
+	Limit    time.Duration
+	Module   string          // 超时时仍在运行的最上游模块
+	Progress *ModuleProgress // 该模块的进度（未启用进度追踪时为 nil）
+	Report   *ProgressReport // 超时时的进度报告（未启用进度追踪时为 nil）
+}
+
+// Error 输出超时时的模块与进度
+func (e *TimeLimitError) Error() string {
+	var sb strings.Builder
+	limit := e.Limit.String()
+	if e.Limit >= time.Second {
+		limit = formatDuration(e.Limit)
+	}
+	fmt.Fprintf(&sb, "任务超过时间上限 %s", limit)
+
+	if e.Module == "" {
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "，超时时正在运行模块 %s", e.Module)
+	if mp := e.Progress; mp != nil {
+		if mp.TotalItems > 0 {
+			fmt.Fprintf(&sb, "（进度 %.1f%%，已处理 %d/%d，输出 %d）", mp.Progress, mp.ProcessedItems, mp.TotalItems, mp.OutputItems)
+		} else {
+			fmt.Fprintf(&sb, "（已处理 %d，输出 %d）", mp.ProcessedItems, mp.OutputItems)
+		}
+	}
+	if e.Report != nil {
+		fmt.Fprintf(&sb, "，总体进度 %d%%", e.Report.OverallProgress)
+	}
+	return sb.String()
+}
+
+// SetOverrunHandler 设置超时预警回调
+func (p *StreamingPipeline) SetOverrunHandler(handler OverrunHandler) {
+	p.overrunHandler = handler
+}
+
+// runTimeLimit 超过预警比例时触发回调，到达时间上限时终止流水线
+func (p *StreamingPipeline) runTimeLimit(done <-chan struct{}) {
+	limit := p.config.TimeLimit
+	if limit <= 0 {
+		return
+	}
+
+	ratio := p.config.TimeLimitWarnRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = DefaultTimeLimitWarnRatio
+	}
+
+	start := time.Now()
+	warnTimer := time.NewTimer(time.Duration(float64(limit) * ratio))
+	defer warnTimer.Stop()
+	limitTimer := time.NewTimer(limit)
+	defer limitTimer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.ctx.Done():
+			return
+		case <-warnTimer.C:
+			elapsed := time.Since(start)
+			log.Printf("[Pipeline] Time limit warning: elapsed %v of %v", elapsed.Round(time.Second), limit)
+			if p.progressTracker != nil {
+				p.progressTracker.MarkOverrun()
+			}
+			if p.overrunHandler != nil {
+				p.overrunHandler(elapsed, limit, p.GetProgressReport())
+			}
+		case <-limitTimer.C:
+			// 在终止前获取进度，模块退出后状态会变为 completed
+			p.abortWithError(p.timeLimitError(limit))
+			return
+		}
+	}
+}
+
+// timeLimitError 根据当前模块状态构建超时错误
+func (p *StreamingPipeline) timeLimitError(limit time.Duration) *TimeLimitError {
+	tlErr := &TimeLimitError{
+		Limit:  limit,
+		Module: p.monitor.firstRunning(),
+		Report: p.GetProgressReport(),
+	}
+	if tlErr.Report != nil {
+		tlErr.Progress = tlErr.Report.ModuleProgresses[tlErr.Module]
+	}
+	return tlErr
+}
+
+// firstRunning 获取链上第一个仍在产出数据的模块（即当前的瓶颈模块）
+// 模块在下游结束后才会返回，因此以下游输入是否关闭判断模块是否仍在处理
+func (pm *pipelineMonitor) firstRunning() string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for i := 0; i+1 < len(pm.modules); i++ {
+		if !pm.modules[i+1].state.inputClosed {
+			return pm.modules[i].state.name
+		}
+	}
+	return ""
+}
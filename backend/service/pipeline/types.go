@@ -1,6 +1,11 @@
 package pipeline
 
-import "time"
+import (
+	"time"
+
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/webscan"
+)
 
 // 流水线数据类型定义
 // 定义模块间传递的数据结构，实现流式处理
@@ -22,49 +27,76 @@ type SubdomainResult struct {
 	StatusCode   int      `json:"status_code"`  // HTTP 状态码
 	WebServer    string   `json:"web_server"`   // Web 服务器
 	Technologies []string `json:"technologies"` // 技术栈/指纹
+	TechVersions map[string]string `json:"tech_versions,omitempty"` // 技术版本: 规范名称 -> 版本
 	CDN          bool     `json:"cdn"`          // 是否为 CDN
 	CDNName      string   `json:"cdn_name"`     // CDN 名称
 	URL          string   `json:"url"`          // 完整 URL
+	Excluded     bool     `json:"excluded,omitempty"` // 命中任务排除规则，仅记录不扫描
+	Resolution   string   `json:"resolution,omitempty"` // 解析状态: resolved, unresolved, nxdomain, unverified
+	// SaaS 分类结果
+	SaaSProvider string   `json:"saas_provider,omitempty"` // SaaS 平台
+	SaaSCategory string   `json:"saas_category,omitempty"` // 平台类别
+	SaaSHandling string   `json:"saas_handling,omitempty"` // 处理建议: skip-portscan, takeover-relevant, scan-normally
+	SkipReason   string   `json:"skip_reason,omitempty"`   // 跳过端口扫描的原因
 }
 
 // DomainResolve 域名解析结果
 // 由子域名安全检测模块输出，传递给端口扫描预处理模块
 type DomainResolve struct {
-	Domain string   `json:"domain"` // 域名
-	IP     []string `json:"ip"`     // 解析的IP
+	Domain     string   `json:"domain"`                // 域名
+	IP         []string `json:"ip"`                    // 解析的IP
+	CNAMEs     []string `json:"cnames,omitempty"`      // CNAME 链，CDN 检测使用
+	SkipReason string   `json:"skip_reason,omitempty"` // 非空时跳过端口扫描（如 SaaS 平台）
 }
 
 // DomainSkip 端口扫描预处理结果
 // 由端口扫描预处理模块输出，传递给端口扫描模块
 // 包含CDN检测结果，决定是否跳过该域名的端口扫描
 type DomainSkip struct {
-	Domain string   `json:"domain"` // 域名
-	IP     []string `json:"ip"`     // 解析的IP
-	Skip   bool     `json:"skip"`   // 是否跳过端口扫描（如CDN）
-	IsCDN  bool     `json:"is_cdn"` // 是否为CDN
-	CDN    string   `json:"cdn"`    // CDN提供商名称
-	CIDR   bool     `json:"cidr"`   // 是否为CIDR格式
+	Domain   string   `json:"domain"`             // 域名
+	IP       []string `json:"ip"`                 // 解析的IP
+	Skip     bool     `json:"skip"`               // 是否跳过端口扫描（如CDN）
+	IsCDN    bool     `json:"is_cdn"`             // 是否为CDN
+	CDN      string   `json:"cdn"`                // CDN提供商名称
+	CIDR     bool     `json:"cidr"`               // 是否为CIDR格式
+	Reason   string   `json:"reason,omitempty"`   // 跳过原因
+	Evidence string   `json:"evidence,omitempty"` // CDN 判定依据（命中的 CNAME、IP 段和响应头）
 }
 
 // PortAlive 端口存活结果
 // 由端口扫描模块输出，传递给端口指纹识别模块
 type PortAlive struct {
-	Host    string `json:"host"`    // 域名或IP
-	IP      string `json:"ip"`      // IP地址
-	Port    string `json:"port"`    // 端口号
-	Service string `json:"service"` // 初步识别的服务
+	Host           string                `json:"host"`                       // 域名或IP
+	IP             string                `json:"ip"`                         // IP地址
+	Family         string                `json:"family,omitempty"`           // IP 地址族: ipv4, ipv6
+	Port           string                `json:"port"`                       // 端口号
+	Service        string                `json:"service"`                    // 初步识别的服务
+	Protocol       string                `json:"protocol,omitempty"`         // 传输层协议: tcp, udp
+	TLS            bool                  `json:"tls"`                        // 是否为 TLS 服务
+	ResponseTimeMs int64                 `json:"response_time_ms,omitempty"` // TCP 连接耗时（毫秒）
+	Certificate    *fingerprint.CertInfo `json:"certificate,omitempty"`      // TLS 端口的证书
+}
+
+// HostLiveness 主机存活探测结果
+// 由存活预检测模块输出，未响应的主机直接记录，不进入端口扫描
+type HostLiveness struct {
+	IP       string   `json:"ip"`       // IP地址
+	Alive    bool     `json:"alive"`    // 是否存活
+	Method   string   `json:"method"`   // 判定存活的方式: tcp, icmp
+	Evidence []string `json:"evidence"` // 探测证据，如 tcp/80 timeout
 }
 
 // AssetOther 非HTTP资产
 // 由端口指纹识别模块输出
 type AssetOther struct {
-	Host    string `json:"host"`    // 域名
-	IP      string `json:"ip"`      // IP地址
-	Port    string `json:"port"`    // 端口
-	Service string `json:"service"` // 服务类型
-	Type    string `json:"type"`    // 资产类型: http, other
-	Banner  string `json:"banner"`  // Banner信息
-	Version string `json:"version"` // 版本信息
+	Host         string   `json:"host"`                   // 域名
+	IP           string   `json:"ip"`                     // IP地址
+	Port         string   `json:"port"`                   // 端口
+	Service      string   `json:"service"`                // 服务类型
+	Type         string   `json:"type"`                   // 资产类型: http, other
+	Banner       string   `json:"banner"`                 // Banner信息
+	Version      string   `json:"version"`                // 版本信息
+	Fingerprints []string `json:"fingerprints,omitempty"` // 命中的服务指纹规则（service_finger.yaml）
 }
 
 // AssetHttp HTTP资产
@@ -72,6 +104,7 @@ type AssetOther struct {
 type AssetHttp struct {
 	Host         string   `json:"host"`         // 域名
 	IP           string   `json:"ip"`           // IP地址
+	Family       string   `json:"family,omitempty"` // IP 地址族: ipv4, ipv6
 	Port         string   `json:"port"`         // 端口
 	URL          string   `json:"url"`          // 完整URL
 	Title        string   `json:"title"`        // 页面标题
@@ -79,7 +112,26 @@ type AssetHttp struct {
 	Server       string   `json:"server"`       // Web服务器
 	ContentType  string   `json:"content_type"` // 内容类型
 	Technologies []string `json:"technologies"` // 识别的技术栈
+	TechVersions map[string]string `json:"tech_versions,omitempty"` // 技术版本: 规范名称 -> 版本
 	Fingerprints []string `json:"fingerprints"` // 指纹信息
+	Source       string   `json:"source,omitempty"` // 来源: fingerprint（默认）、httpx
+	FinalURL     string   `json:"final_url,omitempty"` // 跳转后实际识别的页面URL，与 URL 相同时为空
+	BodyHash           string `json:"body_hash,omitempty"`            // 响应体 MD5
+	NormalizedBodyHash string `json:"normalized_body_hash,omitempty"` // 去掉 CSRF token、时间戳等后的响应体 hash，用于比较两次扫描
+	BodyPreview        string `json:"body_preview,omitempty"`         // 页面可见文本的开头部分
+	WAF                string `json:"waf,omitempty"`                  // 检测到的 WAF 名称
+	WAFMethod          string `json:"waf_method,omitempty"`           // WAF 检测方式: header, cookie, body, probe
+}
+
+// ScreenshotResult 页面截图结果
+// 由截图模块输出，执行器合并到同一 URL 的 Web 服务结果
+type ScreenshotResult struct {
+	URL   string `json:"url"`             // 截图的URL
+	Host  string `json:"host"`            // 域名
+	IP    string `json:"ip"`              // IP地址
+	Port  string `json:"port"`            // 端口
+	Path  string `json:"path,omitempty"`  // 截图文件路径，截图失败时为空
+	Error string `json:"error,omitempty"` // 截图失败原因
 }
 
 // UrlResult URL扫描结果
@@ -87,25 +139,44 @@ type AssetHttp struct {
 type UrlResult struct {
 	Input       string `json:"input"`        // 输入URL
 	Output      string `json:"output"`       // 发现的URL
-	Source      string `json:"source"`       // 来源: katana, wayback, rad
+	Source      string `json:"source"`       // 来源: katana, wayback, rad, dirscan, openapi, jsfinder
 	Method      string `json:"method"`       // HTTP方法
 	StatusCode  int    `json:"status_code"`  // HTTP状态码
 	ContentType string `json:"content_type"` // 内容类型
 	Length      int64  `json:"length"`       // 响应长度
 	ResultId    string `json:"result_id"`    // 结果ID (用于去重)
+	// 爬虫发现的表单提交等请求，保留请求内容以便导出重放
+	RequestBody    string            `json:"request_body,omitempty"`    // 请求体
+	RequestHeaders map[string]string `json:"request_headers,omitempty"` // 请求头（至少包含 Content-Type）
+	StateChanging  bool              `json:"is_state_changing"`         // 可能改变服务端状态，流水线中不自动重放
+	// 爬虫发现的请求的参数，漏洞扫描按参数构造测试请求
+	RequestContentType string              `json:"request_content_type,omitempty"` // 请求的 Content-Type
+	Parameters         []string            `json:"parameters,omitempty"`           // 查询参数名和请求体参数名，排序
+	FormFields         []webscan.FormField `json:"form_fields,omitempty"`          // 表单提交的字段名和类型
+	Suspicious     bool              `json:"suspicious,omitempty"`      // 目录扫描疑似软 404（同一主机上大量相同响应）
+	Interesting    bool              `json:"interesting,omitempty"`     // 目录扫描状态码为 401/403/405/500，需要重点关注
+	// 标准化形式，由发现该 URL 的模块填写
+	NormalizedURL string `json:"normalized_url,omitempty"` // 协议和主机小写、去掉默认端口和片段、参数排序后的 URL
+	Signature     string `json:"url_signature,omitempty"`  // 参数值替换为占位符后的 URL，按参数签名去重时使用
+	ParamSignature string `json:"param_signature,omitempty"` // 请求方法 + 接口 + 参数名集合，按参数集合去重时使用
+	// 从 OpenAPI 文档或 JS 文件中提取的接口，记录来源文档
+	Parent string `json:"parent,omitempty"`
 }
 
 // SensitiveInfoResult 敏感信息检测结果
 type SensitiveInfoResult struct {
-	Target     string                  `json:"target"`     // 目标URL
-	URL        string                  `json:"url"`        // 发现位置
-	Type       string                  `json:"type"`       // 敏感信息类型: api_key, password, token, email, phone, id_card, etc
-	Pattern    string                  `json:"pattern"`    // 匹配的模式名称
-	Matches    []string                `json:"matches"`    // 匹配到的内容
-	Location   string                  `json:"location"`   // 位置: body, header, js, url
-	Severity   string                  `json:"severity"`   // 严重程度: critical, high, medium, low, info
-	Confidence int                     `json:"confidence"` // 置信度 0-100
-	Source     string                  `json:"source"`     // 来源
+	Target       string                     `json:"target"`             // 目标URL
+	URL          string                     `json:"url"`                // 发现位置
+	Parent       string                     `json:"parent,omitempty"`   // 链接到该文件的页面（内容检测）
+	Type         string                     `json:"type"`               // 敏感信息类型: api_key, password, token, email, phone, id_card, etc
+	Pattern      string                     `json:"pattern"`            // 匹配的模式名称
+	Matches      []string                   `json:"matches"`            // 匹配到的内容
+	Contexts     []webscan.SensitiveContext `json:"contexts,omitempty"` // 前 20 处匹配的上下文（匹配值已掩码）和偏移
+	TotalMatches int                        `json:"total_matches"`      // 响应中的匹配总数
+	Location     string                     `json:"location"`           // 位置: body, header, js, url
+	Severity     string                     `json:"severity"`           // 严重程度: critical, high, medium, low, info
+	Confidence   int                        `json:"confidence"`         // 置信度 0-100
+	Source       string                     `json:"source"`             // 来源
 }
 
 // SubTakeResult 子域名接管检测结果 (旧版，保留兼容)
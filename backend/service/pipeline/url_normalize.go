@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"moongazing/scanner/webscan"
+)
+
+// URL 标准化和去重
+// katana、rad、spray 发现的同一页面写法可能不同（主机大小写、默认端口、片段、参数顺序、末尾斜杠、
+// 参数编码），标准化后再去重。参数签名把参数值替换为占位符，?id=1 和 ?id=2 视为同一个 URL，
+// 开启 URLDedupSignature 时爬虫和目录扫描按签名去重，入库时也按 data.url_signature 合并。
+// 开启 URLDedupParameters 时按请求方法、接口和参数名集合（查询参数和请求体字段）去重，
+// GET ?a=1&b=2 与 GET ?b=3&a=4 视为同一接口，入库时按 data.param_signature 合并
+
+// URLParamPlaceholder 参数签名中替换参数值的占位符
+const URLParamPlaceholder = "{}"
+
+// NormalizeURL 标准化 URL：协议和主机转小写，去掉默认端口、片段和非根路径末尾的斜杠，参数按名称和值排序
+// 无法解析或没有主机的字符串原样返回
+func NormalizeURL(rawURL string) string {
+	return normalizeURL(rawURL, false)
+}
+
+// URLSignature 参数签名：在 NormalizeURL 的基础上把参数值替换为占位符，重复的参数只保留一个
+func URLSignature(rawURL string) string {
+	return normalizeURL(rawURL, true)
+}
+
+func normalizeURL(rawURL string, signature bool) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	} else if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	u.RawPath = ""
+	u.ForceQuery = false
+	u.RawQuery = normalizeQuery(u.RawQuery, signature)
+	return u.String()
+}
+
+// normalizeQuery 解码后重新编码参数并排序，signature 为 true 时参数值替换为占位符
+func normalizeQuery(rawQuery string, signature bool) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil && len(values) == 0 {
+		return rawQuery
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		key := url.QueryEscape(k)
+		if signature {
+			parts = append(parts, key+"="+URLParamPlaceholder)
+			continue
+		}
+		vals := append([]string(nil), values[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, key+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// ParameterSignature 参数集合签名：请求方法、去掉查询参数的标准化地址和排序后的参数名，如 POST https://a.com/login?password&username
+// 参数名取 UrlResult.Parameters，未填写时从 URL 和请求体中解析
+func ParameterSignature(r UrlResult) string {
+	method := strings.ToUpper(strings.TrimSpace(r.Method))
+	if method == "" {
+		method = "GET"
+	}
+	endpoint, _, _ := strings.Cut(NormalizeURL(r.Output), "?")
+	params := r.Parameters
+	if params == nil {
+		params = webscan.ParseRequestParams(r.Output, requestHeader(r.RequestHeaders, "Content-Type"), r.RequestBody).Parameters
+	}
+	if len(params) == 0 {
+		return method + " " + endpoint
+	}
+	return method + " " + endpoint + "?" + strings.Join(params, "&")
+}
+
+// AnnotateURL 填写 URL 结果的标准化地址、参数签名和参数集合签名，已填写时保持不变
+func AnnotateURL(r UrlResult) UrlResult {
+	if r.NormalizedURL == "" {
+		r.NormalizedURL = NormalizeURL(r.Output)
+	}
+	if r.Signature == "" {
+		r.Signature = URLSignature(r.Output)
+	}
+	if r.ParamSignature == "" {
+		r.ParamSignature = ParameterSignature(r)
+	}
+	return r
+}
+
+// URLDeduper 爬虫和目录扫描共用的 URL 去重器，同一个 URL 只由最先发现它的模块输出
+type URLDeduper struct {
+	store        DedupStore
+	bySignature  bool
+	byParameters bool
+}
+
+// NewURLDeduper 创建 URL 去重器，bySignature 为 true 时按参数签名去重，否则按标准化后的 URL
+func NewURLDeduper(bySignature bool) *URLDeduper {
+	return &URLDeduper{store: NewMemoryDedupStore(), bySignature: bySignature}
+}
+
+// NewParameterURLDeduper 创建按请求方法、接口和参数名集合去重的 URL 去重器
+func NewParameterURLDeduper() *URLDeduper {
+	return &URLDeduper{store: NewMemoryDedupStore(), byParameters: true}
+}
+
+// BySignature 是否按参数签名去重
+func (d *URLDeduper) BySignature() bool {
+	return d != nil && d.bySignature
+}
+
+// ByParameters 是否按参数集合去重
+func (d *URLDeduper) ByParameters() bool {
+	return d != nil && d.byParameters
+}
+
+// urlDedupKey 去重键：同一地址的 GET 和表单提交是不同的请求
+// 按参数集合去重时方法已包含在签名中，请求体的参数值不参与比较
+func urlDedupKey(r UrlResult, dedup *URLDeduper) string {
+	if dedup.ByParameters() {
+		return r.ParamSignature
+	}
+	key := r.NormalizedURL
+	if dedup.BySignature() {
+		key = r.Signature
+	}
+	if r.Method == "" || strings.EqualFold(r.Method, "GET") {
+		return key
+	}
+	return strings.ToUpper(r.Method) + " " + key + "\n" + r.RequestBody
+}
+
+// SetURLDeduper 设置共享的 URL 去重器，nil 时只在模块内按标准化后的 URL 去重
+func (m *BaseModule) SetURLDeduper(dedup *URLDeduper) {
+	m.urlDedup = dedup
+}
+
+// checkURL 填写标准化地址和参数签名，并检查该 URL 是否已经输出过
+func (m *BaseModule) checkURL(r UrlResult) (UrlResult, bool) {
+	r = AnnotateURL(r)
+	key := urlDedupKey(r, m.urlDedup)
+	if m.urlDedup != nil {
+		return r, m.dupChecker.seenIn(m.urlDedup.store, DedupKindURL, key)
+	}
+	return r, m.dupChecker.IsURLDuplicate(key)
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+
+	"moongazing/scanner/core"
+)
+
+// User-Agent 策略
+// PipelineConfig.UserAgentStrategy 设置后，指纹识别、HTTP 探测和内容检测按策略为每个请求选择 User-Agent，
+// katana、spray 每次运行选择一个通过 -H/--header 传入；自定义请求头中设置了 User-Agent 时以自定义请求头为准。
+// 工具（或当前版本）不支持请求头参数时使用工具的默认 User-Agent，记录 headers_unsupported 警告事件
+
+// applyUserAgents 按策略创建 User-Agent 选择器并应用到各模块的扫描器，策略为空时不设置
+func (p *StreamingPipeline) applyUserAgents() error {
+	agents, err := core.NewUserAgentPicker(p.config.UserAgentStrategy, p.config.UserAgents)
+	if err != nil || agents == nil {
+		return err
+	}
+	log.Printf("[Pipeline] User-Agent strategy: %s (%d agents)", agents.Strategy(), len(agents.Agents()))
+
+	if p.subdomainModule != nil {
+		p.subdomainModule.SetUserAgents(agents)
+	}
+	if p.fingerprintModule != nil {
+		p.fingerprintModule.SetUserAgents(agents)
+	}
+	if p.crawlerModule != nil {
+		p.crawlerModule.SetUserAgents(agents)
+	}
+	if p.dirScanModule != nil {
+		p.dirScanModule.SetUserAgents(agents)
+	}
+	if p.contentModule != nil {
+		p.contentModule.SetUserAgents(agents)
+	}
+	return nil
+}
+
+// SetUserAgents 设置 HTTP 探测的 User-Agent 策略
+func (m *SubdomainScanModule) SetUserAgents(agents *core.UserAgentPicker) {
+	if m.httpxScanner != nil {
+		m.httpxScanner.SetUserAgents(agents)
+	}
+}
+
+// SetUserAgents 设置指纹识别的 User-Agent 策略（页面、https 重试、favicon 请求和端口 HTTP 探测）
+func (m *FingerprintModule) SetUserAgents(agents *core.UserAgentPicker) {
+	m.fingerprintScanner.SetUserAgents(agents)
+	if m.httpProber != nil {
+		m.httpProber.SetUserAgents(agents)
+	}
+}
+
+// SetUserAgents 设置 katana 的 User-Agent 请求头参数，rad 不支持命令行请求头
+func (m *CrawlerModule) SetUserAgents(agents *core.UserAgentPicker) {
+	if m.katanaScanner.SetUserAgents(agents) && m.useKatana && m.katanaScanner.IsAvailable() {
+		m.emitUserAgentUnsupported("katana")
+	}
+	if m.radEnabled() {
+		m.emitUserAgentUnsupported("rad")
+	}
+}
+
+// SetUserAgents 设置 spray 的 User-Agent 请求头参数
+func (m *DirScanModule) SetUserAgents(agents *core.UserAgentPicker) {
+	if m.sprayScanner == nil {
+		return
+	}
+	if m.sprayScanner.SetUserAgents(agents) && m.sprayScanner.IsAvailable() {
+		m.emitUserAgentUnsupported("spray")
+	}
+}
+
+// SetUserAgents 设置获取内容时的 User-Agent 策略
+func (m *ContentAnalysisModule) SetUserAgents(agents *core.UserAgentPicker) {
+	m.analyzer.UserAgents = agents
+}
+
+// emitUserAgentUnsupported 记录工具不支持设置 User-Agent，该工具的请求使用其默认 User-Agent
+func (m *BaseModule) emitUserAgentUnsupported(tool string) {
+	log.Printf("[%s] %s does not support custom headers, its requests use its default User-Agent", m.name, tool)
+	m.events.Emit(m.name, EventLevelWarn, EventHeadersUnsupported,
+		fmt.Sprintf("%s 不支持自定义请求头，其请求使用工具默认的 User-Agent", tool), map[string]interface{}{
+			"tool":   tool,
+			"header": "User-Agent",
+		})
+}
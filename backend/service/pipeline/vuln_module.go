@@ -2,13 +2,26 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
+	"moongazing/scanner/core"
 	"moongazing/scanner/vulnscan"
 )
 
+// nuclei 攒批参数：流式输入的目标攒够 nucleiBatchSize 个，或第一个目标等待 nucleiBatchWait 后一次调用 nuclei，
+// 避免每个目标启动一个 nuclei 进程
+const (
+	nucleiBatchSize = 50
+	nucleiBatchWait = 3 * time.Second
+	// nucleiBatchTimeout 一批目标的扫描超时
+	nucleiBatchTimeout = 30 * time.Minute
+)
+
 // VulnScanModule 漏洞扫描模块
 // 接收HTTP资产或URL，执行漏洞扫描，输出漏洞结果
 type VulnScanModule struct {
@@ -19,6 +32,12 @@ type VulnScanModule struct {
 	templates   []string // 指定模板
 	severity    []string // 过滤严重级别
 	tags        []string // 过滤标签
+
+	// nuclei 可用时使用 nuclei，否则使用内置引擎
+	nuclei          *vulnscan.NucleiCLIScanner
+	nucleiResolved  bool
+	scanConcurrency int // nuclei -c，0 使用默认值
+	rateLimit       int // nuclei -rl，0 使用默认值
 }
 
 // NewVulnScanModule 创建漏洞扫描模块
@@ -57,6 +76,74 @@ func (m *VulnScanModule) SetTags(tags []string) {
 	m.tags = tags
 }
 
+// SetFilters 设置任务的严重级别和模板选择，selectors 中的模板路径和标签分开处理
+func (m *VulnScanModule) SetFilters(severities, selectors []string) {
+	if len(severities) > 0 {
+		m.severity = make([]string, 0, len(severities))
+		for _, sev := range severities {
+			m.severity = append(m.severity, strings.ToLower(strings.TrimSpace(sev)))
+		}
+	}
+	m.templates, m.tags = vulnscan.SplitTemplateSelectors(selectors)
+}
+
+// SetRateLimit 设置 nuclei 并发模板数和每秒请求数（内置引擎只使用并发数），0 保持默认值
+func (m *VulnScanModule) SetRateLimit(concurrency, rateLimit int) {
+	m.scanConcurrency = concurrency
+	m.rateLimit = rateLimit
+	if concurrency > 0 {
+		m.vulnScanner.Concurrency = concurrency
+	}
+}
+
+// SetNucleiScanner 指定 nuclei 扫描器（测试使用模拟的 nuclei）
+func (m *VulnScanModule) SetNucleiScanner(scanner *vulnscan.NucleiCLIScanner) {
+	m.nuclei = scanner
+}
+
+// nucleiConfig 任务的 nuclei 扫描配置
+func (m *VulnScanModule) nucleiConfig() *vulnscan.NucleiScanConfig {
+	config := vulnscan.NewNucleiScanConfig(m.severity, nil, m.scanConcurrency, m.rateLimit)
+	config.Templates = m.templates
+	config.Tags = m.tags
+	return config
+}
+
+// resolveScanner 确定使用 nuclei 还是内置引擎，并把调用参数记录到任务事件
+func (m *VulnScanModule) resolveScanner() {
+	if m.nucleiResolved {
+		return
+	}
+	m.nucleiResolved = true
+	if m.nuclei == nil {
+		m.nuclei = vulnscan.NewNucleiCLIScanner("")
+	}
+	if !m.nuclei.IsAvailable() {
+		m.nuclei = nil
+	}
+
+	data := map[string]interface{}{
+		"severities": m.severity,
+		"templates":  m.templates,
+		"tags":       m.tags,
+	}
+	if m.nuclei != nil {
+		args := core.RedactArgs(m.nuclei.BuildArgs([]string{"<target>"}, m.nucleiConfig()))
+		data["tool"] = "nuclei"
+		data["args"] = args
+		log.Printf("[%s] nuclei %s", m.name, strings.Join(args, " "))
+		m.events.Emit(m.name, EventLevelInfo, EventToolCommand, "nuclei "+strings.Join(args, " "), data)
+		return
+	}
+	data["tool"] = "vulnscan"
+	message := fmt.Sprintf("nuclei 不可用，使用内置引擎: severity=%s tags=%s",
+		strings.Join(m.severity, ","), strings.Join(m.tags, ","))
+	if len(m.templates) > 0 {
+		message += "（内置引擎不支持模板路径，已忽略 " + strings.Join(m.templates, ",") + "）"
+	}
+	m.events.Emit(m.name, EventLevelInfo, EventToolCommand, message, data)
+}
+
 // ModuleRun 运行模块
 func (m *VulnScanModule) ModuleRun() error {
 	var allWg sync.WaitGroup
@@ -65,6 +152,7 @@ func (m *VulnScanModule) ModuleRun() error {
 
 	// 并发控制
 	sem := make(chan struct{}, m.concurrency)
+	m.resolveScanner()
 
 	// 启动下一个模块
 	if m.nextModule != nil {
@@ -100,6 +188,24 @@ func (m *VulnScanModule) ModuleRun() error {
 		}
 	}()
 
+	// nuclei 的目标攒批后扫描
+	var batch []string
+	var batchTimer <-chan time.Time
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		targets := batch
+		batch, batchTimer = nil, nil
+		allWg.Add(1)
+		go func() {
+			defer allWg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			m.scanNucleiBatch(targets)
+		}()
+	}
+
 	// 处理输入
 	for {
 		select {
@@ -110,8 +216,12 @@ func (m *VulnScanModule) ModuleRun() error {
 			nextModuleRun.Wait()
 			return nil
 
+		case <-batchTimer:
+			flush()
+
 		case data, ok := <-m.input:
 			if !ok {
+				flush()
 				allWg.Wait()
 				close(m.resultChan)
 				resultWg.Wait()
@@ -133,6 +243,22 @@ func (m *VulnScanModule) ModuleRun() error {
 				continue
 			}
 
+			if m.nuclei != nil {
+				select {
+				case <-m.ctx.Done():
+					continue
+				case m.resultChan <- data:
+				}
+				batch = append(batch, target)
+				if len(batch) == 1 {
+					batchTimer = time.After(nucleiBatchWait)
+				}
+				if len(batch) >= nucleiBatchSize {
+					flush()
+				}
+				continue
+			}
+
 			allWg.Add(1)
 			go func(t string, originalData interface{}) {
 				defer allWg.Done()
@@ -159,6 +285,10 @@ func (m *VulnScanModule) extractTarget(data interface{}) string {
 	case AssetHttp:
 		return v.URL
 	case UrlResult:
+		// 可能改变服务端状态的请求不自动重新请求
+		if v.StateChanging {
+			return ""
+		}
 		return v.Output
 	case string:
 		return v
@@ -196,6 +326,10 @@ func (m *VulnScanModule) scanVulnerabilities(target string) {
 			templates = tagFiltered
 		}
 	}
+	// 设置了过滤条件但没有匹配的内置模板时不扫描（空列表会使用全部模板）
+	if len(templates) == 0 && (len(m.severity) > 0 || len(m.tags) > 0) {
+		return
+	}
 
 	// 执行扫描
 	result := m.vulnScanner.ScanVuln(ctx, target, templates)
@@ -229,6 +363,98 @@ func (m *VulnScanModule) scanVulnerabilities(target string) {
 	}
 }
 
+// scanNucleiBatch 一次调用 nuclei 扫描一批目标，结果按 nuclei 输出的 host 和 matched-at 对应到输入的目标
+func (m *VulnScanModule) scanNucleiBatch(targets []string) {
+	log.Printf("[%s] Scanning vulnerabilities for %d targets with nuclei", m.name, len(targets))
+
+	ctx, cancel := context.WithTimeout(m.ctx, nucleiBatchTimeout)
+	defer cancel()
+
+	config := m.nucleiConfig()
+	config.Timeout = nucleiBatchTimeout
+	results, err := m.nuclei.Scan(ctx, targets, config)
+	if err != nil {
+		target := targets[0]
+		if len(targets) > 1 {
+			target = fmt.Sprintf("%d 个目标", len(targets))
+		}
+		m.emitTargetError("nuclei", target, err)
+		return
+	}
+
+	log.Printf("[%s] Found %d vulnerabilities for %d targets", m.name, len(results), len(targets))
+
+	for _, r := range results {
+		vulnID := r.TemplateID
+		if r.CVEID != "" {
+			vulnID = r.CVEID
+		}
+		vulnResult := VulnResult{
+			Target:      nucleiResultTarget(targets, r),
+			VulnID:      vulnID,
+			Name:        r.TemplateName,
+			Severity:    r.Severity,
+			Description: r.Description,
+			Evidence:    r.Matched,
+			Reference:   r.Reference,
+			MatchedAt:   r.URL,
+			Source:      "nuclei",
+			Timestamp:   time.Now(),
+		}
+		if vulnResult.Name == "" {
+			vulnResult.Name = r.TemplateID
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.resultChan <- vulnResult:
+		}
+	}
+}
+
+// nucleiResultTarget nuclei 结果对应的输入目标：host 与目标相同，或 matched-at 以目标开头（取最长的），
+// 否则为主机名相同的目标；都不匹配时使用 host
+func nucleiResultTarget(targets []string, r *vulnscan.NucleiResult) string {
+	best := ""
+	for _, target := range targets {
+		if r.Host == target {
+			return target
+		}
+		if prefix := strings.TrimSuffix(target, "/"); strings.HasPrefix(r.URL, prefix) && len(target) > len(best) {
+			best = target
+		}
+	}
+	if best != "" {
+		return best
+	}
+	host := urlHostname(r.Host)
+	if host == "" {
+		host = urlHostname(r.URL)
+	}
+	for _, target := range targets {
+		if host != "" && urlHostname(target) == host {
+			return target
+		}
+	}
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL
+}
+
+// urlHostname URL 或 host:port 的主机名
+func urlHostname(raw string) string {
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
 // intersectTemplates 取模板交集
 func intersectTemplates(a, b []*vulnscan.POCTemplate) []*vulnscan.POCTemplate {
 	m := make(map[string]bool)
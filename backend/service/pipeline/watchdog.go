@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 看门狗：模块输入已关闭但输出在 PipelineConfig.WatchdogTimeout 内没有任何进展时，认为流水线卡死。
+// PipelineConfig 默认不启用，执行器按任务的 watchdog_timeout 设置，未设置时使用 DefaultWatchdogTimeoutMinutes。
+// spray 批量扫描、katana 等模块合法的无输出时间可达 LongestModuleSilenceMinutes，超时必须明显更长
+
+const (
+	// LongestModuleSilenceMinutes 内置模块合法的最长无输出时间（分钟），spray 批量扫描和 katana 单批的执行上限
+	LongestModuleSilenceMinutes = 60
+	// DefaultWatchdogTimeoutMinutes 任务未设置看门狗超时时使用的默认值（分钟）
+	DefaultWatchdogTimeoutMinutes = 90
+)
+
+// watchdogTimeout 获取看门狗超时时间，返回 0 表示禁用
+func (p *StreamingPipeline) watchdogTimeout() time.Duration {
+	if p.config.WatchdogTimeout <= 0 {
+		return 0
+	}
+	return p.config.WatchdogTimeout
+}
+
+// runWatchdog 周期性检查模块状态，发现卡死时强制终止流水线
+func (p *StreamingPipeline) runWatchdog(done <-chan struct{}) {
+	timeout := p.watchdogTimeout()
+	if timeout == 0 {
+		return
+	}
+
+	interval := timeout / 5
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			if reason, stalled := p.monitor.check(timeout, time.Now()); stalled {
+				p.abortWithError(fmt.Errorf("pipeline stalled: %s; modules: %s", reason, p.monitor.describe()))
+				return
+			}
+		}
+	}
+}
+
+// setErr 记录流水线错误（仅保留第一个）
+func (p *StreamingPipeline) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// abortWithError 记录错误并终止流水线
+func (p *StreamingPipeline) abortWithError(err error) {
+	p.setErr(err)
+
+	log.Printf("[Pipeline] Aborted: %v", err)
+	p.abortOnce.Do(func() { close(p.abort) })
+	p.cancel()
+}
+
+// Err 获取流水线异常终止的原因，正常完成时返回 nil
+func (p *StreamingPipeline) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// FailedModule 获取导致流水线异常终止的模块：优先返回 panic 或出错的模块，否则返回当前仍在处理的模块
+func (p *StreamingPipeline) FailedModule() string {
+	if name := p.monitor.failedModule(); name != "" {
+		return name
+	}
+	return p.monitor.firstRunning()
+}
+
+// check 检查是否存在卡死的模块
+func (pm *pipelineMonitor) check(timeout time.Duration, now time.Time) (string, bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if reason, failed := pm.failureLocked(); failed {
+		return reason, true
+	}
+
+	for i, m := range pm.modules {
+		s := m.state
+		if !s.inputClosed {
+			continue
+		}
+
+		// 扇出分支退出后由 FanOut 关闭其合并输入
+		if len(m.downstream) > 0 && s.finished {
+			continue
+		}
+
+		lastProgress := s.closedAt
+		downstream := m.downstream
+		if len(downstream) == 0 && i+1 < len(pm.modules) {
+			downstream = pm.modules[i+1 : i+2]
+		}
+		if len(downstream) > 0 {
+			// 所有下游的输入都已关闭，说明该模块已处理完成
+			closed := true
+			for _, d := range downstream {
+				next := d.state
+				if !next.inputClosed {
+					closed = false
+				}
+				if next.lastReceived.After(lastProgress) {
+					lastProgress = next.lastReceived
+				}
+			}
+			if closed {
+				continue
+			}
+		} else if s.finished {
+			continue
+		}
+
+		if idle := now.Sub(lastProgress); idle > timeout {
+			return fmt.Sprintf("module %s input closed but no output progress for %v", s.name, idle.Round(time.Millisecond)), true
+		}
+	}
+	return "", false
+}
+
+// failure 检查是否有模块 panic 或异常退出
+func (pm *pipelineMonitor) failure() (string, bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.failureLocked()
+}
+
+func (pm *pipelineMonitor) failureLocked() (string, bool) {
+	for _, m := range pm.modules {
+		s := m.state
+		if s.panicValue != nil {
+			return fmt.Sprintf("module %s panicked: %v", s.name, s.panicValue), true
+		}
+		// 模块异常退出后下游收不到数据，结果不完整
+		if s.err != nil {
+			return fmt.Sprintf("module %s exited with error: %v", s.name, s.err), true
+		}
+	}
+	return "", false
+}
+
+// failedModule 第一个 panic 或异常退出的模块
+func (pm *pipelineMonitor) failedModule() string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, m := range pm.modules {
+		if m.state.panicValue != nil || m.state.err != nil {
+			return m.state.name
+		}
+	}
+	return ""
+}
+
+// describe 输出所有模块的状态
+func (pm *pipelineMonitor) describe() string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	states := make([]string, 0, len(pm.modules))
+	for _, m := range pm.modules {
+		states = append(states, m.state.String())
+	}
+	return strings.Join(states, ", ")
+}
@@ -0,0 +1,709 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 结果数据脱敏
+// 导出结果、生成报告时按策略删除、掩码字段或排除整类结果，在序列化之前逐条处理，
+// 不需要把全部结果先读入内存。开启 mask_secrets 时，敏感信息结果的匹配值（密钥、口令等）
+// 在所有字段中替换，避免从漏洞证据、URL 等其他字段还原出已掩码的内容
+
+const (
+	// RedactionPolicyFull 不做任何处理
+	RedactionPolicyFull = "full"
+	// RedactionPolicyClientSafe 掩码密钥和凭据，删除原始请求头和响应体
+	RedactionPolicyClientSafe = "client-safe"
+
+	// redactionPlaceholder 默认替换内容
+	redactionPlaceholder = "***"
+	// minSecretLength 过短的匹配值不在其他字段中替换，避免误伤正常内容
+	minSecretLength = 4
+)
+
+var (
+	// ErrRedactionPolicyNotFound 策略不存在或不属于该工作空间
+	ErrRedactionPolicyNotFound = errors.New("脱敏策略不存在")
+	// ErrRedactionPolicyBuiltIn 内置策略不能修改
+	ErrRedactionPolicyBuiltIn = errors.New("内置脱敏策略不能修改")
+)
+
+// secretFields 敏感信息结果中保存匹配值的字段
+var secretFields = []string{"matches", "value"}
+
+// BuiltinRedactionPolicies 内置策略
+func BuiltinRedactionPolicies() []*models.RedactionPolicy {
+	return []*models.RedactionPolicy{
+		{
+			Name:        RedactionPolicyFull,
+			Description: "完整导出，不做脱敏",
+			BuiltIn:     true,
+		},
+		{
+			Name:        RedactionPolicyClientSafe,
+			Description: "掩码密钥和凭据，删除原始请求头和响应体",
+			DropFields: []string{
+				"headers", "raw_headers", "request_headers", "response_headers",
+				"request", "response", "raw_request", "raw_response", "body", "raw", "banner",
+			},
+			MaskFields: []models.RedactionMask{
+				// URL 中的用户名口令
+				{Field: "*", Pattern: `(?i)([a-z][a-z0-9+.-]*://[^/\s:@]+:)[^/\s@]+@`, Replacement: "${1}" + redactionPlaceholder + "@"},
+				// URL 参数中的令牌
+				{Field: "*", Pattern: `(?i)([?&](?:access_token|token|api_key|apikey|key|secret|password|passwd|pwd|auth|sig|signature)=)[^&#\s"']+`, Replacement: "${1}" + redactionPlaceholder},
+			},
+			MaskSecrets: true,
+			BuiltIn:     true,
+		},
+	}
+}
+
+// BuiltinRedactionPolicy 按名称获取内置策略
+func BuiltinRedactionPolicy(name string) *models.RedactionPolicy {
+	for _, policy := range BuiltinRedactionPolicies() {
+		if policy.Name == name {
+			return policy
+		}
+	}
+	return nil
+}
+
+// ValidateRedactionPolicy 保存时校验名称、字段和正则
+func ValidateRedactionPolicy(policy *models.RedactionPolicy) error {
+	name := strings.TrimSpace(policy.Name)
+	if name == "" {
+		return errors.New("策略名称不能为空")
+	}
+	if BuiltinRedactionPolicy(name) != nil {
+		return fmt.Errorf("策略名称 %s 与内置策略重复", name)
+	}
+	policy.Name = name
+	for _, field := range policy.DropFields {
+		if strings.TrimSpace(field) == "" || field == "*" {
+			return errors.New("删除字段不能为空或 *")
+		}
+	}
+	for _, mask := range policy.MaskFields {
+		if strings.TrimSpace(mask.Field) == "" {
+			return errors.New("掩码字段不能为空")
+		}
+		if mask.Field == "*" && mask.Pattern == "" {
+			return errors.New("对所有字段掩码时必须指定正则")
+		}
+		if mask.Pattern != "" {
+			if _, err := regexp.Compile(mask.Pattern); err != nil {
+				return fmt.Errorf("字段 %s 的掩码正则无效: %v", mask.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// compiledMask 编译后的掩码规则
+type compiledMask struct {
+	path        []string
+	all         bool
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Redactor 按策略逐条处理结果
+// 同一次导出共用一个 Redactor，已见过的匹配值在之后的结果中继续替换
+type Redactor struct {
+	policy  *models.RedactionPolicy
+	drop    [][]string
+	masks   []compiledMask
+	exclude map[models.ResultType]bool
+
+	secrets map[string]bool
+	ordered []string // 按长度降序，先替换长的，避免短值截断长值
+}
+
+// NewRedactor 编译策略
+func NewRedactor(policy *models.RedactionPolicy) (*Redactor, error) {
+	r := &Redactor{
+		policy:  policy,
+		exclude: make(map[models.ResultType]bool),
+		secrets: make(map[string]bool),
+	}
+	for _, field := range policy.DropFields {
+		r.drop = append(r.drop, strings.Split(field, "."))
+	}
+	for _, mask := range policy.MaskFields {
+		cm := compiledMask{all: mask.Field == "*", replacement: mask.Replacement}
+		if !cm.all {
+			cm.path = strings.Split(mask.Field, ".")
+		}
+		if cm.replacement == "" {
+			cm.replacement = redactionPlaceholder
+		}
+		if mask.Pattern != "" {
+			pattern, err := regexp.Compile(mask.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("字段 %s 的掩码正则无效: %v", mask.Field, err)
+			}
+			cm.pattern = pattern
+		}
+		r.masks = append(r.masks, cm)
+	}
+	for _, t := range policy.ExcludeTypes {
+		r.exclude[t] = true
+	}
+	return r, nil
+}
+
+// Policy 使用的策略
+func (r *Redactor) Policy() *models.RedactionPolicy {
+	return r.policy
+}
+
+// SecretValues 结果中需要在所有字段中掩码的匹配值
+func SecretValues(result *models.ScanResult) []string {
+	if result.Type != models.ResultTypeSensitive {
+		return nil
+	}
+	var values []string
+	for _, field := range secretFields {
+		walkStrings(result.Data[field], func(s string) string {
+			values = append(values, s)
+			return s
+		})
+	}
+	return values
+}
+
+// AddSecrets 添加需要掩码的值，同时掩码其 URL 编码和 Base64 形式
+func (r *Redactor) AddSecrets(values ...string) {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < minSecretLength {
+			continue
+		}
+		for _, variant := range []string{
+			v,
+			url.QueryEscape(v),
+			url.PathEscape(v),
+			base64.StdEncoding.EncodeToString([]byte(v)),
+			base64.RawStdEncoding.EncodeToString([]byte(v)),
+			base64.RawURLEncoding.EncodeToString([]byte(v)),
+		} {
+			if !r.secrets[variant] {
+				r.secrets[variant] = true
+				r.ordered = append(r.ordered, variant)
+			}
+		}
+	}
+	sort.SliceStable(r.ordered, func(i, j int) bool { return len(r.ordered[i]) > len(r.ordered[j]) })
+}
+
+// Redact 原地处理一条结果，返回 false 表示该结果不导出
+func (r *Redactor) Redact(result *models.ScanResult) bool {
+	if r.exclude[result.Type] {
+		return false
+	}
+	if result.Data == nil {
+		return true
+	}
+
+	if r.policy.MaskSecrets {
+		// 先替换匹配值，再执行字段规则，避免正则部分改写后匹配值不再能被识别
+		r.AddSecrets(SecretValues(result)...)
+		for _, field := range secretFields {
+			if v, ok := result.Data[field]; ok && result.Type == models.ResultTypeSensitive {
+				result.Data[field] = walkStrings(v, func(string) string { return redactionPlaceholder })
+			}
+		}
+		if len(r.ordered) > 0 {
+			for k, v := range result.Data {
+				result.Data[k] = walkStrings(v, r.replaceSecrets)
+			}
+			for i, tag := range result.Tags {
+				result.Tags[i] = r.replaceSecrets(tag)
+			}
+		}
+	}
+
+	for _, path := range r.drop {
+		deletePath(result.Data, path)
+	}
+
+	for _, mask := range r.masks {
+		mask := mask
+		apply := func(s string) string {
+			if mask.pattern == nil {
+				return mask.replacement
+			}
+			return mask.pattern.ReplaceAllString(s, mask.replacement)
+		}
+		if mask.all {
+			for k, v := range result.Data {
+				result.Data[k] = walkStrings(v, apply)
+			}
+			continue
+		}
+		updatePath(result.Data, mask.path, func(v interface{}) interface{} {
+			if mask.pattern == nil {
+				if _, isString := v.(string); !isString && !isContainer(v) {
+					// 数字等非字符串值整体替换
+					return mask.replacement
+				}
+			}
+			return walkStrings(v, apply)
+		})
+	}
+	return true
+}
+
+// RedactStrings 处理报告中的字符串（命令行参数、目标等），只应用匹配值和对所有字段的掩码
+func (r *Redactor) RedactStrings(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		if r.policy.MaskSecrets {
+			v = r.replaceSecrets(v)
+		}
+		for _, mask := range r.masks {
+			if mask.all && mask.pattern != nil {
+				v = mask.pattern.ReplaceAllString(v, mask.replacement)
+			}
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// replaceSecrets 替换字符串中出现的匹配值
+func (r *Redactor) replaceSecrets(s string) string {
+	for _, secret := range r.ordered {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, redactionPlaceholder)
+		}
+	}
+	return s
+}
+
+// walkStrings 对值中的所有字符串调用 f，返回替换后的值
+func walkStrings(v interface{}, f func(string) string) interface{} {
+	switch val := v.(type) {
+	case string:
+		return f(val)
+	case []string:
+		out := make([]string, len(val))
+		for i, s := range val {
+			out[i] = f(s)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = walkStrings(item, f)
+		}
+		return out
+	case primitive.A:
+		out := make(primitive.A, len(val))
+		for i, item := range val {
+			out[i] = walkStrings(item, f)
+		}
+		return out
+	case bson.M:
+		for k, item := range val {
+			val[k] = walkStrings(item, f)
+		}
+		return val
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = walkStrings(item, f)
+		}
+		return val
+	case map[string]string:
+		for k, item := range val {
+			val[k] = f(item)
+		}
+		return val
+	case primitive.D:
+		for i := range val {
+			val[i].Value = walkStrings(val[i].Value, f)
+		}
+		return val
+	}
+	return v
+}
+
+// isContainer 是否为数组或文档
+func isContainer(v interface{}) bool {
+	switch v.(type) {
+	case []string, []interface{}, primitive.A, bson.M, map[string]interface{}, map[string]string, primitive.D:
+		return true
+	}
+	return false
+}
+
+// asDocument 将嵌套文档统一为 map
+func asDocument(v interface{}) (map[string]interface{}, bool) {
+	switch val := v.(type) {
+	case bson.M:
+		return val, true
+	case map[string]interface{}:
+		return val, true
+	}
+	return nil, false
+}
+
+// deletePath 删除嵌套字段
+func deletePath(doc map[string]interface{}, path []string) {
+	for i, key := range path {
+		if i == len(path)-1 {
+			delete(doc, key)
+			return
+		}
+		next, ok := asDocument(doc[key])
+		if !ok {
+			if d, isD := doc[key].(primitive.D); isD {
+				doc[key] = deleteFromD(d, path[i+1:])
+			}
+			return
+		}
+		doc = next
+	}
+}
+
+// deleteFromD 删除 primitive.D 中的嵌套字段
+func deleteFromD(d primitive.D, path []string) primitive.D {
+	for i, e := range d {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(d[:i:i], d[i+1:]...)
+		}
+		if next, ok := asDocument(e.Value); ok {
+			deletePath(next, path[1:])
+		} else if nd, ok := e.Value.(primitive.D); ok {
+			d[i].Value = deleteFromD(nd, path[1:])
+		}
+	}
+	return d
+}
+
+// updatePath 替换嵌套字段的值，字段不存在时不处理
+func updatePath(doc map[string]interface{}, path []string, f func(interface{}) interface{}) {
+	for i, key := range path {
+		v, ok := doc[key]
+		if !ok {
+			return
+		}
+		if i == len(path)-1 {
+			doc[key] = f(v)
+			return
+		}
+		next, ok := asDocument(v)
+		if !ok {
+			if d, isD := v.(primitive.D); isD {
+				updateD(d, path[i+1:], f)
+			}
+			return
+		}
+		doc = next
+	}
+}
+
+// updateD 替换 primitive.D 中的嵌套字段
+func updateD(d primitive.D, path []string, f func(interface{}) interface{}) {
+	for i, e := range d {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			d[i].Value = f(e.Value)
+		} else if next, ok := asDocument(e.Value); ok {
+			updatePath(next, path[1:], f)
+		} else if nd, ok := e.Value.(primitive.D); ok {
+			updateD(nd, path[1:], f)
+		}
+	}
+}
+
+// RedactTaskReport 按策略处理任务报告中的目标和工具命令行
+func RedactTaskReport(report *TaskReport, redactor *Redactor) {
+	if redactor == nil {
+		return
+	}
+	report.RedactionPolicy = redactor.Policy().Name
+	if report.Task != nil {
+		task := *report.Task
+		task.Targets = redactor.RedactStrings(task.Targets)
+		report.Task = &task
+	}
+	for i, run := range report.Appendix.ToolRuns {
+		redacted := *run
+		redacted.Args = redactor.RedactStrings(run.Args)
+		if run.Stderr != "" {
+			redacted.Stderr = redactor.RedactStrings([]string{run.Stderr})[0]
+		}
+		report.Appendix.ToolRuns[i] = &redacted
+	}
+}
+
+// RedactionService 脱敏策略服务
+type RedactionService struct {
+	collection    *mongo.Collection
+	resultService *ResultService
+	taskService   *TaskService
+}
+
+// NewRedactionService 创建脱敏策略服务
+func NewRedactionService() *RedactionService {
+	return &RedactionService{
+		collection:    database.GetCollection(models.CollectionRedactionPolicies),
+		resultService: NewResultService(),
+		taskService:   NewTaskService(),
+	}
+}
+
+// ListRedactionPolicies 列出内置策略和工作空间的策略
+func (s *RedactionService) ListRedactionPolicies(workspaceID, userID primitive.ObjectID, role string) ([]*models.RedactionPolicy, error) {
+	if err := s.resultService.AuthorizeWorkspace(workspaceID, userID, role); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"workspace_id": workspaceID}, opts)
+	if err != nil {
+		return nil, errors.New("查询脱敏策略失败")
+	}
+	defer cursor.Close(ctx)
+
+	var policies []*models.RedactionPolicy
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, errors.New("查询脱敏策略失败")
+	}
+	return append(BuiltinRedactionPolicies(), policies...), nil
+}
+
+// GetRedactionPolicy 获取策略详情
+func (s *RedactionService) GetRedactionPolicy(id string, userID primitive.ObjectID, role string) (*models.RedactionPolicy, error) {
+	if policy := BuiltinRedactionPolicy(id); policy != nil {
+		return policy, nil
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrRedactionPolicyNotFound
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	var policy models.RedactionPolicy
+	if err := s.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&policy); err != nil {
+		return nil, ErrRedactionPolicyNotFound
+	}
+	if err := s.resultService.AuthorizeWorkspace(policy.WorkspaceID, userID, role); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// CreateRedactionPolicy 创建策略，同一工作空间内名称唯一
+func (s *RedactionService) CreateRedactionPolicy(policy *models.RedactionPolicy, userID primitive.ObjectID, role string) error {
+	if err := ValidateRedactionPolicy(policy); err != nil {
+		return err
+	}
+	if err := s.resultService.AuthorizeWorkspaceEdit(policy.WorkspaceID, userID, role); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	count, err := s.collection.CountDocuments(ctx, bson.M{"workspace_id": policy.WorkspaceID, "name": policy.Name})
+	if err != nil {
+		return errors.New("保存脱敏策略失败")
+	}
+	if count > 0 {
+		return errors.New("策略名称已存在")
+	}
+
+	policy.ID = primitive.NewObjectID()
+	policy.BuiltIn = false
+	policy.CreatedBy = userID
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = time.Now()
+	if _, err := s.collection.InsertOne(ctx, policy); err != nil {
+		return errors.New("保存脱敏策略失败")
+	}
+	return nil
+}
+
+// UpdateRedactionPolicy 更新策略的规则，工作空间不可修改
+func (s *RedactionService) UpdateRedactionPolicy(id string, update *models.RedactionPolicy, userID primitive.ObjectID, role string) (*models.RedactionPolicy, error) {
+	if BuiltinRedactionPolicy(id) != nil {
+		return nil, ErrRedactionPolicyBuiltIn
+	}
+	policy, err := s.GetRedactionPolicy(id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.resultService.AuthorizeWorkspaceEdit(policy.WorkspaceID, userID, role); err != nil {
+		return nil, err
+	}
+	if err := ValidateRedactionPolicy(update); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	if update.Name != policy.Name {
+		count, err := s.collection.CountDocuments(ctx, bson.M{"workspace_id": policy.WorkspaceID, "name": update.Name, "_id": bson.M{"$ne": policy.ID}})
+		if err != nil {
+			return nil, errors.New("更新脱敏策略失败")
+		}
+		if count > 0 {
+			return nil, errors.New("策略名称已存在")
+		}
+	}
+
+	policy.Name = update.Name
+	policy.Description = update.Description
+	policy.DropFields = update.DropFields
+	policy.MaskFields = update.MaskFields
+	policy.ExcludeTypes = update.ExcludeTypes
+	policy.MaskSecrets = update.MaskSecrets
+	policy.UpdatedAt = time.Now()
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": policy.ID}, policy); err != nil {
+		return nil, errors.New("更新脱敏策略失败")
+	}
+	return policy, nil
+}
+
+// DeleteRedactionPolicy 删除策略
+func (s *RedactionService) DeleteRedactionPolicy(id string, userID primitive.ObjectID, role string) error {
+	if BuiltinRedactionPolicy(id) != nil {
+		return ErrRedactionPolicyBuiltIn
+	}
+	policy, err := s.GetRedactionPolicy(id, userID, role)
+	if err != nil {
+		return err
+	}
+	if err := s.resultService.AuthorizeWorkspaceEdit(policy.WorkspaceID, userID, role); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": policy.ID}); err != nil {
+		return errors.New("删除脱敏策略失败")
+	}
+	return nil
+}
+
+// resolvePolicy 按内置名称、ID 或名称查找工作空间的策略
+func (s *RedactionService) resolvePolicy(ref string, workspaceID primitive.ObjectID) (*models.RedactionPolicy, error) {
+	if policy := BuiltinRedactionPolicy(ref); policy != nil {
+		return policy, nil
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	filter := bson.M{"workspace_id": workspaceID, "name": ref}
+	if objID, err := primitive.ObjectIDFromHex(ref); err == nil {
+		filter = bson.M{"workspace_id": workspaceID, "_id": objID}
+	}
+	var policy models.RedactionPolicy
+	if err := s.collection.FindOne(ctx, filter).Decode(&policy); err != nil {
+		return nil, ErrRedactionPolicyNotFound
+	}
+	return &policy, nil
+}
+
+// TaskRedactor 为任务的导出或报告创建 Redactor，未指定策略时返回 nil
+// 策略必须是内置策略或任务所在工作空间的策略；开启 mask_secrets 时预先加载任务的全部匹配值，
+// 这样排在敏感信息结果之前导出的证据、URL 也能被掩码
+func (s *RedactionService) TaskRedactor(taskID, ref string, userID primitive.ObjectID, role string) (*Redactor, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	task, err := s.taskService.GetTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.resultService.AuthorizeWorkspace(task.WorkspaceID, userID, role); err != nil {
+		return nil, err
+	}
+	policy, err := s.resolvePolicy(ref, task.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := NewRedactor(policy)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaskSecrets {
+		if err := s.loadTaskSecrets(task.ID, redactor); err != nil {
+			return nil, err
+		}
+	}
+	return redactor, nil
+}
+
+// WorkspaceRedactor 为工作空间范围的导出创建 Redactor，未指定策略时返回 nil，调用方需先校验工作空间权限
+// 工作空间导出不预先加载各任务的匹配值，开启 mask_secrets 的策略只能按任务导出
+func (s *RedactionService) WorkspaceRedactor(workspaceID primitive.ObjectID, ref string) (*Redactor, error) {
+	if ref == "" {
+		return nil, nil
+	}
+	policy, err := s.resolvePolicy(ref, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaskSecrets {
+		return nil, errors.New("该脱敏策略需要掩码敏感信息匹配值，请按任务导出")
+	}
+	return NewRedactor(policy)
+}
+
+// loadTaskSecrets 加载任务敏感信息结果中的匹配值，只读取匹配值字段
+func (s *RedactionService) loadTaskSecrets(taskID primitive.ObjectID, redactor *Redactor) error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	projection := bson.M{"type": 1}
+	for _, field := range secretFields {
+		projection["data."+field] = 1
+	}
+	cursor, err := s.resultService.collection.Find(ctx,
+		bson.M{"task_id": taskID, "type": models.ResultTypeSensitive},
+		options.Find().SetProjection(projection))
+	if err != nil {
+		return errors.New("加载敏感信息失败")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var result models.ScanResult
+		if err := cursor.Decode(&result); err != nil {
+			continue
+		}
+		redactor.AddSecrets(SecretValues(&result)...)
+	}
+	return cursor.Err()
+}
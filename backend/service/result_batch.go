@@ -0,0 +1,220 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 结果批量入库
+// 执行器在同一个协程里读取流水线结果并逐条写入 Mongo，数据库变慢时结果通道和各模块通道会依次填满，
+// 上游模块被阻塞后触发各自的超时。结果先累积到 N 条或等待 T 时间，再用一次有序的 BulkWrite 写入
+
+const (
+	// DefaultResultBatchSize 每批最多写入的结果数
+	DefaultResultBatchSize = 100
+	// DefaultResultBatchInterval 结果最长等待时间，超过后不满一批也写入
+	DefaultResultBatchInterval = 500 * time.Millisecond
+)
+
+// ResultWrite 一条待写入的结果
+type ResultWrite struct {
+	Result *models.ScanResult
+	Dedup  bool        // 按 DedupFilter 合并到已有结果（upsert），否则直接插入
+	Source interface{} // 对应的流水线结果，写入成功后用于断点等记录
+}
+
+// ResultWriteOutcome 单条结果的写入情况
+type ResultWriteOutcome struct {
+	Merged bool // 与已有结果合并（仅 Dedup）
+	Err    error
+}
+
+// ResultBulkWriter 批量写入结果，按 writes 的顺序返回每条的写入情况
+type ResultBulkWriter interface {
+	BulkWriteResults(writes []ResultWrite) ([]ResultWriteOutcome, error)
+}
+
+// ResultWriteModels 构建 BulkWrite 的写入模型，顺序与 writes 一致：
+// 去重的结果为 upsert 的 UpdateOne，其他结果为 InsertOne（预先分配 _id）
+func ResultWriteModels(writes []ResultWrite, now time.Time) []mongo.WriteModel {
+	writeModels := make([]mongo.WriteModel, 0, len(writes))
+	for _, w := range writes {
+		result := w.Result
+		result.UpdatedAt = now
+		if w.Dedup {
+			filter := DedupFilter(result)
+			writeModels = append(writeModels, mongo.NewUpdateOneModel().
+				SetFilter(filter).
+				SetUpdate(DedupUpdate(result)).
+				SetUpsert(true))
+			continue
+		}
+		result.CreatedAt = now
+		if result.ID.IsZero() {
+			result.ID = primitive.NewObjectID()
+		}
+		writeModels = append(writeModels, mongo.NewInsertOneModel().SetDocument(result))
+	}
+	return writeModels
+}
+
+// BulkWriteResults 用有序的 BulkWrite 写入结果，同一去重键的多次 upsert 按顺序合并；
+// 单条写入失败时跳过该条，继续写入之后的结果
+func (s *ResultService) BulkWriteResults(writes []ResultWrite) ([]ResultWriteOutcome, error) {
+	outcomes := make([]ResultWriteOutcome, len(writes))
+	for start := 0; start < len(writes); {
+		batch := writes[start:]
+		ctx, cancel := database.NewContext()
+		res, err := s.collection.BulkWrite(ctx, ResultWriteModels(batch, time.Now()), options.BulkWrite().SetOrdered(true))
+		cancel()
+
+		// 有序写入在第一个出错的位置停止，之前的都已写入
+		done := len(batch)
+		if err != nil {
+			var bulkErr mongo.BulkWriteException
+			if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+				for i := range batch {
+					outcomes[start+i].Err = err
+				}
+				return outcomes, err
+			}
+			done = bulkErr.WriteErrors[0].Index
+			outcomes[start+done].Err = bulkErr.WriteErrors[0]
+		}
+		for i := 0; i < done; i++ {
+			if !batch[i].Dedup || res == nil {
+				continue
+			}
+			if id, upserted := res.UpsertedIDs[int64(i)]; upserted {
+				if oid, ok := id.(primitive.ObjectID); ok {
+					batch[i].Result.ID = oid
+				}
+			} else {
+				outcomes[start+i].Merged = true
+			}
+		}
+		start += done + 1
+	}
+	return outcomes, nil
+}
+
+// isStoreDedupType 按 URL、主机去重入库的结果类型，合并时计入丢弃统计
+func isStoreDedupType(t models.ResultType) bool {
+	switch t {
+	case models.ResultTypeService, models.ResultTypeURL, models.ResultTypeCrawler, models.ResultTypeDirScan:
+		return true
+	}
+	return false
+}
+
+// storeWithDedup 结果是否按去重键合并入库：Web 服务和 URL 类结果始终合并；
+// 断点续扫时重放的、重新扫描的子域名、端口、漏洞和敏感信息可能已入库，也合并到原结果
+func storeWithDedup(t models.ResultType, resume bool) bool {
+	if isStoreDedupType(t) {
+		return true
+	}
+	switch t {
+	case models.ResultTypeSubdomain, models.ResultTypePort, models.ResultTypeVuln, models.ResultTypeSensitive:
+		return resume
+	}
+	return false
+}
+
+// ResultBatcher 累积结果，达到批量大小或最早的结果等待超过间隔时批量写入
+// 不是并发安全的，由执行器的结果协程调用
+type ResultBatcher struct {
+	writer   ResultBulkWriter
+	size     int
+	interval time.Duration
+	onSaved  func(w ResultWrite, merged bool)
+	onFlush  func() // 每批结果写入后调用，时间线等附属记录随结果批量写入
+
+	pending []ResultWrite
+	oldest  time.Time
+}
+
+// NewResultBatcher 创建结果批量写入器，size、interval 为 0 时使用默认值；
+// onSaved 在每条结果写入成功后按原顺序调用
+func NewResultBatcher(writer ResultBulkWriter, size int, interval time.Duration, onSaved func(w ResultWrite, merged bool)) *ResultBatcher {
+	if size <= 0 {
+		size = DefaultResultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultResultBatchInterval
+	}
+	return &ResultBatcher{
+		writer:   writer,
+		size:     size,
+		interval: interval,
+		onSaved:  onSaved,
+	}
+}
+
+// SetOnFlush 设置每批结果写入（并调用完 onSaved）后的回调
+func (b *ResultBatcher) SetOnFlush(onFlush func()) {
+	b.onFlush = onFlush
+}
+
+// Interval 最长等待时间，调用方按该间隔调用 FlushDue
+func (b *ResultBatcher) Interval() time.Duration {
+	return b.interval
+}
+
+// Pending 等待写入的结果数
+func (b *ResultBatcher) Pending() int {
+	return len(b.pending)
+}
+
+// Add 加入一条结果，达到批量大小时立即写入
+func (b *ResultBatcher) Add(w ResultWrite) {
+	if len(b.pending) == 0 {
+		b.oldest = time.Now()
+	}
+	b.pending = append(b.pending, w)
+	if len(b.pending) >= b.size {
+		b.Flush()
+	}
+}
+
+// FlushDue 最早的结果等待超过间隔时写入
+func (b *ResultBatcher) FlushDue(now time.Time) {
+	if len(b.pending) > 0 && now.Sub(b.oldest) >= b.interval {
+		b.Flush()
+	}
+}
+
+// Flush 写入全部等待的结果
+func (b *ResultBatcher) Flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+	writes := b.pending
+	b.pending = nil
+
+	outcomes, err := b.writer.BulkWriteResults(writes)
+	if err != nil {
+		log.Printf("[ResultBatcher] Failed to save %d results: %v", len(writes), err)
+	}
+	for i, w := range writes {
+		if i >= len(outcomes) || outcomes[i].Err != nil {
+			if i < len(outcomes) && err == nil {
+				log.Printf("[ResultBatcher] Failed to save result: %v", outcomes[i].Err)
+			}
+			continue
+		}
+		if b.onSaved != nil {
+			b.onSaved(w, outcomes[i].Merged)
+		}
+	}
+	if b.onFlush != nil {
+		b.onFlush()
+	}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 任务结果比较
+// 对同一目标的周期性扫描，比较前后两次任务"新增了什么、消失了什么"：
+// 按与 CreateResultWithDedup 相同的去重键（子域名、ip:port、Web 服务 host、标准化 URL、漏洞 ID + 目标）匹配两次的结果，
+// 两边都有但状态码、标题、技术栈或端口服务不同的记为变化
+
+// DefaultDiffTypes 未指定类型时比较的结果类型
+var DefaultDiffTypes = []models.ResultType{
+	models.ResultTypeSubdomain,
+	models.ResultTypePort,
+	models.ResultTypeService,
+	models.ResultTypeURL,
+	models.ResultTypeCrawler,
+	models.ResultTypeDirScan,
+	models.ResultTypeVuln,
+}
+
+// diffFields 判断变化时比较的字段
+var diffFields = []string{"status_code", "title", "technologies", "service"}
+
+// ResultDiffItem 一条新增、消失或变化的结果
+type ResultDiffItem struct {
+	Key           string                 `json:"key"`
+	ResultID      primitive.ObjectID     `json:"result_id"`                // 任务 B 中的结果，消失的为任务 A 中的结果
+	Data          map[string]interface{} `json:"data,omitempty"`           // 新增、消失的结果数据
+	ChangedFields []string               `json:"changed_fields,omitempty"` // 变化的字段
+	Before        map[string]interface{} `json:"before,omitempty"`         // 变化字段在任务 A 中的值
+	After         map[string]interface{} `json:"after,omitempty"`          // 变化字段在任务 B 中的值
+}
+
+// ResultTypeDiff 一种结果类型的比较结果
+type ResultTypeDiff struct {
+	Type      models.ResultType `json:"type"`
+	Added     []ResultDiffItem  `json:"added"`
+	Removed   []ResultDiffItem  `json:"removed"`
+	Changed   []ResultDiffItem  `json:"changed"`
+	Unchanged int               `json:"unchanged"`
+}
+
+// ResultDiffCounts 比较结果的数量
+type ResultDiffCounts struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// TaskResultDiff 两个任务的结果比较，任务 A 为之前的任务
+type TaskResultDiff struct {
+	TaskA  string                                 `json:"task_a"`
+	TaskB  string                                 `json:"task_b"`
+	Types  []*ResultTypeDiff                      `json:"types"`
+	Counts map[models.ResultType]ResultDiffCounts `json:"counts"`
+	Total  ResultDiffCounts                       `json:"total"`
+}
+
+// ResultDiffKey 结果的去重键，与 DedupFilter 的去重条件一致；结果没有去重字段时使用结果 ID
+func ResultDiffKey(result *models.ScanResult) string {
+	data := make(map[string]interface{}, len(result.Data))
+	for k, v := range result.Data {
+		data[k] = v
+	}
+	filter := DedupFilter(&models.ScanResult{Type: result.Type, Data: data})
+
+	var parts []string
+	for field, value := range filter {
+		if !strings.HasPrefix(field, "data.") {
+			continue
+		}
+		// 方法条件为 {$in: ["", "GET", nil]}，即 GET
+		if _, ok := value.(bson.M); ok {
+			value = "GET"
+		}
+		parts = append(parts, strings.TrimPrefix(field, "data.")+"="+diffScalar(value))
+	}
+	if len(parts) == 0 {
+		return "id=" + result.ID.Hex()
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// DiffTaskResults 比较两组结果，types 为空时比较 DefaultDiffTypes
+func DiffTaskResults(a, b []*models.ScanResult, types []models.ResultType) *TaskResultDiff {
+	if len(types) == 0 {
+		types = DefaultDiffTypes
+	}
+	diff := &TaskResultDiff{Types: []*ResultTypeDiff{}, Counts: make(map[models.ResultType]ResultDiffCounts)}
+	for _, t := range types {
+		before := indexDiffResults(a, t)
+		after := indexDiffResults(b, t)
+		typeDiff := &ResultTypeDiff{Type: t, Added: []ResultDiffItem{}, Removed: []ResultDiffItem{}, Changed: []ResultDiffItem{}}
+
+		for key, r := range after {
+			prev, ok := before[key]
+			if !ok {
+				typeDiff.Added = append(typeDiff.Added, ResultDiffItem{Key: key, ResultID: r.ID, Data: r.Data})
+				continue
+			}
+			if item, changed := diffResultFields(key, prev, r); changed {
+				typeDiff.Changed = append(typeDiff.Changed, item)
+			} else {
+				typeDiff.Unchanged++
+			}
+		}
+		for key, r := range before {
+			if _, ok := after[key]; !ok {
+				typeDiff.Removed = append(typeDiff.Removed, ResultDiffItem{Key: key, ResultID: r.ID, Data: r.Data})
+			}
+		}
+		for _, items := range [][]ResultDiffItem{typeDiff.Added, typeDiff.Removed, typeDiff.Changed} {
+			sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+		}
+
+		counts := ResultDiffCounts{
+			Added:     len(typeDiff.Added),
+			Removed:   len(typeDiff.Removed),
+			Changed:   len(typeDiff.Changed),
+			Unchanged: typeDiff.Unchanged,
+		}
+		diff.Types = append(diff.Types, typeDiff)
+		diff.Counts[t] = counts
+		diff.Total.Added += counts.Added
+		diff.Total.Removed += counts.Removed
+		diff.Total.Changed += counts.Changed
+		diff.Total.Unchanged += counts.Unchanged
+	}
+	return diff
+}
+
+// Summary 通知中的比较摘要，没有变化时返回空字符串
+func (d *TaskResultDiff) Summary() string {
+	if d == nil || d.Total.Added+d.Total.Removed+d.Total.Changed == 0 {
+		return ""
+	}
+	lines := []string{fmt.Sprintf("与上次扫描相比: 新增 %d，消失 %d，变化 %d", d.Total.Added, d.Total.Removed, d.Total.Changed)}
+	for _, t := range d.Types {
+		c := d.Counts[t.Type]
+		if c.Added+c.Removed+c.Changed == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- %s: +%d / -%d / ~%d", t.Type, c.Added, c.Removed, c.Changed))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indexDiffResults 按去重键索引一种类型的结果，同一键的多条结果取最后一条
+func indexDiffResults(results []*models.ScanResult, t models.ResultType) map[string]*models.ScanResult {
+	index := make(map[string]*models.ScanResult)
+	for _, r := range results {
+		if r.Type == t {
+			index[ResultDiffKey(r)] = r
+		}
+	}
+	return index
+}
+
+// diffResultFields 比较两条结果的 diffFields，任一方缺少的字段不比较
+func diffResultFields(key string, before, after *models.ScanResult) (ResultDiffItem, bool) {
+	item := ResultDiffItem{Key: key, ResultID: after.ID}
+	for _, field := range diffFields {
+		old, ok1 := before.Data[field]
+		cur, ok2 := after.Data[field]
+		if !ok1 || !ok2 || diffValue(field, old) == diffValue(field, cur) {
+			continue
+		}
+		if item.Before == nil {
+			item.Before = make(map[string]interface{})
+			item.After = make(map[string]interface{})
+		}
+		item.ChangedFields = append(item.ChangedFields, field)
+		item.Before[field] = old
+		item.After[field] = cur
+	}
+	return item, len(item.ChangedFields) > 0
+}
+
+// diffValue 字段的比较形式：数字不区分 int32/int64/float64，技术栈不区分顺序和大小写
+func diffValue(field string, v interface{}) string {
+	if field == "technologies" {
+		list := stringList(v)
+		for i := range list {
+			list[i] = strings.ToLower(strings.TrimSpace(list[i]))
+		}
+		sort.Strings(list)
+		return strings.Join(list, ",")
+	}
+	return diffScalar(v)
+}
+
+// diffScalar 标量值的字符串形式，数字统一为整数（去重键中的端口号同样适用）
+func diffScalar(v interface{}) string {
+	switch n := v.(type) {
+	case int:
+		return strconv.FormatInt(int64(n), 10)
+	case int32:
+		return strconv.FormatInt(int64(n), 10)
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case float64:
+		if n == float64(int64(n)) {
+			return strconv.FormatInt(int64(n), 10)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case string:
+		return strings.TrimSpace(n)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// DiffTasks 比较同一工作空间的两个任务的结果，taskA 为之前的任务
+func (s *ResultService) DiffTasks(taskA, taskB string, types []models.ResultType) (*TaskResultDiff, error) {
+	taskService := NewTaskService()
+	a, err := taskService.GetTaskByID(taskA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := taskService.GetTaskByID(taskB)
+	if err != nil {
+		return nil, err
+	}
+	if a.WorkspaceID != b.WorkspaceID {
+		return nil, errors.New("两个任务不属于同一工作空间")
+	}
+	if len(types) == 0 {
+		types = DefaultDiffTypes
+	}
+
+	before, err := s.diffResults(a.ID, types)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.diffResults(b.ID, types)
+	if err != nil {
+		return nil, err
+	}
+	diff := DiffTaskResults(before, after, types)
+	diff.TaskA = taskA
+	diff.TaskB = taskB
+	return diff, nil
+}
+
+// diffResults 读取任务中指定类型的全部结果
+func (s *ResultService) diffResults(taskID primitive.ObjectID, types []models.ResultType) ([]*models.ScanResult, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"task_id": taskID, "type": bson.M{"$in": types}})
+	if err != nil {
+		return nil, errors.New("查询任务结果失败")
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]*models.ScanResult, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, errors.New("解析任务结果失败")
+	}
+	return results, nil
+}
+
+// cruiseDiff 开启 NotifyDiff 的巡航任务与同一巡航上次完成的任务比较，其他任务返回 nil
+func (e *TaskExecutor) cruiseDiff(task *models.Task) *TaskResultDiff {
+	if !task.Config.NotifyDiff {
+		return nil
+	}
+	previous := e.taskService.PreviousCruiseTask(task)
+	if previous == nil {
+		return nil
+	}
+	diff, err := NewResultService().DiffTasks(previous.ID.Hex(), task.ID.Hex(), nil)
+	if err != nil {
+		log.Printf("[TaskExecutor] Failed to diff task %s with %s: %v", task.ID.Hex(), previous.ID.Hex(), err)
+		return nil
+	}
+	return diff
+}
+
+// PreviousCruiseTask 同一巡航在该任务之前最后一个完成的任务，任务不是由巡航创建或没有之前的任务时返回 nil
+func (s *TaskService) PreviousCruiseTask(task *models.Task) *models.Task {
+	if task.CruiseID.IsZero() {
+		return nil
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	var previous models.Task
+	err := database.GetCollection(models.CollectionTasks).FindOne(ctx,
+		bson.M{
+			"cruise_id":  task.CruiseID,
+			"_id":        bson.M{"$ne": task.ID},
+			"status":     models.TaskStatusCompleted,
+			"created_at": bson.M{"$lt": task.CreatedAt},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&previous)
+	if err != nil {
+		return nil
+	}
+	return &previous
+}
@@ -0,0 +1,482 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JSONL 流式导出
+// 每条结果输出为一行扁平的 JSON 对象，供外部脚本和数据仓库直接导入。字段顺序固定：
+//   id, task_id, workspace_id, type, source, created_at, tags，之后是结果类型的字段，缺少的字段输出 null
+// 各结果类型的字段（括号内为依次尝试的 Data 字段）：
+//   subdomain: subdomain(subdomain, full_domain, domain), domain, ips(ips, ip), cnames, title, status_code, web_server,
+//              technologies, cdn, cdn_name, url, alive, resolution
+//   port:      ip(ip, host), host, port, service, protocol, version, tls
+//   service:   url, host, ip, port, title, status_code, server, technologies, final_url, body_hash
+//   vuln:      vuln_id, name, severity, target, matched_at, description, reference
+//   url、crawler、dirscan: url, method, status_code(status_code, status), content_type, length(length, size)
+//   sensitive: target, url, sensitive_type(type), severity, confidence, location, total_matches, matches
+//   takeover:  subdomain, cname, provider, vulnerable, reason
+//   liveness:  ip, alive, method, evidence
+//   其他类型:  data（原始 Data）
+// 结果按 (created_at, id) 升序输出，中断后以最后一行的 created_at 和 id 作为 created_after、last_id 继续导出
+
+// JSONL 导出格式，ndjson 为同一格式的别名
+const (
+	ExportFormatJSONL  = "jsonl"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// jsonlBatchSize 每次从数据库读取的结果数
+const jsonlBatchSize = 500
+
+// jsonlFlushLines 每写出多少行刷新一次响应
+const jsonlFlushLines = 200
+
+// jsonlField JSONL 行中的字段，按顺序取第一个存在的 Data 字段
+type jsonlField struct {
+	name string
+	keys []string
+}
+
+func jsonlKey(name string, keys ...string) jsonlField {
+	if len(keys) == 0 {
+		keys = []string{name}
+	}
+	return jsonlField{name: name, keys: keys}
+}
+
+// jsonlURLFields URL、爬虫、目录扫描结果共用的字段
+var jsonlURLFields = []jsonlField{
+	jsonlKey("url"),
+	jsonlKey("method"),
+	jsonlKey("status_code", "status_code", "status"),
+	jsonlKey("content_type"),
+	jsonlKey("length", "length", "size"),
+}
+
+// jsonlFields 各结果类型输出的字段，未列出的类型输出原始 Data
+var jsonlFields = map[models.ResultType][]jsonlField{
+	models.ResultTypeSubdomain: {
+		jsonlKey("subdomain", "subdomain", "full_domain", "domain"),
+		jsonlKey("domain"),
+		jsonlKey("ips", "ips", "ip"),
+		jsonlKey("cnames"),
+		jsonlKey("title"),
+		jsonlKey("status_code"),
+		jsonlKey("web_server"),
+		jsonlKey("technologies"),
+		jsonlKey("cdn"),
+		jsonlKey("cdn_name"),
+		jsonlKey("url"),
+		jsonlKey("alive"),
+		jsonlKey("resolution"),
+	},
+	models.ResultTypePort: {
+		jsonlKey("ip", "ip", "host"),
+		jsonlKey("host"),
+		jsonlKey("port"),
+		jsonlKey("service"),
+		jsonlKey("protocol"),
+		jsonlKey("version"),
+		jsonlKey("tls"),
+	},
+	models.ResultTypeService: {
+		jsonlKey("url"),
+		jsonlKey("host"),
+		jsonlKey("ip"),
+		jsonlKey("port"),
+		jsonlKey("title"),
+		jsonlKey("status_code"),
+		jsonlKey("server"),
+		jsonlKey("technologies"),
+		jsonlKey("final_url"),
+		jsonlKey("body_hash"),
+	},
+	models.ResultTypeVuln: {
+		jsonlKey("vuln_id"),
+		jsonlKey("name"),
+		jsonlKey("severity"),
+		jsonlKey("target"),
+		jsonlKey("matched_at"),
+		jsonlKey("description"),
+		jsonlKey("reference"),
+	},
+	models.ResultTypeURL:     jsonlURLFields,
+	models.ResultTypeCrawler: jsonlURLFields,
+	models.ResultTypeDirScan: jsonlURLFields,
+	models.ResultTypeSensitive: {
+		jsonlKey("target"),
+		jsonlKey("url"),
+		jsonlKey("sensitive_type", "type"),
+		jsonlKey("severity"),
+		jsonlKey("confidence"),
+		jsonlKey("location"),
+		jsonlKey("total_matches"),
+		jsonlKey("matches"),
+	},
+	models.ResultTypeTakeover: {
+		jsonlKey("subdomain"),
+		jsonlKey("cname"),
+		jsonlKey("provider"),
+		jsonlKey("vulnerable"),
+		jsonlKey("reason"),
+	},
+	models.ResultTypeLiveness: {
+		jsonlKey("ip"),
+		jsonlKey("alive"),
+		jsonlKey("method"),
+		jsonlKey("evidence"),
+	},
+}
+
+// jsonlCommonFields 所有结果类型共有的字段
+var jsonlCommonFields = []string{"id", "task_id", "workspace_id", "type", "source", "created_at", "tags"}
+
+// JSONLFields 结果类型在 JSONL 行中的字段名，包括共有字段
+func JSONLFields(resultType models.ResultType) []string {
+	names := append([]string(nil), jsonlCommonFields...)
+	fields, ok := jsonlFields[resultType]
+	if !ok {
+		return append(names, "data")
+	}
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// JSONLCursor 续传位置：created_at 晚于 CreatedAfter，或等于 CreatedAfter 且 ID 大于 LastID
+type JSONLCursor struct {
+	CreatedAfter time.Time
+	LastID       primitive.ObjectID
+}
+
+// ParseJSONLCursor 解析 created_after（RFC3339）和 last_id 参数，都为空时返回零值
+func ParseJSONLCursor(createdAfter, lastID string) (JSONLCursor, error) {
+	var cursor JSONLCursor
+	if createdAfter != "" {
+		t, err := time.Parse(time.RFC3339Nano, createdAfter)
+		if err != nil {
+			return cursor, errors.New("created_after 格式无效，应为 RFC3339 时间")
+		}
+		cursor.CreatedAfter = t
+	}
+	if lastID != "" {
+		if cursor.CreatedAfter.IsZero() {
+			return cursor, errors.New("last_id 需要与 created_after 一起使用")
+		}
+		oid, err := primitive.ObjectIDFromHex(lastID)
+		if err != nil {
+			return cursor, errors.New("无效的 last_id")
+		}
+		cursor.LastID = oid
+	}
+	return cursor, nil
+}
+
+// JSONLExportQuery JSONL 导出的范围，TaskID、WorkspaceID 至少指定一个
+type JSONLExportQuery struct {
+	TaskID      primitive.ObjectID
+	WorkspaceID primitive.ObjectID
+	Types       []models.ResultType // 为空时导出全部类型
+	Cursor      JSONLCursor
+}
+
+// Filter 数据库查询条件
+func (q JSONLExportQuery) Filter() bson.M {
+	filter := bson.M{}
+	if !q.TaskID.IsZero() {
+		filter["task_id"] = q.TaskID
+	}
+	if !q.WorkspaceID.IsZero() {
+		filter["workspace_id"] = q.WorkspaceID
+	}
+	if len(q.Types) > 0 {
+		filter["type"] = bson.M{"$in": q.Types}
+	}
+	if after := q.Cursor.CreatedAfter; !after.IsZero() {
+		if q.Cursor.LastID.IsZero() {
+			filter["created_at"] = bson.M{"$gt": after}
+		} else {
+			filter["$or"] = []bson.M{
+				{"created_at": bson.M{"$gt": after}},
+				{"created_at": after, "_id": bson.M{"$gt": q.Cursor.LastID}},
+			}
+		}
+	}
+	return filter
+}
+
+// Match 在内存中判断结果是否在导出范围内，与 Filter 的条件一致
+func (q JSONLExportQuery) Match(result *models.ScanResult) bool {
+	if !q.TaskID.IsZero() && result.TaskID != q.TaskID {
+		return false
+	}
+	if !q.WorkspaceID.IsZero() && result.WorkspaceID != q.WorkspaceID {
+		return false
+	}
+	if len(q.Types) > 0 {
+		found := false
+		for _, t := range q.Types {
+			found = found || t == result.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if after := q.Cursor.CreatedAfter; !after.IsZero() {
+		created := result.CreatedAt.Truncate(time.Millisecond)
+		if created.Before(after) {
+			return false
+		}
+		if created.Equal(after) && (q.Cursor.LastID.IsZero() || bytes.Compare(result.ID[:], q.Cursor.LastID[:]) <= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// JSONLRecord 把结果渲染为一行 JSON（不含换行），字段顺序固定
+func JSONLRecord(result *models.ScanResult) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	n := 0
+	put := func(name string, value interface{}) error {
+		data, err := json.Marshal(jsonlValue(value))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		n++
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+		return nil
+	}
+
+	tags := result.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	common := []interface{}{result.ID, result.TaskID, result.WorkspaceID, string(result.Type), result.Source, result.CreatedAt, tags}
+	for i, name := range jsonlCommonFields {
+		if err := put(name, common[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, ok := jsonlFields[result.Type]
+	if !ok {
+		data := map[string]interface{}(result.Data)
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		if err := put("data", data); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range fields {
+		var value interface{}
+		for _, key := range f.keys {
+			if v, ok := result.Data[key]; ok && v != nil {
+				value = v
+				break
+			}
+		}
+		if err := put(f.name, value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonlValue 统一时间和 BSON 类型的表示：时间为毫秒精度的 UTC RFC3339，ObjectID 为十六进制
+func jsonlValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		if val.IsZero() {
+			return nil
+		}
+		return val.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano)
+	case primitive.DateTime:
+		return jsonlValue(val.Time())
+	case primitive.ObjectID:
+		if val.IsZero() {
+			return nil
+		}
+		return val.Hex()
+	case bson.M:
+		return jsonlMap(val)
+	case map[string]interface{}:
+		return jsonlMap(val)
+	case bson.D:
+		return jsonlMap(val.Map())
+	case primitive.A:
+		return jsonlSlice(val)
+	case []interface{}:
+		return jsonlSlice(val)
+	}
+	return v
+}
+
+func jsonlMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = jsonlValue(v)
+	}
+	return out
+}
+
+func jsonlSlice(values []interface{}) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = jsonlValue(v)
+	}
+	return out
+}
+
+// AcceptsGzip 请求的 Accept-Encoding 是否接受 gzip
+func AcceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding := strings.TrimSpace(part)
+		if i := strings.IndexByte(coding, ';'); i >= 0 {
+			if q := strings.TrimSpace(coding[i+1:]); q == "q=0" || q == "q=0.0" {
+				continue
+			}
+			coding = strings.TrimSpace(coding[:i])
+		}
+		if strings.EqualFold(coding, "gzip") || coding == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONLExporter 逐行写出 JSONL，每 jsonlFlushLines 行刷新一次，w 实现 http.Flusher 时同时刷新响应
+type JSONLExporter struct {
+	flusher http.Flusher
+	gz      *gzip.Writer
+	w       *bufio.Writer
+	count   int
+	last    *models.ScanResult
+}
+
+// NewJSONLExporter 创建 JSONL 导出器，compress 为 true 时以 gzip 压缩输出
+func NewJSONLExporter(w io.Writer, compress bool) *JSONLExporter {
+	e := &JSONLExporter{}
+	e.flusher, _ = w.(http.Flusher)
+	if compress {
+		e.gz = gzip.NewWriter(w)
+		w = e.gz
+	}
+	e.w = bufio.NewWriter(w)
+	return e
+}
+
+// Write 写出一条结果
+func (e *JSONLExporter) Write(result *models.ScanResult) error {
+	line, err := JSONLRecord(result)
+	if err != nil {
+		return err
+	}
+	e.w.Write(line)
+	if err := e.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	e.count++
+	e.last = result
+	if e.count%jsonlFlushLines == 0 {
+		return e.Flush()
+	}
+	return nil
+}
+
+// Flush 把已写出的行发送给客户端
+func (e *JSONLExporter) Flush() error {
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	if e.gz != nil {
+		if err := e.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return nil
+}
+
+// Count 已写出的结果数
+func (e *JSONLExporter) Count() int {
+	return e.count
+}
+
+// Cursor 从最后写出的结果之后继续导出的位置，没有写出结果时返回零值
+func (e *JSONLExporter) Cursor() JSONLCursor {
+	if e.last == nil {
+		return JSONLCursor{}
+	}
+	return JSONLCursor{CreatedAfter: e.last.CreatedAt.UTC().Truncate(time.Millisecond), LastID: e.last.ID}
+}
+
+// Close 结束导出
+func (e *JSONLExporter) Close() error {
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	if e.gz != nil {
+		return e.gz.Close()
+	}
+	return nil
+}
+
+// StreamJSONL 按 (created_at, _id) 升序读取导出范围内的结果，脱敏后交给 emit，返回导出的条数
+func (s *ResultService) StreamJSONL(ctx context.Context, query JSONLExportQuery, redactor *Redactor, emit func(*models.ScanResult) error) (int, error) {
+	if query.TaskID.IsZero() && query.WorkspaceID.IsZero() {
+		return 0, errors.New("请指定任务或工作空间")
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetBatchSize(jsonlBatchSize)
+	cursor, err := s.collection.Find(ctx, query.Filter(), opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var result models.ScanResult
+		if err := cursor.Decode(&result); err != nil {
+			return count, err
+		}
+		if redactor != nil && !redactor.Redact(&result) {
+			continue
+		}
+		if err := emit(&result); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"moongazing/models"
+	"moongazing/scanner/webscan"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 结果导出格式
+const (
+	ExportFormatJSON    = "json"
+	ExportFormatHTTPRaw = "http-raw" // 爬虫、目录扫描、URL 结果渲染为可重放的原始 HTTP 请求
+)
+
+// http-raw 导出的打包方式
+const (
+	RawLayoutZip    = "zip"    // 每个请求一个文件
+	RawLayoutConcat = "concat" // 所有请求写入一个文本，以分隔行隔开
+)
+
+// StateChangingMark 可能改变服务端状态的请求在文件名和分隔行中的标记
+const StateChangingMark = "STATE-CHANGING"
+
+// RawHTTPRequest 渲染后的原始 HTTP 请求
+type RawHTTPRequest struct {
+	Method        string
+	URL           string
+	StateChanging bool
+	Raw           string
+}
+
+// rawFileUnsafe 文件名中需要替换的字符
+var rawFileUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// RenderRawHTTPRequest 将 URL、爬虫、目录扫描结果渲染为原始 HTTP 请求，可直接导入 Burp 等工具
+// 其他类型的结果或没有有效 URL 时返回 false
+func RenderRawHTTPRequest(result *models.ScanResult) (*RawHTTPRequest, bool) {
+	switch result.Type {
+	case models.ResultTypeCrawler, models.ResultTypeDirScan, models.ResultTypeURL:
+	default:
+		return nil, false
+	}
+
+	rawURL, _ := result.Data["url"].(string)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, false
+	}
+
+	method, _ := result.Data["method"].(string)
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = "GET"
+	}
+	body, _ := result.Data["request_body"].(string)
+	headers := rawRequestHeaders(result.Data["request_headers"])
+
+	stateChanging, _ := result.Data["is_state_changing"].(bool)
+	if !stateChanging {
+		stateChanging = webscan.IsStateChanging(method, rawURL, body)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, u.RequestURI())
+	fmt.Fprintf(&b, "Host: %s\r\n", u.Host)
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		switch strings.ToLower(name) {
+		case "host", "content-length":
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, headers[name])
+	}
+	if body != "" || (method != "GET" && method != "HEAD") {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	}
+	b.WriteString("\r\n")
+	b.WriteString(body)
+
+	return &RawHTTPRequest{
+		Method:        method,
+		URL:           rawURL,
+		StateChanging: stateChanging,
+		Raw:           b.String(),
+	}, true
+}
+
+// rawRequestHeaders 读取保存的请求头（写入时为 map[string]string，从数据库读出为 bson.M）
+func rawRequestHeaders(v interface{}) map[string]string {
+	headers := make(map[string]string)
+	switch h := v.(type) {
+	case map[string]string:
+		for k, val := range h {
+			headers[k] = val
+		}
+	case bson.M:
+		for k, val := range h {
+			headers[k] = fmt.Sprint(val)
+		}
+	case primitive.D:
+		for _, e := range h {
+			headers[e.Key] = fmt.Sprint(e.Value)
+		}
+	case map[string]interface{}:
+		for k, val := range h {
+			headers[k] = fmt.Sprint(val)
+		}
+	}
+	return headers
+}
+
+// RawHTTPExporter 逐条写出 http-raw 导出内容
+type RawHTTPExporter struct {
+	layout string
+	w      *bufio.Writer
+	zw     *zip.Writer
+	count  int
+}
+
+// NewRawHTTPExporter 创建 http-raw 导出器，layout 为 zip 或 concat
+func NewRawHTTPExporter(w io.Writer, layout string) *RawHTTPExporter {
+	e := &RawHTTPExporter{layout: layout}
+	if layout == RawLayoutConcat {
+		e.w = bufio.NewWriter(w)
+	} else {
+		e.layout = RawLayoutZip
+		e.zw = zip.NewWriter(w)
+	}
+	return e
+}
+
+// Layout 打包方式
+func (e *RawHTTPExporter) Layout() string {
+	return e.layout
+}
+
+// Write 写出一条结果，不能渲染为请求的结果跳过并返回 false
+func (e *RawHTTPExporter) Write(result *models.ScanResult) (bool, error) {
+	req, ok := RenderRawHTTPRequest(result)
+	if !ok {
+		return false, nil
+	}
+	e.count++
+
+	if e.zw != nil {
+		f, err := e.zw.Create(e.fileName(req))
+		if err != nil {
+			return false, err
+		}
+		_, err = io.WriteString(f, req.Raw)
+		return err == nil, err
+	}
+
+	mark := ""
+	if req.StateChanging {
+		mark = " [" + StateChangingMark + "]"
+	}
+	if e.count > 1 {
+		e.w.WriteString("\r\n\r\n")
+	}
+	fmt.Fprintf(e.w, "### %d%s %s %s\r\n", e.count, mark, req.Method, req.URL)
+	_, err := e.w.WriteString(req.Raw)
+	return err == nil, err
+}
+
+// Count 已写出的请求数
+func (e *RawHTTPExporter) Count() int {
+	return e.count
+}
+
+// Close 结束导出
+func (e *RawHTTPExporter) Close() error {
+	if e.zw != nil {
+		return e.zw.Close()
+	}
+	return e.w.Flush()
+}
+
+// fileName 压缩包中的文件名：序号_[STATE-CHANGING_]方法_主机路径.http
+func (e *RawHTTPExporter) fileName(req *RawHTTPRequest) string {
+	name := req.URL
+	if u, err := url.Parse(req.URL); err == nil {
+		name = u.Host + u.Path
+	}
+	name = strings.Trim(rawFileUnsafe.ReplaceAllString(name, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+
+	prefix := fmt.Sprintf("%04d_", e.count)
+	if req.StateChanging {
+		prefix += StateChangingMark + "_"
+	}
+	return prefix + req.Method + "_" + name + ".http"
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 表格导出
+// 按结果类型把 Data 中的字段展开为固定的列，逐行写出 CSV 或 XLSX，不在内存中保留结果。
+// XLSX 使用内联字符串，每种结果类型一个工作表，工作表在写出第一行时才创建
+
+// 表格导出格式
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// xlsxMaxRows Excel 单个工作表的行数上限（含表头）
+const xlsxMaxRows = 1048576
+
+// ErrTableExportType 结果类型不支持表格导出
+var ErrTableExportType = errors.New("该结果类型不支持导出为表格")
+
+// ErrCSVNeedsType CSV 只能导出一种结果类型
+var ErrCSVNeedsType = errors.New("CSV 导出需要指定结果类型")
+
+// tableColumn 表格列：表头和取值
+type tableColumn struct {
+	header string
+	value  func(result *models.ScanResult) string
+}
+
+// dataColumn 按顺序取第一个非空的 Data 字段
+func dataColumn(header string, keys ...string) tableColumn {
+	if len(keys) == 0 {
+		keys = []string{header}
+	}
+	return tableColumn{header: header, value: func(result *models.ScanResult) string {
+		for _, key := range keys {
+			if v := cellValue(result.Data[key]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}}
+}
+
+// urlColumns URL、爬虫、目录扫描结果共用的列
+var urlColumns = []tableColumn{
+	dataColumn("url"),
+	dataColumn("status", "status_code", "status"),
+	dataColumn("length", "length", "size"),
+	{header: "source", value: func(result *models.ScanResult) string {
+		if v := cellValue(result.Data["source"]); v != "" {
+			return v
+		}
+		return result.Source
+	}},
+}
+
+// tableColumns 各结果类型导出的列
+var tableColumns = map[models.ResultType][]tableColumn{
+	models.ResultTypeSubdomain: {
+		dataColumn("subdomain", "subdomain", "full_domain", "domain"),
+		dataColumn("ips", "ips", "ip"),
+		dataColumn("cnames"),
+		dataColumn("title"),
+		dataColumn("status", "status_code"),
+		dataColumn("cdn_name"),
+	},
+	models.ResultTypePort: {
+		dataColumn("ip", "ip", "host"),
+		dataColumn("port"),
+		dataColumn("service"),
+		dataColumn("version"),
+	},
+	models.ResultTypeVuln: {
+		dataColumn("vuln_id"),
+		dataColumn("name"),
+		dataColumn("severity"),
+		dataColumn("target"),
+		dataColumn("matched_at"),
+	},
+	models.ResultTypeURL:     urlColumns,
+	models.ResultTypeCrawler: urlColumns,
+	models.ResultTypeDirScan: urlColumns,
+}
+
+// tableExportOrder 未指定结果类型时 XLSX 的工作表顺序
+var tableExportOrder = []models.ResultType{
+	models.ResultTypeSubdomain,
+	models.ResultTypePort,
+	models.ResultTypeVuln,
+	models.ResultTypeURL,
+	models.ResultTypeCrawler,
+	models.ResultTypeDirScan,
+}
+
+// TableExportTypes 要导出的结果类型：指定类型时只导出该类型，未指定时 XLSX 导出全部支持的类型
+func TableExportTypes(resultType models.ResultType, format string) ([]models.ResultType, error) {
+	if resultType == "" {
+		if format == ExportFormatCSV {
+			return nil, ErrCSVNeedsType
+		}
+		return tableExportOrder, nil
+	}
+	if _, ok := tableColumns[resultType]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableExportType, resultType)
+	}
+	return []models.ResultType{resultType}, nil
+}
+
+// TableColumns 结果类型导出的列名
+func TableColumns(resultType models.ResultType) []string {
+	columns := tableColumns[resultType]
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.header
+	}
+	return headers
+}
+
+// cellValue 把 Data 中的值转为单元格文本，缺失的字段输出空字符串
+func cellValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int32:
+		return strconv.FormatInt(int64(val), 10)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case time.Time:
+		if val.IsZero() {
+			return ""
+		}
+		return val.Format(time.RFC3339)
+	case primitive.DateTime:
+		return val.Time().UTC().Format(time.RFC3339)
+	case primitive.ObjectID:
+		return val.Hex()
+	case []string:
+		return strings.Join(val, ",")
+	case primitive.A:
+		return joinCells(val)
+	case []interface{}:
+		return joinCells(val)
+	case bson.M, map[string]interface{}, bson.D:
+		return fmt.Sprint(val)
+	}
+	return fmt.Sprint(v)
+}
+
+// joinCells 列表以逗号连接，忽略空元素
+func joinCells(values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if s := cellValue(v); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// csvSafe 以 = + - @ 等开头的文本在表格软件中会被当作公式，加单引号前缀
+// 页面标题等字段来自扫描目标，不可信
+func csvSafe(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
+
+// TableExporter 逐行写出表格导出内容
+type TableExporter struct {
+	format string
+
+	// 当前工作表
+	sheet     models.ResultType
+	columns   []tableColumn
+	started   bool // 当前工作表已写出表头
+	rows      int
+	pending   bool // 已开始但还没有写出的工作表
+	csvWriter *csv.Writer
+
+	zw     *zip.Writer
+	sw     *bufio.Writer
+	sheets []models.ResultType
+	total  int
+}
+
+// NewTableExporter 创建表格导出器，format 为 csv 或 xlsx
+func NewTableExporter(w io.Writer, format string) (*TableExporter, error) {
+	e := &TableExporter{format: format}
+	switch format {
+	case ExportFormatCSV:
+		e.csvWriter = csv.NewWriter(w)
+	case ExportFormatXLSX:
+		e.zw = zip.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+	return e, nil
+}
+
+// ContentType 响应的 Content-Type
+func (e *TableExporter) ContentType() string {
+	if e.format == ExportFormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// BeginSheet 开始导出一种结果类型，CSV 只能导出一种
+func (e *TableExporter) BeginSheet(resultType models.ResultType) error {
+	columns, ok := tableColumns[resultType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableExportType, resultType)
+	}
+	if e.format == ExportFormatCSV && e.sheet != "" {
+		return ErrCSVNeedsType
+	}
+	if err := e.finishSheet(); err != nil {
+		return err
+	}
+	e.sheet = resultType
+	e.columns = columns
+	e.started = false
+	e.rows = 0
+	e.pending = true
+	return nil
+}
+
+// Write 写出一行
+func (e *TableExporter) Write(result *models.ScanResult) error {
+	if e.sheet == "" {
+		if err := e.BeginSheet(result.Type); err != nil {
+			return err
+		}
+	}
+	if err := e.startSheet(); err != nil {
+		return err
+	}
+	if e.format == ExportFormatXLSX && e.rows >= xlsxMaxRows {
+		return fmt.Errorf("工作表 %s 超过 Excel 行数上限 %d", e.sheet, xlsxMaxRows)
+	}
+
+	cells := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		cells[i] = col.value(result)
+	}
+	e.total++
+	return e.writeRow(cells)
+}
+
+// Count 已写出的结果数
+func (e *TableExporter) Count() int {
+	return e.total
+}
+
+// Close 结束导出；没有任何结果的工作表只输出表头
+func (e *TableExporter) Close() error {
+	if err := e.finishSheet(); err != nil {
+		return err
+	}
+	if e.csvWriter != nil {
+		e.csvWriter.Flush()
+		return e.csvWriter.Error()
+	}
+	if len(e.sheets) == 0 {
+		// 工作簿至少需要一个工作表
+		if e.sheet == "" {
+			e.sheet, e.columns = models.ResultTypeSubdomain, tableColumns[models.ResultTypeSubdomain]
+		}
+		e.pending = true
+		if err := e.finishSheet(); err != nil {
+			return err
+		}
+	}
+	if err := e.writeWorkbook(); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
+
+// startSheet 写出工作表开头和表头
+func (e *TableExporter) startSheet() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	e.pending = false
+	if e.zw != nil {
+		f, err := e.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(e.sheets)+1))
+		if err != nil {
+			return err
+		}
+		e.sheets = append(e.sheets, e.sheet)
+		e.sw = bufio.NewWriter(f)
+		e.sw.WriteString(xml.Header)
+		e.sw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	}
+	headers := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		headers[i] = col.header
+	}
+	return e.writeRow(headers)
+}
+
+// finishSheet 结束当前工作表；已开始但没有结果的工作表补上表头
+func (e *TableExporter) finishSheet() error {
+	if e.pending {
+		if err := e.startSheet(); err != nil {
+			return err
+		}
+	}
+	if e.sw == nil {
+		return nil
+	}
+	e.sw.WriteString(`</sheetData></worksheet>`)
+	err := e.sw.Flush()
+	e.sw = nil
+	return err
+}
+
+// writeRow 写出一行单元格
+func (e *TableExporter) writeRow(cells []string) error {
+	e.rows++
+	if e.csvWriter != nil {
+		for i := range cells {
+			cells[i] = csvSafe(cells[i])
+		}
+		if err := e.csvWriter.Write(cells); err != nil {
+			return err
+		}
+		// 定期写出，避免缓冲区随结果数增长
+		if e.rows%1000 == 0 {
+			e.csvWriter.Flush()
+			return e.csvWriter.Error()
+		}
+		return nil
+	}
+
+	fmt.Fprintf(e.sw, `<row r="%d">`, e.rows)
+	for i, cell := range cells {
+		if cell == "" {
+			continue
+		}
+		fmt.Fprintf(e.sw, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumn(i), e.rows)
+		xml.EscapeText(e.sw, []byte(cell))
+		e.sw.WriteString(`</t></is></c>`)
+	}
+	_, err := e.sw.WriteString(`</row>`)
+	return err
+}
+
+// writeWorkbook 写出工作簿、关系和内容类型
+func (e *TableExporter) writeWorkbook() error {
+	var workbook, rels, types strings.Builder
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	types.WriteString(xml.Header)
+	types.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i, sheet := range e.sheets {
+		n := i + 1
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, sheet, n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	types.WriteString(`</Types>`)
+
+	parts := []struct{ name, content string }{
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"[Content_Types].xml", types.String()},
+	}
+	for _, part := range parts {
+		f, err := e.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xlsxColumn 列序号（从 0 开始）转为 Excel 列名 A、B ... AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// ExportTable 按结果类型逐条读取导出结果写入表格，返回导出的条数
+func (s *ResultService) ExportTable(ctx context.Context, exporter *TableExporter, taskID string, types []models.ResultType, redactor *Redactor) (int, error) {
+	for _, resultType := range types {
+		if err := exporter.BeginSheet(resultType); err != nil {
+			return exporter.Count(), err
+		}
+		if _, err := s.StreamExportResults(ctx, taskID, resultType, redactor, exporter.Write); err != nil {
+			return exporter.Count(), err
+		}
+	}
+	return exporter.Count(), nil
+}
@@ -0,0 +1,573 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 结构化结果查询
+// 同一个 ResultFilter 既可以转换为 MongoDB 查询，也可以直接在内存中匹配结果，两者语义保持一致
+
+// resultFilterOps 支持的条件运算符
+var resultFilterOps = map[string]string{
+	"eq":            "",
+	"ne":            "$ne",
+	"gt":            "$gt",
+	"gte":           "$gte",
+	"lt":            "$lt",
+	"lte":           "$lte",
+	"in":            "$in",
+	"nin":           "$nin",
+	"exists":        "$exists",
+	"contains":      "$regex",
+	"not_contains":  "$regex",
+	"ends_with":     "$regex",
+	"not_ends_with": "$regex",
+}
+
+// resultFieldPattern 合法的数据字段名，避免字段名中夹带 $ 运算符
+var resultFieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// defaultTargetFields 各结果类型默认作为目标的数据字段
+var defaultTargetFields = map[models.ResultType]string{
+	models.ResultTypeSubdomain: "subdomain",
+	models.ResultTypeTakeover:  "subdomain",
+	models.ResultTypePort:      "ip",
+	models.ResultTypeService:   "url",
+	models.ResultTypeURL:       "url",
+	models.ResultTypeCrawler:   "url",
+	models.ResultTypeDirScan:   "url",
+	models.ResultTypeSensitive: "url",
+	models.ResultTypeVuln:      "target",
+}
+
+// ValidateResultFilter 校验结果查询条件
+func ValidateResultFilter(filter models.ResultFilter) error {
+	if filter.Type == "" {
+		return fmt.Errorf("结果类型不能为空")
+	}
+	if filter.TargetField == "" {
+		if _, ok := defaultTargetFields[filter.Type]; !ok {
+			return fmt.Errorf("结果类型 %s 需要指定 target_field", filter.Type)
+		}
+	}
+	for _, cond := range filter.Conditions {
+		if cond.Field == "" {
+			return fmt.Errorf("条件字段不能为空")
+		}
+		if !resultFieldPattern.MatchString(cond.Field) {
+			return fmt.Errorf("非法的条件字段: %s", cond.Field)
+		}
+		if _, ok := resultFilterOps[cond.Op]; !ok {
+			return fmt.Errorf("不支持的条件运算符: %s", cond.Op)
+		}
+		switch cond.Op {
+		case "in", "nin":
+			if _, ok := filterValues(cond.Value); !ok {
+				return fmt.Errorf("%s 条件的值必须是数组: %s", cond.Op, cond.Field)
+			}
+		case "exists":
+			if _, ok := cond.Value.(bool); !ok {
+				return fmt.Errorf("exists 条件的值必须是布尔值: %s", cond.Field)
+			}
+		}
+	}
+	if filter.Limit < 0 {
+		return fmt.Errorf("结果数量上限不能为负数")
+	}
+	return nil
+}
+
+// BuildResultQuery 将查询条件转换为任务范围内的 MongoDB 查询
+func BuildResultQuery(taskID primitive.ObjectID, filter models.ResultFilter) bson.M {
+	return buildFilterQuery(bson.M{"task_id": taskID}, filter)
+}
+
+// BuildWorkspaceResultQuery 将查询条件转换为工作空间范围内的 MongoDB 查询
+// 即席查询和保存的搜索都通过这里生成查询，两者结果一致
+func BuildWorkspaceResultQuery(workspaceID primitive.ObjectID, filter models.ResultFilter) bson.M {
+	return buildFilterQuery(bson.M{"workspace_id": workspaceID}, filter)
+}
+
+// buildFilterQuery 在 scope 基础上追加类型、标签和数据字段条件
+func buildFilterQuery(query bson.M, filter models.ResultFilter) bson.M {
+	query["type"] = filter.Type
+	if len(filter.Tags) > 0 {
+		query["tags"] = bson.M{"$in": filter.Tags}
+	}
+
+	// 同一字段上无法合并的条件放入 $and
+	var and []bson.M
+	addClause := func(key string, expr interface{}) {
+		if _, ok := query[key]; ok {
+			and = append(and, bson.M{key: expr})
+			return
+		}
+		query[key] = expr
+	}
+
+	for _, cond := range filter.Conditions {
+		key := "data." + cond.Field
+		value := normalizeFilterValue(cond.Value)
+		op := resultFilterOps[cond.Op]
+		switch cond.Op {
+		case "eq":
+			addClause(key, value)
+		case "contains", "not_contains", "ends_with", "not_ends_with":
+			addClause(key, patternExpr(cond.Op, value))
+		default:
+			// 同一字段的多个条件合并（如 gte + lte 表示范围）
+			existing, ok := query[key].(bson.M)
+			if _, dup := existing[op]; ok && !dup {
+				existing[op] = value
+				continue
+			}
+			addClause(key, bson.M{op: value})
+		}
+	}
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+	return query
+}
+
+// patternExpr 字符串匹配条件，均不区分大小写
+func patternExpr(op string, value interface{}) interface{} {
+	pattern := regexp.QuoteMeta(fmt.Sprint(value))
+	if op == "ends_with" || op == "not_ends_with" {
+		pattern += "$"
+	}
+	regex := primitive.Regex{Pattern: pattern, Options: "i"}
+	if strings.HasPrefix(op, "not_") {
+		return bson.M{"$not": regex}
+	}
+	return regex
+}
+
+// filterValues 获取数组条件值，兼容 JSON 解析和从 MongoDB 读出的两种数组类型
+func filterValues(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case primitive.A:
+		return []interface{}(v), true
+	}
+	return nil, false
+}
+
+// normalizeFilterValue 统一条件值的数组类型，保证保存后再读出的条件生成相同的查询
+func normalizeFilterValue(value interface{}) interface{} {
+	if values, ok := filterValues(value); ok {
+		return values
+	}
+	return value
+}
+
+// MatchResult 在内存中判断结果是否满足查询条件
+func MatchResult(result *models.ScanResult, filter models.ResultFilter) bool {
+	if result.Type != filter.Type {
+		return false
+	}
+	if len(filter.Tags) > 0 && !hasAnyTag(result.Tags, filter.Tags) {
+		return false
+	}
+	for _, cond := range filter.Conditions {
+		if cond.Op == "exists" {
+			_, ok := result.Data[cond.Field]
+			if ok != (cond.Value == true) {
+				return false
+			}
+			continue
+		}
+		if !matchCondition(result.Data[cond.Field], cond) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResultTarget 提取结果中作为后续任务目标的值
+func ResultTarget(result *models.ScanResult, filter models.ResultFilter) string {
+	field := filter.TargetField
+	if field == "" {
+		field = defaultTargetFields[result.Type]
+	}
+	if field == "" {
+		return ""
+	}
+	value, ok := result.Data[field]
+	if !ok || value == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(value))
+}
+
+// QueryResults 按结构化条件查询任务结果
+func (s *ResultService) QueryResults(taskID string, filter models.ResultFilter) ([]models.ScanResult, error) {
+	if err := ValidateResultFilter(filter); err != nil {
+		return nil, err
+	}
+	oid, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("无效的任务ID")
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := s.collection.Find(ctx, BuildResultQuery(oid, filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("查询结果失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []models.ScanResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("解析结果失败: %w", err)
+	}
+	log.Printf("[ResultService] Query on task %s matched %d %s results", taskID, len(results), filter.Type)
+	return results, nil
+}
+
+// hasAnyTag 是否包含任一标签
+func hasAnyTag(tags []string, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchCondition 判断字段值是否满足条件
+// 数组字段与 MongoDB 语义一致：eq、contains 等对任一元素满足即可，ne、not_* 要求所有元素都不满足
+func matchCondition(value interface{}, cond models.ResultCondition) bool {
+	switch cond.Op {
+	case "eq":
+		return anyElement(value, func(v interface{}) bool { return valuesEqual(v, cond.Value) })
+	case "ne":
+		return !anyElement(value, func(v interface{}) bool { return valuesEqual(v, cond.Value) })
+	case "contains", "ends_with":
+		return matchPattern(value, cond)
+	case "not_contains", "not_ends_with":
+		return !matchPattern(value, models.ResultCondition{Field: cond.Field, Op: strings.TrimPrefix(cond.Op, "not_"), Value: cond.Value})
+	case "in", "nin":
+		candidates, _ := filterValues(cond.Value)
+		matched := anyElement(value, func(v interface{}) bool {
+			for _, c := range candidates {
+				if valuesEqual(v, c) {
+					return true
+				}
+			}
+			return false
+		})
+		return matched == (cond.Op == "in")
+	case "gt", "gte", "lt", "lte":
+		left, ok := toFloat(value)
+		right, ok2 := toFloat(cond.Value)
+		if !ok || !ok2 {
+			return false
+		}
+		switch cond.Op {
+		case "gt":
+			return left > right
+		case "gte":
+			return left >= right
+		case "lt":
+			return left < right
+		default:
+			return left <= right
+		}
+	}
+	return false
+}
+
+// matchPattern 字符串包含或后缀匹配（不区分大小写）
+func matchPattern(value interface{}, cond models.ResultCondition) bool {
+	needle := strings.ToLower(fmt.Sprint(cond.Value))
+	return anyElement(value, func(v interface{}) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		if cond.Op == "ends_with" {
+			return strings.HasSuffix(strings.ToLower(s), needle)
+		}
+		return strings.Contains(strings.ToLower(s), needle)
+	})
+}
+
+// anyElement 对数组字段逐个元素判断，非数组直接判断
+func anyElement(value interface{}, fn func(interface{}) bool) bool {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if fn(item) {
+				return true
+			}
+		}
+		return false
+	case primitive.A:
+		for _, item := range v {
+			if fn(item) {
+				return true
+			}
+		}
+		return false
+	case []string:
+		for _, item := range v {
+			if fn(item) {
+				return true
+			}
+		}
+		return false
+	}
+	return fn(value)
+}
+
+// valuesEqual 比较两个值，数字按数值比较
+func valuesEqual(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toFloat 将数字类型转换为 float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// 工作空间结果搜索
+// 即席查询接口和保存的搜索共用同一套字段白名单、查询生成和工作空间权限校验
+
+// resultFilterFields 各结果类型允许在搜索中引用的数据字段
+var resultFilterFields = map[models.ResultType][]string{
+	models.ResultTypeSubdomain: {"subdomain", "domain", "root_domain", "full_domain", "ip", "ips", "cnames", "title", "status_code",
+		"web_server", "technologies", "cdn", "cdn_name", "url", "alive", "excluded", "resolution",
+		"saas_provider", "saas_category", "saas_handling", "skip_reason"},
+	models.ResultTypeTakeover:  {"subdomain", "cname", "provider", "vulnerable", "fingerprints", "reason", "severity"},
+	models.ResultTypePort:      {"host", "ip", "port", "service", "state", "version", "banner", "fingerprint"},
+	models.ResultTypeLiveness:  {"ip", "alive", "method", "evidence"},
+	models.ResultTypeService:   {"url", "host", "ip", "port", "title", "status_code", "server", "technologies", "fingerprints", "target", "name", "version", "category", "confidence"},
+	models.ResultTypeURL:       {"url", "method", "status_code", "title", "content_type", "length"},
+	models.ResultTypeCrawler:   {"target", "url", "method", "status_code", "crawler", "source"},
+	models.ResultTypeDirScan:   {"target", "url", "path", "status", "size", "content_type", "title"},
+	models.ResultTypeSensitive: {"target", "url", "type", "pattern", "location", "severity", "confidence", "total_matches"},
+	models.ResultTypeVuln:      {"target", "vuln_id", "name", "severity", "matched_at"},
+}
+
+// resultSortFields 结果顶层可排序字段
+var resultSortFields = map[string]bool{"created_at": true, "updated_at": true}
+
+// ResultFilterFields 获取结果类型允许搜索的字段
+func ResultFilterFields(resultType models.ResultType) []string {
+	return resultFilterFields[resultType]
+}
+
+// resultFieldAllowed 字段是否在结果类型的白名单中
+func resultFieldAllowed(resultType models.ResultType, field string) bool {
+	for _, f := range resultFilterFields[resultType] {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSearchFilter 校验搜索条件，只允许引用白名单中的字段
+func ValidateSearchFilter(filter models.ResultFilter) error {
+	if err := ValidateResultFilter(filter); err != nil {
+		return err
+	}
+	if _, ok := resultFilterFields[filter.Type]; !ok {
+		return fmt.Errorf("结果类型 %s 不支持搜索", filter.Type)
+	}
+	for _, cond := range filter.Conditions {
+		if !resultFieldAllowed(filter.Type, cond.Field) {
+			return fmt.Errorf("结果类型 %s 不允许按字段 %s 搜索", filter.Type, cond.Field)
+		}
+	}
+	if filter.TargetField != "" && !resultFieldAllowed(filter.Type, filter.TargetField) {
+		return fmt.Errorf("结果类型 %s 不允许使用目标字段 %s", filter.Type, filter.TargetField)
+	}
+	return nil
+}
+
+// BuildResultSort 生成排序，默认按创建时间倒序
+func BuildResultSort(resultType models.ResultType, sort models.ResultSort) (bson.D, error) {
+	order := -1
+	switch sort.Order {
+	case "", "desc":
+	case "asc":
+		order = 1
+	default:
+		return nil, fmt.Errorf("不支持的排序方向: %s", sort.Order)
+	}
+
+	switch {
+	case sort.Field == "":
+		return bson.D{{Key: "created_at", Value: order}}, nil
+	case resultSortFields[sort.Field]:
+		return bson.D{{Key: sort.Field, Value: order}}, nil
+	case resultFieldAllowed(resultType, sort.Field):
+		return bson.D{{Key: "data." + sort.Field, Value: order}, {Key: "_id", Value: order}}, nil
+	}
+	return nil, fmt.Errorf("结果类型 %s 不允许按字段 %s 排序", resultType, sort.Field)
+}
+
+// ErrWorkspaceForbidden 无权访问工作空间
+var ErrWorkspaceForbidden = errors.New("无权访问该工作空间")
+
+// CanAccessWorkspace 用户是否可以访问工作空间的结果：管理员、所有者或成员
+func CanAccessWorkspace(workspace *models.Workspace, userID primitive.ObjectID, role string) bool {
+	if role == "admin" {
+		return true
+	}
+	if workspace == nil || userID.IsZero() {
+		return false
+	}
+	if workspace.OwnerID == userID {
+		return true
+	}
+	for _, member := range workspace.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizeWorkspace 校验用户对工作空间结果和设置的查看权限，不是成员时返回 ErrWorkspaceNotFound
+// 未指定工作空间（默认空间）的结果对所有登录用户可见
+func (s *ResultService) AuthorizeWorkspace(workspaceID, userID primitive.ObjectID, role string) error {
+	return s.access.AuthorizeVisible(workspaceID, userID, role, models.WorkspaceRoleViewer)
+}
+
+// AuthorizeWorkspaceEdit 校验用户对工作空间结果和设置的修改权限，修改前调用；
+// 不是成员时返回 ErrWorkspaceNotFound，只读成员返回 ErrWorkspaceReadOnly
+func (s *ResultService) AuthorizeWorkspaceEdit(workspaceID, userID primitive.ObjectID, role string) error {
+	return s.access.AuthorizeVisible(workspaceID, userID, role, models.WorkspaceRoleEditor)
+}
+
+// AuthorizeResults 校验用户对指定结果所在工作空间的权限
+// 有结果不在用户可见的工作空间中时返回 ErrResultNotFound，无效或不存在的 ID 忽略
+func (s *ResultService) AuthorizeResults(ids []string, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	objIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objIDs = append(objIDs, objID)
+		}
+	}
+	if len(objIDs) == 0 || role == "admin" {
+		return nil
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	values, err := s.collection.Distinct(ctx, "workspace_id", bson.M{"_id": bson.M{"$in": objIDs}})
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		workspaceID, _ := v.(primitive.ObjectID)
+		have, err := s.access.WorkspaceRole(workspaceID, userID, role)
+		if err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+			return err
+		}
+		if have == "" {
+			return ErrResultNotFound
+		}
+		if err := checkWorkspaceRole(have, need); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuthorizeTagSelection 校验批量打标签范围的修改权限：按结果 ID 或任务
+func (s *ResultService) AuthorizeTagSelection(sel BulkTagSelection, userID primitive.ObjectID, role string) error {
+	if len(sel.IDs) > 0 {
+		return s.AuthorizeResults(sel.IDs, userID, role, models.WorkspaceRoleEditor)
+	}
+	if sel.TaskID == "" {
+		return nil
+	}
+	_, err := NewTaskService().GetTaskForUser(sel.TaskID, userID, role, models.WorkspaceRoleEditor)
+	return err
+}
+
+// SearchResults 在工作空间内按搜索条件分页查询结果，调用方需先校验工作空间权限
+func (s *ResultService) SearchResults(workspaceID primitive.ObjectID, filter models.ResultFilter, sort models.ResultSort, page, pageSize int) ([]models.ScanResult, int64, error) {
+	if err := ValidateSearchFilter(filter); err != nil {
+		return nil, 0, err
+	}
+	sortDoc, err := BuildResultSort(filter.Type, sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	query := BuildWorkspaceResultQuery(workspaceID, filter)
+	total, err := s.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("统计结果失败: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(sortDoc).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询结果失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]models.ScanResult, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, fmt.Errorf("解析结果失败: %w", err)
+	}
+	return results, total, nil
+}
@@ -0,0 +1,542 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 扫描结果保留策略
+// 每天按工作空间的策略清理 scan_results：早于保留天数的结果、巡航中超出保留次数的旧执行的结果，
+// 以及所属任务已不存在的孤立结果。删除按 ID 分批进行，避免一次删除过多文档；
+// 漏洞（findings、vulnerabilities）和工作空间资产不在清理范围内，漏洞类型的扫描结果默认也保留
+
+const (
+	// RetentionAuditAction 结果清理的审计日志动作
+	RetentionAuditAction = "result_retention"
+	// RetentionInterval 后台清理的执行间隔
+	RetentionInterval = 24 * time.Hour
+	// RetentionBatchSize 每批删除的结果数
+	RetentionBatchSize = 1000
+
+	// retentionStartDelay 启动后首次清理的等待时间，避开任务恢复
+	retentionStartDelay = 10 * time.Minute
+)
+
+// ResultSelection 待清理结果的查询条件
+type ResultSelection struct {
+	WorkspaceID  *primitive.ObjectID  // 所属工作空间，nil 不限制
+	Before       time.Time            // 创建时间早于该时间，零值不限制
+	Since        time.Time            // 创建时间不早于该时间，零值不限制
+	TaskIDs      []primitive.ObjectID // 所属任务，nil 不限制
+	ExcludeTasks []primitive.ObjectID // 不属于这些任务
+	ExcludeTypes []models.ResultType  // 不清理的结果类型
+}
+
+// RetentionStore 结果清理依赖的存储操作
+type RetentionStore interface {
+	ListRetentionPolicies(ctx context.Context) ([]*models.WorkspaceRetention, error)
+	// GetRetentionPolicy 工作空间的保留策略，未配置时返回 nil
+	GetRetentionPolicy(ctx context.Context, workspaceID string) (*models.WorkspaceRetention, error)
+	SaveRetentionPolicy(ctx context.Context, policy *models.WorkspaceRetention) error
+	// FindResultIDs 满足条件且 ID 大于 after 的结果ID，按 ID 升序最多 limit 条
+	FindResultIDs(ctx context.Context, sel ResultSelection, after primitive.ObjectID, limit int) ([]primitive.ObjectID, error)
+	DeleteResults(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+	// CruiseRuns 工作空间中巡航触发的已结束任务，按巡航分组，每组按创建时间从新到旧
+	CruiseRuns(ctx context.Context, workspaceID primitive.ObjectID) (map[primitive.ObjectID][]primitive.ObjectID, error)
+	// ResultTaskIDs 结果中出现的全部任务ID
+	ResultTaskIDs(ctx context.Context) ([]primitive.ObjectID, error)
+	// ExistingTasks ids 中仍存在的任务
+	ExistingTasks(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error)
+	InsertAudit(ctx context.Context, entry *models.OperationLog) error
+}
+
+// ValidateRetention 校验保留策略
+func ValidateRetention(policy *models.WorkspaceRetention) error {
+	if policy.KeepDays < 0 || policy.KeepRuns < 0 {
+		return errors.New("保留天数和保留次数不能为负数")
+	}
+	return nil
+}
+
+// LoadRetention 读取工作空间的保留策略，未配置或读取失败时返回不清理的空策略
+func LoadRetention(store RetentionStore, workspaceID string) *models.WorkspaceRetention {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	policy, err := store.GetRetentionPolicy(ctx, workspaceID)
+	if err != nil {
+		log.Printf("[Retention] Failed to load retention policy of workspace %s: %v", workspaceID, err)
+	}
+	if policy == nil {
+		return &models.WorkspaceRetention{WorkspaceID: workspaceID}
+	}
+	return policy
+}
+
+// SaveRetention 校验并保存工作空间的保留策略
+func SaveRetention(store RetentionStore, policy *models.WorkspaceRetention) error {
+	if err := ValidateRetention(policy); err != nil {
+		return err
+	}
+	policy.UpdatedAt = time.Now()
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return store.SaveRetentionPolicy(ctx, policy)
+}
+
+// RetentionCutoff 保留 keepDays 天时的截止时间：now 所在自然日往前 keepDays 天的零点，早于该时间的结果被清理
+// 例如 keepDays 为 1 时保留今天和昨天的结果；keepDays <= 0 返回零值（不按时间清理）
+func RetentionCutoff(now time.Time, keepDays int) time.Time {
+	if keepDays <= 0 {
+		return time.Time{}
+	}
+	y, m, d := now.Date()
+	return time.Date(y, m, d-keepDays, 0, 0, 0, 0, now.Location())
+}
+
+// ExpiredRuns 每个巡航超出保留次数的旧任务，runs 每组按从新到旧排列
+func ExpiredRuns(runs map[primitive.ObjectID][]primitive.ObjectID, keepRuns int) []primitive.ObjectID {
+	if keepRuns <= 0 {
+		return nil
+	}
+	var expired []primitive.ObjectID
+	for _, tasks := range runs {
+		if len(tasks) > keepRuns {
+			expired = append(expired, tasks[keepRuns:]...)
+		}
+	}
+	return expired
+}
+
+// FindOrphanTasks 结果中引用的已不存在的任务
+func FindOrphanTasks(ctx context.Context, store RetentionStore) ([]primitive.ObjectID, error) {
+	ids, err := store.ResultTaskIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := store.ExistingTasks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []primitive.ObjectID
+	for _, id := range ids {
+		if !existing[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	return orphans, nil
+}
+
+// RetentionOptions 清理选项
+type RetentionOptions struct {
+	DryRun    bool      // 只统计将要删除的结果数，不删除
+	Now       time.Time // 计算截止时间的当前时间，零值使用 time.Now()
+	BatchSize int       // 每批删除的结果数，0 使用 RetentionBatchSize
+	UserID    primitive.ObjectID
+	Username  string // 审计日志中的操作人，后台任务为空
+}
+
+// WorkspaceRetentionReport 单个工作空间的清理结果
+type WorkspaceRetentionReport struct {
+	WorkspaceID string    `json:"workspace_id"`
+	Cutoff      time.Time `json:"cutoff,omitempty"`
+	Expired     int64     `json:"expired"`  // 早于保留天数的结果数
+	OldRuns     int64     `json:"old_runs"` // 巡航旧执行的结果数
+	Error       string    `json:"error,omitempty"`
+}
+
+// RetentionReport 清理结果，DryRun 时为将要删除的数量
+type RetentionReport struct {
+	DryRun      bool                        `json:"dry_run"`
+	StartedAt   time.Time                   `json:"started_at"`
+	FinishedAt  time.Time                   `json:"finished_at"`
+	Workspaces  []*WorkspaceRetentionReport `json:"workspaces"`
+	OrphanTasks int                         `json:"orphan_tasks"` // 已不存在的任务数
+	Orphaned    int64                       `json:"orphaned"`     // 孤立结果数
+	Total       int64                       `json:"total"`
+}
+
+// RunRetention 清理孤立结果，再按全部工作空间的策略清理结果
+// 同一结果只计数一次，DryRun 的数量与实际删除的数量一致；孤立结果的查询失败时返回错误，单个工作空间失败时记录错误并继续
+func RunRetention(ctx context.Context, store RetentionStore, opts RetentionOptions) (*RetentionReport, error) {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = RetentionBatchSize
+	}
+	report := &RetentionReport{DryRun: opts.DryRun, StartedAt: time.Now()}
+
+	// 孤立结果：任务已被删除，不区分结果类型
+	orphans, err := FindOrphanTasks(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	report.OrphanTasks = len(orphans)
+	if len(orphans) > 0 {
+		n, err := deleteResultSelection(ctx, store, ResultSelection{TaskIDs: orphans}, opts)
+		report.Orphaned = n
+		report.Total += n
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	policies, err := store.ListRetentionPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range policies {
+		if policy.KeepDays <= 0 && policy.KeepRuns <= 0 {
+			continue
+		}
+		ws := applyRetention(ctx, store, policy, orphans, opts)
+		report.Workspaces = append(report.Workspaces, ws)
+		report.Total += ws.Expired + ws.OldRuns
+	}
+	report.FinishedAt = time.Now()
+
+	if !opts.DryRun {
+		// 审计日志失败不影响清理结果
+		if err := store.InsertAudit(ctx, retentionAuditEntry(report, opts)); err != nil {
+			log.Printf("[Retention] Failed to write audit entry: %v", err)
+		}
+	}
+	log.Printf("[Retention] Cleanup finished (dry_run=%v): %d workspaces, %d results, %d orphaned results of %d tasks",
+		opts.DryRun, len(report.Workspaces), report.Total, report.Orphaned, report.OrphanTasks)
+	return report, nil
+}
+
+// applyRetention 按工作空间的策略清理结果，已作为孤立结果处理的任务不再计数
+func applyRetention(ctx context.Context, store RetentionStore, policy *models.WorkspaceRetention, orphans []primitive.ObjectID, opts RetentionOptions) *WorkspaceRetentionReport {
+	ws := &WorkspaceRetentionReport{WorkspaceID: policy.WorkspaceID}
+	oid, err := primitive.ObjectIDFromHex(policy.WorkspaceID)
+	if err != nil {
+		ws.Error = "无效的工作空间ID"
+		return ws
+	}
+	var exclude []models.ResultType
+	if !policy.IncludeVulnResults {
+		exclude = []models.ResultType{models.ResultTypeVuln}
+	}
+
+	if policy.KeepDays > 0 {
+		ws.Cutoff = RetentionCutoff(opts.Now, policy.KeepDays)
+		ws.Expired, err = deleteResultSelection(ctx, store, ResultSelection{
+			WorkspaceID:  &oid,
+			Before:       ws.Cutoff,
+			ExcludeTasks: orphans,
+			ExcludeTypes: exclude,
+		}, opts)
+		if err != nil {
+			ws.Error = err.Error()
+			return ws
+		}
+	}
+
+	if policy.KeepRuns > 0 {
+		runs, err := store.CruiseRuns(ctx, oid)
+		if err != nil {
+			ws.Error = err.Error()
+			return ws
+		}
+		if expired := ExpiredRuns(runs, policy.KeepRuns); len(expired) > 0 {
+			// 早于截止时间的结果已计入 Expired
+			ws.OldRuns, err = deleteResultSelection(ctx, store, ResultSelection{
+				WorkspaceID:  &oid,
+				Since:        ws.Cutoff,
+				TaskIDs:      expired,
+				ExcludeTypes: exclude,
+			}, opts)
+			if err != nil {
+				ws.Error = err.Error()
+			}
+		}
+	}
+	return ws
+}
+
+// deleteResultSelection 分批删除满足条件的结果，DryRun 时只计数，返回删除（或将要删除）的数量
+func deleteResultSelection(ctx context.Context, store RetentionStore, sel ResultSelection, opts RetentionOptions) (int64, error) {
+	var total int64
+	var after primitive.ObjectID
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		ids, err := store.FindResultIDs(ctx, sel, after, opts.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		if opts.DryRun {
+			total += int64(len(ids))
+		} else {
+			n, err := store.DeleteResults(ctx, ids)
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+		if len(ids) < opts.BatchSize {
+			return total, nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// retentionAuditEntry 清理的审计日志，记录每个工作空间和孤立结果的删除数量
+func retentionAuditEntry(report *RetentionReport, opts RetentionOptions) *models.OperationLog {
+	data, _ := json.Marshal(map[string]interface{}{
+		"workspaces":   report.Workspaces,
+		"orphan_tasks": report.OrphanTasks,
+		"orphaned":     report.Orphaned,
+		"total":        report.Total,
+	})
+	username := opts.Username
+	if username == "" {
+		username = "system"
+	}
+	return &models.OperationLog{
+		ID:        primitive.NewObjectID(),
+		UserID:    opts.UserID,
+		Username:  username,
+		Action:    RetentionAuditAction,
+		Module:    "result",
+		Target:    models.CollectionScanResults,
+		Detail:    string(data),
+		Status:    1,
+		CreatedAt: time.Now(),
+	}
+}
+
+// RetentionJob 每天执行一次的结果清理
+type RetentionJob struct {
+	store    RetentionStore
+	interval time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRetentionJob 创建结果清理任务
+func NewRetentionJob(store RetentionStore) *RetentionJob {
+	return &RetentionJob{store: store, interval: RetentionInterval, stopCh: make(chan struct{})}
+}
+
+// Start 启动后台清理，启动后等待 retentionStartDelay 执行第一次
+func (j *RetentionJob) Start() {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		timer := time.NewTimer(retentionStartDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-j.stopCh:
+				return
+			case <-timer.C:
+				ctx, cancel := context.WithTimeout(context.Background(), j.interval/2)
+				if _, err := RunRetention(ctx, j.store, RetentionOptions{}); err != nil {
+					log.Printf("[Retention] Cleanup failed: %v", err)
+				}
+				cancel()
+				timer.Reset(j.interval)
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理，等待正在执行的清理结束
+func (j *RetentionJob) Stop() {
+	close(j.stopCh)
+	j.wg.Wait()
+}
+
+// mongoRetentionStore 基于 MongoDB 的清理存储
+type mongoRetentionStore struct{}
+
+// NewMongoRetentionStore 创建数据库清理存储
+func NewMongoRetentionStore() RetentionStore {
+	return &mongoRetentionStore{}
+}
+
+func (s *mongoRetentionStore) ListRetentionPolicies(ctx context.Context) ([]*models.WorkspaceRetention, error) {
+	cursor, err := database.GetCollection(models.CollectionRetentionPolicies).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var policies []*models.WorkspaceRetention
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (s *mongoRetentionStore) GetRetentionPolicy(ctx context.Context, workspaceID string) (*models.WorkspaceRetention, error) {
+	var policy models.WorkspaceRetention
+	err := database.GetCollection(models.CollectionRetentionPolicies).FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&policy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (s *mongoRetentionStore) SaveRetentionPolicy(ctx context.Context, policy *models.WorkspaceRetention) error {
+	_, err := database.GetCollection(models.CollectionRetentionPolicies).ReplaceOne(ctx,
+		bson.M{"_id": policy.WorkspaceID}, policy, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoRetentionStore) FindResultIDs(ctx context.Context, sel ResultSelection, after primitive.ObjectID, limit int) ([]primitive.ObjectID, error) {
+	filter := bson.M{}
+	if sel.WorkspaceID != nil {
+		filter["workspace_id"] = *sel.WorkspaceID
+	}
+	createdAt := bson.M{}
+	if !sel.Before.IsZero() {
+		createdAt["$lt"] = sel.Before
+	}
+	if !sel.Since.IsZero() {
+		createdAt["$gte"] = sel.Since
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	taskID := bson.M{}
+	if sel.TaskIDs != nil {
+		taskID["$in"] = sel.TaskIDs
+	}
+	if len(sel.ExcludeTasks) > 0 {
+		taskID["$nin"] = sel.ExcludeTasks
+	}
+	if len(taskID) > 0 {
+		filter["task_id"] = taskID
+	}
+	if len(sel.ExcludeTypes) > 0 {
+		filter["type"] = bson.M{"$nin": sel.ExcludeTypes}
+	}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := database.GetCollection(models.CollectionScanResults).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+func (s *mongoRetentionStore) DeleteResults(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	res, err := database.GetCollection(models.CollectionScanResults).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoRetentionStore) CruiseRuns(ctx context.Context, workspaceID primitive.ObjectID) (map[primitive.ObjectID][]primitive.ObjectID, error) {
+	filter := bson.M{
+		"workspace_id": workspaceID,
+		"cruise_id":    bson.M{"$exists": true, "$ne": primitive.NilObjectID},
+		"status":       bson.M{"$in": []models.TaskStatus{models.TaskStatusCompleted, models.TaskStatusFailed, models.TaskStatusCancelled}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"_id": 1, "cruise_id": 1})
+	cursor, err := database.GetCollection(models.CollectionTasks).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		CruiseID primitive.ObjectID `bson:"cruise_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	runs := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, doc := range docs {
+		runs[doc.CruiseID] = append(runs[doc.CruiseID], doc.ID)
+	}
+	return runs, nil
+}
+
+func (s *mongoRetentionStore) ResultTaskIDs(ctx context.Context) ([]primitive.ObjectID, error) {
+	values, err := database.GetCollection(models.CollectionScanResults).Distinct(ctx, "task_id", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *mongoRetentionStore) ExistingTasks(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	existing := make(map[primitive.ObjectID]bool)
+	for start := 0; start < len(ids); start += RetentionBatchSize {
+		end := start + RetentionBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		cursor, err := database.GetCollection(models.CollectionTasks).Find(ctx,
+			bson.M{"_id": bson.M{"$in": ids[start:end]}}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return nil, err
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err = cursor.All(ctx, &docs)
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			existing[doc.ID] = true
+		}
+	}
+	return existing, nil
+}
+
+func (s *mongoRetentionStore) InsertAudit(ctx context.Context, entry *models.OperationLog) error {
+	_, err := database.GetCollection(models.CollectionOperationLog).InsertOne(ctx, entry)
+	return err
+}
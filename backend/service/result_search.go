@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"moongazing/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 结果列表的关键字搜索
+// 默认按字面量匹配（转义正则元字符），不区分大小写；/pattern/ 形式为原始正则。
+// field:value 只搜索指定字段，如 ip:10.0.0. 或 title:/log(in|on)/；IP 字段按前缀匹配以便使用索引
+
+// ErrInvalidSearch 搜索表达式不合法
+var ErrInvalidSearch = errors.New("无效的搜索表达式")
+
+// resultSearchFields 可以用 field:value 指定的搜索字段
+var resultSearchFields = map[string]string{
+	"domain":       "data.domain",
+	"subdomain":    "data.subdomain",
+	"display_name": "data.display_name",
+	"host":         "data.host",
+	"url":          "data.url",
+	"ip":           "data.ip",
+	"title":        "data.title",
+	"server":       "data.server",
+	"service":      "data.service",
+	"company":      "data.company",
+	"project":      "project",
+}
+
+// prefixSearchFields 字面量搜索时按前缀、区分大小写匹配的字段，这样的正则可以使用索引
+var prefixSearchFields = map[string]bool{
+	"data.ip": true,
+}
+
+var (
+	// 任务结果列表未指定字段时搜索的字段
+	taskSearchFields = []string{"data.domain", "data.subdomain", "data.url", "data.ip", "data.company", "project"}
+	// 子域名结果列表未指定字段时搜索的字段
+	subdomainSearchFields = []string{"data.subdomain", "data.display_name", "data.domain", "data.title"}
+	// 端口结果列表未指定字段时搜索的字段
+	portSearchFields = []string{"data.ip", "data.host", "data.service", "data.org"}
+)
+
+// BuildSearchFilter 将搜索关键字转换为查询条件，defaults 为未指定字段时搜索的字段
+// 原始正则按 RE2 语法预先校验，非法时返回 ErrInvalidSearch，避免 MongoDB 报错
+func BuildSearchFilter(search string, defaults []string) (bson.M, error) {
+	search = strings.TrimSpace(search)
+	if search == "" {
+		return bson.M{}, nil
+	}
+
+	fields := defaults
+	if name, value, ok := strings.Cut(search, ":"); ok {
+		if field, scoped := resultSearchFields[strings.ToLower(name)]; scoped {
+			fields = []string{field}
+			search = strings.TrimSpace(value)
+			if search == "" {
+				return nil, fmt.Errorf("%w: %s 缺少搜索内容", ErrInvalidSearch, name)
+			}
+		}
+	}
+
+	raw, isRaw := rawSearchPattern(search)
+	if isRaw {
+		if _, err := regexp.Compile(raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+	}
+
+	clauses := make([]bson.M, 0, len(fields))
+	for _, field := range fields {
+		regex := primitive.Regex{Pattern: raw, Options: "i"}
+		switch {
+		case isRaw:
+		case prefixSearchFields[field]:
+			regex = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(search)}
+		default:
+			regex.Pattern = regexp.QuoteMeta(search)
+		}
+		clauses = append(clauses, bson.M{field: regex})
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return bson.M{"$or": clauses}, nil
+}
+
+// rawSearchPattern 识别 /pattern/ 形式的原始正则
+func rawSearchPattern(search string) (string, bool) {
+	if len(search) >= 2 && strings.HasPrefix(search, "/") && strings.HasSuffix(search, "/") {
+		return search[1 : len(search)-1], true
+	}
+	return "", false
+}
+
+// applySearchFilter 将搜索条件合并到查询中
+func applySearchFilter(filter bson.M, search string, defaults []string) error {
+	clause, err := BuildSearchFilter(search, defaults)
+	if err != nil {
+		return err
+	}
+	for k, v := range clause {
+		filter[k] = v
+	}
+	return nil
+}
+
+// ResultIndexes 扫描结果集合的索引，任务内按类型和常用搜索字段查询时不做全集合扫描
+func ResultIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.subdomain", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.ip", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.host", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.url", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.normalized_url", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.url_signature", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.param_signature", Value: 1}}},
+		{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "tags", Value: 1}}},
+	}
+}
+
+// EnsureIndexes 创建扫描结果集合的索引，已存在的索引不会重复创建
+func (s *ResultService) EnsureIndexes() error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateMany(ctx, ResultIndexes(), options.CreateIndexes())
+	return err
+}
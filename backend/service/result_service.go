@@ -4,6 +4,8 @@ import (
 	"context"
 	"moongazing/database"
 	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/service/pipeline"
 	"strings"
 	"time"
 
@@ -15,11 +17,18 @@ import (
 
 type ResultService struct {
 	collection *mongo.Collection
+	access     *WorkspaceAccess
 }
 
 func NewResultService() *ResultService {
+	return NewResultServiceWithCollection(database.GetCollection(models.CollectionScanResults))
+}
+
+// NewResultServiceWithCollection 使用指定集合创建结果服务
+func NewResultServiceWithCollection(collection *mongo.Collection) *ResultService {
 	return &ResultService{
-		collection: database.GetCollection(models.CollectionScanResults),
+		collection: collection,
+		access:     NewWorkspaceAccess(),
 	}
 }
 
@@ -96,10 +105,31 @@ func (s *ResultService) CreateResult(result *models.ScanResult) error {
 // CreateResultWithDedup 创建扫描结果（带去重）
 // 根据 type 和 data 中的关键字段进行去重
 func (s *ResultService) CreateResultWithDedup(result *models.ScanResult) error {
+	_, err := s.UpsertResult(result)
+	return err
+}
+
+// UpsertResult 创建扫描结果（带去重），merged 表示与任务中已有的结果合并
+func (s *ResultService) UpsertResult(result *models.ScanResult) (merged bool, err error) {
 	ctx, cancel := database.NewContext()
 	defer cancel()
 
-	// 构建去重过滤条件
+	filter := DedupFilter(result)
+
+	// 使用 Upsert：存在则更新，不存在则插入
+	result.UpdatedAt = time.Now()
+	update := DedupUpdate(result)
+
+	opts := options.Update().SetUpsert(true)
+	res, err := s.collection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// DedupFilter 构建去重过滤条件，同时把去重用的标准化字段写回 result.Data
+func DedupFilter(result *models.ScanResult) bson.M {
 	filter := bson.M{
 		"task_id": result.TaskID,
 		"type":    result.Type,
@@ -108,12 +138,20 @@ func (s *ResultService) CreateResultWithDedup(result *models.ScanResult) error {
 	// 根据不同类型添加特定的去重字段
 	switch result.Type {
 	case models.ResultTypeSubdomain:
+		// 子域名按 punycode 去重，同时保留 Unicode 形式用于展示
 		if subdomain, ok := result.Data["subdomain"].(string); ok && subdomain != "" {
+			subdomain = core.ToASCIIDomain(subdomain)
+			result.Data["subdomain"] = subdomain
+			if name, _ := result.Data["display_name"].(string); name == "" {
+				result.Data["display_name"] = core.ToUnicodeDomain(subdomain)
+			}
 			filter["data.subdomain"] = subdomain
 		}
 	case models.ResultTypePort:
 		if ip, ok := result.Data["ip"].(string); ok && ip != "" {
 			filter["data.ip"] = ip
+		} else if host, ok := result.Data["host"].(string); ok && host != "" {
+			filter["data.host"] = host
 		}
 		if port, ok := result.Data["port"]; ok {
 			filter["data.port"] = port
@@ -121,24 +159,34 @@ func (s *ResultService) CreateResultWithDedup(result *models.ScanResult) error {
 	case models.ResultTypeService:
 		// Web服务按 host 去重（同一个 host 的 http 和 https 只保留一条）
 		if rawURL, ok := result.Data["url"].(string); ok && rawURL != "" {
-			host := extractHostFromURL(rawURL)
+			host := core.NormalizeTargetIDN(extractHostFromURL(rawURL))
 			filter["data.dedup_host"] = host
 			// 存储用于去重的 host
 			result.Data["dedup_host"] = host
 			// 同时存储标准化后的 URL
 			result.Data["normalized_url"] = normalizeServiceURL(rawURL)
 		}
-	case models.ResultTypeURL, models.ResultTypeCrawler:
+	case models.ResultTypeURL, models.ResultTypeCrawler, models.ResultTypeDirScan:
 		if rawURL, ok := result.Data["url"].(string); ok && rawURL != "" {
-			normalizedURL := normalizeServiceURL(rawURL)
+			normalizedURL := pipeline.NormalizeURL(rawURL)
 			filter["data.normalized_url"] = normalizedURL
 			result.Data["normalized_url"] = normalizedURL
 		}
-	case models.ResultTypeDirScan:
-		if rawURL, ok := result.Data["url"].(string); ok && rawURL != "" {
-			normalizedURL := normalizeServiceURL(rawURL)
-			filter["data.normalized_url"] = normalizedURL
-			result.Data["normalized_url"] = normalizedURL
+		// 按参数签名去重时同一签名只保留一条
+		if signature, ok := result.Data["url_signature"].(string); ok && signature != "" {
+			delete(filter, "data.normalized_url")
+			filter["data.url_signature"] = signature
+		}
+		// 按参数集合去重时同一接口、方法和参数名集合只保留一条
+		if signature, ok := result.Data["param_signature"].(string); ok && signature != "" {
+			delete(filter, "data.normalized_url")
+			filter["data.param_signature"] = signature
+		}
+		// 接口文档中同一路径的不同方法分别保留，GET 与未记录方法的结果视为同一请求
+		if method, ok := result.Data["method"].(string); ok && method != "" && !strings.EqualFold(method, "GET") {
+			filter["data.method"] = strings.ToUpper(method)
+		} else {
+			filter["data.method"] = bson.M{"$in": bson.A{"", "GET", nil}}
 		}
 	case models.ResultTypeVuln:
 		if vulnID, ok := result.Data["vuln_id"].(string); ok && vulnID != "" {
@@ -155,29 +203,116 @@ func (s *ResultService) CreateResultWithDedup(result *models.ScanResult) error {
 			filter["data.type"] = matchType
 		}
 	}
+	return filter
+}
 
-	// 使用 Upsert：存在则更新，不存在则插入
-	result.UpdatedAt = time.Now()
-	
-	update := bson.M{
-		"$set": bson.M{
-			"data":       result.Data,
-			"source":     result.Source,
-			"tags":       result.Tags,
-			"project":    result.Project,
-			"updated_at": result.UpdatedAt,
-		},
-		"$setOnInsert": bson.M{
-			"task_id":      result.TaskID,
-			"workspace_id": result.WorkspaceID,
-			"type":         result.Type,
-			"created_at":   time.Now(),
-		},
+// resultSetFields 合并时取并集的数组字段
+var resultSetFields = []string{"technologies", "fingerprints"}
+
+// DedupUpdate 构建去重写入的更新语句
+// 同一条结果会被多个模块写入（爬虫和目录扫描写入同一 URL，子域名 HTTP 探测和指纹识别写入同一 Web 服务），
+// 按字段合并：非空字段覆盖已有值，空值只在插入时写入，技术栈、指纹和标签取并集；
+// sources 记录写入过该结果的全部来源，first_seen_source/first_seen_at 只在插入时写入
+func DedupUpdate(result *models.ScanResult) bson.M {
+	now := time.Now()
+	set := bson.M{
+		"updated_at": result.UpdatedAt,
+	}
+	setOnInsert := bson.M{
+		"task_id":           result.TaskID,
+		"workspace_id":      result.WorkspaceID,
+		"type":              result.Type,
+		"created_at":        now,
+		"first_seen_source": result.Source,
+		"first_seen_at":     now,
+	}
+	for key, value := range map[string]string{"source": result.Source, "project": result.Project} {
+		if value != "" {
+			set[key] = value
+		} else {
+			setOnInsert[key] = value
+		}
 	}
 
-	opts := options.Update().SetUpsert(true)
-	_, err := s.collection.UpdateOne(ctx, filter, update, opts)
-	return err
+	// 空数组也写入，新记录始终带有这些字段
+	sources := []string{}
+	if result.Source != "" {
+		sources = append(sources, result.Source)
+	}
+	tags := result.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	addToSet := bson.M{
+		"sources": bson.M{"$each": sources},
+		"tags":    bson.M{"$each": tags},
+	}
+	for _, field := range resultSetFields {
+		// Web 服务始终带有技术栈和指纹字段，其他类型只合并结果中出现的字段
+		if _, ok := result.Data[field]; !ok && result.Type != models.ResultTypeService {
+			continue
+		}
+		values := stringList(result.Data[field])
+		if values == nil {
+			values = []string{}
+		}
+		addToSet["data."+field] = bson.M{"$each": values}
+	}
+
+	for key, value := range result.Data {
+		if _, merged := addToSet["data."+key]; merged {
+			continue
+		}
+		// 截图字段只由截图结果写入，指纹识别更新同一条 Web 服务时保留已有截图
+		if result.Type == models.ResultTypeService && screenshotFields[key] {
+			continue
+		}
+		if isEmptyValue(value) {
+			setOnInsert["data."+key] = value
+			continue
+		}
+		set["data."+key] = value
+	}
+
+	return bson.M{
+		"$set":         set,
+		"$setOnInsert": setOnInsert,
+		"$addToSet":    addToSet,
+	}
+}
+
+// isEmptyValue 合并时不覆盖已有字段的空值
+// 从数据库读出后再次写入的结果中，整数为 int32/int64，数组为 primitive.A，文档为 bson.M
+func isEmptyValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case int:
+		return val == 0
+	case int32:
+		return val == 0
+	case int64:
+		return val == 0
+	case float64:
+		return val == 0
+	case []string:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	case primitive.A:
+		return len(val) == 0
+	case map[string]string:
+		return len(val) == 0
+	case bson.M:
+		return len(val) == 0
+	case map[string]interface{}:
+		return len(val) == 0
+	case primitive.D:
+		return len(val) == 0
+	}
+	return false
 }
 
 // BatchCreateResults 批量创建扫描结果
@@ -197,55 +332,39 @@ func (s *ResultService) BatchCreateResults(results []models.ScanResult) error {
 	return err
 }
 
-// BatchCreateResultsWithDedup 批量创建扫描结果（带去重）
+// BatchCreateResultsWithDedup 批量创建扫描结果（带去重），一次 BulkWrite 写入
 func (s *ResultService) BatchCreateResultsWithDedup(results []models.ScanResult) (int, int, error) {
-	inserted := 0
-	skipped := 0
-	
+	if len(results) == 0 {
+		return 0, 0, nil
+	}
+	writes := make([]ResultWrite, len(results))
 	for i := range results {
-		err := s.CreateResultWithDedup(&results[i])
-		if err != nil {
-			skipped++
-		} else {
+		writes[i] = ResultWrite{Result: &results[i], Dedup: true}
+	}
+	outcomes, err := s.BulkWriteResults(writes)
+	if err != nil {
+		return 0, len(results), err
+	}
+
+	inserted := 0
+	for _, outcome := range outcomes {
+		if outcome.Err == nil {
 			inserted++
 		}
 	}
-	
-	return inserted, skipped, nil
+	return inserted, len(results) - inserted, nil
 }
 
 // GetResultsByTask 获取任务的扫描结果
-func (s *ResultService) GetResultsByTask(taskID string, resultType models.ResultType, page, pageSize int, search string, statusCode int) ([]models.ScanResult, int64, error) {
+func (s *ResultService) GetResultsByTask(taskID string, resultType models.ResultType, page, pageSize int, search string, statusCode int, tags ResultTagFilter) ([]models.ScanResult, int64, error) {
 	ctx, cancel := database.NewContext()
 	defer cancel()
 
-	objID, err := primitive.ObjectIDFromHex(taskID)
+	filter, err := TaskResultFilter(taskID, resultType, search, statusCode, tags)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	filter := bson.M{"task_id": objID}
-	if resultType != "" {
-		filter["type"] = resultType
-	}
-	
-	// 状态码筛选（主要用于目录扫描结果）
-	if statusCode > 0 {
-		filter["data.status"] = statusCode
-	}
-	
-	if search != "" {
-		// 根据不同类型搜索不同字段
-		filter["$or"] = []bson.M{
-			{"data.domain": bson.M{"$regex": search, "$options": "i"}},
-			{"data.subdomain": bson.M{"$regex": search, "$options": "i"}},
-			{"data.url": bson.M{"$regex": search, "$options": "i"}},
-			{"data.ip": bson.M{"$regex": search, "$options": "i"}},
-			{"data.company": bson.M{"$regex": search, "$options": "i"}},
-			{"project": bson.M{"$regex": search, "$options": "i"}},
-		}
-	}
-
 	// 计算总数
 	total, err := s.collection.CountDocuments(ctx, filter)
 	if err != nil {
@@ -335,6 +454,10 @@ func (s *ResultService) UpdateResultTags(id string, tags []string) error {
 	if err != nil {
 		return err
 	}
+	tags, err = NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
 
 	update := bson.M{
 		"$set": bson.M{
@@ -356,6 +479,10 @@ func (s *ResultService) AddResultTag(id string, tag string) error {
 	if err != nil {
 		return err
 	}
+	tag, err = NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
 
 	update := bson.M{
 		"$addToSet": bson.M{"tags": tag},
@@ -375,6 +502,10 @@ func (s *ResultService) RemoveResultTag(id string, tag string) error {
 	if err != nil {
 		return err
 	}
+	tag, err = NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
 
 	update := bson.M{
 		"$pull": bson.M{"tags": tag},
@@ -390,11 +521,26 @@ func (s *ResultService) ExportResults(taskID string, resultType models.ResultTyp
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	objID, err := primitive.ObjectIDFromHex(taskID)
+	var results []models.ScanResult
+	_, err := s.StreamExportResults(ctx, taskID, resultType, nil, func(result *models.ScanResult) error {
+		results = append(results, *result)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return results, nil
+}
+
+// StreamExportResults 逐条读取导出结果，按脱敏策略处理后交给 emit，返回导出的条数
+// redactor 为空时不做处理；被策略排除的结果不计数
+func (s *ResultService) StreamExportResults(ctx context.Context, taskID string, resultType models.ResultType, redactor *Redactor, emit func(*models.ScanResult) error) (int, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return 0, err
+	}
+
 	filter := bson.M{"task_id": objID}
 	if resultType != "" {
 		filter["type"] = resultType
@@ -403,20 +549,29 @@ func (s *ResultService) ExportResults(taskID string, resultType models.ResultTyp
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
 	cursor, err := s.collection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer cursor.Close(ctx)
 
-	var results []models.ScanResult
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, err
+	count := 0
+	for cursor.Next(ctx) {
+		var result models.ScanResult
+		if err := cursor.Decode(&result); err != nil {
+			return count, err
+		}
+		if redactor != nil && !redactor.Redact(&result) {
+			continue
+		}
+		if err := emit(&result); err != nil {
+			return count, err
+		}
+		count++
 	}
-
-	return results, nil
+	return count, cursor.Err()
 }
 
-// UpdateSubdomainCDN 更新子域名的 CDN 信息
-func (s *ResultService) UpdateSubdomainCDN(taskID string, domain string, cdnProvider string) error {
+// UpdateSubdomainCDN 更新子域名的 CDN 信息，evidence 为判定依据
+func (s *ResultService) UpdateSubdomainCDN(taskID string, domain string, cdnProvider string, evidence string) error {
 	ctx, cancel := database.NewContext()
 	defer cancel()
 
@@ -439,6 +594,7 @@ func (s *ResultService) UpdateSubdomainCDN(taskID string, domain string, cdnProv
 		"$set": bson.M{
 			"data.cdn":          true,
 			"data.cdn_provider": cdnProvider,
+			"data.cdn_evidence": evidence,
 			"updated_at":        time.Now(),
 		},
 	}
@@ -470,6 +626,7 @@ func (s *ResultService) BatchDeleteResults(ids []string) error {
 }
 
 // GetSubdomainResults 获取子域名结果 (带解析，联合查询 service 数据补充指纹信息)
+// 分页和关联都在聚合管道中完成，每次请求只读取当前页的子域名及其同名 Web 服务
 func (s *ResultService) GetSubdomainResults(taskID string, page, pageSize int, search string) ([]map[string]interface{}, int64, error) {
 	ctx, cancel := database.NewContext()
 	defer cancel()
@@ -479,43 +636,12 @@ func (s *ResultService) GetSubdomainResults(taskID string, page, pageSize int, s
 		return nil, 0, err
 	}
 
-	// 1. 先查询所有 service 类型结果，用于后续关联
-	serviceFilter := bson.M{
-		"task_id": objID,
-		"type":    models.ResultTypeService,
-	}
-	serviceCursor, err := s.collection.Find(ctx, serviceFilter)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer serviceCursor.Close(ctx)
-
-	// 构建 host -> service 信息的映射
-	serviceMap := make(map[string]map[string]interface{})
-	for serviceCursor.Next(ctx) {
-		var result models.ScanResult
-		if err := serviceCursor.Decode(&result); err != nil {
-			continue
-		}
-		if host, ok := result.Data["host"].(string); ok && host != "" {
-			// 使用第一个匹配的 service 信息（通常是 443 或 80 端口）
-			if _, exists := serviceMap[host]; !exists {
-				serviceMap[host] = result.Data
-			}
-		}
-	}
-
-	// 2. 查询子域名结果
 	filter := bson.M{
 		"task_id": objID,
 		"type":    models.ResultTypeSubdomain,
 	}
-	if search != "" {
-		filter["$or"] = []bson.M{
-			{"data.subdomain": bson.M{"$regex": search, "$options": "i"}},
-			{"data.domain": bson.M{"$regex": search, "$options": "i"}},
-			{"data.title": bson.M{"$regex": search, "$options": "i"}},
-		}
+	if err := applySearchFilter(filter, search, subdomainSearchFields); err != nil {
+		return nil, 0, err
 	}
 
 	total, err := s.collection.CountDocuments(ctx, filter)
@@ -524,12 +650,8 @@ func (s *ResultService) GetSubdomainResults(taskID string, page, pageSize int, s
 	}
 
 	skip := int64((page - 1) * pageSize)
-	opts := options.Find().
-		SetSkip(skip).
-		SetLimit(int64(pageSize)).
-		SetSort(bson.D{{Key: "created_at", Value: -1}})
-
-	cursor, err := s.collection.Find(ctx, filter, opts)
+	pipeline := SubdomainResultsPipeline(s.collection.Name(), objID, filter, skip, int64(pageSize))
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -537,83 +659,170 @@ func (s *ResultService) GetSubdomainResults(taskID string, page, pageSize int, s
 
 	var results []map[string]interface{}
 	for cursor.Next(ctx) {
-		var result models.ScanResult
-		if err := cursor.Decode(&result); err != nil {
+		var row SubdomainResultRow
+		if err := cursor.Decode(&row); err != nil {
 			continue
 		}
+		results = append(results, row.Item())
+	}
 
-		item := map[string]interface{}{
-			"id":         result.ID.Hex(),
-			"task_id":    result.TaskID.Hex(),
-			"type":       result.Type,
-			"tags":       result.Tags,
-			"project":    result.Project,
-			"created_at": result.CreatedAt,
-		}
-
-		// 解析 data 字段 (Data 已经是 bson.M 类型)
-		for k, v := range result.Data {
-			item[k] = v
-		}
-
-		// 3. 尝试从 service 结果中补充 title, status_code, fingerprint 等信息
-		// 优先使用 subdomain 字段（完整子域名），因为 service 的 host 也是完整子域名
-		domainName := ""
-		if s, ok := result.Data["subdomain"].(string); ok && s != "" {
-			domainName = s
-		} else if d, ok := result.Data["domain"].(string); ok && d != "" {
-			domainName = d
-		}
-		
-		if domainName != "" {
-			if serviceInfo, exists := serviceMap[domainName]; exists {
-				// 补充 title
-				if title, ok := serviceInfo["title"].(string); ok && title != "" {
-					item["title"] = title
-				}
-				// 补充 status_code
-				if statusCode, ok := serviceInfo["status_code"].(int32); ok {
-					item["status_code"] = int(statusCode)
-				} else if statusCode, ok := serviceInfo["status_code"].(int); ok {
-					item["status_code"] = statusCode
-				}
-				// 补充 web_server
-				if server, ok := serviceInfo["server"].(string); ok && server != "" {
-					item["web_server"] = server
-				}
-				// 补充 fingerprints (技术栈)
-				if techs, ok := serviceInfo["technologies"].([]interface{}); ok && len(techs) > 0 {
-					var techStrings []string
-					for _, t := range techs {
-						if ts, ok := t.(string); ok {
-							techStrings = append(techStrings, ts)
-						}
-					}
-					item["fingerprint"] = techStrings
-					item["technologies"] = techStrings
-				}
-				if fps, ok := serviceInfo["fingerprints"].([]interface{}); ok && len(fps) > 0 {
-					var fpStrings []string
-					for _, f := range fps {
-						if fs, ok := f.(string); ok {
-							fpStrings = append(fpStrings, fs)
-						}
-					}
-					if item["fingerprint"] == nil {
-						item["fingerprint"] = fpStrings
-					}
-				}
-				// 补充 URL
-				if url, ok := serviceInfo["url"].(string); ok && url != "" {
-					item["url"] = url
-				}
-			}
-		}
+	return results, total, nil
+}
 
-		results = append(results, item)
+// SubdomainResultRow 子域名结果聚合行，Service 为同名 host 最早写入的 Web 服务的 data 字段
+type SubdomainResultRow struct {
+	models.ScanResult `bson:",inline"`
+	Service           bson.M `bson:"service,omitempty"`
+}
+
+// Item 构建子域名列表项
+func (r SubdomainResultRow) Item() map[string]interface{} {
+	return subdomainResultItem(r.ScanResult, r.Service)
+}
+
+// SubdomainResultsPipeline 子域名结果分页聚合（扫描结果集合）
+// 先分页再按 task_id + data.host 关联同名 Web 服务（索引 {task_id, type, data.host}），
+// 关联的主机名与 subdomainJoinHost 一致：优先 data.subdomain，为空时取 data.domain
+func SubdomainResultsPipeline(collection string, taskID primitive.ObjectID, filter bson.M, skip, limit int64) []bson.M {
+	host := bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{"$data.subdomain", ""}},
+		"$data.subdomain",
+		bson.M{"$ifNull": bson.A{"$data.domain", ""}},
+	}}
+	return []bson.M{
+		{"$match": filter},
+		{"$sort": bson.D{{Key: "created_at", Value: -1}}},
+		{"$skip": skip},
+		{"$limit": limit},
+		{"$lookup": bson.M{
+			"from": collection,
+			"let":  bson.M{"host": host},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"task_id":   taskID,
+					"type":      models.ResultTypeService,
+					"data.host": bson.M{"$gt": ""},
+					"$expr":     bson.M{"$eq": bson.A{"$data.host", "$$host"}},
+				}},
+				// 同一主机有多个 Web 服务时取最早写入的一个（通常是 443 或 80 端口）
+				bson.M{"$sort": bson.M{"_id": 1}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 0, "data": 1}},
+			},
+			"as": "service",
+		}},
+		{"$addFields": bson.M{"service": bson.M{"$arrayElemAt": bson.A{"$service.data", 0}}}},
 	}
+}
 
-	return results, total, nil
+// subdomainJoinHost 子域名结果关联 Web 服务使用的主机名
+// 优先使用 subdomain 字段（完整子域名），因为 service 的 host 也是完整子域名
+func subdomainJoinHost(result models.ScanResult) string {
+	if sub, ok := result.Data["subdomain"].(string); ok && sub != "" {
+		return sub
+	}
+	if d, ok := result.Data["domain"].(string); ok && d != "" {
+		return d
+	}
+	return ""
+}
+
+// SubdomainResultItem 构建子域名列表项，合并 data 字段并从同名 Web 服务补充标题、状态码和指纹
+func SubdomainResultItem(result models.ScanResult, serviceMap map[string]map[string]interface{}) map[string]interface{} {
+	var serviceInfo map[string]interface{}
+	if host := subdomainJoinHost(result); host != "" {
+		serviceInfo = serviceMap[host]
+	}
+	return subdomainResultItem(result, serviceInfo)
+}
+
+// subdomainResultItem 构建子域名列表项，serviceInfo 为关联到的 Web 服务 data 字段，可以为空
+func subdomainResultItem(result models.ScanResult, serviceInfo map[string]interface{}) map[string]interface{} {
+	item := map[string]interface{}{
+		"id":         result.ID.Hex(),
+		"task_id":    result.TaskID.Hex(),
+		"type":       result.Type,
+		"tags":       result.Tags,
+		"project":    result.Project,
+		"created_at": result.CreatedAt,
+	}
+
+	// 解析 data 字段 (Data 已经是 bson.M 类型)
+	for k, v := range result.Data {
+		item[k] = v
+	}
+
+	// 升级前的结果没有 display_name，由 punycode 转换
+	domainName := subdomainJoinHost(result)
+	if name, _ := item["display_name"].(string); name == "" && domainName != "" {
+		item["display_name"] = core.ToUnicodeDomain(domainName)
+	}
+
+	if serviceInfo == nil {
+		return item
+	}
+
+	// 从 service 结果中补充 title, status_code, fingerprint 等信息
+	if title, ok := serviceInfo["title"].(string); ok && title != "" {
+		item["title"] = title
+	}
+	if statusCode, ok := intValue(serviceInfo["status_code"]); ok {
+		item["status_code"] = statusCode
+	}
+	if server, ok := serviceInfo["server"].(string); ok && server != "" {
+		item["web_server"] = server
+	}
+	// 补充 fingerprints (技术栈)，technologies 优先，没有时使用 fingerprints
+	if techs, ok := stringArray(serviceInfo["technologies"]); ok {
+		item["fingerprint"] = techs
+		item["technologies"] = techs
+	}
+	if fps, ok := stringArray(serviceInfo["fingerprints"]); ok && item["fingerprint"] == nil {
+		item["fingerprint"] = fps
+	}
+	if url, ok := serviceInfo["url"].(string); ok && url != "" {
+		item["url"] = url
+	}
+
+	return item
+}
+
+// intValue 读取数字字段，从数据库读出的整数为 int32/int64，内存中的结果为 int
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// stringArray 读取非空数组字段中的字符串，ok 为 false 表示字段不是数组或数组为空
+func stringArray(v interface{}) ([]string, bool) {
+	var values []interface{}
+	switch list := v.(type) {
+	case []interface{}:
+		values = list
+	case primitive.A:
+		values = list
+	case []string:
+		return list, len(list) > 0
+	default:
+		return nil, false
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	var strs []string
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs, true
 }
 
 // GetPortResultsAggregated 获取聚合后的端口结果（按 IP 聚合，合并端口）
@@ -635,12 +844,8 @@ func (s *ResultService) GetPortResultsAggregated(taskID string, page, pageSize i
 	}
 
 	// 如果有搜索条件
-	if search != "" {
-		matchStage["$match"].(bson.M)["$or"] = []bson.M{
-			{"data.ip": bson.M{"$regex": search, "$options": "i"}},
-			{"data.host": bson.M{"$regex": search, "$options": "i"}},
-			{"data.service": bson.M{"$regex": search, "$options": "i"}},
-		}
+	if err := applySearchFilter(matchStage["$match"].(bson.M), search, portSearchFields); err != nil {
+		return nil, 0, err
 	}
 
 	// 按 IP 分组，收集端口信息
@@ -650,12 +855,22 @@ func (s *ResultService) GetPortResultsAggregated(taskID string, page, pageSize i
 			"host": bson.M{"$first": "$data.host"},
 			"ports": bson.M{
 				"$push": bson.M{
-					"port":    "$data.port",
-					"service": "$data.service",
+					"port":             "$data.port",
+					"service":          "$data.service",
+					"protocol":         "$data.protocol",
+					"tls":              "$data.tls",
+					"response_time_ms": "$data.response_time_ms",
+					"certificate":      "$data.certificate",
 				},
 			},
 			"created_at": bson.M{"$max": "$created_at"},
 			"task_id":    bson.M{"$first": "$task_id"},
+			// IP 归属，未查到的端口结果没有这些字段，取 $max 忽略空值
+			"asn":          bson.M{"$max": "$data.asn"},
+			"org":          bson.M{"$max": "$data.org"},
+			"country":      bson.M{"$max": "$data.country"},
+			"country_code": bson.M{"$max": "$data.country_code"},
+			"city":         bson.M{"$max": "$data.city"},
 		},
 	}
 
@@ -716,9 +931,13 @@ func (s *ResultService) GetPortResultsAggregated(taskID string, page, pageSize i
 		// 处理端口列表
 		var portList []string
 		var serviceList []string
+		var portDetails []map[string]interface{}
 		if ports, ok := doc["ports"].(bson.A); ok {
 			for _, p := range ports {
 				if portDoc, ok := p.(bson.M); ok {
+					if detail := portDetail(portDoc); detail != nil {
+						portDetails = append(portDetails, detail)
+					}
 					port := ""
 					service := ""
 					if v, ok := portDoc["port"].(string); ok {
@@ -743,11 +962,46 @@ func (s *ResultService) GetPortResultsAggregated(taskID string, page, pageSize i
 			"ports":      portList,
 			"port_count": len(portList),
 			"services":   serviceList,
+			"details":    portDetails,
 			"created_at": doc["created_at"],
 		}
+		addIPOwnership(item, doc)
 
 		results = append(results, item)
 	}
 
 	return results, total, nil
 }
+
+// addIPOwnership 把分组中的 IP 归属字段加入聚合结果，没有归属信息的 IP 不输出这些字段
+func addIPOwnership(item map[string]interface{}, doc bson.M) {
+	if asn, ok := intValue(doc["asn"]); ok && asn != 0 {
+		item["asn"] = asn
+	}
+	for _, field := range []string{"org", "country", "country_code", "city"} {
+		if v, ok := doc[field].(string); ok && v != "" {
+			item[field] = v
+		}
+	}
+}
+
+// portDetail 聚合结果中单个端口的详情：协议、TLS、连接耗时和证书
+func portDetail(portDoc bson.M) map[string]interface{} {
+	port, _ := portDoc["port"].(string)
+	if port == "" {
+		return nil
+	}
+	detail := map[string]interface{}{
+		"port":     port,
+		"service":  portDoc["service"],
+		"protocol": portDoc["protocol"],
+		"tls":      portDoc["tls"] == true,
+	}
+	if v, ok := portDoc["response_time_ms"]; ok && v != nil {
+		detail["response_time_ms"] = v
+	}
+	if cert, ok := portDoc["certificate"].(bson.M); ok {
+		detail["certificate"] = cert
+	}
+	return detail
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"sort"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 资产快照比较
+// 指纹识别为每个 Web 服务记录去掉 CSRF token、nonce、时间戳等后的响应体 hash（normalized_body_hash），
+// 比较同一工作空间的两个任务，找出页面内容发生变化的资产。
+
+// AssetSnapshot 一个任务中 Web 服务的页面快照
+type AssetSnapshot struct {
+	URL                string `json:"url"`
+	Host               string `json:"host"`
+	Title              string `json:"title,omitempty"`
+	StatusCode         int    `json:"status_code,omitempty"`
+	NormalizedBodyHash string `json:"normalized_body_hash,omitempty"`
+	BodyPreview        string `json:"body_preview,omitempty"`
+}
+
+// AssetSnapshotChange 页面内容变化的资产
+type AssetSnapshotChange struct {
+	URL    string        `json:"url"`
+	Before AssetSnapshot `json:"before"`
+	After  AssetSnapshot `json:"after"`
+}
+
+// AssetSnapshotDiff 两个任务的资产快照比较结果
+type AssetSnapshotDiff struct {
+	TaskA   string                `json:"task_a"`
+	TaskB   string                `json:"task_b"`
+	Changed []AssetSnapshotChange `json:"changed"`
+	Added   []AssetSnapshot       `json:"added"`   // 只在任务 B 中出现
+	Removed []AssetSnapshot       `json:"removed"` // 只在任务 A 中出现
+}
+
+// DiffAssetSnapshots 按标准化 URL 比较两组快照，任一方缺少 hash（升级前的结果）时不判定为变化
+func DiffAssetSnapshots(a, b []AssetSnapshot) *AssetSnapshotDiff {
+	diff := &AssetSnapshotDiff{Changed: []AssetSnapshotChange{}, Added: []AssetSnapshot{}, Removed: []AssetSnapshot{}}
+
+	before := make(map[string]AssetSnapshot, len(a))
+	for _, s := range a {
+		before[normalizeServiceURL(s.URL)] = s
+	}
+	seen := make(map[string]bool, len(b))
+	for _, s := range b {
+		key := normalizeServiceURL(s.URL)
+		seen[key] = true
+		prev, ok := before[key]
+		if !ok {
+			diff.Added = append(diff.Added, s)
+			continue
+		}
+		if prev.NormalizedBodyHash == "" || s.NormalizedBodyHash == "" || prev.NormalizedBodyHash == s.NormalizedBodyHash {
+			continue
+		}
+		diff.Changed = append(diff.Changed, AssetSnapshotChange{URL: s.URL, Before: prev, After: s})
+	}
+	for key, s := range before {
+		if !seen[key] {
+			diff.Removed = append(diff.Removed, s)
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].URL < diff.Changed[j].URL })
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].URL < diff.Added[j].URL })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].URL < diff.Removed[j].URL })
+	return diff
+}
+
+// CompareAssetSnapshots 比较同一工作空间两个任务的 Web 服务，报告页面内容变化的资产
+func (s *ResultService) CompareAssetSnapshots(taskA, taskB string) (*AssetSnapshotDiff, error) {
+	taskService := NewTaskService()
+	a, err := taskService.GetTaskByID(taskA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := taskService.GetTaskByID(taskB)
+	if err != nil {
+		return nil, err
+	}
+	if a.WorkspaceID != b.WorkspaceID {
+		return nil, errors.New("两个任务不属于同一工作空间")
+	}
+
+	before, err := s.assetSnapshots(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.assetSnapshots(b)
+	if err != nil {
+		return nil, err
+	}
+	diff := DiffAssetSnapshots(before, after)
+	diff.TaskA = taskA
+	diff.TaskB = taskB
+	return diff, nil
+}
+
+// assetSnapshots 读取任务的 Web 服务快照
+func (s *ResultService) assetSnapshots(task *models.Task) ([]AssetSnapshot, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"task_id": task.ID, "type": models.ResultTypeService})
+	if err != nil {
+		return nil, errors.New("查询任务结果失败")
+	}
+	defer cursor.Close(ctx)
+
+	var snapshots []AssetSnapshot
+	for cursor.Next(ctx) {
+		var result models.ScanResult
+		if err := cursor.Decode(&result); err != nil {
+			continue
+		}
+		var snapshot AssetSnapshot
+		snapshot.URL, _ = result.Data["url"].(string)
+		if snapshot.URL == "" {
+			continue
+		}
+		snapshot.Host, _ = result.Data["host"].(string)
+		snapshot.Title, _ = result.Data["title"].(string)
+		snapshot.NormalizedBodyHash, _ = result.Data["normalized_body_hash"].(string)
+		snapshot.BodyPreview, _ = result.Data["body_preview"].(string)
+		switch code := result.Data["status_code"].(type) {
+		case int32:
+			snapshot.StatusCode = int(code)
+		case int64:
+			snapshot.StatusCode = int(code)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, cursor.Err()
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 结果标签
+// 标签统一去掉首尾空白并转为小写；批量打标签可以指定结果 ID 列表，也可以使用与任务结果列表相同的
+// 筛选条件（task_id + type + search + tags）。按筛选条件更新时按 _id 分批处理，每批使用独立的
+// 数据库超时，整个工作空间的结果也不会因为单次 10s 超时而失败
+
+// BulkTagBatchSize 批量打标签时每批更新的结果数
+const BulkTagBatchSize = 1000
+
+var (
+	// ErrInvalidTag 标签为空
+	ErrInvalidTag = errors.New("标签不能为空")
+	// ErrInvalidTagSelection 批量打标签的结果范围无效
+	ErrInvalidTagSelection = errors.New("无效的批量范围")
+)
+
+// NormalizeTag 标准化标签：去掉首尾空白并转为小写，空标签返回 ErrInvalidTag
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// NormalizeTags 标准化标签列表并去重，保持原有顺序
+func NormalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+// ParseTagList 解析逗号分隔的标签，忽略空项（用于查询参数）
+func ParseTagList(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag, err := NormalizeTag(tag); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ResultTagFilter 按标签筛选结果
+type ResultTagFilter struct {
+	Any  []string `json:"any,omitempty"`  // 包含其中任意一个标签
+	None []string `json:"none,omitempty"` // 不包含其中任何一个标签
+}
+
+// apply 将标签条件合并到查询中
+func (f ResultTagFilter) apply(filter bson.M) error {
+	clause := bson.M{}
+	if len(f.Any) > 0 {
+		tags, err := NormalizeTags(f.Any)
+		if err != nil {
+			return err
+		}
+		clause["$in"] = tags
+	}
+	if len(f.None) > 0 {
+		tags, err := NormalizeTags(f.None)
+		if err != nil {
+			return err
+		}
+		clause["$nin"] = tags
+	}
+	if len(clause) > 0 {
+		filter["tags"] = clause
+	}
+	return nil
+}
+
+// TaskResultFilter 构建任务结果列表的查询条件
+func TaskResultFilter(taskID string, resultType models.ResultType, search string, statusCode int, tags ResultTagFilter) (bson.M, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"task_id": objID}
+	if resultType != "" {
+		filter["type"] = resultType
+	}
+
+	// 状态码筛选（主要用于目录扫描结果）
+	if statusCode > 0 {
+		filter["data.status"] = statusCode
+	}
+
+	if err := applySearchFilter(filter, search, taskSearchFields); err != nil {
+		return nil, err
+	}
+	if err := tags.apply(filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// BulkTagSelection 批量打标签的结果范围，指定 IDs 时忽略其他条件
+type BulkTagSelection struct {
+	IDs        []string          `json:"ids"`
+	TaskID     string            `json:"task_id"`
+	Type       models.ResultType `json:"type"`
+	Search     string            `json:"search"`
+	StatusCode int               `json:"status_code"`
+	Tags       ResultTagFilter   `json:"tags"`
+}
+
+// Filter 构建批量操作的查询条件
+func (sel BulkTagSelection) Filter() (bson.M, error) {
+	if len(sel.IDs) > 0 {
+		objIDs := make([]primitive.ObjectID, 0, len(sel.IDs))
+		for _, id := range sel.IDs {
+			objID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return nil, fmt.Errorf("%w: 无效的结果ID %s", ErrInvalidTagSelection, id)
+			}
+			objIDs = append(objIDs, objID)
+		}
+		return bson.M{"_id": bson.M{"$in": objIDs}}, nil
+	}
+	if sel.TaskID == "" {
+		return nil, fmt.Errorf("%w: 需要指定结果ID列表或任务ID", ErrInvalidTagSelection)
+	}
+	filter, err := TaskResultFilter(sel.TaskID, sel.Type, sel.Search, sel.StatusCode, sel.Tags)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSearch) || errors.Is(err, ErrInvalidTag) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: 无效的任务ID", ErrInvalidTagSelection)
+	}
+	return filter, nil
+}
+
+// BulkTagStore 批量打标签依赖的存储操作
+type BulkTagStore interface {
+	// NextIDs 按 _id 升序返回 after 之后（不含）匹配 filter 的结果 ID，最多 limit 个
+	NextIDs(ctx context.Context, filter bson.M, after primitive.ObjectID, limit int) ([]primitive.ObjectID, error)
+	// UpdateMany 更新指定的结果，返回实际修改的文档数
+	UpdateMany(ctx context.Context, ids []primitive.ObjectID, update bson.M) (int64, error)
+}
+
+// ApplyBulkTagUpdate 按 _id 分批更新匹配 filter 的结果，每批使用独立的数据库超时，返回修改的文档数
+func ApplyBulkTagUpdate(store BulkTagStore, filter, update bson.M, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = BulkTagBatchSize
+	}
+
+	var modified int64
+	after := primitive.NilObjectID
+	for {
+		n, last, done, err := applyBulkTagBatch(store, filter, update, after, batchSize)
+		modified += n
+		if err != nil {
+			return modified, err
+		}
+		if done {
+			return modified, nil
+		}
+		after = last
+	}
+}
+
+// applyBulkTagBatch 处理一批结果，done 表示已没有更多结果
+func applyBulkTagBatch(store BulkTagStore, filter, update bson.M, after primitive.ObjectID, batchSize int) (int64, primitive.ObjectID, bool, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	ids, err := store.NextIDs(ctx, filter, after, batchSize)
+	if err != nil {
+		return 0, after, false, err
+	}
+	if len(ids) == 0 {
+		return 0, after, true, nil
+	}
+	n, err := store.UpdateMany(ctx, ids, update)
+	if err != nil {
+		return n, after, false, err
+	}
+	return n, ids[len(ids)-1], len(ids) < batchSize, nil
+}
+
+// BulkAddTag 为选中的结果添加标签，返回修改的结果数
+func (s *ResultService) BulkAddTag(sel BulkTagSelection, tag string) (int64, error) {
+	return s.bulkTag(sel, tag, "$addToSet")
+}
+
+// BulkRemoveTag 从选中的结果移除标签，返回修改的结果数
+func (s *ResultService) BulkRemoveTag(sel BulkTagSelection, tag string) (int64, error) {
+	return s.bulkTag(sel, tag, "$pull")
+}
+
+// bulkTag 构建批量更新；添加时跳过已有该标签的结果，移除时只处理带该标签的结果
+func (s *ResultService) bulkTag(sel BulkTagSelection, tag, op string) (int64, error) {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	filter, err := sel.Filter()
+	if err != nil {
+		return 0, err
+	}
+
+	pending := bson.M{"tags": tag}
+	if op == "$addToSet" {
+		pending = bson.M{"tags": bson.M{"$ne": tag}}
+	}
+	filter = bson.M{"$and": []bson.M{filter, pending}}
+
+	update := bson.M{
+		op:     bson.M{"tags": tag},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+	return ApplyBulkTagUpdate(&mongoBulkTagStore{collection: s.collection}, filter, update, BulkTagBatchSize)
+}
+
+// mongoBulkTagStore 基于扫描结果集合的批量打标签存储
+type mongoBulkTagStore struct {
+	collection *mongo.Collection
+}
+
+// NextIDs 按 _id 升序返回 after 之后匹配的结果 ID
+func (s *mongoBulkTagStore) NextIDs(ctx context.Context, filter bson.M, after primitive.ObjectID, limit int) ([]primitive.ObjectID, error) {
+	query := filter
+	if !after.IsZero() {
+		query = bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$gt": after}}}}
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(docs))
+	for _, d := range docs {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// UpdateMany 按 ID 列表更新结果
+func (s *mongoBulkTagStore) UpdateMany(ctx context.Context, ids []primitive.ObjectID, update bson.M) (int64, error) {
+	res, err := s.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/scanner/core"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ScanNetworkStore 扫描出站网络设置存储，每个工作空间一条
+type ScanNetworkStore interface {
+	// GetScanNetwork 工作空间的设置，未配置时返回 nil
+	GetScanNetwork(ctx context.Context, workspaceID string) (*models.WorkspaceNetwork, error)
+	SaveScanNetwork(ctx context.Context, network *models.WorkspaceNetwork) error
+}
+
+// LoadScanNetwork 读取工作空间的设置，未配置或读取失败时返回空设置（使用系统网络）
+func LoadScanNetwork(store ScanNetworkStore, workspaceID string) *models.WorkspaceNetwork {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	network, err := store.GetScanNetwork(ctx, workspaceID)
+	if err != nil {
+		log.Printf("[TaskExecutor] Failed to load scan network of workspace %s, using system network: %v", workspaceID, err)
+	}
+	if network == nil {
+		return &models.WorkspaceNetwork{WorkspaceID: workspaceID}
+	}
+	return network
+}
+
+// SaveScanNetwork 校验并保存工作空间的设置
+func SaveScanNetwork(store ScanNetworkStore, network *models.WorkspaceNetwork) error {
+	cfg := &core.ScanNetworkConfig{Proxy: network.Proxy, Resolvers: network.Resolvers, DoH: network.DoH}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	network.UpdatedAt = time.Now()
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return store.SaveScanNetwork(ctx, network)
+}
+
+// ValidateTaskNetwork 校验任务的代理和 DNS 设置
+func ValidateTaskNetwork(config *models.TaskConfig) error {
+	return (&core.ScanNetworkConfig{Proxy: config.Proxy, Resolvers: config.Resolvers, DoH: config.DoH}).Validate()
+}
+
+// ValidateTaskHeaders 校验任务的自定义请求头和 Cookie
+func ValidateTaskHeaders(config *models.TaskConfig) error {
+	return core.ValidateScanHeaders(config.CustomHeaders, config.CookieJar)
+}
+
+// ValidateTaskUserAgents 校验任务的 User-Agent 策略和列表
+func ValidateTaskUserAgents(config *models.TaskConfig) error {
+	return core.ValidateUserAgents(config.UserAgentStrategy, config.UserAgents)
+}
+
+// ResolveScanNetwork 合并任务和工作空间的设置：任务设置了代理或 DNS 时覆盖工作空间的对应项，都未设置时返回 nil
+func ResolveScanNetwork(config *models.TaskConfig, workspace *models.WorkspaceNetwork) *core.ScanNetworkConfig {
+	cfg := &core.ScanNetworkConfig{}
+	if workspace != nil {
+		cfg.Proxy, cfg.Resolvers, cfg.DoH = workspace.Proxy, workspace.Resolvers, workspace.DoH
+	}
+	if config.Proxy != "" {
+		cfg.Proxy = config.Proxy
+	}
+	if len(config.Resolvers) > 0 || config.DoH {
+		cfg.Resolvers, cfg.DoH = config.Resolvers, config.DoH
+	}
+	if cfg.Proxy == "" && !cfg.HasResolvers() {
+		return nil
+	}
+	return cfg
+}
+
+// mongoScanNetworkStore 设置的数据库存储
+type mongoScanNetworkStore struct{}
+
+// NewMongoScanNetworkStore 创建数据库设置存储
+func NewMongoScanNetworkStore() ScanNetworkStore {
+	return &mongoScanNetworkStore{}
+}
+
+func (s *mongoScanNetworkStore) GetScanNetwork(ctx context.Context, workspaceID string) (*models.WorkspaceNetwork, error) {
+	var network models.WorkspaceNetwork
+	err := database.GetCollection(models.CollectionScanNetworks).FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&network)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
+
+func (s *mongoScanNetworkStore) SaveScanNetwork(ctx context.Context, network *models.WorkspaceNetwork) error {
+	_, err := database.GetCollection(models.CollectionScanNetworks).ReplaceOne(ctx,
+		bson.M{"_id": network.WorkspaceID}, network, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/scanner/core"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ScanScopeStore 扫描范围存储，每个工作空间一条
+type ScanScopeStore interface {
+	// GetScanScope 工作空间的扫描范围，未配置时返回 nil
+	GetScanScope(ctx context.Context, workspaceID string) (*models.WorkspaceScope, error)
+	SaveScanScope(ctx context.Context, scope *models.WorkspaceScope) error
+}
+
+// LoadScanScope 读取工作空间的扫描范围，未配置或读取失败时返回空范围（不限制）
+func LoadScanScope(store ScanScopeStore, workspaceID string) *models.WorkspaceScope {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	scope, err := store.GetScanScope(ctx, workspaceID)
+	if err != nil {
+		log.Printf("[TaskExecutor] Failed to load scan scope of workspace %s, scanning without workspace scope: %v", workspaceID, err)
+	}
+	if scope == nil {
+		return &models.WorkspaceScope{WorkspaceID: workspaceID}
+	}
+	return scope
+}
+
+// SaveScanScope 校验并保存工作空间的扫描范围
+func SaveScanScope(store ScanScopeStore, scope *models.WorkspaceScope) error {
+	if _, err := core.NewScopeFilter(scope.Include, scope.Exclude); err != nil {
+		return err
+	}
+	scope.UpdatedAt = time.Now()
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return store.SaveScanScope(ctx, scope)
+}
+
+// ValidateTaskScope 校验任务的包含规则（排除规则由 core.ValidateExcludePatterns 校验）
+func ValidateTaskScope(config *models.TaskConfig) error {
+	return core.ValidateScopeIncludes(config.ScopeInclude)
+}
+
+// ResolveScanScope 合并任务和工作空间的扫描范围：任务设置了包含规则时覆盖工作空间的包含规则，
+// 排除规则取两者的并集（任务不能放开工作空间排除的主机）
+func ResolveScanScope(config *models.TaskConfig, workspace *models.WorkspaceScope) (includes, excludes []string) {
+	includes = config.ScopeInclude
+	if len(includes) == 0 && workspace != nil {
+		includes = workspace.Include
+	}
+
+	seen := make(map[string]bool)
+	var lists [][]string
+	if workspace != nil {
+		lists = append(lists, workspace.Exclude)
+	}
+	lists = append(lists, config.ExcludeList)
+	for _, list := range lists {
+		for _, pattern := range list {
+			if pattern != "" && !seen[pattern] {
+				seen[pattern] = true
+				excludes = append(excludes, pattern)
+			}
+		}
+	}
+	return includes, excludes
+}
+
+// mongoScanScopeStore 扫描范围的数据库存储
+type mongoScanScopeStore struct{}
+
+// NewMongoScanScopeStore 创建数据库扫描范围存储
+func NewMongoScanScopeStore() ScanScopeStore {
+	return &mongoScanScopeStore{}
+}
+
+func (s *mongoScanScopeStore) GetScanScope(ctx context.Context, workspaceID string) (*models.WorkspaceScope, error) {
+	var scope models.WorkspaceScope
+	err := database.GetCollection(models.CollectionScanScopes).FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&scope)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &scope, nil
+}
+
+func (s *mongoScanScopeStore) SaveScanScope(ctx context.Context, scope *models.WorkspaceScope) error {
+	_, err := database.GetCollection(models.CollectionScanScopes).ReplaceOne(ctx,
+		bson.M{"_id": scope.WorkspaceID}, scope, options.Replace().SetUpsert(true))
+	return err
+}
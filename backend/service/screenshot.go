@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 页面截图
+// 截图按任务保存在 DefaultScreenshotDir/<task_id>/ 下，路径和失败原因写入同一 URL 的 Web 服务结果
+// （data.screenshot_path、data.screenshot_error）。指纹识别再次写入同一条记录时不会覆盖截图字段；
+// 读取截图时校验文件位于该任务的截图目录中，结果数据被改写也不能读取其他文件
+
+var (
+	// ErrScreenshotNotFound 结果没有截图或文件已不存在
+	ErrScreenshotNotFound = errors.New("截图不存在")
+	// ErrInvalidScreenshotPath 截图路径不在任务的截图目录中
+	ErrInvalidScreenshotPath = errors.New("截图路径无效")
+)
+
+// screenshotFields 只由截图结果写入的 Web 服务字段
+var screenshotFields = map[string]bool{
+	"screenshot_path":  true,
+	"screenshot_error": true,
+	"screenshot_at":    true,
+}
+
+// ScreenshotTaskDir 任务的截图目录
+func ScreenshotTaskDir(taskID string) string {
+	return filepath.Join(pipeline.DefaultScreenshotDir, taskID)
+}
+
+// ScreenshotUpdate 构建截图结果的更新语句：成功时写入路径并清除之前的错误，失败时只记录错误，保留已有的截图
+func ScreenshotUpdate(path, errMsg string) bson.M {
+	now := time.Now()
+	if path == "" {
+		return bson.M{"$set": bson.M{
+			"data.screenshot_error": errMsg,
+			"updated_at":            now,
+		}}
+	}
+	return bson.M{
+		"$set": bson.M{
+			"data.screenshot_path": path,
+			"data.screenshot_at":   now,
+			"updated_at":           now,
+		},
+		"$unset": bson.M{"data.screenshot_error": ""},
+	}
+}
+
+// SetServiceScreenshot 把截图结果合并到同一 URL 的 Web 服务结果，没有对应的结果时不写入
+func (s *ResultService) SetServiceScreenshot(taskID primitive.ObjectID, screenshot pipeline.ScreenshotResult) error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	filter := DedupFilter(&models.ScanResult{
+		TaskID: taskID,
+		Type:   models.ResultTypeService,
+		Data:   bson.M{"url": screenshot.URL},
+	})
+	_, err := s.collection.UpdateOne(ctx, filter, ScreenshotUpdate(screenshot.Path, screenshot.Error))
+	return err
+}
+
+// ResolveTaskScreenshot 校验截图文件位于任务的截图目录中（跟随符号链接），返回文件的绝对路径
+func ResolveTaskScreenshot(taskDir, path string) (string, error) {
+	if path == "" {
+		return "", ErrScreenshotNotFound
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".png") {
+		return "", ErrInvalidScreenshotPath
+	}
+
+	dir, err := filepath.Abs(taskDir)
+	if err != nil {
+		return "", ErrInvalidScreenshotPath
+	}
+	file, err := filepath.Abs(path)
+	if err != nil || !withinDir(dir, file) {
+		return "", ErrInvalidScreenshotPath
+	}
+
+	realFile, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrScreenshotNotFound
+		}
+		return "", err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil || !withinDir(realDir, realFile) {
+		return "", ErrInvalidScreenshotPath
+	}
+	if info, err := os.Stat(realFile); err != nil || !info.Mode().IsRegular() {
+		return "", ErrScreenshotNotFound
+	}
+	return realFile, nil
+}
+
+// withinDir file 是否位于 dir 中（不含 dir 本身）
+func withinDir(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == "." || rel == ".." {
+		return false
+	}
+	return !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// GetTaskScreenshot 获取任务中 Web 服务结果的截图文件，结果不属于该任务时返回 ErrScreenshotNotFound
+func (s *ResultService) GetTaskScreenshot(taskID, resultID string) (string, error) {
+	taskObjID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return "", ErrScreenshotNotFound
+	}
+	resultObjID, err := primitive.ObjectIDFromHex(resultID)
+	if err != nil {
+		return "", ErrScreenshotNotFound
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	var result models.ScanResult
+	err = s.collection.FindOne(ctx, bson.M{
+		"_id":     resultObjID,
+		"task_id": taskObjID,
+		"type":    models.ResultTypeService,
+	}).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", ErrScreenshotNotFound
+		}
+		return "", err
+	}
+
+	path, _ := result.Data["screenshot_path"].(string)
+	return ResolveTaskScreenshot(ScreenshotTaskDir(taskObjID.Hex()), path)
+}
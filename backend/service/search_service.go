@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 保存的搜索
+// 将常用的结果查询（如"带 prod 标签的主机上 >10KB 且不是 .js/.css 的目录扫描结果"）保存下来，
+// 执行时与即席查询接口走同一套校验和查询生成逻辑
+
+// ErrSavedSearchNotFound 搜索不存在或不可见
+var ErrSavedSearchNotFound = errors.New("搜索不存在")
+
+// SearchService 保存的搜索服务
+type SearchService struct {
+	collection    *mongo.Collection
+	resultService *ResultService
+}
+
+// NewSearchService 创建保存的搜索服务
+func NewSearchService() *SearchService {
+	return &SearchService{
+		collection:    database.GetCollection(models.CollectionSavedSearches),
+		resultService: NewResultService(),
+	}
+}
+
+// CanViewSavedSearch 共享的搜索工作空间内可见，私有的仅创建者可见
+// 工作空间本身的访问权限由 AuthorizeWorkspace 校验
+func CanViewSavedSearch(search *models.SavedSearch, userID primitive.ObjectID) bool {
+	return search.Shared || (!userID.IsZero() && search.OwnerID == userID)
+}
+
+// CanEditSavedSearch 只有创建者和管理员可以修改、删除搜索
+func CanEditSavedSearch(search *models.SavedSearch, userID primitive.ObjectID, role string) bool {
+	return role == "admin" || (!userID.IsZero() && search.OwnerID == userID)
+}
+
+// SavedSearchVisibilityQuery 工作空间内用户可见的搜索
+func SavedSearchVisibilityQuery(workspaceID, userID primitive.ObjectID) bson.M {
+	return bson.M{
+		"workspace_id": workspaceID,
+		"$or": []bson.M{
+			{"shared": true},
+			{"owner_id": userID},
+		},
+	}
+}
+
+// CompileSavedSearch 生成保存的搜索对应的查询和排序
+func CompileSavedSearch(search *models.SavedSearch) (bson.M, bson.D, error) {
+	if err := ValidateSavedSearch(search); err != nil {
+		return nil, nil, err
+	}
+	sort, err := BuildResultSort(search.ResultType, search.Sort)
+	if err != nil {
+		return nil, nil, err
+	}
+	return BuildWorkspaceResultQuery(search.WorkspaceID, search.Filter), sort, nil
+}
+
+// ValidateSavedSearch 保存时校验名称、结果类型和条件，条件只能引用白名单字段
+func ValidateSavedSearch(search *models.SavedSearch) error {
+	if strings.TrimSpace(search.Name) == "" {
+		return errors.New("搜索名称不能为空")
+	}
+	if search.Filter.Type == "" {
+		search.Filter.Type = search.ResultType
+	}
+	if search.ResultType == "" {
+		search.ResultType = search.Filter.Type
+	}
+	if search.Filter.Type != search.ResultType {
+		return errors.New("条件的结果类型与搜索的结果类型不一致")
+	}
+	if err := ValidateSearchFilter(search.Filter); err != nil {
+		return err
+	}
+	_, err := BuildResultSort(search.ResultType, search.Sort)
+	return err
+}
+
+// CreateSavedSearch 保存搜索，创建者为当前用户
+func (s *SearchService) CreateSavedSearch(search *models.SavedSearch, userID primitive.ObjectID, role string) error {
+	if err := ValidateSavedSearch(search); err != nil {
+		return err
+	}
+	if err := s.resultService.AuthorizeWorkspace(search.WorkspaceID, userID, role); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	search.ID = primitive.NewObjectID()
+	search.OwnerID = userID
+	search.CreatedAt = time.Now()
+	search.UpdatedAt = time.Now()
+	if _, err := s.collection.InsertOne(ctx, search); err != nil {
+		return errors.New("保存搜索失败")
+	}
+	return nil
+}
+
+// GetSavedSearch 获取当前用户可见的搜索
+func (s *SearchService) GetSavedSearch(id string, userID primitive.ObjectID, role string) (*models.SavedSearch, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("无效的搜索ID")
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	var search models.SavedSearch
+	if err := s.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&search); err != nil {
+		return nil, ErrSavedSearchNotFound
+	}
+	// 私有搜索对其他人表现为不存在
+	if !CanViewSavedSearch(&search, userID) && role != "admin" {
+		return nil, ErrSavedSearchNotFound
+	}
+	if err := s.resultService.AuthorizeWorkspace(search.WorkspaceID, userID, role); err != nil {
+		return nil, err
+	}
+	return &search, nil
+}
+
+// ListSavedSearches 列出工作空间内当前用户可见的搜索
+func (s *SearchService) ListSavedSearches(workspaceID, userID primitive.ObjectID, role string) ([]*models.SavedSearch, error) {
+	if err := s.resultService.AuthorizeWorkspace(workspaceID, userID, role); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cursor, err := s.collection.Find(ctx, SavedSearchVisibilityQuery(workspaceID, userID), opts)
+	if err != nil {
+		return nil, errors.New("查询搜索失败")
+	}
+	defer cursor.Close(ctx)
+
+	searches := make([]*models.SavedSearch, 0)
+	if err := cursor.All(ctx, &searches); err != nil {
+		return nil, errors.New("解析搜索失败")
+	}
+	return searches, nil
+}
+
+// UpdateSavedSearch 更新搜索，工作空间和创建者不可修改
+func (s *SearchService) UpdateSavedSearch(id string, update *models.SavedSearch, userID primitive.ObjectID, role string) (*models.SavedSearch, error) {
+	search, err := s.GetSavedSearch(id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if !CanEditSavedSearch(search, userID, role) {
+		return nil, errors.New("只有创建者可以修改搜索")
+	}
+
+	search.Name = update.Name
+	search.Description = update.Description
+	search.ResultType = update.ResultType
+	search.Filter = update.Filter
+	search.Sort = update.Sort
+	search.Shared = update.Shared
+	if err := ValidateSavedSearch(search); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	search.UpdatedAt = time.Now()
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": search.ID}, bson.M{"$set": bson.M{
+		"name":        search.Name,
+		"description": search.Description,
+		"result_type": search.ResultType,
+		"filter":      search.Filter,
+		"sort":        search.Sort,
+		"shared":      search.Shared,
+		"updated_at":  search.UpdatedAt,
+	}})
+	if err != nil {
+		return nil, errors.New("更新搜索失败")
+	}
+	return search, nil
+}
+
+// DeleteSavedSearch 删除搜索
+func (s *SearchService) DeleteSavedSearch(id string, userID primitive.ObjectID, role string) error {
+	search, err := s.GetSavedSearch(id, userID, role)
+	if err != nil {
+		return err
+	}
+	if !CanEditSavedSearch(search, userID, role) {
+		return errors.New("只有创建者可以删除搜索")
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": search.ID}); err != nil {
+		return errors.New("删除搜索失败")
+	}
+	return nil
+}
+
+// Execute 执行保存的搜索，权限与即席查询一致
+func (s *SearchService) Execute(savedSearchID string, page, pageSize int, userID primitive.ObjectID, role string) ([]models.ScanResult, int64, error) {
+	search, err := s.GetSavedSearch(savedSearchID, userID, role)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.resultService.SearchResults(search.WorkspaceID, search.Filter, search.Sort, page, pageSize)
+}
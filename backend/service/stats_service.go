@@ -0,0 +1,455 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 工作空间统计
+// 仪表盘展示的工作空间级数字：资产总数、漏洞等级分布、技术栈排行、新增资产和每日完成任务数。
+// 子域名、端口、技术栈按工作空间资产统计（跨任务去重），漏洞按扫描结果统计，任务趋势按任务完成时间统计。
+// 每个统计是一条以 workspace_id 开头匹配的聚合，StatsIndexes 为这些匹配条件建立索引，仪表盘加载时不做全集合扫描
+
+// ErrInvalidStatsRange 统计时间范围不合法
+var ErrInvalidStatsRange = errors.New("无效的时间范围，格式为 2006-01-02 或 RFC3339，开始时间需早于结束时间")
+
+const (
+	TopTechnologiesLimit  = 10 // 技术栈排行返回的数量
+	DefaultStatsTrendDays = 7  // 任务趋势未指定开始时间时的天数
+	MaxStatsTrendDays     = 90 // 任务趋势最多返回的天数
+	NewAssetDays          = 7  // 新增资产统计的天数
+)
+
+// SeverityOrder 漏洞等级从高到低，等级分布按此顺序返回
+var SeverityOrder = []string{"critical", "high", "medium", "low", "info"}
+
+// SeverityUnknown 不在 SeverityOrder 中的等级归入该桶，排在最后
+const SeverityUnknown = "unknown"
+
+// StatsRange 统计时间范围，Start 包含、End 不包含，零值表示不限
+type StatsRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// StatsQuery 统计条件
+type StatsQuery struct {
+	WorkspaceID primitive.ObjectID
+	Range       StatsRange
+}
+
+// WorkspaceOverview 工作空间概览，时间范围内最近发现过的资产和范围内发现的漏洞
+type WorkspaceOverview struct {
+	Subdomains      int64     `json:"subdomains"`
+	Ports           int64     `json:"ports"`
+	WebServices     int64     `json:"web_services"`
+	Vulnerabilities int64     `json:"vulnerabilities"`
+	NewAssets       int64     `json:"new_assets"`       // 最近 NewAssetDays 天首次发现的资产
+	NewAssetsSince  time.Time `json:"new_assets_since"` // 新增资产的起始时间
+}
+
+// SeverityCount 单个漏洞等级的数量
+type SeverityCount struct {
+	Severity string `json:"severity"`
+	Count    int64  `json:"count"`
+}
+
+// TechnologyCount 单个技术栈出现的资产数
+type TechnologyCount struct {
+	Name  string `json:"name" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// DailyCount 单日数量，Date 为 UTC 日期 2006-01-02
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// StatsStore 统计数据来源
+type StatsStore interface {
+	// CountAssets 时间范围内最近发现过的资产数，按资产类型分组
+	CountAssets(ctx context.Context, query StatsQuery) (map[models.AssetKind]int64, error)
+	// CountNewAssets since 之后首次发现的资产数
+	CountNewAssets(ctx context.Context, workspaceID primitive.ObjectID, since time.Time) (int64, error)
+	// CountVulnsBySeverity 时间范围内发现的漏洞数，按等级分组
+	CountVulnsBySeverity(ctx context.Context, query StatsQuery) (map[string]int64, error)
+	// CountTechnologies 时间范围内最近发现过的资产的技术栈，按资产数从多到少返回前 limit 个
+	CountTechnologies(ctx context.Context, query StatsQuery, limit int) ([]TechnologyCount, error)
+	// CountCompletedTasks 时间范围内完成的任务数，按 UTC 日期分组
+	CountCompletedTasks(ctx context.Context, query StatsQuery) (map[string]int64, error)
+}
+
+// StatsService 工作空间统计服务
+type StatsService struct {
+	store StatsStore
+}
+
+// NewStatsService 创建统计服务
+func NewStatsService() *StatsService {
+	return NewStatsServiceWithStore(NewMongoStatsStore())
+}
+
+// NewStatsServiceWithStore 使用指定存储创建统计服务
+func NewStatsServiceWithStore(store StatsStore) *StatsService {
+	return &StatsService{store: store}
+}
+
+// ParseStatsRange 解析查询参数中的时间范围，日期格式的结束时间包含当天
+func ParseStatsRange(start, end string) (StatsRange, error) {
+	var r StatsRange
+	var err error
+	if r.Start, err = parseStatsTime(start, false); err != nil {
+		return r, err
+	}
+	if r.End, err = parseStatsTime(end, true); err != nil {
+		return r, err
+	}
+	if !r.Start.IsZero() && !r.End.IsZero() && !r.Start.Before(r.End) {
+		return r, ErrInvalidStatsRange
+	}
+	return r, nil
+}
+
+func parseStatsTime(value string, endOfDay bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, ErrInvalidStatsRange
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// GetWorkspaceOverview 工作空间资产、漏洞总数和最近 NewAssetDays 天的新增资产（截至范围结束时间，未指定时为当前时间）
+func (s *StatsService) GetWorkspaceOverview(workspaceID primitive.ObjectID, r StatsRange) (*WorkspaceOverview, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	query := StatsQuery{WorkspaceID: workspaceID, Range: r}
+
+	assets, err := s.store.CountAssets(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	severities, err := s.store.CountVulnsBySeverity(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	end := r.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	overview := &WorkspaceOverview{
+		Subdomains:     assets[models.AssetKindSubdomain],
+		Ports:          assets[models.AssetKindPort],
+		WebServices:    assets[models.AssetKindWeb],
+		NewAssetsSince: end.AddDate(0, 0, -NewAssetDays),
+	}
+	for _, count := range severities {
+		overview.Vulnerabilities += count
+	}
+	if overview.NewAssets, err = s.store.CountNewAssets(ctx, workspaceID, overview.NewAssetsSince); err != nil {
+		return nil, err
+	}
+	return overview, nil
+}
+
+// GetSeverityBreakdown 漏洞等级分布，按 critical > high > medium > low > info 的顺序返回全部等级，
+// 其他等级合并为 unknown 排在最后（没有时不返回）
+func (s *StatsService) GetSeverityBreakdown(workspaceID primitive.ObjectID, r StatsRange) ([]SeverityCount, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	counts, err := s.store.CountVulnsBySeverity(ctx, StatsQuery{WorkspaceID: workspaceID, Range: r})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]int64)
+	for severity, count := range counts {
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		if severityRank(severity) < 0 {
+			severity = SeverityUnknown
+		}
+		merged[severity] += count
+	}
+	breakdown := make([]SeverityCount, 0, len(SeverityOrder)+1)
+	for _, severity := range SeverityOrder {
+		breakdown = append(breakdown, SeverityCount{Severity: severity, Count: merged[severity]})
+	}
+	if merged[SeverityUnknown] > 0 {
+		breakdown = append(breakdown, SeverityCount{Severity: SeverityUnknown, Count: merged[SeverityUnknown]})
+	}
+	return breakdown, nil
+}
+
+// severityRank 等级在 SeverityOrder 中的位置，未知等级返回 -1
+func severityRank(severity string) int {
+	for i, s := range SeverityOrder {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetTopTechnologies 资产数最多的 TopTechnologiesLimit 个技术栈，数量相同时按名称排序
+func (s *StatsService) GetTopTechnologies(workspaceID primitive.ObjectID, r StatsRange) ([]TechnologyCount, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	techs, err := s.store.CountTechnologies(ctx, StatsQuery{WorkspaceID: workspaceID, Range: r}, TopTechnologiesLimit)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(techs, func(i, j int) bool {
+		if techs[i].Count != techs[j].Count {
+			return techs[i].Count > techs[j].Count
+		}
+		return techs[i].Name < techs[j].Name
+	})
+	if len(techs) > TopTechnologiesLimit {
+		techs = techs[:TopTechnologiesLimit]
+	}
+	if techs == nil {
+		techs = []TechnologyCount{}
+	}
+	return techs, nil
+}
+
+// GetDailyTaskCounts 每日完成的任务数，范围内每天一项（没有任务的日期为 0）。
+// 未指定结束时间时截至今天，未指定开始时间时为最近 DefaultStatsTrendDays 天，最多 MaxStatsTrendDays 天
+func (s *StatsService) GetDailyTaskCounts(workspaceID primitive.ObjectID, r StatsRange) ([]DailyCount, error) {
+	r = trendRange(r)
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	counts, err := s.store.CountCompletedTasks(ctx, StatsQuery{WorkspaceID: workspaceID, Range: r})
+	if err != nil {
+		return nil, err
+	}
+
+	var daily []DailyCount
+	for day := r.Start; day.Before(r.End); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		daily = append(daily, DailyCount{Date: date, Count: counts[date]})
+	}
+	return daily, nil
+}
+
+// trendRange 任务趋势的范围对齐到 UTC 整天并补全默认值
+func trendRange(r StatsRange) StatsRange {
+	end := r.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	end = end.UTC()
+	if day := end.Truncate(24 * time.Hour); !day.Equal(end) {
+		end = day.AddDate(0, 0, 1)
+	}
+
+	earliest := end.AddDate(0, 0, -MaxStatsTrendDays)
+	start := r.Start
+	if start.IsZero() {
+		start = end.AddDate(0, 0, -DefaultStatsTrendDays)
+	}
+	start = start.UTC().Truncate(24 * time.Hour)
+	if start.Before(earliest) {
+		start = earliest
+	}
+	return StatsRange{Start: start, End: end}
+}
+
+// StatsIndexes 统计聚合使用的索引，按集合名称分组
+func StatsIndexes() map[string][]mongo.IndexModel {
+	return map[string][]mongo.IndexModel{
+		models.CollectionAssets: {
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "last_seen", Value: -1}}},
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "first_seen", Value: -1}}},
+		},
+		models.CollectionScanResults: {
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		models.CollectionTasks: {
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "status", Value: 1}, {Key: "completed_at", Value: -1}}},
+		},
+	}
+}
+
+// EnsureStatsIndexes 创建统计聚合使用的索引，已存在的索引不会重复创建
+func EnsureStatsIndexes() error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	for name, indexes := range StatsIndexes() {
+		if _, err := database.GetCollection(name).Indexes().CreateMany(ctx, indexes, options.CreateIndexes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeCondition 时间字段的范围条件，不限时返回 nil
+func rangeCondition(r StatsRange) bson.M {
+	condition := bson.M{}
+	if !r.Start.IsZero() {
+		condition["$gte"] = r.Start
+	}
+	if !r.End.IsZero() {
+		condition["$lt"] = r.End
+	}
+	if len(condition) == 0 {
+		return nil
+	}
+	return condition
+}
+
+// statsMatch 工作空间 + 固定条件 + 时间范围的匹配条件
+func statsMatch(query StatsQuery, timeField string, fields bson.M) bson.M {
+	match := bson.M{"workspace_id": query.WorkspaceID}
+	for k, v := range fields {
+		match[k] = v
+	}
+	if condition := rangeCondition(query.Range); condition != nil {
+		match[timeField] = condition
+	}
+	return match
+}
+
+// AssetCountPipeline 资产按类型计数的聚合（资产集合）
+func AssetCountPipeline(query StatsQuery) []bson.M {
+	return []bson.M{
+		{"$match": statsMatch(query, "last_seen", nil)},
+		{"$group": bson.M{"_id": "$kind", "count": bson.M{"$sum": 1}}},
+	}
+}
+
+// NewAssetFilter 新增资产的查询条件（资产集合）
+func NewAssetFilter(workspaceID primitive.ObjectID, since time.Time) bson.M {
+	return bson.M{"workspace_id": workspaceID, "first_seen": bson.M{"$gte": since}}
+}
+
+// SeverityPipeline 漏洞按等级计数的聚合（扫描结果集合），等级统一转为小写
+func SeverityPipeline(query StatsQuery) []bson.M {
+	return []bson.M{
+		{"$match": statsMatch(query, "created_at", bson.M{"type": models.ResultTypeVuln})},
+		{"$group": bson.M{"_id": bson.M{"$toLower": "$data.severity"}, "count": bson.M{"$sum": 1}}},
+	}
+}
+
+// TechnologyPipeline 技术栈按资产数排行的聚合（资产集合）
+func TechnologyPipeline(query StatsQuery, limit int) []bson.M {
+	return []bson.M{
+		{"$match": statsMatch(query, "last_seen", nil)},
+		{"$unwind": "$technologies"},
+		{"$group": bson.M{"_id": "$technologies", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": limit},
+	}
+}
+
+// DailyTaskPipeline 完成任务按 UTC 日期计数的聚合（任务集合）
+func DailyTaskPipeline(query StatsQuery) []bson.M {
+	return []bson.M{
+		{"$match": statsMatch(query, "completed_at", bson.M{"status": models.TaskStatusCompleted})},
+		{"$group": bson.M{
+			"_id":   bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$completed_at"}},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+}
+
+// mongoStatsStore 统计的数据库实现
+type mongoStatsStore struct{}
+
+// NewMongoStatsStore 创建数据库统计存储
+func NewMongoStatsStore() StatsStore {
+	return &mongoStatsStore{}
+}
+
+// statsBucket 分组计数的聚合结果
+type statsBucket struct {
+	ID    string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// aggregateBuckets 执行分组计数的聚合
+func aggregateBuckets(ctx context.Context, collection string, pipeline []bson.M) ([]statsBucket, error) {
+	cursor, err := database.GetCollection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var buckets []statsBucket
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (s *mongoStatsStore) CountAssets(ctx context.Context, query StatsQuery) (map[models.AssetKind]int64, error) {
+	buckets, err := aggregateBuckets(ctx, models.CollectionAssets, AssetCountPipeline(query))
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[models.AssetKind]int64, len(buckets))
+	for _, b := range buckets {
+		counts[models.AssetKind(b.ID)] = b.Count
+	}
+	return counts, nil
+}
+
+func (s *mongoStatsStore) CountNewAssets(ctx context.Context, workspaceID primitive.ObjectID, since time.Time) (int64, error) {
+	return database.GetCollection(models.CollectionAssets).CountDocuments(ctx, NewAssetFilter(workspaceID, since))
+}
+
+func (s *mongoStatsStore) CountVulnsBySeverity(ctx context.Context, query StatsQuery) (map[string]int64, error) {
+	return bucketCounts(aggregateBuckets(ctx, models.CollectionScanResults, SeverityPipeline(query)))
+}
+
+func (s *mongoStatsStore) CountTechnologies(ctx context.Context, query StatsQuery, limit int) ([]TechnologyCount, error) {
+	cursor, err := database.GetCollection(models.CollectionAssets).Aggregate(ctx, TechnologyPipeline(query, limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var techs []TechnologyCount
+	if err := cursor.All(ctx, &techs); err != nil {
+		return nil, err
+	}
+	return techs, nil
+}
+
+func (s *mongoStatsStore) CountCompletedTasks(ctx context.Context, query StatsQuery) (map[string]int64, error) {
+	return bucketCounts(aggregateBuckets(ctx, models.CollectionTasks, DailyTaskPipeline(query)))
+}
+
+// bucketCounts 分组结果转为 分组键 -> 数量
+func bucketCounts(buckets []statsBucket, err error) (map[string]int64, error) {
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(buckets))
+	for _, b := range buckets {
+		counts[b.ID] += b.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/portscan"
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// 任务工具可用性检查
+// 外部工具缺失时对应模块在执行时直接跳过，只在服务日志中可见。
+// 创建任务时按任务的流水线配置检查每个模块依赖的工具，返回可用性和模块依赖关系的提示。
+
+// ErrNoAvailableModule 所选模块依赖的工具均不可用
+var ErrNoAvailableModule = errors.New("所选模块依赖的工具均不可用")
+
+// ToolCapability 工具的可用性
+type ToolCapability struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Path      string `json:"path,omitempty"`     // 找到的路径，未找到时为查找的路径
+	Builtin   bool   `json:"builtin,omitempty"`  // 内置实现，无需外部程序
+	Optional  bool   `json:"optional,omitempty"` // 缺失时模块仍可运行
+}
+
+// ModuleCapability 流水线模块的可用性，必需的工具都可用时模块可用
+type ModuleCapability struct {
+	Module    string           `json:"module"`
+	Available bool             `json:"available"`
+	Tools     []ToolCapability `json:"tools,omitempty"`
+}
+
+// CapabilityReport 任务的工具可用性报告
+type CapabilityReport struct {
+	Modules  []ModuleCapability `json:"modules"`
+	Warnings []string           `json:"warnings,omitempty"`
+}
+
+// NoneAvailable 启用的模块全部不可用
+func (r *CapabilityReport) NoneAvailable() bool {
+	if len(r.Modules) == 0 {
+		return false
+	}
+	for _, m := range r.Modules {
+		if m.Available {
+			return false
+		}
+	}
+	return true
+}
+
+// Module 按名称查找模块，未启用时返回 nil
+func (r *CapabilityReport) Module(name string) *ModuleCapability {
+	for i := range r.Modules {
+		if r.Modules[i].Module == name {
+			return &r.Modules[i]
+		}
+	}
+	return nil
+}
+
+// moduleTool 模块依赖的工具
+type moduleTool struct {
+	name     string
+	builtin  bool
+	optional bool
+	anyOf    bool                               // 与模块中其他 anyOf 的工具互为备选，其中一个可用即可
+	lookPath bool                               // 工具目录中没有时在 PATH 中查找，与扫描器的查找方式一致
+	find     func(tm *core.ToolsManager) string // 扫描器自己的查找方式（如浏览器有多个名称），设置时忽略 lookPath
+	check    func(path string) bool             // 扫描器的可用性检查，为 nil 时只检查文件是否存在
+}
+
+// pipelineModules 流水线模块及其依赖的工具，顺序与流水线一致
+var pipelineModules = []struct {
+	name    string
+	enabled func(c *pipeline.PipelineConfig) bool
+	tools   []moduleTool
+}{
+	{"subdomain_scan", func(c *pipeline.PipelineConfig) bool { return c.SubdomainScan }, []moduleTool{
+		{name: "ksubdomain", builtin: true},
+		{name: "subfinder", optional: true},
+	}},
+	{"port_scan", func(c *pipeline.PipelineConfig) bool { return c.PortScan }, []moduleTool{
+		{name: "gogo", optional: true, lookPath: true, check: func(path string) bool { return portscan.NewGoGoScannerWithPath(path).IsAvailable() }},
+		{name: "tcp-connect", builtin: true}, // gogo 缺失时使用的内置 TCP 连接扫描
+	}},
+	{"fingerprint", func(c *pipeline.PipelineConfig) bool { return c.Fingerprint }, []moduleTool{
+		{name: "httpx", builtin: true},
+	}},
+	{"vuln_scan", func(c *pipeline.PipelineConfig) bool { return c.VulnScan }, []moduleTool{
+		{name: "vulnscan", builtin: true},
+		{name: "nuclei", optional: true, lookPath: true},
+	}},
+	{"web_crawler", func(c *pipeline.PipelineConfig) bool { return c.WebCrawler }, []moduleTool{
+		// katana 不可用时爬虫模块使用 rad
+		{name: "katana", anyOf: true, check: func(path string) bool { return (&webscan.KatanaScanner{BinPath: path}).IsAvailable() }},
+		{name: "rad", anyOf: true, check: func(path string) bool { return (&webscan.RadScanner{BinPath: path}).IsAvailable() }},
+	}},
+	{"dir_scan", func(c *pipeline.PipelineConfig) bool { return c.DirScan }, []moduleTool{
+		{name: "spray", check: func(path string) bool { return (&webscan.SprayScanner{BinPath: path}).IsAvailable() }},
+	}},
+	{"screenshot", func(c *pipeline.PipelineConfig) bool { return c.Screenshot }, []moduleTool{
+		{name: "chrome", find: webscan.FindScreenshotBrowser, check: func(path string) bool { return (&webscan.ScreenshotCapturer{BinPath: path}).IsAvailable() }},
+	}},
+	{"endpoint_extraction", func(c *pipeline.PipelineConfig) bool { return c.EndpointExtraction }, nil},
+	{"sensitive_scan", func(c *pipeline.PipelineConfig) bool { return c.SensitiveScan }, nil},
+}
+
+// CheckPipelineCapabilities 检查流水线配置启用的模块依赖的工具
+func CheckPipelineCapabilities(tm *core.ToolsManager, config *pipeline.PipelineConfig) *CapabilityReport {
+	report := &CapabilityReport{Modules: []ModuleCapability{}}
+	if config == nil {
+		return report
+	}
+
+	for _, m := range pipelineModules {
+		if !m.enabled(config) {
+			continue
+		}
+		module := ModuleCapability{Module: m.name, Available: true}
+		var alternatives []ToolCapability
+		for _, tool := range m.tools {
+			capability := probeTool(tm, tool)
+			module.Tools = append(module.Tools, capability)
+			if tool.anyOf {
+				alternatives = append(alternatives, capability)
+				continue
+			}
+			if capability.Available {
+				continue
+			}
+			if tool.optional {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s 的可选工具 %s 未找到（%s）", m.name, tool.name, capability.Path))
+				continue
+			}
+			module.Available = false
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s 不可用，执行时将跳过：未找到 %s（%s）", m.name, tool.name, capability.Path))
+		}
+		if len(alternatives) > 0 && !anyToolAvailable(alternatives) {
+			module.Available = false
+			var missing []string
+			for _, capability := range alternatives {
+				missing = append(missing, fmt.Sprintf("%s（%s）", capability.Name, capability.Path))
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s 不可用，执行时将跳过：未找到 %s", m.name, strings.Join(missing, " 或 ")))
+		}
+		report.Modules = append(report.Modules, module)
+	}
+
+	if config.SubdomainCheckTakeover && !config.SubdomainScan {
+		report.Warnings = append(report.Warnings, "已选择子域名接管检测但未启用子域名扫描，接管检测不会执行")
+	}
+	if (config.WebCrawler || config.DirScan || config.VulnScan) && !config.Fingerprint {
+		report.Warnings = append(report.Warnings, "爬虫、目录扫描和漏洞扫描的输入来自指纹识别，未启用指纹识别时不会执行")
+	}
+	if config.Screenshot && !config.Fingerprint {
+		report.Warnings = append(report.Warnings, "截图的输入来自指纹识别，未启用指纹识别时不会执行")
+	}
+	if config.EndpointExtraction && !config.WebCrawler && !config.DirScan {
+		report.Warnings = append(report.Warnings, "接口提取的输入来自爬虫和目录扫描，两者都未启用时不会执行")
+	}
+	return report
+}
+
+// CheckTaskCapabilities 按任务类型（自定义任务按 scan_types）检查工具可用性
+func CheckTaskCapabilities(tm *core.ToolsManager, task *models.Task) *CapabilityReport {
+	config := taskPipelineConfig(task)
+	if config == nil {
+		return &CapabilityReport{Modules: []ModuleCapability{}, Warnings: []string{"未知的任务类型: " + string(task.Type)}}
+	}
+	report := CheckPipelineCapabilities(tm, config)
+	if task.Type == models.TaskTypeCustom {
+		report.Warnings = append(customScanTypeWarnings(task.Config.ScanTypes), report.Warnings...)
+	}
+	return report
+}
+
+// customScanTypes 自定义任务支持的扫描类型
+var customScanTypes = map[string]bool{
+	"subdomain": true, "takeover": true, "port_scan": true, "fingerprint": true, "service_detect": true,
+	"crawler": true, "dir_scan": true, "vuln_scan": true, "sensitive": true, "screenshot": true,
+	"endpoint": true,
+}
+
+// customScanTypeWarnings 自定义任务的扫描类型提示：未知的类型、自动启用的依赖模块
+func customScanTypeWarnings(scanTypes []string) []string {
+	var warnings []string
+	selected := make(map[string]bool)
+	for _, t := range scanTypes {
+		if !customScanTypes[t] {
+			warnings = append(warnings, "未知的扫描类型: "+t)
+			continue
+		}
+		selected[t] = true
+	}
+	if len(selected) == 0 {
+		return append(warnings, "未选择任何扫描类型")
+	}
+
+	if selected["takeover"] && !selected["subdomain"] {
+		warnings = append(warnings, "已选择子域名接管检测但未选择子域名扫描，将自动启用子域名扫描")
+	}
+	needsWeb := selected["crawler"] || selected["dir_scan"] || selected["vuln_scan"]
+	if needsWeb && !selected["port_scan"] {
+		warnings = append(warnings, "爬虫、目录扫描和漏洞扫描需要先发现 Web 服务，将自动启用端口扫描")
+	}
+	if needsWeb && !selected["fingerprint"] && !selected["service_detect"] {
+		warnings = append(warnings, "爬虫、目录扫描和漏洞扫描需要先识别 Web 服务，将自动启用指纹识别")
+	}
+	return warnings
+}
+
+// anyToolAvailable 备选工具中是否有可用的
+func anyToolAvailable(tools []ToolCapability) bool {
+	for _, tool := range tools {
+		if tool.Available {
+			return true
+		}
+	}
+	return false
+}
+
+// probeTool 查找工具并调用扫描器的可用性检查
+func probeTool(tm *core.ToolsManager, tool moduleTool) ToolCapability {
+	capability := ToolCapability{Name: tool.name, Builtin: tool.builtin, Optional: tool.optional}
+	if tool.builtin {
+		capability.Available = true
+		return capability
+	}
+
+	var path string
+	if tool.find != nil {
+		path = tool.find(tm)
+	} else {
+		path = tm.GetToolPath(tool.name)
+	}
+	if path == "" && tool.lookPath && tool.find == nil {
+		path, _ = exec.LookPath(tool.name)
+	}
+	if path == "" {
+		capability.Path = tm.ExpectedToolPath(tool.name)
+		return capability
+	}
+	capability.Path = path
+	if tool.check != nil {
+		capability.Available = tool.check(path)
+	} else {
+		capability.Available = core.FileExists(path)
+	}
+	return capability
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 任务链
+// 任务成功完成后按 follow_up 配置筛选自身结果作为目标，自动创建并入队子任务
+// 例如：先对整个组织做子域名扫描，再只对带特定标签的子域名做全量扫描
+
+// DefaultChainMaxDepth 任务链默认最大深度
+const DefaultChainMaxDepth = 2
+
+// maxChainDepthLimit 任务链允许配置的最大深度
+const maxChainDepthLimit = 5
+
+// ChainStore 任务链依赖的存储操作
+type ChainStore interface {
+	// FindResults 按查询条件获取任务结果
+	FindResults(ctx context.Context, taskID primitive.ObjectID, filter models.ResultFilter) ([]models.ScanResult, error)
+	// GetTemplate 获取任务模板
+	GetTemplate(ctx context.Context, templateID string) (*models.TaskTemplate, error)
+	// CreateChildTask 创建并入队子任务，同时在父任务上记录子任务 ID
+	CreateChildTask(ctx context.Context, parent, child *models.Task) error
+	// AuthorizeFollowUp 校验任务创建者仍可以在工作空间中创建任务并使用模板，template 为 nil 表示不使用模板
+	AuthorizeFollowUp(ctx context.Context, creator, workspaceID primitive.ObjectID, template *models.TaskTemplate) error
+}
+
+// ValidateFollowUp 校验后续任务配置
+func ValidateFollowUp(spec *models.FollowUpSpec) error {
+	for depth := 1; spec != nil; depth++ {
+		if err := ValidateResultFilter(spec.Filter); err != nil {
+			return fmt.Errorf("后续任务筛选条件无效: %w", err)
+		}
+		if spec.MaxDepth < 0 || spec.MaxDepth > maxChainDepthLimit {
+			return fmt.Errorf("任务链深度必须在 0-%d 之间", maxChainDepthLimit)
+		}
+		if depth > maxChainDepthLimit {
+			return fmt.Errorf("任务链深度不能超过 %d", maxChainDepthLimit)
+		}
+		if spec.WorkspaceID != "" {
+			if _, err := primitive.ObjectIDFromHex(spec.WorkspaceID); err != nil {
+				return fmt.Errorf("无效的工作空间ID: %s", spec.WorkspaceID)
+			}
+		}
+		spec = spec.Next
+	}
+	return nil
+}
+
+// AuthorizeFollowUp 创建或修改任务时校验任务链每一级的权限：后续任务的工作空间需要编辑权限，模板需要可见
+// workspaceID 为父任务的工作空间，未指定工作空间的后续任务沿用上一级的工作空间
+func (s *TaskService) AuthorizeFollowUp(workspaceID primitive.ObjectID, spec *models.FollowUpSpec, userID primitive.ObjectID, role string) error {
+	for ; spec != nil; spec = spec.Next {
+		if spec.WorkspaceID != "" {
+			wsID, err := primitive.ObjectIDFromHex(spec.WorkspaceID)
+			if err != nil {
+				return fmt.Errorf("无效的工作空间ID: %s", spec.WorkspaceID)
+			}
+			workspaceID = wsID
+		}
+		var template *models.TaskTemplate
+		if spec.TemplateID != "" {
+			t, err := s.GetTaskTemplate(spec.TemplateID)
+			if err != nil {
+				return ErrTaskTemplateNotFound
+			}
+			template = t
+		}
+		if err := s.access.AuthorizeFollowUpTarget(workspaceID, template, userID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpawnFollowUp 根据父任务的 follow_up 配置创建子任务
+// 只有成功完成的任务才会创建子任务；没有匹配结果时不创建，返回 nil
+func SpawnFollowUp(ctx context.Context, store ChainStore, parent *models.Task) (*models.Task, error) {
+	spec := parent.FollowUp
+	if spec == nil {
+		return nil, nil
+	}
+	if parent.Status != models.TaskStatusCompleted {
+		return nil, fmt.Errorf("任务 %s 状态为 %s，不创建后续任务", parent.ID.Hex(), parent.Status)
+	}
+
+	maxDepth := spec.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultChainMaxDepth
+	}
+	if parent.ChainDepth+1 > maxDepth {
+		log.Printf("[TaskChain] Task %s reached chain depth limit %d, follow-up skipped", parent.ID.Hex(), maxDepth)
+		return nil, nil
+	}
+
+	results, err := store.FindResults(ctx, parent.ID, spec.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("查询父任务结果失败: %w", err)
+	}
+	targets := materializeTargets(results, spec.Filter)
+	if len(targets) == 0 {
+		log.Printf("[TaskChain] Task %s follow-up matched no results, child not created", parent.ID.Hex())
+		return nil, nil
+	}
+
+	child := &models.Task{
+		WorkspaceID:  parent.WorkspaceID,
+		Name:         spec.Name,
+		Description:  fmt.Sprintf("由任务 %s 的结果自动创建", parent.Name),
+		Type:         parent.Type,
+		Targets:      targets,
+		TargetType:   parent.TargetType,
+		Config:       parent.Config,
+		FollowUp:     spec.Next,
+		ParentTaskID: parent.ID,
+		ChainDepth:   parent.ChainDepth + 1,
+		CreatedBy:    parent.CreatedBy,
+		Tags:         parent.Tags,
+		ResultStats:  models.TaskResultStats{TotalTargets: len(targets)},
+	}
+	if child.Name == "" {
+		child.Name = fmt.Sprintf("%s - 后续任务", parent.Name)
+	}
+	if spec.WorkspaceID != "" {
+		if wsID, err := primitive.ObjectIDFromHex(spec.WorkspaceID); err == nil {
+			child.WorkspaceID = wsID
+		}
+	}
+	var template *models.TaskTemplate
+	if spec.TemplateID != "" {
+		template, err = store.GetTemplate(ctx, spec.TemplateID)
+		if err != nil {
+			return nil, fmt.Errorf("获取后续任务模板失败: %w", err)
+		}
+		if template == nil {
+			return nil, fmt.Errorf("获取后续任务模板失败: %w", ErrTaskTemplateNotFound)
+		}
+		child.Type = template.Type
+		child.Config = CopyTaskConfig(template.Config)
+		child.TemplateID = template.ID
+	}
+	// 父任务执行期间创建者的成员权限可能已被收回，按创建者当前的权限重新校验
+	if err := store.AuthorizeFollowUp(ctx, parent.CreatedBy, child.WorkspaceID, template); err != nil {
+		return nil, fmt.Errorf("任务创建者无权创建后续任务: %w", err)
+	}
+	// 目标来自父任务结果，类型由结果类型决定
+	if targetType := chainTargetType(spec.Filter); targetType != "" {
+		child.TargetType = targetType
+	}
+
+	if err := store.CreateChildTask(ctx, parent, child); err != nil {
+		return nil, fmt.Errorf("创建后续任务失败: %w", err)
+	}
+	log.Printf("[TaskChain] Task %s spawned follow-up %s with %d targets (depth %d)",
+		parent.ID.Hex(), child.ID.Hex(), len(targets), child.ChainDepth)
+	return child, nil
+}
+
+// materializeTargets 将结果转换为去重后的目标列表，保持结果顺序
+func materializeTargets(results []models.ScanResult, filter models.ResultFilter) []string {
+	seen := make(map[string]bool)
+	var targets []string
+	for i := range results {
+		target := ResultTarget(&results[i], filter)
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+		if filter.Limit > 0 && len(targets) >= filter.Limit {
+			break
+		}
+	}
+	return targets
+}
+
+// chainTargetType 根据结果类型确定子任务的目标类型
+func chainTargetType(filter models.ResultFilter) string {
+	if filter.TargetField != "" {
+		return ""
+	}
+	switch filter.Type {
+	case models.ResultTypeSubdomain, models.ResultTypeTakeover:
+		return "domain"
+	case models.ResultTypePort:
+		return "ip"
+	case models.ResultTypeService, models.ResultTypeURL, models.ResultTypeCrawler, models.ResultTypeDirScan, models.ResultTypeSensitive:
+		return "url"
+	}
+	return ""
+}
+
+// mongoChainStore 基于 MongoDB 的任务链存储
+type mongoChainStore struct {
+	taskService   *TaskService
+	resultService *ResultService
+}
+
+// NewChainStore 创建任务链存储
+func NewChainStore(taskService *TaskService, resultService *ResultService) ChainStore {
+	return &mongoChainStore{taskService: taskService, resultService: resultService}
+}
+
+func (s *mongoChainStore) FindResults(ctx context.Context, taskID primitive.ObjectID, filter models.ResultFilter) ([]models.ScanResult, error) {
+	return s.resultService.QueryResults(taskID.Hex(), filter)
+}
+
+func (s *mongoChainStore) GetTemplate(ctx context.Context, templateID string) (*models.TaskTemplate, error) {
+	return s.taskService.GetTaskTemplate(templateID)
+}
+
+func (s *mongoChainStore) AuthorizeFollowUp(ctx context.Context, creator, workspaceID primitive.ObjectID, template *models.TaskTemplate) error {
+	user, err := NewUserService().GetUserByID(creator.Hex())
+	if err != nil {
+		return err
+	}
+	return s.taskService.access.AuthorizeFollowUpTarget(workspaceID, template, creator, user.Role)
+}
+
+func (s *mongoChainStore) CreateChildTask(ctx context.Context, parent, child *models.Task) error {
+	if err := s.taskService.CreateTask(child); err != nil {
+		return err
+	}
+
+	_, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{"_id": parent.ID},
+		bson.M{
+			"$addToSet": bson.M{"child_task_ids": child.ID},
+			"$set":      bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("记录子任务失败: %w", err)
+	}
+	parent.ChildTaskIDs = append(parent.ChildTaskIDs, child.ID)
+	return nil
+}
+
+// spawnFollowUp 任务完成后创建后续任务
+// 重新读取任务状态，确保完成前被取消的任务不会创建子任务
+func (e *TaskExecutor) spawnFollowUp(task *models.Task) {
+	if task.FollowUp == nil {
+		return
+	}
+
+	current, err := e.taskService.GetTaskByID(task.ID.Hex())
+	if err != nil || current == nil {
+		log.Printf("[TaskChain] Failed to reload task %s: %v", task.ID.Hex(), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	child, err := SpawnFollowUp(ctx, NewChainStore(e.taskService, e.resultService), current)
+	if err != nil {
+		log.Printf("[TaskChain] Follow-up for task %s failed: %v", task.ID.Hex(), err)
+		e.taskService.AddTaskLog(task.ID.Hex(), "error", "创建后续任务失败", err.Error())
+		return
+	}
+	if child != nil {
+		e.taskService.AddTaskLog(task.ID.Hex(), "info",
+			fmt.Sprintf("已创建后续任务 %s，目标数 %d", child.ID.Hex(), len(child.Targets)), "")
+	}
+}
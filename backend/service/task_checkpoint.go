@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 任务断点续扫
+// 执行过程中记录各模块已完成的目标（子域名枚举按根域名、端口扫描按主机），
+// 暂停或失败的任务带 resume 标记重新入队时，已完成的目标不再扫描，
+// 之前保存的子域名、端口结果作为后续模块的输入，进度从中断时的进度开始
+
+// CheckpointStore 断点存储
+type CheckpointStore interface {
+	// LoadCheckpoint 读取任务断点，没有断点时返回 nil
+	LoadCheckpoint(ctx context.Context, taskID primitive.ObjectID) (*models.TaskCheckpoint, error)
+	// SaveCheckpoint 追加已完成的目标并记录进度
+	SaveCheckpoint(ctx context.Context, taskID primitive.ObjectID, entries []pipeline.CheckpointEntry, progress int) error
+	// DeleteCheckpoint 删除任务断点（全新执行时）
+	DeleteCheckpoint(ctx context.Context, taskID primitive.ObjectID) error
+	// LoadResults 读取任务已保存的指定类型结果
+	LoadResults(ctx context.Context, taskID primitive.ObjectID, types []models.ResultType) ([]*models.ScanResult, error)
+}
+
+// LoadResumeState 读取断点和之前保存的结果，构建恢复执行的流水线输入
+func LoadResumeState(ctx context.Context, store CheckpointStore, taskID primitive.ObjectID) (*pipeline.ResumeState, error) {
+	state := &pipeline.ResumeState{}
+	checkpoint, err := store.LoadCheckpoint(ctx, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务断点失败: %w", err)
+	}
+	if checkpoint == nil {
+		return state, nil
+	}
+
+	state.Progress = checkpoint.Progress
+	var types []models.ResultType
+	for module, keys := range checkpoint.Completed {
+		for _, key := range keys {
+			state.Completed = append(state.Completed, pipeline.CheckpointEntry{Module: module, Key: key})
+		}
+		switch {
+		case len(keys) == 0:
+		case module == pipeline.CheckpointSubdomainScan:
+			types = append(types, models.ResultTypeSubdomain)
+		case module == pipeline.CheckpointPortScan:
+			types = append(types, models.ResultTypePort)
+		}
+	}
+	if len(types) == 0 {
+		return state, nil
+	}
+
+	results, err := store.LoadResults(ctx, taskID, types)
+	if err != nil {
+		return nil, fmt.Errorf("读取已保存的结果失败: %w", err)
+	}
+	for _, r := range results {
+		switch r.Type {
+		case models.ResultTypeSubdomain:
+			state.Subdomains = append(state.Subdomains, subdomainFromResult(r))
+		case models.ResultTypePort:
+			state.Ports = append(state.Ports, pipeline.PortAlive{
+				Host:     dataString(r.Data, "host"),
+				IP:       dataString(r.Data, "ip"),
+				Port:     dataString(r.Data, "port"),
+				Service:  dataString(r.Data, "service"),
+				Protocol: dataString(r.Data, "protocol"),
+				TLS:      dataBool(r.Data, "tls"),
+			})
+		}
+	}
+	return state, nil
+}
+
+// subdomainFromResult 由保存的子域名结果还原流水线结果
+func subdomainFromResult(r *models.ScanResult) pipeline.SubdomainResult {
+	domain := dataString(r.Data, "domain")
+	root := dataString(r.Data, "root_domain")
+	if root == "" {
+		root = domain
+	}
+	return pipeline.SubdomainResult{
+		Host:         dataString(r.Data, "subdomain"),
+		Domain:       domain,
+		RootDomain:   root,
+		IPs:          dataStrings(r.Data, "ips"),
+		CNAMEs:       dataStrings(r.Data, "cnames"),
+		Source:       r.Source,
+		Title:        dataString(r.Data, "title"),
+		StatusCode:   dataInt(r.Data, "status_code"),
+		WebServer:    dataString(r.Data, "web_server"),
+		Technologies: dataStrings(r.Data, "technologies"),
+		CDN:          dataBool(r.Data, "cdn"),
+		CDNName:      dataString(r.Data, "cdn_name"),
+		URL:          dataString(r.Data, "url"),
+		Excluded:     dataBool(r.Data, "excluded"),
+		Resolution:   dataString(r.Data, "resolution"),
+		SaaSProvider: dataString(r.Data, "saas_provider"),
+		SaaSCategory: dataString(r.Data, "saas_category"),
+		SaaSHandling: dataString(r.Data, "saas_handling"),
+		SkipReason:   dataString(r.Data, "skip_reason"),
+	}
+}
+
+// dataString 读取结果字段，兼容从 MongoDB 读出的数值类型
+func dataString(data bson.M, key string) string {
+	switch v := data[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// dataStrings 读取字符串数组字段，兼容内存中和从 MongoDB 读出的数组类型
+func dataStrings(data bson.M, key string) []string {
+	values, ok := filterValues(data[key])
+	if !ok {
+		if v, ok := data[key].([]string); ok {
+			return v
+		}
+		return nil
+	}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// dataInt 读取整数字段
+func dataInt(data bson.M, key string) int {
+	switch v := data[key].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// dataBool 读取布尔字段
+func dataBool(data bson.M, key string) bool {
+	v, _ := data[key].(bool)
+	return v
+}
+
+// prepareResume 带 resume 标记的任务读取断点，其余任务清除上次执行留下的断点
+func (e *TaskExecutor) prepareResume(ctx context.Context, task *models.Task, config *pipeline.PipelineConfig) {
+	taskID := task.ID.Hex()
+	if !task.Resume {
+		if err := e.checkpoints.DeleteCheckpoint(ctx, task.ID); err != nil {
+			log.Printf("[TaskExecutor] Failed to clear checkpoint for task %s: %v", taskID, err)
+		}
+		return
+	}
+
+	state, err := LoadResumeState(ctx, e.checkpoints, task.ID)
+	if err != nil {
+		// 读取失败时完整执行，结果入库时去重
+		log.Printf("[TaskExecutor] Task %s resume failed, running from scratch: %v", taskID, err)
+		state = &pipeline.ResumeState{}
+	}
+	config.Resume = state
+	log.Printf("[TaskExecutor] Resuming task %s from checkpoint: %d completed targets, %d subdomains, %d ports, progress %d%%",
+		taskID, len(state.Completed), len(state.Subdomains), len(state.Ports), state.Progress)
+	e.taskService.AddTaskLog(taskID, "info", "从断点恢复执行",
+		fmt.Sprintf("completed=%d subdomains=%d ports=%d progress=%d", len(state.Completed), len(state.Subdomains), len(state.Ports), state.Progress))
+}
+
+// saveCheckpoint 保存新完成的目标和当前进度
+func (e *TaskExecutor) saveCheckpoint(task *models.Task, scanPipe *pipeline.StreamingPipeline) {
+	entries := scanPipe.Checkpoint().TakeConfirmed()
+	progress := scanPipe.GetProgress()
+	if len(entries) == 0 && progress == 0 {
+		return
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := e.checkpoints.SaveCheckpoint(ctx, task.ID, entries, progress); err != nil {
+		log.Printf("[TaskExecutor] Failed to save checkpoint for task %s: %v", task.ID.Hex(), err)
+	}
+}
+
+// mongoCheckpointStore 断点的数据库存储，每个任务一个文档
+type mongoCheckpointStore struct{}
+
+// NewMongoCheckpointStore 创建数据库断点存储
+func NewMongoCheckpointStore() CheckpointStore {
+	return &mongoCheckpointStore{}
+}
+
+func (s *mongoCheckpointStore) LoadCheckpoint(ctx context.Context, taskID primitive.ObjectID) (*models.TaskCheckpoint, error) {
+	var checkpoint models.TaskCheckpoint
+	err := database.GetCollection(models.CollectionTaskCheckpoints).FindOne(ctx, bson.M{"task_id": taskID}).Decode(&checkpoint)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (s *mongoCheckpointStore) SaveCheckpoint(ctx context.Context, taskID primitive.ObjectID, entries []pipeline.CheckpointEntry, progress int) error {
+	keys := make(map[string][]string)
+	for _, entry := range entries {
+		keys[entry.Module] = append(keys[entry.Module], entry.Key)
+	}
+	update := bson.M{
+		"$set":         bson.M{"updated_at": time.Now()},
+		"$max":         bson.M{"progress": progress},
+		"$setOnInsert": bson.M{"task_id": taskID},
+	}
+	if len(keys) > 0 {
+		addToSet := bson.M{}
+		for module, moduleKeys := range keys {
+			addToSet["completed."+module] = bson.M{"$each": moduleKeys}
+		}
+		update["$addToSet"] = addToSet
+	}
+	_, err := database.GetCollection(models.CollectionTaskCheckpoints).UpdateOne(ctx,
+		bson.M{"task_id": taskID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *mongoCheckpointStore) DeleteCheckpoint(ctx context.Context, taskID primitive.ObjectID) error {
+	_, err := database.GetCollection(models.CollectionTaskCheckpoints).DeleteOne(ctx, bson.M{"task_id": taskID})
+	return err
+}
+
+func (s *mongoCheckpointStore) LoadResults(ctx context.Context, taskID primitive.ObjectID, types []models.ResultType) ([]*models.ScanResult, error) {
+	cursor, err := database.GetCollection(models.CollectionScanResults).Find(ctx, bson.M{
+		"task_id": taskID,
+		"type":    bson.M{"$in": types},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []*models.ScanResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 任务运行中的模块控制
+// 接口把指令写入 task_controls 集合，任务可能运行在任意一个执行器上，
+// 各执行器在任务状态监控中（每 2 秒）读取本进程运行中任务的待执行指令，交给流水线执行后记录结果。
+// 指令的效果（跳过剩余输入、停止模块、调整并发）见 pipeline.ApplyControl
+
+// ErrTaskNotRunning 任务不在运行中，不能发送模块控制指令
+var ErrTaskNotRunning = errors.New("只能控制正在运行的任务")
+
+// TaskControlStore 模块控制指令的存储
+type TaskControlStore interface {
+	// CreateControl 保存待执行的指令
+	CreateControl(ctx context.Context, control *models.TaskControl) error
+	// PendingControls 读取指定任务待执行的指令，按创建时间排序
+	PendingControls(ctx context.Context, taskIDs []primitive.ObjectID) ([]*models.TaskControl, error)
+	// FinishControl 记录指令的执行结果
+	FinishControl(ctx context.Context, control *models.TaskControl) error
+	// ListControls 读取任务的所有指令，按创建时间排序
+	ListControls(ctx context.Context, taskID primitive.ObjectID) ([]*models.TaskControl, error)
+}
+
+// ControlTarget 可以执行模块控制指令的运行中任务
+type ControlTarget interface {
+	ApplyControl(msg pipeline.ControlMessage) error
+}
+
+// NewTaskControl 校验指令并创建待执行的控制记录
+func NewTaskControl(task *models.Task, msg pipeline.ControlMessage, createdBy string) (*models.TaskControl, error) {
+	if task.Status != models.TaskStatusRunning {
+		return nil, ErrTaskNotRunning
+	}
+	if msg.Module == "" {
+		return nil, errors.New("模块名称不能为空")
+	}
+	if !pipeline.ValidControlAction(msg.Action) {
+		return nil, fmt.Errorf("不支持的控制指令: %s", msg.Action)
+	}
+	if msg.Action == pipeline.ControlConcurrency && msg.Concurrency <= 0 {
+		return nil, errors.New("并发数必须大于 0")
+	}
+	if msg.Action != pipeline.ControlConcurrency {
+		msg.Concurrency = 0
+	}
+	return &models.TaskControl{
+		TaskID:      task.ID,
+		Module:      msg.Module,
+		Action:      msg.Action,
+		Concurrency: msg.Concurrency,
+		Status:      models.TaskControlPending,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// ApplyTaskControls 执行本执行器运行中任务的待执行指令，targets 按任务 ID 索引，返回执行的指令数
+func ApplyTaskControls(ctx context.Context, store TaskControlStore, nodeID string, targets map[string]ControlTarget) int {
+	if len(targets) == 0 {
+		return 0
+	}
+	taskIDs := make([]primitive.ObjectID, 0, len(targets))
+	for id := range targets {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			taskIDs = append(taskIDs, oid)
+		}
+	}
+	controls, err := store.PendingControls(ctx, taskIDs)
+	if err != nil {
+		log.Printf("[TaskExecutor] Failed to load task controls: %v", err)
+		return 0
+	}
+
+	applied := 0
+	for _, control := range controls {
+		target, ok := targets[control.TaskID.Hex()]
+		if !ok {
+			continue
+		}
+		err := target.ApplyControl(pipeline.ControlMessage{
+			Module:      control.Module,
+			Action:      control.Action,
+			Concurrency: control.Concurrency,
+		})
+		control.Status = models.TaskControlApplied
+		control.Error = ""
+		if err != nil {
+			control.Status = models.TaskControlFailed
+			control.Error = err.Error()
+		}
+		control.NodeID = nodeID
+		control.AppliedAt = time.Now()
+		log.Printf("[TaskExecutor] Task %s control %s %s: %s %s", control.TaskID.Hex(), control.Action, control.Module, control.Status, control.Error)
+		if err := store.FinishControl(ctx, control); err != nil {
+			log.Printf("[TaskExecutor] Failed to save task control %s: %v", control.ID.Hex(), err)
+		}
+		applied++
+	}
+	return applied
+}
+
+// TaskControlService 模块控制指令服务
+type TaskControlService struct {
+	taskService *TaskService
+	store       TaskControlStore
+}
+
+// NewTaskControlService 创建模块控制指令服务
+func NewTaskControlService() *TaskControlService {
+	return &TaskControlService{
+		taskService: NewTaskService(),
+		store:       NewMongoTaskControlStore(),
+	}
+}
+
+// CreateControl 为运行中的任务添加模块控制指令
+func (s *TaskControlService) CreateControl(taskID string, msg pipeline.ControlMessage, createdBy string) (*models.TaskControl, error) {
+	task, err := s.taskService.GetTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	control, err := NewTaskControl(task, msg, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.store.CreateControl(ctx, control); err != nil {
+		return nil, err
+	}
+	return control, nil
+}
+
+// ListControls 获取任务的模块控制指令及执行结果
+func (s *TaskControlService) ListControls(taskID string) ([]*models.TaskControl, error) {
+	oid, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, errors.New("无效的任务ID")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.store.ListControls(ctx, oid)
+}
+
+// mongoTaskControlStore 模块控制指令的数据库存储
+type mongoTaskControlStore struct{}
+
+// NewMongoTaskControlStore 创建数据库控制指令存储
+func NewMongoTaskControlStore() TaskControlStore {
+	return &mongoTaskControlStore{}
+}
+
+func (s *mongoTaskControlStore) CreateControl(ctx context.Context, control *models.TaskControl) error {
+	res, err := database.GetCollection(models.CollectionTaskControls).InsertOne(ctx, control)
+	if err != nil {
+		return err
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		control.ID = oid
+	}
+	return nil
+}
+
+func (s *mongoTaskControlStore) PendingControls(ctx context.Context, taskIDs []primitive.ObjectID) ([]*models.TaskControl, error) {
+	return s.find(ctx, bson.M{
+		"task_id": bson.M{"$in": taskIDs},
+		"status":  models.TaskControlPending,
+	})
+}
+
+func (s *mongoTaskControlStore) FinishControl(ctx context.Context, control *models.TaskControl) error {
+	_, err := database.GetCollection(models.CollectionTaskControls).UpdateOne(ctx,
+		bson.M{"_id": control.ID, "status": models.TaskControlPending},
+		bson.M{"$set": bson.M{
+			"status":     control.Status,
+			"error":      control.Error,
+			"node_id":    control.NodeID,
+			"applied_at": control.AppliedAt,
+		}},
+	)
+	return err
+}
+
+func (s *mongoTaskControlStore) ListControls(ctx context.Context, taskID primitive.ObjectID) ([]*models.TaskControl, error) {
+	return s.find(ctx, bson.M{"task_id": taskID})
+}
+
+// find 按创建时间排序查询指令
+func (s *mongoTaskControlStore) find(ctx context.Context, filter bson.M) ([]*models.TaskControl, error) {
+	cursor, err := database.GetCollection(models.CollectionTaskControls).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	controls := make([]*models.TaskControl, 0)
+	if err := cursor.All(ctx, &controls); err != nil {
+		return nil, err
+	}
+	return controls, nil
+}
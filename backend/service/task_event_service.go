@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 任务执行事件
+// 流水线模块和执行器产生的结构化事件（模块开始/结束、工具不可用、目标出错、取消），
+// 执行期间缓冲后批量写入，按级别、模块分页查询
+
+const (
+	// TaskEventFlushInterval 事件缓冲的写入间隔
+	TaskEventFlushInterval = 2 * time.Second
+	// MaxTaskEventsPerRun 单次执行最多保存的事件数，超出的只计数
+	MaxTaskEventsPerRun = 2000
+	// TaskEventModuleExecutor 执行器产生的事件使用的模块名
+	TaskEventModuleExecutor = "TaskExecutor"
+)
+
+// ErrInvalidEventLevel 查询条件中的事件级别不合法
+var ErrInvalidEventLevel = errors.New("无效的事件级别，可选 info、warn、error")
+
+// validEventLevels 可查询的事件级别
+var validEventLevels = map[string]bool{
+	pipeline.EventLevelInfo:  true,
+	pipeline.EventLevelWarn:  true,
+	pipeline.EventLevelError: true,
+}
+
+// TaskEventFilter 事件查询条件，Levels、Modules 为空表示不限
+type TaskEventFilter struct {
+	TaskID  primitive.ObjectID
+	Levels  []string
+	Modules []string
+}
+
+// TaskEventStore 事件存储
+type TaskEventStore interface {
+	InsertExecutionEvents(ctx context.Context, events []*models.TaskExecutionEvent) error
+	// FindExecutionEvents 按时间先后分页查询，返回当页事件和总数
+	FindExecutionEvents(ctx context.Context, filter TaskEventFilter, page, pageSize int) ([]*models.TaskExecutionEvent, int64, error)
+}
+
+// TaskEventService 任务事件服务
+type TaskEventService struct {
+	store TaskEventStore
+}
+
+// NewTaskEventService 创建任务事件服务
+func NewTaskEventService() *TaskEventService {
+	return NewTaskEventServiceWithStore(NewMongoTaskEventStore())
+}
+
+// NewTaskEventServiceWithStore 使用指定存储创建任务事件服务
+func NewTaskEventServiceWithStore(store TaskEventStore) *TaskEventService {
+	return &TaskEventService{store: store}
+}
+
+// Append 追加事件
+func (s *TaskEventService) Append(events ...*models.TaskExecutionEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := s.store.InsertExecutionEvents(ctx, events); err != nil {
+		return fmt.Errorf("保存任务事件失败: %w", err)
+	}
+	return nil
+}
+
+// ListEvents 分页查询任务事件
+func (s *TaskEventService) ListEvents(taskID string, levels, modules []string, page, pageSize int) ([]*models.TaskExecutionEvent, int64, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, 0, errors.New("无效的任务ID")
+	}
+	for _, level := range levels {
+		if !validEventLevels[level] {
+			return nil, 0, ErrInvalidEventLevel
+		}
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	events, total, err := s.store.FindExecutionEvents(ctx, TaskEventFilter{TaskID: objID, Levels: levels, Modules: modules}, page, pageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询任务事件失败: %w", err)
+	}
+	if events == nil {
+		events = []*models.TaskExecutionEvent{}
+	}
+	return events, total, nil
+}
+
+// TaskEventWriter 单次执行的事件写入器，缓冲事件并定期写入
+type TaskEventWriter struct {
+	service *TaskEventService
+	taskID  primitive.ObjectID
+
+	mu      sync.Mutex
+	buffer  []*models.TaskExecutionEvent
+	written int
+	dropped int
+	closed  bool
+	// 任务已删除，丢弃未写入的事件
+	discarded bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTaskEventWriter 创建事件写入器，Close 之前每隔 TaskEventFlushInterval 写入一次
+func NewTaskEventWriter(service *TaskEventService, taskID primitive.ObjectID) *TaskEventWriter {
+	w := &TaskEventWriter{
+		service: service,
+		taskID:  taskID,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Emit 记录流水线事件，可以作为流水线的事件处理函数
+func (w *TaskEventWriter) Emit(event pipeline.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.discarded {
+		return
+	}
+	if w.written+len(w.buffer) >= MaxTaskEventsPerRun {
+		w.dropped++
+		return
+	}
+	w.buffer = append(w.buffer, &models.TaskExecutionEvent{
+		ID:        primitive.NewObjectID(),
+		TaskID:    w.taskID,
+		Timestamp: event.Time,
+		Module:    event.Module,
+		Level:     event.Level,
+		Type:      event.Type,
+		Message:   event.Message,
+		Data:      bson.M(event.Data),
+	})
+}
+
+// Record 记录执行器产生的事件
+func (w *TaskEventWriter) Record(level, eventType, message string, data map[string]interface{}) {
+	w.Emit(pipeline.Event{
+		Time:    time.Now(),
+		Module:  TaskEventModuleExecutor,
+		Level:   level,
+		Type:    eventType,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// Flush 写入缓冲的事件
+func (w *TaskEventWriter) Flush() {
+	w.mu.Lock()
+	events := w.buffer
+	w.buffer = nil
+	w.written += len(events)
+	w.mu.Unlock()
+
+	if err := w.service.Append(events...); err != nil {
+		log.Printf("[TaskEvents] Failed to write %d events for task %s: %v", len(events), w.taskID.Hex(), err)
+	}
+}
+
+// Close 停止定期写入并写入剩余事件，超出上限被丢弃的事件数记录为最后一条事件
+func (w *TaskEventWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	if w.dropped > 0 {
+		w.buffer = append(w.buffer, &models.TaskExecutionEvent{
+			ID:        primitive.NewObjectID(),
+			TaskID:    w.taskID,
+			Timestamp: time.Now(),
+			Module:    TaskEventModuleExecutor,
+			Level:     pipeline.EventLevelWarn,
+			Type:      "events_dropped",
+			Message:   fmt.Sprintf("事件超过 %d 条，%d 条未保存", MaxTaskEventsPerRun, w.dropped),
+			Data:      bson.M{"dropped": w.dropped},
+		})
+	}
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	w.Flush()
+}
+
+// Discard 丢弃未写入的事件并停止记录，用于执行中被删除的任务
+func (w *TaskEventWriter) Discard() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.discarded = true
+	w.buffer = nil
+	w.dropped = 0
+}
+
+func (w *TaskEventWriter) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(TaskEventFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.Flush()
+		}
+	}
+}
+
+// mongoTaskEventStore 事件的数据库存储
+type mongoTaskEventStore struct{}
+
+// NewMongoTaskEventStore 创建数据库事件存储
+func NewMongoTaskEventStore() TaskEventStore {
+	return &mongoTaskEventStore{}
+}
+
+func (s *mongoTaskEventStore) InsertExecutionEvents(ctx context.Context, events []*models.TaskExecutionEvent) error {
+	docs := make([]interface{}, len(events))
+	for i, e := range events {
+		docs[i] = e
+	}
+	_, err := database.GetCollection(models.CollectionTaskExecEvents).InsertMany(ctx, docs)
+	return err
+}
+
+func (s *mongoTaskEventStore) FindExecutionEvents(ctx context.Context, filter TaskEventFilter, page, pageSize int) ([]*models.TaskExecutionEvent, int64, error) {
+	query := bson.M{"task_id": filter.TaskID}
+	if len(filter.Levels) > 0 {
+		query["level"] = bson.M{"$in": filter.Levels}
+	}
+	if len(filter.Modules) > 0 {
+		query["module"] = bson.M{"$in": filter.Modules}
+	}
+
+	collection := database.GetCollection(models.CollectionTaskExecEvents)
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.TaskExecutionEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// recordTerminationEvent 记录任务结束事件，任务已删除时丢弃未写入的事件
+func recordTerminationEvent(events *TaskEventWriter, term *models.TaskTermination) {
+	data := map[string]interface{}{
+		"reason":   string(term.Reason),
+		"progress": term.Progress,
+	}
+	if term.Module != "" {
+		data["module"] = term.Module
+	}
+	switch term.Reason {
+	case models.TerminationDeleted:
+		events.Discard()
+	case models.TerminationCompleted:
+		events.Record(pipeline.EventLevelInfo, "task_complete", "任务执行完成", data)
+	case models.TerminationUserCancel, models.TerminationWorkerShutdown:
+		events.Record(pipeline.EventLevelWarn, pipeline.EventCancelled, term.Message, data)
+	default:
+		events.Record(pipeline.EventLevelError, pipeline.EventCancelled, term.Message, data)
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 	"moongazing/database"
 	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/geoip"
 	"moongazing/service/notify"
 	"moongazing/service/pipeline"
 
@@ -20,8 +22,10 @@ import (
 
 // runningTask 正在运行的任务信息
 type runningTask struct {
-	cancelFunc context.CancelFunc
+	task       *models.Task
+	cancelFunc context.CancelCauseFunc
 	pipeline   *pipeline.StreamingPipeline
+	done       chan struct{} // 取消注册时关闭
 }
 
 // TaskExecutor 任务执行器
@@ -34,6 +38,34 @@ type TaskExecutor struct {
 	// 正在运行的任务，用于取消
 	runningTasks  map[string]*runningTask
 	runningMutex  sync.RWMutex
+	// 执行器 ID，写入任务的 node_id 并定期刷新心跳
+	nodeID        string
+	// 断点存储，用于断点续扫
+	checkpoints   CheckpointStore
+	// 任务执行事件
+	events        *TaskEventService
+	// 工作空间资产，保存结果时合并
+	assets        *AssetService
+	// 工作空间漏洞，保存漏洞结果时合并
+	findings      *FindingService
+	// 漏洞即时通知规则
+	findingRules  FindingRuleStore
+	// 工作空间的扫描出站网络设置
+	scanNetworks  ScanNetworkStore
+	// 工作空间的扫描范围
+	scanScopes    ScanScopeStore
+	// 工作空间的第三方数据源密钥
+	apiKeys       *APIKeyService
+	// 停止时重新入队运行中的任务
+	shutdown      ShutdownStore
+	// 运行中任务的模块控制指令
+	controls      TaskControlStore
+	// 可靠任务队列，出队的任务在处理完之前保存在 worker 的处理中列表
+	queue         ProcessingQueueStore
+	// 回收失联 worker 的任务时更新任务状态
+	reapTasks     ReapTaskStore
+	// 本执行器的 worker，随执行器心跳刷新
+	queueWorkers  []string
 }
 
 // NewTaskExecutor 创建任务执行器
@@ -47,6 +79,19 @@ func NewTaskExecutor(workers int) *TaskExecutor {
 		workers:       workers,
 		stopCh:        make(chan struct{}),
 		runningTasks:  make(map[string]*runningTask),
+		nodeID:        newExecutorID(),
+		checkpoints:   NewMongoCheckpointStore(),
+		events:        NewTaskEventService(),
+		assets:        NewAssetService(),
+		findings:      NewFindingService(),
+		findingRules:  NewMongoFindingRuleStore(),
+		scanNetworks:  NewMongoScanNetworkStore(),
+		scanScopes:    NewMongoScanScopeStore(),
+		apiKeys:       NewAPIKeyService(NewMongoAPIKeyStore(APIKeyEncryptionKey()), nil),
+		shutdown:      NewMongoShutdownStore(),
+		controls:      NewMongoTaskControlStore(),
+		queue:         NewRedisProcessingQueue(database.GetRedis()),
+		reapTasks:     NewMongoReapTaskStore(),
 	}
 }
 
@@ -64,6 +109,34 @@ func (e *TaskExecutor) Start() {
 		string(models.TaskTypeCustom),
 	}
 
+	// 清理任务时通过执行器停止本进程中运行的任务
+	SetTaskCanceller(e)
+
+	// 登记全部 worker，worker 心跳随执行器心跳一起刷新
+	for i := 0; i < e.workers; i++ {
+		for _, taskType := range taskTypes {
+			e.queueWorkers = append(e.queueWorkers, e.queueWorkerID(i, taskType))
+		}
+	}
+	e.registerWorkers()
+
+	// 心跳先于恢复启动，避免其他同时启动的实例误判本实例的任务
+	e.wg.Add(1)
+	go e.heartbeatLoop()
+
+	// 恢复上次进程退出时遗留的 Running 任务
+	// 快速重启时旧进程的心跳可能尚未过期，心跳过期后再执行一次
+	e.recoverOrphanedTasks()
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		select {
+		case <-e.stopCh:
+		case <-time.After(ExecutorHeartbeatTTL + executorHeartbeatInterval):
+			e.recoverOrphanedTasks()
+		}
+	}()
+
 	for i := 0; i < e.workers; i++ {
 		for _, taskType := range taskTypes {
 			e.wg.Add(1)
@@ -81,17 +154,51 @@ func (e *TaskExecutor) Start() {
 // Stop 停止执行器
 func (e *TaskExecutor) Stop() {
 	close(e.stopCh)
-	e.wg.Wait()
-	log.Println("[TaskExecutor] Stopped")
+
+	// 取消仍在运行的任务，等待结果处理完后改回 Pending 并重新入队
+	e.runningMutex.RLock()
+	tasks := make([]ShutdownTask, 0, len(e.runningTasks))
+	for taskID, rt := range e.runningTasks {
+		taskID := taskID
+		tasks = append(tasks, ShutdownTask{
+			Task:   rt.task,
+			Cancel: func() { e.cancelRunningTask(taskID, models.TerminationWorkerShutdown) },
+			Done:   rt.done,
+		})
+	}
+	e.runningMutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout+10*time.Second)
+	defer cancel()
+	report := ShutdownRunningTasks(ctx, tasks, e.shutdown, DefaultShutdownTimeout)
+	if len(tasks) > 0 {
+		log.Printf("[TaskExecutor] Shutdown handed over running tasks: requeued=%d, timed_out=%d, skipped=%d",
+			len(report.Requeued), len(report.TimedOut), len(report.Skipped))
+	}
+
+	// 超时未退出的任务不再等待
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("[TaskExecutor] Stopped")
+	case <-ctx.Done():
+		log.Println("[TaskExecutor] Stopped before all workers exited")
+	}
 }
 
 // registerRunningTask 注册正在运行的任务
-func (e *TaskExecutor) registerRunningTask(taskID string, cancelFunc context.CancelFunc, pipe *pipeline.StreamingPipeline) {
+func (e *TaskExecutor) registerRunningTask(task *models.Task, cancelFunc context.CancelCauseFunc, pipe *pipeline.StreamingPipeline) {
 	e.runningMutex.Lock()
 	defer e.runningMutex.Unlock()
-	e.runningTasks[taskID] = &runningTask{
+	e.runningTasks[task.ID.Hex()] = &runningTask{
+		task:       task,
 		cancelFunc: cancelFunc,
 		pipeline:   pipe,
+		done:       make(chan struct{}),
 	}
 }
 
@@ -99,33 +206,60 @@ func (e *TaskExecutor) registerRunningTask(taskID string, cancelFunc context.Can
 func (e *TaskExecutor) unregisterRunningTask(taskID string) {
 	e.runningMutex.Lock()
 	defer e.runningMutex.Unlock()
+	if rt, ok := e.runningTasks[taskID]; ok && rt.done != nil {
+		close(rt.done)
+	}
 	delete(e.runningTasks, taskID)
 }
 
-// cancelRunningTask 取消正在运行的任务
-func (e *TaskExecutor) cancelRunningTask(taskID string) bool {
+// CancelAndWait 取消本进程中运行的任务并等待其退出，任务的结果保存和状态更新都在取消注册之前完成
+func (e *TaskExecutor) CancelAndWait(taskID string, reason models.TerminationReason, timeout time.Duration) (bool, error) {
+	e.runningMutex.RLock()
+	rt, exists := e.runningTasks[taskID]
+	e.runningMutex.RUnlock()
+	if !exists || rt == nil {
+		return false, nil
+	}
+
+	e.cancelRunningTask(taskID, reason)
+	select {
+	case <-rt.done:
+		return true, nil
+	case <-time.After(timeout):
+		return true, fmt.Errorf("等待任务 %s 退出超时", taskID)
+	}
+}
+
+// cancelRunningTask 取消正在运行的任务，reason 为空表示任务只是暂停
+func (e *TaskExecutor) cancelRunningTask(taskID string, reason models.TerminationReason) bool {
 	e.runningMutex.RLock()
 	rt, exists := e.runningTasks[taskID]
 	e.runningMutex.RUnlock()
 	
 	if exists && rt != nil {
-		log.Printf("[TaskExecutor] Cancelling running task: %s", taskID)
-		if rt.pipeline != nil {
-			rt.pipeline.Stop()
+		log.Printf("[TaskExecutor] Cancelling running task: %s (reason: %s)", taskID, reason)
+		// 先记录原因再停止流水线，结果收集循环退出时才能读到
+		var cause error
+		if reason != "" {
+			cause = CancelCause(reason)
 		}
 		if rt.cancelFunc != nil {
-			rt.cancelFunc()
+			rt.cancelFunc(cause)
+		}
+		if rt.pipeline != nil {
+			rt.pipeline.Stop()
 		}
 		return true
 	}
 	return false
 }
 
-// taskStatusMonitor 监控任务状态，取消被删除或取消的任务
+// taskStatusMonitor 监控任务状态，取消被删除或取消的任务，执行模块控制指令
 func (e *TaskExecutor) taskStatusMonitor() {
 	defer e.wg.Done()
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
+	lastReap := time.Time{}
 
 	for {
 		select {
@@ -133,6 +267,12 @@ func (e *TaskExecutor) taskStatusMonitor() {
 			return
 		case <-ticker.C:
 			e.checkRunningTasks()
+			e.applyTaskControls()
+			// worker 心跳按执行器心跳的间隔刷新，回收不需要更频繁
+			if time.Since(lastReap) >= executorHeartbeatInterval {
+				e.reapDeadWorkers()
+				lastReap = time.Now()
+			}
 		}
 	}
 }
@@ -151,22 +291,44 @@ func (e *TaskExecutor) checkRunningTasks() {
 		if err != nil || task == nil {
 			// 任务已被删除，取消执行
 			log.Printf("[TaskExecutor] Task %s deleted, cancelling", taskID)
-			e.cancelRunningTask(taskID)
+			e.cancelRunningTask(taskID, models.TerminationDeleted)
 			continue
 		}
 		
-		if task.Status == models.TaskStatusCancelled || task.Status == models.TaskStatusPaused {
+		switch task.Status {
+		case models.TaskStatusCancelled:
 			log.Printf("[TaskExecutor] Task %s status changed to %s, cancelling", taskID, task.Status)
-			e.cancelRunningTask(taskID)
+			e.cancelRunningTask(taskID, models.TerminationUserCancel)
+		case models.TaskStatusPaused:
+			log.Printf("[TaskExecutor] Task %s status changed to %s, cancelling", taskID, task.Status)
+			e.cancelRunningTask(taskID, "")
+		}
+	}
+}
+
+// applyTaskControls 执行本进程运行中任务的模块控制指令
+func (e *TaskExecutor) applyTaskControls() {
+	e.runningMutex.RLock()
+	targets := make(map[string]ControlTarget, len(e.runningTasks))
+	for taskID, rt := range e.runningTasks {
+		if rt.pipeline != nil {
+			targets[taskID] = rt.pipeline
 		}
 	}
+	e.runningMutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ApplyTaskControls(ctx, e.controls, e.nodeID, targets)
 }
 
 // worker 工作者循环
 func (e *TaskExecutor) worker(id int, taskType string) {
 	defer e.wg.Done()
 	workerID := fmt.Sprintf("worker-%d-%s", id, taskType)
+	queueWorker := e.queueWorkerID(id, taskType)
 	log.Printf("[%s] Worker started, listening for %s tasks", workerID, taskType)
+	defer e.releaseWorker(queueWorker)
 
 	for {
 		select {
@@ -175,7 +337,7 @@ func (e *TaskExecutor) worker(id int, taskType string) {
 		default:
 		}
 
-		task, err := e.dequeueRunningTask(taskType)
+		task, err := e.dequeueRunningTask(queueWorker, taskType)
 		if err != nil {
 			if err != redis.Nil {
 				log.Printf("[%s] Dequeue error: %v", workerID, err)
@@ -191,36 +353,30 @@ func (e *TaskExecutor) worker(id int, taskType string) {
 
 		log.Printf("[%s] Processing task: %s", workerID, task.ID.Hex())
 		e.processTask(task)
+		e.ackTask(queueWorker, task.ID.Hex())
 	}
 }
 
-// dequeueRunningTask 获取待执行的任务
-func (e *TaskExecutor) dequeueRunningTask(taskType string) (*models.Task, error) {
+// dequeueRunningTask 获取待执行的任务，任务在处理完之前保存在 worker 的处理中列表
+func (e *TaskExecutor) dequeueRunningTask(queueWorker, taskType string) (*models.Task, error) {
 	ctx := context.Background()
-	rdb := database.GetRedis()
 
-	queueKey := "task:queue:" + taskType
-	
-	// 检查队列长度
-	queueLen, _ := rdb.LLen(ctx, queueKey).Result()
-	if queueLen > 0 {
-		log.Printf("[TaskExecutor] Queue %s has %d tasks", queueKey, queueLen)
-	}
-	
-	result, err := rdb.LPop(ctx, queueKey).Result()
-	if err == redis.Nil {
-		return nil, nil
-	}
+	// 依次检查 high、旧队列、normal、low
+	result, queueKey, err := ClaimTaskID(ctx, e.queue, taskType, queueWorker)
 	if err != nil {
-		log.Printf("[TaskExecutor] LPop error for %s: %v", queueKey, err)
+		log.Printf("[TaskExecutor] LMove error for %s: %v", queueKey, err)
 		return nil, err
 	}
+	if result == "" {
+		return nil, nil
+	}
 
 	log.Printf("[TaskExecutor] Dequeued task ID: %s from %s", result, queueKey)
 
 	task, err := e.taskService.GetTaskByID(result)
 	if err != nil {
 		log.Printf("[TaskExecutor] Failed to get task %s: %v", result, err)
+		e.ackTask(queueWorker, result)
 		return nil, err
 	}
 
@@ -229,6 +385,7 @@ func (e *TaskExecutor) dequeueRunningTask(taskType string) (*models.Task, error)
 	// 接受 Pending 或 Running 状态的任务
 	if task.Status != models.TaskStatusRunning && task.Status != models.TaskStatusPending {
 		log.Printf("[TaskExecutor] Task %s skipped, status: %s", task.ID.Hex(), task.Status)
+		e.ackTask(queueWorker, result)
 		return nil, nil
 	}
 
@@ -237,13 +394,28 @@ func (e *TaskExecutor) dequeueRunningTask(taskType string) (*models.Task, error)
 		if err := e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
 			"status":     models.TaskStatusRunning,
 			"started_at": time.Now(),
+			"node_id":    e.nodeID,
+			// 重试、重新扫描的任务清除上次的结束原因
+			"termination_reason": "",
+			"termination":        nil,
+			// 断点续扫标记只对本次执行有效
+			"resume": false,
 		}); err != nil {
 			log.Printf("[TaskExecutor] Failed to update task %s status: %v", task.ID.Hex(), err)
+			// 放回原队列，稍后重试
+			if _, err := e.queue.Move(ctx, ProcessingQueueKey(queueWorker), queueKey, result); err != nil {
+				log.Printf("[TaskExecutor] Failed to return task %s to %s: %v", result, queueKey, err)
+			}
 			return nil, fmt.Errorf("failed to start task: %w", err)
 		}
 		task.Status = models.TaskStatusRunning
 		log.Printf("[TaskExecutor] Task %s started (was pending)", task.ID.Hex())
+	} else {
+		e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
+			"node_id": e.nodeID,
+		})
 	}
+	task.NodeID = e.nodeID
 
 	return task, nil
 }
@@ -253,14 +425,24 @@ func (e *TaskExecutor) processTask(task *models.Task) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("[TaskExecutor] Panic in task %s: %v", task.ID.Hex(), r)
-			e.failTask(task, "内部错误")
+			e.failTaskWithTermination(task, NewTermination(models.TerminationModuleFailure, "内部错误", "", nil))
 		}
 	}()
 
 	// 使用 StreamingPipeline 处理所有扫描任务
+	config := taskPipelineConfig(task)
+	if config == nil {
+		e.failTask(task, "未知的任务类型: "+string(task.Type))
+		return
+	}
+	e.executeStreamingPipeline(task, config)
+}
+
+// taskPipelineConfig 任务类型对应的流水线配置，未知的任务类型返回 nil
+func taskPipelineConfig(task *models.Task) *pipeline.PipelineConfig {
 	switch task.Type {
 	case models.TaskTypeFull:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan:          true,
 			SubdomainMaxEnumTime:   15,
 			SubdomainResolveIP:     true,
@@ -273,89 +455,88 @@ func (e *TaskExecutor) processTask(task *models.Task) {
 			VulnScan:               true,
 			WebCrawler:             true,
 			DirScan:                true,
+			EndpointExtraction:     true,
 			SensitiveScan:          true,
-		})
+		}
 
 	case models.TaskTypeSubdomain:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan:          true,
 			SubdomainMaxEnumTime:   10,
 			SubdomainResolveIP:     true,
 			SubdomainCheckTakeover: false,
 			SubdomainHTTPProbe:     true,  // 启用 HTTP 探测获取标题、状态码等
 			PortScan:               false,
-		})
+		}
 
 	case models.TaskTypeTakeover:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan:          true,
 			SubdomainMaxEnumTime:   10,
 			SubdomainResolveIP:     true,
 			SubdomainCheckTakeover: true,
 			SubdomainHTTPProbe:     true,  // 启用 HTTP 探测
 			PortScan:               false,
-		})
+		}
 
 	case models.TaskTypePortScan:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan: false,
 			PortScan:      true,
 			PortScanMode:  "top1000",
 			SkipCDN:       true,
 			Fingerprint:   true,
-		})
+		}
 
 	case models.TaskTypeFingerprint:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan: false,
 			PortScan:      true,
 			PortScanMode:  "quick",
 			SkipCDN:       true,
 			Fingerprint:   true,
-		})
+		}
 
 	case models.TaskTypeVulnScan:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan: false,
 			PortScan:      true,
 			PortScanMode:  "quick",
 			SkipCDN:       true,
 			Fingerprint:   true,
 			VulnScan:      true,
-		})
+		}
 
 	case models.TaskTypeDirScan:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan: false,
 			PortScan:      true,
 			PortScanMode:  "quick",
 			SkipCDN:       true,
 			Fingerprint:   true,
 			DirScan:       true,
-		})
+		}
 
 	case models.TaskTypeCrawler:
-		e.executeStreamingPipeline(task, &pipeline.PipelineConfig{
+		return &pipeline.PipelineConfig{
 			SubdomainScan: false,
 			PortScan:      true,
 			PortScanMode:  "quick",
 			SkipCDN:       true,
 			Fingerprint:   true,
 			WebCrawler:    true,
-		})
+		}
 
 	case models.TaskTypeCustom:
 		// 根据用户选择的 scanTypes 构建配置
-		config := e.buildCustomConfig(task)
-		e.executeStreamingPipeline(task, config)
+		return buildCustomConfig(task)
 
-	default:
-		e.failTask(task, "未知的任务类型: "+string(task.Type))
 	}
+	return nil
 }
 
 // buildCustomConfig 根据用户选择的 scanTypes 构建 PipelineConfig
-func (e *TaskExecutor) buildCustomConfig(task *models.Task) *pipeline.PipelineConfig {
+func buildCustomConfig(task *models.Task) *pipeline.PipelineConfig {
 	scanTypes := make(map[string]bool)
 	for _, t := range task.Config.ScanTypes {
 		scanTypes[t] = true
@@ -422,6 +603,30 @@ func (e *TaskExecutor) buildCustomConfig(task *models.Task) *pipeline.PipelineCo
 	if scanTypes["sensitive"] {
 		config.SensitiveScan = true
 	}
+	config.SensitiveMaskEmails = task.Config.SensitiveMaskEmails
+
+	if scanTypes["endpoint"] {
+		config.EndpointExtraction = true
+		// 接口提取的输入来自爬虫，未选择爬虫和目录扫描时启用爬虫
+		if !config.WebCrawler && !config.DirScan {
+			config.WebCrawler = true
+			if !config.PortScan {
+				config.PortScan = true
+				config.PortScanMode = "quick"
+			}
+			config.Fingerprint = true
+		}
+	}
+
+	if scanTypes["screenshot"] {
+		config.Screenshot = true
+		// 截图的输入来自指纹识别
+		if !config.PortScan {
+			config.PortScan = true
+			config.PortScanMode = "quick"
+		}
+		config.Fingerprint = true
+	}
 
 	log.Printf("[TaskExecutor] Built custom config for task %s: subdomain=%v, port=%v, fingerprint=%v, crawler=%v, dirscan=%v, vuln=%v, sensitive=%v",
 		task.ID.Hex(), config.SubdomainScan, config.PortScan, config.Fingerprint, config.WebCrawler, config.DirScan, config.VulnScan, config.SensitiveScan)
@@ -431,11 +636,92 @@ func (e *TaskExecutor) buildCustomConfig(task *models.Task) *pipeline.PipelineCo
 
 // executeStreamingPipeline 使用 StreamingPipeline 执行任务
 func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipeline.PipelineConfig) {
-	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	// 时间上限由流水线控制，超时时需要记录当时运行的模块和进度
+	// 流水线中的外部工具调用记录到任务
+	// 取消时携带结束原因（用户取消、删除、执行器停止）
+	ctx, cancel := context.WithCancelCause(e.toolContext(task))
 	taskID := task.ID.Hex()
 
 	log.Printf("[TaskExecutor] Starting StreamingPipeline for task %s, type: %s", taskID, task.Type)
 
+	// 扫描范围：任务的包含规则覆盖工作空间的设置，排除规则合并
+	config.ScopeIncludes, config.ExcludePatterns = ResolveScanScope(&task.Config, LoadScanScope(e.scanScopes, task.WorkspaceID.Hex()))
+	config.SubdomainKeepUnresolved = task.Config.KeepUnresolved
+	config.SubdomainWildcardHTTPConfirm = task.Config.WildcardHTTPConfirm
+	config.DirScanSoft404Limit = task.Config.Soft404Limit
+	config.DirScanSoft404Tag = task.Config.Soft404Tag
+	config.DirScanStatusInclude = task.Config.DirStatusInclude
+	config.DirScanStatusExclude = task.Config.DirStatusExclude
+	config.URLDedupSignature = task.Config.URLDedupSignature
+	config.URLDedupParameters = task.Config.URLDedupParameters
+	config.DedupBackend = task.Config.DedupBackend
+	config.DedupBloomFPRate = task.Config.DedupBloomFPRate
+	if task.Config.LivenessCheck {
+		config.LivenessCheck = true
+		config.LivenessPorts = task.Config.LivenessPorts
+		config.LivenessTimeout = task.Config.LivenessTimeout
+		config.LivenessConcurrency = task.Config.LivenessConcurrency
+		config.LivenessICMP = task.Config.LivenessICMP
+	}
+	if task.Config.Screenshot {
+		config.Screenshot = true
+	}
+	if task.Config.EndpointExtraction {
+		config.EndpointExtraction = true
+	}
+	config.ScreenshotDir = ScreenshotTaskDir(taskID)
+	config.ScreenshotConcurrency = task.Config.ScreenshotConcurrency
+	config.ScreenshotTimeout = task.Config.ScreenshotTimeout
+	config.MaxInFlightPerIP = task.Config.MaxPerIP
+	config.IPQueueWarnThreshold = task.Config.IPQueueWarning
+	config.MaxExpandedTargets = task.Config.MaxTargets
+	config.RateLimit = task.Config.RateLimit
+	config.PortScanThreads = task.Config.PortScanThreads
+	config.IPv6Mode = task.Config.IPv6Mode
+	config.PortHTTPProbe = task.Config.HTTPProbe
+	config.PortHTTPProbeMinPort = task.Config.HTTPProbeMinPort
+	config.PortHTTPProbeMaxPerHost = task.Config.HTTPProbeMaxPerHost
+	config.HTTPConcurrency = task.Config.HTTPConcurrency
+	config.CrawlerConcurrency = task.Config.CrawlerConcurrency
+	config.CrawlerBatchSize = task.Config.CrawlerBatchSize
+	config.CrawlerParallelBatches = task.Config.CrawlerParallelBatches
+	// 代理和 DNS：任务设置优先，未设置的项使用工作空间的设置
+	config.Network = ResolveScanNetwork(&task.Config, LoadScanNetwork(e.scanNetworks, task.WorkspaceID.Hex()))
+	config.CustomHeaders = task.Config.CustomHeaders
+	config.CookieJar = task.Config.CookieJar
+	config.UserAgentStrategy = task.Config.UserAgentStrategy
+	config.UserAgents = task.Config.UserAgents
+	// 第三方数据源：任务填写的密钥优先，其次是工作空间保存的密钥，最后是配置文件的密钥
+	var apiUsage func(provider string)
+	if task.Config.UseThirdParty && config.SubdomainScan {
+		config.ThirdPartyAPI, apiUsage = e.apiKeys.Resolve(task.WorkspaceID.Hex(), &task.Config)
+		config.ThirdPartySources = task.Config.ThirdPartySources
+	}
+	// 漏洞扫描模板选择，未设置时沿用旧的 severity_filter / poc_tags
+	config.VulnSeverities = task.Config.VulnSeverities
+	if len(config.VulnSeverities) == 0 {
+		config.VulnSeverities = task.Config.SeverityFilter
+	}
+	config.VulnTemplates = task.Config.VulnTemplates
+	if len(config.VulnTemplates) == 0 {
+		config.VulnTemplates = task.Config.POCTags
+	}
+	config.VulnRateLimit = task.Config.VulnRateLimit
+	config.VulnConcurrency = task.Config.VulnConcurrency
+	if task.Config.DebugSuppression {
+		config.SuppressionSamples = task.Config.SuppressionSamples
+		if config.SuppressionSamples <= 0 {
+			config.SuppressionSamples = pipeline.DefaultSuppressionSamples
+		}
+	}
+
+	// 按任务类型（或任务覆盖值）设置时间上限，同时设置模块超时和看门狗
+	ApplyTaskTimeouts(config, task)
+	log.Printf("[TaskExecutor] Task %s time limit: %v, watchdog: %v", taskID, config.TimeLimit, config.WatchdogTimeout)
+
+	// 断点续扫：跳过已完成的目标，之前保存的结果作为后续模块的输入
+	e.prepareResume(ctx, task, config)
+
 	// 创建带进度追踪的流水线
 	progressCallback := func(report *pipeline.ProgressReport) {
 		// 更新任务进度到数据库
@@ -443,12 +729,27 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 	}
 	
 	scanPipe := pipeline.NewStreamingPipelineWithProgress(ctx, task, config, len(task.Targets), progressCallback)
+	scanPipe.SetDedupRedis(database.GetRedis())
+	scanPipe.SetAPIUsageRecorder(apiUsage)
+	scanPipe.SetOverrunHandler(func(elapsed, limit time.Duration, report *pipeline.ProgressReport) {
+		e.handleOverrun(task, elapsed, limit, report)
+	})
+
+	// 模块开始/结束、工具不可用、目标出错等事件保存到任务
+	events := NewTaskEventWriter(e.events, task.ID)
+	defer events.Close()
+	scanPipe.SetEventHandler(events.Emit)
+	events.Record(pipeline.EventLevelInfo, "task_start", "任务开始执行", map[string]interface{}{
+		"targets": len(task.Targets),
+		"node_id": e.nodeID,
+		"resume":  task.Resume,
+	})
 
 	// 注册正在运行的任务
-	e.registerRunningTask(taskID, cancel, scanPipe)
+	e.registerRunningTask(task, cancel, scanPipe)
 	defer func() {
 		e.unregisterRunningTask(taskID)
-		cancel()
+		cancel(nil)
 	}()
 
 	// 启动流水线
@@ -458,7 +759,7 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 	}
 
 	// CDN 信息映射 (domain -> CDN provider)
-	cdnInfo := make(map[string]string)
+	cdnInfo := make(map[string]pipeline.DomainSkip)
 
 	// 收集结果
 	var resultCount int
@@ -468,11 +769,62 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 	progressTicker := time.NewTicker(3 * time.Second)
 	defer progressTicker.Stop()
 
-	for result := range scanPipe.Results() {
+	// 发现时间线，事件随进度更新批量写入
+	timeline := NewTaskTimelineRecorder(task, NewMongoTimelineStore())
+	defer timeline.Close()
+
+	// 高危漏洞在保存后立即通知，不等任务结束
+	alerts := NewFindingAlerter(task, LoadFindingRule(e.findingRules, task.WorkspaceID.Hex()), notify.GetGlobalManager())
+	defer func() {
+		if n := alerts.Throttle().Suppressed(); n > 0 {
+			log.Printf("[TaskExecutor] Task %s suppressed %d duplicate or rate-limited finding alerts", taskID, n)
+		}
+	}()
+
+	// 结果批量入库，写入成功后记录时间线、断点、资产和漏洞
+	batcher := NewResultBatcher(e.resultService, DefaultResultBatchSize, DefaultResultBatchInterval, func(w ResultWrite, merged bool) {
+		scanResult := w.Result
+		if merged && isStoreDedupType(scanResult.Type) {
+			scanPipe.Suppression().Record(StoreSuppressionModule, pipeline.SuppressStoredDuplicate, scanResult.Data["url"])
+		}
+		timeline.Record(scanResult)
+		scanPipe.Checkpoint().Stored(w.Source)
+		if err := e.assets.Record(scanResult); err != nil {
+			log.Printf("[TaskExecutor] %v", err)
+		}
+		if err := e.findings.Record(scanResult); err != nil {
+			log.Printf("[TaskExecutor] %v", err)
+		}
+		alerts.Record(scanResult)
+	})
+	batcher.SetOnFlush(timeline.Flush)
+	flushTicker := time.NewTicker(batcher.Interval())
+	defer flushTicker.Stop()
+
+	// IP 归属查询，同一 IP 在任务内只查询一次
+	geo := geoip.NewCache(geoip.Default())
+
+	results := scanPipe.Results()
+collect:
+	for {
+		var result interface{}
+		select {
+		case r, ok := <-results:
+			if !ok {
+				break collect
+			}
+			result = r
+		case now := <-flushTicker.C:
+			batcher.FlushDue(now)
+			continue
+		}
+
 		// 检查上下文是否被取消
 		select {
 		case <-ctx.Done():
 			log.Printf("[TaskExecutor] Task %s cancelled during result collection", taskID)
+			batcher.Flush()
+			e.finishStreamingTask(ctx, task, scanPipe, events, resultCount)
 			return
 		default:
 		}
@@ -494,7 +846,8 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 				Type:        models.ResultTypeSubdomain,
 				Source:      r.Source,
 				Data: bson.M{
-					"subdomain":    r.Host,         // 子域名完整名称
+					"subdomain":    r.Host,         // 子域名完整名称（punycode）
+					"display_name": core.ToUnicodeDomain(r.Host), // 展示用的 Unicode 形式
 					"domain":       r.Domain,       // 根域名
 					"root_domain":  r.RootDomain,
 					"ips":          r.IPs,
@@ -503,10 +856,17 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 					"status_code":  r.StatusCode,   // HTTP 状态码
 					"web_server":   r.WebServer,    // Web 服务器
 					"technologies": r.Technologies, // 技术栈/指纹
+					"tech_versions": r.TechVersions, // 技术版本
 					"cdn":          r.CDN,          // 是否为 CDN
 					"cdn_name":     r.CDNName,      // CDN 名称
 					"url":          r.URL,          // 完整 URL
 					"alive":        r.StatusCode > 0,
+					"excluded":     r.Excluded,     // 命中排除规则，仅记录未扫描
+					"resolution":   r.Resolution,   // 解析状态: resolved, unresolved, nxdomain, unverified
+					"saas_provider": r.SaaSProvider, // SaaS 平台
+					"saas_category": r.SaaSCategory, // 平台类别
+					"saas_handling": r.SaaSHandling, // 处理建议
+					"skip_reason":   r.SkipReason,   // 跳过端口扫描的原因
 				},
 				CreatedAt: time.Now(),
 			}
@@ -514,7 +874,7 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 		case pipeline.DomainSkip:
 			// 记录 CDN 信息，稍后更新子域名结果
 			if r.IsCDN && r.CDN != "" {
-				cdnInfo[r.Domain] = r.CDN
+				cdnInfo[r.Domain] = r
 			}
 			// DomainSkip 不需要单独存储，它的信息会合并到子域名结果中
 
@@ -526,32 +886,98 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 					WorkspaceID: task.WorkspaceID,
 					Type:        models.ResultTypePort,
 					Source:      "gogo",
-					Data: bson.M{
-						"host":    r.Host,
-						"ip":      r.IP,
-						"port":    r.Port,
-						"service": r.Service,
-					},
-					CreatedAt: time.Now(),
+					Data:        PortResultData(r),
+					CreatedAt:   time.Now(),
 				}
+				EnrichPortData(scanResult.Data, geo)
+			}
+
+		case pipeline.AssetOther:
+			// 端口指纹合并到端口扫描写入的同一条端口结果
+			if data := PortFingerprintData(r); data != nil {
+				batcher.Add(ResultWrite{
+					Result: &models.ScanResult{
+						TaskID:      task.ID,
+						WorkspaceID: task.WorkspaceID,
+						Type:        models.ResultTypePort,
+						Source:      "fingerprint",
+						Data:        data,
+						CreatedAt:   time.Now(),
+					},
+					Dedup:  true,
+					Source: result,
+				})
+			}
+
+		case pipeline.HostLiveness:
+			// 未通过存活预检测的主机，仅作提示
+			scanResult = &models.ScanResult{
+				TaskID:      task.ID,
+				WorkspaceID: task.WorkspaceID,
+				Type:        models.ResultTypeLiveness,
+				Source:      "liveness",
+				Data: bson.M{
+					"ip":       r.IP,
+					"alive":    r.Alive,
+					"method":   r.Method,
+					"evidence": r.Evidence,
+				},
+				CreatedAt: time.Now(),
 			}
 
 		case pipeline.AssetHttp:
+			source := r.Source
+			if source == "" {
+				source = "fingerprint"
+			}
 			scanResult = &models.ScanResult{
 				TaskID:      task.ID,
 				WorkspaceID: task.WorkspaceID,
 				Type:        models.ResultTypeService,
-				Source:      "fingerprint",
+				Source:      source,
 				Data: bson.M{
 					"url":          r.URL,
 					"host":         r.Host,
 					"ip":           r.IP,
+					"family":       r.Family,
 					"port":         r.Port,
 					"title":        r.Title,
 					"status_code":  r.StatusCode,
 					"server":       r.Server,
 					"technologies": r.Technologies,
+					"tech_versions": r.TechVersions,
 					"fingerprints": r.Fingerprints,
+					"final_url":    r.FinalURL,
+					"body_hash":    r.BodyHash,
+					"normalized_body_hash": r.NormalizedBodyHash,
+					"body_preview": r.BodyPreview,
+					"waf":          r.WAF,
+					"waf_method":   r.WAFMethod,
+				},
+				CreatedAt: time.Now(),
+			}
+
+		case pipeline.ScreenshotResult:
+			// 截图合并到已保存的同一 URL 的 Web 服务结果，不单独保存；先写入等待中的结果
+			batcher.Flush()
+			if err := e.resultService.SetServiceScreenshot(task.ID, r); err != nil {
+				log.Printf("[TaskExecutor] Failed to save screenshot for %s: %v", r.URL, err)
+			}
+
+		case pipeline.TakeoverResult:
+			scanResult = &models.ScanResult{
+				TaskID:      task.ID,
+				WorkspaceID: task.WorkspaceID,
+				Type:        models.ResultTypeTakeover,
+				Source:      "takeover_scanner",
+				Data: bson.M{
+					"subdomain":    r.Domain,
+					"cname":        r.CNAME,
+					"provider":     r.Service,
+					"vulnerable":   r.Vulnerable,
+					"fingerprints": r.Fingerprints,
+					"reason":       r.Reason,
+					"severity":     "high", // 子域名接管通常是高危漏洞
 				},
 				CreatedAt: time.Now(),
 			}
@@ -612,6 +1038,43 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 				},
 				CreatedAt: time.Now(),
 			}
+			// 爬虫发现的表单提交等请求，保留请求内容供 http-raw 导出
+			if r.RequestBody != "" {
+				scanResult.Data["request_body"] = r.RequestBody
+			}
+			if len(r.RequestHeaders) > 0 {
+				scanResult.Data["request_headers"] = r.RequestHeaders
+			}
+			if r.Suspicious {
+				scanResult.Data["suspected_soft404"] = true
+			}
+			if r.Interesting {
+				scanResult.Data["interesting"] = true
+			}
+			if r.StateChanging {
+				scanResult.Data["is_state_changing"] = true
+			}
+			// 请求参数供漏洞扫描构造测试请求
+			if len(r.Parameters) > 0 {
+				scanResult.Data["parameters"] = r.Parameters
+			}
+			if r.RequestContentType != "" {
+				scanResult.Data["request_content_type"] = r.RequestContentType
+			}
+			if len(r.FormFields) > 0 {
+				scanResult.Data["form_fields"] = r.FormFields
+			}
+			// 保留发现时的原始写法；按参数签名去重时入库也按签名合并
+			scanResult.Data["original_url"] = r.Output
+			if config.URLDedupParameters && r.ParamSignature != "" {
+				scanResult.Data["param_signature"] = r.ParamSignature
+			} else if config.URLDedupSignature && r.Signature != "" {
+				scanResult.Data["url_signature"] = r.Signature
+			}
+			// 从 OpenAPI 文档、JS 文件中提取的接口记录来源文档
+			if r.Parent != "" {
+				scanResult.Data["parent_url"] = r.Parent
+			}
 
 		case pipeline.SensitiveInfoResult:
 			scanResult = &models.ScanResult{
@@ -623,33 +1086,34 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 					"target":     r.Target,
 					"url":        r.URL,
 					"type":       r.Type,
-					"pattern":    r.Pattern,
-					"matches":    r.Matches,
-					"location":   r.Location,
-					"severity":   r.Severity,
-					"confidence": r.Confidence,
+					"pattern":       r.Pattern,
+					"matches":       r.Matches,
+					"contexts":      r.Contexts,
+					"total_matches": r.TotalMatches,
+					"location":      r.Location,
+					"severity":      r.Severity,
+					"confidence":    r.Confidence,
 				},
 				CreatedAt: time.Now(),
 			}
+			// 爬虫和目录扫描发现的文件记录链接到它的页面
+			if r.Parent != "" {
+				scanResult.Data["parent_url"] = r.Parent
+			}
 		}
 
 		// 保存结果
 		if scanResult != nil {
-			var err error
-			// 对于需要去重的类型，使用 CreateResultWithDedup
-			switch scanResult.Type {
-			case models.ResultTypeService, models.ResultTypeURL, models.ResultTypeCrawler, models.ResultTypeDirScan:
-				err = e.resultService.CreateResultWithDedup(scanResult)
-			default:
-				err = e.resultService.CreateResult(scanResult)
-			}
-			if err != nil {
-				log.Printf("[TaskExecutor] Failed to save result: %v", err)
-			}
+			batcher.Add(ResultWrite{
+				Result: scanResult,
+				Dedup:  storeWithDedup(scanResult.Type, config.Resume != nil),
+				Source: result,
+			})
 		}
 
 		// 定期更新进度（基于结果数量，进度追踪器会更精确地计算）
 		if resultCount%50 == 0 {
+			e.saveCheckpoint(task, scanPipe)
 			if tracker := scanPipe.GetProgressTracker(); tracker != nil {
 				report := tracker.GetReport()
 				e.updateProgressWithDetails(task, report)
@@ -657,31 +1121,100 @@ func (e *TaskExecutor) executeStreamingPipeline(task *models.Task, config *pipel
 		}
 	}
 
-	// 批量更新子域名的 CDN 信息
-	if len(cdnInfo) > 0 {
-		log.Printf("[TaskExecutor] Updating CDN info for %d subdomains", len(cdnInfo))
-		for domain, cdnProvider := range cdnInfo {
-			if err := e.resultService.UpdateSubdomainCDN(task.ID.Hex(), domain, cdnProvider); err != nil {
-				log.Printf("[TaskExecutor] Failed to update CDN info for %s: %v", domain, err)
-			}
-		}
+	// 写入最后一批结果后再更新子域名的 CDN 信息，执行器停止时也在任务退出前写入
+	batcher.Flush()
+	e.flushCDNInfo(taskID, cdnInfo)
+
+	// 长时间没有再被扫描到的漏洞标记为可能已修复
+	if n, err := e.findings.FlagPossiblyFixed(task.WorkspaceID); err != nil {
+		log.Printf("[TaskExecutor] Failed to flag stale findings: %v", err)
+	} else if n > 0 {
+		log.Printf("[TaskExecutor] Flagged %d stale findings of workspace %s as possibly fixed", n, task.WorkspaceID.Hex())
 	}
 
-	// 检查任务是否被取消或删除
+	log.Printf("[TaskExecutor] Task %s finished: subdomains=%d, ports=%d, vulns=%d, urls=%d",
+		taskID, subdomainCount, portCount, vulnCount, urlCount)
+	e.finishStreamingTask(ctx, task, scanPipe, events, resultCount)
+}
+
+// finishStreamingTask 判定流水线任务的结束原因并更新任务状态
+func (e *TaskExecutor) finishStreamingTask(ctx context.Context, task *models.Task, scanPipe *pipeline.StreamingPipeline, events *TaskEventWriter, resultCount int) {
+	taskID := task.ID.Hex()
+	end := TaskEnd{
+		CancelReason: CancelReason(ctx),
+		Err:          scanPipe.Err(),
+		FailedModule: scanPipe.FailedModule(),
+		Report:       scanPipe.GetProgressReport(),
+	}
 	currentTask, err := e.taskService.GetTaskByID(taskID)
 	if err != nil || currentTask == nil {
-		log.Printf("[TaskExecutor] Task %s was deleted during execution", taskID)
+		end.Deleted = true
+	} else {
+		end.Status = currentTask.Status
+	}
+
+	if !end.Deleted {
+		e.saveCheckpoint(task, scanPipe)
+		e.recordUnmappedTechnologies(task, scanPipe)
+		e.recordSuppressionStats(task, scanPipe.Suppression())
+	}
+
+	term := ClassifyTermination(end)
+	if term == nil {
+		log.Printf("[TaskExecutor] Task %s was paused during execution", taskID)
 		return
 	}
-	if currentTask.Status == models.TaskStatusCancelled {
+	term.NodeID = e.nodeID
+	recordTerminationEvent(events, term)
+
+	switch term.Reason {
+	case models.TerminationDeleted:
+		// 任务文档已删除，结束原因只能记录到任务日志
+		log.Printf("[TaskExecutor] Task %s was deleted during execution", taskID)
+		e.taskService.AddTaskLog(taskID, "warn", term.Message,
+			fmt.Sprintf("termination_reason=%s progress=%d", term.Reason, term.Progress))
+	case models.TerminationUserCancel:
 		log.Printf("[TaskExecutor] Task %s was cancelled during execution", taskID)
+		e.taskService.UpdateTask(taskID, terminationUpdates(term))
+	case models.TerminationWorkerShutdown:
+		// 保持 Running 状态，由 Stop 改回 Pending 并重新入队
+		log.Printf("[TaskExecutor] Task %s interrupted by executor shutdown", taskID)
+		e.taskService.UpdateTask(taskID, terminationUpdates(term))
+	case models.TerminationCompleted:
+		e.completeTask(task, resultCount)
+	default:
+		// 流水线超过时间上限或被看门狗强制终止
+		e.failTaskWithTermination(task, term)
+	}
+}
+
+// flushCDNInfo 批量更新子域名的 CDN 信息
+func (e *TaskExecutor) flushCDNInfo(taskID string, cdnInfo map[string]pipeline.DomainSkip) {
+	if len(cdnInfo) == 0 {
 		return
 	}
+	log.Printf("[TaskExecutor] Updating CDN info for %d subdomains", len(cdnInfo))
+	for domain, skip := range cdnInfo {
+		if err := e.resultService.UpdateSubdomainCDN(taskID, domain, skip.CDN, skip.Evidence); err != nil {
+			log.Printf("[TaskExecutor] Failed to update CDN info for %s: %v", domain, err)
+		}
+	}
+}
 
-	// 任务完成
-	log.Printf("[TaskExecutor] Task %s completed: subdomains=%d, ports=%d, vulns=%d, urls=%d",
-		taskID, subdomainCount, portCount, vulnCount, urlCount)
-	e.completeTask(task, resultCount)
+// recordUnmappedTechnologies 记录任务中别名文件未收录的技术名称
+func (e *TaskExecutor) recordUnmappedTechnologies(task *models.Task, scanPipe *pipeline.StreamingPipeline) {
+	unmapped := scanPipe.UnmappedTechnologies()
+	if len(unmapped) == 0 {
+		return
+	}
+	report := make([]models.UnmappedTechnology, 0, len(unmapped))
+	for _, u := range unmapped {
+		report = append(report, models.UnmappedTechnology{Name: u.Name, Raw: u.Raw, Count: u.Count})
+	}
+	log.Printf("[TaskExecutor] Task %s saw %d technology names not in aliases.yaml", task.ID.Hex(), len(report))
+	e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
+		"unmapped_technologies": report,
+	})
 }
 
 // updateProgress 更新任务进度（简单版本）
@@ -697,50 +1230,49 @@ func (e *TaskExecutor) updateProgressWithDetails(task *models.Task, report *pipe
 		return
 	}
 	
-	// 构建进度详情
-	progressDetails := map[string]interface{}{
-		"current_module":     report.CurrentModule,
-		"elapsed_time":       report.ElapsedTime,
-		"estimated_time_left": report.EstimatedTimeLeft,
-		"total_results":      report.TotalResults,
-	}
-	
-	// 模块进度
-	moduleProgress := make(map[string]interface{})
-	for name, mp := range report.ModuleProgresses {
-		moduleProgress[name] = map[string]interface{}{
-			"status":     mp.Status,
-			"progress":   mp.Progress,
-			"total":      mp.TotalItems,
-			"processed":  mp.ProcessedItems,
-			"output":     mp.OutputItems,
-		}
-	}
-	progressDetails["modules"] = moduleProgress
-	
 	e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
 		"progress":         report.OverallProgress,
-		"progress_details": progressDetails,
+		"progress_details": progressDetailsFromReport(report),
 	})
 }
 
+// handleOverrun 任务即将超过时间上限：更新进度标记并发送通知
+func (e *TaskExecutor) handleOverrun(task *models.Task, elapsed, limit time.Duration, report *pipeline.ProgressReport) {
+	log.Printf("[TaskExecutor] Task %s approaching time limit: elapsed %v of %v", task.ID.Hex(), elapsed.Round(time.Second), limit)
+
+	var currentModule string
+	if report != nil {
+		currentModule = report.CurrentModule
+		e.updateProgressWithDetails(task, report)
+	}
+	notify.GetGlobalManager().NotifyTaskOverrun(task.WorkspaceID.Hex(), task.Name, task.ID.Hex(), elapsed, limit, currentModule)
+}
+
 // saveResults 保存扫描结果
 func (e *TaskExecutor) saveResults(task *models.Task, results []models.ScanResult) {
 	resultService := NewResultService()
 	for _, result := range results {
 		if err := resultService.CreateResult(&result); err != nil {
 			log.Printf("[TaskExecutor] Failed to save result: %v", err)
+			continue
+		}
+		if err := e.assets.Record(&result); err != nil {
+			log.Printf("[TaskExecutor] %v", err)
 		}
 	}
 }
 
 // completeTask 完成任务
 func (e *TaskExecutor) completeTask(task *models.Task, resultCount int) {
+	term := NewTermination(models.TerminationCompleted, "", "", nil)
+	term.NodeID = e.nodeID
 	e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
-		"status":       models.TaskStatusCompleted,
-		"progress":     100,
-		"completed_at": time.Now(),
-		"result_count": resultCount,
+		"status":             models.TaskStatusCompleted,
+		"progress":           100,
+		"completed_at":       time.Now(),
+		"result_count":       resultCount,
+		"termination_reason": term.Reason,
+		"termination":        term,
 	})
 	log.Printf("[TaskExecutor] Task %s completed with %d results", task.ID.Hex(), resultCount)
 
@@ -751,15 +1283,38 @@ func (e *TaskExecutor) completeTask(task *models.Task, resultCount int) {
 		"targets":      task.Targets,
 		"type":         task.Type,
 	}
-	notify.GetGlobalManager().NotifyTaskComplete(task.Name, task.ID.Hex(), true, summary, stats)
+	if diff := e.cruiseDiff(task); diff != nil {
+		if diffSummary := diff.Summary(); diffSummary != "" {
+			summary += "\n" + diffSummary
+		}
+		stats["diff"] = diff.Total
+		stats["diff_base_task"] = diff.TaskA
+	}
+	if taskNotifyEnabled(task) {
+		notify.GetGlobalManager().NotifyTaskComplete(task.WorkspaceID.Hex(), task.Name, task.ID.Hex(), true, summary, stats)
+	}
+
+	// 任务链：按结果创建后续任务
+	e.spawnFollowUp(task)
 }
 
-// failTask 任务失败
+// failTask 任务失败，结束原因记为模块异常
 func (e *TaskExecutor) failTask(task *models.Task, errMsg string) {
+	e.failTaskWithTermination(task, NewTermination(models.TerminationModuleFailure, errMsg, "", nil))
+}
+
+// failTaskWithTermination 任务失败并记录结束原因（超时、模块异常）
+func (e *TaskExecutor) failTaskWithTermination(task *models.Task, term *models.TaskTermination) {
+	errMsg := term.Message
+	if term.NodeID == "" {
+		term.NodeID = e.nodeID
+	}
 	e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
-		"status":       models.TaskStatusFailed,
-		"completed_at": time.Now(),
-		"error":        errMsg,
+		"status":             models.TaskStatusFailed,
+		"completed_at":       time.Now(),
+		"error":              errMsg,
+		"termination_reason": term.Reason,
+		"termination":        term,
 	})
 	log.Printf("[TaskExecutor] Task %s failed: %s", task.ID.Hex(), errMsg)
 
@@ -770,7 +1325,63 @@ func (e *TaskExecutor) failTask(task *models.Task, errMsg string) {
 		"targets": task.Targets,
 		"type":    task.Type,
 	}
-	notify.GetGlobalManager().NotifyTaskComplete(task.Name, task.ID.Hex(), false, summary, stats)
+	if taskNotifyEnabled(task) {
+		notify.GetGlobalManager().NotifyTaskComplete(task.WorkspaceID.Hex(), task.Name, task.ID.Hex(), false, summary, stats)
+	}
+}
+
+// taskNotifyEnabled 任务配置（或创建任务的模板）未关闭通知时发送完成和失败通知
+func taskNotifyEnabled(task *models.Task) bool {
+	return task.Config.NotifyOnComplete == nil || *task.Config.NotifyOnComplete
+}
+
+// PortResultData 端口结果保存的字段，TLS 端口带上证书的主题和有效期
+func PortResultData(r pipeline.PortAlive) bson.M {
+	data := bson.M{
+		"host":     r.Host,
+		"ip":       r.IP,
+		"port":     r.Port,
+		"service":  r.Service,
+		"protocol": r.Protocol,
+		"tls":      r.TLS,
+	}
+	if r.Family != "" {
+		data["family"] = r.Family
+	}
+	if r.ResponseTimeMs > 0 {
+		data["response_time_ms"] = r.ResponseTimeMs
+	}
+	if cert := r.Certificate; cert != nil {
+		data["certificate"] = bson.M{
+			"subject":     cert.Subject,
+			"issuer":      cert.Issuer,
+			"not_after":   cert.NotAfter,
+			"expired":     cert.Expired,
+			"self_signed": cert.SelfSigned,
+			"sans":        cert.SANs,
+		}
+	}
+	return data
+}
+
+// PortFingerprintData 端口指纹合并到端口结果的字段，按 ip/host + port 匹配端口结果；
+// 没有识别出版本和服务指纹时返回 nil
+func PortFingerprintData(r pipeline.AssetOther) bson.M {
+	if r.Port == "" || (r.Version == "" && len(r.Fingerprints) == 0) {
+		return nil
+	}
+	data := bson.M{
+		"host": r.Host,
+		"ip":   r.IP,
+		"port": r.Port,
+	}
+	if r.Version != "" {
+		data["version"] = r.Version
+	}
+	if len(r.Fingerprints) > 0 {
+		data["fingerprints"] = r.Fingerprints
+	}
+	return data
 }
 
 // executorIsIPAddress 判断是否为 IP 地址 (executor专用)
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"moongazing/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 任务优先级队列
+// 每种任务类型按优先级分为 task:queue:<type>:high / normal / low 三个 Redis 列表，
+// 执行器依次从 high、normal、low 中取任务，同一优先级内先进先出。
+// 升级前入队的任务仍在 task:queue:<type> 中，按 normal 处理，在 normal 列表之前取出。
+
+// taskPriorityOrder 出队顺序
+var taskPriorityOrder = []models.TaskPriority{
+	models.TaskPriorityHigh,
+	models.TaskPriorityNormal,
+	models.TaskPriorityLow,
+}
+
+// ValidTaskPriority 检查优先级，为空视为 normal
+func ValidTaskPriority(priority models.TaskPriority) error {
+	switch priority {
+	case "", models.TaskPriorityHigh, models.TaskPriorityNormal, models.TaskPriorityLow:
+		return nil
+	}
+	return errors.New("无效的任务优先级: " + string(priority) + "，可选 high、normal、low")
+}
+
+// NormalizeTaskPriority 为空或无效的优先级按 normal 处理
+func NormalizeTaskPriority(priority models.TaskPriority) models.TaskPriority {
+	if priority == "" || ValidTaskPriority(priority) != nil {
+		return models.TaskPriorityNormal
+	}
+	return priority
+}
+
+// LegacyTaskQueueKey 升级前不区分优先级的队列
+func LegacyTaskQueueKey(taskType string) string {
+	return "task:queue:" + taskType
+}
+
+// TaskQueueKey 任务类型和优先级对应的队列
+func TaskQueueKey(taskType string, priority models.TaskPriority) string {
+	return LegacyTaskQueueKey(taskType) + ":" + string(NormalizeTaskPriority(priority))
+}
+
+// TaskQueueKeys 任务类型的所有队列，按出队顺序排列
+func TaskQueueKeys(taskType string) []string {
+	keys := make([]string, 0, len(taskPriorityOrder)+1)
+	for _, priority := range taskPriorityOrder {
+		if priority == models.TaskPriorityNormal {
+			// 旧队列中的任务入队更早，排在 normal 之前
+			keys = append(keys, LegacyTaskQueueKey(taskType))
+		}
+		keys = append(keys, TaskQueueKey(taskType, priority))
+	}
+	return keys
+}
+
+// TaskQueueStore 任务队列依赖的列表操作
+type TaskQueueStore interface {
+	// Push 追加到队列末尾
+	Push(ctx context.Context, key, taskID string) error
+	// Pop 取出队列头部的任务，队列为空时 ok 为 false
+	Pop(ctx context.Context, key string) (taskID string, ok bool, err error)
+	// Move 在一个事务中把任务从 from 移到 to 的末尾，任务不在 from 中时返回 false
+	Move(ctx context.Context, from, to, taskID string) (bool, error)
+}
+
+// EnqueueTaskID 按任务的优先级入队
+func EnqueueTaskID(ctx context.Context, store TaskQueueStore, task *models.Task) error {
+	return store.Push(ctx, TaskQueueKey(string(task.Type), task.Priority), task.ID.Hex())
+}
+
+// DequeueTaskID 按优先级取出下一个任务，返回任务 ID 和所在队列，所有队列为空时 ID 为空
+func DequeueTaskID(ctx context.Context, store TaskQueueStore, taskType string) (taskID, queueKey string, err error) {
+	for _, key := range TaskQueueKeys(taskType) {
+		id, ok, err := store.Pop(ctx, key)
+		if err != nil {
+			return "", key, err
+		}
+		if ok {
+			return id, key, nil
+		}
+	}
+	return "", "", nil
+}
+
+// MoveQueuedTask 把排队中的任务移到新优先级的队列，任务不在任何队列中时返回 false
+func MoveQueuedTask(ctx context.Context, store TaskQueueStore, task *models.Task, priority models.TaskPriority) (bool, error) {
+	taskType := string(task.Type)
+	to := TaskQueueKey(taskType, priority)
+	for _, from := range TaskQueueKeys(taskType) {
+		if from == to {
+			continue
+		}
+		moved, err := store.Move(ctx, from, to, task.ID.Hex())
+		if err != nil || moved {
+			return moved, err
+		}
+	}
+	return false, nil
+}
+
+// redisTaskQueue 基于 Redis 列表的任务队列
+type redisTaskQueue struct {
+	rdb *redis.Client
+}
+
+// NewRedisTaskQueue 创建 Redis 任务队列
+func NewRedisTaskQueue(rdb *redis.Client) TaskQueueStore {
+	return &redisTaskQueue{rdb: rdb}
+}
+
+// Push RPUSH
+func (q *redisTaskQueue) Push(ctx context.Context, key, taskID string) error {
+	return q.rdb.RPush(ctx, key, taskID).Err()
+}
+
+// Pop LPOP
+func (q *redisTaskQueue) Pop(ctx context.Context, key string) (string, bool, error) {
+	id, err := q.rdb.LPop(ctx, key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// moveRetries 队列在事务期间被修改（执行器出队等）时的重试次数
+const moveRetries = 3
+
+// Move WATCH 来源队列，确认任务在队列中后以 MULTI 执行 LREM + RPUSH
+func (q *redisTaskQueue) Move(ctx context.Context, from, to, taskID string) (bool, error) {
+	for i := 0; i < moveRetries; i++ {
+		moved := false
+		err := q.rdb.Watch(ctx, func(tx *redis.Tx) error {
+			if _, err := tx.LPos(ctx, from, taskID, redis.LPosArgs{}).Result(); err != nil {
+				return err
+			}
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LRem(ctx, from, 0, taskID)
+				pipe.RPush(ctx, to, taskID)
+				return nil
+			})
+			moved = err == nil
+			return err
+		}, from)
+		switch err {
+		case nil:
+			return moved, nil
+		case redis.Nil:
+			return false, nil
+		case redis.TxFailedErr:
+			continue
+		default:
+			return false, err
+		}
+	}
+	return false, redis.TxFailedErr
+}
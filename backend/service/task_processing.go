@@ -0,0 +1,514 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 可靠任务队列
+// 出队时用 LMOVE 把任务 ID 从待执行队列原子地移到 worker 自己的处理中列表 task:processing:<worker-id>，
+// 任务结束后再从处理中列表删除（确认），出队和登记之间进程崩溃也不会丢失任务。
+// worker 登记在 task:workers 中，执行器定期刷新每个 worker 带过期时间的心跳。
+// taskStatusMonitor 定期回收心跳已过期的 worker：处理中列表里的任务改回 Pending 放回待执行队列并累计尝试次数，
+// 累计 MaxTaskAttempts 次后移到死信队列 task:dead，任务标记为失败。
+// 启动时的孤儿任务恢复处理任务后从任务所在执行器的处理中列表删除，同一任务只由一方重新入队。
+
+const (
+	// MaxTaskAttempts 执行节点失联的次数上限，达到后任务移到死信队列
+	MaxTaskAttempts = 3
+	// DeadLetterQueueKey 死信队列
+	DeadLetterQueueKey = "task:dead"
+	// MaxRetriesExceededError 移到死信队列的任务的错误信息
+	MaxRetriesExceededError = "max retries exceeded"
+
+	processingQueuePrefix = "task:processing:"
+	workerRegistryKey     = "task:workers"
+	workerHeartbeatPrefix = "task:worker:heartbeat:"
+	taskAttemptsKey       = "task:attempts"
+	reaperLockKey         = "task:reaper:lock"
+	reaperLockTTL         = 30 * time.Second
+)
+
+// ProcessingQueueKey worker 的处理中列表
+func ProcessingQueueKey(workerID string) string {
+	return processingQueuePrefix + workerID
+}
+
+// ProcessingQueueStore 可靠任务队列依赖的存储操作
+type ProcessingQueueStore interface {
+	TaskQueueStore
+	// Claim 在一个操作中取出 from 头部的任务并追加到 processing 末尾，队列为空时 ok 为 false
+	Claim(ctx context.Context, from, processing string) (taskID string, ok bool, err error)
+	// Ack 从 processing 中删除任务
+	Ack(ctx context.Context, processing, taskID string) error
+	// Processing 处理中列表的全部任务
+	Processing(ctx context.Context, processing string) ([]string, error)
+	// IncrAttempts 任务的尝试次数加一，返回累计次数
+	IncrAttempts(ctx context.Context, taskID string) (int, error)
+	// ResetAttempts 清除任务的尝试次数
+	ResetAttempts(ctx context.Context, taskID string) error
+	// RegisterWorker 登记 worker 并写入心跳
+	RegisterWorker(ctx context.Context, workerID string, ttl time.Duration) error
+	// UnregisterWorker 取消登记并删除心跳
+	UnregisterWorker(ctx context.Context, workerID string) error
+	// RefreshWorkers 刷新 worker 心跳
+	RefreshWorkers(ctx context.Context, workerIDs []string, ttl time.Duration) error
+	// Workers 已登记的 worker
+	Workers(ctx context.Context) ([]string, error)
+	// WorkerAlive worker 心跳是否未过期
+	WorkerAlive(ctx context.Context, workerID string) (bool, error)
+	// AcquireLock 获取回收锁，多个执行器只有一个同时回收
+	AcquireLock(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+	// ReleaseLock 释放回收锁（仅释放自己持有的锁）
+	ReleaseLock(ctx context.Context, owner string) error
+}
+
+// ClaimTaskID 按优先级取出下一个任务并放入 worker 的处理中列表，所有队列为空时 ID 为空
+func ClaimTaskID(ctx context.Context, store ProcessingQueueStore, taskType, workerID string) (taskID, queueKey string, err error) {
+	processing := ProcessingQueueKey(workerID)
+	for _, key := range TaskQueueKeys(taskType) {
+		id, ok, err := store.Claim(ctx, key, processing)
+		if err != nil {
+			return "", key, err
+		}
+		if ok {
+			return id, key, nil
+		}
+	}
+	return "", "", nil
+}
+
+// AckTaskID 任务处理结束，从 worker 的处理中列表删除并清除尝试次数
+func AckTaskID(ctx context.Context, store ProcessingQueueStore, workerID, taskID string) error {
+	if err := store.Ack(ctx, ProcessingQueueKey(workerID), taskID); err != nil {
+		return err
+	}
+	return store.ResetAttempts(ctx, taskID)
+}
+
+// ReleaseWorker worker 退出时取消登记，处理中列表不为空时保留登记，由回收处理
+func ReleaseWorker(ctx context.Context, store ProcessingQueueStore, workerID string) error {
+	pending, err := store.Processing(ctx, ProcessingQueueKey(workerID))
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return nil
+	}
+	return store.UnregisterWorker(ctx, workerID)
+}
+
+// ReapTaskStore 回收任务依赖的任务状态操作
+type ReapTaskStore interface {
+	// GetTask 查询任务，不存在时返回 nil
+	GetTask(ctx context.Context, taskID string) (*models.Task, error)
+	// RequeueTask 将仍由 task.NodeID 执行的 Running 任务改回 Pending，note 记录到任务进度，返回是否实际更新
+	RequeueTask(ctx context.Context, task *models.Task, note string) (bool, error)
+	// FailTask 将仍由 task.NodeID 执行的 Running 任务标记为失败，返回是否实际更新
+	FailTask(ctx context.Context, task *models.Task, errMsg string) (bool, error)
+}
+
+// ReapReport 回收结果
+type ReapReport struct {
+	Requeued     []string `json:"requeued"`      // 放回待执行队列的任务
+	DeadLettered []string `json:"dead_lettered"` // 移到死信队列的任务
+	Dropped      []string `json:"dropped"`       // 已结束或已删除、直接确认的任务
+	Workers      []string `json:"workers"`       // 回收的 worker
+}
+
+// ReapOptions 回收选项
+type ReapOptions struct {
+	NodeID      string // 当前执行器 ID，作为回收锁的持有者
+	MaxAttempts int    // 尝试次数上限，0 使用 MaxTaskAttempts
+}
+
+// ReapDeadWorkers 回收心跳已过期的 worker 处理中的任务
+// 重复执行是安全的：任务状态更新以任务仍由失联 worker 所在的执行器运行为条件，任务处理完才从处理中列表移走
+func ReapDeadWorkers(ctx context.Context, queue ProcessingQueueStore, tasks ReapTaskStore, opts ReapOptions) (*ReapReport, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = MaxTaskAttempts
+	}
+
+	report := &ReapReport{}
+	acquired, err := queue.AcquireLock(ctx, opts.NodeID, reaperLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("获取回收锁失败: %w", err)
+	}
+	if !acquired {
+		return report, nil
+	}
+	defer queue.ReleaseLock(ctx, opts.NodeID)
+
+	workers, err := queue.Workers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("查询 worker 失败: %w", err)
+	}
+	for _, workerID := range workers {
+		alive, err := queue.WorkerAlive(ctx, workerID)
+		if err != nil {
+			log.Printf("[TaskReaper] Failed to check worker %s: %v", workerID, err)
+			continue
+		}
+		if alive {
+			continue
+		}
+		if reapWorker(ctx, queue, tasks, workerID, opts.MaxAttempts, report) {
+			report.Workers = append(report.Workers, workerID)
+		}
+	}
+	return report, nil
+}
+
+// reapWorker 处理一个已失联 worker 的处理中列表，列表处理完时取消登记并返回 true
+func reapWorker(ctx context.Context, queue ProcessingQueueStore, tasks ReapTaskStore, workerID string, maxAttempts int, report *ReapReport) bool {
+	processing := ProcessingQueueKey(workerID)
+	taskIDs, err := queue.Processing(ctx, processing)
+	if err != nil {
+		log.Printf("[TaskReaper] Failed to list processing tasks of worker %s: %v", workerID, err)
+		return false
+	}
+
+	done := true
+	for _, taskID := range taskIDs {
+		if err := reapTask(ctx, queue, tasks, workerID, taskID, maxAttempts, report); err != nil {
+			log.Printf("[TaskReaper] Failed to reap task %s of worker %s: %v", taskID, workerID, err)
+			done = false
+		}
+	}
+	if !done {
+		return false
+	}
+	if err := queue.UnregisterWorker(ctx, workerID); err != nil {
+		log.Printf("[TaskReaper] Failed to unregister worker %s: %v", workerID, err)
+		return false
+	}
+	return true
+}
+
+// reapTask 仍由失联 worker 所在执行器运行的任务，达到尝试次数上限的移到死信队列，其余改回 Pending 放回待执行队列；
+// 已结束的任务，以及已改回 Pending（孤儿任务恢复已重新入队）或已由其他执行器接手的任务，只从处理中列表删除
+func reapTask(ctx context.Context, queue ProcessingQueueStore, tasks ReapTaskStore, workerID, taskID string, maxAttempts int, report *ReapReport) error {
+	processing := ProcessingQueueKey(workerID)
+	task, err := tasks.GetTask(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil || task.Status != models.TaskStatusRunning || task.NodeID == "" || task.NodeID != workerNodeID(workerID) {
+		report.Dropped = append(report.Dropped, taskID)
+		return dropProcessingTask(ctx, queue, processing, taskID)
+	}
+
+	attempts, err := queue.IncrAttempts(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	if attempts >= maxAttempts {
+		ok, err := tasks.FailTask(ctx, task, MaxRetriesExceededError)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 期间任务已结束或已由其他执行器接手
+			report.Dropped = append(report.Dropped, taskID)
+			return dropProcessingTask(ctx, queue, processing, taskID)
+		}
+		if _, err := queue.Move(ctx, processing, DeadLetterQueueKey, taskID); err != nil {
+			return err
+		}
+		log.Printf("[TaskReaper] Task %s moved to dead-letter queue after %d attempts", taskID, attempts)
+		report.DeadLettered = append(report.DeadLettered, taskID)
+		return queue.ResetAttempts(ctx, taskID)
+	}
+
+	note := fmt.Sprintf("执行节点失联，任务已重新入队（第 %d 次）", attempts)
+	ok, err := tasks.RequeueTask(ctx, task, note)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 期间任务已结束或已由其他执行器接手
+		report.Dropped = append(report.Dropped, taskID)
+		return dropProcessingTask(ctx, queue, processing, taskID)
+	}
+	if _, err := queue.Move(ctx, processing, TaskQueueKey(string(task.Type), task.Priority), taskID); err != nil {
+		return err
+	}
+	log.Printf("[TaskReaper] Requeued task %s of dead worker (attempt %d/%d)", taskID, attempts, maxAttempts)
+	report.Requeued = append(report.Requeued, taskID)
+	return nil
+}
+
+// ReleaseNodeTask 从执行器所有 worker 的处理中列表删除任务，孤儿任务恢复处理任务后调用，
+// 失联 worker 回收时不再重复处理
+func ReleaseNodeTask(ctx context.Context, queue ProcessingQueueStore, nodeID, taskID string) error {
+	if queue == nil || nodeID == "" {
+		return nil
+	}
+	workers, err := queue.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, workerID := range workers {
+		if workerNodeID(workerID) != nodeID {
+			continue
+		}
+		if err := queue.Ack(ctx, ProcessingQueueKey(workerID), taskID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workerNodeID worker 所在的执行器 ID（worker ID 为 <执行器 ID>:worker-<序号>-<任务类型>）
+func workerNodeID(workerID string) string {
+	if i := strings.LastIndex(workerID, ":"); i >= 0 {
+		return workerID[:i]
+	}
+	return ""
+}
+
+// dropProcessingTask 从处理中列表删除不再需要执行的任务
+func dropProcessingTask(ctx context.Context, queue ProcessingQueueStore, processing, taskID string) error {
+	if err := queue.Ack(ctx, processing, taskID); err != nil {
+		return err
+	}
+	return queue.ResetAttempts(ctx, taskID)
+}
+
+// NewRedisProcessingQueue 创建 Redis 可靠任务队列
+func NewRedisProcessingQueue(rdb *redis.Client) ProcessingQueueStore {
+	return &redisTaskQueue{rdb: rdb}
+}
+
+// Claim LMOVE from processing LEFT RIGHT
+func (q *redisTaskQueue) Claim(ctx context.Context, from, processing string) (string, bool, error) {
+	id, err := q.rdb.LMove(ctx, from, processing, "LEFT", "RIGHT").Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// Ack LREM
+func (q *redisTaskQueue) Ack(ctx context.Context, processing, taskID string) error {
+	return q.rdb.LRem(ctx, processing, 0, taskID).Err()
+}
+
+// Processing LRANGE
+func (q *redisTaskQueue) Processing(ctx context.Context, processing string) ([]string, error) {
+	return q.rdb.LRange(ctx, processing, 0, -1).Result()
+}
+
+// IncrAttempts HINCRBY
+func (q *redisTaskQueue) IncrAttempts(ctx context.Context, taskID string) (int, error) {
+	n, err := q.rdb.HIncrBy(ctx, taskAttemptsKey, taskID, 1).Result()
+	return int(n), err
+}
+
+// ResetAttempts HDEL
+func (q *redisTaskQueue) ResetAttempts(ctx context.Context, taskID string) error {
+	return q.rdb.HDel(ctx, taskAttemptsKey, taskID).Err()
+}
+
+// RegisterWorker SADD 并写入心跳
+func (q *redisTaskQueue) RegisterWorker(ctx context.Context, workerID string, ttl time.Duration) error {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, workerRegistryKey, workerID)
+		pipe.Set(ctx, workerHeartbeatPrefix+workerID, time.Now().Unix(), ttl)
+		return nil
+	})
+	return err
+}
+
+// UnregisterWorker SREM 并删除心跳
+func (q *redisTaskQueue) UnregisterWorker(ctx context.Context, workerID string) error {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, workerRegistryKey, workerID)
+		pipe.Del(ctx, workerHeartbeatPrefix+workerID)
+		return nil
+	})
+	return err
+}
+
+// RefreshWorkers 批量刷新心跳
+func (q *redisTaskQueue) RefreshWorkers(ctx context.Context, workerIDs []string, ttl time.Duration) error {
+	now := time.Now().Unix()
+	_, err := q.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, workerID := range workerIDs {
+			pipe.Set(ctx, workerHeartbeatPrefix+workerID, now, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Workers SMEMBERS
+func (q *redisTaskQueue) Workers(ctx context.Context) ([]string, error) {
+	return q.rdb.SMembers(ctx, workerRegistryKey).Result()
+}
+
+// WorkerAlive 心跳 key 是否存在
+func (q *redisTaskQueue) WorkerAlive(ctx context.Context, workerID string) (bool, error) {
+	n, err := q.rdb.Exists(ctx, workerHeartbeatPrefix+workerID).Result()
+	return n > 0, err
+}
+
+// AcquireLock SETNX
+func (q *redisTaskQueue) AcquireLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return q.rdb.SetNX(ctx, reaperLockKey, owner, ttl).Result()
+}
+
+// ReleaseLock 锁仍由 owner 持有时删除
+func (q *redisTaskQueue) ReleaseLock(ctx context.Context, owner string) error {
+	val, err := q.rdb.Get(ctx, reaperLockKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if val != owner {
+		return nil
+	}
+	return q.rdb.Del(ctx, reaperLockKey).Err()
+}
+
+// mongoReapTaskStore 基于 MongoDB 的回收任务状态存储
+type mongoReapTaskStore struct {
+	taskService *TaskService
+}
+
+// NewMongoReapTaskStore 创建回收任务状态存储
+func NewMongoReapTaskStore() ReapTaskStore {
+	return &mongoReapTaskStore{taskService: NewTaskService()}
+}
+
+// GetTask 查询任务
+func (s *mongoReapTaskStore) GetTask(ctx context.Context, taskID string) (*models.Task, error) {
+	task, err := s.taskService.GetTaskByID(taskID)
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+		// 任务已删除
+		return nil, nil
+	}
+	return task, err
+}
+
+// RequeueTask 改回 Pending，带断点续扫标记
+func (s *mongoReapTaskStore) RequeueTask(ctx context.Context, task *models.Task, note string) (bool, error) {
+	res, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{"_id": task.ID, "status": models.TaskStatusRunning, "node_id": task.NodeID},
+		bson.M{"$set": bson.M{
+			"status":                models.TaskStatusPending,
+			"node_id":               "",
+			"resume":                true,
+			"progress_details.note": note,
+			"updated_at":            time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		return false, nil
+	}
+	task.Status = models.TaskStatusPending
+	s.taskService.AddTaskLog(task.ID.Hex(), "warn", note, "")
+	return true, nil
+}
+
+// FailTask 标记失败，结束原因为超过重试次数
+func (s *mongoReapTaskStore) FailTask(ctx context.Context, task *models.Task, errMsg string) (bool, error) {
+	res, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{"_id": task.ID, "status": models.TaskStatusRunning, "node_id": task.NodeID},
+		bson.M{"$set": bson.M{
+			"status":             models.TaskStatusFailed,
+			"error":              errMsg,
+			"last_error":         errMsg,
+			"completed_at":       time.Now(),
+			"updated_at":         time.Now(),
+			"termination_reason": models.TerminationMaxRetries,
+			"termination":        NewTermination(models.TerminationMaxRetries, errMsg, "", nil),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount == 0 {
+		return false, nil
+	}
+	s.taskService.AddTaskLog(task.ID.Hex(), "error", "执行节点多次失联，任务已移到死信队列", "termination_reason="+string(models.TerminationMaxRetries))
+	return true, nil
+}
+
+// reapDeadWorkers 回收失联 worker 的任务
+func (e *TaskExecutor) reapDeadWorkers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := ReapDeadWorkers(ctx, e.queue, e.reapTasks, ReapOptions{NodeID: e.nodeID})
+	if err != nil {
+		log.Printf("[TaskExecutor] Reaping dead workers failed: %v", err)
+		return
+	}
+	if len(report.Workers) > 0 {
+		log.Printf("[TaskExecutor] Reaped %d dead workers: requeued=%d, dead_lettered=%d, dropped=%d",
+			len(report.Workers), len(report.Requeued), len(report.DeadLettered), len(report.Dropped))
+	}
+}
+
+// refreshWorkers 刷新本执行器所有 worker 的心跳
+func (e *TaskExecutor) refreshWorkers(ctx context.Context) {
+	if err := e.queue.RefreshWorkers(ctx, e.queueWorkers, ExecutorHeartbeatTTL); err != nil {
+		log.Printf("[TaskExecutor] Failed to refresh worker heartbeats: %v", err)
+	}
+}
+
+// queueWorkerID worker 在可靠任务队列中的 ID，包含执行器 ID，多个执行器之间不重复
+func (e *TaskExecutor) queueWorkerID(id int, taskType string) string {
+	return fmt.Sprintf("%s:worker-%d-%s", e.nodeID, id, taskType)
+}
+
+// registerWorkers 登记本执行器的 worker
+func (e *TaskExecutor) registerWorkers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, workerID := range e.queueWorkers {
+		if err := e.queue.RegisterWorker(ctx, workerID, ExecutorHeartbeatTTL); err != nil {
+			log.Printf("[TaskExecutor] Failed to register worker %s: %v", workerID, err)
+		}
+	}
+}
+
+// releaseWorker worker 退出时取消登记
+func (e *TaskExecutor) releaseWorker(workerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ReleaseWorker(ctx, e.queue, workerID); err != nil {
+		log.Printf("[TaskExecutor] Failed to release worker %s: %v", workerID, err)
+	}
+}
+
+// ackTask 任务处理结束，从 worker 的处理中列表删除
+func (e *TaskExecutor) ackTask(workerID, taskID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := AckTaskID(ctx, e.queue, workerID, taskID); err != nil {
+		log.Printf("[TaskExecutor] Failed to ack task %s: %v", taskID, err)
+	}
+}
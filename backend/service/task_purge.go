@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 删除任务时清理所有关联数据
+// 顺序保证任何时候都不会出现指向不存在任务的引用：先停止任务，再删除磁盘文件和任务产生的数据，
+// 然后解除其他文档对任务的引用，最后才删除任务文档。中途失败时任务文档仍在，可以重新执行
+
+const (
+	// PurgeWaitTimeout 等待运行中任务退出的时间
+	PurgeWaitTimeout = 30 * time.Second
+
+	// PurgeAuditAction 清理任务的审计日志动作
+	PurgeAuditAction = "purge_task"
+)
+
+// ErrTaskStillRunning 任务仍在其他节点运行，已请求取消
+var ErrTaskStillRunning = errors.New("任务仍在运行，已请求取消，请稍后重试")
+
+// purgeDataCollections 任务产生的数据，按 task_id 直接删除
+// 工具调用记录最后删除：其中记录了磁盘上的输入文件，文件删除成功之前不能丢失
+var purgeDataCollections = []string{
+	models.CollectionScanResults,
+	models.CollectionVulnerabilities,
+	models.CollectionTaskLogs,
+	models.CollectionTaskEvents,
+	models.CollectionSuppressionSamples,
+	models.CollectionTaskCheckpoints,
+	models.CollectionTaskExecEvents,
+	models.CollectionTaskControls,
+	models.CollectionToolRuns,
+}
+
+// TaskReference 其他文档对任务的引用，清理时解除引用而不是删除文档
+type TaskReference struct {
+	Collection string
+	Field      string
+	Array      bool // 字段为任务ID列表，从列表中移除；否则清空字段
+}
+
+// Key 引用在清理报告中的名称
+func (r TaskReference) Key() string {
+	return r.Collection + "." + r.Field
+}
+
+// purgeReferences 需要解除的引用
+var purgeReferences = []TaskReference{
+	{Collection: models.CollectionTasks, Field: "child_task_ids", Array: true}, // 父任务的子任务列表
+	{Collection: models.CollectionTasks, Field: "parent_task_id"},              // 子任务的父任务
+	{Collection: models.CollectionCruiseLogs, Field: "task_id"},                // 巡航执行日志
+	{Collection: models.CollectionAssets, Field: "task_ids", Array: true},      // 发现过资产的任务
+	{Collection: models.CollectionAssets, Field: "first_task_id"},              // 首次发现资产的任务
+	{Collection: models.CollectionAssets, Field: "last_task_id"},               // 最近发现资产的任务
+	{Collection: models.CollectionFindings, Field: "first_task_id"},            // 首次发现漏洞的任务
+	{Collection: models.CollectionFindings, Field: "last_task_id"},             // 最近发现漏洞的任务
+}
+
+// PurgeStore 清理任务依赖的存储操作，每个操作重复执行都是安全的
+type PurgeStore interface {
+	// FindTask 查询任务，不存在时返回 nil
+	FindTask(ctx context.Context, taskID primitive.ObjectID) (*models.Task, error)
+	// StopTask 将未结束（等待、暂停、运行中）的任务标记为取消，防止被重新调度
+	StopTask(ctx context.Context, taskID primitive.ObjectID) error
+	// TaskFiles 任务在磁盘上的文件（工具调用的输入文件等）
+	TaskFiles(ctx context.Context, taskID primitive.ObjectID) ([]string, error)
+	// DeleteTaskData 删除集合中属于任务的文档
+	DeleteTaskData(ctx context.Context, collection string, taskID primitive.ObjectID) (int64, error)
+	// DetachTask 解除引用，返回修改的文档数
+	DetachTask(ctx context.Context, ref TaskReference, taskID primitive.ObjectID) (int64, error)
+	// DeleteTask 删除任务文档
+	DeleteTask(ctx context.Context, taskID primitive.ObjectID) (int64, error)
+	// InsertAudit 写入审计日志
+	InsertAudit(ctx context.Context, entry *models.OperationLog) error
+}
+
+// TaskCanceller 取消本进程中运行的任务
+type TaskCanceller interface {
+	// CancelAndWait 取消任务并等待其完全退出、取消注册，任务不在本进程运行时返回 false
+	CancelAndWait(taskID string, reason models.TerminationReason, timeout time.Duration) (bool, error)
+}
+
+var (
+	taskCanceller   TaskCanceller
+	taskCancellerMu sync.RWMutex
+)
+
+// SetTaskCanceller 设置本进程的任务取消器，执行器启动时调用
+func SetTaskCanceller(c TaskCanceller) {
+	taskCancellerMu.Lock()
+	defer taskCancellerMu.Unlock()
+	taskCanceller = c
+}
+
+func currentTaskCanceller() TaskCanceller {
+	taskCancellerMu.RLock()
+	defer taskCancellerMu.RUnlock()
+	return taskCanceller
+}
+
+// PurgeOptions 清理选项
+type PurgeOptions struct {
+	Canceller   TaskCanceller
+	WaitTimeout time.Duration
+	UserID      primitive.ObjectID // 审计日志中的操作人
+	Username    string
+}
+
+// PurgeReport 清理结果
+type PurgeReport struct {
+	TaskID       string           `json:"task_id"`
+	Deleted      map[string]int64 `json:"deleted"`       // 集合 -> 删除的文档数
+	Detached     map[string]int64 `json:"detached"`      // 引用 -> 解除的文档数
+	FilesRemoved int64            `json:"files_removed"` // 删除的磁盘文件数
+	TaskDeleted  bool             `json:"task_deleted"`
+}
+
+// PurgeTask 清理任务及其所有关联数据，可以重复执行：已清理的部分计数为 0
+func PurgeTask(ctx context.Context, store PurgeStore, taskID string, opts PurgeOptions) (*PurgeReport, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, errors.New("无效的任务ID")
+	}
+	if opts.WaitTimeout <= 0 {
+		opts.WaitTimeout = PurgeWaitTimeout
+	}
+
+	task, err := store.FindTask(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+
+	// 1. 停止任务：先标记取消防止被调度，再等待本进程中运行的任务完全退出
+	if task != nil {
+		if err := stopTaskForPurge(ctx, store, task, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &PurgeReport{
+		TaskID:   taskID,
+		Deleted:  make(map[string]int64),
+		Detached: make(map[string]int64),
+	}
+
+	// 2. 磁盘文件：路径记录在工具调用中，必须在删除调用记录之前处理
+	files, err := store.TaskFiles(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务文件失败: %w", err)
+	}
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			report.FilesRemoved++
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("删除任务文件 %s 失败: %w", path, err)
+		}
+	}
+
+	// 截图目录
+	if err := os.RemoveAll(ScreenshotTaskDir(taskID)); err != nil {
+		return nil, fmt.Errorf("删除任务截图失败: %w", err)
+	}
+
+	// 3. 任务产生的数据
+	for _, collection := range purgeDataCollections {
+		n, err := store.DeleteTaskData(ctx, collection, objID)
+		if err != nil {
+			return nil, fmt.Errorf("清理 %s 失败: %w", collection, err)
+		}
+		report.Deleted[collection] = n
+	}
+
+	// 4. 其他文档对任务的引用
+	for _, ref := range purgeReferences {
+		n, err := store.DetachTask(ctx, ref, objID)
+		if err != nil {
+			return nil, fmt.Errorf("解除 %s 引用失败: %w", ref.Key(), err)
+		}
+		report.Detached[ref.Key()] = n
+	}
+
+	// 5. 任务文档
+	n, err := store.DeleteTask(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("删除任务失败: %w", err)
+	}
+	report.Deleted[models.CollectionTasks] = n
+	report.TaskDeleted = n > 0
+
+	// 审计日志失败不影响清理结果
+	if err := store.InsertAudit(ctx, purgeAuditEntry(task, report, opts)); err != nil {
+		log.Printf("[TaskPurge] Failed to write audit entry for task %s: %v", taskID, err)
+	}
+	log.Printf("[TaskPurge] Purged task %s: deleted=%v detached=%v files=%d", taskID, report.Deleted, report.Detached, report.FilesRemoved)
+	return report, nil
+}
+
+// stopTaskForPurge 停止任务，任务仍在其他节点运行时返回 ErrTaskStillRunning
+func stopTaskForPurge(ctx context.Context, store PurgeStore, task *models.Task, opts PurgeOptions) error {
+	switch task.Status {
+	case models.TaskStatusPending, models.TaskStatusPaused, models.TaskStatusRunning:
+	default:
+		return nil
+	}
+
+	if err := store.StopTask(ctx, task.ID); err != nil {
+		return fmt.Errorf("取消任务失败: %w", err)
+	}
+	if task.Status != models.TaskStatusRunning {
+		return nil
+	}
+
+	if opts.Canceller != nil {
+		owned, err := opts.Canceller.CancelAndWait(task.ID.Hex(), models.TerminationDeleted, opts.WaitTimeout)
+		if err != nil {
+			return err
+		}
+		if owned {
+			return nil
+		}
+	}
+	// 其他节点上运行的任务由其状态监控取消，任务退出后重新执行清理
+	return ErrTaskStillRunning
+}
+
+// purgeAuditEntry 清理的审计日志，记录每个集合的删除数量
+func purgeAuditEntry(task *models.Task, report *PurgeReport, opts PurgeOptions) *models.OperationLog {
+	detail := map[string]interface{}{
+		"deleted":       report.Deleted,
+		"detached":      report.Detached,
+		"files_removed": report.FilesRemoved,
+		"task_deleted":  report.TaskDeleted,
+	}
+	if task != nil {
+		detail["task_name"] = task.Name
+	}
+	data, _ := json.Marshal(detail)
+	return &models.OperationLog{
+		ID:        primitive.NewObjectID(),
+		UserID:    opts.UserID,
+		Username:  opts.Username,
+		Action:    PurgeAuditAction,
+		Module:    "task",
+		Target:    report.TaskID,
+		Detail:    string(data),
+		Status:    1,
+		CreatedAt: time.Now(),
+	}
+}
+
+// PurgeTask 清理任务及其所有关联数据
+func (s *TaskService) PurgeTask(taskID string, userID primitive.ObjectID, username string) (*PurgeReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), PurgeWaitTimeout+30*time.Second)
+	defer cancel()
+
+	return PurgeTask(ctx, &mongoPurgeStore{}, taskID, PurgeOptions{
+		Canceller: currentTaskCanceller(),
+		UserID:    userID,
+		Username:  username,
+	})
+}
+
+// mongoPurgeStore 基于 MongoDB 的清理存储
+type mongoPurgeStore struct{}
+
+// FindTask 查询任务
+func (s *mongoPurgeStore) FindTask(ctx context.Context, taskID primitive.ObjectID) (*models.Task, error) {
+	var task models.Task
+	err := database.GetCollection(models.CollectionTasks).FindOne(ctx, bson.M{"_id": taskID}).Decode(&task)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// StopTask 标记未结束的任务为取消
+func (s *mongoPurgeStore) StopTask(ctx context.Context, taskID primitive.ObjectID) error {
+	_, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{
+			"_id":    taskID,
+			"status": bson.M{"$in": []models.TaskStatus{models.TaskStatusPending, models.TaskStatusPaused, models.TaskStatusRunning}},
+		},
+		bson.M{"$set": bson.M{"status": models.TaskStatusCancelled, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// TaskFiles 工具调用记录中的输入文件
+func (s *mongoPurgeStore) TaskFiles(ctx context.Context, taskID primitive.ObjectID) ([]string, error) {
+	cursor, err := database.GetCollection(models.CollectionToolRuns).Find(ctx, bson.M{"task_id": taskID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var runs []models.ToolRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, run := range runs {
+		for _, input := range run.Inputs {
+			files = append(files, input.Path)
+		}
+	}
+	return files, nil
+}
+
+// DeleteTaskData 删除集合中属于任务的文档
+func (s *mongoPurgeStore) DeleteTaskData(ctx context.Context, collection string, taskID primitive.ObjectID) (int64, error) {
+	res, err := database.GetCollection(collection).DeleteMany(ctx, bson.M{"task_id": taskID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// DetachTask 解除引用
+func (s *mongoPurgeStore) DetachTask(ctx context.Context, ref TaskReference, taskID primitive.ObjectID) (int64, error) {
+	update := bson.M{"$unset": bson.M{ref.Field: ""}}
+	if ref.Array {
+		update = bson.M{"$pull": bson.M{ref.Field: taskID}}
+	}
+	res, err := database.GetCollection(ref.Collection).UpdateMany(ctx, bson.M{ref.Field: taskID}, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// DeleteTask 删除任务文档
+func (s *mongoPurgeStore) DeleteTask(ctx context.Context, taskID primitive.ObjectID) (int64, error) {
+	res, err := database.GetCollection(models.CollectionTasks).DeleteOne(ctx, bson.M{"_id": taskID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// InsertAudit 写入操作日志
+func (s *mongoPurgeStore) InsertAudit(ctx context.Context, entry *models.OperationLog) error {
+	_, err := database.GetCollection(models.CollectionOperationLog).InsertOne(ctx, entry)
+	return err
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 启动时恢复孤儿任务
+// 进程被杀死（OOM、发布）后，Running 状态的任务不会再被任何执行器处理
+// 启动时找出这些任务：有断点的重新入队，其余标记为失败并保留已保存的结果
+
+const (
+	// DefaultOrphanThreshold 任务开始时间早于该阈值才视为孤儿任务
+	DefaultOrphanThreshold = 10 * time.Minute
+	// ExecutorHeartbeatTTL 执行器心跳过期时间
+	ExecutorHeartbeatTTL = 30 * time.Second
+	// executorHeartbeatInterval 执行器心跳刷新间隔
+	executorHeartbeatInterval = 10 * time.Second
+	// OrphanInterruptedError 孤儿任务标记失败时的错误信息
+	OrphanInterruptedError = "interrupted by restart"
+
+	recoveryLockKey         = "task:recovery:lock"
+	recoveryLockTTL         = 2 * time.Minute
+	executorHeartbeatPrefix = "task:executor:heartbeat:"
+)
+
+// RecoveryStore 孤儿任务恢复依赖的存储操作
+type RecoveryStore interface {
+	// AcquireLock 获取分布式锁，多个实例同时启动时只有一个执行恢复
+	AcquireLock(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+	// ReleaseLock 释放分布式锁（仅释放自己持有的锁）
+	ReleaseLock(ctx context.Context, owner string) error
+	// FindRunningTasks 查询开始时间早于 startedBefore 的 Running 任务
+	FindRunningTasks(ctx context.Context, startedBefore time.Time) ([]*models.Task, error)
+	// IsNodeAlive 检查执行节点是否仍有心跳
+	IsNodeAlive(ctx context.Context, nodeID string) (bool, error)
+	// CountResults 统计任务已保存的结果数量
+	CountResults(ctx context.Context, taskID primitive.ObjectID) (int64, error)
+	// FailTask 将仍处于 Running 的任务标记为失败，返回是否实际更新
+	FailTask(ctx context.Context, taskID primitive.ObjectID, errMsg string, resultCount int64) (bool, error)
+	// RequeueTask 将仍处于 Running 的任务重新入队，返回是否实际更新
+	RequeueTask(ctx context.Context, task *models.Task) (bool, error)
+}
+
+// RecoveryReport 恢复结果
+type RecoveryReport struct {
+	Failed   []string `json:"failed"`   // 标记为失败的任务
+	Requeued []string `json:"requeued"` // 重新入队的任务
+	Skipped  []string `json:"skipped"`  // 仍在其他节点运行的任务
+}
+
+// RecoveryOptions 恢复选项
+type RecoveryOptions struct {
+	NodeID    string                   // 当前执行器 ID
+	Threshold time.Duration            // 孤儿任务判定阈值
+	IsRunning func(taskID string) bool // 当前进程中是否正在运行
+	Now       func() time.Time         // 当前时间（测试使用）
+	// Queue 可靠任务队列，处理后的任务从所在执行器的处理中列表删除，为 nil 时不处理
+	Queue ProcessingQueueStore
+}
+
+// RecoverOrphanedTasks 恢复孤儿任务
+// 重复执行是安全的：状态更新都以任务仍处于 Running 为条件
+func RecoverOrphanedTasks(ctx context.Context, store RecoveryStore, opts RecoveryOptions) (*RecoveryReport, error) {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultOrphanThreshold
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	acquired, err := store.AcquireLock(ctx, opts.NodeID, recoveryLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("获取恢复锁失败: %w", err)
+	}
+	report := &RecoveryReport{}
+	if !acquired {
+		log.Printf("[TaskRecovery] Another instance is recovering orphaned tasks, skipping")
+		return report, nil
+	}
+	defer store.ReleaseLock(ctx, opts.NodeID)
+
+	tasks, err := store.FindRunningTasks(ctx, opts.Now().Add(-opts.Threshold))
+	if err != nil {
+		return nil, fmt.Errorf("查询运行中任务失败: %w", err)
+	}
+
+	for _, task := range tasks {
+		taskID := task.ID.Hex()
+
+		if opts.IsRunning != nil && opts.IsRunning(taskID) {
+			continue
+		}
+
+		// 其他存活节点上的任务不处理
+		if task.NodeID != "" && task.NodeID != opts.NodeID {
+			alive, err := store.IsNodeAlive(ctx, task.NodeID)
+			if err != nil {
+				log.Printf("[TaskRecovery] Failed to check node %s for task %s: %v", task.NodeID, taskID, err)
+				report.Skipped = append(report.Skipped, taskID)
+				continue
+			}
+			if alive {
+				report.Skipped = append(report.Skipped, taskID)
+				continue
+			}
+		}
+
+		if canResumeTask(task) {
+			ok, err := store.RequeueTask(ctx, task)
+			if err != nil {
+				log.Printf("[TaskRecovery] Failed to requeue task %s: %v", taskID, err)
+				continue
+			}
+			if ok {
+				log.Printf("[TaskRecovery] Requeued orphaned task %s from checkpoint %d", taskID, task.ResultStats.LastScannedIndex)
+				report.Requeued = append(report.Requeued, taskID)
+				releaseRecoveredTask(ctx, opts.Queue, task)
+			}
+			continue
+		}
+
+		// 结果数以实际保存的结果为准
+		count, err := store.CountResults(ctx, task.ID)
+		if err != nil {
+			log.Printf("[TaskRecovery] Failed to count results for task %s: %v", taskID, err)
+			continue
+		}
+		ok, err := store.FailTask(ctx, task.ID, OrphanInterruptedError, count)
+		if err != nil {
+			log.Printf("[TaskRecovery] Failed to mark task %s failed: %v", taskID, err)
+			continue
+		}
+		if ok {
+			log.Printf("[TaskRecovery] Marked orphaned task %s failed, preserved %d results", taskID, count)
+			report.Failed = append(report.Failed, taskID)
+			releaseRecoveredTask(ctx, opts.Queue, task)
+		}
+	}
+
+	return report, nil
+}
+
+// releaseRecoveredTask 从任务原执行器的处理中列表删除已恢复的任务，避免失联 worker 回收时再次入队
+func releaseRecoveredTask(ctx context.Context, queue ProcessingQueueStore, task *models.Task) {
+	if err := ReleaseNodeTask(ctx, queue, task.NodeID, task.ID.Hex()); err != nil {
+		log.Printf("[TaskRecovery] Failed to release task %s from node %s: %v", task.ID.Hex(), task.NodeID, err)
+	}
+}
+
+// canResumeTask 任务是否有断点可以继续执行
+func canResumeTask(task *models.Task) bool {
+	idx := task.ResultStats.LastScannedIndex
+	return idx > 0 && idx < len(task.Targets)
+}
+
+// newExecutorID 生成执行器 ID
+func newExecutorID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("executor-%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// executorHeartbeatKey 执行器心跳的 Redis key
+func executorHeartbeatKey(nodeID string) string {
+	return executorHeartbeatPrefix + nodeID
+}
+
+// mongoRecoveryStore 基于 MongoDB / Redis 的恢复存储
+type mongoRecoveryStore struct {
+	taskService *TaskService
+}
+
+// AcquireLock 获取分布式锁
+func (s *mongoRecoveryStore) AcquireLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return database.GetRedis().SetNX(ctx, recoveryLockKey, owner, ttl).Result()
+}
+
+// ReleaseLock 释放分布式锁
+func (s *mongoRecoveryStore) ReleaseLock(ctx context.Context, owner string) error {
+	rdb := database.GetRedis()
+	val, err := rdb.Get(ctx, recoveryLockKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if val != owner {
+		return nil
+	}
+	return rdb.Del(ctx, recoveryLockKey).Err()
+}
+
+// FindRunningTasks 查询运行中的任务
+func (s *mongoRecoveryStore) FindRunningTasks(ctx context.Context, startedBefore time.Time) ([]*models.Task, error) {
+	collection := database.GetCollection(models.CollectionTasks)
+	cursor, err := collection.Find(ctx, bson.M{
+		"status":     models.TaskStatusRunning,
+		"started_at": bson.M{"$lt": startedBefore},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tasks []*models.Task
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// IsNodeAlive 检查执行器心跳，或分布式扫描节点的心跳
+func (s *mongoRecoveryStore) IsNodeAlive(ctx context.Context, nodeID string) (bool, error) {
+	n, err := database.GetRedis().Exists(ctx, executorHeartbeatKey(nodeID)).Result()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return true, nil
+	}
+
+	collection := database.GetCollection(models.CollectionNodes)
+	count, err := collection.CountDocuments(ctx, bson.M{
+		"node_id":        nodeID,
+		"status":         bson.M{"$in": []models.NodeStatus{models.NodeStatusOnline, models.NodeStatusBusy}},
+		"last_heartbeat": bson.M{"$gte": time.Now().Add(-ExecutorHeartbeatTTL * 4)},
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountResults 统计任务已保存的结果
+func (s *mongoRecoveryStore) CountResults(ctx context.Context, taskID primitive.ObjectID) (int64, error) {
+	return database.GetCollection(models.CollectionScanResults).CountDocuments(ctx, bson.M{"task_id": taskID})
+}
+
+// FailTask 标记任务失败
+func (s *mongoRecoveryStore) FailTask(ctx context.Context, taskID primitive.ObjectID, errMsg string, resultCount int64) (bool, error) {
+	res, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{"_id": taskID, "status": models.TaskStatusRunning},
+		bson.M{"$set": bson.M{
+			"status":       models.TaskStatusFailed,
+			"error":        errMsg,
+			"last_error":   errMsg,
+			"result_count": resultCount,
+			"completed_at": time.Now(),
+			"updated_at":   time.Now(),
+			// 执行器在任务运行中退出
+			"termination_reason": models.TerminationWorkerShutdown,
+			"termination":        NewTermination(models.TerminationWorkerShutdown, errMsg, "", nil),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// RequeueTask 重新入队
+func (s *mongoRecoveryStore) RequeueTask(ctx context.Context, task *models.Task) (bool, error) {
+	res, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{"_id": task.ID, "status": models.TaskStatusRunning, "node_id": task.NodeID},
+		bson.M{"$set": bson.M{
+			"status":     models.TaskStatusPending,
+			"node_id":    "",
+			"updated_at": time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount == 0 {
+		return false, nil
+	}
+	task.Status = models.TaskStatusPending
+	s.taskService.enqueueTask(task)
+	return true, nil
+}
+
+// recoverOrphanedTasks 执行器启动时恢复孤儿任务
+func (e *TaskExecutor) recoverOrphanedTasks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	report, err := RecoverOrphanedTasks(ctx, &mongoRecoveryStore{taskService: e.taskService}, RecoveryOptions{
+		NodeID:    e.nodeID,
+		Threshold: DefaultOrphanThreshold,
+		IsRunning: e.isTaskRunning,
+		Queue:     e.queue,
+	})
+	if err != nil {
+		log.Printf("[TaskExecutor] Orphaned task recovery failed: %v", err)
+		return
+	}
+	log.Printf("[TaskExecutor] Orphaned task recovery: failed=%d, requeued=%d, skipped=%d",
+		len(report.Failed), len(report.Requeued), len(report.Skipped))
+}
+
+// heartbeatLoop 定期刷新执行器心跳，供其他实例判断任务是否仍在运行
+func (e *TaskExecutor) heartbeatLoop() {
+	defer e.wg.Done()
+
+	beat := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := database.GetRedis().Set(ctx, executorHeartbeatKey(e.nodeID), time.Now().Unix(), ExecutorHeartbeatTTL).Err(); err != nil {
+			log.Printf("[TaskExecutor] Failed to refresh heartbeat: %v", err)
+		}
+		e.refreshWorkers(ctx)
+	}
+	beat()
+
+	ticker := time.NewTicker(executorHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stopCh:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			database.GetRedis().Del(ctx, executorHeartbeatKey(e.nodeID))
+			cancel()
+			return
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
+
+// isTaskRunning 任务是否正在当前进程中运行
+func (e *TaskExecutor) isTaskRunning(taskID string) bool {
+	e.runningMutex.RLock()
+	defer e.runningMutex.RUnlock()
+	_, ok := e.runningTasks[taskID]
+	return ok
+}
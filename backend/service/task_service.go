@@ -5,21 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"moongazing/database"
 	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/vulnscan"
+	"moongazing/service/pipeline"
 
-	"github.com/go-redis/redis/v8"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type TaskService struct{}
+type TaskService struct {
+	access *WorkspaceAccess
+}
 
 func NewTaskService() *TaskService {
-	return &TaskService{}
+	return &TaskService{access: NewWorkspaceAccess()}
 }
 
 // CreateTask creates a new task
@@ -67,28 +73,93 @@ func (s *TaskService) GetTaskByID(taskID string) (*models.Task, error) {
 	return &task, nil
 }
 
-// ListTasks lists tasks with filtering and pagination
-func (s *TaskService) ListTasks(workspaceID string, taskType string, status string, page, pageSize int) ([]*models.Task, int64, error) {
-	ctx, cancel := database.NewContext()
-	defer cancel()
-	
-	collection := database.GetCollection(models.CollectionTasks)
-	
+// GetTaskForUser 获取任务并校验用户对任务所在工作空间的权限，need 为需要的最低角色
+// 任务不存在和用户看不到任务所在的工作空间都返回 ErrTaskNotFound
+func (s *TaskService) GetTaskForUser(taskID string, userID primitive.ObjectID, role string, need models.WorkspaceRole) (*models.Task, error) {
+	if _, err := primitive.ObjectIDFromHex(taskID); err != nil {
+		return nil, ErrTaskNotFound
+	}
+	task, err := s.GetTaskByID(taskID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+	if err := s.access.AuthorizeTask(task, userID, role, need); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// AuthorizeWorkspace 校验用户对工作空间的权限，创建任务前调用；不是成员时返回 ErrWorkspaceNotFound
+func (s *TaskService) AuthorizeWorkspace(workspaceID primitive.ObjectID, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	return s.access.AuthorizeVisible(workspaceID, userID, role, need)
+}
+
+// AuthorizeTemplate 校验用户是否可以使用模板，看不到模板所在的工作空间时返回 ErrTaskTemplateNotFound
+func (s *TaskService) AuthorizeTemplate(template *models.TaskTemplate, userID primitive.ObjectID, role string) error {
+	return s.access.AuthorizeTemplate(template, userID, role)
+}
+
+// VisibleWorkspaceIDs 用户可以查看的工作空间，all 为 true 时不限制
+func (s *TaskService) VisibleWorkspaceIDs(userID primitive.ObjectID, role string) ([]primitive.ObjectID, bool, error) {
+	return s.access.VisibleWorkspaceIDs(userID, role)
+}
+
+// TaskListFilter 任务列表过滤条件
+type TaskListFilter struct {
+	WorkspaceID       string
+	WorkspaceIDs      []primitive.ObjectID // 未指定 WorkspaceID 时只列出这些工作空间的任务，nil 不限制
+	Type              string
+	Status            string
+	TerminationReason string
+}
+
+// BSON 构建查询条件
+func (f TaskListFilter) BSON() bson.M {
 	filter := bson.M{}
 	
-	if workspaceID != "" {
-		wsID, _ := primitive.ObjectIDFromHex(workspaceID)
+	if f.WorkspaceID != "" {
+		wsID, _ := primitive.ObjectIDFromHex(f.WorkspaceID)
 		filter["workspace_id"] = wsID
+	} else if f.WorkspaceIDs != nil {
+		// 默认空间的任务没有 workspace_id 字段
+		filter["$or"] = []bson.M{
+			{"workspace_id": bson.M{"$in": f.WorkspaceIDs}},
+			{"workspace_id": bson.M{"$exists": false}},
+		}
 	}
 	
-	if taskType != "" {
-		filter["type"] = taskType
+	if f.Type != "" {
+		filter["type"] = f.Type
 	}
 	
-	if status != "" {
-		filter["status"] = status
+	if f.Status != "" {
+		filter["status"] = f.Status
 	}
 	
+	if f.TerminationReason != "" {
+		filter["termination_reason"] = f.TerminationReason
+	}
+	
+	return filter
+}
+
+// ListTasks lists tasks with filtering and pagination
+func (s *TaskService) ListTasks(workspaceID string, taskType string, status string, page, pageSize int) ([]*models.Task, int64, error) {
+	return s.ListTasksByFilter(TaskListFilter{WorkspaceID: workspaceID, Type: taskType, Status: status}, page, pageSize)
+}
+
+// ListTasksByFilter 按条件分页查询任务（支持按结束原因过滤）
+func (s *TaskService) ListTasksByFilter(f TaskListFilter, page, pageSize int) ([]*models.Task, int64, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	
+	collection := database.GetCollection(models.CollectionTasks)
+	
+	filter := f.BSON()
+	
 	// Get total count
 	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
@@ -206,12 +277,16 @@ func (s *TaskService) PauseTask(taskID string) error {
 }
 
 // ResumeTask resumes a paused task
-func (s *TaskService) ResumeTask(taskID string) error {
+func (s *TaskService) ResumeTask(taskID string, fromCheckpoint bool) error {
 	task, err := s.GetTaskByID(taskID)
 	if err != nil {
 		return err
 	}
 	
+	if fromCheckpoint {
+		return s.resumeFromCheckpoint(task)
+	}
+	
 	if task.Status != models.TaskStatusPaused {
 		return errors.New("只能恢复已暂停的任务")
 	}
@@ -230,6 +305,28 @@ func (s *TaskService) ResumeTask(taskID string) error {
 	return nil
 }
 
+// resumeFromCheckpoint 将暂停或失败的任务带 resume 标记重新入队，执行器从断点继续扫描
+func (s *TaskService) resumeFromCheckpoint(task *models.Task) error {
+	if task.Status != models.TaskStatusPaused && task.Status != models.TaskStatusFailed {
+		return errors.New("只能从断点恢复已暂停或失败的任务")
+	}
+	
+	err := s.UpdateTask(task.ID.Hex(), map[string]interface{}{
+		"status":     models.TaskStatusPending,
+		"resume":     true,
+		"last_error": "",
+	})
+	if err != nil {
+		return err
+	}
+	
+	task.Status = models.TaskStatusPending
+	task.Resume = true
+	s.enqueueTask(task)
+	
+	return nil
+}
+
 // CancelTask cancels a task
 func (s *TaskService) CancelTask(taskID string) error {
 	task, err := s.GetTaskByID(taskID)
@@ -241,8 +338,13 @@ func (s *TaskService) CancelTask(taskID string) error {
 		return errors.New("已完成的任务不能取消")
 	}
 	
+	// 运行中的任务结束时，执行器会补充当时的模块和进度快照
+	term := NewTermination(models.TerminationUserCancel, "", "", nil)
+	term.Progress = task.Progress
 	return s.UpdateTask(taskID, map[string]interface{}{
-		"status": models.TaskStatusCancelled,
+		"status":             models.TaskStatusCancelled,
+		"termination_reason": term.Reason,
+		"termination":        term,
 	})
 }
 
@@ -344,16 +446,17 @@ func (s *TaskService) FailTask(taskID string, errorMsg string) error {
 
 // GetTaskStats returns task statistics
 func (s *TaskService) GetTaskStats(workspaceID string) (map[string]interface{}, error) {
+	return s.GetTaskStatsByFilter(TaskListFilter{WorkspaceID: workspaceID})
+}
+
+// GetTaskStatsByFilter 按工作空间条件统计任务状态（类型、状态等条件同样生效）
+func (s *TaskService) GetTaskStatsByFilter(f TaskListFilter) (map[string]interface{}, error) {
 	ctx, cancel := database.NewContext()
 	defer cancel()
 	
 	collection := database.GetCollection(models.CollectionTasks)
 	
-	filter := bson.M{}
-	if workspaceID != "" {
-		wsID, _ := primitive.ObjectIDFromHex(workspaceID)
-		filter["workspace_id"] = wsID
-	}
+	filter := f.BSON()
 	
 	// Count by status
 	pipeline := []bson.M{
@@ -411,18 +514,61 @@ func (s *TaskService) GetTaskStats(workspaceID string) (map[string]interface{},
 	stats["pending"] = pending
 	stats["by_status"] = statusStats
 	
+	// Count by termination reason
+	reasonStats, err := s.countByTerminationReason(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	stats["by_termination_reason"] = reasonStats
+	
 	return stats, nil
 }
 
+// countByTerminationReason 按结束原因统计任务数（未结束的任务不计入）
+func (s *TaskService) countByTerminationReason(ctx context.Context, filter bson.M) (map[string]int, error) {
+	match := bson.M{"termination_reason": bson.M{"$nin": bson.A{"", nil}}}
+	for k, v := range filter {
+		match[k] = v
+	}
+	
+	cursor, err := database.GetCollection(models.CollectionTasks).Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   "$termination_reason",
+			"count": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, errors.New("统计失败")
+	}
+	defer cursor.Close(ctx)
+	
+	var results []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, errors.New("解析统计数据失败")
+	}
+	
+	reasonStats := make(map[string]int, len(results))
+	for _, r := range results {
+		reasonStats[r.ID] = r.Count
+	}
+	return reasonStats, nil
+}
+
 // enqueueTask adds task to Redis queue
 func (s *TaskService) enqueueTask(task *models.Task) {
 	ctx := context.Background()
 	rdb := database.GetRedis()
 	
 	// Add to task queue
-	queueKey := "task:queue:" + string(task.Type)
+	queueKey := TaskQueueKey(string(task.Type), task.Priority)
 	log.Printf("[TaskService] Enqueueing task %s to queue: %s", task.ID.Hex(), queueKey)
-	rdb.RPush(ctx, queueKey, task.ID.Hex())
+	if err := EnqueueTaskID(ctx, NewRedisTaskQueue(rdb), task); err != nil {
+		log.Printf("[TaskService] Failed to enqueue task %s: %v", task.ID.Hex(), err)
+	}
 	
 	// Set task status in Redis
 	statusKey := "task:status:" + task.ID.Hex()
@@ -435,18 +581,48 @@ func (s *TaskService) DequeueTask(taskType string) (*models.Task, error) {
 	ctx := context.Background()
 	rdb := database.GetRedis()
 	
-	queueKey := "task:queue:" + taskType
-	result, err := rdb.LPop(ctx, queueKey).Result()
-	if err == redis.Nil {
-		return nil, nil // No task in queue
-	}
+	result, _, err := DequeueTaskID(ctx, NewRedisTaskQueue(rdb), taskType)
 	if err != nil {
 		return nil, err
 	}
+	if result == "" {
+		return nil, nil // No task in queue
+	}
 	
 	return s.GetTaskByID(result)
 }
 
+// SetTaskPriority 调整任务优先级，排队中的任务移到新优先级的队列
+// 返回任务是否在队列中被移动；已开始执行的任务不在队列中，无法调整
+func (s *TaskService) SetTaskPriority(taskID string, priority models.TaskPriority) (bool, error) {
+	if err := ValidTaskPriority(priority); err != nil {
+		return false, err
+	}
+	priority = NormalizeTaskPriority(priority)
+	
+	task, err := s.GetTaskByID(taskID)
+	if err != nil {
+		return false, err
+	}
+	if task.Status != models.TaskStatusPending && task.Status != models.TaskStatusRunning {
+		return false, errors.New("只能调整排队中任务的优先级")
+	}
+	
+	moved, err := MoveQueuedTask(context.Background(), NewRedisTaskQueue(database.GetRedis()), task, priority)
+	if err != nil {
+		return false, errors.New("调整队列失败: " + err.Error())
+	}
+	// Running 且不在队列中的任务已被执行器取出
+	if !moved && task.Status == models.TaskStatusRunning && NormalizeTaskPriority(task.Priority) != priority {
+		return false, errors.New("任务已开始执行，无法调整优先级")
+	}
+	
+	if err := s.UpdateTask(taskID, map[string]interface{}{"priority": priority}); err != nil {
+		return moved, err
+	}
+	return moved, nil
+}
+
 // CreateTaskTemplate creates a task template
 func (s *TaskService) CreateTaskTemplate(template *models.TaskTemplate) error {
 	ctx, cancel := database.NewContext()
@@ -514,25 +690,60 @@ func (s *TaskService) GetTaskTemplate(templateID string) (*models.TaskTemplate,
 	var template models.TaskTemplate
 	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&template)
 	if err != nil {
-		return nil, errors.New("模板不存在")
+		return nil, ErrTaskTemplateNotFound
 	}
 	
 	return &template, nil
 }
 
-// DeleteTaskTemplate deletes a task template
-func (s *TaskService) DeleteTaskTemplate(templateID string) error {
+// UpdateTaskTemplate updates a task template, built-in templates are read-only
+func (s *TaskService) UpdateTaskTemplate(templateID string, update *models.TaskTemplate) error {
+	template, err := s.GetTaskTemplate(templateID)
+	if err != nil {
+		return err
+	}
+	if template.BuiltIn {
+		return ErrBuiltInTemplate
+	}
+	
 	ctx, cancel := database.NewContext()
 	defer cancel()
 	
-	objID, err := primitive.ObjectIDFromHex(templateID)
+	collection := database.GetCollection(models.CollectionTaskTemplates)
+	
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": template.ID}, bson.M{"$set": bson.M{
+		"name":        update.Name,
+		"description": update.Description,
+		"type":        update.Type,
+		"priority":    update.Priority,
+		"tags":        update.Tags,
+		"config":      update.Config,
+		"is_public":   update.IsPublic,
+		"updated_at":  time.Now(),
+	}})
 	if err != nil {
-		return errors.New("无效的模板ID")
+		return errors.New("更新模板失败")
+	}
+	
+	return nil
+}
+
+// DeleteTaskTemplate deletes a task template, built-in templates are read-only
+func (s *TaskService) DeleteTaskTemplate(templateID string) error {
+	template, err := s.GetTaskTemplate(templateID)
+	if err != nil {
+		return err
+	}
+	if template.BuiltIn {
+		return ErrBuiltInTemplate
 	}
 	
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	
 	collection := database.GetCollection(models.CollectionTaskTemplates)
 	
-	_, err = collection.DeleteOne(ctx, bson.M{"_id": objID})
+	_, err = collection.DeleteOne(ctx, bson.M{"_id": template.ID})
 	if err != nil {
 		return errors.New("删除模板失败")
 	}
@@ -603,3 +814,170 @@ func (s *TaskService) GetTaskLogs(taskID string, page, pageSize int) ([]*models.
 	
 	return logs, total, nil
 }
+
+// ExcludedHost 预览中被排除的已知资产
+type ExcludedHost struct {
+	Host string `json:"host"`
+	Type string `json:"type"` // subdomain, ip
+	Rule string `json:"rule"` // 命中的排除规则
+}
+
+// PreviewExclusions 预览排除规则会排除工作空间中哪些已知主机
+func (s *TaskService) PreviewExclusions(workspaceID string, patterns []string) ([]ExcludedHost, error) {
+	matcher, err := core.NewExclusionMatcher(patterns)
+	if err != nil {
+		return nil, err
+	}
+	excluded := []ExcludedHost{}
+	if matcher.Empty() {
+		return excluded, nil
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	collection := database.GetCollection(models.CollectionScanResults)
+
+	baseFilter := bson.M{}
+	if workspaceID != "" {
+		wsID, err := primitive.ObjectIDFromHex(workspaceID)
+		if err != nil {
+			return nil, errors.New("无效的工作空间ID")
+		}
+		baseFilter["workspace_id"] = wsID
+	}
+
+	sources := []struct {
+		field      string
+		resultType models.ResultType
+		hostType   string
+	}{
+		{"data.subdomain", models.ResultTypeSubdomain, "subdomain"},
+		{"data.ip", models.ResultTypePort, "ip"},
+	}
+
+	seen := make(map[string]bool)
+	for _, src := range sources {
+		filter := bson.M{"type": src.resultType}
+		for k, v := range baseFilter {
+			filter[k] = v
+		}
+
+		values, err := collection.Distinct(ctx, src.field, filter)
+		if err != nil {
+			return nil, fmt.Errorf("查询已知资产失败: %w", err)
+		}
+
+		for _, v := range values {
+			host, ok := v.(string)
+			if !ok || host == "" || seen[host] {
+				continue
+			}
+			seen[host] = true
+			if rule, hit := matcher.Match(host); hit {
+				excluded = append(excluded, ExcludedHost{Host: host, Type: src.hostType, Rule: rule})
+			}
+		}
+	}
+
+	return excluded, nil
+}
+
+// ValidateTaskTargets 校验任务目标中的网段、IP 范围，展开后不能超过目标数上限（0 使用默认值）
+func ValidateTaskTargets(targets []string, maxTargets int) error {
+	if maxTargets < 0 {
+		return fmt.Errorf("目标数上限不能为负数")
+	}
+	if _, err := pipeline.ExpandTargets(targets, maxTargets); err != nil {
+		return fmt.Errorf("任务目标无效: %w", err)
+	}
+	return nil
+}
+
+// ValidateVulnScanConfig 校验漏洞扫描的严重级别和速率设置
+func ValidateVulnScanConfig(config models.TaskConfig) error {
+	if err := vulnscan.ValidateSeverities(config.VulnSeverities); err != nil {
+		return err
+	}
+	if err := vulnscan.ValidateSeverities(config.SeverityFilter); err != nil {
+		return err
+	}
+	if config.VulnRateLimit < 0 || config.VulnConcurrency < 0 {
+		return errors.New("漏洞扫描速率和并发数不能为负数")
+	}
+	return nil
+}
+
+// ValidateLivenessConfig 校验存活检测的探测端口、超时和并发数
+func ValidateLivenessConfig(config models.TaskConfig) error {
+	for _, port := range config.LivenessPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("存活检测端口无效: %d", port)
+		}
+	}
+	if config.LivenessTimeout < 0 || config.LivenessConcurrency < 0 {
+		return errors.New("存活检测超时和并发数不能为负数")
+	}
+	return nil
+}
+
+// ValidateTaskTimeouts 校验模块超时和看门狗超时
+// 模块超时的键必须是流水线的模块名称，值必须大于 0；看门狗超时必须长于最长的模块超时和内置模块合法的最长无输出时间
+func ValidateTaskTimeouts(config models.TaskConfig) error {
+	names := make([]string, 0, len(config.ModuleTimeouts))
+	for name := range config.ModuleTimeouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !pipeline.ValidTimeoutModule(name) {
+			return fmt.Errorf("不支持设置超时的模块: %s", name)
+		}
+		if config.ModuleTimeouts[name] <= 0 {
+			return fmt.Errorf("模块 %s 的超时必须大于 0 分钟", name)
+		}
+	}
+	if config.WatchdogTimeout < 0 {
+		return errors.New("看门狗超时不能为负数")
+	}
+	if config.WatchdogTimeout == 0 {
+		return nil
+	}
+	floor := pipeline.LongestModuleSilenceMinutes
+	if longest := longestModuleTimeout(config); longest > floor {
+		floor = longest
+	}
+	if config.WatchdogTimeout <= floor {
+		return fmt.Errorf("看门狗超时必须长于 %d 分钟（最长的模块超时）", floor)
+	}
+	return nil
+}
+
+// ValidateTaskConfig 校验任务配置，创建任务、保存模板和从模板创建任务共用
+func ValidateTaskConfig(config *models.TaskConfig) error {
+	if err := core.ValidateExcludePatterns(config.ExcludeList); err != nil {
+		return err
+	}
+	if err := ValidateTaskNetwork(config); err != nil {
+		return err
+	}
+	if err := ValidateTaskHeaders(config); err != nil {
+		return err
+	}
+	if err := ValidateTaskUserAgents(config); err != nil {
+		return err
+	}
+	if err := ValidateTaskScope(config); err != nil {
+		return err
+	}
+	if err := GetTaskTimeLimits().ValidateOverride(config.TimeLimit); err != nil {
+		return err
+	}
+	if err := ValidateLivenessConfig(*config); err != nil {
+		return err
+	}
+	if err := ValidateTaskTimeouts(*config); err != nil {
+		return err
+	}
+	return ValidateVulnScanConfig(*config)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 执行器停止时的任务交接
+// 进程收到 SIGTERM 时，正在运行的任务已从 Redis 队列取出，不处理的话会一直停留在 Running。
+// 停止时取消所有运行中的任务，在限定时间内等待结果收集循环处理完已产生的结果（保存结果、断点和 CDN 信息），
+// 然后把仍处于 Running 的任务改回 Pending、带断点续扫标记重新入队，由重启后的执行器继续执行。
+// 期间被用户暂停、取消或删除的任务不再处于 Running，保持原状态。
+
+// DefaultShutdownTimeout 停止时等待运行中任务退出的默认时间
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ShutdownStore 执行器停止时交接任务依赖的存储操作
+type ShutdownStore interface {
+	// RequeueInterrupted 将仍处于 Running 的任务改回 Pending 并重新入队，note 记录到任务进度，返回是否实际更新
+	RequeueInterrupted(ctx context.Context, task *models.Task, note string) (bool, error)
+}
+
+// ShutdownTask 停止时需要交接的运行中任务
+type ShutdownTask struct {
+	Task   *models.Task
+	Cancel func()          // 取消任务，结束原因为执行器停止
+	Done   <-chan struct{} // 结果收集循环退出后关闭
+}
+
+// ShutdownReport 交接结果
+type ShutdownReport struct {
+	Requeued []string `json:"requeued"`  // 改回 Pending 并重新入队的任务
+	TimedOut []string `json:"timed_out"` // 等待超时、结果可能未处理完的任务
+	Skipped  []string `json:"skipped"`   // 已不处于 Running 的任务
+}
+
+// ShutdownRunningTasks 取消运行中的任务，等待其退出后重新入队
+// 超过 timeout 仍未退出的任务同样重新入队，未保存的结果在重新执行时补齐
+func ShutdownRunningTasks(ctx context.Context, tasks []ShutdownTask, store ShutdownStore, timeout time.Duration) *ShutdownReport {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	report := &ShutdownReport{}
+	if len(tasks) == 0 {
+		return report
+	}
+
+	for _, t := range tasks {
+		if t.Cancel != nil {
+			t.Cancel()
+		}
+	}
+
+	// 所有任务共用一个等待期限
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	expired := false
+	for _, t := range tasks {
+		taskID := t.Task.ID.Hex()
+		drained := true
+		if t.Done != nil && !expired {
+			select {
+			case <-t.Done:
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		if expired && t.Done != nil {
+			select {
+			case <-t.Done:
+			default:
+				drained = false
+			}
+		}
+
+		note := "执行器停止，任务已重新入队"
+		if !drained {
+			note = fmt.Sprintf("执行器停止时等待任务退出超时（%v），任务已重新入队", timeout)
+			report.TimedOut = append(report.TimedOut, taskID)
+		}
+		ok, err := store.RequeueInterrupted(ctx, t.Task, note)
+		if err != nil {
+			log.Printf("[TaskExecutor] Failed to requeue task %s on shutdown: %v", taskID, err)
+			continue
+		}
+		if !ok {
+			report.Skipped = append(report.Skipped, taskID)
+			continue
+		}
+		log.Printf("[TaskExecutor] Task %s requeued on shutdown (drained: %v)", taskID, drained)
+		report.Requeued = append(report.Requeued, taskID)
+	}
+	return report
+}
+
+// mongoShutdownStore 基于 MongoDB / Redis 的交接存储
+type mongoShutdownStore struct {
+	taskService *TaskService
+}
+
+// NewMongoShutdownStore 创建交接存储
+func NewMongoShutdownStore() ShutdownStore {
+	return &mongoShutdownStore{taskService: NewTaskService()}
+}
+
+// RequeueInterrupted 改回 Pending 并重新入队
+func (s *mongoShutdownStore) RequeueInterrupted(ctx context.Context, task *models.Task, note string) (bool, error) {
+	res, err := database.GetCollection(models.CollectionTasks).UpdateOne(ctx,
+		bson.M{"_id": task.ID, "status": models.TaskStatusRunning},
+		bson.M{"$set": bson.M{
+			"status":                models.TaskStatusPending,
+			"node_id":               "",
+			"resume":                true,
+			"progress_details.note": note,
+			"updated_at":            time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount == 0 {
+		return false, nil
+	}
+	task.Status = models.TaskStatusPending
+	task.Resume = true
+	s.taskService.enqueueTask(task)
+	s.taskService.AddTaskLog(task.ID.Hex(), "warn", note, "termination_reason="+string(models.TerminationWorkerShutdown))
+	return true, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StoreSuppressionModule 入库合并在丢弃统计中的模块名
+const StoreSuppressionModule = "ResultStore"
+
+// maxSuppressionSamplesQuery 查询返回的采样条目上限
+const maxSuppressionSamplesQuery = 2000
+
+// TaskSuppressionStats 任务的丢弃统计
+type TaskSuppressionStats struct {
+	TaskID   string                     `json:"task_id"`
+	Total    int64                      `json:"total"`
+	ByReason map[string]int64           `json:"by_reason"`
+	ByModule map[string]int64           `json:"by_module"`
+	Items    []models.SuppressionCount  `json:"items"`
+	Samples  []models.SuppressionSample `json:"samples,omitempty"` // 仅调试模式的任务有采样
+}
+
+// BuildSuppressionBreakdown 按原因、模块汇总丢弃计数，Items 按数量从多到少排列
+func BuildSuppressionBreakdown(counts []models.SuppressionCount) *TaskSuppressionStats {
+	stats := &TaskSuppressionStats{
+		ByReason: make(map[string]int64),
+		ByModule: make(map[string]int64),
+		Items:    make([]models.SuppressionCount, 0, len(counts)),
+	}
+	for _, c := range counts {
+		if c.Count <= 0 {
+			continue
+		}
+		stats.Total += c.Count
+		stats.ByReason[c.Reason] += c.Count
+		stats.ByModule[c.Module] += c.Count
+		stats.Items = append(stats.Items, c)
+	}
+	sort.SliceStable(stats.Items, func(i, j int) bool { return stats.Items[i].Count > stats.Items[j].Count })
+	return stats
+}
+
+// GetTaskSuppressionStats 获取任务中各模块去重、排除等丢弃的结果数（任务结束时写入）
+func (s *TaskService) GetTaskSuppressionStats(taskID string) (*TaskSuppressionStats, error) {
+	task, err := s.GetTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := BuildSuppressionBreakdown(task.SuppressionStats)
+	stats.TaskID = taskID
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "module", Value: 1}, {Key: "reason", Value: 1}, {Key: "created_at", Value: 1}}).
+		SetLimit(maxSuppressionSamplesQuery)
+	cursor, err := database.GetCollection(models.CollectionSuppressionSamples).Find(ctx, bson.M{"task_id": task.ID}, opts)
+	if err != nil {
+		return nil, errors.New("查询丢弃采样失败")
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &stats.Samples); err != nil {
+		return nil, errors.New("查询丢弃采样失败")
+	}
+	return stats, nil
+}
+
+// recordSuppressionStats 任务结束时写入丢弃计数，调试模式下同时写入采样条目
+func (e *TaskExecutor) recordSuppressionStats(task *models.Task, stats *pipeline.SuppressionStats) {
+	counts := stats.Counts()
+	if len(counts) == 0 {
+		return
+	}
+	report := make([]models.SuppressionCount, 0, len(counts))
+	var total int64
+	for _, c := range counts {
+		report = append(report, models.SuppressionCount{Module: c.Module, Reason: c.Reason, Count: c.Count})
+		total += c.Count
+	}
+	log.Printf("[TaskExecutor] Task %s suppressed %d items in %d module/reason groups", task.ID.Hex(), total, len(report))
+	e.taskService.UpdateTask(task.ID.Hex(), map[string]interface{}{
+		"suppression_stats": report,
+	})
+
+	samples := stats.Samples()
+	if len(samples) == 0 {
+		return
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(samples))
+	for _, sample := range samples {
+		docs = append(docs, models.SuppressionSample{
+			ID:          primitive.NewObjectID(),
+			TaskID:      task.ID,
+			WorkspaceID: task.WorkspaceID,
+			Module:      sample.Module,
+			Reason:      sample.Reason,
+			Item:        sample.Item,
+			CreatedAt:   now,
+		})
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if _, err := database.GetCollection(models.CollectionSuppressionSamples).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil {
+		log.Printf("[TaskExecutor] Failed to save suppression samples for task %s: %v", task.ID.Hex(), err)
+	}
+}
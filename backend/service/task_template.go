@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 任务模板
+// 模板保存任务类型、扫描类型和完整的任务配置（端口、漏洞扫描、速率、请求头、通知等），
+// 从模板创建任务时：目标总是按任务指定，其余字段任务指定的值优先，其次模板的值，都未设置时使用任务的默认值。
+// 任务保存的是模板配置的副本，之后修改或删除模板不影响已创建的任务。
+// 内置模板（快速侦察、全面审计、仅 Web）在启动时补齐，只读。
+
+// ErrBuiltInTemplate 内置模板不能修改或删除
+var ErrBuiltInTemplate = errors.New("内置模板为只读，不能修改或删除")
+
+// 内置模板标识
+const (
+	TemplateQuickRecon = "quick_recon"
+	TemplateFullAudit  = "full_audit"
+	TemplateWebOnly    = "web_only"
+)
+
+// BuiltInTaskTemplates 内置模板，每次调用返回新的副本
+func BuiltInTaskTemplates() []*models.TaskTemplate {
+	return []*models.TaskTemplate{
+		{
+			Key:         TemplateQuickRecon,
+			Name:        "快速侦察",
+			Description: "子域名、常用端口和 Web 指纹，适合初次摸底",
+			Type:        models.TaskTypeCustom,
+			Config: models.TaskConfig{
+				ScanTypes:    []string{"subdomain", "port_scan", "fingerprint"},
+				PortScanMode: "quick",
+			},
+		},
+		{
+			Key:         TemplateFullAudit,
+			Name:        "全面审计",
+			Description: "子域名和接管检测、top1000 端口、指纹、爬虫、目录扫描、中危及以上漏洞和敏感信息",
+			Type:        models.TaskTypeCustom,
+			Config: models.TaskConfig{
+				ScanTypes: []string{
+					"subdomain", "takeover", "port_scan", "fingerprint", "crawler",
+					"dir_scan", "endpoint", "vuln_scan", "sensitive",
+				},
+				PortScanMode:   "top1000",
+				VulnSeverities: []string{"critical", "high", "medium"},
+			},
+		},
+		{
+			Key:         TemplateWebOnly,
+			Name:        "仅 Web",
+			Description: "常用端口上 Web 服务的指纹、爬虫、目录扫描和高危漏洞，不扫描子域名",
+			Type:        models.TaskTypeCustom,
+			Config: models.TaskConfig{
+				ScanTypes:      []string{"port_scan", "fingerprint", "crawler", "dir_scan", "vuln_scan"},
+				PortScanMode:   "quick",
+				VulnSeverities: []string{"critical", "high"},
+			},
+		},
+	}
+}
+
+// TaskTemplateStore 内置模板的存储
+type TaskTemplateStore interface {
+	// EnsureBuiltIn 标识为 template.Key 的内置模板不存在时写入，返回是否写入
+	EnsureBuiltIn(ctx context.Context, template *models.TaskTemplate) (bool, error)
+}
+
+// SeedBuiltInTemplates 补齐缺失的内置模板，已存在的模板不修改，返回写入的模板数
+func SeedBuiltInTemplates(ctx context.Context, store TaskTemplateStore) (int, error) {
+	created := 0
+	for _, template := range BuiltInTaskTemplates() {
+		now := time.Now()
+		template.BuiltIn = true
+		template.IsPublic = true
+		template.CreatedAt = now
+		template.UpdatedAt = now
+		ok, err := store.EnsureBuiltIn(ctx, template)
+		if err != nil {
+			return created, fmt.Errorf("写入内置模板 %s 失败: %w", template.Key, err)
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// InitBuiltInTemplates 启动时补齐内置模板
+func InitBuiltInTemplates() {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	created, err := SeedBuiltInTemplates(ctx, NewMongoTaskTemplateStore())
+	if err != nil {
+		log.Printf("Warning: Failed to seed built-in task templates: %v", err)
+		return
+	}
+	if created > 0 {
+		log.Printf("Seeded %d built-in task templates", created)
+	}
+}
+
+// CopyTaskConfig 深拷贝任务配置，切片和 map 不与原配置共用
+func CopyTaskConfig(config models.TaskConfig) models.TaskConfig {
+	copied, _ := MergeTaskConfig(config, nil)
+	return copied
+}
+
+// MergeTaskConfig 在 base 的副本上应用 override 中出现的字段（JSON，与任务配置的字段名相同），
+// 未出现的字段保留 base 的值；custom_headers、module_timeouts 按键合并，其余字段整体替换
+func MergeTaskConfig(base models.TaskConfig, override json.RawMessage) (models.TaskConfig, error) {
+	var merged models.TaskConfig
+	data, err := json.Marshal(base)
+	if err != nil {
+		return merged, err
+	}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return merged, err
+	}
+	if len(override) > 0 {
+		if err := json.Unmarshal(override, &merged); err != nil {
+			return merged, fmt.Errorf("任务配置无效: %w", err)
+		}
+	}
+	return merged, nil
+}
+
+// TemplateTaskRequest 从模板创建任务的参数，目标总是按任务指定，其余字段为空时使用模板的值
+type TemplateTaskRequest struct {
+	WorkspaceID primitive.ObjectID
+	Name        string
+	Description string
+	Type        models.TaskType
+	Priority    models.TaskPriority
+	Targets     []string
+	TargetType  string
+	Tags        []string
+	Config      json.RawMessage // 覆盖模板配置的字段
+	CreatedBy   primitive.ObjectID
+}
+
+// NewTaskFromTemplate 合并模板和任务指定的值创建任务，不保存
+func NewTaskFromTemplate(template *models.TaskTemplate, req TemplateTaskRequest) (*models.Task, error) {
+	if !template.IsPublic && !req.WorkspaceID.IsZero() && template.WorkspaceID != req.WorkspaceID {
+		return nil, errors.New("模板不属于该工作空间")
+	}
+	config, err := MergeTaskConfig(template.Config, req.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	task := &models.Task{
+		WorkspaceID: req.WorkspaceID,
+		Name:        req.Name,
+		Description: firstNonEmpty(req.Description, template.Description),
+		Type:        req.Type,
+		Priority:    req.Priority,
+		Targets:     req.Targets,
+		TargetType:  req.TargetType,
+		Config:      config,
+		TemplateID:  template.ID,
+		Tags:        append([]string(nil), template.Tags...),
+		CreatedBy:   req.CreatedBy,
+		ResultStats: models.TaskResultStats{
+			TotalTargets: len(req.Targets),
+		},
+	}
+	if task.WorkspaceID.IsZero() {
+		task.WorkspaceID = template.WorkspaceID
+	}
+	if task.Type == "" {
+		task.Type = template.Type
+	}
+	if task.Priority == "" {
+		task.Priority = template.Priority
+	}
+	task.Priority = NormalizeTaskPriority(task.Priority)
+	if req.Tags != nil {
+		task.Tags = append([]string(nil), req.Tags...)
+	}
+	return task, nil
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// mongoTaskTemplateStore 数据库模板存储
+type mongoTaskTemplateStore struct{}
+
+// NewMongoTaskTemplateStore 创建数据库模板存储
+func NewMongoTaskTemplateStore() TaskTemplateStore {
+	return &mongoTaskTemplateStore{}
+}
+
+// EnsureBuiltIn 按标识 upsert，多个节点同时启动时也只写入一份
+func (s *mongoTaskTemplateStore) EnsureBuiltIn(ctx context.Context, template *models.TaskTemplate) (bool, error) {
+	template.ID = primitive.NewObjectID()
+	res, err := database.GetCollection(models.CollectionTaskTemplates).UpdateOne(ctx,
+		bson.M{"key": template.Key, "built_in": true},
+		bson.M{"$setOnInsert": template},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
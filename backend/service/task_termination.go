@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service/pipeline"
+)
+
+// 任务结束原因
+// 每条结束任务的路径（完成、失败、超时、用户取消、删除、执行器停止）都记录 termination_reason，
+// 失败和超时时附带当时的模块和进度快照，事后可以按原因统计，而不是只看一个 failed 状态
+
+// terminationCause 取消运行中任务时携带的原因
+type terminationCause struct {
+	reason models.TerminationReason
+}
+
+func (c *terminationCause) Error() string {
+	return "task terminated: " + string(c.reason)
+}
+
+// CancelCause 构造任务取消原因，配合 context.WithCancelCause 使用
+func CancelCause(reason models.TerminationReason) error {
+	return &terminationCause{reason: reason}
+}
+
+// CancelReason 获取上下文被取消的原因，未取消或不是任务取消时返回空
+func CancelReason(ctx context.Context) models.TerminationReason {
+	var cause *terminationCause
+	if errors.As(context.Cause(ctx), &cause) {
+		return cause.reason
+	}
+	return ""
+}
+
+// TaskEnd 任务结束时的状态
+type TaskEnd struct {
+	CancelReason models.TerminationReason // 执行器取消任务时的原因
+	Deleted      bool                     // 任务在数据库中已不存在
+	Status       models.TaskStatus        // 结束时数据库中的任务状态
+	Err          error                    // 流水线异常终止的原因
+	FailedModule string                   // 出错或正在运行的模块
+	Report       *pipeline.ProgressReport // 结束时的进度
+}
+
+// ClassifyTermination 判定任务结束原因；任务被暂停时返回 nil（任务没有结束）
+func ClassifyTermination(end TaskEnd) *models.TaskTermination {
+	switch {
+	case end.Deleted:
+		return NewTermination(models.TerminationDeleted, "任务在运行中被删除", "", end.Report)
+	case end.CancelReason != "":
+		return NewTermination(end.CancelReason, "", "", end.Report)
+	case end.Status == models.TaskStatusCancelled:
+		return NewTermination(models.TerminationUserCancel, "", "", end.Report)
+	case end.Status == models.TaskStatusPaused:
+		return nil
+	case end.Err != nil:
+		var tlErr *pipeline.TimeLimitError
+		if errors.As(end.Err, &tlErr) {
+			report := tlErr.Report
+			if report == nil {
+				report = end.Report
+			}
+			return NewTermination(models.TerminationDeadlineExceeded, tlErr.Error(), tlErr.Module, report)
+		}
+		return NewTermination(models.TerminationModuleFailure, fmt.Sprintf("流水线异常终止: %v", end.Err), end.FailedModule, end.Report)
+	default:
+		return NewTermination(models.TerminationCompleted, "", "", end.Report)
+	}
+}
+
+// NewTermination 构造任务结束详情，失败和超时未指定模块时使用进度中的当前模块
+func NewTermination(reason models.TerminationReason, message, module string, report *pipeline.ProgressReport) *models.TaskTermination {
+	term := &models.TaskTermination{
+		Reason:  reason,
+		Message: message,
+		Module:  module,
+		At:      time.Now(),
+	}
+	if reason == models.TerminationCompleted {
+		term.Progress = 100
+	}
+	if report != nil {
+		if reason != models.TerminationCompleted {
+			term.Progress = report.OverallProgress
+		}
+		term.ProgressDetails = progressDetailsFromReport(report)
+		if term.Module == "" && (reason == models.TerminationModuleFailure || reason == models.TerminationDeadlineExceeded) {
+			term.Module = report.CurrentModule
+		}
+	}
+	return term
+}
+
+// terminationUpdates 结束原因对应的任务更新字段
+func terminationUpdates(term *models.TaskTermination) map[string]interface{} {
+	return map[string]interface{}{
+		"termination_reason": term.Reason,
+		"termination":        term,
+	}
+}
+
+// progressDetailsFromReport 构建进度详情
+func progressDetailsFromReport(report *pipeline.ProgressReport) map[string]interface{} {
+	progressDetails := map[string]interface{}{
+		"current_module":      report.CurrentModule,
+		"elapsed_time":        report.ElapsedTime,
+		"estimated_time_left": report.EstimatedTimeLeft,
+		"total_results":       report.TotalResults,
+	}
+	if report.TimeLimit != "" {
+		progressDetails["time_limit"] = report.TimeLimit
+	}
+	if report.OverrunWarning {
+		progressDetails["overrun_warning"] = true
+	}
+	if len(report.Warnings) > 0 {
+		progressDetails["warnings"] = report.Warnings
+	}
+	if len(report.Channels) > 0 {
+		progressDetails["channels"] = report.Channels
+	}
+
+	// 模块进度
+	moduleProgress := make(map[string]interface{})
+	for name, mp := range report.ModuleProgresses {
+		moduleProgress[name] = map[string]interface{}{
+			"status":    mp.Status,
+			"progress":  mp.Progress,
+			"total":     mp.TotalItems,
+			"processed": mp.ProcessedItems,
+			"output":    mp.OutputItems,
+		}
+	}
+	progressDetails["modules"] = moduleProgress
+	return progressDetails
+}
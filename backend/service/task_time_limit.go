@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service/pipeline"
+)
+
+// DefaultTaskTimeLimit 未单独配置的任务类型使用的时间上限
+const DefaultTaskTimeLimit = 24 * time.Hour
+
+// TaskTimeLimits 任务执行时间上限
+type TaskTimeLimits struct {
+	Default     time.Duration                     // 未单独配置的任务类型使用的上限
+	Types       map[models.TaskType]time.Duration // 按任务类型配置的上限
+	MinOverride time.Duration                     // 任务级覆盖允许的最小值
+	MaxOverride time.Duration                     // 任务级覆盖允许的最大值
+	WarnRatio   float64                           // 超时预警比例
+}
+
+// DefaultTaskTimeLimits 默认时间上限
+func DefaultTaskTimeLimits() TaskTimeLimits {
+	return TaskTimeLimits{
+		Default: DefaultTaskTimeLimit,
+		Types: map[models.TaskType]time.Duration{
+			models.TaskTypeFingerprint: 2 * time.Hour,
+			models.TaskTypePortScan:    8 * time.Hour,
+			models.TaskTypeFull:        48 * time.Hour,
+		},
+		MinOverride: 10 * time.Minute,
+		MaxOverride: 7 * 24 * time.Hour,
+		WarnRatio:   pipeline.DefaultTimeLimitWarnRatio,
+	}
+}
+
+var (
+	taskTimeLimits   = DefaultTaskTimeLimits()
+	taskTimeLimitsMu sync.RWMutex
+)
+
+// SetTaskTimeLimits 设置全局任务时间上限
+func SetTaskTimeLimits(limits TaskTimeLimits) {
+	taskTimeLimitsMu.Lock()
+	defer taskTimeLimitsMu.Unlock()
+	taskTimeLimits = limits
+}
+
+// GetTaskTimeLimits 获取全局任务时间上限
+func GetTaskTimeLimits() TaskTimeLimits {
+	taskTimeLimitsMu.RLock()
+	defer taskTimeLimitsMu.RUnlock()
+	return taskTimeLimits
+}
+
+// LimitFor 获取任务的时间上限
+// 任务配置了 time_limit 时优先使用，超出管理员设置的范围时截断到边界
+func (l TaskTimeLimits) LimitFor(task *models.Task) time.Duration {
+	if task.Config.TimeLimit > 0 {
+		return l.clamp(time.Duration(task.Config.TimeLimit) * time.Minute)
+	}
+	if limit, ok := l.Types[task.Type]; ok && limit > 0 {
+		return limit
+	}
+	if l.Default > 0 {
+		return l.Default
+	}
+	return DefaultTaskTimeLimit
+}
+
+// ValidateOverride 校验任务级时间上限（分钟），0 表示使用任务类型的默认值
+func (l TaskTimeLimits) ValidateOverride(minutes int) error {
+	if minutes == 0 {
+		return nil
+	}
+	if minutes < 0 {
+		return fmt.Errorf("任务时间上限不能为负数")
+	}
+	limit := time.Duration(minutes) * time.Minute
+	if l.MinOverride > 0 && limit < l.MinOverride {
+		return fmt.Errorf("任务时间上限不能小于 %d 分钟", int(l.MinOverride.Minutes()))
+	}
+	if l.MaxOverride > 0 && limit > l.MaxOverride {
+		return fmt.Errorf("任务时间上限不能大于 %d 分钟", int(l.MaxOverride.Minutes()))
+	}
+	return nil
+}
+
+// WatchdogTimeoutFor 任务的看门狗超时（分钟）
+// 任务设置了 watchdog_timeout 时直接使用（创建时已校验长于模块超时），否则使用默认值，
+// 默认值不超过任务的最长模块超时时延长到模块超时之后，避免看门狗先于模块超时终止任务
+func WatchdogTimeoutFor(config models.TaskConfig) int {
+	if config.WatchdogTimeout > 0 {
+		return config.WatchdogTimeout
+	}
+	timeout := pipeline.DefaultWatchdogTimeoutMinutes
+	if longest := longestModuleTimeout(config); longest >= timeout {
+		timeout = longest + pipeline.DefaultWatchdogTimeoutMinutes - pipeline.LongestModuleSilenceMinutes
+	}
+	return timeout
+}
+
+// longestModuleTimeout 任务配置中最长的模块超时（分钟）
+func longestModuleTimeout(config models.TaskConfig) int {
+	longest := 0
+	for _, minutes := range config.ModuleTimeouts {
+		if minutes > longest {
+			longest = minutes
+		}
+	}
+	return longest
+}
+
+// ApplyTaskTimeouts 按任务设置流水线的时间上限、模块超时和看门狗超时
+// 看门狗与模块超时使用相同的时间单位（PipelineConfig.TimeoutUnit，默认分钟）
+func ApplyTaskTimeouts(config *pipeline.PipelineConfig, task *models.Task) {
+	limits := GetTaskTimeLimits()
+	config.TimeLimit = limits.LimitFor(task)
+	config.TimeLimitWarnRatio = limits.WarnRatio
+	config.ModuleTimeouts = task.Config.ModuleTimeouts
+
+	unit := config.TimeoutUnit
+	if unit <= 0 {
+		unit = time.Minute
+	}
+	config.WatchdogTimeout = time.Duration(WatchdogTimeoutFor(task.Config)) * unit
+}
+
+// clamp 将覆盖值限制在允许范围内
+func (l TaskTimeLimits) clamp(limit time.Duration) time.Duration {
+	if l.MinOverride > 0 && limit < l.MinOverride {
+		return l.MinOverride
+	}
+	if l.MaxOverride > 0 && limit > l.MaxOverride {
+		return l.MaxOverride
+	}
+	return limit
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 任务时间线：记录每类结果在任务中被发现的时间
+// 数量大的结果类型按量采样，避免每个爬取的 URL 都产生一个事件；事件在内存中缓冲，
+// 每批结果入库后随之批量写入（ResultBatcher.SetOnFlush），不为每条结果增加一次数据库写入
+
+const (
+	// TimelineFullEvents 每种结果类型前 N 条逐条记录
+	TimelineFullEvents = 20
+	// TimelineSampleEvery 超过 TimelineFullEvents 后每 N 条结果记录一个事件
+	TimelineSampleEvery = 100
+	// TimelineTailSize 时间线默认返回的最近事件数
+	TimelineTailSize = 50
+)
+
+// 时间线粒度
+const (
+	TimelineMinute = "minute"
+	TimelineHour   = "hour"
+)
+
+// timelineUnsampled 逐条记录的结果类型：数量少且发现时间本身有意义
+var timelineUnsampled = map[models.ResultType]bool{
+	models.ResultTypeVuln:      true,
+	models.ResultTypeSensitive: true,
+	models.ResultTypeTakeover:  true,
+}
+
+// TimelineStore 时间线事件存储
+type TimelineStore interface {
+	InsertTaskEvents(ctx context.Context, events []*models.TaskEvent) error
+	TaskEvents(ctx context.Context, taskID primitive.ObjectID) ([]*models.TaskEvent, error)
+}
+
+// TaskTimelineRecorder 记录任务结果的发现事件
+type TaskTimelineRecorder struct {
+	task  *models.Task
+	store TimelineStore
+
+	mu      sync.Mutex
+	seen    map[models.ResultType]int
+	pending map[models.ResultType]*models.TaskEvent // 正在累计的采样事件
+	buffer  []*models.TaskEvent
+}
+
+// NewTaskTimelineRecorder 创建任务时间线记录器
+func NewTaskTimelineRecorder(task *models.Task, store TimelineStore) *TaskTimelineRecorder {
+	return &TaskTimelineRecorder{
+		task:    task,
+		store:   store,
+		seen:    make(map[models.ResultType]int),
+		pending: make(map[models.ResultType]*models.TaskEvent),
+	}
+}
+
+// Record 记录一条已保存的结果，只写入缓冲区
+func (r *TaskTimelineRecorder) Record(result *models.ScanResult) {
+	ts := result.CreatedAt
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	key := TimelineKey(result)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seen[result.Type]++
+	if timelineUnsampled[result.Type] || r.seen[result.Type] <= TimelineFullEvents {
+		r.buffer = append(r.buffer, r.newEvent(result, ts, key, 1))
+		return
+	}
+
+	event := r.pending[result.Type]
+	if event == nil {
+		event = r.newEvent(result, ts, key, 0)
+		r.pending[result.Type] = event
+	}
+	event.Count++
+	event.Key = key
+	event.Timestamp = ts
+	if event.Count >= TimelineSampleEvery {
+		r.buffer = append(r.buffer, event)
+		delete(r.pending, result.Type)
+	}
+}
+
+func (r *TaskTimelineRecorder) newEvent(result *models.ScanResult, ts time.Time, key string, count int) *models.TaskEvent {
+	return &models.TaskEvent{
+		ID:          primitive.NewObjectID(),
+		TaskID:      r.task.ID,
+		WorkspaceID: r.task.WorkspaceID,
+		Timestamp:   ts,
+		ResultType:  result.Type,
+		Key:         key,
+		Source:      result.Source,
+		Count:       count,
+	}
+}
+
+// Flush 批量写入缓冲的事件并推送给实时订阅者，未满的采样事件继续累计
+func (r *TaskTimelineRecorder) Flush() {
+	r.mu.Lock()
+	events := r.buffer
+	r.buffer = nil
+	r.mu.Unlock()
+	r.write(events)
+}
+
+// Close 任务结束时写入所有事件，包括未满的采样事件
+func (r *TaskTimelineRecorder) Close() {
+	r.mu.Lock()
+	events := r.buffer
+	r.buffer = nil
+	types := make([]string, 0, len(r.pending))
+	for t := range r.pending {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		events = append(events, r.pending[models.ResultType(t)])
+	}
+	r.pending = make(map[models.ResultType]*models.TaskEvent)
+	r.mu.Unlock()
+	r.write(events)
+}
+
+func (r *TaskTimelineRecorder) write(events []*models.TaskEvent) {
+	if len(events) == 0 {
+		return
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := r.store.InsertTaskEvents(ctx, events); err != nil {
+		log.Printf("[Timeline] Failed to write %d events for task %s: %v", len(events), r.task.ID.Hex(), err)
+	}
+	timelineBroker.publish(r.task.ID.Hex(), events)
+}
+
+// TimelineKey 结果在时间线中的标识
+func TimelineKey(result *models.ScanResult) string {
+	str := func(key string) string {
+		s, _ := result.Data[key].(string)
+		return s
+	}
+	switch result.Type {
+	case models.ResultTypeSubdomain, models.ResultTypeTakeover:
+		if s := str("subdomain"); s != "" {
+			return s
+		}
+		return str("domain")
+	case models.ResultTypePort:
+		host := str("host")
+		if host == "" {
+			host = str("ip")
+		}
+		return fmt.Sprintf("%s:%v", host, result.Data["port"])
+	case models.ResultTypeVuln:
+		name := str("name")
+		if target := str("target"); target != "" {
+			return name + " @ " + target
+		}
+		return name
+	case models.ResultTypeLiveness:
+		return str("ip")
+	}
+	if s := str("url"); s != "" {
+		return s
+	}
+	if s := str("target"); s != "" {
+		return s
+	}
+	return str("host")
+}
+
+// TimelineBucket 一个时间段内发现的结果数
+type TimelineBucket struct {
+	Time   time.Time                 `json:"time"`
+	Total  int                       `json:"total"`
+	Counts map[models.ResultType]int `json:"counts"`
+}
+
+// TaskTimeline 任务时间线
+type TaskTimeline struct {
+	TaskID     string                    `json:"task_id"`
+	Resolution string                    `json:"resolution"`
+	Buckets    []TimelineBucket          `json:"buckets"`
+	Totals     map[models.ResultType]int `json:"totals"`
+	Tail       []*models.TaskEvent       `json:"tail"` // 最近的事件，最新的在后
+}
+
+// ErrInvalidResolution 时间线粒度无效
+var ErrInvalidResolution = errors.New("无效的时间粒度，可选 minute、hour")
+
+// BuildTaskTimeline 按粒度汇总事件，首尾之间没有事件的时间段也返回，便于绘图
+func BuildTaskTimeline(events []*models.TaskEvent, resolution string, tail int) (*TaskTimeline, error) {
+	var step time.Duration
+	switch resolution {
+	case "", TimelineMinute:
+		resolution, step = TimelineMinute, time.Minute
+	case TimelineHour:
+		step = time.Hour
+	default:
+		return nil, ErrInvalidResolution
+	}
+
+	sorted := make([]*models.TaskEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	timeline := &TaskTimeline{
+		Resolution: resolution,
+		Buckets:    []TimelineBucket{},
+		Totals:     make(map[models.ResultType]int),
+		Tail:       []*models.TaskEvent{},
+	}
+	if len(sorted) == 0 {
+		return timeline, nil
+	}
+
+	start := sorted[0].Timestamp.UTC().Truncate(step)
+	end := sorted[len(sorted)-1].Timestamp.UTC().Truncate(step)
+	for t := start; !t.After(end); t = t.Add(step) {
+		timeline.Buckets = append(timeline.Buckets, TimelineBucket{Time: t, Counts: make(map[models.ResultType]int)})
+	}
+	for _, e := range sorted {
+		count := e.Count
+		if count <= 0 {
+			count = 1
+		}
+		i := int(e.Timestamp.UTC().Truncate(step).Sub(start) / step)
+		timeline.Buckets[i].Counts[e.ResultType] += count
+		timeline.Buckets[i].Total += count
+		timeline.Totals[e.ResultType] += count
+	}
+
+	if tail <= 0 {
+		tail = TimelineTailSize
+	}
+	if len(sorted) > tail {
+		sorted = sorted[len(sorted)-tail:]
+	}
+	timeline.Tail = sorted
+	return timeline, nil
+}
+
+// GetTaskTimeline 获取任务时间线
+func (s *TaskService) GetTaskTimeline(taskID, resolution string, tail int) (*TaskTimeline, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, errors.New("无效的任务ID")
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	events, err := NewMongoTimelineStore().TaskEvents(ctx, objID)
+	if err != nil {
+		return nil, errors.New("查询任务时间线失败")
+	}
+
+	timeline, err := BuildTaskTimeline(events, resolution, tail)
+	if err != nil {
+		return nil, err
+	}
+	timeline.TaskID = taskID
+	return timeline, nil
+}
+
+// SubscribeTaskTimeline 订阅任务新写入的时间线事件，返回的函数用于取消订阅
+func SubscribeTaskTimeline(taskID string) (<-chan *models.TaskEvent, func()) {
+	return timelineBroker.subscribe(taskID)
+}
+
+// timelineSubscribers 时间线实时订阅
+type timelineSubscribers struct {
+	mu   sync.Mutex
+	subs map[string]map[chan *models.TaskEvent]struct{}
+}
+
+var timelineBroker = &timelineSubscribers{subs: make(map[string]map[chan *models.TaskEvent]struct{})}
+
+func (b *timelineSubscribers) subscribe(taskID string) (<-chan *models.TaskEvent, func()) {
+	ch := make(chan *models.TaskEvent, 256)
+	b.mu.Lock()
+	if b.subs[taskID] == nil {
+		b.subs[taskID] = make(map[chan *models.TaskEvent]struct{})
+	}
+	b.subs[taskID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[taskID], ch)
+			if len(b.subs[taskID]) == 0 {
+				delete(b.subs, taskID)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+// publish 推送事件，订阅者处理不过来时丢弃（完整数据可从接口查询）
+func (b *timelineSubscribers) publish(taskID string, events []*models.TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[taskID] {
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// mongoTimelineStore 时间线事件的数据库存储
+type mongoTimelineStore struct{}
+
+// NewMongoTimelineStore 创建数据库时间线存储
+func NewMongoTimelineStore() TimelineStore {
+	return &mongoTimelineStore{}
+}
+
+func (s *mongoTimelineStore) InsertTaskEvents(ctx context.Context, events []*models.TaskEvent) error {
+	docs := make([]interface{}, 0, len(events))
+	for _, e := range events {
+		docs = append(docs, e)
+	}
+	_, err := database.GetCollection(models.CollectionTaskEvents).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+func (s *mongoTimelineStore) TaskEvents(ctx context.Context, taskID primitive.ObjectID) ([]*models.TaskEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cursor, err := database.GetCollection(models.CollectionTaskEvents).Find(ctx, bson.M{"task_id": taskID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := make([]*models.TaskEvent, 0)
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"moongazing/database"
+	"moongazing/models"
+	"moongazing/scanner/core"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 外部工具调用记录
+// 扫描器通过上下文中的记录器上报每次外部工具调用，按任务持久化，
+// 用于复现任务实际执行的命令，并发现两次"相同"扫描之间二进制被替换的情况
+
+// ToolRunStore 工具调用记录存储
+type ToolRunStore interface {
+	InsertToolRun(run *models.ToolRun) error
+}
+
+// taskToolRecorder 记录任务的工具调用
+type taskToolRecorder struct {
+	task  *models.Task
+	store ToolRunStore
+}
+
+// NewToolRunRecorder 创建任务的工具调用记录器
+func NewToolRunRecorder(task *models.Task, store ToolRunStore) core.ToolRecorder {
+	return &taskToolRecorder{task: task, store: store}
+}
+
+func (r *taskToolRecorder) RecordToolRun(run *core.ToolRun) {
+	doc := ToolRunDocument(r.task, run)
+	if err := r.store.InsertToolRun(doc); err != nil {
+		log.Printf("[ToolRun] Failed to record %s run for task %s: %v", run.Tool, r.task.ID.Hex(), err)
+	}
+}
+
+// ToolRunDocument 将工具调用转换为存储文档
+func ToolRunDocument(task *models.Task, run *core.ToolRun) *models.ToolRun {
+	doc := &models.ToolRun{
+		ID:          primitive.NewObjectID(),
+		TaskID:      task.ID,
+		WorkspaceID: task.WorkspaceID,
+		Tool:        run.Tool,
+		BinaryPath:  run.BinaryPath,
+		BinaryHash:  run.BinaryHash,
+		Version:     run.Version,
+		Args:        run.Args,
+		ExitCode:    run.ExitCode,
+		Error:       run.Error,
+		StartedAt:   run.StartedAt,
+		FinishedAt:  run.FinishedAt,
+		DurationMs:  run.DurationMs,
+
+		Stderr:          run.Stderr,
+		StderrTruncated: run.StderrTruncated,
+		OutputFile:      run.OutputFile,
+		OutputSize:      run.OutputSize,
+	}
+	for _, input := range run.Inputs {
+		doc.Inputs = append(doc.Inputs, models.ToolRunInput{Path: input.Path, SHA256: input.SHA256, Size: input.Size})
+	}
+	return doc
+}
+
+// toolContext 挂载任务工具调用记录器的上下文
+func (e *TaskExecutor) toolContext(task *models.Task) context.Context {
+	return core.WithToolRecorder(context.Background(), NewToolRunRecorder(task, e.taskService))
+}
+
+// InsertToolRun 保存工具调用记录
+func (s *TaskService) InsertToolRun(run *models.ToolRun) error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	if _, err := database.GetCollection(models.CollectionToolRuns).InsertOne(ctx, run); err != nil {
+		return errors.New("保存工具调用记录失败")
+	}
+	return nil
+}
+
+// GetToolRuns 获取任务的工具调用记录（按开始时间排序）
+func (s *TaskService) GetToolRuns(taskID string) ([]*models.ToolRun, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, errors.New("无效的任务ID")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}})
+	cursor, err := database.GetCollection(models.CollectionToolRuns).Find(ctx, bson.M{"task_id": objID}, opts)
+	if err != nil {
+		return nil, errors.New("查询工具调用记录失败")
+	}
+	defer cursor.Close(ctx)
+
+	runs := make([]*models.ToolRun, 0)
+	if err = cursor.All(ctx, &runs); err != nil {
+		return nil, errors.New("解析工具调用记录失败")
+	}
+	return runs, nil
+}
+
+// previousToolRuns 获取工作空间中每个工具在任务开始前的最后一次调用
+func (s *TaskService) previousToolRuns(task *models.Task, tools []string) []*models.ToolRun {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	collection := database.GetCollection(models.CollectionToolRuns)
+	var previous []*models.ToolRun
+	for _, tool := range tools {
+		var run models.ToolRun
+		err := collection.FindOne(ctx,
+			bson.M{
+				"workspace_id": task.WorkspaceID,
+				"tool":         tool,
+				"task_id":      bson.M{"$ne": task.ID},
+				"started_at":   bson.M{"$lt": task.CreatedAt},
+			},
+			options.FindOne().SetSort(bson.D{{Key: "started_at", Value: -1}}),
+		).Decode(&run)
+		if err == nil {
+			previous = append(previous, &run)
+		}
+	}
+	return previous
+}
+
+// ToolBinaryChange 同一工具两次调用之间二进制发生变化
+type ToolBinaryChange struct {
+	Tool            string             `json:"tool"`
+	BinaryPath      string             `json:"binary_path"`
+	PreviousHash    string             `json:"previous_hash"`
+	PreviousVersion string             `json:"previous_version"`
+	CurrentHash     string             `json:"current_hash"`
+	CurrentVersion  string             `json:"current_version"`
+	PreviousRunID   primitive.ObjectID `json:"previous_run_id"`
+	CurrentRunID    primitive.ObjectID `json:"current_run_id"`
+}
+
+// DetectBinaryChanges 按时间顺序比较同一工具相邻两次调用的二进制哈希
+func DetectBinaryChanges(runs []*models.ToolRun) []ToolBinaryChange {
+	changes := make([]ToolBinaryChange, 0)
+	last := make(map[string]*models.ToolRun)
+	for _, run := range runs {
+		if run.BinaryHash == "" {
+			continue
+		}
+		if prev, ok := last[run.Tool]; ok && prev.BinaryHash != run.BinaryHash {
+			changes = append(changes, ToolBinaryChange{
+				Tool:            run.Tool,
+				BinaryPath:      run.BinaryPath,
+				PreviousHash:    prev.BinaryHash,
+				PreviousVersion: prev.Version,
+				CurrentHash:     run.BinaryHash,
+				CurrentVersion:  run.Version,
+				PreviousRunID:   prev.ID,
+				CurrentRunID:    run.ID,
+			})
+		}
+		last[run.Tool] = run
+	}
+	return changes
+}
+
+// TaskReport 任务报告
+type TaskReport struct {
+	Task            *models.Task       `json:"task"`
+	ResultStats     map[string]int64   `json:"result_stats"`
+	Appendix        TaskReportAppendix `json:"appendix"`
+	RedactionPolicy string             `json:"redaction_policy,omitempty"` // 生成报告时使用的脱敏策略
+}
+
+// TaskReportAppendix 任务报告附录：实际执行的外部工具命令
+type TaskReportAppendix struct {
+	ToolRuns      []*models.ToolRun  `json:"tool_runs"`
+	BinaryChanges []ToolBinaryChange `json:"binary_changes"` // 包含与本任务之前最后一次调用的比较
+}
+
+// GetTaskReport 生成任务报告
+func (s *TaskService) GetTaskReport(taskID string) (*TaskReport, error) {
+	task, err := s.GetTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := NewResultService().GetResultStats(taskID)
+	if err != nil {
+		return nil, errors.New("查询结果统计失败")
+	}
+
+	runs, err := s.GetToolRuns(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 与工作空间中之前的调用比较，发现两次扫描之间二进制被替换
+	var tools []string
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		if !seen[run.Tool] {
+			seen[run.Tool] = true
+			tools = append(tools, run.Tool)
+		}
+	}
+	history := append(s.previousToolRuns(task, tools), runs...)
+
+	return &TaskReport{
+		Task:        task,
+		ResultStats: stats,
+		Appendix: TaskReportAppendix{
+			ToolRuns:      runs,
+			BinaryChanges: DetectBinaryChanges(history),
+		},
+	}, nil
+}
@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 工作空间漏洞
+// 漏洞扫描结果按任务保存，同一目标上的同一漏洞在连续三次任务中是三条互不相关的记录。
+// 执行器保存漏洞结果时按 工作空间 + 目标 + 漏洞ID 合并到漏洞集合，记录首次/最近发现时间和发现次数，
+// 用本地 CVE 元数据补充 CVSS 评分和向量。漏洞的处理状态（待处理、已修复、接受风险、误报）由用户变更并留下记录；
+// 已修复的漏洞再次被扫描到时自动重新打开，超过 N 天没有在新扫描中出现的待处理漏洞标记为可能已修复
+
+// DefaultFindingStaleDays 待处理漏洞超过该天数没有再被发现时标记为可能已修复
+const DefaultFindingStaleDays = 30
+
+// findingSystemActor 扫描自动变更状态时记录的操作人
+const findingSystemActor = "system"
+
+var (
+	ErrFindingNotFound       = errors.New("漏洞不存在")
+	ErrInvalidFindingStatus  = errors.New("无效的漏洞状态，可选 open、fixed、accepted、false_positive")
+	ErrFindingNoteRequired   = errors.New("接受风险或标记误报需要填写说明")
+	ErrFindingStatusConflict = errors.New("漏洞状态已被修改，请刷新后重试")
+)
+
+// findingTransitions 允许的状态变更
+var findingTransitions = map[models.FindingStatus][]models.FindingStatus{
+	models.FindingStatusOpen:          {models.FindingStatusFixed, models.FindingStatusAccepted, models.FindingStatusFalsePositive},
+	models.FindingStatusFixed:         {models.FindingStatusOpen},
+	models.FindingStatusAccepted:      {models.FindingStatusOpen, models.FindingStatusFixed},
+	models.FindingStatusFalsePositive: {models.FindingStatusOpen},
+}
+
+// CanTransitFinding 是否允许从 from 变更为 to
+func CanTransitFinding(from, to models.FindingStatus) bool {
+	for _, allowed := range findingTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FindingFilter 漏洞查询条件，零值表示不限
+type FindingFilter struct {
+	WorkspaceID   primitive.ObjectID
+	Statuses      []models.FindingStatus
+	Severity      string
+	Target        string // 目标包含该字符串
+	PossiblyFixed bool   // 只返回可能已修复的漏洞
+}
+
+// FindingStore 漏洞存储
+type FindingStore interface {
+	// UpsertFinding 按 工作空间 + 目标 + 漏洞ID 合并：首次写入时状态为待处理并记录 FirstSeen、FirstTaskID，
+	// 之后发现次数加一、推进 LastSeen、清除可能已修复标记，并用非空的字段覆盖已有信息。返回合并后的漏洞
+	UpsertFinding(ctx context.Context, finding *models.Finding) (*models.Finding, error)
+	// GetFinding 按ID读取，不存在时返回 ErrFindingNotFound
+	GetFinding(ctx context.Context, id primitive.ObjectID) (*models.Finding, error)
+	// SetFindingStatus 当前状态为 change.From 时变更为 change.To 并追加记录，状态已变化时返回 ErrFindingStatusConflict
+	SetFindingStatus(ctx context.Context, id primitive.ObjectID, change models.FindingStatusChange) error
+	// FindFindings 按最近发现时间倒序分页查询
+	FindFindings(ctx context.Context, filter FindingFilter, page, pageSize int) ([]*models.Finding, int64, error)
+	// MarkPossiblyFixed 将最近发现时间早于 before 的待处理漏洞标记为可能已修复，返回新标记的数量
+	MarkPossiblyFixed(ctx context.Context, workspaceID primitive.ObjectID, before time.Time) (int64, error)
+}
+
+// FindingService 工作空间漏洞服务
+type FindingService struct {
+	store     FindingStore
+	cves      CVEStore
+	staleDays int
+}
+
+// NewFindingService 创建漏洞服务
+func NewFindingService() *FindingService {
+	return NewFindingServiceWithStore(NewMongoFindingStore(), NewMongoCVEStore())
+}
+
+// NewFindingServiceWithStore 使用指定存储创建漏洞服务，cves 为 nil 时不补充 CVE 元数据
+func NewFindingServiceWithStore(store FindingStore, cves CVEStore) *FindingService {
+	return &FindingService{store: store, cves: cves, staleDays: DefaultFindingStaleDays}
+}
+
+// SetStaleDays 设置标记可能已修复的天数，<= 0 时关闭
+func (s *FindingService) SetStaleDays(days int) {
+	s.staleDays = days
+}
+
+// Record 把已保存的漏洞结果合并到工作空间漏洞，其他结果类型忽略
+func (s *FindingService) Record(result *models.ScanResult) error {
+	if s == nil {
+		return nil
+	}
+	finding := FindingFromResult(result)
+	if finding == nil {
+		return nil
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	s.enrich(ctx, finding)
+	merged, err := s.store.UpsertFinding(ctx, finding)
+	if err != nil {
+		return fmt.Errorf("更新漏洞 %s (%s) 失败: %w", finding.VulnID, finding.Target, err)
+	}
+
+	// 已修复的漏洞再次出现，重新打开
+	if merged.Status == models.FindingStatusFixed {
+		change := models.FindingStatusChange{
+			From: models.FindingStatusFixed,
+			To:   models.FindingStatusOpen,
+			Note: "任务 " + result.TaskID.Hex() + " 再次发现",
+			By:   findingSystemActor,
+			At:   time.Now(),
+		}
+		if err := s.store.SetFindingStatus(ctx, merged.ID, change); err != nil && !errors.Is(err, ErrFindingStatusConflict) {
+			return fmt.Errorf("重新打开漏洞 %s 失败: %w", merged.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// enrich 用本地 CVE 元数据补充评分，多个 CVE 时取评分最高的一个；查询失败时不影响保存
+func (s *FindingService) enrich(ctx context.Context, finding *models.Finding) {
+	if s.cves == nil || len(finding.CVEIDs) == 0 {
+		return
+	}
+	items, err := s.cves.GetCVEs(ctx, finding.CVEIDs)
+	if err != nil {
+		log.Printf("[FindingService] Failed to look up CVE metadata for %v: %v", finding.CVEIDs, err)
+		return
+	}
+	var best *models.CVEMetadata
+	for _, id := range finding.CVEIDs {
+		if item, ok := items[id]; ok && (best == nil || item.CVSSScore > best.CVSSScore) {
+			best = item
+		}
+	}
+	if best == nil {
+		return
+	}
+	finding.CVSSScore = best.CVSSScore
+	finding.CVSSVector = best.CVSSVector
+	finding.CVESummary = best.Summary
+	if finding.Description == "" {
+		finding.Description = best.Summary
+	}
+	if len(finding.References) == 0 {
+		finding.References = best.References
+	}
+}
+
+// GetFinding 按ID读取漏洞
+func (s *FindingService) GetFinding(id string) (*models.Finding, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrFindingNotFound
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.GetFinding(ctx, oid)
+}
+
+// ListFindings 按条件分页查询漏洞
+func (s *FindingService) ListFindings(filter FindingFilter, page, pageSize int) ([]*models.Finding, int64, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.FindFindings(ctx, filter, page, pageSize)
+}
+
+// ChangeStatus 变更漏洞状态并记录说明和操作人，接受风险和误报必须填写说明
+func (s *FindingService) ChangeStatus(id string, to models.FindingStatus, note, by string) (*models.Finding, error) {
+	if _, ok := findingTransitions[to]; !ok {
+		return nil, ErrInvalidFindingStatus
+	}
+	note = strings.TrimSpace(note)
+	if note == "" && (to == models.FindingStatusAccepted || to == models.FindingStatusFalsePositive) {
+		return nil, ErrFindingNoteRequired
+	}
+
+	finding, err := s.GetFinding(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransitFinding(finding.Status, to) {
+		return nil, fmt.Errorf("不能从 %s 变更为 %s", finding.Status, to)
+	}
+
+	change := models.FindingStatusChange{From: finding.Status, To: to, Note: note, By: by, At: time.Now()}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	if err := s.store.SetFindingStatus(ctx, finding.ID, change); err != nil {
+		return nil, err
+	}
+	return s.store.GetFinding(ctx, finding.ID)
+}
+
+// FlagPossiblyFixed 将工作空间中超过设置天数没有再被发现的待处理漏洞标记为可能已修复，返回新标记的数量
+func (s *FindingService) FlagPossiblyFixed(workspaceID primitive.ObjectID) (int64, error) {
+	if s == nil || s.staleDays <= 0 {
+		return 0, nil
+	}
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return s.store.MarkPossiblyFixed(ctx, workspaceID, time.Now().AddDate(0, 0, -s.staleDays))
+}
+
+// ParseFindingStatuses 解析查询参数中的漏洞状态
+func ParseFindingStatuses(values []string) ([]models.FindingStatus, error) {
+	statuses := make([]models.FindingStatus, 0, len(values))
+	for _, v := range values {
+		status := models.FindingStatus(v)
+		if _, ok := findingTransitions[status]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFindingStatus, v)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// FindingFromResult 从漏洞扫描结果中提取漏洞标识和信息，其他结果类型返回 nil
+func FindingFromResult(result *models.ScanResult) *models.Finding {
+	if result == nil || result.Type != models.ResultTypeVuln || result.Data == nil {
+		return nil
+	}
+	data := result.Data
+	finding := &models.Finding{
+		WorkspaceID: result.WorkspaceID,
+		Target:      strings.TrimSpace(cellValue(data["target"])),
+		VulnID:      strings.TrimSpace(cellValue(data["vuln_id"])),
+		Name:        cellValue(data["name"]),
+		Severity:    strings.ToLower(cellValue(data["severity"])),
+		Source:      result.Source,
+		Description: cellValue(data["description"]),
+		References:  stringList(data["reference"]),
+		Status:      models.FindingStatusOpen,
+		Occurrences: 1,
+		FirstTaskID: result.TaskID,
+		LastTaskID:  result.TaskID,
+		FirstSeen:   result.CreatedAt,
+		LastSeen:    result.CreatedAt,
+	}
+	if finding.Target == "" {
+		finding.Target = strings.TrimSpace(cellValue(data["matched_at"]))
+	}
+	if finding.VulnID == "" {
+		finding.VulnID = finding.Name
+	}
+	if finding.Target == "" || finding.VulnID == "" {
+		return nil
+	}
+	if finding.LastSeen.IsZero() {
+		finding.FirstSeen = time.Now()
+		finding.LastSeen = finding.FirstSeen
+	}
+	finding.CVEIDs = ExtractCVEIDs(finding.VulnID, finding.Name)
+	return finding
+}
+
+// FindingIndexes 漏洞集合的索引：合并键唯一，避免并发写入同一漏洞时产生重复记录
+func FindingIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "workspace_id", Value: 1}, {Key: "target", Value: 1}, {Key: "vuln_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "status", Value: 1}, {Key: "last_seen", Value: -1}}},
+	}
+}
+
+// EnsureFindingIndexes 创建漏洞集合的索引，已存在的索引不会重复创建
+func EnsureFindingIndexes() error {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	_, err := database.GetCollection(models.CollectionFindings).Indexes().CreateMany(ctx, FindingIndexes(), options.CreateIndexes())
+	return err
+}
+
+// mongoFindingStore 漏洞的数据库存储
+type mongoFindingStore struct{}
+
+// NewMongoFindingStore 创建数据库漏洞存储
+func NewMongoFindingStore() FindingStore {
+	return &mongoFindingStore{}
+}
+
+func (s *mongoFindingStore) UpsertFinding(ctx context.Context, finding *models.Finding) (*models.Finding, error) {
+	filter := bson.M{
+		"workspace_id": finding.WorkspaceID,
+		"target":       finding.Target,
+		"vuln_id":      finding.VulnID,
+	}
+
+	set := bson.M{
+		"last_task_id":   finding.LastTaskID,
+		"possibly_fixed": false,
+		"updated_at":     time.Now(),
+	}
+	for field, value := range map[string]string{
+		"name":        finding.Name,
+		"severity":    finding.Severity,
+		"source":      finding.Source,
+		"description": finding.Description,
+		"cvss_vector": finding.CVSSVector,
+		"cve_summary": finding.CVESummary,
+	} {
+		if value != "" {
+			set[field] = value
+		}
+	}
+	if finding.CVSSScore > 0 {
+		set["cvss_score"] = finding.CVSSScore
+	}
+	if len(finding.References) > 0 {
+		set["references"] = finding.References
+	}
+	if len(finding.CVEIDs) > 0 {
+		set["cve_ids"] = finding.CVEIDs
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"status":        models.FindingStatusOpen,
+			"first_seen":    finding.FirstSeen,
+			"first_task_id": finding.FirstTaskID,
+		},
+		"$max": bson.M{"last_seen": finding.LastSeen},
+		"$inc": bson.M{"occurrences": 1},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var merged models.Finding
+	if err := database.GetCollection(models.CollectionFindings).FindOneAndUpdate(ctx, filter, update, opts).Decode(&merged); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+func (s *mongoFindingStore) GetFinding(ctx context.Context, id primitive.ObjectID) (*models.Finding, error) {
+	var finding models.Finding
+	err := database.GetCollection(models.CollectionFindings).FindOne(ctx, bson.M{"_id": id}).Decode(&finding)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrFindingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &finding, nil
+}
+
+func (s *mongoFindingStore) SetFindingStatus(ctx context.Context, id primitive.ObjectID, change models.FindingStatusChange) error {
+	res, err := database.GetCollection(models.CollectionFindings).UpdateOne(ctx,
+		bson.M{"_id": id, "status": change.From},
+		bson.M{
+			"$set":  bson.M{"status": change.To, "possibly_fixed": false, "updated_at": change.At},
+			"$push": bson.M{"history": change},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrFindingStatusConflict
+	}
+	return nil
+}
+
+func (s *mongoFindingStore) FindFindings(ctx context.Context, filter FindingFilter, page, pageSize int) ([]*models.Finding, int64, error) {
+	query := bson.M{"workspace_id": filter.WorkspaceID}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if filter.Severity != "" {
+		query["severity"] = strings.ToLower(filter.Severity)
+	}
+	if filter.Target != "" {
+		query["target"] = bson.M{"$regex": regexp.QuoteMeta(filter.Target), "$options": "i"}
+	}
+	if filter.PossiblyFixed {
+		query["possibly_fixed"] = true
+	}
+
+	collection := database.GetCollection(models.CollectionFindings)
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "last_seen", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var findings []*models.Finding
+	if err := cursor.All(ctx, &findings); err != nil {
+		return nil, 0, err
+	}
+	return findings, total, nil
+}
+
+func (s *mongoFindingStore) MarkPossiblyFixed(ctx context.Context, workspaceID primitive.ObjectID, before time.Time) (int64, error) {
+	res, err := database.GetCollection(models.CollectionFindings).UpdateMany(ctx,
+		bson.M{
+			"workspace_id":   workspaceID,
+			"status":         models.FindingStatusOpen,
+			"possibly_fixed": false,
+			"last_seen":      bson.M{"$lt": before},
+		},
+		bson.M{"$set": bson.M{"possibly_fixed": true, "updated_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
@@ -61,36 +61,61 @@ func (s *VulnService) GetVulnByID(vulnID string) (*models.Vulnerability, error)
 	return &vuln, nil
 }
 
-// ListVulnerabilities lists vulnerabilities with filtering and pagination
-func (s *VulnService) ListVulnerabilities(workspaceID string, severity string, status string, keyword string, page, pageSize int) ([]*models.Vulnerability, int64, error) {
-	ctx, cancel := database.NewContext()
-	defer cancel()
-	
-	collection := database.GetCollection(models.CollectionVulnerabilities)
-	
+// VulnListFilter 漏洞查询条件
+type VulnListFilter struct {
+	WorkspaceID string
+	// WorkspaceIDs 未指定 WorkspaceID 时限定可见的工作空间，nil 表示不限
+	WorkspaceIDs []primitive.ObjectID
+	Severity     string
+	Status       string
+	Keyword      string
+}
+
+// BSON 转换为 MongoDB 查询条件
+func (f VulnListFilter) BSON() bson.M {
 	filter := bson.M{}
 	
-	if workspaceID != "" {
-		wsID, _ := primitive.ObjectIDFromHex(workspaceID)
+	if f.WorkspaceID != "" {
+		wsID, _ := primitive.ObjectIDFromHex(f.WorkspaceID)
 		filter["workspace_id"] = wsID
+	} else if f.WorkspaceIDs != nil {
+		// 漏洞总是带 workspace_id，默认空间为零值 ObjectID（已包含在可见列表中）
+		filter["workspace_id"] = bson.M{"$in": f.WorkspaceIDs}
 	}
 	
-	if severity != "" {
-		filter["severity"] = severity
+	if f.Severity != "" {
+		filter["severity"] = f.Severity
 	}
 	
-	if status != "" {
-		filter["status"] = status
+	if f.Status != "" {
+		filter["status"] = f.Status
 	}
 	
-	if keyword != "" {
+	if f.Keyword != "" {
 		filter["$or"] = []bson.M{
-			{"name": bson.M{"$regex": keyword, "$options": "i"}},
-			{"target": bson.M{"$regex": keyword, "$options": "i"}},
-			{"description": bson.M{"$regex": keyword, "$options": "i"}},
+			{"name": bson.M{"$regex": f.Keyword, "$options": "i"}},
+			{"target": bson.M{"$regex": f.Keyword, "$options": "i"}},
+			{"description": bson.M{"$regex": f.Keyword, "$options": "i"}},
 		}
 	}
 	
+	return filter
+}
+
+// ListVulnerabilities lists vulnerabilities with filtering and pagination
+func (s *VulnService) ListVulnerabilities(workspaceID string, severity string, status string, keyword string, page, pageSize int) ([]*models.Vulnerability, int64, error) {
+	return s.ListVulnerabilitiesByFilter(VulnListFilter{WorkspaceID: workspaceID, Severity: severity, Status: status, Keyword: keyword}, page, pageSize)
+}
+
+// ListVulnerabilitiesByFilter 按条件分页查询漏洞
+func (s *VulnService) ListVulnerabilitiesByFilter(f VulnListFilter, page, pageSize int) ([]*models.Vulnerability, int64, error) {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	
+	collection := database.GetCollection(models.CollectionVulnerabilities)
+	
+	filter := f.BSON()
+	
 	// Get total count
 	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
@@ -186,16 +211,17 @@ func (s *VulnService) MarkAsFalsePositive(vulnID string) error {
 
 // GetVulnStats returns vulnerability statistics
 func (s *VulnService) GetVulnStats(workspaceID string) (*models.ReportSummary, error) {
+	return s.GetVulnStatsByFilter(VulnListFilter{WorkspaceID: workspaceID})
+}
+
+// GetVulnStatsByFilter 按条件统计各等级漏洞数量
+func (s *VulnService) GetVulnStatsByFilter(f VulnListFilter) (*models.ReportSummary, error) {
 	ctx, cancel := database.NewContext()
 	defer cancel()
 	
 	collection := database.GetCollection(models.CollectionVulnerabilities)
 	
-	filter := bson.M{}
-	if workspaceID != "" {
-		wsID, _ := primitive.ObjectIDFromHex(workspaceID)
-		filter["workspace_id"] = wsID
-	}
+	filter := f.BSON()
 	
 	// Count by severity
 	pipeline := []bson.M{
@@ -0,0 +1,564 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"moongazing/database"
+	"moongazing/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 工作空间成员权限
+// 成员角色记录在 workspace_members 集合：owner 管理成员并读写，editor 读写任务和结果，viewer 只读。
+// 全局管理员视为所有工作空间的 owner；未指定工作空间（默认空间）的任务和结果对所有登录用户可读写，与之前一致。
+// 没有成员记录时沿用工作空间文档中的 owner_id（owner）和 members（editor）。
+// 用户看不到的工作空间中的任务和结果按不存在处理，不返回 403，避免通过 ID 探测其他工作空间的数据。
+
+var (
+	// ErrWorkspaceNotFound 工作空间不存在
+	ErrWorkspaceNotFound = errors.New("工作空间不存在")
+	// ErrTaskNotFound 任务不存在或不在用户可见的工作空间中
+	ErrTaskNotFound = errors.New("任务不存在")
+	// ErrResultNotFound 结果不存在或不在用户可见的工作空间中
+	ErrResultNotFound = errors.New("结果不存在")
+	// ErrCruiseNotFound 巡航任务不存在或不在用户可见的工作空间中
+	ErrCruiseNotFound = errors.New("巡航任务不存在")
+	// ErrTaskTemplateNotFound 模板不存在或不在用户可见的工作空间中
+	ErrTaskTemplateNotFound = errors.New("模板不存在")
+	// ErrWorkspaceReadOnly 只读成员尝试修改
+	ErrWorkspaceReadOnly = fmt.Errorf("%w：只读成员不能修改任务和结果", ErrWorkspaceForbidden)
+	// ErrWorkspaceOwnerRequired 非所有者尝试管理成员
+	ErrWorkspaceOwnerRequired = fmt.Errorf("%w：只有所有者和管理员可以管理成员", ErrWorkspaceForbidden)
+	// ErrLastWorkspaceOwner 移除或降级最后一个所有者
+	ErrLastWorkspaceOwner = errors.New("工作空间至少需要保留一个所有者")
+	// ErrInvalidWorkspaceRole 成员角色无效
+	ErrInvalidWorkspaceRole = errors.New("无效的成员角色，可选 owner、editor、viewer")
+	// ErrWorkspaceMemberNotFound 成员不存在
+	ErrWorkspaceMemberNotFound = errors.New("成员不存在")
+	// ErrWorkspaceCreatorRemove 移除工作空间的创建者
+	ErrWorkspaceCreatorRemove = errors.New("不能移除工作空间的创建者，可以修改其角色")
+	// ErrDefaultWorkspaceMembers 默认空间没有成员
+	ErrDefaultWorkspaceMembers = errors.New("默认空间对所有用户开放，不能设置成员")
+)
+
+// workspaceRoleRank 角色的权限高低
+var workspaceRoleRank = map[models.WorkspaceRole]int{
+	models.WorkspaceRoleViewer: 1,
+	models.WorkspaceRoleEditor: 2,
+	models.WorkspaceRoleOwner:  3,
+}
+
+// ValidWorkspaceRole 是否为有效的成员角色
+func ValidWorkspaceRole(role models.WorkspaceRole) bool {
+	return workspaceRoleRank[role] > 0
+}
+
+// checkWorkspaceRole 成员角色是否满足要求，have 为空表示不是成员
+func checkWorkspaceRole(have, need models.WorkspaceRole) error {
+	switch {
+	case have == "":
+		return ErrWorkspaceForbidden
+	case workspaceRoleRank[have] >= workspaceRoleRank[need]:
+		return nil
+	case need == models.WorkspaceRoleOwner:
+		return ErrWorkspaceOwnerRequired
+	default:
+		return ErrWorkspaceReadOnly
+	}
+}
+
+// WorkspaceMemberStore 工作空间和成员的存储
+type WorkspaceMemberStore interface {
+	// GetWorkspace 不存在时返回 ErrWorkspaceNotFound
+	GetWorkspace(ctx context.Context, workspaceID primitive.ObjectID) (*models.Workspace, error)
+	// ListWorkspaces userID 为空时返回全部工作空间，否则返回 owner_id 或 members 中包含该用户的工作空间
+	ListWorkspaces(ctx context.Context, userID primitive.ObjectID) ([]*models.Workspace, error)
+	// GetMember 没有成员记录时返回 nil
+	GetMember(ctx context.Context, workspaceID, userID primitive.ObjectID) (*models.WorkspaceMember, error)
+	ListMembers(ctx context.Context, workspaceID primitive.ObjectID) ([]*models.WorkspaceMember, error)
+	ListMemberships(ctx context.Context, userID primitive.ObjectID) ([]*models.WorkspaceMember, error)
+	// SaveMember 按工作空间和用户新增或更新成员
+	SaveMember(ctx context.Context, member *models.WorkspaceMember) error
+	// EnsureMember 没有成员记录时新增，已有记录不修改，返回是否新增
+	EnsureMember(ctx context.Context, member *models.WorkspaceMember) (bool, error)
+	// DeleteMember 删除成员记录，同时从工作空间文档的 members 中移除，返回是否删除了任何一处
+	DeleteMember(ctx context.Context, workspaceID, userID primitive.ObjectID) (bool, error)
+}
+
+// WorkspaceAccess 工作空间权限校验和成员管理
+type WorkspaceAccess struct {
+	store WorkspaceMemberStore
+}
+
+// NewWorkspaceAccess 使用数据库存储创建权限校验
+func NewWorkspaceAccess() *WorkspaceAccess {
+	return NewWorkspaceAccessWithStore(NewMongoWorkspaceMemberStore())
+}
+
+// NewWorkspaceAccessWithStore 使用指定存储创建权限校验
+func NewWorkspaceAccessWithStore(store WorkspaceMemberStore) *WorkspaceAccess {
+	return &WorkspaceAccess{store: store}
+}
+
+// WorkspaceRole 用户在工作空间中的角色，不是成员时返回空字符串
+// role 为用户的全局角色，管理员视为 owner
+func (a *WorkspaceAccess) WorkspaceRole(workspaceID, userID primitive.ObjectID, role string) (models.WorkspaceRole, error) {
+	if role == "admin" {
+		return models.WorkspaceRoleOwner, nil
+	}
+	if workspaceID.IsZero() {
+		return models.WorkspaceRoleEditor, nil
+	}
+	if userID.IsZero() {
+		return "", nil
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	member, err := a.store.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+	if member != nil {
+		return member.Role, nil
+	}
+
+	workspace, err := a.store.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return "", err
+	}
+	if workspace.OwnerID == userID {
+		return models.WorkspaceRoleOwner, nil
+	}
+	for _, id := range workspace.Members {
+		if id == userID {
+			return models.WorkspaceRoleEditor, nil
+		}
+	}
+	return "", nil
+}
+
+// Authorize 校验用户对工作空间的权限，need 为需要的最低角色
+func (a *WorkspaceAccess) Authorize(workspaceID, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	have, err := a.WorkspaceRole(workspaceID, userID, role)
+	if err != nil {
+		return err
+	}
+	return checkWorkspaceRole(have, need)
+}
+
+// AuthorizeVisible 与 Authorize 相同，不是成员时按工作空间不存在返回 ErrWorkspaceNotFound，
+// 避免泄露其他工作空间是否存在；只读成员修改时返回 ErrWorkspaceReadOnly
+func (a *WorkspaceAccess) AuthorizeVisible(workspaceID, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	have, err := a.WorkspaceRole(workspaceID, userID, role)
+	if err != nil {
+		return err
+	}
+	if have == "" {
+		return ErrWorkspaceNotFound
+	}
+	return checkWorkspaceRole(have, need)
+}
+
+// CanViewWorkspace 用户是否可以查看工作空间的任务和结果
+func (a *WorkspaceAccess) CanViewWorkspace(workspaceID, userID primitive.ObjectID, role string) bool {
+	return a.Authorize(workspaceID, userID, role, models.WorkspaceRoleViewer) == nil
+}
+
+// CanEditWorkspace 用户是否可以创建、修改、删除工作空间的任务和结果
+func (a *WorkspaceAccess) CanEditWorkspace(workspaceID, userID primitive.ObjectID, role string) bool {
+	return a.Authorize(workspaceID, userID, role, models.WorkspaceRoleEditor) == nil
+}
+
+// AuthorizeTask 校验用户对任务的权限，看不到任务所在的工作空间时返回 ErrTaskNotFound
+func (a *WorkspaceAccess) AuthorizeTask(task *models.Task, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	if task == nil {
+		return ErrTaskNotFound
+	}
+	return a.authorizeResource(task.WorkspaceID, userID, role, need, ErrTaskNotFound)
+}
+
+// AuthorizeCruise 校验用户对巡航任务的权限，看不到巡航任务所在的工作空间时返回 ErrCruiseNotFound
+func (a *WorkspaceAccess) AuthorizeCruise(cruise *models.CruiseTask, userID primitive.ObjectID, role string, need models.WorkspaceRole) error {
+	if cruise == nil {
+		return ErrCruiseNotFound
+	}
+	return a.authorizeResource(cruise.WorkspaceID, userID, role, need, ErrCruiseNotFound)
+}
+
+// AuthorizeTemplate 校验用户是否可以使用任务模板：公开模板和内置模板所有用户可用，
+// 其他模板需要可以查看模板所在的工作空间，否则返回 ErrTaskTemplateNotFound
+func (a *WorkspaceAccess) AuthorizeTemplate(template *models.TaskTemplate, userID primitive.ObjectID, role string) error {
+	if template == nil {
+		return ErrTaskTemplateNotFound
+	}
+	if template.IsPublic || template.BuiltIn {
+		return nil
+	}
+	return a.authorizeResource(template.WorkspaceID, userID, role, models.WorkspaceRoleViewer, ErrTaskTemplateNotFound)
+}
+
+// AuthorizeFollowUpTarget 校验用户可以在后续任务的工作空间中创建任务并使用其模板，template 为 nil 表示沿用父任务配置
+func (a *WorkspaceAccess) AuthorizeFollowUpTarget(workspaceID primitive.ObjectID, template *models.TaskTemplate, userID primitive.ObjectID, role string) error {
+	if err := a.AuthorizeVisible(workspaceID, userID, role, models.WorkspaceRoleEditor); err != nil {
+		return err
+	}
+	if template == nil {
+		return nil
+	}
+	return a.AuthorizeTemplate(template, userID, role)
+}
+
+// authorizeResource 校验用户对工作空间中某个资源的权限，看不到该工作空间时返回 notFound
+func (a *WorkspaceAccess) authorizeResource(workspaceID, userID primitive.ObjectID, role string, need models.WorkspaceRole, notFound error) error {
+	have, err := a.WorkspaceRole(workspaceID, userID, role)
+	if err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+		return err
+	}
+	if have == "" {
+		return notFound
+	}
+	return checkWorkspaceRole(have, need)
+}
+
+// VisibleWorkspaceIDs 用户可以查看的工作空间（包括默认空间），all 为 true 时可以查看全部
+func (a *WorkspaceAccess) VisibleWorkspaceIDs(userID primitive.ObjectID, role string) (ids []primitive.ObjectID, all bool, err error) {
+	if role == "admin" {
+		return nil, true, nil
+	}
+	ids = []primitive.ObjectID{primitive.NilObjectID}
+	if userID.IsZero() {
+		return ids, false, nil
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	memberships, err := a.store.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	recorded := make(map[primitive.ObjectID]bool, len(memberships))
+	for _, m := range memberships {
+		recorded[m.WorkspaceID] = true
+		ids = append(ids, m.WorkspaceID)
+	}
+	// 没有成员记录的工作空间按 owner_id 和 members 判断
+	legacy, err := a.store.ListWorkspaces(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, ws := range legacy {
+		if !recorded[ws.ID] {
+			ids = append(ids, ws.ID)
+		}
+	}
+	return ids, false, nil
+}
+
+// ListMembers 列出工作空间的成员，成员可以查看
+func (a *WorkspaceAccess) ListMembers(workspaceID, userID primitive.ObjectID, role string) ([]*models.WorkspaceMember, error) {
+	if workspaceID.IsZero() {
+		return nil, ErrDefaultWorkspaceMembers
+	}
+	if err := a.Authorize(workspaceID, userID, role, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+	return a.store.ListMembers(ctx, workspaceID)
+}
+
+// SetMember 邀请成员或修改成员角色，只有所有者和管理员可以操作
+func (a *WorkspaceAccess) SetMember(workspaceID, memberID primitive.ObjectID, memberRole models.WorkspaceRole, userID primitive.ObjectID, role string) (*models.WorkspaceMember, error) {
+	if workspaceID.IsZero() {
+		return nil, ErrDefaultWorkspaceMembers
+	}
+	if !ValidWorkspaceRole(memberRole) {
+		return nil, ErrInvalidWorkspaceRole
+	}
+	if err := a.Authorize(workspaceID, userID, role, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	if memberRole != models.WorkspaceRoleOwner {
+		if err := a.ensureOtherOwner(ctx, workspaceID, memberID); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	member := &models.WorkspaceMember{
+		WorkspaceID: workspaceID,
+		UserID:      memberID,
+		Role:        memberRole,
+		InvitedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := a.store.SaveMember(ctx, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember 移除成员，只有所有者和管理员可以操作
+func (a *WorkspaceAccess) RemoveMember(workspaceID, memberID, userID primitive.ObjectID, role string) error {
+	if workspaceID.IsZero() {
+		return ErrDefaultWorkspaceMembers
+	}
+	if err := a.Authorize(workspaceID, userID, role, models.WorkspaceRoleOwner); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	workspace, err := a.store.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	// 没有成员记录时 owner_id 仍按所有者处理，删除不能收回权限
+	if workspace.OwnerID == memberID {
+		return ErrWorkspaceCreatorRemove
+	}
+	if err := a.ensureOtherOwner(ctx, workspaceID, memberID); err != nil {
+		return err
+	}
+	deleted, err := a.store.DeleteMember(ctx, workspaceID, memberID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrWorkspaceMemberNotFound
+	}
+	return nil
+}
+
+// ensureOtherOwner memberID 不再是所有者后工作空间仍有其他所有者
+func (a *WorkspaceAccess) ensureOtherOwner(ctx context.Context, workspaceID, memberID primitive.ObjectID) error {
+	current, err := a.store.GetMember(ctx, workspaceID, memberID)
+	if err != nil {
+		return err
+	}
+	workspace, err := a.store.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	// 没有成员记录的 owner_id 用户也是所有者
+	isOwner := (current != nil && current.Role == models.WorkspaceRoleOwner) || (current == nil && workspace.OwnerID == memberID)
+	if !isOwner {
+		return nil
+	}
+
+	members, err := a.store.ListMembers(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	legacyOwnerRecorded := false
+	for _, m := range members {
+		if m.UserID == workspace.OwnerID {
+			legacyOwnerRecorded = true
+		}
+		if m.UserID != memberID && m.Role == models.WorkspaceRoleOwner {
+			return nil
+		}
+	}
+	if !workspace.OwnerID.IsZero() && workspace.OwnerID != memberID && !legacyOwnerRecorded {
+		return nil
+	}
+	return ErrLastWorkspaceOwner
+}
+
+// GrantOwnerOnAllWorkspaces 为用户补齐所有已有工作空间的 owner 成员记录，已有的成员记录不修改，返回新增数量
+func (a *WorkspaceAccess) GrantOwnerOnAllWorkspaces(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	workspaces, err := a.store.ListWorkspaces(ctx, primitive.NilObjectID)
+	if err != nil {
+		return 0, err
+	}
+	granted := 0
+	for _, ws := range workspaces {
+		now := time.Now()
+		created, err := a.store.EnsureMember(ctx, &models.WorkspaceMember{
+			WorkspaceID: ws.ID,
+			UserID:      userID,
+			Role:        models.WorkspaceRoleOwner,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			return granted, err
+		}
+		if created {
+			granted++
+		}
+	}
+	return granted, nil
+}
+
+// InitWorkspaceOwners 启动时为管理员补齐所有已有工作空间的 owner 成员记录，单用户部署升级后仍能访问原有数据
+func InitWorkspaceOwners() {
+	ctx, cancel := database.NewContext()
+	defer cancel()
+
+	if err := EnsureWorkspaceMemberIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create workspace member indexes: %v", err)
+	}
+
+	cursor, err := database.GetCollection(models.CollectionUsers).Find(ctx, bson.M{"role": "admin"})
+	if err != nil {
+		log.Printf("Warning: Failed to list admin users: %v", err)
+		return
+	}
+	var admins []models.User
+	if err := cursor.All(ctx, &admins); err != nil {
+		log.Printf("Warning: Failed to list admin users: %v", err)
+		return
+	}
+
+	access := NewWorkspaceAccess()
+	for _, admin := range admins {
+		granted, err := access.GrantOwnerOnAllWorkspaces(ctx, admin.ID)
+		if err != nil {
+			log.Printf("Warning: Failed to grant workspace ownership to %s: %v", admin.Username, err)
+			continue
+		}
+		if granted > 0 {
+			log.Printf("Granted %s owner on %d existing workspaces", admin.Username, granted)
+		}
+	}
+}
+
+// EnsureWorkspaceMemberIndexes 成员集合的索引：每个工作空间内每个用户一条记录
+func EnsureWorkspaceMemberIndexes(ctx context.Context) error {
+	_, err := database.GetCollection(models.CollectionWorkspaceMembers).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
+// mongoWorkspaceMemberStore 工作空间成员的数据库存储
+type mongoWorkspaceMemberStore struct{}
+
+// NewMongoWorkspaceMemberStore 创建数据库成员存储
+func NewMongoWorkspaceMemberStore() WorkspaceMemberStore {
+	return &mongoWorkspaceMemberStore{}
+}
+
+func (s *mongoWorkspaceMemberStore) GetWorkspace(ctx context.Context, workspaceID primitive.ObjectID) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := database.GetCollection(models.CollectionWorkspaces).FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&workspace)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+func (s *mongoWorkspaceMemberStore) ListWorkspaces(ctx context.Context, userID primitive.ObjectID) ([]*models.Workspace, error) {
+	filter := bson.M{}
+	if !userID.IsZero() {
+		filter = bson.M{"$or": []bson.M{{"owner_id": userID}, {"members": userID}}}
+	}
+	cursor, err := database.GetCollection(models.CollectionWorkspaces).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []*models.Workspace
+	if err := cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+func (s *mongoWorkspaceMemberStore) GetMember(ctx context.Context, workspaceID, userID primitive.ObjectID) (*models.WorkspaceMember, error) {
+	var member models.WorkspaceMember
+	err := database.GetCollection(models.CollectionWorkspaceMembers).FindOne(ctx, bson.M{"workspace_id": workspaceID, "user_id": userID}).Decode(&member)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (s *mongoWorkspaceMemberStore) ListMembers(ctx context.Context, workspaceID primitive.ObjectID) ([]*models.WorkspaceMember, error) {
+	return s.findMembers(ctx, bson.M{"workspace_id": workspaceID})
+}
+
+func (s *mongoWorkspaceMemberStore) ListMemberships(ctx context.Context, userID primitive.ObjectID) ([]*models.WorkspaceMember, error) {
+	return s.findMembers(ctx, bson.M{"user_id": userID})
+}
+
+func (s *mongoWorkspaceMemberStore) findMembers(ctx context.Context, filter bson.M) ([]*models.WorkspaceMember, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := database.GetCollection(models.CollectionWorkspaceMembers).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var members []*models.WorkspaceMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (s *mongoWorkspaceMemberStore) SaveMember(ctx context.Context, member *models.WorkspaceMember) error {
+	_, err := database.GetCollection(models.CollectionWorkspaceMembers).UpdateOne(ctx,
+		bson.M{"workspace_id": member.WorkspaceID, "user_id": member.UserID},
+		bson.M{
+			"$set":         bson.M{"role": member.Role, "updated_at": member.UpdatedAt},
+			"$setOnInsert": bson.M{"invited_by": member.InvitedBy, "created_at": member.CreatedAt},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *mongoWorkspaceMemberStore) EnsureMember(ctx context.Context, member *models.WorkspaceMember) (bool, error) {
+	res, err := database.GetCollection(models.CollectionWorkspaceMembers).UpdateOne(ctx,
+		bson.M{"workspace_id": member.WorkspaceID, "user_id": member.UserID},
+		bson.M{"$setOnInsert": bson.M{
+			"role":       member.Role,
+			"invited_by": member.InvitedBy,
+			"created_at": member.CreatedAt,
+			"updated_at": member.UpdatedAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+func (s *mongoWorkspaceMemberStore) DeleteMember(ctx context.Context, workspaceID, userID primitive.ObjectID) (bool, error) {
+	res, err := database.GetCollection(models.CollectionWorkspaceMembers).DeleteOne(ctx, bson.M{"workspace_id": workspaceID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	pulled, err := database.GetCollection(models.CollectionWorkspaces).UpdateOne(ctx,
+		bson.M{"_id": workspaceID},
+		bson.M{"$pull": bson.M{"members": userID}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0 || pulled.ModifiedCount > 0, nil
+}
@@ -0,0 +1,384 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/subdomain/thirdparty"
+	"moongazing/service"
+	"moongazing/utils"
+)
+
+// ========== 工作空间第三方数据源密钥测试 ==========
+// 各数据源的认证接口用 httptest 模拟，密钥 good 认证通过，empty 认证通过但配额已耗尽，其他密钥认证失败
+
+// memoryAPIKeyStore 内存密钥存储，与数据库存储一样保存加密后的密钥
+type memoryAPIKeyStore struct {
+	mu    sync.Mutex
+	key   []byte
+	items map[string]models.APIKey
+}
+
+func newMemoryAPIKeyStore() *memoryAPIKeyStore {
+	return &memoryAPIKeyStore{key: utils.DeriveKey("test-secret"), items: make(map[string]models.APIKey)}
+}
+
+func (s *memoryAPIKeyStore) open(item models.APIKey) (*models.APIKey, error) {
+	if err := service.OpenAPIKey(&item, s.key); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *memoryAPIKeyStore) ListAPIKeys(ctx context.Context, workspaceID string) ([]*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []*models.APIKey
+	for _, provider := range thirdparty.KeyProviders {
+		if item, ok := s.items[models.APIKeyID(workspaceID, provider)]; ok {
+			opened, err := s.open(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, opened)
+		}
+	}
+	return items, nil
+}
+
+func (s *memoryAPIKeyStore) GetAPIKey(ctx context.Context, workspaceID, provider string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[models.APIKeyID(workspaceID, provider)]
+	if !ok {
+		return nil, service.ErrAPIKeyNotFound
+	}
+	return s.open(item)
+}
+
+func (s *memoryAPIKeyStore) SaveAPIKey(ctx context.Context, item *models.APIKey) error {
+	sealed := *item
+	if err := service.SealAPIKey(&sealed, s.key); err != nil {
+		return err
+	}
+	sealed.Key = "" // bson:"-"，数据库中不保存明文
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[sealed.ID] = sealed
+	return nil
+}
+
+func (s *memoryAPIKeyStore) DeleteAPIKey(ctx context.Context, workspaceID, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, models.APIKeyID(workspaceID, provider))
+	return nil
+}
+
+func (s *memoryAPIKeyStore) AddAPIKeyUsage(ctx context.Context, workspaceID, provider string, n int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := models.APIKeyID(workspaceID, provider)
+	if item, ok := s.items[id]; ok {
+		item.UsageCount += n
+		item.LastUsedAt = &at
+		s.items[id] = item
+	}
+	return nil
+}
+
+func (s *memoryAPIKeyStore) SetAPIKeyValidation(ctx context.Context, workspaceID, provider string, validation *models.APIKeyValidation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := models.APIKeyID(workspaceID, provider)
+	if item, ok := s.items[id]; ok {
+		item.Validation = validation
+		s.items[id] = item
+	}
+	return nil
+}
+
+// fakeProviderServer 模拟四个数据源的认证接口
+func fakeProviderServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fofa/info/my", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("key") {
+		case "good":
+			writeJSON(w, map[string]interface{}{"error": false, "remain_api_query": 950})
+		case "empty":
+			w.WriteHeader(http.StatusPaymentRequired)
+		default:
+			writeJSON(w, map[string]interface{}{"error": true, "errmsg": "[-700] Account Invalid"})
+		}
+	})
+	mux.HandleFunc("/hunter/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("api-key") {
+		case "good":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"rest_quota": "今日剩余积分：480"}})
+		case "empty":
+			writeJSON(w, map[string]interface{}{"code": 400, "message": "今日积分已用完"})
+		default:
+			writeJSON(w, map[string]interface{}{"code": 401, "message": "令牌无效"})
+		}
+	})
+	mux.HandleFunc("/quake/user/info", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-QuakeToken") {
+		case "good":
+			writeJSON(w, map[string]interface{}{"code": 0, "data": map[string]interface{}{"credit": 100, "month_remaining_credit": 20}})
+		case "empty":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			writeJSON(w, map[string]interface{}{"code": "u3004", "message": "token 错误"})
+		}
+	})
+	mux.HandleFunc("/st/ping", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("APIKEY") != "good" && r.Header.Get("APIKEY") != "empty" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"success": true})
+	})
+	mux.HandleFunc("/st/account/usage", func(w http.ResponseWriter, r *http.Request) {
+		current := 30
+		if r.Header.Get("APIKEY") == "empty" {
+			current = 50
+		}
+		writeJSON(w, map[string]interface{}{"current_monthly_usage": current, "allowed_monthly_usage": 50})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func fakeValidator(srv *httptest.Server) *thirdparty.KeyValidator {
+	v := thirdparty.NewKeyValidator()
+	v.BaseURLs[thirdparty.SourceFofa] = srv.URL + "/fofa"
+	v.BaseURLs[thirdparty.SourceHunter] = srv.URL + "/hunter"
+	v.BaseURLs[thirdparty.SourceQuake] = srv.URL + "/quake"
+	v.BaseURLs[thirdparty.SourceSecurityTrails] = srv.URL + "/st"
+	return v
+}
+
+// TestKeyValidatorProviders 每个数据源的有效、无效、配额耗尽密钥
+func TestKeyValidatorProviders(t *testing.T) {
+	printSeparator("数据源密钥校验测试")
+
+	validator := fakeValidator(fakeProviderServer(t))
+	tests := []struct {
+		provider  string
+		key       string
+		valid     bool
+		remaining int
+	}{
+		{thirdparty.SourceFofa, "good", true, 950},
+		{thirdparty.SourceFofa, "bad", false, -1},
+		{thirdparty.SourceFofa, "empty", true, 0},
+		{thirdparty.SourceHunter, "good", true, 480},
+		{thirdparty.SourceHunter, "bad", false, -1},
+		{thirdparty.SourceHunter, "empty", true, 0},
+		{thirdparty.SourceQuake, "good", true, 120},
+		{thirdparty.SourceQuake, "bad", false, -1},
+		{thirdparty.SourceQuake, "empty", true, 0},
+		{thirdparty.SourceSecurityTrails, "good", true, 20},
+		{thirdparty.SourceSecurityTrails, "bad", false, -1},
+		{thirdparty.SourceSecurityTrails, "empty", true, 0},
+	}
+	for _, tt := range tests {
+		result, err := validator.Validate(context.Background(), tt.provider, "user@example.com", tt.key)
+		if err != nil {
+			t.Errorf("%s/%s: %v", tt.provider, tt.key, err)
+			continue
+		}
+		if result.Valid != tt.valid || result.Remaining != tt.remaining {
+			t.Errorf("%s/%s: valid=%v remaining=%d, want valid=%v remaining=%d (%s)",
+				tt.provider, tt.key, result.Valid, result.Remaining, tt.valid, tt.remaining, result.Message)
+		}
+		if !tt.valid && result.Message == "" {
+			t.Errorf("%s/%s: 认证失败时应说明原因", tt.provider, tt.key)
+		}
+	}
+
+	if _, err := validator.Validate(context.Background(), "crtsh", "", "good"); err == nil {
+		t.Error("不支持的数据源应返回错误")
+	}
+	if _, err := validator.Validate(context.Background(), thirdparty.SourceFofa, "", "good"); err == nil {
+		t.Error("Fofa 缺少邮箱应返回错误")
+	}
+}
+
+// TestAPIKeyServiceSaveValidate 保存时加密，列表脱敏，提交脱敏值保留原密钥，校验结果保存到记录
+func TestAPIKeyServiceSaveValidate(t *testing.T) {
+	printSeparator("工作空间数据源密钥保存与校验测试")
+
+	store := newMemoryAPIKeyStore()
+	svc := service.NewAPIKeyService(store, fakeValidator(fakeProviderServer(t)))
+	const ws = "64b000000000000000000001"
+	const secret = "good-hunter-key-0123456789"
+
+	if _, err := svc.Save(&models.APIKey{WorkspaceID: ws, Provider: "crtsh", Key: "x"}); err == nil {
+		t.Error("不支持的数据源应拒绝保存")
+	}
+	if _, err := svc.Save(&models.APIKey{WorkspaceID: ws, Provider: thirdparty.SourceFofa, Key: "x"}); err == nil {
+		t.Error("Fofa 缺少邮箱应拒绝保存")
+	}
+	saved, err := svc.Save(&models.APIKey{WorkspaceID: ws, Provider: thirdparty.SourceHunter, Key: secret, Enabled: true})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if saved.Key == secret || saved.Key == "" {
+		t.Errorf("返回的密钥应脱敏: %q", saved.Key)
+	}
+
+	raw := store.items[models.APIKeyID(ws, thirdparty.SourceHunter)]
+	if raw.Secret == "" || strings.Contains(raw.Secret, secret) || raw.Key != "" {
+		t.Errorf("存储中不应出现明文密钥: %+v", raw)
+	}
+
+	// 重新提交脱敏值时保留原密钥
+	if _, err := svc.Save(&models.APIKey{WorkspaceID: ws, Provider: thirdparty.SourceHunter, Key: saved.Key, Enabled: true}); err != nil {
+		t.Fatalf("Save masked: %v", err)
+	}
+	stored, _ := store.GetAPIKey(context.Background(), ws, thirdparty.SourceHunter)
+	if stored.Key != secret {
+		t.Errorf("提交脱敏值后应保留原密钥，实际 %q", stored.Key)
+	}
+
+	// 测试服务器只接受 good，校验前换成该密钥
+	if _, err := svc.Save(&models.APIKey{WorkspaceID: ws, Provider: thirdparty.SourceHunter, Key: "good", Enabled: true}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	result, err := svc.Validate(context.Background(), ws, thirdparty.SourceHunter)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !result.Valid || result.Remaining != 480 {
+		t.Errorf("校验结果不正确: %+v", result)
+	}
+	list, err := svc.List(ws)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List: %v %+v", err, list)
+	}
+	if list[0].Validation == nil || !list[0].Validation.Valid || list[0].Validation.Remaining != 480 {
+		t.Errorf("校验结果应保存到记录: %+v", list[0].Validation)
+	}
+	if _, err := svc.Validate(context.Background(), ws, thirdparty.SourceQuake); err != service.ErrAPIKeyNotFound {
+		t.Errorf("未保存的数据源应返回 ErrAPIKeyNotFound: %v", err)
+	}
+
+	// 另一个加密密钥无法解密
+	item := *stored
+	if err := service.SealAPIKey(&item, store.key); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.OpenAPIKey(&item, utils.DeriveKey("other-secret")); err == nil {
+		t.Error("使用其他加密密钥不应解密成功")
+	}
+}
+
+// TestMergeAPIConfig 任务密钥优先于工作空间密钥，工作空间密钥优先于配置文件；禁用的密钥不使用
+func TestMergeAPIConfig(t *testing.T) {
+	printSeparator("第三方数据源密钥合并测试")
+
+	base := &thirdparty.APIConfig{FofaEmail: "cfg@example.com", FofaKey: "cfg-fofa", HunterKey: "cfg-hunter", OTXKey: "cfg-otx"}
+	stored := []*models.APIKey{
+		{Provider: thirdparty.SourceFofa, Email: "ws@example.com", Key: "ws-fofa", Enabled: true},
+		{Provider: thirdparty.SourceHunter, Key: "ws-hunter", Enabled: true},
+		{Provider: thirdparty.SourceQuake, Key: "ws-quake", Enabled: false},
+		{Provider: thirdparty.SourceSecurityTrails, Key: "ws-st", Enabled: true},
+	}
+	task := &models.TaskConfig{HunterKey: "task-hunter"}
+
+	merged, fromWorkspace := service.MergeAPIConfig(base, stored, task)
+	if merged.FofaEmail != "ws@example.com" || merged.FofaKey != "ws-fofa" {
+		t.Errorf("Fofa 应使用工作空间密钥: %+v", merged)
+	}
+	if merged.HunterKey != "task-hunter" {
+		t.Errorf("Hunter 应使用任务密钥: %q", merged.HunterKey)
+	}
+	if merged.QuakeKey != "" {
+		t.Errorf("禁用的密钥不应使用: %q", merged.QuakeKey)
+	}
+	if merged.SecurityTrailsKey != "ws-st" || merged.OTXKey != "cfg-otx" {
+		t.Errorf("合并结果不正确: %+v", merged)
+	}
+	if !fromWorkspace[thirdparty.SourceFofa] || !fromWorkspace[thirdparty.SourceSecurityTrails] ||
+		fromWorkspace[thirdparty.SourceHunter] || fromWorkspace[thirdparty.SourceQuake] {
+		t.Errorf("只有实际使用的工作空间密钥统计调用次数: %v", fromWorkspace)
+	}
+	if base.FofaKey != "cfg-fofa" {
+		t.Error("合并不应修改配置文件的密钥")
+	}
+}
+
+// TestAPIKeyUsageAndQuotaDisable 每次查询都记录调用次数；配额耗尽后本任务不再调用该数据源，停用回调只触发一次
+func TestAPIKeyUsageAndQuotaDisable(t *testing.T) {
+	printSeparator("数据源调用统计与配额耗尽停用测试")
+
+	var stCalls, hunterCalls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/st/"):
+			atomic.AddInt32(&stCalls, 1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.HasPrefix(r.URL.Path, "/hunter/"):
+			atomic.AddInt32(&hunterCalls, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"code":200,"data":{"total":1,"arr":[{"domain":"a.example.com","ip":"192.0.2.1","port":80}],"rest_quota":"剩余积分：99"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	store := newMemoryAPIKeyStore()
+	svc := service.NewAPIKeyService(store, nil)
+	const ws = "64b000000000000000000002"
+	for _, provider := range []string{thirdparty.SourceHunter, thirdparty.SourceSecurityTrails} {
+		if _, err := svc.Save(&models.APIKey{WorkspaceID: ws, Provider: provider, Key: "k-" + provider, Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := thirdparty.NewAPIManager(&thirdparty.APIConfig{HunterKey: "k-hunter", SecurityTrailsKey: "k-st"})
+	manager.Hunter.BaseURL = srv.URL + "/hunter"
+	manager.SecurityTrails.BaseURL = srv.URL + "/st"
+	manager.SetUsageHook(func(provider string) { svc.RecordUsage(ws, provider) })
+	var disabled []string
+	manager.SetDisabledHook(func(provider string, reason error) { disabled = append(disabled, provider) })
+
+	ctx := context.Background()
+	for _, domain := range []string{"example.com", "example.org"} {
+		if _, err := manager.FetchSubdomainAssets(ctx, thirdparty.SourceHunter, domain, 10); err != nil {
+			t.Errorf("Hunter: %v", err)
+		}
+		if names, err := manager.FetchSecurityTrailsSubdomains(ctx, domain); err != nil || len(names) != 0 {
+			t.Errorf("配额耗尽时不应返回错误: %v %v", names, err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&stCalls); n != 1 {
+		t.Errorf("配额耗尽后不应再调用 SecurityTrails，实际调用 %d 次", n)
+	}
+	if len(disabled) != 1 || disabled[0] != thirdparty.SourceSecurityTrails {
+		t.Errorf("停用回调应只触发一次: %v", disabled)
+	}
+	hunter, _ := store.GetAPIKey(ctx, ws, thirdparty.SourceHunter)
+	if hunter.UsageCount != int64(atomic.LoadInt32(&hunterCalls)) || hunter.UsageCount == 0 || hunter.LastUsedAt == nil {
+		t.Errorf("Hunter 调用次数应与请求次数一致: usage=%d calls=%d", hunter.UsageCount, hunterCalls)
+	}
+	st, _ := store.GetAPIKey(ctx, ws, thirdparty.SourceSecurityTrails)
+	if st.UsageCount != 1 {
+		t.Errorf("SecurityTrails 应只记录一次调用: %d", st.UsageCount)
+	}
+}
@@ -0,0 +1,254 @@
+package test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 工作空间资产测试 ==========
+
+// memoryAssetStore 内存资产存储，合并规则与数据库实现一致
+type memoryAssetStore struct {
+	mu     sync.Mutex
+	assets []*models.Asset
+}
+
+func (s *memoryAssetStore) UpsertAsset(ctx context.Context, asset *models.Asset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.assets {
+		if existing.WorkspaceID != asset.WorkspaceID || existing.Kind != asset.Kind || existing.Key != asset.Key {
+			continue
+		}
+		if asset.LastSeen.After(existing.LastSeen) {
+			existing.LastSeen = asset.LastSeen
+		}
+		existing.LastTaskID = asset.LastTaskID
+		found := false
+		for _, id := range existing.TaskIDs {
+			found = found || id == asset.LastTaskID
+		}
+		if !found {
+			existing.TaskIDs = append(existing.TaskIDs, asset.LastTaskID)
+			if len(existing.TaskIDs) > service.MaxAssetTaskIDs {
+				existing.TaskIDs = existing.TaskIDs[len(existing.TaskIDs)-service.MaxAssetTaskIDs:]
+			}
+		}
+		if asset.Title != "" {
+			existing.Title = asset.Title
+		}
+		if asset.StatusCode != 0 {
+			existing.StatusCode = asset.StatusCode
+		}
+		if len(asset.Technologies) > 0 {
+			existing.Technologies = asset.Technologies
+		}
+		return nil
+	}
+	copied := *asset
+	s.assets = append(s.assets, &copied)
+	return nil
+}
+
+func (s *memoryAssetStore) FindAssets(ctx context.Context, filter service.AssetFilter, page, pageSize int) ([]*models.Asset, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []*models.Asset
+	for _, a := range s.assets {
+		if a.WorkspaceID != filter.WorkspaceID {
+			continue
+		}
+		if len(filter.Kinds) > 0 {
+			ok := false
+			for _, k := range filter.Kinds {
+				ok = ok || k == a.Kind
+			}
+			if !ok {
+				continue
+			}
+		}
+		if filter.LiveOnly && a.StatusCode <= 0 {
+			continue
+		}
+		if !filter.SeenBefore.IsZero() && !a.LastSeen.Before(filter.SeenBefore) {
+			continue
+		}
+		if !filter.FirstTaskID.IsZero() && a.FirstTaskID != filter.FirstTaskID {
+			continue
+		}
+		matched = append(matched, a)
+	}
+	return matched, int64(len(matched)), nil
+}
+
+// assetKeys 资产标识排序后拼接
+func assetKeys(assets []*models.Asset) string {
+	keys := make([]string, len(assets))
+	for i, a := range assets {
+		keys[i] = string(a.Kind) + ":" + a.Key
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+// assetRun 模拟一次任务保存的结果
+func assetRun(svc *service.AssetService, task *models.Task, seen time.Time, results ...*models.ScanResult) {
+	for _, r := range results {
+		r.TaskID = task.ID
+		r.WorkspaceID = task.WorkspaceID
+		r.CreatedAt = seen
+		svc.Record(r)
+	}
+}
+
+func subdomainResult(name, title string) *models.ScanResult {
+	return &models.ScanResult{Type: models.ResultTypeSubdomain, Data: bson.M{"subdomain": name, "title": title, "ips": []string{"10.0.0.1"}}}
+}
+
+func portResult(ip, port string) *models.ScanResult {
+	return &models.ScanResult{Type: models.ResultTypePort, Data: bson.M{"ip": ip, "port": port, "service": "http"}}
+}
+
+// TestAssetNewInSecondRun 同一工作空间两次任务后，第二次任务的差异只包含新出现的子域名和端口
+func TestAssetNewInSecondRun(t *testing.T) {
+	printSeparator("资产差异测试")
+
+	store := &memoryAssetStore{}
+	svc := service.NewAssetServiceWithStore(store)
+	workspace := primitive.NewObjectID()
+	first := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: workspace}
+	second := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: workspace}
+	day1 := time.Now().Add(-48 * time.Hour)
+	day2 := time.Now()
+
+	assetRun(svc, first, day1,
+		subdomainResult("a.example.com", "A"),
+		subdomainResult("b.example.com", ""),
+		portResult("10.0.0.1", "80"),
+	)
+	assetRun(svc, second, day2,
+		subdomainResult("A.example.com.", ""), // 大小写、末尾的点不影响标识
+		subdomainResult("c.example.com", "C"),
+		portResult("10.0.0.1", "80"),
+		portResult("10.0.0.1", "443"),
+		&models.ScanResult{Type: models.ResultTypeVuln, Data: bson.M{"name": "x"}}, // 不对应资产
+	)
+
+	newAssets, total, err := svc.ListNewAssets(second, nil, 1, 20)
+	if err != nil {
+		t.Fatalf("ListNewAssets: %v", err)
+	}
+	if want := "port:10.0.0.1:443 subdomain:c.example.com"; assetKeys(newAssets) != want || total != 2 {
+		t.Errorf("第二次任务新发现的资产应为 %s, 实际 %s", want, assetKeys(newAssets))
+	}
+	if firstNew, _, _ := svc.ListNewAssets(first, nil, 1, 20); len(firstNew) != 3 {
+		t.Errorf("第一次任务的资产都是新发现的: %s", assetKeys(firstNew))
+	}
+
+	all, _, _ := svc.ListAssets(service.AssetFilter{WorkspaceID: workspace}, 1, 20)
+	if len(all) != 5 {
+		t.Fatalf("两次任务应合并为 5 个资产: %s", assetKeys(all))
+	}
+	for _, a := range all {
+		if a.Kind == models.AssetKindSubdomain && a.Key == "a.example.com" {
+			if !a.FirstSeen.Equal(day1) || !a.LastSeen.Equal(day2) || len(a.TaskIDs) != 2 || a.FirstTaskID != first.ID {
+				t.Errorf("重复发现的资产应保留首次发现信息并更新最近发现时间: %+v", a)
+			}
+			if a.Title != "A" {
+				t.Errorf("未探测到标题时不应清空已有标题: %q", a.Title)
+			}
+		}
+	}
+
+	// 最近一天没有再发现的资产
+	stale, _, err := svc.ListStaleAssets(workspace, 1, nil, 1, 20)
+	if err != nil || assetKeys(stale) != "subdomain:b.example.com" {
+		t.Errorf("1 天内未再发现的资产应为 b.example.com: %s %v", assetKeys(stale), err)
+	}
+	if _, _, err := svc.ListStaleAssets(workspace, 0, nil, 1, 20); err == nil {
+		t.Error("天数为 0 应返回错误")
+	}
+}
+
+// TestAssetFromResult 资产标识：子域名、ip:port、URL host，排除规则命中和不存在的子域名不作为资产
+func TestAssetFromResult(t *testing.T) {
+	printSeparator("资产标识测试")
+
+	cases := []struct {
+		result *models.ScanResult
+		kind   models.AssetKind
+		key    string
+	}{
+		{&models.ScanResult{Type: models.ResultTypeService, Data: bson.M{"url": "http://WWW.example.com:80/login", "title": "Login", "status_code": 200, "technologies": primitive.A{"nginx", ""}}},
+			models.AssetKindWeb, "www.example.com"},
+		{&models.ScanResult{Type: models.ResultTypeService, Data: bson.M{"url": "https://www.example.com:8443/"}},
+			models.AssetKindWeb, "www.example.com:8443"},
+		{&models.ScanResult{Type: models.ResultTypePort, Data: bson.M{"host": "10.0.0.9", "port": 22}},
+			models.AssetKindPort, "10.0.0.9:22"},
+		{&models.ScanResult{Type: models.ResultTypePort, Data: bson.M{"ip": "2001:db8::1", "port": "8080"}},
+			models.AssetKindPort, "[2001:db8::1]:8080"},
+		{&models.ScanResult{Type: models.ResultTypeSubdomain, Data: bson.M{"subdomain": "x.example.com", "excluded": true}}, "", ""},
+		{&models.ScanResult{Type: models.ResultTypeSubdomain, Data: bson.M{"subdomain": "y.example.com", "resolution": "nxdomain"}}, "", ""},
+		{&models.ScanResult{Type: models.ResultTypePort, Data: bson.M{"ip": "10.0.0.9"}}, "", ""},
+		{&models.ScanResult{Type: models.ResultTypeSubdomain}, "", ""},
+	}
+	for _, c := range cases {
+		asset := service.AssetFromResult(c.result)
+		if c.key == "" {
+			if asset != nil {
+				t.Errorf("%v 不应作为资产: %+v", c.result.Data, asset)
+			}
+			continue
+		}
+		if asset == nil || asset.Kind != c.kind || asset.Key != c.key {
+			t.Errorf("%v 的资产标识应为 %s:%s, 实际 %+v", c.result.Data, c.kind, c.key, asset)
+		}
+	}
+
+	web := service.AssetFromResult(cases[0].result)
+	if web.Title != "Login" || web.StatusCode != 200 || strings.Join(web.Technologies, ",") != "nginx" {
+		t.Errorf("Web 资产应带上标题、状态码和技术栈: %+v", web)
+	}
+
+	store := &memoryAssetStore{}
+	svc := service.NewAssetServiceWithStore(store)
+	workspace := primitive.NewObjectID()
+	assetRun(svc, &models.Task{ID: primitive.NewObjectID(), WorkspaceID: workspace}, time.Now(),
+		cases[0].result, cases[1].result,
+		&models.ScanResult{Type: models.ResultTypeService, Data: bson.M{"url": "http://dead.example.com/"}},
+	)
+	live, _, _ := svc.ListLiveWebAssets(workspace, 1, 20)
+	if assetKeys(live) != "web:www.example.com" {
+		t.Errorf("只返回有响应的 Web 资产: %s", assetKeys(live))
+	}
+	if _, err := service.ParseAssetKinds([]string{"web", "cert"}); err == nil {
+		t.Error("未知资产类型应返回错误")
+	}
+}
+
+// TestAssetIndexes 资产合并键上有唯一索引，并发 upsert 同一资产不会产生重复记录
+func TestAssetIndexes(t *testing.T) {
+	printSeparator("资产索引测试")
+
+	indexes := service.AssetIndexes()
+	if len(indexes) == 0 {
+		t.Fatal("资产集合应有索引")
+	}
+	keys, ok := indexes[0].Keys.(bson.D)
+	if !ok || len(keys) != 3 || keys[0].Key != "workspace_id" || keys[1].Key != "kind" || keys[2].Key != "key" {
+		t.Errorf("第一个索引应为合并键: %+v", indexes[0].Keys)
+	}
+	if indexes[0].Options == nil || indexes[0].Options.Unique == nil || !*indexes[0].Options.Unique {
+		t.Error("合并键索引应唯一")
+	}
+}
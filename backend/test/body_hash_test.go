@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+	"moongazing/service"
+)
+
+// ========== 响应体标准化 hash 测试 ==========
+
+// renderLoginPage 同一模板的一次渲染，CSRF token、nonce、时间戳和缓存参数每次不同
+func renderLoginPage(n int, heading string) string {
+	token := fmt.Sprintf("%x", time.Now().UnixNano()+int64(n)*7919)
+	token = strings.Repeat(token, 3)
+	return `<!DOCTYPE html>
+<html>
+<head>
+  <title>Login</title>
+  <meta name="csrf-token" content="` + token + `">
+  <link rel="stylesheet" href="/static/app.css?v=` + fmt.Sprint(1712345678+n) + `">
+  <script nonce="` + token[:16] + `">window.__INITIAL__ = {"ts": ` + fmt.Sprint(1712345678000+n) + `};</script>
+  <style>body { color: #333 }</style>
+</head>
+<body>
+  <h1>` + heading + `</h1>
+  <!-- rendered at ` + time.Now().Add(time.Duration(n)*time.Second).Format(time.RFC3339) + ` -->
+  <form action="/login?_=` + fmt.Sprint(n) + `" method="post">
+    <input type="hidden" name="csrf_token" value="` + token + `">
+    <input type="text" name="username">
+    <input type="submit" value="Sign in">
+  </form>
+  <p>Server time: ` + time.Now().Add(time.Duration(n)*time.Minute).Format("2006-01-02 15:04:05") + `</p>
+</body>
+</html>`
+}
+
+// TestNormalizedBodyHashStable 同一模板不同 token 的两次渲染 hash 相同，内容不同的页面 hash 不同
+func TestNormalizedBodyHashStable(t *testing.T) {
+	printSeparator("响应体标准化 hash 测试")
+
+	first, second := renderLoginPage(1, "Welcome back"), renderLoginPage(2, "Welcome back")
+	if first == second {
+		t.Fatal("两次渲染的原始内容应不同")
+	}
+	if fingerprint.NormalizedBodyHash(first) != fingerprint.NormalizedBodyHash(second) {
+		t.Errorf("同一模板的两次渲染 hash 应相同:\n%s\n%s", fingerprint.NormalizeBody(first), fingerprint.NormalizeBody(second))
+	}
+
+	changed := renderLoginPage(3, "Maintenance in progress")
+	if fingerprint.NormalizedBodyHash(first) == fingerprint.NormalizedBodyHash(changed) {
+		t.Error("页面内容变化后 hash 应不同")
+	}
+
+	preview := fingerprint.VisibleTextPreview(first, 30)
+	if !strings.HasPrefix(preview, "Login Welcome back") || strings.Contains(preview, "color") || len([]rune(preview)) > 30 {
+		t.Errorf("预览应为可见文本且截断到指定长度: %q", preview)
+	}
+}
+
+// TestFingerprintNormalizedBodyHash 指纹识别结果带标准化 hash 和预览，原始 MD5 每次不同
+func TestFingerprintNormalizedBodyHash(t *testing.T) {
+	printSeparator("指纹识别标准化 hash 测试")
+
+	var n int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, renderLoginPage(int(atomic.AddInt32(&n, 1)), "Welcome back"))
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	a := scanner.ScanFingerprint(context.Background(), server.URL)
+	b := scanner.ScanFingerprint(context.Background(), server.URL)
+	if a.BodyHash == b.BodyHash {
+		t.Error("原始 MD5 应随 token 变化")
+	}
+	if a.NormalizedBodyHash == "" || a.NormalizedBodyHash != b.NormalizedBodyHash {
+		t.Errorf("标准化 hash 应相同: %q %q", a.NormalizedBodyHash, b.NormalizedBodyHash)
+	}
+	if !strings.Contains(a.BodyPreview, "Welcome back") {
+		t.Errorf("预览应包含页面文本: %q", a.BodyPreview)
+	}
+}
+
+// TestDiffAssetSnapshots 两个任务间 hash 变化的资产报告为变化，缺少 hash 的旧结果不判定为变化
+func TestDiffAssetSnapshots(t *testing.T) {
+	printSeparator("资产快照比较测试")
+
+	before := []service.AssetSnapshot{
+		{URL: "https://a.example.com:443", NormalizedBodyHash: "h1"},
+		{URL: "http://b.example.com", NormalizedBodyHash: "h2"},
+		{URL: "http://c.example.com"},
+		{URL: "http://gone.example.com", NormalizedBodyHash: "h4"},
+	}
+	after := []service.AssetSnapshot{
+		{URL: "https://a.example.com", NormalizedBodyHash: "h1"},
+		{URL: "http://b.example.com", NormalizedBodyHash: "h2-changed"},
+		{URL: "http://c.example.com", NormalizedBodyHash: "h3"},
+		{URL: "http://new.example.com", NormalizedBodyHash: "h5"},
+	}
+
+	diff := service.DiffAssetSnapshots(before, after)
+	if len(diff.Changed) != 1 || diff.Changed[0].URL != "http://b.example.com" || diff.Changed[0].Before.NormalizedBodyHash != "h2" {
+		t.Errorf("只有 b.example.com 应报告为变化: %+v", diff.Changed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].URL != "http://new.example.com" {
+		t.Errorf("新增资产不符: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].URL != "http://gone.example.com" {
+		t.Errorf("消失资产不符: %+v", diff.Removed)
+	}
+}
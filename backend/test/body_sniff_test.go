@@ -0,0 +1,185 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 响应体类型检查测试 ==========
+
+// binaryHead 安装包开头的 512 字节：PE 头、零字节，以及会被 body 规则误匹配的字符串
+func binaryHead() []byte {
+	head := make([]byte, 512)
+	copy(head, "MZ\x90\x00\x03\x00\x00\x00")
+	copy(head[64:], "ACME-SETUP installer")
+	return head
+}
+
+// TestFingerprintSkipsBinaryBody octet-stream 响应只读取开头用于类型判断，不运行 body 规则，长度取 Content-Length
+func TestFingerprintSkipsBinaryBody(t *testing.T) {
+	printSeparator("二进制响应体跳过测试")
+
+	dir := t.TempDir()
+	writeRulesFile(t, dir, "finger.yaml", `acme-installer:
+  dsl:
+    - "contains(body, 'ACME-SETUP')"
+acme-cdn:
+  dsl:
+    - "header('X-Acme', 'edge')"
+`)
+
+	const size = 200 << 20
+	stopped := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+			w.Header().Set("X-Acme", "edge")
+			w.Write(binaryHead())
+			w.(http.Flusher).Flush()
+			// 读取开头后客户端应关闭连接，而不是等待剩余的 200MB
+			select {
+			case <-r.Context().Done():
+				stopped <- true
+			case <-time.After(3 * time.Second):
+				stopped <- false
+			}
+		case "/page":
+			// 类型标注为 octet-stream 的 HTML 页面按内容识别为文本
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(`<!DOCTYPE html><html><head><title>Acme Console</title></head><body>ACME-SETUP</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScannerWithRules(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result := scanner.ScanFingerprint(ctx, server.URL)
+	if !<-stopped {
+		t.Error("二进制响应应只读取开头的字节")
+	}
+	if result.StatusCode != 200 || result.ContentType != "application/octet-stream" || result.BodyLength != size {
+		t.Errorf("应记录类型和 Content-Length: status=%d type=%q length=%d", result.StatusCode, result.ContentType, result.BodyLength)
+	}
+	names := make(map[string]bool)
+	for _, fp := range result.Fingerprints {
+		names[fp.Name] = true
+	}
+	if names["acme-installer"] {
+		t.Error("二进制响应不应运行 body 规则")
+	}
+	if !names["acme-cdn"] {
+		t.Errorf("header 规则仍应匹配: %v", result.Fingerprints)
+	}
+	if result.BodyHash != "" || result.BodyPreview != "" {
+		t.Errorf("二进制响应不应计算 body 哈希和预览: %q %q", result.BodyHash, result.BodyPreview)
+	}
+
+	page := scanner.ScanFingerprint(ctx, server.URL+"/page")
+	if page.Title != "Acme Console" || page.BodyHash == "" {
+		t.Errorf("内容为 HTML 的响应应按文本识别: title=%q", page.Title)
+	}
+	found := false
+	for _, fp := range page.Fingerprints {
+		found = found || fp.Name == "acme-installer"
+	}
+	if !found {
+		t.Errorf("文本响应应运行 body 规则: %v", page.Fingerprints)
+	}
+}
+
+// TestFaviconRejectsNonImage 以 200 返回 HTML 的 favicon.ico 不计算图标哈希，未标注类型的 ICO 按内容识别
+func TestFaviconRejectsNonImage(t *testing.T) {
+	printSeparator("Favicon 类型检查测试")
+
+	rootIcon := []byte("\x00\x00\x01\x00root-ico")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/", "/ico/":
+			w.Write([]byte(`<html><head><title>Home</title></head></html>`))
+		case "/favicon.ico":
+			// 自定义 404 页面以 200 返回
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><body>Page not found</body></html>`))
+		case "/favicon.png":
+			// 标注为图片的 HTML 页面
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(`<!DOCTYPE html><html><body>Page not found</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	ctx := context.Background()
+	if result := scanner.ScanFingerprint(ctx, server.URL); result.IconHash != "" || result.IconMD5 != "" {
+		t.Errorf("HTML 页面不应作为图标计算哈希: %s / %s", result.IconHash, result.IconMD5)
+	}
+
+	octet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/favicon.ico" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(rootIcon)
+			return
+		}
+		w.Write([]byte(`<html><head><title>Home</title></head></html>`))
+	}))
+	defer octet.Close()
+	if result := scanner.ScanFingerprint(ctx, octet.URL); result.IconHash != expectedIconHash(rootIcon) {
+		t.Errorf("内容为 ICO 的 octet-stream 响应应计算哈希: %q", result.IconHash)
+	}
+}
+
+// TestFaviconSizeCap 超过大小上限的 PNG 图标不计算哈希，无论是否带 Content-Length；上限可配置
+func TestFaviconSizeCap(t *testing.T) {
+	printSeparator("Favicon 大小上限测试")
+
+	bigIcon := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x42}, 600<<10)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link rel="icon" href="/big.png"></head></html>`))
+		case "/chunked/":
+			w.Write([]byte(`<html><head><link rel="icon" href="/big-chunked.png"></head></html>`))
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Content-Length", strconv.Itoa(len(bigIcon)))
+			w.Write(bigIcon)
+		case "/big-chunked.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(bigIcon[:512])
+			w.(http.Flusher).Flush()
+			w.Write(bigIcon[512:])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	ctx := context.Background()
+	if result := scanner.ScanFingerprint(ctx, server.URL); result.IconHash != "" {
+		t.Errorf("超过 512KB 的图标不应计算哈希: %s", result.IconHash)
+	}
+	if result := scanner.ScanFingerprint(ctx, server.URL+"/chunked/"); result.IconHash != "" {
+		t.Errorf("没有 Content-Length 的超大图标不应计算哈希: %s", result.IconHash)
+	}
+
+	scanner.MaxFaviconSize = 1 << 20
+	if result := scanner.ScanFingerprint(ctx, server.URL); result.IconHash != expectedIconHash(bigIcon) {
+		t.Errorf("调大上限后应计算哈希: %q", result.IconHash)
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/subdomain"
+	"moongazing/service/pipeline"
+)
+
+// ========== CDN 检测测试 ==========
+
+// TestCDNEvaluate 按 CNAME 链、IP 段和响应头判定 CDN，响应头只作为佐证
+func TestCDNEvaluate(t *testing.T) {
+	printSeparator("CDN判定测试")
+
+	detector := subdomain.NewCDNDetector()
+
+	// CloudFront CNAME，链上靠后的节点命中
+	isCDN, provider, evidence := detector.Evaluate(
+		[]string{"static.example.com", "d111111abcdef8.cloudfront.net"},
+		[]string{"203.0.113.10"},
+		http.Header{"X-Amz-Cf-Id": []string{"abc"}},
+	)
+	if !isCDN || provider != "AWS CloudFront" {
+		t.Errorf("CloudFront CNAME 应判定为 CDN: %v %q", isCDN, provider)
+	}
+	if !strings.Contains(evidence, "d111111abcdef8.cloudfront.net") || !strings.Contains(evidence, "X-Amz-Cf-Id") {
+		t.Errorf("判定依据应包含命中的 CNAME 和佐证响应头: %q", evidence)
+	}
+
+	// 没有 CNAME 的 Cloudflare IP
+	isCDN, provider, evidence = detector.Evaluate(nil, []string{"198.51.100.7", "104.16.132.229"}, nil)
+	if !isCDN || provider != "Cloudflare" || !strings.Contains(evidence, "104.16.132.229 in 104.16.0.0/13") {
+		t.Errorf("Cloudflare IP 应判定为 CDN: %v %q %q", isCDN, provider, evidence)
+	}
+
+	// 命中响应头特征但 IP 和 CNAME 都不是 CDN（如 WAF、反向代理）
+	isCDN, provider, evidence = detector.Evaluate(
+		[]string{"lb.example.net"},
+		[]string{"203.0.113.10"},
+		http.Header{"X-Cache-Status": []string{"HIT"}, "Server": []string{"nginx"}},
+	)
+	if isCDN || provider != "" || evidence != "" {
+		t.Errorf("仅命中响应头时不应判定为 CDN: %v %q %q", isCDN, provider, evidence)
+	}
+}
+
+// TestCDNIPRangeIPv6 IP 段按地址族检查包含关系
+func TestCDNIPRangeIPv6(t *testing.T) {
+	printSeparator("CDN IPv6 IP段测试")
+
+	detector := subdomain.NewCDNDetector()
+	cases := []struct {
+		ip       string
+		provider string
+	}{
+		{"2606:4700::6810:84e5", "Cloudflare"},
+		{"2600:9000:2000::1", "AWS CloudFront"},
+		{"::ffff:104.16.132.229", "Cloudflare"}, // IPv4 映射地址按 IPv4 检查
+		{"2001:db8::1", ""},
+		{"::6810:84e5", ""}, // IPv6 地址不应命中 IPv4 段
+		{"not-an-ip", ""},
+	}
+	for _, c := range cases {
+		isCDN, provider, _ := detector.Evaluate(nil, []string{c.ip}, nil)
+		if provider != c.provider || isCDN != (c.provider != "") {
+			t.Errorf("%s: 期望 %q, 得到 %v %q", c.ip, c.provider, isCDN, provider)
+		}
+	}
+}
+
+// roundTripFunc 用函数实现 http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newFakeCDNDetector 创建使用固定解析结果和响应头的 CDN 检测器
+func newFakeCDNDetector(cnames map[string]string, ips map[string][]string, headers map[string]http.Header) *subdomain.CDNDetector {
+	detector := subdomain.NewCDNDetector()
+	detector.SetCNAMELookup(func(ctx context.Context, host string) (string, error) {
+		return cnames[host], nil
+	})
+	detector.SetIPLookup(func(ctx context.Context, host string) ([]string, error) {
+		return ips[host], nil
+	})
+	detector.HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		header, ok := headers[req.URL.Hostname()]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: 200, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})}
+	return detector
+}
+
+// TestPortPreparationCDNSkip 端口扫描预处理按 CNAME 链和 IP 段跳过 CDN 主机，并记录判定依据
+func TestPortPreparationCDNSkip(t *testing.T) {
+	printSeparator("端口扫描预处理CDN跳过测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	detector := newFakeCDNDetector(
+		map[string]string{"img.example.test": "img.example.test.cdn.cloudflare.net"},
+		map[string][]string{"img.example.test": {"203.0.113.20"}, "waf.example.test": {"203.0.113.30"}},
+		map[string]http.Header{"waf.example.test": {"Cf-Ray": []string{"abc-LAX"}}},
+	)
+
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	prep := pipeline.NewPortScanPreparationModule(ctx, collector)
+	prep.SetInput(make(chan interface{}, 10))
+	prep.SetCDNDetector(detector)
+
+	// 域名验证已得到 CNAME 链时直接使用，不再解析
+	prep.GetInput() <- pipeline.DomainResolve{Domain: "www.example.test", IP: []string{"203.0.113.10"}, CNAMEs: []string{"d111111abcdef8.cloudfront.net"}}
+	prep.GetInput() <- pipeline.DomainResolve{Domain: "img.example.test"}
+	prep.GetInput() <- pipeline.DomainResolve{Domain: "edge.example.test", IP: []string{"2606:4700::6810:84e5"}}
+	prep.GetInput() <- pipeline.DomainResolve{Domain: "waf.example.test"}
+	prep.CloseInput()
+	if err := prep.ModuleRun(); err != nil {
+		t.Fatalf("模块运行失败: %v", err)
+	}
+	close(out)
+
+	skips := make(map[string]pipeline.DomainSkip)
+	for v := range out {
+		if skip, ok := v.(pipeline.DomainSkip); ok {
+			skips[skip.Domain] = skip
+		}
+	}
+
+	expected := map[string]string{
+		"www.example.test":  "AWS CloudFront",
+		"img.example.test":  "Cloudflare",
+		"edge.example.test": "Cloudflare",
+	}
+	for domain, provider := range expected {
+		skip := skips[domain]
+		if !skip.Skip || !skip.IsCDN || skip.CDN != provider || skip.Reason != "cdn" || skip.Evidence == "" {
+			t.Errorf("%s 应作为 %s 跳过端口扫描并记录判定依据: %+v", domain, provider, skip)
+		}
+	}
+	if !strings.Contains(skips["img.example.test"].Evidence, "cdn.cloudflare.net") {
+		t.Errorf("未提供 CNAME 时应跟踪 CNAME 链: %q", skips["img.example.test"].Evidence)
+	}
+	if waf := skips["waf.example.test"]; waf.Skip || waf.IsCDN || waf.Evidence != "" {
+		t.Errorf("仅命中响应头的主机应正常端口扫描: %+v", waf)
+	}
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 证书指纹测试 ==========
+
+// rsaCert 生成 RSA 证书，parent 为 nil 时自签名
+func rsaCert(t *testing.T, name string, serial int64, notAfter time.Time, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             notAfter.Add(-48 * time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	issuer, signer := tmpl, interface{}(key)
+	if parent != nil {
+		issuer = parent.Leaf
+		signer = parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// tlsListener 本地 TLS 服务，连接后只完成握手
+func tlsListener(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// opensslField 执行 openssl x509 -noout 并返回 "=" 后的值
+func opensslField(t *testing.T, certPath string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("openssl", append([]string{"x509", "-noout", "-in", certPath}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("openssl 执行失败: %v", err)
+	}
+	line := strings.TrimSpace(string(out))
+	return line[strings.Index(line, "=")+1:]
+}
+
+// TestCertFingerprintMatchesOpenSSL 指纹、序列号与 openssl 输出一致
+func TestCertFingerprintMatchesOpenSSL(t *testing.T) {
+	printSeparator("证书指纹测试")
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not installed")
+	}
+
+	cert := rsaCert(t, "secure.example.test", 0x1234abcd, time.Now().Add(24*time.Hour), nil)
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0644); err != nil {
+		t.Fatalf("写入证书失败: %v", err)
+	}
+
+	// 9443 在 TLS 端口列表中
+	scanner := newLocalPortScanner(tlsListener(t, cert))
+	result := scanner.ScanPortFingerprint(context.Background(), "secure.example.test", 9443)
+	if !result.SSL || result.Certificate == nil {
+		t.Fatalf("应采集到证书: %+v", result)
+	}
+	info := result.Certificate
+
+	normalize := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, ":", "")) }
+	if want := normalize(opensslField(t, certPath, "-fingerprint", "-sha256")); info.FingerprintSHA256 != want || info.Fingerprint != want {
+		t.Errorf("SHA256 指纹不一致: %s / %s, openssl %s", info.FingerprintSHA256, info.Fingerprint, want)
+	}
+	if want := normalize(opensslField(t, certPath, "-fingerprint", "-sha1")); info.FingerprintSHA1 != want {
+		t.Errorf("SHA1 指纹不一致: %s, openssl %s", info.FingerprintSHA1, want)
+	}
+	if want := opensslField(t, certPath, "-serial"); info.SerialNumber != want {
+		t.Errorf("序列号不一致: %s, openssl %s", info.SerialNumber, want)
+	}
+	if info.SignatureAlgorithm != "SHA256-RSA" || !info.SelfSigned || info.Expired {
+		t.Errorf("证书属性不正确: %+v", info)
+	}
+}
+
+// TestTLSDetectedOnNonStandardPort 不在列表中的端口没有 banner 时通过握手识别 TLS
+func TestTLSDetectedOnNonStandardPort(t *testing.T) {
+	printSeparator("非标准端口 TLS 识别测试")
+
+	ca := rsaCert(t, "Test CA", 1, time.Now().Add(24*time.Hour), nil)
+	expired := rsaCert(t, "old.example.test", 2, time.Now().Add(-time.Hour), &ca)
+
+	scanner := newLocalPortScanner(tlsListener(t, expired))
+	result := scanner.ScanPortFingerprint(context.Background(), "old.example.test", 10443)
+	if !result.SSL || result.Certificate == nil {
+		t.Fatalf("应通过握手识别 TLS: %+v", result)
+	}
+	if result.Certificate.SelfSigned || !result.Certificate.Expired {
+		t.Errorf("CA 签发的过期证书: %+v", result.Certificate)
+	}
+	if !strings.Contains(result.Certificate.Issuer, "Test CA") {
+		t.Errorf("签发者不正确: %s", result.Certificate.Issuer)
+	}
+
+	// 有 banner 的明文服务不尝试握手
+	ssh := newLocalPortScanner(bannerListener(t, "SSH-2.0-OpenSSH_8.9p1\r\n"))
+	if fp := ssh.ScanPortFingerprint(context.Background(), "old.example.test", 10022); fp.SSL || fp.Certificate != nil {
+		t.Errorf("明文服务不应标记为 TLS: %+v", fp)
+	}
+
+	// 过期判断以传入时间为准
+	info := fingerprint.CertInfoFromCertificate(expired.Leaf, expired.Leaf.NotAfter.Add(-time.Minute))
+	if info.Expired || info.FingerprintSHA256 != info.Fingerprint {
+		t.Errorf("按指定时间判断是否过期: %+v", info)
+	}
+}
+
+// TestSelfSignedLeafCertificate 不是 CA 的自签名证书（设备和自建服务的默认证书）同样识别为自签名
+func TestSelfSignedLeafCertificate(t *testing.T) {
+	printSeparator("非 CA 自签名证书测试")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(7),
+		Subject:               pkix.Name{CommonName: "router.local"},
+		DNSNames:              []string{"router.local"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	if info := fingerprint.CertInfoFromCertificate(leaf, time.Now()); !info.SelfSigned {
+		t.Errorf("非 CA 的自签名证书应识别为自签名: %+v", info)
+	}
+
+	// 主题与签发者相同但由其他密钥签名的证书不是自签名
+	ca := rsaCert(t, "router.local", 8, time.Now().Add(24*time.Hour), nil)
+	forged := rsaCert(t, "router.local", 9, time.Now().Add(24*time.Hour), &ca)
+	if info := fingerprint.CertInfoFromCertificate(forged.Leaf, time.Now()); info.SelfSigned {
+		t.Errorf("由其他密钥签名的证书不应识别为自签名: %+v", info)
+	}
+}
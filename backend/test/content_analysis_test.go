@@ -0,0 +1,186 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== 内容敏感信息检测测试 ==========
+
+// newContentFixtureServer JS 包、.env、备份文件等；/private/ 下的文件需要认证请求头
+func newContentFixtureServer() *httptest.Server {
+	files := map[string]struct {
+		contentType string
+		body        string
+	}{
+		"/static/main.js":      {"application/javascript", `!function(){var c={region:"us-east-1",accessKeyId:"` + fakeAWSKey(7) + `"};window.__cfg=c}();`},
+		"/static/vendor.js":    {"application/javascript", `/* analytics */var k="` + fakeAWSKey(7) + `";`},
+		"/.env":                {"application/octet-stream", "APP_NAME=shop\nAPP_KEY=base64:c2hvcC1hcHAta2V5\nDB_PASSWORD=\"S3cure-Prod-Pass\"\nAWS_ACCESS_KEY_ID=" + fakeAWSKey(7) + "\n"},
+		"/backup.bak":          {"application/octet-stream", "PK\x03\x04\x14\x00\x00\x00\x08\x00" + fakeAWSKey(8)},
+		"/logo.png":            {"image/png", fakeAWSKey(9)},
+		"/config.json":         {"application/json", `{"key":"` + fakeAWSKey(10) + `"}`},
+		"/private/settings.js": {"text/javascript", `const AWS_KEY = "` + fakeAWSKey(11) + `";`},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/private/") && r.Header.Get("Authorization") != "Bearer fixture-session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", f.contentType)
+		w.Write([]byte(f.body))
+	}))
+}
+
+// newFixtureContentAnalyzer 只使用 AWS 密钥、密码两条正则和一条 DSL 规则，结果与配置文件无关
+func newFixtureContentAnalyzer(t *testing.T) *webscan.ContentAnalyzer {
+	rulesFile := filepath.Join(t.TempDir(), "sensitive.yaml")
+	rules := "Laravel环境配置泄漏:\n  dsl:\n  - contains(body, 'APP_KEY=')\n"
+	if err := os.WriteFile(rulesFile, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := fingerprint.NewDSLEngine()
+	if err := engine.LoadRulesFromFile(rulesFile); err != nil {
+		t.Fatalf("加载 DSL 规则失败: %v", err)
+	}
+
+	analyzer := webscan.NewContentAnalyzer()
+	analyzer.Rules = engine
+	analyzer.Patterns = map[string]*webscan.SensitivePattern{
+		"aws_access_key": {
+			Name: "aws_access_key", Type: "credential", Severity: "critical",
+			Regex: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+		},
+		"password_field": {
+			Name: "password_field", Type: "credential", Severity: "high",
+			Regex: regexp.MustCompile(`(?i)(password|passwd|pwd|secret)\s*[=:]\s*['"]([^'"]+)['"]`),
+		},
+	}
+	return analyzer
+}
+
+// TestContentAnalysisFindings JS 包中的 AWS 密钥和 .env 中的凭证各输出一次，二进制、非文本类型和非 2xx 的文件不检测
+func TestContentAnalysisFindings(t *testing.T) {
+	printSeparator("内容敏感信息检测测试")
+
+	server := newContentFixtureServer()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 100))
+	module := pipeline.NewContentAnalysisModule(ctx, collector, 2)
+	module.SetAnalyzer(newFixtureContentAnalyzer(t))
+	module.SetHeaders(core.NewScanHeaders(map[string]string{"Authorization": "Bearer fixture-session"}, ""))
+
+	page := server.URL + "/index.html"
+	inputs := []pipeline.UrlResult{
+		{Input: server.URL, Output: server.URL + "/static/main.js", Source: "katana", Parent: page},
+		{Input: server.URL, Output: server.URL + "/static/vendor.js", Source: "katana", Parent: page},
+		{Input: server.URL, Output: server.URL + "/static/main.js", Source: "katana", Parent: page},
+		{Input: server.URL, Output: server.URL + "/.env", Source: "dirscan", StatusCode: 200},
+		{Input: server.URL, Output: server.URL + "/backup.bak", Source: "dirscan", StatusCode: 200},
+		{Input: server.URL, Output: server.URL + "/logo.png", Source: "katana", ContentType: "image/png"},
+		{Input: server.URL, Output: server.URL + "/config.json", Source: "dirscan", StatusCode: 403},
+		{Input: server.URL, Output: server.URL + "/private/settings.js", Source: "katana"},
+	}
+	input := make(chan interface{}, len(inputs))
+	for _, in := range inputs {
+		input <- in
+	}
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	forwarded := 0
+	var got []string
+	findings := map[string]pipeline.SensitiveInfoResult{}
+	for len(out) > 0 {
+		switch r := (<-out).(type) {
+		case pipeline.UrlResult:
+			forwarded++
+		case pipeline.SensitiveInfoResult:
+			key := strings.TrimPrefix(r.URL, server.URL) + " " + r.Pattern
+			got = append(got, key)
+			findings[key] = r
+		}
+	}
+	if forwarded != len(inputs) {
+		t.Errorf("URL 结果应原样传递: %d/%d", forwarded, len(inputs))
+	}
+
+	sort.Strings(got)
+	want := []string{
+		"/.env Laravel环境配置泄漏",
+		"/.env password_field",
+		"/private/settings.js aws_access_key",
+		"/static/main.js aws_access_key",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("检测结果不符合预期:\n%s\n期望:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	js := findings["/static/main.js aws_access_key"]
+	if len(js.Matches) != 1 || js.Matches[0] != fakeAWSKey(7) || js.Location != "js" || js.Severity != "critical" {
+		t.Errorf("JS 包中的 AWS 密钥不正确: %+v", js)
+	}
+	if js.Parent != page || js.Target != server.URL || js.Source != "content_analysis" {
+		t.Errorf("应记录来源文件和链接到它的页面: url=%s parent=%s target=%s", js.URL, js.Parent, js.Target)
+	}
+	if len(js.Contexts) != 1 || strings.Contains(js.Contexts[0].Before+js.Contexts[0].Match+js.Contexts[0].After, fakeAWSKey(7)) {
+		t.Errorf("匹配上下文中的密钥应掩码: %+v", js.Contexts)
+	}
+
+	// .env 中的 AWS 密钥已在 main.js 中输出，不重复
+	env := findings["/.env password_field"]
+	if len(env.Matches) != 1 || !strings.Contains(env.Matches[0], "S3cure-Prod-Pass") || env.Location != "body" || env.Parent != server.URL {
+		t.Errorf(".env 中的密码不正确: %+v", env)
+	}
+}
+
+// TestContentAnalysisSelection 按扩展名、内容类型和状态码选择需要检测的文件
+func TestContentAnalysisSelection(t *testing.T) {
+	printSeparator("内容检测文件选择测试")
+
+	cases := []struct {
+		result pipeline.UrlResult
+		want   bool
+	}{
+		{pipeline.UrlResult{Output: "https://a.example.com/static/app.8f3a.js"}, true},
+		{pipeline.UrlResult{Output: "https://a.example.com/.env.production"}, true},
+		{pipeline.UrlResult{Output: "https://a.example.com/db/dump.SQL", StatusCode: 200}, true},
+		{pipeline.UrlResult{Output: "https://a.example.com/web.config.bak"}, true},
+		{pipeline.UrlResult{Output: "https://a.example.com/api/settings", ContentType: "application/json; charset=utf-8"}, true},
+		{pipeline.UrlResult{Output: "https://a.example.com/robots", ContentType: "text/plain"}, true},
+		{pipeline.UrlResult{Output: "https://a.example.com/index.html", ContentType: "text/html"}, false},
+		{pipeline.UrlResult{Output: "https://a.example.com/logo.png?v=.js"}, false},
+		{pipeline.UrlResult{Output: "https://a.example.com/.env", StatusCode: 403}, false},
+		{pipeline.UrlResult{Output: "https://a.example.com/config.json", Method: "POST"}, false},
+		{pipeline.UrlResult{Output: "https://a.example.com/app.js", StateChanging: true}, false},
+	}
+	for _, c := range cases {
+		if got := pipeline.ContentAnalysisDoc(c.result); got != c.want {
+			t.Errorf("%s (%s, %d): 期望 %v，实际 %v", c.result.Output, c.result.ContentType, c.result.StatusCode, c.want, got)
+		}
+	}
+}
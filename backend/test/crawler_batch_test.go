@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== 爬虫批量模式分批测试 ==========
+
+// writeBatchKatana 模拟 katana -list：每次调用向 calls.txt 追加一行，每个输入 URL 输出一条 <url>/page 结果，
+// 每批都输出同一条 https://cdn.example.com/app.js
+func writeBatchKatana(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "katana")
+	script := `#!/bin/sh
+if [ "$1" = "-version" ]; then echo 'katana v1.1.0'; exit 0; fi
+list=""
+out=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-list" ]; then list="$2"; fi
+  if [ "$1" = "-o" ]; then out="$2"; fi
+  shift
+done
+echo call >> "` + filepath.Join(dir, "calls.txt") + `"
+while read -r url; do
+  echo "{\"request\":{\"method\":\"GET\",\"endpoint\":\"$url/page\",\"source\":\"$url\"},\"response\":{\"status_code\":200}}"
+done < "$list" > "$out"
+echo '{"request":{"method":"GET","endpoint":"https://cdn.example.com/app.js"},"response":{"status_code":200}}' >> "$out"
+exit 0
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake katana: %v", err)
+	}
+	return path
+}
+
+// crawlRecorder 作为爬虫的下一个模块，记录收到每条 URL 结果时 katana 已被调用的次数
+type crawlRecorder struct {
+	input     chan interface{}
+	callsFile string
+
+	mu     sync.Mutex
+	callAt map[string]int
+}
+
+func (r *crawlRecorder) ModuleRun() error {
+	for data := range r.input {
+		result, ok := data.(pipeline.UrlResult)
+		if !ok {
+			continue
+		}
+		r.mu.Lock()
+		r.callAt[result.Output] = r.calls()
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+func (r *crawlRecorder) calls() int {
+	data, _ := os.ReadFile(r.callsFile)
+	return strings.Count(string(data), "call\n")
+}
+
+func (r *crawlRecorder) SetInput(ch chan interface{}) { r.input = ch }
+func (r *crawlRecorder) GetInput() chan interface{}   { return r.input }
+func (r *crawlRecorder) CloseInput()                  { close(r.input) }
+func (r *crawlRecorder) GetName() string              { return "Recorder" }
+
+// runBatchCrawler 向爬虫模块输入 n 个 Web 资产，返回记录器和 katana 调用次数
+func runBatchCrawler(t *testing.T, n, batchSize, parallel int) (*crawlRecorder, int) {
+	t.Helper()
+	dir := t.TempDir()
+	recorder := &crawlRecorder{
+		input:     make(chan interface{}),
+		callsFile: filepath.Join(dir, "calls.txt"),
+		callAt:    make(map[string]int),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	katana := webscan.NewKatanaScanner()
+	katana.BinPath = writeBatchKatana(t, dir)
+	katana.TempDir = dir
+
+	crawler := pipeline.NewCrawlerModule(ctx, recorder, 5, true, false)
+	crawler.SetKatanaScanner(katana)
+	crawler.SetBatchMode(true, batchSize)
+	crawler.SetBatchLimits(0, parallel)
+	crawler.SetInput(make(chan interface{}, n))
+	for i := 0; i < n; i++ {
+		host := fmt.Sprintf("site%03d.example.com", i)
+		crawler.GetInput() <- pipeline.AssetHttp{URL: "https://" + host, Host: host}
+	}
+	crawler.CloseInput()
+
+	if err := crawler.ModuleRun(); err != nil {
+		t.Fatalf("爬虫模块运行失败: %v", err)
+	}
+	return recorder, recorder.calls()
+}
+
+// TestCrawlerBatchChunks 250 个 URL 按每批 100 个分 3 次调用 katana，每批的结果在下一批开始前转发
+func TestCrawlerBatchChunks(t *testing.T) {
+	printSeparator("爬虫批量模式分批测试")
+
+	recorder, calls := runBatchCrawler(t, 250, 100, 1)
+	if calls != 3 {
+		t.Fatalf("250 个 URL 每批 100 个应调用 3 次 katana, 实际 %d", calls)
+	}
+	if len(recorder.callAt) != 251 {
+		t.Fatalf("应转发 251 条爬取结果, 实际 %d", len(recorder.callAt))
+	}
+	if recorder.callAt["https://cdn.example.com/app.js"] != 1 {
+		t.Error("各批都发现的 URL 应只在第一批转发")
+	}
+	for i := 0; i < 250; i++ {
+		url := fmt.Sprintf("https://site%03d.example.com/page", i)
+		want := i/100 + 1
+		if got := recorder.callAt[url]; got != want {
+			t.Errorf("%s 应在第 %d 批结束后、下一批开始前转发, 转发时已调用 %d 次", url, want, got)
+		}
+	}
+}
+
+// TestCrawlerParallelBatches 同时运行多批时调用次数不变，结果跨批去重后全部转发
+func TestCrawlerParallelBatches(t *testing.T) {
+	printSeparator("爬虫并行批次测试")
+
+	recorder, calls := runBatchCrawler(t, 250, 100, 3)
+	if calls != 3 {
+		t.Errorf("并行运行时应调用 3 次 katana, 实际 %d", calls)
+	}
+	if len(recorder.callAt) != 251 {
+		t.Errorf("应转发 251 条爬取结果, 实际 %d", len(recorder.callAt))
+	}
+}
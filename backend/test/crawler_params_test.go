@@ -0,0 +1,238 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== 爬虫请求参数测试 ==========
+
+// katanaParamsFixture katana -jsonl 输出：带查询参数的 GET、只在 request.raw 中给出请求体的表单 POST、JSON POST
+var katanaParamsFixture = []string{
+	`{"timestamp":"2026-01-01T00:00:00Z","request":{"method":"GET","endpoint":"http://app.example.test/search?q=test&page=2&q=more","source":"http://app.example.test/"},"response":{"status_code":200}}`,
+	`{"timestamp":"2026-01-01T00:00:01Z","request":{"method":"POST","endpoint":"http://app.example.test/login","source":"form","raw":"POST /login HTTP/1.1\r\nHost: app.example.test\r\nContent-Type: application/x-www-form-urlencoded\r\n\r\nusername=admin&password=secret&remember=on"},"response":{"status_code":302}}`,
+	`{"timestamp":"2026-01-01T00:00:02Z","request":{"method":"POST","endpoint":"http://app.example.test/api/items?v=1","body":"{\"name\":\"a\",\"count\":2,\"tags\":[\"x\"],\"active\":true}","headers":{"content-type":"application/json"},"source":"script"},"response":{"status_code":201}}`,
+}
+
+// TestKatanaRequestParams katana 结果记录查询参数、请求体参数、Content-Type 和表单字段
+func TestKatanaRequestParams(t *testing.T) {
+	printSeparator("Katana 请求参数解析测试")
+
+	katana := webscan.NewKatanaScanner()
+	katana.BinPath = writeFakeKatana(t, katanaParamsFixture)
+	katana.TempDir = t.TempDir()
+
+	result, err := katana.Crawl(context.Background(), "http://app.example.test")
+	if err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+	if len(result.URLs) != 3 {
+		t.Fatalf("期望 3 个请求, 实际 %d: %+v", len(result.URLs), result.URLs)
+	}
+
+	search := result.URLs[0]
+	if !reflect.DeepEqual(search.Parameters, []string{"page", "q"}) || search.ContentType != "" || search.FormFields != nil {
+		t.Errorf("GET 请求应记录去重排序后的查询参数: %+v", search)
+	}
+
+	login := result.URLs[1]
+	if login.Body == "" || login.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("应从原始请求中读取请求体和 Content-Type: %+v", login)
+	}
+	if !reflect.DeepEqual(login.Parameters, []string{"password", "remember", "username"}) {
+		t.Errorf("表单参数不正确: %v", login.Parameters)
+	}
+	wantLogin := []webscan.FormField{
+		{Name: "username", Type: webscan.FieldTypeText},
+		{Name: "password", Type: webscan.FieldTypeText},
+		{Name: "remember", Type: webscan.FieldTypeText},
+	}
+	if !reflect.DeepEqual(login.FormFields, wantLogin) {
+		t.Errorf("表单字段应按提交顺序记录: %+v", login.FormFields)
+	}
+
+	items := result.URLs[2]
+	if items.ContentType != "application/json" || !reflect.DeepEqual(items.Parameters, []string{"active", "count", "name", "tags", "v"}) {
+		t.Errorf("JSON 请求应合并查询参数和请求体字段: %+v", items)
+	}
+	wantItems := []webscan.FormField{
+		{Name: "active", Type: webscan.FieldTypeBoolean},
+		{Name: "count", Type: webscan.FieldTypeNumber},
+		{Name: "name", Type: webscan.FieldTypeString},
+		{Name: "tags", Type: webscan.FieldTypeArray},
+	}
+	if !reflect.DeepEqual(items.FormFields, wantItems) {
+		t.Errorf("JSON 字段类型不正确: %+v", items.FormFields)
+	}
+}
+
+// TestParseMultipartParams multipart 表单中带文件名的部分记为文件字段
+func TestParseMultipartParams(t *testing.T) {
+	printSeparator("multipart 表单参数解析测试")
+
+	body := "--BOUNDARY\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nhello\r\n" +
+		"--BOUNDARY\r\nContent-Disposition: form-data; name=\"avatar\"; filename=\"a.png\"\r\nContent-Type: image/png\r\n\r\nPNG\r\n" +
+		"--BOUNDARY--\r\n"
+	params := webscan.ParseRequestParams("http://app.example.test/upload", "multipart/form-data; boundary=BOUNDARY", body)
+	if params.ContentType != "multipart/form-data" {
+		t.Errorf("Content-Type 应去掉 boundary 参数: %s", params.ContentType)
+	}
+	want := []webscan.FormField{{Name: "title", Type: webscan.FieldTypeText}, {Name: "avatar", Type: webscan.FieldTypeFile}}
+	if !reflect.DeepEqual(params.FormFields, want) || !reflect.DeepEqual(params.Parameters, []string{"avatar", "title"}) {
+		t.Errorf("multipart 字段不正确: %+v", params)
+	}
+
+	// 未给出 Content-Type 时按请求体推断
+	if p := webscan.ParseRequestParams("http://a.test/x", "", "a=1&b=2"); p.ContentType != "application/x-www-form-urlencoded" || len(p.FormFields) != 2 {
+		t.Errorf("应按请求体推断表单类型: %+v", p)
+	}
+}
+
+// TestCrawlerModuleRequestParams 爬虫模块输出的 UrlResult 带上请求参数，按参数集合去重时只保留参数值不同的第一个请求
+func TestCrawlerModuleRequestParams(t *testing.T) {
+	printSeparator("爬虫模块请求参数测试")
+
+	fixture := append([]string{}, katanaParamsFixture...)
+	fixture = append(fixture,
+		`{"request":{"method":"GET","endpoint":"http://app.example.test/search?page=9&q=other"},"response":{"status_code":200}}`,
+		`{"request":{"method":"POST","endpoint":"http://app.example.test/login","body":"username=guest&password=x&remember=off","headers":{"Content-Type":"application/x-www-form-urlencoded"}},"response":{"status_code":302}}`,
+	)
+
+	run := func(dedup *pipeline.URLDeduper) []pipeline.UrlResult {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		output := make(chan interface{}, 100)
+		collector := pipeline.NewResultCollectorModule(ctx, output)
+		collector.SetInput(make(chan interface{}, 100))
+		module := pipeline.NewCrawlerModule(ctx, collector, 1, true, false)
+		module.SetBatchMode(false, 0)
+		module.SetURLDeduper(dedup)
+
+		katana := webscan.NewKatanaScanner()
+		katana.BinPath = writeFakeKatana(t, fixture)
+		katana.TempDir = t.TempDir()
+		module.SetKatanaScanner(katana)
+
+		input := make(chan interface{}, 1)
+		module.SetInput(input)
+		input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test"}
+		close(input)
+		if err := module.ModuleRun(); err != nil {
+			t.Fatalf("爬虫模块异常: %v", err)
+		}
+		close(output)
+
+		var urls []pipeline.UrlResult
+		for r := range output {
+			if u, ok := r.(pipeline.UrlResult); ok {
+				urls = append(urls, u)
+			}
+		}
+		return urls
+	}
+
+	urls := run(pipeline.NewURLDeduper(false))
+	if len(urls) != 5 {
+		t.Fatalf("按 URL 去重时参数值不同的请求都应保留, 实际 %d", len(urls))
+	}
+	var login *pipeline.UrlResult
+	for i := range urls {
+		if urls[i].Method == "POST" && strings.HasSuffix(urls[i].Output, "/login") {
+			login = &urls[i]
+			break
+		}
+	}
+	if login == nil {
+		t.Fatalf("未输出登录表单请求")
+	}
+	if login.RequestContentType != "application/x-www-form-urlencoded" || !reflect.DeepEqual(login.Parameters, []string{"password", "remember", "username"}) || len(login.FormFields) != 3 {
+		t.Errorf("UrlResult 应记录表单参数: %+v", login)
+	}
+	if login.ParamSignature != "POST http://app.example.test/login?password&remember&username" {
+		t.Errorf("参数集合签名不正确: %s", login.ParamSignature)
+	}
+
+	urls = run(pipeline.NewParameterURLDeduper())
+	if len(urls) != 3 {
+		t.Errorf("按参数集合去重时期望 3 个请求, 实际 %d", len(urls))
+	}
+	for _, u := range urls {
+		if strings.Contains(u.Output, "q=other") || strings.Contains(u.RequestBody, "guest") {
+			t.Errorf("参数名相同的请求应只保留第一个: %s %s", u.Output, u.RequestBody)
+		}
+	}
+}
+
+// TestParameterSignature 参数集合签名忽略参数顺序和参数值，区分请求方法
+func TestParameterSignature(t *testing.T) {
+	printSeparator("参数集合签名测试")
+
+	a := pipeline.ParameterSignature(pipeline.UrlResult{Output: "http://a.test/list?a=1&b=2"})
+	b := pipeline.ParameterSignature(pipeline.UrlResult{Output: "http://a.test/list?b=3&a=4", Method: "get"})
+	if a != b || a != "GET http://a.test/list?a&b" {
+		t.Errorf("参数顺序和值不同应得到相同签名: %s / %s", a, b)
+	}
+	post := pipeline.ParameterSignature(pipeline.UrlResult{
+		Output:         "http://a.test/list",
+		Method:         "POST",
+		RequestBody:    "a=1&b=2",
+		RequestHeaders: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	})
+	if post != "POST http://a.test/list?a&b" {
+		t.Errorf("POST 请求应从请求体解析参数: %s", post)
+	}
+	if bare := pipeline.ParameterSignature(pipeline.UrlResult{Output: "http://a.test/list"}); bare != "GET http://a.test/list" {
+		t.Errorf("无参数时签名只包含方法和地址: %s", bare)
+	}
+}
+
+// TestRadRequestParams rad 输出的 "POST url" 文本行和带 b64_body 的 JSON 行
+func TestRadRequestParams(t *testing.T) {
+	printSeparator("Rad 请求参数解析测试")
+
+	lines := []string{
+		"GET http://app.example.test/news?id=1",
+		"POST http://app.example.test/comment",
+		`{"url":"http://app.example.test/login","method":"POST","header":{"Content-Type":"application/x-www-form-urlencoded"},"b64_body":"dXNlcj1hJnBhc3M9Yg=="}`,
+		"http://app.example.test/about",
+	}
+	path := filepath.Join(t.TempDir(), "rad")
+	script := "#!/bin/sh\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = \"-o\" ]; then out=\"$2\"; fi\n  shift\ndone\ncat > \"$out\" <<'EOF'\n" +
+		strings.Join(lines, "\n") + "\nEOF\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake rad: %v", err)
+	}
+
+	rad := webscan.NewRadScanner()
+	rad.BinPath = path
+	rad.TempDir = t.TempDir()
+	result, err := rad.Crawl(context.Background(), "http://app.example.test")
+	if err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+	if len(result.URLs) != 4 {
+		t.Fatalf("期望 4 个请求, 实际 %+v", result.URLs)
+	}
+	if u := result.URLs[0]; u.Method != "GET" || !reflect.DeepEqual(u.Parameters, []string{"id"}) {
+		t.Errorf("文本行应解析请求方法和查询参数: %+v", u)
+	}
+	if u := result.URLs[1]; u.Method != "POST" || u.URL != "http://app.example.test/comment" {
+		t.Errorf("POST 文本行应保留请求方法: %+v", u)
+	}
+	login := result.URLs[2]
+	if login.Body != "user=a&pass=b" || !reflect.DeepEqual(login.Parameters, []string{"pass", "user"}) || len(login.FormFields) != 2 {
+		t.Errorf("JSON 行应解码请求体并解析表单字段: %+v", login)
+	}
+	if u := result.URLs[3]; u.Method != "" || u.URL != "http://app.example.test/about" {
+		t.Errorf("单独的 URL 行: %+v", u)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 巡航调度测试 ==========
+
+// memoryCruiseFireStore 内存触发存储，多个 CruiseGate 共享时模拟多个实例
+type memoryCruiseFireStore struct {
+	locks    map[string]bool
+	statuses map[string]models.TaskStatus
+}
+
+func newMemoryCruiseFireStore() *memoryCruiseFireStore {
+	return &memoryCruiseFireStore{locks: map[string]bool{}, statuses: map[string]models.TaskStatus{}}
+}
+
+func (s *memoryCruiseFireStore) AcquireFireLock(ctx context.Context, cruiseID string, slot time.Time) (bool, error) {
+	key := cruiseID + slot.UTC().Format(time.RFC3339)
+	if s.locks[key] {
+		return false, nil
+	}
+	s.locks[key] = true
+	return true, nil
+}
+
+func (s *memoryCruiseFireStore) GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error) {
+	return s.statuses[taskID], nil
+}
+
+// TestParseCronExpr 五段式表达式解析和下次执行时间
+func TestParseCronExpr(t *testing.T) {
+	printSeparator("巡航 Cron 表达式解析测试")
+
+	// 2026-10-14 是周三
+	from := time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 22 * * 0", time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC)}, // 每周日晚上
+		{"*/15 * * * *", time.Date(2026, 10, 14, 12, 45, 0, 0, time.UTC)},
+		{"0 2 1,15 * *", time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		schedule, err := service.ParseCronExpr(c.expr)
+		if err != nil {
+			t.Errorf("%q 解析失败: %v", c.expr, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(c.want) {
+			t.Errorf("%q 下次执行时间 %v, 期望 %v", c.expr, next, c.want)
+		}
+	}
+
+	for _, expr := range []string{"", "61 * * * *", "0 0 * * * *", "every sunday"} {
+		if _, err := service.ParseCronExpr(expr); err == nil {
+			t.Errorf("%q 应解析失败", expr)
+		}
+	}
+
+	if err := service.ValidateOverlapPolicy("queue"); err == nil {
+		t.Error("未知的重叠策略应返回错误")
+	}
+	if err := service.ValidateOverlapPolicy(""); err != nil {
+		t.Errorf("空策略应使用默认值: %v", err)
+	}
+}
+
+// TestCruiseGateOverlapSkip 上一次任务仍在执行时按策略跳过，多实例同一分钟只触发一次
+func TestCruiseGateOverlapSkip(t *testing.T) {
+	printSeparator("巡航重叠跳过测试")
+
+	ctx := context.Background()
+	store := newMemoryCruiseFireStore()
+	gate := service.NewCruiseGate(store)
+	other := service.NewCruiseGate(store) // 另一个实例
+	slot := time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC)
+
+	lastTask := primitive.NewObjectID().Hex()
+	store.statuses[lastTask] = models.TaskStatusRunning
+	cruise := &models.CruiseTask{ID: primitive.NewObjectID(), Status: models.CruiseStatusEnabled, LastTaskID: lastTask}
+
+	if reason, _ := gate.Check(ctx, cruise, slot, false); reason != service.CruiseSkipOverlap {
+		t.Errorf("上一次任务运行中应跳过, 实际 %q", reason)
+	}
+	if reason, _ := other.Check(ctx, cruise, slot.Add(20*time.Second), false); reason != service.CruiseSkipLocked {
+		t.Errorf("同一分钟的其他实例应被锁拦截, 实际 %q", reason)
+	}
+	if reason, _ := gate.Check(ctx, cruise, slot, true); reason != service.CruiseSkipOverlap {
+		t.Errorf("立即执行也应遵守重叠策略, 实际 %q", reason)
+	}
+
+	cruise.OverlapPolicy = models.CruiseOverlapAllow
+	if reason, _ := gate.Check(ctx, cruise, slot.Add(time.Minute), false); reason != service.CruiseSkipNone {
+		t.Errorf("allow 策略应照常触发, 实际 %q", reason)
+	}
+
+	cruise.OverlapPolicy = models.CruiseOverlapSkip
+	store.statuses[lastTask] = models.TaskStatusCompleted
+	if reason, _ := gate.Check(ctx, cruise, slot.Add(2*time.Minute), false); reason != service.CruiseSkipNone {
+		t.Errorf("上一次任务结束后应触发, 实际 %q", reason)
+	}
+
+	cruise.Status = models.CruiseStatusDisabled
+	if reason, _ := gate.Check(ctx, cruise, slot.Add(3*time.Minute), false); reason != service.CruiseSkipPaused {
+		t.Errorf("暂停的巡航不应定时触发, 实际 %q", reason)
+	}
+	if reason, _ := gate.Check(ctx, cruise, slot.Add(3*time.Minute), true); reason != service.CruiseSkipNone {
+		t.Errorf("暂停的巡航可以立即执行, 实际 %q", reason)
+	}
+}
@@ -0,0 +1,500 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/service/pipeline"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ========== 模块内去重存储测试 ==========
+
+// fakeRedis 只实现去重和可靠任务队列用到的命令的 RESP 服务，过期时间只记录不生效，MULTI/EXEC 按顺序执行排队的命令
+// discard 为 true 时不保存集合成员，SADD 总是返回新增，用于只统计扫描进程内存的基准测试
+type fakeRedis struct {
+	listener net.Listener
+	discard  bool
+
+	mu     sync.Mutex
+	sets   map[string]map[string]bool
+	ttls   map[string]time.Duration
+	lists  map[string][]string
+	hashes map[string]map[string]int
+	values map[string]string
+}
+
+func newFakeRedis(t testing.TB, discard bool) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := &fakeRedis{listener: ln, discard: discard, sets: map[string]map[string]bool{}, ttls: map[string]time.Duration{},
+		lists: map[string][]string{}, hashes: map[string]map[string]int{}, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeRedis) client() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: s.listener.Addr().String(), MaxRetries: -1})
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	var multi [][]string // MULTI 之后排队的命令
+	inMulti := false
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "MULTI":
+			inMulti, multi = true, nil
+			fmt.Fprint(w, "+OK\r\n")
+		case cmd == "EXEC":
+			s.mu.Lock()
+			fmt.Fprintf(w, "*%d\r\n", len(multi))
+			for _, queued := range multi {
+				fmt.Fprint(w, s.execLocked(queued))
+			}
+			s.mu.Unlock()
+			inMulti, multi = false, nil
+		case cmd == "DISCARD":
+			inMulti, multi = false, nil
+			fmt.Fprint(w, "+OK\r\n")
+		case cmd == "WATCH" || cmd == "UNWATCH":
+			fmt.Fprint(w, "+OK\r\n")
+		case inMulti:
+			multi = append(multi, args)
+			fmt.Fprint(w, "+QUEUED\r\n")
+		default:
+			fmt.Fprint(w, s.exec(args))
+		}
+		if r.Buffered() == 0 {
+			w.Flush()
+		}
+	}
+}
+
+// readRESPCommand 读取一条命令（bulk string 数组）
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) exec(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.execLocked(args)
+}
+
+// execLocked 执行一条命令（需要持有锁）
+func (s *fakeRedis) execLocked(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SADD":
+		set := s.sets[args[1]]
+		if set == nil && !s.discard {
+			set = map[string]bool{}
+			s.sets[args[1]] = set
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if s.discard || !set[member] {
+				added++
+			}
+			if !s.discard {
+				set[member] = true
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", added)
+	case "EXPIRE":
+		seconds, _ := strconv.Atoi(args[2])
+		s.ttls[args[1]] = time.Duration(seconds) * time.Second
+		return ":1\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if s.existsLocked(key) {
+				deleted++
+			}
+			delete(s.sets, key)
+			delete(s.ttls, key)
+			delete(s.lists, key)
+			delete(s.hashes, key)
+			delete(s.values, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if s.existsLocked(key) {
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SREM":
+		removed := 0
+		for _, member := range args[2:] {
+			if s.sets[args[1]][member] {
+				removed++
+				delete(s.sets[args[1]], member)
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "SMEMBERS":
+		var members []string
+		for member := range s.sets[args[1]] {
+			members = append(members, member)
+		}
+		return respArray(members)
+	case "SET":
+		nx := false
+		for _, opt := range args[3:] {
+			if strings.EqualFold(opt, "NX") {
+				nx = true
+			}
+		}
+		if _, ok := s.values[args[1]]; ok && nx {
+			return "$-1\r\n"
+		}
+		s.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return respBulk(value)
+	case "RPUSH":
+		s.lists[args[1]] = append(s.lists[args[1]], args[2:]...)
+		return fmt.Sprintf(":%d\r\n", len(s.lists[args[1]]))
+	case "LPOP":
+		list := s.lists[args[1]]
+		if len(list) == 0 {
+			return "$-1\r\n"
+		}
+		s.lists[args[1]] = list[1:]
+		return respBulk(list[0])
+	case "LMOVE":
+		// 只实现 LMOVE from to LEFT RIGHT
+		list := s.lists[args[1]]
+		if len(list) == 0 {
+			return "$-1\r\n"
+		}
+		s.lists[args[1]] = list[1:]
+		s.lists[args[2]] = append(s.lists[args[2]], list[0])
+		return respBulk(list[0])
+	case "LRANGE":
+		return respArray(s.lists[args[1]])
+	case "LREM":
+		// 只实现 count 为 0（删除全部）
+		kept := s.lists[args[1]][:0:0]
+		removed := 0
+		for _, v := range s.lists[args[1]] {
+			if v == args[3] {
+				removed++
+				continue
+			}
+			kept = append(kept, v)
+		}
+		s.lists[args[1]] = kept
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "LPOS":
+		for i, v := range s.lists[args[1]] {
+			if v == args[2] {
+				return fmt.Sprintf(":%d\r\n", i)
+			}
+		}
+		return "$-1\r\n"
+	case "HINCRBY":
+		hash := s.hashes[args[1]]
+		if hash == nil {
+			hash = map[string]int{}
+			s.hashes[args[1]] = hash
+		}
+		n, _ := strconv.Atoi(args[3])
+		hash[args[2]] += n
+		return fmt.Sprintf(":%d\r\n", hash[args[2]])
+	case "HDEL":
+		deleted := 0
+		for _, field := range args[2:] {
+			if _, ok := s.hashes[args[1]][field]; ok {
+				deleted++
+				delete(s.hashes[args[1]], field)
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// existsLocked key 是否存在（需要持有锁）
+func (s *fakeRedis) existsLocked(key string) bool {
+	if _, ok := s.values[key]; ok {
+		return true
+	}
+	return len(s.sets[key]) > 0 || len(s.lists[key]) > 0 || len(s.hashes[key]) > 0
+}
+
+// list 列表的全部元素
+func (s *fakeRedis) list(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lists[key]...)
+}
+
+func respBulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+func respArray(values []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(values))
+	for _, v := range values {
+		b.WriteString(respBulk(v))
+	}
+	return b.String()
+}
+
+func (s *fakeRedis) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.sets {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// checkDedupStore 各类条目分别去重，相同字符串在不同类型中互不影响
+func checkDedupStore(t *testing.T, name string, store pipeline.DedupStore) {
+	t.Helper()
+	for _, kind := range []string{pipeline.DedupKindSubdomain, pipeline.DedupKindPort, pipeline.DedupKindURL} {
+		if store.Add(kind, "www.example.com") {
+			t.Errorf("%s: %s 首次记录不应为重复", name, kind)
+		}
+		if !store.Add(kind, "www.example.com") {
+			t.Errorf("%s: %s 再次记录应为重复", name, kind)
+		}
+	}
+	if store.Add(pipeline.DedupKindURL, "http://www.example.com/a?id=2") {
+		t.Errorf("%s: 不同 URL 不应为重复", name)
+	}
+}
+
+// TestDedupStoreBackends 内存、布隆过滤器、Redis 三种存储的去重结果一致
+func TestDedupStoreBackends(t *testing.T) {
+	printSeparator("模块内去重存储测试")
+
+	checkDedupStore(t, "memory", pipeline.NewMemoryDedupStore())
+	checkDedupStore(t, "bloom", pipeline.NewBloomDedupStore(0.01))
+
+	server := newFakeRedis(t, false)
+	client := server.client()
+	defer client.Close()
+	store := pipeline.NewRedisDedupStore(client, "task1", "Crawler", time.Hour)
+	checkDedupStore(t, "redis", store)
+
+	keys := server.keys()
+	if len(keys) != 3 {
+		t.Fatalf("应按类型分别创建集合: %v", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "task:dedup:task1:Crawler:") || server.ttls[key] != time.Hour {
+			t.Errorf("集合应按任务和模块分键并设置过期时间: %s %v", key, server.ttls[key])
+		}
+	}
+	if err := store.Close(); err != nil || len(server.keys()) != 0 {
+		t.Errorf("任务结束时应删除集合: %v %v", err, server.keys())
+	}
+}
+
+// TestDedupStoreRedisFallback Redis 不可用时改用内存集合，去重继续生效
+func TestDedupStoreRedisFallback(t *testing.T) {
+	printSeparator("Redis去重存储降级测试")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DialTimeout: 200 * time.Millisecond})
+	defer client.Close()
+	store := pipeline.NewRedisDedupStore(client, "task1", "Crawler", 0)
+	if store.Add(pipeline.DedupKindURL, "http://www.example.com/") || !store.Add(pipeline.DedupKindURL, "http://www.example.com/") {
+		t.Errorf("Redis 不可用时应使用内存集合去重")
+	}
+}
+
+// TestBloomDedupFalsePositiveRate 布隆过滤器写满后扩容，误判率保持在配置值附近
+func TestBloomDedupFalsePositiveRate(t *testing.T) {
+	printSeparator("布隆过滤器误判率测试")
+
+	const n = 300000
+	const fpRate = 0.01
+	store := pipeline.NewBloomDedupStore(fpRate)
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if store.Add(pipeline.DedupKindURL, fmt.Sprintf("http://www.example.com/item?id=%d", i)) {
+			falsePositives++
+		}
+	}
+	// 逐层误判率减半，总误判率不超过配置值的两倍
+	if rate := float64(falsePositives) / n; rate > 2*fpRate {
+		t.Errorf("误判率过高: %.4f", rate)
+	}
+	for i := 0; i < n; i += 1000 {
+		if !store.Add(pipeline.DedupKindURL, fmt.Sprintf("http://www.example.com/item?id=%d", i)) {
+			t.Fatalf("已记录的 URL 必须判定为重复: %d", i)
+		}
+	}
+}
+
+// TestTieredDedupStore 内存集合超过上限后迁移到大容量存储，已记录的条目仍判定为重复
+func TestTieredDedupStore(t *testing.T) {
+	printSeparator("分级去重存储测试")
+
+	server := newFakeRedis(t, false)
+	client := server.client()
+	defer client.Close()
+
+	created := 0
+	store := pipeline.NewTieredDedupStore(10, func() pipeline.DedupStore {
+		created++
+		return pipeline.NewRedisDedupStore(client, "task1", "DirScan", 0)
+	})
+	for i := 0; i < 30; i++ {
+		if store.Add(pipeline.DedupKindURL, fmt.Sprintf("http://www.example.com/%d", i)) {
+			t.Errorf("%d 首次记录不应为重复", i)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("超过上限后应迁移一次: %d", created)
+	}
+	for i := 0; i < 30; i++ {
+		if !store.Add(pipeline.DedupKindURL, fmt.Sprintf("http://www.example.com/%d", i)) {
+			t.Errorf("%d 迁移后应判定为重复", i)
+		}
+	}
+	if keys := server.keys(); len(keys) != 1 {
+		t.Errorf("迁移后条目应写入 Redis: %v", keys)
+	}
+	store.Close()
+	if keys := server.keys(); len(keys) != 0 {
+		t.Errorf("关闭时应删除 Redis 集合: %v", keys)
+	}
+}
+
+// TestDuplicateCheckerWithStore 去重检查器的接口不变，条目写入指定的存储
+func TestDuplicateCheckerWithStore(t *testing.T) {
+	printSeparator("去重检查器存储测试")
+
+	store := pipeline.NewMemoryDedupStore()
+	checker := pipeline.NewDuplicateCheckerWithStore(store)
+	if checker.IsSubdomainDuplicate("www.example.com") || !checker.IsSubdomainDuplicate("www.example.com") {
+		t.Errorf("子域名去重不正确")
+	}
+	if checker.IsPortDuplicate("www.example.com", "443") || !checker.IsPortDuplicate("www.example.com", "443") {
+		t.Errorf("端口去重不正确")
+	}
+	if checker.IsURLDuplicate("http://www.example.com/") || !checker.IsURLDuplicate("http://www.example.com/") {
+		t.Errorf("URL 去重不正确")
+	}
+	if store.Len() != 3 {
+		t.Errorf("条目应写入指定的存储: %d", store.Len())
+	}
+}
+
+// BenchmarkDedupStoreMemory 记录 100 万个 URL 后扫描进程的堆内存占用
+// Redis 模式下集合保存在 Redis 服务端（基准测试中为不保存成员的模拟服务），只统计客户端内存
+func BenchmarkDedupStoreMemory(b *testing.B) {
+	const n = 1000000
+	urls := make([]string, n)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://www.example.com/api/v1/items/%d?page=%d&sort=desc", i, i%50)
+	}
+
+	server := newFakeRedis(b, true)
+	client := server.client()
+	defer client.Close()
+
+	modes := []struct {
+		name  string
+		store func() pipeline.DedupStore
+	}{
+		{"memory", func() pipeline.DedupStore { return pipeline.NewMemoryDedupStore() }},
+		{"bloom", func() pipeline.DedupStore { return pipeline.NewBloomDedupStore(pipeline.DefaultDedupBloomFPRate) }},
+		{"redis", func() pipeline.DedupStore { return pipeline.NewRedisDedupStore(client, "bench", "Crawler", 0) }},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			var heap float64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				store := mode.store()
+				for _, u := range urls {
+					store.Add(pipeline.DedupKindURL, u)
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heap = float64(after.HeapAlloc-min(before.HeapAlloc, after.HeapAlloc)) / (1 << 20)
+				runtime.KeepAlive(store)
+				store.Close()
+			}
+			b.ReportMetric(heap, "heap-MB")
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== 目录扫描软 404 过滤测试 ==========
+
+// soft404SprayResult 300 条相同响应的路径 + 5 条不同的路径 + 命中白名单的 .git/config（与软 404 响应相同）
+func soft404SprayResult() *webscan.SprayResult {
+	result := &webscan.SprayResult{Target: "http://shop.example.com"}
+	for i := 0; i < 300; i++ {
+		result.Results = append(result.Results, webscan.SprayEntry{
+			URL:        fmt.Sprintf("http://shop.example.com/random-%d", i),
+			Path:       fmt.Sprintf("/random-%d", i),
+			StatusCode: 200,
+			BodyLength: 1534,
+		})
+	}
+	distinct := []webscan.SprayEntry{
+		{Path: "/admin", StatusCode: 302, BodyLength: 0},
+		{Path: "/login", StatusCode: 200, BodyLength: 4210},
+		{Path: "/api", StatusCode: 401, BodyLength: 58},
+		{Path: "/static", StatusCode: 403, BodyLength: 162},
+		{Path: "/backup.zip", StatusCode: 200, BodyLength: 1534, Hashes: map[string]string{"md5": "0cc175b9c0f1b6a831c399e269772661"}},
+	}
+	for _, e := range distinct {
+		e.URL = "http://shop.example.com" + e.Path
+		result.Results = append(result.Results, e)
+	}
+	result.Results = append(result.Results, webscan.SprayEntry{
+		URL: "http://shop.example.com/.git/config", Path: "/.git/config", StatusCode: 200, BodyLength: 1534,
+	})
+	return result
+}
+
+// TestDirScanSoft404Drop 超过阈值的相同响应被丢弃，不同的路径和白名单路径保留且不标记
+func TestDirScanSoft404Drop(t *testing.T) {
+	printSeparator("目录扫描软 404 丢弃测试")
+
+	filter := pipeline.NewSoftNotFoundFilter(0, false)
+	kept, dropped := filter.FilterSprayResult(soft404SprayResult(), "http://shop.example.com")
+	if dropped != 300 {
+		t.Errorf("应丢弃 300 条相同响应, 实际 %d", dropped)
+	}
+	if len(kept) != 6 {
+		t.Fatalf("应保留 5 条不同的路径和 .git/config, 实际 %d: %+v", len(kept), kept)
+	}
+	outputs := make(map[string]bool)
+	for _, r := range kept {
+		if r.Suspicious {
+			t.Errorf("保留的结果不应标记: %s", r.Output)
+		}
+		outputs[r.Output] = true
+	}
+	for _, path := range []string{"/admin", "/login", "/api", "/static", "/backup.zip", "/.git/config"} {
+		if !outputs["http://shop.example.com"+path] {
+			t.Errorf("缺少 %s", path)
+		}
+	}
+}
+
+// TestDirScanSoft404Tag 标记模式保留全部结果，只有相同响应组标记 Suspicious；未超过阈值的不标记
+func TestDirScanSoft404Tag(t *testing.T) {
+	printSeparator("目录扫描软 404 标记测试")
+
+	filter := pipeline.NewSoftNotFoundFilter(20, true)
+	kept, dropped := filter.FilterSprayResult(soft404SprayResult(), "http://shop.example.com")
+	suspicious := 0
+	for _, r := range kept {
+		if r.Suspicious {
+			suspicious++
+		}
+	}
+	if dropped != 0 || len(kept) != 306 || suspicious != 300 {
+		t.Errorf("标记模式应保留全部 306 条并标记 300 条, 实际 kept=%d suspicious=%d dropped=%d", len(kept), suspicious, dropped)
+	}
+
+	// 同样的响应只有 20 条时不超过阈值
+	few := &webscan.SprayResult{}
+	for i := 0; i < 20; i++ {
+		few.Results = append(few.Results, webscan.SprayEntry{
+			URL: fmt.Sprintf("http://a.example.com/p%d", i), Path: fmt.Sprintf("/p%d", i), StatusCode: 200, BodyLength: 10,
+		})
+	}
+	kept, _ = pipeline.NewSoftNotFoundFilter(20, true).FilterSprayResult(few, "http://a.example.com")
+	for _, r := range kept {
+		if r.Suspicious {
+			t.Fatalf("未超过阈值不应标记: %s", r.Output)
+		}
+	}
+	if len(kept) != 20 {
+		t.Errorf("应保留 20 条, 实际 %d", len(kept))
+	}
+}
+
+// TestDirScanSoft404BatchTag 批量模式边扫描边转发时，标记模式下整组软 404 都被标记，包括超过阈值前收到的结果
+func TestDirScanSoft404BatchTag(t *testing.T) {
+	printSeparator("目录扫描批量模式软 404 标记测试")
+
+	body := sprayLine("/console", 401)
+	for i := 0; i < 25; i++ {
+		body += sprayLine(fmt.Sprintf("/random-%d", i), 200)
+	}
+	scanner := writeFakeSpray(t, body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out := make(chan interface{}, 50)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 50))
+	module := pipeline.NewDirScanModule(ctx, collector, 2, nil)
+	module.SetSprayScanner(scanner)
+	module.SetSoftNotFound(20, true)
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test"}
+	close(input)
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("目录扫描失败: %v", err)
+	}
+
+	total, suspicious := 0, 0
+	for len(out) > 0 {
+		u, ok := (<-out).(pipeline.UrlResult)
+		if !ok {
+			continue
+		}
+		total++
+		if u.Suspicious {
+			suspicious++
+		} else if u.StatusCode != 401 {
+			t.Errorf("软 404 的结果应标记: %s", u.Output)
+		}
+	}
+	if total != 26 || suspicious != 25 {
+		t.Errorf("应输出 26 条并标记 25 条, 实际 %d / %d", total, suspicious)
+	}
+}
+
+// TestSoftNotFoundFlushIdle 空闲的分组先转发，已转发的结果计入分组数量
+func TestSoftNotFoundFlushIdle(t *testing.T) {
+	printSeparator("软 404 空闲分组转发测试")
+
+	filter := pipeline.NewSoftNotFoundFilter(3, true)
+	entry := func(i int) (webscan.SprayEntry, pipeline.UrlResult) {
+		e := webscan.SprayEntry{URL: fmt.Sprintf("http://a.example.com/p%d", i), Path: fmt.Sprintf("/p%d", i), StatusCode: 200, BodyLength: 10}
+		return e, pipeline.UrlResult{Output: e.URL}
+	}
+	for i := 0; i < 2; i++ {
+		if ready, _ := filter.Add(entry(i)); len(ready) != 0 {
+			t.Fatalf("未超过阈值的结果应缓存")
+		}
+	}
+	if ready := filter.FlushIdle(time.Hour); len(ready) != 0 {
+		t.Errorf("仍在收到结果的分组不应转发: %d", len(ready))
+	}
+	ready := filter.FlushIdle(0)
+	if len(ready) != 2 || ready[0].Suspicious {
+		t.Fatalf("空闲的分组应转发且不标记: %+v", ready)
+	}
+	filter.Add(entry(2))
+	ready, _ = filter.Add(entry(3))
+	if len(ready) != 2 || !ready[0].Suspicious || !ready[1].Suspicious {
+		t.Errorf("超过阈值时缓存的结果应一起标记: %+v", ready)
+	}
+	if rest := filter.Flush(); len(rest) != 0 {
+		t.Errorf("超过阈值的分组不应再有缓存: %d", len(rest))
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"moongazing/service/pipeline"
+)
+
+// ========== 目录扫描状态码过滤测试 ==========
+
+// runDirScanStatus 用模拟 spray 运行目录扫描模块，batch 选择批量或流式模式，按路径返回转发的结果
+func runDirScanStatus(t *testing.T, body string, batch bool, include, exclude []int) map[int]pipeline.UrlResult {
+	t.Helper()
+	scanner := writeFakeSpray(t, body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 20)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 20))
+	module := pipeline.NewDirScanModule(ctx, collector, 2, nil)
+	module.SetSprayScanner(scanner)
+	module.SetBatchMode(batch, 0)
+	module.SetStatusFilter(include, exclude)
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test"}
+	close(input)
+
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("目录扫描失败: %v", err)
+	}
+	results := make(map[int]pipeline.UrlResult)
+	for len(out) > 0 {
+		if u, ok := (<-out).(pipeline.UrlResult); ok {
+			if _, dup := results[u.StatusCode]; dup {
+				t.Errorf("状态码 %d 重复输出: %+v", u.StatusCode, u)
+			}
+			results[u.StatusCode] = u
+		}
+	}
+	return results
+}
+
+// dirScanStatusBody 每个状态码一条结果，根路径为整站 401
+func dirScanStatusBody() string {
+	return sprayLine("/", 401) +
+		sprayLine("/admin", 200) +
+		sprayLine("/old", 302) +
+		sprayLine("/upload", 405) +
+		sprayLine("/debug", 500) +
+		sprayLine("/missing", 404)
+}
+
+// TestDirScanStatusDefault 默认保留 2xx、3xx、401、403、405、500，只有需要关注的状态码标记 Interesting
+func TestDirScanStatusDefault(t *testing.T) {
+	printSeparator("目录扫描默认状态码测试")
+
+	filter := pipeline.NewDirScanStatusFilter(nil, nil)
+	for _, code := range []int{200, 204, 301, 302, 401, 403, 405, 500} {
+		if !filter.Accept(code) {
+			t.Errorf("默认应保留 %d", code)
+		}
+	}
+	for _, code := range []int{400, 404, 429, 502} {
+		if filter.Accept(code) {
+			t.Errorf("默认不应保留 %d", code)
+		}
+	}
+	if pipeline.NewDirScanStatusFilter(nil, []int{403}).Accept(403) {
+		t.Error("排除的状态码不应保留")
+	}
+
+	results := runDirScanStatus(t, dirScanStatusBody(), false, nil, nil)
+	if len(results) != 5 {
+		t.Fatalf("默认应保留 5 条结果（不含 404）: %+v", results)
+	}
+	for code, r := range results {
+		if r.Interesting != pipeline.IsInterestingStatus(code) {
+			t.Errorf("状态码 %d 的 Interesting 标记错误: %+v", code, r)
+		}
+	}
+	if root := results[401]; root.NormalizedURL != "http://app.example.test/" {
+		t.Errorf("整站 401 的根路径应保留: %+v", root)
+	}
+}
+
+// TestDirScanStatusCustomInclude 自定义状态码在批量和流式模式下一致生效
+func TestDirScanStatusCustomInclude(t *testing.T) {
+	printSeparator("目录扫描自定义状态码测试")
+
+	for _, batch := range []bool{true, false} {
+		results := runDirScanStatus(t, dirScanStatusBody(), batch, []int{302, 401, 405, 500}, []int{405})
+		if len(results) != 3 {
+			t.Fatalf("batch=%v 应只保留 302、401、500: %+v", batch, results)
+		}
+		if r, ok := results[302]; !ok || r.Interesting || r.NormalizedURL != "http://app.example.test/old" {
+			t.Errorf("batch=%v 302 应保留且不标记: %+v", batch, r)
+		}
+		for _, code := range []int{401, 500} {
+			if r, ok := results[code]; !ok || !r.Interesting {
+				t.Errorf("batch=%v %d 应保留并标记 Interesting: %+v", batch, code, r)
+			}
+		}
+		if _, ok := results[200]; ok {
+			t.Errorf("batch=%v 不在自定义列表中的 200 不应保留", batch)
+		}
+	}
+
+	// 根路径状态码不需要关注时仍跳过
+	results := runDirScanStatus(t, sprayLine("/", 200)+sprayLine("/admin", 200), true, nil, nil)
+	if len(results) != 1 || results[200].NormalizedURL != "http://app.example.test/admin" {
+		t.Errorf("状态码 200 的根路径应跳过: %+v", results)
+	}
+}
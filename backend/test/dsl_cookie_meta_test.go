@@ -0,0 +1,126 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== DSL cookie / meta 匹配测试 ==========
+
+const cookieMetaRules = `Laravel:
+  dsl:
+    - "cookie('laravel_session')"
+  category: Framework
+
+WordPress:
+  dsl:
+    - "cookie('wordpress_logged_in_*')"
+    - "meta('generator', 'WordPress')"
+
+Java:
+  dsl:
+    - "cookie('JSESSIONID', 'node0')"
+
+Drupal:
+  dsl:
+    - "meta('Generator', 'drupal')"
+  category: CMS
+
+OpenGraph:
+  dsl:
+    - "meta('og:site_name', 'shop')"
+
+bad-meta:
+  dsl:
+    - "meta('generator')"
+`
+
+// matchedRules 返回匹配到的规则名（排序后）
+func matchedRules(engine *fingerprint.DSLEngine, resp *fingerprint.HTTPResponse) []string {
+	var names []string
+	for _, m := range engine.AnalyzeResponse(resp) {
+		names = append(names, m.RuleName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestDSLCookieAndMetaMatchers 多个 Set-Cookie、带属性的 Cookie，单双引号的 meta 标签
+func TestDSLCookieAndMetaMatchers(t *testing.T) {
+	printSeparator("DSL cookie / meta 匹配测试")
+
+	engine := fingerprint.NewDSLEngine()
+	if err := engine.LoadRulesFromFile(writeRulesFile(t, t.TempDir(), "finger.yaml", cookieMetaRules)); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+	if engine.RulesCount() != 5 {
+		t.Fatalf("meta 缺少 content 参数的规则应跳过: %v", engine.ListRules())
+	}
+
+	cookies := fingerprint.ParseSetCookies([]string{
+		"XSRF-TOKEN=abc; Path=/; Expires=Wed, 21 Oct 2026 07:28:00 GMT; Secure",
+		"laravel_session=eyJpdiI6; Path=/; HttpOnly; SameSite=Lax",
+		"JSESSIONID=node01abc.node0; Path=/app; HttpOnly",
+	})
+	if len(cookies) != 3 || cookies["laravel_session"] != "eyJpdiI6" || cookies["JSESSIONID"] != "node01abc.node0" {
+		t.Fatalf("Set-Cookie 解析不正确: %v", cookies)
+	}
+
+	got := matchedRules(engine, &fingerprint.HTTPResponse{Cookies: cookies})
+	if len(got) != 2 || got[0] != "Java" || got[1] != "Laravel" {
+		t.Errorf("应按 Cookie 名称和值匹配: %v", got)
+	}
+
+	// Cookie 名称不在原始 header 文本中做子串匹配
+	got = matchedRules(engine, &fingerprint.HTTPResponse{
+		Headers: map[string]string{"Set-Cookie": "laravel_session=x"},
+		Cookies: map[string]string{"not_laravel_session_x": "1", "wordpress_logged_in_5f3a": "admin"},
+	})
+	if len(got) != 1 || got[0] != "WordPress" {
+		t.Errorf("应只按解析后的 Cookie 匹配，支持名称前缀: %v", got)
+	}
+
+	body := `<html><head>
+<meta name='generator' content='WordPress 6.4.2'>
+<meta content="Drupal 10 (https://www.drupal.org)" name="Generator">
+<meta property="og:site_name" content="My Shop">
+</head></html>`
+	got = matchedRules(engine, &fingerprint.HTTPResponse{Body: body})
+	if len(got) != 3 || got[0] != "Drupal" || got[1] != "OpenGraph" || got[2] != "WordPress" {
+		t.Errorf("应匹配单双引号、任意属性顺序的 meta 标签: %v", got)
+	}
+	if got := matchedRules(engine, &fingerprint.HTTPResponse{Body: `<p>meta name="generator" content="WordPress"</p>`}); len(got) != 0 {
+		t.Errorf("正文中的文字不是 meta 标签: %v", got)
+	}
+}
+
+// TestFingerprintScannerCookies 扫描时把响应的 Set-Cookie 传给 DSL 引擎
+func TestFingerprintScannerCookies(t *testing.T) {
+	printSeparator("指纹扫描 Cookie 测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: "t", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "laravel_session", Value: "s", Path: "/", HttpOnly: true})
+		w.Write([]byte("<html><title>app</title></html>"))
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.DSLEngine = fingerprint.NewDSLEngine()
+	if err := scanner.DSLEngine.LoadRulesFromFile(writeRulesFile(t, t.TempDir(), "finger.yaml", cookieMetaRules)); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+	found := false
+	for _, fp := range result.Fingerprints {
+		found = found || fp.Name == "Laravel"
+	}
+	if !found {
+		t.Errorf("应通过 Cookie 识别 Laravel: %+v", result.Fingerprints)
+	}
+}
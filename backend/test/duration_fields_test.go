@@ -0,0 +1,126 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/portscan"
+	"moongazing/scanner/subdomain"
+	"moongazing/scanner/subdomain/thirdparty"
+	"moongazing/scanner/vulnscan"
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ========== 耗时字段检查 ==========
+
+// serializedResultTypes 写入数据库或通过接口返回的结果结构
+var serializedResultTypes = []interface{}{
+	models.ScanResult{},
+	models.Task{},
+	models.ToolRun{},
+	models.CruiseLog{},
+	core.ToolRun{},
+	fingerprint.FingerprintResult{},
+	portscan.CSegmentResult{},
+	subdomain.DomainScanResult{},
+	thirdparty.SubdomainResult{},
+	vulnscan.VulnScanResult{},
+	vulnscan.BruteForceResult{},
+	webscan.CrawlerResult{},
+	webscan.KatanaResult{},
+	webscan.RadResult{},
+	webscan.SprayResult{},
+	webscan.HttpxResult{},
+	webscan.SensitiveResult{},
+	pipeline.SubdomainResult{},
+	pipeline.AssetHttp{},
+	pipeline.UrlResult{},
+	pipeline.SensitiveInfoResult{},
+	pipeline.VulnResult{},
+	pipeline.ProgressReport{},
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// checkDurationFields 递归检查结构中的耗时字段：不能是 time.Duration，名称含耗时含义的字段必须是 int64 且 JSON 键以 _ms 结尾
+func checkDurationFields(t *testing.T, typ reflect.Type, path string, seen map[reflect.Type]bool) {
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		checkDurationFields(t, typ.Elem(), path, seen)
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	if seen[typ] || !strings.HasPrefix(typ.PkgPath(), "moongazing") {
+		return
+	}
+	seen[typ] = true
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := path + "." + field.Name
+		jsonKey := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonKey == "-" {
+			continue
+		}
+		if field.Type == durationType {
+			t.Errorf("%s 是 time.Duration，应改为 int64 毫秒字段", name)
+			continue
+		}
+		if strings.Contains(field.Name, "Duration") || strings.HasSuffix(field.Name, "TimeMs") || field.Name == "ScanTime" || field.Name == "ResponseTime" {
+			if field.Type.Kind() != reflect.Int64 || !strings.HasSuffix(field.Name, "Ms") || !strings.HasSuffix(jsonKey, "_ms") {
+				t.Errorf("%s (%s, json:%q) 应为 int64 且以 Ms/_ms 结尾", name, field.Type, jsonKey)
+			}
+		}
+		checkDurationFields(t, field.Type, name, seen)
+	}
+}
+
+// TestNoBareDurationFields 可序列化的结果结构中不保留 time.Duration 或字符串形式的耗时
+func TestNoBareDurationFields(t *testing.T) {
+	printSeparator("耗时字段检查")
+
+	seen := make(map[reflect.Type]bool)
+	for _, v := range serializedResultTypes {
+		typ := reflect.TypeOf(v)
+		checkDurationFields(t, typ, typ.String(), seen)
+	}
+}
+
+// TestDurationMsFallback 旧巡航日志以秒保存的耗时换算为毫秒
+func TestDurationMsFallback(t *testing.T) {
+	printSeparator("耗时旧数据兼容测试")
+
+	raw, err := bson.Marshal(bson.M{"duration": int64(90)})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var stored models.CruiseLog
+	if err := bson.Unmarshal(raw, &stored); err != nil || stored.ElapsedMs() != 90000 {
+		t.Errorf("读取旧巡航日志应按秒换算, 实际 %d (%v)", stored.ElapsedMs(), err)
+	}
+
+	legacy := models.CruiseLog{LegacyDurationSec: 90}
+	if legacy.ElapsedMs() != 90000 {
+		t.Errorf("旧巡航日志应按秒换算, 实际 %d", legacy.ElapsedMs())
+	}
+	current := models.CruiseLog{DurationMs: 1234, LegacyDurationSec: 90}
+	if current.ElapsedMs() != 1234 {
+		t.Errorf("有毫秒字段时应直接使用, 实际 %d", current.ElapsedMs())
+	}
+	if core.MillisDuration(core.Millis(1500*time.Millisecond)) != 1500*time.Millisecond {
+		t.Errorf("毫秒换算不一致")
+	}
+}
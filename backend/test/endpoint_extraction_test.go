@@ -0,0 +1,313 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== OpenAPI/JS 接口提取测试 ==========
+
+const swagger2Fixture = `{
+  "swagger": "2.0",
+  "info": {"title": "Pet Store", "version": "1.0"},
+  "host": "petstore.example.com",
+  "basePath": "/v2",
+  "schemes": ["https", "http"],
+  "paths": {
+    "/pet": {
+      "post": {"summary": "Add a pet"},
+      "put": {"summary": "Update a pet"}
+    },
+    "/pet/{petId}": {
+      "parameters": [{"name": "petId", "in": "path", "required": true}],
+      "get": {"summary": "Find pet by ID"},
+      "delete": {"summary": "Delete a pet"}
+    },
+    "/user/login": {
+      "get": {"summary": "Log in"}
+    }
+  }
+}`
+
+const openAPI3Fixture = `{
+  "openapi": "3.0.1",
+  "info": {"title": "Orders", "version": "3.1"},
+  "servers": [
+    {"url": "/api/{version}", "variables": {"version": {"default": "v3"}}},
+    {"url": "https://staging.example.com/api/v3"}
+  ],
+  "paths": {
+    "/orders": {
+      "get": {"operationId": "listOrders"},
+      "post": {"operationId": "createOrder"}
+    },
+    "/orders/{id}": {
+      "summary": "Single order",
+      "patch": {"operationId": "updateOrder"}
+    }
+  }
+}`
+
+// jsBundleFixture 压缩后的 webpack 产物片段
+const jsBundleFixture = `!function(e){var t={};function n(r){if(t[r])return t[r].exports}n.p="/static/"}([function(e,t,n){` +
+	`var r=n(1),o="/api/v1/users",i='/api/v1/orders?status=open',a=r.get("api/v1/profile/settings");` +
+	"var s=`/api/v1/search`;" +
+	`fetch("./internal/health.json").then(function(e){return e.json()});` +
+	`var c={"Content-Type":"application/json",Accept:"text/html"},u="MM/DD/YYYY";` +
+	`var l="https://cdn.other-site.com/lib/track.js",d="//fonts.example.net/css/app.css",p="/static/img/logo.png";` +
+	`var f="/";e.exports={login:"/auth/login.action",logout:"/auth/logout"}}]);`
+
+// TestParseOpenAPI Swagger 2.0 按 host/basePath 拼接接口地址，OpenAPI 3 按第一个 servers 地址拼接
+func TestParseOpenAPI(t *testing.T) {
+	printSeparator("OpenAPI 文档解析测试")
+
+	endpoints, err := webscan.ParseOpenAPI([]byte(swagger2Fixture), "http://app.example.com/v2/api-docs")
+	if err != nil {
+		t.Fatalf("解析 Swagger 2.0 文档失败: %v", err)
+	}
+	want := []webscan.ExtractedEndpoint{
+		{URL: "https://petstore.example.com/v2/pet", Method: "POST"},
+		{URL: "https://petstore.example.com/v2/pet", Method: "PUT"},
+		{URL: "https://petstore.example.com/v2/pet/{petId}", Method: "DELETE"},
+		{URL: "https://petstore.example.com/v2/pet/{petId}", Method: "GET"},
+		{URL: "https://petstore.example.com/v2/user/login", Method: "GET"},
+	}
+	assertEndpoints(t, endpoints, want)
+
+	endpoints, err = webscan.ParseOpenAPI([]byte(openAPI3Fixture), "https://shop.example.com/docs/openapi.json")
+	if err != nil {
+		t.Fatalf("解析 OpenAPI 3 文档失败: %v", err)
+	}
+	want = []webscan.ExtractedEndpoint{
+		{URL: "https://shop.example.com/api/v3/orders", Method: "GET"},
+		{URL: "https://shop.example.com/api/v3/orders", Method: "POST"},
+		{URL: "https://shop.example.com/api/v3/orders/{id}", Method: "PATCH"},
+	}
+	assertEndpoints(t, endpoints, want)
+
+	// 未声明 host 时使用文档地址
+	endpoints, err = webscan.ParseOpenAPI([]byte(`{"swagger":"2.0","paths":{"/ping":{"get":{}}}}`), "http://10.0.0.5:8080/swagger.json")
+	if err != nil || len(endpoints) != 1 || endpoints[0].URL != "http://10.0.0.5:8080/ping" {
+		t.Errorf("未声明 host 时应相对文档地址: %+v, %v", endpoints, err)
+	}
+
+	if _, err := webscan.ParseOpenAPI([]byte(`{"name":"not a spec"}`), "http://app.example.com/swagger.json"); err == nil {
+		t.Error("不是 OpenAPI 文档时应返回错误")
+	}
+}
+
+func assertEndpoints(t *testing.T, got, want []webscan.ExtractedEndpoint) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("接口数量 %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("接口 %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestExtractJSEndpoints JS 中的相对路径按资产地址解析，排除其他主机、静态资源和 MIME 类型等
+func TestExtractJSEndpoints(t *testing.T) {
+	printSeparator("JS 接口提取测试")
+
+	endpoints := webscan.ExtractJSEndpoints([]byte(jsBundleFixture), "http://app.example.com:8080")
+	got := make(map[string]bool)
+	for _, e := range endpoints {
+		if e.Method != "GET" {
+			t.Errorf("JS 接口的方法应为 GET: %+v", e)
+		}
+		got[e.URL] = true
+	}
+
+	for _, u := range []string{
+		"http://app.example.com:8080/api/v1/users",
+		"http://app.example.com:8080/api/v1/orders?status=open",
+		"http://app.example.com:8080/api/v1/profile/settings",
+		"http://app.example.com:8080/api/v1/search",
+		"http://app.example.com:8080/internal/health.json",
+		"http://app.example.com:8080/auth/login.action",
+		"http://app.example.com:8080/auth/logout",
+	} {
+		if !got[u] {
+			t.Errorf("应提取 %s，实际: %v", u, got)
+		}
+	}
+	for u := range got {
+		if strings.Contains(u, "other-site") || strings.Contains(u, "fonts.example.net") ||
+			strings.HasSuffix(u, ".png") || strings.Contains(u, "application") || strings.Contains(u, "YYYY") ||
+			u == "http://app.example.com:8080/" || strings.HasSuffix(u, "/static/") {
+			t.Errorf("不应提取 %s", u)
+		}
+	}
+}
+
+// TestEndpointDocKind 路径匹配且内容类型为 JSON 的 URL 解析为 OpenAPI 文档，.js 按 JS 文件提取
+func TestEndpointDocKind(t *testing.T) {
+	printSeparator("接口文档识别测试")
+
+	cases := []struct {
+		result pipeline.UrlResult
+		want   string
+	}{
+		{pipeline.UrlResult{Output: "http://a.example.com/v2/api-docs", ContentType: "application/json;charset=UTF-8"}, "openapi"},
+		{pipeline.UrlResult{Output: "http://a.example.com/swagger/v1/swagger.json"}, "openapi"},
+		{pipeline.UrlResult{Output: "http://a.example.com/openapi.json", ContentType: "application/json"}, "openapi"},
+		{pipeline.UrlResult{Output: "http://a.example.com/v2/api-docs", ContentType: "text/html"}, ""},
+		{pipeline.UrlResult{Output: "http://a.example.com/static/js/app.3f2a9c.js"}, "jsfinder"},
+		{pipeline.UrlResult{Output: "http://a.example.com/bundle", ContentType: "application/javascript"}, "jsfinder"},
+		{pipeline.UrlResult{Output: "http://a.example.com/swagger.json", Method: "POST", StateChanging: true}, ""},
+		{pipeline.UrlResult{Output: "http://a.example.com/index.html", ContentType: "text/html"}, ""},
+	}
+	for _, tc := range cases {
+		if got := pipeline.EndpointDocKind(tc.result); got != tc.want {
+			t.Errorf("EndpointDocKind(%s, %q) = %q, want %q", tc.result.Output, tc.result.ContentType, got, tc.want)
+		}
+	}
+}
+
+// newEndpointFixtureServer 提供 Swagger 文档、OpenAPI 文档和 JS 文件的测试服务器
+func newEndpointFixtureServer() *httptest.Server {
+	swagger := strings.Replace(swagger2Fixture, `"host": "petstore.example.com",`, "", 1)
+	swagger = strings.Replace(swagger, `"schemes": ["https", "http"],`, "", 1)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/api-docs":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(swagger))
+		case "/static/js/app.js":
+			w.Header().Set("Content-Type", "application/javascript")
+			// 与文档中已有的接口重复一次
+			w.Write([]byte(jsBundleFixture + `var q="/v2/user/login";`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// runEndpointModule 运行接口提取模块，返回输出的全部数据
+func runEndpointModule(t *testing.T, maxBodySize int64, inputs ...pipeline.UrlResult) []interface{} {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 100))
+	module := pipeline.NewEndpointModule(ctx, collector, 2)
+	module.SetMaxBodySize(maxBodySize)
+	module.SetURLDeduper(pipeline.NewURLDeduper(false))
+
+	input := make(chan interface{}, len(inputs))
+	for _, in := range inputs {
+		input <- in
+	}
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	var results []interface{}
+	for len(out) > 0 {
+		results = append(results, <-out)
+	}
+	return results
+}
+
+// TestEndpointModule 文档原样传递，提取到的接口记录来源文档，重复的接口和重复的文档只处理一次
+func TestEndpointModule(t *testing.T) {
+	printSeparator("接口提取模块测试")
+
+	server := newEndpointFixtureServer()
+	defer server.Close()
+
+	spec := pipeline.UrlResult{Input: server.URL, Output: server.URL + "/v2/api-docs", Source: "katana", ContentType: "application/json"}
+	bundle := pipeline.UrlResult{Input: server.URL, Output: server.URL + "/static/js/app.js", Source: "katana"}
+	page := pipeline.UrlResult{Input: server.URL, Output: server.URL + "/index.html", Source: "katana", ContentType: "text/html"}
+	results := runEndpointModule(t, 0, spec, bundle, page, spec)
+
+	forwarded := 0
+	bySource := map[string]int{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		u, ok := r.(pipeline.UrlResult)
+		if !ok {
+			continue
+		}
+		if u.Source == "katana" {
+			forwarded++
+			continue
+		}
+		bySource[u.Source]++
+		key := u.Method + " " + u.NormalizedURL
+		if seen[key] {
+			t.Errorf("接口重复输出: %s", key)
+		}
+		seen[key] = true
+
+		switch u.Source {
+		case "openapi":
+			if u.Parent != spec.Output {
+				t.Errorf("OpenAPI 接口的来源文档错误: %+v", u)
+			}
+			if u.StateChanging != (u.Method != "GET") {
+				t.Errorf("非 GET 接口应标记为可能改变状态: %+v", u)
+			}
+		case "jsfinder":
+			if u.Parent != bundle.Output || u.Method != "GET" || !strings.HasPrefix(u.Output, server.URL+"/") {
+				t.Errorf("JS 接口应相对资产地址解析并记录来源: %+v", u)
+			}
+		default:
+			t.Errorf("未知来源: %+v", u)
+		}
+	}
+	if forwarded != 4 {
+		t.Errorf("输入数据应原样传递: %d", forwarded)
+	}
+	// 文档和 JS 都包含 /v2/user/login，只由先处理的一方输出
+	if bySource["openapi"] < 4 || bySource["jsfinder"] < 7 || bySource["openapi"]+bySource["jsfinder"] != 12 {
+		t.Errorf("接口数 openapi=%d jsfinder=%d, want 共 12", bySource["openapi"], bySource["jsfinder"])
+	}
+	if !seen["GET "+server.URL+"/v2/user/login"] {
+		t.Errorf("应输出 /v2/user/login: %v", seen)
+	}
+	if !seen["GET "+strings.ToLower(server.URL)+"/v2/pet/{petId}"] && !seen["GET "+server.URL+"/v2/pet/%7BpetId%7D"] {
+		t.Errorf("应输出带路径参数的接口: %v", seen)
+	}
+
+	// 超过大小上限的文档跳过
+	results = runEndpointModule(t, 64, spec, bundle)
+	if len(results) != 2 {
+		t.Errorf("超过大小上限时只传递原始数据: %d", len(results))
+	}
+}
+
+// TestEndpointDedupFilter 同一路径的不同方法分别入库，并记录来源文档
+func TestEndpointDedupFilter(t *testing.T) {
+	printSeparator("接口入库去重测试")
+
+	taskID := primitive.NewObjectID()
+	get := service.DedupFilter(&models.ScanResult{TaskID: taskID, Type: models.ResultTypeURL, Data: bson.M{"url": "http://a.example.com/v2/pet", "method": "GET"}})
+	post := service.DedupFilter(&models.ScanResult{TaskID: taskID, Type: models.ResultTypeURL, Data: bson.M{"url": "http://a.example.com/v2/pet", "method": "post"}})
+	if post["data.method"] != "POST" {
+		t.Errorf("非 GET 接口应按方法区分: %v", post)
+	}
+	if _, ok := get["data.method"].(bson.M); !ok {
+		t.Errorf("GET 接口应与未记录方法的结果合并: %v", get)
+	}
+	if get["data.normalized_url"] != post["data.normalized_url"] {
+		t.Errorf("同一路径的标准化 URL 应相同: %v %v", get, post)
+	}
+}
@@ -0,0 +1,304 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/service/pipeline"
+)
+
+// ========== 模块扇出测试 ==========
+
+// fakeBranch 模拟分支模块：按模块链约定启动下游、转发 AssetHttp 并为每个资产输出一条结果
+type fakeBranch struct {
+	ctx      context.Context
+	name     string
+	input    chan interface{}
+	next     pipeline.ModuleRunner
+	delay    time.Duration // 每个资产的处理耗时
+	skip     bool          // 模拟工具不可用：不读取输入，关闭下游后直接返回
+	finished time.Time
+	mu       sync.Mutex
+}
+
+func newFakeBranch(ctx context.Context, name string, next pipeline.ModuleRunner, buffer int) *fakeBranch {
+	return &fakeBranch{ctx: ctx, name: name, next: next, input: make(chan interface{}, buffer)}
+}
+
+// send 发送到下游，ctx 取消时返回 false
+func (b *fakeBranch) send(data interface{}) bool {
+	select {
+	case <-b.ctx.Done():
+		return false
+	case b.next.GetInput() <- data:
+		return true
+	}
+}
+
+func (b *fakeBranch) ModuleRun() error {
+	if b.skip {
+		b.next.CloseInput()
+		return nil
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.next.ModuleRun()
+	}()
+	for data := range b.input {
+		if !b.send(data) {
+			break
+		}
+		if asset, ok := data.(pipeline.AssetHttp); ok {
+			select {
+			case <-b.ctx.Done():
+			case <-time.After(b.delay):
+			}
+			if !b.send(b.name + ":" + asset.URL) {
+				break
+			}
+		}
+	}
+	b.mu.Lock()
+	b.finished = time.Now()
+	b.mu.Unlock()
+	b.next.CloseInput()
+	wg.Wait()
+	return nil
+}
+
+func (b *fakeBranch) SetInput(ch chan interface{}) { b.input = ch }
+func (b *fakeBranch) GetInput() chan interface{}   { return b.input }
+func (b *fakeBranch) CloseInput()                  { close(b.input) }
+func (b *fakeBranch) GetName() string              { return b.name }
+
+func (b *fakeBranch) finishedAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.finished
+}
+
+// runTee 运行扇出模块，注入数据并收集合并后的输出，超时视为死锁
+func runTee(t *testing.T, ctx context.Context, tee *pipeline.TeeModule, inputs []interface{}, timeout time.Duration) bool {
+	t.Helper()
+	tee.SetInput(make(chan interface{}, 10))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tee.ModuleRun()
+	}()
+	go func() {
+		defer tee.CloseInput()
+		for _, data := range inputs {
+			select {
+			case <-ctx.Done():
+				return
+			case tee.GetInput() <- data:
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// collectStrings 读取收集模块输出中的全部数据，按字符串排序
+func collectStrings(out chan interface{}) []string {
+	var items []string
+	for len(out) > 0 {
+		switch v := (<-out).(type) {
+		case string:
+			items = append(items, v)
+		case pipeline.AssetHttp:
+			items = append(items, "asset:"+v.URL)
+		}
+	}
+	sort.Strings(items)
+	return items
+}
+
+// newTeeWithBranches 两个分支都只接收 AssetHttp，输出合并到结果收集模块
+func newTeeWithBranches(ctx context.Context, out chan interface{}, slowBuffer int) (*pipeline.TeeModule, *fakeBranch, *fakeBranch) {
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	tee := pipeline.NewTeeModule(ctx, collector)
+
+	isAsset := func(data interface{}) bool {
+		_, ok := data.(pipeline.AssetHttp)
+		return ok
+	}
+	var fast, slow *fakeBranch
+	tee.AddBranch(isAsset, func(next pipeline.ModuleRunner) pipeline.ModuleRunner {
+		fast = newFakeBranch(ctx, "crawl", next, 10)
+		return fast
+	})
+	tee.AddBranch(isAsset, func(next pipeline.ModuleRunner) pipeline.ModuleRunner {
+		slow = newFakeBranch(ctx, "dir", next, slowBuffer)
+		return slow
+	})
+	return tee, fast, slow
+}
+
+// TestTeeModuleFanOut 两个分支各收到一份资产，上游数据只到达下游一次，慢分支不拖住快分支
+func TestTeeModuleFanOut(t *testing.T) {
+	printSeparator("模块扇出测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 100)
+	tee, fast, slow := newTeeWithBranches(ctx, out, 10)
+	slow.delay = 50 * time.Millisecond
+
+	inputs := []interface{}{"a.example.com"}
+	for i := 1; i <= 4; i++ {
+		inputs = append(inputs, pipeline.AssetHttp{URL: fmt.Sprintf("http://h%d.example.com", i)})
+	}
+	if !runTee(t, ctx, tee, inputs, 10*time.Second) {
+		t.Fatal("扇出模块未结束")
+	}
+
+	got := collectStrings(out)
+	want := []string{"a.example.com"}
+	for i := 1; i <= 4; i++ {
+		url := fmt.Sprintf("http://h%d.example.com", i)
+		want = append(want, "asset:"+url, "crawl:"+url, "dir:"+url)
+	}
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("合并输出不符:\n got %v\nwant %v", got, want)
+	}
+
+	// 两个分支并行：快分支不需要等慢分支处理完
+	if !fast.finishedAt().Before(slow.finishedAt().Add(-100 * time.Millisecond)) {
+		t.Errorf("快分支应先于慢分支完成: fast=%v slow=%v", fast.finishedAt(), slow.finishedAt())
+	}
+}
+
+// TestTeeModuleUnavailableBranch 不读取输入就退出的分支不阻塞另一个分支，超过缓冲区的数据也能处理完
+func TestTeeModuleUnavailableBranch(t *testing.T) {
+	printSeparator("扇出分支不可用测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 200)
+	tee, _, dead := newTeeWithBranches(ctx, out, 1)
+	dead.skip = true
+
+	var inputs []interface{}
+	for i := 0; i < 50; i++ {
+		inputs = append(inputs, pipeline.AssetHttp{URL: fmt.Sprintf("http://h%d.example.com", i)})
+	}
+	if !runTee(t, ctx, tee, inputs, 10*time.Second) {
+		t.Fatal("分支不可用时扇出模块死锁")
+	}
+
+	crawled, assets := 0, 0
+	for _, item := range collectStrings(out) {
+		switch {
+		case len(item) > 6 && item[:6] == "crawl:":
+			crawled++
+		case len(item) > 6 && item[:6] == "asset:":
+			assets++
+		default:
+			t.Errorf("不可用的分支不应有输出: %s", item)
+		}
+	}
+	if crawled != 50 || assets != 50 {
+		t.Errorf("期望 50 条资产和 50 条爬虫结果, 实际 %d / %d", assets, crawled)
+	}
+}
+
+// TestTeeModuleStuckBranchCancel 分支卡住（不再读取输入）时，ctx 取消后所有分支和合并阶段都能退出
+func TestTeeModuleStuckBranchCancel(t *testing.T) {
+	printSeparator("扇出分支卡住取消测试")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan interface{}, 200)
+	tee, _, stuck := newTeeWithBranches(ctx, out, 1)
+	stuck.delay = time.Hour
+
+	var inputs []interface{}
+	for i := 0; i < 20; i++ {
+		inputs = append(inputs, pipeline.AssetHttp{URL: fmt.Sprintf("http://h%d.example.com", i)})
+	}
+
+	time.AfterFunc(300*time.Millisecond, cancel)
+	start := time.Now()
+	if !runTee(t, ctx, tee, inputs, 5*time.Second) {
+		t.Fatal("ctx 取消后扇出模块未退出")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("取消后退出耗时过长: %v", elapsed)
+	}
+}
+
+// TestStreamingPipelineFanOut 同时启用爬虫和目录扫描时经 FanOut 并行运行，非资产目标只到达结果一次
+// 测试环境中爬虫或 spray 不可用时分支直接退出，流水线仍然正常结束
+func TestStreamingPipelineFanOut(t *testing.T) {
+	printSeparator("流水线扇出测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{
+		WebCrawler:      true,
+		DirScan:         true,
+		WatchdogTimeout: 5 * time.Second,
+	})
+	var mu sync.Mutex
+	started := map[string]bool{}
+	pipe.SetEventHandler(func(e pipeline.Event) {
+		if e.Type == pipeline.EventModuleStart {
+			mu.Lock()
+			started[e.Module] = true
+			mu.Unlock()
+		}
+	})
+	targets := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if err := pipe.Start(targets); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	count := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range pipe.Results() {
+			count++
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("流水线未结束")
+	}
+
+	if err := pipe.Err(); err != nil && strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("分支不可用时流水线不应卡死: %v", err)
+	}
+	if count != len(targets) {
+		t.Errorf("期望 %d 条结果, 实际 %d", len(targets), count)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"FanOut", "Crawler", "DirScan"} {
+		if !started[name] {
+			t.Errorf("模块 %s 应已启动: %v", name, started)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/spaolacci/murmur3"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== Favicon 发现测试 ==========
+
+// expectedIconHash Shodan 风格的 mmh3：对 base64 编码后的图标计算
+func expectedIconHash(icon []byte) string {
+	return fmt.Sprintf("%d", int32(murmur3.Sum32([]byte(base64.StdEncoding.EncodeToString(icon)))))
+}
+
+// TestFaviconFromLinkTag 从 link 标签发现图标，相对路径按重定向后的地址和 base href 解析
+func TestFaviconFromLinkTag(t *testing.T) {
+	printSeparator("Favicon 发现测试")
+
+	icon := []byte("\x89PNG\r\n\x1a\nfake-png-favicon")
+	cdnIcon := []byte("\x89PNG\r\n\x1a\ncdn-favicon")
+	rootIcon := []byte("\x00\x00\x01\x00root-ico")
+	var mu sync.Mutex
+	requested := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/portal/index.html", http.StatusFound)
+		case "/portal/index.html":
+			w.Write([]byte(`<html><head><link rel="Shortcut Icon" href="../assets/fav.png"><title>Portal</title></head></html>`))
+		case "/assets/fav.png":
+			w.Write(icon)
+		case "/based/":
+			w.Write([]byte(`<html><head><base href="/cdn/v2/"><link rel="stylesheet" href="x.css"><link rel="apple-touch-icon" href="img/touch.png"></head></html>`))
+		case "/cdn/v2/img/touch.png":
+			w.Write(cdnIcon)
+		case "/plain/page":
+			w.Write([]byte(`<html><head><title>Plain</title></head></html>`))
+		case "/favicon.ico":
+			w.Write(rootIcon)
+		case "/inline/":
+			w.Write([]byte(`<html><head><link rel="icon" href="data:image/png;base64,` + base64.StdEncoding.EncodeToString(icon) + `"></head></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+	if result.IconHash == "" || result.IconHash != expectedIconHash(icon) {
+		t.Fatalf("应从 link 标签获取图标 hash: got %q want %s", result.IconHash, expectedIconHash(icon))
+	}
+	mu.Lock()
+	if requested["/assets/fav.png"] != 1 || requested["/favicon.ico"] != 0 {
+		t.Errorf("声明的图标应先于 /favicon.ico 请求: %v", requested)
+	}
+	mu.Unlock()
+
+	if result := scanner.ScanFingerprint(context.Background(), server.URL+"/based/"); result.IconHash != expectedIconHash(cdnIcon) {
+		t.Errorf("应按 base href 解析图标地址: %q", result.IconHash)
+	}
+
+	result = scanner.ScanFingerprint(context.Background(), server.URL+"/inline/")
+	if result.IconHash != expectedIconHash(icon) || result.IconMD5 == "" {
+		t.Errorf("data URI 图标应直接解码: %q", result.IconHash)
+	}
+	mu.Lock()
+	if requested["/favicon.ico"] != 0 {
+		t.Errorf("找到声明的图标后不应回退到 /favicon.ico: %v", requested)
+	}
+	mu.Unlock()
+
+	// 没有声明图标时回退到站点根目录的 /favicon.ico
+	result = scanner.ScanFingerprint(context.Background(), server.URL+"/plain/page")
+	if result.IconHash != expectedIconHash(rootIcon) {
+		t.Errorf("应回退到 /favicon.ico: %q", result.IconHash)
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 批量指纹识别取消测试 ==========
+
+// hangingServer 请求一直挂起，直到客户端断开或测试结束
+func hangingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		server.Close()
+	})
+	return server
+}
+
+// TestBatchFingerprintCancel 取消后不再启动排队中的目标，未扫描的目标标记为跳过
+func TestBatchFingerprintCancel(t *testing.T) {
+	printSeparator("批量指纹识别取消测试")
+
+	server := hangingServer(t)
+	targets := make([]string, 100)
+	for i := range targets {
+		targets[i] = server.URL
+	}
+
+	scanner := fingerprint.NewFingerprintScanner(5)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	start := time.Now()
+	results := scanner.BatchScanFingerprint(ctx, targets)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("取消后应尽快返回, 耗时 %v", elapsed)
+	}
+	if len(results) != len(targets) {
+		t.Fatalf("结果数应与目标数一致: %d", len(results))
+	}
+	skipped := 0
+	for i, r := range results {
+		if r == nil {
+			t.Fatalf("结果 %d 为空", i)
+		}
+		if r.Skipped {
+			skipped++
+			if r.Target != targets[i] || r.Error == "" {
+				t.Errorf("跳过的结果应带目标和原因: %+v", r)
+			}
+		}
+	}
+	if skipped != len(targets)-5 {
+		t.Errorf("只有已启动的 5 个目标被扫描, 跳过 %d", skipped)
+	}
+}
+
+// TestBatchFingerprintPerTargetTimeout 单个目标超过时间上限时结束，不影响其他目标
+func TestBatchFingerprintPerTargetTimeout(t *testing.T) {
+	printSeparator("单目标超时测试")
+
+	slow := hangingServer(t)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><title>fast</title></html>"))
+	}))
+	defer fast.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(2)
+	scanner.PerTargetTimeout = 500 * time.Millisecond
+
+	start := time.Now()
+	results := scanner.BatchScanFingerprint(context.Background(), []string{slow.URL, fast.URL})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("慢目标应在单目标超时后结束, 耗时 %v", elapsed)
+	}
+	if results[0].Skipped || results[0].StatusCode != 0 {
+		t.Errorf("超时的目标已启动扫描，不应标记为跳过: %+v", results[0])
+	}
+	if results[1].Title != "fast" {
+		t.Errorf("其他目标应正常扫描: %+v", results[1])
+	}
+}
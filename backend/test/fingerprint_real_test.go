@@ -202,7 +202,7 @@ func TestFingerprintScanner_SingleTarget(t *testing.T) {
 	t.Logf("Body Hash (MD5): %s", result.BodyHash)
 	t.Logf("Favicon Hash (MMH3): %s", result.IconHash)
 	t.Logf("Favicon MD5: %s", result.IconMD5)
-	t.Logf("扫描耗时: %dms", result.ScanTime)
+	t.Logf("扫描耗时: %dms", result.ScanTimeMs)
 
 	t.Log("\n--- HTTP Headers ---")
 	for k, v := range result.Headers {
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 指纹识别跳转链测试 ==========
+
+// TestFingerprintRedirectChain 三跳跳转链记录每一跳的 URL 和状态码，超过 MaxRedirects 时停在最后一跳
+func TestFingerprintRedirectChain(t *testing.T) {
+	printSeparator("指纹识别跳转链测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/home", http.StatusTemporaryRedirect)
+		case "/home":
+			fmt.Fprint(w, "<title>Home</title>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+	if result.Title != "Home" || result.StatusCode != 200 {
+		t.Fatalf("应跟随三跳跳转到最终页面: %+v", result)
+	}
+	if result.URL != server.URL || result.FinalURL != server.URL+"/home" {
+		t.Errorf("请求 URL 和最终 URL 应分别记录: %q -> %q", result.URL, result.FinalURL)
+	}
+	want := []fingerprint.RedirectHop{
+		{URL: server.URL, StatusCode: 301, Location: server.URL + "/a"},
+		{URL: server.URL + "/a", StatusCode: 302, Location: server.URL + "/b"},
+		{URL: server.URL + "/b", StatusCode: 307, Location: server.URL + "/home"},
+	}
+	if fmt.Sprint(result.RedirectChain) != fmt.Sprint(want) {
+		t.Errorf("跳转链不符:\n%v\n%v", result.RedirectChain, want)
+	}
+	if result.CrossOriginRedirect {
+		t.Error("同一主机内的跳转不应标记为跨域")
+	}
+
+	scanner.MaxRedirects = 2
+	result = scanner.ScanFingerprint(context.Background(), server.URL)
+	if result.StatusCode != 307 || result.FinalURL != server.URL+"/b" || len(result.RedirectChain) != 3 {
+		t.Errorf("超过 MaxRedirects 时应停在最后一跳并记录未跟随的跳转: %d %q %v",
+			result.StatusCode, result.FinalURL, result.RedirectChain)
+	}
+}
+
+// TestFingerprintCrossOriginRedirect 跳转到其他主机时标记跨域，默认不识别其他主机的页面
+func TestFingerprintCrossOriginRedirect(t *testing.T) {
+	printSeparator("指纹识别跨域跳转测试")
+
+	sso := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cdn-sso")
+		fmt.Fprint(w, "<title>SSO Login</title>")
+	}))
+	defer sso.Close()
+	// 同一个监听地址换用 localhost 作为其他主机
+	ssoURL := strings.Replace(sso.URL, "127.0.0.1", "localhost", 1)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		http.Redirect(w, r, ssoURL+"/login", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	result := scanner.ScanFingerprint(context.Background(), origin.URL)
+	if !result.CrossOriginRedirect {
+		t.Fatalf("应标记跨域跳转: %+v", result)
+	}
+	if result.Server != "nginx" || result.Title == "SSO Login" || result.FinalURL != origin.URL {
+		t.Errorf("默认不应识别其他主机的页面: server=%q title=%q final=%q", result.Server, result.Title, result.FinalURL)
+	}
+	if len(result.RedirectChain) != 1 || result.RedirectChain[0].Location != ssoURL+"/login" || result.RedirectChain[0].StatusCode != 302 {
+		t.Errorf("未跟随的跨域跳转应记录在跳转链中: %v", result.RedirectChain)
+	}
+
+	scanner.FollowForeignRedirects = true
+	result = scanner.ScanFingerprint(context.Background(), origin.URL)
+	if !result.CrossOriginRedirect || result.Title != "SSO Login" || result.FinalURL != ssoURL+"/login" {
+		t.Errorf("开启 FollowForeignRedirects 后应识别跳转后的页面并保留跨域标记: %+v", result)
+	}
+}
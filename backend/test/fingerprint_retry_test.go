@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 指纹识别临时错误重试测试 ==========
+
+// flakyListener 前 drop 个连接接受后立即关闭，之后正常处理
+type flakyListener struct {
+	net.Listener
+	mu       sync.Mutex
+	drop     int
+	accepted int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		l.mu.Lock()
+		l.accepted++
+		dropped := l.accepted <= l.drop
+		l.mu.Unlock()
+		if !dropped {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+func (l *flakyListener) connections() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.accepted
+}
+
+// flakyServer 前 drop 个连接被断开的 HTTP 服务，status 为正常响应的状态码
+func flakyServer(t *testing.T, drop, status int) (string, *flakyListener) {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := &flakyListener{Listener: inner, drop: drop}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, "<html><title>flaky</title></html>")
+	})}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	return "http://" + inner.Addr().String(), ln
+}
+
+// retryScanner 测试用的短重试间隔
+func retryScanner(attempts int) *fingerprint.FingerprintScanner {
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.Retry = fingerprint.RetryPolicy{Attempts: attempts, Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	return scanner
+}
+
+// TestFingerprintRetryTransient 前两次连接被断开，第三次成功
+func TestFingerprintRetryTransient(t *testing.T) {
+	printSeparator("指纹识别重试测试")
+
+	url, _ := flakyServer(t, 2, http.StatusOK)
+	result := retryScanner(3).ScanFingerprint(context.Background(), url)
+	if result.StatusCode != 200 || result.Attempts != 3 || result.Error != "" {
+		t.Errorf("重试后应成功: status=%d attempts=%d error=%q", result.StatusCode, result.Attempts, result.Error)
+	}
+	if result.Title != "flaky" || result.URL != url {
+		t.Errorf("应使用 http 的响应, 不应回退到 https: %+v", result)
+	}
+}
+
+// TestFingerprintRetryExhausted 重试用尽后记录错误，之后才回退到 https
+func TestFingerprintRetryExhausted(t *testing.T) {
+	printSeparator("指纹识别重试用尽测试")
+
+	url, ln := flakyServer(t, 100, http.StatusOK)
+	result := retryScanner(2).ScanFingerprint(context.Background(), url)
+	if result.StatusCode != 0 || !strings.Contains(result.Error, fingerprint.ErrRetriesExhausted.Error()) {
+		t.Errorf("重试用尽应记录错误: status=%d error=%q", result.StatusCode, result.Error)
+	}
+	// http 两次，https 回退两次
+	if result.Attempts != 4 || ln.connections() != 4 || !strings.HasPrefix(result.URL, "https://") {
+		t.Errorf("http 重试用尽后才回退到 https: attempts=%d connections=%d url=%s", result.Attempts, ln.connections(), result.URL)
+	}
+}
+
+// TestFingerprintNoRetryOnHTTPError 4xx/5xx 响应和非临时错误不重试
+func TestFingerprintNoRetryOnHTTPError(t *testing.T) {
+	printSeparator("指纹识别 HTTP 错误不重试测试")
+
+	url, ln := flakyServer(t, 0, http.StatusServiceUnavailable)
+	result := retryScanner(3).ScanFingerprint(context.Background(), url)
+	if result.StatusCode != 503 || result.Attempts != 1 || ln.connections() != 1 {
+		t.Errorf("503 响应不应重试: status=%d attempts=%d connections=%d", result.StatusCode, result.Attempts, ln.connections())
+	}
+
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.ECONNREFUSED, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{fingerprint.ErrSlowResponse, false},
+		{context.Canceled, false},
+		{errors.New("tls: bad certificate"), false},
+		{fmt.Errorf("Get \"http://127.0.0.1\": %w", errors.New("http: server closed idle connection")), true},
+	}
+	for _, c := range cases {
+		if got := fingerprint.IsTransientError(c.err); got != c.want {
+			t.Errorf("IsTransientError(%v) = %v, 期望 %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 指纹规则热加载和管理测试 ==========
+
+// generatedRules 生成 count 条规则，alpha 规则的 DSL 随 variant 变化但都匹配 body 中的 hello
+func generatedRules(variant string, count int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "alpha:\n  dsl:\n    - \"contains(body, 'hello')\"\n    - \"title('%s')\"\n  category: CMS\n", variant)
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&sb, "%s-rule-%d:\n  dsl:\n    - \"regex(body, '%s-marker-%d[0-9]+')\"\n", variant, i, variant, i)
+	}
+	return sb.String()
+}
+
+// TestDSLEngineReloadDuringAnalyze 重新加载期间 AnalyzeResponse 始终匹配完整的规则集
+func TestDSLEngineReloadDuringAnalyze(t *testing.T) {
+	printSeparator("规则重新加载并发测试")
+
+	dir := t.TempDir()
+	fileA := writeRulesFile(t, dir, "a.yaml", generatedRules("a", 200))
+	fileB := writeRulesFile(t, dir, "b.yaml", generatedRules("b", 50))
+
+	engine := fingerprint.NewDSLEngine()
+	if _, err := engine.ReloadRules(fileA); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+
+	resp := &fingerprint.HTTPResponse{StatusCode: 200, Body: "<html>hello a-marker-7123</html>", Title: "x"}
+	var stop atomic.Bool
+	var analyzed atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				matches := engine.AnalyzeResponse(resp)
+				found := false
+				for _, m := range matches {
+					found = found || m.RuleName == "alpha"
+				}
+				if !found {
+					select {
+					case errs <- fmt.Sprintf("重新加载期间未匹配到 alpha: %d 条匹配", len(matches)):
+					default:
+					}
+					return
+				}
+				if n := engine.RulesCount(); n != 201 && n != 51 {
+					select {
+					case errs <- fmt.Sprintf("规则数应为完整的旧规则集或新规则集: %d", n):
+					default:
+					}
+					return
+				}
+				analyzed.Add(1)
+			}
+		}()
+	}
+
+	for i := 0; i < 40; i++ {
+		file := fileA
+		if i%2 == 0 {
+			file = fileB
+		}
+		if _, err := engine.ReloadRules(file); err != nil {
+			t.Fatalf("重新加载失败: %v", err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+	if analyzed.Load() == 0 {
+		t.Error("重新加载期间应有识别请求完成")
+	}
+	if engine.RulesCount() != 201 {
+		t.Errorf("最后加载的是 a.yaml: %d", engine.RulesCount())
+	}
+}
+
+// TestCheckRule 提交的规则做静态检查并用合成响应试运行
+func TestCheckRule(t *testing.T) {
+	printSeparator("规则提交校验测试")
+
+	valid := &fingerprint.RuleDefinition{
+		Name:         "my-panel",
+		DSL:          []string{"title('Admin')", "regex(body, 'v([0-9.]+)')", "cookie('session')", "meta('generator', 'test')"},
+		Category:     "Panel",
+		VersionRegex: `Panel v([0-9.]+)`,
+	}
+	if problems := fingerprint.CheckRule(valid); len(problems) != 0 {
+		t.Errorf("合法规则不应有问题: %v", problems)
+	}
+
+	cases := map[string]*fingerprint.RuleDefinition{
+		"name is empty":    {DSL: []string{"title('x')"}},
+		"dsl is empty":     {Name: "a"},
+		"unknown function": {Name: "a", DSL: []string{"contians(body, 'x')"}},
+		"invalid regex":    {Name: "a", DSL: []string{"regex(body, 'a(b')"}},
+		"capture group":    {Name: "a", DSL: []string{"title('x')"}, VersionRegex: "v[0-9]+"},
+		"invalid status":   {Name: "a", DSL: []string{"status(ok)"}},
+		"unknown category": {Name: "a", DSL: []string{"title('x')"}, Category: "Toaster"},
+	}
+	for want, def := range cases {
+		problems := fingerprint.CheckRule(def)
+		if len(problems) == 0 || !strings.Contains(strings.Join(problems, "; "), want) {
+			t.Errorf("应发现问题 %q: %v", want, problems)
+		}
+	}
+}
+
+// TestRuleOnURL 对测试服务器试运行规则，返回每个 DSL 表达式的结果
+func TestRuleOnURL(t *testing.T) {
+	printSeparator("规则试运行测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/favicon.ico" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Server", "AcmeServer/2.4")
+		http.SetCookie(w, &http.Cookie{Name: "ACMESESSID", Value: "1"})
+		w.Write([]byte("<html><head><title>Acme Console</title></head><body>Powered by Acme v2.4.1</body></html>"))
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	def := &fingerprint.RuleDefinition{
+		Name:         "acme",
+		DSL:          []string{"title('Acme Console')", "header('Server', 'AcmeServer')", "cookie('ACMESESSID')"},
+		Condition:    "and",
+		VersionRegex: `Acme v([0-9.]+)`,
+	}
+	result := scanner.TestRuleOnURL(context.Background(), def.Rule(), server.URL)
+	if result.Error != "" || !result.Matched || result.Match.Version != "2.4.1" || result.Title != "Acme Console" || result.StatusCode != 200 {
+		t.Fatalf("规则应匹配并提取版本: %+v", result)
+	}
+	for _, expr := range result.Expressions {
+		if !expr.Matched {
+			t.Errorf("表达式应匹配: %+v", expr)
+		}
+	}
+
+	def.DSL = append(def.DSL, "contains(body, 'not on the page')")
+	result = scanner.TestRuleOnURL(context.Background(), def.Rule(), server.URL)
+	if result.Matched || len(result.Expressions) != 4 || result.Expressions[3].Matched || !result.Expressions[0].Matched {
+		t.Errorf("and 条件下有表达式不匹配时规则不匹配，并报告每个表达式的结果: %+v", result)
+	}
+
+	result = scanner.TestRuleOnURL(context.Background(), def.Rule(), "http://127.0.0.1:1")
+	if result.Error == "" || result.Matched {
+		t.Errorf("获取失败时应返回错误: %+v", result)
+	}
+}
+
+// useCustomRulesFile 把自定义规则文件指向临时目录，测试结束后恢复并重新加载共享规则
+func useCustomRulesFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "custom-rules.yaml")
+	fingerprint.SetCustomRulesFile(path)
+	t.Cleanup(func() {
+		fingerprint.SetCustomRulesFile("")
+		fingerprint.ReloadDefaultRules()
+	})
+	return path
+}
+
+// TestCustomRulesPrecedence 自定义规则保存到单独的文件，加载时覆盖同名内置规则，删除后恢复内置规则
+func TestCustomRulesPrecedence(t *testing.T) {
+	printSeparator("自定义规则优先级测试")
+
+	path := useCustomRulesFile(t)
+	engine := fingerprint.DefaultDSLEngine()
+	if _, err := fingerprint.ReloadDefaultRules(); err != nil {
+		t.Fatalf("加载内置规则失败: %v", err)
+	}
+	builtins := engine.RuleDefinitions()
+	if len(builtins) == 0 {
+		t.Fatal("应加载内置规则")
+	}
+	builtin := builtins[0]
+	if builtin.Custom || builtin.Source == "" {
+		t.Errorf("内置规则应记录所在文件: %+v", builtin)
+	}
+
+	// 覆盖同名内置规则
+	override := &fingerprint.RuleDefinition{Name: builtin.Name, DSL: []string{"contains(body, 'custom-override-marker')"}, Category: "CMS"}
+	if _, err := fingerprint.SaveCustomRule(override); err != nil {
+		t.Fatalf("保存自定义规则失败: %v", err)
+	}
+	got, ok := engine.RuleDefinition(builtin.Name)
+	if !ok || !got.Custom || len(got.DSL) != 1 || got.DSL[0] != override.DSL[0] {
+		t.Errorf("同名规则应以自定义规则为准: %+v", got)
+	}
+	if engine.RulesCount() != len(builtins) {
+		t.Errorf("覆盖同名规则不应增加规则数: %d -> %d", len(builtins), engine.RulesCount())
+	}
+	matches := engine.AnalyzeResponse(&fingerprint.HTTPResponse{StatusCode: 200, Body: "custom-override-marker"})
+	if len(matches) == 0 {
+		t.Error("自定义规则应参与识别")
+	}
+
+	// 新增规则
+	if _, err := fingerprint.SaveCustomRule(&fingerprint.RuleDefinition{Name: "zz-custom-app", DSL: []string{"title('ZZ App')"}}); err != nil {
+		t.Fatalf("保存自定义规则失败: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "zz-custom-app:") || !strings.Contains(string(data), builtin.Name+":") {
+		t.Errorf("自定义规则应写入单独的文件: %s, %v", data, err)
+	}
+
+	// 校验失败时不写入
+	_, err = fingerprint.SaveCustomRule(&fingerprint.RuleDefinition{Name: "broken", DSL: []string{"regex(body, 'a(b')"}})
+	var invalid *fingerprint.InvalidRuleError
+	if !errors.As(err, &invalid) || len(invalid.Problems) == 0 {
+		t.Errorf("非法规则应返回校验问题: %v", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Error("非法规则不应写入文件")
+	}
+
+	// 删除后恢复内置规则
+	if _, err := fingerprint.DeleteCustomRule(builtin.Name); err != nil {
+		t.Fatalf("删除自定义规则失败: %v", err)
+	}
+	if got, _ := engine.RuleDefinition(builtin.Name); got.Custom || len(got.DSL) != len(builtin.DSL) {
+		t.Errorf("删除后应恢复内置规则: %+v", got)
+	}
+	if _, err := fingerprint.DeleteCustomRule(builtin.Name); !errors.Is(err, fingerprint.ErrRuleNotFound) {
+		t.Errorf("规则不在自定义规则文件中时应返回 ErrRuleNotFound: %v", err)
+	}
+
+	// 扫描器的 Reload 读取手动修改的自定义规则文件
+	os.WriteFile(path, []byte("hand-edited:\n  dsl: \"title('Hand')\"\n"), 0644)
+	if _, err := fingerprint.NewFingerprintScanner(1).Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if _, ok := engine.RuleDefinition("hand-edited"); !ok {
+		t.Error("Reload 应加载自定义规则文件")
+	}
+	if _, ok := engine.RuleDefinition("zz-custom-app"); ok {
+		t.Error("Reload 应以文件内容为准")
+	}
+}
+
+// TestWatchDefaultRules 规则文件变化后自动重新加载
+func TestWatchDefaultRules(t *testing.T) {
+	printSeparator("规则文件变化自动加载测试")
+
+	path := useCustomRulesFile(t)
+	fingerprint.ReloadDefaultRules()
+	engine := fingerprint.DefaultDSLEngine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fingerprint.WatchDefaultRules(ctx, 20*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	os.WriteFile(path, []byte("watched-rule:\n  dsl:\n    - \"title('Watched')\"\n"), 0644)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := engine.RuleDefinition("watched-rule"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("规则文件变化后应自动重新加载")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("ctx 取消后应停止检查")
+	}
+}
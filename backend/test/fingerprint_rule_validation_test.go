@@ -0,0 +1,195 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 指纹规则校验测试 ==========
+
+// defectiveRules 每类问题各一条规则，只有 good-rule 合法
+const defectiveRules = `good-rule:
+  dsl:
+    - "contains(body, 'hello')"
+    - "regex(title, 'admin\\s+panel')"
+  condition: and
+  category: CMS
+
+empty-rule:
+
+empty-dsl:
+  dsl: []
+
+unknown-func:
+  dsl:
+    - "contians(body, 'typo')"
+
+bad-condition:
+  dsl:
+    - "title('x')"
+  condition: xor
+
+bad-category:
+  dsl:
+    - "title('x')"
+  category: Toaster
+
+bad-regex:
+  dsl:
+    - "regex(body, 'a(b')"
+
+bad-status:
+  dsl:
+    - "status(ok)"
+
+bad-target:
+  dsl:
+    - "contains(cookie, 'x')"
+
+malformed:
+  dsl:
+    - "contains body"
+
+bad-structure:
+  dsl:
+    - "title('x')"
+  condition: [and, or]
+`
+
+// defectChecks 规则名 -> 报告中应包含的错误信息
+var defectChecks = map[string]string{
+	"empty-rule":    "rule is empty",
+	"empty-dsl":     "dsl is empty",
+	"unknown-func":  "unknown function contians",
+	"bad-condition": "invalid condition",
+	"bad-category":  "unknown category",
+	"bad-regex":     "invalid regex",
+	"bad-status":    "invalid status code",
+	"bad-target":    "unknown match target",
+	"malformed":     "malformed expression",
+	"bad-structure": "invalid rule structure",
+}
+
+func writeRulesFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入规则文件失败: %v", err)
+	}
+	return path
+}
+
+// TestFingerprintRuleValidationReport 宽松模式跳过错误规则，报告包含文件、规则名、行号和错误
+func TestFingerprintRuleValidationReport(t *testing.T) {
+	printSeparator("指纹规则校验报告测试")
+
+	path := writeRulesFile(t, t.TempDir(), "finger.yaml", defectiveRules)
+	engine := fingerprint.NewDSLEngine()
+	if err := engine.LoadRulesFromFile(path); err != nil {
+		t.Fatalf("宽松模式不应返回错误: %v", err)
+	}
+	if engine.RulesCount() != 1 || engine.GetRule("good-rule") == nil {
+		t.Fatalf("只应加载合法规则, 实际 %v", engine.ListRules())
+	}
+
+	report := engine.ValidationReport()
+	if report.Loaded != 1 || report.Skipped != len(defectChecks) || len(report.Errors) != len(defectChecks) {
+		t.Fatalf("报告计数不正确: loaded=%d skipped=%d errors=%d", report.Loaded, report.Skipped, len(report.Errors))
+	}
+	found := make(map[string]fingerprint.RuleError)
+	for _, e := range report.Errors {
+		found[e.Rule] = e
+	}
+	for rule, want := range defectChecks {
+		e, ok := found[rule]
+		if !ok {
+			t.Errorf("报告缺少规则 %s", rule)
+			continue
+		}
+		if e.File != path || e.Line == 0 || !contains(e.Error, want) {
+			t.Errorf("%s 的错误不正确, 期望包含 %q: %+v", rule, want, e)
+		}
+	}
+
+	// 合法规则可以正常匹配
+	matches := engine.AnalyzeResponse(&fingerprint.HTTPResponse{Body: "hello", Title: "Admin  Panel"})
+	if len(matches) != 1 || matches[0].Category != "CMS" {
+		t.Errorf("合法规则应正常匹配: %+v", matches)
+	}
+
+	// 空文件作为文件级错误报告
+	empty := writeRulesFile(t, t.TempDir(), "empty.yaml", "# nothing here\n")
+	emptyEngine := fingerprint.NewDSLEngine()
+	emptyEngine.LoadRulesFromFile(empty)
+	if errs := emptyEngine.ValidationReport().Errors; len(errs) != 1 || errs[0].Rule != "" || !contains(errs[0].Error, "no rules") {
+		t.Errorf("空规则文件应报告文件级错误: %+v", errs)
+	}
+}
+
+// TestFingerprintRuleStrictMode 严格模式下任何错误都拒绝加载，重新加载失败时保留原有规则
+func TestFingerprintRuleStrictMode(t *testing.T) {
+	printSeparator("指纹规则严格模式测试")
+
+	dir := t.TempDir()
+	good := writeRulesFile(t, dir, "good.yaml", "only-good:\n  dsl:\n    - \"title('ok')\"\n")
+	bad := writeRulesFile(t, dir, "bad.yaml", defectiveRules)
+
+	engine := fingerprint.NewDSLEngine()
+	engine.SetStrict(true)
+	err := engine.LoadRulesFromFile(bad)
+	var validationErr *fingerprint.RuleValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Report.Errors) != len(defectChecks) {
+		t.Fatalf("严格模式应返回校验错误: %v", err)
+	}
+	if engine.RulesCount() != 0 {
+		t.Errorf("严格模式下有错误的文件不应加载任何规则: %d", engine.RulesCount())
+	}
+
+	if _, err := engine.ReloadRules(good); err != nil {
+		t.Fatalf("合法文件应加载成功: %v", err)
+	}
+	report, err := engine.ReloadRules(good, bad)
+	if err == nil || report == nil || !report.HasErrors() || report.Loaded != 0 {
+		t.Fatalf("严格模式重新加载应失败并返回报告: %v %+v", err, report)
+	}
+	if engine.RulesCount() != 1 || engine.GetRule("only-good") == nil {
+		t.Errorf("重新加载失败时应保留原有规则: %v", engine.ListRules())
+	}
+	if engine.ValidationReport().HasErrors() {
+		t.Errorf("状态中的报告应为最近一次成功的加载")
+	}
+
+	// 宽松模式重新加载：合法规则替换原有规则，错误记录在报告中
+	engine.SetStrict(false)
+	report, err = engine.ReloadRules(good, bad)
+	if err != nil || engine.RulesCount() != 2 || report.Loaded != 2 || report.Skipped != len(defectChecks) || len(report.Files) != 2 {
+		t.Errorf("宽松模式重新加载结果不正确: %v count=%d %+v", err, engine.RulesCount(), report)
+	}
+}
+
+// TestFingerprintShippedRulesValid 内置规则文件应通过校验
+func TestFingerprintShippedRulesValid(t *testing.T) {
+	printSeparator("内置指纹规则校验测试")
+
+	for _, name := range []string{"finger.yaml", "sensitive.yaml"} {
+		path := filepath.Join("..", "config", "dicts", "yaml", name)
+		if _, err := os.Stat(path); err != nil {
+			t.Skipf("规则文件不存在: %s", path)
+		}
+		engine := fingerprint.NewDSLEngine()
+		engine.SetStrict(true)
+		if err := engine.LoadRulesFromFile(path); err != nil {
+			var validationErr *fingerprint.RuleValidationError
+			if errors.As(err, &validationErr) {
+				for _, e := range validationErr.Report.Errors {
+					t.Errorf("%s:%d %s: %s", name, e.Line, e.Rule, e.Error)
+				}
+			}
+			t.Fatalf("%s 校验失败: %v", name, err)
+		}
+	}
+}
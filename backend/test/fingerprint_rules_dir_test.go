@@ -0,0 +1,138 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"moongazing/config"
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 指纹规则目录测试 ==========
+
+// TestFingerprintRulesSummary 默认目录加载时返回每个文件的规则数量
+func TestFingerprintRulesSummary(t *testing.T) {
+	printSeparator("指纹规则加载摘要测试")
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	summary := scanner.RulesSummary
+	if summary == nil || summary.Dir != config.DictYAMLDir() {
+		t.Fatalf("应返回默认规则目录的加载摘要: %+v", summary)
+	}
+	if summary.HasErrors() {
+		t.Errorf("默认规则目录不应有加载错误: %v", summary.Errors())
+	}
+
+	finger := summary.File("finger.yaml")
+	if finger == nil || finger.Embedded || finger.Loaded == 0 || finger.Loaded > scanner.DSLEngine.RulesCount() {
+		t.Errorf("finger.yaml 应从规则目录加载: %+v", finger)
+	}
+	if jslib := summary.File("jslib.yaml"); jslib == nil || jslib.Loaded != len(scanner.JSLibPatterns) || jslib.Loaded == 0 {
+		t.Errorf("jslib.yaml 加载数量应与 JS 库规则一致: %+v", jslib)
+	}
+	if favicon := summary.File("favicon.yaml"); favicon == nil || favicon.Loaded != len(scanner.FaviconHashes) {
+		t.Errorf("favicon.yaml 加载数量应与图标哈希一致: %+v", favicon)
+	}
+	for _, name := range []string{"sensitive.yaml", "ports.yaml", "service_banners.yaml"} {
+		if f := summary.File(name); f == nil || f.Loaded == 0 {
+			t.Errorf("%s 应已加载: %+v", name, f)
+		}
+	}
+}
+
+// TestFingerprintScannerWithRules 指定规则目录：规则只来自该目录，缺少的文件使用内置副本
+func TestFingerprintScannerWithRules(t *testing.T) {
+	printSeparator("指定指纹规则目录测试")
+
+	dir := t.TempDir()
+	writeRulesFile(t, dir, "finger.yaml", `acme-portal:
+  dsl:
+    - "contains(body, 'Acme Portal')"
+`)
+	writeRulesFile(t, dir, "jslib.yaml", `AcmeJS:
+  pattern: "acme[.-]?([\\d.]+)?\\.js"
+Broken:
+  pattern: "(unclosed"
+`)
+
+	scanner := fingerprint.NewFingerprintScannerWithRules(dir)
+	if scanner.DSLEngine == fingerprint.DefaultDSLEngine() {
+		t.Fatalf("指定规则目录的扫描器不应使用共享规则")
+	}
+	if n := scanner.DSLEngine.RulesCount(); n != 1 {
+		t.Errorf("期望只加载目录中的 1 条规则, 实际 %d", n)
+	}
+	if fingerprint.DefaultDSLEngine().RulesCount() <= 1 {
+		t.Errorf("共享规则不应被替换")
+	}
+
+	summary := scanner.RulesSummary
+	if summary.Dir != dir {
+		t.Errorf("摘要应记录指定的规则目录: %s", summary.Dir)
+	}
+	if f := summary.File("finger.yaml"); f == nil || f.Loaded != 1 || f.Embedded || f.Path != filepath.Join(dir, "finger.yaml") {
+		t.Errorf("finger.yaml 应从指定目录加载 1 条规则: %+v", f)
+	}
+	if f := summary.File("jslib.yaml"); f == nil || f.Loaded != 1 || f.Skipped != 1 || f.Error != "" {
+		t.Errorf("jslib.yaml 应加载 1 条并跳过 1 条错误规则: %+v", f)
+	}
+	for _, name := range []string{"favicon.yaml", "ports.yaml"} {
+		f := summary.File(name)
+		if f == nil || !f.Embedded || f.Loaded == 0 || f.Path != config.EmbeddedDictPrefix+name {
+			t.Errorf("%s 缺失时应使用内置副本: %+v", name, f)
+		}
+	}
+	if f := summary.File("sensitive.yaml"); f == nil || !strings.Contains(f.Error, "not found") {
+		t.Errorf("没有内置副本的文件缺失时应记录错误: %+v", f)
+	}
+	if f := summary.File("service_banners.yaml"); f == nil || f.Error == "" {
+		t.Errorf("没有内置副本的文件缺失时应记录错误: %+v", f)
+	}
+	if len(summary.Errors()) != 2 {
+		t.Errorf("期望 2 个文件加载错误, 实际 %v", summary.Errors())
+	}
+
+	// 重新加载同样只读取指定目录
+	writeRulesFile(t, dir, "finger.yaml", `acme-portal:
+  dsl:
+    - "contains(body, 'Acme Portal')"
+acme-admin:
+  dsl:
+    - "contains(body, 'Acme Admin')"
+`)
+	report, err := scanner.Reload()
+	if err != nil || report.Loaded != 2 || scanner.DSLEngine.RulesCount() != 2 {
+		t.Errorf("重新加载应读取指定目录的规则: %+v (%v)", report, err)
+	}
+}
+
+// TestFingerprintRulesEmbeddedFallback 空目录时使用内置的规则副本
+func TestFingerprintRulesEmbeddedFallback(t *testing.T) {
+	printSeparator("内置指纹规则测试")
+
+	scanner := fingerprint.NewFingerprintScannerWithRules(t.TempDir())
+	disk := fingerprint.NewFingerprintScanner(1).RulesSummary
+
+	for _, name := range []string{"finger.yaml", "jslib.yaml", "favicon.yaml", "ports.yaml"} {
+		f := scanner.RulesSummary.File(name)
+		if f == nil || !f.Embedded || f.Error != "" || f.Loaded == 0 {
+			t.Errorf("%s 应从内置副本加载: %+v", name, f)
+			continue
+		}
+		// 共享规则可能被同名自定义规则覆盖，finger.yaml 不比较数量
+		if want := disk.File(name); name != "finger.yaml" && want != nil && want.Loaded != f.Loaded {
+			t.Errorf("%s 内置副本应与规则目录一致: %d != %d", name, f.Loaded, want.Loaded)
+		}
+	}
+	if scanner.DSLEngine.RulesCount() == 0 || len(scanner.JSLibPatterns) == 0 || len(scanner.PortServices) == 0 {
+		t.Errorf("内置规则应提供基础的识别能力")
+	}
+
+	if data, err := config.ReadDictFile(config.ResolveDictFile(t.TempDir(), "finger.yaml")); err != nil || len(data) == 0 {
+		t.Errorf("应能读取内置的 finger.yaml: %v", err)
+	}
+	if path := config.ResolveDictFile(t.TempDir(), "sensitive.yaml"); config.IsEmbeddedDict(path) {
+		t.Errorf("没有内置副本的文件不应返回内置路径: %s", path)
+	}
+}
@@ -138,7 +138,7 @@ func TestFingerprintScanner_WithMockServer(t *testing.T) {
 	t.Logf("Powered By: %s", result.PoweredBy)
 	t.Logf("Body Length: %d", result.BodyLength)
 	t.Logf("JS Libraries: %v", result.JSLibraries)
-	t.Logf("Scan Time: %dms", result.ScanTime)
+	t.Logf("Scan Time: %dms", result.ScanTimeMs)
 
 	// 验证基本结果
 	if result.StatusCode != 200 {
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 指纹版本提取测试 ==========
+
+const versionRules = `WordPress:
+  dsl:
+    - "contains(body, 'wp-content')"
+  category: CMS
+  version_regex: '<meta\s+name="generator"\s+content="WordPress\s+([\d.]+)"'
+
+Jetty:
+  dsl:
+    - "contains(server, 'jetty')"
+  category: WebServer
+  version_regex: 'Server:\s*Jetty\(([\w.\-]+)\)'
+
+Grafana:
+  dsl:
+    - "title('Grafana')"
+  category: Monitoring
+
+bad-version-regex:
+  dsl:
+    - "contains(body, 'x')"
+  version_regex: 'v(\d+'
+
+no-capture-group:
+  dsl:
+    - "contains(body, 'x')"
+  version_regex: 'v\d+'
+`
+
+// TestFingerprintVersionRegex 规则匹配时用 version_regex 从 body、header 中提取版本，错误的正则在加载时拒绝
+func TestFingerprintVersionRegex(t *testing.T) {
+	printSeparator("指纹版本提取测试")
+
+	path := writeRulesFile(t, t.TempDir(), "finger.yaml", versionRules)
+	engine := fingerprint.NewDSLEngine()
+	if err := engine.LoadRulesFromFile(path); err != nil {
+		t.Fatalf("宽松模式不应返回错误: %v", err)
+	}
+	if engine.RulesCount() != 3 {
+		t.Fatalf("错误的版本正则应跳过规则, 实际加载 %v", engine.ListRules())
+	}
+	found := make(map[string]string)
+	for _, e := range engine.ValidationReport().Errors {
+		found[e.Rule] = e.Error
+	}
+	if !contains(found["bad-version-regex"], "invalid regex") || !contains(found["no-capture-group"], "capture group") {
+		t.Errorf("报告应包含版本正则错误: %v", found)
+	}
+
+	versions := make(map[string]string)
+	for _, m := range engine.AnalyzeResponse(&fingerprint.HTTPResponse{
+		Body:    `<html><head><meta name="generator" content="WordPress 6.4.2"></head><link href="/wp-content/x.css"></html>`,
+		Headers: map[string]string{"Server": "Jetty(9.4.48.v20220622)"},
+		Title:   "Grafana",
+	}) {
+		versions[m.Technology] = m.Version
+	}
+	want := map[string]string{"WordPress": "6.4.2", "Jetty": "9.4.48.v20220622", "Grafana": ""}
+	for name, version := range want {
+		if got, ok := versions[name]; !ok || got != version {
+			t.Errorf("%s 版本应为 %q, 实际 %q (matched=%v)", name, version, got, ok)
+		}
+	}
+}
+
+// TestFingerprintVersionFromHeaders 扫描结果带上 DSL 规则和响应头识别出的版本
+func TestFingerprintVersionFromHeaders(t *testing.T) {
+	printSeparator("响应头版本识别测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.18.0")
+		w.Header().Set("X-Powered-By", "PHP/8.1.0")
+		w.Write([]byte(`<html><head><title>Blog</title><meta name="generator" content="WordPress 6.4.2"></head><body>wp-content</body></html>`))
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.DSLEngine = fingerprint.NewDSLEngine()
+	if err := scanner.DSLEngine.LoadRulesFromFile(writeRulesFile(t, t.TempDir(), "finger.yaml", versionRules)); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+	if result == nil {
+		t.Fatal("扫描结果为空")
+	}
+
+	versions := make(map[string]string)
+	for _, fp := range result.Fingerprints {
+		versions[fp.Name] = fp.Version
+	}
+	for name, version := range map[string]string{"Nginx": "1.18.0", "PHP": "8.1.0", "WordPress": "6.4.2"} {
+		if versions[name] != version {
+			t.Errorf("%s 版本应为 %s: %+v", name, version, result.Fingerprints)
+		}
+	}
+}
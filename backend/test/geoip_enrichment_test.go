@@ -0,0 +1,360 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/scanner/geoip"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== IP 归属（GeoIP）测试 ==========
+
+// mmdbNetwork 测试数据库中的一个网段和它的记录
+type mmdbNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// buildTestMMDB 生成只含 IPv4 网段的最小 MaxMind DB（24 位记录），网段之间不能重叠
+func buildTestMMDB(t *testing.T, dbType string, networks []mmdbNetwork) []byte {
+	t.Helper()
+
+	// 搜索树节点的左右记录：>=0 为子节点，<0 为 -1-数据序号，无记录为 empty
+	const empty = int(^uint(0) >> 1)
+	nodes := [][2]int{{empty, empty}}
+	for i, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatalf("无效的网段 %s: %v", n.cidr, err)
+		}
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To4()
+		node := 0
+		for depth := 0; depth < ones; depth++ {
+			bit := (ip[depth/8] >> (7 - uint(depth%8))) & 1
+			if depth == ones-1 {
+				nodes[node][bit] = -1 - i
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var data bytes.Buffer
+	offsets := make([]int, len(networks))
+	for i, n := range networks {
+		offsets[i] = data.Len()
+		writeMMDBValue(&data, n.record)
+	}
+
+	nodeCount := len(nodes)
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, rec := range node {
+			value := rec
+			switch {
+			case rec == empty:
+				value = nodeCount
+			case rec < 0:
+				value = nodeCount + 16 + offsets[-1-rec]
+			}
+			buf.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	writeMMDBValue(&buf, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               dbType,
+		"description":                 map[string]interface{}{"en": "moongazing test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+	return buf.Bytes()
+}
+
+// writeMMDBControl 写入类型和长度，扩展类型（>7）多写一个字节
+func writeMMDBControl(buf *bytes.Buffer, typ, size int) {
+	ctrl := byte(typ << 5)
+	if typ > 7 {
+		ctrl = 0
+	}
+	switch {
+	case size < 29:
+		buf.WriteByte(ctrl | byte(size))
+	case size < 285:
+		buf.WriteByte(ctrl | 29)
+	default:
+		buf.WriteByte(ctrl | 30)
+	}
+	if typ > 7 {
+		buf.WriteByte(byte(typ - 7))
+	}
+	switch {
+	case size >= 285:
+		n := size - 285
+		buf.Write([]byte{byte(n >> 8), byte(n)})
+	case size >= 29:
+		buf.WriteByte(byte(size - 29))
+	}
+}
+
+// writeMMDBValue 按 MaxMind DB 数据格式编码值
+func writeMMDBValue(buf *bytes.Buffer, v interface{}) {
+	writeUint := func(typ int, n uint64) {
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, n)
+		raw = bytes.TrimLeft(raw, "\x00")
+		writeMMDBControl(buf, typ, len(raw))
+		buf.Write(raw)
+	}
+	switch val := v.(type) {
+	case string:
+		writeMMDBControl(buf, 2, len(val))
+		buf.WriteString(val)
+	case uint16:
+		writeUint(5, uint64(val))
+	case uint32:
+		writeUint(6, uint64(val))
+	case uint64:
+		writeUint(9, val)
+	case []interface{}:
+		writeMMDBControl(buf, 11, len(val))
+		for _, item := range val {
+			writeMMDBValue(buf, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeMMDBControl(buf, 7, len(keys))
+		for _, k := range keys {
+			writeMMDBValue(buf, k)
+			writeMMDBValue(buf, val[k])
+		}
+	default:
+		panic("unsupported mmdb value")
+	}
+}
+
+// englishNames GeoLite2 的 names 字段
+func englishNames(name string) map[string]interface{} {
+	return map[string]interface{}{"names": map[string]interface{}{"en": name, "zh-CN": "测试"}}
+}
+
+// writeTestGeoIPDatabases 在临时目录生成 ASN 和 City 数据库，返回两个文件路径
+func writeTestGeoIPDatabases(t *testing.T, dir string, org string) (string, string) {
+	t.Helper()
+
+	asn := buildTestMMDB(t, "GeoLite2-ASN", []mmdbNetwork{
+		{"8.8.8.0/24", map[string]interface{}{"autonomous_system_number": uint32(15169), "autonomous_system_organization": org}},
+		{"1.1.1.0/24", map[string]interface{}{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"}},
+	})
+	mountainView := englishNames("Mountain View")
+	unitedStates := englishNames("United States")
+	unitedStates["iso_code"] = "US"
+	australia := englishNames("Australia")
+	australia["iso_code"] = "AU"
+	city := buildTestMMDB(t, "GeoLite2-City", []mmdbNetwork{
+		{"8.8.8.0/24", map[string]interface{}{"city": mountainView, "country": unitedStates}},
+		// 只有注册国家、没有城市的记录
+		{"1.1.1.0/24", map[string]interface{}{"registered_country": australia}},
+	})
+
+	asnPath := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	cityPath := filepath.Join(dir, "GeoLite2-City.mmdb")
+	if err := os.WriteFile(asnPath, asn, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cityPath, city, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return asnPath, cityPath
+}
+
+// TestGeoIPLookup 查询 ASN、组织、国家和城市，私有地址和库中没有的 IP 返回 nil
+func TestGeoIPLookup(t *testing.T) {
+	printSeparator("GeoIP 查询测试")
+
+	asnPath, cityPath := writeTestGeoIPDatabases(t, t.TempDir(), "GOOGLE")
+	db, err := geoip.Open(asnPath, cityPath)
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if !db.Available() {
+		t.Fatal("数据库应可用")
+	}
+
+	info := db.Lookup("8.8.8.8")
+	if info == nil || info.ASN != 15169 || info.Org != "GOOGLE" || info.Country != "United States" || info.CountryCode != "US" || info.City != "Mountain View" {
+		t.Errorf("8.8.8.8 的归属信息不正确: %+v", info)
+	}
+	info = db.Lookup("1.1.1.1")
+	if info == nil || info.ASN != 13335 || info.CountryCode != "AU" || info.City != "" {
+		t.Errorf("没有 country 时应使用 registered_country: %+v", info)
+	}
+
+	for _, ip := range []string{"9.9.9.9", "10.0.0.1", "127.0.0.1", "::1", "not-an-ip", ""} {
+		if info := db.Lookup(ip); info != nil {
+			t.Errorf("%q 不应有归属信息: %+v", ip, info)
+		}
+	}
+
+	// 只有 ASN 数据库时只返回 ASN 字段
+	asnOnly, err := geoip.Open(asnPath, filepath.Join(t.TempDir(), "missing.mmdb"))
+	if err != nil {
+		t.Fatalf("City 数据库不存在时不应报错: %v", err)
+	}
+	info = asnOnly.Lookup("8.8.8.8")
+	if info == nil || info.Org != "GOOGLE" || info.Country != "" {
+		t.Errorf("只有 ASN 数据库时的结果不正确: %+v", info)
+	}
+}
+
+// TestGeoIPEnrichPortResults 同一 IP 的多个端口只查询一次，归属信息写入端口结果并合并到资产
+func TestGeoIPEnrichPortResults(t *testing.T) {
+	printSeparator("端口结果 IP 归属测试")
+
+	asnPath, cityPath := writeTestGeoIPDatabases(t, t.TempDir(), "GOOGLE")
+	db, err := geoip.Open(asnPath, cityPath)
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	cache := geoip.NewCache(db)
+
+	var results []*models.ScanResult
+	for _, port := range []string{"53", "443", "853"} {
+		data := service.PortResultData(pipeline.PortAlive{Host: "dns.google", IP: "8.8.8.8", Port: port, Service: "dns"})
+		service.EnrichPortData(data, cache)
+		results = append(results, &models.ScanResult{
+			WorkspaceID: primitive.NewObjectID(),
+			TaskID:      primitive.NewObjectID(),
+			Type:        models.ResultTypePort,
+			Data:        data,
+		})
+	}
+	internal := service.PortResultData(pipeline.PortAlive{IP: "192.168.1.10", Port: "22"})
+	service.EnrichPortData(internal, cache)
+
+	if cache.Lookups() != 2 {
+		t.Errorf("两个不同 IP 应只查询 2 次数据库，实际 %d", cache.Lookups())
+	}
+	data := results[1].Data
+	if data["asn"] != int64(15169) || data["org"] != "GOOGLE" || data["country"] != "United States" || data["country_code"] != "US" || data["city"] != "Mountain View" {
+		t.Errorf("端口结果缺少归属信息: %v", data)
+	}
+	for _, field := range []string{"asn", "org", "country", "country_code", "city"} {
+		if _, ok := internal[field]; ok {
+			t.Errorf("内网 IP 不应写入 %s: %v", field, internal)
+		}
+	}
+
+	asset := service.AssetFromResult(results[0])
+	if asset == nil {
+		t.Fatal("端口结果应生成资产")
+	}
+	if asset.ASN != 15169 || asset.Org != "GOOGLE" || asset.Country != "United States" || asset.CountryCode != "US" || asset.City != "Mountain View" {
+		t.Errorf("资产缺少归属信息: %+v", asset)
+	}
+}
+
+// TestGeoIPNoDatabase 未配置或文件不存在时跳过，端口结果保持不变
+func TestGeoIPNoDatabase(t *testing.T) {
+	printSeparator("GeoIP 数据库缺失测试")
+
+	dir := t.TempDir()
+	db, err := geoip.Open(filepath.Join(dir, "GeoLite2-ASN.mmdb"), filepath.Join(dir, "GeoLite2-City.mmdb"))
+	if err != nil {
+		t.Fatalf("数据库文件不存在时不应报错: %v", err)
+	}
+	if db.Available() {
+		t.Error("没有数据库文件时不应可用")
+	}
+
+	for _, cache := range []*geoip.Cache{geoip.NewCache(db), geoip.NewCache(nil), nil} {
+		data := service.PortResultData(pipeline.PortAlive{Host: "dns.google", IP: "8.8.8.8", Port: "53"})
+		before := len(data)
+		service.EnrichPortData(data, cache)
+		if len(data) != before {
+			t.Errorf("没有数据库时不应修改端口结果: %v", data)
+		}
+		if info := cache.Lookup("8.8.8.8"); info != nil {
+			t.Errorf("没有数据库时不应返回归属信息: %+v", info)
+		}
+	}
+
+	// 文件存在但内容无效时报错
+	bad := filepath.Join(dir, "bad.mmdb")
+	if err := os.WriteFile(bad, []byte("not a maxmind database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := geoip.Open(bad, ""); err == nil {
+		t.Error("无效的 mmdb 文件应返回错误")
+	}
+}
+
+// TestGeoIPReload 替换 mmdb 文件后重新加载，不需要重启；加载失败时保留之前的数据库
+func TestGeoIPReload(t *testing.T) {
+	printSeparator("GeoIP 重新加载测试")
+	t.Cleanup(func() { geoip.Configure("", "") })
+
+	dir := t.TempDir()
+	asnPath := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	cityPath := filepath.Join(dir, "GeoLite2-City.mmdb")
+
+	if err := geoip.Configure(asnPath, cityPath); err != nil {
+		t.Fatalf("文件不存在时配置不应报错: %v", err)
+	}
+	if geoip.Default().Available() {
+		t.Fatal("文件不存在时数据库不应可用")
+	}
+
+	writeTestGeoIPDatabases(t, dir, "GOOGLE")
+	if err := geoip.Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if info := geoip.Default().Lookup("8.8.8.8"); info == nil || info.Org != "GOOGLE" {
+		t.Fatalf("重新加载后应能查询: %+v", info)
+	}
+
+	// 替换为新版本的数据库
+	writeTestGeoIPDatabases(t, dir, "GOOGLE LLC")
+	if err := geoip.Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if info := geoip.Default().Lookup("8.8.8.8"); info == nil || info.Org != "GOOGLE LLC" {
+		t.Errorf("应使用替换后的数据库: %+v", info)
+	}
+
+	// 写入了损坏的文件
+	if err := os.WriteFile(asnPath, []byte("truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := geoip.Reload(); err == nil {
+		t.Error("损坏的文件应返回错误")
+	}
+	if info := geoip.Default().Lookup("8.8.8.8"); info == nil || info.Org != "GOOGLE LLC" {
+		t.Errorf("加载失败时应保留之前的数据库: %+v", info)
+	}
+}
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== 未识别端口 HTTP 探测测试 ==========
+
+// splitHostPort 拆分本地监听地址
+func splitHostPort(t *testing.T, addr string) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("地址解析失败: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	if core.IsHTTPPort(port) || core.IsNonHTTPPort(port) {
+		t.Skipf("随机端口 %d 在静态端口列表中", port)
+	}
+	return host, port
+}
+
+// TestHTTPProbeUnlabeledPort gogo 只报告 "tcp" 的高位端口经探测后成为 HTTP 资产
+func TestHTTPProbeUnlabeledPort(t *testing.T) {
+	printSeparator("未识别端口 HTTP 探测测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "AdminPanel/1.0")
+		w.Write([]byte("<html><head><title>Admin Console</title></head></html>"))
+	}))
+	defer server.Close()
+	host, port := splitHostPort(t, server.Listener.Addr().String())
+
+	prober := webscan.NewHTTPProber(webscan.HTTPProbeConfig{Enabled: true, MinPort: 1025, Timeout: 2 * time.Second})
+	if !prober.ShouldProbe(core.PortResult{Port: port, State: "open", Service: "tcp"}) {
+		t.Fatalf("未识别服务的高位端口应探测")
+	}
+	result := prober.Probe(context.Background(), host, port)
+	if result == nil {
+		t.Fatalf("HTTP 服务应被发现")
+	}
+	if result.Protocol != "http" || result.URL != server.URL || result.Title != "Admin Console" || result.Server != "AdminPanel/1.0" || result.StatusCode != 200 {
+		t.Errorf("探测结果不正确: %+v", result)
+	}
+
+	// HTTPS 优先
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tlsServer.Close()
+	tlsHost, tlsPort := splitHostPort(t, tlsServer.Listener.Addr().String())
+	result = prober.Probe(context.Background(), tlsHost, tlsPort)
+	if result == nil || result.Protocol != "https" || result.StatusCode != http.StatusUnauthorized {
+		t.Errorf("HTTPS 服务应被发现: %+v", result)
+	}
+
+	if probed, found := prober.Probed(); probed != 2 || found != 2 {
+		t.Errorf("探测统计不正确: probed=%d found=%d", probed, found)
+	}
+}
+
+// TestHTTPProbeNegativeAndLimits 非 HTTP 端口记录失败结果不再重试；已识别的服务、低位端口、关闭配置时不探测
+func TestHTTPProbeNegativeAndLimits(t *testing.T) {
+	printSeparator("HTTP 探测缓存和限制测试")
+
+	host, port := splitHostPort(t, bannerListener(t, "SSH-2.0-OpenSSH_8.9\r\n"))
+	prober := webscan.NewHTTPProber(webscan.HTTPProbeConfig{Enabled: true, MinPort: 1025, MaxPerHost: 2, Timeout: 2 * time.Second})
+
+	unlabeled := core.PortResult{Port: port, State: "open", Service: "tcp"}
+	if result := prober.Probe(context.Background(), host, port); result != nil {
+		t.Fatalf("非 HTTP 服务不应识别为 HTTP: %+v", result)
+	}
+	probed, _ := prober.Probed()
+	if probed != 1 {
+		t.Fatalf("失败的探测应被记录: %d", probed)
+	}
+	// 再次探测命中缓存，探测数不变，也不占用主机探测上限
+	prober.Probe(context.Background(), host, port)
+	if probed, _ := prober.Probed(); probed != 1 {
+		t.Errorf("失败的探测不应重试: %d", probed)
+	}
+
+	skip := []core.PortResult{
+		{Port: port, State: "open", Service: "ssh"},
+		{Port: port, State: "open", Fingerprint: []string{"redis"}},
+		{Port: 1024, State: "open", Service: "tcp"},
+		{Port: port, State: "closed"},
+	}
+	for _, p := range skip {
+		if prober.ShouldProbe(p) {
+			t.Errorf("不应探测: %+v", p)
+		}
+	}
+	disabled := webscan.NewHTTPProber(webscan.HTTPProbeConfig{Enabled: false})
+	if disabled.ShouldProbe(unlabeled) {
+		t.Errorf("关闭探测后不应探测")
+	}
+
+	// 每个主机的探测上限：第二个新端口仍可探测，第三个被跳过
+	other := bannerListener(t, "")
+	_, otherPort := splitHostPort(t, other)
+	prober.Probe(context.Background(), host, otherPort)
+	third := bannerListener(t, "")
+	_, thirdPort := splitHostPort(t, third)
+	prober.Probe(context.Background(), host, thirdPort)
+	if probed, _ := prober.Probed(); probed != 2 {
+		t.Errorf("超过主机探测上限后不应继续探测: %d", probed)
+	}
+
+	// 任务配置
+	off := false
+	cfg := (&pipeline.PipelineConfig{PortHTTPProbe: &off, PortHTTPProbeMinPort: 2000, PortHTTPProbeMaxPerHost: 5}).HTTPProbeConfig()
+	if cfg.Enabled || cfg.MinPort != 2000 || cfg.MaxPerHost != 5 {
+		t.Errorf("任务配置未生效: %+v", cfg)
+	}
+	if def := (&pipeline.PipelineConfig{}).HTTPProbeConfig(); !def.Enabled || def.MinPort != 1025 {
+		t.Errorf("默认应对 1024 以上端口开启: %+v", def)
+	}
+}
+
+// runFingerprintPorts 指纹识别模块开启端口 HTTP 探测后处理开放端口，返回输出的 Web 资产和非 HTTP 资产
+func runFingerprintPorts(t *testing.T, ports ...pipeline.PortAlive) ([]pipeline.AssetHttp, []pipeline.AssetOther) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out := make(chan interface{}, 20)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 20))
+	module := pipeline.NewFingerprintModule(ctx, collector, 2)
+	module.SetHTTPProbe(webscan.HTTPProbeConfig{Enabled: true, MinPort: 1025, Timeout: 2 * time.Second})
+	input := make(chan interface{}, len(ports))
+	module.SetInput(input)
+	for _, port := range ports {
+		input <- port
+	}
+	close(input)
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("指纹识别失败: %v", err)
+	}
+
+	var web []pipeline.AssetHttp
+	var other []pipeline.AssetOther
+	for len(out) > 0 {
+		switch a := (<-out).(type) {
+		case pipeline.AssetHttp:
+			web = append(web, a)
+		case pipeline.AssetOther:
+			other = append(other, a)
+		}
+	}
+	return web, other
+}
+
+// TestFingerprintModuleHTTPProbe 流水线中 gogo 只报告 "tcp" 的高位端口：HTTPS 服务按探测到的协议识别指纹，非 HTTP 服务做端口指纹识别
+func TestFingerprintModuleHTTPProbe(t *testing.T) {
+	printSeparator("指纹识别模块端口 HTTP 探测测试")
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>Secure Console</title></head></html>"))
+	}))
+	defer tlsServer.Close()
+	tlsHost, tlsPort := splitHostPort(t, tlsServer.Listener.Addr().String())
+	sshHost, sshPort := splitHostPort(t, bannerListener(t, "SSH-2.0-OpenSSH_8.9\r\n"))
+
+	web, other := runFingerprintPorts(t,
+		pipeline.PortAlive{Host: tlsHost, IP: tlsHost, Port: strconv.Itoa(tlsPort), Service: "tcp"},
+		pipeline.PortAlive{Host: sshHost, IP: sshHost, Port: strconv.Itoa(sshPort), Service: "tcp"},
+	)
+	if len(web) != 1 || web[0].URL != tlsServer.URL || web[0].Title != "Secure Console" {
+		t.Errorf("HTTPS 服务应按 https 识别指纹: %+v", web)
+	}
+	if len(other) != 1 || other[0].Port != strconv.Itoa(sshPort) {
+		t.Errorf("非 HTTP 服务应输出端口指纹识别结果: %+v", other)
+	}
+}
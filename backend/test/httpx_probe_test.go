@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/webscan"
+)
+
+// ========== HTTP 探测测试 ==========
+
+// TestHttpxProbeSchemes 只开放 HTTP、只开放 HTTPS 和无法连接的目标
+func TestHttpxProbeSchemes(t *testing.T) {
+	printSeparator("HTTP 探测协议测试")
+
+	httpOnly := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.18.0")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><head><title>\n  Admin &amp; Login\n</title></head></html>"))
+	}))
+	defer httpOnly.Close()
+
+	httpsOnly := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("<title>Secure Console</title>"))
+	}))
+	defer httpsOnly.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := listener.Addr().String()
+	listener.Close()
+
+	httpTarget := strings.TrimPrefix(httpOnly.URL, "http://")
+	httpsTarget := strings.TrimPrefix(httpsOnly.URL, "https://")
+
+	scanner := webscan.NewHttpxScanner(5)
+	results := make(map[string]*webscan.HttpxResult)
+	for _, r := range scanner.EnrichSubdomains(context.Background(), []string{httpTarget, httpsTarget, dead}) {
+		results[r.Host] = r
+	}
+	if len(results) != 3 {
+		t.Fatalf("应返回 3 个结果，实际 %d", len(results))
+	}
+
+	r := results[httpTarget]
+	if r.Scheme != "http" || r.URL != httpOnly.URL || r.StatusCode != http.StatusOK {
+		t.Errorf("只开放 HTTP 的目标应使用 http: %+v", r)
+	}
+	if r.Title != "Admin & Login" || r.WebServer != "nginx/1.18.0" || r.IP != "127.0.0.1" || r.Error != "" {
+		t.Errorf("HTTP 目标的标题、Server 或 IP 不正确: title=%q server=%q ip=%q err=%q", r.Title, r.WebServer, r.IP, r.Error)
+	}
+	if r.ResponseTimeMs < 0 || r.ContentLength == 0 || !strings.Contains(r.RawHeaders, "Server: nginx/1.18.0") {
+		t.Errorf("HTTP 目标缺少响应信息: %+v", r)
+	}
+
+	// HTTPS 端口对明文请求返回 400，应使用 HTTPS 的响应
+	r = results[httpsTarget]
+	if r.Scheme != "https" || r.URL != httpsOnly.URL || r.StatusCode != http.StatusUnauthorized || r.Title != "Secure Console" {
+		t.Errorf("只开放 HTTPS 的目标应使用 https: scheme=%s status=%d title=%q", r.Scheme, r.StatusCode, r.Title)
+	}
+
+	r = results[dead]
+	if r.StatusCode != 0 || r.URL != "" || r.Error == "" {
+		t.Errorf("无法连接的目标不应有响应: %+v", r)
+	}
+	if r.IP != "127.0.0.1" || r.CDN {
+		t.Errorf("无法连接的目标仍应记录 IP: ip=%q cdn=%v", r.IP, r.CDN)
+	}
+}
+
+// TestHttpxProbeTimeout 单个目标超过探测时间后返回，ctx 取消后不再探测新的目标
+func TestHttpxProbeTimeout(t *testing.T) {
+	printSeparator("HTTP 探测超时测试")
+
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(done)
+
+	scanner := webscan.NewHttpxScanner(2)
+	scanner.SetHostTimeout(300 * time.Millisecond)
+
+	start := time.Now()
+	r := scanner.Probe(context.Background(), strings.TrimPrefix(slow.URL, "http://"))
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("超过单个目标的探测时间后应返回，实际耗时 %v", elapsed)
+	}
+	if r.StatusCode != 0 || r.Error == "" {
+		t.Errorf("超时的目标不应有响应: %+v", r)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results := scanner.ProbeMultiple(ctx, []string{"a.example.com", "b.example.com", "c.example.com"}); len(results) != 0 {
+		t.Errorf("ctx 取消后不应再探测，实际 %d 个结果", len(results))
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"testing"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 国际化域名（IDN）测试 ==========
+
+// TestIDNTargetNormalization Unicode 目标和大小写混合的 punycode 目标统一为小写 punycode
+func TestIDNTargetNormalization(t *testing.T) {
+	printSeparator("国际化域名目标标准化测试")
+
+	cases := map[string]string{
+		"münchen.example":                      "xn--mnchen-3ya.example",
+		"WWW.München.Example":                  "www.xn--mnchen-3ya.example",
+		"XN--MNCHEN-3YA.example":               "xn--mnchen-3ya.example",
+		"测试。中国":                                "xn--0zwm56d.xn--fiqs8s",
+		"https://münchen.example:8443/Login?a": "https://xn--mnchen-3ya.example:8443/Login?a",
+		"münchen.example:8080":                 "xn--mnchen-3ya.example:8080",
+		"Example.com":                          "Example.com",
+		"10.0.0.1":                             "10.0.0.1",
+	}
+	for input, want := range cases {
+		if got := core.NormalizeTargetIDN(input); got != want {
+			t.Errorf("NormalizeTargetIDN(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	if got := core.ExtractRootDomain("api.münchen.example"); got != "xn--mnchen-3ya.example" {
+		t.Errorf("根域名应为 punycode 形式: %s", got)
+	}
+	if got := core.ToUnicodeDomain("WWW.XN--MNCHEN-3YA.example"); got != "www.münchen.example" {
+		t.Errorf("展示名称应为 Unicode 形式: %s", got)
+	}
+
+	// 同一域名的 Unicode 和 punycode 写法展开后只保留一个目标
+	expanded, err := pipeline.ExpandTargets([]string{"münchen.example", "XN--MNCHEN-3YA.EXAMPLE", "http://测试.中国/"}, 0)
+	if err != nil {
+		t.Fatalf("ExpandTargets failed: %v", err)
+	}
+	if len(expanded) != 2 || expanded[0] != "xn--mnchen-3ya.example" || expanded[1] != "http://xn--0zwm56d.xn--fiqs8s/" {
+		t.Errorf("展开结果不符: %v", expanded)
+	}
+}
+
+// TestIDNSubdomainDedup Unicode 和 punycode 写法的子域名使用同一去重键，并保留展示名称
+func TestIDNSubdomainDedup(t *testing.T) {
+	printSeparator("国际化域名子域名去重测试")
+
+	taskID := primitive.NewObjectID()
+	unicodeResult := &models.ScanResult{TaskID: taskID, Type: models.ResultTypeSubdomain, Data: bson.M{"subdomain": "Mail.München.example"}}
+	punycodeResult := &models.ScanResult{TaskID: taskID, Type: models.ResultTypeSubdomain, Data: bson.M{"subdomain": "mail.XN--MNCHEN-3YA.example"}}
+
+	a := service.DedupFilter(unicodeResult)
+	b := service.DedupFilter(punycodeResult)
+	if a["data.subdomain"] != "mail.xn--mnchen-3ya.example" || a["data.subdomain"] != b["data.subdomain"] {
+		t.Errorf("去重键应为相同的 punycode: %v %v", a["data.subdomain"], b["data.subdomain"])
+	}
+	for _, r := range []*models.ScanResult{unicodeResult, punycodeResult} {
+		if r.Data["subdomain"] != "mail.xn--mnchen-3ya.example" || r.Data["display_name"] != "mail.münchen.example" {
+			t.Errorf("存储的结果应同时包含 punycode 和 Unicode 形式: %v", r.Data)
+		}
+	}
+
+	service1 := &models.ScanResult{TaskID: taskID, Type: models.ResultTypeService, Data: bson.M{"url": "https://münchen.example:443/"}}
+	service2 := &models.ScanResult{TaskID: taskID, Type: models.ResultTypeService, Data: bson.M{"url": "http://xn--mnchen-3ya.example"}}
+	if h1, h2 := service.DedupFilter(service1)["data.dedup_host"], service.DedupFilter(service2)["data.dedup_host"]; h1 != "xn--mnchen-3ya.example" || h1 != h2 {
+		t.Errorf("Web 服务去重 host 应为 punycode: %v %v", h1, h2)
+	}
+}
+
+// TestSubdomainResultDisplayName 子域名列表返回 Unicode 展示名称，升级前的结果由 punycode 转换
+func TestSubdomainResultDisplayName(t *testing.T) {
+	printSeparator("子域名结果展示名称测试")
+
+	serviceMap := map[string]map[string]interface{}{
+		"www.xn--0zwm56d.xn--fiqs8s": {"title": "测试首页", "status_code": int32(200)},
+	}
+
+	stored := models.ScanResult{
+		ID:     primitive.NewObjectID(),
+		TaskID: primitive.NewObjectID(),
+		Type:   models.ResultTypeSubdomain,
+		Data:   bson.M{"subdomain": "www.xn--0zwm56d.xn--fiqs8s", "display_name": "www.测试.中国"},
+	}
+	item := service.SubdomainResultItem(stored, serviceMap)
+	if item["display_name"] != "www.测试.中国" || item["subdomain"] != "www.xn--0zwm56d.xn--fiqs8s" {
+		t.Errorf("列表项应包含两种形式: %v", item)
+	}
+	if item["title"] != "测试首页" || item["status_code"] != 200 {
+		t.Errorf("应按 punycode 关联 Web 服务信息: %v", item)
+	}
+
+	legacy := stored
+	legacy.Data = bson.M{"subdomain": "xn--mnchen-3ya.example"}
+	if item := service.SubdomainResultItem(legacy, serviceMap); item["display_name"] != "münchen.example" {
+		t.Errorf("旧结果应补充展示名称: %v", item["display_name"])
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/service/pipeline"
+)
+
+// ========== IP 并发调度测试 ==========
+
+// TestIPSchedulerSharedIP 50 个子域名解析到同一 IP：同时执行数不超过上限，排队超过阈值时写入进度提示
+func TestIPSchedulerSharedIP(t *testing.T) {
+	printSeparator("IP 并发调度测试")
+
+	const hosts, maxPerIP = 50, 5
+	scheduler := pipeline.NewIPScheduler(maxPerIP, 20)
+	tracker := pipeline.NewProgressTracker(hosts, nil)
+	scheduler.SetWarningHandler(tracker.SetWarning)
+
+	gate := make(chan struct{})
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < hosts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 指纹识别和目录扫描交替提交，共用同一 IP 的名额
+			release, ok := scheduler.Acquire(context.Background(), fmt.Sprintf("app%d.saas.example.com", i), "1.2.3.4")
+			if !ok {
+				t.Errorf("不应取消")
+				return
+			}
+			defer release()
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-gate
+			atomic.AddInt32(&inFlight, -1)
+		}(i)
+	}
+
+	// 等待全部进入队列后放行
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		loads := scheduler.Loads()
+		if len(loads) == 1 && loads[0].Queued == hosts-maxPerIP && loads[0].InFlight == maxPerIP {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("排队状态不正确: %+v", loads)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	report := tracker.GetReport()
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "50 个主机共用 IP 1.2.3.4") {
+		t.Errorf("应提示共用 IP 的主机数: %v", report.Warnings)
+	}
+
+	close(gate)
+	wg.Wait()
+	if peak != maxPerIP {
+		t.Errorf("同时执行数应为 %d, 实际 %d", maxPerIP, peak)
+	}
+	if loads := scheduler.Loads(); loads[0].Hosts != hosts || loads[0].Peak != maxPerIP || loads[0].InFlight != 0 {
+		t.Errorf("负载统计不正确: %+v", loads[0])
+	}
+
+	// 取消排队
+	scheduler = pipeline.NewIPScheduler(1, 0)
+	release, _ := scheduler.Acquire(context.Background(), "a.example.com", "1.2.3.4")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, ok := scheduler.Acquire(ctx, "b.example.com", "1.2.3.4"); ok {
+		t.Errorf("名额用完时应等待到上下文取消")
+	}
+	release()
+	if loads := scheduler.Loads(); loads[0].Queued != 0 {
+		t.Errorf("取消后不应留在队列中: %+v", loads[0])
+	}
+}
+
+// TestIPSchedulerLeastLoaded 多 IP 主机计入负载最小的 IP；批量模式按 IP 拆分轮次
+func TestIPSchedulerLeastLoaded(t *testing.T) {
+	printSeparator("IP 调度负载均衡测试")
+
+	scheduler := pipeline.NewIPScheduler(2, 0)
+	scheduler.RecordHost("multi.example.com", []string{"1.2.3.4", "5.6.7.8"})
+
+	r1, _ := scheduler.Acquire(context.Background(), "busy.example.com", "1.2.3.4")
+	defer r1()
+	// 数据中只携带第一个 IP，但主机记录了两个 IP
+	r2, _ := scheduler.Acquire(context.Background(), "multi.example.com", "1.2.3.4")
+	defer r2()
+	for _, load := range scheduler.Loads() {
+		if load.IP == "5.6.7.8" && load.InFlight != 1 {
+			t.Errorf("多 IP 主机应计入负载最小的 IP: %+v", scheduler.Loads())
+		}
+	}
+
+	var works []pipeline.IPWork
+	for i := 0; i < 5; i++ {
+		works = append(works, pipeline.IPWork{Host: fmt.Sprintf("h%d.example.com", i), IP: "9.9.9.9", URL: fmt.Sprintf("https://h%d.example.com", i)})
+	}
+	works = append(works, pipeline.IPWork{Host: "solo.example.com", IP: "8.8.8.8", URL: "https://solo.example.com"})
+
+	rounds := scheduler.Rounds(works)
+	if len(rounds) != 3 {
+		t.Fatalf("5 个同 IP 的 URL 按上限 2 应分 3 轮, 实际 %d", len(rounds))
+	}
+	total := 0
+	for _, round := range rounds {
+		perIP := make(map[string]int)
+		for _, w := range round {
+			perIP[w.IP]++
+		}
+		for ip, n := range perIP {
+			if n > 2 {
+				t.Errorf("一轮中 IP %s 有 %d 个 URL", ip, n)
+			}
+		}
+		total += len(round)
+		release, ok := scheduler.AcquireRound(context.Background(), round)
+		if !ok {
+			t.Fatalf("占用名额失败")
+		}
+		release()
+	}
+	if total != len(works) || len(rounds[0]) != 3 {
+		t.Errorf("轮次拆分不正确: %v", rounds)
+	}
+
+	// 不限制时整批处理
+	var nilScheduler *pipeline.IPScheduler
+	if rounds := nilScheduler.Rounds(works); len(rounds) != 1 {
+		t.Errorf("未启用调度时应整批处理")
+	}
+}
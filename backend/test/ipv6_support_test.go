@@ -0,0 +1,219 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/portscan"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== IPv6 支持测试 ==========
+
+// listenIPv6 在 [::1] 上监听并回写 banner，环境不支持 IPv6 时跳过
+func listenIPv6(t *testing.T, banner string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// writeArgsGoGo 写入模拟 gogo：把 -i 参数记录到文件，输出给定的 JSON 行
+func writeArgsGoGo(t *testing.T, line string) (*portscan.GoGoScanner, string) {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "targets")
+	script := "#!/bin/sh\necho \"$2\" >> " + argsFile + "\necho '" + line + "'\n"
+	path := filepath.Join(dir, "gogo")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake gogo: %v", err)
+	}
+	return portscan.NewGoGoScannerWithPath(path), argsFile
+}
+
+// runPortModule 运行端口扫描模块，返回输出的开放端口
+func runPortModule(t *testing.T, gogo *portscan.GoGoScanner, ports, ipv6Mode string, input interface{}) []pipeline.PortAlive {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewPortScanModule(ctx, collector, ports, "custom")
+	module.SetGoGoScanner(gogo)
+	module.SetIPv6Mode(ipv6Mode)
+	in := make(chan interface{}, 1)
+	in <- input
+	close(in)
+	module.SetInput(in)
+	module.ModuleRun()
+
+	var alive []pipeline.PortAlive
+	for len(out) > 0 {
+		if p, ok := (<-out).(pipeline.PortAlive); ok {
+			alive = append(alive, p)
+		}
+	}
+	return alive
+}
+
+// TestIPv6Addresses IPv6 地址拼接加方括号，双栈主机按设置排列 IP
+func TestIPv6Addresses(t *testing.T) {
+	printSeparator("IPv6 地址处理测试")
+
+	if got := core.HostPort("2001:db8::1", 8080); got != "[2001:db8::1]:8080" {
+		t.Errorf("HostPort: %s", got)
+	}
+	if got := core.HostPort("[2001:db8::1]", 22); got != "[2001:db8::1]:22" {
+		t.Errorf("已带方括号的地址不重复添加: %s", got)
+	}
+	if got := core.BuildURL("http", "2001:db8::1", 8080); got != "http://[2001:db8::1]:8080" {
+		t.Errorf("BuildURL: %s", got)
+	}
+	if got := core.BuildURL("https", "example.com", 0); got != "https://example.com" {
+		t.Errorf("BuildURL 不带端口: %s", got)
+	}
+	for ip, want := range map[string]string{"10.0.0.1": "ipv4", "::ffff:10.0.0.1": "ipv4", "2001:db8::1": "ipv6", "[::1]": "ipv6", "example.com": ""} {
+		if got := core.AddressFamily(ip); got != want {
+			t.Errorf("%s 的地址族应为 %q, 实际 %q", ip, want, got)
+		}
+	}
+
+	dual := []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2"}
+	if got := strings.Join(core.SelectIPs(dual, core.IPv6ModeDefault), ","); got != "10.0.0.1,10.0.0.2,2001:db8::1,2001:db8::2" {
+		t.Errorf("默认 IPv4 在前: %s", got)
+	}
+	if got := strings.Join(core.SelectIPs(dual, core.IPv6ModePrefer), ","); got != "2001:db8::1,2001:db8::2,10.0.0.1,10.0.0.2" {
+		t.Errorf("prefer 时 IPv6 在前: %s", got)
+	}
+	if got := core.SelectIPs([]string{"2001:db8::1"}, core.IPv6ModeSkip); len(got) != 0 {
+		t.Errorf("skip 时去掉 IPv6: %v", got)
+	}
+
+	ports, err := portscan.ParsePortSpec("22, 80-82,443,80")
+	if err != nil || len(ports) != 5 || ports[0] != 22 || ports[4] != 443 {
+		t.Errorf("端口参数解析不正确: %v %v", ports, err)
+	}
+	if _, err := portscan.ParsePortSpec("90-80"); err == nil {
+		t.Errorf("无效的端口范围应报错")
+	}
+	if top, _ := portscan.ParsePortSpec("top1"); len(top) == 0 {
+		t.Errorf("top1 应有端口")
+	}
+}
+
+// TestIPv6LiteralPortScan IPv6 地址目标不交给 gogo，使用 TCP 连接扫描，结果带地址族，端口指纹可连接
+func TestIPv6LiteralPortScan(t *testing.T) {
+	printSeparator("IPv6 地址端口扫描测试")
+
+	port := listenIPv6(t, "SSH-2.0-OpenSSH_9.6\r\n")
+	gogo, argsFile := writeArgsGoGo(t, `{"ip":"127.0.0.1","port":"1","protocol":"tcp","status":"open"}`)
+
+	alive := runPortModule(t, gogo, strconv.Itoa(port), "", "::1")
+	if _, err := os.Stat(argsFile); err == nil {
+		t.Errorf("IPv6 目标不应交给 gogo")
+	}
+	if len(alive) != 1 {
+		t.Fatalf("应找到 1 个开放端口: %+v", alive)
+	}
+	p := alive[0]
+	if p.Host != "::1" || p.IP != "::1" || p.Family != core.AddressFamilyIPv6 || p.Port != strconv.Itoa(port) || p.ResponseTimeMs <= 0 {
+		t.Errorf("IPv6 端口结果不正确: %+v", p)
+	}
+	if data := service.PortResultData(p); data["family"] != "ipv6" {
+		t.Errorf("保存的端口结果应包含地址族: %+v", data)
+	}
+
+	fp := fingerprint.NewFingerprintScanner(1).ScanPortFingerprint(context.Background(), "::1", port)
+	if fp == nil || !strings.HasPrefix(fp.Banner, "SSH-2.0") {
+		t.Errorf("IPv6 端口指纹应能读取 banner: %+v", fp)
+	}
+
+	// 未识别端口的 HTTP 探测和指纹识别使用带方括号的 URL
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>v6 panel</title></head></html>"))
+	}))
+	server.Listener = ln
+	server.Start()
+	defer server.Close()
+	httpPort := ln.Addr().(*net.TCPAddr).Port
+	if !core.IsHTTPPort(httpPort) && !core.IsNonHTTPPort(httpPort) {
+		prober := webscan.NewHTTPProber(webscan.HTTPProbeConfig{Enabled: true, MinPort: 1025, Timeout: 2 * time.Second})
+		result := prober.Probe(context.Background(), "::1", httpPort)
+		if result == nil || result.URL != "http://[::1]:"+strconv.Itoa(httpPort) || result.Title != "v6 panel" {
+			t.Errorf("IPv6 探测 URL 应加方括号: %+v", result)
+		}
+	}
+	result := fingerprint.NewFingerprintScanner(1).ScanFingerprint(context.Background(), core.BuildURL("http", "::1", httpPort))
+	if result == nil || result.StatusCode != 200 || result.Title != "v6 panel" {
+		t.Errorf("IPv6 URL 应能识别指纹: %+v", result)
+	}
+
+	// 设置跳过 IPv6 时不扫描
+	if alive := runPortModule(t, gogo, strconv.Itoa(port), core.IPv6ModeSkip, "::1"); len(alive) != 0 {
+		t.Errorf("skip 时不应扫描 IPv6 地址: %+v", alive)
+	}
+}
+
+// TestDualStackPortScan 双栈主机默认交给 gogo 扫描主机名并记录 IPv4，prefer 时扫描 IPv6 地址；只有 AAAA 记录的主机扫描 IPv6 地址
+func TestDualStackPortScan(t *testing.T) {
+	printSeparator("双栈主机端口扫描测试")
+
+	port := listenIPv6(t, "hello\r\n")
+	gogo, argsFile := writeArgsGoGo(t, `{"ip":"127.0.0.1","port":"80","protocol":"http","status":"200"}`)
+	dual := pipeline.DomainSkip{Domain: "dual.example.com", IP: []string{"::1", "127.0.0.1"}}
+
+	alive := runPortModule(t, gogo, strconv.Itoa(port), "", dual)
+	if len(alive) != 1 || alive[0].IP != "127.0.0.1" || alive[0].Family != core.AddressFamilyIPv4 || alive[0].Port != "80" {
+		t.Fatalf("默认应使用 gogo 扫描并记录 IPv4: %+v", alive)
+	}
+	if args, _ := os.ReadFile(argsFile); strings.TrimSpace(string(args)) != "dual.example.com" {
+		t.Errorf("gogo 应收到主机名: %q", args)
+	}
+
+	alive = runPortModule(t, gogo, strconv.Itoa(port), core.IPv6ModePrefer, dual)
+	if len(alive) != 1 || alive[0].Host != "dual.example.com" || alive[0].IP != "::1" || alive[0].Family != core.AddressFamilyIPv6 || alive[0].Port != strconv.Itoa(port) {
+		t.Errorf("prefer 时应扫描 IPv6 地址: %+v", alive)
+	}
+
+	v6only := pipeline.DomainSkip{Domain: "v6.example.com", IP: []string{"::1"}}
+	if alive := runPortModule(t, gogo, strconv.Itoa(port), "", v6only); len(alive) != 1 || alive[0].IP != "::1" {
+		t.Errorf("只有 AAAA 记录的主机应扫描 IPv6 地址: %+v", alive)
+	}
+	if alive := runPortModule(t, gogo, strconv.Itoa(port), core.IPv6ModeSkip, v6only); len(alive) != 0 {
+		t.Errorf("skip 时只有 IPv6 地址的主机不扫描: %+v", alive)
+	}
+	if args, _ := os.ReadFile(argsFile); strings.Count(string(args), "\n") != 1 {
+		t.Errorf("IPv6 地址不应交给 gogo: %q", args)
+	}
+}
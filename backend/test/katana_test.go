@@ -57,7 +57,7 @@ func TestKatanaSingleCrawl(t *testing.T) {
 		t.Fatalf("Crawl failed: %v", err)
 	}
 
-	fmt.Printf("Duration: %s\n", result.Duration)
+	fmt.Printf("Duration: %dms\n", result.DurationMs)
 	fmt.Printf("Total URLs found: %d\n", result.Total)
 
 	// 打印前10个URL
@@ -104,7 +104,7 @@ func TestKatanaListCrawl(t *testing.T) {
 		t.Fatalf("CrawlList failed: %v", err)
 	}
 
-	fmt.Printf("\nDuration: %s\n", result.Duration)
+	fmt.Printf("\nDuration: %dms\n", result.DurationMs)
 	fmt.Printf("Total URLs found: %d\n", result.Total)
 
 	// 打印前20个URL
@@ -139,7 +139,7 @@ func TestKatanaDeepCrawl(t *testing.T) {
 		t.Fatalf("DeepCrawl failed: %v", err)
 	}
 
-	fmt.Printf("Duration: %s\n", result.Duration)
+	fmt.Printf("Duration: %dms\n", result.DurationMs)
 	fmt.Printf("Total URLs found: %d\n", result.Total)
 
 	// 按状态码统计
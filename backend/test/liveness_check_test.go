@@ -0,0 +1,196 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/portscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 主机存活预检测测试 ==========
+// 本地监听端口模拟存活主机，RFC5737 文档地址模拟不存活主机
+
+// listenLocal 启动本地监听，返回端口
+func listenLocal(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// unroutableDial 模拟不可路由网络：RFC5737 文档地址的连接一直等到超时
+// 部分网关会对文档地址直接返回 RST，使用真实拨号时结果取决于运行环境
+func unroutableDial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(address)
+	for _, cidr := range []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"} {
+		_, block, _ := net.ParseCIDR(cidr)
+		if block.Contains(net.ParseIP(host)) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// closedLocalPort 获取一个未监听的本地端口
+func closedLocalPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// TestLivenessProbe 端口开放或拒绝连接视为存活，全部超时视为不存活
+func TestLivenessProbe(t *testing.T) {
+	printSeparator("主机存活探测测试")
+
+	open := listenLocal(t)
+	closed := closedLocalPort(t)
+	prober := portscan.NewLivenessProber(portscan.LivenessConfig{
+		Ports:   []int{open, closed},
+		Timeout: 300 * time.Millisecond,
+		Dial:    unroutableDial,
+	})
+
+	local := prober.Probe(context.Background(), "127.0.0.1")
+	if !local.Alive || local.Method != "tcp" {
+		t.Errorf("本地主机应判定为存活: %+v", local)
+	}
+	evidence := strings.Join(local.Evidence, ",")
+	if !contains(evidence, "open") || !contains(evidence, "refused") {
+		t.Errorf("探测证据应包含开放和拒绝的端口: %s", evidence)
+	}
+
+	dead := prober.Probe(context.Background(), "192.0.2.1")
+	if dead.Alive {
+		t.Errorf("RFC5737 地址不应判定为存活: %+v", dead)
+	}
+	if len(dead.Evidence) != 2 {
+		t.Errorf("不存活主机应记录每个端口的探测证据: %v", dead.Evidence)
+	}
+}
+
+// TestLivenessModuleFilter 只转发存活主机，不存活主机带证据记录，总目标数随过滤更新
+func TestLivenessModuleFilter(t *testing.T) {
+	printSeparator("存活预检测模块测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	open := listenLocal(t)
+	prober := portscan.NewLivenessProber(portscan.LivenessConfig{
+		Ports:       []int{open},
+		Timeout:     300 * time.Millisecond,
+		Concurrency: 8,
+		Dial:        unroutableDial,
+	})
+
+	targets := []string{"127.0.0.1", "192.0.2.1", "198.51.100.0/30", "example.com"}
+	tracker := pipeline.NewProgressTracker(len(targets), nil)
+
+	recorded := make(chan interface{}, 100)
+	forwarded := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, forwarded)
+	collector.SetInput(make(chan interface{}, 100))
+
+	module := pipeline.NewLivenessModule(ctx, collector, prober, func(v interface{}) { recorded <- v })
+	module.SetInput(make(chan interface{}, 100))
+	module.SetProgressTracker(tracker)
+
+	for _, target := range targets {
+		module.GetInput() <- target
+	}
+	module.CloseInput()
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("模块运行失败: %v", err)
+	}
+	close(forwarded)
+	close(recorded)
+
+	var passed []string
+	for v := range forwarded {
+		passed = append(passed, v.(string))
+	}
+	sort.Strings(passed)
+	if strings.Join(passed, ",") != "127.0.0.1,example.com" {
+		t.Errorf("应只转发存活主机和域名目标: %v", passed)
+	}
+
+	var deadHosts []string
+	for v := range recorded {
+		host, ok := v.(pipeline.HostLiveness)
+		if !ok {
+			t.Fatalf("记录的结果类型不正确: %T", v)
+		}
+		if host.Alive || len(host.Evidence) == 0 {
+			t.Errorf("不存活主机应包含探测证据: %+v", host)
+		}
+		deadHosts = append(deadHosts, host.IP)
+	}
+	sort.Strings(deadHosts)
+	want := "192.0.2.1,198.51.100.0,198.51.100.1,198.51.100.2,198.51.100.3"
+	if strings.Join(deadHosts, ",") != want {
+		t.Errorf("不存活主机记录不正确: %v", deadHosts)
+	}
+
+	report := tracker.GetReport()
+	if report.TotalTargets != 2 {
+		t.Errorf("过滤后总目标数应为 2, 实际 %d", report.TotalTargets)
+	}
+	if mp := report.ModuleProgresses["LivenessCheck"]; mp == nil || mp.TotalItems != 6 || mp.OutputItems != 1 {
+		t.Errorf("存活检测模块进度不正确: %+v", mp)
+	}
+}
+
+// TestLivenessTaskConfig 任务配置中的存活检测端口、超时、并发和 ICMP 设置可以提交并校验
+func TestLivenessTaskConfig(t *testing.T) {
+	printSeparator("存活检测任务配置测试")
+
+	var config models.TaskConfig
+	body := `{"liveness_check":true,"liveness_ports":[22,3389],"liveness_timeout":800,"liveness_concurrency":64,"liveness_icmp":true}`
+	if err := json.Unmarshal([]byte(body), &config); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(config.LivenessPorts) != 2 || config.LivenessTimeout != 800 || config.LivenessConcurrency != 64 || !config.LivenessICMP {
+		t.Fatalf("存活检测设置应写入任务配置: %+v", config)
+	}
+	if err := service.ValidateLivenessConfig(config); err != nil {
+		t.Errorf("有效的存活检测设置不应报错: %v", err)
+	}
+
+	for _, invalid := range []models.TaskConfig{
+		{LivenessPorts: []int{0}},
+		{LivenessPorts: []int{65536}},
+		{LivenessTimeout: -1},
+		{LivenessConcurrency: -1},
+	} {
+		if err := service.ValidateLivenessConfig(invalid); err == nil {
+			t.Errorf("无效的存活检测设置应报错: %+v", invalid)
+		}
+	}
+}
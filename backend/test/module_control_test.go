@@ -0,0 +1,358 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 模块运行时控制测试 ==========
+// 指纹识别 -> 截图（浏览器不可用时只传递数据）-> 结果收集，用故障注入的逐条停顿模拟处理慢的模块
+
+// controlRun 受控流水线的运行结果
+type controlRun struct {
+	results []interface{}
+	err     error
+	report  *pipeline.ProgressReport
+	events  []pipeline.Event
+	dropped map[string]int64
+}
+
+// processed 模块处理了至少 n 个目标
+func processed(module string, n int) func(report *pipeline.ProgressReport) bool {
+	return func(report *pipeline.ProgressReport) bool {
+		mp := report.ModuleProgresses[module]
+		return mp != nil && mp.ProcessedItems >= n
+	}
+}
+
+// runControlledPipeline 运行流水线，ready 返回 true 后调用 control
+func runControlledPipeline(t *testing.T, targets int, ready func(report *pipeline.ProgressReport) bool, control func(pipe *pipeline.StreamingPipeline), faults ...pipeline.ModuleFault) *controlRun {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:   true,
+		Screenshot:    true,
+		ScreenshotDir: t.TempDir(),
+		Faults:        &pipeline.FaultConfig{Faults: faults},
+	}
+	hosts := make([]string, targets)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%d.example.com", i)
+	}
+
+	run := &controlRun{dropped: make(map[string]int64)}
+	var mu sync.Mutex
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, targets, nil)
+	pipe.SetEventHandler(func(e pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		run.events = append(run.events, e)
+	})
+	if err := pipe.Start(hosts); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run.results = pipe.Wait()
+	}()
+
+	deadline := time.After(10 * time.Second)
+	for report := pipe.GetProgressReport(); report == nil || !ready(report); report = pipe.GetProgressReport() {
+		select {
+		case <-deadline:
+			t.Fatalf("流水线未运行到发送控制指令的时机")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	control(pipe)
+
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatalf("控制模块后流水线未结束")
+	}
+	run.err = pipe.Err()
+	run.report = pipe.GetProgressReport()
+	for _, c := range pipe.Suppression().Counts() {
+		run.dropped[c.Reason] += c.Count
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return run
+}
+
+// module 进度报告中的模块进度
+func (r *controlRun) module(name string) *pipeline.ModuleProgress {
+	if mp := r.report.ModuleProgresses[name]; mp != nil {
+		return mp
+	}
+	return &pipeline.ModuleProgress{}
+}
+
+// controlEvents 指定模块的控制事件
+func (r *controlRun) controlEvents(module string) []pipeline.Event {
+	var events []pipeline.Event
+	for _, e := range r.events {
+		if e.Module == module && e.Type == pipeline.EventModuleControl {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// TestModuleControlSkip 慢模块跳过剩余输入：已转发的数据经过下游模块，任务正常完成，进度停在跳过时
+func TestModuleControlSkip(t *testing.T) {
+	printSeparator("模块跳过剩余输入测试")
+
+	var skipErr error
+	run := runControlledPipeline(t, 20, processed("Fingerprint", 3), func(pipe *pipeline.StreamingPipeline) {
+		skipErr = pipe.ApplyControl(pipeline.ControlMessage{Module: "Fingerprint", Action: pipeline.ControlSkip})
+	}, pipeline.ModuleFault{Module: "Fingerprint", Delay: 50 * time.Millisecond})
+
+	if skipErr != nil {
+		t.Fatalf("跳过指令执行失败: %v", skipErr)
+	}
+	if run.err != nil {
+		t.Fatalf("跳过模块不应终止任务: %v", run.err)
+	}
+	if len(run.results) < 3 || len(run.results) >= 20 {
+		t.Fatalf("应只输出跳过前转发的结果: %d", len(run.results))
+	}
+	fp := run.module("Fingerprint")
+	if fp.Status != "skipped" || fp.Progress >= 100 {
+		t.Errorf("跳过的模块状态应为 skipped 且进度保持: %+v", fp)
+	}
+	if s := run.module("Screenshot").Status; s != "completed" {
+		t.Errorf("下游模块应正常完成: %q", s)
+	}
+	if run.report.OverallProgress != 100 {
+		t.Errorf("跳过的模块不再计入剩余进度: %d", run.report.OverallProgress)
+	}
+	if dropped := run.dropped[pipeline.SuppressModuleSkipped]; dropped == 0 || int(dropped)+len(run.results) > 20 {
+		t.Errorf("跳过的目标应计入丢弃统计: dropped=%d results=%d", dropped, len(run.results))
+	}
+	if events := run.controlEvents("Fingerprint"); len(events) != 1 || events[0].Data["action"] != pipeline.ControlSkip {
+		t.Errorf("应记录一次跳过事件: %+v", events)
+	}
+}
+
+// TestModuleControlStop 停止下游的慢模块：上游正常完成，已经收到的结果继续入库
+func TestModuleControlStop(t *testing.T) {
+	printSeparator("模块停止测试")
+
+	// 截图模块不可用时只传递数据、不报告进度，运行一段时间后停止
+	start := time.Now()
+	ready := func(*pipeline.ProgressReport) bool { return time.Since(start) > 300*time.Millisecond }
+	var stopErr error
+	run := runControlledPipeline(t, 20, ready, func(pipe *pipeline.StreamingPipeline) {
+		stopErr = pipe.ApplyControl(pipeline.ControlMessage{Module: "Screenshot", Action: pipeline.ControlStop})
+	}, pipeline.ModuleFault{Module: "Screenshot", Delay: 50 * time.Millisecond})
+
+	if stopErr != nil {
+		t.Fatalf("停止指令执行失败: %v", stopErr)
+	}
+	if run.err != nil {
+		t.Fatalf("停止模块不应终止任务: %v", run.err)
+	}
+	if len(run.results) == 0 || len(run.results) >= 20 {
+		t.Fatalf("应只输出停止前处理的结果: %d", len(run.results))
+	}
+	if s := run.module("Fingerprint").Status; s != "completed" {
+		t.Errorf("上游模块应正常完成: %q", s)
+	}
+	if s := run.module("Screenshot").Status; s != "stopped" {
+		t.Errorf("停止的模块状态应为 stopped: %q", s)
+	}
+	if events := run.controlEvents("Screenshot"); len(events) != 1 || events[0].Data["action"] != pipeline.ControlStop {
+		t.Errorf("应记录一次停止事件: %+v", events)
+	}
+}
+
+// TestModuleControlErrors 并发调整只对支持的模块生效，未启用的模块、未知指令和已结束的模块返回错误
+func TestModuleControlErrors(t *testing.T) {
+	printSeparator("模块控制指令校验测试")
+
+	var pipe *pipeline.StreamingPipeline
+	errs := make(map[string]error)
+	run := runControlledPipeline(t, 10, processed("Fingerprint", 2), func(p *pipeline.StreamingPipeline) {
+		pipe = p
+		errs["fingerprint"] = p.ApplyControl(pipeline.ControlMessage{Module: "Fingerprint", Action: pipeline.ControlConcurrency, Concurrency: 2})
+		errs["screenshot"] = p.ApplyControl(pipeline.ControlMessage{Module: "Screenshot", Action: pipeline.ControlConcurrency, Concurrency: 2})
+		errs["zero"] = p.ApplyControl(pipeline.ControlMessage{Module: "Fingerprint", Action: pipeline.ControlConcurrency})
+		errs["crawler"] = p.ApplyControl(pipeline.ControlMessage{Module: "Crawler", Action: pipeline.ControlStop})
+		errs["action"] = p.ApplyControl(pipeline.ControlMessage{Module: "Fingerprint", Action: "pause"})
+	}, pipeline.ModuleFault{Module: "Fingerprint", Delay: 20 * time.Millisecond})
+
+	if errs["fingerprint"] != nil {
+		t.Errorf("指纹识别应支持调整并发: %v", errs["fingerprint"])
+	}
+	for _, name := range []string{"screenshot", "zero", "crawler", "action"} {
+		if errs[name] == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+	if errs["crawler"] != nil && !strings.Contains(errs["crawler"].Error(), "未启用") {
+		t.Errorf("未启用的模块应提示未启用: %v", errs["crawler"])
+	}
+	if run.err != nil || len(run.results) != 10 {
+		t.Fatalf("调整并发不应影响结果: %d (%v)", len(run.results), run.err)
+	}
+	if events := run.controlEvents("Fingerprint"); len(events) != 1 || events[0].Data["concurrency"] != 2 {
+		t.Errorf("应记录一次并发调整事件: %+v", events)
+	}
+	if err := pipe.ApplyControl(pipeline.ControlMessage{Module: "Fingerprint", Action: pipeline.ControlSkip}); err == nil {
+		t.Error("已结束的模块不应接受指令")
+	}
+}
+
+// memoryControlStore 内存中的控制指令存储
+type memoryControlStore struct {
+	mu       sync.Mutex
+	controls []*models.TaskControl
+}
+
+func (s *memoryControlStore) CreateControl(ctx context.Context, control *models.TaskControl) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	control.ID = primitive.NewObjectID()
+	s.controls = append(s.controls, control)
+	return nil
+}
+
+func (s *memoryControlStore) PendingControls(ctx context.Context, taskIDs []primitive.ObjectID) ([]*models.TaskControl, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []*models.TaskControl
+	for _, c := range s.controls {
+		for _, id := range taskIDs {
+			if c.TaskID == id && c.Status == models.TaskControlPending {
+				cp := *c
+				pending = append(pending, &cp)
+			}
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	return pending, nil
+}
+
+func (s *memoryControlStore) FinishControl(ctx context.Context, control *models.TaskControl) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.controls {
+		if c.ID == control.ID && c.Status == models.TaskControlPending {
+			cp := *control
+			s.controls[i] = &cp
+		}
+	}
+	return nil
+}
+
+func (s *memoryControlStore) ListControls(ctx context.Context, taskID primitive.ObjectID) ([]*models.TaskControl, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*models.TaskControl
+	for _, c := range s.controls {
+		if c.TaskID == taskID {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+// recordingTarget 记录收到的指令，Screenshot 的指令返回错误
+type recordingTarget struct {
+	received []pipeline.ControlMessage
+}
+
+func (r *recordingTarget) ApplyControl(msg pipeline.ControlMessage) error {
+	r.received = append(r.received, msg)
+	if msg.Module == "Screenshot" {
+		return errors.New("模块 Screenshot 不支持调整并发")
+	}
+	return nil
+}
+
+// TestApplyTaskControls 执行器只执行本进程运行中任务的指令，按创建顺序执行并记录结果
+func TestApplyTaskControls(t *testing.T) {
+	printSeparator("任务模块控制指令执行测试")
+
+	ctx := context.Background()
+	store := &memoryControlStore{}
+	local := &models.Task{ID: primitive.NewObjectID(), Status: models.TaskStatusRunning}
+	remote := &models.Task{ID: primitive.NewObjectID(), Status: models.TaskStatusRunning}
+
+	msgs := []struct {
+		task *models.Task
+		msg  pipeline.ControlMessage
+	}{
+		{local, pipeline.ControlMessage{Module: "Crawler", Action: pipeline.ControlStop, Concurrency: 8}},
+		{local, pipeline.ControlMessage{Module: "Screenshot", Action: pipeline.ControlConcurrency, Concurrency: 2}},
+		{remote, pipeline.ControlMessage{Module: "DirScan", Action: pipeline.ControlSkip}},
+	}
+	for i, m := range msgs {
+		control, err := service.NewTaskControl(m.task, m.msg, "admin")
+		if err != nil {
+			t.Fatalf("创建指令失败: %v", err)
+		}
+		control.CreatedAt = control.CreatedAt.Add(time.Duration(i) * time.Millisecond)
+		store.CreateControl(ctx, control)
+	}
+
+	target := &recordingTarget{}
+	if n := service.ApplyTaskControls(ctx, store, "node-a", map[string]service.ControlTarget{local.ID.Hex(): target}); n != 2 {
+		t.Fatalf("应执行本进程任务的 2 条指令: %d", n)
+	}
+	if len(target.received) != 2 || target.received[0].Module != "Crawler" || target.received[0].Concurrency != 0 || target.received[1].Concurrency != 2 {
+		t.Errorf("指令应按创建顺序执行，非并发指令不带并发数: %+v", target.received)
+	}
+
+	controls, _ := store.ListControls(ctx, local.ID)
+	if controls[0].Status != models.TaskControlApplied || controls[0].NodeID != "node-a" || controls[0].AppliedAt.IsZero() {
+		t.Errorf("执行成功的指令应标记 applied: %+v", controls[0])
+	}
+	if controls[1].Status != models.TaskControlFailed || controls[1].Error == "" {
+		t.Errorf("执行失败的指令应记录原因: %+v", controls[1])
+	}
+	if others, _ := store.ListControls(ctx, remote.ID); others[0].Status != models.TaskControlPending {
+		t.Errorf("其他执行器的任务指令应保持 pending: %+v", others[0])
+	}
+
+	// 已执行的指令不会重复执行
+	if n := service.ApplyTaskControls(ctx, store, "node-a", map[string]service.ControlTarget{local.ID.Hex(): target}); n != 0 {
+		t.Errorf("已执行的指令不应重复执行: %d", n)
+	}
+
+	// 指令校验
+	paused := &models.Task{ID: primitive.NewObjectID(), Status: models.TaskStatusPaused}
+	if _, err := service.NewTaskControl(paused, pipeline.ControlMessage{Module: "Crawler", Action: pipeline.ControlStop}, ""); !errors.Is(err, service.ErrTaskNotRunning) {
+		t.Errorf("未运行的任务应返回 ErrTaskNotRunning: %v", err)
+	}
+	invalid := []pipeline.ControlMessage{
+		{Action: pipeline.ControlStop},
+		{Module: "Crawler", Action: "pause"},
+		{Module: "Fingerprint", Action: pipeline.ControlConcurrency},
+	}
+	for _, msg := range invalid {
+		if _, err := service.NewTaskControl(local, msg, ""); err == nil {
+			t.Errorf("无效指令应返回错误: %+v", msg)
+		}
+	}
+}
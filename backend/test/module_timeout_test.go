@@ -0,0 +1,237 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 模块超时测试 ==========
+// 超时单位缩短为 100ms，用故障注入的逐条停顿模拟处理慢的模块
+
+// moduleTimeoutRun 流水线运行结果
+type moduleTimeoutRun struct {
+	results  []interface{}
+	err      error
+	report   *pipeline.ProgressReport
+	events   []pipeline.Event
+	dropped  int64
+	duration time.Duration
+}
+
+// runModuleTimeoutPipeline 指纹识别 -> 截图（浏览器不可用时只传递数据）-> 结果收集，目标字符串原样传递到结果
+func runModuleTimeoutPipeline(t *testing.T, targets int, timeouts map[string]int, faults ...pipeline.ModuleFault) *moduleTimeoutRun {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:    true,
+		Screenshot:     true,
+		ScreenshotDir:  t.TempDir(),
+		ModuleTimeouts: timeouts,
+		TimeoutUnit:    100 * time.Millisecond,
+		Faults:         &pipeline.FaultConfig{Faults: faults},
+	}
+	hosts := make([]string, targets)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%d.example.com", i)
+	}
+
+	run := &moduleTimeoutRun{}
+	var mu sync.Mutex
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, targets, nil)
+	pipe.SetEventHandler(func(e pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		run.events = append(run.events, e)
+	})
+
+	start := time.Now()
+	if err := pipe.Start(hosts); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run.results = pipe.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatalf("模块超时后流水线未结束")
+	}
+	run.duration = time.Since(start)
+	run.err = pipe.Err()
+	run.report = pipe.GetProgressReport()
+	for _, c := range pipe.Suppression().Counts() {
+		if c.Reason == pipeline.SuppressModuleTimeout {
+			run.dropped += c.Count
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return run
+}
+
+// moduleStatus 进度报告中模块的状态
+func (r *moduleTimeoutRun) moduleStatus(name string) string {
+	if mp := r.report.ModuleProgresses[name]; mp != nil {
+		return mp.Status
+	}
+	return ""
+}
+
+// timeoutEvents 指定模块的超时事件
+func (r *moduleTimeoutRun) timeoutEvents(module string) int {
+	n := 0
+	for _, e := range r.events {
+		if e.Module == module && e.Type == pipeline.EventModuleTimeout {
+			n++
+		}
+	}
+	return n
+}
+
+// TestModuleTimeoutPartialResults 上游模块超时：已输出的结果继续经过下游模块，任务正常完成
+func TestModuleTimeoutPartialResults(t *testing.T) {
+	printSeparator("模块超时部分结果测试")
+
+	run := runModuleTimeoutPipeline(t, 20, map[string]int{"Fingerprint": 3},
+		pipeline.ModuleFault{Module: "Fingerprint", Delay: 50 * time.Millisecond})
+
+	if run.err != nil {
+		t.Fatalf("模块超时不应终止任务: %v", run.err)
+	}
+	if len(run.results) == 0 || len(run.results) >= 20 {
+		t.Fatalf("应只输出超时前处理的部分结果: %d", len(run.results))
+	}
+	if run.duration > 5*time.Second {
+		t.Errorf("超时后流水线应尽快结束: %v", run.duration)
+	}
+	if s := run.moduleStatus("Fingerprint"); s != "timeout" {
+		t.Errorf("超时模块的状态应为 timeout: %q", s)
+	}
+	if s := run.moduleStatus("Screenshot"); s != "completed" {
+		t.Errorf("下游模块应正常完成: %q", s)
+	}
+	if run.report.OverallProgress != 100 {
+		t.Errorf("超时模块不再计入剩余进度: %d", run.report.OverallProgress)
+	}
+	if run.timeoutEvents("Fingerprint") != 1 {
+		t.Errorf("应记录一次模块超时事件: %+v", run.events)
+	}
+	if run.dropped == 0 || int(run.dropped)+len(run.results) > 20 {
+		t.Errorf("超时后收到的目标应计入丢弃统计: dropped=%d results=%d", run.dropped, len(run.results))
+	}
+}
+
+// TestModuleTimeoutDownstream 下游模块超时：上游不被阻塞，正常完成
+func TestModuleTimeoutDownstream(t *testing.T) {
+	printSeparator("下游模块超时测试")
+
+	run := runModuleTimeoutPipeline(t, 20, map[string]int{"Screenshot": 3},
+		pipeline.ModuleFault{Module: "Screenshot", Delay: 50 * time.Millisecond})
+
+	if run.err != nil {
+		t.Fatalf("模块超时不应终止任务: %v", run.err)
+	}
+	if len(run.results) == 0 || len(run.results) >= 20 {
+		t.Fatalf("应只输出超时前处理的部分结果: %d", len(run.results))
+	}
+	if s := run.moduleStatus("Fingerprint"); s != "completed" {
+		t.Errorf("上游模块应正常完成: %q", s)
+	}
+	if s := run.moduleStatus("Screenshot"); s != "timeout" {
+		t.Errorf("超时模块的状态应为 timeout: %q", s)
+	}
+	if run.timeoutEvents("Screenshot") != 1 || run.timeoutEvents("Fingerprint") != 0 {
+		t.Errorf("只有超时的模块记录超时事件: %+v", run.events)
+	}
+}
+
+// TestModuleTimeoutDefaults 未配置模块超时时行为不变，所有结果输出
+func TestModuleTimeoutDefaults(t *testing.T) {
+	printSeparator("模块超时默认配置测试")
+
+	run := runModuleTimeoutPipeline(t, 20, nil,
+		pipeline.ModuleFault{Module: "Fingerprint", Delay: 5 * time.Millisecond})
+
+	if run.err != nil || len(run.results) != 20 {
+		t.Fatalf("期望 20 条结果, 实际 %d (%v)", len(run.results), run.err)
+	}
+	for _, name := range []string{"Fingerprint", "Screenshot"} {
+		if s := run.moduleStatus(name); s != "completed" {
+			t.Errorf("%s 状态应为 completed: %q", name, s)
+		}
+		if run.timeoutEvents(name) != 0 {
+			t.Errorf("%s 不应记录超时事件", name)
+		}
+	}
+	if run.dropped != 0 {
+		t.Errorf("不应丢弃数据: %d", run.dropped)
+	}
+
+	// 模块在截止时间前完成时不标记超时
+	run = runModuleTimeoutPipeline(t, 5, map[string]int{"Fingerprint": 5, "Screenshot": 5})
+	if run.err != nil || len(run.results) != 5 || run.moduleStatus("Fingerprint") != "completed" {
+		t.Fatalf("截止时间前完成的模块应正常结束: %d %q (%v)", len(run.results), run.moduleStatus("Fingerprint"), run.err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	if run.timeoutEvents("Fingerprint") != 0 {
+		t.Errorf("流水线结束后不应再记录超时事件")
+	}
+}
+
+// TestGlobalTimeoutTaskTimeLimit 流水线的全局超时即任务类型的时间上限，到达时终止流水线
+func TestGlobalTimeoutTaskTimeLimit(t *testing.T) {
+	printSeparator("流水线全局超时测试")
+
+	limits := service.DefaultTaskTimeLimits()
+	limits.Types = map[models.TaskType]time.Duration{models.TaskTypeFingerprint: 300 * time.Millisecond}
+	service.SetTaskTimeLimits(limits)
+	defer service.SetTaskTimeLimits(service.DefaultTaskTimeLimits())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint: true,
+		Faults: &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{
+			{Module: "Fingerprint", Stall: 10 * time.Second},
+		}},
+	}
+	service.ApplyTaskTimeouts(config, &models.Task{Type: models.TaskTypeFingerprint})
+	if config.TimeLimit != 300*time.Millisecond {
+		t.Fatalf("全局超时应为任务类型的时间上限: %v", config.TimeLimit)
+	}
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, config)
+	if err := pipe.Start([]string{"a.example.com"}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pipe.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatalf("流水线未在全局超时后结束")
+	}
+
+	var tlErr *pipeline.TimeLimitError
+	if !errors.As(pipe.Err(), &tlErr) || tlErr.Limit != 300*time.Millisecond {
+		t.Errorf("期望全局超时错误, 实际 %v", pipe.Err())
+	}
+}
@@ -0,0 +1,420 @@
+package test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/service"
+	"moongazing/service/notify"
+	"moongazing/utils"
+)
+
+// ========== 通知渠道测试 ==========
+
+// captureServer 记录收到的请求，按 reply 返回响应
+type captureServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []map[string]interface{}
+}
+
+func newCaptureServer(t *testing.T, reply string) *captureServer {
+	s := &captureServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, payload)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *captureServer) last(t *testing.T) (*http.Request, map[string]interface{}) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		t.Fatalf("服务端未收到请求")
+	}
+	return s.requests[len(s.requests)-1], s.bodies[len(s.bodies)-1]
+}
+
+func testMessage() *notify.NotifyMessage {
+	return &notify.NotifyMessage{
+		Level:     notify.NotifyLevelCritical,
+		Title:     "发现漏洞: SQL 注入",
+		Content:   "**目标**: https://a.example.com",
+		Source:    "vuln_scanner",
+		Timestamp: time.Now(),
+	}
+}
+
+// TestDingTalkSignedWebhook 钉钉加签：签名参数附加在原有的 access_token 之后，签名按 HmacSHA256(secret, timestamp\nsecret) 计算
+func TestDingTalkSignedWebhook(t *testing.T) {
+	printSeparator("钉钉加签测试")
+
+	const secret = "SEC0123456789abcdef"
+	server := newCaptureServer(t, `{"errcode":0,"errmsg":"ok"}`)
+	dingtalk := notify.NewDingTalkNotifier(server.URL+"/robot/send?access_token=abc", secret)
+	if err := dingtalk.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	req, body := server.last(t)
+	query := req.URL.Query()
+	if query.Get("access_token") != "abc" {
+		t.Errorf("应保留 access_token: %s", req.URL.RawQuery)
+	}
+	ts, err := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+	if err != nil || time.Since(time.UnixMilli(ts)) > time.Minute {
+		t.Fatalf("timestamp 应为当前毫秒时间戳: %s", query.Get("timestamp"))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d\n%s", ts, secret)))
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if query.Get("sign") != want || notify.DingTalkSign(ts, secret) != want {
+		t.Errorf("签名不正确: %s, 期望 %s", query.Get("sign"), want)
+	}
+	if body["msgtype"] != "markdown" {
+		t.Errorf("应发送 markdown 消息: %v", body)
+	}
+
+	// 钉钉以 200 返回错误码
+	failing := newCaptureServer(t, `{"errcode":310000,"errmsg":"sign not match"}`)
+	err = notify.NewDingTalkNotifier(failing.URL+"/robot/send?access_token=abc", secret).Send(context.Background(), testMessage())
+	if err == nil || !strings.Contains(err.Error(), "310000") {
+		t.Errorf("错误码应视为发送失败: %v", err)
+	}
+}
+
+// TestFeishuCardPayload 飞书交互卡片：标题、按级别的颜色、字段、正文和时间备注，加签时带 timestamp 和 sign
+func TestFeishuCardPayload(t *testing.T) {
+	printSeparator("飞书卡片消息测试")
+
+	const secret = "feishu-secret"
+	server := newCaptureServer(t, `{"code":0,"msg":"success"}`)
+	msg := testMessage()
+	if err := notify.NewFeishuNotifier(server.URL, secret).Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	_, body := server.last(t)
+	if body["msg_type"] != "interactive" {
+		t.Fatalf("应发送交互卡片: %v", body)
+	}
+	card, _ := body["card"].(map[string]interface{})
+	header, _ := card["header"].(map[string]interface{})
+	title, _ := header["title"].(map[string]interface{})
+	if title["tag"] != "plain_text" || title["content"] != msg.Title || header["template"] != "red" {
+		t.Errorf("卡片标题不正确: %v", header)
+	}
+	elements, _ := card["elements"].([]interface{})
+	if len(elements) != 3 {
+		t.Fatalf("卡片应包含字段、正文和备注: %v", elements)
+	}
+	fields, _ := elements[0].(map[string]interface{})["fields"].([]interface{})
+	if len(fields) != 2 {
+		t.Errorf("应包含级别和来源两个字段: %v", elements[0])
+	}
+	text, _ := elements[1].(map[string]interface{})["text"].(map[string]interface{})
+	if text["tag"] != "lark_md" || text["content"] != msg.Content {
+		t.Errorf("卡片正文不正确: %v", elements[1])
+	}
+	if note, _ := elements[2].(map[string]interface{}); note["tag"] != "note" {
+		t.Errorf("最后一个元素应为时间备注: %v", elements[2])
+	}
+
+	// 签名：以 timestamp\nsecret 为密钥对空串做 HmacSHA256
+	ts, _ := body["timestamp"].(string)
+	mac := hmac.New(sha256.New, []byte(ts+"\n"+secret))
+	if ts == "" || body["sign"] != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("飞书签名不正确: %v %v", ts, body["sign"])
+	}
+
+	failing := newCaptureServer(t, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`)
+	if err := notify.NewFeishuNotifier(failing.URL, secret).Send(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "19021") {
+		t.Errorf("错误码应视为发送失败: %v", err)
+	}
+}
+
+// TestTelegramNotifier 通过 Bot API 的 sendMessage 发送纯文本消息，错误信息中不包含 token
+func TestTelegramNotifier(t *testing.T) {
+	printSeparator("Telegram 通知测试")
+
+	const token = "123456:ABC-token"
+	server := newCaptureServer(t, `{"ok":true,"result":{}}`)
+	if err := notify.NewTelegramNotifier(token, "-100200", server.URL).Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	req, body := server.last(t)
+	if req.URL.Path != "/bot"+token+"/sendMessage" {
+		t.Errorf("请求路径不正确: %s", req.URL.Path)
+	}
+	if body["chat_id"] != "-100200" || !strings.HasPrefix(fmt.Sprint(body["text"]), "发现漏洞: SQL 注入\n\n") || body["parse_mode"] != nil {
+		t.Errorf("消息内容不正确: %v", body)
+	}
+
+	failing := newCaptureServer(t, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+	err := notify.NewTelegramNotifier(token, "-1", failing.URL).Send(context.Background(), testMessage())
+	if err == nil || !strings.Contains(err.Error(), "chat not found") || strings.Contains(err.Error(), token) {
+		t.Errorf("ok=false 应视为发送失败且不泄露 token: %v", err)
+	}
+}
+
+// TestNotifyMessageTemplates 英文内置模板、自定义模板和中文默认消息
+func TestNotifyMessageTemplates(t *testing.T) {
+	printSeparator("通知消息模板测试")
+
+	server := newCaptureServer(t, `{}`)
+	send := func(config notify.NotifyConfig, msg *notify.NotifyMessage) map[string]interface{} {
+		t.Helper()
+		config.Type = notify.NotifyTypeWebhook
+		config.Name = "hook"
+		config.WebhookURL = server.URL
+		notifier, err := notify.NewChannelNotifier(config)
+		if err != nil || notifier == nil {
+			t.Fatalf("创建渠道失败: %v", err)
+		}
+		if err := notifier.Send(context.Background(), msg); err != nil {
+			t.Fatalf("发送失败: %v", err)
+		}
+		_, body := server.last(t)
+		return body
+	}
+	complete := func() *notify.NotifyMessage {
+		return &notify.NotifyMessage{
+			Event:     notify.EventTaskCompleted,
+			Level:     notify.NotifyLevelInfo,
+			Title:     "✅ 扫描完成: demo",
+			Content:   "扫描任务已完成",
+			Timestamp: time.Now(),
+			Extra: map[string]interface{}{
+				"workspace_id": "ws1",
+				"task_name":    "demo",
+				"task_id":      "t1",
+				"stats":        map[string]interface{}{"result_count": 42, "targets": []string{"a.com", "b.com"}},
+			},
+		}
+	}
+
+	body := send(notify.NotifyConfig{Language: notify.LanguageEn}, complete())
+	if body["title"] != "✅ Scan completed: demo" || body["content"] != "Task demo completed\nTargets: a.com, b.com\nResults: 42" {
+		t.Errorf("英文模板渲染不正确: %v", body)
+	}
+
+	msg := complete()
+	body = send(notify.NotifyConfig{}, msg)
+	if body["title"] != msg.Title || body["content"] != msg.Content {
+		t.Errorf("中文默认使用原消息: %v", body)
+	}
+
+	body = send(notify.NotifyConfig{
+		Language:        notify.LanguageEn,
+		TitleTemplate:   `[{{upper .Level}}] {{.TaskName}}`,
+		ContentTemplate: `{{.Event}}: {{len .Targets}} targets, {{.Counts.result_count}} results, see {{.TaskLink}}`,
+	}, complete())
+	if body["title"] != "[INFO] demo" || body["content"] != "task_completed: 2 targets, 42 results, see /tasks/t1" {
+		t.Errorf("自定义模板渲染不正确: %v", body)
+	}
+
+	finding := &notify.NotifyMessage{
+		Event: notify.EventFinding, Level: notify.NotifyLevelCritical, Title: "🚨 发现HIGH漏洞: XSS", Timestamp: time.Now(),
+		Extra: map[string]interface{}{"task_name": "demo", "vuln_name": "XSS", "severity": "high", "target": "https://a.com", "vuln_id": "xss-1"},
+	}
+	body = send(notify.NotifyConfig{Language: notify.LanguageEn}, finding)
+	if body["title"] != "🚨 HIGH finding: XSS" || !strings.Contains(fmt.Sprint(body["content"]), "**Vuln ID**: xss-1") {
+		t.Errorf("漏洞通知英文模板不正确: %v", body)
+	}
+
+	for _, bad := range []notify.NotifyConfig{
+		{Name: "x", Type: notify.NotifyTypeWebhook, WebhookURL: server.URL, ContentTemplate: "{{.Missing"},
+		{Name: "x", Type: notify.NotifyTypeWebhook, WebhookURL: server.URL, ContentTemplate: "{{.NoSuchField}}"},
+		{Name: "x", Type: notify.NotifyTypeWebhook, WebhookURL: server.URL, Language: "fr"},
+		{Name: "x", Type: notify.NotifyTypeTelegram, TelegramBotToken: "t"},
+		{Name: "x", Type: notify.NotifyTypeDingTalk, DingTalkWebhook: "not a url"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("无效配置应校验失败: %+v", bad)
+		}
+	}
+}
+
+// TestNotifyChannelWorkspaceRouting 工作空间渠道只接收本空间的通知，全局渠道接收全部
+func TestNotifyChannelWorkspaceRouting(t *testing.T) {
+	printSeparator("通知渠道工作空间路由测试")
+
+	m := notify.NewNotifyManager()
+	m.AddConfig(notify.NotifyConfig{Name: "global", Type: notify.NotifyTypeWebhook, Enabled: true, WebhookURL: "http://127.0.0.1:1/global"})
+	m.AddConfig(notify.NotifyConfig{ID: "c1", WorkspaceID: "ws-a", Name: "team", Type: notify.NotifyTypeWebhook, Enabled: true, WebhookURL: "http://127.0.0.1:1/a"})
+	m.AddConfig(notify.NotifyConfig{ID: "c2", WorkspaceID: "ws-b", Name: "team", Type: notify.NotifyTypeWebhook, Enabled: true, WebhookURL: "http://127.0.0.1:1/b"})
+
+	channels := func(workspaceID string) []string {
+		deliveries, err := m.Enqueue(&notify.NotifyMessage{Title: "x", Extra: map[string]interface{}{"workspace_id": workspaceID}})
+		if err != nil {
+			t.Fatalf("写入投递失败: %v", err)
+		}
+		var names []string
+		for _, d := range deliveries {
+			names = append(names, d.Channel+"/"+d.ChannelID)
+		}
+		sort.Strings(names)
+		return names
+	}
+	if got := strings.Join(channels("ws-a"), ","); got != "global/,team/c1" {
+		t.Errorf("ws-a 应投递到全局渠道和本空间渠道: %s", got)
+	}
+	if got := strings.Join(channels("ws-c"), ","); got != "global/" {
+		t.Errorf("其他工作空间只投递到全局渠道: %s", got)
+	}
+
+	m.RemoveConfigByID("c1")
+	if got := strings.Join(channels("ws-a"), ","); got != "global/" {
+		t.Errorf("删除后不再投递: %s", got)
+	}
+}
+
+// memoryChannelStore 内存渠道存储，以加密记录保存
+type memoryChannelStore struct {
+	key     []byte
+	records map[string]*service.NotifyChannelRecord
+}
+
+func (s *memoryChannelStore) ListChannels(ctx context.Context, workspaceID *string) ([]*notify.NotifyConfig, error) {
+	var list []*notify.NotifyConfig
+	for _, r := range s.records {
+		if workspaceID != nil && r.WorkspaceID != *workspaceID {
+			continue
+		}
+		cfg, err := r.Open(s.key)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, cfg)
+	}
+	return list, nil
+}
+
+func (s *memoryChannelStore) GetChannel(ctx context.Context, id string) (*notify.NotifyConfig, error) {
+	r, ok := s.records[id]
+	if !ok {
+		return nil, service.ErrNotifyChannelNotFound
+	}
+	return r.Open(s.key)
+}
+
+func (s *memoryChannelStore) SaveChannel(ctx context.Context, cfg *notify.NotifyConfig) error {
+	r, err := service.SealNotifyChannel(cfg, s.key)
+	if err != nil {
+		return err
+	}
+	s.records[r.ID] = r
+	return nil
+}
+
+func (s *memoryChannelStore) DeleteChannel(ctx context.Context, id string) error {
+	if _, ok := s.records[id]; !ok {
+		return service.ErrNotifyChannelNotFound
+	}
+	delete(s.records, id)
+	return nil
+}
+
+// TestNotifyChannelService 渠道加密保存，更新时保留未修改的密钥，发送测试消息
+func TestNotifyChannelService(t *testing.T) {
+	printSeparator("通知渠道配置测试")
+
+	key := utils.DeriveKey("test-secret")
+	store := &memoryChannelStore{key: key, records: map[string]*service.NotifyChannelRecord{}}
+	manager := notify.NewNotifyManager()
+	svc := service.NewNotifyChannelService(store, manager)
+
+	server := newCaptureServer(t, `{"errcode":0}`)
+	cfg := &notify.NotifyConfig{
+		WorkspaceID:     "ws-a",
+		Name:            "ops",
+		Type:            notify.NotifyTypeDingTalk,
+		Enabled:         true,
+		DingTalkWebhook: server.URL + "/robot/send?access_token=tok-123",
+		DingTalkSecret:  "SECabcdefghijkl",
+	}
+	if err := svc.Create(cfg); err != nil || cfg.ID == "" {
+		t.Fatalf("创建渠道失败: %v", err)
+	}
+
+	record := store.records[cfg.ID]
+	if strings.Contains(record.Config, "tok-123") || strings.Contains(record.Config, "SECabcdefghijkl") || record.WorkspaceID != "ws-a" {
+		t.Errorf("渠道配置应加密保存: %+v", record)
+	}
+	if _, err := record.Open(utils.DeriveKey("other")); err == nil {
+		t.Errorf("错误的密钥不应能解密")
+	}
+	if len(manager.GetConfigs()) != 1 {
+		t.Errorf("保存后应加载到通知管理器")
+	}
+
+	// 前端回传脱敏后的密钥
+	masked := cfg.Masked()
+	if masked.DingTalkSecret == cfg.DingTalkSecret {
+		t.Fatalf("返回的配置应隐藏密钥")
+	}
+	masked.Name = "ops-renamed"
+	masked.WorkspaceID = "ws-b"
+	if err := svc.Update(cfg.ID, &masked); err != nil {
+		t.Fatalf("更新渠道失败: %v", err)
+	}
+	saved, _ := svc.Get(cfg.ID)
+	if saved.DingTalkSecret != "SECabcdefghijkl" || saved.Name != "ops-renamed" || saved.WorkspaceID != "ws-a" {
+		t.Errorf("更新应保留原密钥和工作空间: %+v", saved)
+	}
+
+	if err := svc.Test(cfg.ID); err != nil {
+		t.Fatalf("测试消息发送失败: %v", err)
+	}
+	req, body := server.last(t)
+	if req.URL.Query().Get("sign") == "" || !strings.Contains(fmt.Sprint(body["markdown"]), "测试通知") {
+		t.Errorf("测试消息应通过保存的渠道加签发送: %v", body)
+	}
+
+	if err := svc.Delete(cfg.ID); err != nil || len(manager.GetConfigs()) != 0 {
+		t.Errorf("删除后应从通知管理器移除: %v", err)
+	}
+	if _, err := svc.Get(cfg.ID); err != service.ErrNotifyChannelNotFound {
+		t.Errorf("删除后应不存在: %v", err)
+	}
+}
+
+// TestRetryNotifier 同步发送失败后按退避重试，超过次数返回最后的错误
+func TestRetryNotifier(t *testing.T) {
+	printSeparator("通知同步重试测试")
+
+	policy := notify.RetryPolicy{MaxAttempts: 3, BaseDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond}
+	flaky := &flakyNotifier{notifyType: notify.NotifyTypeWebhook, failures: 2}
+	if err := notify.NewRetryNotifier(flaky, policy).Send(context.Background(), testMessage()); err != nil || flaky.calls != 3 {
+		t.Errorf("第三次应发送成功: %v (%d 次)", err, flaky.calls)
+	}
+
+	broken := &flakyNotifier{notifyType: notify.NotifyTypeWebhook, failures: -1}
+	if err := notify.NewRetryNotifier(broken, policy).Send(context.Background(), testMessage()); err == nil || broken.calls != 3 {
+		t.Errorf("一直失败时应在 3 次后返回错误: %v (%d 次)", err, broken.calls)
+	}
+}
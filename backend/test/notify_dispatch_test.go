@@ -0,0 +1,182 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/service/notify"
+)
+
+// ========== 通知投递队列测试 ==========
+
+// flakyNotifier 前 failures 次发送失败（failures < 0 时一直失败），每次发送前等待 delay
+type flakyNotifier struct {
+	notifyType notify.NotifyType
+	failures   int
+	delay      time.Duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *flakyNotifier) Send(ctx context.Context, msg *notify.NotifyMessage) error {
+	if n.delay > 0 {
+		select {
+		case <-time.After(n.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.failures < 0 || n.calls <= n.failures {
+		return errors.New("channel unavailable")
+	}
+	return nil
+}
+
+func (n *flakyNotifier) Type() notify.NotifyType {
+	return n.notifyType
+}
+
+// fastRetryPolicy 测试用的短重试间隔
+func fastRetryPolicy() notify.RetryPolicy {
+	return notify.RetryPolicy{
+		MaxAttempts:  3,
+		BaseDelay:    10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+		SendTimeout:  time.Second,
+		PollInterval: 10 * time.Millisecond,
+	}
+}
+
+// waitDeliveries 等待工作空间的投递记录全部结束
+func waitDeliveries(t *testing.T, m *notify.NotifyManager, workspaceID string, want int) map[string]*notify.Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, _ := m.Deliveries(context.Background(), notify.DeliveryFilter{WorkspaceID: workspaceID})
+		byChannel := make(map[string]*notify.Delivery)
+		done := 0
+		for _, d := range deliveries {
+			byChannel[d.Channel] = d
+			if d.Status != notify.DeliveryPending {
+				done++
+			}
+		}
+		if done == want {
+			return byChannel
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("投递未在期限内结束: %+v", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestNotifyDeliveryRetry 不稳定的渠道重试后送达，一直失败的渠道最终标记为失败并记录错误
+func TestNotifyDeliveryRetry(t *testing.T) {
+	printSeparator("通知投递重试测试")
+
+	m := notify.NewNotifyManager()
+	m.SetRetryPolicy(fastRetryPolicy())
+	flaky := &flakyNotifier{notifyType: notify.NotifyTypeWebhook, failures: 2}
+	down := &flakyNotifier{notifyType: notify.NotifyTypeDingTalk, failures: -1}
+	m.AddNotifier("flaky", flaky)
+	m.AddNotifier("down", down)
+
+	m.NotifyTaskComplete("ws1", "扫描任务", "task1", true, "扫描任务已完成", nil)
+
+	// 启动前只入队
+	pending, _ := m.Deliveries(context.Background(), notify.DeliveryFilter{WorkspaceID: "ws1", Status: notify.DeliveryPending})
+	if len(pending) != 2 {
+		t.Fatalf("每个渠道应有一条待投递记录, 实际 %d", len(pending))
+	}
+	if pending[0].TaskID != "task1" || pending[0].Attempts != 0 {
+		t.Errorf("投递记录不正确: %+v", pending[0])
+	}
+
+	m.Start()
+	defer m.Stop()
+
+	byChannel := waitDeliveries(t, m, "ws1", 2)
+	if d := byChannel["flaky"]; d.Status != notify.DeliveryDelivered || d.Attempts != 3 || d.DeliveredAt == nil || d.LastError != "channel unavailable" {
+		t.Errorf("重试后应送达并保留上次错误: %+v", d)
+	}
+	if d := byChannel["down"]; d.Status != notify.DeliveryFailed || d.Attempts != 3 || d.LastError != "channel unavailable" {
+		t.Errorf("超过重试次数应标记为失败: %+v", d)
+	}
+
+	if others, _ := m.Deliveries(context.Background(), notify.DeliveryFilter{WorkspaceID: "ws2"}); len(others) != 0 {
+		t.Errorf("不应返回其他工作空间的投递记录: %+v", others)
+	}
+	failed, _ := m.Deliveries(context.Background(), notify.DeliveryFilter{Status: notify.DeliveryFailed})
+	if len(failed) != 1 || failed[0].ChannelType != notify.NotifyTypeDingTalk {
+		t.Errorf("按状态查询不正确: %+v", failed)
+	}
+}
+
+// TestNotifyEnqueueNotBlocked 渠道响应很慢时任务结束通知也立即返回
+func TestNotifyEnqueueNotBlocked(t *testing.T) {
+	printSeparator("通知入队不阻塞测试")
+
+	m := notify.NewNotifyManager()
+	m.SetRetryPolicy(fastRetryPolicy())
+	slow := &flakyNotifier{notifyType: notify.NotifyTypeWebhook, delay: 300 * time.Millisecond}
+	m.AddNotifier("slow", slow)
+	m.Start()
+	defer m.Stop()
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		m.NotifyTaskComplete("ws1", "扫描任务", "task1", i%2 == 0, "summary", nil)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("入队不应等待渠道发送, 耗时 %s", elapsed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		delivered, _ := m.Deliveries(context.Background(), notify.DeliveryFilter{Status: notify.DeliveryDelivered})
+		if len(delivered) == 20 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("应全部送达, 实际 %d", len(delivered))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestNotifyRedriveAfterRestart 退出时未完成的投递在新的管理器启动后继续发送
+func TestNotifyRedriveAfterRestart(t *testing.T) {
+	printSeparator("通知重启后重新投递测试")
+
+	store := notify.NewMemoryDeliveryStore()
+
+	// 第一个进程入队后退出，渠道一直不可用
+	first := notify.NewNotifyManager()
+	first.SetDeliveryStore(store)
+	first.AddNotifier("im", &flakyNotifier{notifyType: notify.NotifyTypeFeishu, failures: -1})
+	first.NotifyTaskOverrun("ws1", "扫描任务", "task1", time.Minute, 2*time.Minute, "crawler")
+
+	// 重启后渠道恢复
+	second := notify.NewNotifyManager()
+	second.SetRetryPolicy(fastRetryPolicy())
+	second.SetDeliveryStore(store)
+	im := &flakyNotifier{notifyType: notify.NotifyTypeFeishu}
+	second.AddNotifier("im", im)
+	second.Start()
+	defer second.Stop()
+
+	byChannel := waitDeliveries(t, second, "ws1", 1)
+	if d := byChannel["im"]; d.Status != notify.DeliveryDelivered || d.Attempts != 1 {
+		t.Errorf("重启后应重新投递: %+v", d)
+	}
+	if im.calls != 1 {
+		t.Errorf("应只发送一次, 实际 %d", im.calls)
+	}
+}
@@ -0,0 +1,151 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/notify"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 漏洞即时通知测试 ==========
+
+// captureNotifier 记录收到的通知
+type captureNotifier struct {
+	mu       sync.Mutex
+	messages []*notify.NotifyMessage
+}
+
+func (n *captureNotifier) Send(ctx context.Context, msg *notify.NotifyMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func (n *captureNotifier) Type() notify.NotifyType {
+	return notify.NotifyTypeWebhook
+}
+
+func (n *captureNotifier) received() []*notify.NotifyMessage {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*notify.NotifyMessage(nil), n.messages...)
+}
+
+// memoryFindingRuleStore 内存规则存储
+type memoryFindingRuleStore struct {
+	rules map[string]*notify.FindingRule
+}
+
+func (s *memoryFindingRuleStore) GetFindingRule(ctx context.Context, workspaceID string) (*notify.FindingRule, error) {
+	return s.rules[workspaceID], nil
+}
+
+func (s *memoryFindingRuleStore) SaveFindingRule(ctx context.Context, rule *notify.FindingRule) error {
+	s.rules[rule.WorkspaceID] = rule
+	return nil
+}
+
+func vulnScanResult(vulnID, severity, target string) *models.ScanResult {
+	return &models.ScanResult{
+		Type: models.ResultTypeVuln,
+		Data: bson.M{
+			"vuln_id":  vulnID,
+			"name":     "Test " + vulnID,
+			"severity": severity,
+			"target":   target,
+			"evidence": strings.Repeat("响应", 400),
+		},
+	}
+}
+
+// TestFindingAlertBurstDeduped 同一漏洞连续发现 50 次只发送一条通知
+func TestFindingAlertBurstDeduped(t *testing.T) {
+	printSeparator("漏洞即时通知去重测试")
+
+	m := notify.NewNotifyManager()
+	m.SetRetryPolicy(fastRetryPolicy())
+	capture := &captureNotifier{}
+	m.AddNotifier("capture", capture)
+	m.Start()
+	defer m.Stop()
+
+	task := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: primitive.NewObjectID(), Name: "Full 扫描"}
+	store := &memoryFindingRuleStore{rules: map[string]*notify.FindingRule{}}
+	alerter := service.NewFindingAlerter(task, service.LoadFindingRule(store, task.WorkspaceID.Hex()), m)
+
+	for i := 0; i < 50; i++ {
+		alerter.Record(vulnScanResult("CVE-2024-0001", "critical", "http://a.example.com/"))
+	}
+	alerter.Record(vulnScanResult("CVE-2024-0002", "medium", "http://a.example.com/")) // 低于默认的 high
+	alerter.Record(&models.ScanResult{Type: models.ResultTypePort, Data: bson.M{"severity": "critical"}})
+
+	waitDeliveries(t, m, task.WorkspaceID.Hex(), 1)
+	time.Sleep(50 * time.Millisecond)
+	got := capture.received()
+	if len(got) != 1 {
+		t.Fatalf("应只发送一条通知, 实际 %d", len(got))
+	}
+	msg := got[0]
+	if msg.Level != notify.NotifyLevelCritical || msg.Extra["task_link"] != "/tasks/"+task.ID.Hex() ||
+		msg.Extra["target"] != "http://a.example.com/" || !strings.Contains(msg.Title, "Test CVE-2024-0001") {
+		t.Errorf("通知内容不符: %+v", msg)
+	}
+	if len([]rune(msg.Content)) > 700 || !strings.Contains(msg.Content, "...") {
+		t.Errorf("证据应截断为摘要: %d", len([]rune(msg.Content)))
+	}
+	if n := alerter.Throttle().Suppressed(); n != 49 {
+		t.Errorf("应记录 49 条被去重的通知, 实际 %d", n)
+	}
+}
+
+// TestFindingThrottleRateLimit 不同漏洞在时间窗口内超过上限后不再通知，窗口过后恢复
+func TestFindingThrottleRateLimit(t *testing.T) {
+	printSeparator("漏洞即时通知限流测试")
+
+	store := &memoryFindingRuleStore{rules: map[string]*notify.FindingRule{}}
+	rule := &notify.FindingRule{WorkspaceID: "ws", Enabled: true, MinSeverity: "medium", MaxAlerts: 3, WindowMinutes: 10, Dedupe: true}
+	if err := service.SaveFindingRule(store, rule); err != nil {
+		t.Fatalf("保存规则失败: %v", err)
+	}
+	if err := service.SaveFindingRule(store, &notify.FindingRule{WorkspaceID: "ws", MinSeverity: "urgent", MaxAlerts: 1, WindowMinutes: 1}); err == nil {
+		t.Error("无效的严重程度应返回错误")
+	}
+
+	now := time.Now()
+	throttle := notify.NewFindingThrottle(service.LoadFindingRule(store, "ws"))
+	throttle.SetClock(func() time.Time { return now })
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if throttle.Allow(notify.Finding{VulnID: fmt.Sprintf("v%d", i), Severity: "High", Target: "t"}) {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("时间窗口内最多通知 3 条, 实际 %d", allowed)
+	}
+	if throttle.Allow(notify.Finding{VulnID: "low", Severity: "low", Target: "t"}) {
+		t.Error("低于最低严重程度的漏洞不应通知")
+	}
+
+	now = now.Add(11 * time.Minute)
+	if !throttle.Allow(notify.Finding{VulnID: "v10", Severity: "medium", Target: "t"}) {
+		t.Error("时间窗口过后应恢复通知")
+	}
+	if throttle.Allow(notify.Finding{VulnID: "v0", Severity: "high", Target: "t"}) {
+		t.Error("已通知过的漏洞不应再次通知")
+	}
+	if def := service.LoadFindingRule(store, "other"); !def.Enabled || def.MinSeverity != "high" || def.MaxAlerts != notify.DefaultFindingMaxAlerts {
+		t.Errorf("未配置规则的工作空间应使用默认规则: %+v", def)
+	}
+}
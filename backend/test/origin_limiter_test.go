@@ -0,0 +1,335 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/service/pipeline"
+)
+
+// ========== 源站并发限制测试 ==========
+
+// peakServer 记录同时处理的请求数峰值，status 为响应状态码
+func peakServer(t *testing.T, status int, delay time.Duration) (*httptest.Server, *int32) {
+	t.Helper()
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		w.Write([]byte("<html><title>origin</title></html>"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &peak
+}
+
+// TestBatchFingerprintPerOrigin 同一源站的目标同时扫描数不超过 MaxPerOrigin
+func TestBatchFingerprintPerOrigin(t *testing.T) {
+	printSeparator("批量指纹识别源站并发测试")
+
+	server, peak := peakServer(t, 200, 50*time.Millisecond)
+	targets := make([]string, 30)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("%s/app%d", server.URL, i)
+	}
+
+	scanner := fingerprint.NewFingerprintScanner(20)
+	if scanner.MaxPerOrigin != core.DefaultOriginConcurrency {
+		t.Errorf("默认每个源站并发应为 %d: %d", core.DefaultOriginConcurrency, scanner.MaxPerOrigin)
+	}
+	scanner.MaxPerOrigin = 3
+	results := scanner.BatchScanFingerprint(context.Background(), targets)
+	for i, r := range results {
+		if r == nil || r.Skipped || r.StatusCode != 200 {
+			t.Fatalf("目标 %d 应扫描成功: %+v", i, r)
+		}
+	}
+	if got := atomic.LoadInt32(peak); got != 3 {
+		t.Errorf("同一源站同时处理的请求数应为 3, 实际 %d", got)
+	}
+
+	// 关闭限制时按全局并发
+	server2, peak2 := peakServer(t, 200, 50*time.Millisecond)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("%s/app%d", server2.URL, i)
+	}
+	scanner.MaxPerOrigin = 0
+	scanner.BatchScanFingerprint(context.Background(), targets)
+	if got := atomic.LoadInt32(peak2); got <= 3 {
+		t.Errorf("关闭源站限制后并发应高于 3, 实际 %d", got)
+	}
+}
+
+// TestBatchFingerprintOriginBackoff 源站持续返回 429 时并发逐次减半
+func TestBatchFingerprintOriginBackoff(t *testing.T) {
+	printSeparator("源站限速退避测试")
+
+	server, _ := peakServer(t, http.StatusTooManyRequests, 10*time.Millisecond)
+	targets := make([]string, 40)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("%s/p%d", server.URL, i)
+	}
+
+	var mu sync.Mutex
+	var backoffs []string
+	scanner := fingerprint.NewFingerprintScanner(20)
+	scanner.MaxPerOrigin = 4
+	scanner.OriginBackoff = func(origin string, from, to int) {
+		mu.Lock()
+		defer mu.Unlock()
+		backoffs = append(backoffs, fmt.Sprintf("%s:%d->%d", origin, from, to))
+	}
+	scanner.BatchScanFingerprint(context.Background(), targets)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(backoffs) != 2 || backoffs[0] != "127.0.0.1:4->2" || backoffs[1] != "127.0.0.1:2->1" {
+		t.Errorf("应两次减半至 1: %v", backoffs)
+	}
+}
+
+// TestOriginLimiter 源站按解析 IP 分组，限速（429、连接重置）达到阈值后减半，上限下调后等待中的请求按新上限放行
+func TestOriginLimiter(t *testing.T) {
+	printSeparator("源站限制器测试")
+
+	limiter := core.NewOriginLimiter(2)
+	limiter.Resolve = func(ctx context.Context, host string) ([]string, error) {
+		if host == "down.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+	for target, want := range map[string]string{
+		"https://a.example.com/login": "10.0.0.1",
+		"b.example.com:8443":          "10.0.0.1",
+		"down.example.com":            "down.example.com",
+		"http://192.168.1.1:8080/":    "192.168.1.1",
+		"http://[::1]:8080/":          "::1",
+	} {
+		if got := limiter.Origin(context.Background(), target); got != want {
+			t.Errorf("%s 的源站应为 %s, 实际 %s", target, want, got)
+		}
+	}
+
+	var backoffs int
+	limiter.SetBackoff(2, func(origin string, from, to int) { backoffs++ })
+	r1, _ := limiter.Acquire(context.Background(), "10.0.0.1")
+	r2, _ := limiter.Acquire(context.Background(), "10.0.0.1")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, ok := limiter.Acquire(ctx, "10.0.0.1"); ok {
+		t.Fatalf("名额用完时应等待")
+	}
+
+	if limiter.Observe("10.0.0.1", 200, "") || limiter.Observe("10.0.0.1", 429, "") {
+		t.Errorf("未达到阈值不应减半")
+	}
+	if !limiter.Observe("10.0.0.1", 0, "read tcp 10.0.0.1:443: read: connection reset by peer") || limiter.Limit("10.0.0.1") != 1 || backoffs != 1 {
+		t.Errorf("连接重置计入限速次数，达到阈值后减半: %d", limiter.Limit("10.0.0.1"))
+	}
+	if limiter.Limit("10.0.0.9") != 2 {
+		t.Errorf("其他源站不受影响")
+	}
+
+	// 两个名额释放一个后仍在上限（1）上，全部释放后才能再占用
+	acquired := make(chan struct{})
+	go func() {
+		release, _ := limiter.Acquire(context.Background(), "10.0.0.1")
+		close(acquired)
+		release()
+	}()
+	r1()
+	select {
+	case <-acquired:
+		t.Fatalf("上限减半后不应放行")
+	case <-time.After(30 * time.Millisecond):
+	}
+	r2()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("名额释放后应放行")
+	}
+
+	// 最低为 1
+	for i := 0; i < 4; i++ {
+		limiter.Observe("10.0.0.1", 429, "")
+	}
+	if limiter.Limit("10.0.0.1") != 1 || backoffs != 1 {
+		t.Errorf("并发上限最低为 1: %d", limiter.Limit("10.0.0.1"))
+	}
+}
+
+// TestIPSchedulerBackoff 流水线 IP 调度：限速后该 IP 并发减半，批量轮次和 spray 线程数随之减少
+func TestIPSchedulerBackoff(t *testing.T) {
+	printSeparator("IP 调度限速退避测试")
+
+	scheduler := pipeline.NewIPScheduler(4, 0)
+	var events []string
+	scheduler.SetBackoffHandler(func(key string, from, to int) {
+		events = append(events, fmt.Sprintf("%s:%d->%d", key, from, to))
+	})
+
+	var works []pipeline.IPWork
+	for i := 0; i < 8; i++ {
+		works = append(works, pipeline.IPWork{Host: fmt.Sprintf("h%d.example.com", i), IP: "9.9.9.9", URL: fmt.Sprintf("https://h%d.example.com", i)})
+	}
+	solo := pipeline.IPWork{Host: "solo.example.com", IP: "8.8.8.8", URL: "https://solo.example.com"}
+
+	rounds := scheduler.Rounds(works)
+	if len(rounds) != 2 {
+		t.Fatalf("8 个同 IP 的 URL 按上限 4 应分 2 轮, 实际 %d", len(rounds))
+	}
+	// 4 个目标共用 IP，平分 40 个线程
+	if got := scheduler.SplitThreads(rounds[0], 40); got != 10 {
+		t.Errorf("每个目标应分到 10 个线程, 实际 %d", got)
+	}
+	if got := scheduler.SplitThreads([]pipeline.IPWork{solo}, 40); got != 40 {
+		t.Errorf("独占 IP 的目标使用全部线程, 实际 %d", got)
+	}
+
+	// 不带 IP 的结果计入主机记录的第一个 IP
+	scheduler.RecordHost("h0.example.com", []string{"9.9.9.9"})
+	for i := 0; i < core.DefaultOriginBackoffThreshold; i++ {
+		scheduler.Observe("h0.example.com", "", 429, "")
+		scheduler.Observe("solo.example.com", "8.8.8.8", 200, "")
+	}
+	if len(events) != 1 || events[0] != "9.9.9.9:4->2" {
+		t.Fatalf("应记录一次退避: %v", events)
+	}
+	for _, load := range scheduler.Loads() {
+		if load.IP == "9.9.9.9" && load.Limit != 2 {
+			t.Errorf("负载统计应为减半后的上限: %+v", load)
+		}
+	}
+
+	rounds = scheduler.Rounds(works)
+	if len(rounds) != 4 || len(rounds[0]) != 2 {
+		t.Errorf("减半后每轮同 IP 最多 2 个: %v", rounds)
+	}
+	if got := scheduler.SplitThreads(rounds[0], 40); got != 10 {
+		t.Errorf("上限减半后 2 个目标各分到 40*2/4/2=10 个线程, 实际 %d", got)
+	}
+	if got := scheduler.SplitThreads(append(rounds[0], solo), 40); got != 10 {
+		t.Errorf("一轮按最受限的 IP 计算线程数, 实际 %d", got)
+	}
+
+	// 减半后同时执行数不超过新上限
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, ok := scheduler.Acquire(context.Background(), fmt.Sprintf("h%d.example.com", i), "9.9.9.9")
+			if !ok {
+				return
+			}
+			defer release()
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}(i)
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Errorf("同时执行数应为 2, 实际 %d", peak)
+	}
+}
+
+// TestIPSchedulerBackoffBetweenRounds 第一轮执行期间 IP 并发减半，后续轮次按新上限拆分，不会等待不存在的名额
+func TestIPSchedulerBackoffBetweenRounds(t *testing.T) {
+	printSeparator("IP 调度轮次间退避测试")
+
+	scheduler := pipeline.NewIPScheduler(4, 0)
+	var works []pipeline.IPWork
+	for i := 0; i < 8; i++ {
+		works = append(works, pipeline.IPWork{Host: fmt.Sprintf("h%d.example.com", i), IP: "9.9.9.9", URL: fmt.Sprintf("https://h%d.example.com", i)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var sizes []int
+	ok := scheduler.EachRound(ctx, works, func(round []pipeline.IPWork) bool {
+		sizes = append(sizes, len(round))
+		if len(sizes) == 1 {
+			for i := 0; i < core.DefaultOriginBackoffThreshold; i++ {
+				scheduler.Observe(round[0].Host, round[0].IP, 429, "")
+			}
+		}
+		return true
+	})
+	if !ok {
+		t.Fatalf("上限减半后后续轮次不应一直等待")
+	}
+	if fmt.Sprint(sizes) != "[4 2 2]" {
+		t.Errorf("减半后每轮最多 2 个: %v", sizes)
+	}
+
+	// 减半前拆分的轮次按当前上限占用名额
+	rounds := pipeline.NewIPScheduler(4, 0).Rounds(works)
+	release, ok := scheduler.AcquireRound(ctx, rounds[0])
+	if !ok {
+		t.Fatalf("超过当前上限的轮次应按上限占用")
+	}
+	release()
+}
+
+// TestIPSchedulerConcurrentRounds 两个模块同时按轮占用相同的几个 IP，不会各占一部分后互相等待
+func TestIPSchedulerConcurrentRounds(t *testing.T) {
+	printSeparator("IP 调度并发轮次测试")
+
+	scheduler := pipeline.NewIPScheduler(2, 0)
+	var works []pipeline.IPWork
+	for i := 0; i < 6; i++ {
+		works = append(works, pipeline.IPWork{Host: fmt.Sprintf("h%d.example.com", i), IP: fmt.Sprintf("10.0.0.%d", i%3), URL: fmt.Sprintf("https://h%d.example.com", i)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !scheduler.EachRound(ctx, works, func(round []pipeline.IPWork) bool {
+				time.Sleep(time.Millisecond)
+				return true
+			}) {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if failed > 0 {
+		t.Fatalf("%d 个批量调用互相等待直到超时", failed)
+	}
+	for _, load := range scheduler.Loads() {
+		if load.Peak > 2 || load.InFlight != 0 {
+			t.Errorf("IP 并发应不超过上限且全部释放: %+v", load)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 页面编码与标题提取测试 ==========
+
+// gbkPage GBK 编码的页面，charset 只在 meta 标签中声明
+func gbkPage(t *testing.T, meta string) []byte {
+	t.Helper()
+	page := "<html><head>" + meta + "<title>统一身份认证管理系统</title></head><body>欢迎登录后台管理系统</body></html>"
+	encoded, err := simplifiedchinese.GBK.NewEncoder().String(page)
+	if err != nil {
+		t.Fatalf("GBK 编码失败: %v", err)
+	}
+	return []byte(encoded)
+}
+
+// TestDecodeBodyCharset 按 Content-Type、meta charset、meta http-equiv 识别编码并转为 UTF-8
+func TestDecodeBodyCharset(t *testing.T) {
+	printSeparator("页面编码识别测试")
+
+	cases := []struct {
+		name        string
+		body        []byte
+		contentType string
+	}{
+		{"Content-Type", gbkPage(t, ""), "text/html; charset=GBK"},
+		{"meta charset", gbkPage(t, `<meta charset="gb2312">`), "text/html"},
+		{"meta http-equiv", gbkPage(t, `<meta http-equiv="Content-Type" content="text/html; charset=gbk">`), ""},
+		{"错误声明 UTF-8 的响应头", gbkPage(t, `<meta charset="gbk">`), "text/html; charset=utf-8"},
+	}
+	for _, c := range cases {
+		decoded := fingerprint.DecodeBody(c.body, c.contentType)
+		if title := fingerprint.ExtractPageTitle(decoded); title != "统一身份认证管理系统" {
+			t.Errorf("%s: 标题解码错误: %q", c.name, title)
+		}
+	}
+
+	// 未声明编码的 UTF-8 页面原样返回
+	page := "<title>中文标题</title>"
+	if decoded := fingerprint.DecodeBody([]byte(page), ""); decoded != page {
+		t.Errorf("UTF-8 页面不应转换: %q", decoded)
+	}
+}
+
+// TestExtractPageTitleEntities 标题中的 HTML 实体被还原
+func TestExtractPageTitleEntities(t *testing.T) {
+	printSeparator("标题实体还原测试")
+
+	html := "<title>\n  R&amp;D &#x4e2d;&#25991; &lt;Admin&gt; &quot;Portal&quot; &copy; 2024&nbsp;</title>"
+	if title := fingerprint.ExtractPageTitle(html); title != "R&D 中文 <Admin> \"Portal\" © 2024" {
+		t.Errorf("实体未还原: %q", title)
+	}
+}
+
+// TestExtractPageTitleRuneTruncation 超长标题按字符截断，截断处的 emoji 不会被拆开
+func TestExtractPageTitleRuneTruncation(t *testing.T) {
+	printSeparator("标题按字符截断测试")
+
+	long := strings.Repeat("a", 198) + "😀😀😀"
+	title := fingerprint.ExtractPageTitle("<title>" + long + "</title>")
+	if !utf8.ValidString(title) {
+		t.Fatalf("截断后不是有效的 UTF-8: %q", title)
+	}
+	if want := strings.Repeat("a", 198) + "😀😀..."; title != want {
+		t.Errorf("应截断到 200 个字符: %q", title)
+	}
+
+	exact := strings.Repeat("中", 199) + "😀"
+	if title := fingerprint.ExtractPageTitle("<title>" + exact + "</title>"); title != exact {
+		t.Errorf("正好 200 个字符不应截断: %q", title)
+	}
+}
+
+// TestFingerprintScannerGBKPage 扫描 GBK 页面时标题为 UTF-8，中文 contains 规则能匹配
+func TestFingerprintScannerGBKPage(t *testing.T) {
+	printSeparator("GBK 页面指纹识别测试")
+
+	body := gbkPage(t, `<meta http-equiv="Content-Type" content="text/html; charset=gb2312">`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.DSLEngine = fingerprint.NewDSLEngine()
+	rules := "中文后台:\n  dsl:\n    - \"contains(body, '后台管理系统')\"\n"
+	if err := scanner.DSLEngine.LoadRulesFromFile(writeRulesFile(t, t.TempDir(), "finger.yaml", rules)); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+	if result.Title != "统一身份认证管理系统" {
+		t.Errorf("标题应解码为 UTF-8: %q", result.Title)
+	}
+	if result.BodyLength != len(body) {
+		t.Errorf("响应长度应为原始字节数: %d", result.BodyLength)
+	}
+	found := false
+	for _, fp := range result.Fingerprints {
+		found = found || fp.Name == "中文后台"
+	}
+	if !found {
+		t.Errorf("中文 contains 规则应匹配 GBK 页面: %+v", result.Fingerprints)
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/service/pipeline"
+)
+
+// ========== 流水线故障注入 / 看门狗测试 ==========
+// 仅启用指纹识别模块，字符串目标会直接透传到结果收集模块，不依赖外部工具
+
+// runFaultPipeline 运行带故障注入的流水线，返回结果数量和流水线错误
+func runFaultPipeline(t *testing.T, targets []string, faults *pipeline.FaultConfig) (int, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:     true,
+		WatchdogTimeout: 200 * time.Millisecond,
+		Faults:          faults,
+	}
+
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, config)
+	if err := pipe.Start(targets); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	count := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range pipe.Results() {
+			count++
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("流水线未结束，看门狗未生效")
+	}
+
+	return count, pipe.Err()
+}
+
+// TestPipelineFaultNone 无故障时流水线正常完成
+func TestPipelineFaultNone(t *testing.T) {
+	printSeparator("流水线无故障测试")
+
+	targets := []string{"a.example.com", "b.example.com", "c.example.com"}
+	count, err := runFaultPipeline(t, targets, nil)
+	if err != nil {
+		t.Fatalf("期望正常完成, 实际错误: %v", err)
+	}
+	if count != len(targets) {
+		t.Errorf("期望 %d 条结果, 实际 %d", len(targets), count)
+	}
+	fmt.Printf("结果数量: %d\n", count)
+}
+
+// TestPipelineFaultMissingCloseInput 模块遗漏 CloseInput 时看门狗终止流水线
+func TestPipelineFaultMissingCloseInput(t *testing.T) {
+	printSeparator("遗漏 CloseInput 测试")
+
+	faults := &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{
+		{Module: "Fingerprint", DropCloseInput: true},
+	}}
+	_, err := runFaultPipeline(t, []string{"a.example.com"}, faults)
+	if err == nil {
+		t.Fatalf("期望看门狗返回错误")
+	}
+	if !strings.Contains(err.Error(), "Fingerprint") {
+		t.Errorf("诊断信息应包含模块状态: %v", err)
+	}
+	fmt.Printf("看门狗诊断: %v\n", err)
+}
+
+// TestPipelineFaultPanic 模块处理数据时 panic，看门狗终止流水线
+func TestPipelineFaultPanic(t *testing.T) {
+	printSeparator("模块 panic 测试")
+
+	faults := &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{
+		{Module: "ResultCollector", PanicAfter: 1},
+	}}
+	_, err := runFaultPipeline(t, []string{"a.example.com", "b.example.com", "c.example.com"}, faults)
+	if err == nil {
+		t.Fatalf("期望看门狗返回错误")
+	}
+	if !strings.Contains(err.Error(), "panic") {
+		t.Errorf("诊断信息应包含 panic: %v", err)
+	}
+	fmt.Printf("看门狗诊断: %v\n", err)
+}
+
+// TestPipelineFaultErrorOnStart 模块启动失败时看门狗终止流水线
+func TestPipelineFaultErrorOnStart(t *testing.T) {
+	printSeparator("模块启动失败测试")
+
+	faults := &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{
+		{Module: "ResultCollector", ErrorOnStart: true},
+	}}
+	_, err := runFaultPipeline(t, []string{"a.example.com"}, faults)
+	if err == nil {
+		t.Fatalf("期望看门狗返回错误")
+	}
+	fmt.Printf("看门狗诊断: %v\n", err)
+}
+
+// TestPipelineFaultStall 短暂停顿未超过看门狗超时，流水线正常完成
+func TestPipelineFaultStall(t *testing.T) {
+	printSeparator("模块短暂停顿测试")
+
+	faults := &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{
+		{Module: "Fingerprint", Stall: 50 * time.Millisecond},
+	}}
+	count, err := runFaultPipeline(t, []string{"a.example.com", "b.example.com"}, faults)
+	if err != nil {
+		t.Fatalf("期望正常完成, 实际错误: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("期望 2 条结果, 实际 %d", count)
+	}
+}
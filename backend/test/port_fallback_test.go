@@ -0,0 +1,169 @@
+package test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"moongazing/scanner/portscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== 内置 TCP 连接扫描测试 ==========
+// 本地监听端口模拟开放的服务，监听后立即关闭的端口模拟关闭的端口
+
+// listenBanner 在 127.0.0.1 上监听，连接后发送 banner，返回端口
+func listenBanner(t *testing.T, banner string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if banner != "" {
+				conn.Write([]byte(banner))
+			}
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort 取得一个未监听的端口
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// TestTCPConnectOpenClosed 开放端口被发现并按 banner 推断服务，关闭的端口不出现在结果中
+func TestTCPConnectOpenClosed(t *testing.T) {
+	printSeparator("内置 TCP 连接扫描开放/关闭端口测试")
+
+	sshPort := listenBanner(t, "SSH-2.0-OpenSSH_8.9\r\n")
+	silentPort := listenBanner(t, "")
+	closed := closedPort(t)
+
+	scanner := portscan.NewTCPConnectScanner(10, time.Second)
+	scanner.BannerTimeout = 200 * time.Millisecond
+	ports := strconv.Itoa(sshPort) + "," + strconv.Itoa(silentPort) + "," + strconv.Itoa(closed)
+	result, err := scanner.ScanPorts(context.Background(), "127.0.0.1", ports)
+	if err != nil {
+		t.Fatalf("ScanPorts: %v", err)
+	}
+
+	found := make(map[int]string)
+	for _, p := range result.Ports {
+		if p.State != "open" || p.Protocol != "tcp" {
+			t.Errorf("端口状态应为 open/tcp: %+v", p)
+		}
+		found[p.Port] = p.Service
+		if p.Port == sshPort && p.Banner != "SSH-2.0-OpenSSH_8.9" {
+			t.Errorf("banner 应为第一行: %q", p.Banner)
+		}
+	}
+	if found[sshPort] != "ssh" {
+		t.Errorf("SSH banner 应识别为 ssh: %+v", result.Ports)
+	}
+	if _, ok := found[silentPort]; !ok {
+		t.Errorf("不发送 banner 的开放端口也应被发现: %+v", result.Ports)
+	}
+	if _, ok := found[closed]; ok {
+		t.Errorf("关闭的端口不应出现在结果中: %+v", result.Ports)
+	}
+	if !scanner.IsAvailable() {
+		t.Error("内置扫描器应总是可用")
+	}
+}
+
+// TestTCPConnectCancel 取消 ctx 后扫描及时返回，不等待剩余端口
+func TestTCPConnectCancel(t *testing.T) {
+	printSeparator("内置 TCP 连接扫描取消测试")
+
+	scanner := portscan.NewTCPConnectScanner(50, time.Minute)
+	scanner.Dialer = func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	result, err := scanner.FullScan(ctx, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("FullScan: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("取消后应及时返回，实际耗时 %v", elapsed)
+	}
+	if len(result.Ports) != 0 {
+		t.Errorf("连接均未成功时不应有开放端口: %+v", result.Ports)
+	}
+}
+
+// TestPortModuleFallback gogo 不存在时端口扫描模块改用内置扫描，并记录降级事件
+func TestPortModuleFallback(t *testing.T) {
+	printSeparator("gogo 缺失时端口扫描降级测试")
+
+	port := listenBanner(t, "220 mail.example.com ESMTP Postfix\r\n")
+	gogo := portscan.NewGoGoScannerWithPath("/nonexistent/gogo")
+	if gogo.IsAvailable() {
+		t.Fatal("不存在的 gogo 路径应不可用")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewPortScanModule(ctx, collector, strconv.Itoa(port), "custom")
+	module.SetGoGoScanner(gogo)
+
+	var events []pipeline.Event
+	recorder := pipeline.NewEventRecorder()
+	recorder.SetHandler(func(e pipeline.Event) { events = append(events, e) })
+	module.SetEventRecorder(recorder)
+
+	in := make(chan interface{}, 1)
+	in <- "127.0.0.1"
+	close(in)
+	module.SetInput(in)
+	module.ModuleRun()
+
+	var alive []pipeline.PortAlive
+	for len(out) > 0 {
+		if p, ok := (<-out).(pipeline.PortAlive); ok {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) != 1 || alive[0].Port != strconv.Itoa(port) || alive[0].Service != "smtp" {
+		t.Errorf("内置扫描应发现监听的端口并识别为 smtp: %+v", alive)
+	}
+
+	degraded := false
+	for _, e := range events {
+		switch e.Type {
+		case pipeline.EventDegraded:
+			degraded = e.Level == pipeline.EventLevelWarn && e.Data["tool"] == "gogo"
+		case pipeline.EventToolUnavailable:
+			t.Errorf("降级运行时不应记录工具不可用: %+v", e)
+		}
+	}
+	if !degraded {
+		t.Errorf("应记录 gogo 降级事件: %+v", events)
+	}
+}
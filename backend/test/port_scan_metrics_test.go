@@ -0,0 +1,189 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/portscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ========== 端口协议、TLS 和连接耗时测试 ==========
+
+// writeFakeGoGo 写入模拟 gogo：忽略参数，输出日志行和给定的 JSON 行
+func writeFakeGoGo(t *testing.T, lines ...string) *portscan.GoGoScanner {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gogo")
+	script := "#!/bin/sh\necho '[*] fake gogo'\n"
+	for _, line := range lines {
+		script += "echo '" + line + "'\n"
+	}
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake gogo: %v", err)
+	}
+	return portscan.NewGoGoScannerWithPath(path)
+}
+
+// TestConvertGoGoTLS GoGo 的 protocol 或 frameworks 为 TLS 时标记 TLS，udp 协议记为 UDP 端口
+func TestConvertGoGoTLS(t *testing.T) {
+	printSeparator("GoGo TLS 识别测试")
+
+	cases := []struct {
+		result   portscan.GoGoResult
+		tls      bool
+		protocol string
+	}{
+		{portscan.GoGoResult{Port: "443", Protocol: "https", Status: "200"}, true, "tcp"},
+		{portscan.GoGoResult{Port: "8443", Protocol: "tcp", Status: "open", Frameworks: map[string]interface{}{"tls": map[string]interface{}{"name": "tls"}}}, true, "tcp"},
+		{portscan.GoGoResult{Port: "80", Protocol: "http", Status: "200", Frameworks: map[string]interface{}{"nginx": map[string]interface{}{"version": "1.25.3"}}}, false, "tcp"},
+		{portscan.GoGoResult{Port: "53", Protocol: "udp", Status: "open"}, false, "udp"},
+	}
+	for _, c := range cases {
+		port := portscan.ConvertGoGoResult(&c.result)
+		if port == nil || port.TLS != c.tls || port.Protocol != c.protocol {
+			t.Errorf("%s/%s: 期望 tls=%v protocol=%s, 实际 %+v", c.result.Port, c.result.Protocol, c.tls, c.protocol, port)
+		}
+	}
+}
+
+// TestPortScanTLSMetrics gogo 标记为 https 的端口记录连接耗时和证书，字段写入保存的端口结果
+func TestPortScanTLSMetrics(t *testing.T) {
+	printSeparator("端口 TLS 证书和连接耗时测试")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewPortScanModule(ctx, collector, port, "custom")
+	module.SetGoGoScanner(writeFakeGoGo(t,
+		`{"ip":"127.0.0.1","port":"`+port+`","protocol":"https","status":"200","title":"","frameworks":{"nginx":{"name":"nginx"}}}`))
+	input := make(chan interface{}, 1)
+	input <- "127.0.0.1"
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	var alive []pipeline.PortAlive
+	for len(out) > 0 {
+		if p, ok := (<-out).(pipeline.PortAlive); ok {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) != 1 {
+		t.Fatalf("应输出 1 个开放端口, 实际 %+v", alive)
+	}
+	p := alive[0]
+	if !p.TLS || p.Protocol != "tcp" || p.Certificate == nil {
+		t.Fatalf("https 端口应标记 TLS 并获取证书: %+v", p)
+	}
+
+	data := service.PortResultData(p)
+	if data["tls"] != true || data["protocol"] != "tcp" || data["port"] != port {
+		t.Errorf("保存的端口结果应包含协议和 TLS: %+v", data)
+	}
+	if p.ResponseTimeMs <= 0 || data["response_time_ms"] != p.ResponseTimeMs {
+		t.Errorf("连接耗时应写入保存的端口结果: %d %v", p.ResponseTimeMs, data["response_time_ms"])
+	}
+	cert, ok := data["certificate"].(bson.M)
+	if !ok {
+		t.Fatal("TLS 端口应保存证书")
+	}
+	if cert["subject"] == "" || cert["not_after"] == nil {
+		t.Errorf("证书应包含主题和有效期: %+v", cert)
+	}
+}
+
+// listenSlowTLS 启动 TLS 监听，每个连接等待 delay 后才握手
+func listenSlowTLS(t *testing.T, config *tls.Config, delay time.Duration) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				time.Sleep(delay)
+				tls.Server(conn, config).Handshake()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+// TestPortScanConcurrentProbe 开放端口的补充探测并发进行，结果按 gogo 输出顺序发送
+func TestPortScanConcurrentProbe(t *testing.T) {
+	printSeparator("端口补充探测并发测试")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var ports, lines []string
+	for i := 0; i < 6; i++ {
+		port := listenSlowTLS(t, server.TLS, 500*time.Millisecond)
+		ports = append(ports, port)
+		lines = append(lines, `{"ip":"127.0.0.1","port":"`+port+`","protocol":"https","status":"200"}`)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out := make(chan interface{}, 20)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 20))
+	module := pipeline.NewPortScanModule(ctx, collector, strings.Join(ports, ","), "custom")
+	module.SetGoGoScanner(writeFakeGoGo(t, lines...))
+	module.SetIPScheduler(pipeline.NewIPScheduler(10, 0))
+	input := make(chan interface{}, 1)
+	input <- "127.0.0.1"
+	close(input)
+	module.SetInput(input)
+
+	start := time.Now()
+	module.ModuleRun()
+	// 串行探测 6 个端口至少需要 3s
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("开放端口应并发探测, 耗时 %v", elapsed)
+	}
+
+	var alive []pipeline.PortAlive
+	for len(out) > 0 {
+		if p, ok := (<-out).(pipeline.PortAlive); ok {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) != len(ports) {
+		t.Fatalf("应输出 %d 个开放端口, 实际 %+v", len(ports), alive)
+	}
+	for i, p := range alive {
+		if p.Port != ports[i] {
+			t.Errorf("第 %d 个端口应为 %s, 实际 %s", i, ports[i], p.Port)
+		}
+		if p.ResponseTimeMs <= 0 || p.Certificate == nil {
+			t.Errorf("端口 %s 应记录连接耗时和证书: %+v", p.Port, p)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"moongazing/config"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/portscan"
+)
+
+// ========== 端口服务映射统一测试 ==========
+
+// bannerListener 本地监听，连接后写入 banner（为空则直接关闭）
+func bannerListener(t *testing.T, banner string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if banner != "" {
+				conn.Write([]byte(banner))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// newLocalPortScanner 端口指纹扫描器，所有连接都转发到本地监听
+func newLocalPortScanner(addr string) *fingerprint.FingerprintScanner {
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.PortDialer = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return scanner
+}
+
+// TestPortServiceLabelsConsistent 端口指纹和 gogo 结果转换对同一端口给出相同的服务名称
+func TestPortServiceLabelsConsistent(t *testing.T) {
+	printSeparator("端口服务名称一致性测试")
+
+	silent := newLocalPortScanner(bannerListener(t, ""))
+	for _, port := range []int{21, 22, 25, 53, 80, 443, 3306, 3389, 6379, 8080, 8443, 9443, 27017, 45678} {
+		want, ok := config.LookupPortService(port)
+		if !ok {
+			want = "unknown"
+		}
+
+		fp := silent.ScanPortFingerprint(context.Background(), "scan.example.test", port)
+		gogo := portscan.ConvertGoGoResult(&portscan.GoGoResult{IP: "192.0.2.1", Port: strconv.Itoa(port), Protocol: "tcp", Status: "open"})
+		if gogo == nil {
+			t.Fatalf("端口 %d 转换结果为空", port)
+		}
+		if fp.Service != gogo.Service || fp.Service != want {
+			t.Errorf("端口 %d 服务名称不一致: fingerprint=%s gogo=%s map=%s", port, fp.Service, gogo.Service, want)
+		}
+	}
+
+	// banner 识别的服务与 gogo 识别的协议一致时，两条路径结果相同
+	ssh := newLocalPortScanner(bannerListener(t, "SSH-2.0-OpenSSH_8.9p1 Ubuntu\r\n"))
+	fp := ssh.ScanPortFingerprint(context.Background(), "scan.example.test", 2222)
+	gogo := portscan.ConvertGoGoResult(&portscan.GoGoResult{Port: "2222", Protocol: "ssh", Status: "open"})
+	if fp.Service != "ssh" || gogo.Service != "ssh" {
+		t.Errorf("非标准端口上的 SSH 应按 banner/协议识别: fingerprint=%s gogo=%s", fp.Service, gogo.Service)
+	}
+}
+
+// TestPortServicePrecedence banner > 扫描器协议 > 统一映射 > unknown
+func TestPortServicePrecedence(t *testing.T) {
+	printSeparator("端口服务名称优先级测试")
+
+	cases := []struct {
+		port     int
+		banner   string
+		protocol string
+		want     string
+	}{
+		{80, "ssh", "http", "ssh"},
+		{80, "", "redis", "redis"},
+		{80, "unknown", "TCP", "http"},
+		{6379, "", "", "redis"},
+		{45678, "", "tcp", "unknown"},
+	}
+	for _, c := range cases {
+		if got := config.ResolvePortService(c.port, c.banner, c.protocol); got != c.want {
+			t.Errorf("ResolvePortService(%d, %q, %q) = %s, want %s", c.port, c.banner, c.protocol, got, c.want)
+		}
+	}
+}
+
+// TestPortServiceConflicts 两种写法定义不一致的端口以单端口条目为准并记录冲突
+func TestPortServiceConflicts(t *testing.T) {
+	printSeparator("端口服务映射冲突检测测试")
+
+	path := filepath.Join(t.TempDir(), "ports.yaml")
+	content := `22:
+  service: ssh
+80:
+  service: http
+port_service_map:
+  22: openssh
+  80: http
+  8888: jupyter
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	ports := config.LoadPortsConfigFile(path)
+	if ports.PortServiceMap[22] != "ssh" || ports.PortServiceMap[80] != "http" || ports.PortServiceMap[8888] != "jupyter" {
+		t.Errorf("合并后的映射不正确: %v", ports.PortServiceMap)
+	}
+	if len(ports.Conflicts) != 1 || ports.Conflicts[0].Port != 22 || ports.Conflicts[0].Service != "ssh" || ports.Conflicts[0].LegacyService != "openssh" {
+		t.Errorf("冲突记录不正确: %+v", ports.Conflicts)
+	}
+
+	shipped := filepath.Join("..", "config", "dicts", "yaml", "ports.yaml")
+	if _, err := os.Stat(shipped); err == nil {
+		if conflicts := config.LoadPortsConfigFile(shipped).Conflicts; len(conflicts) != 0 {
+			t.Errorf("内置 ports.yaml 不应有冲突: %+v", conflicts)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ========== 爬虫请求 http-raw 导出测试 ==========
+
+// crawlerResults 一个带参数的 GET 请求、一个表单提交（从数据库读出时请求头为 bson.M）和一个子域名结果
+func crawlerResults() []*models.ScanResult {
+	return []*models.ScanResult{
+		{
+			Type: models.ResultTypeCrawler,
+			Data: bson.M{
+				"url":    "https://app.example.com/search?q=test&page=2",
+				"method": "GET",
+			},
+		},
+		{
+			Type: models.ResultTypeCrawler,
+			Data: bson.M{
+				"url":               "https://app.example.com:8443/account/update",
+				"method":            "POST",
+				"request_body":      "email=a%40example.com&notify=1",
+				"request_headers":   bson.M{"Content-Type": "application/x-www-form-urlencoded", "Host": "ignored"},
+				"is_state_changing": true,
+			},
+		},
+		{
+			Type: models.ResultTypeSubdomain,
+			Data: bson.M{"subdomain": "app.example.com"},
+		},
+	}
+}
+
+// TestRawHTTPRender GET 带参数和 POST 带请求体的结果渲染为可重放的原始请求
+func TestRawHTTPRender(t *testing.T) {
+	printSeparator("http-raw 渲染测试")
+
+	results := crawlerResults()
+
+	get, ok := service.RenderRawHTTPRequest(results[0])
+	if !ok {
+		t.Fatalf("GET 请求应能渲染")
+	}
+	want := "GET /search?q=test&page=2 HTTP/1.1\r\nHost: app.example.com\r\n\r\n"
+	if get.Raw != want || get.StateChanging {
+		t.Errorf("GET 请求渲染不正确: %q state_changing=%v", get.Raw, get.StateChanging)
+	}
+
+	post, ok := service.RenderRawHTTPRequest(results[1])
+	if !ok {
+		t.Fatalf("POST 请求应能渲染")
+	}
+	want = "POST /account/update HTTP/1.1\r\n" +
+		"Host: app.example.com:8443\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 30\r\n" +
+		"\r\n" +
+		"email=a%40example.com&notify=1"
+	if post.Raw != want || !post.StateChanging {
+		t.Errorf("POST 请求渲染不正确: %q state_changing=%v", post.Raw, post.StateChanging)
+	}
+
+	if _, ok := service.RenderRawHTTPRequest(results[2]); ok {
+		t.Errorf("子域名结果不应渲染为请求")
+	}
+
+	// 旧数据没有 is_state_changing 字段时按方法和参数判断
+	legacy := &models.ScanResult{Type: models.ResultTypeURL, Data: bson.M{"url": "https://app.example.com/user/logout"}}
+	if req, _ := service.RenderRawHTTPRequest(legacy); req == nil || !req.StateChanging {
+		t.Errorf("logout 请求应标记为改变状态")
+	}
+}
+
+// TestRawHTTPExportLayouts zip 每个请求一个文件，concat 以分隔行隔开，改变状态的请求有明显标记
+func TestRawHTTPExportLayouts(t *testing.T) {
+	printSeparator("http-raw 导出格式测试")
+
+	var buf bytes.Buffer
+	exporter := service.NewRawHTTPExporter(&buf, service.RawLayoutZip)
+	for _, r := range crawlerResults() {
+		if _, err := exporter.Write(r); err != nil {
+			t.Fatalf("写出失败: %v", err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if exporter.Count() != 2 {
+		t.Errorf("应导出 2 个请求, 实际 %d", exporter.Count())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("压缩包无效: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("压缩包应有 2 个文件, 实际 %d", len(zr.File))
+	}
+	if name := zr.File[0].Name; name != "0001_GET_app.example.com_search.http" {
+		t.Errorf("文件名不正确: %s", name)
+	}
+	if name := zr.File[1].Name; !strings.Contains(name, service.StateChangingMark) || !strings.Contains(name, "POST") {
+		t.Errorf("改变状态的请求应在文件名中标记: %s", name)
+	}
+	f, _ := zr.File[1].Open()
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if !strings.HasPrefix(string(content), "POST /account/update HTTP/1.1\r\n") {
+		t.Errorf("文件内容应为原始请求: %q", content)
+	}
+
+	buf.Reset()
+	exporter = service.NewRawHTTPExporter(&buf, service.RawLayoutConcat)
+	for _, r := range crawlerResults() {
+		exporter.Write(r)
+	}
+	exporter.Close()
+	text := buf.String()
+	if !strings.HasPrefix(text, "### 1 GET https://app.example.com/search?q=test&page=2\r\n") {
+		t.Errorf("分隔行不正确: %q", text)
+	}
+	if !strings.Contains(text, "### 2 ["+service.StateChangingMark+"] POST https://app.example.com:8443/account/update\r\n") {
+		t.Errorf("改变状态的请求应在分隔行中标记: %q", text)
+	}
+}
+
+// TestStateChangingExcludedFromReplay 改变状态的请求不被敏感信息检测重新请求
+func TestStateChangingExcludedFromReplay(t *testing.T) {
+	printSeparator("改变状态的请求不重放测试")
+
+	for _, c := range []struct {
+		method, url, body string
+		want              bool
+	}{
+		{"GET", "https://app.example.com/search?q=test", "", false},
+		{"", "https://app.example.com/static/app.js", "", false},
+		{"POST", "https://app.example.com/search", "", true},
+		{"GET", "https://app.example.com/logout.php", "", true},
+		{"GET", "https://app.example.com/admin?action=delete&id=3", "", true},
+		{"GET", "https://app.example.com/item?id=3", "id=3", true},
+		{"DELETE", "https://app.example.com/api/items/3", "", true},
+	} {
+		if got := webscan.IsStateChanging(c.method, c.url, c.body); got != c.want {
+			t.Errorf("%s %s: 应为 %v", c.method, c.url, c.want)
+		}
+	}
+
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte("<html>ok</html>"))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	module := pipeline.NewSensitiveModule(ctx, nil, 2)
+	input := make(chan interface{}, 2)
+	module.SetInput(input)
+	input <- pipeline.UrlResult{Output: server.URL + "/account/delete", Method: "POST", Source: "katana", StateChanging: true}
+	input <- pipeline.UrlResult{Output: server.URL + "/page", Method: "GET", Source: "katana"}
+	close(input)
+	module.ModuleRun()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/account/delete"] != 0 {
+		t.Errorf("改变状态的请求不应被重新请求")
+	}
+	if hits["/page"] == 0 {
+		t.Errorf("普通 URL 应被检测")
+	}
+}
@@ -0,0 +1,218 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/scanner/subdomain"
+	"moongazing/service/pipeline"
+)
+
+// ========== 共享解析器池测试 ==========
+// 使用计数的伪造解析函数统计每个主机实际查询的次数
+
+// countingResolver 记录每个主机的查询次数
+type countingResolver struct {
+	mu      sync.Mutex
+	records map[string][]string
+	ttl     time.Duration
+	counts  map[string]int
+}
+
+func newCountingResolver(records map[string][]string, ttl time.Duration) *countingResolver {
+	return &countingResolver{records: records, ttl: ttl, counts: make(map[string]int)}
+}
+
+func (r *countingResolver) lookup(ctx context.Context, host string) ([]string, time.Duration, error) {
+	r.mu.Lock()
+	r.counts[host]++
+	r.mu.Unlock()
+
+	// 模拟网络延迟，让并发请求重叠
+	time.Sleep(5 * time.Millisecond)
+	if ips, ok := r.records[host]; ok {
+		return ips, r.ttl, nil
+	}
+	if host == "timeout.example.test" {
+		return nil, 0, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+	}
+	return nil, r.ttl, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *countingResolver) count(host string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[host]
+}
+
+// TestResolverPoolCache 批量解析去重、缓存命中、NXDOMAIN 缓存、临时错误不缓存、TTL 过期和 LRU 淘汰
+func TestResolverPoolCache(t *testing.T) {
+	printSeparator("解析器池缓存测试")
+
+	records := map[string][]string{
+		"a.example.test": {"192.0.2.1"},
+		"b.example.test": {"192.0.2.2", "2001:db8::2"},
+	}
+	fake := newCountingResolver(records, time.Minute)
+	pool := subdomain.NewResolverPool(nil, 0)
+	pool.SetLookup(fake.lookup)
+
+	hosts := []string{"a.example.test", "b.example.test", "a.example.test", "nx.example.test", "b.example.test"}
+	resolved := pool.ResolveBatch(context.Background(), hosts, 10)
+	if len(resolved) != 2 || len(resolved["b.example.test"]) != 2 {
+		t.Errorf("批量解析结果不正确: %v", resolved)
+	}
+	if _, ok := resolved["nx.example.test"]; ok {
+		t.Errorf("无法解析的主机不应出现在结果中")
+	}
+
+	// 再次解析全部命中缓存（包括 NXDOMAIN），主机名大小写和末尾的点不影响命中
+	if ips, err := pool.Resolve(context.Background(), "A.Example.Test."); err != nil || len(ips) != 1 {
+		t.Errorf("缓存结果不正确: %v %v", ips, err)
+	}
+	if _, err := pool.Resolve(context.Background(), "nx.example.test"); err == nil {
+		t.Errorf("NXDOMAIN 应返回错误")
+	}
+	for _, host := range []string{"a.example.test", "b.example.test", "nx.example.test"} {
+		if n := fake.count(host); n != 1 {
+			t.Errorf("%s 应只查询一次, 实际 %d 次", host, n)
+		}
+	}
+
+	// 超时等临时错误不缓存
+	pool.Resolve(context.Background(), "timeout.example.test")
+	pool.Resolve(context.Background(), "timeout.example.test")
+	if n := fake.count("timeout.example.test"); n != 2 {
+		t.Errorf("临时错误不应缓存, 查询 %d 次", n)
+	}
+
+	stats := pool.Stats()
+	if stats.Requests != 7 || stats.Lookups != 5 || stats.Hits != 2 || stats.Entries != 3 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+	if stats.HitRate < 0.28 || stats.HitRate > 0.29 {
+		t.Errorf("命中率不正确: %.3f", stats.HitRate)
+	}
+
+	// TTL 过期后重新解析
+	short := newCountingResolver(records, 20*time.Millisecond)
+	expiring := subdomain.NewResolverPool(nil, 0)
+	expiring.SetLookup(short.lookup)
+	expiring.Resolve(context.Background(), "a.example.test")
+	expiring.Resolve(context.Background(), "a.example.test")
+	time.Sleep(40 * time.Millisecond)
+	expiring.Resolve(context.Background(), "a.example.test")
+	if n := short.count("a.example.test"); n != 2 {
+		t.Errorf("TTL 过期后应重新解析一次, 查询 %d 次", n)
+	}
+
+	// 超过容量时淘汰最久未使用的条目
+	small := subdomain.NewResolverPool(nil, 2)
+	small.SetLookup(fake.lookup)
+	small.Add("c.example.test", []string{"192.0.2.3"})
+	small.Add("d.example.test", []string{"192.0.2.4"})
+	small.Cached("c.example.test")
+	small.Add("e.example.test", []string{"192.0.2.5"})
+	if _, ok := small.Cached("d.example.test"); ok {
+		t.Errorf("最久未使用的条目应被淘汰")
+	}
+	if _, ok := small.Cached("c.example.test"); !ok {
+		t.Errorf("最近使用的条目应保留")
+	}
+}
+
+// TestResolverPoolPipelineOnce 子域名解析验证、域名验证和 CDN 检测共用解析器池，每个主机只解析一次
+func TestResolverPoolPipelineOnce(t *testing.T) {
+	printSeparator("流水线共享解析器池测试")
+
+	records := make(map[string][]string)
+	var hosts []string
+	for i := 0; i < 40; i++ {
+		host := fmt.Sprintf("h%d.example.test", i)
+		records[host] = []string{fmt.Sprintf("192.0.2.%d", i+1)}
+		hosts = append(hosts, host)
+	}
+	fake := newCountingResolver(records, time.Minute)
+	pool := subdomain.NewResolverPool(nil, 0)
+	pool.SetLookup(fake.lookup)
+
+	// 子域名阶段：被动来源的子域名（含重复）通过解析器池验证
+	scanner := subdomain.NewActiveScanner(&subdomain.ActiveScannerConfig{VerifySubdomains: true, ResolveConcurrency: 8}, nil)
+	scanner.SetResolver(pool.Resolve)
+	scanner.AddPassiveResults(context.Background(), append(append([]string{}, hosts...), hosts[:10]...), "hunter")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	forwarded := make(chan interface{}, 500)
+	collector := pipeline.NewResultCollectorModule(ctx, forwarded)
+	collector.SetInput(make(chan interface{}, 500))
+
+	prep := pipeline.NewPortScanPreparationModule(ctx, collector)
+	prep.SetInput(make(chan interface{}, 500))
+	prep.SetResolverPool(pool)
+
+	verify := pipeline.NewDomainVerifyModule(ctx, prep, 10)
+	verify.SetInput(make(chan interface{}, 500))
+	verify.SetSaaSClassifier(newFakeSaaSClassifier())
+	verify.SetResolverPool(pool)
+
+	// 一半子域名不带 IP（模拟只返回名称的来源），由域名验证批量解析
+	for i, r := range scanner.Results() {
+		sr := pipeline.SubdomainResult{Host: r.FullDomain, Domain: "example.test", RootDomain: "example.test", IPs: r.IPs}
+		if i%2 == 0 {
+			sr.IPs = nil
+		}
+		verify.GetInput() <- sr
+	}
+	verify.CloseInput()
+	if err := verify.ModuleRun(); err != nil {
+		t.Fatalf("模块运行失败: %v", err)
+	}
+	close(forwarded)
+
+	skips := 0
+	for v := range forwarded {
+		if skip, ok := v.(pipeline.DomainSkip); ok {
+			skips++
+			if len(skip.IP) != 1 || skip.IP[0] != records[skip.Domain][0] {
+				t.Errorf("%s 的 IP 不正确: %v", skip.Domain, skip.IP)
+			}
+		}
+	}
+	if skips != len(hosts) {
+		t.Errorf("应输出 %d 个端口扫描目标, 实际 %d", len(hosts), skips)
+	}
+
+	for _, host := range hosts {
+		if n := fake.count(host); n != 1 {
+			t.Errorf("%s 应在整个流水线中只解析一次, 实际 %d 次", host, n)
+		}
+	}
+	stats := pool.Stats()
+	if stats.Lookups != int64(len(hosts)) || stats.HitRate <= 0.5 {
+		t.Errorf("缓存统计不正确: %+v", stats)
+	}
+}
+
+// TestResolverPoolSystemDefault 未配置 DNS 服务器时使用系统解析器（hosts 文件中的 localhost）并缓存结果
+func TestResolverPoolSystemDefault(t *testing.T) {
+	printSeparator("解析器池系统解析测试")
+
+	pool := subdomain.NewResolverPool(nil, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		ips, err := pool.Resolve(ctx, "localhost")
+		if err != nil || len(ips) == 0 || !net.ParseIP(ips[0]).IsLoopback() {
+			t.Fatalf("未配置 DNS 服务器时应使用系统解析器: %v %v", ips, err)
+		}
+	}
+	if stats := pool.Stats(); stats.Lookups != 1 || stats.Hits != 1 {
+		t.Errorf("系统解析的结果应缓存: %+v", stats)
+	}
+}
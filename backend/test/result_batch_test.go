@@ -0,0 +1,293 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ========== 结果批量入库与通道背压测试 ==========
+
+// memoryBulkWriter 内存中的批量写入：按顺序应用写入，去重的结果按 URL 合并
+type memoryBulkWriter struct {
+	batches [][]service.ResultWrite
+	stored  map[string]*models.ScanResult
+	inserts int
+}
+
+func newMemoryBulkWriter() *memoryBulkWriter {
+	return &memoryBulkWriter{stored: make(map[string]*models.ScanResult)}
+}
+
+func (w *memoryBulkWriter) BulkWriteResults(writes []service.ResultWrite) ([]service.ResultWriteOutcome, error) {
+	w.batches = append(w.batches, writes)
+	outcomes := make([]service.ResultWriteOutcome, len(writes))
+	for i, write := range writes {
+		if !write.Dedup {
+			w.inserts++
+			continue
+		}
+		key, _ := write.Result.Data["url"].(string)
+		if existing, ok := w.stored[key]; ok {
+			existing.Data["title"] = write.Result.Data["title"]
+			outcomes[i].Merged = true
+			continue
+		}
+		w.stored[key] = write.Result
+	}
+	return outcomes, nil
+}
+
+// batchTaskID 批量写入测试的结果所属任务
+var batchTaskID = primitive.NewObjectID()
+
+// urlWrite 一条按 URL 去重的待写入结果
+func urlWrite(url, title string) service.ResultWrite {
+	result := &models.ScanResult{
+		TaskID: batchTaskID,
+		Type:   models.ResultTypeService,
+		Data:   map[string]interface{}{"url": url, "title": title},
+	}
+	return service.ResultWrite{Result: result, Dedup: true, Source: title}
+}
+
+// TestResultBatcherSizeTrigger 累积到批量大小时立即写入，写入成功后按顺序回调
+func TestResultBatcherSizeTrigger(t *testing.T) {
+	printSeparator("结果批量入库数量触发测试")
+
+	writer := newMemoryBulkWriter()
+	var saved []interface{}
+	batcher := service.NewResultBatcher(writer, 3, time.Hour, func(w service.ResultWrite, merged bool) {
+		saved = append(saved, w.Source)
+	})
+
+	batcher.Add(urlWrite("http://a.example.com", "a"))
+	batcher.Add(urlWrite("http://b.example.com", "b"))
+	if len(writer.batches) != 0 || batcher.Pending() != 2 {
+		t.Fatalf("未达到批量大小不应写入: batches=%d pending=%d", len(writer.batches), batcher.Pending())
+	}
+	batcher.Add(service.ResultWrite{Result: &models.ScanResult{Type: models.ResultTypePort, Data: map[string]interface{}{}}, Source: "c"})
+	if len(writer.batches) != 1 || len(writer.batches[0]) != 3 || batcher.Pending() != 0 {
+		t.Fatalf("达到批量大小应写入一批 3 条: %+v", writer.batches)
+	}
+	if writer.inserts != 1 || len(writer.stored) != 2 {
+		t.Errorf("应插入 1 条、合并写入 2 条: inserts=%d stored=%d", writer.inserts, len(writer.stored))
+	}
+	if fmt.Sprint(saved) != "[a b c]" {
+		t.Errorf("回调顺序错误: %v", saved)
+	}
+}
+
+// TestResultBatcherOnFlush 每批结果写入并回调后调用 onFlush，没有等待的结果时不调用
+func TestResultBatcherOnFlush(t *testing.T) {
+	printSeparator("结果批量入库写入后回调测试")
+
+	writer := newMemoryBulkWriter()
+	var calls []string
+	batcher := service.NewResultBatcher(writer, 2, time.Hour, func(w service.ResultWrite, merged bool) {
+		calls = append(calls, w.Source.(string))
+	})
+	batcher.SetOnFlush(func() { calls = append(calls, "flush") })
+
+	batcher.Add(urlWrite("http://a.example.com", "a"))
+	batcher.Add(urlWrite("http://b.example.com", "b"))
+	batcher.Add(urlWrite("http://c.example.com", "c"))
+	batcher.Flush()
+	batcher.Flush()
+	if fmt.Sprint(calls) != "[a b flush c flush]" {
+		t.Errorf("每批写入后应调用一次 onFlush: %v", calls)
+	}
+}
+
+// TestResultBatcherTimeTrigger 不满一批时，最早的结果等待超过间隔后写入
+func TestResultBatcherTimeTrigger(t *testing.T) {
+	printSeparator("结果批量入库时间触发测试")
+
+	writer := newMemoryBulkWriter()
+	batcher := service.NewResultBatcher(writer, 100, 50*time.Millisecond, nil)
+
+	batcher.Add(urlWrite("http://a.example.com", "a"))
+	start := time.Now()
+	batcher.Add(urlWrite("http://b.example.com", "b"))
+	batcher.FlushDue(start)
+	if len(writer.batches) != 0 {
+		t.Fatal("未超过等待间隔不应写入")
+	}
+	batcher.FlushDue(start.Add(60 * time.Millisecond))
+	if len(writer.batches) != 1 || len(writer.batches[0]) != 2 {
+		t.Fatalf("超过等待间隔应写入等待的 2 条: %+v", writer.batches)
+	}
+
+	// 写入后重新计时
+	batcher.Add(urlWrite("http://c.example.com", "c"))
+	batcher.FlushDue(time.Now())
+	if len(writer.batches) != 1 {
+		t.Error("新的一批应重新计时")
+	}
+	batcher.Flush()
+	if len(writer.batches) != 2 || batcher.Pending() != 0 {
+		t.Errorf("Flush 应写入剩余结果: %d", len(writer.batches))
+	}
+}
+
+// TestResultBatcherSameKeyOrder 同一去重键的多次写入跨批次、批内都按到达顺序合并
+func TestResultBatcherSameKeyOrder(t *testing.T) {
+	printSeparator("结果批量入库顺序测试")
+
+	writer := newMemoryBulkWriter()
+	var merged []bool
+	batcher := service.NewResultBatcher(writer, 2, time.Hour, func(w service.ResultWrite, m bool) {
+		merged = append(merged, m)
+	})
+	for i := 1; i <= 5; i++ {
+		batcher.Add(urlWrite("http://app.example.com", fmt.Sprintf("v%d", i)))
+	}
+	batcher.Flush()
+
+	if len(writer.batches) != 3 {
+		t.Fatalf("5 条结果每批 2 条应写入 3 批: %d", len(writer.batches))
+	}
+	if got := writer.stored["http://app.example.com"].Data["title"]; got != "v5" {
+		t.Errorf("最后写入的结果应覆盖之前的: %v", got)
+	}
+	if fmt.Sprint(merged) != "[false true true true true]" {
+		t.Errorf("只有第一条是新结果: %v", merged)
+	}
+
+	// 写入模型与结果顺序一致：去重的为 upsert，其他为预先分配 _id 的插入
+	writes := []service.ResultWrite{
+		urlWrite("http://app.example.com/", "first"),
+		{Result: &models.ScanResult{Type: models.ResultTypePort, Data: map[string]interface{}{"ip": "10.0.0.1", "port": 80}}},
+		urlWrite("http://app.example.com:80", "second"),
+	}
+	writeModels := service.ResultWriteModels(writes, time.Now())
+	first, ok1 := writeModels[0].(*mongo.UpdateOneModel)
+	insert, ok2 := writeModels[1].(*mongo.InsertOneModel)
+	second, ok3 := writeModels[2].(*mongo.UpdateOneModel)
+	if !ok1 || !ok2 || !ok3 {
+		t.Fatalf("写入模型类型或顺序错误: %T %T %T", writeModels[0], writeModels[1], writeModels[2])
+	}
+	if first.Upsert == nil || !*first.Upsert || second.Upsert == nil || !*second.Upsert {
+		t.Error("去重的结果应为 upsert")
+	}
+	if fmt.Sprint(first.Filter) != fmt.Sprint(second.Filter) {
+		t.Errorf("同一主机的结果应使用相同的去重条件: %v / %v", first.Filter, second.Filter)
+	}
+	if writes[1].Result.ID.IsZero() || insert.Document != writes[1].Result {
+		t.Error("插入的结果应预先分配 _id")
+	}
+}
+
+// TestBackpressureWatch 通道持续超过 90% 达到预警时长后只预警一次，回落后重新计时
+func TestBackpressureWatch(t *testing.T) {
+	printSeparator("通道背压预警判定测试")
+
+	watch := pipeline.NewBackpressureWatch(time.Minute)
+	full := map[string]pipeline.ChannelStats{
+		"Fingerprint": {Len: 950, Cap: 1000, Utilization: 0.95},
+		"PortScan":    {Len: 100, Cap: 1000, Utilization: 0.1},
+	}
+	low := map[string]pipeline.ChannelStats{"Fingerprint": {Len: 10, Cap: 1000, Utilization: 0.01}}
+	t0 := time.Now()
+
+	steps := []struct {
+		at    time.Duration
+		stats map[string]pipeline.ChannelStats
+		want  string
+	}{
+		{0, full, "[]"},
+		{30 * time.Second, full, "[]"},
+		{61 * time.Second, full, "[Fingerprint]"},
+		{90 * time.Second, full, "[]"}, // 已预警
+		{100 * time.Second, low, "[]"}, // 回落
+		{110 * time.Second, full, "[]"},
+		{171 * time.Second, full, "[Fingerprint]"},
+	}
+	for _, s := range steps {
+		if got := fmt.Sprint(watch.Check(s.stats, t0.Add(s.at))); got != s.want {
+			t.Errorf("%v: 预警 %s, 应为 %s", s.at, got, s.want)
+		}
+	}
+}
+
+// TestPipelineBackpressureEvent 结果通道无人读取时进度报告显示占用，持续接近满时记录预警事件
+func TestPipelineBackpressureEvent(t *testing.T) {
+	printSeparator("流水线通道背压事件测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:      true,
+		ChannelWarnAfter: 200 * time.Millisecond,
+	}
+	// 结果通道合计容量 2000，1900 条结果超过 90%
+	hosts := make([]string, 1900)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%d.example.com", i)
+	}
+
+	var mu sync.Mutex
+	var events []pipeline.Event
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, len(hosts), nil)
+	pipe.SetEventHandler(func(e pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == pipeline.EventBackpressure {
+			events = append(events, e)
+		}
+	})
+	if err := pipe.Start(hosts); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	// 不读取结果，等待预警
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	report := pipe.GetProgressReport()
+	if stats, ok := report.Channels[pipeline.ResultsChannel]; !ok || stats.Cap != 2000 || stats.Len < 1800 {
+		t.Errorf("进度报告应包含结果通道占用: %+v", report.Channels)
+	}
+	if _, ok := report.Channels["Fingerprint"]; !ok {
+		t.Errorf("进度报告应包含模块通道占用: %+v", report.Channels)
+	}
+
+	results := pipe.Wait()
+	if len(results) != len(hosts) {
+		t.Errorf("读取后结果不应丢失: %d", len(results))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Module != pipeline.ResultsChannel || events[0].Level != pipeline.EventLevelWarn {
+		t.Fatalf("结果通道应记录一次预警事件: %+v", events)
+	}
+	if !strings.Contains(events[0].Message, "结果入库较慢") {
+		t.Errorf("预警应说明原因: %s", events[0].Message)
+	}
+	warned := false
+	for _, w := range report.Warnings {
+		warned = warned || strings.Contains(w, pipeline.ResultsChannel)
+	}
+	if !warned {
+		t.Errorf("进度报告应包含通道预警: %v", report.Warnings)
+	}
+}
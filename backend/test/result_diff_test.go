@@ -0,0 +1,127 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务结果比较测试 ==========
+
+// diffResult 构造一条结果，模拟从数据库读出的数据（数字为 int32，数组为 primitive.A）
+func diffResult(t models.ResultType, data map[string]interface{}) *models.ScanResult {
+	return &models.ScanResult{ID: primitive.NewObjectID(), Type: t, Data: data}
+}
+
+// TestDiffTaskResults 按去重键比较两次任务的结果，分别得到新增、消失和变化的结果
+func TestDiffTaskResults(t *testing.T) {
+	printSeparator("任务结果比较测试")
+
+	before := []*models.ScanResult{
+		diffResult(models.ResultTypeSubdomain, map[string]interface{}{"subdomain": "www.example.com"}),
+		diffResult(models.ResultTypeSubdomain, map[string]interface{}{"subdomain": "old.example.com"}),
+		diffResult(models.ResultTypePort, map[string]interface{}{"ip": "10.0.0.1", "port": int32(22), "service": "ssh"}),
+		diffResult(models.ResultTypePort, map[string]interface{}{"ip": "10.0.0.1", "port": int32(8080), "service": "http"}),
+		diffResult(models.ResultTypeService, map[string]interface{}{
+			"url": "https://www.example.com", "status_code": int32(200), "title": "Home",
+			"technologies": primitive.A{"nginx", "Vue.js"},
+		}),
+		diffResult(models.ResultTypeService, map[string]interface{}{"url": "http://admin.example.com", "status_code": int32(200), "title": "Admin"}),
+		diffResult(models.ResultTypeVuln, map[string]interface{}{"vuln_id": "CVE-2021-1", "target": "https://www.example.com"}),
+	}
+	after := []*models.ScanResult{
+		diffResult(models.ResultTypeSubdomain, map[string]interface{}{"subdomain": "WWW.example.com"}),
+		diffResult(models.ResultTypeSubdomain, map[string]interface{}{"subdomain": "new.example.com"}),
+		// 新任务内存中的结果为 int，与数据库中的 int32 为同一端口
+		diffResult(models.ResultTypePort, map[string]interface{}{"ip": "10.0.0.1", "port": 22, "service": "ssh"}),
+		diffResult(models.ResultTypePort, map[string]interface{}{"ip": "10.0.0.1", "port": int64(8080), "service": "https"}),
+		// 同一 host 的 http/https 为同一服务；状态码类型不同、技术栈顺序不同不算变化
+		diffResult(models.ResultTypeService, map[string]interface{}{
+			"url": "http://www.example.com/", "status_code": 200, "title": "Home",
+			"technologies": []string{"vue.js", "Nginx"},
+		}),
+		diffResult(models.ResultTypeService, map[string]interface{}{"url": "https://admin.example.com:443", "status_code": float64(403), "title": "Forbidden"}),
+		diffResult(models.ResultTypeVuln, map[string]interface{}{"vuln_id": "CVE-2021-1", "target": "https://www.example.com"}),
+		diffResult(models.ResultTypeVuln, map[string]interface{}{"vuln_id": "CVE-2024-2", "target": "https://admin.example.com"}),
+	}
+	diff := service.DiffTaskResults(before, after, nil)
+
+	byType := make(map[models.ResultType]*service.ResultTypeDiff)
+	for _, d := range diff.Types {
+		byType[d.Type] = d
+	}
+	keys := func(items []service.ResultDiffItem) string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.Key)
+		}
+		return strings.Join(out, " ")
+	}
+
+	sub := byType[models.ResultTypeSubdomain]
+	if keys(sub.Added) != "subdomain=new.example.com" || keys(sub.Removed) != "subdomain=old.example.com" || sub.Unchanged != 1 {
+		t.Errorf("子域名比较错误: added=%s removed=%s unchanged=%d", keys(sub.Added), keys(sub.Removed), sub.Unchanged)
+	}
+
+	port := byType[models.ResultTypePort]
+	if len(port.Added) != 0 || len(port.Removed) != 0 || port.Unchanged != 1 {
+		t.Fatalf("int 与 int32 端口应为同一结果: %+v", port)
+	}
+	if len(port.Changed) != 1 || port.Changed[0].Key != "ip=10.0.0.1&port=8080" || fmt.Sprint(port.Changed[0].ChangedFields) != "[service]" {
+		t.Errorf("端口服务变化错误: %+v", port.Changed)
+	}
+
+	svc := byType[models.ResultTypeService]
+	if svc.Unchanged != 1 || len(svc.Changed) != 1 {
+		t.Fatalf("Web 服务比较错误: unchanged=%d changed=%+v", svc.Unchanged, svc.Changed)
+	}
+	changed := svc.Changed[0]
+	if changed.Key != "dedup_host=admin.example.com" || fmt.Sprint(changed.ChangedFields) != "[status_code title]" {
+		t.Errorf("变化的字段错误: %+v", changed)
+	}
+	if changed.Before["status_code"] != int32(200) || changed.After["title"] != "Forbidden" {
+		t.Errorf("应记录变化前后的值: %+v / %+v", changed.Before, changed.After)
+	}
+
+	vuln := byType[models.ResultTypeVuln]
+	if keys(vuln.Added) != "target=https://admin.example.com&vuln_id=CVE-2024-2" || len(vuln.Removed) != 0 {
+		t.Errorf("漏洞比较错误: %+v", vuln)
+	}
+
+	if diff.Total.Added != 2 || diff.Total.Removed != 1 || diff.Total.Changed != 2 || diff.Total.Unchanged != 4 {
+		t.Errorf("合计错误: %+v", diff.Total)
+	}
+	summary := diff.Summary()
+	if !strings.Contains(summary, "新增 2，消失 1，变化 2") || !strings.Contains(summary, "- port: +0 / -0 / ~1") || strings.Contains(summary, "url:") {
+		t.Errorf("摘要错误:\n%s", summary)
+	}
+}
+
+// TestDiffTaskResultsTypes 只比较指定的类型，没有变化时摘要为空
+func TestDiffTaskResultsTypes(t *testing.T) {
+	printSeparator("任务结果按类型比较测试")
+
+	before := []*models.ScanResult{
+		diffResult(models.ResultTypeDirScan, map[string]interface{}{"url": "https://a.example.com/admin/", "status_code": int32(403)}),
+		diffResult(models.ResultTypeSubdomain, map[string]interface{}{"subdomain": "a.example.com"}),
+	}
+	after := []*models.ScanResult{
+		diffResult(models.ResultTypeDirScan, map[string]interface{}{"url": "https://A.example.com/admin", "status_code": 403}),
+	}
+
+	diff := service.DiffTaskResults(before, after, []models.ResultType{models.ResultTypeDirScan})
+	if len(diff.Types) != 1 || diff.Types[0].Type != models.ResultTypeDirScan {
+		t.Fatalf("只应比较目录扫描结果: %+v", diff.Types)
+	}
+	if c := diff.Counts[models.ResultTypeDirScan]; c.Unchanged != 1 || c.Added+c.Removed+c.Changed != 0 {
+		t.Errorf("标准化后的 URL 应为同一结果: %+v", c)
+	}
+	if diff.Summary() != "" {
+		t.Errorf("没有变化时摘要应为空: %q", diff.Summary())
+	}
+}
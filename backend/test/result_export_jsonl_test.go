@@ -0,0 +1,257 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== JSONL 流式导出测试 ==========
+
+// jsonlResults 构造一组模拟从数据库读出的结果（数字为 int32，数组为 primitive.A），按 (created_at, id) 升序
+func jsonlResults(taskID, workspaceID primitive.ObjectID, n int) []*models.ScanResult {
+	base := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	results := make([]*models.ScanResult, 0, n)
+	for i := 0; i < n; i++ {
+		r := &models.ScanResult{
+			ID:          primitive.NewObjectID(),
+			TaskID:      taskID,
+			WorkspaceID: workspaceID,
+			Source:      "scan",
+			// 每两条结果的创建时间相同，续传需要用 ID 区分
+			CreatedAt: base.Add(time.Duration(i/2) * time.Second),
+		}
+		switch i % 3 {
+		case 0:
+			r.Type = models.ResultTypeSubdomain
+			r.Data = bson.M{"subdomain": fmt.Sprintf("s%d.example.com", i), "ips": primitive.A{"10.0.0.1"}, "status_code": int32(200)}
+		case 1:
+			r.Type = models.ResultTypePort
+			r.Data = bson.M{"ip": "10.0.0.1", "port": int32(8000 + i), "service": "http"}
+		default:
+			r.Type = models.ResultTypeApp
+			r.Data = bson.M{"name": fmt.Sprintf("app-%d", i)}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// jsonlKeys 按出现顺序读取一行 JSON 的顶层字段名
+func jsonlKeys(t *testing.T, line []byte) []string {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(line))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		t.Fatalf("不是 JSON 对象: %s", line)
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("解析 JSON 失败: %v", err)
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			t.Fatalf("解析 JSON 失败: %v", err)
+		}
+	}
+	return keys
+}
+
+// splitJSONL 按换行切分导出内容，内容必须以换行结尾
+func splitJSONL(t *testing.T, body []byte) [][]byte {
+	t.Helper()
+	if len(body) == 0 {
+		return nil
+	}
+	if body[len(body)-1] != '\n' {
+		t.Fatalf("JSONL 应以换行结尾")
+	}
+	return bytes.Split(body[:len(body)-1], []byte("\n"))
+}
+
+// TestJSONLExportFraming 每条结果一行，字段顺序固定，缺少的字段输出 null，写出过程中刷新响应
+func TestJSONLExportFraming(t *testing.T) {
+	printSeparator("JSONL 导出行格式测试")
+
+	taskID, workspaceID := primitive.NewObjectID(), primitive.NewObjectID()
+	results := jsonlResults(taskID, workspaceID, 450)
+	rec := httptest.NewRecorder()
+	exporter := service.NewJSONLExporter(rec, false)
+	for i, r := range results {
+		if err := exporter.Write(r); err != nil {
+			t.Fatalf("写出失败: %v", err)
+		}
+		if i == 250 && !rec.Flushed {
+			t.Error("写出 200 行后应刷新响应")
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("结束导出失败: %v", err)
+	}
+
+	lines := splitJSONL(t, rec.Body.Bytes())
+	if len(lines) != 450 || exporter.Count() != 450 {
+		t.Fatalf("应输出 450 行, 实际 %d", len(lines))
+	}
+	for i, line := range lines[:3] {
+		if keys := jsonlKeys(t, line); strings.Join(keys, ",") != strings.Join(service.JSONLFields(results[i].Type), ",") {
+			t.Errorf("%s 字段顺序错误: %v", results[i].Type, keys)
+		}
+	}
+
+	var sub map[string]interface{}
+	json.Unmarshal(lines[0], &sub)
+	if sub["task_id"] != taskID.Hex() || sub["workspace_id"] != workspaceID.Hex() || sub["type"] != "subdomain" {
+		t.Errorf("共有字段错误: %v", sub)
+	}
+	if sub["created_at"] != "2026-03-01T08:00:00Z" || sub["status_code"] != float64(200) {
+		t.Errorf("时间或数字格式错误: %v", sub)
+	}
+	if ips, ok := sub["ips"].([]interface{}); !ok || len(ips) != 1 {
+		t.Errorf("数组字段错误: %v", sub["ips"])
+	}
+	if v, ok := sub["cdn_name"]; !ok || v != nil {
+		t.Errorf("缺少的字段应输出 null: %v", sub)
+	}
+
+	var app map[string]interface{}
+	json.Unmarshal(lines[2], &app)
+	if data, ok := app["data"].(map[string]interface{}); !ok || data["name"] != "app-2" {
+		t.Errorf("未定义字段的类型应输出原始 data: %v", app)
+	}
+}
+
+// TestJSONLExportGzip Accept-Encoding 包含 gzip 时压缩输出，解压后与未压缩的内容一致
+func TestJSONLExportGzip(t *testing.T) {
+	printSeparator("JSONL 导出 gzip 测试")
+
+	for header, want := range map[string]bool{
+		"gzip, deflate, br": true,
+		"deflate;q=1, GZIP": true,
+		"*":                 true,
+		"gzip;q=0, br":      false,
+		"identity":          false,
+		"":                  false,
+	} {
+		if got := service.AcceptsGzip(header); got != want {
+			t.Errorf("AcceptsGzip(%q) = %v, 期望 %v", header, got, want)
+		}
+	}
+
+	results := jsonlResults(primitive.NewObjectID(), primitive.NewObjectID(), 30)
+	var plain bytes.Buffer
+	rec := httptest.NewRecorder()
+	plainExporter := service.NewJSONLExporter(&plain, false)
+	gzExporter := service.NewJSONLExporter(rec, true)
+	for _, r := range results {
+		plainExporter.Write(r)
+		gzExporter.Write(r)
+	}
+	plainExporter.Close()
+	if err := gzExporter.Close(); err != nil {
+		t.Fatalf("结束导出失败: %v", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("输出不是 gzip: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("解压失败: %v", err)
+	}
+	if !bytes.Equal(body, plain.Bytes()) || len(splitJSONL(t, body)) != 30 {
+		t.Errorf("解压后的内容与未压缩的不一致")
+	}
+}
+
+// TestJSONLExportResume 中断后以最后一行的 created_at 和 id 续传，不重复也不遗漏创建时间相同的结果
+func TestJSONLExportResume(t *testing.T) {
+	printSeparator("JSONL 导出续传测试")
+
+	taskID := primitive.NewObjectID()
+	results := jsonlResults(taskID, primitive.NewObjectID(), 10)
+	results = append(results, jsonlResults(primitive.NewObjectID(), primitive.NewObjectID(), 2)...) // 其他任务的结果
+
+	// 第一次导出在第 5 条（与第 6 条创建时间相同）后中断
+	query := service.JSONLExportQuery{TaskID: taskID}
+	var first bytes.Buffer
+	exporter := service.NewJSONLExporter(&first, false)
+	for _, r := range results {
+		if query.Match(r) && exporter.Count() < 5 {
+			exporter.Write(r)
+		}
+	}
+	exporter.Close()
+
+	lines := splitJSONL(t, first.Bytes())
+	var last struct {
+		ID        string `json:"id"`
+		CreatedAt string `json:"created_at"`
+	}
+	if err := json.Unmarshal(lines[len(lines)-1], &last); err != nil {
+		t.Fatalf("解析最后一行失败: %v", err)
+	}
+	cursor, err := service.ParseJSONLCursor(last.CreatedAt, last.ID)
+	if err != nil {
+		t.Fatalf("解析续传位置失败: %v", err)
+	}
+	if want := exporter.Cursor(); !cursor.CreatedAfter.Equal(want.CreatedAfter) || cursor.LastID != want.LastID {
+		t.Errorf("最后一行的续传位置应与导出器一致: %+v / %+v", cursor, want)
+	}
+
+	query.Cursor = cursor
+	filter := query.Filter()
+	if or, ok := filter["$or"].([]bson.M); !ok || len(or) != 2 {
+		t.Errorf("续传条件应为 created_at 更晚或相同且 id 更大: %v", filter)
+	}
+	var resumed []string
+	for _, r := range results {
+		if query.Match(r) {
+			resumed = append(resumed, r.ID.Hex())
+		}
+	}
+	var want []string
+	for _, r := range results[5:10] {
+		want = append(want, r.ID.Hex())
+	}
+	if strings.Join(resumed, ",") != strings.Join(want, ",") {
+		t.Errorf("续传应从第 6 条开始, 实际 %d 条: %v", len(resumed), resumed)
+	}
+
+	if _, err := service.ParseJSONLCursor("", last.ID); err == nil {
+		t.Error("只有 last_id 时应报错")
+	}
+	if _, err := service.ParseJSONLCursor("yesterday", ""); err == nil {
+		t.Error("无效的 created_after 应报错")
+	}
+
+	// 只按 created_after 过滤时不包含该时间的结果
+	onlyAfter := service.JSONLExportQuery{TaskID: taskID, Types: []models.ResultType{models.ResultTypePort}, Cursor: service.JSONLCursor{CreatedAfter: results[2].CreatedAt}}
+	count := 0
+	for _, r := range results {
+		if onlyAfter.Match(r) {
+			count++
+			if r.Type != models.ResultTypePort || !r.CreatedAt.After(results[2].CreatedAt) {
+				t.Errorf("结果不满足类型和时间条件: %+v", r)
+			}
+		}
+	}
+	if count != 2 {
+		t.Errorf("应有 2 条更晚的端口结果, 实际 %d", count)
+	}
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== CSV / XLSX 导出测试 ==========
+
+// syntheticSubdomain 生成第 i 条子域名结果
+func syntheticSubdomain(i int) *models.ScanResult {
+	return &models.ScanResult{
+		Type: models.ResultTypeSubdomain,
+		Data: bson.M{
+			"subdomain":   fmt.Sprintf("host-%d.example.com", i),
+			"ips":         primitive.A{"10.0.0.1", "10.0.0.2"},
+			"cnames":      []string{"cdn.example.net"},
+			"title":       strings.Repeat("title ", 20),
+			"status_code": 200,
+			"cdn_name":    "",
+		},
+	}
+}
+
+// TestTableExportBoundedMemory 一万条结果逐行写出，内存占用不随结果数增长
+func TestTableExportBoundedMemory(t *testing.T) {
+	printSeparator("表格导出内存测试")
+
+	for _, format := range []string{service.ExportFormatCSV, service.ExportFormatXLSX} {
+		counter := &countingWriter{}
+		exporter, err := service.NewTableExporter(counter, format)
+		if err != nil {
+			t.Fatalf("创建导出器失败: %v", err)
+		}
+		if err := exporter.BeginSheet(models.ResultTypeSubdomain); err != nil {
+			t.Fatalf("BeginSheet: %v", err)
+		}
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for i := 0; i < 10000; i++ {
+			if err := exporter.Write(syntheticSubdomain(i)); err != nil {
+				t.Fatalf("%s 写出第 %d 条失败: %v", format, i, err)
+			}
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		if err := exporter.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		if exporter.Count() != 10000 {
+			t.Errorf("%s 应导出 10000 条, 实际 %d", format, exporter.Count())
+		}
+		// CSV 输出远大于保留的内存，说明结果没有积累在导出器中（XLSX 经过压缩）
+		growth := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+		if growth > 4<<20 {
+			t.Errorf("%s 导出后堆内存增长 %d 字节（输出 %d 字节）", format, growth, counter.n)
+		}
+		if format == service.ExportFormatCSV && counter.n < 1<<20 {
+			t.Errorf("%s 输出过小: %d 字节", format, counter.n)
+		}
+	}
+}
+
+// countingWriter 只统计写出的字节数
+type countingWriter struct{ n int64 }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// TestTableExportMissingFields 缺失或类型不同的字段输出空单元格，不会 panic
+func TestTableExportMissingFields(t *testing.T) {
+	printSeparator("表格导出缺失字段测试")
+
+	results := []*models.ScanResult{
+		{Type: models.ResultTypeURL},
+		{Type: models.ResultTypeURL, Data: bson.M{"url": "http://a.example.com/", "status_code": int32(404)}},
+		{Type: models.ResultTypeURL, Data: bson.M{"url": "http://b.example.com/", "size": int64(512), "source": nil}, Source: "katana"},
+		{Type: models.ResultTypeURL, Data: bson.M{"url": "=HYPERLINK(\"http://evil\")", "status": "200", "length": 3.5}},
+	}
+
+	var buf bytes.Buffer
+	exporter, _ := service.NewTableExporter(&buf, service.ExportFormatCSV)
+	if err := exporter.BeginSheet(models.ResultTypeURL); err != nil {
+		t.Fatalf("BeginSheet: %v", err)
+	}
+	for _, r := range results {
+		if err := exporter.Write(r); err != nil {
+			t.Fatalf("写出失败: %v", err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV 解析失败: %v", err)
+	}
+	want := [][]string{
+		{"url", "status", "length", "source"},
+		{"", "", "", ""},
+		{"http://a.example.com/", "404", "", ""},
+		{"http://b.example.com/", "", "512", "katana"},
+		{"'=HYPERLINK(\"http://evil\")", "200", "3.5", ""},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("CSV 内容不符:\n期望 %q\n实际 %q", want, rows)
+	}
+
+	if err := exporter.BeginSheet(models.ResultTypeURL); err == nil {
+		t.Error("CSV 不应导出多种结果类型")
+	}
+	if _, err := service.TableExportTypes("", service.ExportFormatCSV); err == nil {
+		t.Error("CSV 未指定类型应返回错误")
+	}
+	if _, err := service.TableExportTypes(models.ResultTypeMonitor, service.ExportFormatXLSX); err == nil {
+		t.Error("不支持的类型应返回错误")
+	}
+}
+
+// TestTableExportXLSX XLSX 为合法的 zip，每种结果类型一个工作表，空类型只有表头
+func TestTableExportXLSX(t *testing.T) {
+	printSeparator("XLSX 导出测试")
+
+	var buf bytes.Buffer
+	exporter, _ := service.NewTableExporter(&buf, service.ExportFormatXLSX)
+	types, _ := service.TableExportTypes("", service.ExportFormatXLSX)
+	for _, resultType := range types {
+		if err := exporter.BeginSheet(resultType); err != nil {
+			t.Fatalf("BeginSheet: %v", err)
+		}
+		switch resultType {
+		case models.ResultTypePort:
+			exporter.Write(&models.ScanResult{Type: resultType, Data: bson.M{"ip": "10.0.0.1", "port": 443, "service": "https", "version": "nginx <1.2> & co"}})
+		case models.ResultTypeVuln:
+			exporter.Write(&models.ScanResult{Type: resultType, Data: bson.M{"vuln_id": "CVE-2021-0001", "name": "bad\x01name", "severity": "high"}})
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("XLSX 不是合法的 zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("缺少 %s", name)
+		}
+	}
+	if n := strings.Count(files["xl/workbook.xml"], "<sheet "); n != len(types) {
+		t.Errorf("应有 %d 个工作表, 实际 %d", len(types), n)
+	}
+
+	ports := files["xl/worksheets/sheet2.xml"]
+	if !strings.Contains(ports, "nginx &lt;1.2&gt; &amp; co") || !strings.Contains(ports, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">443</t>`) {
+		t.Errorf("端口工作表内容不符: %s", ports)
+	}
+	if strings.Contains(files["xl/worksheets/sheet3.xml"], "\x01") {
+		t.Error("控制字符应从 XML 中去除")
+	}
+	if subdomains := files["xl/worksheets/sheet1.xml"]; strings.Count(subdomains, "<row ") != 1 {
+		t.Errorf("空类型的工作表应只有表头: %s", subdomains)
+	}
+}
@@ -0,0 +1,268 @@
+package test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// ========== 去重写入按字段合并测试 ==========
+
+// storedResult 内存中的单条结果，按 upsert 语句应用 $set、$setOnInsert 和 $addToSet，
+// 每次写入后经过 BSON 编解码，字段类型与从数据库读出的一致（int32、primitive.A 等）
+type storedResult struct {
+	doc bson.M
+}
+
+// setPath 按点分路径写入字段
+func setPath(doc bson.M, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			next = bson.M{}
+			doc[part] = next
+		}
+		doc = next
+	}
+	doc[parts[len(parts)-1]] = value
+}
+
+// getPath 按点分路径读取字段
+func getPath(doc bson.M, path string) interface{} {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			return nil
+		}
+		doc = next
+	}
+	return doc[parts[len(parts)-1]]
+}
+
+// apply 应用 upsert 语句，返回是否为插入
+func (s *storedResult) apply(t *testing.T, filter, update bson.M) bool {
+	t.Helper()
+	inserted := s.doc == nil
+	if inserted {
+		s.doc = bson.M{}
+		// upsert 插入时带上过滤条件中的等值字段
+		for key, value := range filter {
+			if cond, ok := value.(bson.M); ok && len(cond) > 0 {
+				continue
+			}
+			setPath(s.doc, key, value)
+		}
+		for key, value := range update["$setOnInsert"].(bson.M) {
+			setPath(s.doc, key, value)
+		}
+	}
+	for key, value := range update["$set"].(bson.M) {
+		setPath(s.doc, key, value)
+	}
+	for key, value := range update["$addToSet"].(bson.M) {
+		existing, _ := getPath(s.doc, key).(primitive.A)
+		for _, item := range value.(bson.M)["$each"].(primitive.A) {
+			found := false
+			for _, e := range existing {
+				found = found || e == item
+			}
+			if !found {
+				existing = append(existing, item)
+			}
+		}
+		if existing == nil {
+			existing = primitive.A{}
+		}
+		setPath(s.doc, key, existing)
+	}
+
+	raw, err := bson.Marshal(s.doc)
+	if err != nil {
+		t.Fatalf("编码结果失败: %v", err)
+	}
+	s.doc = bson.M{}
+	if err := bson.Unmarshal(raw, &s.doc); err != nil {
+		t.Fatalf("解码结果失败: %v", err)
+	}
+	return inserted
+}
+
+// upsertThrough 通过 ResultService 写入，从 mock 数据库收到的命令中取出过滤条件和更新语句并应用到 stored
+func upsertThrough(mt *mtest.T, svc *service.ResultService, stored *storedResult, result *models.ScanResult) {
+	mt.Helper()
+	if stored.doc == nil {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 0},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: primitive.NewObjectID()}}}},
+		))
+	} else {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+	}
+
+	merged, err := svc.UpsertResult(result)
+	if err != nil {
+		mt.Fatalf("写入失败: %v", err)
+	}
+	if merged == (stored.doc == nil) {
+		mt.Errorf("merged 应表示与已有结果合并: %v", merged)
+	}
+
+	event := mt.GetStartedEvent()
+	if event == nil || event.CommandName != "update" {
+		mt.Fatalf("应发送 update 命令: %+v", event)
+	}
+	var cmd struct {
+		Updates []struct {
+			Q      bson.M `bson:"q"`
+			U      bson.M `bson:"u"`
+			Upsert bool   `bson:"upsert"`
+		} `bson:"updates"`
+	}
+	if err := bson.Unmarshal(event.Command, &cmd); err != nil || len(cmd.Updates) != 1 || !cmd.Updates[0].Upsert {
+		mt.Fatalf("update 命令不正确: %v %+v", err, cmd)
+	}
+	stored.apply(mt.T, cmd.Updates[0].Q, cmd.Updates[0].U)
+}
+
+// stringSet 把数组字段转换为排序后的字符串列表
+func stringSet(v interface{}) []string {
+	var list []string
+	arr, _ := v.(primitive.A)
+	for _, item := range arr {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// TestResultDedupMerge 同一条结果先插入再被其他模块更新：非空字段覆盖，空值保留已有值，数组取并集，记录首次发现来源
+func TestResultDedupMerge(t *testing.T) {
+	printSeparator("去重写入按字段合并测试")
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	taskID := primitive.NewObjectID()
+
+	mt.Run("service", func(mt *mtest.T) {
+		svc := service.NewResultServiceWithCollection(mt.Coll)
+		stored := &storedResult{}
+		upsertThrough(mt, svc, stored, &models.ScanResult{
+			TaskID: taskID, Type: models.ResultTypeService, Source: "httpx", Tags: []string{"prod"},
+			Data: bson.M{"url": "https://www.example.com", "title": "Admin", "status_code": 200, "server": "nginx", "technologies": []string{"nginx"}},
+		})
+		upsertThrough(mt, svc, stored, &models.ScanResult{
+			TaskID: taskID, Type: models.ResultTypeService, Source: "fingerprint",
+			Data: bson.M{"url": "https://www.example.com:443", "title": "", "status_code": 0, "server": "", "technologies": []string{"Vue.js", "nginx"}, "fingerprints": []string{"vue"}},
+		})
+
+		data := stored.doc["data"].(bson.M)
+		if data["title"] != "Admin" || data["server"] != "nginx" {
+			mt.Errorf("空值不应覆盖已有字段: %+v", data)
+		}
+		if code, ok := data["status_code"].(int32); !ok || code != 200 {
+			mt.Errorf("状态码应保留为 200: %#v", data["status_code"])
+		}
+		if data["url"] != "https://www.example.com:443" {
+			mt.Errorf("非空字段应覆盖: %v", data["url"])
+		}
+		if techs := stringSet(data["technologies"]); strings.Join(techs, ",") != "Vue.js,nginx" {
+			mt.Errorf("技术栈应取并集: %v", techs)
+		}
+		if fps := stringSet(data["fingerprints"]); len(fps) != 1 || fps[0] != "vue" {
+			mt.Errorf("指纹应取并集: %v", fps)
+		}
+		if tags := stringSet(stored.doc["tags"]); len(tags) != 1 || tags[0] != "prod" {
+			mt.Errorf("更新不应清除已有标签: %v", tags)
+		}
+	})
+
+	mt.Run("url", func(mt *mtest.T) {
+		svc := service.NewResultServiceWithCollection(mt.Coll)
+		stored := &storedResult{}
+		upsertThrough(mt, svc, stored, &models.ScanResult{
+			TaskID: taskID, Type: models.ResultTypeURL, Source: "crawler",
+			Data: bson.M{"url": "http://www.example.com/login?next=/", "content_type": "text/html", "status_code": 200, "method": "GET"},
+		})
+		firstSeen := stored.doc["first_seen_at"]
+		upsertThrough(mt, svc, stored, &models.ScanResult{
+			TaskID: taskID, Type: models.ResultTypeURL, Source: "dirscan",
+			Data: bson.M{"url": "http://www.example.com/login?next=/", "content_type": "", "status_code": 200, "length": 512},
+		})
+
+		data := stored.doc["data"].(bson.M)
+		if data["content_type"] != "text/html" {
+			mt.Errorf("目录扫描不应清除爬虫记录的内容类型: %+v", data)
+		}
+		if length, ok := data["length"].(int32); !ok || length != 512 {
+			mt.Errorf("新字段应写入: %#v", data["length"])
+		}
+		if data["method"] != "GET" || data["normalized_url"] == nil {
+			mt.Errorf("已有字段应保留: %+v", data)
+		}
+		if sources := stringSet(stored.doc["sources"]); strings.Join(sources, ",") != "crawler,dirscan" {
+			mt.Errorf("sources 应记录全部来源: %v", sources)
+		}
+		if stored.doc["first_seen_source"] != "crawler" || stored.doc["first_seen_at"] != firstSeen {
+			mt.Errorf("首次发现来源和时间只在插入时写入: %v %v", stored.doc["first_seen_source"], stored.doc["first_seen_at"])
+		}
+		if stored.doc["source"] != "dirscan" {
+			mt.Errorf("source 为最近一次写入的来源: %v", stored.doc["source"])
+		}
+	})
+
+	mt.Run("vuln", func(mt *mtest.T) {
+		svc := service.NewResultServiceWithCollection(mt.Coll)
+		stored := &storedResult{}
+		upsertThrough(mt, svc, stored, &models.ScanResult{
+			TaskID: taskID, Type: models.ResultTypeVuln, Source: "nuclei",
+			Data: bson.M{"vuln_id": "CVE-2021-44228", "target": "http://www.example.com", "severity": "critical", "extracted": []string{"jndi"}, "description": ""},
+		})
+		if desc, ok := stored.doc["data"].(bson.M)["description"]; !ok || desc != "" {
+			mt.Errorf("空值应在插入时写入: %#v", desc)
+		}
+
+		// 从数据库读出的结果再次写入：int32 零值、空 primitive.A、空 bson.M 都视为空值
+		replay := bson.M{}
+		for key, value := range stored.doc["data"].(bson.M) {
+			replay[key] = value
+		}
+		replay["severity"] = ""
+		replay["description"] = "Log4Shell"
+		replay["extracted"] = primitive.A{}
+		replay["retries"] = int32(0)
+		replay["matcher"] = bson.M{}
+		update := service.DedupUpdate(&models.ScanResult{Type: models.ResultTypeVuln, Data: replay})
+		set := update["$set"].(bson.M)
+		for _, key := range []string{"data.severity", "data.extracted", "data.retries", "data.matcher"} {
+			if _, ok := set[key]; ok {
+				mt.Errorf("%s 为空值不应覆盖: %v", key, set[key])
+			}
+		}
+		upsertThrough(mt, svc, stored, &models.ScanResult{TaskID: taskID, Type: models.ResultTypeVuln, Source: "nuclei", Data: replay})
+
+		data := stored.doc["data"].(bson.M)
+		if data["severity"] != "critical" || data["description"] != "Log4Shell" {
+			mt.Errorf("非空字段覆盖、空值保留: %+v", data)
+		}
+		if extracted, ok := data["extracted"].(primitive.A); !ok || len(extracted) != 1 {
+			mt.Errorf("空数组不应清除已有值: %#v", data["extracted"])
+		}
+		if _, ok := data["retries"]; ok {
+			mt.Errorf("已有记录不应写入空值: %+v", data)
+		}
+		if sources := stringSet(stored.doc["sources"]); len(sources) != 1 {
+			mt.Errorf("相同来源只记录一次: %v", sources)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 结果保留策略测试 ==========
+
+// memoryRetentionStore 内存实现的结果清理存储
+type memoryRetentionStore struct {
+	mu        sync.Mutex
+	policies  []*models.WorkspaceRetention
+	results   map[primitive.ObjectID]*models.ScanResult
+	tasks     map[primitive.ObjectID]*models.Task
+	audits    []*models.OperationLog
+	deletions []int // 每次 DeleteResults 的批大小
+}
+
+func newMemoryRetentionStore() *memoryRetentionStore {
+	return &memoryRetentionStore{
+		results: make(map[primitive.ObjectID]*models.ScanResult),
+		tasks:   make(map[primitive.ObjectID]*models.Task),
+	}
+}
+
+// addResult 添加一条结果
+func (s *memoryRetentionStore) addResult(ws, task primitive.ObjectID, typ models.ResultType, created time.Time) primitive.ObjectID {
+	id := primitive.NewObjectID()
+	s.results[id] = &models.ScanResult{ID: id, WorkspaceID: ws, TaskID: task, Type: typ, CreatedAt: created}
+	return id
+}
+
+func (s *memoryRetentionStore) ListRetentionPolicies(ctx context.Context) ([]*models.WorkspaceRetention, error) {
+	return s.policies, nil
+}
+
+func (s *memoryRetentionStore) GetRetentionPolicy(ctx context.Context, workspaceID string) (*models.WorkspaceRetention, error) {
+	for _, p := range s.policies {
+		if p.WorkspaceID == workspaceID {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryRetentionStore) SaveRetentionPolicy(ctx context.Context, policy *models.WorkspaceRetention) error {
+	s.policies = append(s.policies, policy)
+	return nil
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryRetentionStore) FindResultIDs(ctx context.Context, sel service.ResultSelection, after primitive.ObjectID, limit int) ([]primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []primitive.ObjectID
+	for id, r := range s.results {
+		switch {
+		case sel.WorkspaceID != nil && r.WorkspaceID != *sel.WorkspaceID,
+			!sel.Before.IsZero() && !r.CreatedAt.Before(sel.Before),
+			!sel.Since.IsZero() && r.CreatedAt.Before(sel.Since),
+			sel.TaskIDs != nil && !containsID(sel.TaskIDs, r.TaskID),
+			containsID(sel.ExcludeTasks, r.TaskID),
+			idAtOrBefore(id, after):
+			continue
+		}
+		excluded := false
+		for _, t := range sel.ExcludeTypes {
+			excluded = excluded || r.Type == t
+		}
+		if !excluded {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Hex() < ids[j].Hex() })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+// idAtOrBefore id 不大于 after，after 为零值时总是 false
+func idAtOrBefore(id, after primitive.ObjectID) bool {
+	return !after.IsZero() && id.Hex() <= after.Hex()
+}
+
+func (s *memoryRetentionStore) DeleteResults(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletions = append(s.deletions, len(ids))
+	var n int64
+	for _, id := range ids {
+		if _, ok := s.results[id]; ok {
+			delete(s.results, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryRetentionStore) CruiseRuns(ctx context.Context, workspaceID primitive.ObjectID) (map[primitive.ObjectID][]primitive.ObjectID, error) {
+	var tasks []*models.Task
+	for _, t := range s.tasks {
+		if t.WorkspaceID == workspaceID && !t.CruiseID.IsZero() && t.Status == models.TaskStatusCompleted {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.After(tasks[j].CreatedAt) })
+	runs := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, t := range tasks {
+		runs[t.CruiseID] = append(runs[t.CruiseID], t.ID)
+	}
+	return runs, nil
+}
+
+func (s *memoryRetentionStore) ResultTaskIDs(ctx context.Context) ([]primitive.ObjectID, error) {
+	seen := make(map[primitive.ObjectID]bool)
+	var ids []primitive.ObjectID
+	for _, r := range s.results {
+		if !seen[r.TaskID] {
+			seen[r.TaskID] = true
+			ids = append(ids, r.TaskID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *memoryRetentionStore) ExistingTasks(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	existing := make(map[primitive.ObjectID]bool)
+	for _, id := range ids {
+		if _, ok := s.tasks[id]; ok {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+func (s *memoryRetentionStore) InsertAudit(ctx context.Context, entry *models.OperationLog) error {
+	s.audits = append(s.audits, entry)
+	return nil
+}
+
+func (s *memoryRetentionStore) addTask(ws, cruise primitive.ObjectID, created time.Time) primitive.ObjectID {
+	id := primitive.NewObjectID()
+	s.tasks[id] = &models.Task{ID: id, WorkspaceID: ws, CruiseID: cruise, Status: models.TaskStatusCompleted, CreatedAt: created}
+	return id
+}
+
+// TestRetentionCutoff 截止时间为所在自然日往前 N 天的零点
+func TestRetentionCutoff(t *testing.T) {
+	printSeparator("结果保留截止时间测试")
+
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2026, 3, 1, 0, 30, 0, 0, loc)
+	tests := []struct {
+		days int
+		want time.Time
+	}{
+		{0, time.Time{}},
+		{1, time.Date(2026, 2, 28, 0, 0, 0, 0, loc)},
+		{30, time.Date(2026, 1, 30, 0, 0, 0, 0, loc)},
+		{-3, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := service.RetentionCutoff(now, tt.days); !got.Equal(tt.want) {
+			t.Errorf("keepDays=%d: got %v, want %v", tt.days, got, tt.want)
+		}
+	}
+
+	// 跨年
+	newYear := time.Date(2027, 1, 1, 23, 59, 59, 0, loc)
+	if got := service.RetentionCutoff(newYear, 1); !got.Equal(time.Date(2026, 12, 31, 0, 0, 0, 0, loc)) {
+		t.Errorf("跨年截止时间不正确: %v", got)
+	}
+}
+
+// TestRetentionDaysBoundary 早于截止时间的结果删除，截止时间及之后的保留；漏洞结果默认保留；DryRun 不删除
+func TestRetentionDaysBoundary(t *testing.T) {
+	printSeparator("结果保留天数边界测试")
+
+	store := newMemoryRetentionStore()
+	ws := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	task := store.addTask(ws, primitive.NilObjectID, time.Now())
+	otherTask := store.addTask(other, primitive.NilObjectID, time.Now())
+
+	now := time.Date(2026, 10, 14, 9, 0, 0, 0, time.Local)
+	cutoff := time.Date(2026, 10, 7, 0, 0, 0, 0, time.Local)
+	expired := []primitive.ObjectID{
+		store.addResult(ws, task, models.ResultTypeSubdomain, cutoff.Add(-time.Nanosecond)),
+		store.addResult(ws, task, models.ResultTypePort, cutoff.AddDate(0, 0, -20)),
+	}
+	kept := []primitive.ObjectID{
+		store.addResult(ws, task, models.ResultTypeSubdomain, cutoff),
+		store.addResult(ws, task, models.ResultTypeURL, now),
+		store.addResult(ws, task, models.ResultTypeVuln, cutoff.AddDate(0, 0, -20)),        // 漏洞默认保留
+		store.addResult(other, otherTask, models.ResultTypePort, cutoff.AddDate(-1, 0, 0)), // 其他工作空间没有策略
+	}
+	store.policies = []*models.WorkspaceRetention{{WorkspaceID: ws.Hex(), KeepDays: 7}}
+
+	report, err := service.RunRetention(context.Background(), store, service.RetentionOptions{DryRun: true, Now: now})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Total != int64(len(expired)) || len(store.results) != len(expired)+len(kept) {
+		t.Errorf("DryRun 应只统计不删除: total=%d results=%d", report.Total, len(store.results))
+	}
+	if len(store.audits) != 0 {
+		t.Error("DryRun 不应写审计日志")
+	}
+
+	report, err = service.RunRetention(context.Background(), store, service.RetentionOptions{Now: now, Username: "admin"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Total != int64(len(expired)) || len(report.Workspaces) != 1 || !report.Workspaces[0].Cutoff.Equal(cutoff) {
+		t.Errorf("清理结果不正确: %+v", report)
+	}
+	for _, id := range expired {
+		if _, ok := store.results[id]; ok {
+			t.Errorf("过期结果应删除: %s", id.Hex())
+		}
+	}
+	for _, id := range kept {
+		if _, ok := store.results[id]; !ok {
+			t.Errorf("结果不应删除: %s", id.Hex())
+		}
+	}
+	if len(store.audits) != 1 || store.audits[0].Action != service.RetentionAuditAction || store.audits[0].Username != "admin" {
+		t.Errorf("应写入一条审计日志: %+v", store.audits)
+	}
+
+	// 启用漏洞结果清理
+	store.policies[0].IncludeVulnResults = true
+	report, _ = service.RunRetention(context.Background(), store, service.RetentionOptions{Now: now})
+	if report.Total != 1 {
+		t.Errorf("启用后应清理过期的漏洞结果: %+v", report)
+	}
+}
+
+// TestRetentionKeepRunsAndBatches 每个巡航保留最近 K 次执行，分批删除
+func TestRetentionKeepRunsAndBatches(t *testing.T) {
+	printSeparator("巡航执行保留次数测试")
+
+	store := newMemoryRetentionStore()
+	ws := primitive.NewObjectID()
+	cruise := primitive.NewObjectID()
+	base := time.Now().Add(-time.Hour)
+	var runs []primitive.ObjectID
+	for i := 0; i < 4; i++ {
+		runs = append(runs, store.addTask(ws, cruise, base.Add(time.Duration(i)*time.Minute)))
+	}
+	manual := store.addTask(ws, primitive.NilObjectID, base)
+	for _, task := range append(runs, manual) {
+		for i := 0; i < 5; i++ {
+			store.addResult(ws, task, models.ResultTypePort, base)
+		}
+	}
+	store.policies = []*models.WorkspaceRetention{{WorkspaceID: ws.Hex(), KeepRuns: 2}}
+
+	report, err := service.RunRetention(context.Background(), store, service.RetentionOptions{BatchSize: 3})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Workspaces[0].OldRuns != 10 {
+		t.Errorf("两次旧执行共 10 条结果应删除: %+v", report.Workspaces[0])
+	}
+	for _, r := range store.results {
+		if r.TaskID == runs[0] || r.TaskID == runs[1] {
+			t.Errorf("旧执行的结果应删除: %s", r.TaskID.Hex())
+		}
+	}
+	if len(store.results) != 15 {
+		t.Errorf("最近两次执行和手动任务的结果应保留: %d", len(store.results))
+	}
+	for _, n := range store.deletions {
+		if n > 3 {
+			t.Errorf("每批删除数不应超过 BatchSize: %v", store.deletions)
+		}
+	}
+
+	got := service.ExpiredRuns(map[primitive.ObjectID][]primitive.ObjectID{cruise: {runs[3], runs[2]}}, 2)
+	if len(got) != 0 {
+		t.Errorf("执行次数未超过保留次数时不应清理: %v", got)
+	}
+}
+
+// TestRetentionOrphans 所属任务已删除的结果作为孤立结果清理，不区分工作空间和类型，且只计数一次
+func TestRetentionOrphans(t *testing.T) {
+	printSeparator("孤立结果清理测试")
+
+	store := newMemoryRetentionStore()
+	ws := primitive.NewObjectID()
+	live := store.addTask(ws, primitive.NilObjectID, time.Now())
+	deleted := primitive.NewObjectID()
+	old := time.Now().AddDate(0, 0, -60)
+	store.addResult(ws, live, models.ResultTypePort, time.Now())
+	store.addResult(ws, deleted, models.ResultTypeVuln, time.Now())
+	store.addResult(ws, deleted, models.ResultTypePort, old)
+	store.addResult(primitive.NewObjectID(), deleted, models.ResultTypeURL, old)
+	store.policies = []*models.WorkspaceRetention{{WorkspaceID: ws.Hex(), KeepDays: 30}}
+
+	orphans, err := service.FindOrphanTasks(context.Background(), store)
+	if err != nil || len(orphans) != 1 || orphans[0] != deleted {
+		t.Fatalf("应找到一个孤立任务: %v %v", orphans, err)
+	}
+
+	dry, _ := service.RunRetention(context.Background(), store, service.RetentionOptions{DryRun: true})
+	report, err := service.RunRetention(context.Background(), store, service.RetentionOptions{})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Orphaned != 3 || report.OrphanTasks != 1 || report.Total != 3 {
+		t.Errorf("孤立结果清理不正确: %+v", report)
+	}
+	if dry.Total != report.Total {
+		t.Errorf("DryRun 数量应与实际删除数量一致: dry=%d run=%d", dry.Total, report.Total)
+	}
+	if len(store.results) != 1 {
+		t.Errorf("存在的任务的结果应保留: %d", len(store.results))
+	}
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 结果关键字搜索测试 ==========
+
+// searchRegex 取出单字段搜索条件中的正则
+func searchRegex(t *testing.T, filter bson.M, field string) primitive.Regex {
+	t.Helper()
+	regex, ok := filter[field].(primitive.Regex)
+	if !ok {
+		t.Fatalf("应只搜索 %s: %v", field, filter)
+	}
+	return regex
+}
+
+// TestSearchEscapesSpecialCharacters 默认按字面量搜索，正则元字符被转义
+func TestSearchEscapesSpecialCharacters(t *testing.T) {
+	printSeparator("结果搜索特殊字符测试")
+
+	filter, err := service.BuildSearchFilter("1.2.3.4", []string{"data.url", "data.title"})
+	if err != nil {
+		t.Fatalf("构建搜索条件失败: %v", err)
+	}
+	clauses, ok := filter["$or"].([]bson.M)
+	if !ok || len(clauses) != 2 {
+		t.Fatalf("未指定字段时应搜索全部默认字段: %v", filter)
+	}
+	regex := searchRegex(t, clauses[0], "data.url")
+	re := regexp.MustCompile("(?i)" + regex.Pattern)
+	if re.MatchString("http://1x2y3z4/") || !re.MatchString("http://1.2.3.4/") {
+		t.Errorf("点号应按字面量匹配: %q", regex.Pattern)
+	}
+
+	for _, search := range []string{"(", "a[b", "*.example.com", "c++"} {
+		filter, err := service.BuildSearchFilter(search, []string{"data.title"})
+		if err != nil {
+			t.Errorf("%q 不应报错: %v", search, err)
+			continue
+		}
+		regex := searchRegex(t, filter, "data.title")
+		if _, err := regexp.Compile(regex.Pattern); err != nil || !regexp.MustCompile(regex.Pattern).MatchString("x"+search+"y") {
+			t.Errorf("%q 转义后应是合法正则并匹配原文: %q", search, regex.Pattern)
+		}
+	}
+
+	if filter, _ := service.BuildSearchFilter("  ", []string{"data.title"}); len(filter) != 0 {
+		t.Errorf("空搜索不应添加条件: %v", filter)
+	}
+}
+
+// TestSearchFieldScoped field:value 只搜索指定字段，IP 按前缀匹配
+func TestSearchFieldScoped(t *testing.T) {
+	printSeparator("结果搜索指定字段测试")
+
+	defaults := []string{"data.domain", "data.subdomain", "data.url", "data.ip"}
+	filter, err := service.BuildSearchFilter("ip:10.0.0.", defaults)
+	if err != nil {
+		t.Fatalf("构建搜索条件失败: %v", err)
+	}
+	if regex := searchRegex(t, filter, "data.ip"); regex.Pattern != `^10\.0\.0\.` || regex.Options != "" {
+		t.Errorf("IP 应按前缀匹配以便使用索引: %+v", regex)
+	}
+
+	filter, _ = service.BuildSearchFilter("Title:login", defaults)
+	if regex := searchRegex(t, filter, "data.title"); regex.Pattern != "login" || regex.Options != "i" {
+		t.Errorf("标题应不区分大小写包含匹配: %+v", regex)
+	}
+
+	filter, _ = service.BuildSearchFilter("title:/log(in|on)/", defaults)
+	if regex := searchRegex(t, filter, "data.title"); regex.Pattern != "log(in|on)" {
+		t.Errorf("指定字段时也应支持原始正则: %+v", regex)
+	}
+
+	// 未知前缀按普通关键字搜索
+	filter, _ = service.BuildSearchFilter("http://api.example.com", defaults)
+	if clauses, ok := filter["$or"].([]bson.M); !ok || len(clauses) != len(defaults) {
+		t.Errorf("URL 不应被当作字段前缀: %v", filter)
+	}
+
+	if _, err := service.BuildSearchFilter("ip:", defaults); !errors.Is(err, service.ErrInvalidSearch) {
+		t.Errorf("指定字段但缺少内容应返回 ErrInvalidSearch: %v", err)
+	}
+}
+
+// TestSearchInvalidRawRegex 非法的原始正则返回 ErrInvalidSearch（接口返回 400），而不是查询时的内部错误
+func TestSearchInvalidRawRegex(t *testing.T) {
+	printSeparator("结果搜索非法正则测试")
+
+	for _, search := range []string{"/(/", "url:/a[/"} {
+		if _, err := service.BuildSearchFilter(search, []string{"data.url"}); !errors.Is(err, service.ErrInvalidSearch) {
+			t.Errorf("%q 应返回 ErrInvalidSearch: %v", search, err)
+		}
+	}
+
+	filter, err := service.BuildSearchFilter(`/^api-\d+\./`, []string{"data.subdomain"})
+	if err != nil {
+		t.Fatalf("合法的原始正则不应报错: %v", err)
+	}
+	if regex := searchRegex(t, filter, "data.subdomain"); regex.Pattern != `^api-\d+\.` || regex.Options != "i" {
+		t.Errorf("原始正则应原样使用: %+v", regex)
+	}
+
+	var subdomainIndex bool
+	for _, index := range service.ResultIndexes() {
+		keys := index.Keys.(bson.D)
+		if len(keys) == 3 && keys[0].Key == "task_id" && keys[1].Key == "type" && keys[2].Key == "data.subdomain" {
+			subdomainIndex = true
+		}
+	}
+	if !subdomainIndex {
+		t.Error("应创建 task_id + type + data.subdomain 复合索引")
+	}
+}
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 结果标签筛选和批量打标签测试 ==========
+
+// memoryBulkTagStore 内存中的结果标签，NextIDs 忽略 filter，按 _id 升序分页
+type memoryBulkTagStore struct {
+	ids       []primitive.ObjectID
+	tags      map[primitive.ObjectID][]string
+	batches   int
+	deadlines []time.Time
+}
+
+func newMemoryBulkTagStore(n int) *memoryBulkTagStore {
+	s := &memoryBulkTagStore{tags: make(map[primitive.ObjectID][]string)}
+	for i := 0; i < n; i++ {
+		id := primitive.NewObjectID()
+		s.ids = append(s.ids, id)
+		s.tags[id] = nil
+	}
+	sort.Slice(s.ids, func(i, j int) bool { return s.ids[i].Hex() < s.ids[j].Hex() })
+	return s
+}
+
+func (s *memoryBulkTagStore) NextIDs(ctx context.Context, filter bson.M, after primitive.ObjectID, limit int) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for _, id := range s.ids {
+		if id.Hex() > after.Hex() && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *memoryBulkTagStore) UpdateMany(ctx context.Context, ids []primitive.ObjectID, update bson.M) (int64, error) {
+	s.batches++
+	deadline, _ := ctx.Deadline()
+	s.deadlines = append(s.deadlines, deadline)
+
+	tag := update["$addToSet"].(bson.M)["tags"].(string)
+	var modified int64
+	for _, id := range ids {
+		has := false
+		for _, t := range s.tags[id] {
+			has = has || t == tag
+		}
+		if !has {
+			s.tags[id] = append(s.tags[id], tag)
+			modified++
+		}
+	}
+	return modified, nil
+}
+
+// TestNormalizeResultTags 标签去掉空白并转小写，空标签被拒绝
+func TestNormalizeResultTags(t *testing.T) {
+	printSeparator("结果标签标准化测试")
+
+	if tag, err := service.NormalizeTag("  Reviewed "); err != nil || tag != "reviewed" {
+		t.Errorf("标签应标准化为 reviewed: %q %v", tag, err)
+	}
+	for _, tag := range []string{"", "   "} {
+		if _, err := service.NormalizeTag(tag); !errors.Is(err, service.ErrInvalidTag) {
+			t.Errorf("%q 应返回 ErrInvalidTag: %v", tag, err)
+		}
+	}
+	tags, err := service.NormalizeTags([]string{"Prod", "prod ", "TODO"})
+	if err != nil || len(tags) != 2 || tags[0] != "prod" || tags[1] != "todo" {
+		t.Errorf("标签列表应去重: %v %v", tags, err)
+	}
+	if tags := service.ParseTagList("FP, ,Critical,"); len(tags) != 2 || tags[0] != "fp" || tags[1] != "critical" {
+		t.Errorf("查询参数应忽略空项: %v", tags)
+	}
+}
+
+// TestTaskResultTagFilter 标签筛选支持包含任意一个和不包含任何一个
+func TestTaskResultTagFilter(t *testing.T) {
+	printSeparator("结果标签筛选测试")
+
+	taskID := primitive.NewObjectID().Hex()
+	filter, err := service.TaskResultFilter(taskID, models.ResultTypeSubdomain, "api", 0, service.ResultTagFilter{
+		Any:  []string{"Prod", "staging"},
+		None: []string{" FP "},
+	})
+	if err != nil {
+		t.Fatalf("TaskResultFilter failed: %v", err)
+	}
+	clause, ok := filter["tags"].(bson.M)
+	if !ok {
+		t.Fatalf("应包含 tags 条件: %v", filter)
+	}
+	if in := clause["$in"].([]string); len(in) != 2 || in[0] != "prod" || in[1] != "staging" {
+		t.Errorf("$in 条件不符: %v", clause)
+	}
+	if nin := clause["$nin"].([]string); len(nin) != 1 || nin[0] != "fp" {
+		t.Errorf("$nin 条件不符: %v", clause)
+	}
+	if filter["type"] != models.ResultTypeSubdomain || filter["$or"] == nil {
+		t.Errorf("应保留类型和搜索条件: %v", filter)
+	}
+
+	filter, _ = service.TaskResultFilter(taskID, "", "", 0, service.ResultTagFilter{})
+	if _, ok := filter["tags"]; ok {
+		t.Errorf("未指定标签时不应筛选: %v", filter)
+	}
+
+	var tagIndex bool
+	for _, index := range service.ResultIndexes() {
+		keys := index.Keys.(bson.D)
+		for _, k := range keys {
+			tagIndex = tagIndex || k.Key == "tags"
+		}
+	}
+	if !tagIndex {
+		t.Error("应创建包含 tags 的索引")
+	}
+}
+
+// TestBulkTagSelection 批量范围按 ID 列表或任务筛选条件构建，范围无效时报错
+func TestBulkTagSelection(t *testing.T) {
+	printSeparator("批量标签范围测试")
+
+	ids := []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()}
+	filter, err := service.BulkTagSelection{IDs: ids, TaskID: "ignored"}.Filter()
+	if err != nil {
+		t.Fatalf("ID 列表不应报错: %v", err)
+	}
+	if in := filter["_id"].(bson.M)["$in"].([]primitive.ObjectID); len(in) != 2 || len(filter) != 1 {
+		t.Errorf("指定 ID 时只按 ID 筛选: %v", filter)
+	}
+
+	filter, err = service.BulkTagSelection{TaskID: primitive.NewObjectID().Hex(), Type: models.ResultTypeService, Tags: service.ResultTagFilter{None: []string{"fp"}}}.Filter()
+	if err != nil || filter["type"] != models.ResultTypeService || filter["tags"] == nil {
+		t.Errorf("任务筛选条件不符: %v %v", filter, err)
+	}
+
+	for _, sel := range []service.BulkTagSelection{{}, {IDs: []string{"bad"}}, {TaskID: "bad"}} {
+		if _, err := sel.Filter(); !errors.Is(err, service.ErrInvalidTagSelection) {
+			t.Errorf("%+v 应返回 ErrInvalidTagSelection: %v", sel, err)
+		}
+	}
+	if _, err := (service.BulkTagSelection{TaskID: primitive.NewObjectID().Hex(), Search: "/(/"}).Filter(); !errors.Is(err, service.ErrInvalidSearch) {
+		t.Errorf("非法搜索应返回 ErrInvalidSearch: %v", err)
+	}
+}
+
+// TestApplyBulkTagUpdate 按批更新 2500 条结果，每批使用独立的数据库超时，已有标签的结果不计入修改数
+func TestApplyBulkTagUpdate(t *testing.T) {
+	printSeparator("批量打标签分批测试")
+
+	store := newMemoryBulkTagStore(2500)
+	update := bson.M{"$addToSet": bson.M{"tags": "triaged"}}
+
+	modified, err := service.ApplyBulkTagUpdate(store, bson.M{}, update, 1000)
+	if err != nil {
+		t.Fatalf("ApplyBulkTagUpdate failed: %v", err)
+	}
+	if modified != 2500 || store.batches != 3 {
+		t.Errorf("期望 3 批修改 2500 条, 实际 %d 批 %d 条", store.batches, modified)
+	}
+	for i := 1; i < len(store.deadlines); i++ {
+		if !store.deadlines[i].After(store.deadlines[i-1]) {
+			t.Errorf("每批应使用新的数据库超时: %v", store.deadlines)
+		}
+	}
+
+	// 再次执行时结果已带标签，修改数为 0
+	modified, err = service.ApplyBulkTagUpdate(store, bson.M{}, update, 1000)
+	if err != nil || modified != 0 {
+		t.Errorf("重复打标签不应修改结果: %d %v", modified, err)
+	}
+}
@@ -0,0 +1,222 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/subdomain"
+	"moongazing/service/pipeline"
+)
+
+// ========== SaaS 资产分类测试 ==========
+// 使用模拟 DNS 返回预设的 CNAME 链
+
+// fakeCNAMEs 模拟的单跳 CNAME 记录
+var fakeCNAMEs = map[string]string{
+	"shop.example.test":         "example.myshopify.com",
+	"example.myshopify.com":     "shops.myshopify.com",
+	"crm.example.test":          "example.my.salesforce.com",
+	"docs.example.test":         "example.atlassian.net",
+	"example.atlassian.net":     "d1234.cloudfront.net",
+	"lb.example.test":           "web-123.us-east-1.elb.amazonaws.com",
+	"app.example.test":          "example-app.azurewebsites.net",
+	"blog.example.test":         "example.github.io",
+	"loop.example.test":         "loop-a.example.test",
+	"loop-a.example.test":       "loop.example.test",
+	"www.example.test":          "",
+	"example.my.salesforce.com": "",
+}
+
+func fakeCNAMELookup(ctx context.Context, host string) (string, error) {
+	return fakeCNAMEs[host], nil
+}
+
+// fakeHostLookup 只有 Azure 的 CNAME 目标不存在（悬挂）
+func fakeHostLookup(ctx context.Context, host string) ([]string, error) {
+	if strings.HasSuffix(host, ".azurewebsites.net") {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []string{"192.0.2.10"}, nil
+}
+
+func newFakeSaaSClassifier() *subdomain.SaaSClassifier {
+	classifier := subdomain.NewSaaSClassifier()
+	classifier.SetResolver(fakeCNAMELookup, fakeHostLookup)
+	return classifier
+}
+
+// TestSaaSClassification 按 CNAME 链识别三类处理建议，链上中间节点也参与匹配
+func TestSaaSClassification(t *testing.T) {
+	printSeparator("SaaS资产分类测试")
+
+	classifier := newFakeSaaSClassifier()
+	cases := []struct {
+		host     string
+		provider string
+		handling string
+	}{
+		{"shop.example.test", "Shopify", subdomain.SaaSHandlingTakeover},
+		{"crm.example.test", "Salesforce", subdomain.SaaSHandlingSkipPortScan},
+		{"docs.example.test", "Atlassian", subdomain.SaaSHandlingSkipPortScan},
+		{"lb.example.test", "AWS ELB", subdomain.SaaSHandlingScan},
+		{"www.example.test", "", ""},
+		{"loop.example.test", "", ""},
+	}
+	for _, c := range cases {
+		match, chain := classifier.Classify(context.Background(), c.host, nil)
+		if c.provider == "" {
+			if match != nil {
+				t.Errorf("%s 不应命中 SaaS 平台: %+v", c.host, match.Provider)
+			}
+			continue
+		}
+		if match == nil {
+			t.Errorf("%s 应命中 %s, CNAME 链: %v", c.host, c.provider, chain)
+			continue
+		}
+		if match.Provider.Name != c.provider || match.Provider.Handling != c.handling {
+			t.Errorf("%s 分类不正确: %s/%s", c.host, match.Provider.Name, match.Provider.Handling)
+		}
+	}
+
+	// 中间节点命中 Atlassian，链末端的 CloudFront 保留在 CNAME 链中
+	_, chain := classifier.Classify(context.Background(), "docs.example.test", nil)
+	if strings.Join(chain, ",") != "example.atlassian.net,d1234.cloudfront.net" {
+		t.Errorf("CNAME 链不正确: %v", chain)
+	}
+
+	// 子域名扫描结果中已有的 CNAME 也参与匹配
+	if match, _ := classifier.Classify(context.Background(), "www.example.test", []string{"example.herokuapp.com."}); match == nil || match.Provider.Name != "Heroku" {
+		t.Errorf("已知 CNAME 应参与分类: %+v", match)
+	}
+
+	// 字典缺失时使用内置规则
+	fallback := subdomain.NewSaaSClassifierWithProviders(nil)
+	if match := fallback.Match([]string{"example.github.io"}); match == nil || !match.TakeoverRelevant() {
+		t.Errorf("内置规则应识别 GitHub Pages: %+v", match)
+	}
+}
+
+// TestSaaSTakeoverFingerprint 可接管平台按平台专属指纹检测
+func TestSaaSTakeoverFingerprint(t *testing.T) {
+	printSeparator("SaaS平台接管指纹测试")
+
+	classifier := newFakeSaaSClassifier()
+	scanner := subdomain.NewTakeoverScanner(5)
+	scanner.SetHostLookup(classifier.LookupHost)
+
+	// Azure：CNAME 目标不存在即判定悬挂
+	azure, _ := classifier.Classify(context.Background(), "app.example.test", nil)
+	if azure == nil || !azure.TakeoverRelevant() {
+		t.Fatalf("app.example.test 应命中可接管平台: %+v", azure)
+	}
+	result := scanner.ScanWithFingerprint(context.Background(), "app.example.test", azure.CNAME, azure.Provider.TakeoverFingerprint())
+	if !result.Vulnerable || result.Service != "Azure App Service" || !contains(result.Reason, "Dangling CNAME") {
+		t.Errorf("悬挂的 Azure CNAME 应判定为可接管: %+v", result)
+	}
+
+	// GitHub Pages：按响应内容指纹检测
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>404</h1><p>There isn't a GitHub Pages site here.</p>"))
+	}))
+	defer server.Close()
+	scanner.SetHTTPClient(&http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	})
+
+	pages, _ := classifier.Classify(context.Background(), "blog.example.test", nil)
+	if pages == nil || pages.Provider.Name != "GitHub Pages" {
+		t.Fatalf("blog.example.test 应命中 GitHub Pages: %+v", pages)
+	}
+	result = scanner.ScanWithFingerprint(context.Background(), "blog.example.test", pages.CNAME, pages.Provider.TakeoverFingerprint())
+	if !result.Vulnerable || len(result.Fingerprints) == 0 {
+		t.Errorf("GitHub Pages 指纹应命中: %+v", result)
+	}
+}
+
+// TestSaaSDomainVerifyRouting 域名验证模块写入分类结果，跳过端口扫描的主机带原因，可接管平台进入接管检测
+func TestSaaSDomainVerifyRouting(t *testing.T) {
+	printSeparator("SaaS分类流水线路由测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	forwarded := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, forwarded)
+	collector.SetInput(make(chan interface{}, 100))
+
+	module := pipeline.NewDomainVerifyModule(ctx, collector, 5)
+	module.SetInput(make(chan interface{}, 100))
+	module.SetSaaSClassifier(newFakeSaaSClassifier())
+
+	for _, host := range []string{"crm.example.test", "app.example.test", "lb.example.test"} {
+		module.GetInput() <- pipeline.SubdomainResult{Host: host, Domain: "example.test", RootDomain: "example.test"}
+	}
+	module.CloseInput()
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("模块运行失败: %v", err)
+	}
+	close(forwarded)
+
+	subdomains := make(map[string]pipeline.SubdomainResult)
+	resolves := make(map[string]pipeline.DomainResolve)
+	var takeovers []pipeline.TakeoverResult
+	for v := range forwarded {
+		switch r := v.(type) {
+		case pipeline.SubdomainResult:
+			subdomains[r.Host] = r
+		case pipeline.DomainResolve:
+			resolves[r.Domain] = r
+		case pipeline.TakeoverResult:
+			takeovers = append(takeovers, r)
+		}
+	}
+
+	crm := subdomains["crm.example.test"]
+	if crm.SaaSProvider != "Salesforce" || crm.SaaSCategory != "crm" || crm.SaaSHandling != subdomain.SaaSHandlingSkipPortScan {
+		t.Errorf("子域名结果应记录 SaaS 分类: %+v", crm)
+	}
+	if crm.SkipReason == "" || !contains(resolves["crm.example.test"].SkipReason, "Salesforce") {
+		t.Errorf("skip-portscan 主机应带跳过原因: %q / %+v", crm.SkipReason, resolves["crm.example.test"])
+	}
+	if lb := resolves["lb.example.test"]; lb.SkipReason != "" || subdomains["lb.example.test"].SaaSHandling != subdomain.SaaSHandlingScan {
+		t.Errorf("scan-normally 主机应正常进入端口扫描: %+v", lb)
+	}
+	if resolves["app.example.test"].SkipReason != "" {
+		t.Errorf("takeover-relevant 主机不应跳过端口扫描: %+v", resolves["app.example.test"])
+	}
+	if len(takeovers) != 1 || takeovers[0].Domain != "app.example.test" || takeovers[0].Service != "Azure App Service" {
+		t.Errorf("可接管平台应使用平台指纹进入接管检测: %+v", takeovers)
+	}
+
+	// 端口扫描预处理保留跳过原因，不再做CDN检测
+	prepOut := make(chan interface{}, 10)
+	prepCollector := pipeline.NewResultCollectorModule(ctx, prepOut)
+	prepCollector.SetInput(make(chan interface{}, 10))
+	prep := pipeline.NewPortScanPreparationModule(ctx, prepCollector)
+	prep.SetInput(make(chan interface{}, 10))
+	prep.GetInput() <- resolves["crm.example.test"]
+	prep.CloseInput()
+	if err := prep.ModuleRun(); err != nil {
+		t.Fatalf("模块运行失败: %v", err)
+	}
+	close(prepOut)
+	for v := range prepOut {
+		skip, ok := v.(pipeline.DomainSkip)
+		if !ok || !skip.Skip || skip.IsCDN || !contains(skip.Reason, "Salesforce") {
+			t.Errorf("SaaS 主机应跳过端口扫描并保留原因: %+v", v)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 保存的搜索测试 ==========
+
+// prodAssetsFilter 带 prod 标签、大于 10KB、不是 .js/.css 的目录扫描结果
+const prodAssetsFilter = `{
+	"type": "dirscan",
+	"tags": ["prod"],
+	"conditions": [
+		{"field": "size", "op": "gt", "value": 10240},
+		{"field": "url", "op": "not_ends_with", "value": ".js"},
+		{"field": "url", "op": "not_ends_with", "value": ".css"},
+		{"field": "status", "op": "in", "value": [200, 403]}
+	]
+}`
+
+// TestSavedSearchCompileEquivalence 保存后再读出的搜索与即席查询生成相同的 MongoDB 查询
+func TestSavedSearchCompileEquivalence(t *testing.T) {
+	printSeparator("保存的搜索查询生成测试")
+
+	var filter models.ResultFilter
+	if err := json.Unmarshal([]byte(prodAssetsFilter), &filter); err != nil {
+		t.Fatalf("解析条件失败: %v", err)
+	}
+	workspaceID := primitive.NewObjectID()
+	adhoc := service.BuildWorkspaceResultQuery(workspaceID, filter)
+
+	// 模拟保存到 MongoDB 后读出，数组值会变成 primitive.A
+	search := &models.SavedSearch{
+		Name:        "prod 大文件",
+		WorkspaceID: workspaceID,
+		ResultType:  models.ResultTypeDirScan,
+		Filter:      filter,
+		Sort:        models.ResultSort{Field: "size", Order: "desc"},
+	}
+	raw, err := bson.Marshal(search)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var stored models.SavedSearch
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	if _, ok := stored.Filter.Conditions[3].Value.(primitive.A); !ok {
+		t.Fatalf("读出的数组值应为 primitive.A: %T", stored.Filter.Conditions[3].Value)
+	}
+
+	query, sort, err := service.CompileSavedSearch(&stored)
+	if err != nil {
+		t.Fatalf("编译搜索失败: %v", err)
+	}
+	if !reflect.DeepEqual(query, adhoc) {
+		t.Errorf("保存的搜索与即席查询不一致:\n%v\n%v", query, adhoc)
+	}
+	if query["workspace_id"] != workspaceID {
+		t.Errorf("查询应限定在工作空间内: %v", query)
+	}
+	if and, ok := query["$and"].([]bson.M); !ok || len(and) != 1 {
+		t.Errorf("同一字段的多个后缀排除条件应放入 $and: %v", query)
+	}
+	if len(sort) == 0 || sort[0].Key != "data.size" || sort[0].Value != -1 {
+		t.Errorf("排序不正确: %v", sort)
+	}
+
+	// 内存匹配与查询语义一致
+	results := []struct {
+		data  bson.M
+		tags  []string
+		match bool
+	}{
+		{bson.M{"url": "https://a/backup.zip", "size": 20480, "status": 200}, []string{"prod"}, true},
+		{bson.M{"url": "https://a/app.JS", "size": 20480, "status": 200}, []string{"prod"}, false},
+		{bson.M{"url": "https://a/site.css", "size": 20480, "status": 403}, []string{"prod"}, false},
+		{bson.M{"url": "https://a/backup.zip", "size": 100, "status": 200}, []string{"prod"}, false},
+		{bson.M{"url": "https://a/backup.zip", "size": 20480, "status": 404}, []string{"prod"}, false},
+		{bson.M{"url": "https://a/backup.zip", "size": 20480, "status": 200}, []string{"dev"}, false},
+	}
+	for _, r := range results {
+		result := &models.ScanResult{Type: models.ResultTypeDirScan, Data: r.data, Tags: r.tags}
+		if got := service.MatchResult(result, stored.Filter); got != r.match {
+			t.Errorf("内存匹配结果不正确 %v %v: %v", r.data, r.tags, got)
+		}
+	}
+}
+
+// TestSavedSearchFieldWhitelist 保存时只允许引用白名单中的字段
+func TestSavedSearchFieldWhitelist(t *testing.T) {
+	printSeparator("保存的搜索字段白名单测试")
+
+	valid := models.ResultFilter{Conditions: []models.ResultCondition{{Field: "status_code", Op: "eq", Value: 200}}}
+	if err := service.ValidateSavedSearch(&models.SavedSearch{Name: "ok", ResultType: models.ResultTypeSubdomain, Filter: valid}); err != nil {
+		t.Errorf("合法的搜索不应报错: %v", err)
+	}
+
+	cases := map[string]*models.SavedSearch{
+		"未知字段": {Name: "x", ResultType: models.ResultTypeSubdomain,
+			Filter: models.ResultFilter{Conditions: []models.ResultCondition{{Field: "password", Op: "eq", Value: "x"}}}},
+		"运算符注入": {Name: "x", ResultType: models.ResultTypeSubdomain,
+			Filter: models.ResultFilter{Conditions: []models.ResultCondition{{Field: "$where", Op: "eq", Value: "1"}}}},
+		"其他类型的字段": {Name: "x", ResultType: models.ResultTypePort,
+			Filter: models.ResultFilter{Conditions: []models.ResultCondition{{Field: "subdomain", Op: "eq", Value: "a"}}}},
+		"排序字段": {Name: "x", ResultType: models.ResultTypeSubdomain, Filter: valid,
+			Sort: models.ResultSort{Field: "secret"}},
+		"类型不一致": {Name: "x", ResultType: models.ResultTypePort,
+			Filter: models.ResultFilter{Type: models.ResultTypeSubdomain}},
+		"名称为空": {ResultType: models.ResultTypeSubdomain, Filter: valid},
+	}
+	for name, search := range cases {
+		if err := service.ValidateSavedSearch(search); err == nil {
+			t.Errorf("%s 应校验失败", name)
+		}
+	}
+}
+
+// TestSavedSearchVisibility 共享搜索工作空间内可见，私有搜索仅创建者可见，工作空间权限与结果查询一致
+func TestSavedSearchVisibility(t *testing.T) {
+	printSeparator("保存的搜索可见性测试")
+
+	owner, member, outsider := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	workspace := &models.Workspace{ID: primitive.NewObjectID(), OwnerID: owner, Members: []primitive.ObjectID{member}}
+
+	private := &models.SavedSearch{WorkspaceID: workspace.ID, OwnerID: owner}
+	shared := &models.SavedSearch{WorkspaceID: workspace.ID, OwnerID: owner, Shared: true}
+
+	if !service.CanViewSavedSearch(private, owner) || service.CanViewSavedSearch(private, member) {
+		t.Errorf("私有搜索只对创建者可见")
+	}
+	if !service.CanViewSavedSearch(shared, member) {
+		t.Errorf("共享搜索应对工作空间成员可见")
+	}
+	if service.CanViewSavedSearch(private, primitive.NilObjectID) {
+		t.Errorf("未登录用户不应看到私有搜索")
+	}
+	if service.CanEditSavedSearch(shared, member, "user") || !service.CanEditSavedSearch(shared, owner, "user") || !service.CanEditSavedSearch(shared, member, "admin") {
+		t.Errorf("只有创建者和管理员可以修改搜索")
+	}
+
+	// 执行搜索与即席查询使用同一个工作空间权限判断
+	if !service.CanAccessWorkspace(workspace, owner, "user") || !service.CanAccessWorkspace(workspace, member, "viewer") {
+		t.Errorf("所有者和成员应可访问工作空间")
+	}
+	if service.CanAccessWorkspace(workspace, outsider, "user") {
+		t.Errorf("非成员不应访问工作空间，即使搜索是共享的")
+	}
+	if !service.CanAccessWorkspace(workspace, outsider, "admin") {
+		t.Errorf("管理员应可访问工作空间")
+	}
+
+	query := service.SavedSearchVisibilityQuery(workspace.ID, member)
+	or, ok := query["$or"].([]bson.M)
+	if query["workspace_id"] != workspace.ID || !ok || len(or) != 2 || or[0]["shared"] != true || or[1]["owner_id"] != member {
+		t.Errorf("列表查询应限定工作空间并只返回共享或自己的搜索: %v", query)
+	}
+}
@@ -0,0 +1,226 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 认证扫描自定义请求头测试 ==========
+
+// sessionServer 只有带有效会话 Cookie 时返回后台页面，记录每个路径收到的请求头
+type sessionServer struct {
+	mu      sync.Mutex
+	headers map[string]http.Header
+}
+
+func newSessionServer(t *testing.T, checkSession bool) (*httptest.Server, *sessionServer) {
+	t.Helper()
+	s := &sessionServer{headers: make(map[string]http.Header)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.headers[r.URL.Path] = r.Header.Clone()
+		s.mu.Unlock()
+		if r.URL.Path == "/favicon.ico" {
+			w.Write([]byte("icon"))
+			return
+		}
+		if !checkSession || r.Header.Get("Cookie") == "session=valid" {
+			w.Write([]byte(`<html><head><link rel="icon" href="/favicon.ico"><title>Admin</title></head><body>dashboard of the admin console</body></html>`))
+			return
+		}
+		w.Write([]byte(`<html><title>Login</title></html>`))
+	}))
+	t.Cleanup(server.Close)
+	return server, s
+}
+
+func (s *sessionServer) header(path string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[path]
+}
+
+// TestFingerprintScannerCustomHeaders 指纹识别的页面和 favicon 请求带上自定义请求头和 Cookie
+func TestFingerprintScannerCustomHeaders(t *testing.T) {
+	printSeparator("指纹识别自定义请求头测试")
+
+	server, recorded := newSessionServer(t, true)
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.SetHeaders(core.NewScanHeaders(map[string]string{
+		"Authorization": "Bearer tok-1",
+		"User-Agent":    "moongazing-auth",
+	}, "session=valid"))
+
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+	if result.Title != "Admin" {
+		t.Errorf("应以登录后的页面识别: %q", result.Title)
+	}
+	for _, path := range []string{"/", "/favicon.ico"} {
+		h := recorded.header(path)
+		if h == nil {
+			t.Fatalf("%s 未被请求", path)
+		}
+		if h.Get("Authorization") != "Bearer tok-1" || h.Get("Cookie") != "session=valid" {
+			t.Errorf("%s 未带认证请求头: %v", path, h)
+		}
+		if h.Get("User-Agent") != "moongazing-auth" {
+			t.Errorf("%s 自定义请求头应覆盖默认值: %s", path, h.Get("User-Agent"))
+		}
+	}
+}
+
+// writeHeaderKatana 模拟支持 -H 的 katana，把收到的参数写入 args.txt
+func writeHeaderKatana(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "katana")
+	script := `#!/bin/sh
+if [ "$1" = "-h" ]; then echo '   -H, -headers string[]  custom header/cookie to include in all http request'; exit 0; fi
+if [ "$1" = "-version" ]; then echo 'katana v1.1.0'; exit 0; fi
+for arg in "$@"; do echo "$arg"; done > "` + filepath.Join(dir, "args.txt") + `"
+exit 0
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake katana: %v", err)
+	}
+	return path
+}
+
+// TestKatanaHeaderArgs katana 的命令行带上 -H 请求头，调用记录中的认证请求头已脱敏
+func TestKatanaHeaderArgs(t *testing.T) {
+	printSeparator("katana 请求头参数测试")
+
+	dir := t.TempDir()
+	katana := webscan.NewKatanaScanner()
+	katana.BinPath = writeHeaderKatana(t, dir)
+	katana.TempDir = dir
+	headers := core.NewScanHeaders(map[string]string{"authorization": "Bearer tok-2", "X-Tenant": "acme"}, "session=valid")
+	if unsupported := katana.SetHeaders(headers); unsupported {
+		t.Fatal("支持 -H 的 katana 不应返回不支持")
+	}
+
+	task := &models.Task{ID: primitive.NewObjectID()}
+	store := &memoryToolRunStore{}
+	ctx := core.WithToolRecorder(context.Background(), service.NewToolRunRecorder(task, store))
+	if _, err := katana.Crawl(ctx, "https://app.example.com"); err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+
+	argv, err := os.ReadFile(filepath.Join(dir, "args.txt"))
+	if err != nil {
+		t.Fatalf("读取参数失败: %v", err)
+	}
+	for _, want := range []string{"-H\nAuthorization: Bearer tok-2\n", "-H\nX-Tenant: acme\n", "-H\nCookie: session=valid\n"} {
+		if !strings.Contains(string(argv), want) {
+			t.Errorf("katana 参数缺少 %q:\n%s", want, argv)
+		}
+	}
+
+	recorded := strings.Join(store.runs[0].Args, "\n")
+	if strings.Contains(recorded, "tok-2") || strings.Contains(recorded, "session=valid") {
+		t.Errorf("调用记录中的认证请求头应脱敏: %v", store.runs[0].Args)
+	}
+	if !strings.Contains(recorded, "Authorization: ***") || !strings.Contains(recorded, "X-Tenant: acme") {
+		t.Errorf("调用记录应保留请求头名称和非敏感值: %v", store.runs[0].Args)
+	}
+
+	// 不支持 -H 的版本不传参数
+	old := webscan.NewKatanaScanner()
+	old.BinPath = writeFakeTool(t, t.TempDir(), "v0.0.1")
+	if !old.SetHeaders(headers) || len(old.Headers) != 0 {
+		t.Error("不支持 -H 的 katana 应返回不支持")
+	}
+}
+
+// TestAuthPreflight 带和不带请求头的响应不同时会话有效，相同时判定会话可能失效
+func TestAuthPreflight(t *testing.T) {
+	printSeparator("认证预检测试")
+
+	checked, _ := newSessionServer(t, true)
+	headers := core.NewScanHeaders(nil, "session=valid")
+	result, err := core.RunAuthPreflight(context.Background(), http.DefaultClient, checked.URL, headers)
+	if err != nil {
+		t.Fatalf("预检失败: %v", err)
+	}
+	if !result.Differs || result.SessionFailed || result.AuthLength <= result.AnonLength {
+		t.Errorf("有效会话应与匿名响应不同: %+v", result)
+	}
+
+	result, err = core.RunAuthPreflight(context.Background(), http.DefaultClient, checked.URL, core.NewScanHeaders(nil, "session=expired"))
+	if err != nil {
+		t.Fatalf("预检失败: %v", err)
+	}
+	if result.Differs || !result.SessionFailed {
+		t.Errorf("失效会话应判定为失效: %+v", result)
+	}
+
+	if err := core.ValidateScanHeaders(map[string]string{"X-Bad\r\nInjected": "v"}, ""); err == nil {
+		t.Error("非法的请求头名称应校验失败")
+	}
+	if err := core.ValidateScanHeaders(map[string]string{"X-Ok": "a\nb"}, ""); err == nil {
+		t.Error("请求头值包含换行应校验失败")
+	}
+}
+
+// TestPipelineAuthPreflightEvent 会话失效时流水线记录预检警告事件
+func TestPipelineAuthPreflightEvent(t *testing.T) {
+	printSeparator("流水线认证预检事件测试")
+
+	server, recorded := newSessionServer(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:   true,
+		CustomHeaders: map[string]string{"X-Api-Key": "ak-3"},
+		CookieJar:     "session=expired",
+	}
+	var mu sync.Mutex
+	var events []pipeline.Event
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, 1, nil)
+	pipe.SetEventHandler(func(e pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == pipeline.EventAuthPreflight {
+			events = append(events, e)
+		}
+	})
+	if err := pipe.Start([]string{server.URL}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	pipe.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Level != pipeline.EventLevelWarn || events[0].Data["session_failed"] != true {
+		t.Fatalf("会话失效应记录一次预检警告: %+v", events)
+	}
+	if h := recorded.header("/"); h == nil {
+		t.Error("预检应请求目标")
+	}
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/portscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务级并发和速率设置测试 ==========
+
+// recordedArg 返回工具调用中某个参数的值
+func recordedArg(runs []*models.ToolRun, tool, flag string) []string {
+	var values []string
+	for _, run := range runs {
+		if run.Tool != tool {
+			continue
+		}
+		for i := 0; i+1 < len(run.Args); i++ {
+			if run.Args[i] == flag {
+				values = append(values, run.Args[i+1])
+			}
+		}
+	}
+	return values
+}
+
+// runWithToolRecorder 在带工具调用记录的上下文中运行模块
+func runWithToolRecorder(t *testing.T, run func(ctx context.Context)) []*models.ToolRun {
+	t.Helper()
+	store := &memoryToolRunStore{}
+	task := &models.Task{ID: primitive.NewObjectID()}
+	ctx, cancel := context.WithTimeout(core.WithToolRecorder(context.Background(), service.NewToolRunRecorder(task, store)), 30*time.Second)
+	defer cancel()
+	run(ctx)
+	return store.runs
+}
+
+// TestPortScanThreadsPerTask 两个任务使用不同的 gogo 线程数，不修改全局扫描器
+func TestPortScanThreadsPerTask(t *testing.T) {
+	printSeparator("端口扫描线程数测试")
+
+	bin := writeFakeTool(t, t.TempDir(), "gogo-threads-test")
+	global := portscan.GetGoGoScanner().Threads
+
+	for _, threads := range []int{50, 2000} {
+		runs := runWithToolRecorder(t, func(ctx context.Context) {
+			module := pipeline.NewPortScanModule(ctx, nil, "80", "custom")
+			module.SetGoGoScanner(portscan.NewGoGoScannerWithPath(bin))
+			module.SetThreads(threads)
+			input := make(chan interface{}, 1)
+			input <- "10.0.0.1"
+			close(input)
+			module.SetInput(input)
+			module.ModuleRun()
+		})
+		if got := recordedArg(runs, "gogo", "-t"); len(got) != 1 || got[0] != strconv.Itoa(threads) {
+			t.Errorf("gogo 应使用 -t %d, 实际 %v", threads, got)
+		}
+	}
+	if portscan.GetGoGoScanner().Threads != global {
+		t.Errorf("全局 gogo 扫描器的线程数不应被任务修改: %d -> %d", global, portscan.GetGoGoScanner().Threads)
+	}
+}
+
+// TestDirScanRateLimitPerTask 两个任务使用不同的 spray 速率和线程数，0 保持默认值
+func TestDirScanRateLimitPerTask(t *testing.T) {
+	printSeparator("目录扫描速率测试")
+
+	cases := []struct {
+		concurrency, rateLimit int
+		wantThreads, wantRate  string
+	}{
+		{5, 10, "5", "10"},
+		{100, 500, "100", "500"},
+		{0, 0, "50", ""}, // 保持扫描器原有的设置
+	}
+	for _, c := range cases {
+		runs := runWithToolRecorder(t, func(ctx context.Context) {
+			out := make(chan interface{}, 10)
+			collector := pipeline.NewResultCollectorModule(ctx, out)
+			collector.SetInput(make(chan interface{}, 10))
+			module := pipeline.NewDirScanModule(ctx, collector, 20, nil)
+			module.SetSprayScanner(writeFakeSpray(t, "exit 0\n"))
+			module.SetRateLimit(c.concurrency, c.rateLimit)
+			input := make(chan interface{}, 1)
+			input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test"}
+			close(input)
+			module.SetInput(input)
+			module.ModuleRun()
+		})
+		if got := recordedArg(runs, "spray", "-t"); len(got) != 1 || got[0] != c.wantThreads {
+			t.Errorf("spray 应使用 -t %s, 实际 %v", c.wantThreads, got)
+		}
+		got := strings.Join(recordedArg(runs, "spray", "--rate-limit"), ",")
+		if got != c.wantRate {
+			t.Errorf("spray --rate-limit 应为 %q, 实际 %q", c.wantRate, got)
+		}
+	}
+}
+
+// TestScanLimitsClamped 超出范围的设置在流水线启动时限制到边界，0 保持默认值
+func TestScanLimitsClamped(t *testing.T) {
+	printSeparator("并发设置范围测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:        true,
+		RateLimit:          99999,
+		PortScanThreads:    -5,
+		HTTPConcurrency:    40,
+		CrawlerConcurrency: 0,
+	}
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, config)
+	if err := pipe.Start([]string{"a.example.com"}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	for range pipe.Results() {
+	}
+
+	if config.RateLimit != pipeline.MaxScanRateLimit || config.PortScanThreads != 1 ||
+		config.HTTPConcurrency != 40 || config.CrawlerConcurrency != 0 {
+		t.Errorf("设置应限制到允许范围: %+v", config)
+	}
+}
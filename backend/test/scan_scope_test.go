@@ -0,0 +1,343 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 扫描范围测试 ==========
+
+// TestScopeFilterPatterns 包含规则（根域名、网段）与排除规则，排除优先
+func TestScopeFilterPatterns(t *testing.T) {
+	printSeparator("扫描范围规则测试")
+
+	scope, err := core.NewScopeFilter(
+		[]string{"example.com", "*.corp.test", "10.0.0.0/24"},
+		[]string{"*.prod.example.com", "10.0.0.128/25"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create scope filter: %v", err)
+	}
+
+	for target, want := range map[string]bool{
+		"example.com":                   true,
+		"www.example.com":               true,
+		"https://a.b.example.com:8443/": true,
+		"badexample.com":                false,
+		"example.com.evil.com":          false,
+		"vpn.corp.test":                 true,
+		"corp.test":                     true,
+		"pay.prod.example.com":          false, // 包含且排除，排除优先
+		"a.b.prod.example.com":          false,
+		"prod.example.com":              true,
+		"10.0.0.9":                      true,
+		"http://10.0.0.127:8080/x":      true,
+		"10.0.0.200":                    false, // 网段包含且排除
+		"10.0.1.1":                      false,
+		"other.com":                     false,
+	} {
+		if got := scope.InScope(target); got != want {
+			t.Errorf("%s: 期望 %v, 实际 %v", target, want, got)
+		}
+	}
+
+	if rule, ok := scope.Check("pay.prod.example.com"); ok || rule != "*.prod.example.com" {
+		t.Errorf("被排除的目标应返回命中的排除规则: %q %v", rule, ok)
+	}
+	if rule, ok := scope.Check("other.com"); ok || rule != core.ScopeNotIncluded {
+		t.Errorf("不在包含规则内的目标应返回 %s: %q %v", core.ScopeNotIncluded, rule, ok)
+	}
+
+	// 只有排除规则时其余目标都在范围内
+	onlyExclude, _ := core.NewScopeFilter(nil, []string{"*.prod.example.com", "10.0.0.0/24"})
+	if !onlyExclude.InScope("anything.org") || onlyExclude.InScope("10.0.0.5") || onlyExclude.InScope("db.prod.example.com") {
+		t.Errorf("只有排除规则时只拦截被排除的目标")
+	}
+
+	var nilScope *core.ScopeFilter
+	if !nilScope.InScope("anything.org") || !nilScope.Empty() {
+		t.Errorf("未配置范围时不限制目标")
+	}
+}
+
+// TestScopeIncludeValidation 非法的包含规则被拒绝
+func TestScopeIncludeValidation(t *testing.T) {
+	printSeparator("扫描范围包含规则校验测试")
+
+	for _, p := range []string{"localhost", "regex:^a", "10.0.0.0/33", "*.*.example.com", "exa mple.com"} {
+		if err := core.ValidateScopeIncludes([]string{p}); err == nil {
+			t.Errorf("%q 应校验失败", p)
+		}
+	}
+	if err := core.ValidateScopeIncludes([]string{"example.com", "*.example.org", " ", "10.0.0.1", "192.168.0.0/16"}); err != nil {
+		t.Errorf("合法规则不应校验失败: %v", err)
+	}
+	if _, err := core.NewScopeFilter([]string{"example.com"}, []string{"regex:(("}); err == nil {
+		t.Errorf("非法排除规则应导致创建失败")
+	}
+}
+
+// TestScopeDefaultToTargets 未配置包含规则时以任务目标作为爬虫跨站范围
+func TestScopeDefaultToTargets(t *testing.T) {
+	printSeparator("扫描范围默认任务目标测试")
+
+	base, _ := core.NewScopeFilter(nil, []string{"*.prod.example.com"})
+	scope := base.DefaultToTargets([]string{"https://example.com/login", "10.0.0.0/24, a.test"})
+
+	for target, want := range map[string]bool{
+		"api.example.com":      true,
+		"pay.prod.example.com": false,
+		"10.0.0.3":             true,
+		"b.a.test":             true,
+		"accounts.google.com":  false,
+	} {
+		if got := scope.InScope(target); got != want {
+			t.Errorf("%s: 期望 %v, 实际 %v", target, want, got)
+		}
+	}
+
+	// 显式配置了包含规则时保持不变
+	explicit, _ := core.NewScopeFilter([]string{"example.org"}, nil)
+	if explicit.DefaultToTargets([]string{"example.com"}).InScope("www.example.com") {
+		t.Errorf("已配置包含规则时不应使用任务目标")
+	}
+}
+
+// TestResolveScanScope 任务包含规则覆盖工作空间，排除规则合并
+func TestResolveScanScope(t *testing.T) {
+	printSeparator("扫描范围合并测试")
+
+	workspace := &models.WorkspaceScope{
+		Include: []string{"example.com"},
+		Exclude: []string{"*.prod.example.com", "10.0.0.0/24"},
+	}
+
+	includes, excludes := service.ResolveScanScope(&models.TaskConfig{}, workspace)
+	if strings.Join(includes, ",") != "example.com" || len(excludes) != 2 {
+		t.Errorf("任务未配置时使用工作空间范围: %v %v", includes, excludes)
+	}
+
+	includes, excludes = service.ResolveScanScope(&models.TaskConfig{
+		ScopeInclude: []string{"example.org"},
+		ExcludeList:  []string{"10.0.0.0/24", "legacy.example.org"},
+	}, workspace)
+	if strings.Join(includes, ",") != "example.org" {
+		t.Errorf("任务包含规则应覆盖工作空间: %v", includes)
+	}
+	if strings.Join(excludes, ",") != "*.prod.example.com,10.0.0.0/24,legacy.example.org" {
+		t.Errorf("排除规则应去重合并: %v", excludes)
+	}
+
+	includes, excludes = service.ResolveScanScope(&models.TaskConfig{ExcludeList: []string{"a.example.com"}}, nil)
+	if len(includes) != 0 || strings.Join(excludes, ",") != "a.example.com" {
+		t.Errorf("没有工作空间范围时只使用任务配置: %v %v", includes, excludes)
+	}
+
+	if err := service.ValidateTaskScope(&models.TaskConfig{ScopeInclude: []string{"localhost"}}); err == nil {
+		t.Errorf("非法的任务包含规则应校验失败")
+	}
+}
+
+// TestScopePipelineGate 超出范围的目标在模块入口丢弃，计数并记录任务事件
+func TestScopePipelineGate(t *testing.T) {
+	printSeparator("流水线扫描范围拦截测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:     true,
+		ScopeIncludes:   []string{"example.com", "10.0.0.0/24"},
+		ExcludePatterns: []string{"*.prod.example.com", "10.0.0.128/25"},
+	}
+	targets := []string{
+		"www.example.com",
+		"pay.prod.example.com",
+		"other.com",
+		"10.0.0.9",
+		"10.0.0.200",
+		"10.0.1.1",
+	}
+
+	var mu sync.Mutex
+	var events []pipeline.Event
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, config)
+	pipe.SetEventHandler(func(e pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	if err := pipe.Start(targets); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	var results []string
+	for r := range pipe.Results() {
+		if s, ok := r.(string); ok {
+			results = append(results, s)
+		}
+	}
+	if err := pipe.Err(); err != nil {
+		t.Fatalf("流水线异常: %v", err)
+	}
+
+	joined := strings.Join(results, ",")
+	if len(results) != 2 || !contains(joined, "www.example.com") || !contains(joined, "10.0.0.9") {
+		t.Errorf("期望仅保留 www.example.com 和 10.0.0.9, 实际 %v", results)
+	}
+	if n := pipe.Suppression().Count("Fingerprint", pipeline.SuppressOutOfScope); n != 4 {
+		t.Errorf("期望丢弃 4 个超出范围的目标, 实际 %d", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var scopeEvents []pipeline.Event
+	for _, e := range events {
+		if e.Type == pipeline.EventOutOfScope {
+			scopeEvents = append(scopeEvents, e)
+		}
+	}
+	if len(scopeEvents) != 1 || scopeEvents[0].Module != "Fingerprint" ||
+		scopeEvents[0].Message != "丢弃 4 个超出扫描范围的目标" || fmt.Sprint(scopeEvents[0].Data["dropped"]) != "4" {
+		t.Errorf("期望记录一条超出范围事件, 实际 %+v", scopeEvents)
+	}
+	fmt.Printf("保留目标: %v\n", results)
+
+	// 非法包含规则导致流水线启动失败
+	bad := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{
+		Fingerprint:   true,
+		ScopeIncludes: []string{"localhost"},
+	})
+	if err := bad.Start([]string{"www.example.com"}); err == nil {
+		t.Errorf("非法包含规则应导致启动失败")
+	}
+}
+
+// writeFakeKatana 模拟 katana：把固定的 URL 写入 -o 指定的输出文件
+func writeFakeKatana(t *testing.T, urls []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "katana")
+	script := "#!/bin/sh\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = \"-o\" ]; then out=\"$2\"; fi\n  shift\ndone\ncat > \"$out\" <<'EOF'\n" +
+		strings.Join(urls, "\n") + "\nEOF\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake katana: %v", err)
+	}
+	return path
+}
+
+// TestScopeCrawlerCrossOrigin 爬虫发现的跨站 URL 超出范围时丢弃，同站 URL 不受影响
+func TestScopeCrawlerCrossOrigin(t *testing.T) {
+	printSeparator("爬虫跨站 URL 范围测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	output := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, output)
+	collector.SetInput(make(chan interface{}, 100))
+	module := pipeline.NewCrawlerModule(ctx, collector, 1, true, false)
+	module.SetBatchMode(false, 0)
+
+	katana := webscan.NewKatanaScanner()
+	katana.BinPath = writeFakeKatana(t, []string{
+		"https://www.example.com/login",
+		"https://api.example.com/v1/users",
+		"https://accounts.google.com/o/oauth2/auth",
+		"https://pay.prod.example.com/checkout",
+	})
+	katana.TempDir = t.TempDir()
+	module.SetKatanaScanner(katana)
+
+	stats := pipeline.NewSuppressionStats(0)
+	module.SetSuppressionStats(stats)
+	base, _ := core.NewScopeFilter(nil, []string{"*.prod.example.com"})
+	module.SetCrossOriginScope(base.DefaultToTargets([]string{"example.com"}))
+
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- pipeline.AssetHttp{URL: "https://www.example.com", Host: "www.example.com"}
+	close(input)
+
+	done := make(chan error, 1)
+	go func() { done <- module.ModuleRun() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("爬虫模块异常: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatalf("爬虫模块未结束")
+	}
+	close(output)
+
+	var urls []string
+	for r := range output {
+		if u, ok := r.(pipeline.UrlResult); ok {
+			urls = append(urls, u.Output)
+		}
+	}
+	joined := strings.Join(urls, ",")
+	if len(urls) != 2 || !contains(joined, "www.example.com/login") || !contains(joined, "api.example.com/v1/users") {
+		t.Errorf("期望仅保留任务目标下的 URL, 实际 %v", urls)
+	}
+	if n := stats.Count("Crawler", pipeline.SuppressOutOfScope); n != 2 {
+		t.Errorf("期望丢弃 2 个跨站 URL, 实际 %d", n)
+	}
+}
+
+// TestScopePortPreparation 解析到排除网段的域名跳过端口扫描
+func TestScopePortPreparation(t *testing.T) {
+	printSeparator("端口扫描目标范围测试")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	output := make(chan interface{}, 10)
+	next := pipeline.NewResultCollectorModule(ctx, output)
+	next.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewPortScanPreparationModule(ctx, next)
+
+	scope, _ := core.NewScopeFilter(nil, []string{"10.0.0.128/25"})
+	module.SetScope(scope)
+	stats := pipeline.NewSuppressionStats(0)
+	module.SetSuppressionStats(stats)
+
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- pipeline.DomainResolve{Domain: "db.example.com", IP: []string{"10.0.0.9", "10.0.0.200"}}
+	close(input)
+
+	done := make(chan error, 1)
+	go func() { done <- module.ModuleRun() }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("端口扫描准备模块未结束")
+	}
+
+	var skips []pipeline.DomainSkip
+	close(output)
+	for r := range output {
+		if s, ok := r.(pipeline.DomainSkip); ok {
+			skips = append(skips, s)
+		}
+	}
+	if len(skips) != 1 || !skips[0].Skip || skips[0].Reason != pipeline.SuppressOutOfScope {
+		t.Errorf("解析到排除网段的域名应跳过端口扫描: %+v", skips)
+	}
+	if n := stats.Count("PortScanPreparation", pipeline.SuppressOutOfScope); n != 1 {
+		t.Errorf("期望记录 1 个超出范围的目标, 实际 %d", n)
+	}
+}
@@ -0,0 +1,304 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 页面截图测试 ==========
+
+// writeFakeChrome 写入模拟浏览器：把 URL 写入 --screenshot 指定的文件；
+// URL 含 fail 时出错退出，含 slow 时长时间不退出；运行期间在 dir/running 下留一个标记，用于统计并发数
+func writeFakeChrome(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "chrome")
+	running := filepath.Join(dir, "running")
+	script := `#!/bin/sh
+out=""; url=""
+for arg in "$@"; do
+  case "$arg" in
+    --screenshot=*) out="${arg#--screenshot=}" ;;
+    --*) ;;
+    *) url="$arg" ;;
+  esac
+done
+mkdir -p ` + running + `
+touch ` + running + `/$$
+ls ` + running + ` | wc -l >> ` + filepath.Join(dir, "concurrency") + `
+case "$url" in
+  *fail*) rm -f ` + running + `/$$; echo "net::ERR_CONNECTION_REFUSED" >&2; exit 1 ;;
+  *slow*) rm -f ` + running + `/$$; exec sleep 10 ;;
+esac
+sleep 0.2
+printf 'PNG %s' "$url" > "$out"
+rm -f ` + running + `/$$
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake chrome: %v", err)
+	}
+	return path
+}
+
+// maxConcurrency 模拟浏览器记录的最大同时运行数
+func maxConcurrency(t *testing.T, dir string) int {
+	t.Helper()
+	data, _ := os.ReadFile(filepath.Join(dir, "concurrency"))
+	max := 0
+	for _, line := range strings.Fields(string(data)) {
+		if n, _ := strconv.Atoi(line); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// TestShouldScreenshot 状态码为 0 或内容类型明确不是页面时跳过，文件名只包含安全字符
+func TestShouldScreenshot(t *testing.T) {
+	printSeparator("截图过滤测试")
+
+	cases := []struct {
+		asset pipeline.AssetHttp
+		want  bool
+	}{
+		{pipeline.AssetHttp{URL: "http://a.example.com", StatusCode: 200, ContentType: "text/html; charset=utf-8"}, true},
+		{pipeline.AssetHttp{URL: "http://a.example.com", StatusCode: 403}, true},
+		{pipeline.AssetHttp{URL: "http://a.example.com", StatusCode: 200, ContentType: "application/xhtml+xml"}, true},
+		{pipeline.AssetHttp{URL: "http://a.example.com", StatusCode: 0, ContentType: "text/html"}, false},
+		{pipeline.AssetHttp{URL: "http://a.example.com/logo", StatusCode: 200, ContentType: "image/png"}, false},
+		{pipeline.AssetHttp{URL: "http://a.example.com/api", StatusCode: 200, ContentType: "Application/JSON"}, false},
+		{pipeline.AssetHttp{URL: "http://a.example.com/f", StatusCode: 200, ContentType: "application/octet-stream"}, false},
+	}
+	for _, c := range cases {
+		if got := pipeline.ShouldScreenshot(c.asset); got != c.want {
+			t.Errorf("ShouldScreenshot(%d %q) = %v, want %v", c.asset.StatusCode, c.asset.ContentType, got, c.want)
+		}
+	}
+
+	a := pipeline.ScreenshotFileName("https://a.example.com:8443/../../etc/passwd?x=1")
+	b := pipeline.ScreenshotFileName("https://a.example.com:8443/login")
+	if a == b || !strings.HasPrefix(a, "a.example.com_8443_") || strings.ContainsAny(a, "/\\?") || filepath.Ext(a) != ".png" {
+		t.Errorf("截图文件名不符: %s %s", a, b)
+	}
+}
+
+// TestScreenshotModuleCapture 截图受并发上限约束，超时和出错记录到结果中，跳过的资产和重复 URL 不截图，所有输入原样传递
+func TestScreenshotModuleCapture(t *testing.T) {
+	printSeparator("截图模块测试")
+
+	toolDir := t.TempDir()
+	outDir := filepath.Join(t.TempDir(), "task")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 100))
+
+	module := pipeline.NewScreenshotModule(ctx, collector, outDir, 2)
+	module.SetCapturer(&webscan.ScreenshotCapturer{BinPath: writeFakeChrome(t, toolDir), Timeout: 30})
+	module.SetTimeout(1)
+
+	var inputs []interface{}
+	for i := 0; i < 5; i++ {
+		inputs = append(inputs, pipeline.AssetHttp{URL: "http://ok" + strconv.Itoa(i) + ".example.com", StatusCode: 200, ContentType: "text/html"})
+	}
+	inputs = append(inputs,
+		pipeline.AssetHttp{URL: "http://ok0.example.com", StatusCode: 200}, // 重复
+		pipeline.AssetHttp{URL: "http://fail.example.com", StatusCode: 200},
+		pipeline.AssetHttp{URL: "http://slow.example.com", StatusCode: 200},
+		pipeline.AssetHttp{URL: "http://down.example.com", StatusCode: 0},
+		pipeline.AssetHttp{URL: "http://img.example.com", StatusCode: 200, ContentType: "image/gif"},
+		"a.example.com",
+	)
+	input := make(chan interface{}, len(inputs))
+	for _, data := range inputs {
+		input <- data
+	}
+	close(input)
+	module.SetInput(input)
+
+	start := time.Now()
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("ModuleRun failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 8*time.Second {
+		t.Errorf("超时的页面应在单页超时后结束: %v", elapsed)
+	}
+
+	forwarded := 0
+	shots := map[string]pipeline.ScreenshotResult{}
+	for len(out) > 0 {
+		switch v := (<-out).(type) {
+		case pipeline.ScreenshotResult:
+			if _, dup := shots[v.URL]; dup {
+				t.Errorf("重复 URL 不应再次截图: %s", v.URL)
+			}
+			shots[v.URL] = v
+		default:
+			forwarded++
+		}
+	}
+	if forwarded != len(inputs) {
+		t.Errorf("所有输入都应传递给下一个模块: %d/%d", forwarded, len(inputs))
+	}
+	if len(shots) != 7 {
+		t.Errorf("期望 7 个截图结果, 实际 %d: %v", len(shots), shots)
+	}
+
+	for i := 0; i < 5; i++ {
+		shot := shots["http://ok"+strconv.Itoa(i)+".example.com"]
+		if shot.Error != "" || filepath.Dir(shot.Path) != outDir {
+			t.Errorf("截图应保存在任务目录中: %+v", shot)
+			continue
+		}
+		if data, err := os.ReadFile(shot.Path); err != nil || !strings.Contains(string(data), shot.URL) {
+			t.Errorf("截图文件内容不符: %s %v", data, err)
+		}
+	}
+	if shot := shots["http://fail.example.com"]; shot.Path != "" || !strings.Contains(shot.Error, "ERR_CONNECTION_REFUSED") {
+		t.Errorf("失败的截图应记录原因: %+v", shot)
+	}
+	if shot := shots["http://slow.example.com"]; shot.Path != "" || !strings.Contains(shot.Error, "timeout") {
+		t.Errorf("超时的截图应记录超时: %+v", shot)
+	}
+	if n := maxConcurrency(t, toolDir); n < 1 || n > 2 {
+		t.Errorf("同时截图数应不超过 2, 实际 %d", n)
+	}
+}
+
+// TestScreenshotModuleUnavailable 浏览器不可用时记录事件，数据照常传递
+func TestScreenshotModuleUnavailable(t *testing.T) {
+	printSeparator("截图工具不可用测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewScreenshotModule(ctx, collector, t.TempDir(), 0)
+	module.SetCapturer(&webscan.ScreenshotCapturer{BinPath: filepath.Join(t.TempDir(), "missing")})
+
+	recorder := pipeline.NewEventRecorder()
+	var events []pipeline.Event
+	recorder.SetHandler(func(e pipeline.Event) { events = append(events, e) })
+	module.SetEventRecorder(recorder)
+
+	input := make(chan interface{}, 2)
+	input <- pipeline.AssetHttp{URL: "http://a.example.com", StatusCode: 200}
+	input <- "a.example.com"
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	if len(out) != 2 {
+		t.Errorf("工具不可用时应只传递数据: %d", len(out))
+	}
+	if len(events) != 1 || events[0].Type != pipeline.EventToolUnavailable {
+		t.Errorf("应记录工具不可用事件: %+v", events)
+	}
+
+	report := service.CheckPipelineCapabilities(core.NewToolsManager(), &pipeline.PipelineConfig{Screenshot: true})
+	found := false
+	for _, m := range report.Modules {
+		found = found || m.Module == "screenshot"
+	}
+	if !found {
+		t.Errorf("能力检查应包含截图模块: %+v", report.Modules)
+	}
+}
+
+// TestScreenshotResultMerge 指纹识别再次写入 Web 服务时保留截图字段；截图成功清除之前的错误，失败保留已有截图
+func TestScreenshotResultMerge(t *testing.T) {
+	printSeparator("截图结果合并测试")
+
+	result := &models.ScanResult{
+		TaskID: primitive.NewObjectID(),
+		Type:   models.ResultTypeService,
+		Data: bson.M{
+			"url":              "http://a.example.com",
+			"title":            "Home",
+			"screenshot_path":  "",
+			"screenshot_error": "",
+		},
+	}
+	set := service.DedupUpdate(result)["$set"].(bson.M)
+	if set["data.title"] != "Home" {
+		t.Errorf("应更新其他字段: %v", set)
+	}
+	for _, key := range []string{"data.screenshot_path", "data.screenshot_error", "data"} {
+		if _, ok := set[key]; ok {
+			t.Errorf("Web 服务更新不应写入 %s: %v", key, set)
+		}
+	}
+	result.Data["screenshot_path"] = "data/screenshots/other/x.png"
+	if _, ok := service.DedupUpdate(result)["$set"].(bson.M)["data.screenshot_path"]; ok {
+		t.Error("截图路径只应由截图结果写入")
+	}
+
+	ok := service.ScreenshotUpdate("data/screenshots/t/a.png", "")
+	if ok["$set"].(bson.M)["data.screenshot_path"] != "data/screenshots/t/a.png" || ok["$unset"].(bson.M)["data.screenshot_error"] == nil {
+		t.Errorf("截图成功时应写入路径并清除错误: %v", ok)
+	}
+	failed := service.ScreenshotUpdate("", "screenshot timeout after 30s")
+	if _, ok := failed["$set"].(bson.M)["data.screenshot_path"]; ok || failed["$unset"] != nil {
+		t.Errorf("截图失败时不应改动已有截图: %v", failed)
+	}
+	if failed["$set"].(bson.M)["data.screenshot_error"] != "screenshot timeout after 30s" {
+		t.Errorf("截图失败时应记录原因: %v", failed)
+	}
+}
+
+// TestResolveTaskScreenshot 只允许读取任务截图目录中的 PNG 文件，路径穿越、其他任务的目录和指向目录外的符号链接都被拒绝
+func TestResolveTaskScreenshot(t *testing.T) {
+	printSeparator("截图路径校验测试")
+
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "task1")
+	otherDir := filepath.Join(root, "task2")
+	for _, dir := range []string{taskDir, otherDir} {
+		os.MkdirAll(dir, 0755)
+	}
+	own := filepath.Join(taskDir, "a.png")
+	other := filepath.Join(otherDir, "b.png")
+	secret := filepath.Join(root, "secret.png")
+	for _, f := range []string{own, other, secret} {
+		os.WriteFile(f, []byte("PNG"), 0644)
+	}
+	link := filepath.Join(taskDir, "link.png")
+	if err := os.Symlink(secret, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if path, err := service.ResolveTaskScreenshot(taskDir, own); err != nil || filepath.Base(path) != "a.png" {
+		t.Errorf("任务目录中的截图应可读取: %s %v", path, err)
+	}
+	for _, path := range []string{other, secret, taskDir + "/../task2/b.png", link, filepath.Join(taskDir, "a.txt"), taskDir} {
+		if _, err := service.ResolveTaskScreenshot(taskDir, path); !errors.Is(err, service.ErrInvalidScreenshotPath) {
+			t.Errorf("%s 应返回 ErrInvalidScreenshotPath: %v", path, err)
+		}
+	}
+	for _, path := range []string{"", filepath.Join(taskDir, "missing.png")} {
+		if _, err := service.ResolveTaskScreenshot(taskDir, path); !errors.Is(err, service.ErrScreenshotNotFound) {
+			t.Errorf("%q 应返回 ErrScreenshotNotFound: %v", path, err)
+		}
+	}
+	if dir := service.ScreenshotTaskDir("abc"); dir != filepath.Join(pipeline.DefaultScreenshotDir, "abc") {
+		t.Errorf("任务截图目录不符: %s", dir)
+	}
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 非 HTTP 服务 banner 规则测试 ==========
+// banner 和探测响应取自真实服务的抓包
+
+var (
+	recordedSSHBanner     = "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6\r\n"
+	recordedMySQLBanner   = "\x4a\x00\x00\x00\x0a8.0.36\x00\x08\x00\x00\x00\x3b\x5f\x2a\x10\x6e\x21\x4c\x01\x00\xff\xff\xff\x02\x00\xff\xdf\x15\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x4f\x1b\x3a\x6d\x07\x38\x36\x65\x2b\x57\x15\x29\x00caching_sha2_password\x00"
+	recordedMariaDBBanner = "\x5b\x00\x00\x00\x0a5.5.5-10.11.6-MariaDB-0+deb12u1\x00\x05\x00\x00\x00\x3c\x45\x29\x6e\x51\x2d\x7e\x46\x00\xfe\xf7\x2d\x02\x00\xff\x81\x15\x00\x00\x00\x00\x00\x00\x1d\x00\x00\x00\x2f\x76\x3a\x4e\x34\x31\x52\x6f\x62\x2e\x3f\x58\x00mysql_native_password\x00"
+	recordedRedisInfo     = "$1187\r\n# Server\r\nredis_version:7.2.4\r\nredis_git_sha1:00000000\r\nredis_git_dirty:0\r\nredis_mode:standalone\r\nos:Linux 6.1.0-18-amd64 x86_64\r\n"
+	recordedRDPConfirm    = "\x03\x00\x00\x13\x0e\xd0\x00\x00\x12\x34\x00\x02\x1f\x08\x00\x02\x00\x00\x00"
+)
+
+// loadBannerRules 加载仓库中的 service_banners.yaml
+func loadBannerRules(t *testing.T) *fingerprint.ServiceBannerRules {
+	t.Helper()
+	rules, err := fingerprint.LoadServiceBannerRules("../config/dicts/yaml/service_banners.yaml")
+	if err != nil {
+		t.Fatalf("加载 service_banners.yaml 失败: %v", err)
+	}
+	return rules
+}
+
+// probeListener 本地监听，不主动发送 banner，收到以 expect 开头的请求后写入 reply
+func probeListener(t *testing.T, expect []byte, reply string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				buf := make([]byte, 1024)
+				n, _ := conn.Read(buf)
+				if n > 0 && bytes.HasPrefix(buf[:n], expect) {
+					conn.Write([]byte(reply))
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestServiceBannerRules 规则文件识别 SSH、MySQL、Redis、RDP 的产品和版本
+func TestServiceBannerRules(t *testing.T) {
+	printSeparator("服务 banner 规则测试")
+
+	rules := loadBannerRules(t)
+	cases := []struct {
+		name, banner              string
+		service, product, version string
+	}{
+		{"ssh", recordedSSHBanner, "ssh", "OpenSSH", "8.9p1"},
+		{"dropbear", "SSH-2.0-dropbear_2022.83\r\n", "ssh", "Dropbear", "2022.83"},
+		{"mysql", recordedMySQLBanner, "mysql", "MySQL", "8.0.36"},
+		{"mariadb", recordedMariaDBBanner, "mysql", "MariaDB", "10.11.6"},
+		{"redis", recordedRedisInfo, "redis", "Redis", "7.2.4"},
+		{"redis-noauth", "-NOAUTH Authentication required.\r\n", "redis", "Redis", ""},
+		{"rdp", recordedRDPConfirm, "rdp", "Microsoft Terminal Services", ""},
+	}
+	for _, c := range cases {
+		service, product, version, ok := rules.Match(c.banner)
+		if !ok || service != c.service || product != c.product || version != c.version {
+			t.Errorf("%s: 期望 %s/%s/%s, 实际 %s/%s/%s (matched=%v)", c.name, c.service, c.product, c.version, service, product, version, ok)
+		}
+	}
+
+	if _, _, _, ok := rules.Match("SSH-2.0-libssh_0.9.6\r\n"); ok {
+		t.Error("没有对应规则的 banner 不应命中")
+	}
+	if rules.Probe(6379) == nil || rules.Probe(3389) == nil || rules.Probe(22) != nil {
+		t.Error("Redis 和 RDP 端口应有探测数据，SSH 端口没有")
+	}
+}
+
+// TestServiceBannerInvalidRules 无效的规则和探测数据跳过，其余规则正常加载
+func TestServiceBannerInvalidRules(t *testing.T) {
+	printSeparator("服务 banner 无效规则测试")
+
+	path := filepath.Join(t.TempDir(), "service_banners.yaml")
+	content := `rules:
+  - {name: bad-regex, service: x, match: regex, pattern: "([a-"}
+  - {name: bad-type, service: x, match: suffix, pattern: "abc"}
+  - {name: bad-hex, service: x, match: hex-prefix, pattern: "zz"}
+  - {name: no-service, match: prefix, pattern: "abc"}
+  - {name: telnet, service: telnet, match: hex-prefix, pattern: "ff fd"}
+probes:
+  - {name: bad, ports: [23], send_hex: "xyz"}
+  - {name: ok, ports: [24], send: "hello"}
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入规则文件失败: %v", err)
+	}
+	rules, err := fingerprint.LoadServiceBannerRules(path)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if rules.RulesCount() != 1 {
+		t.Errorf("应只加载 1 条有效规则, 实际 %d", rules.RulesCount())
+	}
+	if service, _, _, ok := rules.Match("\xff\xfd\x18"); !ok || service != "telnet" {
+		t.Errorf("hex-prefix 规则应命中: %s %v", service, ok)
+	}
+	if rules.Probe(23) != nil || string(rules.Probe(24)) != "hello" {
+		t.Error("无效的探测数据应跳过")
+	}
+}
+
+// TestScanPortFingerprintBannerRules 端口指纹使用规则文件识别，静默端口发送探测数据，未命中时回退到内置识别
+func TestScanPortFingerprintBannerRules(t *testing.T) {
+	printSeparator("端口指纹 banner 规则测试")
+
+	ctx := context.Background()
+	check := func(name string, fp *fingerprint.PortFingerprint, service, product, version string) {
+		t.Helper()
+		if fp.Service != service || fp.Product != product || fp.Version != version {
+			t.Errorf("%s: 期望 %s/%s/%s, 实际 %s/%s/%s", name, service, product, version, fp.Service, fp.Product, fp.Version)
+		}
+	}
+
+	ssh := newLocalPortScanner(bannerListener(t, recordedSSHBanner))
+	check("ssh", ssh.ScanPortFingerprint(ctx, "scan.example.test", 2222), "ssh", "OpenSSH", "8.9p1")
+
+	mysql := newLocalPortScanner(bannerListener(t, recordedMySQLBanner))
+	check("mysql", mysql.ScanPortFingerprint(ctx, "scan.example.test", 3306), "mysql", "MySQL", "8.0.36")
+
+	redis := newLocalPortScanner(probeListener(t, []byte("INFO server\r\n"), recordedRedisInfo))
+	check("redis", redis.ScanPortFingerprint(ctx, "scan.example.test", 6379), "redis", "Redis", "7.2.4")
+
+	rdp := newLocalPortScanner(probeListener(t, []byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xe0}, recordedRDPConfirm))
+	fp := rdp.ScanPortFingerprint(ctx, "scan.example.test", 3389)
+	check("rdp", fp, "rdp", "Microsoft Terminal Services", "")
+	if fp.SSL {
+		t.Error("探测得到响应的端口不应再尝试 TLS 握手")
+	}
+
+	// 规则文件未覆盖的 banner 使用内置识别
+	libssh := newLocalPortScanner(bannerListener(t, "SSH-2.0-libssh_0.9.6\r\n"))
+	check("libssh", libssh.ScanPortFingerprint(ctx, "scan.example.test", 2222), "ssh", "libssh_0.9.6", "")
+}
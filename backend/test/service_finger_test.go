@@ -0,0 +1,215 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 非 Web 服务 DSL 指纹测试 ==========
+
+// fortigateIssuer FortiGate 出厂证书的签发者
+const fortigateIssuer = "CN=support,OU=Certificate Authority,O=Fortinet,L=Sunnyvale,ST=California,C=US"
+
+// loadServiceFinger 加载仓库中的 service_finger.yaml
+func loadServiceFinger(t *testing.T) *fingerprint.DSLEngine {
+	t.Helper()
+	engine := fingerprint.NewDSLEngine()
+	if err := engine.LoadRulesFromFile("../config/dicts/yaml/service_finger.yaml"); err != nil {
+		t.Fatalf("加载 service_finger.yaml 失败: %v", err)
+	}
+	if report := engine.ValidationReport(); report.HasErrors() {
+		t.Fatalf("service_finger.yaml 有无效规则: %+v", report.Errors)
+	}
+	return engine
+}
+
+// serviceMatches 按规则名索引匹配结果
+func serviceMatches(engine *fingerprint.DSLEngine, resp *fingerprint.ServiceResponse) map[string]*fingerprint.FingerprintMatch {
+	matches := make(map[string]*fingerprint.FingerprintMatch)
+	for _, m := range engine.AnalyzeService(resp) {
+		matches[m.RuleName] = m
+	}
+	return matches
+}
+
+// TestServiceFingerRules 规则文件按 MySQL 握手包识别数据库，按出厂证书的签发者识别 FortiGate
+func TestServiceFingerRules(t *testing.T) {
+	printSeparator("服务指纹规则测试")
+
+	engine := loadServiceFinger(t)
+
+	mysql := serviceMatches(engine, &fingerprint.ServiceResponse{Host: "db.example.test", Port: 3306, Banner: recordedMySQLBanner, Protocol: "mysql"})
+	m := mysql["mysql"]
+	if m == nil || len(mysql) != 1 {
+		t.Fatalf("MySQL banner 应只命中 mysql 规则: %v", mysql)
+	}
+	if m.Version != "8.0.36" || m.Category != "Database" || m.Method != "dsl" || m.URL != "db.example.test:3306" || m.Confidence != 95 {
+		t.Errorf("MySQL 匹配结果错误: %+v", m)
+	}
+
+	mariadb := serviceMatches(engine, &fingerprint.ServiceResponse{Port: 3306, Banner: recordedMariaDBBanner})
+	if mariadb["mariadb"] == nil || mariadb["mariadb"].Version != "10.11.6" || mariadb["mysql"] == nil {
+		t.Errorf("MariaDB banner 应同时命中 mysql 和 mariadb 规则: %v", mariadb)
+	}
+
+	fortigate := serviceMatches(engine, &fingerprint.ServiceResponse{
+		Port:        443,
+		CertSubject: "CN=FGT60FTK2109XXXX,OU=FortiGate,O=Fortinet,L=Sunnyvale,ST=California,C=US",
+		CertIssuer:  fortigateIssuer,
+	})
+	if f := fortigate["fortinet-fortigate"]; f == nil || f.Category != "Firewall" || len(f.Tags) != 1 || f.Tags[0] != "fortinet" || len(fortigate) != 1 {
+		t.Errorf("FortiGate 证书应命中 fortinet-fortigate 规则: %v", fortigate)
+	}
+
+	if ssh := serviceMatches(engine, &fingerprint.ServiceResponse{Port: 22, Banner: recordedSSHBanner}); ssh["openssh"] == nil || ssh["openssh"].Version != "8.9p1" || len(ssh) != 1 {
+		t.Errorf("SSH banner 应只命中 openssh 规则: %v", ssh)
+	}
+	if none := engine.AnalyzeService(&fingerprint.ServiceResponse{Port: 3306}); len(none) != 0 {
+		t.Errorf("没有 banner 和证书时不应命中: %v", none)
+	}
+}
+
+// TestServiceDSLFunctions port、protocol、cert_san 及 contains / regex 的服务匹配对象，无效端口的规则加载时跳过
+func TestServiceDSLFunctions(t *testing.T) {
+	printSeparator("服务 DSL 函数测试")
+
+	path := filepath.Join(t.TempDir(), "service_finger.yaml")
+	content := `acme-db:
+  dsl:
+    - "port(5000, 5001)"
+    - "protocol('acmedb')"
+  condition: and
+acme-vpn:
+  dsl:
+    - "cert_san('vpn.acme.test')"
+acme-banner:
+  dsl:
+    - "contains_all(banner, 'acme', 'ready')"
+    - "regex(cert_issuer, 'O=Acme\\s+Corp')"
+bad-port:
+  dsl:
+    - "port(70000)"
+bad-source:
+  dsl:
+    - "contains(packet, 'acme')"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入规则文件失败: %v", err)
+	}
+	engine := fingerprint.NewDSLEngine()
+	if err := engine.LoadRulesFromFile(path); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+	if report := engine.ValidationReport(); engine.RulesCount() != 3 || report.Skipped != 2 {
+		t.Fatalf("应加载 3 条规则并跳过 2 条无效规则: loaded=%d errors=%+v", engine.RulesCount(), report.Errors)
+	}
+
+	cases := []struct {
+		name string
+		resp fingerprint.ServiceResponse
+		want string
+	}{
+		{"端口和协议", fingerprint.ServiceResponse{Port: 5001, Protocol: "AcmeDB"}, "acme-db"},
+		{"端口不符", fingerprint.ServiceResponse{Port: 5002, Protocol: "acmedb"}, ""},
+		{"证书备用名称", fingerprint.ServiceResponse{Port: 443, CertSANs: []string{"www.acme.test", "VPN.acme.test"}}, "acme-vpn"},
+		{"banner 全部包含", fingerprint.ServiceResponse{Port: 9000, Banner: "ACME service ready"}, "acme-banner"},
+		{"banner 部分包含", fingerprint.ServiceResponse{Port: 9000, Banner: "ACME service starting"}, ""},
+		{"签发者正则", fingerprint.ServiceResponse{Port: 9000, CertIssuer: "CN=ca,O=Acme  Corp"}, "acme-banner"},
+	}
+	for _, c := range cases {
+		matches := engine.AnalyzeService(&c.resp)
+		got := ""
+		if len(matches) == 1 {
+			got = matches[0].RuleName
+		} else if len(matches) > 1 {
+			got = fmt.Sprintf("%d matches", len(matches))
+		}
+		if got != c.want {
+			t.Errorf("%s: 期望 %q, 实际 %q", c.name, c.want, got)
+		}
+	}
+
+	// HTTP 响应不会命中服务规则
+	if matches := engine.AnalyzeResponse(&fingerprint.HTTPResponse{Body: "acme ready", Title: "vpn.acme.test"}); len(matches) != 0 {
+		t.Errorf("服务规则不应匹配 HTTP 响应: %v", matches)
+	}
+}
+
+// fortigateCert 模拟 FortiGate 的出厂自签名证书
+func fortigateCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	name := pkix.Name{
+		CommonName:         "support",
+		OrganizationalUnit: []string{"Certificate Authority"},
+		Organization:       []string{"Fortinet"},
+		Locality:           []string{"Sunnyvale"},
+		Province:           []string{"California"},
+		Country:            []string{"US"},
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      name,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// TestScanPortFingerprintServiceRules 端口指纹对 banner 和证书运行服务规则，命中的规则名合并到端口结果
+func TestScanPortFingerprintServiceRules(t *testing.T) {
+	printSeparator("端口指纹服务规则测试")
+
+	ctx := context.Background()
+	mysql := newLocalPortScanner(bannerListener(t, recordedMySQLBanner))
+	if f := mysql.RulesSummary.File("service_finger.yaml"); f == nil || f.Loaded == 0 || f.Error != "" {
+		t.Fatalf("service_finger.yaml 应已加载: %+v", f)
+	}
+	fp := mysql.ScanPortFingerprint(ctx, "db.example.test", 3306)
+	if fp.Service != "mysql" || len(fp.Fingerprints) != 1 || fp.Fingerprints[0] != "mysql" {
+		t.Errorf("MySQL 端口应命中 mysql 规则: service=%s fingerprints=%v", fp.Service, fp.Fingerprints)
+	}
+
+	fortigate := newLocalPortScanner(tlsListener(t, fortigateCert(t)))
+	fp = fortigate.ScanPortFingerprint(ctx, "fw.example.test", 443)
+	if fp.Certificate == nil || fp.Certificate.Issuer != fortigateIssuer {
+		t.Fatalf("应采集到证书: %+v", fp.Certificate)
+	}
+	if len(fp.Fingerprints) != 1 || fp.Fingerprints[0] != "fortinet-fortigate" {
+		t.Errorf("FortiGate 出厂证书应命中 fortinet-fortigate 规则: %v", fp.Fingerprints)
+	}
+
+	// 端口结果按 ip + port 与端口扫描写入的结果合并
+	data := service.PortFingerprintData(pipeline.AssetOther{Host: "fw.example.test", IP: "10.0.0.1", Port: "443", Fingerprints: fp.Fingerprints})
+	if data["ip"] != "10.0.0.1" || data["port"] != "443" {
+		t.Errorf("端口指纹数据应带有端口结果的去重字段: %v", data)
+	}
+	if names, ok := data["fingerprints"].([]string); !ok || len(names) != 1 || names[0] != "fortinet-fortigate" {
+		t.Errorf("端口指纹数据应包含服务指纹: %v", data)
+	}
+	if service.PortFingerprintData(pipeline.AssetOther{IP: "10.0.0.1", Port: "22", Service: "ssh"}) != nil {
+		t.Error("没有版本和服务指纹时不应更新端口结果")
+	}
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 慢速响应防护测试 ==========
+
+// dribble 每秒写入一个字节，直到客户端断开
+func dribble(w http.ResponseWriter, r *http.Request) {
+	flusher := w.(http.Flusher)
+	for {
+		if _, err := w.Write([]byte("a")); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// newDeadlineScanner 读取超时较短的指纹扫描器
+func newDeadlineScanner() *fingerprint.FingerprintScanner {
+	s := fingerprint.NewFingerprintScanner(1)
+	s.FirstByteTimeout = 500 * time.Millisecond
+	s.BodyReadTimeout = 500 * time.Millisecond
+	return s
+}
+
+// TestSlowBodyFreesWorker 响应体逐字节返回时在读取超时内释放，并在本任务中排除该目标
+func TestSlowBodyFreesWorker(t *testing.T) {
+	printSeparator("慢速响应体测试")
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/html")
+		dribble(w, r)
+	}))
+	defer srv.Close()
+
+	scanner := newDeadlineScanner()
+	start := time.Now()
+	result := scanner.ScanFingerprint(context.Background(), srv.URL)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("读取超时后应释放工作协程, 耗时 %s", elapsed)
+	}
+	if result.Error != "slow response" || result.StatusCode != http.StatusOK {
+		t.Fatalf("应标记为慢速响应并保留状态码: %+v", result)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("慢速响应后不应继续请求 favicon 或 HTTPS, 实际请求 %d 次", n)
+	}
+
+	// 同一任务中再次扫描直接跳过
+	start = time.Now()
+	result = scanner.ScanFingerprint(context.Background(), srv.URL)
+	if time.Since(start) > 100*time.Millisecond || result.Error != "slow response" {
+		t.Errorf("已标记的目标应直接跳过: %+v", result)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("已标记的目标不应再次请求, 实际请求 %d 次", n)
+	}
+	if !scanner.IsSlowHost(strings.TrimPrefix(srv.URL, "http://")) {
+		t.Errorf("目标应被标记为慢速主机")
+	}
+	if fingerprint.NewFingerprintScanner(1).IsSlowHost(strings.TrimPrefix(srv.URL, "http://")) {
+		t.Errorf("慢速标记只属于当前扫描器")
+	}
+}
+
+// TestSlowFirstByteAndFavicon 迟迟不返回响应头或 favicon 逐字节返回时同样受限
+func TestSlowFirstByteAndFavicon(t *testing.T) {
+	printSeparator("首字节与 favicon 超时测试")
+
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer stalled.Close()
+
+	start := time.Now()
+	result := newDeadlineScanner().ScanFingerprint(context.Background(), stalled.URL)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("首字节超时后应释放工作协程, 耗时 %s", elapsed)
+	}
+	if result.Error != "slow response" || result.StatusCode != 0 {
+		t.Errorf("未收到响应头时应标记为慢速响应: %+v", result)
+	}
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/favicon") {
+			w.Header().Set("Content-Type", "image/x-icon")
+			dribble(w, r)
+			return
+		}
+		w.Write([]byte("<html><head><title>Hostile</title></head></html>"))
+	}))
+	defer site.Close()
+
+	start = time.Now()
+	result = newDeadlineScanner().ScanFingerprint(context.Background(), site.URL)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("favicon 读取超时后应释放工作协程, 耗时 %s", elapsed)
+	}
+	if result.Error != "slow response" || result.Title != "Hostile" || result.IconHash != "" {
+		t.Errorf("favicon 超时应标记错误并保留页面结果: %+v", result)
+	}
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== Spray 流式输出测试 ==========
+
+// writeFakeSpray 写入模拟 spray：按 body 向 -f 指定的输出文件追加 JSON 行
+func writeFakeSpray(t *testing.T, body string) *webscan.SprayScanner {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "spray")
+	script := "#!/bin/sh\nout=\"\"\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = \"-f\" ]; then out=\"$2\"; fi\n  shift\ndone\n" + body
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake spray: %v", err)
+	}
+	interval := webscan.SprayTailInterval
+	webscan.SprayTailInterval = 50 * time.Millisecond
+	t.Cleanup(func() { webscan.SprayTailInterval = interval })
+
+	scanner := webscan.NewSprayScanner()
+	scanner.BinPath = path
+	scanner.TempDir = t.TempDir()
+	return scanner
+}
+
+// sprayLine 模拟 spray 输出的一行结果
+func sprayLine(path string, status int) string {
+	return "echo '{\"url\":\"http://app.example.test\",\"path\":\"" + path + "\",\"status\":" + strconv.Itoa(status) + ",\"host\":\"app.example.test\"}' >> \"$out\"\n"
+}
+
+// TestSprayBatchStream spray 运行期间逐条回调，最后一行没有换行也会解析
+func TestSprayBatchStream(t *testing.T) {
+	printSeparator("Spray 流式输出测试")
+
+	scanner := writeFakeSpray(t, sprayLine("/admin", 200)+
+		sprayLine("/admin", 200)+ // 重复结果
+		"sleep 1\n"+
+		sprayLine("/backup.zip", 403)+
+		"sleep 1\n"+
+		"printf '{\"url\":\"http://app.example.test\",\"path\":\"/.git/config\",\"status\":200}' >> \"$out\"\n")
+
+	start := time.Now()
+	var arrivals []time.Duration
+	result, err := scanner.ScanBatchStream(context.Background(), []string{"app.example.test"}, nil, func(entry webscan.SprayEntry) {
+		arrivals = append(arrivals, time.Since(start))
+	})
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	total := time.Since(start)
+	if len(arrivals) != 3 || result.Total != 3 || result.Results[2].Path != "/.git/config" {
+		t.Fatalf("应回调 3 条去重后的结果: %+v", result.Results)
+	}
+	if arrivals[0] > total-time.Second {
+		t.Errorf("第一条结果应在 spray 运行期间到达: %v / %v", arrivals[0], total)
+	}
+}
+
+// TestSprayBatchStreamCancel spray 运行中被取消时保留已解析的结果
+func TestSprayBatchStreamCancel(t *testing.T) {
+	printSeparator("Spray 取消保留结果测试")
+
+	scanner := writeFakeSpray(t, sprayLine("/admin", 200)+sprayLine("/login", 302)+"sleep 30\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := 0
+	start := time.Now()
+	result, err := scanner.ScanBatchStream(ctx, []string{"app.example.test"}, nil, func(entry webscan.SprayEntry) {
+		received++
+		if received == 2 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("取消时应返回 context.Canceled, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("取消后应尽快返回, 耗时 %v", elapsed)
+	}
+	if result == nil || result.Total != 2 || received != 2 {
+		t.Fatalf("已解析的结果不应丢失: %+v", result)
+	}
+}
+
+// TestDirScanModuleStreamsResults 目录扫描模块在 spray 结束前就把结果发送给下一个模块
+func TestDirScanModuleStreamsResults(t *testing.T) {
+	printSeparator("目录扫描流式转发测试")
+
+	scanner := writeFakeSpray(t, sprayLine("/", 200)+ // 根路径不输出
+		sprayLine("/admin", 200)+
+		sprayLine("/missing", 404)+ // 无效状态码不输出
+		"sleep 2\n"+
+		sprayLine("/console", 401))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewDirScanModule(ctx, collector, 2, nil)
+	module.SetSprayScanner(scanner)
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test"}
+	close(input)
+
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		module.ModuleRun()
+	}()
+
+	var urls []pipeline.UrlResult
+	var firstAt time.Duration
+	collect := func(data interface{}) {
+		if u, ok := data.(pipeline.UrlResult); ok {
+			if len(urls) == 0 {
+				firstAt = time.Since(start)
+			}
+			urls = append(urls, u)
+		}
+	}
+	for running := true; running; {
+		select {
+		case data := <-out:
+			collect(data)
+		case <-done:
+			running = false
+		}
+	}
+	total := time.Since(start)
+	for len(out) > 0 {
+		collect(<-out)
+	}
+
+	if len(urls) != 2 || urls[0].Output != "http://app.example.test" || urls[0].Source != "dirscan" || urls[1].StatusCode != 401 {
+		t.Fatalf("应输出 2 条有效结果: %+v", urls)
+	}
+	if firstAt == 0 || firstAt > total-time.Second {
+		t.Errorf("第一条结果应在 spray 结束前转发: %v / %v", firstAt, total)
+	}
+}
@@ -44,7 +44,7 @@ func TestSprayScan(t *testing.T) {
 	
 	if result != nil {
 		t.Logf("Scan found %d results", len(result.Results))
-		t.Logf("Duration: %s", result.Duration)
+		t.Logf("Duration: %dms", result.DurationMs)
 		
 		// 打印前几个结果
 		for i, entry := range result.Results {
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ========== STARTTLS 证书采集测试 ==========
+
+// selfSignedCert 生成自签名证书
+func selfSignedCert(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startTLSServer 最小的明文协议服务：写入 banner，按 handle 处理命令，handle 返回 true 时升级为 TLS
+func startTLSServer(t *testing.T, cert tls.Certificate, banner string, handle func(cmd string, w *bufio.Writer) (upgrade bool)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				w := bufio.NewWriter(conn)
+				w.WriteString(banner)
+				w.Flush()
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					upgrade := handle(strings.TrimSpace(line), w)
+					w.Flush()
+					if upgrade {
+						tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+						tlsConn.Handshake()
+						tlsConn.Close()
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// smtpHandler EHLO 通告 STARTTLS，reject 为 true 时拒绝升级
+func smtpHandler(reject bool) func(string, *bufio.Writer) bool {
+	return func(cmd string, w *bufio.Writer) bool {
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			w.WriteString("250-mail.example.test\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+		case cmd == "STARTTLS" && !reject:
+			w.WriteString("220 Ready to start TLS\r\n")
+			return true
+		default:
+			w.WriteString("502 Command not implemented\r\n")
+		}
+		return false
+	}
+}
+
+// TestStartTLSCertCapture SMTP 和 POP3 服务经 STARTTLS 升级后采集证书并标记
+func TestStartTLSCertCapture(t *testing.T) {
+	printSeparator("STARTTLS 证书采集测试")
+
+	smtpCert := selfSignedCert(t, "mail.example.test")
+	smtp := newLocalPortScanner(startTLSServer(t, smtpCert, "220 mail.example.test ESMTP Postfix\r\n", smtpHandler(false)))
+	result := smtp.ScanPortFingerprint(context.Background(), "mail.example.test", 587)
+	if result.Service != "smtp" {
+		t.Fatalf("应识别为 smtp, 实际 %s", result.Service)
+	}
+	if !result.StartTLS || result.SSL || result.Certificate == nil {
+		t.Fatalf("应通过 STARTTLS 采集证书: %+v", result)
+	}
+	if !strings.Contains(result.Certificate.Subject, "mail.example.test") || len(result.Certificate.SANs) != 1 {
+		t.Errorf("证书信息不正确: %+v", result.Certificate)
+	}
+	if !strings.HasPrefix(result.Banner, "220 mail.example.test") {
+		t.Errorf("banner 应保留: %q", result.Banner)
+	}
+
+	popCert := selfSignedCert(t, "pop.example.test")
+	pop := newLocalPortScanner(startTLSServer(t, popCert, "+OK POP3 server ready\r\n", func(cmd string, w *bufio.Writer) bool {
+		if cmd == "STLS" {
+			w.WriteString("+OK Begin TLS negotiation\r\n")
+			return true
+		}
+		w.WriteString("-ERR unknown command\r\n")
+		return false
+	}))
+	result = pop.ScanPortFingerprint(context.Background(), "pop.example.test", 110)
+	if result.Service != "pop3" || !result.StartTLS || result.Certificate == nil {
+		t.Fatalf("POP3 应通过 STLS 采集证书: %+v", result)
+	}
+	if !strings.Contains(result.Certificate.Subject, "pop.example.test") {
+		t.Errorf("证书信息不正确: %+v", result.Certificate)
+	}
+}
+
+// TestStartTLSUpgradeFailure 服务拒绝升级或不响应时保留原 banner 结果
+func TestStartTLSUpgradeFailure(t *testing.T) {
+	printSeparator("STARTTLS 升级失败测试")
+
+	cert := selfSignedCert(t, "mail.example.test")
+	rejecting := newLocalPortScanner(startTLSServer(t, cert, "220 mail.example.test ESMTP\r\n", smtpHandler(true)))
+	result := rejecting.ScanPortFingerprint(context.Background(), "mail.example.test", 25)
+	if result.Service != "smtp" || result.StartTLS || result.Certificate != nil {
+		t.Errorf("拒绝升级时不应有证书: %+v", result)
+	}
+	if !strings.HasPrefix(result.Banner, "220 mail.example.test") {
+		t.Errorf("banner 应保留: %q", result.Banner)
+	}
+
+	// EHLO 之后不再响应：交互受上下文限制
+	silent := newLocalPortScanner(startTLSServer(t, cert, "220 mail.example.test ESMTP\r\n", func(string, *bufio.Writer) bool {
+		time.Sleep(5 * time.Second)
+		return false
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result = silent.ScanPortFingerprint(ctx, "mail.example.test", 25)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("上下文取消后应立即返回, 耗时 %s", elapsed)
+	}
+	if result.Service != "smtp" || result.StartTLS || result.Certificate != nil {
+		t.Errorf("超时时应保留 banner 结果: %+v", result)
+	}
+}
@@ -0,0 +1,416 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 工作空间统计测试 ==========
+
+// memoryStatsStore 内存统计存储，统计规则与数据库聚合一致
+type memoryStatsStore struct {
+	assets  []*models.Asset
+	results []*models.ScanResult
+	tasks   []*models.Task
+}
+
+// inStatsRange 时间是否在范围内（Start 包含、End 不包含）
+func inStatsRange(t time.Time, r service.StatsRange) bool {
+	return (r.Start.IsZero() || !t.Before(r.Start)) && (r.End.IsZero() || t.Before(r.End))
+}
+
+func (s *memoryStatsStore) CountAssets(ctx context.Context, query service.StatsQuery) (map[models.AssetKind]int64, error) {
+	counts := make(map[models.AssetKind]int64)
+	for _, a := range s.assets {
+		if a.WorkspaceID == query.WorkspaceID && inStatsRange(a.LastSeen, query.Range) {
+			counts[a.Kind]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *memoryStatsStore) CountNewAssets(ctx context.Context, workspaceID primitive.ObjectID, since time.Time) (int64, error) {
+	var n int64
+	for _, a := range s.assets {
+		if a.WorkspaceID == workspaceID && !a.FirstSeen.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryStatsStore) CountVulnsBySeverity(ctx context.Context, query service.StatsQuery) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, r := range s.results {
+		if r.WorkspaceID != query.WorkspaceID || r.Type != models.ResultTypeVuln || !inStatsRange(r.CreatedAt, query.Range) {
+			continue
+		}
+		severity, _ := r.Data["severity"].(string)
+		counts[strings.ToLower(severity)]++
+	}
+	return counts, nil
+}
+
+func (s *memoryStatsStore) CountTechnologies(ctx context.Context, query service.StatsQuery, limit int) ([]service.TechnologyCount, error) {
+	counts := make(map[string]int64)
+	for _, a := range s.assets {
+		if a.WorkspaceID != query.WorkspaceID || !inStatsRange(a.LastSeen, query.Range) {
+			continue
+		}
+		for _, tech := range a.Technologies {
+			counts[tech]++
+		}
+	}
+	// 不排序也不截断，由服务层保证顺序和数量
+	var techs []service.TechnologyCount
+	for name, count := range counts {
+		techs = append(techs, service.TechnologyCount{Name: name, Count: count})
+	}
+	return techs, nil
+}
+
+func (s *memoryStatsStore) CountCompletedTasks(ctx context.Context, query service.StatsQuery) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, t := range s.tasks {
+		if t.WorkspaceID == query.WorkspaceID && t.Status == models.TaskStatusCompleted && inStatsRange(t.CompletedAt, query.Range) {
+			counts[t.CompletedAt.UTC().Format("2006-01-02")]++
+		}
+	}
+	return counts, nil
+}
+
+// statsDataset 两个工作空间的种子数据，统计时间点为 2026-03-20
+type statsDataset struct {
+	workspace primitive.ObjectID
+	other     primitive.ObjectID
+	now       time.Time
+	store     *memoryStatsStore
+}
+
+func seedStatsDataset() *statsDataset {
+	d := &statsDataset{
+		workspace: primitive.NewObjectID(),
+		other:     primitive.NewObjectID(),
+		now:       time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC),
+		store:     &memoryStatsStore{},
+	}
+	// 比整天早一小时，当天的数据在统计时间点之前
+	daysAgo := func(n int) time.Time { return d.now.AddDate(0, 0, -n).Add(-time.Hour) }
+	asset := func(ws primitive.ObjectID, kind models.AssetKind, key string, first, last int, techs ...string) {
+		d.store.assets = append(d.store.assets, &models.Asset{
+			WorkspaceID: ws, Kind: kind, Key: key, Technologies: techs,
+			FirstSeen: daysAgo(first), LastSeen: daysAgo(last),
+		})
+	}
+
+	// 子域名 5 个，其中 2 个最近 7 天首次发现
+	for i, first := range []int{30, 20, 10, 3, 1} {
+		asset(d.workspace, models.AssetKindSubdomain, fmt.Sprintf("s%d.example.com", i), first, 0)
+	}
+	// 端口 3 个，其中 1 个最近 7 天首次发现；1 个 15 天前之后没有再出现
+	asset(d.workspace, models.AssetKindPort, "10.0.0.1:22", 40, 0)
+	asset(d.workspace, models.AssetKindPort, "10.0.0.1:80", 40, 15)
+	asset(d.workspace, models.AssetKindPort, "10.0.0.2:443", 2, 0)
+	// Web 资产 4 个
+	asset(d.workspace, models.AssetKindWeb, "a.example.com", 30, 0, "nginx", "jquery", "php")
+	asset(d.workspace, models.AssetKindWeb, "b.example.com", 30, 0, "nginx", "jquery")
+	asset(d.workspace, models.AssetKindWeb, "c.example.com", 30, 20, "nginx", "wordpress")
+	asset(d.workspace, models.AssetKindWeb, "d.example.com", 5, 0, "apache")
+	// 其他工作空间的资产不计入
+	asset(d.other, models.AssetKindSubdomain, "x.other.com", 1, 0)
+	asset(d.other, models.AssetKindWeb, "y.other.com", 1, 0, "iis", "iis-asp")
+
+	// 漏洞：critical 1、high 3（含大写）、medium 2、low 0、info 4，另有 1 个未知等级
+	vuln := func(ws primitive.ObjectID, severity string, created int) {
+		d.store.results = append(d.store.results, &models.ScanResult{
+			WorkspaceID: ws, Type: models.ResultTypeVuln, CreatedAt: daysAgo(created),
+			Data: bson.M{"severity": severity},
+		})
+	}
+	for _, v := range []struct {
+		severity string
+		created  int
+	}{
+		{"info", 1}, {"high", 2}, {"critical", 3}, {"info", 4}, {"HIGH", 5}, {"medium", 6},
+		{"info", 10}, {"high", 12}, {"medium", 20}, {"info", 25}, {"", 8},
+	} {
+		vuln(d.workspace, v.severity, v.created)
+	}
+	vuln(d.other, "critical", 1)
+	// 其他类型的结果不计入漏洞
+	d.store.results = append(d.store.results, &models.ScanResult{
+		WorkspaceID: d.workspace, Type: models.ResultTypeSensitive, CreatedAt: daysAgo(1),
+		Data: bson.M{"severity": "critical"},
+	})
+
+	// 完成的任务：3-19 两个、3-17 一个、3-14 一个；运行中、失败的任务和其他工作空间不计入
+	task := func(ws primitive.ObjectID, status models.TaskStatus, completed time.Time) {
+		d.store.tasks = append(d.store.tasks, &models.Task{WorkspaceID: ws, Status: status, CompletedAt: completed})
+	}
+	task(d.workspace, models.TaskStatusCompleted, time.Date(2026, 3, 19, 1, 0, 0, 0, time.UTC))
+	task(d.workspace, models.TaskStatusCompleted, time.Date(2026, 3, 19, 23, 59, 0, 0, time.UTC))
+	task(d.workspace, models.TaskStatusCompleted, time.Date(2026, 3, 17, 8, 0, 0, 0, time.UTC))
+	task(d.workspace, models.TaskStatusCompleted, time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC))
+	task(d.workspace, models.TaskStatusCompleted, time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC))
+	task(d.workspace, models.TaskStatusFailed, time.Date(2026, 3, 18, 8, 0, 0, 0, time.UTC))
+	task(d.workspace, models.TaskStatusRunning, time.Time{})
+	task(d.other, models.TaskStatusCompleted, time.Date(2026, 3, 18, 8, 0, 0, 0, time.UTC))
+	return d
+}
+
+// TestStatsWorkspaceOverview 资产总数、漏洞总数和最近 7 天新增资产，只统计指定工作空间
+func TestStatsWorkspaceOverview(t *testing.T) {
+	printSeparator("工作空间概览统计测试")
+
+	d := seedStatsDataset()
+	svc := service.NewStatsServiceWithStore(d.store)
+
+	overview, err := svc.GetWorkspaceOverview(d.workspace, service.StatsRange{End: d.now})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if overview.Subdomains != 5 || overview.Ports != 3 || overview.WebServices != 4 || overview.Vulnerabilities != 11 {
+		t.Errorf("总数不正确: %+v", overview)
+	}
+	// 子域名 2 + 端口 1 + Web 1
+	if overview.NewAssets != 4 || !overview.NewAssetsSince.Equal(d.now.AddDate(0, 0, -7)) {
+		t.Errorf("最近 7 天新增资产不正确: %d since %v", overview.NewAssets, overview.NewAssetsSince)
+	}
+
+	// 时间范围：最近 10 天内出现过的资产和发现的漏洞
+	recent := service.StatsRange{Start: d.now.AddDate(0, 0, -10), End: d.now.Add(time.Second)}
+	overview, err = svc.GetWorkspaceOverview(d.workspace, recent)
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if overview.Subdomains != 5 || overview.Ports != 2 || overview.WebServices != 3 || overview.Vulnerabilities != 7 {
+		t.Errorf("按时间范围的总数不正确: %+v", overview)
+	}
+
+	other, _ := svc.GetWorkspaceOverview(d.other, service.StatsRange{End: d.now})
+	if other.Subdomains != 1 || other.WebServices != 1 || other.Vulnerabilities != 1 || other.NewAssets != 2 {
+		t.Errorf("其他工作空间的统计不正确: %+v", other)
+	}
+	empty, _ := svc.GetWorkspaceOverview(primitive.NewObjectID(), service.StatsRange{})
+	if empty.Subdomains != 0 || empty.Vulnerabilities != 0 || empty.NewAssets != 0 {
+		t.Errorf("没有数据的工作空间应全部为 0: %+v", empty)
+	}
+}
+
+// TestStatsSeverityBreakdown 等级按 critical > high > medium > low > info 排序，等级大小写不敏感，未知等级排在最后
+func TestStatsSeverityBreakdown(t *testing.T) {
+	printSeparator("漏洞等级分布统计测试")
+
+	d := seedStatsDataset()
+	svc := service.NewStatsServiceWithStore(d.store)
+
+	breakdown, err := svc.GetSeverityBreakdown(d.workspace, service.StatsRange{})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	expected := []service.SeverityCount{
+		{Severity: "critical", Count: 1},
+		{Severity: "high", Count: 3},
+		{Severity: "medium", Count: 2},
+		{Severity: "low", Count: 0},
+		{Severity: "info", Count: 4},
+		{Severity: service.SeverityUnknown, Count: 1},
+	}
+	if fmt.Sprint(breakdown) != fmt.Sprint(expected) {
+		t.Errorf("等级分布不正确:\n期望 %v\n实际 %v", expected, breakdown)
+	}
+
+	// 没有漏洞时五个等级都返回 0，不返回 unknown
+	breakdown, _ = svc.GetSeverityBreakdown(primitive.NewObjectID(), service.StatsRange{})
+	if len(breakdown) != len(service.SeverityOrder) {
+		t.Fatalf("应返回全部等级: %v", breakdown)
+	}
+	for i, b := range breakdown {
+		if b.Severity != service.SeverityOrder[i] || b.Count != 0 {
+			t.Errorf("第 %d 个等级不正确: %+v", i, b)
+		}
+	}
+
+	// 最近 5 天：info(1)、high(2)、critical(3)、info(4)
+	recent := service.StatsRange{Start: d.now.AddDate(0, 0, -5).Add(time.Minute), End: d.now}
+	breakdown, _ = svc.GetSeverityBreakdown(d.workspace, recent)
+	if breakdown[0].Count != 1 || breakdown[1].Count != 1 || breakdown[2].Count != 0 || breakdown[4].Count != 2 {
+		t.Errorf("按时间范围的等级分布不正确: %v", breakdown)
+	}
+}
+
+// TestStatsTopTechnologies 技术栈按资产数排序，数量相同按名称排序，最多返回 10 个
+func TestStatsTopTechnologies(t *testing.T) {
+	printSeparator("技术栈排行统计测试")
+
+	d := seedStatsDataset()
+	svc := service.NewStatsServiceWithStore(d.store)
+
+	techs, err := svc.GetTopTechnologies(d.workspace, service.StatsRange{})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	expected := "[{nginx 3} {jquery 2} {apache 1} {php 1} {wordpress 1}]"
+	if fmt.Sprint(techs) != expected {
+		t.Errorf("技术栈排行不正确: %v", techs)
+	}
+
+	// 最近 10 天出现过的资产，c.example.com 不计入
+	techs, _ = svc.GetTopTechnologies(d.workspace, service.StatsRange{Start: d.now.AddDate(0, 0, -10)})
+	if fmt.Sprint(techs) != "[{jquery 2} {nginx 2} {apache 1} {php 1}]" {
+		t.Errorf("按时间范围的技术栈排行不正确: %v", techs)
+	}
+
+	// 超过 10 个时只返回前 10 个
+	for i := 0; i < 15; i++ {
+		techs := []string{fmt.Sprintf("tech-%02d", i)}
+		for j := 0; j < i; j++ {
+			techs = append(techs, fmt.Sprintf("tech-%02d", j))
+		}
+		d.store.assets = append(d.store.assets, &models.Asset{
+			WorkspaceID: d.other, Kind: models.AssetKindWeb, LastSeen: d.now, Technologies: techs,
+		})
+	}
+	techs, _ = svc.GetTopTechnologies(d.other, service.StatsRange{})
+	if len(techs) != service.TopTechnologiesLimit {
+		t.Fatalf("应只返回前 %d 个: %v", service.TopTechnologiesLimit, techs)
+	}
+	if !sort.SliceIsSorted(techs, func(i, j int) bool { return techs[i].Count > techs[j].Count }) ||
+		techs[0].Name != "tech-00" || techs[0].Count != 15 || techs[9].Name != "tech-09" {
+		t.Errorf("排行顺序不正确: %v", techs)
+	}
+
+	empty, _ := svc.GetTopTechnologies(primitive.NewObjectID(), service.StatsRange{})
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("没有数据时应返回空列表: %#v", empty)
+	}
+}
+
+// TestStatsDailyTaskCounts 每日完成任务数按 UTC 日期分组，范围内没有任务的日期补 0
+func TestStatsDailyTaskCounts(t *testing.T) {
+	printSeparator("每日完成任务统计测试")
+
+	d := seedStatsDataset()
+	svc := service.NewStatsServiceWithStore(d.store)
+
+	// 未指定开始时间：截至 3-20 的最近 7 天（结束时间所在的当天计入）
+	daily, err := svc.GetDailyTaskCounts(d.workspace, service.StatsRange{End: d.now})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	expected := "[{2026-03-14 1} {2026-03-15 0} {2026-03-16 0} {2026-03-17 1} {2026-03-18 0} {2026-03-19 2} {2026-03-20 0}]"
+	if fmt.Sprint(daily) != expected {
+		t.Errorf("每日完成任务数不正确:\n期望 %s\n实际 %v", expected, daily)
+	}
+
+	r, err := service.ParseStatsRange("2026-03-17", "2026-03-19")
+	if err != nil {
+		t.Fatalf("解析时间范围失败: %v", err)
+	}
+	daily, _ = svc.GetDailyTaskCounts(d.workspace, r)
+	if fmt.Sprint(daily) != "[{2026-03-17 1} {2026-03-18 0} {2026-03-19 2}]" {
+		t.Errorf("日期格式的结束时间应包含当天: %v", daily)
+	}
+
+	// 超过上限时截断到最近 90 天
+	daily, _ = svc.GetDailyTaskCounts(d.workspace, service.StatsRange{Start: d.now.AddDate(-1, 0, 0), End: d.now})
+	if len(daily) != service.MaxStatsTrendDays || daily[len(daily)-1].Date != "2026-03-20" {
+		t.Errorf("应最多返回 %d 天: %d", service.MaxStatsTrendDays, len(daily))
+	}
+	var total int64
+	for _, day := range daily {
+		total += day.Count
+	}
+	if total != 5 {
+		t.Errorf("90 天内完成的任务应为 5 个: %d", total)
+	}
+}
+
+// TestStatsParseRange 时间范围支持日期和 RFC3339，开始时间需早于结束时间
+func TestStatsParseRange(t *testing.T) {
+	printSeparator("统计时间范围解析测试")
+
+	r, err := service.ParseStatsRange("", "")
+	if err != nil || !r.Start.IsZero() || !r.End.IsZero() {
+		t.Errorf("未指定时应不限: %+v %v", r, err)
+	}
+	r, err = service.ParseStatsRange("2026-03-01T08:00:00Z", "2026-03-02")
+	if err != nil || !r.Start.Equal(time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)) || !r.End.Equal(time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("解析结果不正确: %+v %v", r, err)
+	}
+	for _, c := range [][2]string{{"yesterday", ""}, {"", "2026/03/01"}, {"2026-03-05", "2026-03-01"}, {"2026-03-01T00:00:00Z", "2026-03-01T00:00:00Z"}} {
+		if _, err := service.ParseStatsRange(c[0], c[1]); !errors.Is(err, service.ErrInvalidStatsRange) {
+			t.Errorf("%v 应返回 ErrInvalidStatsRange: %v", c, err)
+		}
+	}
+}
+
+// TestStatsIndexCoverage 每个统计聚合的匹配条件都是某个索引的前缀，仪表盘加载时不做全集合扫描
+func TestStatsIndexCoverage(t *testing.T) {
+	printSeparator("统计聚合索引测试")
+
+	query := service.StatsQuery{
+		WorkspaceID: primitive.NewObjectID(),
+		Range:       service.StatsRange{Start: time.Now().AddDate(0, 0, -7), End: time.Now()},
+	}
+	indexes := service.StatsIndexes()
+	covered := func(collection string, match bson.M) bool {
+		for _, index := range indexes[collection] {
+			keys := index.Keys.(bson.D)
+			if len(keys) < len(match) || keys[0].Key != "workspace_id" {
+				continue
+			}
+			ok := true
+			for _, key := range keys[:len(match)] {
+				_, found := match[key.Key]
+				ok = ok && found
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+	firstMatch := func(pipeline []bson.M) bson.M {
+		match, _ := pipeline[0]["$match"].(bson.M)
+		return match
+	}
+
+	cases := []struct {
+		name       string
+		collection string
+		match      bson.M
+	}{
+		{"资产计数", models.CollectionAssets, firstMatch(service.AssetCountPipeline(query))},
+		{"新增资产", models.CollectionAssets, service.NewAssetFilter(query.WorkspaceID, query.Range.Start)},
+		{"漏洞等级", models.CollectionScanResults, firstMatch(service.SeverityPipeline(query))},
+		{"技术栈", models.CollectionAssets, firstMatch(service.TechnologyPipeline(query, service.TopTechnologiesLimit))},
+		{"任务趋势", models.CollectionTasks, firstMatch(service.DailyTaskPipeline(query))},
+	}
+	for _, c := range cases {
+		if c.match == nil || c.match["workspace_id"] != query.WorkspaceID {
+			t.Errorf("%s 的聚合应先按工作空间匹配: %v", c.name, c.match)
+			continue
+		}
+		if !covered(c.collection, c.match) {
+			t.Errorf("%s 的匹配条件没有对应的索引: %v", c.name, c.match)
+		}
+	}
+
+	// 技术栈排行在数据库中排序并限制数量
+	pipeline := service.TechnologyPipeline(query, service.TopTechnologiesLimit)
+	if last := pipeline[len(pipeline)-1]; last["$limit"] != service.TopTechnologiesLimit {
+		t.Errorf("技术栈聚合应限制数量: %v", last)
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ========== 子域名 HTTP 探测记录 Web 服务测试 ==========
+
+// TestSubdomainProbeRecordsService 有响应的子域名同时记录为 Web 服务，不发送到下一个模块
+func TestSubdomainProbeRecordsService(t *testing.T) {
+	printSeparator("子域名 HTTP 探测记录 Web 服务测试")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := pipeline.NewResultCollectorModule(ctx, make(chan interface{}, 10))
+	next.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewSubdomainScanModule(ctx, next, 1, false)
+	var recorded []interface{}
+	module.SetServiceRecorder(func(r interface{}) {
+		recorded = append(recorded, r)
+	})
+
+	live := &webscan.HttpxResult{
+		Host:         "www.example.com",
+		IP:           "93.184.216.34",
+		IPs:          []string{"93.184.216.34"},
+		URL:          "https://www.example.com",
+		Scheme:       "https",
+		StatusCode:   200,
+		Title:        "Example",
+		WebServer:    "nginx",
+		Technologies: []string{"nginx", "jQuery"},
+		TechVersions: map[string]string{"nginx": "1.25.3"},
+		CDN:          true,
+	}
+	result := module.ApplyHTTPProbe(pipeline.SubdomainResult{Host: "www.example.com", Domain: "example.com"}, live)
+	if result.Title != "Example" || result.StatusCode != 200 || !result.CDN || result.Source != "httpx" {
+		t.Errorf("子域名结果应使用探测数据丰富: %+v", result)
+	}
+	module.ApplyHTTPProbe(pipeline.SubdomainResult{Host: "dead.example.com"}, &webscan.HttpxResult{Host: "dead.example.com"})
+
+	if len(recorded) != 1 {
+		t.Fatalf("只有有响应的子域名应记录为 Web 服务, 实际 %d", len(recorded))
+	}
+	asset, ok := recorded[0].(pipeline.AssetHttp)
+	if !ok {
+		t.Fatalf("应记录为 AssetHttp: %T", recorded[0])
+	}
+	if asset.URL != live.URL || asset.IP != live.IP || asset.Port != "443" || asset.Server != "nginx" ||
+		asset.Title != "Example" || asset.Source != "httpx" || len(asset.Technologies) != 2 {
+		t.Errorf("Web 服务字段不符: %+v", asset)
+	}
+	if len(next.GetInput()) != 0 {
+		t.Error("Web 服务记录不应发送到下一个模块")
+	}
+}
+
+// TestServiceDedupMergesTechnologies 同一 host 的 Web 服务按字段合并，技术栈取并集
+func TestServiceDedupMergesTechnologies(t *testing.T) {
+	printSeparator("Web 服务去重合并测试")
+
+	fingerprint := &models.ScanResult{
+		Type:   models.ResultTypeService,
+		Source: "fingerprint",
+		Data: bson.M{
+			"url":          "https://www.example.com",
+			"title":        "",
+			"status_code":  200,
+			"technologies": []string{"nginx", "Vue.js"},
+			"fingerprints": nil,
+		},
+	}
+	update := service.DedupUpdate(fingerprint)
+
+	set := update["$set"].(bson.M)
+	if _, ok := set["data"]; ok {
+		t.Fatal("Web 服务不应整体替换 data")
+	}
+	if _, ok := set["data.title"]; ok {
+		t.Error("空标题不应覆盖探测得到的标题")
+	}
+	if set["data.url"] != "https://www.example.com" || set["data.status_code"] != 200 {
+		t.Errorf("非空字段应写入: %+v", set)
+	}
+	if _, ok := set["data.technologies"]; ok {
+		t.Error("技术栈不应直接覆盖")
+	}
+
+	addToSet := update["$addToSet"].(bson.M)
+	techs := addToSet["data.technologies"].(bson.M)["$each"].([]string)
+	if len(techs) != 2 || techs[0] != "nginx" || techs[1] != "Vue.js" {
+		t.Errorf("技术栈应以 $addToSet 合并: %v", techs)
+	}
+	if fps := addToSet["data.fingerprints"].(bson.M)["$each"].([]string); fps == nil || len(fps) != 0 {
+		t.Errorf("没有指纹时应写入空数组: %#v", fps)
+	}
+
+	port := &models.ScanResult{Type: models.ResultTypePort, Data: bson.M{"ip": "1.2.3.4", "port": 80}}
+	portSet := service.DedupUpdate(port)["$set"].(bson.M)
+	if _, ok := portSet["data"]; ok || portSet["data.ip"] != "1.2.3.4" || portSet["data.port"] != 80 {
+		t.Errorf("其他类型同样按字段合并: %+v", portSet)
+	}
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"moongazing/scanner/subdomain"
+	"moongazing/service/pipeline"
+)
+
+// ========== 子域名解析状态测试 ==========
+// 使用伪造的解析函数模拟可解析、NXDOMAIN 和超时的被动来源记录
+
+// fakeResolver 按预设结果返回解析数据
+func fakeResolver(records map[string][]string, nx map[string]bool) subdomain.ResolveFunc {
+	return func(ctx context.Context, domain string) ([]string, error) {
+		if ips, ok := records[domain]; ok {
+			return ips, nil
+		}
+		if nx[domain] {
+			return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+		}
+		return nil, &net.DNSError{Err: "i/o timeout", Name: domain, IsTimeout: true}
+	}
+}
+
+// TestSubdomainPassiveResolution 被动来源的子域名重新解析后标记解析状态
+func TestSubdomainPassiveResolution(t *testing.T) {
+	printSeparator("被动来源子域名解析状态测试")
+
+	scanner := subdomain.NewActiveScanner(&subdomain.ActiveScannerConfig{VerifySubdomains: true, ResolveConcurrency: 2}, nil)
+	scanner.SetResolver(fakeResolver(
+		map[string][]string{"www.example.com": {"1.2.3.4"}},
+		map[string]bool{"old.example.com": true},
+	))
+
+	scanner.AddPassiveResults(context.Background(),
+		[]string{"www.example.com", "old.example.com", "slow.example.com"}, "subfinder")
+
+	got := make(map[string]subdomain.SubdomainResult)
+	for _, r := range scanner.Results() {
+		got[r.FullDomain] = r
+	}
+
+	want := map[string]string{
+		"www.example.com":  subdomain.ResolutionResolved,
+		"old.example.com":  subdomain.ResolutionNXDomain,
+		"slow.example.com": subdomain.ResolutionUnresolved,
+	}
+	for host, resolution := range want {
+		r, ok := got[host]
+		if !ok {
+			t.Errorf("缺少子域名 %s", host)
+			continue
+		}
+		if r.Resolution != resolution {
+			t.Errorf("%s: 期望解析状态 %s, 实际 %s", host, resolution, r.Resolution)
+		}
+		if r.Alive != (resolution == subdomain.ResolutionResolved) {
+			t.Errorf("%s: 存活状态应与解析结果一致, 实际 %v", host, r.Alive)
+		}
+	}
+	if ips := got["www.example.com"].IPs; len(ips) != 1 || ips[0] != "1.2.3.4" {
+		t.Errorf("可解析的子域名应使用当前解析的 IP: %v", ips)
+	}
+
+	// 关闭验证时不解析，标记为未验证
+	unverified := subdomain.NewActiveScanner(&subdomain.ActiveScannerConfig{}, nil)
+	unverified.SetResolver(func(ctx context.Context, domain string) ([]string, error) {
+		t.Errorf("关闭验证时不应解析 %s", domain)
+		return nil, errors.New("unexpected")
+	})
+	unverified.AddPassiveResults(context.Background(), []string{"api.example.com"}, "hunter")
+	results := unverified.Results()
+	if len(results) != 1 || results[0].Resolution != subdomain.ResolutionUnverified {
+		t.Errorf("关闭验证时应标记为 unverified: %+v", results)
+	}
+	if !subdomain.IsResolved(subdomain.ResolutionUnverified) {
+		t.Errorf("未验证的子域名应继续参与扫描")
+	}
+}
+
+// TestSubdomainUnresolvedFilter 无法解析的子域名不进入后续扫描，开启保留时仅记录
+func TestSubdomainUnresolvedFilter(t *testing.T) {
+	printSeparator("无法解析子域名过滤测试")
+
+	for _, keep := range []bool{false, true} {
+		var recorded []pipeline.SubdomainResult
+		module := pipeline.NewSubdomainScanModule(context.Background(), nil, 0, false)
+		module.SetExclusion(nil, func(r pipeline.SubdomainResult) {
+			recorded = append(recorded, r)
+		})
+		module.SetKeepUnresolved(keep)
+
+		if module.FilterUnresolved(pipeline.SubdomainResult{Host: "www.example.com", Resolution: subdomain.ResolutionResolved}) {
+			t.Errorf("可解析的子域名不应被过滤")
+		}
+		if module.FilterUnresolved(pipeline.SubdomainResult{Host: "brute.example.com"}) {
+			t.Errorf("未标记解析状态的子域名不应被过滤")
+		}
+		for _, resolution := range []string{subdomain.ResolutionNXDomain, subdomain.ResolutionUnresolved} {
+			if !module.FilterUnresolved(pipeline.SubdomainResult{Host: "old.example.com", Resolution: resolution}) {
+				t.Errorf("%s 的子域名应被过滤", resolution)
+			}
+		}
+
+		wantRecorded := 0
+		if keep {
+			wantRecorded = 2
+		}
+		if len(recorded) != wantRecorded {
+			t.Errorf("keep_unresolved=%v: 期望记录 %d 条, 实际 %d", keep, wantRecorded, len(recorded))
+		}
+		for _, r := range recorded {
+			if r.Resolution == "" || subdomain.IsResolved(r.Resolution) {
+				t.Errorf("记录的结果应保留解析状态: %+v", r)
+			}
+		}
+	}
+}
+
+// TestSubdomainResolvedUpgradesUnresolved 先由被动来源记录为无法解析的子域名，之后解析成功时更新为可解析，
+// 可解析的记录不会被之后无法解析的结果覆盖
+func TestSubdomainResolvedUpgradesUnresolved(t *testing.T) {
+	printSeparator("子域名解析状态更新测试")
+
+	scanner := subdomain.NewActiveScanner(&subdomain.ActiveScannerConfig{VerifySubdomains: true, ResolveConcurrency: 2}, nil)
+	scanner.SetResolver(fakeResolver(nil, nil))
+	scanner.AddPassiveResults(context.Background(), []string{"live.example.com"}, "subfinder")
+	if results := scanner.Results(); len(results) != 1 || results[0].Resolution != subdomain.ResolutionUnresolved {
+		t.Fatalf("解析超时应记录为无法解析: %+v", results)
+	}
+
+	scanner.SetResolver(fakeResolver(map[string][]string{"live.example.com": {"10.0.0.8"}}, nil))
+	scanner.AddPassiveResults(context.Background(), []string{"live.example.com"}, "hunter")
+	results := scanner.Results()
+	if len(results) != 1 || results[0].Resolution != subdomain.ResolutionResolved || !results[0].Alive ||
+		len(results[0].IPs) != 1 || results[0].IPs[0] != "10.0.0.8" {
+		t.Fatalf("解析成功后应更新为可解析: %+v", results)
+	}
+
+	scanner.SetResolver(fakeResolver(nil, map[string]bool{"live.example.com": true}))
+	scanner.AddPassiveResults(context.Background(), []string{"live.example.com"}, "fofa")
+	if results := scanner.Results(); len(results) != 1 || results[0].Resolution != subdomain.ResolutionResolved {
+		t.Errorf("可解析的记录不应被覆盖: %+v", results)
+	}
+}
@@ -0,0 +1,266 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 子域名结果关联查询测试 ==========
+
+// subdomainFixture 数据库中的子域名和 Web 服务结果（按写入顺序编码为 BSON）
+type subdomainFixture struct {
+	taskID     primitive.ObjectID
+	subdomains [][]byte
+	services   [][]byte
+}
+
+// seedSubdomainFixture 写入 subdomains 个子域名，每个主机 0~3 个 Web 服务
+func seedSubdomainFixture(t testing.TB, subdomains int) *subdomainFixture {
+	t.Helper()
+	f := &subdomainFixture{taskID: primitive.NewObjectID()}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	marshal := func(r models.ScanResult) []byte {
+		data, err := bson.Marshal(r)
+		if err != nil {
+			t.Fatalf("编码结果失败: %v", err)
+		}
+		return data
+	}
+
+	for i := 0; i < subdomains; i++ {
+		host := fmt.Sprintf("h%d.example.com", i)
+		data := bson.M{"subdomain": host, "domain": "example.com", "ips": bson.A{"10.0.0.1"}}
+		if i%7 == 0 {
+			// 旧版本结果只有 domain 字段
+			data = bson.M{"domain": host}
+		}
+		f.subdomains = append(f.subdomains, marshal(models.ScanResult{
+			ID:        primitive.NewObjectID(),
+			TaskID:    f.taskID,
+			Type:      models.ResultTypeSubdomain,
+			Data:      data,
+			Tags:      []string{"passive"},
+			CreatedAt: base.Add(time.Duration(i) * time.Second),
+		}))
+
+		for port := 0; port < i%4; port++ {
+			data := bson.M{
+				"host":        host,
+				"url":         fmt.Sprintf("https://%s:%d", host, 443+port),
+				"title":       fmt.Sprintf("title-%d-%d", i, port),
+				"status_code": int32(200 + port),
+				"server":      "nginx",
+			}
+			switch i % 3 {
+			case 0:
+				data["technologies"] = bson.A{"nginx", "PHP"}
+			case 1:
+				data["fingerprints"] = bson.A{"WordPress"}
+			default:
+				data["technologies"] = bson.A{"Vue"}
+				data["fingerprints"] = bson.A{"ignored"}
+			}
+			f.services = append(f.services, marshal(models.ScanResult{
+				ID:     primitive.NewObjectID(),
+				TaskID: f.taskID,
+				Type:   models.ResultTypeService,
+				Data:   data,
+			}))
+		}
+	}
+	// 不同主机的 Web 服务和空 host 不应关联
+	f.services = append(f.services, marshal(models.ScanResult{
+		ID: primitive.NewObjectID(), TaskID: f.taskID, Type: models.ResultTypeService,
+		Data: bson.M{"host": "", "title": "empty"},
+	}))
+	return f
+}
+
+// page 按创建时间倒序分页的子域名
+func (f *subdomainFixture) page(page, pageSize int) [][]byte {
+	start := len(f.subdomains) - page*pageSize
+	end := start + pageSize
+	if start < 0 {
+		start = 0
+	}
+	var docs [][]byte
+	for i := end - 1; i >= start; i-- {
+		docs = append(docs, f.subdomains[i])
+	}
+	return docs
+}
+
+// legacyJoin 旧实现：读出任务的全部 Web 服务建立 host 映射，再构建当前页
+func (f *subdomainFixture) legacyJoin(page, pageSize int) []map[string]interface{} {
+	serviceMap := make(map[string]map[string]interface{})
+	for _, doc := range f.services {
+		var result models.ScanResult
+		if err := bson.Unmarshal(doc, &result); err != nil {
+			continue
+		}
+		if host, ok := result.Data["host"].(string); ok && host != "" {
+			if _, exists := serviceMap[host]; !exists {
+				serviceMap[host] = result.Data
+			}
+		}
+	}
+	var items []map[string]interface{}
+	for _, doc := range f.page(page, pageSize) {
+		var result models.ScanResult
+		if err := bson.Unmarshal(doc, &result); err != nil {
+			continue
+		}
+		items = append(items, service.SubdomainResultItem(result, serviceMap))
+	}
+	return items
+}
+
+// aggregateRows 模拟数据库执行 SubdomainResultsPipeline 返回的当前页结果
+func (f *subdomainFixture) aggregateRows(t testing.TB, page, pageSize int) [][]byte {
+	t.Helper()
+	var services []models.ScanResult
+	for _, svcDoc := range f.services {
+		var svc models.ScanResult
+		if err := bson.Unmarshal(svcDoc, &svc); err != nil {
+			t.Fatalf("解码 Web 服务失败: %v", err)
+		}
+		services = append(services, svc)
+	}
+
+	var rows [][]byte
+	for _, doc := range f.page(page, pageSize) {
+		var sub models.ScanResult
+		if err := bson.Unmarshal(doc, &sub); err != nil {
+			t.Fatalf("解码子域名失败: %v", err)
+		}
+		host, _ := sub.Data["subdomain"].(string)
+		if host == "" {
+			host, _ = sub.Data["domain"].(string)
+		}
+		row := service.SubdomainResultRow{ScanResult: sub}
+		for _, svc := range services {
+			if h, _ := svc.Data["host"].(string); h != "" && h == host {
+				row.Service = svc.Data
+				break
+			}
+		}
+		data, err := bson.Marshal(row)
+		if err != nil {
+			t.Fatalf("编码聚合结果失败: %v", err)
+		}
+		rows = append(rows, data)
+	}
+	return rows
+}
+
+// decodeRows GetSubdomainResults 对聚合结果的处理
+func decodeRows(rows [][]byte) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, doc := range rows {
+		var row service.SubdomainResultRow
+		if err := bson.Unmarshal(doc, &row); err != nil {
+			continue
+		}
+		items = append(items, row.Item())
+	}
+	return items
+}
+
+// TestSubdomainResultsJoinMatchesLegacy 聚合关联的列表项与旧的内存关联一致
+func TestSubdomainResultsJoinMatchesLegacy(t *testing.T) {
+	printSeparator("子域名结果聚合关联一致性测试")
+
+	f := seedSubdomainFixture(t, 3000)
+	for _, page := range []int{1, 2, 75, 150} {
+		want := f.legacyJoin(page, 20)
+		got := decodeRows(f.aggregateRows(t, page, 20))
+		if len(got) != 20 || !reflect.DeepEqual(got, want) {
+			t.Fatalf("第 %d 页与旧实现不一致:\n got %v\nwant %v", page, got, want)
+		}
+	}
+
+	items := decodeRows(f.aggregateRows(t, 150, 20))
+	enriched := map[string]int{}
+	for _, item := range items {
+		if _, ok := item["status_code"].(int); ok {
+			enriched["status_code"]++
+		}
+		if fp, ok := item["fingerprint"].([]string); ok && len(fp) > 0 {
+			enriched["fingerprint"]++
+			if techs, ok := item["technologies"].([]string); ok && !reflect.DeepEqual(fp, techs) {
+				t.Errorf("technologies 存在时 fingerprint 应与之相同: %v", item)
+			}
+			if fp[0] == "ignored" {
+				t.Errorf("technologies 应优先于 fingerprints: %v", item)
+			}
+		}
+	}
+	if enriched["status_code"] == 0 || enriched["fingerprint"] == 0 {
+		t.Errorf("应从 Web 服务补充状态码和指纹: %v", enriched)
+	}
+}
+
+// TestSubdomainResultsJoinAllocations 每次请求只解码当前页，内存分配不随任务的 Web 服务数量增长
+func TestSubdomainResultsJoinAllocations(t *testing.T) {
+	printSeparator("子域名结果聚合关联内存分配测试")
+
+	f := seedSubdomainFixture(t, 3000)
+	rows := f.aggregateRows(t, 3, 20)
+
+	legacy := testing.AllocsPerRun(5, func() { f.legacyJoin(3, 20) })
+	aggregated := testing.AllocsPerRun(5, func() { decodeRows(rows) })
+	t.Logf("每次请求分配: 旧实现 %.0f, 聚合 %.0f (%d 个 Web 服务)", legacy, aggregated, len(f.services))
+	if aggregated*20 > legacy {
+		t.Errorf("聚合关联的分配次数应远小于旧实现: %.0f vs %.0f", aggregated, legacy)
+	}
+}
+
+// TestSubdomainResultsPipeline 先分页再关联，关联条件使用 {task_id, type, data.host} 索引
+func TestSubdomainResultsPipeline(t *testing.T) {
+	printSeparator("子域名结果聚合管道测试")
+
+	taskID := primitive.NewObjectID()
+	filter := bson.M{"task_id": taskID, "type": models.ResultTypeSubdomain}
+	stages := service.SubdomainResultsPipeline(models.CollectionScanResults, taskID, filter, 40, 20)
+
+	var names []string
+	for _, stage := range stages {
+		for name := range stage {
+			names = append(names, name)
+		}
+	}
+	want := []string{"$match", "$sort", "$skip", "$limit", "$lookup", "$addFields"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("聚合阶段顺序不正确: %v", names)
+	}
+	if stages[2]["$skip"] != int64(40) || stages[3]["$limit"] != int64(20) {
+		t.Errorf("分页参数不正确: %v %v", stages[2], stages[3])
+	}
+
+	lookup := stages[4]["$lookup"].(bson.M)
+	if lookup["from"] != models.CollectionScanResults || lookup["as"] != "service" {
+		t.Errorf("关联集合不正确: %v", lookup)
+	}
+	match := lookup["pipeline"].(bson.A)[0].(bson.M)["$match"].(bson.M)
+	if match["task_id"] != taskID || match["type"] != models.ResultTypeService || match["data.host"] == nil {
+		t.Errorf("关联条件应限定任务、Web 服务类型和 host: %v", match)
+	}
+
+	found := false
+	for _, index := range service.ResultIndexes() {
+		if reflect.DeepEqual(index.Keys, bson.D{{Key: "task_id", Value: 1}, {Key: "type", Value: 1}, {Key: "data.host", Value: 1}}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("缺少 {task_id, type, data.host} 索引")
+	}
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"moongazing/scanner/subdomain"
+	"moongazing/service/pipeline"
+)
+
+// ========== 子域名接管检测测试 ==========
+// 使用模拟 DNS 和 HTTP 响应，未认领页面按服务的特征文本确认
+
+// takeoverClient 按主机返回预设页面的 HTTP 客户端，页面逐字节返回以覆盖分段读取
+func takeoverClient(pages map[string]string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		page, ok := pages[req.URL.Hostname()]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		body := io.NopCloser(iotest.OneByteReader(strings.NewReader(page)))
+		return &http.Response{StatusCode: 404, Header: http.Header{}, Body: body, Request: req}, nil
+	})}
+}
+
+// padPage 特征文本前填充内容，确认不只检查第一次读取到的数据
+func padPage(signature string) string {
+	return "<html><head>" + strings.Repeat("<meta name=\"x\">", 500) + "</head><body>" + signature + "</body></html>"
+}
+
+// newFakeTakeoverScanner 创建使用模拟解析的接管检测器，返回 CNAME 查询次数计数
+func newFakeTakeoverScanner(cnames map[string]string, pages map[string]string) (*subdomain.TakeoverScanner, *int32) {
+	var lookups int32
+	scanner := subdomain.NewTakeoverScanner(5)
+	scanner.SetCNAMELookup(func(ctx context.Context, host string) (string, error) {
+		atomic.AddInt32(&lookups, 1)
+		return cnames[host], nil
+	})
+	scanner.SetHostLookup(func(ctx context.Context, host string) ([]string, error) {
+		return []string{"192.0.2.10"}, nil
+	})
+	scanner.SetHTTPClient(takeoverClient(pages))
+	return scanner, &lookups
+}
+
+// TestTakeoverSignatures CNAME 命中可接管服务后，页面包含未认领特征才判定为可接管
+func TestTakeoverSignatures(t *testing.T) {
+	printSeparator("子域名接管特征确认测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cnames := map[string]string{
+		"blog.example.test":   "example.github.io",
+		"docs.example.test":   "example-docs.github.io",
+		"app.example.test":    "example-app.azurewebsites.net",
+		"portal.example.test": "example-portal.azurewebsites.net",
+	}
+	pages := map[string]string{
+		"blog.example.test":   padPage("<title>Site not found &middot; GitHub Pages</title>"),
+		"docs.example.test":   padPage("<h1>Example Docs</h1>"),
+		"app.example.test":    padPage("<h1>Error 404 - Web app not found.</h1>"),
+		"portal.example.test": padPage("<h1>Welcome</h1>"),
+	}
+	scanner, _ := newFakeTakeoverScanner(cnames, pages)
+
+	cases := []struct {
+		host       string
+		service    string
+		vulnerable bool
+	}{
+		{"blog.example.test", "GitHub Pages", true},
+		{"docs.example.test", "GitHub Pages", false},
+		{"app.example.test", "Azure", true},
+		{"portal.example.test", "Azure", false},
+	}
+	for _, c := range cases {
+		result, err := scanner.Scan(ctx, c.host)
+		if err != nil {
+			t.Fatalf("%s: 检测失败: %v", c.host, err)
+		}
+		if result.Service != c.service || result.Vulnerable != c.vulnerable || result.CNAME != cnames[c.host] {
+			t.Errorf("%s: 期望 %s vulnerable=%v, 得到 %+v", c.host, c.service, c.vulnerable, result)
+		}
+		if c.vulnerable && len(result.Fingerprints) == 0 {
+			t.Errorf("%s: 应记录匹配的特征: %+v", c.host, result)
+		}
+		if !c.vulnerable && !strings.Contains(result.Reason, "signature was not found") {
+			t.Errorf("%s: 未匹配特征时应说明原因: %q", c.host, result.Reason)
+		}
+	}
+}
+
+// TestTakeoverKnownCNAMEs 提供 CNAME 链时直接使用，链上中间节点也参与匹配
+func TestTakeoverKnownCNAMEs(t *testing.T) {
+	printSeparator("子域名接管已知CNAME测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	scanner, lookups := newFakeTakeoverScanner(nil, map[string]string{
+		"blog.example.test": padPage("There isn't a GitHub Pages site here."),
+	})
+
+	result, err := scanner.ScanWithCNAMEs(ctx, "blog.example.test", []string{"pages.example.net", "example.github.io.", "github.map.fastly.net"})
+	if err != nil {
+		t.Fatalf("检测失败: %v", err)
+	}
+	if !result.Vulnerable || result.Service != "GitHub Pages" || result.CNAME != "example.github.io" {
+		t.Errorf("应按链上的 github.io 节点检测: %+v", result)
+	}
+	if n := atomic.LoadInt32(lookups); n != 0 {
+		t.Errorf("已知 CNAME 链时不应再解析: %d 次", n)
+	}
+}
+
+// TestDomainVerifyTakeoverVuln 域名验证对子域名主机做接管检测，确认后同时输出接管结果和高危漏洞
+func TestDomainVerifyTakeoverVuln(t *testing.T) {
+	printSeparator("域名验证子域名接管漏洞测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	forwarded := make(chan interface{}, 100)
+	collector := pipeline.NewResultCollectorModule(ctx, forwarded)
+	collector.SetInput(make(chan interface{}, 100))
+
+	module := pipeline.NewDomainVerifyModule(ctx, collector, 5)
+	module.SetInput(make(chan interface{}, 100))
+	module.SetTakeoverHTTPClient(takeoverClient(map[string]string{
+		"blog.example.test": padPage("<title>Site not found &middot; GitHub Pages</title>"),
+	}))
+
+	module.GetInput() <- pipeline.SubdomainResult{
+		Host: "blog.example.test", Domain: "example.test", RootDomain: "example.test",
+		IPs: []string{"192.0.2.10"}, CNAMEs: []string{"example.github.io"},
+	}
+	module.CloseInput()
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("模块运行失败: %v", err)
+	}
+	close(forwarded)
+
+	var takeovers []pipeline.TakeoverResult
+	var vulns []pipeline.VulnResult
+	for v := range forwarded {
+		switch r := v.(type) {
+		case pipeline.TakeoverResult:
+			takeovers = append(takeovers, r)
+		case pipeline.VulnResult:
+			vulns = append(vulns, r)
+		}
+	}
+
+	if len(takeovers) != 1 || takeovers[0].Domain != "blog.example.test" || takeovers[0].CNAME != "example.github.io" {
+		t.Fatalf("应对子域名主机而非根域名检测: %+v", takeovers)
+	}
+	if len(vulns) != 1 {
+		t.Fatalf("接管应同时输出一条漏洞: %+v", vulns)
+	}
+	vuln := vulns[0]
+	if vuln.Target != "blog.example.test" || vuln.Severity != "high" || vuln.VulnID != "subdomain-takeover" || !strings.Contains(vuln.Name, "GitHub Pages") {
+		t.Errorf("漏洞结果不正确: %+v", vuln)
+	}
+	if !strings.Contains(vuln.Evidence, "example.github.io") || !strings.Contains(vuln.Evidence, "GitHub Pages") {
+		t.Errorf("漏洞证据应包含 CNAME 和匹配的特征: %q", vuln.Evidence)
+	}
+}
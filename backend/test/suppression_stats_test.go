@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 丢弃统计测试 ==========
+
+// TestSuppressionStatsPipeline 重复和超出范围的输入按模块、原因计数，调试采样严格受限
+func TestSuppressionStatsPipeline(t *testing.T) {
+	printSeparator("丢弃统计测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// 流水线入口拦截超出范围的目标
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{
+		Fingerprint:        true,
+		ExcludePatterns:    []string{"*-dr.example.com", "10.0.0.0/24"},
+		SuppressionSamples: 2,
+	})
+	targets := []string{"www.example.com", "a-dr.example.com", "b-dr.example.com", "c-dr.example.com", "10.0.0.9", "10.0.1.9"}
+	if err := pipe.Start(targets); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	kept := len(pipe.Wait())
+
+	counts := pipe.Suppression().Counts()
+	if len(counts) != 1 || counts[0] != (pipeline.SuppressionCount{Module: "Fingerprint", Reason: pipeline.SuppressOutOfScope, Count: 4}) {
+		t.Fatalf("应记录 Fingerprint 模块 4 个超出范围的输入: %+v", counts)
+	}
+	if kept+int(counts[0].Count) != len(targets) {
+		t.Errorf("保留数 %d 与丢弃数之和应等于输入数", kept)
+	}
+	samples := pipe.Suppression().Samples()
+	if len(samples) != 2 || samples[0].Item != "a-dr.example.com" {
+		t.Errorf("每种原因最多采样 2 条: %+v", samples)
+	}
+
+	// 模块内去重：同一 URL 只检测一次
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte("<html>ok</html>"))
+	}))
+	defer server.Close()
+
+	stats := pipeline.NewSuppressionStats(0)
+	module := pipeline.NewSensitiveModule(ctx, nil, 2)
+	module.SetSuppressionStats(stats)
+	input := make(chan interface{}, 10)
+	module.SetInput(input)
+	for i := 0; i < 3; i++ {
+		input <- pipeline.UrlResult{Output: server.URL + "/a", Method: "GET", Source: "katana"}
+	}
+	input <- pipeline.UrlResult{Output: server.URL + "/b", Method: "GET", Source: "katana"}
+	input <- pipeline.UrlResult{Output: server.URL + "/b", Method: "GET", Source: "katana"}
+	close(input)
+	module.ModuleRun()
+
+	// 入库合并由执行器记录在同一统计中
+	stats.Record(service.StoreSuppressionModule, pipeline.SuppressStoredDuplicate, server.URL+"/a")
+
+	counts = stats.Counts()
+	want := []pipeline.SuppressionCount{
+		{Module: service.StoreSuppressionModule, Reason: pipeline.SuppressStoredDuplicate, Count: 1},
+		{Module: "SensitiveInfo", Reason: pipeline.SuppressDuplicate, Count: 3},
+	}
+	if len(counts) != len(want) || counts[0] != want[0] || counts[1] != want[1] {
+		t.Errorf("去重计数不正确: %+v", counts)
+	}
+	if len(stats.Samples()) != 0 {
+		t.Errorf("未开启调试时不应采样")
+	}
+	mu.Lock()
+	if hits["/a"] != 1 || hits["/b"] != 1 {
+		t.Errorf("重复 URL 不应再次检测: %v", hits)
+	}
+	mu.Unlock()
+
+	// 未设置统计的模块不记录
+	var nilStats *pipeline.SuppressionStats
+	nilStats.Record("Crawler", pipeline.SuppressDuplicate, "x")
+	if nilStats.Counts() != nil {
+		t.Errorf("nil 统计不应记录")
+	}
+}
+
+// TestSuppressionSampleCap 并发记录时采样数量不超过上限
+func TestSuppressionSampleCap(t *testing.T) {
+	printSeparator("丢弃采样上限测试")
+
+	stats := pipeline.NewSuppressionStats(10000)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				stats.Record("Crawler", pipeline.SuppressDuplicate, strings.Repeat("u", 1000))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counts := stats.Counts(); len(counts) != 1 || counts[0].Count != 4000 {
+		t.Fatalf("计数应为 4000: %+v", counts)
+	}
+	samples := stats.Samples()
+	if len(samples) != pipeline.MaxSuppressionSamples {
+		t.Errorf("采样数应限制为 %d, 实际 %d", pipeline.MaxSuppressionSamples, len(samples))
+	}
+	if len(samples[0].Item) > 512 {
+		t.Errorf("采样条目应截断, 长度 %d", len(samples[0].Item))
+	}
+
+	breakdown := service.BuildSuppressionBreakdown([]models.SuppressionCount{
+		{Module: "Crawler", Reason: pipeline.SuppressDuplicate, Count: 11000},
+		{Module: "ResultStore", Reason: pipeline.SuppressStoredDuplicate, Count: 100},
+		{Module: "Fingerprint", Reason: pipeline.SuppressOutOfScope, Count: 7},
+		{Module: "Sensitive", Reason: pipeline.SuppressDuplicate, Count: 900},
+	})
+	if breakdown.Total != 12007 || breakdown.ByReason[pipeline.SuppressDuplicate] != 11900 || breakdown.ByModule["ResultStore"] != 100 {
+		t.Errorf("汇总不正确: %+v", breakdown)
+	}
+	if breakdown.Items[0].Module != "Crawler" || breakdown.Items[3].Module != "Fingerprint" {
+		t.Errorf("应按数量从多到少排列: %+v", breakdown.Items)
+	}
+}
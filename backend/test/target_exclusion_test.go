@@ -0,0 +1,205 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/service/pipeline"
+)
+
+// ========== 目标排除规则测试 ==========
+
+// TestExclusionMatcherPatterns 通配符、正则、IP 规则匹配
+func TestExclusionMatcherPatterns(t *testing.T) {
+	printSeparator("排除规则匹配测试")
+
+	matcher, err := core.NewExclusionMatcher([]string{
+		"prod-payments.example.com",
+		"*-dr.example.com",
+		`regex:^db[0-9]+\.internal\.example\.com$`,
+		"10.0.0.0/24",
+		"192.168.1.5",
+	})
+	if err != nil {
+		t.Fatalf("创建匹配器失败: %v", err)
+	}
+
+	cases := []struct {
+		target   string
+		excluded bool
+	}{
+		{"prod-payments.example.com", true},
+		{"PROD-Payments.Example.COM", true},
+		{"https://prod-payments.example.com:8443/login", true},
+		{"prod-payments.example.com.", true},
+		{"www.example.com", false},
+		{"mail-dr.example.com", true},
+		{"a.b-dr.example.com", true},
+		{"dr.example.com", false},
+		{"db01.internal.example.com", true},
+		{"DB7.Internal.Example.com", true},
+		{"dbx.internal.example.com", false},
+		{"10.0.0.77", true},
+		{"10.0.0.77:8080", true},
+		{"10.0.1.1", false},
+		{"192.168.1.5", true},
+		{"http://192.168.1.5/admin", true},
+		{"192.168.1.6", false},
+	}
+
+	for _, c := range cases {
+		rule, excluded := matcher.Match(c.target)
+		if excluded != c.excluded {
+			t.Errorf("%s: 期望 excluded=%v, 实际 %v (rule %q)", c.target, c.excluded, excluded, rule)
+		}
+	}
+
+	var nilMatcher *core.ExclusionMatcher
+	if nilMatcher.IsExcluded("prod-payments.example.com") {
+		t.Errorf("nil 匹配器不应排除任何目标")
+	}
+}
+
+// TestExclusionPatternValidation 非法规则在创建任务时被拒绝
+func TestExclusionPatternValidation(t *testing.T) {
+	printSeparator("排除规则校验测试")
+
+	invalid := []string{"regex:db[0-9", "regex:", "10.0.0.0/33", "bad host:80"}
+	for _, p := range invalid {
+		if err := core.ValidateExcludePatterns([]string{p}); err == nil {
+			t.Errorf("规则 %q 应校验失败", p)
+		} else {
+			fmt.Printf("%s -> %v\n", p, err)
+		}
+	}
+
+	if err := core.ValidateExcludePatterns([]string{"*.example.com", " ", "regex:^a"}); err != nil {
+		t.Errorf("合法规则不应校验失败: %v", err)
+	}
+}
+
+// TestExclusionCrawlerScope 爬虫排除范围正则只命中被排除主机
+func TestExclusionCrawlerScope(t *testing.T) {
+	printSeparator("爬虫排除范围测试")
+
+	matcher, _ := core.NewExclusionMatcher([]string{"*-dr.example.com", "10.0.0.5", "10.1.0.0/16"})
+	exprs := matcher.URLRegexps()
+	if len(exprs) != 2 {
+		t.Fatalf("期望生成 2 条正则（网段规则不生成）, 实际 %d: %v", len(exprs), exprs)
+	}
+
+	var res []*regexp.Regexp
+	for _, expr := range exprs {
+		res = append(res, regexp.MustCompile(expr))
+	}
+	matchAny := func(u string) bool {
+		for _, re := range res {
+			if re.MatchString(u) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for u, want := range map[string]bool{
+		"https://app-dr.example.com/":                true,
+		"http://APP-DR.example.com:8080/x?y=1":       true,
+		"http://10.0.0.5/login":                      true,
+		"https://www.example.com/app-dr.example.com": false,
+		"https://app-dr.example.com.evil.com/":       false,
+		"http://10.0.0.50/":                          false,
+	} {
+		if got := matchAny(u); got != want {
+			t.Errorf("%s: 期望 %v, 实际 %v", u, want, got)
+		}
+	}
+}
+
+// TestExclusionSubdomainRecorded 被排除的子域名只记录不转发
+func TestExclusionSubdomainRecorded(t *testing.T) {
+	printSeparator("被排除子域名记录测试")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	next := pipeline.NewResultCollectorModule(ctx, make(chan interface{}, 10))
+	next.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewSubdomainScanModule(ctx, next, 1, false)
+
+	matcher, _ := core.NewExclusionMatcher([]string{"prod-payments.example.com"})
+	var recorded []pipeline.SubdomainResult
+	module.SetExclusion(matcher, func(r pipeline.SubdomainResult) {
+		recorded = append(recorded, r)
+	})
+
+	if !module.FilterExcluded(pipeline.SubdomainResult{Host: "Prod-Payments.example.com", Domain: "example.com"}) {
+		t.Errorf("prod-payments 应被排除")
+	}
+	if module.FilterExcluded(pipeline.SubdomainResult{Host: "www.example.com", Domain: "example.com"}) {
+		t.Errorf("www 不应被排除")
+	}
+
+	if len(recorded) != 1 || !recorded[0].Excluded {
+		t.Fatalf("被排除的子域名应以 excluded=true 记录: %+v", recorded)
+	}
+	if len(next.GetInput()) != 0 {
+		t.Errorf("被排除的子域名不应发送到下一个模块")
+	}
+}
+
+// TestExclusionPipelineGate 流水线各模块入口拦截被排除的目标
+func TestExclusionPipelineGate(t *testing.T) {
+	printSeparator("流水线排除拦截测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint:     true,
+		ExcludePatterns: []string{"prod-payments.example.com", "*-dr.example.com", "10.0.0.0/24"},
+	}
+
+	// 模拟通过旁路（证书 SAN、爬虫链接等）发现的目标
+	targets := []string{
+		"www.example.com",
+		"https://PROD-PAYMENTS.example.com/login",
+		"mail-dr.example.com",
+		"10.0.0.9",
+		"10.0.1.9",
+	}
+
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, config)
+	if err := pipe.Start(targets); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	var results []string
+	for r := range pipe.Results() {
+		if s, ok := r.(string); ok {
+			results = append(results, s)
+		}
+	}
+	if err := pipe.Err(); err != nil {
+		t.Fatalf("流水线异常: %v", err)
+	}
+
+	joined := strings.Join(results, ",")
+	if len(results) != 2 || !contains(joined, "www.example.com") || !contains(joined, "10.0.1.9") {
+		t.Errorf("期望仅保留 www.example.com 和 10.0.1.9, 实际 %v", results)
+	}
+	fmt.Printf("保留目标: %v\n", results)
+
+	// 非法规则导致流水线启动失败
+	bad := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{
+		Fingerprint:     true,
+		ExcludePatterns: []string{"regex:(("},
+	})
+	if err := bad.Start([]string{"www.example.com"}); err == nil {
+		t.Errorf("非法排除规则应导致启动失败")
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 网段 / IP 范围目标展开测试 ==========
+
+// TestExpandTargets 网段、IP 范围、逗号列表展开为单个主机，域名原样保留
+func TestExpandTargets(t *testing.T) {
+	printSeparator("目标展开测试")
+
+	cases := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{"/32", []string{"10.0.0.5/32"}, []string{"10.0.0.5"}},
+		{"/31", []string{"10.0.0.4/31"}, []string{"10.0.0.4", "10.0.0.5"}},
+		{"非对齐网段", []string{"192.168.1.7/30"}, []string{"192.168.1.4", "192.168.1.5", "192.168.1.6", "192.168.1.7"}},
+		{"完整范围", []string{"192.168.1.254-192.168.2.1"}, []string{"192.168.1.254", "192.168.1.255", "192.168.2.0", "192.168.2.1"}},
+		{"简写范围", []string{"192.168.1.1-3"}, []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"}},
+		{"IPv6", []string{"2001:db8::/127"}, []string{"2001:db8::", "2001:db8::1"}},
+		{
+			"域名与网段混合",
+			[]string{"example.com, 10.0.0.0/31", "my-site.example.com", "http://a.example.com/path", "10.0.0.1"},
+			[]string{"example.com", "10.0.0.0", "10.0.0.1", "my-site.example.com", "http://a.example.com/path"},
+		},
+	}
+	for _, c := range cases {
+		got, err := pipeline.ExpandTargets(c.targets, 0)
+		if err != nil {
+			t.Errorf("%s: 展开失败: %v", c.name, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Errorf("%s: 期望 %v, 实际 %v", c.name, c.want, got)
+		}
+	}
+
+	for _, target := range []string{"10.0.0.0/33", "10.0.0.256/24", "10.0.0.9-10.0.0.1", "10.0.0.1-300", "10.0.0.1-2001:db8::1"} {
+		if _, err := pipeline.ExpandTargets([]string{target}, 0); err == nil {
+			t.Errorf("%s 应返回错误", target)
+		}
+	}
+}
+
+// TestExpandTargetsLimit 展开后超过上限时报错，任务创建时同样校验
+func TestExpandTargetsLimit(t *testing.T) {
+	printSeparator("目标展开上限测试")
+
+	if got, err := pipeline.ExpandTargets([]string{"10.0.0.0/20"}, 0); err != nil || len(got) != pipeline.DefaultMaxExpandedTargets {
+		t.Fatalf("默认上限内的网段应全部展开: %d %v", len(got), err)
+	}
+	if _, err := pipeline.ExpandTargets([]string{"10.0.0.0/8"}, 0); err == nil || !strings.Contains(err.Error(), "limit is 4096") {
+		t.Errorf("超过上限应返回明确的错误: %v", err)
+	}
+	if _, err := pipeline.ExpandTargets([]string{"10.0.0.0/30", "10.0.1.0/30"}, 6); err == nil {
+		t.Error("多个目标合计超过上限应返回错误")
+	}
+	if _, err := pipeline.ExpandTargets([]string{"2001:db8::/32"}, 0); err == nil {
+		t.Error("超大 IPv6 网段应返回错误")
+	}
+
+	if err := service.ValidateTaskTargets([]string{"10.0.0.0/24"}, 100); err == nil || !strings.Contains(err.Error(), "任务目标无效") {
+		t.Errorf("任务目标超过上限应拒绝: %v", err)
+	}
+	if err := service.ValidateTaskTargets([]string{"example.com", "10.0.0.0/24"}, 0); err != nil {
+		t.Errorf("默认上限内的目标应通过: %v", err)
+	}
+}
+
+// TestPipelineIPTargetsBypassSubdomain 网段在流水线中按主机注入，IP 目标不进入子域名扫描
+func TestPipelineIPTargetsBypassSubdomain(t *testing.T) {
+	printSeparator("IP 目标跳过子域名扫描测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collector := &eventCollector{}
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{
+		SubdomainScan: true,
+		Fingerprint:   true,
+	})
+	pipe.SetEventHandler(collector.handle)
+	if err := pipe.Start([]string{"10.0.0.0/31,10.0.0.8"}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	var got []string
+	for result := range pipe.Results() {
+		if s, ok := result.(string); ok {
+			got = append(got, s)
+		}
+	}
+	sort.Strings(got)
+	if strings.Join(got, " ") != "10.0.0.0 10.0.0.1 10.0.0.8" {
+		t.Errorf("每个主机应单独经过后续模块: %v", got)
+	}
+
+	complete := collector.find("SubdomainScan", pipeline.EventModuleComplete)
+	if len(complete) != 1 || complete[0].Data["received"] != 0 {
+		t.Errorf("子域名扫描模块不应收到 IP 目标: %+v", complete)
+	}
+
+	if err := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{Fingerprint: true}).Start([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("无效网段应导致流水线启动失败")
+	}
+}
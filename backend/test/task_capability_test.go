@@ -0,0 +1,133 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 任务工具可用性检查测试 ==========
+// ToolsManager 指向空的临时目录模拟工具缺失，PATH 同样指向空目录
+
+// emptyToolsManager 工具目录为空的 ToolsManager
+func emptyToolsManager(t *testing.T) *core.ToolsManager {
+	t.Helper()
+	t.Setenv("PATH", t.TempDir())
+	return &core.ToolsManager{ToolsDir: t.TempDir()}
+}
+
+// TestCapabilityMissingTools 自定义任务的爬虫、目录扫描缺少工具时报告查找的路径，漏洞扫描使用内置引擎，
+// 端口扫描缺少 gogo 时使用内置 TCP 连接扫描
+func TestCapabilityMissingTools(t *testing.T) {
+	printSeparator("任务工具缺失检查测试")
+
+	tm := emptyToolsManager(t)
+	task := &models.Task{Type: models.TaskTypeCustom, Config: models.TaskConfig{ScanTypes: []string{"crawler", "dir_scan", "vuln_scan"}}}
+	report := service.CheckTaskCapabilities(tm, task)
+
+	for _, name := range []string{"web_crawler", "dir_scan"} {
+		module := report.Module(name)
+		if module == nil || module.Available {
+			t.Errorf("%s 应报告为不可用: %+v", name, module)
+			continue
+		}
+		if len(module.Tools) == 0 || !strings.HasPrefix(module.Tools[0].Path, tm.ToolsDir) {
+			t.Errorf("%s 应报告查找的路径: %+v", name, module.Tools)
+		}
+	}
+	if port := report.Module("port_scan"); port == nil || !port.Available ||
+		len(port.Tools) == 0 || !strings.HasPrefix(port.Tools[0].Path, tm.ToolsDir) {
+		t.Errorf("端口扫描缺少 gogo 时仍可用，并报告 gogo 查找的路径: %+v", port)
+	}
+	if vuln := report.Module("vuln_scan"); vuln == nil || !vuln.Available {
+		t.Errorf("漏洞扫描使用内置引擎，缺少 nuclei 时仍可用: %+v", vuln)
+	}
+	if fp := report.Module("fingerprint"); fp == nil || !fp.Available {
+		t.Errorf("依赖的指纹识别应自动启用且可用: %+v", fp)
+	}
+	if report.NoneAvailable() {
+		t.Error("仍有可用的模块时不应判定为全部不可用")
+	}
+
+	warnings := strings.Join(report.Warnings, "\n")
+	for _, want := range []string{"dir_scan 不可用", "web_crawler 不可用", "自动启用端口扫描", "nuclei", "gogo"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("提示中缺少 %q:\n%s", want, warnings)
+		}
+	}
+}
+
+// TestCapabilityToolFound 工具目录中有 katana 时爬虫可用
+func TestCapabilityToolFound(t *testing.T) {
+	printSeparator("任务工具可用检查测试")
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("工具目录结构按 linux/darwin 模拟")
+	}
+	tm := emptyToolsManager(t)
+	dir := filepath.Join(tm.ToolsDir, runtime.GOOS)
+	os.MkdirAll(dir, 0755)
+	if err := os.WriteFile(filepath.Join(dir, "katana"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake katana: %v", err)
+	}
+
+	report := service.CheckPipelineCapabilities(tm, &pipeline.PipelineConfig{WebCrawler: true, Fingerprint: true})
+	crawler := report.Module("web_crawler")
+	if crawler == nil || !crawler.Available || crawler.Tools[0].Path != filepath.Join(dir, "katana") {
+		t.Errorf("找到 katana 时爬虫应可用: %+v", crawler)
+	}
+}
+
+// TestCapabilityRadFallback 只有 rad 时爬虫同样可用（katana 不可用时爬虫模块使用 rad），require_tools 不拒绝任务
+func TestCapabilityRadFallback(t *testing.T) {
+	printSeparator("爬虫备选工具检查测试")
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("工具目录结构按 linux/darwin 模拟")
+	}
+	tm := emptyToolsManager(t)
+	dir := filepath.Join(tm.ToolsDir, runtime.GOOS)
+	os.MkdirAll(dir, 0755)
+	if err := os.WriteFile(filepath.Join(dir, "rad"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake rad: %v", err)
+	}
+
+	report := service.CheckPipelineCapabilities(tm, &pipeline.PipelineConfig{WebCrawler: true})
+	crawler := report.Module("web_crawler")
+	if crawler == nil || !crawler.Available || len(crawler.Tools) != 2 || !crawler.Tools[1].Available {
+		t.Fatalf("只有 rad 时爬虫应可用: %+v", crawler)
+	}
+	if report.NoneAvailable() {
+		t.Error("只有 rad 时不应判定为全部不可用")
+	}
+	if warnings := strings.Join(report.Warnings, "\n"); strings.Contains(warnings, "web_crawler 不可用") {
+		t.Errorf("只有 rad 时不应提示爬虫不可用:\n%s", warnings)
+	}
+}
+
+// TestCapabilityNoneAvailable 所选模块全部不可用；未启用子域名扫描的接管检测给出提示
+func TestCapabilityNoneAvailable(t *testing.T) {
+	printSeparator("任务模块全部不可用测试")
+
+	tm := emptyToolsManager(t)
+	report := service.CheckPipelineCapabilities(tm, &pipeline.PipelineConfig{WebCrawler: true, DirScan: true, SubdomainCheckTakeover: true})
+	if !report.NoneAvailable() {
+		t.Errorf("爬虫和目录扫描都缺少工具时应判定为全部不可用: %+v", report.Modules)
+	}
+	warnings := strings.Join(report.Warnings, "\n")
+	if !strings.Contains(warnings, "接管检测") || !strings.Contains(warnings, "指纹识别") {
+		t.Errorf("应提示接管检测和目录扫描缺少依赖的模块:\n%s", warnings)
+	}
+
+	empty := service.CheckTaskCapabilities(tm, &models.Task{Type: models.TaskTypeCustom})
+	if empty.NoneAvailable() || !strings.Contains(strings.Join(empty.Warnings, ""), "未选择任何扫描类型") {
+		t.Errorf("未选择扫描类型时应给出提示: %+v", empty)
+	}
+}
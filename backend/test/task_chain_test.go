@@ -0,0 +1,251 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务链测试 ==========
+// 使用内存存储模拟结果集合、任务模板和任务创建
+
+// memoryChainStore 内存实现的任务链存储
+type memoryChainStore struct {
+	results   []models.ScanResult
+	templates map[string]*models.TaskTemplate
+	created   []*models.Task
+	// access 为 nil 时不校验创建者的权限
+	access *service.WorkspaceAccess
+}
+
+func (s *memoryChainStore) FindResults(ctx context.Context, taskID primitive.ObjectID, filter models.ResultFilter) ([]models.ScanResult, error) {
+	var matched []models.ScanResult
+	for i := range s.results {
+		if s.results[i].TaskID == taskID && service.MatchResult(&s.results[i], filter) {
+			matched = append(matched, s.results[i])
+		}
+	}
+	return matched, nil
+}
+
+func (s *memoryChainStore) GetTemplate(ctx context.Context, templateID string) (*models.TaskTemplate, error) {
+	return s.templates[templateID], nil
+}
+
+func (s *memoryChainStore) AuthorizeFollowUp(ctx context.Context, creator, workspaceID primitive.ObjectID, template *models.TaskTemplate) error {
+	if s.access == nil {
+		return nil
+	}
+	return s.access.AuthorizeFollowUpTarget(workspaceID, template, creator, "user")
+}
+
+func (s *memoryChainStore) CreateChildTask(ctx context.Context, parent, child *models.Task) error {
+	child.ID = primitive.NewObjectID()
+	child.Status = models.TaskStatusPending
+	s.created = append(s.created, child)
+	parent.ChildTaskIDs = append(parent.ChildTaskIDs, child.ID)
+	return nil
+}
+
+func seedSubdomain(taskID primitive.ObjectID, host string, statusCode int, tags ...string) models.ScanResult {
+	return models.ScanResult{
+		ID:     primitive.NewObjectID(),
+		TaskID: taskID,
+		Type:   models.ResultTypeSubdomain,
+		Tags:   tags,
+		Data:   bson.M{"subdomain": host, "status_code": int32(statusCode)},
+	}
+}
+
+// TestTaskChainSpawnFollowUp 父任务完成后按筛选结果创建子任务并记录双向关联
+func TestTaskChainSpawnFollowUp(t *testing.T) {
+	printSeparator("任务链子任务创建测试")
+
+	workspace := primitive.NewObjectID()
+	parent := &models.Task{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: workspace,
+		Name:        "org-subdomains",
+		Type:        models.TaskTypeSubdomain,
+		Status:      models.TaskStatusCompleted,
+		Targets:     []string{"example.com"},
+		TargetType:  "domain",
+		Config:      models.TaskConfig{ExcludeList: []string{"*.internal.example.com"}},
+		FollowUp: &models.FollowUpSpec{
+			TemplateID: "full-scan",
+			Filter: models.ResultFilter{
+				Type: models.ResultTypeSubdomain,
+				Tags: []string{"interesting"},
+				Conditions: []models.ResultCondition{
+					{Field: "status_code", Op: "gte", Value: float64(200)},
+				},
+			},
+		},
+	}
+
+	store := &memoryChainStore{
+		templates: map[string]*models.TaskTemplate{
+			"full-scan": {Type: models.TaskTypeFull, Config: models.TaskConfig{PortScanMode: "top1000"}},
+		},
+		results: []models.ScanResult{
+			seedSubdomain(parent.ID, "admin.example.com", 200, "interesting"),
+			seedSubdomain(parent.ID, "www.example.com", 200),
+			seedSubdomain(parent.ID, "vpn.example.com", 0, "interesting"),
+			seedSubdomain(parent.ID, "api.example.com", 403, "interesting", "api"),
+			seedSubdomain(parent.ID, "admin.example.com", 200, "interesting"),
+			seedSubdomain(primitive.NewObjectID(), "other.example.com", 200, "interesting"),
+		},
+	}
+
+	child, err := service.SpawnFollowUp(context.Background(), store, parent)
+	if err != nil {
+		t.Fatalf("创建后续任务失败: %v", err)
+	}
+	if child == nil {
+		t.Fatalf("应创建后续任务")
+	}
+
+	if got := strings.Join(child.Targets, ","); got != "admin.example.com,api.example.com" {
+		t.Errorf("子任务目标不正确: %s", got)
+	}
+	if child.Type != models.TaskTypeFull || child.Config.PortScanMode != "top1000" {
+		t.Errorf("子任务应使用模板的类型和配置: type=%s config=%+v", child.Type, child.Config)
+	}
+	if child.WorkspaceID != workspace || child.TargetType != "domain" {
+		t.Errorf("子任务应继承父任务的工作空间: workspace=%s target_type=%s", child.WorkspaceID.Hex(), child.TargetType)
+	}
+	if child.ParentTaskID != parent.ID || child.ChainDepth != 1 {
+		t.Errorf("子任务应记录父任务: parent=%s depth=%d", child.ParentTaskID.Hex(), child.ChainDepth)
+	}
+	if len(parent.ChildTaskIDs) != 1 || parent.ChildTaskIDs[0] != child.ID {
+		t.Errorf("父任务应记录子任务: %v", parent.ChildTaskIDs)
+	}
+	if child.ResultStats.TotalTargets != 2 {
+		t.Errorf("子任务目标数统计不正确: %d", child.ResultStats.TotalTargets)
+	}
+
+	// 未指定模板时沿用父任务的类型和配置
+	parent.FollowUp.TemplateID = ""
+	inherited, err := service.SpawnFollowUp(context.Background(), store, parent)
+	if err != nil || inherited == nil {
+		t.Fatalf("创建后续任务失败: %v", err)
+	}
+	if inherited.Type != parent.Type || len(inherited.Config.ExcludeList) != 1 {
+		t.Errorf("未指定模板时应沿用父任务配置: type=%s config=%+v", inherited.Type, inherited.Config)
+	}
+}
+
+// TestTaskChainGuards 失败、取消的任务不创建子任务，任务链深度受限
+func TestTaskChainGuards(t *testing.T) {
+	printSeparator("任务链限制测试")
+
+	parentID := primitive.NewObjectID()
+	store := &memoryChainStore{
+		results: []models.ScanResult{seedSubdomain(parentID, "a.example.com", 200)},
+	}
+	spec := &models.FollowUpSpec{
+		Filter: models.ResultFilter{Type: models.ResultTypeSubdomain},
+		Next:   &models.FollowUpSpec{Filter: models.ResultFilter{Type: models.ResultTypeSubdomain}},
+	}
+
+	for _, status := range []models.TaskStatus{models.TaskStatusFailed, models.TaskStatusCancelled} {
+		parent := &models.Task{ID: parentID, Status: status, FollowUp: spec}
+		if child, _ := service.SpawnFollowUp(context.Background(), store, parent); child != nil {
+			t.Errorf("%s 的任务不应创建子任务", status)
+		}
+	}
+	if len(store.created) != 0 {
+		t.Fatalf("不应创建任何子任务: %d", len(store.created))
+	}
+
+	// 默认深度 2：根任务 -> 子任务 -> 孙任务，之后不再创建
+	task := &models.Task{ID: parentID, Status: models.TaskStatusCompleted, FollowUp: spec}
+	var depths []int
+	for i := 0; i < 4 && task != nil; i++ {
+		child, err := service.SpawnFollowUp(context.Background(), store, task)
+		if err != nil {
+			t.Fatalf("创建后续任务失败: %v", err)
+		}
+		if child == nil {
+			break
+		}
+		depths = append(depths, child.ChainDepth)
+		// 模拟子任务完成并产生结果
+		child.Status = models.TaskStatusCompleted
+		store.results = append(store.results, seedSubdomain(child.ID, "a.example.com", 200))
+		if child.FollowUp == nil {
+			child.FollowUp = spec
+		}
+		task = child
+	}
+	if len(depths) != service.DefaultChainMaxDepth {
+		t.Errorf("任务链深度应限制为 %d, 实际创建 %v", service.DefaultChainMaxDepth, depths)
+	}
+
+	if err := service.ValidateFollowUp(&models.FollowUpSpec{Filter: models.ResultFilter{Type: models.ResultTypeSubdomain,
+		Conditions: []models.ResultCondition{{Field: "priority", Op: "between"}}}}); err == nil {
+		t.Errorf("不支持的运算符应校验失败")
+	}
+}
+
+// TestTaskChainRevokedCreator 父任务完成前创建者被移出工作空间时不创建子任务，模板按创建者的权限校验
+func TestTaskChainRevokedCreator(t *testing.T) {
+	printSeparator("任务链创建者权限测试")
+	f := newWorkspaceAccessFixture(t)
+
+	parent := &models.Task{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: f.ws,
+		Name:        "org-subdomains",
+		Type:        models.TaskTypeSubdomain,
+		Status:      models.TaskStatusCompleted,
+		CreatedBy:   f.editor,
+		FollowUp:    &models.FollowUpSpec{Filter: models.ResultFilter{Type: models.ResultTypeSubdomain}},
+	}
+	store := &memoryChainStore{
+		access: f.access,
+		templates: map[string]*models.TaskTemplate{
+			"blue-private": {ID: primitive.NewObjectID(), WorkspaceID: f.other, Type: models.TaskTypeFull},
+			"blue-public":  {ID: primitive.NewObjectID(), WorkspaceID: f.other, Type: models.TaskTypeFull, IsPublic: true},
+		},
+		results: []models.ScanResult{seedSubdomain(parent.ID, "a.example.com", 200)},
+	}
+
+	if child, err := service.SpawnFollowUp(context.Background(), store, parent); err != nil || child == nil {
+		t.Fatalf("编辑成员应可以创建后续任务: %v", err)
+	}
+
+	parent.FollowUp.TemplateID = "blue-private"
+	if _, err := service.SpawnFollowUp(context.Background(), store, parent); !errors.Is(err, service.ErrTaskTemplateNotFound) {
+		t.Errorf("其他工作空间的私有模板应按不存在处理，实际 %v", err)
+	}
+	parent.FollowUp.TemplateID = "blue-public"
+	if child, err := service.SpawnFollowUp(context.Background(), store, parent); err != nil || child == nil {
+		t.Errorf("公开模板应可以使用: %v", err)
+	}
+
+	parent.FollowUp.TemplateID = ""
+	parent.FollowUp.WorkspaceID = f.other.Hex()
+	if _, err := service.SpawnFollowUp(context.Background(), store, parent); !errors.Is(err, service.ErrWorkspaceNotFound) {
+		t.Errorf("不能在不是成员的工作空间中创建后续任务，实际 %v", err)
+	}
+
+	parent.FollowUp.WorkspaceID = ""
+	if err := f.access.RemoveMember(f.ws, f.editor, f.owner, "user"); err != nil {
+		t.Fatalf("移除成员失败: %v", err)
+	}
+	created := len(store.created)
+	if _, err := service.SpawnFollowUp(context.Background(), store, parent); !errors.Is(err, service.ErrWorkspaceNotFound) {
+		t.Errorf("创建者被移除后不应创建后续任务，实际 %v", err)
+	}
+	if len(store.created) != created {
+		t.Errorf("创建者被移除后创建了子任务")
+	}
+}
@@ -0,0 +1,218 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务执行事件测试 ==========
+
+// memoryTaskEventStore 内存事件存储
+type memoryTaskEventStore struct {
+	mu     sync.Mutex
+	events []*models.TaskExecutionEvent
+}
+
+func (s *memoryTaskEventStore) InsertExecutionEvents(ctx context.Context, events []*models.TaskExecutionEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memoryTaskEventStore) FindExecutionEvents(ctx context.Context, filter service.TaskEventFilter, page, pageSize int) ([]*models.TaskExecutionEvent, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in := func(values []string, v string) bool {
+		if len(values) == 0 {
+			return true
+		}
+		for _, value := range values {
+			if value == v {
+				return true
+			}
+		}
+		return false
+	}
+	var matched []*models.TaskExecutionEvent
+	for _, e := range s.events {
+		if e.TaskID == filter.TaskID && in(filter.Levels, e.Level) && in(filter.Modules, e.Module) {
+			matched = append(matched, e)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Timestamp.Before(matched[j].Timestamp) })
+	start := (page - 1) * pageSize
+	if start >= len(matched) {
+		return nil, int64(len(matched)), nil
+	}
+	end := start + pageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return matched[start:end], int64(len(matched)), nil
+}
+
+// eventCollector 收集流水线事件
+type eventCollector struct {
+	mu     sync.Mutex
+	events []pipeline.Event
+}
+
+func (c *eventCollector) handle(e pipeline.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+func (c *eventCollector) find(module, eventType string) []pipeline.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []pipeline.Event
+	for _, e := range c.events {
+		if e.Module == module && e.Type == eventType {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// TestPipelineModuleEvents 流水线为每个模块记录开始和结束事件，结果收集模块不记录
+func TestPipelineModuleEvents(t *testing.T) {
+	printSeparator("流水线模块事件测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collector := &eventCollector{}
+	pipe := pipeline.NewStreamingPipeline(ctx, nil, &pipeline.PipelineConfig{Fingerprint: true})
+	pipe.SetEventHandler(collector.handle)
+	targets := []string{"a.example.com", "b.example.com"}
+	if err := pipe.Start(targets); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	for range pipe.Results() {
+	}
+
+	if got := collector.find("Fingerprint", pipeline.EventModuleStart); len(got) != 1 {
+		t.Errorf("指纹模块应有一条开始事件: %+v", collector.events)
+	}
+	complete := collector.find("Fingerprint", pipeline.EventModuleComplete)
+	if len(complete) != 1 {
+		t.Fatalf("指纹模块应有一条结束事件: %+v", collector.events)
+	}
+	if complete[0].Level != pipeline.EventLevelInfo || complete[0].Data["received"] != len(targets) {
+		t.Errorf("结束事件应为 info 并记录输入数量: %+v", complete[0])
+	}
+	if got := collector.find("ResultCollector", pipeline.EventModuleStart); len(got) != 0 {
+		t.Errorf("结果收集模块不应记录事件: %+v", got)
+	}
+}
+
+// TestDirScanToolUnavailableEvent spray 不存在时目录扫描记录工具不可用事件
+func TestDirScanToolUnavailableEvent(t *testing.T) {
+	printSeparator("工具不可用事件测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 10)
+	resultCollector := pipeline.NewResultCollectorModule(ctx, out)
+	resultCollector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewDirScanModule(ctx, resultCollector, 2, nil)
+	scanner := writeFakeSpray(t, "")
+	scanner.BinPath = "/nonexistent/spray"
+	module.SetSprayScanner(scanner)
+	input := make(chan interface{})
+	close(input)
+	module.SetInput(input)
+
+	recorder := pipeline.NewEventRecorder()
+	collector := &eventCollector{}
+	recorder.SetHandler(collector.handle)
+	module.SetEventRecorder(recorder)
+
+	if err := module.ModuleRun(); err == nil {
+		t.Fatal("spray 不可用时应返回错误")
+	}
+	got := collector.find("DirScan", pipeline.EventToolUnavailable)
+	if len(got) != 1 || got[0].Level != pipeline.EventLevelWarn || got[0].Data["tool"] != "spray" {
+		t.Errorf("应记录 spray 不可用事件: %+v", collector.events)
+	}
+
+	// 未设置记录器时不记录也不 panic
+	var nilRecorder *pipeline.EventRecorder
+	nilRecorder.Emit("DirScan", pipeline.EventLevelInfo, pipeline.EventModuleStart, "", nil)
+}
+
+// TestTaskEventServiceFilter 写入器缓冲事件，按级别和模块分页查询，非法级别返回错误
+func TestTaskEventServiceFilter(t *testing.T) {
+	printSeparator("任务事件查询测试")
+
+	store := &memoryTaskEventStore{}
+	svc := service.NewTaskEventServiceWithStore(store)
+	taskID := primitive.NewObjectID()
+
+	writer := service.NewTaskEventWriter(svc, taskID)
+	base := time.Now().Add(-time.Second)
+	emit := func(offset int, module, level, eventType string) {
+		writer.Emit(pipeline.Event{
+			Time:   base.Add(time.Duration(offset) * time.Millisecond),
+			Module: module, Level: level, Type: eventType, Message: eventType,
+		})
+	}
+	emit(0, "DirScan", pipeline.EventLevelInfo, pipeline.EventModuleStart)
+	emit(1, "DirScan", pipeline.EventLevelWarn, pipeline.EventToolUnavailable)
+	emit(2, "Crawler", pipeline.EventLevelError, pipeline.EventTargetError)
+	emit(3, "DirScan", pipeline.EventLevelError, pipeline.EventModuleComplete)
+	writer.Record(pipeline.EventLevelWarn, pipeline.EventCancelled, "任务已取消", nil)
+	writer.Close()
+	writer.Emit(pipeline.Event{Module: "DirScan", Level: pipeline.EventLevelInfo})
+
+	all, total, err := svc.ListEvents(taskID.Hex(), nil, nil, 1, 50)
+	if err != nil || total != 5 || len(all) != 5 {
+		t.Fatalf("关闭时应写入全部事件, 关闭后不再记录: total=%d err=%v", total, err)
+	}
+	if all[4].Module != service.TaskEventModuleExecutor || all[4].TaskID != taskID {
+		t.Errorf("执行器事件的模块名或任务ID不正确: %+v", all[4])
+	}
+
+	events, total, err := svc.ListEvents(taskID.Hex(), []string{"warn", "error"}, []string{"DirScan"}, 1, 1)
+	if err != nil || total != 2 || len(events) != 1 || events[0].Type != pipeline.EventToolUnavailable {
+		t.Errorf("应按级别和模块过滤并按时间分页: total=%d events=%+v err=%v", total, events, err)
+	}
+
+	if _, _, err := svc.ListEvents(taskID.Hex(), []string{"debug"}, nil, 1, 50); !errors.Is(err, service.ErrInvalidEventLevel) {
+		t.Errorf("非法级别应返回 ErrInvalidEventLevel: %v", err)
+	}
+}
+
+// TestTaskEventWriterLimit 超过单次执行上限的事件只计数，关闭时记录丢弃数量
+func TestTaskEventWriterLimit(t *testing.T) {
+	printSeparator("任务事件上限测试")
+
+	store := &memoryTaskEventStore{}
+	svc := service.NewTaskEventServiceWithStore(store)
+	writer := service.NewTaskEventWriter(svc, primitive.NewObjectID())
+	for i := 0; i < service.MaxTaskEventsPerRun+10; i++ {
+		writer.Emit(pipeline.Event{Time: time.Now(), Module: "Crawler", Level: pipeline.EventLevelError, Type: pipeline.EventTargetError})
+	}
+	writer.Close()
+
+	if len(store.events) != service.MaxTaskEventsPerRun+1 {
+		t.Fatalf("应保存 %d 条事件和一条丢弃统计, 实际 %d", service.MaxTaskEventsPerRun, len(store.events))
+	}
+	last := store.events[len(store.events)-1]
+	if last.Type != "events_dropped" || last.Data["dropped"] != 10 {
+		t.Errorf("最后一条应记录丢弃数量: %+v", last)
+	}
+}
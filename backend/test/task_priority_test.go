@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务优先级队列测试 ==========
+// 使用内存列表模拟 Redis 任务队列
+
+// memoryTaskQueue 内存实现的任务队列
+type memoryTaskQueue struct {
+	mu    sync.Mutex
+	lists map[string][]string
+}
+
+func newMemoryTaskQueue() *memoryTaskQueue {
+	return &memoryTaskQueue{lists: make(map[string][]string)}
+}
+
+func (q *memoryTaskQueue) Push(ctx context.Context, key, taskID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.lists[key] = append(q.lists[key], taskID)
+	return nil
+}
+
+func (q *memoryTaskQueue) Pop(ctx context.Context, key string) (string, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := q.lists[key]
+	if len(list) == 0 {
+		return "", false, nil
+	}
+	q.lists[key] = list[1:]
+	return list[0], true, nil
+}
+
+func (q *memoryTaskQueue) Move(ctx context.Context, from, to, taskID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := q.lists[from]
+	for i, id := range list {
+		if id == taskID {
+			q.lists[from] = append(list[:i:i], list[i+1:]...)
+			q.lists[to] = append(q.lists[to], taskID)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// queueTask 创建指定优先级的指纹识别任务并入队
+func queueTask(t *testing.T, q *memoryTaskQueue, priority models.TaskPriority) *models.Task {
+	t.Helper()
+	task := &models.Task{ID: primitive.NewObjectID(), Type: models.TaskTypeFingerprint, Priority: priority}
+	if err := service.EnqueueTaskID(context.Background(), q, task); err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+	return task
+}
+
+// drainQueue 按执行器的顺序取出所有任务
+func drainQueue(t *testing.T, q *memoryTaskQueue, taskType models.TaskType) []string {
+	t.Helper()
+	var ids []string
+	for {
+		id, _, err := service.DequeueTaskID(context.Background(), q, string(taskType))
+		if err != nil {
+			t.Fatalf("出队失败: %v", err)
+		}
+		if id == "" {
+			return ids
+		}
+		ids = append(ids, id)
+	}
+}
+
+// TestTaskPriorityDequeueOrder 交替入队不同优先级的任务，先取 high，再取旧队列和 normal，最后取 low
+func TestTaskPriorityDequeueOrder(t *testing.T) {
+	printSeparator("任务优先级出队顺序测试")
+
+	q := newMemoryTaskQueue()
+	// 升级前入队的任务
+	legacy := primitive.NewObjectID().Hex()
+	q.Push(context.Background(), service.LegacyTaskQueueKey(string(models.TaskTypeFingerprint)), legacy)
+
+	low1 := queueTask(t, q, models.TaskPriorityLow)
+	normal1 := queueTask(t, q, models.TaskPriorityNormal)
+	high1 := queueTask(t, q, models.TaskPriorityHigh)
+	unset := queueTask(t, q, "")
+	low2 := queueTask(t, q, models.TaskPriorityLow)
+	high2 := queueTask(t, q, models.TaskPriorityHigh)
+
+	want := []string{high1.ID.Hex(), high2.ID.Hex(), legacy, normal1.ID.Hex(), unset.ID.Hex(), low1.ID.Hex(), low2.ID.Hex()}
+	got := drainQueue(t, q, models.TaskTypeFingerprint)
+	if len(got) != len(want) {
+		t.Fatalf("出队数量不符: 期望 %v, 实际 %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第 %d 个出队的任务不符: 期望 %s, 实际 %s", i, want[i], got[i])
+		}
+	}
+
+	if key := service.TaskQueueKey("port_scan", ""); key != "task:queue:port_scan:normal" {
+		t.Errorf("未设置优先级的任务应进入 normal 队列: %s", key)
+	}
+}
+
+// TestMoveQueuedTaskPriority 调整排队中任务的优先级，任务移到新队列末尾
+func TestMoveQueuedTaskPriority(t *testing.T) {
+	printSeparator("调整排队任务优先级测试")
+
+	ctx := context.Background()
+	q := newMemoryTaskQueue()
+	high := queueTask(t, q, models.TaskPriorityHigh)
+	low := queueTask(t, q, models.TaskPriorityLow)
+	normal := queueTask(t, q, models.TaskPriorityNormal)
+
+	moved, err := service.MoveQueuedTask(ctx, q, low, models.TaskPriorityHigh)
+	if err != nil || !moved {
+		t.Fatalf("排队中的任务应被移动: moved=%v err=%v", moved, err)
+	}
+	// 旧队列中的任务同样可以调整
+	legacy := &models.Task{ID: primitive.NewObjectID(), Type: models.TaskTypeFingerprint}
+	q.Push(ctx, service.LegacyTaskQueueKey(string(legacy.Type)), legacy.ID.Hex())
+	if moved, _ := service.MoveQueuedTask(ctx, q, legacy, models.TaskPriorityLow); !moved {
+		t.Error("旧队列中的任务应被移动")
+	}
+
+	want := []string{high.ID.Hex(), low.ID.Hex(), normal.ID.Hex(), legacy.ID.Hex()}
+	got := drainQueue(t, q, models.TaskTypeFingerprint)
+	if len(got) != len(want) {
+		t.Fatalf("出队数量不符: 期望 %v, 实际 %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第 %d 个出队的任务不符: 期望 %s, 实际 %s", i, want[i], got[i])
+		}
+	}
+
+	// 已出队的任务不在任何队列中
+	if moved, err := service.MoveQueuedTask(ctx, q, high, models.TaskPriorityLow); moved || err != nil {
+		t.Errorf("已出队的任务不应被移动: moved=%v err=%v", moved, err)
+	}
+	if err := service.ValidTaskPriority("urgent"); err == nil {
+		t.Error("无效的优先级应返回错误")
+	}
+}
@@ -0,0 +1,501 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 可靠任务队列测试 ==========
+// 使用内存列表模拟 Redis 的处理中列表、worker 心跳和尝试次数，worker 失联通过删除心跳模拟
+
+// memoryProcessingQueue 内存实现的可靠任务队列
+type memoryProcessingQueue struct {
+	*memoryTaskQueue
+	workers  map[string]bool
+	alive    map[string]bool
+	attempts map[string]int
+	lock     string
+}
+
+func newMemoryProcessingQueue() *memoryProcessingQueue {
+	return &memoryProcessingQueue{
+		memoryTaskQueue: newMemoryTaskQueue(),
+		workers:         make(map[string]bool),
+		alive:           make(map[string]bool),
+		attempts:        make(map[string]int),
+	}
+}
+
+func (q *memoryProcessingQueue) Claim(ctx context.Context, from, processing string) (string, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := q.lists[from]
+	if len(list) == 0 {
+		return "", false, nil
+	}
+	q.lists[from] = list[1:]
+	q.lists[processing] = append(q.lists[processing], list[0])
+	return list[0], true, nil
+}
+
+func (q *memoryProcessingQueue) Ack(ctx context.Context, processing, taskID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kept := q.lists[processing][:0:0]
+	for _, id := range q.lists[processing] {
+		if id != taskID {
+			kept = append(kept, id)
+		}
+	}
+	q.lists[processing] = kept
+	return nil
+}
+
+func (q *memoryProcessingQueue) Processing(ctx context.Context, processing string) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.lists[processing]...), nil
+}
+
+func (q *memoryProcessingQueue) IncrAttempts(ctx context.Context, taskID string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.attempts[taskID]++
+	return q.attempts[taskID], nil
+}
+
+func (q *memoryProcessingQueue) ResetAttempts(ctx context.Context, taskID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.attempts, taskID)
+	return nil
+}
+
+func (q *memoryProcessingQueue) RegisterWorker(ctx context.Context, workerID string, ttl time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.workers[workerID] = true
+	q.alive[workerID] = true
+	return nil
+}
+
+func (q *memoryProcessingQueue) UnregisterWorker(ctx context.Context, workerID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.workers, workerID)
+	delete(q.alive, workerID)
+	return nil
+}
+
+func (q *memoryProcessingQueue) RefreshWorkers(ctx context.Context, workerIDs []string, ttl time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range workerIDs {
+		q.alive[id] = true
+	}
+	return nil
+}
+
+func (q *memoryProcessingQueue) Workers(ctx context.Context) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := make([]string, 0, len(q.workers))
+	for id := range q.workers {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (q *memoryProcessingQueue) WorkerAlive(ctx context.Context, workerID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.alive[workerID], nil
+}
+
+func (q *memoryProcessingQueue) AcquireLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.lock != "" && q.lock != owner {
+		return false, nil
+	}
+	q.lock = owner
+	return true, nil
+}
+
+func (q *memoryProcessingQueue) ReleaseLock(ctx context.Context, owner string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.lock == owner {
+		q.lock = ""
+	}
+	return nil
+}
+
+// kill 心跳过期，模拟 worker 所在进程崩溃
+func (q *memoryProcessingQueue) kill(workerID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.alive, workerID)
+}
+
+func (q *memoryProcessingQueue) list(key string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.lists[key]...)
+}
+
+// memoryReapTaskStore 内存中的任务状态
+type memoryReapTaskStore struct {
+	mu    sync.Mutex
+	tasks map[string]*models.Task
+}
+
+func (s *memoryReapTaskStore) GetTask(ctx context.Context, taskID string) (*models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *task
+	return &copied, nil
+}
+
+func (s *memoryReapTaskStore) RequeueTask(ctx context.Context, task *models.Task, note string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.tasks[task.ID.Hex()]
+	if stored == nil || stored.Status != models.TaskStatusRunning || stored.NodeID != task.NodeID {
+		return false, nil
+	}
+	stored.Status = models.TaskStatusPending
+	stored.NodeID = ""
+	stored.Resume = true
+	return true, nil
+}
+
+func (s *memoryReapTaskStore) FailTask(ctx context.Context, task *models.Task, errMsg string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.tasks[task.ID.Hex()]
+	if stored == nil || stored.Status != models.TaskStatusRunning || stored.NodeID != task.NodeID {
+		return false, nil
+	}
+	stored.Status = models.TaskStatusFailed
+	stored.LastError = errMsg
+	stored.TerminationReason = models.TerminationMaxRetries
+	return true, nil
+}
+
+func (s *memoryReapTaskStore) status(taskID string) models.TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tasks[taskID].Status
+}
+
+// setStatus 模拟执行器更新任务状态
+func (s *memoryReapTaskStore) setStatus(taskID string, status models.TaskStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[taskID].Status = status
+}
+
+// start 模拟执行器取出任务后改为 Running 并记录所在执行器
+func (s *memoryReapTaskStore) start(taskID, workerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[taskID].Status = models.TaskStatusRunning
+	s.tasks[taskID].NodeID = strings.Split(workerID, ":")[0]
+}
+
+// queueReliableTask 创建端口扫描任务并入队
+func queueReliableTask(t *testing.T, q *memoryProcessingQueue, store *memoryReapTaskStore) *models.Task {
+	t.Helper()
+	task := &models.Task{ID: primitive.NewObjectID(), Type: models.TaskTypePortScan, Status: models.TaskStatusPending}
+	store.tasks[task.ID.Hex()] = task
+	if err := service.EnqueueTaskID(context.Background(), q, task); err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+	return task
+}
+
+// claimAndDie worker 登记后取出任务、开始执行，然后进程崩溃
+func claimAndDie(t *testing.T, q *memoryProcessingQueue, store *memoryReapTaskStore, workerID string) string {
+	t.Helper()
+	id := claimTask(t, q, store, workerID)
+	q.kill(workerID)
+	return id
+}
+
+// claimTask worker 登记后取出任务并开始执行
+func claimTask(t *testing.T, q service.ProcessingQueueStore, store *memoryReapTaskStore, workerID string) string {
+	t.Helper()
+	ctx := context.Background()
+	if err := q.RegisterWorker(ctx, workerID, service.ExecutorHeartbeatTTL); err != nil {
+		t.Fatalf("登记 worker 失败: %v", err)
+	}
+	id, _, err := service.ClaimTaskID(ctx, q, string(models.TaskTypePortScan), workerID)
+	if err != nil || id == "" {
+		t.Fatalf("取出任务失败: id=%q err=%v", id, err)
+	}
+	store.start(id, workerID)
+	return id
+}
+
+// TestReliableQueueRequeueDeadWorker worker 在执行任务时崩溃，任务放回待执行队列，由其他 worker 继续执行
+func TestReliableQueueRequeueDeadWorker(t *testing.T) {
+	printSeparator("失联 worker 任务回收测试")
+
+	ctx := context.Background()
+	q := newMemoryProcessingQueue()
+	store := &memoryReapTaskStore{tasks: make(map[string]*models.Task)}
+	task := queueReliableTask(t, q, store)
+	queueKey := service.TaskQueueKey(string(task.Type), task.Priority)
+
+	// 正在运行的 worker 的任务不回收
+	live := "node-b:worker-0-port_scan"
+	q.RegisterWorker(ctx, live, service.ExecutorHeartbeatTTL)
+	other := queueReliableTask(t, q, store)
+
+	dead := "node-a:worker-0-port_scan"
+	id := claimAndDie(t, q, store, dead)
+	if id != task.ID.Hex() {
+		t.Fatalf("应先取出先入队的任务: %s", id)
+	}
+	if got := q.list(service.ProcessingQueueKey(dead)); len(got) != 1 || got[0] != id {
+		t.Fatalf("取出的任务应在处理中列表: %v", got)
+	}
+	liveID, _, _ := service.ClaimTaskID(ctx, q, string(models.TaskTypePortScan), live)
+	if liveID != other.ID.Hex() {
+		t.Fatalf("存活 worker 应取出第二个任务: %s", liveID)
+	}
+
+	report, err := service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if err != nil {
+		t.Fatalf("回收失败: %v", err)
+	}
+	if len(report.Requeued) != 1 || report.Requeued[0] != id || len(report.Workers) != 1 || report.Workers[0] != dead {
+		t.Fatalf("应回收失联 worker 的任务: %+v", report)
+	}
+	if got := q.list(queueKey); len(got) != 1 || got[0] != id {
+		t.Errorf("任务应回到待执行队列: %v", got)
+	}
+	if len(q.list(service.ProcessingQueueKey(dead))) != 0 {
+		t.Error("失联 worker 的处理中列表应清空")
+	}
+	if store.status(id) != models.TaskStatusPending || !store.tasks[id].Resume {
+		t.Errorf("任务应改回 Pending 并带断点续扫标记: %s", store.status(id))
+	}
+	if q.attempts[id] != 1 {
+		t.Errorf("尝试次数应为 1，实际 %d", q.attempts[id])
+	}
+	if got := q.list(service.ProcessingQueueKey(live)); len(got) != 1 {
+		t.Errorf("存活 worker 的任务不应回收: %v", got)
+	}
+	if alive, _ := q.WorkerAlive(ctx, live); !alive || !q.workers[live] {
+		t.Error("存活 worker 应保留登记")
+	}
+	if q.workers[dead] {
+		t.Error("回收后失联 worker 应取消登记")
+	}
+
+	// 新的 worker 取出并完成任务，确认后尝试次数清除
+	next := "node-b:worker-1-port_scan"
+	q.RegisterWorker(ctx, next, service.ExecutorHeartbeatTTL)
+	if got, _, _ := service.ClaimTaskID(ctx, q, string(models.TaskTypePortScan), next); got != id {
+		t.Fatalf("回收的任务应能再次取出: %s", got)
+	}
+	if err := service.AckTaskID(ctx, q, next, id); err != nil {
+		t.Fatalf("确认失败: %v", err)
+	}
+	if len(q.list(service.ProcessingQueueKey(next))) != 0 || q.attempts[id] != 0 {
+		t.Error("确认后任务应从处理中列表删除并清除尝试次数")
+	}
+
+	// 再次回收没有可处理的任务
+	report, _ = service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if len(report.Requeued)+len(report.DeadLettered)+len(report.Dropped) != 0 {
+		t.Errorf("已确认的任务不应再回收: %+v", report)
+	}
+}
+
+// TestReliableQueueDeadLetter 任务多次因 worker 崩溃中断后移到死信队列并标记失败
+func TestReliableQueueDeadLetter(t *testing.T) {
+	printSeparator("死信队列测试")
+
+	ctx := context.Background()
+	q := newMemoryProcessingQueue()
+	store := &memoryReapTaskStore{tasks: make(map[string]*models.Task)}
+	task := queueReliableTask(t, q, store)
+	id := task.ID.Hex()
+	queueKey := service.TaskQueueKey(string(task.Type), task.Priority)
+
+	for attempt := 1; attempt <= service.MaxTaskAttempts; attempt++ {
+		worker := "node-" + string(rune('a'+attempt)) + ":worker-0-port_scan"
+		claimAndDie(t, q, store, worker)
+		report, err := service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "reaper"})
+		if err != nil {
+			t.Fatalf("回收失败: %v", err)
+		}
+		if attempt < service.MaxTaskAttempts {
+			if len(report.Requeued) != 1 {
+				t.Fatalf("第 %d 次中断应重新入队: %+v", attempt, report)
+			}
+			continue
+		}
+		if len(report.DeadLettered) != 1 || report.DeadLettered[0] != id || len(report.Requeued) != 0 {
+			t.Fatalf("第 %d 次中断应移到死信队列: %+v", attempt, report)
+		}
+	}
+
+	if got := q.list(service.DeadLetterQueueKey); len(got) != 1 || got[0] != id {
+		t.Errorf("任务应在死信队列中: %v", got)
+	}
+	if len(q.list(queueKey)) != 0 {
+		t.Error("死信任务不应留在待执行队列")
+	}
+	stored := store.tasks[id]
+	if stored.Status != models.TaskStatusFailed || stored.LastError != service.MaxRetriesExceededError || stored.TerminationReason != models.TerminationMaxRetries {
+		t.Errorf("死信任务应标记失败: status=%s error=%q reason=%s", stored.Status, stored.LastError, stored.TerminationReason)
+	}
+	if _, ok := q.attempts[id]; ok {
+		t.Error("移到死信队列后应清除尝试次数")
+	}
+}
+
+// TestReliableQueueDropFinished 失联 worker 中已结束或已删除的任务直接确认，持有回收锁的执行器之外不回收
+func TestReliableQueueDropFinished(t *testing.T) {
+	printSeparator("已结束任务回收测试")
+
+	ctx := context.Background()
+	q := newMemoryProcessingQueue()
+	store := &memoryReapTaskStore{tasks: make(map[string]*models.Task)}
+	cancelled := queueReliableTask(t, q, store)
+	deleted := queueReliableTask(t, q, store)
+
+	dead := "node-a:worker-0-port_scan"
+	claimAndDie(t, q, store, dead)
+	claimAndDie(t, q, store, dead)
+	store.setStatus(cancelled.ID.Hex(), models.TaskStatusCancelled)
+	delete(store.tasks, deleted.ID.Hex())
+
+	// 其他执行器正在回收
+	q.lock = "node-c"
+	report, err := service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if err != nil || len(report.Workers) != 0 {
+		t.Fatalf("未获得回收锁时不应回收: %+v %v", report, err)
+	}
+	q.lock = ""
+
+	report, err = service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if err != nil {
+		t.Fatalf("回收失败: %v", err)
+	}
+	if len(report.Dropped) != 2 || len(report.Requeued) != 0 || len(report.DeadLettered) != 0 {
+		t.Errorf("已取消和已删除的任务应直接确认: %+v", report)
+	}
+	if store.status(cancelled.ID.Hex()) != models.TaskStatusCancelled {
+		t.Error("已取消的任务状态不应改变")
+	}
+	if len(q.list(service.ProcessingQueueKey(dead))) != 0 || q.lock != "" {
+		t.Error("处理中列表应清空，回收锁应释放")
+	}
+
+	// 正常退出的 worker 处理中列表为空时取消登记，不为空时保留给回收
+	idle := "node-b:worker-2-port_scan"
+	q.RegisterWorker(ctx, idle, service.ExecutorHeartbeatTTL)
+	if err := service.ReleaseWorker(ctx, q, idle); err != nil || q.workers[idle] {
+		t.Errorf("空闲 worker 退出时应取消登记: %v", err)
+	}
+	busy := "node-b:worker-3-port_scan"
+	queueReliableTask(t, q, store)
+	claimAndDie(t, q, store, busy)
+	if err := service.ReleaseWorker(ctx, q, busy); err != nil || !q.workers[busy] {
+		t.Errorf("有处理中任务的 worker 应保留登记: %v", err)
+	}
+}
+
+// TestReliableQueueRecoveryOwnership 孤儿任务恢复和失联 worker 回收处理同一任务时只入队一次，
+// 回收不会把已由其他执行器接手的任务改回 Pending。队列使用 RESP 协议的 Redis 模拟服务
+func TestReliableQueueRecoveryOwnership(t *testing.T) {
+	printSeparator("孤儿任务恢复与回收测试")
+
+	ctx := context.Background()
+	server := newFakeRedis(t, false)
+	q := service.NewRedisProcessingQueue(server.client())
+	store := &memoryReapTaskStore{tasks: make(map[string]*models.Task)}
+	task := &models.Task{ID: primitive.NewObjectID(), Type: models.TaskTypePortScan, Status: models.TaskStatusPending,
+		StartedAt: time.Now().Add(-time.Hour), Targets: []string{"a.com", "b.com"}}
+	task.ResultStats.LastScannedIndex = 1
+	id := task.ID.Hex()
+	store.tasks[id] = task
+	queueKey := service.TaskQueueKey(string(task.Type), task.Priority)
+	if err := service.EnqueueTaskID(ctx, q, task); err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+
+	// node-a 的 worker 取出任务后进程崩溃
+	dead := "node-a:worker-0-port_scan"
+	claimTask(t, q, store, dead)
+	server.exec([]string{"DEL", "task:worker:heartbeat:" + dead})
+
+	// 启动时的孤儿任务恢复先重新入队，并从 node-a 的处理中列表删除
+	recovery := newMemoryRecoveryStore()
+	recovery.tasks[task.ID] = task
+	recovery.queue = q
+	report, err := service.RecoverOrphanedTasks(ctx, recovery, service.RecoveryOptions{NodeID: "node-b", Queue: q})
+	if err != nil || len(report.Requeued) != 1 {
+		t.Fatalf("孤儿任务应重新入队: %+v %v", report, err)
+	}
+	if got := server.list(service.ProcessingQueueKey(dead)); len(got) != 0 {
+		t.Errorf("恢复后应从原执行器的处理中列表删除: %v", got)
+	}
+
+	// 回收时任务已不在失联 worker 的处理中列表，不再入队
+	reaped, err := service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if err != nil || len(reaped.Requeued) != 0 || len(reaped.Workers) != 1 {
+		t.Fatalf("恢复过的任务不应再次回收: %+v %v", reaped, err)
+	}
+	if got := server.list(queueKey); len(got) != 1 || got[0] != id {
+		t.Fatalf("任务应只入队一次: %v", got)
+	}
+
+	// 处理中列表残留已改回 Pending 的任务时只删除记录
+	stale := "node-c:worker-0-port_scan"
+	q.RegisterWorker(ctx, stale, service.ExecutorHeartbeatTTL)
+	server.exec([]string{"RPUSH", service.ProcessingQueueKey(stale), id})
+	server.exec([]string{"DEL", "task:worker:heartbeat:" + stale})
+	reaped, _ = service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if len(reaped.Dropped) != 1 || len(reaped.Requeued) != 0 {
+		t.Errorf("Pending 任务不应再次入队: %+v", reaped)
+	}
+	if got := server.list(queueKey); len(got) != 1 {
+		t.Errorf("待执行队列中应只有一个任务: %v", got)
+	}
+
+	// 存活的 node-b 接手任务后，残留的记录不会把任务改回 Pending
+	live := "node-b:worker-0-port_scan"
+	q.RegisterWorker(ctx, live, service.ExecutorHeartbeatTTL)
+	claimTask(t, q, store, live)
+	server.exec([]string{"RPUSH", service.ProcessingQueueKey(stale), id})
+	q.RegisterWorker(ctx, stale, service.ExecutorHeartbeatTTL)
+	server.exec([]string{"DEL", "task:worker:heartbeat:" + stale})
+	reaped, _ = service.ReapDeadWorkers(ctx, q, store, service.ReapOptions{NodeID: "node-b"})
+	if len(reaped.Dropped) != 1 || len(reaped.Requeued) != 0 {
+		t.Errorf("其他执行器运行的任务不应回收: %+v", reaped)
+	}
+	if store.status(id) != models.TaskStatusRunning || store.tasks[id].NodeID != "node-b" {
+		t.Errorf("任务应仍由 node-b 运行: %s %s", store.status(id), store.tasks[id].NodeID)
+	}
+	if got := server.list(service.ProcessingQueueKey(live)); len(got) != 1 || len(server.list(queueKey)) != 0 {
+		t.Errorf("任务应只在 node-b 的处理中列表: %v", got)
+	}
+}
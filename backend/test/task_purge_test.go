@@ -0,0 +1,472 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务清理测试 ==========
+
+// memoryPurgeStore 内存实现的清理存储
+type memoryPurgeStore struct {
+	mu         sync.Mutex
+	tasks      map[primitive.ObjectID]*models.Task
+	data       map[string][]primitive.ObjectID // 集合 -> 每个文档的 task_id
+	toolRuns   []*models.ToolRun
+	cruiseLogs []*models.CruiseLog
+	assets     []*models.Asset
+	findings   []*models.Finding
+	audits     []*models.OperationLog
+	failOnce   string // 第一次清理该集合时失败
+}
+
+func newMemoryPurgeStore() *memoryPurgeStore {
+	return &memoryPurgeStore{
+		tasks: make(map[primitive.ObjectID]*models.Task),
+		data:  make(map[string][]primitive.ObjectID),
+	}
+}
+
+func (s *memoryPurgeStore) FindTask(ctx context.Context, taskID primitive.ObjectID) (*models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *task
+	return &cp, nil
+}
+
+func (s *memoryPurgeStore) StopTask(ctx context.Context, taskID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if task, ok := s.tasks[taskID]; ok {
+		switch task.Status {
+		case models.TaskStatusPending, models.TaskStatusPaused, models.TaskStatusRunning:
+			task.Status = models.TaskStatusCancelled
+		}
+	}
+	return nil
+}
+
+func (s *memoryPurgeStore) TaskFiles(ctx context.Context, taskID primitive.ObjectID) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var files []string
+	for _, run := range s.toolRuns {
+		if run.TaskID == taskID {
+			for _, input := range run.Inputs {
+				files = append(files, input.Path)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (s *memoryPurgeStore) DeleteTaskData(ctx context.Context, collection string, taskID primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failOnce == collection {
+		s.failOnce = ""
+		return 0, errors.New("connection reset")
+	}
+	var n int64
+	if collection == models.CollectionToolRuns {
+		kept := s.toolRuns[:0]
+		for _, run := range s.toolRuns {
+			if run.TaskID == taskID {
+				n++
+				continue
+			}
+			kept = append(kept, run)
+		}
+		s.toolRuns = kept
+		return n, nil
+	}
+	kept := s.data[collection][:0]
+	for _, id := range s.data[collection] {
+		if id == taskID {
+			n++
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.data[collection] = kept
+	return n, nil
+}
+
+func (s *memoryPurgeStore) DetachTask(ctx context.Context, ref service.TaskReference, taskID primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	switch ref.Key() {
+	case models.CollectionTasks + ".child_task_ids":
+		for _, task := range s.tasks {
+			kept := task.ChildTaskIDs[:0]
+			for _, id := range task.ChildTaskIDs {
+				if id != taskID {
+					kept = append(kept, id)
+				}
+			}
+			if len(kept) != len(task.ChildTaskIDs) {
+				n++
+			}
+			task.ChildTaskIDs = kept
+		}
+	case models.CollectionTasks + ".parent_task_id":
+		for _, task := range s.tasks {
+			if task.ParentTaskID == taskID {
+				task.ParentTaskID = primitive.NilObjectID
+				n++
+			}
+		}
+	case models.CollectionCruiseLogs + ".task_id":
+		for _, l := range s.cruiseLogs {
+			if l.TaskID == taskID {
+				l.TaskID = primitive.NilObjectID
+				n++
+			}
+		}
+	case models.CollectionAssets + ".task_ids":
+		for _, a := range s.assets {
+			kept := a.TaskIDs[:0]
+			for _, id := range a.TaskIDs {
+				if id != taskID {
+					kept = append(kept, id)
+				}
+			}
+			if len(kept) != len(a.TaskIDs) {
+				n++
+			}
+			a.TaskIDs = kept
+		}
+	case models.CollectionAssets + ".first_task_id", models.CollectionAssets + ".last_task_id":
+		for _, a := range s.assets {
+			field := &a.FirstTaskID
+			if ref.Field == "last_task_id" {
+				field = &a.LastTaskID
+			}
+			if *field == taskID {
+				*field = primitive.NilObjectID
+				n++
+			}
+		}
+	case models.CollectionFindings + ".first_task_id", models.CollectionFindings + ".last_task_id":
+		for _, f := range s.findings {
+			field := &f.FirstTaskID
+			if ref.Field == "last_task_id" {
+				field = &f.LastTaskID
+			}
+			if *field == taskID {
+				*field = primitive.NilObjectID
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryPurgeStore) DeleteTask(ctx context.Context, taskID primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[taskID]; !ok {
+		return 0, nil
+	}
+	delete(s.tasks, taskID)
+	return 1, nil
+}
+
+func (s *memoryPurgeStore) InsertAudit(ctx context.Context, entry *models.OperationLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audits = append(s.audits, entry)
+	return nil
+}
+
+// addTaskLog 任务退出前写入的日志
+func (s *memoryPurgeStore) addTaskLog(taskID primitive.ObjectID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[models.CollectionTaskLogs] = append(s.data[models.CollectionTaskLogs], taskID)
+}
+
+// remaining 属于任务的所有数据和引用
+func (s *memoryPurgeStore) remaining(taskID primitive.ObjectID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, ids := range s.data {
+		for _, id := range ids {
+			if id == taskID {
+				n++
+			}
+		}
+	}
+	for _, run := range s.toolRuns {
+		if run.TaskID == taskID {
+			n++
+		}
+	}
+	for _, l := range s.cruiseLogs {
+		if l.TaskID == taskID {
+			n++
+		}
+	}
+	for _, a := range s.assets {
+		if a.FirstTaskID == taskID || a.LastTaskID == taskID {
+			n++
+		}
+		for _, id := range a.TaskIDs {
+			if id == taskID {
+				n++
+			}
+		}
+	}
+	for _, f := range s.findings {
+		if f.FirstTaskID == taskID || f.LastTaskID == taskID {
+			n++
+		}
+	}
+	for id, task := range s.tasks {
+		if id == taskID || task.ParentTaskID == taskID {
+			n++
+		}
+		for _, child := range task.ChildTaskIDs {
+			if child == taskID {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// seedPurgeTask 在每个集合中写入任务数据，另有一个无关任务用于确认不会误删
+func seedPurgeTask(t *testing.T, store *memoryPurgeStore, status models.TaskStatus) (*models.Task, *models.Task, []string) {
+	t.Helper()
+
+	parent := &models.Task{ID: primitive.NewObjectID(), Name: "parent", Status: models.TaskStatusCompleted}
+	task := &models.Task{ID: primitive.NewObjectID(), Name: "purge-me", Status: status, ParentTaskID: parent.ID}
+	child := &models.Task{ID: primitive.NewObjectID(), Name: "child", Status: models.TaskStatusCompleted, ParentTaskID: task.ID}
+	other := &models.Task{ID: primitive.NewObjectID(), Name: "other", Status: models.TaskStatusCompleted}
+	parent.ChildTaskIDs = []primitive.ObjectID{task.ID, other.ID}
+	task.ChildTaskIDs = []primitive.ObjectID{child.ID}
+	for _, tk := range []*models.Task{parent, task, child, other} {
+		store.tasks[tk.ID] = tk
+	}
+
+	for _, collection := range []string{models.CollectionScanResults, models.CollectionVulnerabilities, models.CollectionTaskLogs, models.CollectionTaskControls} {
+		store.data[collection] = []primitive.ObjectID{task.ID, task.ID, other.ID}
+	}
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"targets.txt", "ports.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("example.com\n"), 0644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+		files = append(files, path)
+	}
+	otherFile := filepath.Join(dir, "other.txt")
+	os.WriteFile(otherFile, []byte("other\n"), 0644)
+	store.toolRuns = []*models.ToolRun{
+		{TaskID: task.ID, Tool: "gogo", Inputs: []models.ToolRunInput{{Path: files[0]}, {Path: files[1]}}},
+		{TaskID: task.ID, Tool: "httpx"},
+		{TaskID: other.ID, Tool: "gogo", Inputs: []models.ToolRunInput{{Path: otherFile}}},
+	}
+	store.cruiseLogs = []*models.CruiseLog{{TaskID: task.ID}, {TaskID: other.ID}}
+	// 资产和漏洞跨任务合并：只解除对目标任务的引用
+	store.assets = []*models.Asset{
+		{Key: "a.example.com", TaskIDs: []primitive.ObjectID{task.ID, other.ID}, FirstTaskID: task.ID, LastTaskID: other.ID},
+		{Key: "b.example.com", TaskIDs: []primitive.ObjectID{other.ID}, FirstTaskID: other.ID, LastTaskID: other.ID},
+	}
+	store.findings = []*models.Finding{
+		{VulnID: "CVE-2021-44228", FirstTaskID: other.ID, LastTaskID: task.ID},
+		{VulnID: "CVE-2020-1938", FirstTaskID: other.ID, LastTaskID: other.ID},
+	}
+
+	return task, other, append(files, otherFile)
+}
+
+// fakeCanceller 模拟执行器：取消后任务在退出前还会写入日志
+type fakeCanceller struct {
+	store     *memoryPurgeStore
+	owned     bool
+	cancelled []string
+}
+
+func (c *fakeCanceller) CancelAndWait(taskID string, reason models.TerminationReason, timeout time.Duration) (bool, error) {
+	if !c.owned {
+		return false, nil
+	}
+	c.cancelled = append(c.cancelled, taskID+":"+string(reason))
+	id, _ := primitive.ObjectIDFromHex(taskID)
+	c.store.addTaskLog(id)
+	return true, nil
+}
+
+// TestTaskPurgeCleansEverything 清理所有集合和磁盘文件，引用被解除，重复执行结果为空
+func TestTaskPurgeCleansEverything(t *testing.T) {
+	printSeparator("任务清理测试")
+
+	store := newMemoryPurgeStore()
+	task, other, files := seedPurgeTask(t, store, models.TaskStatusRunning)
+	canceller := &fakeCanceller{store: store, owned: true}
+	opts := service.PurgeOptions{Canceller: canceller, Username: "admin"}
+
+	report, err := service.PurgeTask(context.Background(), store, task.ID.Hex(), opts)
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	if len(canceller.cancelled) != 1 || canceller.cancelled[0] != task.ID.Hex()+":"+string(models.TerminationDeleted) {
+		t.Errorf("运行中的任务应先被取消: %v", canceller.cancelled)
+	}
+	if n := store.remaining(task.ID); n != 0 {
+		t.Errorf("仍有 %d 条数据或引用属于任务", n)
+	}
+	want := map[string]int64{
+		models.CollectionScanResults:     2,
+		models.CollectionVulnerabilities: 2,
+		models.CollectionTaskLogs:        3, // 包括任务退出前写入的日志
+		models.CollectionTaskControls:    2,
+		models.CollectionToolRuns:        2,
+		models.CollectionTasks:           1,
+	}
+	for collection, n := range want {
+		if report.Deleted[collection] != n {
+			t.Errorf("%s 删除数量应为 %d, 实际 %d", collection, n, report.Deleted[collection])
+		}
+	}
+	if report.Detached[models.CollectionTasks+".child_task_ids"] != 1 || report.Detached[models.CollectionTasks+".parent_task_id"] != 1 || report.Detached[models.CollectionCruiseLogs+".task_id"] != 1 {
+		t.Errorf("引用解除数量不正确: %v", report.Detached)
+	}
+	for _, key := range []string{models.CollectionAssets + ".task_ids", models.CollectionAssets + ".first_task_id", models.CollectionFindings + ".last_task_id"} {
+		if report.Detached[key] != 1 {
+			t.Errorf("%s 应解除 1 条引用: %v", key, report.Detached)
+		}
+	}
+	if a := store.assets[0]; len(a.TaskIDs) != 1 || a.TaskIDs[0] != other.ID || a.LastTaskID != other.ID {
+		t.Errorf("资产应保留其他任务的引用: %+v", a)
+	}
+	if f := store.findings[0]; f.FirstTaskID != other.ID {
+		t.Errorf("漏洞应保留其他任务的引用: %+v", f)
+	}
+	if report.FilesRemoved != 2 {
+		t.Errorf("应删除 2 个文件, 实际 %d", report.FilesRemoved)
+	}
+	for _, path := range files[:2] {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("文件未删除: %s", path)
+		}
+	}
+
+	// 无关任务的数据保持不变，子任务和父任务只解除引用
+	if _, err := os.Stat(files[2]); err != nil {
+		t.Errorf("其他任务的文件不应删除")
+	}
+	if len(store.tasks) != 3 || store.tasks[other.ID] == nil {
+		t.Errorf("只应删除目标任务: %d", len(store.tasks))
+	}
+	for _, tk := range store.tasks {
+		if tk.Name == "parent" && (len(tk.ChildTaskIDs) != 1 || tk.ChildTaskIDs[0] != other.ID) {
+			t.Errorf("父任务的子任务列表应只移除目标任务: %v", tk.ChildTaskIDs)
+		}
+	}
+	if len(store.data[models.CollectionScanResults]) != 1 || len(store.toolRuns) != 1 || len(store.cruiseLogs) != 2 {
+		t.Errorf("其他任务的数据不应删除")
+	}
+
+	// 审计日志记录每个集合的数量
+	if len(store.audits) != 1 || store.audits[0].Action != service.PurgeAuditAction || store.audits[0].Target != task.ID.Hex() || store.audits[0].Username != "admin" {
+		t.Fatalf("审计日志不正确: %+v", store.audits)
+	}
+	var detail map[string]interface{}
+	if err := json.Unmarshal([]byte(store.audits[0].Detail), &detail); err != nil || detail["deleted"] == nil {
+		t.Errorf("审计日志应包含删除数量: %s", store.audits[0].Detail)
+	}
+
+	// 重复执行：没有可清理的数据，不报错
+	again, err := service.PurgeTask(context.Background(), store, task.ID.Hex(), opts)
+	if err != nil {
+		t.Fatalf("重复清理失败: %v", err)
+	}
+	if again.TaskDeleted || again.FilesRemoved != 0 {
+		t.Errorf("重复清理不应再删除数据: %+v", again)
+	}
+	for collection, n := range again.Deleted {
+		if n != 0 {
+			t.Errorf("重复清理 %s 删除了 %d 条", collection, n)
+		}
+	}
+	if len(store.audits) != 2 {
+		t.Errorf("每次清理都应写入审计日志")
+	}
+}
+
+// TestTaskPurgePartialFailure 中途失败时任务文档保留，重新执行完成清理
+func TestTaskPurgePartialFailure(t *testing.T) {
+	printSeparator("任务清理失败重试测试")
+
+	store := newMemoryPurgeStore()
+	task, _, _ := seedPurgeTask(t, store, models.TaskStatusCompleted)
+	store.failOnce = models.CollectionTaskLogs
+
+	if _, err := service.PurgeTask(context.Background(), store, task.ID.Hex(), service.PurgeOptions{}); err == nil {
+		t.Fatalf("清理应失败")
+	}
+	if store.tasks[task.ID] == nil {
+		t.Fatalf("失败时任务文档应保留")
+	}
+	// 工具调用记录在出错的集合之后，文件已删除但调用记录仍在，重试时不会报错
+	if len(store.toolRuns) != 3 {
+		t.Errorf("出错之后的集合不应被处理")
+	}
+
+	report, err := service.PurgeTask(context.Background(), store, task.ID.Hex(), service.PurgeOptions{})
+	if err != nil {
+		t.Fatalf("重试失败: %v", err)
+	}
+	if !report.TaskDeleted || store.remaining(task.ID) != 0 {
+		t.Errorf("重试后应完成清理: %+v remaining=%d", report, store.remaining(task.ID))
+	}
+}
+
+// TestTaskPurgeRunningElsewhere 任务在其他节点运行时只请求取消，不删除任何数据
+func TestTaskPurgeRunningElsewhere(t *testing.T) {
+	printSeparator("任务清理运行中测试")
+
+	store := newMemoryPurgeStore()
+	task, _, files := seedPurgeTask(t, store, models.TaskStatusRunning)
+
+	_, err := service.PurgeTask(context.Background(), store, task.ID.Hex(), service.PurgeOptions{Canceller: &fakeCanceller{store: store}})
+	if !errors.Is(err, service.ErrTaskStillRunning) {
+		t.Fatalf("应返回 ErrTaskStillRunning: %v", err)
+	}
+	if store.tasks[task.ID].Status != models.TaskStatusCancelled {
+		t.Errorf("任务应被标记为取消: %s", store.tasks[task.ID].Status)
+	}
+	if len(store.data[models.CollectionScanResults]) != 3 || len(store.audits) != 0 {
+		t.Errorf("任务退出前不应删除数据")
+	}
+	if _, err := os.Stat(files[0]); err != nil {
+		t.Errorf("任务退出前不应删除文件")
+	}
+
+	// 任务退出（状态不再是运行中）后可以清理
+	report, err := service.PurgeTask(context.Background(), store, task.ID.Hex(), service.PurgeOptions{})
+	if err != nil || !report.TaskDeleted {
+		t.Fatalf("任务退出后应能清理: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 孤儿任务恢复测试 ==========
+// 使用内存存储模拟任务文档、结果集合和节点心跳
+
+// memoryRecoveryStore 内存实现的恢复存储
+type memoryRecoveryStore struct {
+	mu        sync.Mutex
+	lockOwner string
+	tasks     map[primitive.ObjectID]*models.Task
+	results   map[primitive.ObjectID]int64
+	alive     map[string]bool
+	counts    map[primitive.ObjectID]int64 // FailTask 写入的 result_count
+	errors    map[primitive.ObjectID]string
+	queued    []string
+	queue     service.TaskQueueStore // 设置时重新入队的任务写入队列
+}
+
+func newMemoryRecoveryStore() *memoryRecoveryStore {
+	return &memoryRecoveryStore{
+		tasks:   make(map[primitive.ObjectID]*models.Task),
+		results: make(map[primitive.ObjectID]int64),
+		alive:   make(map[string]bool),
+		counts:  make(map[primitive.ObjectID]int64),
+		errors:  make(map[primitive.ObjectID]string),
+	}
+}
+
+func (s *memoryRecoveryStore) addTask(task *models.Task, results int64) {
+	task.ID = primitive.NewObjectID()
+	s.tasks[task.ID] = task
+	s.results[task.ID] = results
+}
+
+func (s *memoryRecoveryStore) AcquireLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockOwner != "" {
+		return false, nil
+	}
+	s.lockOwner = owner
+	return true, nil
+}
+
+func (s *memoryRecoveryStore) ReleaseLock(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockOwner == owner {
+		s.lockOwner = ""
+	}
+	return nil
+}
+
+func (s *memoryRecoveryStore) FindRunningTasks(ctx context.Context, startedBefore time.Time) ([]*models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tasks []*models.Task
+	for _, task := range s.tasks {
+		if task.Status == models.TaskStatusRunning && task.StartedAt.Before(startedBefore) {
+			cp := *task
+			tasks = append(tasks, &cp)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *memoryRecoveryStore) IsNodeAlive(ctx context.Context, nodeID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alive[nodeID], nil
+}
+
+func (s *memoryRecoveryStore) CountResults(ctx context.Context, taskID primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results[taskID], nil
+}
+
+func (s *memoryRecoveryStore) FailTask(ctx context.Context, taskID primitive.ObjectID, errMsg string, resultCount int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task := s.tasks[taskID]
+	if task == nil || task.Status != models.TaskStatusRunning {
+		return false, nil
+	}
+	task.Status = models.TaskStatusFailed
+	s.errors[taskID] = errMsg
+	s.counts[taskID] = resultCount
+	return true, nil
+}
+
+func (s *memoryRecoveryStore) RequeueTask(ctx context.Context, task *models.Task) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.tasks[task.ID]
+	if stored == nil || stored.Status != models.TaskStatusRunning || stored.NodeID != task.NodeID {
+		return false, nil
+	}
+	stored.Status = models.TaskStatusPending
+	stored.NodeID = ""
+	s.queued = append(s.queued, task.ID.Hex())
+	if s.queue != nil {
+		return true, service.EnqueueTaskID(ctx, s.queue, stored)
+	}
+	return true, nil
+}
+
+// TestTaskRecoveryOrphans 孤儿任务状态流转与结果数回填
+func TestTaskRecoveryOrphans(t *testing.T) {
+	printSeparator("孤儿任务恢复测试")
+
+	store := newMemoryRecoveryStore()
+	old := time.Now().Add(-time.Hour)
+
+	orphan := &models.Task{Status: models.TaskStatusRunning, StartedAt: old, NodeID: "executor-dead", Targets: []string{"a.com"}}
+	legacy := &models.Task{Status: models.TaskStatusRunning, StartedAt: old, Targets: []string{"b.com"}}
+	resumable := &models.Task{Status: models.TaskStatusRunning, StartedAt: old, NodeID: "executor-dead",
+		Targets: []string{"a.com", "b.com", "c.com"}, ResultStats: models.TaskResultStats{LastScannedIndex: 1}}
+	liveNode := &models.Task{Status: models.TaskStatusRunning, StartedAt: old, NodeID: "executor-live", Targets: []string{"c.com"}}
+	recent := &models.Task{Status: models.TaskStatusRunning, StartedAt: time.Now(), NodeID: "executor-dead", Targets: []string{"d.com"}}
+	completed := &models.Task{Status: models.TaskStatusCompleted, StartedAt: old, Targets: []string{"e.com"}}
+
+	store.addTask(orphan, 42)
+	store.addTask(legacy, 0)
+	store.addTask(resumable, 7)
+	store.addTask(liveNode, 3)
+	store.addTask(recent, 1)
+	store.addTask(completed, 5)
+	store.alive["executor-live"] = true
+
+	report, err := service.RecoverOrphanedTasks(context.Background(), store, service.RecoveryOptions{
+		NodeID:    "executor-new",
+		Threshold: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+
+	if orphan.Status != models.TaskStatusFailed || store.errors[orphan.ID] != service.OrphanInterruptedError {
+		t.Errorf("孤儿任务应标记失败: status=%s error=%q", orphan.Status, store.errors[orphan.ID])
+	}
+	if store.counts[orphan.ID] != 42 {
+		t.Errorf("result_count 应回填为实际结果数 42, 实际 %d", store.counts[orphan.ID])
+	}
+	if legacy.Status != models.TaskStatusFailed {
+		t.Errorf("未记录节点的孤儿任务应标记失败: %s", legacy.Status)
+	}
+	if resumable.Status != models.TaskStatusPending || len(store.queued) != 1 || store.queued[0] != resumable.ID.Hex() {
+		t.Errorf("有断点的任务应重新入队: status=%s queued=%v", resumable.Status, store.queued)
+	}
+	if liveNode.Status != models.TaskStatusRunning {
+		t.Errorf("存活节点上的任务不应被修改: %s", liveNode.Status)
+	}
+	if recent.Status != models.TaskStatusRunning {
+		t.Errorf("未超过阈值的任务不应被修改: %s", recent.Status)
+	}
+	if completed.Status != models.TaskStatusCompleted {
+		t.Errorf("已完成任务不应被修改: %s", completed.Status)
+	}
+	if len(report.Failed) != 2 || len(report.Requeued) != 1 || len(report.Skipped) != 1 {
+		t.Errorf("恢复报告不正确: %+v", report)
+	}
+
+	// 再次执行不产生任何变更
+	again, err := service.RecoverOrphanedTasks(context.Background(), store, service.RecoveryOptions{
+		NodeID:    "executor-new",
+		Threshold: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("重复恢复失败: %v", err)
+	}
+	if len(again.Failed) != 0 || len(again.Requeued) != 0 {
+		t.Errorf("重复执行应是幂等的: %+v", again)
+	}
+}
+
+// TestTaskRecoveryLock 其他实例持有锁时不执行恢复，且不处理本进程正在运行的任务
+func TestTaskRecoveryLock(t *testing.T) {
+	printSeparator("孤儿任务恢复锁测试")
+
+	store := newMemoryRecoveryStore()
+	task := &models.Task{Status: models.TaskStatusRunning, StartedAt: time.Now().Add(-time.Hour)}
+	store.addTask(task, 10)
+
+	store.lockOwner = "executor-other"
+	report, err := service.RecoverOrphanedTasks(context.Background(), store, service.RecoveryOptions{NodeID: "executor-new"})
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if len(report.Failed) != 0 || task.Status != models.TaskStatusRunning {
+		t.Errorf("未获取到锁时不应修改任务: %+v", report)
+	}
+
+	store.lockOwner = ""
+	report, _ = service.RecoverOrphanedTasks(context.Background(), store, service.RecoveryOptions{
+		NodeID:    "executor-new",
+		IsRunning: func(id string) bool { return id == task.ID.Hex() },
+	})
+	if len(report.Failed) != 0 || task.Status != models.TaskStatusRunning {
+		t.Errorf("本进程正在运行的任务不应被修改: %+v", report)
+	}
+	if store.lockOwner != "" {
+		t.Errorf("恢复结束后应释放锁")
+	}
+}
@@ -0,0 +1,219 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 断点续扫测试 ==========
+
+// memoryCheckpointStore 内存断点存储
+type memoryCheckpointStore struct {
+	checkpoint *models.TaskCheckpoint
+	results    []*models.ScanResult
+}
+
+func (s *memoryCheckpointStore) LoadCheckpoint(ctx context.Context, taskID primitive.ObjectID) (*models.TaskCheckpoint, error) {
+	return s.checkpoint, nil
+}
+
+func (s *memoryCheckpointStore) SaveCheckpoint(ctx context.Context, taskID primitive.ObjectID, entries []pipeline.CheckpointEntry, progress int) error {
+	return nil
+}
+
+func (s *memoryCheckpointStore) DeleteCheckpoint(ctx context.Context, taskID primitive.ObjectID) error {
+	s.checkpoint = nil
+	return nil
+}
+
+func (s *memoryCheckpointStore) LoadResults(ctx context.Context, taskID primitive.ObjectID, types []models.ResultType) ([]*models.ScanResult, error) {
+	var out []*models.ScanResult
+	for _, r := range s.results {
+		for _, t := range types {
+			if r.Type == t {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+// TestCheckpointConfirmAfterStored 目标输出的结果全部入库后才算完成
+func TestCheckpointConfirmAfterStored(t *testing.T) {
+	printSeparator("断点确认测试")
+
+	cp := pipeline.NewCheckpoint(nil)
+	www := pipeline.SubdomainResult{Host: "www.example.test", Domain: "example.test"}
+	api := pipeline.SubdomainResult{Host: "api.example.test", Domain: "example.test"}
+
+	// 模块处理完之前已入库一条
+	cp.Stored(www)
+	cp.Complete(pipeline.CheckpointSubdomainScan, "example.test", []string{"www.example.test", "api.example.test"})
+	if cp.Done(pipeline.CheckpointSubdomainScan, "example.test") || len(cp.TakeConfirmed()) != 0 {
+		t.Fatal("还有结果未入库时不应完成")
+	}
+	cp.Stored(api)
+	if !cp.Done(pipeline.CheckpointSubdomainScan, "example.test") {
+		t.Fatal("结果全部入库后应完成")
+	}
+	confirmed := cp.TakeConfirmed()
+	if len(confirmed) != 1 || confirmed[0] != (pipeline.CheckpointEntry{Module: pipeline.CheckpointSubdomainScan, Key: "example.test"}) {
+		t.Errorf("应取出新完成的目标: %+v", confirmed)
+	}
+	if len(cp.TakeConfirmed()) != 0 {
+		t.Error("已取出的目标不应重复返回")
+	}
+
+	// 没有输出端口的主机处理完即完成；端口未入库的主机不完成
+	cp.Complete(pipeline.CheckpointPortScan, "10.0.0.1", nil)
+	cp.Complete(pipeline.CheckpointPortScan, "10.0.0.2", []string{"10.0.0.2:22"})
+	cp.Stored(pipeline.PortAlive{Host: "10.0.0.2", Port: "80"})
+	if !cp.Done(pipeline.CheckpointPortScan, "10.0.0.1") || cp.Done(pipeline.CheckpointPortScan, "10.0.0.2") {
+		t.Errorf("端口主机完成状态不正确")
+	}
+
+	var nilCheckpoint *pipeline.Checkpoint
+	nilCheckpoint.Complete(pipeline.CheckpointPortScan, "10.0.0.1", nil)
+	if nilCheckpoint.Done(pipeline.CheckpointPortScan, "10.0.0.1") || nilCheckpoint.Resumed() {
+		t.Error("nil 断点不应记录")
+	}
+}
+
+// TestResumeReplaysCompletedTargets 已完成的根域名、主机不再扫描，输出之前保存的结果
+func TestResumeReplaysCompletedTargets(t *testing.T) {
+	printSeparator("断点重放测试")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cp := pipeline.NewCheckpoint(&pipeline.ResumeState{
+		Completed: []pipeline.CheckpointEntry{
+			{Module: pipeline.CheckpointSubdomainScan, Key: "example.test"},
+			{Module: pipeline.CheckpointPortScan, Key: "www.example.test"},
+		},
+		Subdomains: []pipeline.SubdomainResult{
+			{Host: "www.example.test", Domain: "example.test", IPs: []string{"192.0.2.10"}, Resolution: "resolved"},
+			{Host: "www.example.test", Domain: "example.test", IPs: []string{"192.0.2.10"}, Resolution: "resolved"},
+			{Host: "old.example.test", Domain: "example.test", Resolution: "nxdomain"},
+			{Host: "dr.example.test", Domain: "example.test", IPs: []string{"192.0.2.11"}, Excluded: true},
+		},
+		Ports: []pipeline.PortAlive{
+			{Host: "www.example.test", IP: "192.0.2.10", Port: "443", Service: "https"},
+		},
+		Progress: 40,
+	})
+	if !cp.Resumed() || cp.Progress() != 40 {
+		t.Fatalf("应从断点恢复")
+	}
+
+	// 子域名扫描
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewSubdomainScanModule(ctx, collector, 1, true)
+	module.SetCheckpoint(cp)
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- "example.test"
+	close(input)
+	module.ModuleRun()
+
+	var hosts []string
+	for len(out) > 0 {
+		if sr, ok := (<-out).(pipeline.SubdomainResult); ok {
+			hosts = append(hosts, sr.Host)
+		}
+	}
+	if len(hosts) != 1 || hosts[0] != "www.example.test" {
+		t.Errorf("应只重放去重后的可解析子域名: %v", hosts)
+	}
+
+	// 端口扫描
+	out = make(chan interface{}, 10)
+	collector = pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	ports := pipeline.NewPortScanModule(ctx, collector, "443", "quick")
+	ports.SetCheckpoint(cp)
+	input = make(chan interface{}, 1)
+	ports.SetInput(input)
+	input <- pipeline.DomainSkip{Domain: "www.example.test"}
+	close(input)
+	ports.ModuleRun()
+
+	var replayed []pipeline.PortAlive
+	for len(out) > 0 {
+		if pa, ok := (<-out).(pipeline.PortAlive); ok {
+			replayed = append(replayed, pa)
+		}
+	}
+	if len(replayed) != 1 || replayed[0].Port != "443" || replayed[0].Service != "https" {
+		t.Errorf("应重放之前保存的端口: %+v", replayed)
+	}
+	if ctx.Err() != nil {
+		t.Error("重放不应执行扫描")
+	}
+
+	// 进度从断点开始
+	tracker := pipeline.NewProgressTracker(1, nil)
+	tracker.SetBaseline(cp.Progress())
+	if p := tracker.GetOverallProgress(); p != 40 {
+		t.Errorf("恢复后进度应从 40 开始, 实际 %d", p)
+	}
+}
+
+// TestLoadResumeState 由断点和已保存的结果构建恢复输入，兼容从数据库读出的字段类型
+func TestLoadResumeState(t *testing.T) {
+	printSeparator("断点读取测试")
+
+	taskID := primitive.NewObjectID()
+	store := &memoryCheckpointStore{
+		checkpoint: &models.TaskCheckpoint{
+			TaskID: taskID,
+			Completed: map[string][]string{
+				pipeline.CheckpointSubdomainScan: {"example.test"},
+			},
+			Progress: 35,
+		},
+		results: []*models.ScanResult{
+			{Type: models.ResultTypeSubdomain, Source: "subfinder", Data: bson.M{
+				"subdomain":   "www.example.test",
+				"domain":      "example.test",
+				"ips":         primitive.A{"192.0.2.10"},
+				"status_code": int32(200),
+				"resolution":  "resolved",
+			}},
+			{Type: models.ResultTypePort, Data: bson.M{"host": "www.example.test", "port": "443"}},
+		},
+	}
+
+	state, err := service.LoadResumeState(context.Background(), store, taskID)
+	if err != nil {
+		t.Fatalf("读取断点失败: %v", err)
+	}
+	if state.Progress != 35 || len(state.Completed) != 1 {
+		t.Fatalf("断点内容不正确: %+v", state)
+	}
+	// 端口扫描没有完成的主机，不读取端口结果
+	if len(state.Ports) != 0 || len(state.Subdomains) != 1 {
+		t.Fatalf("只应读取已完成模块的结果: %+v", state)
+	}
+	sr := state.Subdomains[0]
+	if sr.Host != "www.example.test" || sr.RootDomain != "example.test" || len(sr.IPs) != 1 || sr.StatusCode != 200 || sr.Source != "subfinder" {
+		t.Errorf("子域名结果还原不正确: %+v", sr)
+	}
+
+	// 没有断点时返回空状态
+	store.DeleteCheckpoint(context.Background(), taskID)
+	state, err = service.LoadResumeState(context.Background(), store, taskID)
+	if err != nil || state == nil || len(state.Completed) != 0 {
+		t.Errorf("没有断点时应返回空状态: %+v, %v", state, err)
+	}
+}
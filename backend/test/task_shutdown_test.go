@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 执行器停止交接测试 ==========
+// 使用内存存储模拟任务文档和 Redis 任务队列
+
+// memoryShutdownStore 内存实现的交接存储
+type memoryShutdownStore struct {
+	mu     sync.Mutex
+	tasks  map[primitive.ObjectID]*models.Task
+	notes  map[primitive.ObjectID]string
+	queues map[string][]string
+}
+
+func newMemoryShutdownStore() *memoryShutdownStore {
+	return &memoryShutdownStore{
+		tasks:  make(map[primitive.ObjectID]*models.Task),
+		notes:  make(map[primitive.ObjectID]string),
+		queues: make(map[string][]string),
+	}
+}
+
+func (s *memoryShutdownStore) addTask(taskType models.TaskType, status models.TaskStatus) *models.Task {
+	task := &models.Task{ID: primitive.NewObjectID(), Type: taskType, Status: status, Targets: []string{"a.example.com", "b.example.com"}}
+	cp := *task
+	s.tasks[task.ID] = &cp
+	return task
+}
+
+func (s *memoryShutdownStore) RequeueInterrupted(ctx context.Context, task *models.Task, note string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.tasks[task.ID]
+	if stored == nil || stored.Status != models.TaskStatusRunning {
+		return false, nil
+	}
+	stored.Status = models.TaskStatusPending
+	stored.Resume = true
+	s.notes[task.ID] = note
+	queueKey := "task:queue:" + string(task.Type)
+	s.queues[queueKey] = append(s.queues[queueKey], task.ID.Hex())
+	return true, nil
+}
+
+// startLongPipeline 启动一个卡在指纹识别模块的流水线，结果收集循环退出前写入 CDN 信息
+func startLongPipeline(t *testing.T, flushed *bool) service.ShutdownTask {
+	t.Helper()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	config := &pipeline.PipelineConfig{
+		Fingerprint: true,
+		Faults:      &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{{Module: "Fingerprint", Stall: time.Minute}}},
+	}
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, 2, nil)
+	if err := pipe.Start([]string{"a.example.com", "b.example.com"}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range pipe.Results() {
+		}
+		*flushed = true
+	}()
+	return service.ShutdownTask{
+		Cancel: func() {
+			cancel(service.CancelCause(models.TerminationWorkerShutdown))
+			pipe.Stop()
+		},
+		Done: done,
+	}
+}
+
+// TestShutdownRequeuesRunningTasks 停止时取消流水线，等待收集循环退出后改回 Pending 并重新入队
+func TestShutdownRequeuesRunningTasks(t *testing.T) {
+	printSeparator("执行器停止交接测试")
+
+	store := newMemoryShutdownStore()
+	var flushed bool
+	running := startLongPipeline(t, &flushed)
+	running.Task = store.addTask(models.TaskTypeFull, models.TaskStatusRunning)
+
+	// 停止前已被用户暂停的任务
+	paused := service.ShutdownTask{Task: store.addTask(models.TaskTypeSubdomain, models.TaskStatusPaused)}
+	closed := make(chan struct{})
+	close(closed)
+	paused.Done = closed
+
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	report := service.ShutdownRunningTasks(context.Background(), []service.ShutdownTask{running, paused}, store, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("流水线取消后应很快退出, 耗时 %v", elapsed)
+	}
+
+	if !flushed {
+		t.Error("重新入队前应等待结果收集循环处理完")
+	}
+	if len(report.Requeued) != 1 || report.Requeued[0] != running.Task.ID.Hex() || len(report.TimedOut) != 0 {
+		t.Errorf("运行中的任务应重新入队: %+v", report)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0] != paused.Task.ID.Hex() {
+		t.Errorf("已暂停的任务应跳过: %+v", report)
+	}
+
+	stored := store.tasks[running.Task.ID]
+	if stored.Status != models.TaskStatusPending || !stored.Resume || store.notes[running.Task.ID] == "" {
+		t.Errorf("任务应改回 Pending 并带断点续扫标记和进度说明: %+v", stored)
+	}
+	if q := store.queues["task:queue:full"]; len(q) != 1 || q[0] != running.Task.ID.Hex() {
+		t.Errorf("任务应重新推入对应类型的队列: %v", store.queues)
+	}
+	if store.tasks[paused.Task.ID].Status != models.TaskStatusPaused || len(store.queues["task:queue:subdomain"]) != 0 {
+		t.Error("已暂停的任务应保持原状态且不入队")
+	}
+}
+
+// TestShutdownTimeout 超过等待时间仍未退出的任务同样重新入队
+func TestShutdownTimeout(t *testing.T) {
+	printSeparator("执行器停止超时测试")
+
+	store := newMemoryShutdownStore()
+	stuck := service.ShutdownTask{
+		Task: store.addTask(models.TaskTypePortScan, models.TaskStatusRunning),
+		Done: make(chan struct{}), // 收集循环一直不退出
+	}
+
+	start := time.Now()
+	report := service.ShutdownRunningTasks(context.Background(), []service.ShutdownTask{stuck}, store, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("等待应在超时后结束, 耗时 %v", elapsed)
+	}
+	if len(report.TimedOut) != 1 || len(report.Requeued) != 1 {
+		t.Errorf("超时的任务应记录并重新入队: %+v", report)
+	}
+	if !contains(store.notes[stuck.Task.ID], "超时") || len(store.queues["task:queue:port_scan"]) != 1 {
+		t.Errorf("进度说明应注明等待超时: %q %v", store.notes[stuck.Task.ID], store.queues)
+	}
+}
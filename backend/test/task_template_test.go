@@ -0,0 +1,240 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务模板测试 ==========
+
+// memoryTemplateStore 内存中的模板存储，按标识去重
+type memoryTemplateStore struct {
+	mu        sync.Mutex
+	templates map[string]*models.TaskTemplate
+}
+
+func (s *memoryTemplateStore) EnsureBuiltIn(ctx context.Context, template *models.TaskTemplate) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.templates == nil {
+		s.templates = make(map[string]*models.TaskTemplate)
+	}
+	if _, ok := s.templates[template.Key]; ok {
+		return false, nil
+	}
+	s.templates[template.Key] = template
+	return true, nil
+}
+
+// TestTaskTemplateMergePrecedence 任务指定的值优先，其次模板，都未设置时为默认值
+func TestTaskTemplateMergePrecedence(t *testing.T) {
+	printSeparator("模板合并优先级测试")
+
+	wsID := primitive.NewObjectID()
+	notify := true
+	template := &models.TaskTemplate{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: wsID,
+		Name:        "内网巡检",
+		Description: "模板描述",
+		Type:        models.TaskTypeCustom,
+		Priority:    models.TaskPriorityHigh,
+		Tags:        []string{"internal"},
+		Config: models.TaskConfig{
+			ScanTypes:        []string{"port_scan", "fingerprint"},
+			PortScanMode:     "top1000",
+			Threads:          20,
+			CustomHeaders:    map[string]string{"Authorization": "Bearer a", "X-Team": "red"},
+			NotifyOnComplete: &notify,
+		},
+	}
+
+	task, err := service.NewTaskFromTemplate(template, service.TemplateTaskRequest{
+		WorkspaceID: wsID,
+		Name:        "巡检-1",
+		Targets:     []string{"10.0.0.1"},
+		TargetType:  "ip",
+		Config:      json.RawMessage(`{"port_scan_mode":"quick","custom_headers":{"Authorization":"Bearer b"},"notify_on_complete":false}`),
+	})
+	if err != nil {
+		t.Fatalf("从模板创建任务失败: %v", err)
+	}
+
+	// 任务指定
+	if task.Name != "巡检-1" || task.Config.PortScanMode != "quick" {
+		t.Errorf("任务指定的值应优先: name=%s port_scan_mode=%s", task.Name, task.Config.PortScanMode)
+	}
+	if task.Config.NotifyOnComplete == nil || *task.Config.NotifyOnComplete {
+		t.Error("任务指定的 notify_on_complete=false 应覆盖模板")
+	}
+	if task.Config.CustomHeaders["Authorization"] != "Bearer b" || task.Config.CustomHeaders["X-Team"] != "red" {
+		t.Errorf("请求头应按键合并: %v", task.Config.CustomHeaders)
+	}
+	// 模板
+	if task.Type != models.TaskTypeCustom || task.Priority != models.TaskPriorityHigh || task.Config.Threads != 20 {
+		t.Errorf("未指定的字段应使用模板的值: type=%s priority=%s threads=%d", task.Type, task.Priority, task.Config.Threads)
+	}
+	if task.Description != "模板描述" || len(task.Tags) != 1 || task.Tags[0] != "internal" {
+		t.Errorf("描述和标签应来自模板: %q %v", task.Description, task.Tags)
+	}
+	if len(task.Config.ScanTypes) != 2 {
+		t.Errorf("扫描类型应来自模板: %v", task.Config.ScanTypes)
+	}
+	// 默认值
+	if task.Config.Timeout != 0 || task.Config.MaxTargets != 0 {
+		t.Errorf("模板和任务都未设置的字段应为默认值: timeout=%d max_targets=%d", task.Config.Timeout, task.Config.MaxTargets)
+	}
+	if task.TemplateID != template.ID || task.ResultStats.TotalTargets != 1 {
+		t.Errorf("任务应记录模板和目标数: template=%s total=%d", task.TemplateID.Hex(), task.ResultStats.TotalTargets)
+	}
+
+	// 未指定优先级且模板也没有时使用默认优先级
+	template.Priority = ""
+	task, err = service.NewTaskFromTemplate(template, service.TemplateTaskRequest{Name: "巡检-2", Targets: []string{"10.0.0.2"}})
+	if err != nil {
+		t.Fatalf("从模板创建任务失败: %v", err)
+	}
+	if task.Priority != service.NormalizeTaskPriority("") || task.WorkspaceID != wsID {
+		t.Errorf("优先级应为默认值、工作空间应来自模板: priority=%s workspace=%s", task.Priority, task.WorkspaceID.Hex())
+	}
+
+	t.Logf("合并结果: %+v", task.Config)
+}
+
+// TestTaskTemplateCopy 任务保存模板配置的副本，修改模板不影响已创建的任务
+func TestTaskTemplateCopy(t *testing.T) {
+	printSeparator("模板配置复制测试")
+
+	template := &models.TaskTemplate{
+		Type: models.TaskTypeCustom,
+		Config: models.TaskConfig{
+			ScanTypes:     []string{"subdomain", "port_scan"},
+			CustomHeaders: map[string]string{"X-Team": "red"},
+			ExcludeList:   []string{"*.gov.cn"},
+		},
+	}
+	task, err := service.NewTaskFromTemplate(template, service.TemplateTaskRequest{Name: "t", Targets: []string{"example.com"}})
+	if err != nil {
+		t.Fatalf("从模板创建任务失败: %v", err)
+	}
+
+	template.Config.ScanTypes[0] = "crawler"
+	template.Config.CustomHeaders["X-Team"] = "blue"
+	template.Config.ExcludeList = append(template.Config.ExcludeList[:0], "*.edu.cn")
+
+	if task.Config.ScanTypes[0] != "subdomain" || task.Config.CustomHeaders["X-Team"] != "red" || task.Config.ExcludeList[0] != "*.gov.cn" {
+		t.Errorf("修改模板后任务配置不应变化: %+v", task.Config)
+	}
+
+	copied := service.CopyTaskConfig(template.Config)
+	copied.CustomHeaders["X-Team"] = "green"
+	if template.Config.CustomHeaders["X-Team"] != "blue" {
+		t.Error("CopyTaskConfig 的副本不应与原配置共用 map")
+	}
+
+	if _, err := service.MergeTaskConfig(template.Config, json.RawMessage(`{"threads":"many"}`)); err == nil {
+		t.Error("类型错误的覆盖配置应返回错误")
+	}
+}
+
+// TestTaskTemplateWorkspace 非公开模板只能在所属工作空间使用
+func TestTaskTemplateWorkspace(t *testing.T) {
+	printSeparator("模板工作空间测试")
+
+	template := &models.TaskTemplate{WorkspaceID: primitive.NewObjectID(), Type: models.TaskTypeFull}
+	req := service.TemplateTaskRequest{WorkspaceID: primitive.NewObjectID(), Name: "t", Targets: []string{"example.com"}}
+
+	if _, err := service.NewTaskFromTemplate(template, req); err == nil {
+		t.Error("其他工作空间的非公开模板应拒绝")
+	}
+
+	template.IsPublic = true
+	task, err := service.NewTaskFromTemplate(template, req)
+	if err != nil {
+		t.Fatalf("公开模板应可在任意工作空间使用: %v", err)
+	}
+	if task.WorkspaceID != req.WorkspaceID {
+		t.Errorf("任务应属于请求的工作空间: %s", task.WorkspaceID.Hex())
+	}
+}
+
+// TestBuiltInTemplatesSeed 内置模板补齐可重复执行，已存在时不重复写入
+func TestBuiltInTemplatesSeed(t *testing.T) {
+	printSeparator("内置模板补齐测试")
+
+	store := &memoryTemplateStore{}
+	created, err := service.SeedBuiltInTemplates(context.Background(), store)
+	if err != nil {
+		t.Fatalf("补齐内置模板失败: %v", err)
+	}
+	want := len(service.BuiltInTaskTemplates())
+	if created != want || want != 3 {
+		t.Fatalf("首次应写入 3 个内置模板，实际 %d/%d", created, want)
+	}
+
+	created, err = service.SeedBuiltInTemplates(context.Background(), store)
+	if err != nil {
+		t.Fatalf("再次补齐内置模板失败: %v", err)
+	}
+	if created != 0 || len(store.templates) != want {
+		t.Errorf("再次补齐不应写入: created=%d total=%d", created, len(store.templates))
+	}
+
+	for _, key := range []string{service.TemplateQuickRecon, service.TemplateFullAudit, service.TemplateWebOnly} {
+		template := store.templates[key]
+		if template == nil {
+			t.Errorf("缺少内置模板 %s", key)
+			continue
+		}
+		if !template.BuiltIn || !template.IsPublic || template.CreatedAt.IsZero() {
+			t.Errorf("内置模板 %s 应为只读公开模板: %+v", key, template)
+		}
+	}
+
+	// 删除一个后只补齐缺失的
+	delete(store.templates, service.TemplateWebOnly)
+	created, _ = service.SeedBuiltInTemplates(context.Background(), store)
+	if created != 1 {
+		t.Errorf("应只补齐缺失的 1 个模板，实际 %d", created)
+	}
+}
+
+// TestBuiltInTemplatesValid 内置模板通过与创建任务相同的配置校验，所选模块都能识别
+func TestBuiltInTemplatesValid(t *testing.T) {
+	printSeparator("内置模板校验测试")
+
+	for _, template := range service.BuiltInTaskTemplates() {
+		if err := service.ValidateTaskConfig(&template.Config); err != nil {
+			t.Errorf("内置模板 %s 配置无效: %v", template.Key, err)
+		}
+		report := service.CheckTaskCapabilities(core.NewToolsManager(), &models.Task{Type: template.Type, Config: template.Config})
+		if len(report.Modules) == 0 {
+			t.Errorf("内置模板 %s 没有启用的模块: %v", template.Key, report.Warnings)
+		}
+		for _, w := range report.Warnings {
+			if strings.Contains(w, "未知") || strings.Contains(w, "自动启用") {
+				t.Errorf("内置模板 %s: %s", template.Key, w)
+			}
+		}
+		t.Logf("%s: %d 个模块, 警告 %v", template.Key, len(report.Modules), report.Warnings)
+	}
+
+	// 无效配置在模板保存和从模板创建任务时同样被拒绝
+	bad := models.TaskConfig{VulnRateLimit: -1}
+	if err := service.ValidateTaskConfig(&bad); err == nil {
+		t.Error("负数速率应校验失败")
+	}
+	bad = models.TaskConfig{ExcludeList: []string{core.RegexPatternPrefix + "("}}
+	if err := service.ValidateTaskConfig(&bad); err == nil {
+		t.Error("无效的排除规则应校验失败")
+	}
+}
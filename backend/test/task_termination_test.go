@@ -0,0 +1,190 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 任务结束原因测试 ==========
+// 仅启用指纹识别模块，通过故障注入、时间上限和取消原因驱动每条结束路径
+
+// runTerminationPipeline 运行流水线直到结束，返回执行器在结束时看到的状态
+func runTerminationPipeline(t *testing.T, ctx context.Context, config *pipeline.PipelineConfig, afterStart func()) service.TaskEnd {
+	t.Helper()
+
+	config.Fingerprint = true
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, 1, nil)
+	if err := pipe.Start([]string{"a.example.com", "b.example.com"}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+	if afterStart != nil {
+		afterStart()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range pipe.Results() {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatalf("流水线未结束")
+	}
+
+	return service.TaskEnd{
+		CancelReason: service.CancelReason(ctx),
+		Status:       models.TaskStatusRunning,
+		Err:          pipe.Err(),
+		FailedModule: pipe.FailedModule(),
+		Report:       pipe.GetProgressReport(),
+	}
+}
+
+// TestTaskTerminationPipelinePaths 完成、超时、模块异常、用户取消、执行器停止各自记录对应的原因
+func TestTaskTerminationPipelinePaths(t *testing.T) {
+	printSeparator("任务结束原因测试")
+
+	stall := func(module string) *pipeline.FaultConfig {
+		return &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{{Module: module, Stall: 10 * time.Second}}}
+	}
+
+	t.Run("completed", func(t *testing.T) {
+		end := runTerminationPipeline(t, context.Background(), &pipeline.PipelineConfig{}, nil)
+		term := service.ClassifyTermination(end)
+		if term == nil || term.Reason != models.TerminationCompleted || term.Progress != 100 {
+			t.Errorf("正常结束应记录 completed: %+v", term)
+		}
+	})
+
+	t.Run("deadline_exceeded", func(t *testing.T) {
+		end := runTerminationPipeline(t, context.Background(), &pipeline.PipelineConfig{
+			TimeLimit: 300 * time.Millisecond,
+			Faults:    stall("Fingerprint"),
+		}, nil)
+		term := service.ClassifyTermination(end)
+		if term == nil || term.Reason != models.TerminationDeadlineExceeded {
+			t.Fatalf("超过时间上限应记录 deadline_exceeded: %+v", term)
+		}
+		if term.Module != "Fingerprint" || term.ProgressDetails == nil || !contains(term.Message, "时间上限") {
+			t.Errorf("超时应记录当时运行的模块和进度快照: %+v", term)
+		}
+	})
+
+	t.Run("module_failure", func(t *testing.T) {
+		end := runTerminationPipeline(t, context.Background(), &pipeline.PipelineConfig{
+			WatchdogTimeout: 200 * time.Millisecond,
+			Faults:          &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{{Module: "ResultCollector", PanicAfter: 1}}},
+		}, nil)
+		term := service.ClassifyTermination(end)
+		if term == nil || term.Reason != models.TerminationModuleFailure {
+			t.Fatalf("模块 panic 应记录 module_failure: %+v", term)
+		}
+		if term.Module != "ResultCollector" || !contains(term.Message, "panic") || term.ProgressDetails == nil {
+			t.Errorf("模块异常应记录出错的模块和进度快照: %+v", term)
+		}
+	})
+
+	for _, reason := range []models.TerminationReason{models.TerminationUserCancel, models.TerminationWorkerShutdown} {
+		reason := reason
+		t.Run(string(reason), func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			end := runTerminationPipeline(t, ctx, &pipeline.PipelineConfig{Faults: stall("Fingerprint")}, func() {
+				time.Sleep(50 * time.Millisecond)
+				cancel(service.CancelCause(reason))
+			})
+			term := service.ClassifyTermination(end)
+			if term == nil || term.Reason != reason {
+				t.Errorf("取消原因应为 %s: %+v", reason, term)
+			}
+		})
+	}
+}
+
+// TestTaskWatchdogStalledTask 执行器按任务配置启用看门狗，模块卡死的任务记录为 module_failure，执行器据此将任务置为失败
+func TestTaskWatchdogStalledTask(t *testing.T) {
+	printSeparator("任务看门狗测试")
+
+	task := &models.Task{Type: models.TaskTypeFingerprint, Config: models.TaskConfig{WatchdogTimeout: 200}}
+	config := &pipeline.PipelineConfig{
+		TimeoutUnit: time.Millisecond,
+		Faults:      &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{{Module: "Fingerprint", Stall: 10 * time.Second}}},
+	}
+	service.ApplyTaskTimeouts(config, task)
+	if config.WatchdogTimeout != 200*time.Millisecond {
+		t.Fatalf("看门狗超时应按任务配置设置: %v", config.WatchdogTimeout)
+	}
+
+	start := time.Now()
+	end := runTerminationPipeline(t, context.Background(), config, nil)
+	term := service.ClassifyTermination(end)
+	if term == nil || term.Reason != models.TerminationModuleFailure {
+		t.Fatalf("卡死的任务应记录 module_failure: %+v", term)
+	}
+	if term.Module != "Fingerprint" || !contains(term.Message, "stalled") {
+		t.Errorf("应记录卡死的模块和看门狗诊断: %+v", term)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("看门狗应在停顿结束前终止任务, 实际耗时 %v", elapsed)
+	}
+}
+
+// TestTaskTerminationClassify 数据库状态优先级：删除 > 执行器取消原因 > 用户取消状态 > 流水线错误 > 完成
+func TestTaskTerminationClassify(t *testing.T) {
+	printSeparator("任务结束原因判定测试")
+
+	tlErr := &pipeline.TimeLimitError{Limit: time.Minute, Module: "PortScan"}
+	cases := []struct {
+		name   string
+		end    service.TaskEnd
+		reason models.TerminationReason
+		module string
+	}{
+		{"deleted", service.TaskEnd{Deleted: true, CancelReason: models.TerminationDeleted}, models.TerminationDeleted, ""},
+		{"deleted_without_cause", service.TaskEnd{Deleted: true, Err: tlErr}, models.TerminationDeleted, ""},
+		{"cancel_cause", service.TaskEnd{CancelReason: models.TerminationWorkerShutdown, Status: models.TaskStatusRunning, Err: errors.New("stopped")}, models.TerminationWorkerShutdown, ""},
+		{"cancelled_status", service.TaskEnd{Status: models.TaskStatusCancelled}, models.TerminationUserCancel, ""},
+		{"time_limit", service.TaskEnd{Status: models.TaskStatusRunning, Err: tlErr}, models.TerminationDeadlineExceeded, "PortScan"},
+		{"pipeline_error", service.TaskEnd{Status: models.TaskStatusRunning, Err: errors.New("pipeline stalled"), FailedModule: "VulnScan"}, models.TerminationModuleFailure, "VulnScan"},
+		{"completed", service.TaskEnd{Status: models.TaskStatusRunning}, models.TerminationCompleted, ""},
+	}
+	for _, c := range cases {
+		term := service.ClassifyTermination(c.end)
+		if term == nil || term.Reason != c.reason || term.Module != c.module {
+			t.Errorf("%s: 期望 %s/%s, 实际 %+v", c.name, c.reason, c.module, term)
+		}
+	}
+
+	// 暂停不是结束
+	if term := service.ClassifyTermination(service.TaskEnd{Status: models.TaskStatusPaused}); term != nil {
+		t.Errorf("暂停的任务不应记录结束原因: %+v", term)
+	}
+
+	// 未被取消或普通取消的上下文没有结束原因
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if reason := service.CancelReason(ctx); reason != "" {
+		t.Errorf("普通取消不应带有结束原因: %s", reason)
+	}
+}
+
+// TestTaskTerminationListFilter 任务列表可以按结束原因过滤
+func TestTaskTerminationListFilter(t *testing.T) {
+	printSeparator("按结束原因过滤任务测试")
+
+	filter := service.TaskListFilter{Status: string(models.TaskStatusFailed), TerminationReason: string(models.TerminationDeadlineExceeded)}.BSON()
+	if filter["termination_reason"] != string(models.TerminationDeadlineExceeded) || filter["status"] != string(models.TaskStatusFailed) {
+		t.Errorf("过滤条件不正确: %v", filter)
+	}
+	if _, ok := (service.TaskListFilter{}).BSON()["termination_reason"]; ok {
+		t.Errorf("未指定结束原因时不应过滤")
+	}
+}
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 任务时间上限测试 ==========
+// 使用缩短的时间上限，配合故障注入的停顿模拟长时间运行的模块
+
+// TestTaskTimeLimitPerType 按任务类型获取时间上限，任务覆盖值限制在管理员设置的范围内
+func TestTaskTimeLimitPerType(t *testing.T) {
+	printSeparator("任务类型时间上限测试")
+
+	limits := service.DefaultTaskTimeLimits()
+
+	cases := []struct {
+		task *models.Task
+		want time.Duration
+	}{
+		{&models.Task{Type: models.TaskTypeFingerprint}, 2 * time.Hour},
+		{&models.Task{Type: models.TaskTypePortScan}, 8 * time.Hour},
+		{&models.Task{Type: models.TaskTypeFull}, 48 * time.Hour},
+		{&models.Task{Type: models.TaskTypeCrawler}, service.DefaultTaskTimeLimit},
+		{&models.Task{Type: models.TaskTypeFull, Config: models.TaskConfig{TimeLimit: 90}}, 90 * time.Minute},
+		{&models.Task{Type: models.TaskTypeFull, Config: models.TaskConfig{TimeLimit: 1}}, limits.MinOverride},
+		{&models.Task{Type: models.TaskTypeFull, Config: models.TaskConfig{TimeLimit: 100000}}, limits.MaxOverride},
+	}
+	for _, c := range cases {
+		if got := limits.LimitFor(c.task); got != c.want {
+			t.Errorf("%s (time_limit=%d): 期望 %v, 实际 %v", c.task.Type, c.task.Config.TimeLimit, c.want, got)
+		}
+	}
+
+	if err := limits.ValidateOverride(0); err != nil {
+		t.Errorf("0 表示使用默认值, 不应报错: %v", err)
+	}
+	if err := limits.ValidateOverride(60); err != nil {
+		t.Errorf("范围内的覆盖值不应报错: %v", err)
+	}
+	for _, minutes := range []int{-1, 1, 100000} {
+		if err := limits.ValidateOverride(minutes); err == nil {
+			t.Errorf("覆盖值 %d 应校验失败", minutes)
+		}
+	}
+}
+
+// TestTaskWatchdogTimeout 未设置看门狗超时时使用默认值并长于模块超时，设置值必须长于最长的模块超时
+func TestTaskWatchdogTimeout(t *testing.T) {
+	printSeparator("看门狗超时配置测试")
+
+	cases := []struct {
+		config models.TaskConfig
+		want   int
+	}{
+		{models.TaskConfig{}, pipeline.DefaultWatchdogTimeoutMinutes},
+		{models.TaskConfig{ModuleTimeouts: map[string]int{"Crawler": 30}}, pipeline.DefaultWatchdogTimeoutMinutes},
+		{models.TaskConfig{ModuleTimeouts: map[string]int{"Crawler": 120}}, 150},
+		{models.TaskConfig{WatchdogTimeout: 75}, 75},
+	}
+	for _, c := range cases {
+		if got := service.WatchdogTimeoutFor(c.config); got != c.want {
+			t.Errorf("%+v: 期望 %d 分钟, 实际 %d", c.config, c.want, got)
+		}
+	}
+
+	config := &pipeline.PipelineConfig{}
+	service.ApplyTaskTimeouts(config, &models.Task{Type: models.TaskTypeFull})
+	if config.WatchdogTimeout != pipeline.DefaultWatchdogTimeoutMinutes*time.Minute || config.TimeLimit != 48*time.Hour {
+		t.Errorf("执行器应启用默认看门狗: watchdog=%v limit=%v", config.WatchdogTimeout, config.TimeLimit)
+	}
+
+	for _, bad := range []models.TaskConfig{
+		{WatchdogTimeout: -1},
+		{WatchdogTimeout: 30},
+		{WatchdogTimeout: 100, ModuleTimeouts: map[string]int{"DirScan": 100}},
+	} {
+		if err := service.ValidateTaskConfig(&bad); err == nil {
+			t.Errorf("看门狗超时 %d (模块超时 %v) 应校验失败", bad.WatchdogTimeout, bad.ModuleTimeouts)
+		}
+	}
+	if err := service.ValidateTaskConfig(&models.TaskConfig{WatchdogTimeout: 120, ModuleTimeouts: map[string]int{"DirScan": 100}}); err != nil {
+		t.Errorf("长于模块超时的看门狗超时不应报错: %v", err)
+	}
+}
+
+// TestTaskModuleTimeoutValidation 模块超时只能按流水线的模块名称设置，值必须大于 0
+func TestTaskModuleTimeoutValidation(t *testing.T) {
+	printSeparator("模块超时配置校验测试")
+
+	valid := map[string]int{"SubdomainScan": 30, "PortScan": 60, "Fingerprint": 10, "Crawler": 45, "DirScan": 20, "VulnScan": 90}
+	if err := service.ValidateTaskConfig(&models.TaskConfig{ModuleTimeouts: valid}); err != nil {
+		t.Errorf("有效的模块超时不应报错: %v", err)
+	}
+	for _, bad := range []map[string]int{
+		{"portscan": 30},
+		{"Nuclei": 30},
+		{"Crawler": 0},
+		{"DirScan": -5},
+	} {
+		if err := service.ValidateTaskConfig(&models.TaskConfig{ModuleTimeouts: bad}); err == nil {
+			t.Errorf("模块超时 %v 应校验失败", bad)
+		}
+	}
+}
+
+// runTimeLimitPipeline 运行带时间上限的流水线，返回超时预警时的进度报告
+func runTimeLimitPipeline(t *testing.T, limit, stall time.Duration) ([]*pipeline.ProgressReport, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config := &pipeline.PipelineConfig{
+		Fingerprint: true,
+		TimeLimit:   limit,
+		Faults: &pipeline.FaultConfig{Faults: []pipeline.ModuleFault{
+			{Module: "Fingerprint", Stall: stall},
+		}},
+	}
+
+	var mu sync.Mutex
+	var warnings []*pipeline.ProgressReport
+	pipe := pipeline.NewStreamingPipelineWithProgress(ctx, nil, config, 1, nil)
+	pipe.SetOverrunHandler(func(elapsed, limit time.Duration, report *pipeline.ProgressReport) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, report)
+	})
+
+	if err := pipe.Start([]string{"a.example.com"}); err != nil {
+		t.Fatalf("Failed to start pipeline: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range pipe.Results() {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatalf("流水线未在时间上限后结束")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return warnings, pipe.Err()
+}
+
+// TestTaskTimeLimitOverrunWarning 超过时间上限的 80% 时触发预警，任务仍可正常完成
+func TestTaskTimeLimitOverrunWarning(t *testing.T) {
+	printSeparator("超时预警测试")
+
+	warnings, err := runTimeLimitPipeline(t, 2*time.Second, 1800*time.Millisecond)
+	if err != nil {
+		t.Fatalf("未超过时间上限, 不应报错: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("期望 1 次超时预警, 实际 %d", len(warnings))
+	}
+	if report := warnings[0]; report == nil || !report.OverrunWarning || report.TimeLimit == "" {
+		t.Errorf("预警时的进度报告应标记 overrun_warning: %+v", report)
+	}
+}
+
+// TestTaskTimeLimitExceeded 到达时间上限时失败信息包含当时运行的模块和进度
+func TestTaskTimeLimitExceeded(t *testing.T) {
+	printSeparator("超过时间上限测试")
+
+	warnings, err := runTimeLimitPipeline(t, 300*time.Millisecond, 10*time.Second)
+	if len(warnings) != 1 {
+		t.Errorf("超时前应触发 1 次预警, 实际 %d", len(warnings))
+	}
+
+	var tlErr *pipeline.TimeLimitError
+	if !errors.As(err, &tlErr) {
+		t.Fatalf("期望 TimeLimitError, 实际 %v", err)
+	}
+	if tlErr.Module != "Fingerprint" || tlErr.Progress == nil {
+		t.Errorf("超时信息应包含运行中的模块和进度: %+v", tlErr)
+	}
+
+	msg := tlErr.Error()
+	for _, want := range []string{"时间上限", "Fingerprint", "已处理", "总体进度"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("失败信息缺少 %q: %s", want, msg)
+		}
+	}
+	fmt.Printf("失败信息: %s\n", msg)
+}
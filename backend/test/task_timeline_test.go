@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 任务时间线测试 ==========
+
+// memoryTimelineStore 内存时间线存储，记录批量写入次数
+type memoryTimelineStore struct {
+	mu     sync.Mutex
+	events []*models.TaskEvent
+	writes int
+}
+
+func (s *memoryTimelineStore) InsertTaskEvents(ctx context.Context, events []*models.TaskEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memoryTimelineStore) TaskEvents(ctx context.Context, taskID primitive.ObjectID) ([]*models.TaskEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.TaskEvent(nil), s.events...), nil
+}
+
+// TestTaskTimelineSampling 爬虫结果超过阈值后按量采样，漏洞逐条记录，事件只在刷新时批量写入
+func TestTaskTimelineSampling(t *testing.T) {
+	printSeparator("任务时间线采样测试")
+
+	task := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: primitive.NewObjectID()}
+	store := &memoryTimelineStore{}
+	recorder := service.NewTaskTimelineRecorder(task, store)
+	live, cancel := service.SubscribeTaskTimeline(task.ID.Hex())
+	defer cancel()
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	// 第 0 分钟 60 条、第 1 分钟 300 条爬虫结果，每 50 条刷新一次
+	for i := 0; i < 360; i++ {
+		ts := start.Add(time.Duration(i) * 900 * time.Millisecond)
+		if i >= 60 {
+			ts = start.Add(time.Minute + time.Duration(i-60)*150*time.Millisecond)
+		}
+		recorder.Record(&models.ScanResult{
+			Type:      models.ResultTypeCrawler,
+			Source:    "katana",
+			Data:      bson.M{"url": "https://app.example.com/page"},
+			CreatedAt: ts,
+		})
+		if (i+1)%50 == 0 {
+			recorder.Flush()
+		}
+	}
+	// 4 小时后在爬虫发现的旧接口上发现漏洞
+	for i := 0; i < 3; i++ {
+		recorder.Record(&models.ScanResult{
+			Type:      models.ResultTypeVuln,
+			Source:    "nuclei",
+			Data:      bson.M{"name": "Old API RCE", "target": "https://app.example.com/old-api"},
+			CreatedAt: start.Add(4*time.Hour + time.Duration(i)*time.Second),
+		})
+	}
+	if len(store.events) != 23 {
+		t.Fatalf("未满的采样事件和最后一次刷新后的事件不应写入, 实际 %d 个事件", len(store.events))
+	}
+	recorder.Close()
+
+	perType := make(map[models.ResultType][]*models.TaskEvent)
+	total := 0
+	for _, e := range store.events {
+		perType[e.ResultType] = append(perType[e.ResultType], e)
+		total += e.Count
+		if e.TaskID != task.ID || e.WorkspaceID != task.WorkspaceID {
+			t.Errorf("事件应属于任务: %+v", e)
+		}
+	}
+	// 20 条逐条 + 3 个 100 条的采样事件 + 结束时 40 条
+	crawler := perType[models.ResultTypeCrawler]
+	if len(crawler) != 24 {
+		t.Fatalf("爬虫事件数应为 24, 实际 %d", len(crawler))
+	}
+	for i, e := range crawler {
+		want := 1
+		switch {
+		case i >= 20 && i < 23:
+			want = service.TimelineSampleEvery
+		case i == 23:
+			want = 40
+		}
+		if e.Count != want {
+			t.Errorf("第 %d 个爬虫事件计数应为 %d, 实际 %d", i, want, e.Count)
+		}
+	}
+	if vulns := perType[models.ResultTypeVuln]; len(vulns) != 3 || vulns[0].Key != "Old API RCE @ https://app.example.com/old-api" {
+		t.Errorf("漏洞应逐条记录: %+v", vulns)
+	}
+	if total != 363 {
+		t.Errorf("事件计数之和应等于结果数 363, 实际 %d", total)
+	}
+	// 7 次定期刷新中只有 4 次有新事件，加上结束时 1 次；空的刷新不访问存储
+	if store.writes != 5 {
+		t.Errorf("应批量写入 5 次, 实际 %d", store.writes)
+	}
+
+	received := 0
+	for len(live) > 0 {
+		<-live
+		received++
+	}
+	if received != len(store.events) {
+		t.Errorf("实时订阅应收到 %d 个事件, 实际 %d", len(store.events), received)
+	}
+}
+
+// TestTaskTimelineBuckets 按分钟、小时汇总并返回最近事件
+func TestTaskTimelineBuckets(t *testing.T) {
+	printSeparator("任务时间线汇总测试")
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	events := []*models.TaskEvent{
+		{Timestamp: start.Add(10 * time.Second), ResultType: models.ResultTypeSubdomain, Count: 1},
+		{Timestamp: start.Add(50 * time.Second), ResultType: models.ResultTypeSubdomain, Count: 1},
+		{Timestamp: start.Add(90 * time.Second), ResultType: models.ResultTypeCrawler, Count: 100},
+		{Timestamp: start.Add(4 * time.Minute), ResultType: models.ResultTypePort, Count: 1},
+		{Timestamp: start.Add(2*time.Hour + 30*time.Minute), ResultType: models.ResultTypeVuln, Count: 1, Key: "Old API RCE"},
+	}
+
+	minute, err := service.BuildTaskTimeline(events[:4], service.TimelineMinute, 0)
+	if err != nil {
+		t.Fatalf("汇总失败: %v", err)
+	}
+	if len(minute.Buckets) != 5 {
+		t.Fatalf("第 0 到 4 分钟应有 5 个时间段（含空段）, 实际 %d", len(minute.Buckets))
+	}
+	wantTotals := []int{2, 100, 0, 0, 1}
+	for i, b := range minute.Buckets {
+		if b.Total != wantTotals[i] {
+			t.Errorf("第 %d 分钟应有 %d 条, 实际 %d", i, wantTotals[i], b.Total)
+		}
+	}
+	if minute.Buckets[0].Counts[models.ResultTypeSubdomain] != 2 || !minute.Buckets[1].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("分钟汇总不正确: %+v", minute.Buckets[:2])
+	}
+
+	hour, err := service.BuildTaskTimeline(events, service.TimelineHour, 2)
+	if err != nil {
+		t.Fatalf("汇总失败: %v", err)
+	}
+	if len(hour.Buckets) != 3 || hour.Buckets[0].Total != 103 || hour.Buckets[1].Total != 0 || hour.Buckets[2].Counts[models.ResultTypeVuln] != 1 {
+		t.Errorf("小时汇总不正确: %+v", hour.Buckets)
+	}
+	if hour.Totals[models.ResultTypeCrawler] != 100 {
+		t.Errorf("类型合计不正确: %v", hour.Totals)
+	}
+	if len(hour.Tail) != 2 || hour.Tail[1].Key != "Old API RCE" {
+		t.Errorf("应返回最近 2 个事件，最新的在后: %+v", hour.Tail)
+	}
+
+	if _, err := service.BuildTaskTimeline(events, "day", 0); err == nil {
+		t.Errorf("不支持的粒度应返回错误")
+	}
+	if empty, _ := service.BuildTaskTimeline(nil, "", 0); len(empty.Buckets) != 0 || empty.Resolution != service.TimelineMinute {
+		t.Errorf("没有事件时应返回空时间线: %+v", empty)
+	}
+}
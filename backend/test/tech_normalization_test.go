@@ -0,0 +1,141 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moongazing/config"
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+)
+
+// ========== 技术名称规范化测试 ==========
+
+// TestTechNormalizeMergeSources 同一技术来自 gogo、DSL 规则、httpx 三个来源，合并为一条规范名称并保留版本
+func TestTechNormalizeMergeSources(t *testing.T) {
+	printSeparator("技术名称规范化测试")
+
+	aliases := config.LoadTechAliasConfigFile("../config/dicts/yaml/aliases.yaml").Aliases
+	if len(aliases) == 0 {
+		t.Fatalf("别名文件未加载")
+	}
+	normalizer := core.NewTechNormalizer(aliases)
+
+	// gogo frameworks
+	techs := core.FrameworkTechnologies(normalizer, map[string]interface{}{
+		"nginx":  map[string]interface{}{},
+		"jquery": map[string]interface{}{"version": "3.5.1"},
+	})
+	// DSL 规则
+	techs.Add("Nginx", "jQuery")
+	// httpx
+	techs.Add("Nginx:1.18", "Microsoft-IIS/10.0", "FooServer")
+
+	names := techs.Names()
+	if len(names) != 4 {
+		t.Fatalf("期望 4 条规范名称, 实际 %v", names)
+	}
+	versions := techs.Versions()
+	want := map[string]string{"Nginx": "1.18", "jQuery": "3.5.1", "IIS": "10.0"}
+	for name, version := range want {
+		if versions[name] != version {
+			t.Errorf("%s 版本应为 %s, 实际 %q", name, version, versions[name])
+		}
+	}
+	count := 0
+	for _, name := range names {
+		if name == "Nginx" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Nginx 应只出现一次: %v", names)
+	}
+
+	// 未收录的名称统一小写并出现在报告中
+	if !containsString(names, "fooserver") {
+		t.Errorf("未收录的名称应转为小写: %v", names)
+	}
+	unmapped := normalizer.Unmapped()
+	if len(unmapped) != 1 || unmapped[0].Name != "fooserver" || unmapped[0].Raw != "FooServer" || unmapped[0].Count != 1 {
+		t.Errorf("未收录名称报告不正确: %+v", unmapped)
+	}
+
+	// 任务级规范化器共享别名表，单独统计
+	task := normalizer.Fork()
+	task.Normalize("barlib 2.0")
+	if tech := task.Normalize("apache-tomcat/9.0.1"); tech.Name != "Tomcat" || tech.Version != "9.0.1" {
+		t.Errorf("别名加版本号应规范化: %+v", tech)
+	}
+	if report := task.Unmapped(); len(report) != 1 || report[0].Name != "barlib" {
+		t.Errorf("任务级报告应只包含本任务的名称: %+v", report)
+	}
+	if len(normalizer.Unmapped()) != 1 {
+		t.Errorf("任务级统计不应影响原规范化器")
+	}
+}
+
+// TestTechNormalizerUnmappedCap 未收录名称达到上限后不再记录新名称，已记录的名称继续计数
+func TestTechNormalizerUnmappedCap(t *testing.T) {
+	printSeparator("未收录技术名称上限测试")
+
+	normalizer := core.NewTechNormalizer(nil)
+	for i := 0; i < core.MaxUnmappedTechnologies+100; i++ {
+		normalizer.Normalize(fmt.Sprintf("lib%05d", i))
+	}
+	normalizer.Normalize("lib00000")
+
+	report := normalizer.Unmapped()
+	if len(report) != core.MaxUnmappedTechnologies {
+		t.Fatalf("未收录名称应最多记录 %d 个, 实际 %d", core.MaxUnmappedTechnologies, len(report))
+	}
+	if report[0].Name != "lib00000" || report[0].Count != 2 {
+		t.Errorf("达到上限后已记录的名称应继续计数: %+v", report[0])
+	}
+	if tech := normalizer.Normalize("LIB99999"); tech.Name != "lib99999" {
+		t.Errorf("达到上限后仍应规范化名称: %+v", tech)
+	}
+}
+
+// TestFingerprintScannerCanonicalTech 指纹扫描器合并 Server 头、DSL 规则和 JS 库时使用规范名称
+func TestFingerprintScannerCanonicalTech(t *testing.T) {
+	printSeparator("指纹识别技术名称规范化测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.18.0 (Ubuntu)")
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Test</title><script src="/static/jquery-3.5.1.min.js"></script></head><body>nginx</body></html>`))
+	}))
+	defer server.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(5)
+	result := scanner.ScanFingerprint(context.Background(), server.URL)
+
+	seen := make(map[string]int)
+	for _, name := range result.Technologies {
+		seen[name]++
+	}
+	if seen["Nginx"] != 1 || seen["nginx"] != 0 {
+		t.Errorf("Nginx 应只以规范名称出现一次: %v", result.Technologies)
+	}
+	if seen["jQuery"] != 1 {
+		t.Errorf("JS 库应合并到技术栈: %v", result.Technologies)
+	}
+
+	versions := result.TechVersions()
+	if versions["Nginx"] != "1.18.0" || versions["jQuery"] != "3.5.1" {
+		t.Errorf("应从 Server 头和 JS 文件名提取版本: %v", versions)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
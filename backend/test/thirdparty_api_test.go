@@ -0,0 +1,245 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/scanner/subdomain/thirdparty"
+)
+
+// ========== 第三方 API 分页 / 配额 / 缓存测试 ==========
+// 使用 httptest 模拟 Hunter、Quake 的分页响应，不消耗真实配额
+
+// newTestAPIManager 创建指向模拟服务的管理器
+func newTestAPIManager(hunterURL, quakeURL string, store thirdparty.Store) *thirdparty.APIManager {
+	manager := thirdparty.NewAPIManager(&thirdparty.APIConfig{
+		HunterKey: "test-hunter-key",
+		QuakeKey:  "test-quake-key",
+	})
+	manager.SetOptions(thirdparty.ManagerOptions{
+		CacheTTL:           time.Hour,
+		QuotaWarnThreshold: 50,
+		Store:              store,
+	})
+	if hunterURL != "" {
+		manager.Hunter.BaseURL = hunterURL
+	}
+	if quakeURL != "" {
+		manager.Quake.BaseURL = quakeURL
+	}
+	return manager
+}
+
+// mockHunterServer 模拟 Hunter 接口，共 total 条数据，exhaustAfter 页之后返回积分不足
+func mockHunterServer(total, exhaustAfter int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+
+		if exhaustAfter > 0 && page > exhaustAfter {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"code":    40204,
+				"message": "今日免费积分已用完，积分不足",
+			})
+			return
+		}
+
+		var arr []map[string]interface{}
+		for i := (page - 1) * size; i < page*size && i < total; i++ {
+			arr = append(arr, map[string]interface{}{
+				"domain": fmt.Sprintf("h%d.example.com", i),
+				"ip":     "1.1.1.1",
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data": map[string]interface{}{
+				"total":         total,
+				"consume_quota": fmt.Sprintf("消耗积分：%d", len(arr)),
+				"rest_quota":    fmt.Sprintf("今日剩余积分：%d", 1000-page*size),
+				"arr":           arr,
+			},
+		})
+	}))
+}
+
+// TestThirdPartyHunterPagination Hunter 分页拉取与配额记录
+func TestThirdPartyHunterPagination(t *testing.T) {
+	printSeparator("Hunter 分页与配额测试")
+
+	var requests int32
+	srv := mockHunterServer(250, 0, &requests)
+	defer srv.Close()
+
+	manager := newTestAPIManager(srv.URL, "", thirdparty.NewMemoryStore())
+	assets, err := manager.FetchSubdomainAssets(context.Background(), "hunter", "example.com", 1000)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(assets) != 250 {
+		t.Errorf("期望 250 条资产, 实际 %d", len(assets))
+	}
+	if requests != 3 {
+		t.Errorf("期望 3 次分页请求, 实际 %d", requests)
+	}
+
+	var hunter *thirdparty.QuotaStatus
+	for _, status := range manager.GetQuotaStatus(context.Background()) {
+		if status.Provider == "hunter" {
+			s := status
+			hunter = &s
+		}
+	}
+	if hunter == nil || hunter.ConsumedToday != 250 || hunter.Remaining != 700 {
+		t.Errorf("配额统计不正确: %+v", hunter)
+	}
+	fmt.Printf("资产数: %d, 请求数: %d, 配额: %+v\n", len(assets), requests, hunter)
+}
+
+// TestThirdPartyMaxResultsCap 分页拉取不超过 maxResults
+func TestThirdPartyMaxResultsCap(t *testing.T) {
+	printSeparator("maxResults 上限测试")
+
+	var requests int32
+	srv := mockHunterServer(1000, 0, &requests)
+	defer srv.Close()
+
+	manager := newTestAPIManager(srv.URL, "", thirdparty.NewMemoryStore())
+	assets, err := manager.FetchSubdomainAssets(context.Background(), "hunter", "example.com", 150)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(assets) != 150 {
+		t.Errorf("期望 150 条资产, 实际 %d", len(assets))
+	}
+	if requests != 2 {
+		t.Errorf("期望 2 次分页请求, 实际 %d", requests)
+	}
+}
+
+// TestThirdPartyCache 缓存期内重复查询复用结果
+func TestThirdPartyCache(t *testing.T) {
+	printSeparator("查询结果缓存测试")
+
+	var requests int32
+	srv := mockHunterServer(30, 0, &requests)
+	defer srv.Close()
+
+	store := thirdparty.NewMemoryStore()
+	first := newTestAPIManager(srv.URL, "", store)
+	if _, err := first.FetchSubdomainAssets(context.Background(), "hunter", "example.com", 100); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+
+	// 新任务使用新的管理器，共享同一存储
+	second := newTestAPIManager(srv.URL, "", store)
+	result := second.CollectSubdomains(context.Background(), "example.com", []string{"hunter"}, 100)
+
+	if requests != 1 {
+		t.Errorf("第二次查询应命中缓存, 实际请求 %d 次", requests)
+	}
+	if result.TotalFound != 30 {
+		t.Errorf("期望 30 个子域名, 实际 %d", result.TotalFound)
+	}
+	if _, ok := result.Sources["hunter"+thirdparty.CachedSourceSuffix]; !ok {
+		t.Errorf("缓存结果来源应标注为 cached: %v", result.Sources)
+	}
+	fmt.Printf("来源统计: %v\n", result.Sources)
+}
+
+// TestThirdPartyQuotaExhausted 配额耗尽时保留部分结果并停用数据源
+func TestThirdPartyQuotaExhausted(t *testing.T) {
+	printSeparator("配额耗尽测试")
+
+	var requests int32
+	srv := mockHunterServer(500, 2, &requests)
+	defer srv.Close()
+
+	manager := newTestAPIManager(srv.URL, "", thirdparty.NewMemoryStore())
+	assets, err := manager.FetchSubdomainAssets(context.Background(), "hunter", "example.com", 500)
+	if err != nil {
+		t.Fatalf("配额耗尽不应返回错误: %v", err)
+	}
+	if len(assets) != 200 {
+		t.Errorf("期望保留 200 条部分结果, 实际 %d", len(assets))
+	}
+
+	// 同一任务内再次查询其他域名，不再请求该数据源
+	before := atomic.LoadInt32(&requests)
+	assets, err = manager.FetchSubdomainAssets(context.Background(), "hunter", "other.com", 100)
+	if err != nil || len(assets) != 0 {
+		t.Errorf("停用后应返回空结果: %d, %v", len(assets), err)
+	}
+	if atomic.LoadInt32(&requests) != before {
+		t.Errorf("停用后不应再请求 Hunter")
+	}
+
+	disabled := false
+	for _, status := range manager.GetQuotaStatus(context.Background()) {
+		if status.Provider == "hunter" {
+			disabled = status.Disabled
+		}
+	}
+	if !disabled {
+		t.Errorf("Hunter 应被标记为停用")
+	}
+}
+
+// TestThirdPartyQuakePaginationID Quake 分页时携带 pagination_id
+func TestThirdPartyQuakePaginationID(t *testing.T) {
+	printSeparator("Quake pagination_id 测试")
+
+	var requests int32
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		token, _ := body["pagination_id"].(string)
+		tokens = append(tokens, token)
+		start := int(body["start"].(float64))
+		size := int(body["size"].(float64))
+
+		var data []map[string]interface{}
+		for i := start; i < start+size && i < 150; i++ {
+			data = append(data, map[string]interface{}{
+				"hostname": fmt.Sprintf("q%d.example.com", i),
+				"ip":       "2.2.2.2",
+			})
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(100-int(n)))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":    0,
+			"message": "Successful.",
+			"data":    data,
+			"meta": map[string]interface{}{
+				"total":         150,
+				"pagination_id": fmt.Sprintf("token-%d", n),
+			},
+		})
+	}))
+	defer srv.Close()
+
+	manager := newTestAPIManager("", srv.URL, thirdparty.NewMemoryStore())
+	assets, err := manager.FetchSubdomainAssets(context.Background(), "quake", "example.com", 500)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(assets) != 150 {
+		t.Errorf("期望 150 条资产, 实际 %d", len(assets))
+	}
+	if len(tokens) != 2 || tokens[0] != "" || tokens[1] != "token-1" {
+		t.Errorf("pagination_id 传递不正确: %v", tokens)
+	}
+	fmt.Printf("分页标识: %s\n", strings.Join(tokens, ","))
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"moongazing/scanner/subdomain/thirdparty"
+)
+
+// ========== 免费被动数据源测试 ==========
+// 使用固定的 JSON 响应模拟 crt.sh、OTX、Chaos；-live-thirdparty 时请求真实接口
+
+var liveThirdParty = flag.Bool("live-thirdparty", false, "请求 crt.sh、OTX、Chaos 的真实接口")
+
+// crt.sh 响应：name_value 中多个名称用换行分隔，包含通配符条目、过期证书和其他域名
+const crtShFixture = `[
+  {"id": 1, "common_name": "www.example.com", "name_value": "www.example.com\nexample.com\n*.api.example.com", "not_after": "2099-01-01T00:00:00"},
+  {"id": 2, "common_name": "API.example.com", "name_value": "api.example.com\n%25.dev.example.com", "not_after": "2099-01-01T00:00:00"},
+  {"id": 3, "common_name": "old.example.com", "name_value": "old.example.com", "not_after": "2015-06-01T00:00:00"},
+  {"id": 4, "common_name": "example.org", "name_value": "example.org\nnotexample.com", "not_after": "2099-01-01T00:00:00"}
+]`
+
+const otxFixture = `{
+  "passive_dns": [
+    {"hostname": "mail.example.com", "address": "10.0.0.1", "record_type": "A"},
+    {"hostname": "MAIL.example.com.", "address": "10.0.0.2", "record_type": "A"},
+    {"hostname": "vpn.example.com", "address": "10.0.0.3", "record_type": "A"},
+    {"hostname": "cdn.other.net", "address": "10.0.0.4", "record_type": "CNAME"}
+  ],
+  "count": 4
+}`
+
+const chaosFixture = `{"domain": "example.com", "subdomains": ["www", "git", "*.staging", ""], "count": 4}`
+
+// newPassiveTestManager 创建被动数据源指向模拟服务的管理器
+func newPassiveTestManager(crtURL, otxURL, chaosURL string, opts thirdparty.ManagerOptions) *thirdparty.APIManager {
+	manager := thirdparty.NewAPIManager(&thirdparty.APIConfig{ChaosKey: "test-chaos-key"})
+	if opts.Store == nil {
+		opts.Store = thirdparty.NewMemoryStore()
+	}
+	manager.SetOptions(opts)
+	manager.CrtSh.BaseURL = crtURL
+	manager.OTX.BaseURL = otxURL
+	manager.Chaos.BaseURL = chaosURL
+	return manager
+}
+
+func sortedNames(names []string) string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// TestCrtShFixture crt.sh 拆分多行名称、去掉通配符和 %25 前缀、可选跳过过期证书
+func TestCrtShFixture(t *testing.T) {
+	printSeparator("crt.sh 被动数据源测试")
+
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(crtShFixture))
+	}))
+	defer server.Close()
+
+	manager := newPassiveTestManager(server.URL, "", "", thirdparty.ManagerOptions{})
+	names, err := manager.FetchPassiveSubdomains(context.Background(), thirdparty.SourceCrtSh, "example.com", 0)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if !strings.Contains(query, "q=%25.example.com") || !strings.Contains(query, "output=json") {
+		t.Errorf("查询参数中的 %% 应编码为 %%25: %s", query)
+	}
+	want := "api.example.com,dev.example.com,example.com,old.example.com,www.example.com"
+	if got := sortedNames(names); got != want {
+		t.Errorf("crt.sh 结果不符:\n%s\n%s", got, want)
+	}
+
+	manager = newPassiveTestManager(server.URL, "", "", thirdparty.ManagerOptions{CrtShSkipExpired: true})
+	names, _ = manager.FetchPassiveSubdomains(context.Background(), thirdparty.SourceCrtSh, "example.com", 2)
+	if len(names) != 2 || strings.Contains(sortedNames(names), "old.") || !strings.Contains(query, "exclude=expired") {
+		t.Errorf("应跳过过期证书并截断到 2 个: %v (%s)", names, query)
+	}
+}
+
+// TestOTXAndChaosFixture OTX 被动 DNS 和 Chaos 前缀拼接，按 APIMaxResults 截断
+func TestOTXAndChaosFixture(t *testing.T) {
+	printSeparator("OTX / Chaos 被动数据源测试")
+
+	var auth atomic.Value
+	otx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/indicators/domain/example.com/passive_dns" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(otxFixture))
+	}))
+	defer otx.Close()
+	chaos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		if r.URL.Path != "/dns/example.com/subdomains" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(chaosFixture))
+	}))
+	defer chaos.Close()
+
+	manager := newPassiveTestManager("", otx.URL, chaos.URL, thirdparty.ManagerOptions{})
+	names, err := manager.FetchPassiveSubdomains(context.Background(), thirdparty.SourceOTX, "example.com", 0)
+	if err != nil || sortedNames(names) != "mail.example.com,vpn.example.com" {
+		t.Errorf("OTX 结果不符: %v %v", names, err)
+	}
+	names, err = manager.FetchPassiveSubdomains(context.Background(), thirdparty.SourceChaos, "example.com", 0)
+	if err != nil || sortedNames(names) != "example.com,git.example.com,staging.example.com,www.example.com" {
+		t.Errorf("Chaos 结果不符: %v %v", names, err)
+	}
+	if auth.Load() != "test-chaos-key" {
+		t.Errorf("Chaos 应携带密钥: %v", auth.Load())
+	}
+	if names, _ := manager.FetchPassiveSubdomains(context.Background(), thirdparty.SourceOTX, "example.com", 1); len(names) != 1 {
+		t.Errorf("应按 maxResults 截断: %v", names)
+	}
+
+	// 通过 APISources 选择，与付费数据源共用 CollectSubdomains
+	result := manager.CollectSubdomains(context.Background(), "example.com", []string{"otx", "chaos"}, 100)
+	if result.Sources["otx"] != 2 || result.Sources["chaos"] != 4 || result.TotalFound != 6 {
+		t.Errorf("汇总结果不符: %+v", result)
+	}
+	sources := strings.Join(thirdparty.NewAPIManager(nil).GetConfiguredSources(), ",")
+	if sources != "crtsh,otx" {
+		t.Errorf("未配置密钥时默认只启用 crtsh 和 otx: %s", sources)
+	}
+}
+
+// TestPassiveSourceTimeout 数据源超时按 SourceTimeouts 生效
+func TestPassiveSourceTimeout(t *testing.T) {
+	printSeparator("被动数据源超时测试")
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	manager := newPassiveTestManager(slow.URL, "", "", thirdparty.ManagerOptions{
+		SourceTimeouts: map[string]time.Duration{thirdparty.SourceCrtSh: 100 * time.Millisecond},
+	})
+	start := time.Now()
+	if _, err := manager.FetchPassiveSubdomains(context.Background(), thirdparty.SourceCrtSh, "example.com", 0); err == nil {
+		t.Error("超时应返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("应在数据源超时后返回, 实际 %v", elapsed)
+	}
+}
+
+// TestPassiveSourcesLive 请求真实接口：go test ./test/ -run TestPassiveSourcesLive -args -live-thirdparty
+func TestPassiveSourcesLive(t *testing.T) {
+	if !*liveThirdParty {
+		t.Skip("未指定 -live-thirdparty")
+	}
+	manager := thirdparty.NewAPIManager(nil)
+	for _, source := range []string{thirdparty.SourceCrtSh, thirdparty.SourceOTX} {
+		ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+		names, err := manager.FetchPassiveSubdomains(ctx, source, "hackerone.com", 50)
+		cancel()
+		if err != nil {
+			t.Errorf("%s 查询失败: %v", source, err)
+			continue
+		}
+		t.Logf("%s: %d subdomains, e.g. %v", source, len(names), limitStrings(names, 5))
+	}
+}
+
+func limitStrings(values []string, n int) []string {
+	if len(values) > n {
+		return values[:n]
+	}
+	return values
+}
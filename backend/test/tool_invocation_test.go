@@ -0,0 +1,151 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/scanner/core"
+	"moongazing/scanner/webscan"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 外部工具命令行、退出码与 stderr 记录测试 ==========
+
+// writeFailingKatana 模拟 katana：向 -o 指定的文件写入一条结果，向 stderr 输出超过 4KB 后以状态码 7 退出
+func writeFailingKatana(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "katana")
+	script := `#!/bin/sh
+if [ "$1" = "-version" ]; then echo 'katana v1.1.0'; exit 0; fi
+out=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; fi
+  shift
+done
+echo '{"request":{"method":"GET","endpoint":"https://a.example.com/login"},"response":{"status_code":200}}' > "$out"
+i=0
+while [ $i -lt 100 ]; do
+  echo "[WRN] line $i: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" >&2
+  i=$((i+1))
+done
+echo "[FTL] crawl aborted" >&2
+exit 7
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake katana: %v", err)
+	}
+	return path
+}
+
+// TestToolInvocationExitCodeAndStderr 扫描器调用失败的工具时记录退出码、stderr 末尾 4KB 和输出文件大小
+func TestToolInvocationExitCodeAndStderr(t *testing.T) {
+	printSeparator("外部工具退出码与 stderr 记录测试")
+
+	dir := t.TempDir()
+	task := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: primitive.NewObjectID()}
+	store := &memoryToolRunStore{}
+	ctx := core.WithToolRecorder(context.Background(), service.NewToolRunRecorder(task, store))
+
+	katana := webscan.NewKatanaScanner()
+	katana.BinPath = writeFailingKatana(t, dir)
+	katana.TempDir = dir
+	if _, err := katana.Crawl(ctx, "https://a.example.com"); err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+
+	if len(store.runs) != 1 {
+		t.Fatalf("应记录一次 katana 调用, 实际 %d", len(store.runs))
+	}
+	doc := store.runs[0]
+	if doc.TaskID != task.ID || doc.ExitCode != 7 || doc.Error == "" {
+		t.Errorf("退出码记录错误: exit=%d error=%q", doc.ExitCode, doc.Error)
+	}
+	if len(doc.Stderr) != core.ToolStderrTail || !doc.StderrTruncated {
+		t.Errorf("stderr 应截断为最后 %d 字节: len=%d truncated=%v", core.ToolStderrTail, len(doc.Stderr), doc.StderrTruncated)
+	}
+	if !strings.HasSuffix(doc.Stderr, "[FTL] crawl aborted\n") || strings.Contains(doc.Stderr, "line 0:") {
+		t.Errorf("应保留 stderr 的末尾: %q", doc.Stderr[len(doc.Stderr)-40:])
+	}
+	if doc.OutputFile == "" || doc.OutputSize == 0 {
+		t.Errorf("应记录输出文件大小: %q %d", doc.OutputFile, doc.OutputSize)
+	}
+	if doc.Args[0] != "-u" || doc.Args[1] != "https://a.example.com" {
+		t.Errorf("应记录命令行参数: %v", doc.Args)
+	}
+}
+
+// TestToolCommandCombinedOutput 合并输出的命令仍能读到完整输出，stderr 中出现的凭据被脱敏
+func TestToolCommandCombinedOutput(t *testing.T) {
+	printSeparator("外部工具合并输出记录测试")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fake-tool")
+	script := "#!/bin/sh\necho stdout-line\necho \"auth failed for token $2\" >&2\nexit 0\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake tool: %v", err)
+	}
+	task := &models.Task{ID: primitive.NewObjectID()}
+	store := &memoryToolRunStore{}
+	ctx := core.WithToolRecorder(context.Background(), service.NewToolRunRecorder(task, store))
+
+	cmd := exec.Command(path, "--token", "tk-9f8e7d")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	run := core.StartToolCommand(ctx, "fake-tool", cmd)
+	run.Finish(cmd.Run())
+
+	if !strings.Contains(output.String(), "stdout-line") || !strings.Contains(output.String(), "tk-9f8e7d") {
+		t.Errorf("调用方应读到完整输出: %q", output.String())
+	}
+	doc := store.runs[0]
+	if doc.ExitCode != 0 || doc.StderrTruncated {
+		t.Errorf("退出码或截断标记错误: %+v", doc)
+	}
+	if strings.Contains(doc.Stderr, "tk-9f8e7d") || !strings.Contains(doc.Stderr, "auth failed for token ***") {
+		t.Errorf("stderr 中的凭据应脱敏: %q", doc.Stderr)
+	}
+	if doc.Args[1] != "***" {
+		t.Errorf("参数中的凭据应脱敏: %v", doc.Args)
+	}
+
+	// 未挂载记录器时不修改命令
+	plain := exec.Command(path)
+	if core.StartToolCommand(context.Background(), "fake-tool", plain) != nil || plain.Stderr != nil {
+		t.Error("未挂载记录器时不应记录")
+	}
+}
+
+// TestTailBuffer 只保留最后 N 字节，截断处不留下不完整的 UTF-8 字符
+func TestTailBuffer(t *testing.T) {
+	printSeparator("stderr 末尾缓冲测试")
+
+	buf := core.NewTailBuffer(8)
+	buf.Write([]byte("abcd"))
+	buf.Write([]byte("efgh"))
+	if string(buf.Bytes()) != "abcdefgh" || buf.Truncated() {
+		t.Fatalf("未超出时应保留全部: %q", buf.Bytes())
+	}
+	buf.Write([]byte("ij"))
+	if string(buf.Bytes()) != "cdefghij" || !buf.Truncated() {
+		t.Errorf("超出时应丢弃开头: %q", buf.Bytes())
+	}
+	buf.Write([]byte("0123456789"))
+	if string(buf.Bytes()) != "23456789" {
+		t.Errorf("单次写入超出时保留其末尾: %q", buf.Bytes())
+	}
+
+	cjk := core.NewTailBuffer(7)
+	cjk.Write([]byte("错误信息"))
+	if got := string(cjk.Bytes()); got != "信息" {
+		t.Errorf("截断处的多字节字符应去掉: %q", got)
+	}
+}
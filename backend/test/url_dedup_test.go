@@ -0,0 +1,191 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== URL 标准化和跨模块去重测试 ==========
+
+// TestNormalizeURL 大小写、默认端口、片段、参数顺序、参数编码和末尾斜杠不同的写法标准化为同一个 URL
+func TestNormalizeURL(t *testing.T) {
+	printSeparator("URL 标准化测试")
+
+	groups := [][]string{
+		{"http://app.example.com/login?next=/", "HTTP://App.Example.com:80/login/?next=%2F#top", "http://app.example.com/login?next=%2f"},
+		{"https://app.example.com/", "https://APP.example.com:443", "https://app.example.com"},
+		{"http://app.example.com/search?q=a+b&lang=en", "http://app.example.com/search?lang=en&q=a%20b", "http://app.example.com/search/?q=a%20b&lang=en#results"},
+		{"http://app.example.com/list?tag=b&tag=a", "http://app.example.com/list?tag=a&tag=b"},
+		{"http://app.example.com/~admin/", "http://app.example.com/%7Eadmin"},
+	}
+	for _, group := range groups {
+		want := pipeline.NormalizeURL(group[0])
+		for _, u := range group[1:] {
+			if got := pipeline.NormalizeURL(u); got != want {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", u, got, want)
+			}
+		}
+	}
+
+	cases := map[string]string{
+		"HTTP://App.Example.com:8080/Admin/?b=2&a=1#x": "http://app.example.com:8080/Admin?a=1&b=2",
+		"http://[::1]:80/":                        "http://[::1]/",
+		"http://app.example.com/list?tag=b&tag=a": "http://app.example.com/list?tag=a&tag=b",
+		"/relative/path":                          "/relative/path",
+	}
+	for input, want := range cases {
+		if got := pipeline.NormalizeURL(input); got != want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	// 路径大小写和不同的参数值保持区分
+	if pipeline.NormalizeURL("http://a.example.com/Admin") == pipeline.NormalizeURL("http://a.example.com/admin") {
+		t.Error("路径大小写不应被忽略")
+	}
+	if pipeline.NormalizeURL("http://a.example.com/item?id=1") == pipeline.NormalizeURL("http://a.example.com/item?id=2") {
+		t.Error("精确去重时不同的参数值应保留")
+	}
+}
+
+// TestURLSignature 参数签名忽略参数值和重复参数，参数名不同时签名不同
+func TestURLSignature(t *testing.T) {
+	printSeparator("URL 参数签名测试")
+
+	sig := pipeline.URLSignature("http://app.example.com/item?id=1&page=2")
+	for _, u := range []string{
+		"http://app.example.com/item?page=9&id=2",
+		"http://APP.example.com:80/item/?id=%31&id=7&page=#frag",
+	} {
+		if got := pipeline.URLSignature(u); got != sig {
+			t.Errorf("URLSignature(%q) = %q, want %q", u, got, sig)
+		}
+	}
+	if sig != "http://app.example.com/item?id="+pipeline.URLParamPlaceholder+"&page="+pipeline.URLParamPlaceholder {
+		t.Errorf("签名格式不符: %s", sig)
+	}
+	if pipeline.URLSignature("http://app.example.com/item?id=1&sort=asc") == sig {
+		t.Error("参数名不同时签名应不同")
+	}
+	if got := pipeline.URLSignature("http://app.example.com/login/"); got != "http://app.example.com/login" {
+		t.Errorf("没有参数的签名应与标准化 URL 相同: %s", got)
+	}
+
+	r := pipeline.AnnotateURL(pipeline.UrlResult{Output: "http://App.example.com/item?id=3#x"})
+	if r.Output != "http://App.example.com/item?id=3#x" || r.NormalizedURL != "http://app.example.com/item?id=3" || r.Signature != "http://app.example.com/item?id={}" {
+		t.Errorf("URL 结果应同时包含原始、标准化和签名形式: %+v", r)
+	}
+}
+
+// runSharedDirScan 使用共享去重器运行目录扫描模块，返回输出的 URL 结果
+func runSharedDirScan(t *testing.T, dedup *pipeline.URLDeduper, body string) []pipeline.UrlResult {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out := make(chan interface{}, 50)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 50))
+	module := pipeline.NewDirScanModule(ctx, collector, 2, nil)
+	module.SetSprayScanner(writeFakeSpray(t, body))
+	module.SetBatchMode(false, 0)
+	module.SetSoftNotFound(-1, false)
+	module.SetURLDeduper(dedup)
+
+	input := make(chan interface{}, 1)
+	input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test"}
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	var urls []pipeline.UrlResult
+	for len(out) > 0 {
+		if u, ok := (<-out).(pipeline.UrlResult); ok {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// sprayFullURLLine 模拟 spray 输出完整 URL 的一行结果
+func sprayFullURLLine(url, path string) string {
+	return "echo '{\"url\":\"" + url + "\",\"path\":\"" + path + "\",\"status\":200,\"host\":\"app.example.test\"}' >> \"$out\"\n"
+}
+
+// TestSharedURLDedup 共用去重器的模块之间同一个 URL 只输出一次；按签名去重时参数值不同的 URL 也只输出一次
+func TestSharedURLDedup(t *testing.T) {
+	printSeparator("跨模块 URL 去重测试")
+
+	body := sprayFullURLLine("http://app.example.test/login?next=/", "/login?next=/") +
+		sprayFullURLLine("http://APP.example.test:80/login/?next=%2F", "/login/?next=%2F") +
+		sprayFullURLLine("http://app.example.test/item?id=1", "/item?id=1") +
+		sprayFullURLLine("http://app.example.test/item?id=2", "/item?id=2")
+
+	exact := pipeline.NewURLDeduper(false)
+	first := runSharedDirScan(t, exact, body)
+	if len(first) != 3 {
+		t.Fatalf("精确去重应输出 3 条: %+v", first)
+	}
+	for _, u := range first {
+		if u.NormalizedURL == "" || u.Signature == "" {
+			t.Errorf("输出的结果应包含标准化形式: %+v", u)
+		}
+	}
+	// 第二个模块（如同一任务中的另一个扫描来源）发现的相同 URL 不再输出
+	if second := runSharedDirScan(t, exact, body); len(second) != 0 {
+		t.Errorf("共用去重器时已输出的 URL 不应重复: %+v", second)
+	}
+
+	bySignature := runSharedDirScan(t, pipeline.NewURLDeduper(true), body)
+	if len(bySignature) != 2 {
+		t.Errorf("按签名去重应输出 2 条: %+v", bySignature)
+	}
+
+	// spray 的 url 只有目标地址时按拼接路径后的 URL 去重
+	baseOnly := runSharedDirScan(t, pipeline.NewURLDeduper(false), sprayLine("/admin", 200)+sprayLine("/console", 200))
+	if len(baseOnly) != 2 || baseOnly[0].NormalizedURL != "http://app.example.test/admin" {
+		t.Errorf("应按完整路径去重: %+v", baseOnly)
+	}
+}
+
+// TestURLResultDedupFilter 入库时带签名的结果按 data.url_signature 合并，否则按标准化后的 URL
+func TestURLResultDedupFilter(t *testing.T) {
+	printSeparator("URL 结果入库去重测试")
+
+	taskID := primitive.NewObjectID()
+	plain := &models.ScanResult{TaskID: taskID, Type: models.ResultTypeCrawler, Data: bson.M{"url": "http://App.example.com:80/login/#top"}}
+	filter := service.DedupFilter(plain)
+	if filter["data.normalized_url"] != "http://app.example.com/login" || filter["data.url_signature"] != nil {
+		t.Errorf("未按签名去重时应使用标准化 URL: %v", filter)
+	}
+
+	signed := &models.ScanResult{TaskID: taskID, Type: models.ResultTypeDirScan, Data: bson.M{
+		"url":           "http://app.example.com/item?id=2",
+		"url_signature": "http://app.example.com/item?id={}",
+	}}
+	filter = service.DedupFilter(signed)
+	if filter["data.url_signature"] != "http://app.example.com/item?id={}" || filter["data.normalized_url"] != nil {
+		t.Errorf("按签名去重时应使用 url_signature: %v", filter)
+	}
+	if signed.Data["normalized_url"] != "http://app.example.com/item?id=2" {
+		t.Errorf("仍应保存标准化 URL: %v", signed.Data)
+	}
+
+	var signatureIndex bool
+	for _, index := range service.ResultIndexes() {
+		for _, k := range index.Keys.(bson.D) {
+			signatureIndex = signatureIndex || k.Key == "data.url_signature"
+		}
+	}
+	if !signatureIndex {
+		t.Error("应创建 data.url_signature 索引")
+	}
+}
@@ -0,0 +1,332 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/webscan"
+)
+
+// ========== User-Agent 策略测试 ==========
+
+// userAgentServer 记录每个路径收到的 User-Agent，页面声明 /favicon.ico
+type userAgentServer struct {
+	mu     sync.Mutex
+	agents map[string]string
+}
+
+func newUserAgentServer(t *testing.T) (*httptest.Server, *userAgentServer) {
+	t.Helper()
+	s := &userAgentServer{agents: make(map[string]string)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		s.mu.Lock()
+		s.agents[key] = r.Header.Get("User-Agent")
+		s.mu.Unlock()
+		if r.URL.Path == "/favicon.ico" {
+			w.Header().Set("Content-Type", "image/x-icon")
+			w.Write([]byte("\x00\x00\x01\x00icon"))
+			return
+		}
+		w.Write([]byte(`<html><head><title>Shop</title></head><body>catalog</body></html>`))
+	}))
+	t.Cleanup(server.Close)
+	return server, s
+}
+
+func (s *userAgentServer) agent(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.agents[key]
+}
+
+// TestUserAgentPickerStrategies 固定策略始终返回同一个，轮换按顺序，随机在默认列表中选择
+func TestUserAgentPickerStrategies(t *testing.T) {
+	printSeparator("User-Agent 选择策略测试")
+
+	var nilPicker *core.UserAgentPicker
+	if nilPicker.Next() != core.DefaultUserAgent {
+		t.Error("未设置策略时应使用默认 User-Agent")
+	}
+	if picker, err := core.NewUserAgentPicker("", nil); err != nil || picker != nil {
+		t.Errorf("策略为空时不应创建选择器: %v %v", picker, err)
+	}
+
+	fixed, err := core.NewUserAgentPicker(core.UAStrategyFixed, []string{"moongazing-scan/1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if ua := fixed.Next(); ua != "moongazing-scan/1.0" {
+			t.Fatalf("固定策略应始终使用自定义 User-Agent: %s", ua)
+		}
+	}
+
+	rotate, _ := core.NewUserAgentPicker(core.UAStrategyRotate, []string{"ua-a", "ua-b", "ua-c"})
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, rotate.Next())
+	}
+	if strings.Join(got, ",") != "ua-a,ua-b,ua-c,ua-a,ua-b,ua-c" {
+		t.Errorf("轮换策略应按顺序使用列表: %v", got)
+	}
+
+	random, _ := core.NewUserAgentPicker(core.UAStrategyRandom, nil)
+	known := map[string]bool{}
+	for _, ua := range core.DefaultUserAgents {
+		known[ua] = true
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		ua := random.Next()
+		if !known[ua] {
+			t.Fatalf("随机策略未设置列表时应从默认列表中选择: %s", ua)
+		}
+		seen[ua] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("随机策略在 200 次请求中只使用了 %d 个 User-Agent", len(seen))
+	}
+
+	for _, c := range []struct {
+		strategy string
+		agents   []string
+	}{
+		{"shuffle", nil},
+		{core.UAStrategyRotate, []string{"ok", " "}},
+		{core.UAStrategyFixed, []string{"bad\r\nX-Injected: 1"}},
+		{"", []string{"ua-a"}},
+	} {
+		if err := core.ValidateUserAgents(c.strategy, c.agents); err == nil {
+			t.Errorf("策略 %q 列表 %q 应校验失败", c.strategy, c.agents)
+		}
+	}
+}
+
+// TestFingerprintUserAgentRotation 批量指纹识别按目标轮换 User-Agent，favicon 请求与页面相同，结果记录使用的 User-Agent
+func TestFingerprintUserAgentRotation(t *testing.T) {
+	printSeparator("指纹识别 User-Agent 轮换测试")
+
+	server, recorded := newUserAgentServer(t)
+	agents := []string{"ua-chrome", "ua-firefox", "ua-safari"}
+	picker, err := core.NewUserAgentPicker(core.UAStrategyRotate, agents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := fingerprint.NewFingerprintScanner(3)
+	scanner.SetUserAgents(picker)
+
+	var targets []string
+	for i := 0; i < 6; i++ {
+		targets = append(targets, server.URL+"/?page="+string(rune('a'+i)))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results := scanner.BatchScanFingerprint(ctx, targets)
+
+	counts := map[string]int{}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Fatalf("%s 识别失败: %s", result.Target, result.Error)
+		}
+		sent := recorded.agent(strings.TrimPrefix(result.Target, server.URL))
+		if result.UserAgent == "" || result.UserAgent != sent {
+			t.Errorf("%s 结果记录的 User-Agent %q 与实际发送的 %q 不同", result.Target, result.UserAgent, sent)
+		}
+		counts[result.UserAgent]++
+	}
+	for _, ua := range agents {
+		if counts[ua] != 2 {
+			t.Errorf("6 个目标轮换 3 个 User-Agent，每个应使用 2 次: %v", counts)
+			break
+		}
+	}
+
+	// 单个目标的 favicon 请求使用页面的 User-Agent
+	single := fingerprint.NewFingerprintScanner(1)
+	single.SetUserAgents(picker)
+	result := single.ScanFingerprint(ctx, server.URL+"/?page=z")
+	if result.IconHash == "" {
+		t.Fatal("应获取 favicon")
+	}
+	if favicon := recorded.agent("/favicon.ico"); favicon != result.UserAgent {
+		t.Errorf("favicon 请求的 User-Agent %q 应与页面 %q 相同", favicon, result.UserAgent)
+	}
+
+	// 自定义请求头中的 User-Agent 优先，结果记录实际发送的值
+	single.SetHeaders(core.NewScanHeaders(map[string]string{"User-Agent": "moongazing-auth"}, ""))
+	result = single.ScanFingerprint(ctx, server.URL+"/?page=auth")
+	if result.UserAgent != "moongazing-auth" || recorded.agent("/?page=auth") != "moongazing-auth" {
+		t.Errorf("自定义请求头应覆盖策略选择的 User-Agent: %q", result.UserAgent)
+	}
+}
+
+// httpsOnlyListener 只接受 TLS 握手的连接，明文 HTTP 连接直接关闭，模拟只开放 https 的目标
+type httpsOnlyListener struct {
+	net.Listener
+}
+
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (l *httpsOnlyListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		reader := bufio.NewReader(conn)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		first, err := reader.Peek(1)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil || first[0] != 0x16 {
+			conn.Close()
+			continue
+		}
+		return &peekedConn{Conn: conn, reader: reader}, nil
+	}
+}
+
+// TestFingerprintHTTPSRetryHeaders http 请求失败后的 https 重试带上与首次请求相同的 User-Agent、Accept 和 Accept-Language
+func TestFingerprintHTTPSRetryHeaders(t *testing.T) {
+	printSeparator("指纹识别 https 重试请求头测试")
+
+	var mu sync.Mutex
+	var retried http.Header
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		retried = r.Header.Clone()
+		mu.Unlock()
+		w.Write([]byte(`<html><title>Secure</title></html>`))
+	}))
+	server.Listener = &httpsOnlyListener{Listener: server.Listener}
+	server.StartTLS()
+	defer server.Close()
+
+	picker, _ := core.NewUserAgentPicker(core.UAStrategyFixed, []string{"moongazing-scan/1.0"})
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.Retry = fingerprint.RetryPolicy{Attempts: 1}
+	scanner.SetUserAgents(picker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result := scanner.ScanFingerprint(ctx, "http://"+strings.TrimPrefix(server.URL, "https://"))
+	if !strings.HasPrefix(result.URL, "https://") || result.Title != "Secure" {
+		t.Fatalf("http 失败后应改用 https: url=%s error=%s", result.URL, result.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if retried.Get("User-Agent") != "moongazing-scan/1.0" || result.UserAgent != "moongazing-scan/1.0" {
+		t.Errorf("https 重试应使用配置的 User-Agent: %q", retried.Get("User-Agent"))
+	}
+	if retried.Get("Accept") == "" || retried.Get("Accept-Language") == "" {
+		t.Errorf("https 重试不应丢失 Accept、Accept-Language: %v", retried)
+	}
+}
+
+// writeHeaderSpray 模拟支持 --header 的 spray，把收到的参数写入 args.txt
+func writeHeaderSpray(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "spray")
+	script := `#!/bin/sh
+if [ "$1" = "-h" ]; then echo '      --header=     String, custom headers, e.g.: --header "Auth: example_auth"'; exit 0; fi
+for arg in "$@"; do echo "$arg"; done > "` + filepath.Join(dir, "args.txt") + `"
+exit 0
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake spray: %v", err)
+	}
+	return path
+}
+
+// TestExternalToolUserAgentArgs 配置 User-Agent 策略时 katana、spray 的命令行带上 User-Agent 请求头，
+// 未配置时不传，自定义请求头已设置 User-Agent 时不重复
+func TestExternalToolUserAgentArgs(t *testing.T) {
+	printSeparator("外部工具 User-Agent 参数测试")
+
+	picker, _ := core.NewUserAgentPicker(core.UAStrategyFixed, []string{"moongazing-scan/1.0"})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	katanaDir := t.TempDir()
+	katana := webscan.NewKatanaScanner()
+	katana.BinPath = writeHeaderKatana(t, katanaDir)
+	katana.TempDir = katanaDir
+	readArgs := func(dir string) string {
+		t.Helper()
+		argv, err := os.ReadFile(filepath.Join(dir, "args.txt"))
+		if err != nil {
+			t.Fatalf("读取参数失败: %v", err)
+		}
+		return string(argv)
+	}
+
+	if _, err := katana.Crawl(ctx, "https://app.example.com"); err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+	if argv := readArgs(katanaDir); strings.Contains(argv, "User-Agent") {
+		t.Errorf("未配置策略时 katana 不应传 User-Agent:\n%s", argv)
+	}
+
+	if unsupported := katana.SetUserAgents(picker); unsupported {
+		t.Fatal("支持 -H 的 katana 不应返回不支持")
+	}
+	if _, err := katana.Crawl(ctx, "https://app.example.com"); err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+	if argv := readArgs(katanaDir); !strings.Contains(argv, "-H\nUser-Agent: moongazing-scan/1.0\n") {
+		t.Errorf("katana 参数缺少 User-Agent:\n%s", argv)
+	}
+
+	katana.SetHeaders(core.NewScanHeaders(map[string]string{"user-agent": "moongazing-auth"}, ""))
+	if _, err := katana.Crawl(ctx, "https://app.example.com"); err != nil {
+		t.Fatalf("爬取失败: %v", err)
+	}
+	if argv := readArgs(katanaDir); strings.Count(argv, "User-Agent") != 1 || !strings.Contains(argv, "User-Agent: moongazing-auth") {
+		t.Errorf("自定义请求头的 User-Agent 应优先且只传一次:\n%s", argv)
+	}
+
+	sprayDir := t.TempDir()
+	spray := webscan.NewSprayScanner()
+	spray.BinPath = writeHeaderSpray(t, sprayDir)
+	spray.TempDir = sprayDir
+	if unsupported := spray.SetUserAgents(picker); unsupported {
+		t.Fatal("支持 --header 的 spray 不应返回不支持")
+	}
+	spray.Scan(ctx, "https://app.example.com")
+	if argv := readArgs(sprayDir); !strings.Contains(argv, "--header\nUser-Agent: moongazing-scan/1.0\n") {
+		t.Errorf("spray 参数缺少 User-Agent:\n%s", argv)
+	}
+
+	// 不支持请求头参数的版本不传
+	old := webscan.NewSprayScanner()
+	old.BinPath = writeFakeHelpTool(t, t.TempDir(), "spray", "--proxy")
+	if !old.SetUserAgents(picker) || old.UserAgents != nil {
+		t.Error("不支持 --header 的 spray 应返回不支持")
+	}
+}
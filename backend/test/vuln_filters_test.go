@@ -0,0 +1,208 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/scanner/vulnscan"
+	"moongazing/service"
+	"moongazing/service/pipeline"
+)
+
+// ========== 漏洞扫描严重级别和模板选择测试 ==========
+
+// hasArgPair argv 中 flag 后紧跟 value
+func hasArgPair(args []string, flag, value string) bool {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag && args[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// TestNucleiArgsFilters severities=[critical,high]、tags=[cve] 生成对应的 nuclei 参数
+func TestNucleiArgsFilters(t *testing.T) {
+	printSeparator("nuclei 过滤参数测试")
+
+	scanner := vulnscan.NewNucleiCLIScanner("")
+	config := vulnscan.NewNucleiScanConfig([]string{"critical", "High"}, []string{"cve"}, 0, 0)
+	args := scanner.BuildArgs([]string{"http://target.example.com"}, config)
+
+	if !hasArgPair(args, "-severity", "critical,high") {
+		t.Errorf("应包含 -severity critical,high: %v", args)
+	}
+	if !hasArgPair(args, "-tags", "cve") {
+		t.Errorf("应包含 -tags cve: %v", args)
+	}
+	if !hasArgPair(args, "-u", "http://target.example.com") || !hasArgPair(args, "-c", "25") || !hasArgPair(args, "-rl", "150") {
+		t.Errorf("目标和默认速率参数不符: %v", args)
+	}
+	for _, arg := range args {
+		if arg == "-t" {
+			t.Errorf("只选择标签时不应指定模板路径: %v", args)
+		}
+	}
+
+	// 模板目录和文件走 -t，速率设置覆盖默认值
+	config = vulnscan.NewNucleiScanConfig(nil, []string{"cves/", "default-logins/", "custom/tomcat.yaml", "rce"}, 5, 20)
+	args = scanner.BuildArgs([]string{"http://target.example.com"}, config)
+	for _, path := range []string{"cves/", "default-logins/", "custom/tomcat.yaml"} {
+		if !hasArgPair(args, "-t", path) {
+			t.Errorf("应包含 -t %s: %v", path, args)
+		}
+	}
+	if !hasArgPair(args, "-tags", "rce") || !hasArgPair(args, "-c", "5") || !hasArgPair(args, "-rl", "20") {
+		t.Errorf("标签和速率参数不符: %v", args)
+	}
+}
+
+// TestValidateVulnSeverities 创建任务时拒绝未知的严重级别
+func TestValidateVulnSeverities(t *testing.T) {
+	printSeparator("漏洞严重级别校验测试")
+
+	if err := service.ValidateVulnScanConfig(models.TaskConfig{VulnSeverities: []string{"critical", "HIGH", "info"}}); err != nil {
+		t.Errorf("有效的严重级别不应报错: %v", err)
+	}
+	if err := service.ValidateVulnScanConfig(models.TaskConfig{VulnSeverities: []string{"critical", "severe"}}); err == nil || !strings.Contains(err.Error(), "severe") {
+		t.Errorf("未知的严重级别应报错: %v", err)
+	}
+	if err := service.ValidateVulnScanConfig(models.TaskConfig{VulnRateLimit: -1}); err == nil {
+		t.Error("负数速率应报错")
+	}
+}
+
+// TestVulnModuleNucleiCommandEvent 漏洞扫描模块把 nuclei 调用参数记录到任务事件，并使用任务的过滤条件
+func TestVulnModuleNucleiCommandEvent(t *testing.T) {
+	printSeparator("漏洞扫描 nuclei 调用事件测试")
+
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"-version\" ]; then exit 0; fi\n" +
+		"echo \"$@\" >> " + argsFile + "\n" +
+		`echo '{"template-id":"CVE-2021-44228","info":{"name":"Log4j RCE","severity":"critical","classification":{"cve-id":["CVE-2021-44228"]}},"host":"http://127.0.0.1:1","matched-at":"http://127.0.0.1:1/"}'` + "\n"
+	bin := filepath.Join(dir, "nuclei")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake nuclei: %v", err)
+	}
+	nuclei := vulnscan.NewNucleiCLIScanner("")
+	nuclei.SetNucleiBinary(bin)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []pipeline.Event
+	recorder := pipeline.NewEventRecorder()
+	recorder.SetHandler(func(e pipeline.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewVulnScanModule(ctx, collector, 2)
+	module.SetEventRecorder(recorder)
+	module.SetNucleiScanner(nuclei)
+	module.SetFilters([]string{"critical", "high"}, []string{"cve"})
+	module.SetRateLimit(4, 30)
+	input := make(chan interface{}, 1)
+	input <- "http://127.0.0.1:1/"
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	var vulns []pipeline.VulnResult
+	for len(out) > 0 {
+		if v, ok := (<-out).(pipeline.VulnResult); ok {
+			vulns = append(vulns, v)
+		}
+	}
+	if len(vulns) != 1 || vulns[0].VulnID != "CVE-2021-44228" || vulns[0].Source != "nuclei" {
+		t.Errorf("应输出 nuclei 发现的漏洞: %+v", vulns)
+	}
+
+	data, _ := os.ReadFile(argsFile)
+	invoked := string(data)
+	for _, want := range []string{"-severity critical,high", "-tags cve", "-c 4", "-rl 30"} {
+		if !strings.Contains(invoked, want) {
+			t.Errorf("nuclei 调用参数缺少 %q: %s", want, invoked)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var command *pipeline.Event
+	for i := range events {
+		if events[i].Type == pipeline.EventToolCommand {
+			command = &events[i]
+		}
+	}
+	if command == nil || !strings.Contains(command.Message, "-severity critical,high") || !strings.Contains(command.Message, "-tags cve") {
+		t.Errorf("任务事件应记录 nuclei 调用参数: %+v", command)
+	}
+}
+
+// TestVulnModuleNucleiBatch 多个目标一次调用 nuclei，结果按 host 对应到各自的目标
+func TestVulnModuleNucleiBatch(t *testing.T) {
+	printSeparator("漏洞扫描 nuclei 批量调用测试")
+
+	dir := t.TempDir()
+	callsFile := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"-version\" ]; then exit 0; fi\n" +
+		"echo call >> " + callsFile + "\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  if [ \"$1\" = \"-u\" ]; then\n" +
+		`    echo "{\"template-id\":\"exposed-panel\",\"info\":{\"name\":\"Panel\",\"severity\":\"high\"},\"host\":\"$2\",\"matched-at\":\"$2/admin\"}"` + "\n" +
+		"  fi\n" +
+		"  shift\n" +
+		"done\n"
+	bin := filepath.Join(dir, "nuclei")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake nuclei: %v", err)
+	}
+	nuclei := vulnscan.NewNucleiCLIScanner("")
+	nuclei.SetNucleiBinary(bin)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out := make(chan interface{}, 20)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 20))
+	module := pipeline.NewVulnScanModule(ctx, collector, 2)
+	module.SetNucleiScanner(nuclei)
+	targets := []string{"http://a.example.com", "http://b.example.com:8080", "https://c.example.com"}
+	input := make(chan interface{}, len(targets))
+	for _, target := range targets {
+		input <- target
+	}
+	close(input)
+	module.SetInput(input)
+	module.ModuleRun()
+
+	found := make(map[string]string)
+	for len(out) > 0 {
+		if v, ok := (<-out).(pipeline.VulnResult); ok {
+			found[v.Target] = v.MatchedAt
+		}
+	}
+	for _, target := range targets {
+		if found[target] != target+"/admin" {
+			t.Errorf("%s 的漏洞应对应到该目标: %v", target, found)
+		}
+	}
+	data, _ := os.ReadFile(callsFile)
+	if calls := strings.Count(string(data), "call"); calls != 1 {
+		t.Errorf("3 个目标应一次调用 nuclei, 实际 %d 次", calls)
+	}
+}
@@ -0,0 +1,370 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 工作空间漏洞测试 ==========
+
+// memoryFindingStore 内存漏洞存储，按 Mongo 实现的语义合并
+type memoryFindingStore struct {
+	mu       sync.Mutex
+	findings map[string]*models.Finding
+}
+
+func newMemoryFindingStore() *memoryFindingStore {
+	return &memoryFindingStore{findings: make(map[string]*models.Finding)}
+}
+
+func findingKey(f *models.Finding) string {
+	return f.WorkspaceID.Hex() + "|" + f.Target + "|" + f.VulnID
+}
+
+func cloneFinding(f *models.Finding) *models.Finding {
+	c := *f
+	c.History = append([]models.FindingStatusChange(nil), f.History...)
+	return &c
+}
+
+func (s *memoryFindingStore) UpsertFinding(ctx context.Context, finding *models.Finding) (*models.Finding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.findings[findingKey(finding)]
+	if !ok {
+		created := cloneFinding(finding)
+		created.ID = primitive.NewObjectID()
+		created.Status = models.FindingStatusOpen
+		created.Occurrences = 1
+		s.findings[findingKey(finding)] = created
+		return cloneFinding(created), nil
+	}
+	existing.Occurrences++
+	existing.LastTaskID = finding.LastTaskID
+	existing.PossiblyFixed = false
+	if finding.LastSeen.After(existing.LastSeen) {
+		existing.LastSeen = finding.LastSeen
+	}
+	if finding.Name != "" {
+		existing.Name = finding.Name
+	}
+	if finding.Severity != "" {
+		existing.Severity = finding.Severity
+	}
+	if finding.CVSSScore > 0 {
+		existing.CVSSScore = finding.CVSSScore
+		existing.CVSSVector = finding.CVSSVector
+	}
+	return cloneFinding(existing), nil
+}
+
+func (s *memoryFindingStore) byID(id primitive.ObjectID) *models.Finding {
+	for _, f := range s.findings {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *memoryFindingStore) GetFinding(ctx context.Context, id primitive.ObjectID) (*models.Finding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.byID(id); f != nil {
+		return cloneFinding(f), nil
+	}
+	return nil, service.ErrFindingNotFound
+}
+
+func (s *memoryFindingStore) SetFindingStatus(ctx context.Context, id primitive.ObjectID, change models.FindingStatusChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.byID(id)
+	if f == nil || f.Status != change.From {
+		return service.ErrFindingStatusConflict
+	}
+	f.Status = change.To
+	f.PossiblyFixed = false
+	f.History = append(f.History, change)
+	return nil
+}
+
+func (s *memoryFindingStore) FindFindings(ctx context.Context, filter service.FindingFilter, page, pageSize int) ([]*models.Finding, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*models.Finding
+	for _, f := range s.findings {
+		if f.WorkspaceID != filter.WorkspaceID || (filter.PossiblyFixed && !f.PossiblyFixed) {
+			continue
+		}
+		if filter.Target != "" && !strings.Contains(f.Target, filter.Target) {
+			continue
+		}
+		if len(filter.Statuses) > 0 {
+			matched := false
+			for _, st := range filter.Statuses {
+				matched = matched || st == f.Status
+			}
+			if !matched {
+				continue
+			}
+		}
+		result = append(result, cloneFinding(f))
+	}
+	return result, int64(len(result)), nil
+}
+
+func (s *memoryFindingStore) MarkPossiblyFixed(ctx context.Context, workspaceID primitive.ObjectID, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, f := range s.findings {
+		if f.WorkspaceID == workspaceID && f.Status == models.FindingStatusOpen && !f.PossiblyFixed && f.LastSeen.Before(before) {
+			f.PossiblyFixed = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// memoryCVEStore 内存 CVE 元数据存储
+type memoryCVEStore struct {
+	items map[string]*models.CVEMetadata
+}
+
+func (s *memoryCVEStore) GetCVEs(ctx context.Context, ids []string) (map[string]*models.CVEMetadata, error) {
+	result := make(map[string]*models.CVEMetadata)
+	for _, id := range ids {
+		if item, ok := s.items[id]; ok {
+			result[id] = item
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryCVEStore) SaveCVEs(ctx context.Context, items []*models.CVEMetadata) error {
+	for _, item := range items {
+		s.items[item.ID] = item
+	}
+	return nil
+}
+
+// vulnResult 构造漏洞扫描结果
+func vulnResult(ws, task primitive.ObjectID, target, vulnID string, at time.Time) *models.ScanResult {
+	return &models.ScanResult{
+		TaskID:      task,
+		WorkspaceID: ws,
+		Type:        models.ResultTypeVuln,
+		Source:      "nuclei",
+		CreatedAt:   at,
+		Data: bson.M{
+			"target":   target,
+			"vuln_id":  vulnID,
+			"name":     "Apache Log4j RCE",
+			"severity": "CRITICAL",
+		},
+	}
+}
+
+// TestFindingUpsertOnRepeat 同一目标上的同一漏洞在多次任务中合并为一条，记录首次/最近发现时间和次数
+func TestFindingUpsertOnRepeat(t *testing.T) {
+	printSeparator("漏洞合并测试")
+
+	store := newMemoryFindingStore()
+	cves := &memoryCVEStore{items: make(map[string]*models.CVEMetadata)}
+	svc := service.NewFindingServiceWithStore(store, cves)
+	ws := primitive.NewObjectID()
+	tasks := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+
+	for i, task := range tasks {
+		if err := svc.Record(vulnResult(ws, task, "https://a.example.com", "cve-2021-44228", base.Add(time.Duration(i)*24*time.Hour))); err != nil {
+			t.Fatalf("合并漏洞失败: %v", err)
+		}
+	}
+	svc.Record(vulnResult(ws, tasks[0], "https://b.example.com", "cve-2021-44228", base))
+	svc.Record(vulnResult(primitive.NewObjectID(), tasks[0], "https://a.example.com", "cve-2021-44228", base))
+	// 非漏洞结果忽略
+	svc.Record(&models.ScanResult{WorkspaceID: ws, Type: models.ResultTypeSubdomain, Data: bson.M{"subdomain": "a.example.com"}})
+
+	findings, total, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws, Target: "a.example.com"}, 1, 20)
+	if total != 1 {
+		t.Fatalf("同一工作空间、目标、漏洞应只有一条: %d", total)
+	}
+	f := findings[0]
+	if f.Occurrences != 3 || !f.FirstSeen.Equal(base) || !f.LastSeen.Equal(base.Add(48*time.Hour)) {
+		t.Errorf("发现次数和时间不正确: occurrences=%d first=%v last=%v", f.Occurrences, f.FirstSeen, f.LastSeen)
+	}
+	if f.FirstTaskID != tasks[0] || f.LastTaskID != tasks[2] {
+		t.Errorf("首次/最近任务不正确: %s %s", f.FirstTaskID.Hex(), f.LastTaskID.Hex())
+	}
+	if f.Status != models.FindingStatusOpen || f.Severity != "critical" || len(f.CVEIDs) != 1 || f.CVEIDs[0] != "CVE-2021-44228" {
+		t.Errorf("漏洞信息不正确: %+v", f)
+	}
+	if _, total, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws}, 1, 20); total != 2 {
+		t.Errorf("不同目标应分别记录: %d", total)
+	}
+}
+
+// TestFindingCVEEnrichment 导入的 CVE 元数据补充评分，多个 CVE 时取最高分
+func TestFindingCVEEnrichment(t *testing.T) {
+	printSeparator("CVE 元数据测试")
+
+	if ids := service.ExtractCVEIDs("cve-2021-44228", "Log4Shell CVE-2021-44228 / CVE-2021-45046"); len(ids) != 2 || ids[1] != "CVE-2021-45046" {
+		t.Errorf("CVE 编号提取不正确: %v", ids)
+	}
+
+	simple := `[
+		{"id": "CVE-2021-44228", "cvss_score": 10.0, "cvss_vector": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", "severity": "CRITICAL", "summary": "Log4Shell"},
+		{"id": "not-a-cve", "cvss_score": 5.0}
+	]`
+	items, err := service.ParseCVEFeed(strings.NewReader(simple))
+	if err != nil || len(items) != 1 || items[0].Severity != "critical" {
+		t.Fatalf("简单格式解析不正确: %v %+v", err, items)
+	}
+
+	nvd := `{"vulnerabilities": [{"cve": {
+		"id": "CVE-2021-45046",
+		"published": "2021-12-14T19:15:07.733",
+		"descriptions": [{"lang": "es", "value": "resumen"}, {"lang": "en", "value": "Incomplete fix"}],
+		"metrics": {
+			"cvssMetricV31": [
+				{"type": "Secondary", "cvssData": {"baseScore": 9.1, "vectorString": "secondary", "baseSeverity": "CRITICAL"}},
+				{"type": "Primary", "cvssData": {"baseScore": 9.0, "vectorString": "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:C/C:H/I:H/A:H", "baseSeverity": "CRITICAL"}}
+			],
+			"cvssMetricV2": [{"type": "Primary", "cvssData": {"baseScore": 5.1}, "baseSeverity": "MEDIUM"}]
+		},
+		"references": [{"url": "https://logging.apache.org/log4j/2.x/security.html"}]
+	}}]}`
+	nvdItems, err := service.ParseCVEFeed(strings.NewReader(nvd))
+	if err != nil || len(nvdItems) != 1 {
+		t.Fatalf("NVD 格式解析失败: %v", err)
+	}
+	if it := nvdItems[0]; it.CVSSScore != 9.0 || it.Summary != "Incomplete fix" || it.Published.IsZero() || len(it.References) != 1 {
+		t.Errorf("NVD 格式应取 v3.1 的 Primary 评分和英文描述: %+v", it)
+	}
+	if _, err := service.ParseCVEFeed(strings.NewReader(`[{"id": "bad"}]`)); !errors.Is(err, service.ErrEmptyCVEFeed) {
+		t.Errorf("没有合法条目时应返回 ErrEmptyCVEFeed: %v", err)
+	}
+
+	cves := &memoryCVEStore{items: make(map[string]*models.CVEMetadata)}
+	cves.SaveCVEs(context.Background(), append(items, nvdItems...))
+	store := newMemoryFindingStore()
+	svc := service.NewFindingServiceWithStore(store, cves)
+	ws := primitive.NewObjectID()
+	result := vulnResult(ws, primitive.NewObjectID(), "https://a.example.com", "CVE-2021-45046", time.Now())
+	result.Data["name"] = "Log4j CVE-2021-44228 bypass"
+	svc.Record(result)
+
+	findings, _, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws}, 1, 20)
+	if len(findings) != 1 || findings[0].CVSSScore != 10.0 || findings[0].CVESummary != "Log4Shell" {
+		t.Errorf("应使用评分最高的 CVE: %+v", findings)
+	}
+}
+
+// TestFindingStatusTransitions 状态变更：接受风险和误报需要说明，非法变更被拒绝，并发修改冲突，变更留下记录
+func TestFindingStatusTransitions(t *testing.T) {
+	printSeparator("漏洞状态变更测试")
+
+	store := newMemoryFindingStore()
+	svc := service.NewFindingServiceWithStore(store, nil)
+	ws := primitive.NewObjectID()
+	svc.Record(vulnResult(ws, primitive.NewObjectID(), "https://a.example.com", "exposed-panel", time.Now()))
+	findings, _, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws}, 1, 20)
+	id := findings[0].ID.Hex()
+
+	if _, err := svc.ChangeStatus(id, models.FindingStatusAccepted, "  ", "alice"); !errors.Is(err, service.ErrFindingNoteRequired) {
+		t.Errorf("接受风险未填写说明应被拒绝: %v", err)
+	}
+	if _, err := svc.ChangeStatus(id, "closed", "", "alice"); !errors.Is(err, service.ErrInvalidFindingStatus) {
+		t.Errorf("未知状态应被拒绝: %v", err)
+	}
+	if _, err := svc.ChangeStatus(primitive.NewObjectID().Hex(), models.FindingStatusFixed, "", "alice"); !errors.Is(err, service.ErrFindingNotFound) {
+		t.Errorf("不存在的漏洞: %v", err)
+	}
+
+	f, err := svc.ChangeStatus(id, models.FindingStatusFalsePositive, "WAF 拦截页", "alice")
+	if err != nil || f.Status != models.FindingStatusFalsePositive {
+		t.Fatalf("标记误报失败: %v", err)
+	}
+	if _, err := svc.ChangeStatus(id, models.FindingStatusFixed, "", "alice"); err == nil {
+		t.Errorf("误报不能直接变更为已修复")
+	}
+	if _, err := svc.ChangeStatus(id, models.FindingStatusOpen, "", "bob"); err != nil {
+		t.Fatalf("误报应能重新打开: %v", err)
+	}
+
+	// 读取后被他人修改，条件更新返回冲突
+	err = store.SetFindingStatus(context.Background(), findings[0].ID, models.FindingStatusChange{From: models.FindingStatusFixed, To: models.FindingStatusOpen})
+	if !errors.Is(err, service.ErrFindingStatusConflict) {
+		t.Errorf("状态不一致时应返回冲突: %v", err)
+	}
+
+	f, _ = svc.GetFinding(id)
+	if len(f.History) != 2 || f.History[0].Note != "WAF 拦截页" || f.History[0].By != "alice" || f.History[1].From != models.FindingStatusFalsePositive {
+		t.Errorf("状态变更记录不正确: %+v", f.History)
+	}
+	if statuses, err := service.ParseFindingStatuses([]string{"open", "accepted"}); err != nil || len(statuses) != 2 {
+		t.Errorf("解析状态失败: %v", err)
+	}
+}
+
+// TestFindingReopenAndPossiblyFixed 已修复的漏洞再次发现时重新打开；长时间未出现的待处理漏洞标记为可能已修复
+func TestFindingReopenAndPossiblyFixed(t *testing.T) {
+	printSeparator("漏洞重新打开测试")
+
+	store := newMemoryFindingStore()
+	svc := service.NewFindingServiceWithStore(store, nil)
+	ws := primitive.NewObjectID()
+	old := time.Now().AddDate(0, 0, -(service.DefaultFindingStaleDays + 5))
+	svc.Record(vulnResult(ws, primitive.NewObjectID(), "https://a.example.com", "exposed-panel", old))
+	svc.Record(vulnResult(ws, primitive.NewObjectID(), "https://b.example.com", "exposed-panel", old))
+	svc.Record(vulnResult(ws, primitive.NewObjectID(), "https://c.example.com", "exposed-panel", time.Now()))
+
+	a, _, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws, Target: "a.example.com"}, 1, 20)
+	if _, err := svc.ChangeStatus(a[0].ID.Hex(), models.FindingStatusFixed, "已升级", "alice"); err != nil {
+		t.Fatalf("标记已修复失败: %v", err)
+	}
+
+	n, err := svc.FlagPossiblyFixed(ws)
+	if err != nil || n != 1 {
+		t.Errorf("只有长期未出现的待处理漏洞 b 应被标记: %d %v", n, err)
+	}
+	if n, _ := svc.FlagPossiblyFixed(ws); n != 0 {
+		t.Errorf("已标记的漏洞不重复计数: %d", n)
+	}
+	flagged, _, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws, PossiblyFixed: true}, 1, 20)
+	if len(flagged) != 1 || flagged[0].Target != "https://b.example.com" {
+		t.Errorf("可能已修复的漏洞不正确: %+v", flagged)
+	}
+
+	// 再次扫描到：a 重新打开，b 清除标记
+	task := primitive.NewObjectID()
+	svc.Record(vulnResult(ws, task, "https://a.example.com", "exposed-panel", time.Now()))
+	svc.Record(vulnResult(ws, task, "https://b.example.com", "exposed-panel", time.Now()))
+	f, _ := svc.GetFinding(a[0].ID.Hex())
+	if f.Status != models.FindingStatusOpen || len(f.History) != 2 {
+		t.Fatalf("已修复的漏洞再次发现时应重新打开: %+v", f)
+	}
+	if last := f.History[1]; last.By != "system" || !strings.Contains(last.Note, task.Hex()) {
+		t.Errorf("重新打开应由 system 记录任务: %+v", last)
+	}
+	if flagged, _, _ := svc.ListFindings(service.FindingFilter{WorkspaceID: ws, PossiblyFixed: true}, 1, 20); len(flagged) != 0 {
+		t.Errorf("再次发现后应清除可能已修复标记: %+v", flagged)
+	}
+
+	svc.SetStaleDays(0)
+	if n, _ := svc.FlagPossiblyFixed(ws); n != 0 {
+		t.Errorf("天数为 0 时不标记")
+	}
+}
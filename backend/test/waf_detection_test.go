@@ -0,0 +1,278 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"moongazing/scanner/core"
+	"moongazing/scanner/fingerprint"
+	"moongazing/scanner/webscan"
+	"moongazing/service/pipeline"
+)
+
+// ========== WAF 识别测试 ==========
+
+// wafProbed 探测请求的查询参数包含脚本标签
+func wafProbed(r *http.Request) bool {
+	return strings.Contains(r.URL.RawQuery, "%3Cscript%3E") || strings.Contains(r.URL.Query().Get("q"), "<script>")
+}
+
+// TestWAFDetectionRules 按 waf.yaml 的响应头、Cookie 和拦截页面识别常见 WAF
+func TestWAFDetectionRules(t *testing.T) {
+	printSeparator("WAF 规则识别测试")
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		waf     string
+		method  string
+	}{
+		{"cloudflare", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "cloudflare")
+			w.Header().Set("CF-RAY", "8a1b2c3d4e5f6a7b-SJC")
+			w.Write([]byte(`<html><head><title>Shop</title></head></html>`))
+		}, "Cloudflare", fingerprint.WAFMethodHeader},
+		{"sucuri", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Sucuri-ID", "18015")
+			w.Write([]byte(`<html><head><title>Blog</title></head></html>`))
+		}, "Sucuri", fingerprint.WAFMethodHeader},
+		{"incapsula", func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "visid_incap_2417", Value: "abc"})
+			http.SetCookie(w, &http.Cookie{Name: "incap_ses_1184_2417", Value: "def"})
+			w.Write([]byte(`<html><head><title>Bank</title></head></html>`))
+		}, "Imperva Incapsula", fingerprint.WAFMethodCookie},
+		{"block page", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<html><head><title>Attention Required! | Cloudflare</title></head><body><div id="cf-error-details"></div></body></html>`))
+		}, "Cloudflare", fingerprint.WAFMethodBody},
+	}
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	if f := scanner.RulesSummary.File("waf.yaml"); f == nil || f.Loaded == 0 || f.Error != "" {
+		t.Fatalf("waf.yaml 应已加载: %+v", f)
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(c.handler)
+		result := scanner.ScanFingerprint(context.Background(), server.URL)
+		server.Close()
+		if result.WAF == nil || result.WAF.Name != c.waf || result.WAF.Method != c.method || result.WAF.Evidence == "" {
+			t.Errorf("%s: 期望 %s (%s), 实际 %+v", c.name, c.waf, c.method, result.WAF)
+		}
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Write([]byte(`<html><head><title>Welcome</title></head></html>`))
+	}))
+	defer plain.Close()
+	if result := scanner.ScanFingerprint(context.Background(), plain.URL); result.WAF != nil {
+		t.Errorf("没有 WAF 特征的页面不应识别出 WAF: %+v", result.WAF)
+	}
+
+	// 指定规则目录中的 waf.yaml 替换内置规则
+	dir := t.TempDir()
+	writeRulesFile(t, dir, "waf.yaml", `Acme Shield:
+  headers:
+    X-Acme-Shield: ""
+Empty:
+  body: []
+`)
+	custom := fingerprint.NewFingerprintScannerWithRules(dir)
+	if f := custom.RulesSummary.File("waf.yaml"); f == nil || f.Embedded || f.Loaded != 1 || f.Skipped != 1 {
+		t.Errorf("waf.yaml 应从指定目录加载 1 条并跳过没有特征的规则: %+v", f)
+	}
+	acme := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Acme-Shield", "on")
+		w.Header().Set("Server", "cloudflare")
+	}))
+	defer acme.Close()
+	if result := custom.ScanFingerprint(context.Background(), acme.URL); result.WAF == nil || result.WAF.Name != "Acme Shield" {
+		t.Errorf("应使用指定目录的 WAF 规则: %+v", result.WAF)
+	}
+}
+
+// TestWAFActiveProbe 主动探测默认关闭；开启后带可疑参数的请求被拦截时记录 WAF，拦截页面可识别时记录名称
+func TestWAFActiveProbe(t *testing.T) {
+	printSeparator("WAF 主动探测测试")
+
+	var mu sync.Mutex
+	probes := 0
+	generic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wafProbed(r) {
+			mu.Lock()
+			probes++
+			mu.Unlock()
+			if r.Header.Get("Cookie") != "session=abc" {
+				t.Errorf("探测请求应与正常请求使用相同的请求头: %v", r.Header)
+			}
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden"))
+			return
+		}
+		w.Write([]byte(`<html><head><title>Portal</title></head></html>`))
+	}))
+	defer generic.Close()
+
+	scanner := fingerprint.NewFingerprintScanner(1)
+	scanner.SetHeaders(core.NewScanHeaders(nil, "session=abc"))
+	ctx := context.Background()
+	if result := scanner.ScanFingerprint(ctx, generic.URL); result.WAF != nil || probes != 0 {
+		t.Errorf("默认不应发送探测请求: %+v, probes=%d", result.WAF, probes)
+	}
+
+	scanner.WAFProbe = true
+	result := scanner.ScanFingerprint(ctx, generic.URL)
+	if result.WAF == nil || result.WAF.Name != fingerprint.WAFGeneric || result.WAF.Method != fingerprint.WAFMethodProbe ||
+		result.WAF.Evidence != "status 200 -> 403" {
+		t.Errorf("探测请求被拦截时应记录通用 WAF: %+v", result.WAF)
+	}
+	if probes != 1 || result.StatusCode != 200 || result.Title != "Portal" {
+		t.Errorf("探测不应影响正常页面的结果: probes=%d status=%d title=%q", probes, result.StatusCode, result.Title)
+	}
+
+	// 以 200 返回的拦截页面按规则识别名称
+	named := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wafProbed(r) {
+			w.Write([]byte(`<html><head><title>Access Denied - Sucuri Website Firewall</title></head></html>`))
+			return
+		}
+		w.Write([]byte(`<html><head><title>Blog</title></head></html>`))
+	}))
+	defer named.Close()
+	if result := scanner.ScanFingerprint(ctx, named.URL); result.WAF == nil || result.WAF.Name != "Sucuri" || result.WAF.Method != fingerprint.WAFMethodProbe {
+		t.Errorf("拦截页面应按规则识别 WAF: %+v", result.WAF)
+	}
+
+	// 拦截时直接断开连接
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wafProbed(r) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.(*net.TCPConn).SetLinger(0)
+				conn.Close()
+			}
+			return
+		}
+		w.Write([]byte(`<html><head><title>Shop</title></head></html>`))
+	}))
+	defer reset.Close()
+	if result := scanner.ScanFingerprint(ctx, reset.URL); result.WAF == nil || result.WAF.Name != fingerprint.WAFGeneric || result.Error != "" {
+		t.Errorf("探测请求被断开时应记录通用 WAF: %+v (%s)", result.WAF, result.Error)
+	}
+
+	// 探测请求与正常请求相同时不记录
+	same := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>Docs</title></head></html>`))
+	}))
+	defer same.Close()
+	if result := scanner.ScanFingerprint(ctx, same.URL); result.WAF != nil {
+		t.Errorf("探测请求未被拦截时不应记录 WAF: %+v", result.WAF)
+	}
+}
+
+// TestFingerprintModuleWAF 指纹识别模块把检测到的 WAF 写入 Web 资产
+func TestFingerprintModuleWAF(t *testing.T) {
+	printSeparator("指纹识别模块 WAF 测试")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wafProbed(r) {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Write([]byte(`<html><head><title>Admin</title></head></html>`))
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out := make(chan interface{}, 10)
+	collector := pipeline.NewResultCollectorModule(ctx, out)
+	collector.SetInput(make(chan interface{}, 10))
+	module := pipeline.NewFingerprintModule(ctx, collector, 2)
+	module.SetWAFProbe(true)
+	input := make(chan interface{}, 1)
+	module.SetInput(input)
+	input <- pipeline.PortAlive{Host: host, IP: host, Port: port}
+	close(input)
+	if err := module.ModuleRun(); err != nil {
+		t.Fatalf("指纹识别失败: %v", err)
+	}
+
+	var asset *pipeline.AssetHttp
+	for len(out) > 0 {
+		if a, ok := (<-out).(pipeline.AssetHttp); ok {
+			asset = &a
+		}
+	}
+	if asset == nil || asset.WAF != fingerprint.WAFGeneric || asset.WAFMethod != fingerprint.WAFMethodProbe {
+		t.Errorf("Web 资产应记录 WAF: %+v", asset)
+	}
+}
+
+// writeThreadsSpray 模拟 spray，把每次运行的 -t 参数追加到返回的文件
+func writeThreadsSpray(t *testing.T) (*webscan.SprayScanner, string) {
+	t.Helper()
+	dir := t.TempDir()
+	record := filepath.Join(dir, "threads")
+	path := filepath.Join(dir, "spray")
+	script := "#!/bin/sh\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = \"-t\" ]; then echo \"$2\" >> '" + record + "'; fi\n  shift\ndone\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake spray: %v", err)
+	}
+	scanner := webscan.NewSprayScanner()
+	scanner.BinPath = path
+	scanner.TempDir = t.TempDir()
+	scanner.Concurrency = 20
+	return scanner, record
+}
+
+// TestDirScanWAFThreads 设置 WAF 线程数后，受 WAF 保护的目标使用较低的 spray 线程数
+func TestDirScanWAFThreads(t *testing.T) {
+	printSeparator("目录扫描 WAF 线程数测试")
+
+	run := func(batch bool, wafThreads int) []string {
+		scanner, record := writeThreadsSpray(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		module := pipeline.NewDirScanModule(ctx, nil, 2, nil)
+		module.SetSprayScanner(scanner)
+		module.SetBatchMode(batch, 0)
+		module.SetWAFThreads(wafThreads)
+		input := make(chan interface{}, 2)
+		module.SetInput(input)
+		input <- pipeline.AssetHttp{URL: "http://app.example.test", Host: "app.example.test", IP: "192.0.2.10"}
+		input <- pipeline.AssetHttp{URL: "http://shop.example.test", Host: "shop.example.test", IP: "192.0.2.20", WAF: "Cloudflare"}
+		close(input)
+		if err := module.ModuleRun(); err != nil {
+			t.Fatalf("目录扫描失败: %v", err)
+		}
+		data, _ := os.ReadFile(record)
+		threads := strings.Fields(string(data))
+		sort.Strings(threads)
+		return threads
+	}
+
+	if got := run(true, 0); strings.Join(got, ",") != "20" {
+		t.Errorf("未设置 WAF 线程数时批量模式应一次扫描全部目标: %v", got)
+	}
+	if got := run(true, 5); strings.Join(got, ",") != "20,5" {
+		t.Errorf("批量模式中受 WAF 保护的目标应单独使用 5 个线程: %v", got)
+	}
+	if got := run(false, 5); strings.Join(got, ",") != "20,5" {
+		t.Errorf("流式模式中受 WAF 保护的目标应使用 5 个线程: %v", got)
+	}
+	if got := run(false, 50); strings.Join(got, ",") != "20,20" {
+		t.Errorf("WAF 线程数大于原线程数时不调整: %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"moongazing/scanner/subdomain"
+)
+
+// ========== 泛解析过滤测试 ==========
+
+// rotatingWildcardDNS 模拟在 IP 池中轮换的泛解析：随机子域名每次返回池中相邻的两个 IP
+type rotatingWildcardDNS struct {
+	mu    sync.Mutex
+	pool  []string
+	next  int
+	real  map[string][]string
+	cname map[string]string
+}
+
+func (d *rotatingWildcardDNS) resolve(ctx context.Context, host string) ([]string, error) {
+	if ips, ok := d.real[host]; ok {
+		return ips, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := d.next
+	d.next++
+	return []string{d.pool[i%len(d.pool)], d.pool[(i+1)%len(d.pool)]}, nil
+}
+
+func (d *rotatingWildcardDNS) lookupCNAME(ctx context.Context, host string) (string, error) {
+	if target, ok := d.cname[host]; ok {
+		return target, nil
+	}
+	if _, ok := d.real[host]; ok {
+		return "", nil
+	}
+	return "wildcard.cdn-edge.net.", nil
+}
+
+func newWildcardScanner(dns *rotatingWildcardDNS, httpConfirm bool) *subdomain.ActiveScanner {
+	scanner := subdomain.NewActiveScanner(&subdomain.ActiveScannerConfig{WildcardDetection: true, WildcardHTTPConfirm: httpConfirm}, nil)
+	scanner.SetResolver(dns.resolve)
+	scanner.SetCNAMEResolver(dns.lookupCNAME)
+	return scanner
+}
+
+// TestWildcardPoolRotatingIPs 轮换 IP 池的泛解析：IP 集合是池的子集或 CNAME 相同的判定为泛解析
+func TestWildcardPoolRotatingIPs(t *testing.T) {
+	printSeparator("泛解析 IP 池测试")
+
+	ctx := context.Background()
+	dns := &rotatingWildcardDNS{
+		pool: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		real: map[string][]string{
+			"www.example.com":  {"203.0.113.10"},
+			"mail.example.com": {"10.0.0.4", "203.0.113.20"}, // 与池部分重叠的真实主机
+		},
+	}
+	scanner := newWildcardScanner(dns, false)
+
+	pool := scanner.DetectWildcard(ctx, "example.com")
+	if !pool.Detected() || pool.Probes < 10 || len(pool.IPs()) != 4 {
+		t.Fatalf("应检测到包含全部轮换 IP 的泛解析池: %+v", pool)
+	}
+	if pool.CNAME != "wildcard.cdn-edge.net" {
+		t.Errorf("应记录泛解析 CNAME: %q", pool.CNAME)
+	}
+
+	dns.cname = map[string]string{"img.example.com": "wildcard.cdn-edge.net."}
+	candidates := map[string][]string{
+		"a.example.com":    {"10.0.0.2", "10.0.0.3"}, // 与某次随机查询不同的 IP 组合
+		"b.example.com":    {"10.0.0.4", "10.0.0.1"},
+		"img.example.com":  {"198.51.100.7"}, // IP 不在池中但 CNAME 与泛解析相同
+		"www.example.com":  {"203.0.113.10"},
+		"mail.example.com": {"10.0.0.4", "203.0.113.20"},
+	}
+	kept := scanner.FilterWildcard(ctx, pool, candidates)
+	if len(kept) != 2 || kept["www.example.com"] == nil || kept["mail.example.com"] == nil {
+		t.Errorf("只应保留真实主机, 实际 %v", kept)
+	}
+	if pool.Filtered() != 3 || scanner.Wildcard("example.com") != pool {
+		t.Errorf("应记录过滤数 3, 实际 %d", pool.Filtered())
+	}
+
+	if wildcard, confidence := pool.Classify([]string{"10.0.0.1"}, ""); !wildcard || confidence <= 0 || confidence > 1 {
+		t.Errorf("池内 IP 应判定为泛解析并给出置信度: %v %.2f", wildcard, confidence)
+	}
+	if wildcard, confidence := pool.Classify(nil, "Wildcard.CDN-edge.net."); !wildcard || confidence != 1 {
+		t.Errorf("CNAME 相同时置信度应为 1: %v %.2f", wildcard, confidence)
+	}
+}
+
+// TestWildcardNotDetected 随机子域名无法解析时不过滤
+func TestWildcardNotDetected(t *testing.T) {
+	printSeparator("无泛解析测试")
+
+	scanner := subdomain.NewActiveScanner(&subdomain.ActiveScannerConfig{WildcardDetection: true}, nil)
+	scanner.SetResolver(func(ctx context.Context, host string) ([]string, error) {
+		if host == "www.example.org" {
+			return []string{"10.0.0.1"}, nil
+		}
+		return nil, errors.New("nxdomain")
+	})
+	scanner.SetCNAMEResolver(func(ctx context.Context, host string) (string, error) { return "", nil })
+
+	pool := scanner.DetectWildcard(context.Background(), "example.org")
+	if pool.Detected() {
+		t.Fatalf("不应检测到泛解析: %+v", pool)
+	}
+	kept := scanner.FilterWildcard(context.Background(), pool, map[string][]string{"www.example.org": {"10.0.0.1"}})
+	if len(kept) != 1 || pool.Filtered() != 0 {
+		t.Errorf("没有泛解析时应保留全部结果: %v", kept)
+	}
+}
+
+// TestWildcardHTTPConfirm HTTP 确认：响应体与随机子域名不同的候选保留
+func TestWildcardHTTPConfirm(t *testing.T) {
+	printSeparator("泛解析 HTTP 确认测试")
+
+	ctx := context.Background()
+	dns := &rotatingWildcardDNS{pool: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}}
+	scanner := newWildcardScanner(dns, true)
+	// 泛解析页面回显主机名，去掉主机名后内容相同
+	scanner.SetBodyHasher(func(ctx context.Context, host string) (string, error) {
+		if host == "shop.example.net" {
+			return subdomain.BodyHash([]byte("<title>Shop</title>"), host), nil
+		}
+		return subdomain.BodyHash([]byte("<h1>"+strings.ToUpper(host)+" parked</h1>"), host), nil
+	})
+
+	pool := scanner.DetectWildcard(ctx, "example.net")
+	if pool.BodyHash == "" {
+		t.Fatal("开启 HTTP 确认时应记录随机子域名的响应体 hash")
+	}
+	kept := scanner.FilterWildcard(ctx, pool, map[string][]string{
+		"shop.example.net": {"10.0.0.1"},
+		"zzz.example.net":  {"10.0.0.2"},
+	})
+	if len(kept) != 1 || kept["shop.example.net"] == nil {
+		t.Errorf("内容不同的候选应保留, 实际 %v", kept)
+	}
+	if pool.Filtered() != 1 || pool.Confirmed() != 1 {
+		t.Errorf("过滤 1 个、HTTP 确认保留 1 个, 实际 %d / %d", pool.Filtered(), pool.Confirmed())
+	}
+}
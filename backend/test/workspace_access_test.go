@@ -0,0 +1,490 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"moongazing/models"
+	"moongazing/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ========== 工作空间成员权限测试 ==========
+
+// memoryWorkspaceMemberStore 内存中的工作空间和成员存储
+type memoryWorkspaceMemberStore struct {
+	mu         sync.Mutex
+	workspaces map[primitive.ObjectID]*models.Workspace
+	members    map[[2]primitive.ObjectID]*models.WorkspaceMember
+}
+
+func newMemoryWorkspaceMemberStore(workspaces ...*models.Workspace) *memoryWorkspaceMemberStore {
+	s := &memoryWorkspaceMemberStore{
+		workspaces: make(map[primitive.ObjectID]*models.Workspace),
+		members:    make(map[[2]primitive.ObjectID]*models.WorkspaceMember),
+	}
+	for _, ws := range workspaces {
+		s.workspaces[ws.ID] = ws
+	}
+	return s
+}
+
+func (s *memoryWorkspaceMemberStore) GetWorkspace(ctx context.Context, workspaceID primitive.ObjectID) (*models.Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[workspaceID]
+	if !ok {
+		return nil, service.ErrWorkspaceNotFound
+	}
+	copied := *ws
+	return &copied, nil
+}
+
+func (s *memoryWorkspaceMemberStore) ListWorkspaces(ctx context.Context, userID primitive.ObjectID) ([]*models.Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*models.Workspace
+	for _, ws := range s.workspaces {
+		match := userID.IsZero() || ws.OwnerID == userID
+		for _, id := range ws.Members {
+			match = match || id == userID
+		}
+		if match {
+			copied := *ws
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryWorkspaceMemberStore) GetMember(ctx context.Context, workspaceID, userID primitive.ObjectID) (*models.WorkspaceMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.members[[2]primitive.ObjectID{workspaceID, userID}]; ok {
+		copied := *m
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryWorkspaceMemberStore) ListMembers(ctx context.Context, workspaceID primitive.ObjectID) ([]*models.WorkspaceMember, error) {
+	return s.filter(func(m *models.WorkspaceMember) bool { return m.WorkspaceID == workspaceID }), nil
+}
+
+func (s *memoryWorkspaceMemberStore) ListMemberships(ctx context.Context, userID primitive.ObjectID) ([]*models.WorkspaceMember, error) {
+	return s.filter(func(m *models.WorkspaceMember) bool { return m.UserID == userID }), nil
+}
+
+func (s *memoryWorkspaceMemberStore) filter(match func(*models.WorkspaceMember) bool) []*models.WorkspaceMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*models.WorkspaceMember
+	for _, m := range s.members {
+		if match(m) {
+			copied := *m
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+func (s *memoryWorkspaceMemberStore) SaveMember(ctx context.Context, member *models.WorkspaceMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]primitive.ObjectID{member.WorkspaceID, member.UserID}
+	copied := *member
+	if existing, ok := s.members[key]; ok {
+		copied.ID = existing.ID
+		copied.CreatedAt = existing.CreatedAt
+	} else {
+		copied.ID = primitive.NewObjectID()
+	}
+	s.members[key] = &copied
+	return nil
+}
+
+func (s *memoryWorkspaceMemberStore) EnsureMember(ctx context.Context, member *models.WorkspaceMember) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]primitive.ObjectID{member.WorkspaceID, member.UserID}
+	if _, ok := s.members[key]; ok {
+		return false, nil
+	}
+	copied := *member
+	copied.ID = primitive.NewObjectID()
+	s.members[key] = &copied
+	return true, nil
+}
+
+func (s *memoryWorkspaceMemberStore) DeleteMember(ctx context.Context, workspaceID, userID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]primitive.ObjectID{workspaceID, userID}
+	_, deleted := s.members[key]
+	delete(s.members, key)
+	if ws, ok := s.workspaces[workspaceID]; ok {
+		var kept []primitive.ObjectID
+		for _, id := range ws.Members {
+			if id == userID {
+				deleted = true
+				continue
+			}
+			kept = append(kept, id)
+		}
+		ws.Members = kept
+	}
+	return deleted, nil
+}
+
+// workspaceAccessFixture 两个工作空间：ws 有 owner、editor、viewer 成员，other 只属于 outsider
+type workspaceAccessFixture struct {
+	store                           *memoryWorkspaceMemberStore
+	access                          *service.WorkspaceAccess
+	ws, other                       primitive.ObjectID
+	owner, editor, viewer, outsider primitive.ObjectID
+}
+
+func newWorkspaceAccessFixture(t *testing.T) *workspaceAccessFixture {
+	f := &workspaceAccessFixture{
+		ws: primitive.NewObjectID(), other: primitive.NewObjectID(),
+		owner: primitive.NewObjectID(), editor: primitive.NewObjectID(),
+		viewer: primitive.NewObjectID(), outsider: primitive.NewObjectID(),
+	}
+	f.store = newMemoryWorkspaceMemberStore(
+		&models.Workspace{ID: f.ws, Name: "red-team", OwnerID: f.owner},
+		&models.Workspace{ID: f.other, Name: "blue-team", OwnerID: f.outsider},
+	)
+	f.access = service.NewWorkspaceAccessWithStore(f.store)
+	for id, role := range map[primitive.ObjectID]models.WorkspaceRole{
+		f.editor: models.WorkspaceRoleEditor,
+		f.viewer: models.WorkspaceRoleViewer,
+	} {
+		if _, err := f.access.SetMember(f.ws, id, role, f.owner, "user"); err != nil {
+			t.Fatalf("所有者邀请成员失败: %v", err)
+		}
+	}
+	return f
+}
+
+// TestWorkspaceViewerCannotDelete 只读成员可以查看但不能删除任务和结果
+func TestWorkspaceViewerCannotDelete(t *testing.T) {
+	printSeparator("只读成员删除测试")
+	f := newWorkspaceAccessFixture(t)
+	task := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: f.ws}
+
+	if err := f.access.AuthorizeTask(task, f.viewer, "user", models.WorkspaceRoleViewer); err != nil {
+		t.Errorf("只读成员应可以查看任务: %v", err)
+	}
+	err := f.access.AuthorizeTask(task, f.viewer, "viewer", models.WorkspaceRoleEditor)
+	if !errors.Is(err, service.ErrWorkspaceForbidden) || !errors.Is(err, service.ErrWorkspaceReadOnly) {
+		t.Errorf("只读成员删除任务应被拒绝，实际 %v", err)
+	}
+	if f.access.CanEditWorkspace(f.ws, f.viewer, "user") || !f.access.CanViewWorkspace(f.ws, f.viewer, "user") {
+		t.Error("只读成员只能查看工作空间")
+	}
+}
+
+// TestWorkspaceEditorExport 编辑成员可以导出和修改结果，但不能管理成员
+func TestWorkspaceEditorExport(t *testing.T) {
+	printSeparator("编辑成员导出测试")
+	f := newWorkspaceAccessFixture(t)
+	task := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: f.ws}
+
+	if err := f.access.AuthorizeTask(task, f.editor, "user", models.WorkspaceRoleViewer); err != nil {
+		t.Errorf("编辑成员应可以导出结果: %v", err)
+	}
+	if err := f.access.AuthorizeTask(task, f.editor, "user", models.WorkspaceRoleEditor); err != nil {
+		t.Errorf("编辑成员应可以删除结果: %v", err)
+	}
+	_, err := f.access.SetMember(f.ws, f.outsider, models.WorkspaceRoleViewer, f.editor, "user")
+	if !errors.Is(err, service.ErrWorkspaceOwnerRequired) {
+		t.Errorf("编辑成员不能邀请成员，实际 %v", err)
+	}
+}
+
+// TestWorkspaceCrossProbing 其他工作空间和不存在的工作空间的任务都按不存在处理，不泄露任务是否存在
+func TestWorkspaceCrossProbing(t *testing.T) {
+	printSeparator("跨工作空间探测测试")
+	f := newWorkspaceAccessFixture(t)
+	foreign := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: f.other}
+	orphan := &models.Task{ID: primitive.NewObjectID(), WorkspaceID: primitive.NewObjectID()}
+
+	for name, task := range map[string]*models.Task{"其他工作空间": foreign, "不存在的工作空间": orphan, "不存在的任务": nil} {
+		for _, need := range []models.WorkspaceRole{models.WorkspaceRoleViewer, models.WorkspaceRoleEditor} {
+			err := f.access.AuthorizeTask(task, f.owner, "user", need)
+			if err != service.ErrTaskNotFound {
+				t.Errorf("%s的任务应返回任务不存在（%s），实际 %v", name, need, err)
+			}
+		}
+	}
+	if err := f.access.AuthorizeTask(foreign, f.owner, "", models.WorkspaceRoleViewer); err != service.ErrTaskNotFound {
+		t.Errorf("没有角色的请求应返回任务不存在，实际 %v", err)
+	}
+
+	// 管理员可以访问所有工作空间，默认空间对所有用户开放
+	if err := f.access.AuthorizeTask(foreign, f.viewer, "admin", models.WorkspaceRoleEditor); err != nil {
+		t.Errorf("管理员应可以修改任意工作空间的任务: %v", err)
+	}
+	if err := f.access.AuthorizeTask(&models.Task{}, f.viewer, "user", models.WorkspaceRoleEditor); err != nil {
+		t.Errorf("默认空间的任务应对所有用户开放: %v", err)
+	}
+}
+
+// TestWorkspaceLegacyMembers 没有成员记录时 owner_id 视为所有者，members 视为编辑成员
+func TestWorkspaceLegacyMembers(t *testing.T) {
+	printSeparator("旧版工作空间成员测试")
+	owner, member := primitive.NewObjectID(), primitive.NewObjectID()
+	ws := &models.Workspace{ID: primitive.NewObjectID(), OwnerID: owner, Members: []primitive.ObjectID{member}}
+	access := service.NewWorkspaceAccessWithStore(newMemoryWorkspaceMemberStore(ws))
+
+	if role, _ := access.WorkspaceRole(ws.ID, owner, "user"); role != models.WorkspaceRoleOwner {
+		t.Errorf("owner_id 应为所有者，实际 %q", role)
+	}
+	if role, _ := access.WorkspaceRole(ws.ID, member, "user"); role != models.WorkspaceRoleEditor {
+		t.Errorf("members 应为编辑成员，实际 %q", role)
+	}
+
+	ids, all, err := access.VisibleWorkspaceIDs(member, "user")
+	if err != nil || all || len(ids) != 2 || ids[0] != primitive.NilObjectID || ids[1] != ws.ID {
+		t.Errorf("可见工作空间应为默认空间和旧版工作空间: %v all=%v err=%v", ids, all, err)
+	}
+	if err := access.RemoveMember(ws.ID, member, owner, "user"); err != nil {
+		t.Fatalf("移除旧版成员失败: %v", err)
+	}
+	if access.CanViewWorkspace(ws.ID, member, "user") {
+		t.Error("移除后旧版成员不应再能查看")
+	}
+	if _, all, _ := access.VisibleWorkspaceIDs(member, "admin"); !all {
+		t.Error("管理员应可以查看全部工作空间")
+	}
+}
+
+// TestWorkspaceMemberManagement 邀请、修改角色和移除成员
+func TestWorkspaceMemberManagement(t *testing.T) {
+	printSeparator("工作空间成员管理测试")
+	f := newWorkspaceAccessFixture(t)
+
+	if _, err := f.access.SetMember(f.ws, f.outsider, models.WorkspaceRoleViewer, f.viewer, "user"); !errors.Is(err, service.ErrWorkspaceForbidden) {
+		t.Errorf("只读成员不能邀请成员，实际 %v", err)
+	}
+	if _, err := f.access.SetMember(f.ws, f.outsider, "admin", f.owner, "user"); err != service.ErrInvalidWorkspaceRole {
+		t.Errorf("无效角色应被拒绝，实际 %v", err)
+	}
+	if _, err := f.access.SetMember(primitive.NilObjectID, f.outsider, models.WorkspaceRoleViewer, f.owner, "admin"); err != service.ErrDefaultWorkspaceMembers {
+		t.Errorf("默认空间不能设置成员，实际 %v", err)
+	}
+
+	// 创建者是唯一的所有者，不能降级；提升编辑成员后可以
+	if _, err := f.access.SetMember(f.ws, f.owner, models.WorkspaceRoleViewer, f.owner, "user"); err != service.ErrLastWorkspaceOwner {
+		t.Errorf("不能降级最后一个所有者，实际 %v", err)
+	}
+	if _, err := f.access.SetMember(f.ws, f.editor, models.WorkspaceRoleOwner, f.owner, "user"); err != nil {
+		t.Fatalf("提升编辑成员失败: %v", err)
+	}
+	member, err := f.access.SetMember(f.ws, f.owner, models.WorkspaceRoleViewer, f.editor, "user")
+	if err != nil || member.InvitedBy != f.editor {
+		t.Fatalf("有其他所有者时应可以降级创建者: %v", err)
+	}
+	if f.access.CanEditWorkspace(f.ws, f.owner, "user") {
+		t.Error("成员记录应优先于 owner_id")
+	}
+
+	if err := f.access.RemoveMember(f.ws, f.owner, f.editor, "user"); err != service.ErrWorkspaceCreatorRemove {
+		t.Errorf("不能移除创建者，实际 %v", err)
+	}
+	if err := f.access.RemoveMember(f.ws, f.editor, f.editor, "user"); err != service.ErrLastWorkspaceOwner {
+		t.Errorf("不能移除最后一个所有者，实际 %v", err)
+	}
+	if err := f.access.RemoveMember(f.ws, f.viewer, f.editor, "user"); err != nil {
+		t.Fatalf("移除只读成员失败: %v", err)
+	}
+	if err := f.access.RemoveMember(f.ws, f.viewer, f.editor, "user"); err != service.ErrWorkspaceMemberNotFound {
+		t.Errorf("重复移除应返回成员不存在，实际 %v", err)
+	}
+
+	members, err := f.access.ListMembers(f.ws, f.owner, "user")
+	if err != nil || len(members) != 2 {
+		t.Errorf("应剩余 2 个成员记录: %d err=%v", len(members), err)
+	}
+	if _, err := f.access.ListMembers(f.ws, f.outsider, "user"); err != service.ErrWorkspaceForbidden {
+		t.Errorf("非成员不能查看成员列表，实际 %v", err)
+	}
+}
+
+// TestWorkspaceGrantOwners 启动时为管理员补齐 owner 记录，可以重复执行，不覆盖已有角色
+func TestWorkspaceGrantOwners(t *testing.T) {
+	printSeparator("管理员工作空间授权测试")
+	f := newWorkspaceAccessFixture(t)
+	admin := f.viewer
+
+	granted, err := f.access.GrantOwnerOnAllWorkspaces(context.Background(), admin)
+	if err != nil || granted != 1 {
+		t.Fatalf("应只为 other 新增 owner 记录: granted=%d err=%v", granted, err)
+	}
+	if role, _ := f.access.WorkspaceRole(f.other, admin, "user"); role != models.WorkspaceRoleOwner {
+		t.Errorf("应为所有者，实际 %q", role)
+	}
+	if role, _ := f.access.WorkspaceRole(f.ws, admin, "user"); role != models.WorkspaceRoleViewer {
+		t.Errorf("已有的成员角色不应被覆盖，实际 %q", role)
+	}
+	if granted, _ := f.access.GrantOwnerOnAllWorkspaces(context.Background(), admin); granted != 0 {
+		t.Errorf("重复执行不应新增记录，实际 %d", granted)
+	}
+}
+
+// TestTaskListFilterWorkspaces 未指定工作空间时只查询可见工作空间（包括没有 workspace_id 的旧任务）
+func TestTaskListFilterWorkspaces(t *testing.T) {
+	printSeparator("任务列表工作空间过滤测试")
+	ws := primitive.NewObjectID()
+	ids := []primitive.ObjectID{primitive.NilObjectID, ws}
+
+	query := service.TaskListFilter{WorkspaceIDs: ids}.BSON()
+	or, ok := query["$or"].([]bson.M)
+	if !ok || len(or) != 2 {
+		t.Fatalf("应按可见工作空间过滤: %v", query)
+	}
+	if in, _ := or[0]["workspace_id"].(bson.M); in == nil {
+		t.Errorf("缺少 workspace_id $in 条件: %v", or)
+	}
+
+	query = service.TaskListFilter{WorkspaceID: ws.Hex(), WorkspaceIDs: ids}.BSON()
+	if _, ok := query["$or"]; ok || query["workspace_id"] != ws {
+		t.Errorf("指定工作空间时只按该工作空间过滤: %v", query)
+	}
+	if query := (service.TaskListFilter{}).BSON(); len(query) != 0 {
+		t.Errorf("管理员查询不应过滤工作空间: %v", query)
+	}
+}
+
+// TestVulnListFilterWorkspaces 仪表盘未指定工作空间时漏洞只按可见工作空间过滤，关键字条件不受影响
+func TestVulnListFilterWorkspaces(t *testing.T) {
+	printSeparator("漏洞列表工作空间过滤测试")
+	ws := primitive.NewObjectID()
+	ids := []primitive.ObjectID{primitive.NilObjectID, ws}
+
+	query := service.VulnListFilter{WorkspaceIDs: ids, Keyword: "sql"}.BSON()
+	in, ok := query["workspace_id"].(bson.M)
+	if !ok || len(in["$in"].([]primitive.ObjectID)) != 2 {
+		t.Fatalf("应按可见工作空间过滤: %v", query)
+	}
+	if or, _ := query["$or"].([]bson.M); len(or) != 3 {
+		t.Errorf("关键字条件丢失: %v", query)
+	}
+
+	query = service.VulnListFilter{WorkspaceID: ws.Hex(), WorkspaceIDs: ids}.BSON()
+	if query["workspace_id"] != ws {
+		t.Errorf("指定工作空间时只按该工作空间过滤: %v", query)
+	}
+	if query := (service.VulnListFilter{}).BSON(); len(query) != 0 {
+		t.Errorf("管理员查询不应过滤工作空间: %v", query)
+	}
+}
+
+// TestTaskTemplateAccess 公开模板和内置模板所有用户可用，私有模板只对所在工作空间的成员可见
+func TestTaskTemplateAccess(t *testing.T) {
+	printSeparator("任务模板权限测试")
+	f := newWorkspaceAccessFixture(t)
+	private := &models.TaskTemplate{ID: primitive.NewObjectID(), WorkspaceID: f.ws}
+
+	if err := f.access.AuthorizeTemplate(private, f.viewer, "user"); err != nil {
+		t.Errorf("成员应可以使用工作空间的模板: %v", err)
+	}
+	if err := f.access.AuthorizeTemplate(private, f.outsider, "user"); !errors.Is(err, service.ErrTaskTemplateNotFound) {
+		t.Errorf("其他工作空间的私有模板应按不存在处理，实际 %v", err)
+	}
+	for _, template := range []*models.TaskTemplate{
+		{WorkspaceID: f.ws, IsPublic: true},
+		{WorkspaceID: f.ws, BuiltIn: true},
+		{},
+	} {
+		if err := f.access.AuthorizeTemplate(template, f.outsider, "user"); err != nil {
+			t.Errorf("公开、内置和默认空间的模板应所有用户可用: %v", err)
+		}
+	}
+
+	// 只读成员可以看到模板，但不能在工作空间中创建后续任务
+	if err := f.access.AuthorizeFollowUpTarget(f.ws, private, f.viewer, "user"); !errors.Is(err, service.ErrWorkspaceReadOnly) {
+		t.Errorf("只读成员不能创建后续任务，实际 %v", err)
+	}
+	if err := f.access.AuthorizeFollowUpTarget(f.other, nil, f.editor, "user"); !errors.Is(err, service.ErrWorkspaceNotFound) {
+		t.Errorf("其他工作空间应按不存在处理，实际 %v", err)
+	}
+}
+
+// TestWorkspaceSettingsAccess 修改工作空间设置需要编辑权限，不是成员的工作空间按不存在处理
+func TestWorkspaceSettingsAccess(t *testing.T) {
+	printSeparator("工作空间设置权限测试")
+	f := newWorkspaceAccessFixture(t)
+
+	if err := f.access.AuthorizeVisible(f.ws, f.viewer, "user", models.WorkspaceRoleViewer); err != nil {
+		t.Errorf("只读成员应可以查看设置: %v", err)
+	}
+	if err := f.access.AuthorizeVisible(f.ws, f.viewer, "user", models.WorkspaceRoleEditor); !errors.Is(err, service.ErrWorkspaceReadOnly) {
+		t.Errorf("只读成员修改设置应被拒绝，实际 %v", err)
+	}
+	if err := f.access.AuthorizeVisible(f.ws, f.editor, "user", models.WorkspaceRoleEditor); err != nil {
+		t.Errorf("编辑成员应可以修改设置: %v", err)
+	}
+	for _, need := range []models.WorkspaceRole{models.WorkspaceRoleViewer, models.WorkspaceRoleEditor} {
+		if err := f.access.AuthorizeVisible(f.other, f.viewer, "user", need); !errors.Is(err, service.ErrWorkspaceNotFound) || errors.Is(err, service.ErrWorkspaceForbidden) {
+			t.Errorf("不是成员的工作空间应按不存在处理，实际 %v", err)
+		}
+	}
+	if err := f.access.AuthorizeVisible(primitive.NewObjectID(), f.editor, "user", models.WorkspaceRoleViewer); !errors.Is(err, service.ErrWorkspaceNotFound) {
+		t.Errorf("不存在的工作空间应返回不存在，实际 %v", err)
+	}
+	if err := f.access.AuthorizeVisible(f.other, f.viewer, "admin", models.WorkspaceRoleEditor); err != nil {
+		t.Errorf("管理员可以修改任意工作空间: %v", err)
+	}
+}
+
+// TestCruiseWorkspaceAccess 巡航任务按所在工作空间校验权限，其他工作空间的巡航任务按不存在处理
+func TestCruiseWorkspaceAccess(t *testing.T) {
+	printSeparator("巡航任务工作空间权限测试")
+	f := newWorkspaceAccessFixture(t)
+	cruise := &models.CruiseTask{ID: primitive.NewObjectID(), WorkspaceID: f.ws}
+	foreign := &models.CruiseTask{ID: primitive.NewObjectID(), WorkspaceID: f.other}
+
+	if err := f.access.AuthorizeCruise(cruise, f.viewer, "user", models.WorkspaceRoleViewer); err != nil {
+		t.Errorf("只读成员应可以查看巡航任务和日志: %v", err)
+	}
+	if err := f.access.AuthorizeCruise(cruise, f.viewer, "user", models.WorkspaceRoleEditor); !errors.Is(err, service.ErrWorkspaceReadOnly) {
+		t.Errorf("只读成员不能修改或立即执行巡航任务，实际 %v", err)
+	}
+	if err := f.access.AuthorizeCruise(cruise, f.editor, "user", models.WorkspaceRoleEditor); err != nil {
+		t.Errorf("编辑成员应可以修改巡航任务: %v", err)
+	}
+	for _, c := range []*models.CruiseTask{foreign, nil} {
+		if err := f.access.AuthorizeCruise(c, f.editor, "user", models.WorkspaceRoleViewer); err != service.ErrCruiseNotFound {
+			t.Errorf("其他工作空间的巡航任务应返回不存在，实际 %v", err)
+		}
+	}
+}
+
+// TestCruiseListFilterWorkspaces 巡航任务列表未指定工作空间时只查询可见工作空间，搜索条件同时生效
+func TestCruiseListFilterWorkspaces(t *testing.T) {
+	printSeparator("巡航任务列表工作空间过滤测试")
+	ws := primitive.NewObjectID()
+	ids := []primitive.ObjectID{primitive.NilObjectID, ws}
+
+	query := service.CruiseListFilter{WorkspaceIDs: ids, Search: "daily"}.BSON()
+	and, ok := query["$and"].([]bson.M)
+	if !ok || len(and) != 2 {
+		t.Fatalf("可见工作空间和搜索条件应同时生效: %v", query)
+	}
+	if or, _ := and[0]["$or"].([]bson.M); len(or) != 2 {
+		t.Errorf("缺少可见工作空间条件: %v", and[0])
+	}
+
+	query = service.CruiseListFilter{WorkspaceID: ws, WorkspaceIDs: ids}.BSON()
+	if query["workspace_id"] != ws {
+		t.Errorf("指定工作空间时只按该工作空间过滤: %v", query)
+	}
+	if query := (service.CruiseListFilter{}).BSON(); len(query) != 0 {
+		t.Errorf("管理员查询不应过滤工作空间: %v", query)
+	}
+}